@@ -0,0 +1,72 @@
+// import-properties 将旧版本地SQLite属性库（properties.db）一次性导入主PostgreSQL数据库。
+//
+// 用法：
+//
+//	import-properties -sqlite ./data/properties.db [-dry-run]
+//
+// PostgreSQL连接参数与服务端相同（config.yaml 或 POSTGRES_* 环境变量）。
+// 已存在的属性（user_id, path, namespace, name相同）会被跳过，可重复执行。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+
+	_ "github.com/lib/pq"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+func main() {
+	sqlitePath := flag.String("sqlite", "", "path to the SQLite properties database (defaults to properties.sqlite_path)")
+	dryRun := flag.Bool("dry-run", false, "only count the properties that would be imported")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *sqlitePath == "" {
+		*sqlitePath = cfg.Properties.SQLitePath
+	}
+
+	ctx := context.Background()
+
+	source, err := webdav.NewPropertyService(*sqlitePath)
+	if err != nil {
+		log.Fatalf("Failed to open SQLite properties: %v", err)
+	}
+	defer source.Close()
+
+	props, err := source.ExportProperties(ctx)
+	if err != nil {
+		log.Fatalf("Failed to read SQLite properties: %v", err)
+	}
+	log.Printf("Read %d properties from %s", len(props), *sqlitePath)
+
+	if *dryRun {
+		return
+	}
+
+	db, err := sql.Open("postgres", cfg.PostgresDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatalf("Failed to ping database: %v", err)
+	}
+
+	target := webdav.NewPropertyServiceWithDB(db, webdav.DialectPostgres)
+	defer target.Close()
+
+	imported, err := target.ImportProperties(ctx, props)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	log.Printf("Imported %d properties, skipped %d already present", imported, len(props)-imported)
+}
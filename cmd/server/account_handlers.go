@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/account"
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/jobs"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// jobKindAccountExport 个人数据导出任务
+const jobKindAccountExport = "account_export"
+
+// accountErrorStatus 账户注销错误对应的状态码
+func accountErrorStatus(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, account.ErrNotFound):
+		return http.StatusNotFound, gin.H{"error": "account not found"}
+	case errors.Is(err, account.ErrNotScheduled):
+		return http.StatusConflict, gin.H{"error": err.Error(), "code": "deletion_not_scheduled"}
+	default:
+		log.Printf("Warning: account request failed: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "failed to process account request"}
+	}
+}
+
+// handleDeleteAccount 注销当前账户，请求体中的confirm必须与用户名一致。
+// 账户立即停用，宽限期过后删除全部数据
+func handleDeleteAccount(accounts *account.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, username, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Confirm string `json:"confirm" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Confirm != username {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "confirm must match the username", "code": "confirmation_mismatch"})
+			return
+		}
+
+		deletion, err := accounts.ScheduleDeletion(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(accountErrorStatus(err))
+			return
+		}
+		log.Printf("User %s requested account deletion, data will be removed after %s", username, deletion.PurgeAfter.Format(time.RFC3339))
+		c.JSON(http.StatusAccepted, deletion)
+	}
+}
+
+// handleExportAccount 提交个人数据导出任务，压缩包保存在account.export_folder中
+func handleExportAccount(accounts *account.Service, jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		submitJob(c, jobManager, userID, jobKindAccountExport, accountExportPayload{Target: accounts.ExportTarget(time.Now())})
+	}
+}
+
+// handleListAccountDeletions 管理员查看计划中的账户删除
+func handleListAccountDeletions(accounts *account.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deletions, err := accounts.ListDeletions(c.Request.Context())
+		if err != nil {
+			c.JSON(accountErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deletions": deletions})
+	}
+}
+
+// handleRestoreAccount 管理员在宽限期内恢复已注销的账户
+func handleRestoreAccount(accounts *account.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		if err := accounts.CancelDeletion(c.Request.Context(), userID); err != nil {
+			c.JSON(accountErrorStatus(err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// accountExportPayload 个人数据导出任务的参数
+type accountExportPayload struct {
+	Target string `json:"target"`
+}
+
+// accountExportResult 个人数据导出任务的结果
+type accountExportResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	account.ExportStats
+}
+
+// newAccountExportJobRunner 后台把用户的全部文件和元数据打包保存到用户空间，压缩包计入用量
+func newAccountExportJobRunner(accounts *account.Service, storageService *storage.Service, authService *auth.Service) jobs.Runner {
+	return func(ctx context.Context, job *jobs.Job, progress func(jobs.Progress)) (interface{}, error) {
+		var payload accountExportPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, err
+		}
+
+		if _, err := storageService.StatObject(ctx, job.UserID, payload.Target); err == nil {
+			return nil, fmt.Errorf("%w: %s", errExportTargetExists, payload.Target)
+		}
+
+		// 压缩包最大与已存储的文件一样大
+		user, err := authService.GetUserByID(ctx, job.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if 2*user.StorageUsed > user.StorageQuota {
+			return nil, errExportQuotaExceeded
+		}
+
+		progress(jobs.Progress{Message: "exporting"})
+		var stats *account.ExportStats
+		pr, pw := io.Pipe()
+		go func() {
+			var err error
+			stats, err = accounts.Export(ctx, job.UserID, pw, func(done, total int) {
+				progress(jobs.Progress{Done: int64(done), Total: int64(total), Message: "exporting"})
+			})
+			pw.CloseWithError(err)
+		}()
+		err = storageService.PutObject(ctx, job.UserID, payload.Target, pr, -1, "application/zip")
+		pr.CloseWithError(err)
+		if err != nil {
+			// 不完整的导出不保留
+			storageService.DeleteObject(context.WithoutCancel(ctx), job.UserID, payload.Target)
+			return nil, err
+		}
+
+		info, err := storageService.StatObject(ctx, job.UserID, payload.Target)
+		if err != nil {
+			return nil, err
+		}
+		authService.UpdateStorageUsed(ctx, job.UserID, info.Size)
+		return accountExportResult{Path: payload.Target, Size: info.Size, ExportStats: *stats}, nil
+	}
+}
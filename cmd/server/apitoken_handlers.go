@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/apitoken"
+	"github.com/webdav-gateway/internal/audit"
+)
+
+// apiTokenResponse 创建和轮换时的响应，明文令牌只返回这一次
+type apiTokenResponse struct {
+	*apitoken.Token
+	Secret string `json:"token"`
+}
+
+// apiTokenErrorStatus 个人访问令牌错误对应的状态码
+func apiTokenErrorStatus(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, apitoken.ErrNotFound):
+		return http.StatusNotFound, gin.H{"error": "api token not found"}
+	case errors.Is(err, apitoken.ErrInvalidName), errors.Is(err, apitoken.ErrInvalidScope),
+		errors.Is(err, apitoken.ErrNoScopes), errors.Is(err, apitoken.ErrLifetimeTooLong):
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	case errors.Is(err, apitoken.ErrTooManyTokens):
+		return http.StatusConflict, gin.H{"error": err.Error(), "code": "too_many_tokens"}
+	default:
+		log.Printf("Warning: api token request failed: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "failed to process api token request"}
+	}
+}
+
+// apiTokenIDParam 读取路径参数中的令牌ID
+func apiTokenIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// auditAPIToken 在审计记录中补充令牌ID和名称
+func auditAPIToken(c *gin.Context, token *apitoken.Token) {
+	c.Set(audit.DetailsKey, map[string]string{"token_id": token.ID.String(), "token_name": token.Name})
+}
+
+// handleListAPITokens 列出当前用户的令牌及最近使用情况
+func handleListAPITokens(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		list, err := tokens.List(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": list})
+	}
+}
+
+// handleCreateAPIToken 创建令牌，expires_in为有效期秒数，省略或为0时永不过期
+func handleCreateAPIToken(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Name      string   `json:"name" binding:"required"`
+			Scopes    []string `json:"scopes" binding:"required"`
+			ExpiresIn int64    `json:"expires_in"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, secret, err := tokens.Create(c.Request.Context(), userID, apitoken.CreateRequest{
+			Name:      req.Name,
+			Scopes:    req.Scopes,
+			ExpiresIn: time.Duration(req.ExpiresIn) * time.Second,
+		})
+		if err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		auditAPIToken(c, token)
+		c.JSON(http.StatusCreated, apiTokenResponse{Token: token, Secret: secret})
+	}
+}
+
+// handleRotateAPIToken 为令牌生成新的明文，旧明文立即失效
+func handleRotateAPIToken(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		id, ok := apiTokenIDParam(c)
+		if !ok {
+			return
+		}
+		token, secret, err := tokens.Rotate(c.Request.Context(), userID, id)
+		if err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		auditAPIToken(c, token)
+		c.JSON(http.StatusOK, apiTokenResponse{Token: token, Secret: secret})
+	}
+}
+
+// handleRevokeAPIToken 吊销当前用户的令牌
+func handleRevokeAPIToken(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		id, ok := apiTokenIDParam(c)
+		if !ok {
+			return
+		}
+		if err := tokens.Revoke(c.Request.Context(), userID, id); err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		c.Set(audit.DetailsKey, map[string]string{"token_id": id.String()})
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleListAllAPITokens 管理员列出所有用户未吊销的令牌，用于安全审查
+func handleListAllAPITokens(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := tokens.ListAll(c.Request.Context())
+		if err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": list})
+	}
+}
+
+// handleAdminRevokeAPIToken 管理员吊销任意用户的令牌
+func handleAdminRevokeAPIToken(tokens *apitoken.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := apiTokenIDParam(c)
+		if !ok {
+			return
+		}
+		if err := tokens.Revoke(c.Request.Context(), uuid.Nil, id); err != nil {
+			c.JSON(apiTokenErrorStatus(err))
+			return
+		}
+		c.Set(audit.DetailsKey, map[string]string{"token_id": id.String()})
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/audit"
+)
+
+// maxAuditLimit 单次查询返回的最大事件数
+const maxAuditLimit = 1000
+
+// handleListAuditEvents 按时间范围、操作者和动作查询审计记录，按时间倒序返回，
+// 通过next_before_id翻页
+func handleListAuditEvents(auditLogger *audit.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := audit.Query{
+			Actor:  c.Query("actor"),
+			Action: c.Query("action"),
+			Limit:  100,
+		}
+		for _, bound := range []struct {
+			name string
+			dst  **time.Time
+		}{{"from", &q.From}, {"to", &q.To}} {
+			if v := c.Query(bound.name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be an RFC 3339 timestamp"})
+					return
+				}
+				*bound.dst = &t
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			if limit > maxAuditLimit {
+				limit = maxAuditLimit
+			}
+			q.Limit = limit
+		}
+		if v := c.Query("before_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before_id"})
+				return
+			}
+			q.BeforeID = id
+		}
+
+		events, err := auditLogger.Search(c.Request.Context(), q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query audit events"})
+			return
+		}
+
+		resp := gin.H{"events": events}
+		if len(events) == q.Limit {
+			resp["next_before_id"] = events[len(events)-1].ID
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
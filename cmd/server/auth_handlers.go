@@ -1,23 +1,59 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/webdav-gateway/internal/audit"
 	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/loginalert"
+	"github.com/webdav-gateway/internal/middleware"
 	"github.com/webdav-gateway/internal/models"
 	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/tenant"
+	"github.com/webdav-gateway/internal/twofactor"
 )
 
-func handleRegister(authService *auth.Service) gin.HandlerFunc {
+// reservedUsername 判断用户名是否在auth.admins中。管理员按用户名授权，
+// 开放注册时这些用户名不能被自行注册，否则先注册的人就成了管理员
+func reservedUsername(admins []string, username string) bool {
+	for _, name := range admins {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(username)) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleRegister(authService *auth.Service, tenants *tenant.Service, admins []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.UserCreateRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// Admin names are created by the operator, never through self-registration;
+		// report them like a taken name so the admin list is not disclosed
+		if reservedUsername(admins, req.Username) {
+			c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
+			return
+		}
+
+		// Users registering on a tenant's address become members of that tenant
+		var owner *tenant.Tenant
+		if tenants != nil {
+			t, ok := requestTenant(c, tenants)
+			if !ok {
+				return
+			}
+			owner = t
+		}
 
 		user, err := authService.Register(c.Request.Context(), &req)
 		if err != nil {
@@ -29,17 +65,25 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
+		if owner != nil {
+			if err := tenants.AddMember(c.Request.Context(), owner.ID, user.ID, tenant.RoleMember); err != nil {
+				tenantError(c, err, "failed to register user")
+				return
+			}
+		}
+
 		c.JSON(http.StatusCreated, user)
 	}
 }
 
-func handleLogin(authService *auth.Service, storageService *storage.Service) gin.HandlerFunc {
+func handleLogin(authService *auth.Service, storageService *storage.Service, alerts *loginalert.Service, twoFactor *twofactor.Service, tenants *tenant.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.UserLoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		c.Set(audit.ActorKey, req.Username)
 
 		resp, err := authService.Login(c.Request.Context(), &req)
 		if err != nil {
@@ -51,14 +95,94 @@ func handleLogin(authService *auth.Service, storageService *storage.Service) gin
 			return
 		}
 
-		// Ensure user bucket exists
-		if err := storageService.EnsureBucket(c.Request.Context(), resp.User.ID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to setup storage"})
-			return
+		if tenants != nil {
+			// Credentials are only valid on the address of the user's own tenant
+			ok, err := loginTenantMatches(c, tenants, resp.User.ID)
+			if err != nil {
+				log.Printf("Warning: failed to resolve tenant of %s: %v", resp.User.Username, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+				return
+			}
 		}
 
-		c.JSON(http.StatusOK, resp)
+		if alerts != nil {
+			// Accounts flagged via "this wasn't me" stay locked until the password is reset
+			required, err := alerts.PasswordResetRequired(c.Request.Context(), resp.User.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+				return
+			}
+			if required {
+				c.JSON(http.StatusForbidden, gin.H{"error": "password reset required", "code": "password_reset_required"})
+				return
+			}
+		}
+
+		if twoFactor != nil {
+			// The password alone never yields a token once a second factor is enabled or required
+			requirement, err := twoFactor.LoginRequirement(c.Request.Context(), resp.User.ID, resp.User.Username)
+			if err != nil {
+				log.Printf("Warning: failed to check two-factor status for %s: %v", resp.User.Username, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+				return
+			}
+			if requirement != twofactor.RequirementNone {
+				challenge, err := twoFactor.BeginChallenge(c.Request.Context(), resp.User.ID, requirement)
+				if err != nil {
+					log.Printf("Warning: failed to create two-factor challenge for %s: %v", resp.User.Username, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{
+					"two_factor_required": true,
+					"enrollment_required": challenge.Enroll,
+					"mfa_token":           challenge.Token,
+					"expires_at":          challenge.ExpiresAt,
+				})
+				return
+			}
+		}
+
+		completeLogin(c, resp.User, resp, authService, storageService, alerts)
+	}
+}
+
+// completeLogin 所有认证步骤通过后记录登录指纹、准备存储桶，并以body（含令牌）响应
+func completeLogin(c *gin.Context, user *models.User, body interface{}, authService *auth.Service, storageService *storage.Service, alerts *loginalert.Service) {
+	if alerts != nil {
+		event := loginalert.LoginEvent{
+			UserID:    user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			DeviceID:  c.GetHeader(HeaderDeviceID),
+		}
+		if header := alerts.CountryHeader(); header != "" {
+			event.Country = c.GetHeader(header)
+		}
+		// Fingerprinting problems must not block the login itself
+		if _, err := alerts.RecordLogin(c.Request.Context(), event); err != nil {
+			log.Printf("Warning: failed to record login fingerprint for %s: %v", user.Username, err)
+		}
+	}
+
+	// Ensure user bucket exists
+	if err := storageService.EnsureBucket(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to setup storage"})
+		return
+	}
+
+	// Warn clients whose clock is off before their tokens start failing
+	if skew, ok := middleware.ClientClockSkew(c, time.Now()); ok && skew.Abs() > authService.ClockSkew() {
+		c.Header("X-Clock-Skew", strconv.FormatInt(int64(skew.Seconds()), 10))
 	}
+
+	c.JSON(http.StatusOK, body)
 }
 
 func handleGetMe(authService *auth.Service) gin.HandlerFunc {
@@ -78,4 +202,22 @@ func handleGetMe(authService *auth.Service) gin.HandlerFunc {
 
 		c.JSON(http.StatusOK, user)
 	}
-}
\ No newline at end of file
+}
+
+// handleGetServerTime 返回服务器时间，客户端上报本地时间时附带偏差
+func handleGetServerTime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		resp := gin.H{
+			"time":    now.UTC().Format(time.RFC3339Nano),
+			"unix":    now.Unix(),
+			"unix_ms": now.UnixMilli(),
+		}
+		if skew, ok := middleware.ClientClockSkew(c, now); ok {
+			resp["skew_seconds"] = int64(skew.Seconds())
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, resp)
+	}
+}
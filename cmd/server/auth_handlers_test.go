@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestReservedUsername(t *testing.T) {
+	admins := []string{"alice", " root "}
+	for name, want := range map[string]bool{
+		"alice":  true,
+		"ALICE":  true,
+		" alice": true,
+		"root":   true,
+		"bob":    false,
+		"alice2": false,
+	} {
+		if got := reservedUsername(admins, name); got != want {
+			t.Errorf("reservedUsername(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if reservedUsername(nil, "alice") {
+		t.Error("no names are reserved without auth.admins")
+	}
+}
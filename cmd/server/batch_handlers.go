@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/jobs"
+	"github.com/webdav-gateway/internal/middleware"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/tenant"
+)
+
+// batchForwardHeaders 转发给单个操作的请求头：认证信息和审计、日志使用的客户端信息
+var batchForwardHeaders = []string{"Authorization", "User-Agent", "X-Forwarded-For", "X-Real-IP"}
+
+// batchOperation 批量请求中的一个操作
+type batchOperation struct {
+	// Op delete、move、copy、mkdir
+	Op          string `json:"op"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	// Overwrite move、copy的目标已存在时是否覆盖，默认不覆盖
+	Overwrite bool `json:"overwrite,omitempty"`
+	// Parents mkdir时自动创建不存在的上级目录
+	Parents bool `json:"parents,omitempty"`
+}
+
+// batchRequest 批量操作请求
+type batchRequest struct {
+	Operations []batchOperation `json:"operations" binding:"required"`
+	// StopOnError 某个操作失败后跳过剩余操作，默认继续执行
+	StopOnError bool `json:"stop_on_error"`
+	// Async 为true时作为后台任务执行，立即返回任务
+	Async bool `json:"async,omitempty"`
+}
+
+// batchResult 单个操作的结果，status为对应WebDAV请求的状态码
+type batchResult struct {
+	Index       int    `json:"index"`
+	Op          string `json:"op"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	Status      int    `json:"status"`
+	Success     bool   `json:"success"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Code        string `json:"code,omitempty"`
+}
+
+// batchResponse 批量操作的结果，也是后台任务的结果
+type batchResponse struct {
+	Results   []batchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+}
+
+// batchStatusWriter 只记录状态码，丢弃WebDAV响应体
+type batchStatusWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *batchStatusWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchStatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *batchStatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// batchMethods 批量操作对应的WebDAV方法
+var batchMethods = map[string]string{
+	"delete": http.MethodDelete,
+	"move":   "MOVE",
+	"copy":   "COPY",
+	"mkdir":  "MKCOL",
+}
+
+// batchErrorCode WebDAV状态码对应的错误码
+func batchErrorCode(status int) (string, string) {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request", "invalid path or file name"
+	case http.StatusUnauthorized:
+		return "unauthorized", "authentication failed"
+	case http.StatusForbidden:
+		return "forbidden", "operation not permitted"
+	case http.StatusNotFound:
+		return "not_found", "resource not found"
+	case http.StatusMethodNotAllowed:
+		return "already_exists", "resource already exists"
+	case http.StatusConflict:
+		return "conflict", "parent folder does not exist or name conflicts"
+	case http.StatusPreconditionFailed:
+		return "destination_exists", "destination already exists"
+	case http.StatusLocked:
+		return "locked", "resource is locked"
+	case http.StatusInsufficientStorage:
+		return "quota_exceeded", "storage quota exceeded"
+	default:
+		return "failed", http.StatusText(status)
+	}
+}
+
+// davURL 把用户空间内的路径转换为WebDAV路由下的地址，逐段转义
+func davURL(prefix, p string) string {
+	return (&url.URL{Path: prefix + path.Clean("/"+p)}).EscapedPath()
+}
+
+// handleBatch 在服务端依次执行一批删除、移动、复制、建目录操作。每个操作作为WebDAV请求交给
+// WebDAV路由处理，锁、配额、只读目录、访问控制、审计和变更日志与直接使用WebDAV完全一致；
+// 单个操作失败不影响其他操作，响应中逐项返回结果。async时提交为后台任务
+func handleBatch(router http.Handler, prefix string, cfg config.BatchConfig, jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req batchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Operations) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no operations", "code": "empty_batch"})
+			return
+		}
+		if cfg.MaxOperations > 0 && len(req.Operations) > cfg.MaxOperations {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("a batch may contain at most %d operations", cfg.MaxOperations),
+				"code":  "too_many_operations",
+			})
+			return
+		}
+
+		if req.Async {
+			userID, _, ok := currentUser(c)
+			if !ok {
+				return
+			}
+			req.Async = false
+			submitJob(c, jobManager, userID, jobKindBatch, req)
+			return
+		}
+
+		header := make(http.Header)
+		for _, name := range batchForwardHeaders {
+			if value := c.GetHeader(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+		ctx := c.Request.Context()
+		if slug := c.GetString(middleware.TenantSlugKey); slug != "" {
+			// 子请求没有客户端的Host头，多租户模式下显式带上租户标识
+			ctx = tenant.WithSlug(ctx, slug)
+		}
+		c.JSON(http.StatusOK, runBatch(ctx, router, prefix, header, c.Request.RemoteAddr, req, nil))
+	}
+}
+
+// runBatch 依次执行批量操作，header为转发给每个WebDAV请求的请求头（含认证），
+// progress非nil时每完成一个操作调用一次
+func runBatch(ctx context.Context, router http.Handler, prefix string, header http.Header, remoteAddr string, req batchRequest, progress func(done int)) *batchResponse {
+	resp := &batchResponse{Results: make([]batchResult, len(req.Operations))}
+	stopped := false
+	for i, op := range req.Operations {
+		result := &resp.Results[i]
+		*result = batchResult{Index: i, Op: op.Op, Path: op.Path, Destination: op.Destination}
+		if stopped || ctx.Err() != nil {
+			result.Skipped = true
+			resp.Skipped++
+			continue
+		}
+
+		method, ok := batchMethods[op.Op]
+		switch {
+		case !ok:
+			result.Status, result.Code, result.Error = http.StatusBadRequest, "invalid_operation", "unknown operation"
+		case strings.Trim(op.Path, "/") == "":
+			result.Status, result.Code, result.Error = http.StatusBadRequest, "invalid_request", "path is required and must not be the root folder"
+		case (op.Op == "move" || op.Op == "copy") && strings.Trim(op.Destination, "/") == "":
+			result.Status, result.Code, result.Error = http.StatusBadRequest, "invalid_request", "destination is required and must not be the root folder"
+		default:
+			sub, err := http.NewRequestWithContext(ctx, method, davURL(prefix, op.Path), nil)
+			if err != nil {
+				result.Status, result.Code, result.Error = http.StatusBadRequest, "invalid_request", err.Error()
+				break
+			}
+			sub.RemoteAddr = remoteAddr
+			sub.Header = header.Clone()
+			switch op.Op {
+			case "move", "copy":
+				// Destination使用用户空间内的路径，不带WebDAV路由前缀
+				sub.Header.Set("Destination", (&url.URL{Path: path.Clean("/" + op.Destination)}).EscapedPath())
+				sub.Header.Set("Overwrite", "F")
+				if op.Overwrite {
+					sub.Header.Set("Overwrite", "T")
+				}
+			case "mkdir":
+				if op.Parents {
+					sub.Header.Set("X-Create-Parents", "T")
+				}
+			}
+
+			w := &batchStatusWriter{header: make(http.Header)}
+			router.ServeHTTP(w, sub)
+			result.Status = w.status
+			if result.Status == 0 {
+				result.Status = http.StatusOK
+			}
+			if result.Status >= 200 && result.Status < 300 {
+				result.Success = true
+			} else {
+				result.Code, result.Error = batchErrorCode(result.Status)
+			}
+		}
+
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+			stopped = req.StopOnError
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return resp
+}
+
+// newBatchJobRunner 后台执行批量操作。任务没有原始请求的令牌，为任务所属用户签发新令牌；
+// tenants非nil时子请求带上用户所属的租户标识
+func newBatchJobRunner(router http.Handler, prefix string, authService *auth.Service, tenants *tenant.Service) jobs.Runner {
+	return func(ctx context.Context, job *jobs.Job, progress func(jobs.Progress)) (interface{}, error) {
+		var req batchRequest
+		if err := json.Unmarshal(job.Payload, &req); err != nil {
+			return nil, err
+		}
+		user, err := authService.GetUserByID(ctx, job.UserID)
+		if err != nil {
+			return nil, err
+		}
+		token, err := authService.GenerateToken(user)
+		if err != nil {
+			return nil, err
+		}
+		header := make(http.Header)
+		header.Set("Authorization", "Bearer "+token)
+		header.Set("User-Agent", "webdav-gateway-job/"+job.ID.String())
+
+		if tenants != nil {
+			ctx = tenant.WithSlug(ctx, tenants.TenantOf(job.UserID))
+		}
+
+		total := int64(len(req.Operations))
+		done := 0
+		progress(jobs.Progress{Total: total})
+		// 删除大目录可能需要几分钟，期间按批报告已删除的文件数
+		ctx = storage.WithDeleteProgress(ctx, func(stats storage.DeleteStats) {
+			progress(jobs.Progress{Done: int64(done), Total: total, Message: fmt.Sprintf("deleted %d files", stats.Objects)})
+		})
+		resp := runBatch(ctx, router, prefix, header, "", req, func(n int) {
+			done = n
+			progress(jobs.Progress{Done: int64(done), Total: total})
+		})
+		// 取消后剩余操作被跳过，已执行操作的结果随任务一起保存
+		if err := ctx.Err(); err != nil && resp.Skipped > 0 {
+			return resp, err
+		}
+		return resp, nil
+	}
+}
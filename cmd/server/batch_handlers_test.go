@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// fakeDAV 模拟WebDAV路由：按路径返回状态码，记录收到的子请求
+type fakeDAV struct {
+	status   map[string]int
+	requests []*http.Request
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r)
+	status, ok := f.status[r.URL.EscapedPath()]
+	if !ok {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	w.Write([]byte("<D:error/>"))
+}
+
+func TestRunBatchPartialFailure(t *testing.T) {
+	dav := &fakeDAV{status: map[string]int{
+		"/webdav/locked.txt": http.StatusLocked,
+		"/webdav/missing":    http.StatusNotFound,
+		"/webdav/exists":     http.StatusMethodNotAllowed,
+		"/webdav/old.txt":    http.StatusNoContent,
+		"/webdav/big.bin":    http.StatusInsufficientStorage,
+	}}
+	header := http.Header{"Authorization": {"Bearer token"}}
+	req := batchRequest{Operations: []batchOperation{
+		{Op: "delete", Path: "/old.txt"},
+		{Op: "delete", Path: "/locked.txt"},
+		{Op: "move", Path: "/missing", Destination: "/elsewhere"},
+		{Op: "mkdir", Path: "/exists"},
+		{Op: "copy", Path: "/big.bin", Destination: "/copy.bin"},
+		{Op: "rename", Path: "/a"},
+		{Op: "delete", Path: "/"},
+		{Op: "copy", Path: "/a.txt"},
+		{Op: "mkdir", Path: "/new"},
+	}}
+
+	var progress []int
+	resp := runBatch(context.Background(), dav, "/webdav", header, "10.0.0.1:1234", req, func(done int) {
+		progress = append(progress, done)
+	})
+
+	want := []struct {
+		status  int
+		success bool
+		code    string
+	}{
+		{http.StatusNoContent, true, ""},
+		{http.StatusLocked, false, "locked"},
+		{http.StatusNotFound, false, "not_found"},
+		{http.StatusMethodNotAllowed, false, "already_exists"},
+		{http.StatusInsufficientStorage, false, "quota_exceeded"},
+		{http.StatusBadRequest, false, "invalid_operation"},
+		{http.StatusBadRequest, false, "invalid_request"},
+		{http.StatusBadRequest, false, "invalid_request"},
+		{http.StatusCreated, true, ""},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, w := range want {
+		r := resp.Results[i]
+		if r.Index != i || r.Op != req.Operations[i].Op || r.Path != req.Operations[i].Path {
+			t.Errorf("result %d does not identify its operation: %+v", i, r)
+		}
+		if r.Status != w.status || r.Success != w.success || r.Code != w.code || r.Skipped {
+			t.Errorf("result %d = %+v, want status %d success %v code %q", i, r, w.status, w.success, w.code)
+		}
+		if !r.Success && r.Error == "" {
+			t.Errorf("result %d has no error message", i)
+		}
+	}
+	if resp.Succeeded != 2 || resp.Failed != 7 || resp.Skipped != 0 {
+		t.Errorf("succeeded %d, failed %d, skipped %d; want 2, 7, 0", resp.Succeeded, resp.Failed, resp.Skipped)
+	}
+	if len(progress) != len(want) || progress[len(progress)-1] != len(want) {
+		t.Errorf("progress = %v", progress)
+	}
+	// 无效的操作不发送WebDAV请求
+	if len(dav.requests) != 6 {
+		t.Errorf("sent %d WebDAV requests, want 6", len(dav.requests))
+	}
+}
+
+func TestRunBatchStopOnError(t *testing.T) {
+	dav := &fakeDAV{status: map[string]int{"/dav/b": http.StatusForbidden}}
+	req := batchRequest{StopOnError: true, Operations: []batchOperation{
+		{Op: "delete", Path: "/a"},
+		{Op: "delete", Path: "/b"},
+		{Op: "delete", Path: "/c"},
+		{Op: "mkdir", Path: "/d"},
+	}}
+	resp := runBatch(context.Background(), dav, "/dav", http.Header{}, "", req, nil)
+
+	if resp.Succeeded != 1 || resp.Failed != 1 || resp.Skipped != 2 {
+		t.Errorf("succeeded %d, failed %d, skipped %d; want 1, 1, 2", resp.Succeeded, resp.Failed, resp.Skipped)
+	}
+	if r := resp.Results[1]; r.Code != "forbidden" || r.Status != http.StatusForbidden {
+		t.Errorf("failed result = %+v", r)
+	}
+	for _, r := range resp.Results[2:] {
+		if !r.Skipped || r.Success || r.Status != 0 || r.Path == "" {
+			t.Errorf("result after failure = %+v, want skipped", r)
+		}
+	}
+	if len(dav.requests) != 2 {
+		t.Errorf("sent %d WebDAV requests after the failure, want none", len(dav.requests)-2)
+	}
+}
+
+// TestRunBatchCanceled 取消后剩余操作被跳过
+func TestRunBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dav := &fakeDAV{}
+	req := batchRequest{Operations: []batchOperation{{Op: "mkdir", Path: "/a"}, {Op: "mkdir", Path: "/b"}}}
+	resp := runBatch(ctx, dav, "/dav", http.Header{}, "", req, func(done int) { cancel() })
+
+	if resp.Succeeded != 1 || resp.Skipped != 1 || !resp.Results[1].Skipped {
+		t.Errorf("response = %+v, want the second operation skipped", resp)
+	}
+}
+
+// TestRunBatchRequests 每个操作转换为对应的WebDAV请求
+func TestRunBatchRequests(t *testing.T) {
+	dav := &fakeDAV{}
+	header := http.Header{"Authorization": {"Bearer token"}, "User-Agent": {"test"}}
+	req := batchRequest{Operations: []batchOperation{
+		{Op: "move", Path: "/docs/报告 2024.pdf", Destination: "archive/a#b.pdf"},
+		{Op: "copy", Path: "/docs/a", Destination: "/docs/b", Overwrite: true},
+		{Op: "mkdir", Path: "/x/y", Parents: true},
+		{Op: "delete", Path: "/docs/../tmp"},
+	}}
+	runBatch(context.Background(), dav, "/webdav", header, "10.0.0.1:1234", req, nil)
+
+	want := []struct {
+		method, path, destination, overwrite, parents string
+	}{
+		{"MOVE", "/webdav/docs/%E6%8A%A5%E5%91%8A%202024.pdf", "/archive/a%23b.pdf", "F", ""},
+		{"COPY", "/webdav/docs/a", "/docs/b", "T", ""},
+		{"MKCOL", "/webdav/x/y", "", "", "T"},
+		{http.MethodDelete, "/webdav/tmp", "", "", ""},
+	}
+	if len(dav.requests) != len(want) {
+		t.Fatalf("sent %d requests, want %d", len(dav.requests), len(want))
+	}
+	for i, w := range want {
+		r := dav.requests[i]
+		if r.Method != w.method || r.URL.EscapedPath() != w.path {
+			t.Errorf("request %d = %s %s, want %s %s", i, r.Method, r.URL.EscapedPath(), w.method, w.path)
+		}
+		if r.Header.Get("Destination") != w.destination || r.Header.Get("Overwrite") != w.overwrite ||
+			r.Header.Get("X-Create-Parents") != w.parents {
+			t.Errorf("request %d headers = %v", i, r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" || r.RemoteAddr != "10.0.0.1:1234" {
+			t.Errorf("request %d missing forwarded credentials: %v %s", i, r.Header, r.RemoteAddr)
+		}
+	}
+	// 子请求的请求头互不影响，也不修改转发的原始请求头
+	if header.Get("Destination") != "" || len(header) != 2 {
+		t.Errorf("forwarded header modified: %v", header)
+	}
+}
+
+func TestBatchErrorCode(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusPreconditionFailed:  "destination_exists",
+		http.StatusConflict:            "conflict",
+		http.StatusUnauthorized:        "unauthorized",
+		http.StatusInternalServerError: "failed",
+	} {
+		if code, message := batchErrorCode(status); code != want || message == "" {
+			t.Errorf("batchErrorCode(%d) = %q, %q; want %q", status, code, message, want)
+		}
+	}
+}
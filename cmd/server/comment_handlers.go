@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/comments"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// handleListComments 列出文件的评论，按讨论串组织
+func handleListComments(commentService *comments.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		filePath, ok := commentPath(c)
+		if !ok {
+			return
+		}
+
+		list, err := commentService.List(c.Request.Context(), userID, filePath)
+		if err != nil {
+			commentError(c, err, "failed to list comments")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"comments": list})
+	}
+}
+
+// handleCreateComment 在文件上添加评论或回复
+func handleCreateComment(commentService *comments.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, username, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		filePath, ok := commentPath(c)
+		if !ok {
+			return
+		}
+
+		var req models.CreateCommentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		comment, err := commentService.Create(c.Request.Context(), userID, username, filePath, &req)
+		if err != nil {
+			commentError(c, err, "failed to create comment")
+			return
+		}
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+// handleDeleteComment 删除文件上的一条评论
+func handleDeleteComment(commentService *comments.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		filePath, ok := commentPath(c)
+		if !ok {
+			return
+		}
+		id, err := uuid.Parse(c.Query("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment id"})
+			return
+		}
+
+		if err := commentService.Delete(c.Request.Context(), userID, filePath, id); err != nil {
+			commentError(c, err, "failed to delete comment")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func commentPath(c *gin.Context) (string, bool) {
+	filePath := c.Query("path")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return "", false
+	}
+	return filePath, true
+}
+
+func commentError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, comments.ErrFileNotFound), errors.Is(err, comments.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, comments.ErrEmpty), errors.Is(err, comments.ErrTooLong), errors.Is(err, comments.ErrParentNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, comments.ErrNoFileID):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Warning: comment request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/webdav-gateway/internal/bandwidth"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// validateConfig 实现`server --validate-config [path]`：加载并检查配置，逐行输出问题，
+// 返回进程退出码（0表示配置有效）。不连接数据库、Redis或对象存储
+func validateConfig(path string, out io.Writer) int {
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return 1
+	}
+	if file := config.ConfigFile(); file != "" {
+		fmt.Fprintf(out, "config file: %s\n", file)
+	} else {
+		fmt.Fprintln(out, "config file: none found, using defaults and environment variables")
+	}
+
+	// 不对应任何配置项的键不阻止启动，只作为警告输出
+	for _, unknown := range config.UnknownKeys() {
+		fmt.Fprintf(out, "warning: %s\n", unknown)
+	}
+
+	var problems []string
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+	if err := cryptopolicy.Configure(cfg.Crypto); err != nil {
+		problems = append(problems, fmt.Sprintf("crypto: %v", err))
+	} else if err := cryptopolicy.ValidateJWTSecret(cfg.Auth.JWTSecret); err != nil {
+		problems = append(problems, fmt.Sprintf("auth.jwt_secret: %v", err))
+	}
+	if cfg.Server.TLS.Enabled {
+		if _, err := cryptopolicy.TLSConfig(cfg.Server.TLS); err != nil {
+			problems = append(problems, fmt.Sprintf("server.tls: %v", err))
+		}
+	}
+	if _, err := storage.NewLayout(cfg.Storage, ""); err != nil {
+		problems = append(problems, fmt.Sprintf("storage: %v", err))
+	}
+	if cfg.Bandwidth.Enabled {
+		if _, err := bandwidth.NewScheduler(cfg.Bandwidth); err != nil {
+			problems = append(problems, fmt.Sprintf("bandwidth: %v", err))
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintf(out, "error: %s\n", problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Fprintln(out, "configuration OK")
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/dedup"
+	"github.com/webdav-gateway/internal/jobs"
+)
+
+// jobKindDedupScan 去重已有数据的后台任务
+const jobKindDedupScan = "dedup_scan"
+
+// newDedupScanJobRunner 把去重启用前写入的文件转换为指针并核对引用计数
+func newDedupScanJobRunner(dedupService *dedup.Service) jobs.Runner {
+	return func(ctx context.Context, job *jobs.Job, progress func(jobs.Progress)) (interface{}, error) {
+		progress(jobs.Progress{Message: "scanning"})
+		return dedupService.Scan(ctx, func(done, total int) {
+			progress(jobs.Progress{Done: int64(done), Total: int64(total), Message: "scanning"})
+		})
+	}
+}
+
+// handleGetDedupStats 查看去重的存储统计
+func handleGetDedupStats(dedupService *dedup.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := dedupService.Stats(c.Request.Context())
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get dedup stats"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// handleSubmitDedupScan 提交去重已有数据的后台任务，进度和结果通过/api/jobs/:id查询
+func handleSubmitDedupScan(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		submitJob(c, jobManager, userID, jobKindDedupScan, struct{}{})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/archive"
+	"github.com/webdav-gateway/internal/jobs"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/share"
+)
+
+// handleZipDownload 将选中的文件或整个目录即时打包为zip下载，async时在后台打包保存到用户空间
+func handleZipDownload(zipper *archive.ZipDownloader, jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req models.ZipDownloadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		paths := req.Paths
+		name := req.Name
+		if req.Folder != "" {
+			if len(paths) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "specify either paths or folder"})
+				return
+			}
+			paths = []string{req.Folder}
+			if name == "" {
+				name = path.Base(path.Clean("/" + req.Folder))
+			}
+		}
+		for _, p := range paths {
+			if strings.Contains(p, "..") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+				return
+			}
+		}
+
+		if req.Async && !req.Estimate {
+			if len(paths) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": archive.ErrZipEmptySelection.Error()})
+				return
+			}
+			target, ok := zipExportTarget(req.Target, name)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid target"})
+				return
+			}
+			submitJob(c, jobManager, userID, jobKindZipExport, zipExportPayload{Paths: paths, Target: target})
+			return
+		}
+
+		serveZip(c, zipper, userID, paths, name, req.Estimate)
+	}
+}
+
+// handleShareZipDownload 通过分享链接打包下载分享的目录或其中的部分文件，计为一次下载
+func handleShareZipDownload(shareService *share.Service, zipper *archive.ZipDownloader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+
+		var req models.ShareZipDownloadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		fileShare, err := shareService.ValidateShareAccess(c.Request.Context(), token, req.Password)
+		if err != nil {
+			if err == share.ErrShareNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+			if err == share.ErrShareExpired {
+				c.JSON(http.StatusGone, gin.H{"error": "share has expired"})
+				return
+			}
+			if err == share.ErrMaxDownloads {
+				c.JSON(http.StatusForbidden, gin.H{"error": "maximum downloads reached"})
+				return
+			}
+			if err == share.ErrInvalidPassword {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access share"})
+			return
+		}
+		setShareAudit(c, fileShare)
+		if rejectDisabledShare(c, fileShare) {
+			return
+		}
+
+		if !share.AllowsDownload(fileShare) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "share only accepts uploads"})
+			return
+		}
+
+		// 选中的路径限定在分享目录内
+		root := path.Clean("/" + fileShare.FilePath)
+		paths := []string{root}
+		if len(req.Paths) > 0 {
+			paths = make([]string, 0, len(req.Paths))
+			for _, p := range req.Paths {
+				if strings.Contains(p, "..") {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+					return
+				}
+				paths = append(paths, path.Join(root, path.Clean("/"+p)))
+			}
+		}
+
+		name := fileShare.ShareName
+		if name == "" {
+			name = path.Base(root)
+		}
+
+		if !req.Estimate {
+			if err := shareService.IncrementDownloadCount(c.Request.Context(), fileShare.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update download count"})
+				return
+			}
+		}
+
+		// 并发数计入分享者
+		serveZip(c, zipper, fileShare.UserID, paths, name, req.Estimate)
+	}
+}
+
+// serveZip 生成打包清单，estimate时返回估算，否则流式输出zip
+func serveZip(c *gin.Context, zipper *archive.ZipDownloader, userID uuid.UUID, paths []string, name string, estimate bool) {
+	plan, err := zipper.Plan(c.Request.Context(), userID, paths)
+	if err != nil {
+		switch {
+		case errors.Is(err, archive.ErrZipPathNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, archive.ErrZipEmptySelection):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, archive.ErrZipTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to prepare download"})
+		}
+		return
+	}
+
+	if estimate {
+		c.JSON(http.StatusOK, plan)
+		return
+	}
+
+	release, err := zipper.Acquire(userID)
+	if err != nil {
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many concurrent zip downloads"})
+		return
+	}
+	defer release()
+
+	if name == "" || name == "/" || name == "." {
+		name = "download"
+	}
+	filename := name + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+		asciiFilename(filename), url.PathEscape(filename)))
+	c.Header("X-Estimated-Size", strconv.FormatInt(plan.EstimatedSize, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	if err := zipper.Write(c.Request.Context(), userID, plan, c.Writer); err != nil {
+		// 响应头已发送，无法再返回错误；缺少中央目录的zip会被客户端识别为损坏
+		log.Printf("Warning: zip download for user %s aborted: %v", userID, err)
+	}
+}
+
+// asciiFilename 生成Content-Disposition中filename的ASCII回退值
+func asciiFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+)
+
+// handleEvents 以Server-Sent Events推送当前用户文件树的变更。
+// 重连时按Last-Event-ID（或?since=）从变更日志补发断线期间的变更，
+// 缺口超过replay_limit或已超过保留期时发送reset事件（id为当前最新变更），客户端应完整重新同步
+func handleEvents(journal *changes.Journal, cfg config.EventsConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		lastID := int64(0)
+		since := c.GetHeader("Last-Event-ID")
+		if since == "" {
+			since = c.Query("since")
+		}
+		if since != "" {
+			lastID, err = strconv.ParseInt(since, 10, 64)
+			if err != nil || lastID < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id"})
+				return
+			}
+		}
+		scope := path.Clean("/" + c.Query("path"))
+
+		// 先订阅再补发，补发期间产生的变更不会丢失，重复的按ID跳过
+		sub := journal.Subscribe(userID)
+		defer journal.Unsubscribe(sub)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		limit := cfg.ReplayLimit
+		if limit <= 0 {
+			limit = 1000
+		}
+		if since != "" {
+			missed, err := journal.Since(c.Request.Context(), userID, lastID, limit+1)
+			if err != nil {
+				writeEvent(c.Writer, "error", "", gin.H{"error": "failed to read change journal"})
+				return
+			}
+			pruned, err := journal.Pruned(c.Request.Context(), lastID)
+			if err != nil {
+				writeEvent(c.Writer, "error", "", gin.H{"error": "failed to read change journal"})
+				return
+			}
+			if len(missed) > limit || pruned {
+				latest, err := journal.LatestID(c.Request.Context(), userID)
+				if err != nil {
+					writeEvent(c.Writer, "error", "", gin.H{"error": "failed to read change journal"})
+					return
+				}
+				writeEvent(c.Writer, "reset", strconv.FormatInt(latest, 10), gin.H{"reason": "changes since the last event are no longer available"})
+				missed, lastID = nil, latest
+			}
+			for _, change := range missed {
+				if inScope(change, scope) {
+					writeEvent(c.Writer, change.Type, strconv.FormatInt(change.ID, 10), change)
+				}
+				lastID = change.ID
+			}
+		} else {
+			// 首次连接时告知客户端可用于同步的起点
+			writeEvent(c.Writer, "ready", "", gin.H{"path": scope})
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(eventsDuration(cfg.Heartbeat, 30*time.Second))
+		defer heartbeat.Stop()
+		deadline := time.NewTimer(eventsDuration(cfg.MaxDuration, 10*time.Minute))
+		defer deadline.Stop()
+
+		for {
+			select {
+			case change, ok := <-sub.C:
+				if !ok {
+					// 消费过慢或服务停止，客户端重连后从日志补齐
+					return
+				}
+				if change.ID <= lastID {
+					continue
+				}
+				lastID = change.ID
+				if inScope(change, scope) {
+					writeEvent(c.Writer, change.Type, strconv.FormatInt(change.ID, 10), change)
+					c.Writer.Flush()
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": ping\n\n")
+				c.Writer.Flush()
+			case <-deadline.C:
+				return
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// writeEvent 写入一个SSE事件，data为JSON
+func writeEvent(w io.Writer, event, id string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// inScope 判断变更的源或目标是否位于scope之下
+func inScope(change changes.Change, scope string) bool {
+	if scope == "/" {
+		return true
+	}
+	for _, p := range []string{change.Path, change.Destination} {
+		if p == scope || strings.HasPrefix(p, scope+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func eventsDuration(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
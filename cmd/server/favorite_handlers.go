@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleListFavorites 列出用户收藏的文件和目录，path参数可选，限定为该目录下的收藏。
+// 收藏残留但资源已不存在的路径被跳过
+func handleListFavorites(propertyService *webdav.PropertyService, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+
+		paths, err := propertyService.ListFavorites(c.Request.Context(), userID.String(), c.Query("path"))
+		if err != nil {
+			log.Printf("Warning: failed to list favorites: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list favorites"})
+			return
+		}
+
+		files := make([]models.FileInfo, 0, len(paths))
+		for _, p := range paths {
+			info, err := resourceFileInfo(c.Request.Context(), storageService, userID, p)
+			if err != nil {
+				continue
+			}
+			files = append(files, *info)
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files})
+	}
+}
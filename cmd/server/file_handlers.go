@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/archive"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+func handleGetFileInfo(storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		filePath := c.Query("path")
+		if filePath == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+			return
+		}
+		filePath = davpath.Clean(filePath)
+
+		if info, err := storageService.StatObject(c.Request.Context(), userID, filePath); err == nil {
+			c.JSON(http.StatusOK, models.FileInfo{
+				FileID:       storage.FileID(*info),
+				Path:         filePath,
+				Name:         path.Base(filePath),
+				Size:         info.Size,
+				ContentType:  contenttype.Resolve(filePath, info.ContentType),
+				ETag:         storage.ContentETag(*info),
+				LastModified: info.LastModified,
+			})
+			return
+		}
+
+		info, err := storageService.StatFolder(c.Request.Context(), userID, filePath)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.FileInfo{
+			FileID:       storage.FileID(*info),
+			Path:         filePath,
+			Name:         path.Base(filePath),
+			LastModified: info.LastModified,
+			IsDir:        true,
+		})
+	}
+}
+
+// handleGetFileSegments 返回分段下载元数据：文件大小、ETag和推荐的分段方案
+// 客户端用Range + If-Match(ETag)并发拉取各段，文件中途被修改时分段请求返回412
+func handleGetFileSegments(storageService *storage.Service, downloadConfig config.DownloadConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		filePath := c.Query("path")
+		if filePath == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+			return
+		}
+		filePath = davpath.Clean(filePath)
+
+		connections := downloadConfig.MaxSegments
+		if n, err := strconv.Atoi(c.Query("connections")); err == nil && n > 0 && n < connections {
+			connections = n
+		}
+
+		info, err := storageService.StatObject(c.Request.Context(), userID, filePath)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+
+		segmentSize, segments := storage.PlanSegments(info.Size, downloadConfig.MinSegmentSize, connections)
+		c.JSON(http.StatusOK, models.SegmentInfo{
+			Path:         filePath,
+			Size:         info.Size,
+			ETag:         `"` + storage.ContentETag(*info) + `"`,
+			LastModified: info.LastModified,
+			AcceptRanges: "bytes",
+			SegmentSize:  segmentSize,
+			Segments:     segments,
+		})
+	}
+}
+
+// handleGetFileChecksum 返回PUT上传时计算的校验值
+func handleGetFileChecksum(storageService *storage.Service, propertyService *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		filePath := c.Query("path")
+		if filePath == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+			return
+		}
+		filePath = davpath.Clean(filePath)
+
+		if _, err := storageService.StatObject(c.Request.Context(), userID, filePath); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+
+		md5Hex, sha256Hex, err := propertyService.GetChecksums(c.Request.Context(), userIDStr, filePath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load checksum"})
+			return
+		}
+		if md5Hex == "" && sha256Hex == "" {
+			// 归档解压等非PUT方式写入的文件没有记录校验值；受限加密模式下只记录SHA-256
+			c.JSON(http.StatusNotFound, gin.H{"error": "checksum not available"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.FileChecksum{
+			Path:   filePath,
+			MD5:    md5Hex,
+			SHA256: sha256Hex,
+		})
+	}
+}
+
+// handleExtractArchive 接收ZIP/TAR归档（或引用已上传的归档）并在后台解压到目标目录
+func handleExtractArchive(archiveService *archive.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		target := c.Query("path")
+		if target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+			return
+		}
+		checksum := c.Query("sha256")
+
+		var job *archive.Job
+		if source := c.Query("source"); source != "" {
+			job, err = archiveService.StartFromObject(c.Request.Context(), userID, target, source, checksum)
+		} else {
+			job, err = archiveService.StartFromUpload(c.Request.Context(), userID, target, c.Request.Body, checksum)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, archive.ErrUnsupportedFormat):
+				c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported archive format"})
+			case errors.Is(err, archive.ErrChecksumMismatch):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "archive checksum mismatch"})
+			case errors.Is(err, archive.ErrArchiveTooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "archive too large"})
+			case storage.IsNotFound(err):
+				c.JSON(http.StatusNotFound, gin.H{"error": "source archive not found"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start extraction"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// handleIngestTar 流式导入tar（或tar.gz）归档，同步返回每个条目的结果清单
+func handleIngestTar(ingester *archive.Ingester) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		target := c.Query("path")
+		if target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+			return
+		}
+
+		result, err := ingester.Ingest(c.Request.Context(), userID, target, c.Request.Body)
+		if err != nil {
+			if result == nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start ingestion"})
+				return
+			}
+			status := http.StatusBadRequest
+			if errors.Is(err, archive.ErrTooManyEntries) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{"error": err.Error(), "manifest": result})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// handleGetExtractJob 查询解压任务进度
+func handleGetExtractJob(archiveService *archive.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		job, err := archiveService.GetJob(userID, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+func TestGetFileInfoFileID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, userID, "/a.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFolder(ctx, userID, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/files/info", func(c *gin.Context) {
+		c.Set("userID", userID.String())
+		c.Next()
+	}, handleGetFileInfo(s))
+
+	for _, p := range []string{"/a.txt", "/docs"} {
+		want, err := s.StatObject(ctx, userID, p)
+		if err != nil {
+			want, err = s.StatFolder(ctx, userID, p)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/info?path="+p, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", p, w.Code)
+		}
+		var info models.FileInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		if info.FileID == "" || info.FileID != storage.FileID(*want) {
+			t.Errorf("GET %s: file id = %q, want %q", p, info.FileID, storage.FileID(*want))
+		}
+	}
+}
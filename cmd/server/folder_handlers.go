@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+type folderPathRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+func handleFreezeFolder(propertyService *webdav.PropertyService, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req folderPathRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		folderPath := "/" + strings.Trim(req.Path, "/")
+		if folderPath == "/" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot freeze the root folder"})
+			return
+		}
+
+		// Only collections can be frozen
+		if _, err := storageService.StatObject(c.Request.Context(), userID, folderPath); err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path is not a folder"})
+			return
+		}
+		exists, err := storageService.FolderExists(c.Request.Context(), userID, folderPath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check folder"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+			return
+		}
+
+		if err := propertyService.FreezeCollection(c.Request.Context(), userIDStr, folderPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to freeze folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"path":      folderPath,
+			"read_only": true,
+		})
+	}
+}
+
+func handleUnfreezeFolder(propertyService *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		if _, err := uuid.Parse(userIDStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req folderPathRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		folderPath := "/" + strings.Trim(req.Path, "/")
+		if err := propertyService.UnfreezeCollection(c.Request.Context(), userIDStr, folderPath); err != nil {
+			if err == webdav.ErrCollectionNotFrozen {
+				c.JSON(http.StatusNotFound, gin.H{"error": "folder is not read-only"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unfreeze folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"path":      folderPath,
+			"read_only": false,
+		})
+	}
+}
+
+func handleListFrozenFolders(propertyService *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		if _, err := uuid.Parse(userIDStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		folders, err := propertyService.ListFrozenCollections(c.Request.Context(), userIDStr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list read-only folders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, folders)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/health"
+)
+
+// handleLiveness 存活检查，只表示进程能处理请求，不探测依赖，
+// 依赖故障时不应让编排系统重启网关
+func handleLiveness() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "healthy",
+			"time":   time.Now().Unix(),
+		})
+	}
+}
+
+// handleReadiness 就绪检查，逐个探测依赖并返回各自的状态，必需的依赖不可用时返回503
+func handleReadiness(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		c.Header("Cache-Control", "no-store")
+		if !report.Ready() {
+			c.JSON(http.StatusServiceUnavailable, report)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
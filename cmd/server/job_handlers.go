@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/archive"
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/jobs"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// 后台任务类型
+const (
+	jobKindBatch     = "batch"
+	jobKindZipExport = "zip_export"
+)
+
+var (
+	// errExportQuotaExceeded 打包结果会超出用户的存储配额
+	errExportQuotaExceeded = errors.New("storage quota exceeded")
+	// errExportTargetExists 保存位置已存在文件，不覆盖
+	errExportTargetExists = errors.New("target already exists")
+)
+
+// jobErrorStatus 任务错误对应的状态码
+func jobErrorStatus(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		return http.StatusNotFound, gin.H{"error": "job not found"}
+	case errors.Is(err, jobs.ErrFinished):
+		return http.StatusConflict, gin.H{"error": err.Error(), "code": "job_finished"}
+	case errors.Is(err, jobs.ErrTooManyJobs):
+		return http.StatusTooManyRequests, gin.H{"error": "too many unfinished jobs, wait for them to finish", "code": "too_many_jobs"}
+	default:
+		log.Printf("Warning: job request failed: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "failed to process job request"}
+	}
+}
+
+// submitJob 提交后台任务并返回202，Location指向任务查询地址
+func submitJob(c *gin.Context, jobManager *jobs.Manager, userID uuid.UUID, kind string, payload interface{}) {
+	job, err := jobManager.Submit(c.Request.Context(), userID, kind, payload)
+	if err != nil {
+		c.JSON(jobErrorStatus(err))
+		return
+	}
+	c.Header("Location", "/api/jobs/"+job.ID.String())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// jobParam 解析路由中的任务ID
+func jobParam(c *gin.Context) (uuid.UUID, bool) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return uuid.Nil, false
+	}
+	return jobID, true
+}
+
+// handleListJobs 列出当前用户最近的任务
+func handleListJobs(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit <= 0 || limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		list, err := jobManager.List(c.Request.Context(), userID, limit)
+		if err != nil {
+			c.JSON(jobErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": list})
+	}
+}
+
+// handleGetJob 查询任务状态、进度和结果
+func handleGetJob(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		jobID, ok := jobParam(c)
+		if !ok {
+			return
+		}
+		job, err := jobManager.Get(c.Request.Context(), userID, jobID)
+		if err != nil {
+			c.JSON(jobErrorStatus(err))
+			return
+		}
+		if !job.Finished() {
+			c.Header("Retry-After", "2")
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// handleCancelJob 取消任务，运行中的任务在当前操作结束后停止
+func handleCancelJob(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		jobID, ok := jobParam(c)
+		if !ok {
+			return
+		}
+		job, err := jobManager.Cancel(c.Request.Context(), userID, jobID)
+		if err != nil {
+			c.JSON(jobErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// zipExportPayload 后台打包任务的参数
+type zipExportPayload struct {
+	Paths  []string `json:"paths"`
+	Target string   `json:"target"`
+}
+
+// zipExportResult 后台打包任务的结果
+type zipExportResult struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	Folders int    `json:"folders"`
+}
+
+// zipExportTarget 后台打包的保存位置，默认为根目录下的<name>.zip
+func zipExportTarget(target, name string) (string, bool) {
+	if target == "" {
+		if name == "" || name == "/" || name == "." {
+			name = "download"
+		}
+		target = name + ".zip"
+	}
+	if strings.Contains(target, "..") {
+		return "", false
+	}
+	target = path.Clean("/" + target)
+	return target, target != "/"
+}
+
+// newZipExportJobRunner 后台把选中的文件打包为zip保存到用户空间，打包结果计入用量
+func newZipExportJobRunner(zipper *archive.ZipDownloader, storageService *storage.Service, authService *auth.Service) jobs.Runner {
+	return func(ctx context.Context, job *jobs.Job, progress func(jobs.Progress)) (interface{}, error) {
+		var payload zipExportPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, err
+		}
+
+		if _, err := storageService.StatObject(ctx, job.UserID, payload.Target); err == nil {
+			return nil, fmt.Errorf("%w: %s", errExportTargetExists, payload.Target)
+		}
+
+		progress(jobs.Progress{Message: "preparing"})
+		plan, err := zipper.Plan(ctx, job.UserID, payload.Paths)
+		if err != nil {
+			return nil, err
+		}
+		user, err := authService.GetUserByID(ctx, job.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.StorageUsed+plan.EstimatedSize > user.StorageQuota {
+			return nil, errExportQuotaExceeded
+		}
+
+		total := int64(len(plan.Entries))
+		progress(jobs.Progress{Total: total, Message: "zipping"})
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(zipper.WriteWithProgress(ctx, job.UserID, plan, pw, func(done int) {
+				progress(jobs.Progress{Done: int64(done), Total: total, Message: "zipping"})
+			}))
+		}()
+		err = storageService.PutObject(ctx, job.UserID, payload.Target, pr, -1, "application/zip")
+		pr.CloseWithError(err)
+		if err != nil {
+			// 不完整的zip不保留
+			storageService.DeleteObject(context.WithoutCancel(ctx), job.UserID, payload.Target)
+			return nil, err
+		}
+
+		info, err := storageService.StatObject(ctx, job.UserID, payload.Target)
+		if err != nil {
+			return nil, err
+		}
+		authService.UpdateStorageUsed(ctx, job.UserID, info.Size)
+		return zipExportResult{Path: payload.Target, Size: info.Size, Files: plan.Files, Folders: plan.Folders}, nil
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// configureHTTP2 按server.http2设置HTTP/2：启用时设置每个连接的并发请求数，未启用TLS且开启h2c时接受明文HTTP/2；
+// 关闭时不再通过ALPN协商h2。需要在设置srv.TLSConfig之后调用
+func configureHTTP2(srv *http.Server, cfg config.HTTP2Config, tlsEnabled bool) error {
+	if !cfg.Enabled {
+		// 非nil的空映射关闭TLS连接上的HTTP/2
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return nil
+	}
+	h2 := &http2.Server{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		IdleTimeout:          srv.IdleTimeout,
+	}
+	if cfg.H2C && !tlsEnabled {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2)
+	}
+	return http2.ConfigureServer(srv, h2)
+}
+
+// listen 打开监听地址，maxConnections大于0时限制同时打开的连接数
+func listen(addr string, maxConnections int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConnections > 0 {
+		ln = netutil.LimitListener(ln, maxConnections)
+	}
+	return ln, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/audit"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleListLocks 管理员查看所有未过期的WebDAV锁，可按用户ID和路径过滤
+func handleListLocks(lockManager *webdav.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Query("user_id")
+		if userID != "" {
+			if _, err := uuid.Parse(userID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+				return
+			}
+		}
+		locks := lockManager.FindLocks(userID, c.Query("path"))
+		c.JSON(http.StatusOK, gin.H{"locks": locks, "count": len(locks)})
+	}
+}
+
+// handleForceUnlock 管理员强制释放锁（如客户端崩溃后遗留的锁），记录审计日志
+func handleForceUnlock(lockManager *webdav.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+		lock, ok := lockManager.GetLock(token)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "lock not found"})
+			return
+		}
+
+		c.Set(audit.PathKey, lock.Path)
+		c.Set(audit.DetailsKey, map[string]string{
+			"token":      lock.Token,
+			"lock_owner": lock.Owner,
+			"scope":      string(lock.Scope),
+		})
+		if !lockManager.RemoveLock(token) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "lock not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "lock released", "path": lock.Path})
+	}
+}
+
+// handleListMyLocks 列出当前用户持有的未过期锁
+func handleListMyLocks(lockManager *webdav.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locks := lockManager.FindLocks(c.GetString("userID"), c.Query("path"))
+		c.JSON(http.StatusOK, gin.H{"locks": locks, "count": len(locks)})
+	}
+}
+
+// handleGetLockPolicy 返回当前部署的锁策略，客户端据此选择Timeout和锁作用域
+func handleGetLockPolicy(lockManager *webdav.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := lockManager.Policy()
+		c.JSON(http.StatusOK, gin.H{
+			"max_timeout":        int64(policy.MaxTimeout.Seconds()),
+			"default_timeout":    int64(policy.DefaultTimeout.Seconds()),
+			"allow_shared":       policy.AllowShared,
+			"max_locks_per_user": policy.MaxLocksPerUser,
+			"idle_timeout":       int64(policy.IdleTimeout.Seconds()),
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/loginalert"
+)
+
+// HeaderDeviceID 客户端上报稳定设备标识的请求头，用于识别新设备登录
+const HeaderDeviceID = "X-Device-ID"
+
+// loginAlertErrorStatus 提醒链接错误对应的状态码
+func loginAlertErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, loginalert.ErrAlertNotFound):
+		return http.StatusNotFound, "login alert not found"
+	case errors.Is(err, loginalert.ErrAlertExpired):
+		return http.StatusGone, "login alert has expired"
+	case errors.Is(err, loginalert.ErrAlertResolved):
+		return http.StatusConflict, "login alert already handled"
+	default:
+		return http.StatusInternalServerError, "failed to process login alert"
+	}
+}
+
+// handleGetLoginAlert 通过提醒链接查看异常登录详情，不需要登录
+func handleGetLoginAlert(alerts *loginalert.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alert, err := alerts.GetAlert(c.Request.Context(), c.Param("token"))
+		if err != nil {
+			status, message := loginAlertErrorStatus(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"alert":   alert,
+			"expired": time.Now().After(alert.ExpiresAt),
+		})
+	}
+}
+
+// handleDenyLoginAlert "不是我本人"：撤销全部会话并要求重置密码，返回一次性的重置令牌
+func handleDenyLoginAlert(alerts *loginalert.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := alerts.Deny(c.Request.Context(), c.Param("token"))
+		if err != nil {
+			status, message := loginAlertErrorStatus(err)
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "all sessions revoked, please reset your password",
+			"reset_token":      result.ResetToken,
+			"reset_expires_at": result.ResetExpiresAt,
+		})
+	}
+}
+
+// handleResetPassword 使用重置令牌设置新密码
+func handleResetPassword(alerts *loginalert.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Token       string `json:"token" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required,min=8"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := alerts.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+			if errors.Is(err, loginalert.ErrResetTokenInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+	}
+}
@@ -9,22 +9,60 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/webdav-gateway/internal/account"
+	"github.com/webdav-gateway/internal/apitoken"
+	"github.com/webdav-gateway/internal/archive"
+	"github.com/webdav-gateway/internal/audit"
 	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/bandwidth"
+	"github.com/webdav-gateway/internal/casefold"
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/comments"
 	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+	"github.com/webdav-gateway/internal/dedup"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/drain"
+	"github.com/webdav-gateway/internal/health"
+	"github.com/webdav-gateway/internal/idempotency"
+	"github.com/webdav-gateway/internal/jobs"
+	"github.com/webdav-gateway/internal/loginalert"
+	"github.com/webdav-gateway/internal/media"
+	"github.com/webdav-gateway/internal/metrics"
 	"github.com/webdav-gateway/internal/middleware"
+	"github.com/webdav-gateway/internal/migration"
+	"github.com/webdav-gateway/internal/mirror"
+	"github.com/webdav-gateway/internal/quota"
+	"github.com/webdav-gateway/internal/scim"
+	"github.com/webdav-gateway/internal/secretbox"
 	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/sso"
 	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/tenant"
+	"github.com/webdav-gateway/internal/twofactor"
+	"github.com/webdav-gateway/internal/uploads"
 	"github.com/webdav-gateway/internal/webdav"
+	"github.com/webdav-gateway/internal/webdav/validators"
 )
 
 func main() {
+	// `server --validate-config [path]` checks the configuration and exits
+	if len(os.Args) > 1 && os.Args[1] == "--validate-config" {
+		path := ""
+		if len(os.Args) > 2 {
+			path = os.Args[2]
+		}
+		os.Exit(validateConfig(path, os.Stdout))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -33,39 +71,72 @@ func main() {
 
 	// Setup logger
 	logger := logrus.New()
-	level, err := logrus.ParseLevel(cfg.App.LogLevel)
+	level, err := logrus.ParseLevel(cfg.Logging.Level)
 	if err != nil {
 		level = logrus.InfoLevel
 	}
 	logger.SetLevel(level)
 	logger.SetFormatter(&logrus.JSONFormatter{})
 
-	// Connect to PostgreSQL
-	db, err := sql.Open("postgres", cfg.Database.DSN())
-	if err != nil {
-		logger.Fatalf("Failed to connect to database: %v", err)
+	// Restrict token signing, password hashing, checksums and TLS to approved algorithms
+	if err := cryptopolicy.Configure(cfg.Crypto); err != nil {
+		logger.Fatalf("Invalid crypto configuration: %v", err)
+	}
+	if err := cryptopolicy.ValidateJWTSecret(cfg.Auth.JWTSecret); err != nil {
+		logger.Fatalf("Invalid auth configuration: %v", err)
+	}
+	if cryptopolicy.ApprovedOnly() {
+		logger.WithField("fips_build", cryptopolicy.FIPSBuild()).Info("Approved-crypto mode enabled")
 	}
-	defer db.Close()
 
-	// Test database connection
-	if err := db.Ping(); err != nil {
-		logger.Fatalf("Failed to ping database: %v", err)
+	// `server demo [data-dir]` runs a self-contained sandbox: SQLite and a local
+	// directory replace PostgreSQL, Redis and MinIO, and demo data is seeded
+	var sandbox *demo.Sandbox
+	if len(os.Args) > 1 && os.Args[1] == "demo" {
+		dataDir := ""
+		if len(os.Args) > 2 {
+			dataDir = os.Args[2]
+		}
+		sandbox, err = demo.Start(context.Background(), cfg, dataDir)
+		if err != nil {
+			logger.Fatalf("Failed to start demo sandbox: %v", err)
+		}
+		defer sandbox.Close()
+		logger.WithField("data_dir", sandbox.DataDir).Warn("Demo mode: data is stored locally, do not use in production")
 	}
-	logger.Info("Connected to PostgreSQL")
 
-	// Connect to Redis
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Address(),
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-	defer rdb.Close()
+	var db *sql.DB
+	var rdb *redis.Client
+	if sandbox != nil {
+		db = sandbox.DB
+	} else {
+		// Connect to PostgreSQL
+		db, err = sql.Open("postgres", cfg.Database.DSN())
+		if err != nil {
+			logger.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
 
-	// Test Redis connection
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		logger.Fatalf("Failed to connect to Redis: %v", err)
+		// Test database connection
+		if err := db.Ping(); err != nil {
+			logger.Fatalf("Failed to ping database: %v", err)
+		}
+		logger.Info("Connected to PostgreSQL")
+
+		// Connect to Redis
+		rdb = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Address(),
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer rdb.Close()
+
+		// Test Redis connection
+		if err := rdb.Ping(context.Background()).Err(); err != nil {
+			logger.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		logger.Info("Connected to Redis")
 	}
-	logger.Info("Connected to Redis")
 
 	// Initialize services
 	storageService, err := storage.NewService(cfg)
@@ -74,17 +145,418 @@ func main() {
 	}
 	logger.Info("Storage service initialized")
 
+	// Content-addressed deduplication: identical file contents are stored once
+	var dedupService *dedup.Service
+	if cfg.Storage.Dedup.Enabled {
+		dedupService = dedup.NewService(db, storageService, cfg.Storage.Dedup)
+		if err := dedupService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize deduplication: %v", err)
+		}
+		if err := storageService.EnableDedup(context.Background(), dedupService); err != nil {
+			logger.Fatalf("Failed to enable deduplication: %v", err)
+		}
+		dedupService.Start()
+		defer dedupService.Stop()
+		logger.WithFields(logrus.Fields{
+			"min_size":     cfg.Storage.Dedup.MinSize,
+			"quota_policy": cfg.Storage.Dedup.QuotaPolicy,
+		}).Info("Content deduplication enabled")
+	}
+
+	if sandbox != nil {
+		seeded, err := sandbox.Seed(context.Background(), storageService)
+		if err != nil {
+			logger.Fatalf("Failed to seed demo data: %v", err)
+		}
+		logger.WithFields(logrus.Fields{
+			"users":    seeded.Users,
+			"password": demo.DemoPassword,
+			"shares":   seeded.Shares,
+			"seeded":   seeded.Seeded,
+		}).Info("Demo data ready")
+	}
+
+	// Cache directory listings in Redis so unchanged folders skip ListObjects
+	if cfg.Storage.ListingCache.Enabled {
+		storageService.SetListingCache(storage.NewListingCache(rdb, cfg.Storage.ListingCache))
+		logger.WithField("ttl", cfg.Storage.ListingCache.TTL).Info("Directory listing cache enabled")
+	}
+
+	// Idempotency-Key support for PUT and MKCOL, results are kept in Redis
+	var idempotencyStore *idempotency.Store
+	if cfg.WebDAV.Idempotency.Enabled {
+		if rdb != nil {
+			idempotencyStore = idempotency.NewStore(rdb, cfg.WebDAV.Idempotency)
+			logger.WithField("ttl", cfg.WebDAV.Idempotency.TTL).Info("Idempotency keys enabled")
+		} else {
+			logger.Warn("Idempotency keys need Redis and are disabled in demo mode")
+		}
+	}
+
 	authService := auth.NewService(db, cfg)
+	authService.SetClockSkew(cfg.Auth.ClockSkew)
+
+	// Multi-tenant mode: tenant-scoped users, storage prefixes and quota pools
+	var tenants *tenant.Service
+	if cfg.Tenancy.Enabled {
+		tenants = tenant.NewService(db, cfg.Tenancy)
+		if err := tenants.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize tenants: %v", err)
+		}
+		storageService.SetTenantResolver(tenants)
+		logger.WithField("resolution", cfg.Tenancy.Resolution).Info("Multi-tenant mode enabled")
+	}
+
+	// New device / new country login alerts with session revocation
+	var loginAlerts *loginalert.Service
+	if cfg.Auth.LoginAlerts.Enabled {
+		loginAlerts = loginalert.NewService(db, cfg.Auth.LoginAlerts)
+		if err := loginAlerts.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize login alerts: %v", err)
+		}
+		logger.Info("Login anomaly alerts enabled")
+	}
+
+	// TOTP second factor for password logins on the REST API
+	var twoFactor *twofactor.Service
+	if cfg.Auth.TwoFactor.Enabled {
+		twoFactor = twofactor.NewService(db, cfg.Auth.TwoFactor, cfg.Auth.Admins)
+		if err := twoFactor.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize two-factor authentication: %v", err)
+		}
+		logger.WithField("enforce", cfg.Auth.TwoFactor.Enforce).Info("Two-factor authentication enabled")
+	}
+
+	// Scoped personal access tokens for automation
+	var apiTokens *apitoken.Service
+	if cfg.Auth.APITokens.Enabled {
+		apiTokens = apitoken.NewService(db, cfg.Auth.APITokens)
+		if err := apiTokens.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize API tokens: %v", err)
+		}
+		authService.SetAPITokenValidator(apiTokens)
+		logger.Info("API tokens enabled")
+	}
+
+	// Single sign-on (SAML 2.0, OpenID Connect) alongside local password login
+	var provisioner *sso.Provisioner
+	if cfg.Auth.SAML.Enabled || cfg.Auth.OIDC.Enabled {
+		provisioner = sso.NewProvisioner(db, cfg.Auth.Admins)
+		if err := provisioner.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize identity tables: %v", err)
+		}
+	}
+	var samlProvider *sso.SAMLProvider
+	if cfg.Auth.SAML.Enabled {
+		samlProvider, err = sso.NewSAMLProvider(context.Background(), cfg.Auth.SAML)
+		if err != nil {
+			logger.Fatalf("Failed to initialize SAML: %v", err)
+		}
+		logger.Info("SAML single sign-on enabled")
+	}
+	var oidcProvider *sso.OIDCProvider
+	if cfg.Auth.OIDC.Enabled {
+		oidcProvider, err = sso.NewOIDCProvider(context.Background(), cfg.Auth.OIDC)
+		if err != nil {
+			logger.Fatalf("Failed to initialize OIDC: %v", err)
+		}
+		logger.WithField("issuer", cfg.Auth.OIDC.Issuer).Info("OIDC single sign-on enabled")
+	}
+
+	// SCIM 2.0 user and group provisioning
+	var scimService *scim.Service
+	if cfg.Auth.SCIM.Enabled {
+		if cfg.Auth.SCIM.Token == "" {
+			logger.Fatal("auth.scim.token is required when SCIM is enabled")
+		}
+		scimService = scim.NewService(db, cfg.Auth.SCIM, cfg.Auth.Admins)
+		if err := scimService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize SCIM: %v", err)
+		}
+		if loginAlerts == nil {
+			logger.Warn("SCIM deprovisioning revokes sessions only when auth.login_alerts is enabled")
+		}
+		logger.Info("SCIM provisioning enabled")
+	}
+
 	shareService := share.NewService(db, cfg)
+	// Share passwords used to be stored as entered; hash any that are left
+	if migrated, err := share.MigratePasswords(context.Background(), db); err != nil {
+		logger.Fatalf("Failed to migrate share passwords: %v", err)
+	} else if migrated > 0 {
+		logger.Infof("Hashed %d plaintext share passwords", migrated)
+	}
+	dropBox := share.NewDropBox(db, cfg.Share.Upload)
+	if err := dropBox.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize share uploads: %v", err)
+	}
+	var auditLogger *audit.Logger
+	if cfg.Audit.Enabled {
+		auditLogger = audit.NewLogger(db, cfg.Audit)
+		if err := auditLogger.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize audit log: %v", err)
+		}
+		auditLogger.Start()
+		defer auditLogger.Stop()
+		logger.Info("Audit logging enabled")
+	}
+
+	// Change journal for push notifications (GET /api/events)
+	var changeJournal *changes.Journal
+	if cfg.Events.Enabled {
+		changeJournal = changes.NewJournal(db, rdb, cfg.Events)
+		if err := changeJournal.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize change journal: %v", err)
+		}
+		changeJournal.Start()
+		defer changeJournal.Stop()
+		logger.Info("Change notifications enabled")
+	}
+	// Services writing files outside the WebDAV routes record their own changes; they take the journal
+	// as an interface, so a disabled journal is passed as nil rather than as a nil *changes.Journal
+	var fileJournal uploads.Journal
+	if changeJournal != nil {
+		fileJournal = changeJournal
+	}
+
+	shareReaper := share.NewReaper(db, cfg.Share.Cleanup)
+	if err := shareReaper.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize share cleanup: %v", err)
+	}
+	if auditLogger != nil {
+		shareReaper.SetAuditor(func(ctx context.Context, event share.ReapEvent) {
+			action := audit.ActionShareDisabled
+			if event.Action == share.ActionDeleted {
+				action = audit.ActionShareDeleted
+			}
+			auditLogger.Record(audit.Event{
+				Time:    event.Time,
+				UserID:  &event.UserID,
+				Actor:   "system",
+				Action:  action,
+				Path:    event.FilePath,
+				Result:  audit.ResultSuccess,
+				Details: map[string]string{"share_id": event.ShareID.String(), "reason": event.Reason},
+			})
+		})
+	}
+	shareReaper.Start()
+	defer shareReaper.Stop()
+
+	shareStats := share.NewAccessRecorder(db, cfg.Share.Stats)
+	if err := shareStats.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize share access stats: %v", err)
+	}
+
+	shortLinks := share.NewShortLinks(db, cfg.Share.ShortLinks)
+	if err := shortLinks.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize share short links: %v", err)
+	}
+
+	// Mirror and migration source passwords are stored encrypted, keyed by crypto.secret_key or the JWT secret
+	secretKey := cfg.Crypto.SecretKey
+	if secretKey == "" {
+		secretKey = cfg.Auth.JWTSecret
+	}
+	credentialBox, err := secretbox.New(secretKey)
+	if err != nil {
+		logger.Fatalf("Failed to initialize credential encryption: %v", err)
+	}
+
+	var mirrorService *mirror.Service
+	if cfg.Mirror.Enabled {
+		mirrorService = mirror.NewService(db, storageService, authService, credentialBox, cfg.Mirror)
+		mirrorService.SetJournal(fileJournal)
+		if err := mirrorService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize mirrors: %v", err)
+		}
+		mirrorService.Start()
+		defer mirrorService.Stop()
+		logger.Info("Mirror mode enabled")
+	}
 	
 	// Initialize property service
-	propertyService, err := webdav.NewPropertyService(cfg.App.DataPath + "/properties.db")
-	if err != nil {
-		logger.Fatalf("Failed to create property service: %v", err)
+	var propertyService *webdav.PropertyService
+	switch cfg.Properties.Backend {
+	case "postgres":
+		// Share the main pool so every replica sees the same properties
+		propertyService = webdav.NewPropertyServiceWithDB(db, webdav.DialectPostgres)
+	case "sqlite", "":
+		propertyService, err = webdav.NewSQLitePropertyService(cfg.Properties.SQLitePath, cfg.Properties.SQLite)
+		if err != nil {
+			logger.Fatalf("Failed to create property service: %v", err)
+		}
+	default:
+		logger.Fatalf("Unknown property backend: %s", cfg.Properties.Backend)
+	}
+	defer propertyService.Close()
+	if err := propertyService.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize property storage: %v", err)
+	}
+	if cfg.Properties.Cache.Enabled {
+		propertyService.SetCache(webdav.NewPropertyCache(cfg.Properties.Cache))
+		logger.WithField("ttl", cfg.Properties.Cache.TTL).Info("Property cache enabled")
+	}
+	logger.WithField("backend", cfg.Properties.Backend).Info("Property service initialized")
+
+	// Periodic ANALYZE/VACUUM of the local SQLite property database
+	propertyMaintainer := webdav.NewPropertyMaintainer(propertyService, cfg.Properties.SQLite)
+	propertyMaintainer.Start()
+	defer propertyMaintainer.Stop()
+
+	// Account deletion with a grace period, expired accounts are purged in the background
+	accounts := account.NewService(db, storageService, propertyService, cfg.Account)
+	if err := accounts.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize account deletion: %v", err)
+	}
+	// JWTs of suspended or deleted users and tokens issued before a session revocation are rejected,
+	// whether or not login alerts are enabled
+	authService.SetRevocationChecker(accounts)
+	accounts.Start()
+	defer accounts.Stop()
+
+	var migrations *migration.Service
+	if cfg.Migration.Enabled {
+		migrations = migration.NewService(db, storageService, authService, propertyService, credentialBox, cfg.Migration)
+		migrations.SetJournal(fileJournal)
+		if err := migrations.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize migrations: %v", err)
+		}
+		migrations.Start()
+		defer migrations.Stop()
+		logger.Info("WebDAV migration enabled")
+	}
+
+	var commentService *comments.Service
+	if cfg.Comments.Enabled {
+		var properties comments.PropertyStore
+		if cfg.Comments.CountProperty {
+			properties = propertyService
+		}
+		var journal comments.Journal
+		if changeJournal != nil {
+			journal = changeJournal
+		}
+		commentService = comments.NewService(db, storageService, properties, journal, cfg.Comments)
+		if err := commentService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize comments: %v", err)
+		}
+		logger.Info("File comments enabled")
+	}
+
+	var mediaService *media.Service
+	if cfg.Media.Enabled {
+		mediaService = media.NewService(db, storageService, propertyService, cfg.Media)
+		if err := mediaService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize media metadata: %v", err)
+		}
+		mediaService.Start()
+		defer mediaService.Stop()
+		logger.Info("Media metadata extraction enabled")
+	}
+
+	zipDownloader := archive.NewZipDownloader(storageService, cfg)
+
+	// Background jobs for operations that outlive an HTTP request; runners are registered with the routes
+	jobManager := jobs.NewManager(db, cfg.Jobs)
+	if err := jobManager.Initialize(context.Background()); err != nil {
+		logger.Fatalf("Failed to initialize background jobs: %v", err)
 	}
-	logger.Info("Property service initialized")
 	
 	webdavHandler := webdav.NewHandler(storageService, authService, propertyService)
+	webdavHandler.SetConfig(cfg.WebDAV)
+	// 解压、导入写入的条目与PUT、MKCOL使用同样的只读目录、锁、访问控制和配额检查
+	archiveService := archive.NewService(storageService, authService, webdavHandler.WriteGuard(), cfg)
+	archiveService.SetJournal(fileJournal)
+	// tar导入的PAX属性与PROPPATCH使用同一套属性规则
+	ingester := archive.NewIngester(storageService, authService, webdavHandler.WriteGuard(), propertyService, webdavHandler, cfg)
+	ingester.SetJournal(fileJournal)
+	webdavHandler.SetShareDB(db)
+	webdavHandler.SetDownloadRedirect(cfg.Download.Redirect)
+	if tenants != nil {
+		webdavHandler.SetTenantQuota(tenants)
+	}
+	// Case-insensitive lookups go through a folded-name index instead of listing every ancestor
+	if cfg.WebDAV.CaseInsensitive {
+		nameIndex := casefold.NewIndex(db, storageService)
+		if err := nameIndex.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize name index: %v", err)
+		}
+		storageService.SetNameIndex(nameIndex)
+		webdavHandler.SetNameIndex(nameIndex)
+	}
+
+	var uploadService *uploads.Service
+	if cfg.Uploads.Enabled {
+		uploadService = uploads.NewService(db, storageService, authService, fileJournal, cfg.Uploads)
+		uploadService.SetPathRules(cfg.WebDAV.MaxPathBytes, validators.NewFilenamePolicy(cfg.WebDAV.FilenamePolicy))
+		// Presigned uploads bypass the PUT handler, so they get its read-only folder, lock, ACL and quota checks
+		uploadService.SetWriteGuard(webdavHandler.WriteGuard())
+		if err := uploadService.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize direct uploads: %v", err)
+		}
+		uploadService.Start()
+		defer uploadService.Stop()
+		logger.Info("Presigned direct uploads enabled")
+	}
+
+	searcher := webdav.NewSearcher(storageService, propertyService, cfg.Search)
+	webdavHandler.SetSearcher(searcher)
+	var mediaQueue middleware.MediaQueue
+	if mediaService != nil {
+		searcher.SetMediaIndex(mediaService)
+		mediaQueue = mediaService
+	}
+
+	// Anonymous read-only namespace served from a designated user's folder
+	var publicHandler *webdav.PublicHandler
+	if cfg.WebDAV.Public.Enabled {
+		var publicUserID uuid.UUID
+		err := db.QueryRowContext(context.Background(),
+			`SELECT id FROM users WHERE username = $1 AND status = 'active'`, cfg.WebDAV.Public.Username).Scan(&publicUserID)
+		if err != nil {
+			logger.Fatalf("Public namespace user %q not found: %v", cfg.WebDAV.Public.Username, err)
+		}
+		publicHandler = webdav.NewPublicHandler(webdavHandler, publicUserID, cfg.WebDAV.Public)
+		logger.WithField("prefix", cfg.WebDAV.Public.Prefix).Info("Public WebDAV namespace enabled")
+	}
+
+	// Periodically drop properties of resources removed outside WebDAV
+	orphanSweeper := webdav.NewOrphanSweeper(propertyService, storageService, cfg.WebDAV.OrphanSweepInterval)
+	orphanSweeper.Start()
+	defer orphanSweeper.Stop()
+
+	// Periodically recompute storage usage from the objects actually stored
+	quotaReconciler := quota.NewReconciler(db, storageService, cfg.Quota.Reconcile)
+	quotaReconciler.SetExempt(webdavHandler.QuotaExempt)
+	if dedupService != nil && cfg.Storage.Dedup.QuotaPolicy == "unique" {
+		quotaReconciler.SetContentKey(storage.BlobHash)
+	}
+	quotaReconciler.Start()
+	defer quotaReconciler.Stop()
+
+	// Per-folder usage breakdown, refreshed incrementally from WebDAV changes
+	var usageAggregator *quota.UsageAggregator
+	if cfg.Quota.Usage.Enabled {
+		usageAggregator = quota.NewUsageAggregator(db, storageService, cfg.Quota.Usage)
+		usageAggregator.SetExempt(webdavHandler.QuotaExempt)
+		if err := usageAggregator.Initialize(context.Background()); err != nil {
+			logger.Fatalf("Failed to initialize storage usage aggregation: %v", err)
+		}
+		usageAggregator.Start()
+		defer usageAggregator.Stop()
+	}
+
+	// Time-based bandwidth policies for WebDAV transfers
+	var bandwidthLimiter *bandwidth.Limiter
+	if cfg.Bandwidth.Enabled {
+		scheduler, err := bandwidth.NewScheduler(cfg.Bandwidth)
+		if err != nil {
+			logger.Fatalf("Invalid bandwidth configuration: %v", err)
+		}
+		bandwidthLimiter = bandwidth.NewLimiter(scheduler)
+		logger.WithField("windows", len(cfg.Bandwidth.Windows)).Info("Bandwidth scheduling enabled")
+	}
 
 	// Setup Gin
 	if cfg.Server.Mode == "release" {
@@ -95,45 +567,414 @@ func main() {
 
 	// Global middleware
 	router.Use(middleware.RecoveryMiddleware(logger))
-	router.Use(middleware.LoggerMiddleware(logger))
+	// Per-method deadlines must be set before the access logger wraps the response writer
+	router.Use(middleware.RequestTimeoutMiddleware(middleware.MethodTimeouts(cfg.Server.Limits)))
+	router.Use(middleware.LoggerMiddleware(logger, cfg.Logging.Access))
 	
-	if cfg.App.EnableCORS {
-		router.Use(middleware.CORSMiddleware())
+	// CORS settings and the log level, lock policy and bandwidth schedule are reloaded on SIGHUP
+	corsSettings := middleware.NewCORS(cfg.CORS)
+	router.Use(middleware.CORSMiddleware(corsSettings))
+	router.Use(middleware.HSTSMiddleware(cfg.Server.TLS.HSTS))
+	// Large PROPFIND multistatus and JSON listings are compressed when the client accepts it
+	router.Use(middleware.CompressionMiddleware(cfg.Server.Compression))
+	// During shutdown new writes get 503 while in-flight transfers are allowed to finish
+	drainer := drain.New()
+	router.Use(middleware.DrainMiddleware(drainer))
+	configReloader := newConfigReloader(cfg, logger, webdavHandler.LockManager(), bandwidthLimiter, corsSettings)
+	configReloader.Start()
+	defer configReloader.Stop()
+
+	// Metrics
+	if cfg.Metrics.Enabled {
+		var tenantMetrics *metrics.TenantMetrics
+		if cfg.Metrics.Tenants.Enabled {
+			tenantMetrics = metrics.NewTenantMetrics(db, cfg.Metrics.Tenants)
+			tenantMetrics.SetMultiTenant(tenants != nil)
+			if tenants == nil {
+				logger.Warn("Tenant metrics count every account under tenant=\"_none\" unless tenancy is enabled")
+			}
+			router.Use(middleware.TenantMetricsMiddleware(tenantMetrics))
+		}
+		if cfg.Metrics.Token == "" {
+			logger.Warn("Metrics endpoint is enabled without metrics.token; restrict access to it at the proxy")
+		}
+		router.GET(cfg.Metrics.Path, handleMetrics(tenantMetrics, quotaReconciler, storageService, cfg.Metrics.Token))
 	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
-			"time":   time.Now().Unix(),
+	// Health checks: liveness never touches dependencies, readiness probes each of them
+	healthChecker := health.NewChecker(cfg.Health)
+	healthChecker.Register("database", db.PingContext)
+	if rdb != nil {
+		healthChecker.Register("redis", func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
 		})
-	})
+	}
+	healthChecker.Register("storage", storageService.HealthCheck)
+	healthChecker.Register("properties", propertyService.HealthCheck)
+	healthChecker.Register("drain", drainer.HealthCheck)
+	router.GET("/health", handleLiveness())
+	router.GET("/health/live", handleLiveness())
+	router.GET("/health/ready", handleReadiness(healthChecker))
+
+	// CalDAV/CardDAV service discovery
+	for _, wellKnown := range []string{"/.well-known/caldav", "/.well-known/carddav"} {
+		router.GET(wellKnown, handleWellKnownDAV("/webdav/"))
+		router.Handle("PROPFIND", wellKnown, handleWellKnownDAV("/webdav/"))
+	}
+
+	// Microsoft Office protocol discovery probes the site root before opening documents
+	router.OPTIONS("/", webdavHandler.HandleOptions)
+
+	// Server time for clients to detect clock skew
+	router.GET("/api/time", handleGetServerTime())
 
 	// Auth routes
 	authGroup := router.Group("/api/auth")
 	{
-		authGroup.POST("/register", handleRegister(authService))
-		authGroup.POST("/login", handleLogin(authService, storageService))
-		authGroup.GET("/me", middleware.AuthMiddleware(authService), handleGetMe(authService))
+		authGroup.POST("/register", handleRegister(authService, tenants, cfg.Auth.Admins))
+		authGroup.POST("/login", middleware.AuditMiddleware(auditLogger, audit.ActionLogin), handleLogin(authService, storageService, loginAlerts, twoFactor, tenants))
+		authGroup.GET("/me", middleware.AuthMiddleware(authService), middleware.TenantMiddleware(tenants), middleware.RequireScope(apitoken.ScopeRead), handleGetMe(authService))
+		if twoFactor != nil {
+			authGroup.POST("/2fa/verify", middleware.AuditMiddleware(auditLogger, audit.ActionMFAVerify), handleVerifyTwoFactor(twoFactor, authService, storageService, loginAlerts))
+			authGroup.POST("/2fa/enroll", handleEnrollTwoFactor(twoFactor))
+
+			twoFactorGroup := authGroup.Group("/2fa")
+			twoFactorGroup.Use(middleware.AuthMiddleware(authService))
+			twoFactorGroup.Use(middleware.TenantMiddleware(tenants))
+			twoFactorGroup.Use(middleware.SessionOnly())
+			twoFactorGroup.GET("", handleGetTwoFactorStatus(twoFactor))
+			twoFactorGroup.POST("/setup", handleSetupTwoFactor(twoFactor))
+			twoFactorGroup.POST("/confirm", handleConfirmTwoFactor(twoFactor))
+			twoFactorGroup.POST("/disable", handleDisableTwoFactor(twoFactor))
+			twoFactorGroup.POST("/recovery-codes", handleRegenerateRecoveryCodes(twoFactor))
+		}
+		if loginAlerts != nil {
+			authGroup.GET("/login-alerts/:token", handleGetLoginAlert(loginAlerts))
+			authGroup.POST("/login-alerts/:token/deny", handleDenyLoginAlert(loginAlerts))
+			authGroup.POST("/password/reset", handleResetPassword(loginAlerts))
+		}
+		if samlProvider != nil {
+			authGroup.GET("/saml/metadata", handleSAMLMetadata(samlProvider))
+			authGroup.GET("/saml/login", handleSAMLLogin(samlProvider))
+			authGroup.POST("/saml/acs", handleSAMLACS(samlProvider, provisioner, authService, storageService, cfg.Auth.SAML.RedirectURL))
+		}
+		if oidcProvider != nil {
+			authGroup.GET("/oidc/login", handleOIDCLogin(oidcProvider))
+			authGroup.GET("/oidc/callback", handleOIDCCallback(oidcProvider, provisioner, authService, storageService, cfg.Auth.OIDC.RedirectURL))
+		}
+	}
+
+	// SCIM routes for identity providers
+	if scimService != nil {
+		scimGroup := router.Group("/scim/v2")
+		scimGroup.Use(middleware.SCIMAuthMiddleware(cfg.Auth.SCIM.Token))
+		{
+			scimGroup.GET("/ServiceProviderConfig", handleSCIMServiceProviderConfig(scimService))
+			scimGroup.GET("/ResourceTypes", handleSCIMResourceTypes())
+			scimGroup.GET("/Users", handleSCIMListUsers(scimService))
+			scimGroup.POST("/Users", handleSCIMCreateUser(scimService))
+			scimGroup.GET("/Users/:id", handleSCIMGetUser(scimService))
+			scimGroup.PUT("/Users/:id", handleSCIMReplaceUser(scimService))
+			scimGroup.PATCH("/Users/:id", handleSCIMPatchUser(scimService))
+			scimGroup.DELETE("/Users/:id", handleSCIMDeleteUser(scimService))
+			scimGroup.GET("/Groups", handleSCIMListGroups(scimService))
+			scimGroup.POST("/Groups", handleSCIMCreateGroup(scimService))
+			scimGroup.GET("/Groups/:id", handleSCIMGetGroup(scimService))
+			scimGroup.PUT("/Groups/:id", handleSCIMReplaceGroup(scimService))
+			scimGroup.PATCH("/Groups/:id", handleSCIMPatchGroup(scimService))
+			scimGroup.DELETE("/Groups/:id", handleSCIMDeleteGroup(scimService))
+		}
+	}
+
+	// API token management, only with a session token
+	if apiTokens != nil {
+		tokenGroup := router.Group("/api/tokens")
+		tokenGroup.Use(middleware.AuthMiddleware(authService))
+		tokenGroup.Use(middleware.TenantMiddleware(tenants))
+		tokenGroup.Use(middleware.SessionOnly())
+		{
+			tokenGroup.GET("", handleListAPITokens(apiTokens))
+			tokenGroup.POST("", middleware.AuditMiddleware(auditLogger, audit.ActionTokenCreate), handleCreateAPIToken(apiTokens))
+			tokenGroup.POST("/:id/rotate", middleware.AuditMiddleware(auditLogger, audit.ActionTokenRotate), handleRotateAPIToken(apiTokens))
+			tokenGroup.DELETE("/:id", middleware.AuditMiddleware(auditLogger, audit.ActionTokenRevoke), handleRevokeAPIToken(apiTokens))
+		}
 	}
 
 	// Share routes
 	shareGroup := router.Group("/api/shares")
 	shareGroup.Use(middleware.AuthMiddleware(authService))
+	shareGroup.Use(middleware.TenantMiddleware(tenants))
+	shareGroup.Use(middleware.RequireScope(apitoken.ScopeShare))
 	{
-		shareGroup.POST("", handleCreateShare(shareService))
-		shareGroup.GET("", handleListShares(shareService))
+		shareGroup.POST("", middleware.AuditMiddleware(auditLogger, audit.ActionShareCreate), handleCreateShare(shareService, dropBox, shortLinks, cfg.Share.Password))
+		shareGroup.GET("", handleListShares(shareService, shareReaper))
 		shareGroup.DELETE("/:id", handleDeleteShare(shareService))
+		shareGroup.GET("/:id/stats", handleGetShareStats(shareStats))
+		shareGroup.GET("/:id/qrcode", handleGetShareQRCode(shortLinks))
 	}
 
-	// Public share access
-	router.GET("/share/:token", handleGetShare(shareService, storageService, authService))
-	router.POST("/share/:token/access", handleAccessShare(shareService))
+	// File routes
+	fileGroup := router.Group("/api/files")
+	fileGroup.Use(middleware.TransferMiddleware(drainer))
+	fileGroup.Use(middleware.AuthMiddleware(authService))
+	fileGroup.Use(middleware.TenantMiddleware(tenants))
+	fileGroup.Use(middleware.MethodScope())
+	{
+		fileGroup.GET("/info", handleGetFileInfo(storageService))
+		fileGroup.POST("/extract", handleExtractArchive(archiveService))
+		fileGroup.GET("/extract/:id", handleGetExtractJob(archiveService))
+		fileGroup.POST("/ingest", handleIngestTar(ingester))
+		fileGroup.GET("/segments", handleGetFileSegments(storageService, cfg.Download))
+		fileGroup.GET("/checksum", handleGetFileChecksum(storageService, propertyService))
+		if commentService != nil {
+			fileGroup.GET("/comments", handleListComments(commentService))
+			fileGroup.POST("/comments", handleCreateComment(commentService))
+			fileGroup.DELETE("/comments", handleDeleteComment(commentService))
+		}
+	}
+
+	// Favorites set by sync clients through oc:favorite
+	favoriteGroup := router.Group("/api/favorites")
+	favoriteGroup.Use(middleware.AuthMiddleware(authService))
+	favoriteGroup.Use(middleware.TenantMiddleware(tenants))
+	favoriteGroup.Use(middleware.MethodScope())
+	{
+		favoriteGroup.GET("", handleListFavorites(propertyService, storageService))
+	}
+
+	// Tags stored as properties of the tagged resources
+	if cfg.Tags.Enabled {
+		tagGroup := router.Group("/api/tags")
+		tagGroup.Use(middleware.AuthMiddleware(authService))
+		tagGroup.Use(middleware.TenantMiddleware(tenants))
+		tagGroup.Use(middleware.MethodScope())
+		{
+			tagGroup.GET("", handleListTags(propertyService))
+			tagGroup.GET("/:tag/files", handleListTaggedFiles(propertyService, storageService))
+			tagGroup.PUT("/:tag/files", handleTagFile(propertyService, storageService))
+			tagGroup.DELETE("/:tag/files", handleUntagFile(propertyService, storageService))
+		}
+		logger.Info("Tags enabled")
+	}
+
+	// Presigned uploads written directly to storage
+	if uploadService != nil {
+		uploadGroup := router.Group("/api/uploads")
+		uploadGroup.Use(middleware.AuthMiddleware(authService))
+		uploadGroup.Use(middleware.TenantMiddleware(tenants))
+		uploadGroup.Use(middleware.MethodScope())
+		{
+			uploadGroup.POST("/presign", handlePresignUpload(uploadService))
+			uploadGroup.GET("/:id", handleGetUpload(uploadService))
+			uploadGroup.POST("/:id/complete", handleCompleteUpload(uploadService))
+			uploadGroup.DELETE("/:id", handleCancelUpload(uploadService))
+		}
+	}
+
+	// Batch delete/move/copy/mkdir, executed through the WebDAV routes
+	router.POST("/api/batch", middleware.AuthMiddleware(authService), middleware.TenantMiddleware(tenants), middleware.RequireScope(apitoken.ScopeWrite), handleBatch(router, "/webdav", cfg.Batch, jobManager))
+
+	// Background jobs
+	jobManager.Register(jobKindBatch, newBatchJobRunner(router, "/webdav", authService, tenants))
+	jobManager.Register(jobKindZipExport, newZipExportJobRunner(zipDownloader, storageService, authService))
+	jobManager.Register(jobKindAccountExport, newAccountExportJobRunner(accounts, storageService, authService))
+	if dedupService != nil {
+		jobManager.Register(jobKindDedupScan, newDedupScanJobRunner(dedupService))
+	}
+	jobManager.Start()
+	defer jobManager.Stop()
+	jobGroup := router.Group("/api/jobs")
+	jobGroup.Use(middleware.AuthMiddleware(authService))
+	jobGroup.Use(middleware.TenantMiddleware(tenants))
+	jobGroup.Use(middleware.MethodScope())
+	{
+		jobGroup.GET("", handleListJobs(jobManager))
+		jobGroup.GET("/:id", handleGetJob(jobManager))
+		jobGroup.POST("/:id/cancel", handleCancelJob(jobManager))
+	}
+
+	// Account deletion and personal data export, only with a session token
+	accountGroup := router.Group("/api/account")
+	accountGroup.Use(middleware.AuthMiddleware(authService))
+	accountGroup.Use(middleware.TenantMiddleware(tenants))
+	accountGroup.Use(middleware.SessionOnly())
+	{
+		accountGroup.DELETE("", middleware.AuditMiddleware(auditLogger, audit.ActionAccountDelete), handleDeleteAccount(accounts))
+		accountGroup.POST("/export", middleware.AuditMiddleware(auditLogger, audit.ActionAccountExport), handleExportAccount(accounts, jobManager))
+	}
+
+	// Storage usage breakdown
+	if usageAggregator != nil {
+		router.GET("/api/usage", middleware.AuthMiddleware(authService), middleware.TenantMiddleware(tenants), middleware.RequireScope(apitoken.ScopeRead), handleGetUsage(usageAggregator))
+	}
+
+	// Change notifications
+	if changeJournal != nil {
+		router.GET("/api/events", middleware.AuthMiddleware(authService), middleware.TenantMiddleware(tenants), middleware.RequireScope(apitoken.ScopeRead), handleEvents(changeJournal, cfg.Events))
+	}
+
+	// Lock routes
+	lockGroup := router.Group("/api/locks")
+	lockGroup.Use(middleware.AuthMiddleware(authService))
+	lockGroup.Use(middleware.TenantMiddleware(tenants))
+	lockGroup.Use(middleware.RequireScope(apitoken.ScopeRead))
+	{
+		lockGroup.GET("", handleListMyLocks(webdavHandler.LockManager()))
+		lockGroup.GET("/policy", handleGetLockPolicy(webdavHandler.LockManager()))
+	}
+
+	// Sync routes
+	syncGroup := router.Group("/api/sync")
+	syncGroup.Use(middleware.AuthMiddleware(authService))
+	syncGroup.Use(middleware.TenantMiddleware(tenants))
+	syncGroup.Use(middleware.RequireScope(apitoken.ScopeRead))
+	{
+		syncGroup.POST("/check", handleSyncCheck(storageService, propertyService))
+	}
+
+	// Folder routes
+	folderGroup := router.Group("/api/folders")
+	folderGroup.Use(middleware.AuthMiddleware(authService))
+	folderGroup.Use(middleware.TenantMiddleware(tenants))
+	folderGroup.Use(middleware.MethodScope())
+	{
+		folderGroup.GET("/frozen", handleListFrozenFolders(propertyService))
+		folderGroup.POST("/freeze", handleFreezeFolder(propertyService, storageService))
+		folderGroup.POST("/unfreeze", handleUnfreezeFolder(propertyService))
+	}
+
+	// Download routes
+	downloadGroup := router.Group("/api/download")
+	downloadGroup.Use(middleware.TransferMiddleware(drainer))
+	downloadGroup.Use(middleware.AuthMiddleware(authService))
+	downloadGroup.Use(middleware.TenantMiddleware(tenants))
+	downloadGroup.Use(middleware.RequireScope(apitoken.ScopeRead))
+	{
+		downloadGroup.POST("/zip", handleZipDownload(zipDownloader, jobManager))
+	}
+
+	// Search routes
+	searchGroup := router.Group("/api/search")
+	searchGroup.Use(middleware.AuthMiddleware(authService))
+	searchGroup.Use(middleware.TenantMiddleware(tenants))
+	searchGroup.Use(middleware.RequireScope(apitoken.ScopeRead))
+	{
+		searchGroup.GET("", handleSearch(searcher))
+	}
+
+	// Mirror routes
+	if mirrorService != nil {
+		mirrorGroup := router.Group("/api/mirrors")
+		mirrorGroup.Use(middleware.AuthMiddleware(authService))
+		mirrorGroup.Use(middleware.TenantMiddleware(tenants))
+		mirrorGroup.Use(middleware.MethodScope())
+		{
+			mirrorGroup.GET("", handleListMirrors(mirrorService))
+			mirrorGroup.POST("", handleCreateMirror(mirrorService))
+			mirrorGroup.GET("/:id", handleGetMirror(mirrorService))
+			mirrorGroup.PATCH("/:id", handleUpdateMirror(mirrorService))
+			mirrorGroup.DELETE("/:id", handleDeleteMirror(mirrorService))
+			mirrorGroup.POST("/:id/sync", handleSyncMirror(mirrorService))
+		}
+	}
+
+	// Admin routes
+	adminGroup := router.Group("/api/admin")
+	adminGroup.Use(middleware.AuthMiddleware(authService))
+	adminGroup.Use(middleware.TenantMiddleware(tenants))
+	adminGroup.Use(middleware.RequireScope(apitoken.ScopeAdmin))
+	adminGroup.Use(middleware.AdminMiddleware(cfg.Auth.Admins))
+	{
+		if auditLogger != nil {
+			adminGroup.GET("/audit", handleListAuditEvents(auditLogger))
+		}
+		adminGroup.GET("/quota/reconcile", handleGetQuotaReconcile(quotaReconciler))
+		adminGroup.POST("/quota/reconcile", handleTriggerQuotaReconcile(quotaReconciler))
+		adminGroup.GET("/properties/stats", handleGetPropertyStats(propertyService))
+		adminGroup.POST("/properties/maintenance", handleTriggerPropertyMaintenance(propertyMaintainer))
+		if dedupService != nil {
+			adminGroup.GET("/dedup", handleGetDedupStats(dedupService))
+			adminGroup.POST("/dedup/scan", handleSubmitDedupScan(jobManager))
+		}
+		adminGroup.GET("/locks", handleListLocks(webdavHandler.LockManager()))
+		adminGroup.DELETE("/locks/:token", middleware.AuditMiddleware(auditLogger, audit.ActionLockRelease), handleForceUnlock(webdavHandler.LockManager()))
+		if apiTokens != nil {
+			adminGroup.GET("/tokens", handleListAllAPITokens(apiTokens))
+			adminGroup.DELETE("/tokens/:id", middleware.AuditMiddleware(auditLogger, audit.ActionTokenRevoke), handleAdminRevokeAPIToken(apiTokens))
+		}
+		if tenants != nil {
+			adminGroup.GET("/tenants", handleListTenants(tenants))
+			adminGroup.POST("/tenants", handleCreateTenant(tenants))
+			adminGroup.GET("/tenants/:id", handleGetTenant(tenants))
+			adminGroup.PATCH("/tenants/:id", handleUpdateTenant(tenants))
+			adminGroup.PUT("/tenants/:id/users/:userId", handleAddTenantMember(tenants))
+		}
+		adminGroup.GET("/account-deletions", handleListAccountDeletions(accounts))
+		adminGroup.DELETE("/account-deletions/:id", middleware.AuditMiddleware(auditLogger, audit.ActionAccountRestore), handleRestoreAccount(accounts))
+		if migrations != nil {
+			adminGroup.GET("/migrations", handleListMigrations(migrations))
+			adminGroup.POST("/migrations", middleware.AuditMiddleware(auditLogger, audit.ActionMigrationCreate), handleCreateMigration(migrations))
+			adminGroup.GET("/migrations/:id", handleGetMigration(migrations))
+			adminGroup.POST("/migrations/:id/cancel", handleCancelMigration(migrations))
+			adminGroup.POST("/migrations/:id/resume", handleResumeMigration(migrations))
+		}
+		if twoFactor != nil {
+			adminGroup.PUT("/users/:id/2fa", handleSetTwoFactorRequired(twoFactor))
+			adminGroup.DELETE("/users/:id/2fa", middleware.AuditMiddleware(auditLogger, audit.ActionMFAReset), handleResetTwoFactor(twoFactor))
+		}
+	}
+
+	// Tenant administration for tenant admins, scoped to their own tenant
+	if tenants != nil {
+		tenantGroup := router.Group("/api/tenant")
+		tenantGroup.Use(middleware.AuthMiddleware(authService))
+		tenantGroup.Use(middleware.TenantMiddleware(tenants))
+		tenantGroup.Use(middleware.RequireScope(apitoken.ScopeAdmin))
+		tenantGroup.Use(middleware.TenantAdminMiddleware())
+		{
+			tenantGroup.GET("", handleGetOwnTenant(tenants))
+			tenantGroup.GET("/users", handleListOwnTenantMembers(tenants))
+			tenantGroup.PUT("/users/:id/role", handleSetOwnTenantMemberRole(tenants))
+		}
+	}
+
+	// Public share access, only on the address of the owner's tenant
+	router.GET("/share/:token", middleware.TransferMiddleware(drainer), middleware.TenantShareMiddleware(tenants), handleGetShare(shareService, dropBox, storageService, authService))
+	router.GET("/share/:token/list", middleware.TenantShareMiddleware(tenants), recordShareAccess(shareStats, share.AccessList), handleShareList(shareService, storageService))
+	router.GET("/share/:token/download", middleware.TransferMiddleware(drainer), middleware.TenantShareMiddleware(tenants), middleware.AuditMiddleware(auditLogger, audit.ActionShareAccess), recordShareAccess(shareStats, share.AccessDownload), handleShareDownload(shareService, storageService, cfg.Download.Redirect))
+	router.POST("/share/:token/access", middleware.TenantShareMiddleware(tenants), middleware.AuditMiddleware(auditLogger, audit.ActionShareAccess), recordShareAccess(shareStats, share.AccessOpen), handleAccessShare(shareService))
+	router.POST("/share/:token/zip", middleware.TransferMiddleware(drainer), middleware.TenantShareMiddleware(tenants), middleware.AuditMiddleware(auditLogger, audit.ActionShareAccess), recordShareAccess(shareStats, share.AccessZip), handleShareZipDownload(shareService, zipDownloader))
+	router.POST("/share/:token/upload", middleware.TransferMiddleware(drainer), middleware.TenantShareMiddleware(tenants), middleware.AuditMiddleware(auditLogger, audit.ActionShareUpload), recordShareAccess(shareStats, share.AccessUpload), handleShareUpload(shareService, dropBox, storageService, authService, changeJournal))
+	router.PUT("/share/:token/upload", middleware.TransferMiddleware(drainer), middleware.TenantShareMiddleware(tenants), middleware.AuditMiddleware(auditLogger, audit.ActionShareUpload), recordShareAccess(shareStats, share.AccessUpload), handleShareUpload(shareService, dropBox, storageService, authService, changeJournal))
+	if shortLinks.Enabled() {
+		// Short links redirect to /share/:token, where the tenant check applies
+		router.GET("/s/:slug", handleShortLink(shortLinks))
+	}
 
 	// WebDAV routes
 	webdavGroup := router.Group("/webdav")
+	// Normalize the path first so auditing, the change journal and quota accounting see the same form as storage
+	webdavGroup.Use(webdavHandler.NormalizePath)
+	webdavGroup.Use(middleware.TransferMiddleware(drainer))
 	webdavGroup.Use(middleware.AuthMiddleware(authService))
+	webdavGroup.Use(middleware.TenantMiddleware(tenants))
+	webdavGroup.Use(middleware.MethodScope())
+	// Replayed retries must skip auditing, the change journal and quota accounting
+	webdavGroup.Use(middleware.IdempotencyMiddleware(idempotencyStore))
+	webdavGroup.Use(middleware.AuditMiddleware(auditLogger, ""))
+	webdavGroup.Use(middleware.ChangeJournalMiddleware(changeJournal))
+	webdavGroup.Use(middleware.MediaMetadataMiddleware(mediaQueue))
+	webdavGroup.Use(middleware.UsageMiddleware(usageAggregator))
+	webdavGroup.Use(middleware.RequestBodyLimitMiddleware(cfg.Server.Limits))
 	webdavGroup.Use(middleware.StorageQuotaMiddleware(authService))
+	if bandwidthLimiter != nil {
+		webdavGroup.Use(middleware.BandwidthMiddleware(bandwidthLimiter))
+	}
+	if cfg.Tags.Enabled {
+		// Virtual tag collections are not real paths, so they are served before case resolution
+		webdavGroup.Use(webdavHandler.TagCollections)
+	}
+	webdavGroup.Use(webdavHandler.ResolveCase)
 	{
 		webdavGroup.Handle("OPTIONS", "/*path", webdavHandler.HandleOptions)
 		webdavGroup.Handle("PROPFIND", "/*path", webdavHandler.HandlePropfind)
@@ -141,28 +982,94 @@ func main() {
 		webdavGroup.Handle("GET", "/*path", webdavHandler.HandleGet)
 		webdavGroup.Handle("HEAD", "/*path", webdavHandler.HandleHead)
 		webdavGroup.Handle("PUT", "/*path", webdavHandler.HandlePut)
+		webdavGroup.Handle("PATCH", "/*path", webdavHandler.HandlePatch)
 		webdavGroup.Handle("DELETE", "/*path", webdavHandler.HandleDelete)
 		webdavGroup.Handle("MKCOL", "/*path", webdavHandler.HandleMkcol)
 		webdavGroup.Handle("MOVE", "/*path", webdavHandler.HandleMove)
 		webdavGroup.Handle("COPY", "/*path", webdavHandler.HandleCopy)
 		webdavGroup.Handle("LOCK", "/*path", webdavHandler.HandleLock)
 		webdavGroup.Handle("UNLOCK", "/*path", webdavHandler.HandleUnlock)
+		webdavGroup.Handle("SEARCH", "/*path", webdavHandler.HandleSearch)
+		webdavGroup.Handle("MKCALENDAR", "/*path", webdavHandler.HandleMkcalendar)
+		webdavGroup.Handle("REPORT", "/*path", webdavHandler.HandleReport)
+		webdavGroup.Handle("ACL", "/*path", webdavHandler.HandleACL)
+	}
+
+	// Public read-only WebDAV (no authentication)
+	if publicHandler != nil {
+		publicGroup := router.Group(webdav.PublicBasePath)
+		publicGroup.Use(middleware.TransferMiddleware(drainer))
+		publicGroup.Use(webdavHandler.NormalizePath)
+		if bandwidthLimiter != nil {
+			publicGroup.Use(middleware.BandwidthMiddleware(bandwidthLimiter))
+		}
+		for _, method := range []string{"OPTIONS", "GET", "HEAD", "PROPFIND", "PROPPATCH", "PUT", "DELETE", "MKCOL", "MOVE", "COPY", "LOCK", "UNLOCK"} {
+			publicGroup.Handle(method, "/*path", publicHandler.Handle)
+		}
 	}
 
 	// Setup HTTP server
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+	var handler http.Handler = router
+	if tenants != nil {
+		// Path-based tenancy strips /{prefix}/{slug} before routing
+		handler = tenants.Resolver().Handler(router)
+	}
 	srv := &http.Server{
-		Addr:           addr,
-		Handler:        router,
-		ReadTimeout:    15 * time.Minute,
-		WriteTimeout:   15 * time.Minute,
-		MaxHeaderBytes: 1 << 20,
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+	}
+
+	var redirectSrv *http.Server
+	if cfg.Server.TLS.Enabled {
+		var certManager *autocert.Manager
+		if cfg.Server.TLS.ACME.Enabled {
+			certManager = newCertManager(cfg.Server.TLS.ACME)
+			logger.Infof("Obtaining certificates via ACME for %v", cfg.Server.TLS.ACME.Domains)
+		}
+		tlsConfig, err := serverTLSConfig(cfg.Server.TLS, certManager)
+		if err != nil {
+			logger.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		srv.TLSConfig = tlsConfig
+
+		if cfg.Server.TLS.RedirectAddress != "" {
+			redirectSrv = newRedirectServer(cfg.Server.TLS.RedirectAddress, addr, certManager)
+			go func() {
+				logger.Infof("Redirecting HTTP on %s to HTTPS", redirectSrv.Addr)
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Fatalf("Failed to start HTTP redirect listener: %v", err)
+				}
+			}()
+		}
+	}
+
+	// HTTP/2 must be configured after TLSConfig is set
+	if err := configureHTTP2(srv, cfg.Server.HTTP2, cfg.Server.TLS.Enabled); err != nil {
+		logger.Fatalf("Failed to configure HTTP/2: %v", err)
+	}
+
+	ln, err := listen(addr, cfg.Server.MaxConnections)
+	if err != nil {
+		logger.Fatalf("Failed to listen on %s: %v", addr, err)
 	}
 
 	// Graceful shutdown
 	go func() {
 		logger.Infof("Starting server on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.Server.TLS.Enabled {
+			// With ACME the certificate comes from TLSConfig.GetCertificate and both paths are empty
+			err = srv.ServeTLS(ln, cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -173,12 +1080,14 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
+	if redirectSrv != nil {
+		redirectSrv.Close()
+	}
+	shutdownServer(srv, drainer, cfg.Server.Shutdown, logger)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+	// Persist locks so clients keep their lock tokens across the restart
+	if err := webdavHandler.LockManager().Close(); err != nil {
+		logger.Warnf("Failed to flush locks: %v", err)
 	}
 
 	logger.Info("Server exited")
@@ -276,163 +1185,3 @@ func handleGetMe(authService *auth.Service) gin.HandlerFunc {
 		})
 	}
 }
-
-// handleCreateShare 处理创建分享
-func handleCreateShare(shareService *share.Service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
-			return
-		}
-
-		var req struct {
-			FilePath     string `json:"file_path" binding:"required"`
-			ShareName    string `json:"share_name" binding:"required,max=100"`
-			Password     string `json:"password"`
-			ExpiresIn    int    `json:"expires_in"` // 小时
-			MaxDownloads int    `json:"max_downloads"`
-			Permissions  string `json:"permissions" binding:"oneof=read write"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		share, err := shareService.CreateShare(userID, req.FilePath, req.ShareName, req.Password, req.ExpiresIn, req.MaxDownloads, req.Permissions)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.JSON(http.StatusCreated, gin.H{
-			"share_url":  fmt.Sprintf("/share/%s", share.ShareToken),
-			"share_token": share.ShareToken,
-			"expires_at":  share.ExpiresAt,
-		})
-	}
-}
-
-// handleListShares 处理列出分享
-func handleListShares(shareService *share.Service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
-			return
-		}
-
-		shares, err := shareService.ListShares(userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享列表失败"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"shares": shares,
-		})
-	}
-}
-
-// handleDeleteShare 处理删除分享
-func handleDeleteShare(shareService *share.Service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
-			return
-		}
-
-		shareID := c.Param("id")
-		if shareID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "分享ID不能为空"})
-			return
-		}
-
-		err := shareService.DeleteShare(userID, shareID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": "分享已删除",
-		})
-	}
-}
-
-// handleGetShare 处理获取分享
-func handleGetShare(shareService *share.Service, storageService *storage.Service, authService *auth.Service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := c.Param("token")
-		if token == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "分享令牌不能为空"})
-			return
-		}
-
-		share, err := shareService.GetShareByToken(token)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在或已过期"})
-			return
-		}
-
-		// 获取文件信息
-		fileInfo, err := storageService.GetFileInfo(share.UserID, share.FilePath)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"share":   share,
-			"file":    fileInfo,
-			"requires_password": share.Password != "",
-		})
-	}
-}
-
-// handleAccessShare 处理访问分享
-func handleAccessShare(shareService *share.Service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := c.Param("token")
-		if token == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "分享令牌不能为空"})
-			return
-		}
-
-		var req struct {
-			Password string `json:"password"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		// 验证分享访问权限
-		err := shareService.ValidateShareAccess(token, req.Password)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "访问被拒绝"})
-			return
-		}
-
-		// 获取分享信息
-		share, err := shareService.GetShareByToken(token)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在"})
-			return
-		}
-
-		// 记录访问
-		err = shareService.RecordAccess(token)
-		if err != nil {
-			// 记录访问失败不影响主要功能
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": "访问允许",
-			"share":   share,
-		})
-	}
-}
\ No newline at end of file
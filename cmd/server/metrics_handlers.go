@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/metrics"
+	"github.com/webdav-gateway/internal/quota"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// handleMetrics 以Prometheus文本格式输出指标，配置了token时要求Bearer认证
+func handleMetrics(tenantMetrics *metrics.TenantMetrics, quotaReconciler *quota.Reconciler, storageService *storage.Service, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing bearer token"})
+				return
+			}
+		}
+
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if tenantMetrics != nil {
+			if err := tenantMetrics.WriteTo(c.Request.Context(), c.Writer); err != nil {
+				log.Printf("Warning: failed to write metrics: %v", err)
+			}
+		}
+		if quotaReconciler != nil {
+			if err := quotaReconciler.WriteMetrics(c.Writer); err != nil {
+				log.Printf("Warning: failed to write quota metrics: %v", err)
+			}
+		}
+		if err := storageService.WriteCopyMetrics(c.Writer); err != nil {
+			log.Printf("Warning: failed to write storage metrics: %v", err)
+		}
+	}
+}
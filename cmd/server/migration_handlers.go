@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/migration"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// handleListMigrations 管理员查看全部迁移
+func handleListMigrations(migrations *migration.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := migrations.List(c.Request.Context())
+		if err != nil {
+			migrationError(c, err, "failed to list migrations")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"migrations": list})
+	}
+}
+
+// handleCreateMigration 创建迁移，由后台在下一次轮询时开始执行
+func handleCreateMigration(migrations *migration.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+
+		var req models.CreateMigrationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		m, err := migrations.Create(c.Request.Context(), adminID, &req)
+		if err != nil {
+			migrationError(c, err, "failed to create migration")
+			return
+		}
+		c.JSON(http.StatusAccepted, m)
+	}
+}
+
+// handleGetMigration 查看迁移进度和失败的路径
+func handleGetMigration(migrations *migration.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := migrationID(c)
+		if !ok {
+			return
+		}
+
+		m, err := migrations.Get(c.Request.Context(), id)
+		if err != nil {
+			migrationError(c, err, "failed to get migration")
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// handleCancelMigration 取消等待中或运行中的迁移，已导入的文件保留
+func handleCancelMigration(migrations *migration.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := migrationID(c)
+		if !ok {
+			return
+		}
+
+		if err := migrations.Cancel(c.Request.Context(), id); err != nil {
+			migrationError(c, err, "failed to cancel migration")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleResumeMigration 重新执行失败或已取消的迁移，已导入的文件会被跳过
+func handleResumeMigration(migrations *migration.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := migrationID(c)
+		if !ok {
+			return
+		}
+
+		if err := migrations.Resume(c.Request.Context(), id); err != nil {
+			migrationError(c, err, "failed to resume migration")
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "migration queued"})
+	}
+}
+
+func migrationID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid migration id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func migrationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, migration.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "migration not found"})
+	case errors.Is(err, migration.ErrInvalidSource), errors.Is(err, migration.ErrUserNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, migration.ErrNotActive), errors.Is(err, migration.ErrNotResumable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Warning: migration request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/mirror"
+	"github.com/webdav-gateway/internal/models"
+)
+
+func handleListMirrors(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		mirrors, err := mirrorService.List(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list mirrors"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mirrors": mirrors})
+	}
+}
+
+func handleCreateMirror(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req models.CreateMirrorRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		m, err := mirrorService.Create(c.Request.Context(), userID, &req)
+		if err != nil {
+			mirrorError(c, err, "failed to create mirror")
+			return
+		}
+		c.JSON(http.StatusCreated, m)
+	}
+}
+
+func handleGetMirror(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := mirrorIDs(c)
+		if !ok {
+			return
+		}
+
+		m, err := mirrorService.Get(c.Request.Context(), userID, id)
+		if err != nil {
+			mirrorError(c, err, "failed to get mirror")
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+func handleUpdateMirror(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := mirrorIDs(c)
+		if !ok {
+			return
+		}
+
+		var req models.UpdateMirrorRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		m, err := mirrorService.Update(c.Request.Context(), userID, id, &req)
+		if err != nil {
+			mirrorError(c, err, "failed to update mirror")
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+func handleDeleteMirror(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := mirrorIDs(c)
+		if !ok {
+			return
+		}
+
+		if err := mirrorService.Delete(c.Request.Context(), userID, id); err != nil {
+			mirrorError(c, err, "failed to delete mirror")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleSyncMirror 安排立即同步，实际同步由后台任务在下一次轮询时执行
+func handleSyncMirror(mirrorService *mirror.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := mirrorIDs(c)
+		if !ok {
+			return
+		}
+
+		if err := mirrorService.Trigger(c.Request.Context(), userID, id); err != nil {
+			mirrorError(c, err, "failed to schedule mirror sync")
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "sync scheduled"})
+	}
+}
+
+func mirrorIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mirror id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func mirrorError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, mirror.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "mirror not found"})
+	case errors.Is(err, mirror.ErrInvalidSource), errors.Is(err, mirror.ErrInvalidTarget), errors.Is(err, mirror.ErrIntervalTooLow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, mirror.ErrTargetOverlap), errors.Is(err, mirror.ErrTooManyMirrors):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/sso"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+const (
+	// oidcLoginCookie 保存本浏览器发起的登录的state、nonce和PKCE verifier
+	oidcLoginCookie = "oidc_login"
+	// oidcLoginMaxAge 从跳转到IdP到回调允许的最长时间（秒）
+	oidcLoginMaxAge = 600
+)
+
+// handleOIDCLogin 发起授权码登录，跳转到IdP
+func handleOIDCLogin(provider *sso.OIDCProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redirect, login, err := provider.AuthCodeURL()
+		if err != nil {
+			log.Printf("Warning: failed to create OIDC request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start OIDC login"})
+			return
+		}
+
+		// IdP以顶级GET导航回调，SameSite=Lax的cookie会被带上
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcLoginCookie, login.Encode(), oidcLoginMaxAge, "/api/auth/oidc", "", true, true)
+		c.Redirect(http.StatusFound, redirect)
+	}
+}
+
+// handleOIDCCallback 用授权码换取并校验ID令牌，映射到本地用户并签发令牌
+func handleOIDCCallback(provider *sso.OIDCProvider, provisioner *sso.Provisioner, authService *auth.Service, storageService *storage.Service, redirectURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, _ := c.Cookie(oidcLoginCookie)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcLoginCookie, "", -1, "/api/auth/oidc", "", true, true)
+
+		// 用户在IdP拒绝授权或IdP出错时回调只带error参数
+		if idpError := c.Query("error"); idpError != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider rejected the login", "code": idpError, "description": c.Query("error_description")})
+			return
+		}
+
+		login, err := sso.DecodeOIDCLogin(cookie)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "login session expired, please sign in again", "code": "state_mismatch"})
+			return
+		}
+
+		identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), c.Query("state"), login)
+		if err != nil {
+			switch {
+			case errors.Is(err, sso.ErrOIDCState):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "login session expired, please sign in again", "code": "state_mismatch"})
+			case errors.Is(err, sso.ErrGroupNotAllowed):
+				c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to sign in", "code": "group_not_allowed"})
+			case errors.Is(err, sso.ErrInvalidIDToken):
+				log.Printf("Warning: rejected OIDC response: %v", err)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid OIDC response"})
+			default:
+				log.Printf("Warning: OIDC login failed: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+			}
+			return
+		}
+
+		finishSSOLogin(c, identity, provider.Options(), provisioner, authService, storageService, redirectURL)
+	}
+}
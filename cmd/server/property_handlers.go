@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleGetPropertyStats 返回属性数据库的大小、碎片情况和最近一次维护的结果
+func handleGetPropertyStats(properties *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := properties.GetStats(c.Request.Context())
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get property database stats"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"running": properties.MaintenanceRunning(),
+			"stats":   stats,
+		})
+	}
+}
+
+// handleTriggerPropertyMaintenance 在后台立即维护属性数据库（ANALYZE和VACUUM），结果通过GET /properties/stats查询
+func handleTriggerPropertyMaintenance(maintainer *webdav.PropertyMaintainer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := maintainer.Trigger(); err != nil {
+			switch {
+			case errors.Is(err, webdav.ErrMaintenanceRunning), errors.Is(err, webdav.ErrMaintenanceUnsupported):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start property database maintenance"})
+			}
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "property database maintenance started"})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/quota"
+)
+
+// handleGetQuotaReconcile 返回最近一次配额一致性检查的结果
+func handleGetQuotaReconcile(reconciler *quota.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"running":     reconciler.Running(),
+			"last_report": reconciler.LastReport(),
+		})
+	}
+}
+
+// handleTriggerQuotaReconcile 在后台立即运行一次配额一致性检查，结果通过GET查询
+func handleTriggerQuotaReconcile(reconciler *quota.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := reconciler.Trigger(); err != nil {
+			if errors.Is(err, quota.ErrRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start quota reconciliation"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "quota reconciliation started"})
+	}
+}
+
+// handleGetUsage 返回当前用户按目录、类型等分类的用量明细，首次查询时返回202，稍后重试
+func handleGetUsage(aggregator *quota.UsageAggregator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		usage, err := aggregator.Get(c.Request.Context(), userID)
+		if err != nil {
+			if errors.Is(err, quota.ErrUsagePending) {
+				c.Header("Retry-After", "60")
+				c.JSON(http.StatusAccepted, gin.H{"status": "pending", "message": err.Error()})
+				return
+			}
+			log.Printf("Warning: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get storage usage"})
+			return
+		}
+		c.JSON(http.StatusOK, usage)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/webdav-gateway/internal/bandwidth"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/middleware"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// configReloader 收到SIGHUP时重新读取配置文件，应用可以在运行时切换的设置：
+// 日志级别、锁策略、带宽调度和跨域来源。其他设置的变化只记录警告，重启后生效
+type configReloader struct {
+	initial     *config.Config
+	logger      *logrus.Logger
+	lockManager *webdav.LockManager
+	bandwidth   *bandwidth.Limiter
+	cors        *middleware.CORS
+
+	mu      sync.Mutex
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// newConfigReloader 创建配置重新加载器，bandwidthLimiter为nil（启动时未启用带宽调度）时带宽设置需要重启
+func newConfigReloader(initial *config.Config, logger *logrus.Logger, lockManager *webdav.LockManager,
+	bandwidthLimiter *bandwidth.Limiter, cors *middleware.CORS) *configReloader {
+	return &configReloader{
+		initial:     initial,
+		logger:      logger,
+		lockManager: lockManager,
+		bandwidth:   bandwidthLimiter,
+		cors:        cors,
+	}
+}
+
+// Start 开始监听SIGHUP
+func (r *configReloader) Start() {
+	r.signals = make(chan os.Signal, 1)
+	r.done = make(chan struct{})
+	signal.Notify(r.signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-r.signals:
+				if err := r.Reload(); err != nil {
+					r.logger.WithError(err).Error("Configuration reload failed, keeping the current settings")
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止监听SIGHUP
+func (r *configReloader) Stop() {
+	signal.Stop(r.signals)
+	close(r.done)
+}
+
+// Reload 重新读取并校验配置，全部通过后才应用，任何一项无效时保持原有设置不变
+func (r *configReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	level, err := logrus.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		return fmt.Errorf("logging.level: %w", err)
+	}
+	var scheduler *bandwidth.Scheduler
+	if r.bandwidth != nil {
+		// 关闭带宽调度时换成不限速的策略，已包装的连接不需要重建
+		bandwidthCfg := config.BandwidthConfig{}
+		if cfg.Bandwidth.Enabled {
+			bandwidthCfg = cfg.Bandwidth
+		}
+		if scheduler, err = bandwidth.NewScheduler(bandwidthCfg); err != nil {
+			return err
+		}
+	}
+
+	r.logger.SetLevel(level)
+	r.lockManager.SetPolicy(cfg.WebDAV.LockPolicy)
+	if scheduler != nil {
+		r.bandwidth.SetScheduler(scheduler)
+	}
+	r.cors.SetConfig(cfg.CORS)
+
+	fields := logrus.Fields{"log_level": level.String(), "cors_enabled": cfg.CORS.Enabled}
+	if file := config.ConfigFile(); file != "" {
+		fields["file"] = file
+	}
+	r.logger.WithFields(fields).Info("Configuration reloaded")
+	if changed := r.restartRequired(cfg); len(changed) > 0 {
+		r.logger.WithField("sections", changed).Warn("Changed settings outside the reloadable set take effect after a restart")
+	}
+	return nil
+}
+
+// restartRequired 与启动时的配置相比，除可重新加载的设置外发生变化的顶层配置节
+func (r *configReloader) restartRequired(cfg *config.Config) []string {
+	before := reflect.ValueOf(r.withoutReloadable(*r.initial))
+	after := reflect.ValueOf(r.withoutReloadable(*cfg))
+	var changed []string
+	for i := 0; i < before.NumField(); i++ {
+		if !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			changed = append(changed, before.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
+
+// withoutReloadable 清除可以在运行时切换的设置，用于比较其余部分
+func (r *configReloader) withoutReloadable(cfg config.Config) config.Config {
+	cfg.Logging.Level = ""
+	cfg.WebDAV.LockPolicy = config.LockPolicyConfig{}
+	cfg.CORS = config.CORSConfig{}
+	if r.bandwidth != nil {
+		cfg.Bandwidth = config.BandwidthConfig{}
+	}
+	return cfg
+}
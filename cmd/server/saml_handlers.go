@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/sso"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+const (
+	// samlRequestCookie 保存本浏览器发起的AuthnRequest ID，ACS回调时校验InResponseTo
+	samlRequestCookie = "saml_request_id"
+	// samlRequestMaxAge 从跳转到IdP到回调ACS允许的最长时间（秒）
+	samlRequestMaxAge = 600
+)
+
+// handleSAMLMetadata 返回SP元数据
+func handleSAMLMetadata(provider *sso.SAMLProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		metadata, err := provider.Metadata()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build metadata"})
+			return
+		}
+		c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+	}
+}
+
+// handleSAMLLogin 发起SP端登录，跳转到IdP
+func handleSAMLLogin(provider *sso.SAMLProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redirect, requestID, err := provider.AuthnRequestURL()
+		if err != nil {
+			log.Printf("Warning: failed to create SAML request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start SAML login"})
+			return
+		}
+
+		// IdP以跨站POST回调ACS，cookie必须为SameSite=None才会被带上
+		c.SetSameSite(http.SameSiteNoneMode)
+		c.SetCookie(samlRequestCookie, requestID, samlRequestMaxAge, "/api/auth/saml", "", true, true)
+		c.Redirect(http.StatusFound, redirect)
+	}
+}
+
+// handleSAMLACS 校验IdP返回的断言，映射到本地用户并签发令牌
+func handleSAMLACS(provider *sso.SAMLProvider, provisioner *sso.Provisioner, authService *auth.Service, storageService *storage.Service, redirectURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestIDs []string
+		if requestID, err := c.Cookie(samlRequestCookie); err == nil && requestID != "" {
+			requestIDs = append(requestIDs, requestID)
+		}
+		c.SetSameSite(http.SameSiteNoneMode)
+		c.SetCookie(samlRequestCookie, "", -1, "/api/auth/saml", "", true, true)
+
+		identity, err := provider.ParseResponse(c.Request, requestIDs)
+		if err != nil {
+			if errors.Is(err, sso.ErrGroupNotAllowed) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to sign in", "code": "group_not_allowed"})
+				return
+			}
+			log.Printf("Warning: rejected SAML response: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid SAML response"})
+			return
+		}
+
+		finishSSOLogin(c, identity, provider.Options(), provisioner, authService, storageService, redirectURL)
+	}
+}
+
+// finishSSOLogin 把单点登录得到的外部身份映射到本地用户并签发令牌：
+// redirectURL非空时303跳转到{redirectURL}#token=，否则返回与用户登录相同的JSON
+func finishSSOLogin(c *gin.Context, identity *sso.Identity, options sso.ProvisionOptions, provisioner *sso.Provisioner,
+	authService *auth.Service, storageService *storage.Service, redirectURL string) {
+	user, err := provisioner.Resolve(c.Request.Context(), *identity, options)
+	if err != nil {
+		switch {
+		case errors.Is(err, sso.ErrMissingAttribute):
+			log.Printf("Warning: identity %s from %s is incomplete: %v", identity.Subject, identity.Provider, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "identity provider did not send the required user attributes"})
+		case errors.Is(err, sso.ErrNotProvisioned):
+			c.JSON(http.StatusForbidden, gin.H{"error": "account has not been provisioned", "code": "not_provisioned"})
+		case errors.Is(err, sso.ErrAccountConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email is already used by a local account", "code": "account_conflict"})
+		case errors.Is(err, sso.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled", "code": "account_disabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		}
+		return
+	}
+
+	if err := storageService.EnsureBucket(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to setup storage"})
+		return
+	}
+
+	token, err := authService.GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+
+	if redirectURL == "" {
+		c.JSON(http.StatusOK, models.UserLoginResponse{Token: token, User: user})
+		return
+	}
+
+	// 令牌放在片段中，不会出现在前端服务器日志和Referer里
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusSeeOther, redirectURL+"#token="+url.QueryEscape(token))
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/scim"
+)
+
+// scimBasePath SCIM接口的路由前缀
+const scimBasePath = "/scim/v2"
+
+// handleSCIMServiceProviderConfig 声明支持的SCIM功能
+func handleSCIMServiceProviderConfig(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scimJSON(c, http.StatusOK, gin.H{
+			"schemas":        []string{scim.SchemaServiceProviderConfig},
+			"patch":          gin.H{"supported": true},
+			"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+			"filter":         gin.H{"supported": true, "maxResults": svc.MaxResults()},
+			"changePassword": gin.H{"supported": true},
+			"sort":           gin.H{"supported": false},
+			"etag":           gin.H{"supported": false},
+			"authenticationSchemes": []gin.H{{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer Token",
+				"description": "Static bearer token configured in auth.scim.token",
+			}},
+		})
+	}
+}
+
+// handleSCIMResourceTypes 列出支持的资源类型
+func handleSCIMResourceTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		types := []gin.H{
+			{"schemas": []string{scim.SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scim.SchemaUser},
+			{"schemas": []string{scim.SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scim.SchemaGroup},
+		}
+		scimJSON(c, http.StatusOK, scim.NewListResponse(types, len(types), 1, len(types)))
+	}
+}
+
+func handleSCIMListUsers(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := scim.ParseFilter(c.Query("filter"), "id", "userName", "externalId", "emails.value", "emails")
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		startIndex, count := scimPagination(c, svc.MaxResults())
+
+		users, total, err := svc.ListUsers(c.Request.Context(), filter, startIndex, count)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		for _, user := range users {
+			setSCIMLocation(c, user.Meta, "Users", user.ID)
+		}
+		if users == nil {
+			users = []*scim.User{}
+		}
+		scimJSON(c, http.StatusOK, scim.NewListResponse(users, total, startIndex, len(users)))
+	}
+}
+
+func handleSCIMGetUser(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := svc.GetUser(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, user.Meta, "Users", user.ID)
+		scimJSON(c, http.StatusOK, user)
+	}
+}
+
+func handleSCIMCreateUser(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.User
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		user, err := svc.CreateUser(c.Request.Context(), &req)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, user.Meta, "Users", user.ID)
+		c.Header("Location", user.Meta.Location)
+		scimJSON(c, http.StatusCreated, user)
+	}
+}
+
+func handleSCIMReplaceUser(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.User
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		user, err := svc.ReplaceUser(c.Request.Context(), c.Param("id"), &req)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, user.Meta, "Users", user.ID)
+		scimJSON(c, http.StatusOK, user)
+	}
+}
+
+func handleSCIMPatchUser(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.PatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		user, err := svc.PatchUser(c.Request.Context(), c.Param("id"), req.Operations)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, user.Meta, "Users", user.ID)
+		scimJSON(c, http.StatusOK, user)
+	}
+}
+
+func handleSCIMDeleteUser(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := svc.DeleteUser(c.Request.Context(), c.Param("id")); err != nil {
+			scimError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func handleSCIMListGroups(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := scim.ParseFilter(c.Query("filter"), "id", "displayName", "externalId")
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		startIndex, count := scimPagination(c, svc.MaxResults())
+
+		groups, total, err := svc.ListGroups(c.Request.Context(), filter, startIndex, count, !excludesMembers(c))
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		for _, group := range groups {
+			setSCIMLocation(c, group.Meta, "Groups", group.ID)
+		}
+		if groups == nil {
+			groups = []*scim.Group{}
+		}
+		scimJSON(c, http.StatusOK, scim.NewListResponse(groups, total, startIndex, len(groups)))
+	}
+}
+
+func handleSCIMGetGroup(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, err := svc.GetGroup(c.Request.Context(), c.Param("id"), !excludesMembers(c))
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, group.Meta, "Groups", group.ID)
+		scimJSON(c, http.StatusOK, group)
+	}
+}
+
+func handleSCIMCreateGroup(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.Group
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		group, err := svc.CreateGroup(c.Request.Context(), &req)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, group.Meta, "Groups", group.ID)
+		c.Header("Location", group.Meta.Location)
+		scimJSON(c, http.StatusCreated, group)
+	}
+}
+
+func handleSCIMReplaceGroup(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.Group
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		group, err := svc.ReplaceGroup(c.Request.Context(), c.Param("id"), &req)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		setSCIMLocation(c, group.Meta, "Groups", group.ID)
+		scimJSON(c, http.StatusOK, group)
+	}
+}
+
+func handleSCIMPatchGroup(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scim.PatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			scimError(c, scim.ErrInvalidValue)
+			return
+		}
+
+		group, err := svc.PatchGroup(c.Request.Context(), c.Param("id"), req.Operations)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		// 成员变更后不回显成员列表，大组的响应体会很大
+		group.Members = nil
+		setSCIMLocation(c, group.Meta, "Groups", group.ID)
+		scimJSON(c, http.StatusOK, group)
+	}
+}
+
+func handleSCIMDeleteGroup(svc *scim.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := svc.DeleteGroup(c.Request.Context(), c.Param("id")); err != nil {
+			scimError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// scimPagination 解析startIndex（从1开始）和count，count不超过max
+func scimPagination(c *gin.Context, max int) (int, int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count > max {
+		count = max
+	}
+	if count < 0 {
+		count = 0
+	}
+	return startIndex, count
+}
+
+// excludesMembers 判断是否请求了excludedAttributes=members
+func excludesMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// setSCIMLocation 按请求的Host生成资源地址
+func setSCIMLocation(c *gin.Context, meta *scim.Meta, resource, id string) {
+	if meta == nil {
+		return
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	meta.Location = scheme + "://" + c.Request.Host + scimBasePath + "/" + resource + "/" + id
+}
+
+func scimJSON(c *gin.Context, status int, v interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, v)
+}
+
+// scimError 按RFC 7644第3.12节返回错误
+func scimError(c *gin.Context, err error) {
+	status, scimType := http.StatusInternalServerError, ""
+	switch {
+	case errors.Is(err, scim.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, scim.ErrUniqueness):
+		status, scimType = http.StatusConflict, "uniqueness"
+	case errors.Is(err, scim.ErrInvalidFilter):
+		status, scimType = http.StatusBadRequest, "invalidFilter"
+	case errors.Is(err, scim.ErrInvalidPath):
+		status, scimType = http.StatusBadRequest, "invalidPath"
+	case errors.Is(err, scim.ErrInvalidValue):
+		status, scimType = http.StatusBadRequest, "invalidValue"
+	}
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Printf("Warning: SCIM request %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		detail = "internal error"
+	}
+	scimJSON(c, status, scim.ErrorResponse{
+		Schemas:  []string{scim.SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleSearch 按文件名、类型、大小、修改时间、自定义属性和媒体元数据搜索文件
+func handleSearch(searcher *webdav.Searcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		q, err := parseSearchQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := searcher.Search(c.Request.Context(), userID, q)
+		if errors.Is(err, webdav.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results":   results.Results,
+			"count":     len(results.Results),
+			"truncated": results.Truncated,
+			"scanned":   results.Scanned,
+		})
+	}
+}
+
+// parseSearchQuery 解析查询参数，prop可重复，格式为{ns}name=value或name=value，~=表示包含匹配
+func parseSearchQuery(c *gin.Context) (webdav.SearchQuery, error) {
+	q := webdav.SearchQuery{
+		Scope:       c.DefaultQuery("path", "/"),
+		Recursive:   c.DefaultQuery("depth", "infinity") != "1",
+		NameGlob:    c.Query("name"),
+		Text:        c.Query("q"),
+		ContentType: c.Query("type"),
+	}
+	if strings.Contains(q.Scope, "..") {
+		return q, errors.New("invalid path")
+	}
+
+	var err error
+	if q.MinSize, err = parseSizeParam(c, "min_size"); err != nil {
+		return q, err
+	}
+	if q.MaxSize, err = parseSizeParam(c, "max_size"); err != nil {
+		return q, err
+	}
+	if q.ModifiedAfter, err = parseTimeParam(c, "modified_after"); err != nil {
+		return q, err
+	}
+	if q.ModifiedBefore, err = parseTimeParam(c, "modified_before"); err != nil {
+		return q, err
+	}
+	if q.Media.TakenAfter, err = parseTimeParam(c, "taken_after"); err != nil {
+		return q, err
+	}
+	if q.Media.TakenBefore, err = parseTimeParam(c, "taken_before"); err != nil {
+		return q, err
+	}
+	if q.Media.MinWidth, err = parseDimensionParam(c, "min_width"); err != nil {
+		return q, err
+	}
+	if q.Media.MinHeight, err = parseDimensionParam(c, "min_height"); err != nil {
+		return q, err
+	}
+	if raw := c.Query("has_location"); raw != "" {
+		if q.Media.HasLocation, err = strconv.ParseBool(raw); err != nil {
+			return q, errors.New("invalid has_location")
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit <= 0 {
+			return q, errors.New("invalid limit")
+		}
+	}
+
+	for _, raw := range c.QueryArray("prop") {
+		filter, err := parsePropertyFilter(raw)
+		if err != nil {
+			return q, err
+		}
+		q.Properties = append(q.Properties, filter)
+	}
+	return q, nil
+}
+
+func parseSizeParam(c *gin.Context, name string) (*int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || size < 0 {
+		return nil, errors.New("invalid " + name)
+	}
+	return &size, nil
+}
+
+// parseDimensionParam 解析图片、视频的最小宽高（像素）
+func parseDimensionParam(c *gin.Context, name string) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid " + name)
+	}
+	return n, nil
+}
+
+// parseTimeParam 解析RFC 3339时间或Unix秒
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid " + name + ", expected RFC 3339 or unix seconds")
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// parsePropertyFilter 解析单个prop参数
+func parsePropertyFilter(raw string) (webdav.PropertyFilter, error) {
+	var filter webdav.PropertyFilter
+	key, value, ok := strings.Cut(raw, "=")
+	if !ok {
+		return filter, errors.New("invalid prop filter " + strconv.Quote(raw) + ", expected name=value")
+	}
+	if strings.HasSuffix(key, "~") {
+		key = strings.TrimSuffix(key, "~")
+		filter.Contains = true
+	}
+	if strings.HasPrefix(key, "{") {
+		end := strings.Index(key, "}")
+		if end < 0 {
+			return filter, errors.New("invalid prop filter " + strconv.Quote(raw))
+		}
+		filter.Namespace = key[1:end]
+		key = key[end+1:]
+	}
+	if key == "" {
+		return filter, errors.New("invalid prop filter " + strconv.Quote(raw) + ", missing name")
+	}
+	filter.Name = key
+	filter.Value = value
+	return filter, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// maxShareListEntries 分享目录单次列表最多返回的条目数
+const maxShareListEntries = 5000
+
+// accessShareFromRequest 按X-Share-Password验证分享访问（密码、有效期、下载次数、停用状态），
+// 并要求分享允许下载；失败时已发送错误响应，返回nil
+func accessShareFromRequest(c *gin.Context, shareService *share.Service) *models.FileShare {
+	fileShare, err := shareService.ValidateShareAccess(c.Request.Context(), c.Param("token"), c.GetHeader("X-Share-Password"))
+	if err != nil {
+		switch err {
+		case share.ErrShareNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		case share.ErrShareExpired:
+			c.JSON(http.StatusGone, gin.H{"error": "share has expired"})
+		case share.ErrMaxDownloads:
+			c.JSON(http.StatusForbidden, gin.H{"error": "maximum downloads reached"})
+		case share.ErrInvalidPassword:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access share"})
+		}
+		return nil
+	}
+	setShareAudit(c, fileShare)
+	if rejectDisabledShare(c, fileShare) {
+		return nil
+	}
+	if !share.AllowsDownload(fileShare) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "share only accepts uploads"})
+		return nil
+	}
+	return fileShare
+}
+
+// resolveSharePath 把?path=映射到分享者空间并查询资源，路径越出分享根目录时返回400，不存在时返回404
+func resolveSharePath(c *gin.Context, storageService *storage.Service, fileShare *models.FileShare) (*storage.Resource, bool) {
+	target, err := share.ResolvePath(fileShare, c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return nil, false
+	}
+	resource, err := storageService.StatResource(c.Request.Context(), fileShare.UserID, target)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "path not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access path"})
+		return nil, false
+	}
+	return resource, true
+}
+
+// handleShareList 列出文件夹分享中的一个目录（GET /share/:token/list?path=），路径相对分享根目录。
+// 列表不计入下载次数
+func handleShareList(shareService *share.Service, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileShare := accessShareFromRequest(c, shareService)
+		if fileShare == nil {
+			return
+		}
+		resource, ok := resolveSharePath(c, storageService, fileShare)
+		if !ok {
+			return
+		}
+		if !resource.IsCollection() {
+			c.JSON(http.StatusConflict, gin.H{"error": "path is not a folder"})
+			return
+		}
+
+		listing := models.ShareListing{
+			Path:    share.RelativePath(fileShare, resource.Path),
+			Entries: []models.ShareEntry{},
+		}
+		err := storageService.WalkObjects(c.Request.Context(), fileShare.UserID, resource.Path, false, func(obj minio.ObjectInfo) error {
+			if len(listing.Entries) >= maxShareListEntries {
+				listing.Truncated = true
+				return storage.ErrStopWalk
+			}
+			objPath := "/" + obj.Key
+			entry := models.ShareEntry{
+				Name:         path.Base(objPath),
+				Path:         share.RelativePath(fileShare, objPath),
+				LastModified: obj.LastModified,
+			}
+			if strings.HasSuffix(obj.Key, "/") {
+				entry.IsFolder = true
+			} else {
+				entry.Size = obj.Size
+				entry.ContentType = contenttype.Resolve(objPath, obj.ContentType)
+				entry.ETag = storage.ContentETag(obj)
+			}
+			listing.Entries = append(listing.Entries, entry)
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list folder"})
+			return
+		}
+
+		// 目录在前，同类按名称排序
+		sort.SliceStable(listing.Entries, func(i, j int) bool {
+			a, b := listing.Entries[i], listing.Entries[j]
+			if a.IsFolder != b.IsFolder {
+				return a.IsFolder
+			}
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		})
+		c.JSON(http.StatusOK, listing)
+	}
+}
+
+// handleShareDownload 下载分享中的一个文件（GET /share/:token/download?path=），计入下载次数。
+// 单文件分享省略path即下载该文件；目录请使用/share/:token/zip打包下载。
+// 开启download.redirect时大文件重定向到预签名URL，设有密码的分享不重定向，避免URL被转发后绕过密码
+func handleShareDownload(shareService *share.Service, storageService *storage.Service, redirect config.DownloadRedirectConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileShare := accessShareFromRequest(c, shareService)
+		if fileShare == nil {
+			return
+		}
+		resource, ok := resolveSharePath(c, storageService, fileShare)
+		if !ok {
+			return
+		}
+		if resource.IsCollection() {
+			c.JSON(http.StatusConflict, gin.H{"error": "path is a folder, use the zip download"})
+			return
+		}
+		info := resource.Info
+		filename := path.Base(resource.Path)
+		disposition := fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, asciiFilename(filename), url.PathEscape(filename))
+
+		if redirect.Enabled && info.Size >= redirect.MinSize && fileShare.PasswordHash == "" {
+			location, err := storageService.PresignGet(c.Request.Context(), fileShare.UserID, resource.Path, redirect.TTL, storage.PresignGetOptions{
+				ContentType:        contenttype.Resolve(resource.Path, info.ContentType),
+				ContentDisposition: disposition,
+			})
+			if err == nil {
+				if err := shareService.IncrementDownloadCount(c.Request.Context(), fileShare.ID); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update download count"})
+					return
+				}
+				c.Header("Cache-Control", "no-store")
+				c.Redirect(http.StatusTemporaryRedirect, location)
+				return
+			}
+			if !errors.Is(err, storage.ErrPresignUnsupported) {
+				log.Printf("Warning: share download redirect %s: %v", fileShare.ID, err)
+			}
+		}
+
+		obj, err := storageService.GetObjectRange(c.Request.Context(), fileShare.UserID, resource.Path, -1, -1, info.ETag)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+			return
+		}
+		defer obj.Close()
+
+		if err := shareService.IncrementDownloadCount(c.Request.Context(), fileShare.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update download count"})
+			return
+		}
+
+		c.Header("Content-Type", contenttype.Resolve(resource.Path, info.ContentType))
+		c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+		c.Header("Content-Disposition", disposition)
+		c.Header("ETag", `"`+storage.ContentETag(*info)+`"`)
+		c.Header("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		if _, err := storage.CopyContext(c.Request.Context(), c.Writer, obj); err != nil {
+			// 响应头已发送，只能中断连接
+			log.Printf("Warning: share download %s aborted: %v", fileShare.ID, err)
+		}
+	}
+}
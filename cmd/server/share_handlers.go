@@ -1,18 +1,21 @@
 package main
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/webdav-gateway/internal/audit"
 	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/config"
 	"github.com/webdav-gateway/internal/models"
 	"github.com/webdav-gateway/internal/share"
 	"github.com/webdav-gateway/internal/storage"
 )
 
-func handleCreateShare(shareService *share.Service) gin.HandlerFunc {
+func handleCreateShare(shareService *share.Service, dropBox *share.DropBox, shortLinks *share.ShortLinks, passwordPolicy config.SharePasswordConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDStr := c.GetString("userID")
 		userID, err := uuid.Parse(userIDStr)
@@ -27,17 +30,46 @@ func handleCreateShare(shareService *share.Service) gin.HandlerFunc {
 			return
 		}
 
+		c.Set(audit.PathKey, req.FilePath)
+
+		if !share.ValidPermission(req.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "permissions must be read, write or drop"})
+			return
+		}
+		if err := share.CheckPassword(passwordPolicy, req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		resp, err := shareService.CreateShare(c.Request.Context(), userID, &req)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share"})
 			return
 		}
 
+		if req.Permissions == share.PermissionWrite || req.Permissions == share.PermissionDrop {
+			if err := dropBox.SetLimits(c.Request.Context(), resp.ShareToken, req.UploadLimits); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set upload limits"})
+				return
+			}
+		}
+
+		if shortLinks.Enabled() {
+			// 短码分配失败不影响分享本身，稍后可通过二维码接口重新分配
+			if fileShare, err := shareService.GetShare(c.Request.Context(), resp.ShareToken); err == nil {
+				if link, err := shortLinks.Path(c.Request.Context(), userID, fileShare.ID); err == nil {
+					resp.ShortURL = shareLinkURL(c, shortLinks, link)
+				} else {
+					log.Printf("Warning: failed to assign short link for share %s: %v", fileShare.ID, err)
+				}
+			}
+		}
+
 		c.JSON(http.StatusCreated, resp)
 	}
 }
 
-func handleListShares(shareService *share.Service) gin.HandlerFunc {
+func handleListShares(shareService *share.Service, reaper *share.Reaper) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDStr := c.GetString("userID")
 		userID, err := uuid.Parse(userIDStr)
@@ -46,6 +78,21 @@ func handleListShares(shareService *share.Service) gin.HandlerFunc {
 			return
 		}
 
+		// ?status=active|expired|all 按状态筛选，包括已被清理任务停用的分享
+		if status := c.Query("status"); status != "" {
+			shares, err := reaper.ListShares(c.Request.Context(), userID, status)
+			if err != nil {
+				if err == share.ErrInvalidStatus {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list shares"})
+				return
+			}
+			c.JSON(http.StatusOK, shares)
+			return
+		}
+
 		shares, err := shareService.ListUserShares(c.Request.Context(), userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list shares"})
@@ -84,7 +131,7 @@ func handleDeleteShare(shareService *share.Service) gin.HandlerFunc {
 	}
 }
 
-func handleGetShare(shareService *share.Service, storageService *storage.Service, authService *auth.Service) gin.HandlerFunc {
+func handleGetShare(shareService *share.Service, dropBox *share.DropBox, storageService *storage.Service, authService *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.Param("token")
 
@@ -97,16 +144,33 @@ func handleGetShare(shareService *share.Service, storageService *storage.Service
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get share"})
 			return
 		}
+		if rejectDisabledShare(c, fileShare) {
+			return
+		}
+
+		var fileID string
+		if info, err := storageService.StatObject(c.Request.Context(), fileShare.UserID, fileShare.FilePath); err == nil {
+			fileID = storage.FileID(*info)
+		}
 
 		// Return share info (without downloading the file)
-		c.JSON(http.StatusOK, gin.H{
-			"share_name":     fileShare.ShareName,
-			"file_path":      fileShare.FilePath,
-			"expires_at":     fileShare.ExpiresAt,
-			"download_count": fileShare.DownloadCount,
-			"max_downloads":  fileShare.MaxDownloads,
-			"has_password":   fileShare.PasswordHash != "",
-		})
+		resp := gin.H{
+			"file_id":         fileID,
+			"share_name":      fileShare.ShareName,
+			"file_path":       fileShare.FilePath,
+			"expires_at":      fileShare.ExpiresAt,
+			"download_count":  fileShare.DownloadCount,
+			"max_downloads":   fileShare.MaxDownloads,
+			"has_password":    fileShare.PasswordHash != "",
+			"permissions":     fileShare.Permissions,
+			"accepts_uploads": share.AcceptsUploads(fileShare),
+		}
+		if share.AcceptsUploads(fileShare) {
+			if status, err := dropBox.Status(c.Request.Context(), fileShare.ID); err == nil {
+				resp["upload"] = status
+			}
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
@@ -141,6 +205,15 @@ func handleAccessShare(shareService *share.Service) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access share"})
 			return
 		}
+		setShareAudit(c, fileShare)
+		if rejectDisabledShare(c, fileShare) {
+			return
+		}
+
+		if !share.AllowsDownload(fileShare) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "share only accepts uploads"})
+			return
+		}
 
 		// Increment download count
 		if err := shareService.IncrementDownloadCount(c.Request.Context(), fileShare.ID); err != nil {
@@ -155,4 +228,28 @@ func handleAccessShare(shareService *share.Service) gin.HandlerFunc {
 			"share_name": fileShare.ShareName,
 		})
 	}
-}
\ No newline at end of file
+}
+
+// rejectDisabledShare 分享已被清理任务停用时按停用原因返回与过期或下载次数用尽相同的错误
+func rejectDisabledShare(c *gin.Context, fileShare *models.FileShare) bool {
+	if !share.Disabled(fileShare) {
+		return false
+	}
+	if fileShare.DisabledReason == share.ReasonDownloadLimit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "maximum downloads reached"})
+		return true
+	}
+	c.JSON(http.StatusGone, gin.H{"error": "share has expired"})
+	return true
+}
+
+// setShareAudit 审计记录中使用分享的文件路径和分享ID，不记录分享令牌；
+// 同时保存通过验证的分享，供访问统计使用
+func setShareAudit(c *gin.Context, fileShare *models.FileShare) {
+	c.Set(shareContextKey, fileShare)
+	c.Set(audit.PathKey, fileShare.FilePath)
+	c.Set(audit.DetailsKey, map[string]string{
+		"share_id": fileShare.ID.String(),
+		"owner_id": fileShare.UserID.String(),
+	})
+}
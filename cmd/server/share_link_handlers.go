@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/qrcode"
+	"github.com/webdav-gateway/internal/share"
+)
+
+const (
+	// defaultQRScale 二维码每个模块的默认像素数
+	defaultQRScale = 8
+	// maxQRScale 二维码每个模块的最大像素数（版本10约为1300x1300像素）
+	maxQRScale = 20
+)
+
+// shareLinkURL 把分享路径转换为绝对地址，优先使用share.short_links.public_url，
+// 否则按请求的Host和X-Forwarded-Proto生成
+func shareLinkURL(c *gin.Context, shortLinks *share.ShortLinks, link string) string {
+	if base := strings.TrimRight(shortLinks.PublicURL(), "/"); base != "" {
+		return base + link
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + link
+}
+
+// handleShortLink 把/s/:slug短链接重定向到完整的分享地址
+func handleShortLink(shortLinks *share.ShortLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := shortLinks.Resolve(c.Request.Context(), c.Param("slug"))
+		if err != nil {
+			if err == share.ErrShareNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve short link"})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, "/share/"+token)
+	}
+}
+
+// handleGetShareQRCode 返回分享链接的PNG二维码（GET /api/shares/:id/qrcode?scale=）。
+// 启用短链接时编码短链接（尚未分配时分配），否则编码完整的分享地址
+func handleGetShareQRCode(shortLinks *share.ShortLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		shareID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+			return
+		}
+		scale := defaultQRScale
+		if value := c.Query("scale"); value != "" {
+			if scale, err = strconv.Atoi(value); err != nil || scale < 1 || scale > maxQRScale {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be between 1 and " + strconv.Itoa(maxQRScale)})
+				return
+			}
+		}
+
+		link, err := shortLinks.Path(c.Request.Context(), userID, shareID)
+		if err != nil {
+			if err == share.ErrShareNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get share link"})
+			return
+		}
+		shareURL := shareLinkURL(c, shortLinks, link)
+
+		code, err := qrcode.Encode([]byte(shareURL))
+		if err != nil {
+			if err == qrcode.ErrTooLong {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "share url is too long for a qr code, enable short links"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode qr code"})
+			return
+		}
+		data, err := code.PNG(scale)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render qr code"})
+			return
+		}
+
+		c.Header("Cache-Control", "private, no-cache")
+		c.Header("X-Share-URL", shareURL)
+		c.Data(http.StatusOK, "image/png", data)
+	}
+}
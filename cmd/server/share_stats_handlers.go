@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/share"
+)
+
+// shareContextKey 通过验证的分享（*models.FileShare）在请求上下文中的键
+const shareContextKey = "share"
+
+// recordShareAccess 在分享访问成功（2xx）后写入访问记录。分享由处理函数通过setShareAudit保存，
+// 下载和打包下载记录实际写出的字节数，上传记录请求体大小。recorder为nil时直接放行
+func recordShareAccess(recorder *share.AccessRecorder, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if recorder == nil || c.Writer.Status() < 200 || c.Writer.Status() >= 300 {
+			return
+		}
+		value, ok := c.Get(shareContextKey)
+		if !ok {
+			return
+		}
+		fileShare := value.(*models.FileShare)
+
+		event := share.AccessEvent{
+			IP:        c.ClientIP(),
+			Action:    action,
+			Path:      "/",
+			UserAgent: c.Request.UserAgent(),
+		}
+		switch action {
+		case share.AccessList, share.AccessDownload:
+			event.Path = path.Clean("/" + c.Query("path"))
+		}
+		switch action {
+		case share.AccessDownload, share.AccessZip:
+			event.Bytes = int64(max(c.Writer.Size(), 0))
+		case share.AccessUpload:
+			event.Bytes = max(c.Request.ContentLength, 0)
+		}
+
+		if err := recorder.Record(context.WithoutCancel(c.Request.Context()), fileShare, event); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// handleGetShareStats 返回分享的访问统计和最近的访问记录（GET /api/shares/:id/stats?limit=）
+func handleGetShareStats(recorder *share.AccessRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		shareID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+			return
+		}
+		limit := 0
+		if value := c.Query("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+		}
+
+		stats, err := recorder.Stats(c.Request.Context(), userID, shareID, limit)
+		if err != nil {
+			if err == share.ErrShareNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get share stats"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// errOwnerQuotaExceeded 上传会超出分享者的存储配额
+var errOwnerQuotaExceeded = errors.New("share owner storage quota exceeded")
+
+// maxUploadNameAttempts 为重名文件寻找可用名称的最大尝试次数
+const maxUploadNameAttempts = 1000
+
+// handleShareUpload 匿名访问者向允许上传的分享目录上传文件，支持multipart表单或原始请求体。
+// 已存在的同名文件不会被覆盖，占用的空间计入分享者的配额，上传的文件写入分享者的变更日志（journal为nil时不记录）
+func handleShareUpload(shareService *share.Service, dropBox *share.DropBox, storageService *storage.Service, authService *auth.Service, journal *changes.Journal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+
+		fileShare, err := shareService.ValidateShareAccess(c.Request.Context(), token, c.GetHeader("X-Share-Password"))
+		if err != nil {
+			if err == share.ErrShareNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+			if err == share.ErrShareExpired {
+				c.JSON(http.StatusGone, gin.H{"error": "share has expired"})
+				return
+			}
+			if err == share.ErrInvalidPassword {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+				return
+			}
+			if err == share.ErrMaxDownloads {
+				c.JSON(http.StatusForbidden, gin.H{"error": "maximum downloads reached"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access share"})
+			return
+		}
+		setShareAudit(c, fileShare)
+		if rejectDisabledShare(c, fileShare) {
+			return
+		}
+
+		if !share.AcceptsUploads(fileShare) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "share does not accept uploads"})
+			return
+		}
+
+		folder := path.Clean("/" + fileShare.FilePath)
+		if info, err := storageService.StatObject(c.Request.Context(), fileShare.UserID, folder); err == nil && !strings.HasSuffix(info.Key, "/") {
+			c.JSON(http.StatusConflict, gin.H{"error": "shared item is not a folder"})
+			return
+		}
+
+		uploader := &shareUploader{
+			share:   fileShare,
+			folder:  folder,
+			dropBox: dropBox,
+			storage: storageService,
+			auth:    authService,
+			journal: journal,
+		}
+
+		var files []models.ShareUploadedFile
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			reader, err := c.Request.MultipartReader()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid multipart body"})
+				return
+			}
+			for {
+				part, err := reader.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid multipart body", "files": files})
+					return
+				}
+				if part.FileName() == "" {
+					part.Close()
+					continue
+				}
+				file, status, err := uploader.store(c.Request.Context(), part.FileName(), part, -1, part.Header.Get("Content-Type"))
+				part.Close()
+				if err != nil {
+					c.JSON(status, gin.H{"error": err.Error(), "files": files})
+					return
+				}
+				files = append(files, *file)
+			}
+			if len(files) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no file in request"})
+				return
+			}
+		} else {
+			name := c.Query("name")
+			if name == "" {
+				name, _ = url.PathUnescape(c.GetHeader("X-File-Name"))
+			}
+			if name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "file name is required"})
+				return
+			}
+			file, status, err := uploader.store(c.Request.Context(), name, c.Request.Body, c.Request.ContentLength, c.GetHeader("Content-Type"))
+			if err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			files = append(files, *file)
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"files": files})
+	}
+}
+
+// shareUploader 将匿名上传的文件写入分享者的存储
+type shareUploader struct {
+	share   *models.FileShare
+	folder  string
+	dropBox *share.DropBox
+	storage *storage.Service
+	auth    *auth.Service
+	journal *changes.Journal
+}
+
+// store 写入一个文件，失败时返回对应的HTTP状态码。size为-1表示长度未知
+func (u *shareUploader) store(ctx context.Context, name string, body io.Reader, size int64, contentType string) (*models.ShareUploadedFile, int, error) {
+	name, ok := sanitizeUploadName(name)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("invalid file name")
+	}
+
+	limit, err := u.dropBox.Reserve(ctx, u.share.ID)
+	if err != nil {
+		if errors.Is(err, share.ErrUploadLimitReached) {
+			return nil, http.StatusForbidden, err
+		}
+		return nil, http.StatusInternalServerError, errors.New("failed to upload file")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			if err := u.dropBox.Release(ctx, u.share.ID); err != nil {
+				log.Printf("Warning: failed to release upload slot of share %s: %v", u.share.ID, err)
+			}
+		}
+	}()
+
+	quota := int64(-1)
+	if owner, err := u.auth.GetUserByID(ctx, u.share.UserID); err == nil {
+		quota = owner.StorageQuota - owner.StorageUsed
+	}
+	if size >= 0 {
+		if limit >= 0 && size > limit {
+			return nil, http.StatusRequestEntityTooLarge, share.ErrUploadTooLarge
+		}
+		if quota >= 0 && size > quota {
+			return nil, http.StatusInsufficientStorage, errOwnerQuotaExceeded
+		}
+	}
+
+	dest, err := u.availablePath(ctx, name)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("failed to upload file")
+	}
+
+	// 与WebDAV PUT相同，未声明具体类型时按扩展名和内容判断；已读取的字节仍经过大小和配额限制
+	if contenttype.IsGeneric(contentType) {
+		if contentType, body, err = contenttype.Sniff(dest, body); err != nil {
+			return nil, http.StatusBadRequest, errors.New("failed to read upload")
+		}
+	}
+
+	reader := &uploadLimitReader{r: body, limit: limit, quota: quota}
+	if err := u.storage.PutObject(ctx, u.share.UserID, dest, reader, size, contentType); err != nil {
+		switch {
+		case errors.Is(err, share.ErrUploadTooLarge):
+			return nil, http.StatusRequestEntityTooLarge, share.ErrUploadTooLarge
+		case errors.Is(err, errOwnerQuotaExceeded):
+			return nil, http.StatusInsufficientStorage, errOwnerQuotaExceeded
+		}
+		log.Printf("Warning: share %s upload of %s failed: %v", u.share.ID, dest, err)
+		return nil, http.StatusInternalServerError, errors.New("failed to upload file")
+	}
+
+	// 并发上传可能使总大小超限，此时撤销本次写入
+	if err := u.dropBox.Commit(ctx, u.share.ID, reader.n); err != nil {
+		if delErr := u.storage.DeleteObject(ctx, u.share.UserID, dest); delErr != nil {
+			log.Printf("Warning: failed to remove rejected upload %s: %v", dest, delErr)
+		}
+		if errors.Is(err, share.ErrUploadLimitReached) {
+			return nil, http.StatusRequestEntityTooLarge, share.ErrUploadTooLarge
+		}
+		return nil, http.StatusInternalServerError, errors.New("failed to upload file")
+	}
+	committed = true
+
+	if err := u.auth.UpdateStorageUsed(ctx, u.share.UserID, reader.n); err != nil {
+		log.Printf("Warning: failed to update storage used for %s: %v", u.share.UserID, err)
+	}
+	if u.journal != nil {
+		change := changes.Change{UserID: u.share.UserID, Type: changes.TypeCreated, Path: dest}
+		if err := u.journal.Record(context.WithoutCancel(ctx), change); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	return &models.ShareUploadedFile{Name: path.Base(dest), Size: reader.n}, http.StatusCreated, nil
+}
+
+// availablePath 返回分享目录下未被占用的路径，重名时追加序号，如"report (2).pdf"
+func (u *shareUploader) availablePath(ctx context.Context, name string) (string, error) {
+	ext := path.Ext(name)
+	candidate := name
+	for i := 2; i < maxUploadNameAttempts; i++ {
+		dest := path.Join(u.folder, candidate)
+		if _, err := u.storage.StatObject(ctx, u.share.UserID, dest); err != nil {
+			if storage.IsNotFound(err) {
+				return dest, nil
+			}
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	return "", fmt.Errorf("no free name for %s", name)
+}
+
+// sanitizeUploadName 只保留客户端提供的文件名的最后一段，拒绝控制字符和过长的名称
+func sanitizeUploadName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimSpace(path.Base("/" + name))
+	if name == "" || name == "/" || name == "." || name == ".." || len(name) > 255 {
+		return "", false
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", false
+	}
+	return name, true
+}
+
+// uploadLimitReader 统计写入的字节数，超过分享大小限制或分享者配额时返回错误
+type uploadLimitReader struct {
+	r     io.Reader
+	limit int64
+	quota int64
+	n     int64
+}
+
+func (r *uploadLimitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.limit >= 0 && r.n > r.limit {
+		return n, share.ErrUploadTooLarge
+	}
+	if r.quota >= 0 && r.n > r.quota {
+		return n, errOwnerQuotaExceeded
+	}
+	return n, err
+}
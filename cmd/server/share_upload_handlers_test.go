@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/share"
+)
+
+func TestSanitizeUploadName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"report.pdf", "report.pdf", true},
+		{"  report.pdf ", "report.pdf", true},
+		// 只保留最后一段，Windows路径同样处理
+		{"../../etc/passwd", "passwd", true},
+		{"/abs/path/photo.jpg", "photo.jpg", true},
+		{`C:\Users\alice\photo.jpg`, "photo.jpg", true},
+		{"dir/", "dir", true},
+		{"报告.docx", "报告.docx", true},
+		{"", "", false},
+		{"   ", "", false},
+		{".", "", false},
+		{"..", "", false},
+		{"a/..", "", false},
+		{"/", "", false},
+		{"bad\x00name", "", false},
+		{"line\nbreak.txt", "", false},
+		{strings.Repeat("a", 256), "", false},
+		{strings.Repeat("a", 255), strings.Repeat("a", 255), true},
+	}
+	for _, tt := range tests {
+		got, ok := sanitizeUploadName(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("sanitizeUploadName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestUploadLimitReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 100)
+	tests := []struct {
+		name    string
+		limit   int64
+		quota   int64
+		wantErr error
+	}{
+		{"unlimited", -1, -1, nil},
+		{"exactly at limit", 100, -1, nil},
+		{"over share limit", 99, -1, share.ErrUploadTooLarge},
+		{"exactly at quota", -1, 100, nil},
+		{"over owner quota", -1, 50, errOwnerQuotaExceeded},
+		// 两者都超出时按分享的大小限制报告
+		{"over both", 10, 10, share.ErrUploadTooLarge},
+		{"no quota left", -1, 0, errOwnerQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &uploadLimitReader{r: bytes.NewReader(data), limit: tt.limit, quota: tt.quota}
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (len(got) != len(data) || r.n != int64(len(data))) {
+				t.Errorf("read %d bytes, counted %d", len(got), r.n)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/drain"
+)
+
+// defaultShutdownTimeout server.shutdown.timeout未配置时等待进行中请求的时间
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownGrace 传输结束后等待Shutdown关闭空闲连接的时间
+const shutdownGrace = time.Second
+
+// shutdownServer 优雅停机：先进入排空状态（新的写请求返回503、就绪检查失败），
+// 在Timeout内等待进行中的请求完成；仍有上传或下载未结束时继续等待，最长到MaxDrain，之后强制关闭连接
+func shutdownServer(srv *http.Server, drainer *drain.Tracker, cfg config.ShutdownConfig, logger *logrus.Logger) {
+	drainer.Start()
+	logger.Infof("Draining %d in-flight transfers", drainer.Active())
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	maxDrain := max(cfg.MaxDrain, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxDrain)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			return
+		}
+	case <-time.After(timeout):
+		// 超过Timeout后只为进行中的传输继续等待，其他请求（如长时间的PROPFIND）不再延长停机
+		if active := drainer.Active(); active > 0 {
+			logger.Infof("Waiting up to %s for %d transfers to finish", maxDrain-timeout, active)
+			if err := drainer.Wait(ctx); err != nil {
+				logger.Warnf("%d transfers still running after %s", drainer.Active(), maxDrain)
+			}
+		}
+		// 给Shutdown一点时间发现连接已经空闲
+		select {
+		case err := <-done:
+			if err == nil {
+				return
+			}
+		case <-time.After(shutdownGrace):
+		}
+	}
+
+	logger.Warn("Server forced to shutdown, closing remaining connections")
+	if err := srv.Close(); err != nil {
+		logger.Warnf("Failed to close server: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleSyncCheck 批量比对客户端记录的ETag/哈希与服务器状态，一次返回每个路径的同步结论
+func handleSyncCheck(storageService *storage.Service, propertyService *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.GetString("userID")
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req models.SyncCheckRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		verdicts := make([]models.SyncVerdict, 0, len(req.Entries))
+		for _, entry := range req.Entries {
+			info, err := storageService.StatObject(c.Request.Context(), userID, entry.Path)
+			if err != nil && !storage.IsNotFound(err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check " + entry.Path})
+				return
+			}
+			if err != nil {
+				info = nil
+			}
+
+			// 比对内容哈希需要PUT时记录的MD5，分段上传对象的ETag不是内容MD5
+			var storedMD5 string
+			if info != nil && entry.Hash != "" {
+				storedMD5, _, err = propertyService.GetChecksums(c.Request.Context(), userIDStr, davpath.Clean(entry.Path))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check " + entry.Path})
+					return
+				}
+			}
+			verdicts = append(verdicts, syncVerdict(entry, info, storedMD5))
+		}
+
+		c.JSON(http.StatusOK, models.SyncCheckResponse{Verdicts: verdicts})
+	}
+}
+
+// syncVerdict 根据客户端记录和服务器对象信息（不存在时为nil）得出同步结论，
+// storedMD5为上传时记录的内容MD5（未记录时为空）
+func syncVerdict(entry models.SyncEntry, info *minio.ObjectInfo, storedMD5 string) models.SyncVerdict {
+	verdict := models.SyncVerdict{Path: entry.Path}
+
+	if info == nil {
+		switch {
+		case entry.ETag == "":
+			verdict.Verdict = models.SyncVerdictNew
+		case entry.LocallyModified:
+			verdict.Verdict = models.SyncVerdictConflict
+		default:
+			verdict.Verdict = models.SyncVerdictDeleted
+		}
+		return verdict
+	}
+
+	serverETag := storage.ContentETag(*info)
+	verdict.ETag = serverETag
+	verdict.FileID = storage.FileID(*info)
+	verdict.Size = info.Size
+	lastModified := info.LastModified
+	verdict.LastModified = &lastModified
+
+	switch {
+	case entry.Hash != "" && strings.EqualFold(entry.Hash, contentMD5(serverETag, storedMD5)):
+		// 内容一致，无论ETag记录如何都视为未变化
+		verdict.Verdict = models.SyncVerdictUnchanged
+	case entry.ETag != "" && strings.Trim(entry.ETag, `"`) == serverETag:
+		verdict.Verdict = models.SyncVerdictUnchanged
+	case entry.ETag == "" || entry.LocallyModified:
+		verdict.Verdict = models.SyncVerdictConflict
+	default:
+		verdict.Verdict = models.SyncVerdictChangedOnServer
+	}
+	return verdict
+}
+
+// contentMD5 返回对象内容的十六进制MD5：优先使用上传时记录的值；未记录时只有单段上传的ETag（32位十六进制）
+// 才是内容MD5，分段上传的ETag（带"-分段数"后缀）等无法比对，返回空字符串
+func contentMD5(serverETag, storedMD5 string) string {
+	if storedMD5 != "" {
+		return storedMD5
+	}
+	if len(serverETag) != hex.EncodedLen(md5.Size) {
+		return ""
+	}
+	if _, err := hex.DecodeString(serverETag); err != nil {
+		return ""
+	}
+	return serverETag
+}
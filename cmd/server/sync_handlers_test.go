@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+func TestSyncVerdict(t *testing.T) {
+	const (
+		md5Hex     = "e4d909c290d0fb1ca068ffaddf22cbd0"
+		otherMD5   = "0cc175b9c0f1b6a831c399e269772661"
+		partETag   = "9b2cf535f27731c974343645a3985328-3"
+		partQuoted = `"` + partETag + `"`
+		singleETag = `"` + md5Hex + `"`
+	)
+	single := &minio.ObjectInfo{Key: "a.txt", ETag: singleETag, Size: 5, LastModified: time.Unix(100, 0)}
+	multipart := &minio.ObjectInfo{Key: "big.bin", ETag: partQuoted, Size: 1 << 30, LastModified: time.Unix(100, 0)}
+
+	tests := []struct {
+		name      string
+		entry     models.SyncEntry
+		info      *minio.ObjectInfo
+		storedMD5 string
+		want      string
+	}{
+		{"missing without record", models.SyncEntry{}, nil, "", models.SyncVerdictNew},
+		{"deleted on server", models.SyncEntry{ETag: md5Hex}, nil, "", models.SyncVerdictDeleted},
+		{"deleted but modified locally", models.SyncEntry{ETag: md5Hex, LocallyModified: true}, nil, "", models.SyncVerdictConflict},
+		{"same etag", models.SyncEntry{ETag: singleETag}, single, "", models.SyncVerdictUnchanged},
+		{"same hash single part", models.SyncEntry{Hash: md5Hex, LocallyModified: true}, single, "", models.SyncVerdictUnchanged},
+		{"hash case insensitive", models.SyncEntry{Hash: "E4D909C290D0FB1CA068FFADDF22CBD0", LocallyModified: true}, single, "", models.SyncVerdictUnchanged},
+		// 分段上传的ETag不是内容MD5，按记录的校验值比对
+		{"same hash multipart", models.SyncEntry{ETag: "stale", Hash: md5Hex, LocallyModified: true}, multipart, md5Hex, models.SyncVerdictUnchanged},
+		{"multipart without stored checksum", models.SyncEntry{Hash: md5Hex, LocallyModified: true}, multipart, "", models.SyncVerdictConflict},
+		{"stored checksum wins over etag", models.SyncEntry{Hash: md5Hex, LocallyModified: true}, single, otherMD5, models.SyncVerdictConflict},
+		{"multipart same etag", models.SyncEntry{ETag: partETag}, multipart, "", models.SyncVerdictUnchanged},
+		{"changed on server", models.SyncEntry{ETag: otherMD5}, single, "", models.SyncVerdictChangedOnServer},
+		{"changed on both sides", models.SyncEntry{ETag: otherMD5, Hash: otherMD5, LocallyModified: true}, single, md5Hex, models.SyncVerdictConflict},
+		{"exists without record", models.SyncEntry{}, single, "", models.SyncVerdictConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.Path = "/docs/file"
+			got := syncVerdict(tt.entry, tt.info, tt.storedMD5)
+			if got.Verdict != tt.want {
+				t.Errorf("verdict = %q, want %q", got.Verdict, tt.want)
+			}
+			if got.Path != tt.entry.Path {
+				t.Errorf("path = %q, want %q", got.Path, tt.entry.Path)
+			}
+			if tt.info != nil && (got.ETag == "" || got.LastModified == nil || got.Size != tt.info.Size) {
+				t.Errorf("server state not reported: %+v", got)
+			}
+		})
+	}
+}
+
+func TestContentMD5(t *testing.T) {
+	tests := []struct {
+		serverETag string
+		storedMD5  string
+		want       string
+	}{
+		{"e4d909c290d0fb1ca068ffaddf22cbd0", "", "e4d909c290d0fb1ca068ffaddf22cbd0"},
+		{"9b2cf535f27731c974343645a3985328-3", "", ""},
+		{"9b2cf535f27731c974343645a3985328-3", "e4d909c290d0fb1ca068ffaddf22cbd0", "e4d909c290d0fb1ca068ffaddf22cbd0"},
+		{"0x8DBC2A1B3C4D5E6", "", ""},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz", "", ""},
+	}
+	for _, tt := range tests {
+		if got := contentMD5(tt.serverETag, tt.storedMD5); got != tt.want {
+			t.Errorf("contentMD5(%q, %q) = %q, want %q", tt.serverETag, tt.storedMD5, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// handleListTags 列出用户使用的标签及各标签下的资源数
+func handleListTags(propertyService *webdav.PropertyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+
+		tags, err := propertyService.ListTags(c.Request.Context(), userID.String())
+		if err != nil {
+			log.Printf("Warning: failed to list tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tags"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
+
+// handleListTaggedFiles 列出带标签的文件和目录，标签属性残留但资源已不存在的路径被跳过
+func handleListTaggedFiles(propertyService *webdav.PropertyService, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		tag, ok := tagParam(c)
+		if !ok {
+			return
+		}
+
+		paths, err := propertyService.ListTaggedPaths(c.Request.Context(), userID.String(), tag)
+		if err != nil {
+			log.Printf("Warning: failed to list tagged files: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tagged files"})
+			return
+		}
+
+		files := make([]models.FileInfo, 0, len(paths))
+		for _, p := range paths {
+			info, err := resourceFileInfo(c.Request.Context(), storageService, userID, p)
+			if err != nil {
+				continue
+			}
+			files = append(files, *info)
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files})
+	}
+}
+
+// handleTagFile 给文件或目录添加标签
+func handleTagFile(propertyService *webdav.PropertyService, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, tag, resourcePath, ok := tagRequest(c, storageService)
+		if !ok {
+			return
+		}
+		if err := propertyService.TagResource(c.Request.Context(), userID.String(), resourcePath, tag); err != nil {
+			log.Printf("Warning: failed to tag %s: %v", resourcePath, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to tag file"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleUntagFile 去掉文件或目录的标签
+func handleUntagFile(propertyService *webdav.PropertyService, storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, tag, resourcePath, ok := tagRequest(c, storageService)
+		if !ok {
+			return
+		}
+		if err := propertyService.UntagResource(c.Request.Context(), userID.String(), resourcePath, tag); err != nil {
+			log.Printf("Warning: failed to untag %s: %v", resourcePath, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to untag file"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func tagParam(c *gin.Context) (string, bool) {
+	tag := c.Param("tag")
+	if !webdav.ValidTagName(tag) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag name"})
+		return "", false
+	}
+	return tag, true
+}
+
+// tagRequest 解析添加、去掉标签的请求，资源必须存在且不能是根目录
+func tagRequest(c *gin.Context, storageService *storage.Service) (uuid.UUID, string, string, bool) {
+	userID, _, ok := currentUser(c)
+	if !ok {
+		return uuid.Nil, "", "", false
+	}
+	tag, ok := tagParam(c)
+	if !ok {
+		return uuid.Nil, "", "", false
+	}
+	resourcePath := c.Query("path")
+	if resourcePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return uuid.Nil, "", "", false
+	}
+	resourcePath = davpath.Clean(resourcePath)
+	if resourcePath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the root folder cannot be tagged"})
+		return uuid.Nil, "", "", false
+	}
+
+	if _, err := storageService.StatResource(c.Request.Context(), userID, resourcePath); err != nil {
+		if storage.IsNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		} else {
+			log.Printf("Warning: failed to stat %s: %v", resourcePath, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stat file"})
+		}
+		return uuid.Nil, "", "", false
+	}
+	return userID, tag, resourcePath, true
+}
+
+// resourceFileInfo 返回文件或目录的文件信息，用于按属性列出的资源
+func resourceFileInfo(ctx context.Context, storageService *storage.Service, userID uuid.UUID, resourcePath string) (*models.FileInfo, error) {
+	resource, err := storageService.StatResource(ctx, userID, resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	filePath := strings.TrimSuffix(resource.Path, "/")
+	info := &models.FileInfo{
+		Path:  filePath,
+		Name:  path.Base(filePath),
+		IsDir: resource.IsCollection(),
+	}
+	if resource.Info != nil {
+		info.FileID = storage.FileID(*resource.Info)
+		info.LastModified = resource.Info.LastModified
+		if !info.IsDir {
+			info.Size = resource.Info.Size
+			info.ContentType = contenttype.Resolve(filePath, resource.Info.ContentType)
+			info.ETag = storage.ContentETag(*resource.Info)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/middleware"
+	"github.com/webdav-gateway/internal/tenant"
+)
+
+// tenantError 将租户服务的错误转换为响应
+func tenantError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+	case errors.Is(err, tenant.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, tenant.ErrNotMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, tenant.ErrInvalidSlug), errors.Is(err, tenant.ErrInvalidRole),
+		errors.Is(err, tenant.ErrInvalidStatus), errors.Is(err, tenant.ErrInvalidQuota):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, tenant.ErrSlugTaken), errors.Is(err, tenant.ErrAlreadyAssigned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Warning: tenant request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// tenantIDParam 读取路径参数中的租户ID
+func tenantIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tenant id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// requestTenant 注册前取得请求地址对应的租户；地址不属于任何租户时返回nil。
+// 租户不存在时返回404，已暂停时返回403，ok为false
+func requestTenant(c *gin.Context, tenants *tenant.Service) (*tenant.Tenant, bool) {
+	slug := tenants.Resolver().Slug(c.Request)
+	if slug == "" {
+		return nil, true
+	}
+	t, err := tenants.GetBySlug(c.Request.Context(), slug)
+	if err != nil {
+		tenantError(c, err, "failed to resolve tenant")
+		return nil, false
+	}
+	if t.Status == tenant.StatusSuspended {
+		c.JSON(http.StatusForbidden, gin.H{"error": "tenant is suspended"})
+		return nil, false
+	}
+	return t, true
+}
+
+// loginTenantMatches 判断用户所属的租户与登录地址对应的租户是否一致
+func loginTenantMatches(c *gin.Context, tenants *tenant.Service, userID uuid.UUID) (bool, error) {
+	membership, err := tenants.Membership(c.Request.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	slug := tenants.Resolver().Slug(c.Request)
+	if membership == nil {
+		return slug == "", nil
+	}
+	return membership.Slug == slug && membership.Status != tenant.StatusSuspended, nil
+}
+
+// handleListTenants 管理员列出所有租户及其用量
+func handleListTenants(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := tenants.List(c.Request.Context())
+		if err != nil {
+			tenantError(c, err, "failed to list tenants")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tenants": list})
+	}
+}
+
+// handleCreateTenant 管理员创建租户，未指定quota时使用tenancy.default_quota
+func handleCreateTenant(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Slug  string `json:"slug" binding:"required"`
+			Name  string `json:"name" binding:"max=100"`
+			Quota *int64 `json:"quota"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		quota := int64(-1)
+		if req.Quota != nil {
+			if *req.Quota < 0 {
+				tenantError(c, tenant.ErrInvalidQuota, "")
+				return
+			}
+			quota = *req.Quota
+		}
+
+		t, err := tenants.Create(c.Request.Context(), req.Slug, req.Name, quota)
+		if err != nil {
+			tenantError(c, err, "failed to create tenant")
+			return
+		}
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+// handleGetTenant 管理员查看租户
+func handleGetTenant(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := tenantIDParam(c)
+		if !ok {
+			return
+		}
+		t, err := tenants.Get(c.Request.Context(), id)
+		if err != nil {
+			tenantError(c, err, "failed to get tenant")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// handleUpdateTenant 管理员修改租户名称、配额池或暂停租户
+func handleUpdateTenant(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := tenantIDParam(c)
+		if !ok {
+			return
+		}
+		var req tenant.UpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		t, err := tenants.Update(c.Request.Context(), id, req)
+		if err != nil {
+			tenantError(c, err, "failed to update tenant")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// handleAddTenantMember 管理员将用户加入租户或修改其角色，用户不能转到其他租户
+func handleAddTenantMember(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := tenantIDParam(c)
+		if !ok {
+			return
+		}
+		userID, err := uuid.Parse(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		req := struct {
+			Role string `json:"role"`
+		}{Role: tenant.RoleMember}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tenants.AddMember(c.Request.Context(), id, userID, req.Role); err != nil {
+			tenantError(c, err, "failed to add tenant member")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tenant_id": id, "user_id": userID, "role": req.Role})
+	}
+}
+
+// currentTenantID 读取TenantMiddleware设置的租户，当前用户不属于租户时返回404
+func currentTenantID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.GetString(middleware.TenantIDKey))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user does not belong to a tenant"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// handleGetOwnTenant 租户管理员查看本租户的配额池和用量
+func handleGetOwnTenant(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := currentTenantID(c)
+		if !ok {
+			return
+		}
+		t, err := tenants.Get(c.Request.Context(), id)
+		if err != nil {
+			tenantError(c, err, "failed to get tenant")
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// handleListOwnTenantMembers 租户管理员列出本租户的成员
+func handleListOwnTenantMembers(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := currentTenantID(c)
+		if !ok {
+			return
+		}
+		members, err := tenants.Members(c.Request.Context(), id)
+		if err != nil {
+			tenantError(c, err, "failed to list tenant members")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"members": members})
+	}
+}
+
+// handleSetOwnTenantMemberRole 租户管理员调整本租户成员的角色
+func handleSetOwnTenantMemberRole(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := currentTenantID(c)
+		if !ok {
+			return
+		}
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		var req struct {
+			Role string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tenants.SetRole(c.Request.Context(), id, userID, req.Role); err != nil {
+			tenantError(c, err, "failed to update tenant member")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "role": req.Role})
+	}
+}
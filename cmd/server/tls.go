@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+)
+
+// newCertManager 创建ACME证书管理器：只为配置的域名申请证书，首次握手时申请，到期前30天自动续期
+func newCertManager(cfg config.ACMEConfig) *autocert.Manager {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+	}
+	if cfg.DirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	}
+	return manager
+}
+
+// serverTLSConfig 生成HTTPS监听的TLS配置，协议版本和套件遵循cryptopolicy；
+// 启用ACME时证书由certManager提供，并支持TLS-ALPN-01验证
+func serverTLSConfig(cfg config.TLSConfig, certManager *autocert.Manager) (*tls.Config, error) {
+	tlsConfig, err := cryptopolicy.TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if certManager != nil {
+		tlsConfig.GetCertificate = certManager.GetCertificate
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+	}
+	return tlsConfig, nil
+}
+
+// newRedirectServer 创建把明文HTTP重定向到HTTPS的监听，启用ACME时同时响应HTTP-01验证
+func newRedirectServer(addr, httpsAddr string, certManager *autocert.Manager) *http.Server {
+	handler := httpsRedirectHandler(httpsAddr)
+	if certManager != nil {
+		handler = certManager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+}
+
+// httpsRedirectHandler 把请求重定向到同一主机的HTTPS地址，HTTPS不在443端口时保留端口。
+// GET和HEAD使用301；其他方法使用308，WebDAV客户端重发时保留方法和请求体
+func httpsRedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			http.Error(w, "missing host", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6地址
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
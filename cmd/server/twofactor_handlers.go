@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/audit"
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/loginalert"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/twofactor"
+)
+
+// twoFactorCodeRequest 携带验证码或恢复码的请求
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// twoFactorLoginResponse 完成两步验证后的登录响应，登录时完成绑定的附带恢复码
+type twoFactorLoginResponse struct {
+	models.UserLoginResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// twoFactorErrorStatus 两步验证错误对应的状态码
+func twoFactorErrorStatus(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		return http.StatusUnauthorized, gin.H{"error": "invalid two-factor code", "code": "invalid_code"}
+	case errors.Is(err, twofactor.ErrChallengeInvalid):
+		return http.StatusUnauthorized, gin.H{"error": "two-factor challenge is invalid or expired, please sign in again", "code": "challenge_expired"}
+	case errors.Is(err, twofactor.ErrNotEnabled):
+		return http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled", "code": "not_enabled"}
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		return http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled", "code": "already_enabled"}
+	case errors.Is(err, twofactor.ErrNoPendingSetup):
+		return http.StatusConflict, gin.H{"error": "start two-factor setup first", "code": "setup_required"}
+	case errors.Is(err, twofactor.ErrRequired):
+		return http.StatusForbidden, gin.H{"error": "two-factor authentication is required for this account", "code": "two_factor_required"}
+	default:
+		log.Printf("Warning: two-factor request failed: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "failed to process two-factor request"}
+	}
+}
+
+// currentUser 读取AuthMiddleware设置的用户
+func currentUser(c *gin.Context) (uuid.UUID, string, bool) {
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return uuid.Nil, "", false
+	}
+	return userID, c.GetString("username"), true
+}
+
+// handleGetTwoFactorStatus 查看当前用户的两步验证状态
+func handleGetTwoFactorStatus(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, username, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		status, err := twoFactor.GetStatus(c.Request.Context(), userID, username)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// handleSetupTwoFactor 生成新密钥和otpauth地址，确认前不生效
+func handleSetupTwoFactor(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, username, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		enrollment, err := twoFactor.Setup(c.Request.Context(), userID, username)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// handleConfirmTwoFactor 用验证器App的验证码确认绑定，返回恢复码（只显示这一次）
+func handleConfirmTwoFactor(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		codes, err := twoFactor.Confirm(c.Request.Context(), userID, req.Code)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"enabled": true, "recovery_codes": codes})
+	}
+}
+
+// handleDisableTwoFactor 用验证码或恢复码关闭两步验证
+func handleDisableTwoFactor(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, username, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		if err := twoFactor.Disable(c.Request.Context(), userID, username, req.Code); err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+	}
+}
+
+// handleRegenerateRecoveryCodes 用当前验证码生成新的恢复码，旧恢复码作废
+func handleRegenerateRecoveryCodes(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		codes, err := twoFactor.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// handleEnrollTwoFactor 策略强制启用但尚未绑定时，凭登录返回的mfa_token生成密钥
+func handleEnrollTwoFactor(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			MFAToken string `json:"mfa_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		enrollment, err := twoFactor.SetupForChallenge(c.Request.Context(), req.MFAToken)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// handleVerifyTwoFactor 校验登录挑战的验证码或恢复码，通过后签发令牌
+func handleVerifyTwoFactor(twoFactor *twofactor.Service, authService *auth.Service, storageService *storage.Service, alerts *loginalert.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			MFAToken string `json:"mfa_token" binding:"required"`
+			Code     string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := twoFactor.VerifyChallenge(c.Request.Context(), req.MFAToken, req.Code)
+		if err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+
+		user, err := authService.GetUserByID(c.Request.Context(), result.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+			return
+		}
+		c.Set(audit.ActorKey, user.Username)
+		if result.UsedRecoveryCode {
+			log.Printf("User %s signed in with a recovery code", user.Username)
+		}
+
+		token, err := authService.GenerateToken(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		completeLogin(c, user, twoFactorLoginResponse{
+			UserLoginResponse: models.UserLoginResponse{Token: token, User: user},
+			RecoveryCodes:     result.RecoveryCodes,
+		}, authService, storageService, alerts)
+	}
+}
+
+// handleSetTwoFactorRequired 管理员为单个用户开启或取消强制两步验证
+func handleSetTwoFactorRequired(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		var req struct {
+			Required *bool `json:"required" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := twoFactor.SetRequired(c.Request.Context(), userID, *req.Required); err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "required": *req.Required})
+	}
+}
+
+// handleResetTwoFactor 管理员清除用户的验证器绑定和恢复码（设备丢失时）
+func handleResetTwoFactor(twoFactor *twofactor.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		if err := twoFactor.Reset(c.Request.Context(), userID); err != nil {
+			c.JSON(twoFactorErrorStatus(err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
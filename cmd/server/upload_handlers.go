@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/uploads"
+	"github.com/webdav-gateway/internal/webdav"
+	"github.com/webdav-gateway/internal/webdav/validators"
+)
+
+// handlePresignUpload 校验路径和配额后签发直接写入存储的上传URL
+func handlePresignUpload(uploadService *uploads.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+
+		var req models.PresignUploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := uploadService.Presign(c.Request.Context(), userID, &req)
+		if err != nil {
+			uploadError(c, err, "failed to presign upload")
+			return
+		}
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+// handleGetUpload 查看上传状态
+func handleGetUpload(uploadService *uploads.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		id, ok := uploadID(c)
+		if !ok {
+			return
+		}
+
+		u, err := uploadService.Get(c.Request.Context(), userID, id)
+		if err != nil {
+			uploadError(c, err, "failed to get upload")
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+// handleCompleteUpload 客户端写入全部内容后的完成回调，计入用量和变更日志
+func handleCompleteUpload(uploadService *uploads.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		id, ok := uploadID(c)
+		if !ok {
+			return
+		}
+
+		u, err := uploadService.Complete(c.Request.Context(), userID, id)
+		if err != nil {
+			uploadError(c, err, "failed to complete upload")
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+// handleCancelUpload 放弃等待中的上传
+func handleCancelUpload(uploadService *uploads.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		id, ok := uploadID(c)
+		if !ok {
+			return
+		}
+
+		if err := uploadService.Cancel(c.Request.Context(), userID, id); err != nil {
+			uploadError(c, err, "failed to cancel upload")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func uploadID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func uploadError(c *gin.Context, err error, fallback string) {
+	var nameErr *validators.FilenameError
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+	case errors.As(err, &nameErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": nameErr.Message})
+	case errors.Is(err, webdav.ErrResourceLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, webdav.ErrReadOnlyFolder), errors.Is(err, webdav.ErrWriteForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrInvalidPath), errors.Is(err, uploads.ErrTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrIsFolder), errors.Is(err, uploads.ErrParentNotFound),
+		errors.Is(err, uploads.ErrNotPending), errors.Is(err, uploads.ErrNotUploaded),
+		errors.Is(err, uploads.ErrSizeMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+	case errors.Is(err, uploads.ErrUnsupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Warning: upload request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/tenant"
+)
+
+// handleWellKnownDAV 将CalDAV/CardDAV服务发现地址（RFC 6764）重定向到WebDAV根目录，
+// 客户端随后通过PROPFIND读取current-user-principal和home-set。多租户路径模式下重定向到租户前缀下的地址
+func handleWellKnownDAV(target string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, tenant.MountPrefix(c.Request.Context())+target)
+	}
+}
@@ -1,5 +1,15 @@
 -- Database schema for WebDAV Gateway
 
+-- Tenants (tenancy.enabled)
+CREATE TABLE IF NOT EXISTS tenants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug VARCHAR(16) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    quota_bytes BIGINT NOT NULL DEFAULT 0, -- pooled quota of all members, 0 = unlimited
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -10,6 +20,12 @@ CREATE TABLE IF NOT EXISTS users (
     storage_quota BIGINT DEFAULT 10737418240, -- 10GB
     storage_used BIGINT DEFAULT 0,
     status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'deleted')),
+    tokens_valid_after TIMESTAMP, -- tokens issued earlier are revoked
+    deletion_requested_at TIMESTAMP, -- account deletion requested by the user
+    purge_after TIMESTAMP, -- files and the account are removed after this time
+    password_reset_required BOOLEAN DEFAULT FALSE,
+    tenant_id UUID REFERENCES tenants(id) ON DELETE RESTRICT, -- NULL outside multi-tenant mode
+    tenant_role VARCHAR(20) NOT NULL DEFAULT 'member',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -25,18 +41,403 @@ CREATE TABLE IF NOT EXISTS file_shares (
     expires_at TIMESTAMP,
     max_downloads INTEGER,
     download_count INTEGER DEFAULT 0,
-    permissions VARCHAR(20) DEFAULT 'read' CHECK (permissions IN ('read', 'write')),
+    permissions VARCHAR(20) DEFAULT 'read' CHECK (permissions IN ('read', 'write', 'drop')),
+    max_uploads INTEGER,
+    max_upload_size BIGINT,
+    max_upload_bytes BIGINT,
+    upload_count INTEGER NOT NULL DEFAULT 0,
+    upload_bytes BIGINT NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMP,
+    disabled_reason VARCHAR(20),
+    first_accessed_at TIMESTAMP,
+    short_slug VARCHAR(32),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Share access events (share.stats)
+CREATE TABLE IF NOT EXISTS share_access_events (
+    id UUID PRIMARY KEY,
+    share_id UUID NOT NULL REFERENCES file_shares(id) ON DELETE CASCADE,
+    accessed_at TIMESTAMP NOT NULL,
+    ip VARCHAR(45),
+    action VARCHAR(16) NOT NULL,
+    path TEXT,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    user_agent TEXT
+);
+
+-- WebDAV dead properties table (properties.backend = postgres)
+CREATE TABLE IF NOT EXISTS properties (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    name TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    value TEXT,
+    is_live BOOLEAN DEFAULT FALSE,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL,
+    UNIQUE(user_id, path, namespace, name)
+);
+
+-- Known login devices and countries (auth.login_alerts)
+CREATE TABLE IF NOT EXISTS login_devices (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_hash VARCHAR(64) NOT NULL,
+    user_agent TEXT,
+    last_ip VARCHAR(45),
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, device_hash)
+);
+
+CREATE TABLE IF NOT EXISTS login_countries (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    country VARCHAR(2) NOT NULL,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, country)
+);
+
+-- Login anomaly alerts; only token hashes are stored
+CREATE TABLE IF NOT EXISTS login_alerts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    reasons VARCHAR(64) NOT NULL,
+    device_hash VARCHAR(64) NOT NULL,
+    ip VARCHAR(45),
+    country VARCHAR(2),
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    denied_at TIMESTAMP,
+    reset_token_hash VARCHAR(64) UNIQUE,
+    reset_expires_at TIMESTAMP,
+    reset_used_at TIMESTAMP
+);
+
+-- External (SSO) identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+-- Group memberships synchronized from identity providers
+CREATE TABLE IF NOT EXISTS user_groups (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_name VARCHAR(255) NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    PRIMARY KEY (user_id, group_name, source)
+);
+
+-- Users and groups provisioned through SCIM; members live in user_groups (source = 'scim')
+CREATE TABLE IF NOT EXISTS scim_users (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    external_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id UUID PRIMARY KEY,
+    display_name VARCHAR(255) UNIQUE NOT NULL,
+    external_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- TOTP two-factor authentication (auth.two_factor.enabled)
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64),
+    pending_secret VARCHAR(64),
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    enabled_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Personal access tokens (auth.api_tokens.enabled), only the SHA-256 of the token is stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    hint VARCHAR(16) NOT NULL,
+    scopes VARCHAR(100) NOT NULL, -- comma-separated: read, write, share, admin
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(45),
+    created_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- Per-folder storage usage breakdown (quota.usage.enabled)
+CREATE TABLE IF NOT EXISTS usage_users (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    requested_at TIMESTAMP NOT NULL,
+    scanned_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS usage_folders (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    folder TEXT NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    files BIGINT NOT NULL DEFAULT 0,
+    categories JSONB,
+    largest JSONB,
+    dirty BOOLEAN NOT NULL DEFAULT TRUE,
+    generation BIGINT NOT NULL DEFAULT 0,
+    computed_at TIMESTAMP,
+    PRIMARY KEY (user_id, folder)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_folders_dirty ON usage_folders(user_id) WHERE dirty;
+
+-- Background jobs (batch operations, zip exports)
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    payload JSONB,
+    result JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    progress_done BIGINT NOT NULL DEFAULT 0,
+    progress_total BIGINT NOT NULL DEFAULT 0,
+    progress_message TEXT NOT NULL DEFAULT '',
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, created_at);
+
+-- Mirrors pulling upstream WebDAV/S3 content into user folders (mirror.enabled)
+CREATE TABLE IF NOT EXISTS mirrors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    source_type VARCHAR(20) NOT NULL CHECK (source_type IN ('webdav', 's3')),
+    source_url TEXT NOT NULL,
+    source_bucket VARCHAR(255) NOT NULL DEFAULT '',
+    source_prefix TEXT NOT NULL DEFAULT '',
+    source_username VARCHAR(255) NOT NULL DEFAULT '',
+    source_password TEXT NOT NULL DEFAULT '',
+    target_path TEXT NOT NULL,
+    interval_seconds INTEGER NOT NULL,
+    delete_extraneous BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_sync_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    running_since TIMESTAMP,
+    last_sync_at TIMESTAMP,
+    last_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    last_error TEXT NOT NULL DEFAULT '',
+    last_stats JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS mirror_objects (
+    mirror_id UUID NOT NULL REFERENCES mirrors(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    version TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (mirror_id, path)
+);
+
+-- Server-side imports from other WebDAV servers (migration.enabled)
+CREATE TABLE IF NOT EXISTS migrations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by UUID NOT NULL,
+    source_url TEXT NOT NULL,
+    source_username VARCHAR(255) NOT NULL DEFAULT '',
+    source_password TEXT NOT NULL DEFAULT '',
+    target_path TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    progress JSONB,
+    last_error TEXT NOT NULL DEFAULT '',
+    running_since TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS migration_objects (
+    migration_id UUID NOT NULL REFERENCES migrations(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    version TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (migration_id, path)
+);
+
+-- Comments on files, keyed by the stable file id (comments.enabled)
+CREATE TABLE IF NOT EXISTS file_comments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_id TEXT NOT NULL,
+    parent_id UUID REFERENCES file_comments(id) ON DELETE CASCADE,
+    author_id UUID NOT NULL,
+    author_name VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    deleted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Metadata extracted from images, videos and audio, keyed by the stable file id (media.enabled)
+CREATE TABLE IF NOT EXISTS media_metadata (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    etag TEXT NOT NULL DEFAULT '',
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    width INTEGER,
+    height INTEGER,
+    taken_at TIMESTAMP WITH TIME ZONE,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    duration_seconds DOUBLE PRECISION,
+    camera_make TEXT NOT NULL DEFAULT '',
+    camera_model TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    artist TEXT NOT NULL DEFAULT '',
+    album TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, file_id)
+);
+
+-- Reference counts of content-addressed blobs (storage.dedup)
+CREATE TABLE IF NOT EXISTS dedup_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    refs BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+-- Presigned uploads written directly to storage (uploads.enabled)
+CREATE TABLE IF NOT EXISTS direct_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    parts INTEGER NOT NULL DEFAULT 0,
+    part_size BIGINT NOT NULL DEFAULT 0,
+    upload_id TEXT NOT NULL DEFAULT '',
+    overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+    previous_size BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+-- Audit log (audit.enabled)
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id UUID,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(50) NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    destination TEXT NOT NULL DEFAULT '',
+    client_ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    result VARCHAR(20) NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    details JSONB
+);
+
+-- Folded names for case-insensitive lookups (webdav.case_insensitive)
+CREATE TABLE IF NOT EXISTS name_index (
+    user_id TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    folded_key TEXT NOT NULL,
+    PRIMARY KEY (user_id, object_key)
+);
+
+CREATE TABLE IF NOT EXISTS name_index_users (
+    user_id TEXT PRIMARY KEY,
+    built_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
+CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after) WHERE purge_after IS NOT NULL;
 
 CREATE INDEX IF NOT EXISTS idx_file_shares_user_id ON file_shares(user_id);
 CREATE INDEX IF NOT EXISTS idx_file_shares_share_token ON file_shares(share_token);
 CREATE INDEX IF NOT EXISTS idx_file_shares_created_at ON file_shares(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_file_shares_disabled_at ON file_shares(disabled_at) WHERE disabled_at IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_shares_short_slug ON file_shares(short_slug);
+CREATE INDEX IF NOT EXISTS idx_share_access_events_share ON share_access_events(share_id, accessed_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_name_index_folded ON name_index(user_id, folded_key);
+
+CREATE INDEX IF NOT EXISTS idx_mirrors_user_id ON mirrors(user_id);
+CREATE INDEX IF NOT EXISTS idx_mirrors_next_sync_at ON mirrors(next_sync_at) WHERE enabled;
+
+CREATE INDEX IF NOT EXISTS idx_migrations_status ON migrations(status) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_direct_uploads_pending ON direct_uploads(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_file_comments_file ON file_comments(user_id, file_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_file_comments_parent ON file_comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_media_metadata_queue ON media_metadata(updated_at) WHERE status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS idx_media_metadata_taken_at ON media_metadata(user_id, taken_at);
+CREATE INDEX IF NOT EXISTS idx_dedup_blobs_released ON dedup_blobs(released_at) WHERE refs = 0;
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, occurred_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_login_alerts_user_id ON login_alerts(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_groups_group ON user_groups(group_name, source);
+
+CREATE INDEX IF NOT EXISTS idx_properties_user_path ON properties(user_id, path);
+-- Byte-order index for path prefix range scans (PROPFIND of collections)
+CREATE INDEX IF NOT EXISTS idx_properties_user_path_prefix ON properties(user_id, path COLLATE "C");
+CREATE INDEX IF NOT EXISTS idx_properties_namespace ON properties(namespace);
+CREATE INDEX IF NOT EXISTS idx_properties_name ON properties(name);
+CREATE INDEX IF NOT EXISTS idx_properties_user_path_namespace ON properties(user_id, path, namespace);
+CREATE INDEX IF NOT EXISTS idx_properties_user_path_name ON properties(user_id, path, name);
+CREATE INDEX IF NOT EXISTS idx_properties_created_at ON properties(created_at);
+CREATE INDEX IF NOT EXISTS idx_properties_is_live ON properties(is_live);
 
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -0,0 +1,262 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// defaultExportFolder 未配置account.export_folder时导出文件的保存目录
+const defaultExportFolder = "/Account exports"
+
+// ExportStats 一次数据导出包含的内容
+type ExportStats struct {
+	Files      int   `json:"files"`
+	Folders    int   `json:"folders"`
+	Bytes      int64 `json:"bytes"`
+	Properties int   `json:"properties"`
+	Shares     int   `json:"shares"`
+}
+
+// exportedAccount 导出的account.json
+type exportedAccount struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	DisplayName  string    `json:"display_name"`
+	StorageQuota int64     `json:"storage_quota"`
+	StorageUsed  int64     `json:"storage_used"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExportedAt   time.Time `json:"exported_at"`
+}
+
+// exportedProperty 导出的properties.json中的一个属性
+type exportedProperty struct {
+	Path      string `json:"path"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// exportedShare 导出的shares.json中的一个分享，不包含令牌和密码哈希
+type exportedShare struct {
+	ID             uuid.UUID  `json:"id"`
+	FilePath       string     `json:"file_path"`
+	ShareName      string     `json:"share_name,omitempty"`
+	Permissions    string     `json:"permissions"`
+	HasPassword    bool       `json:"has_password"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads   *int64     `json:"max_downloads,omitempty"`
+	DownloadCount  int64      `json:"download_count"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ExportFolder 数据导出压缩包的保存目录
+func (s *Service) ExportFolder() string {
+	if s.config.ExportFolder == "" {
+		return defaultExportFolder
+	}
+	return path.Clean("/" + s.config.ExportFolder)
+}
+
+// ExportTarget 在t时刻开始的导出的保存路径
+func (s *Service) ExportTarget(t time.Time) string {
+	return path.Join(s.ExportFolder(), "account-export-"+t.UTC().Format("20060102-150405")+".zip")
+}
+
+// Export 把用户的全部数据写为zip：files/下是用户的文件和目录（保留目录结构），
+// metadata/下是account.json、properties.json和shares.json。导出目录中以前的导出不包含在内。
+// progress在每写完一个文件后调用
+func (s *Service) Export(ctx context.Context, userID uuid.UUID, w io.Writer, progress func(done, total int)) (*ExportStats, error) {
+	exportPrefix := strings.TrimPrefix(s.ExportFolder(), "/") + "/"
+	var objects []minio.ObjectInfo
+	err := s.storage.WalkObjects(ctx, userID, "", true, func(object minio.ObjectInfo) error {
+		if object.Key+"/" == exportPrefix || strings.HasPrefix(object.Key, exportPrefix) {
+			return nil
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	stats := &ExportStats{}
+	zw := zip.NewWriter(w)
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") {
+			// 保留空目录
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: "files/" + object.Key, Modified: object.LastModified}); err != nil {
+				return nil, err
+			}
+			stats.Folders++
+			continue
+		}
+		if err := s.exportFile(ctx, zw, userID, object); err != nil {
+			return nil, fmt.Errorf("export %s: %w", object.Key, err)
+		}
+		stats.Files++
+		stats.Bytes += object.Size
+		if progress != nil {
+			progress(stats.Files, len(objects)-stats.Folders)
+		}
+	}
+
+	account, err := s.exportAccount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	properties, err := s.exportProperties(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := s.exportShares(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Properties, stats.Shares = len(properties), len(shares)
+	for name, value := range map[string]interface{}{
+		"metadata/account.json":    account,
+		"metadata/properties.json": properties,
+		"metadata/shares.json":     shares,
+	} {
+		if err := writeJSON(zw, name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// exportFile 把一个文件写入zip
+func (s *Service) exportFile(ctx context.Context, zw *zip.Writer, userID uuid.UUID, object minio.ObjectInfo) error {
+	obj, err := s.storage.GetObject(ctx, userID, object.Key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "files/" + object.Key, Method: zip.Deflate, Modified: object.LastModified})
+	if err != nil {
+		return err
+	}
+	_, err = storage.CopyContext(ctx, fw, obj)
+	return err
+}
+
+// exportAccount 读取账户信息
+func (s *Service) exportAccount(ctx context.Context, userID uuid.UUID) (*exportedAccount, error) {
+	account := &exportedAccount{ID: userID, ExportedAt: s.now().UTC()}
+	var displayName sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT username, email, display_name, COALESCE(storage_quota, 0), COALESCE(storage_used, 0), created_at
+		FROM users WHERE id = $1`, userID).
+		Scan(&account.Username, &account.Email, &displayName, &account.StorageQuota, &account.StorageUsed, &account.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account: %w", err)
+	}
+	account.DisplayName = displayName.String
+	return account, nil
+}
+
+// exportProperties 按路径顺序列出用户的全部WebDAV属性
+func (s *Service) exportProperties(ctx context.Context, userID uuid.UUID) ([]exportedProperty, error) {
+	groups, err := s.properties.ListPropertiesByPathPrefix(ctx, userID.String(), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list properties: %w", err)
+	}
+	properties := []exportedProperty{}
+	for _, props := range groups {
+		for _, prop := range props {
+			properties = append(properties, exportedProperty{
+				Path:      prop.Path,
+				Namespace: prop.Namespace,
+				Name:      prop.Name,
+				Value:     prop.Value,
+				UpdatedAt: prop.UpdatedAt,
+			})
+		}
+	}
+	sort.Slice(properties, func(i, j int) bool {
+		a, b := properties[i], properties[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return properties, nil
+}
+
+// exportShares 列出用户创建的分享
+func (s *Service) exportShares(ctx context.Context, userID uuid.UUID) ([]exportedShare, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, file_path, share_name, permissions, password_hash, expires_at, max_downloads,
+			COALESCE(download_count, 0), disabled_at, disabled_reason, created_at
+		FROM file_shares WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []exportedShare{}
+	for rows.Next() {
+		var (
+			sh                                  exportedShare
+			name, permissions, password, reason sql.NullString
+			expiresAt, disabledAt               sql.NullTime
+			maxDownloads                        sql.NullInt64
+		)
+		if err := rows.Scan(&sh.ID, &sh.FilePath, &name, &permissions, &password, &expiresAt, &maxDownloads,
+			&sh.DownloadCount, &disabledAt, &reason, &sh.CreatedAt); err != nil {
+			return nil, err
+		}
+		sh.ShareName, sh.Permissions, sh.DisabledReason = name.String, permissions.String, reason.String
+		sh.HasPassword = password.String != ""
+		if expiresAt.Valid {
+			sh.ExpiresAt = &expiresAt.Time
+		}
+		if maxDownloads.Valid && maxDownloads.Int64 > 0 {
+			sh.MaxDownloads = &maxDownloads.Int64
+		}
+		if disabledAt.Valid {
+			sh.DisabledAt = &disabledAt.Time
+		}
+		shares = append(shares, sh)
+	}
+	return shares, rows.Err()
+}
+
+// writeJSON 把value以缩进的JSON写入zip
+func writeJSON(zw *zip.Writer, name string, value interface{}) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
@@ -0,0 +1,303 @@
+// Package account 用户注销账户（宽限期后删除数据）和个人数据导出
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+var (
+	// ErrNotFound 用户不存在或不是可注销的活动账户
+	ErrNotFound = errors.New("account not found")
+	// ErrNotScheduled 账户没有计划中的删除
+	ErrNotScheduled = errors.New("account is not scheduled for deletion")
+)
+
+// purgeClaim 副本开始删除一个到期账户时把删除时间推后的时长，期间其他副本不会处理该账户；
+// 删除中途退出时由任一副本在此之后重试
+const purgeClaim = time.Hour
+
+// ObjectStore 注销和导出用到的存储操作，由storage.Service实现
+type ObjectStore interface {
+	WalkObjects(ctx context.Context, userID uuid.UUID, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error
+	GetObject(ctx context.Context, userID uuid.UUID, objectPath string) (storage.Object, error)
+	DeleteAll(ctx context.Context, userID uuid.UUID) (storage.DeleteStats, error)
+}
+
+// PropertyStore 用户的WebDAV属性，由webdav.PropertyService实现
+type PropertyStore interface {
+	ListPropertiesByPathPrefix(ctx context.Context, userID, prefix string) (map[string][]*webdav.DatabaseProperty, error)
+	DeletePropertiesRecursive(ctx context.Context, userID, path string) error
+}
+
+// Deletion 计划中的账户删除
+type Deletion struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Username    string    `json:"username"`
+	RequestedAt time.Time `json:"requested_at"`
+	PurgeAfter  time.Time `json:"purge_after"`
+}
+
+// Service 账户注销：注销时停用账户、撤销会话并停用分享，宽限期过后删除全部文件、属性和账户记录。
+// 宽限期内管理员可以恢复账户
+type Service struct {
+	db         *sql.DB
+	storage    ObjectStore
+	properties PropertyStore
+	config     config.AccountConfig
+	now        func() time.Time
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService 创建账户注销服务
+func NewService(db *sql.DB, storage ObjectStore, properties PropertyStore, cfg config.AccountConfig) *Service {
+	return &Service{
+		db:         db,
+		storage:    storage,
+		properties: properties,
+		config:     cfg,
+		now:        time.Now,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Initialize 为users表添加注销时间和删除时间列，以及会话撤销时间列tokens_valid_after。
+// 会话撤销列只在这里创建，SCIM和异常登录提醒也会读写该列
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after) WHERE purge_after IS NOT NULL`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize account deletion: %w", err)
+		}
+	}
+	return nil
+}
+
+// TokensValidAfter 实现auth.RevocationChecker，在每次校验JWT时调用，不依赖auth.login_alerts：
+// 用户不存在或不是active状态（注销、SCIM停用或删除）时返回auth.ErrTokenRevoked，
+// 否则返回会话撤销时间tokens_valid_after，从未撤销时返回零值
+func (s *Service) TokensValidAfter(ctx context.Context, userID string) (time.Time, error) {
+	var validAfter sql.NullTime
+	var status string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT tokens_valid_after, status FROM users WHERE id = $1`, userID).Scan(&validAfter, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, auth.ErrTokenRevoked
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load session revocation: %w", err)
+	}
+	if status != "active" {
+		return time.Time{}, auth.ErrTokenRevoked
+	}
+	return validAfter.Time, nil
+}
+
+// ScheduleDeletion 注销账户：账户停用（不能再登录），已签发的令牌全部失效，分享停止访问，
+// account.deletion_grace_period之后删除数据。只有活动账户可以注销，否则返回ErrNotFound
+func (s *Service) ScheduleDeletion(ctx context.Context, userID uuid.UUID) (*Deletion, error) {
+	now := s.now()
+	deletion := &Deletion{UserID: userID, RequestedAt: now, PurgeAfter: now.Add(s.config.DeletionGracePeriod)}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users SET status = 'suspended', deletion_requested_at = $1, purge_after = $2,
+			tokens_valid_after = $1, updated_at = $1
+		WHERE id = $3 AND status = 'active'`,
+		deletion.RequestedAt, deletion.PurgeAfter, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT username FROM users WHERE id = $1`, userID).Scan(&deletion.Username); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE file_shares SET disabled_at = $1, disabled_reason = $2
+		WHERE user_id = $3 AND disabled_at IS NULL`,
+		now, share.ReasonAccountDeleted, userID); err != nil {
+		return nil, fmt.Errorf("failed to disable shares: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// CancelDeletion 在宽限期内恢复账户并重新启用因注销而停用的分享，注销前的会话不会恢复
+func (s *Service) CancelDeletion(ctx context.Context, userID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users SET status = 'active', deletion_requested_at = NULL, purge_after = NULL, updated_at = $1
+		WHERE id = $2 AND status = 'suspended' AND deletion_requested_at IS NOT NULL`,
+		s.now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotScheduled
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE file_shares SET disabled_at = NULL, disabled_reason = NULL
+		WHERE user_id = $1 AND disabled_reason = $2`,
+		userID, share.ReasonAccountDeleted); err != nil {
+		return fmt.Errorf("failed to enable shares: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListDeletions 列出计划中的账户删除，按删除时间排序
+func (s *Service) ListDeletions(ctx context.Context) ([]Deletion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, deletion_requested_at, purge_after FROM users
+		WHERE status = 'suspended' AND deletion_requested_at IS NOT NULL
+		ORDER BY purge_after`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	deletions := []Deletion{}
+	for rows.Next() {
+		var d Deletion
+		if err := rows.Scan(&d.UserID, &d.Username, &d.RequestedAt, &d.PurgeAfter); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+// Start 启动定期删除到期账户，purge_interval不大于0时不启动
+func (s *Service) Start() {
+	if s.config.PurgeInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.PurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := s.Purge(context.Background())
+				if err != nil {
+					log.Printf("Warning: account purge failed: %v", err)
+				} else if purged > 0 {
+					log.Printf("Account purge deleted %d accounts", purged)
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定期删除
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+// Purge 删除宽限期已过的账户，返回删除的账户数。单个账户失败时记录警告并继续处理其他账户，
+// 失败的账户在purgeClaim之后重试
+func (s *Service) Purge(ctx context.Context) (int, error) {
+	now := s.now()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE status = 'suspended' AND deletion_requested_at IS NOT NULL AND purge_after <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired accounts: %w", err)
+	}
+	var due []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range due {
+		// 推后删除时间认领账户，多副本同时运行时每个账户只由一个副本删除
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE users SET purge_after = $1
+			WHERE id = $2 AND status = 'suspended' AND deletion_requested_at IS NOT NULL AND purge_after <= $3`,
+			now.Add(purgeClaim), userID, now)
+		if err != nil {
+			return purged, fmt.Errorf("failed to claim account %s: %w", userID, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := s.purgeUser(ctx, userID); err != nil {
+			log.Printf("Warning: failed to delete account %s: %v", userID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeUser 删除账户的全部文件和属性，最后删除账户记录（分享、令牌、登录记录等随之级联删除）
+func (s *Service) purgeUser(ctx context.Context, userID uuid.UUID) error {
+	stats, err := s.storage.DeleteAll(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("delete files (%d removed): %w", stats.Objects, err)
+	}
+	if err := s.properties.DeletePropertiesRecursive(ctx, userID.String(), "/"); err != nil {
+		return fmt.Errorf("delete properties: %w", err)
+	}
+	// 认领后被管理员恢复的账户不删除记录，但文件已无法恢复，用量归零
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM users WHERE id = $1 AND status = 'suspended' AND deletion_requested_at IS NOT NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		log.Printf("Warning: account %s was restored while its files were being deleted", userID)
+		_, err := s.db.ExecContext(ctx, `UPDATE users SET storage_used = 0 WHERE id = $1`, userID)
+		return err
+	}
+	log.Printf("Deleted account %s: removed %d files (%d bytes)", userID, stats.Objects, stats.Bytes)
+	return nil
+}
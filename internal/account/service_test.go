@@ -0,0 +1,192 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// fakeStore 记录被清空的用户空间
+type fakeStore struct {
+	cleared []uuid.UUID
+}
+
+func (f *fakeStore) WalkObjects(ctx context.Context, userID uuid.UUID, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	return nil
+}
+
+func (f *fakeStore) GetObject(ctx context.Context, userID uuid.UUID, objectPath string) (storage.Object, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (f *fakeStore) DeleteAll(ctx context.Context, userID uuid.UUID) (storage.DeleteStats, error) {
+	f.cleared = append(f.cleared, userID)
+	return storage.DeleteStats{Objects: 2, Bytes: 10}, nil
+}
+
+// fakeProperties 记录被删除属性的用户
+type fakeProperties struct {
+	deleted []string
+}
+
+func (f *fakeProperties) ListPropertiesByPathPrefix(ctx context.Context, userID, prefix string) (map[string][]*webdav.DatabaseProperty, error) {
+	return nil, nil
+}
+
+func (f *fakeProperties) DeletePropertiesRecursive(ctx context.Context, userID, path string) error {
+	f.deleted = append(f.deleted, userID)
+	return nil
+}
+
+func newTestService(t *testing.T) (*Service, *sql.DB, *fakeStore) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "gateway.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := &fakeStore{}
+	s := NewService(db, store, &fakeProperties{}, config.AccountConfig{DeletionGracePeriod: 24 * time.Hour})
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s, db, store
+}
+
+func addUser(t *testing.T, db *sql.DB, name string) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+	userID, shareID := uuid.New(), uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, username, email, password_hash) VALUES ($1, $2, $3, 'x')`,
+		userID, name, name+"@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO file_shares (id, user_id, file_path, share_token) VALUES ($1, $2, '/a.txt', $3)`,
+		shareID, userID, name+"-token"); err != nil {
+		t.Fatal(err)
+	}
+	return userID, shareID
+}
+
+func shareReason(t *testing.T, db *sql.DB, shareID uuid.UUID) string {
+	t.Helper()
+	var reason sql.NullString
+	if err := db.QueryRow(`SELECT disabled_reason FROM file_shares WHERE id = $1`, shareID).Scan(&reason); err != nil {
+		t.Fatal(err)
+	}
+	return reason.String
+}
+
+func TestScheduleAndCancelDeletion(t *testing.T) {
+	ctx := context.Background()
+	s, db, _ := newTestService(t)
+	userID, shareID := addUser(t, db, "alice")
+
+	deletion, err := s.ScheduleDeletion(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deletion.Username != "alice" || !deletion.PurgeAfter.Equal(deletion.RequestedAt.Add(24*time.Hour)) {
+		t.Errorf("deletion = %+v", deletion)
+	}
+	if reason := shareReason(t, db, shareID); reason != share.ReasonAccountDeleted {
+		t.Errorf("share disabled_reason = %q, want %q", reason, share.ReasonAccountDeleted)
+	}
+	if _, err := s.ScheduleDeletion(ctx, userID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second ScheduleDeletion error = %v, want ErrNotFound", err)
+	}
+
+	deletions, err := s.ListDeletions(ctx)
+	if err != nil || len(deletions) != 1 || deletions[0].UserID != userID {
+		t.Fatalf("ListDeletions() = %+v, %v", deletions, err)
+	}
+
+	if err := s.CancelDeletion(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if reason := shareReason(t, db, shareID); reason != "" {
+		t.Errorf("share still disabled after restore: %q", reason)
+	}
+	if err := s.CancelDeletion(ctx, userID); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("second CancelDeletion error = %v, want ErrNotScheduled", err)
+	}
+}
+
+// TestTokensValidAfter 注销后全部令牌失效；恢复账户后注销前签发的令牌仍然失效
+func TestTokensValidAfter(t *testing.T) {
+	ctx := context.Background()
+	s, db, _ := newTestService(t)
+	userID, _ := addUser(t, db, "alice")
+
+	if validAfter, err := s.TokensValidAfter(ctx, userID.String()); err != nil || !validAfter.IsZero() {
+		t.Errorf("active user: TokensValidAfter() = %v, %v", validAfter, err)
+	}
+	if _, err := s.TokensValidAfter(ctx, uuid.NewString()); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("unknown user: error = %v, want ErrTokenRevoked", err)
+	}
+
+	deletion, err := s.ScheduleDeletion(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TokensValidAfter(ctx, userID.String()); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("scheduled deletion: error = %v, want ErrTokenRevoked", err)
+	}
+
+	if err := s.CancelDeletion(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	validAfter, err := s.TokensValidAfter(ctx, userID.String())
+	if err != nil || !validAfter.Equal(deletion.RequestedAt) {
+		t.Errorf("restored user: TokensValidAfter() = %v, %v, want %v", validAfter, err, deletion.RequestedAt)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	s, db, store := newTestService(t)
+	doomed, _ := addUser(t, db, "alice")
+	kept, _ := addUser(t, db, "bob")
+
+	if _, err := s.ScheduleDeletion(ctx, doomed); err != nil {
+		t.Fatal(err)
+	}
+
+	// 宽限期内不删除
+	if purged, err := s.Purge(ctx); err != nil || purged != 0 {
+		t.Fatalf("Purge() within grace period = %d, %v", purged, err)
+	}
+
+	later := s.now().Add(25 * time.Hour)
+	s.now = func() time.Time { return later }
+	if purged, err := s.Purge(ctx); err != nil || purged != 1 {
+		t.Fatalf("Purge() = %d, %v, want 1", purged, err)
+	}
+	if len(store.cleared) != 1 || store.cleared[0] != doomed {
+		t.Errorf("cleared storage of %v, want only %s", store.cleared, doomed)
+	}
+
+	var users int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE id IN ($1, $2)`, doomed, kept).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Errorf("%d users left, want only the active one", users)
+	}
+}
@@ -0,0 +1,35 @@
+package apitoken
+
+// 令牌的权限范围
+const (
+	// ScopeRead 读取文件、目录和属性
+	ScopeRead = "read"
+	// ScopeWrite 上传、修改、删除、移动文件，包含read
+	ScopeWrite = "write"
+	// ScopeShare 创建和管理分享链接
+	ScopeShare = "share"
+	// ScopeAdmin 访问/api/admin接口（用户本身仍需在auth.admins中），包含其他所有范围
+	ScopeAdmin = "admin"
+)
+
+// ValidScope 判断权限范围是否合法
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopeWrite, ScopeShare, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// Allows 判断已授予的权限范围是否满足required
+func Allows(granted []string, required string) bool {
+	for _, scope := range granted {
+		switch {
+		case scope == required, scope == ScopeAdmin:
+			return true
+		case scope == ScopeWrite && required == ScopeRead:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package apitoken
+
+import "testing"
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeWrite, false},
+		{[]string{ScopeWrite}, ScopeRead, true},
+		{[]string{ScopeWrite}, ScopeShare, false},
+		{[]string{ScopeShare}, ScopeRead, false},
+		{[]string{ScopeRead, ScopeShare}, ScopeShare, true},
+		{[]string{ScopeAdmin}, ScopeWrite, true},
+		{[]string{ScopeWrite}, ScopeAdmin, false},
+		{nil, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.granted, tt.required); got != tt.want {
+			t.Errorf("Allows(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := normalizeScopes([]string{"write", " Read ", "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != ScopeRead || got[1] != ScopeWrite {
+		t.Errorf("normalizeScopes = %v, want [read write]", got)
+	}
+	if _, err := normalizeScopes([]string{"read", "delete"}); err != ErrInvalidScope {
+		t.Errorf("unknown scope: err = %v, want ErrInvalidScope", err)
+	}
+	if _, err := normalizeScopes(nil); err != ErrNoScopes {
+		t.Errorf("no scopes: err = %v, want ErrNoScopes", err)
+	}
+}
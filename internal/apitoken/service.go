@@ -0,0 +1,372 @@
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/config"
+)
+
+// hintLength 令牌明文中保存下来用于识别的前缀长度（含auth.APITokenPrefix）
+const hintLength = 10
+
+// usageGranularity 最近使用时间的精度，同一IP在此间隔内的多次使用只写一次数据库
+const usageGranularity = time.Minute
+
+var (
+	// ErrNotFound 令牌不存在或不属于当前用户
+	ErrNotFound = errors.New("api token not found")
+	// ErrInvalidName 令牌名称为空或过长
+	ErrInvalidName = errors.New("token name must be 1-100 characters")
+	// ErrInvalidScope 未知的权限范围
+	ErrInvalidScope = errors.New("scopes must be read, write, share or admin")
+	// ErrNoScopes 没有指定权限范围
+	ErrNoScopes = errors.New("at least one scope is required")
+	// ErrTooManyTokens 有效令牌数达到auth.api_tokens.max_per_user
+	ErrTooManyTokens = errors.New("too many active api tokens")
+	// ErrLifetimeTooLong 有效期超过auth.api_tokens.max_lifetime，或要求永不过期但配置了上限
+	ErrLifetimeTooLong = errors.New("token lifetime exceeds the allowed maximum")
+)
+
+// Token 个人访问令牌，明文只在创建和轮换时返回一次
+type Token struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username,omitempty"`
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes"`
+	// Hint 令牌开头的几个字符，用于在列表中识别令牌
+	Hint       string     `json:"hint"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateRequest 创建令牌
+type CreateRequest struct {
+	Name   string
+	Scopes []string
+	// ExpiresIn 有效期，0表示永不过期
+	ExpiresIn time.Duration
+}
+
+// Service 个人访问令牌的创建、轮换、吊销和校验，数据保存在主数据库（PostgreSQL）中，只保存令牌摘要
+type Service struct {
+	db        *sql.DB
+	cfg       config.APITokenConfig
+	now       func() time.Time
+	initOnce  sync.Once
+	initError error
+}
+
+// NewService 创建个人访问令牌服务
+func NewService(db *sql.DB, cfg config.APITokenConfig) *Service {
+	if cfg.MaxPerUser <= 0 {
+		cfg.MaxPerUser = 20
+	}
+	return &Service{db: db, cfg: cfg, now: time.Now}
+}
+
+// Initialize 创建所需的表，多次调用只执行一次
+func (s *Service) Initialize(ctx context.Context) error {
+	s.initOnce.Do(func() {
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS api_tokens (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(100) NOT NULL,
+				token_hash VARCHAR(64) UNIQUE NOT NULL,
+				hint VARCHAR(16) NOT NULL,
+				scopes VARCHAR(100) NOT NULL,
+				expires_at TIMESTAMP,
+				last_used_at TIMESTAMP,
+				last_used_ip VARCHAR(45),
+				created_at TIMESTAMP NOT NULL,
+				rotated_at TIMESTAMP,
+				revoked_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+		}
+		for _, query := range queries {
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				s.initError = fmt.Errorf("初始化个人访问令牌表失败: %v", err)
+				return
+			}
+		}
+	})
+	return s.initError
+}
+
+// normalizeScopes 去重并排序权限范围
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !ValidScope(scope) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrNoScopes
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Create 为用户创建令牌，返回令牌信息和明文
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, req CreateRequest) (*Token, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len([]rune(name)) > 100 {
+		return nil, "", ErrInvalidName
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.ExpiresIn < 0 {
+		return nil, "", ErrLifetimeTooLong
+	}
+	if s.cfg.MaxLifetime > 0 && (req.ExpiresIn == 0 || req.ExpiresIn > s.cfg.MaxLifetime) {
+		return nil, "", ErrLifetimeTooLong
+	}
+
+	now := s.now().UTC()
+	var active int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)`,
+		userID, now).Scan(&active)
+	if err != nil {
+		return nil, "", err
+	}
+	if active >= s.cfg.MaxPerUser {
+		return nil, "", ErrTooManyTokens
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	token := &Token{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		Hint:      secret[:hintLength],
+		CreatedAt: now,
+	}
+	if req.ExpiresIn > 0 {
+		expires := now.Add(req.ExpiresIn)
+		token.ExpiresAt = &expires
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, hint, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		token.ID, userID, name, hashToken(secret), token.Hint, strings.Join(scopes, ","), token.ExpiresAt, now)
+	if err != nil {
+		return nil, "", fmt.Errorf("create api token: %w", err)
+	}
+	return token, secret, nil
+}
+
+// tokenColumns 令牌列，与scanToken的顺序一致
+const tokenColumns = `t.id, t.user_id, u.username, t.name, t.scopes, t.hint, t.expires_at,
+	t.last_used_at, COALESCE(t.last_used_ip, ''), t.created_at, t.rotated_at, t.revoked_at`
+
+func scanToken(row interface{ Scan(...interface{}) error }) (*Token, error) {
+	var t Token
+	var scopes string
+	var expiresAt, lastUsedAt, rotatedAt, revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Username, &t.Name, &scopes, &t.Hint, &expiresAt,
+		&lastUsedAt, &t.LastUsedIP, &t.CreatedAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	t.ExpiresAt = nullTime(expiresAt)
+	t.LastUsedAt = nullTime(lastUsedAt)
+	t.RotatedAt = nullTime(rotatedAt)
+	t.RevokedAt = nullTime(revokedAt)
+	return &t, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// list 按条件列出令牌，最近创建的在前
+func (s *Service) list(ctx context.Context, where string, args ...interface{}) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+tokenColumns+`
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		`+where+`
+		ORDER BY t.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// List 返回用户的令牌，包括已过期和已吊销的令牌
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]Token, error) {
+	return s.list(ctx, `WHERE t.user_id = $1`, userID)
+}
+
+// ListAll 返回所有用户未吊销的令牌，供管理员审查
+func (s *Service) ListAll(ctx context.Context) ([]Token, error) {
+	return s.list(ctx, `WHERE t.revoked_at IS NULL`)
+}
+
+// get 返回令牌，userID为uuid.Nil时不检查所有者
+func (s *Service) get(ctx context.Context, userID, id uuid.UUID) (*Token, error) {
+	t, err := scanToken(s.db.QueryRowContext(ctx, `
+		SELECT `+tokenColumns+`
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.id = $1 AND ($2::uuid IS NULL OR t.user_id = $2)`, id, uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil}))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// Rotate 为令牌生成新的明文，旧明文立即失效。名称和权限范围不变，
+// 有效期从现在起重新计算，长度与原有效期相同。已吊销的令牌不能轮换
+func (s *Service) Rotate(ctx context.Context, userID, id uuid.UUID) (*Token, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := s.now().UTC()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE api_tokens SET
+			token_hash = $3,
+			hint = $4,
+			expires_at = CASE WHEN expires_at IS NULL THEN NULL
+				ELSE $5::timestamp + (expires_at - COALESCE(rotated_at, created_at)) END,
+			rotated_at = $5
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID, hashToken(secret), secret[:hintLength], now)
+	if err != nil {
+		return nil, "", fmt.Errorf("rotate api token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, "", ErrNotFound
+	}
+	token, err := s.get(ctx, userID, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// Revoke 吊销用户的令牌，userID为uuid.Nil时吊销任意用户的令牌（管理员）。重复吊销不报错
+func (s *Service) Revoke(ctx context.Context, userID, id uuid.UUID) error {
+	if _, err := s.get(ctx, userID, id); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`, id, s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("revoke api token: %w", err)
+	}
+	return nil
+}
+
+// ValidateAPIToken 实现auth.APITokenValidator。令牌已吊销或所有者不再是active状态时返回auth.ErrTokenRevoked，
+// 过期返回auth.ErrTokenExpired。校验通过后记录最近使用时间和客户端IP
+func (s *Service) ValidateAPIToken(ctx context.Context, token, clientIP string) (*auth.JWTClaims, error) {
+	var (
+		id, userID           uuid.UUID
+		username, scopes     string
+		status               sql.NullString
+		expiresAt, revokedAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, u.username, t.scopes, u.status, t.expires_at, t.revoked_at
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1`, hashToken(token)).
+		Scan(&id, &userID, &username, &scopes, &status, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	switch {
+	case revokedAt.Valid, status.Valid && status.String != "active":
+		return nil, auth.ErrTokenRevoked
+	case expiresAt.Valid && !now.Before(expiresAt.Time):
+		return nil, auth.ErrTokenExpired
+	}
+
+	// 记录使用情况不影响请求本身
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE api_tokens SET last_used_at = $2, last_used_ip = $3
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $4 OR last_used_ip IS DISTINCT FROM $3)`,
+		id, now, clientIP, now.Add(-usageGranularity))
+	if err != nil {
+		log.Printf("Warning: failed to record use of api token %s: %v", id, err)
+	}
+
+	claims := &auth.JWTClaims{
+		UserID:   userID.String(),
+		Username: username,
+		Scopes:   strings.Split(scopes, ","),
+	}
+	claims.Id = id.String()
+	claims.Subject = userID.String()
+	return claims, nil
+}
+
+// newSecret 生成令牌明文：auth.APITokenPrefix加32字节随机数
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return auth.APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 数据库只保存令牌的摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,349 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// PAXPropertyPrefix tar条目PAX扩展头中携带WebDAV属性的键前缀，
+// 完整键为 "WEBDAV.prop.{namespace}name"（Clark记法），值为属性值
+const PAXPropertyPrefix = "WEBDAV.prop."
+
+// 导入条目结果状态
+const (
+	EntryCreated   = "created"
+	EntryUpdated   = "updated"
+	EntryDirectory = "directory"
+	EntrySkipped   = "skipped"
+	EntryFailed    = "failed"
+)
+
+// IngestEntry 单个tar条目的导入结果
+type IngestEntry struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size,omitempty"`
+	Status     string `json:"status"`
+	Properties int    `json:"properties,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// IngestResult 导入清单
+type IngestResult struct {
+	Target       string        `json:"target"`
+	Entries      []IngestEntry `json:"entries"`
+	FilesWritten int           `json:"files_written"`
+	BytesWritten int64         `json:"bytes_written"`
+	Failed       int           `json:"failed"`
+	Skipped      int           `json:"skipped"`
+}
+
+// PropertyChecker 按PROPPATCH的规则检查要写入一个资源的属性，返回实际保存的属性，由webdav.Handler实现
+type PropertyChecker interface {
+	CheckPropertySets(ctx context.Context, userID, resourcePath string, sets []*webdav.Property) ([]*webdav.Property, error)
+}
+
+// Ingester 流式tar导入服务，面向海量小文件：条目直接写入存储，
+// 属性按批写入，配额在结束时一次性更新
+type Ingester struct {
+	storage    *storage.Service
+	quota      Quota
+	guard      WriteGuard
+	journal    Journal
+	properties *webdav.PropertyService
+	checker    PropertyChecker
+	config     config.ArchiveConfig
+}
+
+// NewIngester 创建tar导入服务，条目经guard检查后写入，PAX扩展头中的属性经checker按PROPPATCH的规则检查后写入
+func NewIngester(storageService *storage.Service, quota Quota, guard WriteGuard, propertyService *webdav.PropertyService, checker PropertyChecker, cfg *config.Config) *Ingester {
+	return &Ingester{
+		storage:    storageService,
+		quota:      quota,
+		guard:      guard,
+		properties: propertyService,
+		checker:    checker,
+		config:     cfg.Archive,
+	}
+}
+
+// SetJournal 设置变更日志，导入写入的文件和目录与WebDAV写入一样推送给订阅的客户端
+func (in *Ingester) SetJournal(journal Journal) {
+	in.journal = journal
+}
+
+// Ingest 读取tar（或tar.gz）流并把条目写入target目录下
+// 流中途损坏时返回已处理部分的清单和错误
+func (in *Ingester) Ingest(ctx context.Context, userID uuid.UUID, target string, body io.Reader) (*IngestResult, error) {
+	target = "/" + strings.Trim(path.Clean("/"+target), "/")
+	result := &IngestResult{Target: target, Entries: []IngestEntry{}}
+
+	// 剩余配额（包括租户配额池）只查询一次，-1表示不限制
+	remaining := in.guard.RemainingQuota(ctx, userID, 0)
+
+	reader, err := decompressIfGzip(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*webdav.DatabaseProperty
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := in.properties.SetPropertiesBatch(ctx, pending)
+		pending = pending[:0]
+		return err
+	}
+
+	// 无论成功与否，已写入的数据都计入配额（只更新一次），客户端中途断开时也要记账；
+	// 覆盖已有文件时只计入新旧大小之差
+	var charged int64
+	defer func() {
+		if charged != 0 {
+			in.quota.UpdateStorageUsed(context.WithoutCancel(ctx), userID, charged)
+		}
+	}()
+
+	batchSize := in.config.IngestBatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	tr := tar.NewReader(reader)
+	quotaExceeded := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, withFlush(fmt.Errorf("read tar: %w", err), flush)
+		}
+
+		if in.config.MaxEntries > 0 && len(result.Entries) >= in.config.MaxEntries {
+			return result, withFlush(ErrTooManyEntries, flush)
+		}
+
+		entry := IngestEntry{Path: header.Name, Size: header.Size}
+		rel, ok := SanitizeEntryName(header.Name)
+		switch {
+		case !ok || rel == "":
+			entry.Status, entry.Error = EntrySkipped, "unsafe entry name"
+		case header.Typeflag == tar.TypeDir:
+			entry.Path = path.Join(target, rel)
+			if created, err := in.putFolder(ctx, userID, entry.Path); err != nil {
+				entry.Status, entry.Error = EntryFailed, err.Error()
+			} else {
+				entry.Status = EntryDirectory
+				if created {
+					recordChange(ctx, in.journal, changes.Change{UserID: userID, Type: changes.TypeCreated, Path: entry.Path})
+				}
+			}
+		case header.Typeflag != tar.TypeReg:
+			// 符号链接、设备文件等不予导入
+			entry.Status, entry.Error = EntrySkipped, "unsupported entry type"
+		case quotaExceeded:
+			entry.Status, entry.Error = EntrySkipped, ErrQuotaExceeded.Error()
+		default:
+			entry.Path = path.Join(target, rel)
+			if err := in.guard.CheckWrite(ctx, userID, entry.Path); err != nil {
+				entry.Status, entry.Error = EntryFailed, err.Error()
+				break
+			}
+			previousSize, overwrite, err := in.previousSize(ctx, userID, entry.Path)
+			if err != nil {
+				entry.Status, entry.Error = EntryFailed, err.Error()
+				break
+			}
+			delta := header.Size - previousSize
+			if remaining >= 0 && delta > remaining {
+				quotaExceeded = true
+				entry.Status, entry.Error = EntrySkipped, ErrQuotaExceeded.Error()
+				break
+			}
+			// 大小来自tar头部，内容不足时写入失败，后端放弃本次写入，被覆盖的原文件保持不变
+			if err := in.putEntry(ctx, userID, entry.Path, tr, header.Size); err != nil {
+				entry.Status, entry.Error = EntryFailed, err.Error()
+				break
+			}
+			entry.Status = EntryCreated
+			changeType := changes.TypeCreated
+			if overwrite {
+				entry.Status, changeType = EntryUpdated, changes.TypeUpdated
+			}
+			recordChange(ctx, in.journal, changes.Change{UserID: userID, Type: changeType, Path: entry.Path})
+			if remaining >= 0 {
+				remaining -= delta
+			}
+			charged += delta
+			result.FilesWritten++
+			result.BytesWritten += header.Size
+		}
+
+		if entry.Status == EntryCreated || entry.Status == EntryUpdated || entry.Status == EntryDirectory {
+			props, err := in.entryProperties(ctx, userID, entry.Path, header.PAXRecords)
+			if err != nil {
+				// 条目已写入，属性按PROPPATCH的原子语义全部不写入
+				entry.Error = "properties rejected: " + err.Error()
+			}
+			entry.Properties = len(props)
+			pending = append(pending, props...)
+			if len(pending) >= batchSize {
+				if err := flush(); err != nil {
+					return result, fmt.Errorf("write properties: %w", err)
+				}
+			}
+		}
+
+		switch entry.Status {
+		case EntryFailed:
+			result.Failed++
+		case EntrySkipped:
+			result.Skipped++
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+
+	if err := flush(); err != nil {
+		return result, fmt.Errorf("write properties: %w", err)
+	}
+	return result, nil
+}
+
+// putEntry 写入单个文件条目，大小来自tar头部，无需额外缓冲
+func (in *Ingester) putEntry(ctx context.Context, userID uuid.UUID, objectPath string, r io.Reader, size int64) error {
+	contentType := mime.TypeByExtension(path.Ext(objectPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return in.storage.PutObject(ctx, userID, objectPath, r, size, contentType)
+}
+
+// putFolder 创建目录条目，已存在的目录保持不变，created表示本次创建了目录
+func (in *Ingester) putFolder(ctx context.Context, userID uuid.UUID, folderPath string) (created bool, err error) {
+	exists, err := in.storage.FolderExists(ctx, userID, folderPath)
+	if err != nil || exists {
+		return false, err
+	}
+	if err := in.guard.CheckWrite(ctx, userID, folderPath); err != nil {
+		return false, err
+	}
+	if err := in.storage.CreateFolder(ctx, userID, folderPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// previousSize 返回被覆盖文件的大小，文件不存在时overwrite为false
+func (in *Ingester) previousSize(ctx context.Context, userID uuid.UUID, objectPath string) (size int64, overwrite bool, err error) {
+	info, err := in.storage.StatObject(ctx, userID, objectPath)
+	if storage.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size, true, nil
+}
+
+// withFlush 在中止导入前写入已收集的属性，属性写入失败时一并返回
+func withFlush(cause error, flush func() error) error {
+	if err := flush(); err != nil {
+		return errors.Join(cause, fmt.Errorf("write properties: %w", err))
+	}
+	return cause
+}
+
+// entryProperties 从PAX扩展头中解析WebDAV属性，并按PROPPATCH的规则检查：
+// 受保护的属性、保留命名空间、命名空间写入规则、值格式和属性数上限，任一属性被拒绝时返回错误
+func (in *Ingester) entryProperties(ctx context.Context, userID uuid.UUID, resourcePath string, records map[string]string) ([]*webdav.DatabaseProperty, error) {
+	sets := parsePAXProperties(userID, resourcePath, records)
+	if len(sets) == 0 {
+		return nil, nil
+	}
+	stored, err := in.checker.CheckPropertySets(ctx, userID.String(), resourcePath, sets)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]*webdav.DatabaseProperty, 0, len(stored))
+	for _, prop := range stored {
+		props = append(props, webdav.PropertyToDatabaseProperty(*prop))
+	}
+	return props, nil
+}
+
+// parsePAXProperties 解析PAX扩展头中 "WEBDAV.prop.{namespace}name" 形式的属性，按名称排序
+func parsePAXProperties(userID uuid.UUID, resourcePath string, records map[string]string) []*webdav.Property {
+	var props []*webdav.Property
+	for key, value := range records {
+		if !strings.HasPrefix(key, PAXPropertyPrefix) {
+			continue
+		}
+		namespace, name, ok := ParseClarkName(strings.TrimPrefix(key, PAXPropertyPrefix))
+		if !ok {
+			continue
+		}
+		props = append(props, &webdav.Property{
+			UserID:     userID.String(),
+			ResourceID: resourcePath,
+			Path:       resourcePath,
+			Name:       name,
+			Namespace:  namespace,
+			Value:      value,
+		})
+	}
+	sort.Slice(props, func(i, j int) bool {
+		return props[i].Namespace+props[i].Name < props[j].Namespace+props[j].Name
+	})
+	return props
+}
+
+// ParseClarkName 解析 "{namespace}name" 形式的属性名，无命名空间时允许只写name
+func ParseClarkName(s string) (namespace, name string, ok bool) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.Index(s, "}")
+		if end < 0 {
+			return "", "", false
+		}
+		namespace, name = s[1:end], s[end+1:]
+	} else {
+		name = s
+	}
+	if name == "" || strings.ContainsAny(name, " :/{}<>") {
+		return "", "", false
+	}
+	return namespace, name, true
+}
+
+// decompressIfGzip 根据魔数自动识别gzip压缩的tar流
+func decompressIfGzip(body io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(body)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		return gz, nil
+	}
+	return br, nil
+}
@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+func TestParseClarkName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		namespace string
+		propName  string
+		ok        bool
+	}{
+		{name: "带命名空间", input: "{http://example.com/ns}author", namespace: "http://example.com/ns", propName: "author", ok: true},
+		{name: "DAV命名空间", input: "{DAV:}displayname", namespace: "DAV:", propName: "displayname", ok: true},
+		{name: "无命名空间", input: "color", propName: "color", ok: true},
+		{name: "空命名空间", input: "{}color", propName: "color", ok: true},
+		{name: "缺少右括号", input: "{http://example.com/ns", ok: false},
+		{name: "缺少属性名", input: "{http://example.com/ns}", ok: false},
+		{name: "非法属性名", input: "{urn:x}a:b", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, name, ok := ParseClarkName(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ParseClarkName(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if namespace != tt.namespace || name != tt.propName {
+				t.Errorf("ParseClarkName(%q) = (%q, %q), want (%q, %q)", tt.input, namespace, name, tt.namespace, tt.propName)
+			}
+		})
+	}
+}
+
+func TestParsePAXProperties(t *testing.T) {
+	userID := uuid.New()
+	records := map[string]string{
+		"WEBDAV.prop.{http://example.com/ns}author": "Alice",
+		"WEBDAV.prop.color":                         "red",
+		"WEBDAV.prop.{urn:x}a:b":                    "invalid name",
+		"SCHILY.xattr.user.comment":                 "not a property",
+		"mtime":                                     "1700000000",
+	}
+
+	props := parsePAXProperties(userID, "/import/a.txt", records)
+	if len(props) != 2 {
+		t.Fatalf("got %d properties, want 2: %+v", len(props), props)
+	}
+	want := []struct{ namespace, name, value string }{
+		{"", "color", "red"},
+		{"http://example.com/ns", "author", "Alice"},
+	}
+	for i, w := range want {
+		p := props[i]
+		if p.Namespace != w.namespace || p.Name != w.name || p.Value != w.value {
+			t.Errorf("property %d = {%s}%s=%q, want {%s}%s=%q", i, p.Namespace, p.Name, p.Value, w.namespace, w.name, w.value)
+		}
+		if p.UserID != userID.String() || p.Path != "/import/a.txt" {
+			t.Errorf("property %d owner = %s %s", i, p.UserID, p.Path)
+		}
+	}
+}
+
+// policyChecker 拒绝保留命名空间中的属性，其余原样保存
+type policyChecker struct {
+	reserved string
+	calls    int
+}
+
+func (c *policyChecker) CheckPropertySets(ctx context.Context, userID, resourcePath string, sets []*webdav.Property) ([]*webdav.Property, error) {
+	c.calls++
+	for _, prop := range sets {
+		if prop.Namespace == c.reserved {
+			return nil, fmt.Errorf("{%s}%s: namespace %s is reserved", prop.Namespace, prop.Name, c.reserved)
+		}
+	}
+	return sets, nil
+}
+
+func TestEntryPropertiesPolicy(t *testing.T) {
+	checker := &policyChecker{reserved: "http://webdav-gateway.org/ns"}
+	in := &Ingester{checker: checker}
+	userID := uuid.New()
+
+	props, err := in.entryProperties(context.Background(), userID, "/import/a.txt", map[string]string{
+		"WEBDAV.prop.{http://example.com/ns}author": "Alice",
+	})
+	if err != nil || len(props) != 1 || props[0].Name != "author" || props[0].UserID != userID.String() {
+		t.Fatalf("allowed property = %+v, %v", props, err)
+	}
+
+	// 任一属性被拒绝时整个条目的属性都不写入
+	props, err = in.entryProperties(context.Background(), userID, "/import/b.txt", map[string]string{
+		"WEBDAV.prop.{http://example.com/ns}author":   "Alice",
+		"WEBDAV.prop.{http://webdav-gateway.org/ns}x": "forged",
+	})
+	if err == nil || len(props) != 0 {
+		t.Fatalf("reserved namespace accepted: %+v, %v", props, err)
+	}
+
+	// 没有属性的条目不做检查
+	checker.calls = 0
+	if props, err := in.entryProperties(context.Background(), userID, "/import/c.txt", map[string]string{"mtime": "1"}); err != nil || props != nil || checker.calls != 0 {
+		t.Errorf("entry without properties = %+v, %v (checker calls %d)", props, err, checker.calls)
+	}
+}
+
+func TestWithFlush(t *testing.T) {
+	cause := errors.New("read tar: unexpected EOF")
+	if err := withFlush(cause, func() error { return nil }); err != cause {
+		t.Errorf("withFlush = %v, want cause unchanged", err)
+	}
+
+	flushErr := errors.New("database is locked")
+	err := withFlush(ErrTooManyEntries, func() error { return flushErr })
+	if !errors.Is(err, ErrTooManyEntries) || !errors.Is(err, flushErr) {
+		t.Errorf("withFlush = %v, want both errors", err)
+	}
+}
+
+func newTestIngester(t *testing.T) (*Ingester, *fakeGuard, uuid.UUID) {
+	t.Helper()
+	store, guard, userID := newTestStore(t)
+	properties, err := webdav.NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { properties.Close() })
+	return NewIngester(store, guard.quota, guard, properties, &policyChecker{}, &config.Config{}), guard, userID
+}
+
+func entryStatuses(result *IngestResult) []string {
+	var statuses []string
+	for _, entry := range result.Entries {
+		statuses = append(statuses, entry.Path+" "+entry.Status)
+	}
+	return statuses
+}
+
+// TestIngestOverwrite 覆盖已有文件记为updated，只计入新旧大小之差，重复导入不增加用量
+func TestIngestOverwrite(t *testing.T) {
+	in, guard, userID := newTestIngester(t)
+	journal := &fakeJournal{}
+	in.SetJournal(journal)
+	ctx := context.Background()
+	archive := buildTar(t, [2]string{"sub/", ""}, [2]string{"a.txt", "abcd"}, [2]string{"sub/b.txt", "123456"}).Bytes()
+
+	result, err := in.Ingest(ctx, userID, "/dst", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/dst/sub directory", "/dst/a.txt updated", "/dst/sub/b.txt created"}
+	if got := entryStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	// 原来的10字节被4字节替换，新增6字节
+	if result.FilesWritten != 2 || result.BytesWritten != 10 || guard.quota.used != 10 {
+		t.Errorf("files %d, bytes %d, storage used %d; want 2, 10, 10", result.FilesWritten, result.BytesWritten, guard.quota.used)
+	}
+
+	result, err = in.Ingest(ctx, userID, "/dst", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"/dst/sub directory", "/dst/a.txt updated", "/dst/sub/b.txt updated"}
+	if got := entryStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("re-ingest entries = %v, want %v", got, want)
+	}
+	if guard.quota.used != 10 {
+		t.Errorf("storage used after re-ingest = %d, want 10", guard.quota.used)
+	}
+	// 已存在的目录不重复记录
+	wantChanges := []string{
+		"created /dst/sub", "updated /dst/a.txt", "created /dst/sub/b.txt",
+		"updated /dst/a.txt", "updated /dst/sub/b.txt",
+	}
+	if !reflect.DeepEqual(journal.changes, wantChanges) {
+		t.Errorf("changes = %v, want %v", journal.changes, wantChanges)
+	}
+	if got := readObject(t, in.storage, userID, "/dst/sub/b.txt"); got != "123456" {
+		t.Errorf("b.txt = %q", got)
+	}
+}
+
+// TestIngestQuota 配额按新旧大小之差检查，超出后之后的文件都被跳过
+func TestIngestQuota(t *testing.T) {
+	in, guard, userID := newTestIngester(t)
+	guard.limit = 25
+
+	// 覆盖10字节的a.txt只需要额外10字节
+	result, err := in.Ingest(context.Background(), userID, "/dst", buildTar(t,
+		[2]string{"a.txt", strings.Repeat("a", 20)},
+		[2]string{"b.txt", strings.Repeat("b", 6)},
+		[2]string{"c.txt", "c"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/dst/a.txt updated", "/dst/b.txt skipped", "c.txt skipped"}
+	if got := entryStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if result.Skipped != 2 || guard.quota.used != 20 {
+		t.Errorf("skipped %d, storage used %d; want 2, 20", result.Skipped, guard.quota.used)
+	}
+}
+
+// TestIngestGuard 只读目录、锁和访问控制拒绝的条目记为failed，不影响其他条目
+func TestIngestGuard(t *testing.T) {
+	in, guard, userID := newTestIngester(t)
+	guard.denied["/dst/a.txt"] = webdav.ErrResourceLocked
+	guard.denied["/dst/sub"] = webdav.ErrReadOnlyFolder
+
+	result, err := in.Ingest(context.Background(), userID, "/dst", buildTar(t,
+		[2]string{"a.txt", "abcd"}, [2]string{"sub/", ""}, [2]string{"c.txt", "c"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/dst/a.txt failed", "/dst/sub failed", "/dst/c.txt created"}
+	if got := entryStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if result.Failed != 2 || result.Entries[0].Error == "" || guard.quota.used != 11 {
+		t.Errorf("result = %+v, storage used %d", result, guard.quota.used)
+	}
+	if got := readObject(t, in.storage, userID, "/dst/a.txt"); got != "0123456789" {
+		t.Errorf("locked file = %q, want it unchanged", got)
+	}
+	if exists, _ := in.storage.FolderExists(context.Background(), userID, "/dst/sub"); exists {
+		t.Error("folder in a read-only folder was created")
+	}
+}
+
+// TestIngestProperties PAX属性随条目写入
+func TestIngestProperties(t *testing.T) {
+	in, _, userID := newTestIngester(t)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name: "p.txt", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"WEBDAV.prop.{http://example.com/ns}author": "Alice"},
+	})
+	tw.Write([]byte("p"))
+	tw.Close()
+
+	result, err := in.Ingest(context.Background(), userID, "/dst", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].Status != EntryCreated || result.Entries[0].Properties != 1 {
+		t.Fatalf("entries = %+v", result.Entries)
+	}
+	prop, err := in.properties.GetProperty(context.Background(), userID.String(), "/dst/p.txt", "http://example.com/ns", "author")
+	if err != nil || prop == nil || prop.Value != "Alice" {
+		t.Errorf("property = %+v, %v", prop, err)
+	}
+}
@@ -0,0 +1,523 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+var (
+	ErrJobNotFound       = errors.New("extraction job not found")
+	ErrUnsupportedFormat = errors.New("unsupported archive format")
+	ErrChecksumMismatch  = errors.New("archive checksum mismatch")
+	ErrArchiveTooLarge   = errors.New("archive exceeds size limit")
+	ErrTooManyEntries    = errors.New("archive has too many entries")
+	ErrQuotaExceeded     = errors.New("storage quota exceeded")
+)
+
+// 解压任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// 支持的归档格式
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+// Job 解压任务及其进度
+type Job struct {
+	ID               string     `json:"id"`
+	UserID           uuid.UUID  `json:"user_id"`
+	Target           string     `json:"target"`
+	Format           string     `json:"format"`
+	Status           string     `json:"status"`
+	TotalEntries     int        `json:"total_entries,omitempty"`
+	ProcessedEntries int        `json:"processed_entries"`
+	BytesWritten     int64      `json:"bytes_written"`
+	Skipped          []string   `json:"skipped,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+// Quota 更新用户的存储用量，由auth.Service实现
+type Quota interface {
+	UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error
+}
+
+// WriteGuard 写入条目前按PUT、MKCOL的规则检查只读目录、锁和访问控制，并计算包括租户配额池在内的剩余配额，
+// 由webdav.WriteGuard实现
+type WriteGuard interface {
+	CheckWrite(ctx context.Context, userID uuid.UUID, resourcePath string) error
+	RemainingQuota(ctx context.Context, userID uuid.UUID, previousSize int64) int64
+}
+
+// Journal 记录解压、导入写入的文件和目录，未启用变更通知时为nil
+type Journal interface {
+	Record(ctx context.Context, change changes.Change) error
+}
+
+// recordChange 写入一条变更，失败只记录日志
+func recordChange(ctx context.Context, journal Journal, change changes.Change) {
+	if journal == nil {
+		return
+	}
+	// 条目已经写入，客户端断开不应使记录失败
+	if err := journal.Record(context.WithoutCancel(ctx), change); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// Service 服务端归档解压服务
+type Service struct {
+	storage *storage.Service
+	quota   Quota
+	guard   WriteGuard
+	journal Journal
+	config  config.ArchiveConfig
+
+	now  func() time.Time
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewService 创建归档解压服务，条目经guard检查后写入
+func NewService(storageService *storage.Service, quota Quota, guard WriteGuard, cfg *config.Config) *Service {
+	return &Service{
+		storage: storageService,
+		quota:   quota,
+		guard:   guard,
+		config:  cfg.Archive,
+		now:     time.Now,
+		jobs:    make(map[string]*Job),
+	}
+}
+
+// SetJournal 设置变更日志，解压写入的文件和目录与WebDAV写入一样推送给订阅的客户端
+func (s *Service) SetJournal(journal Journal) {
+	s.journal = journal
+}
+
+// StartFromUpload 保存上传的归档并启动异步解压；expectedSHA256非空时校验归档完整性
+func (s *Service) StartFromUpload(ctx context.Context, userID uuid.UUID, target string, body io.Reader, expectedSHA256 string) (*Job, error) {
+	file, err := s.spool(body, expectedSHA256)
+	if err != nil {
+		return nil, err
+	}
+	return s.start(userID, target, file)
+}
+
+// StartFromObject 从用户存储中已上传的归档启动异步解压
+func (s *Service) StartFromObject(ctx context.Context, userID uuid.UUID, target, source, expectedSHA256 string) (*Job, error) {
+	obj, err := s.storage.GetObject(ctx, userID, source)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	file, err := s.spool(obj, expectedSHA256)
+	if err != nil {
+		return nil, err
+	}
+	return s.start(userID, target, file)
+}
+
+// GetJob 获取用户的解压任务
+func (s *Service) GetJob(userID uuid.UUID, jobID string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.UserID != userID || s.expired(job) {
+		return nil, ErrJobNotFound
+	}
+
+	snapshot := *job
+	snapshot.Skipped = append([]string(nil), job.Skipped...)
+	return &snapshot, nil
+}
+
+// spool 将归档写入临时文件（ZIP需要随机访问），同时校验大小和SHA-256
+func (s *Service) spool(body io.Reader, expectedSHA256 string) (*os.File, error) {
+	file, err := os.CreateTemp(s.config.TempDir, "extract-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+
+	hash := sha256.New()
+	limit := s.config.MaxUploadSize
+	reader := io.Reader(body)
+	if limit > 0 {
+		reader = io.LimitReader(body, limit+1)
+	}
+
+	n, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err == nil && limit > 0 && n > limit {
+		err = ErrArchiveTooLarge
+	}
+	if err == nil && expectedSHA256 != "" && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), expectedSHA256) {
+		err = ErrChecksumMismatch
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// start 检测格式并在后台执行解压
+func (s *Service) start(userID uuid.UUID, target string, file *os.File) (*Job, error) {
+	format, err := detectFormat(file)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	job := &Job{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Target:    "/" + strings.Trim(path.Clean("/"+target), "/"),
+		Format:    format,
+		Status:    StatusPending,
+		CreatedAt: s.now(),
+	}
+
+	s.mu.Lock()
+	s.evictExpired()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	go s.run(job, file)
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// run 执行解压任务
+func (s *Service) run(job *Job, file *os.File) {
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	s.update(job, func(j *Job) { j.Status = StatusRunning })
+
+	ctx := context.Background()
+	var err error
+	switch job.Format {
+	case FormatZip:
+		err = s.extractZip(ctx, job, file)
+	case FormatTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(file); err == nil {
+			err = s.extractTar(ctx, job, gz)
+		}
+	default:
+		err = s.extractTar(ctx, job, file)
+	}
+
+	now := s.now()
+	s.update(job, func(j *Job) {
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = StatusCompleted
+		}
+	})
+}
+
+// extractZip 解压ZIP归档，读取到条目末尾时archive/zip会校验CRC32
+func (s *Service) extractZip(ctx context.Context, job *Job, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	if s.config.MaxEntries > 0 && len(zr.File) > s.config.MaxEntries {
+		return ErrTooManyEntries
+	}
+	s.update(job, func(j *Job) { j.TotalEntries = len(zr.File) })
+
+	remaining := s.guard.RemainingQuota(ctx, job.UserID, 0)
+	for _, entry := range zr.File {
+		mode := entry.Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			s.skip(job, entry.Name)
+			continue
+		}
+
+		if mode.IsDir() {
+			if err := s.writeDir(ctx, job, entry.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", entry.Name, err)
+		}
+		delta, err := s.writeFile(ctx, job, entry.Name, rc, int64(entry.UncompressedSize64), remaining)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if remaining >= 0 {
+			remaining -= delta
+		}
+	}
+
+	return nil
+}
+
+// extractTar 流式解压TAR归档
+func (s *Service) extractTar(ctx context.Context, job *Job, r io.Reader) error {
+	remaining := s.guard.RemainingQuota(ctx, job.UserID, 0)
+	tr := tar.NewReader(r)
+	entries := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar: %w", err)
+		}
+
+		entries++
+		if s.config.MaxEntries > 0 && entries > s.config.MaxEntries {
+			return ErrTooManyEntries
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := s.writeDir(ctx, job, header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			delta, err := s.writeFile(ctx, job, header.Name, tr, header.Size, remaining)
+			if err != nil {
+				return err
+			}
+			if remaining >= 0 {
+				remaining -= delta
+			}
+		default:
+			// 符号链接、设备文件等不予解压
+			s.skip(job, header.Name)
+		}
+	}
+}
+
+// writeDir 创建目录条目，已存在的目录保持不变
+func (s *Service) writeDir(ctx context.Context, job *Job, name string) error {
+	rel, ok := SanitizeEntryName(name)
+	if !ok {
+		s.skip(job, name)
+		return nil
+	}
+	if rel == "" {
+		return nil
+	}
+
+	folderPath := path.Join(job.Target, rel)
+	exists, err := s.storage.FolderExists(ctx, job.UserID, folderPath)
+	if err != nil {
+		return fmt.Errorf("create folder %s: %w", rel, err)
+	}
+	if !exists {
+		if err := s.guard.CheckWrite(ctx, job.UserID, folderPath); err != nil {
+			return fmt.Errorf("create folder %s: %w", rel, err)
+		}
+		if err := s.storage.CreateFolder(ctx, job.UserID, folderPath); err != nil {
+			return fmt.Errorf("create folder %s: %w", rel, err)
+		}
+		recordChange(ctx, s.journal, changes.Change{UserID: job.UserID, Type: changes.TypeCreated, Path: folderPath})
+	}
+	s.update(job, func(j *Job) { j.ProcessedEntries++ })
+	return nil
+}
+
+// writeFile 写入文件条目，size为条目头部声明的大小，remaining为剩余配额（-1表示不限制）。
+// 返回用量的变化，覆盖已有文件时为新旧大小之差。实际写入量超出配额时读取中途失败，
+// 后端放弃本次写入，被覆盖的原文件保持不变
+func (s *Service) writeFile(ctx context.Context, job *Job, name string, r io.Reader, size, remaining int64) (int64, error) {
+	rel, ok := SanitizeEntryName(name)
+	if !ok || rel == "" {
+		s.skip(job, name)
+		return 0, nil
+	}
+	filePath := path.Join(job.Target, rel)
+
+	if err := s.guard.CheckWrite(ctx, job.UserID, filePath); err != nil {
+		return 0, fmt.Errorf("write %s: %w", rel, err)
+	}
+	var previousSize int64
+	changeType := changes.TypeCreated
+	previous, err := s.storage.StatObject(ctx, job.UserID, filePath)
+	if err == nil {
+		previousSize, changeType = previous.Size, changes.TypeUpdated
+	} else if !storage.IsNotFound(err) {
+		return 0, fmt.Errorf("write %s: %w", rel, err)
+	}
+
+	// 实际写入量同样受剩余配额约束，防止条目头部声明的大小与内容不符
+	limit := int64(-1)
+	if remaining >= 0 {
+		limit = remaining + previousSize
+		if size > limit {
+			return 0, ErrQuotaExceeded
+		}
+	}
+	counter := &countingReader{r: r, limit: limit}
+	contentType := mime.TypeByExtension(path.Ext(rel))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if err := s.storage.ReplaceObject(ctx, job.UserID, filePath, counter, -1, contentType, previous); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			return 0, ErrQuotaExceeded
+		}
+		return 0, fmt.Errorf("write %s: %w", rel, err)
+	}
+
+	delta := counter.n - previousSize
+	if err := s.quota.UpdateStorageUsed(ctx, job.UserID, delta); err != nil {
+		log.Printf("Warning: failed to account extracted file %s: %v", filePath, err)
+	}
+	recordChange(ctx, s.journal, changes.Change{UserID: job.UserID, Type: changeType, Path: filePath})
+	s.update(job, func(j *Job) {
+		j.ProcessedEntries++
+		j.BytesWritten += counter.n
+	})
+	return delta, nil
+}
+
+// skip 记录被跳过的条目
+func (s *Service) skip(job *Job, name string) {
+	s.update(job, func(j *Job) {
+		j.ProcessedEntries++
+		j.Skipped = append(j.Skipped, name)
+	})
+}
+
+// expired 已结束的任务超过保留时间，调用方需持有锁
+func (s *Service) expired(job *Job) bool {
+	return job.FinishedAt != nil && s.now().Sub(*job.FinishedAt) >= s.config.JobRetention
+}
+
+// evictExpired 清理超过保留时间的已结束任务，在创建新任务时调用，调用方需持有写锁
+func (s *Service) evictExpired() {
+	for id, job := range s.jobs {
+		if s.expired(job) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// update 在锁内修改任务状态
+func (s *Service) update(job *Job, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// SanitizeEntryName 规范化归档条目名称，拒绝绝对路径、上级目录引用和控制字符
+// 返回相对于解压目标的路径，ok为false表示条目不安全
+func SanitizeEntryName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || strings.ContainsAny(name, "\x00") {
+		return "", false
+	}
+	if len(name) >= 2 && name[1] == ':' {
+		return "", false // Windows盘符
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+		for _, r := range part {
+			if r < 0x20 || r == 0x7f {
+				return "", false
+			}
+		}
+	}
+
+	cleaned := strings.Trim(path.Clean("/"+name), "/")
+	return cleaned, true
+}
+
+// detectFormat 通过文件头识别归档格式
+func detectFormat(file *os.File) (string, error) {
+	defer file.Seek(0, io.SeekStart)
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(bufio.NewReader(file), header)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return FormatTar, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// countingReader 统计已读取字节数，超过limit（-1表示不限制）时返回ErrQuotaExceeded
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.limit >= 0 && c.n > c.limit {
+		return n, ErrQuotaExceeded
+	}
+	return n, err
+}
@@ -0,0 +1,335 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+func TestSanitizeEntryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		expected string
+		ok       bool
+	}{
+		{name: "普通文件", entry: "docs/readme.txt", expected: "docs/readme.txt", ok: true},
+		{name: "目录条目", entry: "docs/", expected: "docs", ok: true},
+		{name: "当前目录前缀", entry: "./a/./b.txt", expected: "a/b.txt", ok: true},
+		{name: "Windows分隔符", entry: "a\\b.txt", expected: "a/b.txt", ok: true},
+		{name: "根目录条目", entry: "./", expected: "", ok: true},
+		{name: "上级目录引用", entry: "../etc/passwd", ok: false},
+		{name: "中间的上级目录引用", entry: "a/../../b", ok: false},
+		{name: "绝对路径", entry: "/etc/passwd", ok: false},
+		{name: "Windows盘符", entry: "C:/Windows/system.ini", ok: false},
+		{name: "控制字符", entry: "a\x01b.txt", ok: false},
+		{name: "空字节", entry: "a\x00.txt", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SanitizeEntryName(tt.entry)
+			if ok != tt.ok {
+				t.Fatalf("SanitizeEntryName(%q) ok = %v, want %v", tt.entry, ok, tt.ok)
+			}
+			if ok && got != tt.expected {
+				t.Errorf("SanitizeEntryName(%q) = %q, want %q", tt.entry, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	ustar := make([]byte, 512)
+	copy(ustar[257:], "ustar")
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+		wantErr  bool
+	}{
+		{name: "ZIP", content: []byte("PK\x03\x04rest"), expected: FormatZip},
+		{name: "空ZIP", content: []byte("PK\x05\x06rest"), expected: FormatZip},
+		{name: "GZIP压缩的TAR", content: []byte{0x1f, 0x8b, 0x08, 0x00}, expected: FormatTarGz},
+		{name: "TAR", content: ustar, expected: FormatTar},
+		{name: "未知格式", content: []byte("plain text"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.CreateTemp(t.TempDir(), "archive-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if _, err := file.Write(tt.content); err != nil {
+				t.Fatal(err)
+			}
+			file.Seek(0, 0)
+
+			format, err := detectFormat(file)
+			if tt.wantErr {
+				if err != ErrUnsupportedFormat {
+					t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != tt.expected {
+				t.Errorf("detectFormat() = %q, want %q", format, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJobRetention(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewService(nil, nil, nil, &config.Config{Archive: config.ArchiveConfig{JobRetention: time.Hour}})
+	s.now = func() time.Time { return now }
+
+	userID := uuid.New()
+	finishedAt := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	s.jobs = map[string]*Job{
+		"running": {ID: "running", UserID: userID, Status: StatusRunning, CreatedAt: now.Add(-48 * time.Hour)},
+		"recent":  {ID: "recent", UserID: userID, Status: StatusCompleted, FinishedAt: finishedAt(30 * time.Minute)},
+		"expired": {ID: "expired", UserID: userID, Status: StatusFailed, FinishedAt: finishedAt(2 * time.Hour)},
+	}
+
+	for id, want := range map[string]bool{"running": true, "recent": true, "expired": false} {
+		_, err := s.GetJob(userID, id)
+		if (err == nil) != want {
+			t.Errorf("GetJob(%s) error = %v, want found %v", id, err, want)
+		}
+	}
+	if _, err := s.GetJob(uuid.New(), "recent"); err != ErrJobNotFound {
+		t.Errorf("other user's job: %v, want ErrJobNotFound", err)
+	}
+
+	s.mu.Lock()
+	s.evictExpired()
+	s.mu.Unlock()
+	if _, ok := s.jobs["expired"]; ok || len(s.jobs) != 2 {
+		t.Errorf("jobs after eviction = %v", s.jobs)
+	}
+
+	// 保留时间为0时任务结束后立即清理
+	s.config.JobRetention = 0
+	s.mu.Lock()
+	s.evictExpired()
+	s.mu.Unlock()
+	if _, ok := s.jobs["running"]; !ok || len(s.jobs) != 1 {
+		t.Errorf("jobs with zero retention = %v", s.jobs)
+	}
+}
+
+// fakeQuota 记录用量变化
+type fakeQuota struct {
+	used int64
+}
+
+func (q *fakeQuota) UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error {
+	q.used += delta
+	return nil
+}
+
+// fakeGuard 按路径拒绝写入，剩余配额为limit减去已用量
+type fakeGuard struct {
+	quota  *fakeQuota
+	limit  int64
+	denied map[string]error
+}
+
+func (g *fakeGuard) CheckWrite(ctx context.Context, userID uuid.UUID, resourcePath string) error {
+	return g.denied[resourcePath]
+}
+
+func (g *fakeGuard) RemainingQuota(ctx context.Context, userID uuid.UUID, previousSize int64) int64 {
+	return g.limit - g.quota.used + previousSize
+}
+
+// fakeJournal 按顺序记录变更，格式为"类型 路径"
+type fakeJournal struct {
+	changes []string
+}
+
+func (j *fakeJournal) Record(ctx context.Context, change changes.Change) error {
+	j.changes = append(j.changes, change.Type+" "+change.Path)
+	return nil
+}
+
+// newTestStore 本地目录上的存储服务，/dst/a.txt已有10字节内容并已计入用量
+func newTestStore(t *testing.T) (*storage.Service, *fakeGuard, uuid.UUID) {
+	t.Helper()
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	ctx := context.Background()
+	if err := store.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutObject(ctx, userID, "/dst/a.txt", strings.NewReader("0123456789"), 10, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	return store, &fakeGuard{quota: &fakeQuota{used: 10}, limit: 100, denied: map[string]error{}}, userID
+}
+
+// buildTar 按顺序写入条目，以/结尾的名称为目录
+func buildTar(t *testing.T, entries ...[2]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e[0], Mode: 0o644, Size: int64(len(e[1])), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e[0], "/") {
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0o755, 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func readObject(t *testing.T, store *storage.Service, userID uuid.UUID, p string) string {
+	t.Helper()
+	obj, err := store.GetObject(context.Background(), userID, p)
+	if err != nil {
+		t.Fatalf("read %s: %v", p, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestExtractTarOverwrite 覆盖已有文件只按新旧大小之差计入用量，重复解压不增加用量
+func TestExtractTarOverwrite(t *testing.T) {
+	store, guard, userID := newTestStore(t)
+	s := NewService(store, guard.quota, guard, &config.Config{})
+	archive := buildTar(t, [2]string{"sub/", ""}, [2]string{"a.txt", "abcd"}, [2]string{"sub/b.txt", "123456"}).Bytes()
+
+	for i := 0; i < 2; i++ {
+		job := &Job{UserID: userID, Target: "/dst"}
+		if err := s.extractTar(context.Background(), job, bytes.NewReader(archive)); err != nil {
+			t.Fatal(err)
+		}
+		if job.BytesWritten != 10 || job.ProcessedEntries != 3 {
+			t.Errorf("run %d: job = %+v", i, job)
+		}
+		// 原来的10字节被4字节替换，新增6字节
+		if guard.quota.used != 10 {
+			t.Errorf("run %d: storage used = %d, want 10", i, guard.quota.used)
+		}
+	}
+	if got := readObject(t, store, userID, "/dst/a.txt"); got != "abcd" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
+
+// TestExtractQuotaKeepsOriginal 超出配额的覆盖写入失败，原文件和用量保持不变
+func TestExtractQuotaKeepsOriginal(t *testing.T) {
+	store, guard, userID := newTestStore(t)
+	guard.limit = 30
+	s := NewService(store, guard.quota, guard, &config.Config{})
+	ctx := context.Background()
+
+	// 头部声明的大小超出配额，写入前拒绝
+	job := &Job{UserID: userID, Target: "/dst"}
+	err := s.extractTar(ctx, job, buildTar(t, [2]string{"a.txt", strings.Repeat("x", 31)}))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("extract = %v, want ErrQuotaExceeded", err)
+	}
+
+	// 内容比声明的大小长，读取中途超出配额
+	remaining := guard.RemainingQuota(ctx, userID, 0)
+	if _, err := s.writeFile(ctx, job, "a.txt", strings.NewReader(strings.Repeat("x", 31)), 4, remaining); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("writeFile = %v, want ErrQuotaExceeded", err)
+	}
+
+	if got := readObject(t, store, userID, "/dst/a.txt"); got != "0123456789" {
+		t.Errorf("original file = %q, want it unchanged", got)
+	}
+	if guard.quota.used != 10 || job.BytesWritten != 0 {
+		t.Errorf("storage used = %d, bytes written = %d; want 10, 0", guard.quota.used, job.BytesWritten)
+	}
+}
+
+// TestExtractGuard 只读目录、锁和访问控制拒绝的条目不写入，解压失败
+func TestExtractGuard(t *testing.T) {
+	for _, denied := range []string{"/dst/a.txt", "/dst/sub", "/dst/sub/b.txt"} {
+		t.Run(denied, func(t *testing.T) {
+			store, guard, userID := newTestStore(t)
+			guard.denied[denied] = webdav.ErrReadOnlyFolder
+			s := NewService(store, guard.quota, guard, &config.Config{})
+
+			job := &Job{UserID: userID, Target: "/dst"}
+			err := s.extractTar(context.Background(), job, buildTar(t, [2]string{"a.txt", "abcd"}, [2]string{"sub/", ""}, [2]string{"sub/b.txt", "123456"}))
+			if !errors.Is(err, webdav.ErrReadOnlyFolder) {
+				t.Fatalf("extract = %v, want ErrReadOnlyFolder", err)
+			}
+			if denied == "/dst/a.txt" && readObject(t, store, userID, "/dst/a.txt") != "0123456789" {
+				t.Error("denied file was overwritten")
+			}
+			if _, err := store.StatObject(context.Background(), userID, "/dst/sub/b.txt"); !storage.IsNotFound(err) {
+				t.Errorf("entry after the denied one was written: %v", err)
+			}
+		})
+	}
+}
+
+// TestExtractJournal 新建的文件和目录记为created，覆盖的文件记为updated，已存在的目录不记录
+func TestExtractJournal(t *testing.T) {
+	store, guard, userID := newTestStore(t)
+	s := NewService(store, guard.quota, guard, &config.Config{})
+	journal := &fakeJournal{}
+	s.SetJournal(journal)
+	archive := buildTar(t, [2]string{"a.txt", "abcd"}, [2]string{"sub/", ""}, [2]string{"sub/b.txt", "123456"}).Bytes()
+
+	for i := 0; i < 2; i++ {
+		job := &Job{UserID: userID, Target: "/dst"}
+		if err := s.extractTar(context.Background(), job, bytes.NewReader(archive)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"updated /dst/a.txt", "created /dst/sub", "created /dst/sub/b.txt",
+		"updated /dst/a.txt", "updated /dst/sub/b.txt",
+	}
+	if !reflect.DeepEqual(journal.changes, want) {
+		t.Errorf("changes = %v, want %v", journal.changes, want)
+	}
+}
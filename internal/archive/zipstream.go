@@ -0,0 +1,272 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+var (
+	ErrZipPathNotFound     = errors.New("path not found")
+	ErrZipEmptySelection   = errors.New("nothing selected for download")
+	ErrZipTooLarge         = errors.New("selection exceeds zip download limit")
+	ErrTooManyZipDownloads = errors.New("too many concurrent zip downloads")
+)
+
+const (
+	// zipEntryOverhead 单个条目的固定开销：本地文件头30 + 数据描述符24 + 中央目录46 + 两份扩展时间戳9
+	zipEntryOverhead = 30 + 24 + 46 + 2*9
+	// zipEndOverhead 中央目录结束记录（含ZIP64）
+	zipEndOverhead = 22 + 56 + 20
+)
+
+// ZipEntry 打包清单中的一项
+type ZipEntry struct {
+	// Name 归档内的相对路径，目录不带结尾/
+	Name       string
+	ObjectPath string
+	Size       int64
+	Modified   time.Time
+	IsDir      bool
+}
+
+// ZipPlan 打包清单及大小估算
+type ZipPlan struct {
+	Entries   []ZipEntry `json:"-"`
+	Files     int        `json:"files"`
+	Folders   int        `json:"folders"`
+	TotalSize int64      `json:"total_size"`
+	// EstimatedSize 归档大小估算；不压缩时与实际大小基本一致，压缩时为上限
+	EstimatedSize int64 `json:"estimated_size"`
+}
+
+// ZipDownloader 从存储即时读取对象并流式打包为zip，不落盘
+type ZipDownloader struct {
+	storage *storage.Service
+	config  config.ZipDownloadConfig
+
+	mu     sync.Mutex
+	active map[uuid.UUID]int
+}
+
+// NewZipDownloader 创建打包下载服务
+func NewZipDownloader(storageService *storage.Service, cfg *config.Config) *ZipDownloader {
+	return &ZipDownloader{
+		storage: storageService,
+		config:  cfg.Download.Zip,
+		active:  make(map[uuid.UUID]int),
+	}
+}
+
+// Acquire 占用该用户的一个并发名额，下载结束后需调用返回的release
+func (d *ZipDownloader) Acquire(userID uuid.UUID) (func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if limit := d.config.MaxConcurrentPerUser; limit > 0 && d.active[userID] >= limit {
+		return nil, ErrTooManyZipDownloads
+	}
+	d.active[userID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.active[userID]--; d.active[userID] <= 0 {
+				delete(d.active, userID)
+			}
+		})
+	}, nil
+}
+
+// Plan 展开选中的文件和目录，生成打包清单。每个选中项以其名称作为归档内的顶层条目，
+// 重名的顶层条目追加序号
+func (d *ZipDownloader) Plan(ctx context.Context, userID uuid.UUID, paths []string) (*ZipPlan, error) {
+	if len(paths) == 0 {
+		return nil, ErrZipEmptySelection
+	}
+
+	plan := &ZipPlan{}
+	usedNames := make(map[string]bool)
+	for _, p := range paths {
+		objectPath := path.Clean("/" + strings.TrimSpace(p))
+		if objectPath == "/" {
+			if err := d.addFolder(ctx, userID, plan, objectPath, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name := uniqueName(usedNames, path.Base(objectPath))
+
+		info, err := d.storage.StatObject(ctx, userID, objectPath)
+		if err == nil && !strings.HasSuffix(info.Key, "/") {
+			if err := d.addEntry(plan, ZipEntry{
+				Name:       name,
+				ObjectPath: objectPath,
+				Size:       info.Size,
+				Modified:   info.LastModified,
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil && !storage.IsNotFound(err) {
+			return nil, err
+		}
+
+		if err := d.addFolder(ctx, userID, plan, objectPath, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(plan.Entries) == 0 {
+		return nil, ErrZipEmptySelection
+	}
+	plan.EstimatedSize += zipEndOverhead
+	return plan, nil
+}
+
+// addFolder 递归加入目录内容，name为归档内的目录名（根目录为空）
+func (d *ZipDownloader) addFolder(ctx context.Context, userID uuid.UUID, plan *ZipPlan, folderPath, name string) error {
+	found := false
+	if name != "" {
+		if marker, err := d.storage.StatFolder(ctx, userID, folderPath); err == nil {
+			found = true
+			if err := d.addEntry(plan, ZipEntry{Name: name, ObjectPath: folderPath, Modified: marker.LastModified, IsDir: true}); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := d.storage.WalkObjects(ctx, userID, folderPath, true, func(obj minio.ObjectInfo) error {
+		found = true
+		rel, ok := SanitizeEntryName(strings.TrimPrefix("/"+obj.Key, strings.TrimSuffix(folderPath, "/")+"/"))
+		if !ok || rel == "" || rel == "." {
+			log.Printf("Warning: skipping unsafe object key %q in zip download", obj.Key)
+			return nil
+		}
+		return d.addEntry(plan, ZipEntry{
+			Name:       path.Join(name, rel),
+			ObjectPath: "/" + strings.TrimSuffix(obj.Key, "/"),
+			Size:       obj.Size,
+			Modified:   obj.LastModified,
+			IsDir:      strings.HasSuffix(obj.Key, "/"),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if !found && name != "" {
+		return fmt.Errorf("%w: %s", ErrZipPathNotFound, folderPath)
+	}
+	return nil
+}
+
+// addEntry 加入一项并检查数量和大小上限
+func (d *ZipDownloader) addEntry(plan *ZipPlan, entry ZipEntry) error {
+	if entry.IsDir {
+		entry.Size = 0
+		plan.Folders++
+	} else {
+		plan.Files++
+		plan.TotalSize += entry.Size
+	}
+	plan.Entries = append(plan.Entries, entry)
+	plan.EstimatedSize += entry.Size + zipEntryOverhead + 2*int64(len(entry.Name)+1)
+
+	if max := d.config.MaxEntries; max > 0 && len(plan.Entries) > max {
+		return fmt.Errorf("%w: more than %d entries", ErrZipTooLarge, max)
+	}
+	if max := d.config.MaxTotalSize; max > 0 && plan.TotalSize > max {
+		return fmt.Errorf("%w: more than %d bytes", ErrZipTooLarge, max)
+	}
+	return nil
+}
+
+// Write 按清单读取对象并写出zip。打包期间被删除的文件会被跳过；
+// 响应已开始发送，其他错误只能中断输出
+func (d *ZipDownloader) Write(ctx context.Context, userID uuid.UUID, plan *ZipPlan, w io.Writer) error {
+	return d.WriteWithProgress(ctx, userID, plan, w, nil)
+}
+
+// WriteWithProgress 与Write相同，每写完一个条目调用progress报告已处理的条目数
+func (d *ZipDownloader) WriteWithProgress(ctx context.Context, userID uuid.UUID, plan *ZipPlan, w io.Writer, progress func(done int)) error {
+	method := zip.Store
+	if d.config.Compress {
+		method = zip.Deflate
+	}
+
+	zw := zip.NewWriter(w)
+	for i, entry := range plan.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if progress != nil && i > 0 {
+			progress(i)
+		}
+
+		if entry.IsDir {
+			header := &zip.FileHeader{Name: entry.Name + "/", Method: zip.Store, Modified: entry.Modified}
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		obj, err := d.storage.GetObject(ctx, userID, entry.ObjectPath)
+		if err != nil {
+			return err
+		}
+		if _, err := obj.Stat(); err != nil {
+			obj.Close()
+			if storage.IsNotFound(err) {
+				log.Printf("Warning: %s was removed before it could be zipped", entry.ObjectPath)
+				continue
+			}
+			return err
+		}
+
+		header := &zip.FileHeader{Name: entry.Name, Method: method, Modified: entry.Modified}
+		header.SetMode(0o644)
+		fw, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = storage.CopyContext(ctx, fw, obj)
+		}
+		obj.Close()
+		if err != nil {
+			return fmt.Errorf("zip %s: %w", entry.ObjectPath, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(len(plan.Entries))
+	}
+	return nil
+}
+
+// uniqueName 为重名的顶层条目追加序号，如"report (2).pdf"
+func uniqueName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestUniqueName(t *testing.T) {
+	used := make(map[string]bool)
+	names := []string{"report.pdf", "Report.pdf", "report.pdf", "docs", "docs"}
+	expected := []string{"report.pdf", "Report (2).pdf", "report (3).pdf", "docs", "docs (2)"}
+
+	for i, name := range names {
+		if got := uniqueName(used, name); got != expected[i] {
+			t.Errorf("uniqueName(%q) = %q, expected %q", name, got, expected[i])
+		}
+	}
+}
+
+func TestZipDownloaderAcquire(t *testing.T) {
+	d := NewZipDownloader(nil, &config.Config{Download: config.DownloadConfig{
+		Zip: config.ZipDownloadConfig{MaxConcurrentPerUser: 1},
+	}})
+	alice, bob := uuid.New(), uuid.New()
+
+	release, err := d.Acquire(alice)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := d.Acquire(alice); err != ErrTooManyZipDownloads {
+		t.Errorf("第二个并发下载应被拒绝，得到 %v", err)
+	}
+	if _, err := d.Acquire(bob); err != nil {
+		t.Errorf("其他用户不受影响，得到 %v", err)
+	}
+
+	release()
+	release()
+	if _, err := d.Acquire(alice); err != nil {
+		t.Errorf("释放后应可再次下载，得到 %v", err)
+	}
+}
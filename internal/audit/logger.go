@@ -0,0 +1,330 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 审计动作
+const (
+	ActionLogin           = "auth.login"
+	ActionMFAVerify       = "auth.mfa.verify"
+	ActionMFAReset        = "auth.mfa.reset"
+	ActionTokenCreate     = "auth.token.create"
+	ActionTokenRotate     = "auth.token.rotate"
+	ActionTokenRevoke     = "auth.token.revoke"
+	ActionPut             = "webdav.put"
+	ActionPatch           = "webdav.patch"
+	ActionDelete          = "webdav.delete"
+	ActionMove            = "webdav.move"
+	ActionCopy            = "webdav.copy"
+	ActionMkcol           = "webdav.mkcol"
+	ActionLock            = "webdav.lock"
+	ActionUnlock          = "webdav.unlock"
+	ActionShareCreate     = "share.create"
+	ActionShareAccess     = "share.access"
+	ActionShareUpload     = "share.upload"
+	ActionShareDisabled   = "share.disabled"
+	ActionShareDeleted    = "share.deleted"
+	ActionLockRelease     = "lock.force_release"
+	ActionAccountDelete   = "account.delete"
+	ActionAccountRestore  = "account.restore"
+	ActionAccountExport   = "account.export"
+	ActionMigrationCreate = "migration.create"
+)
+
+// 结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// gin.Context中供处理器补充审计信息的键
+const (
+	// ActorKey 未认证请求的操作者，如登录时提交的用户名
+	ActorKey = "audit.actor"
+	// PathKey 操作的资源路径，未设置时使用路由参数path
+	PathKey = "audit.path"
+	// DetailsKey 附加信息，类型为map[string]string
+	DetailsKey = "audit.details"
+)
+
+// batchSize 一次写入的最大事件数
+const batchSize = 100
+
+// Event 一条审计记录
+type Event struct {
+	ID          int64             `json:"id"`
+	Time        time.Time         `json:"time"`
+	UserID      *uuid.UUID        `json:"user_id,omitempty"`
+	Actor       string            `json:"actor"`
+	Action      string            `json:"action"`
+	Path        string            `json:"path,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	ClientIP    string            `json:"client_ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	Result      string            `json:"result"`
+	Status      int               `json:"status,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Logger 将审计事件写入audit_events表。事件先进入缓冲队列由后台批量写入，
+// 队列满时改为同步写入，不会丢弃事件。nil Logger的所有方法都是空操作
+type Logger struct {
+	db     *sql.DB
+	config config.AuditConfig
+	events chan Event
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewLogger 创建审计日志
+func NewLogger(db *sql.DB, cfg config.AuditConfig) *Logger {
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = 1024
+	}
+	return &Logger{
+		db:     db,
+		config: cfg,
+		events: make(chan Event, size),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Initialize 创建审计表
+func (l *Logger) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id BIGSERIAL PRIMARY KEY,
+			occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			user_id UUID,
+			actor VARCHAR(255) NOT NULL DEFAULT '',
+			action VARCHAR(50) NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			destination TEXT NOT NULL DEFAULT '',
+			client_ip VARCHAR(45) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			result VARCHAR(20) NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			details JSONB
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor, occurred_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, occurred_at DESC)`,
+	}
+	for _, stmt := range statements {
+		if _, err := l.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize audit table: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start 启动后台写入和过期清理
+func (l *Logger) Start() {
+	if l == nil {
+		return
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		var purge <-chan time.Time
+		if l.config.Retention > 0 {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			purge = ticker.C
+			l.purge()
+		}
+
+		for {
+			select {
+			case event := <-l.events:
+				l.flush(l.collect(event))
+			case <-purge:
+				l.purge()
+			case <-l.stopCh:
+				// 写完队列中剩余的事件
+				for {
+					select {
+					case event := <-l.events:
+						l.flush(l.collect(event))
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop 写完缓冲中的事件后停止
+func (l *Logger) Stop() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() { close(l.stopCh) })
+	l.wg.Wait()
+}
+
+// Record 记录一个事件
+func (l *Logger) Record(event Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case l.events <- event:
+	default:
+		l.flush([]Event{event})
+	}
+}
+
+// collect 取出队列中已有的事件凑成一批
+func (l *Logger) collect(first Event) []Event {
+	batch := []Event{first}
+	for len(batch) < batchSize {
+		select {
+		case event := <-l.events:
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush 批量写入，失败时把事件写进日志，避免审计记录彻底丢失
+func (l *Logger) flush(batch []Event) {
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO audit_events
+		(occurred_at, user_id, actor, action, path, destination, client_ip, user_agent, result, status, details) VALUES `)
+	args := make([]interface{}, 0, len(batch)*11)
+	for i, e := range batch {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11)
+		var details []byte
+		if len(e.Details) > 0 {
+			details, _ = json.Marshal(e.Details)
+		}
+		args = append(args, e.Time.UTC(), e.UserID, e.Actor, e.Action, e.Path, e.Destination,
+			e.ClientIP, e.UserAgent, e.Result, e.Status, details)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := l.db.ExecContext(ctx, sb.String(), args...); err != nil {
+		log.Printf("Warning: failed to write %d audit events: %v", len(batch), err)
+		for _, e := range batch {
+			log.Printf("Audit: %s actor=%s path=%s result=%s status=%d ip=%s", e.Action, e.Actor, e.Path, e.Result, e.Status, e.ClientIP)
+		}
+	}
+}
+
+// purge 删除超过保留期的事件
+func (l *Logger) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	res, err := l.db.ExecContext(ctx, `DELETE FROM audit_events WHERE occurred_at < $1`, time.Now().UTC().Add(-l.config.Retention))
+	if err != nil {
+		log.Printf("Warning: failed to purge audit events: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Purged %d audit events older than %s", n, l.config.Retention)
+	}
+}
+
+// Query 审计查询条件
+type Query struct {
+	From     *time.Time
+	To       *time.Time
+	Actor    string
+	Action   string
+	BeforeID int64
+	Limit    int
+}
+
+// Search 按时间倒序查询事件，BeforeID用于翻页
+func (l *Logger) Search(ctx context.Context, q Query) ([]Event, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+	if q.From != nil {
+		add("occurred_at >= $%d", q.From.UTC())
+	}
+	if q.To != nil {
+		add("occurred_at < $%d", q.To.UTC())
+	}
+	if q.Actor != "" {
+		add("actor = $%d", q.Actor)
+	}
+	if q.Action != "" {
+		add("action = $%d", q.Action)
+	}
+	if q.BeforeID > 0 {
+		add("id < $%d", q.BeforeID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, q.Limit)
+
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT id, occurred_at, user_id, actor, action, path, destination, client_ip, user_agent, result, status, details
+		FROM audit_events `+where+`
+		ORDER BY id DESC
+		LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var userID uuid.NullUUID
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.Time, &userID, &e.Actor, &e.Action, &e.Path, &e.Destination,
+			&e.ClientIP, &e.UserAgent, &e.Result, &e.Status, &details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if userID.Valid {
+			e.UserID = &userID.UUID
+		}
+		if len(details) > 0 {
+			json.Unmarshal(details, &e.Details)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ResultOf 按HTTP状态码判断结果
+func ResultOf(status int) string {
+	if status >= 400 {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
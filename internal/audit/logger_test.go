@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+)
+
+// openTestDB 打开SQLite测试库并创建audit_events表。Initialize使用的BIGSERIAL在SQLite中不会自增，
+// 这里改用等价的INTEGER PRIMARY KEY
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := demo.OpenDatabase(context.Background(), filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT,
+		actor TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		path TEXT NOT NULL DEFAULT '',
+		destination TEXT NOT NULL DEFAULT '',
+		client_ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		details BLOB
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countEvents(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_events`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestLoggerRecord(t *testing.T) {
+	db := openTestDB(t)
+	l := NewLogger(db, config.AuditConfig{})
+	l.Start()
+
+	userID := uuid.New()
+	l.Record(Event{
+		UserID:      &userID,
+		Actor:       "alice",
+		Action:      ActionMove,
+		Path:        "/docs/a.txt",
+		Destination: "/docs/b.txt",
+		ClientIP:    "192.0.2.1",
+		UserAgent:   "davfs2",
+		Result:      ResultSuccess,
+		Status:      http.StatusCreated,
+		Details:     map[string]string{"api_token": "t1"},
+	})
+	l.Record(Event{Actor: "bob", Action: ActionLogin, Result: ResultFailure, Status: http.StatusUnauthorized})
+	// Stop写完队列中剩余的事件
+	l.Stop()
+	l.Stop()
+
+	events, err := l.Search(context.Background(), Query{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	// 按时间倒序
+	login, move := events[0], events[1]
+	if login.Actor != "bob" || login.UserID != nil || login.Details != nil || login.Result != ResultFailure {
+		t.Errorf("login event = %+v", login)
+	}
+	if move.UserID == nil || *move.UserID != userID {
+		t.Errorf("UserID = %v, want %s", move.UserID, userID)
+	}
+	if move.Action != ActionMove || move.Path != "/docs/a.txt" || move.Destination != "/docs/b.txt" ||
+		move.ClientIP != "192.0.2.1" || move.UserAgent != "davfs2" || move.Status != http.StatusCreated {
+		t.Errorf("move event = %+v", move)
+	}
+	if move.Details["api_token"] != "t1" {
+		t.Errorf("Details = %v", move.Details)
+	}
+	if move.Time.IsZero() || time.Since(move.Time) > time.Minute {
+		t.Errorf("Time = %v, want the recording time", move.Time)
+	}
+}
+
+// TestLoggerRecordQueueFull 队列满时同步写入，不丢弃事件
+func TestLoggerRecordQueueFull(t *testing.T) {
+	db := openTestDB(t)
+	l := NewLogger(db, config.AuditConfig{BufferSize: 1})
+
+	// 后台写入尚未启动，第一个事件留在队列中，第二个直接写入
+	l.Record(Event{Actor: "alice", Action: ActionPut, Result: ResultSuccess})
+	l.Record(Event{Actor: "alice", Action: ActionDelete, Result: ResultSuccess})
+	if n := countEvents(t, db); n != 1 {
+		t.Fatalf("%d events written while the queue is full, want 1", n)
+	}
+
+	l.Start()
+	l.Stop()
+	if n := countEvents(t, db); n != 2 {
+		t.Errorf("%d events written after Stop, want 2", n)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Start()
+	l.Record(Event{Action: ActionPut})
+	l.Stop()
+}
+
+func TestLoggerSearch(t *testing.T) {
+	db := openTestDB(t)
+	l := NewLogger(db, config.AuditConfig{})
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.flush([]Event{
+		{Time: base, Actor: "alice", Action: ActionLogin, Result: ResultSuccess},
+		{Time: base.Add(time.Hour), Actor: "alice", Action: ActionPut, Path: "/a", Result: ResultSuccess},
+		{Time: base.Add(2 * time.Hour), Actor: "bob", Action: ActionPut, Path: "/b", Result: ResultSuccess},
+		{Time: base.Add(3 * time.Hour), Actor: "alice", Action: ActionDelete, Path: "/a", Result: ResultFailure},
+	})
+
+	from, to := base.Add(time.Hour), base.Add(3*time.Hour)
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all", Query{Limit: 10}, []string{ActionDelete, ActionPut, ActionPut, ActionLogin}},
+		{"limit", Query{Limit: 2}, []string{ActionDelete, ActionPut}},
+		{"actor", Query{Actor: "alice", Limit: 10}, []string{ActionDelete, ActionPut, ActionLogin}},
+		{"action", Query{Action: ActionPut, Limit: 10}, []string{ActionPut, ActionPut}},
+		{"actor and action", Query{Actor: "bob", Action: ActionPut, Limit: 10}, []string{ActionPut}},
+		// To不包含边界
+		{"time range", Query{From: &from, To: &to, Limit: 10}, []string{ActionPut, ActionPut}},
+		{"no match", Query{Actor: "carol", Limit: 10}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := l.Search(context.Background(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if events == nil {
+				t.Fatal("Search returned nil, want an empty slice")
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Action)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// BeforeID翻页：两页之间不重复也不遗漏
+	first, err := l.Search(context.Background(), Query{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Search(context.Background(), Query{BeforeID: first[len(first)-1].ID, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 2 || second[0].ID >= first[1].ID || second[1].Action != ActionLogin {
+		t.Errorf("second page = %+v", second)
+	}
+}
+
+func TestResultOf(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusOK:                  ResultSuccess,
+		http.StatusCreated:             ResultSuccess,
+		http.StatusMultiStatus:         ResultSuccess,
+		http.StatusMovedPermanently:    ResultSuccess,
+		http.StatusForbidden:           ResultFailure,
+		http.StatusInsufficientStorage: ResultFailure,
+	} {
+		if got := ResultOf(status); got != want {
+			t.Errorf("ResultOf(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
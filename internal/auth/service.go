@@ -4,26 +4,32 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/webdav-gateway/internal/cryptopolicy"
 	"github.com/webdav-gateway/internal/models"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // JWTClaims JWT令牌声明
 type JWTClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	// Scopes 个人访问令牌的权限范围，会话令牌为空（不受限制）
+	Scopes []string `json:"scopes,omitempty"`
 	jwt.StandardClaims
 }
 
 // AuthService 认证服务
 type AuthService struct {
-	userRepo models.UserRepository
+	userRepo    models.UserRepository
+	clockSkew   time.Duration
+	revocations RevocationChecker
+	apiTokens   APITokenValidator
 }
 
 // NewService 创建认证服务
 func NewService(userRepo models.UserRepository) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		clockSkew: DefaultClockSkew,
 	}
 }
 
@@ -36,7 +42,7 @@ func (s *AuthService) ValidateUser(username, password string) (string, error) {
 	}
 
 	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+	if err := cryptopolicy.ComparePassword(user.Password, password); err != nil {
 		return "", ErrInvalidCredentials
 	}
 
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultClockSkew 默认允许的客户端/服务器时钟偏差
+const DefaultClockSkew = 2 * time.Minute
+
+// 令牌校验错误
+var (
+	ErrTokenInvalid     = Error("invalid token")
+	ErrTokenNotYetValid = Error("token is not valid yet")
+	ErrTokenRevoked     = Error("token has been revoked")
+)
+
+// RevocationChecker 提供用户级的会话撤销时间，早于该时间签发的令牌一律失效；
+// 返回ErrTokenRevoked时该用户的全部令牌失效（如账户已停用）
+type RevocationChecker interface {
+	TokensValidAfter(ctx context.Context, userID string) (time.Time, error)
+}
+
+// SetRevocationChecker 设置会话撤销检查，传入nil时关闭
+func (s *AuthService) SetRevocationChecker(checker RevocationChecker) {
+	s.revocations = checker
+}
+
+// APITokenPrefix 个人访问令牌的前缀，用于与JWT会话令牌区分
+const APITokenPrefix = "wdg_"
+
+// APITokenValidator 校验个人访问令牌并记录最近使用情况
+type APITokenValidator interface {
+	ValidateAPIToken(ctx context.Context, token, clientIP string) (*JWTClaims, error)
+}
+
+// SetAPITokenValidator 设置个人访问令牌校验，传入nil时不接受个人访问令牌
+func (s *AuthService) SetAPITokenValidator(validator APITokenValidator) {
+	s.apiTokens = validator
+}
+
+// ValidateAPIToken 校验个人访问令牌，未开启个人访问令牌时返回ErrTokenInvalid。
+// 个人访问令牌不受会话撤销影响，需要单独吊销
+func (s *AuthService) ValidateAPIToken(ctx context.Context, token, clientIP string) (*JWTClaims, error) {
+	if s.apiTokens == nil {
+		return nil, ErrTokenInvalid
+	}
+	return s.apiTokens.ValidateAPIToken(ctx, token, clientIP)
+}
+
+// SetClockSkew 设置校验exp/nbf/iat时容忍的时钟偏差，小于0时视为0
+func (s *AuthService) SetClockSkew(skew time.Duration) {
+	if skew < 0 {
+		skew = 0
+	}
+	s.clockSkew = skew
+}
+
+// ClockSkew 返回容忍的时钟偏差
+func (s *AuthService) ClockSkew() time.Duration {
+	return s.clockSkew
+}
+
+// ValidateToken 校验JWT令牌签名和有效期，有效期按ClockSkew放宽。
+// 过期返回ErrTokenExpired，签发时间或生效时间在未来返回ErrTokenNotYetValid，
+// 签发于会话撤销之前返回ErrTokenRevoked
+func (s *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodHS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+
+	claims := &JWTClaims{}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(getJWTSecret()), nil
+	})
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := checkTokenTimes(claims, time.Now(), s.clockSkew); err != nil {
+		return nil, err
+	}
+
+	if s.revocations != nil {
+		validAfter, err := s.revocations.TokensValidAfter(context.Background(), claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !validAfter.IsZero() && time.Unix(claims.IssuedAt, 0).Before(validAfter.Truncate(time.Second)) {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// checkTokenTimes 在leeway容差内检查exp、nbf、iat
+func checkTokenTimes(claims *JWTClaims, now time.Time, leeway time.Duration) error {
+	if claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return ErrTokenNotYetValid
+	}
+	if claims.IssuedAt != 0 && now.Add(leeway).Before(time.Unix(claims.IssuedAt, 0)) {
+		return ErrTokenNotYetValid
+	}
+	return nil
+}
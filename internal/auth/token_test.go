@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestCheckTokenTimes(t *testing.T) {
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+	const leeway = 2 * time.Minute
+
+	tests := []struct {
+		name    string
+		claims  jwt.StandardClaims
+		leeway  time.Duration
+		wantErr error
+	}{
+		{"no time claims", jwt.StandardClaims{}, leeway, nil},
+		{"valid", jwt.StandardClaims{IssuedAt: at(-time.Hour), ExpiresAt: at(time.Hour)}, leeway, nil},
+		// 设备时钟偏慢：令牌刚过期但仍在容差内
+		{"expired within leeway", jwt.StandardClaims{ExpiresAt: at(-time.Minute)}, leeway, nil},
+		{"expired at leeway boundary", jwt.StandardClaims{ExpiresAt: at(-leeway)}, leeway, nil},
+		{"expired beyond leeway", jwt.StandardClaims{ExpiresAt: at(-leeway - time.Second)}, leeway, ErrTokenExpired},
+		{"expired without leeway", jwt.StandardClaims{ExpiresAt: at(-time.Second)}, 0, ErrTokenExpired},
+		// 签发服务器时钟偏快：签发时间在未来但仍在容差内
+		{"issued in future within leeway", jwt.StandardClaims{IssuedAt: at(time.Minute)}, leeway, nil},
+		{"issued in future beyond leeway", jwt.StandardClaims{IssuedAt: at(leeway + time.Second)}, leeway, ErrTokenNotYetValid},
+		{"not before within leeway", jwt.StandardClaims{NotBefore: at(leeway)}, leeway, nil},
+		{"not before beyond leeway", jwt.StandardClaims{NotBefore: at(leeway + time.Second)}, leeway, ErrTokenNotYetValid},
+		{"not before without leeway", jwt.StandardClaims{NotBefore: at(time.Second)}, 0, ErrTokenNotYetValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &JWTClaims{StandardClaims: tt.claims}
+			if err := checkTokenTimes(claims, now, tt.leeway); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkTokenTimes = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetClockSkew(t *testing.T) {
+	s := &AuthService{}
+	s.SetClockSkew(-time.Minute)
+	if s.ClockSkew() != 0 {
+		t.Errorf("negative skew = %v, want 0", s.ClockSkew())
+	}
+	s.SetClockSkew(5 * time.Minute)
+	if s.ClockSkew() != 5*time.Minute {
+		t.Errorf("ClockSkew = %v, want 5m", s.ClockSkew())
+	}
+}
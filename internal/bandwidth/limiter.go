@@ -0,0 +1,220 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction 流量方向
+type Direction int
+
+const (
+	// Upload 客户端上传（请求体）
+	Upload Direction = iota
+	// Download 客户端下载（响应体）
+	Download
+)
+
+const (
+	// chunkSize 单次读写的最大字节数，避免大块读写造成突发流量
+	chunkSize = 32 << 10
+	// idleBucketTTL 超过该时长未使用的令牌桶会被回收
+	idleBucketTTL = 10 * time.Minute
+)
+
+// bucketKey 令牌桶按用户和方向区分
+type bucketKey struct {
+	username  string
+	direction Direction
+}
+
+// bucket 允许透支的令牌桶：并发请求按到达顺序排队等待
+type bucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+// reserve 按当前速率扣除n个令牌，返回需要等待的时长
+func (b *bucket) reserve(rate int64, n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	burst := float64(rate)
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(rate)
+	} else {
+		b.tokens = burst
+	}
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.lastUsed = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+}
+
+// idleSince 判断令牌桶是否闲置
+func (b *bucket) idleSince(cutoff time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastUsed.Before(cutoff)
+}
+
+// Limiter 按调度策略对每个用户的上传、下载分别限速，
+// 同一用户的并发连接共享同一个令牌桶
+type Limiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	scheduler *Scheduler
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter 创建限速器
+func NewLimiter(scheduler *Scheduler) *Limiter {
+	return &Limiter{
+		scheduler: scheduler,
+		now:       time.Now,
+		buckets:   make(map[bucketKey]*bucket),
+	}
+}
+
+// SetScheduler 替换调度策略（重新加载配置时），对之后的传输生效，已有令牌桶保留
+func (l *Limiter) SetScheduler(scheduler *Scheduler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scheduler = scheduler
+}
+
+// currentScheduler 返回当前的调度策略
+func (l *Limiter) currentScheduler() *Scheduler {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.scheduler
+}
+
+// Wait 在传输n个字节前等待令牌，不限速时立即返回
+func (l *Limiter) Wait(ctx context.Context, username string, direction Direction, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	now := l.now()
+	rates := l.currentScheduler().Rates(username, now)
+	rate := rates.Upload
+	if direction == Download {
+		rate = rates.Download
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	delay := l.bucket(username, direction, now).reserve(rate, n, now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader 包装请求体，按用户的上传限速读取
+func (l *Limiter) Reader(ctx context.Context, username string, r io.ReadCloser) io.ReadCloser {
+	return &throttledReader{ReadCloser: r, ctx: ctx, limiter: l, username: username}
+}
+
+// Writer 包装响应体，按用户的下载限速写出
+func (l *Limiter) Writer(ctx context.Context, username string, w io.Writer) io.Writer {
+	return &throttledWriter{w: w, ctx: ctx, limiter: l, username: username}
+}
+
+// bucket 获取或创建令牌桶，并顺带回收闲置的令牌桶
+func (l *Limiter) bucket(username string, direction Direction, now time.Time) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		cutoff := now.Add(-idleBucketTTL)
+		for key, b := range l.buckets {
+			if b.idleSince(cutoff) {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	key := bucketKey{username: username, direction: direction}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// throttledReader 限速的请求体
+type throttledReader struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiter  *Limiter
+	username string
+}
+
+// Read 每次最多读取chunkSize字节，读取后扣除令牌
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.Wait(r.ctx, r.username, Upload, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter 限速的响应体
+type throttledWriter struct {
+	w        io.Writer
+	ctx      context.Context
+	limiter  *Limiter
+	username string
+}
+
+// Write 按chunkSize分块等待令牌后写出
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		if err := t.limiter.Wait(t.ctx, t.username, Download, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,142 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestBucketReserve(t *testing.T) {
+	const rate = 1000
+	start := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	// 每一步在上一步之后elapsed时刻扣除n个令牌，want为需要等待的时长
+	type reserveStep struct {
+		elapsed time.Duration
+		n       int
+		want    time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []reserveStep
+	}{
+		{"first use starts full", []reserveStep{{0, 1000, 0}}},
+		{"overdraft waits", []reserveStep{{0, 1000, 0}, {0, 500, 500 * time.Millisecond}}},
+		{"refills over time", []reserveStep{{0, 1000, 0}, {250 * time.Millisecond, 250, 0}, {0, 1, time.Millisecond}}},
+		{"refill capped at burst", []reserveStep{{0, 1000, 0}, {time.Hour, 1500, 500 * time.Millisecond}}},
+		// 并发请求排队：第二个请求要等第一个请求的透支补齐
+		{"queued overdraft accumulates", []reserveStep{{0, 2000, time.Second}, {0, 1000, 2 * time.Second}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{}
+			now := start
+			for i, step := range tt.steps {
+				now = now.Add(step.elapsed)
+				if got := b.reserve(rate, step.n, now); got != step.want {
+					t.Errorf("step %d: reserve(%d) = %v, want %v", i, step.n, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+// newTestLimiter 创建上传限速1000B/s、下载不限速的限速器，时钟固定在now
+func newTestLimiter(t *testing.T, now time.Time) *Limiter {
+	t.Helper()
+	scheduler, err := NewScheduler(config.BandwidthConfig{
+		Timezone:   "UTC",
+		UploadRate: 1000,
+		Users:      map[string]config.BandwidthUserConfig{"admin": {Exempt: true}},
+	})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	l := NewLimiter(scheduler)
+	l.now = func() time.Time { return now }
+	return l
+}
+
+func TestLimiterWait(t *testing.T) {
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		username  string
+		direction Direction
+		n         int
+		wantErr   error
+	}{
+		{"within burst", "alice", Upload, 1000, nil},
+		{"unlimited direction", "alice", Download, 1 << 30, nil},
+		{"exempt user", "admin", Upload, 1 << 30, nil},
+		{"nothing to transfer", "alice", Upload, 0, nil},
+		// 需要等待时请求取消立即返回
+		{"canceled while waiting", "alice", Upload, 5000, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLimiter(t, now)
+			if err := l.Wait(canceled, tt.username, tt.direction, tt.n); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Wait(%s, %d) = %v, want %v", tt.username, tt.n, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLimiterSharedBucket 同一用户的并发连接共享令牌桶，不同用户和方向互不影响
+func TestLimiterSharedBucket(t *testing.T) {
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	l := newTestLimiter(t, now)
+
+	if got := l.bucket("alice", Upload, now).reserve(1000, 1000, now); got != 0 {
+		t.Fatalf("first reservation waited %v", got)
+	}
+	if l.bucket("alice", Upload, now) != l.bucket("alice", Upload, now) {
+		t.Error("same user and direction should share a bucket")
+	}
+	if l.bucket("bob", Upload, now) == l.bucket("alice", Upload, now) {
+		t.Error("users should not share a bucket")
+	}
+	if l.bucket("alice", Download, now) == l.bucket("alice", Upload, now) {
+		t.Error("directions should not share a bucket")
+	}
+
+	// 闲置超过idleBucketTTL的令牌桶被回收
+	later := now.Add(idleBucketTTL + 2*time.Minute)
+	old := l.bucket("alice", Upload, now)
+	l.bucket("carol", Upload, later)
+	if l.bucket("alice", Upload, later) == old {
+		t.Error("idle bucket was not swept")
+	}
+}
+
+func TestThrottledReaderWriter(t *testing.T) {
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+	l := newTestLimiter(t, now)
+	data := bytes.Repeat([]byte("x"), 3*chunkSize+7)
+
+	// 下载不限速：写出全部内容
+	var out bytes.Buffer
+	n, err := l.Writer(context.Background(), "alice", &out).Write(data)
+	if err != nil || n != len(data) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("Write = %d, %v; wrote %d bytes", n, err, out.Len())
+	}
+
+	// 上传每次最多读取chunkSize字节；超出令牌后请求取消时返回已读字节数和取消错误
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := l.Reader(ctx, "alice", io.NopCloser(bytes.NewReader(data)))
+	buf := make([]byte, len(data))
+	n, err = r.Read(buf)
+	if n != chunkSize || !errors.Is(err, context.Canceled) {
+		t.Errorf("Read = %d, %v; want %d, context.Canceled", n, err, chunkSize)
+	}
+}
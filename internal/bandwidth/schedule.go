@@ -0,0 +1,223 @@
+package bandwidth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// minutesPerDay 一天的分钟数
+const minutesPerDay = 24 * 60
+
+// Rates 某一时刻生效的限速，单位为字节/秒，0表示不限速
+type Rates struct {
+	Upload   int64
+	Download int64
+	Window   string
+}
+
+// window 解析后的时间窗口
+type window struct {
+	name     string
+	days     [7]bool
+	start    int
+	end      int
+	upload   int64
+	download int64
+}
+
+// policy 一组默认速率加按顺序匹配的时间窗口
+type policy struct {
+	exempt   bool
+	upload   int64
+	download int64
+	windows  []window
+}
+
+// Scheduler 根据时间窗口和用户覆盖计算当前生效的限速
+type Scheduler struct {
+	loc    *time.Location
+	global policy
+	users  map[string]policy
+}
+
+// NewScheduler 解析带宽调度配置
+func NewScheduler(cfg config.BandwidthConfig) (*Scheduler, error) {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bandwidth timezone %q: %w", cfg.Timezone, err)
+		}
+	}
+
+	global, err := newPolicy(false, cfg.UploadRate, cfg.DownloadRate, cfg.Windows)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]policy, len(cfg.Users))
+	for username, userCfg := range cfg.Users {
+		p, err := newPolicy(userCfg.Exempt, userCfg.UploadRate, userCfg.DownloadRate, userCfg.Windows)
+		if err != nil {
+			return nil, fmt.Errorf("bandwidth policy for user %q: %w", username, err)
+		}
+		// viper会把map键转为小写，用户名统一按小写匹配
+		users[strings.ToLower(username)] = p
+	}
+
+	return &Scheduler{loc: loc, global: global, users: users}, nil
+}
+
+// Rates 返回用户在t时刻生效的限速，第一个命中的时间窗口优先
+func (s *Scheduler) Rates(username string, t time.Time) Rates {
+	p, ok := s.users[strings.ToLower(username)]
+	if !ok {
+		p = s.global
+	}
+	if p.exempt {
+		return Rates{}
+	}
+
+	t = t.In(s.loc)
+	for _, w := range p.windows {
+		if w.contains(t) {
+			return Rates{Upload: w.upload, Download: w.download, Window: w.name}
+		}
+	}
+	return Rates{Upload: p.upload, Download: p.download}
+}
+
+// newPolicy 校验并解析一组策略
+func newPolicy(exempt bool, upload, download int64, windows []config.BandwidthWindow) (policy, error) {
+	if upload < 0 || download < 0 {
+		return policy{}, fmt.Errorf("bandwidth rates must not be negative")
+	}
+
+	p := policy{exempt: exempt, upload: upload, download: download}
+	for i, wc := range windows {
+		w, err := parseWindow(wc)
+		if err != nil {
+			name := wc.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			return policy{}, fmt.Errorf("bandwidth window %s: %w", name, err)
+		}
+		p.windows = append(p.windows, w)
+	}
+	return p, nil
+}
+
+// parseWindow 解析单个时间窗口配置
+func parseWindow(wc config.BandwidthWindow) (window, error) {
+	if wc.UploadRate < 0 || wc.DownloadRate < 0 {
+		return window{}, fmt.Errorf("rates must not be negative")
+	}
+
+	start, err := parseClock(wc.Start)
+	if err != nil {
+		return window{}, err
+	}
+	end, err := parseClock(wc.End)
+	if err != nil {
+		return window{}, err
+	}
+
+	w := window{
+		name:     wc.Name,
+		start:    start,
+		end:      end,
+		upload:   wc.UploadRate,
+		download: wc.DownloadRate,
+	}
+
+	if len(wc.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return w, nil
+	}
+	for _, day := range wc.Days {
+		if err := w.addDay(day); err != nil {
+			return window{}, err
+		}
+	}
+	return w, nil
+}
+
+// addDay 记录窗口生效的星期
+func (w *window) addDay(day string) error {
+	switch strings.ToLower(strings.TrimSpace(day)) {
+	case "sun", "sunday":
+		w.days[time.Sunday] = true
+	case "mon", "monday":
+		w.days[time.Monday] = true
+	case "tue", "tuesday":
+		w.days[time.Tuesday] = true
+	case "wed", "wednesday":
+		w.days[time.Wednesday] = true
+	case "thu", "thursday":
+		w.days[time.Thursday] = true
+	case "fri", "friday":
+		w.days[time.Friday] = true
+	case "sat", "saturday":
+		w.days[time.Saturday] = true
+	case "weekdays":
+		for d := time.Monday; d <= time.Friday; d++ {
+			w.days[d] = true
+		}
+	case "weekend", "weekends":
+		w.days[time.Saturday] = true
+		w.days[time.Sunday] = true
+	default:
+		return fmt.Errorf("unknown day %q", day)
+	}
+	return nil
+}
+
+// contains 判断t是否落在窗口内。跨午夜的窗口按开始那天的星期判断，
+// 例如周五22:00-06:00覆盖到周六早上
+func (w window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+
+	switch {
+	case w.start == w.end:
+		return w.days[today]
+	case w.start < w.end:
+		return w.days[today] && minute >= w.start && minute < w.end
+	default:
+		if minute >= w.start {
+			return w.days[today]
+		}
+		yesterday := (today + 6) % 7
+		return minute < w.end && w.days[yesterday]
+	}
+}
+
+// parseClock 解析HH:MM为当天的分钟数，允许24:00表示午夜
+func parseClock(value string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	hour, err := strconv.Atoi(hh)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	minute, err := strconv.Atoi(mm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	total := hour*60 + minute
+	if hour < 0 || minute < 0 || minute >= 60 || total > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return total % minutesPerDay, nil
+}
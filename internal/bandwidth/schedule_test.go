@@ -0,0 +1,77 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestSchedulerRates(t *testing.T) {
+	scheduler, err := NewScheduler(config.BandwidthConfig{
+		Timezone:     "UTC",
+		UploadRate:   5000,
+		DownloadRate: 6000,
+		Windows: []config.BandwidthWindow{
+			{Name: "business", Days: []string{"weekdays"}, Start: "09:00", End: "18:00", UploadRate: 100, DownloadRate: 200},
+			{Name: "night", Days: []string{"fri"}, Start: "22:00", End: "06:00"},
+		},
+		Users: map[string]config.BandwidthUserConfig{
+			"backup": {UploadRate: 10, DownloadRate: 20},
+			"admin":  {Exempt: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	// 2024-01-05 是周五
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		t        time.Time
+		want     Rates
+	}{
+		{name: "工作时间", username: "alice", t: at(5, 10, 0), want: Rates{Upload: 100, Download: 200, Window: "business"}},
+		{name: "窗口结束时刻不包含", username: "alice", t: at(5, 18, 0), want: Rates{Upload: 5000, Download: 6000}},
+		{name: "周末不命中工作时间", username: "alice", t: at(6, 10, 0), want: Rates{Upload: 5000, Download: 6000}},
+		{name: "跨午夜窗口当天部分", username: "alice", t: at(5, 23, 30), want: Rates{Window: "night"}},
+		{name: "跨午夜窗口次日部分", username: "alice", t: at(6, 5, 59), want: Rates{Window: "night"}},
+		{name: "跨午夜窗口只看开始日", username: "alice", t: at(5, 5, 0), want: Rates{Upload: 5000, Download: 6000}},
+		{name: "用户覆盖替换全局策略", username: "Backup", t: at(5, 10, 0), want: Rates{Upload: 10, Download: 20}},
+		{name: "豁免用户不限速", username: "admin", t: at(5, 10, 0), want: Rates{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scheduler.Rates(tt.username, tt.t); got != tt.want {
+				t.Errorf("Rates(%q, %v) = %+v, want %+v", tt.username, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSchedulerRejectsInvalidWindows(t *testing.T) {
+	tests := []struct {
+		name   string
+		window config.BandwidthWindow
+	}{
+		{name: "未知星期", window: config.BandwidthWindow{Days: []string{"someday"}, Start: "09:00", End: "18:00"}},
+		{name: "时间格式错误", window: config.BandwidthWindow{Start: "9am", End: "18:00"}},
+		{name: "分钟越界", window: config.BandwidthWindow{Start: "09:60", End: "18:00"}},
+		{name: "负速率", window: config.BandwidthWindow{Start: "09:00", End: "18:00", UploadRate: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewScheduler(config.BandwidthConfig{Windows: []config.BandwidthWindow{tt.window}})
+			if err == nil {
+				t.Error("NewScheduler() error = nil, want error")
+			}
+		})
+	}
+}
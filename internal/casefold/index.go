@@ -0,0 +1,224 @@
+// Package casefold 不区分大小写命名空间（webdav.case_insensitive）的名称索引。name_index表为每个对象键
+// 及其各级上级目录保存规范化（小写）键，按索引查找仅大小写不同的已有名称，不必逐级列出目录。
+// 索引由storage.Service在写操作后维护；用户第一次查找时完整遍历一次存储空间建立索引
+package casefold
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// batchSize 每条语句写入或删除的最大键数
+const batchSize = 500
+
+// Fold 返回名称或路径的规范化键，仅大小写不同的名称得到相同的键
+func Fold(name string) string {
+	return strings.ToLower(name)
+}
+
+// Index 名称索引，实现storage.NameIndex
+type Index struct {
+	db      *sql.DB
+	storage *storage.Service
+
+	// built 已确认建立索引的用户，避免每次查找都查询name_index_users
+	built sync.Map
+	// building 每个用户一把锁，同一用户同时只有一个请求遍历存储空间
+	building sync.Map
+}
+
+// NewIndex 创建名称索引
+func NewIndex(db *sql.DB, storageService *storage.Service) *Index {
+	return &Index{db: db, storage: storageService}
+}
+
+// Initialize 创建索引表。object_key为不带结尾/的对象键，目录与文件同样登记
+func (x *Index) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS name_index (
+			user_id TEXT NOT NULL,
+			object_key TEXT NOT NULL,
+			folded_key TEXT NOT NULL,
+			PRIMARY KEY (user_id, object_key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_name_index_folded ON name_index(user_id, folded_key)`,
+		`CREATE TABLE IF NOT EXISTS name_index_users (
+			user_id TEXT PRIMARY KEY,
+			built_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := x.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize name index: %w", err)
+		}
+	}
+	return nil
+}
+
+// withAncestors 返回对象键及其全部上级目录（隐式目录没有标记对象，同样需要登记）
+func withAncestors(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	var all []string
+	for _, key := range keys {
+		for key = strings.Trim(key, "/"); key != "" && key != "." && !seen[key]; key = path.Dir(key) {
+			seen[key] = true
+			all = append(all, key)
+		}
+	}
+	return all
+}
+
+// Add 登记对象键及其上级目录，已登记的键不变
+func (x *Index) Add(ctx context.Context, userID uuid.UUID, keys []string) error {
+	all := withAncestors(keys)
+	for len(all) > 0 {
+		n := min(len(all), batchSize)
+		if err := x.insert(ctx, userID, all[:n]); err != nil {
+			return err
+		}
+		all = all[n:]
+	}
+	return nil
+}
+
+func (x *Index) insert(ctx context.Context, userID uuid.UUID, keys []string) error {
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO name_index (user_id, object_key, folded_key) VALUES `)
+	args := []interface{}{userID.String()}
+	for i, key := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		args = append(args, key, Fold(key))
+		fmt.Fprintf(&sb, "($1, $%d, $%d)", len(args)-1, len(args))
+	}
+	sb.WriteString(` ON CONFLICT (user_id, object_key) DO NOTHING`)
+	if _, err := x.db.ExecContext(ctx, sb.String(), args...); err != nil {
+		return fmt.Errorf("failed to index names: %w", err)
+	}
+	return nil
+}
+
+// Remove 删除对象键，上级目录保留：目录中的对象全部删除后，之后在原位置新建时沿用原来的写法
+func (x *Index) Remove(ctx context.Context, userID uuid.UUID, keys []string) error {
+	for len(keys) > 0 {
+		n := min(len(keys), batchSize)
+		placeholders := make([]string, n)
+		args := []interface{}{userID.String()}
+		for i, key := range keys[:n] {
+			args = append(args, strings.Trim(key, "/"))
+			placeholders[i] = fmt.Sprintf("$%d", i+2)
+		}
+		_, err := x.db.ExecContext(ctx,
+			`DELETE FROM name_index WHERE user_id = $1 AND object_key IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to remove indexed names: %w", err)
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// RemovePrefix 删除目录及其下所有键，prefix为空时删除用户的全部键
+func (x *Index) RemovePrefix(ctx context.Context, userID uuid.UUID, prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+	var err error
+	if prefix == "" {
+		_, err = x.db.ExecContext(ctx, `DELETE FROM name_index WHERE user_id = $1`, userID.String())
+	} else {
+		_, err = x.db.ExecContext(ctx,
+			`DELETE FROM name_index WHERE user_id = $1 AND (object_key = $2 OR substr(object_key, 1, $3) = $4)`,
+			userID.String(), prefix, len(prefix)+1, prefix+"/")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove indexed names: %w", err)
+	}
+	return nil
+}
+
+// Lookup 返回规范化键与requestPath或其任一上级目录相同的全部对象键（不带开头的/），
+// 调用方据此逐级确定实际写法。用户的索引尚未建立时先建立
+func (x *Index) Lookup(ctx context.Context, userID uuid.UUID, requestPath string) ([]string, error) {
+	if err := x.ensure(ctx, userID); err != nil {
+		return nil, err
+	}
+	prefixes := withAncestors([]string{requestPath})
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(prefixes))
+	args := []interface{}{userID.String()}
+	for i, prefix := range prefixes {
+		args = append(args, Fold(prefix))
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+	rows, err := x.db.QueryContext(ctx,
+		`SELECT object_key FROM name_index WHERE user_id = $1 AND folded_key IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up names: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ensure 用户的索引尚未建立时遍历其存储空间建立索引。遍历期间的写操作同样会登记，
+// 遍历与删除同时发生时可能留下已删除的键，其影响只是新建资源沿用了原来的写法
+func (x *Index) ensure(ctx context.Context, userID uuid.UUID) error {
+	if _, ok := x.built.Load(userID); ok {
+		return nil
+	}
+	mu, _ := x.building.LoadOrStore(userID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	if _, ok := x.built.Load(userID); ok {
+		return nil
+	}
+
+	var exists int
+	err := x.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM name_index_users WHERE user_id = $1`, userID.String()).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check name index: %w", err)
+	}
+	if exists == 0 {
+		var batch []string
+		err := x.storage.WalkObjects(ctx, userID, "/", true, func(obj minio.ObjectInfo) error {
+			batch = append(batch, obj.Key)
+			if len(batch) < batchSize {
+				return nil
+			}
+			err := x.Add(ctx, userID, batch)
+			batch = batch[:0]
+			return err
+		})
+		if err != nil && !storage.IsNotFound(err) {
+			return fmt.Errorf("failed to build name index: %w", err)
+		}
+		if err := x.Add(ctx, userID, batch); err != nil {
+			return err
+		}
+		if _, err := x.db.ExecContext(ctx,
+			`INSERT INTO name_index_users (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID.String()); err != nil {
+			return fmt.Errorf("failed to build name index: %w", err)
+		}
+	}
+	x.built.Store(userID, true)
+	return nil
+}
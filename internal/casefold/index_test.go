@@ -0,0 +1,179 @@
+package casefold
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// newTestIndex 本地目录上的存储服务和SQLite上的名称索引，索引尚未接入存储服务
+func newTestIndex(t *testing.T) (*Index, *storage.Service, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := store.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex(db, store)
+	if err := index.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return index, store, userID
+}
+
+func lookup(t *testing.T, index *Index, userID uuid.UUID, p string) []string {
+	t.Helper()
+	keys, err := index.Lookup(context.Background(), userID, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func put(t *testing.T, store *storage.Service, userID uuid.UUID, p string) {
+	t.Helper()
+	if err := store.PutObject(context.Background(), userID, p, strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithAncestors(t *testing.T) {
+	got := withAncestors([]string{"Docs/2024/a.txt", "Docs/b.txt", "/Other/", ""})
+	want := []string{"Docs/2024/a.txt", "Docs/2024", "Docs", "Docs/b.txt", "Other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withAncestors = %q, want %q", got, want)
+	}
+}
+
+// TestIndexBuild 第一次查找时遍历已有对象建立索引，隐式目录也会登记
+func TestIndexBuild(t *testing.T) {
+	ctx := context.Background()
+	index, store, userID := newTestIndex(t)
+	// 接入索引之前写入的对象
+	put(t, store, userID, "/Docs/Report.TXT")
+	put(t, store, userID, "/Docs/sub/a.txt")
+	if err := store.CreateFolder(ctx, userID, "/Empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := lookup(t, index, userID, "/docs/report.txt"), []string{"Docs", "Docs/Report.TXT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup = %q, want %q", got, want)
+	}
+	if got, want := lookup(t, index, userID, "/DOCS/SUB"), []string{"Docs", "Docs/sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup implicit folder = %q, want %q", got, want)
+	}
+	if got, want := lookup(t, index, userID, "/empty/new.txt"), []string{"Empty"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup = %q, want %q", got, want)
+	}
+
+	// 已建立索引的用户不再遍历：绕过索引写入的对象查不到
+	index2 := NewIndex(index.db, store)
+	put(t, store, userID, "/Later.txt")
+	if got := lookup(t, index2, userID, "/later.txt"); len(got) != 0 {
+		t.Errorf("Lookup after build = %q, want the index to be reused", got)
+	}
+
+	// 其他用户的索引互不影响
+	if got := lookup(t, index, uuid.New(), "/docs"); len(got) != 0 {
+		t.Errorf("Lookup for another user = %q", got)
+	}
+}
+
+// TestIndexMaintenance 写操作经由存储服务时同步维护索引
+func TestIndexMaintenance(t *testing.T) {
+	ctx := context.Background()
+	index, store, userID := newTestIndex(t)
+	store.SetNameIndex(index)
+	// 先建立空索引
+	lookup(t, index, userID, "/x")
+
+	put(t, store, userID, "/Photos/2024/IMG_1.jpg")
+	if got, want := lookup(t, index, userID, "/photos/2024/img_1.JPG"), []string{"Photos", "Photos/2024", "Photos/2024/IMG_1.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after PutObject = %q, want %q", got, want)
+	}
+
+	if err := store.MoveObject(ctx, userID, "/Photos/2024/IMG_1.jpg", "/Photos/2024/Beach.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookup(t, index, userID, "/photos/2024/img_1.jpg"), []string{"Photos", "Photos/2024"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after MoveObject = %q, want %q", got, want)
+	}
+	if got := lookup(t, index, userID, "/photos/2024/beach.jpg"); len(got) != 3 {
+		t.Errorf("moved name not indexed: %q", got)
+	}
+
+	if err := store.CreateFolder(ctx, userID, "/Music"); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := store.CopyTree(ctx, userID, "/Photos", "/Backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(t, index, userID, "/backup/2024/BEACH.jpg"); len(got) != 3 {
+		t.Errorf("after CopyTree %q = %q", copied, got)
+	}
+
+	if _, err := store.DeleteFolder(ctx, userID, "/Photos", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(t, index, userID, "/photos/2024/beach.jpg"); len(got) != 0 {
+		t.Errorf("after DeleteFolder = %q, want nothing", got)
+	}
+	if got, want := lookup(t, index, userID, "/music"), []string{"Music"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unrelated folder = %q, want %q", got, want)
+	}
+
+	if _, err := store.DeleteAll(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/music", "/backup/2024/beach.jpg"} {
+		if got := lookup(t, index, userID, p); len(got) != 0 {
+			t.Errorf("after DeleteAll %s = %q", p, got)
+		}
+	}
+}
+
+// TestIndexRemovePrefix 按目录删除时不影响名称以相同字符开头的兄弟目录
+func TestIndexRemovePrefix(t *testing.T) {
+	ctx := context.Background()
+	index, _, userID := newTestIndex(t)
+	lookup(t, index, userID, "/x")
+	if err := index.Add(ctx, userID, []string{"a/b.txt", "ab/c.txt", "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.RemovePrefix(ctx, userID, "a/"); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string][]string{
+		"/a/b.txt": nil,
+		"/ab":      {"ab"},
+		"/a.txt":   {"a.txt"},
+	} {
+		if got := lookup(t, index, userID, p); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q, want %q", p, got, want)
+		}
+	}
+}
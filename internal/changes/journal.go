@@ -0,0 +1,303 @@
+// Package changes 记录用户文件树的变更，并推送给订阅的客户端
+package changes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 变更类型
+const (
+	TypeCreated = "created"
+	TypeUpdated = "updated"
+	TypeDeleted = "deleted"
+	TypeMoved   = "moved"
+	// TypeConflict PUT基于的版本已被修改，内容保存为冲突副本：Path为原文件，Destination为副本
+	TypeConflict = "conflict"
+	// TypeCommented 文件的评论有新增或删除
+	TypeCommented = "commented"
+)
+
+// ConflictCopyKey PUT写入冲突副本时，处理函数在gin上下文中以该键保存副本路径
+const ConflictCopyKey = "webdav.conflict_copy"
+
+// redisChannel 多实例之间转发变更的Redis频道
+const redisChannel = "webdav:changes"
+
+// subscriberBuffer 每个订阅者缓冲的变更数，消费过慢时订阅被关闭，客户端重连后从日志补齐
+const subscriberBuffer = 64
+
+// pruneInterval 清理过期变更的间隔
+const pruneInterval = time.Hour
+
+// Change 一条变更记录，ID在所有用户之间单调递增
+type Change struct {
+	ID          int64     `json:"id"`
+	UserID      uuid.UUID `json:"-"`
+	Type        string    `json:"type"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// redisMessage 通过Redis转发的变更，Change序列化时不含用户ID
+type redisMessage struct {
+	UserID uuid.UUID `json:"user_id"`
+	Change Change    `json:"change"`
+}
+
+// Subscription 一个客户端的变更订阅。C被关闭表示订阅因消费过慢或日志停止而结束
+type Subscription struct {
+	C      <-chan Change
+	ch     chan Change
+	userID uuid.UUID
+}
+
+// Journal 将变更写入change_journal表供断线后补齐，并推送给当前实例上的订阅者。
+// 配置了Redis时变更经Redis发布，每个实例都收到后再推送，订阅者可以连接任意实例
+type Journal struct {
+	db     *sql.DB
+	rdb    *redis.Client
+	config config.EventsConfig
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*Subscription]bool
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewJournal 创建变更日志，rdb为nil时只推送给本实例的订阅者
+func NewJournal(db *sql.DB, rdb *redis.Client, cfg config.EventsConfig) *Journal {
+	return &Journal{
+		db:          db,
+		rdb:         rdb,
+		config:      cfg,
+		subscribers: make(map[uuid.UUID]map[*Subscription]bool),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Initialize 创建变更日志表
+func (j *Journal) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS change_journal (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			path TEXT NOT NULL,
+			destination TEXT NOT NULL DEFAULT '',
+			occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_change_journal_user ON change_journal(user_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_change_journal_occurred_at ON change_journal(occurred_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := j.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize change journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start 启动Redis订阅和过期变更清理
+func (j *Journal) Start() {
+	if j.rdb != nil {
+		pubsub := j.rdb.Subscribe(context.Background(), redisChannel)
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			defer pubsub.Close()
+			messages := pubsub.Channel()
+			for {
+				select {
+				case msg, ok := <-messages:
+					if !ok {
+						return
+					}
+					var m redisMessage
+					if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+						log.Printf("Warning: invalid change notification: %v", err)
+						continue
+					}
+					m.Change.UserID = m.UserID
+					j.deliver(m.Change)
+				case <-j.stopCh:
+					return
+				}
+			}
+		}()
+	}
+
+	if j.config.Retention > 0 {
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			ticker := time.NewTicker(pruneInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := j.prune(context.Background()); err != nil {
+						log.Printf("Warning: failed to prune change journal: %v", err)
+					}
+				case <-j.stopCh:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop 停止后台任务并关闭所有订阅
+func (j *Journal) Stop() {
+	j.stopOnce.Do(func() { close(j.stopCh) })
+	j.wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for userID, subs := range j.subscribers {
+		for sub := range subs {
+			close(sub.ch)
+		}
+		delete(j.subscribers, userID)
+	}
+}
+
+// Record 写入一条变更并通知订阅者
+func (j *Journal) Record(ctx context.Context, change Change) error {
+	err := j.db.QueryRowContext(ctx, `
+		INSERT INTO change_journal (user_id, type, path, destination)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, occurred_at`,
+		change.UserID, change.Type, change.Path, change.Destination).Scan(&change.ID, &change.Time)
+	if err != nil {
+		return fmt.Errorf("failed to record change: %w", err)
+	}
+
+	if j.rdb == nil {
+		j.deliver(change)
+		return nil
+	}
+	payload, err := json.Marshal(redisMessage{UserID: change.UserID, Change: change})
+	if err != nil {
+		return err
+	}
+	if err := j.rdb.Publish(ctx, redisChannel, payload).Err(); err != nil {
+		// 其他实例的订阅者会在重连时从日志补齐
+		log.Printf("Warning: failed to publish change %d: %v", change.ID, err)
+		j.deliver(change)
+	}
+	return nil
+}
+
+// Since 按顺序返回用户ID大于afterID的变更，最多limit条
+func (j *Journal) Since(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]Change, error) {
+	rows, err := j.db.QueryContext(ctx, `
+		SELECT id, type, path, destination, occurred_at
+		FROM change_journal
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []Change{}
+	for rows.Next() {
+		change := Change{UserID: userID}
+		if err := rows.Scan(&change.ID, &change.Type, &change.Path, &change.Destination, &change.Time); err != nil {
+			return nil, fmt.Errorf("failed to scan change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// Pruned 判断afterID之后的变更是否可能已超过保留期被清理，此时无法完整补发
+func (j *Journal) Pruned(ctx context.Context, afterID int64) (bool, error) {
+	var oldest int64
+	err := j.db.QueryRowContext(ctx, `SELECT COALESCE(MIN(id), 0) FROM change_journal`).Scan(&oldest)
+	if err != nil {
+		return false, fmt.Errorf("failed to read oldest change: %w", err)
+	}
+	return oldest > afterID+1, nil
+}
+
+// LatestID 返回用户最新一条变更的ID，没有变更时返回0
+func (j *Journal) LatestID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var id int64
+	err := j.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM change_journal WHERE user_id = $1`, userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read latest change: %w", err)
+	}
+	return id, nil
+}
+
+// Subscribe 订阅用户的变更，使用完毕后调用Unsubscribe
+func (j *Journal) Subscribe(userID uuid.UUID) *Subscription {
+	ch := make(chan Change, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, userID: userID}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.subscribers[userID] == nil {
+		j.subscribers[userID] = make(map[*Subscription]bool)
+	}
+	j.subscribers[userID][sub] = true
+	return sub
+}
+
+// Unsubscribe 取消订阅，可以重复调用
+func (j *Journal) Unsubscribe(sub *Subscription) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.remove(sub)
+}
+
+// remove 移除并关闭订阅，调用方需持有mu
+func (j *Journal) remove(sub *Subscription) {
+	subs := j.subscribers[sub.userID]
+	if !subs[sub] {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(j.subscribers, sub.userID)
+	}
+	close(sub.ch)
+}
+
+// deliver 推送给本实例上该用户的订阅者，缓冲已满的订阅被关闭
+func (j *Journal) deliver(change Change) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for sub := range j.subscribers[change.UserID] {
+		select {
+		case sub.ch <- change:
+		default:
+			j.remove(sub)
+		}
+	}
+}
+
+// prune 删除超过保留期的变更
+func (j *Journal) prune(ctx context.Context) error {
+	_, err := j.db.ExecContext(ctx, `
+		DELETE FROM change_journal
+		WHERE occurred_at <= NOW() - $1 * INTERVAL '1 second'`,
+		j.config.Retention.Seconds())
+	return err
+}
@@ -0,0 +1,58 @@
+package changes
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestJournalDeliver(t *testing.T) {
+	j := NewJournal(nil, nil, config.EventsConfig{})
+	alice, bob := uuid.New(), uuid.New()
+
+	sub := j.Subscribe(alice)
+	other := j.Subscribe(bob)
+	defer j.Unsubscribe(other)
+
+	j.deliver(Change{ID: 1, UserID: alice, Type: TypeCreated, Path: "/a.txt"})
+	j.deliver(Change{ID: 2, UserID: bob, Type: TypeDeleted, Path: "/b.txt"})
+
+	if change := <-sub.C; change.ID != 1 || change.Path != "/a.txt" {
+		t.Errorf("alice received %+v, want change 1", change)
+	}
+	select {
+	case change := <-sub.C:
+		t.Errorf("alice received another user's change %+v", change)
+	default:
+	}
+
+	j.Unsubscribe(sub)
+	j.Unsubscribe(sub)
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription channel still open after Unsubscribe")
+	}
+}
+
+func TestJournalDropsSlowSubscriber(t *testing.T) {
+	j := NewJournal(nil, nil, config.EventsConfig{})
+	userID := uuid.New()
+	sub := j.Subscribe(userID)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		j.deliver(Change{ID: int64(i + 1), UserID: userID, Type: TypeUpdated, Path: "/a.txt"})
+	}
+
+	// 缓冲中的变更仍可读出，之后通道关闭，客户端需重连补齐
+	received := 0
+	for range sub.C {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d changes before close, want %d", received, subscriberBuffer)
+	}
+	if len(j.subscribers) != 0 {
+		t.Errorf("slow subscriber still registered")
+	}
+}
@@ -0,0 +1,281 @@
+// Package comments 文件评论：评论按稳定文件ID保存，文件移动、改名后仍然关联到同一个文件
+package comments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// 错误定义
+var (
+	ErrFileNotFound   = Error("file not found")
+	ErrNoFileID       = Error("file has no stable id, upload it again to enable comments")
+	ErrNotFound       = Error("comment not found")
+	ErrParentNotFound = Error("parent comment not found")
+	ErrEmpty          = Error("comment must not be empty")
+	ErrTooLong        = Error("comment is too long")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// PropertyStore 维护PROPFIND中返回的评论数，未开启comments.count_property时为nil
+type PropertyStore interface {
+	SetCommentCount(ctx context.Context, userID, path string, count int) error
+}
+
+// Journal 评论变化时通知订阅变更的客户端，未启用变更通知时为nil
+type Journal interface {
+	Record(ctx context.Context, change changes.Change) error
+}
+
+// Service 管理用户文件上的评论
+type Service struct {
+	db         *sql.DB
+	storage    *storage.Service
+	properties PropertyStore
+	journal    Journal
+	config     config.CommentsConfig
+}
+
+// NewService 创建评论服务，properties、journal为nil时不更新评论数属性、不发送通知
+func NewService(db *sql.DB, storageService *storage.Service, properties PropertyStore, journal Journal, cfg config.CommentsConfig) *Service {
+	return &Service{
+		db:         db,
+		storage:    storageService,
+		properties: properties,
+		journal:    journal,
+		config:     cfg,
+	}
+}
+
+// Initialize 创建评论表
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS file_comments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			file_id TEXT NOT NULL,
+			parent_id UUID REFERENCES file_comments(id) ON DELETE CASCADE,
+			author_id UUID NOT NULL,
+			author_name VARCHAR(255) NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			deleted_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_comments_file ON file_comments(user_id, file_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_comments_parent ON file_comments(parent_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize comment tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveFile 返回文件的规范路径和稳定文件ID。只能评论文件，目录和不存在的路径返回ErrFileNotFound
+func (s *Service) resolveFile(ctx context.Context, userID uuid.UUID, filePath string) (string, string, error) {
+	filePath = davpath.Clean(filePath)
+	info, err := s.storage.StatObject(ctx, userID, filePath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return "", "", ErrFileNotFound
+		}
+		return "", "", err
+	}
+	fileID := storage.FileID(*info)
+	if fileID == "" {
+		return "", "", ErrNoFileID
+	}
+	return filePath, fileID, nil
+}
+
+// List 返回文件的评论，按讨论串组织，同一层按创建时间排序
+func (s *Service) List(ctx context.Context, userID uuid.UUID, filePath string) ([]*models.Comment, error) {
+	_, fileID, err := s.resolveFile(ctx, userID, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, parent_id, author_id, author_name, body, deleted_at IS NOT NULL, created_at
+		FROM file_comments
+		WHERE user_id = $1 AND file_id = $2
+		ORDER BY created_at, id`, userID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*models.Comment
+	for rows.Next() {
+		comment := &models.Comment{}
+		var parentID uuid.NullUUID
+		if err := rows.Scan(&comment.ID, &parentID, &comment.AuthorID, &comment.AuthorName, &comment.Body,
+			&comment.Deleted, &comment.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		if parentID.Valid {
+			comment.ParentID = &parentID.UUID
+		}
+		list = append(list, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	return buildThreads(list), nil
+}
+
+// buildThreads 把按创建时间排序的评论组织成讨论串，父评论已不存在的回复作为顶层评论
+func buildThreads(list []*models.Comment) []*models.Comment {
+	byID := make(map[uuid.UUID]*models.Comment, len(list))
+	for _, comment := range list {
+		byID[comment.ID] = comment
+	}
+	threads := []*models.Comment{}
+	for _, comment := range list {
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, comment)
+				continue
+			}
+		}
+		threads = append(threads, comment)
+	}
+	return threads
+}
+
+// Create 在文件上添加评论，ParentID非空时作为该评论的回复
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, username, filePath string, req *models.CreateCommentRequest) (*models.Comment, error) {
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return nil, ErrEmpty
+	}
+	if s.config.MaxLength > 0 && utf8.RuneCountInString(body) > s.config.MaxLength {
+		return nil, ErrTooLong
+	}
+	filePath, fileID, err := s.resolveFile(ctx, userID, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ParentID != nil {
+		var exists bool
+		err := s.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM file_comments WHERE id = $1 AND user_id = $2 AND file_id = $3 AND deleted_at IS NULL)`,
+			*req.ParentID, userID, fileID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check parent comment: %w", err)
+		}
+		if !exists {
+			return nil, ErrParentNotFound
+		}
+	}
+
+	comment := &models.Comment{ParentID: req.ParentID, AuthorID: userID, AuthorName: username, Body: body}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO file_comments (user_id, file_id, parent_id, author_id, author_name, body)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		userID, fileID, req.ParentID, userID, username, body).Scan(&comment.ID, &comment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	s.changed(ctx, userID, filePath, fileID)
+	return comment, nil
+}
+
+// Delete 删除评论。有回复的评论保留为占位，讨论串不被打断；删除最后一个回复时一并清理已删除的父评论
+func (s *Service) Delete(ctx context.Context, userID uuid.UUID, filePath string, id uuid.UUID) error {
+	filePath, fileID, err := s.resolveFile(ctx, userID, filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var parentID uuid.NullUUID
+	var hasReplies bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT parent_id, EXISTS(SELECT 1 FROM file_comments r WHERE r.parent_id = c.id)
+		FROM file_comments c
+		WHERE id = $1 AND user_id = $2 AND file_id = $3 AND deleted_at IS NULL
+		FOR UPDATE`, id, userID, fileID).Scan(&parentID, &hasReplies)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	if hasReplies {
+		_, err = tx.ExecContext(ctx, `UPDATE file_comments SET body = '', deleted_at = NOW() WHERE id = $1`, id)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM file_comments WHERE id = $1`, id)
+		// 逐级清理已删除且不再有回复的祖先
+		for err == nil && parentID.Valid {
+			var next uuid.NullUUID
+			err = tx.QueryRowContext(ctx, `
+				DELETE FROM file_comments
+				WHERE id = $1 AND deleted_at IS NOT NULL
+					AND NOT EXISTS (SELECT 1 FROM file_comments r WHERE r.parent_id = $1)
+				RETURNING parent_id`, parentID.UUID).Scan(&next)
+			if err == sql.ErrNoRows {
+				err = nil
+				break
+			}
+			parentID = next
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	s.changed(ctx, userID, filePath, fileID)
+	return nil
+}
+
+// changed 评论变化后更新评论数属性并通知订阅的客户端。评论已经保存，这里的失败只记录日志
+func (s *Service) changed(ctx context.Context, userID uuid.UUID, filePath, fileID string) {
+	ctx = context.WithoutCancel(ctx)
+	if s.properties != nil {
+		var count int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM file_comments WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NULL`,
+			userID, fileID).Scan(&count)
+		if err == nil {
+			err = s.properties.SetCommentCount(ctx, userID.String(), filePath, count)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to update comment count for %s: %v", filePath, err)
+		}
+	}
+	if s.journal != nil {
+		change := changes.Change{UserID: userID, Type: changes.TypeCommented, Path: filePath}
+		if err := s.journal.Record(ctx, change); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package comments
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+func TestBuildThreads(t *testing.T) {
+	root := &models.Comment{ID: uuid.New(), Body: "first"}
+	reply := &models.Comment{ID: uuid.New(), ParentID: &root.ID, Body: "reply"}
+	nested := &models.Comment{ID: uuid.New(), ParentID: &reply.ID, Body: "nested"}
+	second := &models.Comment{ID: uuid.New(), Body: "second"}
+	missing := uuid.New()
+	orphan := &models.Comment{ID: uuid.New(), ParentID: &missing, Body: "orphan"}
+
+	threads := buildThreads([]*models.Comment{root, reply, second, nested, orphan})
+	if len(threads) != 3 || threads[0] != root || threads[1] != second || threads[2] != orphan {
+		t.Fatalf("top-level comments = %v", threads)
+	}
+	if len(root.Replies) != 1 || root.Replies[0] != reply {
+		t.Errorf("root replies = %v", root.Replies)
+	}
+	if len(reply.Replies) != 1 || reply.Replies[0] != nested {
+		t.Errorf("nested replies = %v", reply.Replies)
+	}
+	if threads := buildThreads(nil); threads == nil || len(threads) != 0 {
+		t.Errorf("buildThreads(nil) = %v, want an empty list", threads)
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,12 +13,36 @@ import (
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Auth     AuthConfig     `mapstructure:"auth"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Cache    CacheConfig    `mapstructure:"cache"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	Storage    StorageConfig    `mapstructure:"storage"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Cache      CacheConfig      `mapstructure:"cache"`
+	Logging    LoggingConfig    `mapstructure:"logging"`
+	WebDAV     WebDAVConfig     `mapstructure:"webdav"`
+	Archive    ArchiveConfig    `mapstructure:"archive"`
+	Properties PropertiesConfig `mapstructure:"properties"`
+	Download   DownloadConfig   `mapstructure:"download"`
+	Bandwidth  BandwidthConfig  `mapstructure:"bandwidth"`
+	Crypto     CryptoConfig     `mapstructure:"crypto"`
+	Search     SearchConfig     `mapstructure:"search"`
+	Share      ShareConfig      `mapstructure:"share"`
+	Mirror     MirrorConfig     `mapstructure:"mirror"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
+	Audit      AuditConfig      `mapstructure:"audit"`
+	Quota      QuotaConfig      `mapstructure:"quota"`
+	Events     EventsConfig     `mapstructure:"events"`
+	Health     HealthConfig     `mapstructure:"health"`
+	CORS       CORSConfig       `mapstructure:"cors"`
+	Batch      BatchConfig      `mapstructure:"batch"`
+	Jobs       JobsConfig       `mapstructure:"jobs"`
+	Tenancy    TenancyConfig    `mapstructure:"tenancy"`
+	Account    AccountConfig    `mapstructure:"account"`
+	Migration  MigrationConfig  `mapstructure:"migration"`
+	Uploads    UploadsConfig    `mapstructure:"uploads"`
+	Comments   CommentsConfig   `mapstructure:"comments"`
+	Tags       TagsConfig       `mapstructure:"tags"`
+	Media      MediaConfig      `mapstructure:"media"`
 }
 
 // ServerConfig 服务器配置
@@ -25,6 +51,131 @@ type ServerConfig struct {
 	Mode        string        `mapstructure:"mode"`
 	ReadTimeout time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// IdleTimeout keep-alive连接（包括HTTP/2连接）空闲多久后关闭
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// ReadHeaderTimeout 读取请求头的超时，慢速客户端不能长时间占用连接
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// MaxConnections 同时打开的连接数上限，超出的连接在系统的accept队列中等待，0表示不限制
+	MaxConnections int `mapstructure:"max_connections"`
+	// HTTP2 HTTP/2设置
+	HTTP2 HTTP2Config `mapstructure:"http2"`
+	// TLS 由网关直接提供HTTPS时的证书和协议策略
+	TLS TLSConfig `mapstructure:"tls"`
+	// Limits 请求体大小上限和按方法的超时
+	Limits RequestLimitsConfig `mapstructure:"limits"`
+	// Shutdown 收到SIGTERM后的停机等待
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	// Compression XML、JSON等响应的压缩
+	Compression CompressionConfig `mapstructure:"compression"`
+}
+
+// CompressionConfig 响应压缩配置。按Accept-Encoding协商gzip或deflate，只压缩Types中的类型；
+// 文件下载（带Accept-Ranges、Content-Range或Content-Disposition的响应）不压缩
+type CompressionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinSize 响应体小于该字节数时不压缩
+	MinSize int `mapstructure:"min_size"`
+	// Level 压缩级别1~9，0表示默认级别
+	Level int `mapstructure:"level"`
+	// Types 压缩的Content-Type，另外所有+xml、+json结尾的类型也会压缩
+	Types []string `mapstructure:"types"`
+}
+
+// ShutdownConfig 优雅停机配置。停机开始后新的写请求返回503，就绪检查失败，
+// 已有请求在Timeout内完成；仍有上传或下载进行中时继续等待，最长到MaxDrain
+type ShutdownConfig struct {
+	// Timeout 等待进行中请求完成的时间，0表示30秒
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxDrain 有传输进行中时停机等待的上限，不小于Timeout；0表示不额外等待
+	MaxDrain time.Duration `mapstructure:"max_drain"`
+}
+
+// HTTP2Config HTTP/2配置。启用TLS时通过ALPN协商，同步客户端的大量小请求可以复用一个连接
+type HTTP2Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxConcurrentStreams 每个连接同时处理的请求数
+	MaxConcurrentStreams uint32 `mapstructure:"max_concurrent_streams"`
+	// H2C 未启用TLS时接受明文HTTP/2（h2c），用于反向代理以HTTP/2连接网关
+	H2C bool `mapstructure:"h2c"`
+}
+
+// RequestLimitsConfig 请求体大小上限和按方法的超时，超大请求在读取请求体之前就被拒绝
+type RequestLimitsConfig struct {
+	// MaxUploadSize WebDAV PUT请求体的最大字节数，0表示不限制（仍受配额限制）
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+	// MaxBodySize 其他WebDAV请求（PROPFIND、PROPPATCH、LOCK等XML请求体）的最大字节数，0表示不限制
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+	// RequireContentLength 拒绝没有Content-Length的PUT（411），关闭时分块上传边读取边检查大小
+	RequireContentLength bool `mapstructure:"require_content_length"`
+	// Users 按用户覆盖MaxUploadSize，用户名区分大小写
+	Users []UserUploadLimit `mapstructure:"users"`
+	// Timeouts 按请求方法（如put、propfind）设置的读写超时，覆盖read_timeout、write_timeout和下面的分类超时
+	Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+	// MetadataTimeout 元数据请求（PROPFIND、PROPPATCH、OPTIONS、HEAD、MKCOL、LOCK、UNLOCK、REPORT、SEARCH等）的读写超时，
+	// 0表示使用read_timeout和write_timeout
+	MetadataTimeout time.Duration `mapstructure:"metadata_timeout"`
+	// TransferTimeout 传输和可能耗时较长的请求（GET、PUT、PATCH、POST、COPY、MOVE、DELETE）的读写超时，
+	// 0表示使用read_timeout和write_timeout
+	TransferTimeout time.Duration `mapstructure:"transfer_timeout"`
+}
+
+// UserUploadLimit 单个用户的上传大小上限
+type UserUploadLimit struct {
+	Username string `mapstructure:"username"`
+	// MaxUploadSize 0表示该用户不限制
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+}
+
+// TLSConfig TLS配置
+type TLSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CertFile、KeyFile 证书和私钥文件，启用ACME时不需要
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// MinVersion 最低协议版本：1.2或1.3
+	MinVersion string `mapstructure:"min_version"`
+	// CipherSuites TLS 1.2套件名称，如TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，为空时使用默认值
+	CipherSuites []string `mapstructure:"cipher_suites"`
+	// ACME 通过ACME（Let's Encrypt）自动申请和续期证书
+	ACME ACMEConfig `mapstructure:"acme"`
+	// RedirectAddress 明文HTTP监听地址（如:80），请求重定向到HTTPS，启用ACME时同时响应HTTP-01验证，为空时不监听
+	RedirectAddress string `mapstructure:"redirect_address"`
+	// HSTS Strict-Transport-Security响应头
+	HSTS HSTSConfig `mapstructure:"hsts"`
+}
+
+// ACMEConfig ACME自动证书配置
+type ACMEConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Domains 申请证书的域名，其他域名的TLS握手会被拒绝
+	Domains []string `mapstructure:"domains"`
+	// Email 证书到期和吊销通知的联系邮箱
+	Email string `mapstructure:"email"`
+	// CacheDir 账户密钥和证书的保存目录，多副本部署时应使用共享存储
+	CacheDir string `mapstructure:"cache_dir"`
+	// DirectoryURL ACME服务地址，为空时使用Let's Encrypt正式环境
+	DirectoryURL string `mapstructure:"directory_url"`
+}
+
+// HSTSConfig HTTP严格传输安全配置，只在HTTPS响应中添加
+type HSTSConfig struct {
+	// MaxAge 浏览器只使用HTTPS访问的时长，0表示不发送该响应头
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// IncludeSubdomains 同时作用于所有子域名
+	IncludeSubdomains bool `mapstructure:"include_subdomains"`
+	// Preload 允许加入浏览器的HSTS预加载列表，要求include_subdomains且max_age至少一年
+	Preload bool `mapstructure:"preload"`
+}
+
+// CryptoConfig 密码算法策略
+type CryptoConfig struct {
+	// ApprovedOnly 只使用经批准的算法（政府部署要求），以fips标签构建时始终开启
+	ApprovedOnly bool `mapstructure:"approved_only"`
+	// PBKDF2Iterations 受限模式下密码哈希PBKDF2-HMAC-SHA256的迭代次数
+	PBKDF2Iterations int `mapstructure:"pbkdf2_iterations"`
+	// SecretKey 加密数据库中保存的上游凭据（镜像、迁移的源服务器密码）的密钥，为空时使用auth.jwt_secret。
+	// 更换后已保存的密码无法解密，需要重新填写
+	SecretKey string `mapstructure:"secret_key"`
 }
 
 // AuthConfig 认证配置
@@ -32,14 +183,198 @@ type AuthConfig struct {
 	JWTSecret     string        `mapstructure:"jwt_secret"`
 	TokenExpiry   time.Duration `mapstructure:"token_expiry"`
 	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"`
+	// ClockSkew 校验令牌有效期时容忍的时钟偏差，超出时向客户端返回clock_skew错误
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+	// LoginAlerts 新设备/新国家登录提醒
+	LoginAlerts LoginAlertConfig `mapstructure:"login_alerts"`
+	// SAML SAML 2.0单点登录（服务提供方）
+	SAML SAMLConfig `mapstructure:"saml"`
+	// OIDC OpenID Connect单点登录（授权码流程）
+	OIDC OIDCConfig `mapstructure:"oidc"`
+	// SCIM 身份提供方通过SCIM 2.0自动创建、停用用户和组
+	SCIM SCIMConfig `mapstructure:"scim"`
+	// TwoFactor REST API密码登录的TOTP两步验证
+	TwoFactor TwoFactorConfig `mapstructure:"two_factor"`
+	// APITokens 供自动化使用、带权限范围的个人访问令牌
+	APITokens APITokenConfig `mapstructure:"api_tokens"`
+	// Admins 可以访问/api/admin接口的用户名
+	Admins []string `mapstructure:"admins"`
+}
+
+// LoginAlertConfig 异常登录提醒配置
+type LoginAlertConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CountryHeader 反向代理/CDN注入的国家代码请求头，如CF-IPCountry，为空时不识别国家
+	CountryHeader string `mapstructure:"country_header"`
+	// WebhookURL 提醒推送地址，为空时只写日志
+	WebhookURL string `mapstructure:"webhook_url"`
+	// PublicURL 网关对外访问地址，用于生成提醒中的链接
+	PublicURL string `mapstructure:"public_url"`
+	// LinkTTL 提醒链接和密码重置令牌的有效期
+	LinkTTL time.Duration `mapstructure:"link_ttl"`
+}
+
+// TwoFactorConfig TOTP两步验证配置
+type TwoFactorConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Issuer 验证器App中显示的服务名称
+	Issuer string `mapstructure:"issuer"`
+	// Enforce 强制启用两步验证的范围：off、admins（auth.admins中的用户）、all
+	Enforce string `mapstructure:"enforce"`
+	// ChallengeTTL 密码验证通过后输入验证码的时限
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl"`
+	// MaxAttempts 一次登录允许输错验证码的次数，超出后需重新输入密码
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RecoveryCodes 每次生成的恢复码数量
+	RecoveryCodes int `mapstructure:"recovery_codes"`
+}
+
+// APITokenConfig 个人访问令牌配置
+type APITokenConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxPerUser 每个用户最多持有的有效令牌数
+	MaxPerUser int `mapstructure:"max_per_user"`
+	// MaxLifetime 令牌有效期上限，0表示允许创建永不过期的令牌
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+}
+
+// SAMLConfig SAML 2.0服务提供方配置
+type SAMLConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// RootURL 网关对外访问地址，用于生成metadata和ACS地址
+	RootURL string `mapstructure:"root_url"`
+	// EntityID SP实体标识，为空时使用metadata地址
+	EntityID string `mapstructure:"entity_id"`
+	// CertFile/KeyFile SP签名证书和RSA私钥（PEM）
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// IDPMetadataURL/IDPMetadataFile IdP元数据，二选一
+	IDPMetadataURL  string `mapstructure:"idp_metadata_url"`
+	IDPMetadataFile string `mapstructure:"idp_metadata_file"`
+	// RedirectURL 登录成功后跳转的前端地址，令牌放在#token=片段中；为空时ACS直接返回JSON
+	RedirectURL string `mapstructure:"redirect_url"`
+	// AutoProvision 首次登录时自动创建用户
+	AutoProvision bool `mapstructure:"auto_provision"`
+	// LinkExisting 允许关联已有本地用户：SCIM同步的externalId与NameID/sub相同，或IdP已验证的邮箱与本地用户相同
+	LinkExisting bool `mapstructure:"link_existing"`
+	// AllowedGroups 非空时只允许属于其中任一组的用户登录
+	AllowedGroups []string `mapstructure:"allowed_groups"`
+	// Attributes 断言属性到用户字段的映射
+	Attributes SAMLAttributeMapping `mapstructure:"attributes"`
+}
+
+// SAMLAttributeMapping 断言属性名（Name或FriendlyName），Username为空时使用NameID
+type SAMLAttributeMapping struct {
+	Username    string `mapstructure:"username"`
+	Email       string `mapstructure:"email"`
+	DisplayName string `mapstructure:"display_name"`
+	Groups      string `mapstructure:"groups"`
+}
+
+// OIDCConfig OpenID Connect依赖方（RP）配置，使用授权码流程和PKCE
+type OIDCConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Issuer IdP的issuer地址，启动时从{issuer}/.well-known/openid-configuration获取各端点
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RootURL 网关对外访问地址，回调地址为{root_url}/api/auth/oidc/callback
+	RootURL string `mapstructure:"root_url"`
+	// Scopes 请求的scope，openid总是包含在内
+	Scopes []string `mapstructure:"scopes"`
+	// RedirectURL 登录成功后跳转的前端地址，令牌放在#token=片段中；为空时回调直接返回JSON
+	RedirectURL string `mapstructure:"redirect_url"`
+	// AutoProvision 首次登录时自动创建用户
+	AutoProvision bool `mapstructure:"auto_provision"`
+	// LinkExisting 允许关联已有本地用户：SCIM同步的externalId与NameID/sub相同，或IdP已验证的邮箱与本地用户相同
+	LinkExisting bool `mapstructure:"link_existing"`
+	// DefaultQuota 自动创建的用户的存储配额，0表示使用数据库默认值
+	DefaultQuota int64 `mapstructure:"default_quota"`
+	// AllowedGroups 非空时只允许属于其中任一组的用户登录，按IdP中的组名匹配
+	AllowedGroups []string `mapstructure:"allowed_groups"`
+	// GroupMapping IdP组到网关内部组的映射，非空时只同步映射中列出的组
+	GroupMapping []GroupMapping `mapstructure:"group_mapping"`
+	// Claims ID令牌（或UserInfo）中的声明到用户字段的映射
+	Claims OIDCClaimMapping `mapstructure:"claims"`
+}
+
+// OIDCClaimMapping 声明名称，Username为空时使用sub
+type OIDCClaimMapping struct {
+	Username    string `mapstructure:"username"`
+	Email       string `mapstructure:"email"`
+	DisplayName string `mapstructure:"display_name"`
+	Groups      string `mapstructure:"groups"`
+}
+
+// GroupMapping 外部身份提供方的组到内部组的映射，IdP组名不区分大小写
+type GroupMapping struct {
+	IDPGroup string `mapstructure:"idp_group"`
+	Group    string `mapstructure:"group"`
+}
+
+// SCIMConfig SCIM 2.0服务端配置
+type SCIMConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Token 身份提供方调用/scim/v2时使用的Bearer令牌
+	Token string `mapstructure:"token"`
+	// MaxResults 列表接口单页最多返回的资源数
+	MaxResults int `mapstructure:"max_results"`
+	// DefaultQuota 新建用户及不属于任何配额组的用户的存储配额，0表示使用数据库默认值
+	DefaultQuota int64 `mapstructure:"default_quota"`
+	// GroupQuotas 按组设置存储配额，用户属于多个组时取最大值
+	GroupQuotas []SCIMGroupQuota `mapstructure:"group_quotas"`
+}
+
+// SCIMGroupQuota 组的存储配额，组名不区分大小写
+type SCIMGroupQuota struct {
+	Group string `mapstructure:"group"`
+	Quota int64  `mapstructure:"quota"`
 }
 
 // StorageConfig 存储配置
 type StorageConfig struct {
+	// Type 存储后端：minio（默认）、s3、local或azure
 	Type     string            `mapstructure:"type"`
 	MinIO    MinIOConfig       `mapstructure:"minio"`
 	Local    LocalConfig       `mapstructure:"local"`
+	Azure    AzureConfig       `mapstructure:"azure"`
+	// Layout 用户数据布局：bucket_per_user（默认，每个用户一个存储桶）或
+	// shared_bucket（共用一个存储桶，用户数据位于users/{userID}/前缀下）
+	Layout string `mapstructure:"layout"`
+	// SharedBucket shared_bucket布局使用的存储桶（Azure为容器），为空时使用minio.bucket_name
+	SharedBucket string `mapstructure:"shared_bucket"`
 	Metadata map[string]string `mapstructure:"metadata"`
+	// ListingCache 目录列表缓存，使用cache.redis的连接
+	ListingCache ListingCacheConfig `mapstructure:"listing_cache"`
+	// DeleteWorkers 递归删除目录时并发执行批量删除请求的数量，0表示使用默认值4
+	DeleteWorkers int `mapstructure:"delete_workers"`
+	// Dedup 按内容去重，相同内容的文件只保存一份
+	Dedup DedupConfig `mapstructure:"dedup"`
+}
+
+// DedupConfig 按内容去重配置，引用计数保存在PostgreSQL中
+type DedupConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Bucket 保存去重内容的存储桶（Azure为容器），为空时每用户存储桶布局使用{bucket_prefix}dedup，
+	// 共享存储桶布局使用共享存储桶中的dedup/前缀
+	Bucket string `mapstructure:"bucket"`
+	// MinSize 小于该字节数的文件不去重，按原样保存
+	MinSize int64 `mapstructure:"min_size"`
+	// QuotaPolicy 配额计算方式：logical（默认，每个文件按完整大小计入）或
+	// unique（同一用户的相同内容只计一次，由配额一致性检查修正用量）
+	QuotaPolicy string `mapstructure:"quota_policy"`
+	// SweepInterval 清理引用计数归零的内容的间隔，0表示本副本不清理
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+	// Grace 引用计数归零后保留内容的时长，期间重新上传相同内容时直接复用
+	Grace time.Duration `mapstructure:"grace"`
+}
+
+// ListingCacheConfig 目录列表缓存配置
+type ListingCacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	// MaxEntries 超过该条目数的目录不缓存，0表示不限制
+	MaxEntries int `mapstructure:"max_entries"`
 }
 
 // MinIOConfig MinIO配置
@@ -50,6 +385,14 @@ type MinIOConfig struct {
 	UseSSL     bool   `mapstructure:"use_ssl"`
 	BucketName string `mapstructure:"bucket_name"`
 	BucketPrefix string `mapstructure:"bucket_prefix"`
+	// Region AWS S3等要求签名区域的服务使用，MinIO可留空
+	Region string `mapstructure:"region"`
+	// PartSize 长度未知（分块传输编码）的上传按该大小分片上传，每个上传最多缓冲一个分片。
+	// S3最多10000个分片，单个对象的上限为PartSize*10000
+	PartSize uint64 `mapstructure:"part_size"`
+	// PublicEndpoint 客户端访问存储的地址（如https://s3.example.com），用于生成预签名URL；
+	// 为空时使用Endpoint，网关通过内网地址访问存储时必须设置
+	PublicEndpoint string `mapstructure:"public_endpoint"`
 }
 
 // LocalConfig 本地存储配置
@@ -57,6 +400,17 @@ type LocalConfig struct {
 	RootPath string `mapstructure:"root_path"`
 }
 
+// AzureConfig Azure Blob存储配置，每个用户一个容器
+type AzureConfig struct {
+	AccountName string `mapstructure:"account_name"`
+	// AccountKey Base64编码的存储账户密钥
+	AccountKey string `mapstructure:"account_key"`
+	// Endpoint 为空时使用https://<account_name>.blob.core.windows.net，Azurite等模拟器需要设置
+	Endpoint string `mapstructure:"endpoint"`
+	// ContainerPrefix 容器名称前缀，容器名只能包含小写字母、数字和连字符
+	ContainerPrefix string `mapstructure:"container_prefix"`
+}
+
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
 	Type     string            `mapstructure:"type"`
@@ -106,24 +460,612 @@ type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
 	Output string `mapstructure:"output"`
+	// Access 每个请求一条的访问日志
+	Access AccessLogConfig `mapstructure:"access"`
+}
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	// Privacy 隐私模式：路径和Destination只记录哈希，同一路径的哈希相同
+	Privacy bool `mapstructure:"privacy"`
+	// Fields 记录的字段名，为空时记录全部字段
+	Fields []string `mapstructure:"fields"`
+}
+
+// WebDAVConfig WebDAV协议处理配置
+type WebDAVConfig struct {
+	MaxDecompressedSize int64         `mapstructure:"max_decompressed_size"`
+	MaxCompressionRatio int           `mapstructure:"max_compression_ratio"`
+	OrphanSweepInterval time.Duration `mapstructure:"orphan_sweep_interval"`
+	// PropfindMaxChildren 单次PROPFIND最多返回的子资源数，0表示不限制
+	PropfindMaxChildren int `mapstructure:"propfind_max_children"`
+	// AllowInfiniteDepth 是否允许Depth: infinity的PROPFIND，关闭时返回403 propfind-finite-depth
+	AllowInfiniteDepth bool `mapstructure:"allow_infinite_depth"`
+	// CaseInsensitive 不区分大小写的命名空间：Foo.txt与foo.txt视为同一资源，
+	// 对象键保留创建时的显示名，访问时按规范化（小写）键匹配
+	CaseInsensitive bool `mapstructure:"case_insensitive"`
+	// MaxPathBytes 规范化（NFC、消除..）后请求路径和Destination的最大字节数，超出时返回414或400，
+	// 0表示使用默认值1024（S3对象键的上限）
+	MaxPathBytes int `mapstructure:"max_path_bytes"`
+	// FilenamePolicy PUT/MKCOL/MOVE/COPY创建资源时的文件名规则
+	FilenamePolicy FilenamePolicyConfig `mapstructure:"filename_policy"`
+	// PropertyPolicy PROPPATCH写入属性的规则
+	PropertyPolicy PropertyPolicyConfig `mapstructure:"property_policy"`
+	// XML PROPFIND、PROPPATCH、LOCK等请求体的XML解析限制
+	XML XMLLimitsConfig `mapstructure:"xml"`
+	// Public 无需认证的只读公开命名空间（/public-dav/）
+	Public PublicNamespaceConfig `mapstructure:"public"`
+	// LockPolicy WebDAV锁策略
+	LockPolicy LockPolicyConfig `mapstructure:"lock_policy"`
+	// MacOSCompat macOS Finder写入的AppleDouble（._*）和.DS_Store文件的处理方式
+	MacOSCompat MacOSCompatConfig `mapstructure:"macos_compat"`
+	// LegacyETags 条件请求（If-Match、If-Range、If-None-Match）同时接受旧版按修改时间和大小生成的ETag，
+	// 供升级前缓存了旧ETag的客户端过渡，所有客户端完成一次同步后可以关闭
+	LegacyETags bool `mapstructure:"legacy_etags"`
+	// ConflictCopies PUT的If-Match与当前版本不一致（文件已被其他客户端修改）时，不返回412，
+	// 而是把上传的内容保存为同目录下的冲突副本，并在变更日志中记录conflict事件
+	ConflictCopies bool `mapstructure:"conflict_copies"`
+	// DirectoryIndex GET集合时返回目录列表页面（Accept: application/json时返回JSON），
+	// 用户可以直接用浏览器浏览自己的空间；关闭时集合的GET返回404
+	DirectoryIndex bool `mapstructure:"directory_index"`
+	// Idempotency PUT、PATCH和MKCOL的Idempotency-Key支持，结果保存在Redis中
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+}
+
+// IdempotencyConfig 请求幂等键配置。带Idempotency-Key的PUT、PATCH、MKCOL成功后保存响应，
+// 同一用户用同一个键重试时直接返回保存的响应，不再重复执行（也不重复计入配额）
+type IdempotencyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL 响应保存的时长，超过后同一个键会被当作新请求
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// MacOSCompatConfig macOS Finder兼容模式。Finder会为每个文件写入._*并在每个目录写入.DS_Store，
+// 混合客户端环境中这些文件会出现在其他客户端的列表中并占用配额
+type MacOSCompatConfig struct {
+	// Mode off：按普通文件处理；reject：拒绝创建（403）；hide：照常保存和读取，但不计入用量，也不在PROPFIND列表中出现
+	Mode string `mapstructure:"mode"`
+	// Patterns 按文件名（不含目录）匹配的模式，使用path.Match语法
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// LockPolicyConfig WebDAV锁策略，按部署调整锁的有效期和数量
+type LockPolicyConfig struct {
+	// MaxTimeout 锁的最长有效期，客户端请求更长（包括Infinite）时截断
+	MaxTimeout time.Duration `mapstructure:"max_timeout"`
+	// DefaultTimeout LOCK请求未带Timeout头或无法解析时使用的有效期
+	DefaultTimeout time.Duration `mapstructure:"default_timeout"`
+	// AllowShared 是否允许共享锁，关闭时共享LOCK返回403，supportedlock只列出排他锁
+	AllowShared bool `mapstructure:"allow_shared"`
+	// MaxLocksPerUser 每个用户同时持有的锁数上限，0表示不限制
+	MaxLocksPerUser int `mapstructure:"max_locks_per_user"`
+	// IdleTimeout 锁在这段时间内既未刷新也未被持有者写入时提前释放，0表示不启用
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+}
+
+// FilenamePolicyConfig 文件名规则，保证经网关创建的文件能同步到Windows客户端
+type FilenamePolicyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ReservedNames 拒绝Windows保留名（CON、PRN、AUX、NUL、COM1-9、LPT1-9，含带扩展名的形式）及以点或空格结尾的名称
+	ReservedNames bool `mapstructure:"reserved_names"`
+	// MaxComponentLength 每一级名称的最大字符数，0表示不限制
+	MaxComponentLength int `mapstructure:"max_component_length"`
+	// MaxPathLength 完整路径（不含开头的/）的最大字符数，0表示不限制
+	MaxPathLength int `mapstructure:"max_path_length"`
+	// BannedCharacters 名称中不允许出现的字符，控制字符总是被拒绝
+	BannedCharacters string `mapstructure:"banned_characters"`
+}
+
+// XMLLimitsConfig DAV请求体的XML解析限制，DOCTYPE等DTD声明总是被拒绝
+type XMLLimitsConfig struct {
+	// MaxBodySize 请求体的最大字节数，超出时返回413，0表示使用默认值1MB
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+	// MaxDepth 元素的最大嵌套深度，0表示使用默认值64
+	MaxDepth int `mapstructure:"max_depth"`
+}
+
+// PropertyPolicyConfig PROPPATCH属性规则。服务端计算的DAV:属性和网关内部命名空间总是受保护，
+// 不需要配置
+type PropertyPolicyConfig struct {
+	// ReservedNamespaces 客户端不能写入或删除任何属性的命名空间
+	ReservedNamespaces []string `mapstructure:"reserved_namespaces"`
+	// MaxPropertiesPerResource 每个资源的自定义属性数上限，0表示不限制
+	MaxPropertiesPerResource int `mapstructure:"max_properties_per_resource"`
+	// MaxValueLength 属性值的最大字节数，0表示不限制
+	MaxValueLength int `mapstructure:"max_value_length"`
+	// Namespaces 按命名空间的写入规则
+	Namespaces []NamespacePolicyConfig `mapstructure:"namespaces"`
+}
+
+// NamespacePolicyConfig 单个命名空间的写入规则
+type NamespacePolicyConfig struct {
+	Namespace string `mapstructure:"namespace"`
+	// ReadOnly 只能读取，写入和删除返回403
+	ReadOnly bool `mapstructure:"read_only"`
+	// AllowedNames 非空时只允许写入这些属性名
+	AllowedNames []string `mapstructure:"allowed_names"`
+	// MaxValueLength 该命名空间的属性值最大字节数，0表示使用全局上限
+	MaxValueLength int `mapstructure:"max_value_length"`
+	// ValuePattern 属性值必须完整匹配的正则表达式，为空时不检查
+	ValuePattern string `mapstructure:"value_pattern"`
+}
+
+// PublicNamespaceConfig 公开命名空间配置，将指定用户的某个目录以只读WebDAV匿名发布
+type PublicNamespaceConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Username 提供内容的用户，其文件由该用户正常上传和管理
+	Username string `mapstructure:"username"`
+	// Prefix 发布的目录，/public-dav/对应该目录，为空或/时发布整个用户空间
+	Prefix string `mapstructure:"prefix"`
+	// CacheMaxAge GET/HEAD响应的Cache-Control max-age
+	CacheMaxAge time.Duration `mapstructure:"cache_max_age"`
+	// ListingMaxAge PROPFIND响应的Cache-Control max-age，目录内容变化较频繁
+	ListingMaxAge time.Duration `mapstructure:"listing_max_age"`
+}
+
+// ArchiveConfig 服务端归档解压配置
+type ArchiveConfig struct {
+	TempDir       string `mapstructure:"temp_dir"`
+	MaxUploadSize int64  `mapstructure:"max_upload_size"`
+	MaxEntries    int    `mapstructure:"max_entries"`
+	// IngestBatchSize tar流导入时每批写入的属性条数
+	IngestBatchSize int `mapstructure:"ingest_batch_size"`
+	// JobRetention 已结束的解压任务在内存中保留的时间，过期后查询返回404，0表示结束后立即清理
+	JobRetention time.Duration `mapstructure:"job_retention"`
+}
+
+// DownloadConfig 多连接分段下载配置
+type DownloadConfig struct {
+	MinSegmentSize int64 `mapstructure:"min_segment_size"`
+	MaxSegments    int   `mapstructure:"max_segments"`
+	// Zip 文件夹及多选文件打包下载
+	Zip ZipDownloadConfig `mapstructure:"zip"`
+	// Redirect 大文件下载重定向到存储的预签名URL
+	Redirect DownloadRedirectConfig `mapstructure:"redirect"`
+}
+
+// DownloadRedirectConfig 大文件下载卸载配置。WebDAV GET和无密码分享的下载返回307，
+// 客户端凭短期有效的预签名URL直接从存储下载，HEAD、PROPFIND仍由网关处理。仅MinIO/S3后端支持
+type DownloadRedirectConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinSize 不小于该字节数的文件才重定向
+	MinSize int64 `mapstructure:"min_size"`
+	// TTL 预签名URL的有效期
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// ZipDownloadConfig 打包下载配置，0表示不限制
+type ZipDownloadConfig struct {
+	MaxEntries   int   `mapstructure:"max_entries"`
+	MaxTotalSize int64 `mapstructure:"max_total_size"`
+	// MaxConcurrentPerUser 每个用户（分享下载计入分享者）同时进行的打包下载数
+	MaxConcurrentPerUser int `mapstructure:"max_concurrent_per_user"`
+	// Compress 使用Deflate压缩，关闭时仅存储，CPU开销低且大小估算准确
+	Compress bool `mapstructure:"compress"`
+}
+
+// ShareConfig 分享链接配置
+type ShareConfig struct {
+	// Upload 允许上传（文件投递）的分享的默认限制
+	Upload ShareUploadConfig `mapstructure:"upload"`
+	// Cleanup 过期分享的后台清理
+	Cleanup ShareCleanupConfig `mapstructure:"cleanup"`
+	// Stats 分享访问统计和首次访问通知
+	Stats ShareStatsConfig `mapstructure:"stats"`
+	// ShortLinks /s/:slug短链接和分享二维码
+	ShortLinks ShareShortLinkConfig `mapstructure:"short_links"`
+	// Password 分享密码的复杂度要求
+	Password SharePasswordConfig `mapstructure:"password"`
+}
+
+// SharePasswordConfig 分享密码复杂度要求，只在创建或修改分享密码时检查，不影响已有分享
+type SharePasswordConfig struct {
+	// MinLength 最短长度（按字符计），0表示不限制
+	MinLength int `mapstructure:"min_length"`
+	// RequireLetter 至少包含一个字母
+	RequireLetter bool `mapstructure:"require_letter"`
+	// RequireDigit 至少包含一个数字
+	RequireDigit bool `mapstructure:"require_digit"`
+	// RequireSymbol 至少包含一个字母和数字以外的字符
+	RequireSymbol bool `mapstructure:"require_symbol"`
+}
+
+// ShareShortLinkConfig 分享短链接配置。短码随机生成，与已有短码冲突时重新生成
+type ShareShortLinkConfig struct {
+	// Enabled 创建分享时分配短码，关闭时二维码使用完整的分享链接
+	Enabled bool `mapstructure:"enabled"`
+	// Length 短码长度
+	Length int `mapstructure:"length"`
+	// Alphabet 短码使用的字符，默认去掉了0/o、1/l/i等容易混淆的字符
+	Alphabet string `mapstructure:"alphabet"`
+	// PublicURL 短链接和二维码使用的对外地址，为空时按请求的Host和X-Forwarded-Proto生成
+	PublicURL string `mapstructure:"public_url"`
+}
+
+// ShareStatsConfig 分享访问统计配置
+type ShareStatsConfig struct {
+	// Retention 访问记录的保留时长，0表示永久保留
+	Retention time.Duration `mapstructure:"retention"`
+	// NotifyWebhookURL 分享第一次被访问时推送通知的地址（JSON POST），为空时不通知
+	NotifyWebhookURL string `mapstructure:"notify_webhook_url"`
+}
+
+// ShareCleanupConfig 过期分享清理配置
+type ShareCleanupConfig struct {
+	// Interval 清理间隔，0表示不运行清理任务
+	Interval time.Duration `mapstructure:"interval"`
+	// Retention 已停用的分享保留多久后删除，0表示立即删除
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// ShareUploadConfig 匿名上传限制，分享未单独设置时使用，0表示不限制
+type ShareUploadConfig struct {
+	// MaxFileSize 单个文件大小上限，分享单独设置的值也不能超过它
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxFiles 每个分享默认最多接收的文件数
+	MaxFiles int `mapstructure:"max_files"`
 }
 
-// Load 加载配置
+// QuotaConfig 存储配额
+type QuotaConfig struct {
+	// Reconcile 定期按实际存储重新计算用户用量，修正上传中断、删除部分失败等造成的偏差
+	Reconcile QuotaReconcileConfig `mapstructure:"reconcile"`
+	// Usage 按顶层目录、文件类别统计的用量明细（GET /api/usage）
+	Usage UsageConfig `mapstructure:"usage"`
+}
+
+// UsageConfig 用量明细统计配置。首次查询时完整遍历一次，之后只重新统计有改动的顶层目录
+type UsageConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval 后台重新统计有改动的目录的间隔
+	Interval time.Duration `mapstructure:"interval"`
+	// Rescan 完整重新遍历一个用户的间隔，用于发现不经过WebDAV的改动（镜像、分享上传等），0表示不定期遍历
+	Rescan time.Duration `mapstructure:"rescan"`
+	// BatchSize 每轮最多重新统计的目录数（和完整遍历的用户数）
+	BatchSize int `mapstructure:"batch_size"`
+	// LargestFiles 返回的最大文件数量
+	LargestFiles int `mapstructure:"largest_files"`
+	// TrashFolders 视为回收站的顶层目录，不区分大小写，单独统计
+	TrashFolders []string `mapstructure:"trash_folders"`
+}
+
+// QuotaReconcileConfig 配额一致性检查配置
+type QuotaReconcileConfig struct {
+	// Interval 两次检查之间的间隔，0表示不定期运行（仍可通过管理接口触发）
+	Interval time.Duration `mapstructure:"interval"`
+	// Repair 发现偏差时将数据库中的用量改为实际值，关闭时只报告
+	Repair bool `mapstructure:"repair"`
+	// Tolerance 允许的偏差字节数，不超过该值的偏差既不报告也不修复
+	Tolerance int64 `mapstructure:"tolerance"`
+}
+
+// EventsConfig 变更推送（GET /api/events，Server-Sent Events）配置
+type EventsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Retention 变更日志的保留期，客户端断线超过该时间后需要完整重新同步，0表示不清理
+	Retention time.Duration `mapstructure:"retention"`
+	// Heartbeat 没有变更时发送心跳的间隔，避免代理关闭空闲连接
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+	// MaxDuration 单个连接的最长时间，应小于server.write_timeout，到期后客户端带Last-Event-ID重连
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+	// ReplayLimit 重连时最多补发的变更数，超出时通知客户端完整重新同步
+	ReplayLimit int `mapstructure:"replay_limit"`
+}
+
+// MirrorConfig 镜像模式配置：定期从上游WebDAV或S3拉取内容到用户目录
+type MirrorConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// PollInterval 检查到期镜像的间隔
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// MinInterval 镜像同步间隔的下限
+	MinInterval time.Duration `mapstructure:"min_interval"`
+	// MaxPerUser 每个用户最多可创建的镜像数，0表示不限制
+	MaxPerUser int `mapstructure:"max_per_user"`
+	// RequestTimeout 访问上游单个请求（列目录或下载单个文件）的超时
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// AllowedHosts 允许作为上游的主机名，可以位于内网；为空时允许任意主机，但拒绝解析到内网地址的上游
+	AllowedHosts []string `mapstructure:"allowed_hosts"`
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// BufferSize 等待写入数据库的事件队列长度，队列满时改为同步写入
+	BufferSize int `mapstructure:"buffer_size"`
+	// Retention 审计记录保留时长，0表示永久保留
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// MetricsConfig Prometheus指标配置
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	// Token 抓取时需携带的Bearer令牌，为空时不校验
+	Token   string              `mapstructure:"token"`
+	Tenants TenantMetricsConfig `mapstructure:"tenants"`
+}
+
+// CORSConfig 跨域访问配置，可以通过SIGHUP重新加载
+type CORSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// AllowedOrigins 允许的来源，如https://files.example.com，https://*.example.com匹配任意子域名，
+	// 为空时允许任意来源（*）
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowedHeaders 预检允许浏览器发送的请求头，为空时使用内置列表（含Depth、Destination、Overwrite、Lock-Token、If等WebDAV请求头）
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+	// ExposedHeaders 允许浏览器脚本读取的响应头，为空时使用内置列表（含ETag、Lock-Token、DAV等）
+	ExposedHeaders []string `mapstructure:"exposed_headers"`
+	// AllowCredentials 允许跨域请求携带Cookie和HTTP认证信息，开启时必须列出具体的来源
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge 浏览器缓存预检结果的时长，0表示不缓存
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// HealthConfig 就绪检查配置
+type HealthConfig struct {
+	// Timeout 单个依赖检查的超时
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Optional 失败时不影响就绪状态的依赖（如database、redis、storage、properties），结果中标记为degraded
+	Optional []string `mapstructure:"optional"`
+}
+
+// TenantMetricsConfig 按租户统计的用量指标，限制tenant标签的取值数量
+type TenantMetricsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Include 需要单独统计的租户，为空时按出现顺序统计，直到MaxTenants
+	Include []string `mapstructure:"include"`
+	// MaxTenants tenant标签取值的上限，超出的租户合并到"_other"
+	MaxTenants int `mapstructure:"max_tenants"`
+	// StorageRefresh 存储用量从数据库刷新的最短间隔
+	StorageRefresh time.Duration `mapstructure:"storage_refresh"`
+}
+
+// BandwidthConfig 带宽调度配置，速率单位为字节/秒，0表示不限速
+type BandwidthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Timezone 时间窗口所用时区，如Asia/Shanghai，为空时使用服务器本地时区
+	Timezone     string            `mapstructure:"timezone"`
+	UploadRate   int64             `mapstructure:"upload_rate"`
+	DownloadRate int64             `mapstructure:"download_rate"`
+	Windows      []BandwidthWindow `mapstructure:"windows"`
+	// Users 按用户名覆盖全局策略
+	Users map[string]BandwidthUserConfig `mapstructure:"users"`
+}
+
+// BandwidthWindow 时间窗口内生效的限速策略
+type BandwidthWindow struct {
+	Name string `mapstructure:"name"`
+	// Days 生效的星期，如mon、tue或weekdays、weekend，为空表示每天
+	Days []string `mapstructure:"days"`
+	// Start/End 为HH:MM格式，End早于Start时表示跨越午夜
+	Start        string `mapstructure:"start"`
+	End          string `mapstructure:"end"`
+	UploadRate   int64  `mapstructure:"upload_rate"`
+	DownloadRate int64  `mapstructure:"download_rate"`
+}
+
+// BandwidthUserConfig 单个用户的限速策略，配置后完全替换全局策略
+type BandwidthUserConfig struct {
+	Exempt       bool              `mapstructure:"exempt"`
+	UploadRate   int64             `mapstructure:"upload_rate"`
+	DownloadRate int64             `mapstructure:"download_rate"`
+	Windows      []BandwidthWindow `mapstructure:"windows"`
+}
+
+// SearchConfig 文件搜索配置
+type SearchConfig struct {
+	// MaxResults 单次搜索最多返回的结果数
+	MaxResults int `mapstructure:"max_results"`
+	// MaxScan 单次搜索最多检查的对象数，超出后返回已找到的结果并标记为截断
+	MaxScan int `mapstructure:"max_scan"`
+}
+
+// BatchConfig 批量操作接口配置
+type BatchConfig struct {
+	// MaxOperations 单次请求最多包含的操作数，0表示不限制
+	MaxOperations int `mapstructure:"max_operations"`
+}
+
+// JobsConfig 后台任务配置，任务保存在数据库中，多副本共享
+type JobsConfig struct {
+	// Workers 每个副本同时执行的任务数
+	Workers int `mapstructure:"workers"`
+	// PollInterval 空闲时检查新任务的间隔，也是运行中任务写入进度和检查取消的间隔
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// StaleAfter 运行中的任务超过该时间没有更新时视为副本已退出，标记为失败
+	StaleAfter time.Duration `mapstructure:"stale_after"`
+	// Retention 已结束任务的保留时间，0表示不清理
+	Retention time.Duration `mapstructure:"retention"`
+	// MaxActivePerUser 每个用户未结束的任务数上限，0表示不限制
+	MaxActivePerUser int `mapstructure:"max_active_per_user"`
+}
+
+// AccountConfig 用户注销账户和导出数据的配置
+type AccountConfig struct {
+	// DeletionGracePeriod 注销后保留数据的时间，期间账户被停用，管理员可以恢复；到期后删除全部文件和账户
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"`
+	// PurgeInterval 检查到期账户的间隔，0表示本副本不执行删除
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+	// ExportFolder 数据导出压缩包在用户空间中的保存目录，该目录本身不会被导出
+	ExportFolder string `mapstructure:"export_folder"`
+}
+
+// MigrationConfig 从其他WebDAV服务器（Nextcloud、ownCloud、Apache mod_dav等）迁移数据的配置
+type MigrationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// PollInterval 检查等待中迁移的间隔，0表示本副本不执行迁移
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// RequestTimeout 访问源服务器单个请求（列目录或下载单个文件）的超时
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// AllowedHosts 允许作为源服务器的主机名，可以位于内网；为空时允许任意主机，但拒绝解析到内网地址的源服务器
+	AllowedHosts []string `mapstructure:"allowed_hosts"`
+}
+
+// UploadsConfig 预签名直接上传配置：客户端通过POST /api/uploads/presign获取URL后直接写入存储，
+// 网关在完成回调或后台轮询确认后计入用量和变更日志。仅MinIO/S3后端支持
+type UploadsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL 预签名URL的有效期，过期仍未完成的上传被放弃
+	TTL time.Duration `mapstructure:"ttl"`
+	// PartSize 超过该大小的文件使用分段上传，每个分段的大小（S3最少5MiB，最多10000个分段）
+	PartSize int64 `mapstructure:"part_size"`
+	// PollInterval 检查未回调的上传是否已写入以及是否过期的间隔，0表示本副本不轮询
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// CommentsConfig 文件评论配置：评论保存在数据库中，按稳定文件ID关联，文件移动、改名后仍然保留
+type CommentsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxLength 单条评论的最大字符数，0表示不限制
+	MaxLength int `mapstructure:"max_length"`
+	// CountProperty 在PROPFIND中以gw:comment-count返回文件的评论数
+	CountProperty bool `mapstructure:"count_property"`
+}
+
+// TagsConfig 标签配置：标签保存为资源的属性，随资源移动、复制、删除
+type TagsConfig struct {
+	// Enabled 开启标签REST接口和/webdav/.tags/下按标签浏览的只读虚拟集合
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// MediaConfig 媒体元数据配置：图片、视频和音频写入后在后台提取尺寸、拍摄时间、时长等，
+// 保存为只读属性并可在搜索中按拍摄时间、尺寸过滤
+type MediaConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Location 是否保存照片EXIF中的GPS拍摄地点，默认不保存
+	Location bool `mapstructure:"location"`
+	// PollInterval 检查待提取文件的间隔，0表示本副本不提取（只排队）
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// TenancyConfig 多租户模式：用户属于租户，存储按租户分前缀，请求按子域名或路径前缀识别租户
+type TenancyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Resolution 识别请求所属租户的方式：subdomain（{slug}.base_domain）或path（path_prefix/{slug}/...）
+	Resolution string `mapstructure:"resolution"`
+	// BaseDomain 子域名模式下的基础域名，如files.example.com
+	BaseDomain string `mapstructure:"base_domain"`
+	// PathPrefix 路径模式下租户标识之前的前缀
+	PathPrefix string `mapstructure:"path_prefix"`
+	// DefaultQuota 新建租户的配额池（字节），0表示不限制，成员各自的配额仍然有效
+	DefaultQuota int64 `mapstructure:"default_quota"`
+}
+
+// PropertiesConfig WebDAV属性存储配置
+type PropertiesConfig struct {
+	// Backend 存储后端：sqlite（本地文件，仅适合单实例）或 postgres（主数据库，支持多副本）
+	Backend    string `mapstructure:"backend"`
+	SQLitePath string `mapstructure:"sqlite_path"`
+	// SQLite 本地SQLite存储的连接和维护设置，postgres后端不使用
+	SQLite PropertySQLiteConfig `mapstructure:"sqlite"`
+	// Cache 进程内的资源属性缓存
+	Cache PropertyCacheConfig `mapstructure:"cache"`
+}
+
+// PropertySQLiteConfig SQLite属性存储配置。数据库使用WAL模式，写操作在进程内排队逐个执行
+type PropertySQLiteConfig struct {
+	// BusyTimeout 数据库被其他进程（如import-properties）锁定时的等待时长，超时后返回SQLITE_BUSY
+	BusyTimeout time.Duration `mapstructure:"busy_timeout"`
+	// MaintenanceInterval 定期执行ANALYZE、按需VACUUM的间隔，0表示不执行
+	MaintenanceInterval time.Duration `mapstructure:"maintenance_interval"`
+	// VacuumThreshold 空闲页占数据库的比例达到该值时维护任务执行VACUUM（0-1），0表示每次都执行
+	VacuumThreshold float64 `mapstructure:"vacuum_threshold"`
+}
+
+// PropertyCacheConfig 资源属性缓存配置
+type PropertyCacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL 缓存时长，同时也是多副本共享属性时其他副本修改的最长可见延迟
+	TTL time.Duration `mapstructure:"ttl"`
+	// MaxEntries 缓存的资源数上限，超出时淘汰最久未使用的资源
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+// Load 加载配置，配置文件按当前目录、./config、/etc/webdav-gateway、$HOME/.webdav-gateway的顺序查找
 func Load() (*Config, error) {
+	return LoadFile("")
+}
+
+// LoadFile 从指定的配置文件加载配置，path为空时按Load的顺序查找，找不到时只使用默认值和环境变量。
+// 配置文件存在但无法解析时返回错误
+func LoadFile(path string) (*Config, error) {
 	// 设置默认值
 	viper.SetDefault("server.address", ":8080")
 	viper.SetDefault("server.mode", "debug")
-	viper.SetDefault("server.read_timeout", 10*time.Second)
-	viper.SetDefault("server.write_timeout", 10*time.Second)
+	viper.SetDefault("server.read_timeout", 15*time.Minute)
+	viper.SetDefault("server.write_timeout", 15*time.Minute)
+	viper.SetDefault("server.idle_timeout", 2*time.Minute)
+	viper.SetDefault("server.read_header_timeout", 10*time.Second)
+	viper.SetDefault("server.max_connections", 0)
+	viper.SetDefault("server.http2.enabled", true)
+	viper.SetDefault("server.http2.max_concurrent_streams", 250)
+	viper.SetDefault("server.http2.h2c", false)
+	viper.SetDefault("server.limits.metadata_timeout", 2*time.Minute)
+	viper.SetDefault("server.limits.transfer_timeout", time.Duration(0))
+	viper.SetDefault("server.shutdown.timeout", 30*time.Second)
+	viper.SetDefault("server.shutdown.max_drain", 10*time.Minute)
+	viper.SetDefault("server.compression.enabled", true)
+	viper.SetDefault("server.compression.min_size", 1024)
+	viper.SetDefault("server.compression.level", 0)
+	viper.SetDefault("server.compression.types", []string{
+		"application/xml", "text/xml", "application/json", "text/html", "text/plain", "text/css", "application/javascript",
+	})
+	viper.SetDefault("server.limits.max_upload_size", int64(0))
+	viper.SetDefault("server.limits.max_body_size", int64(10<<20))
+	viper.SetDefault("server.limits.require_content_length", false)
+	viper.SetDefault("server.tls.enabled", false)
+	viper.SetDefault("server.tls.min_version", "1.2")
+	viper.SetDefault("server.tls.acme.enabled", false)
+	viper.SetDefault("server.tls.acme.cache_dir", "/var/lib/webdav-gateway/acme")
+	viper.SetDefault("server.tls.redirect_address", "")
+	viper.SetDefault("server.tls.hsts.max_age", time.Duration(0))
 	viper.SetDefault("auth.jwt_secret", "your-secret-key")
 	viper.SetDefault("auth.token_expiry", 24*time.Hour)
 	viper.SetDefault("auth.refresh_expiry", 7*24*time.Hour)
+	viper.SetDefault("auth.clock_skew", 2*time.Minute)
+	viper.SetDefault("auth.login_alerts.enabled", false)
+	viper.SetDefault("auth.login_alerts.link_ttl", 72*time.Hour)
+	viper.SetDefault("auth.saml.enabled", false)
+	viper.SetDefault("auth.saml.auto_provision", true)
+	viper.SetDefault("auth.saml.attributes.email", "email")
+	viper.SetDefault("auth.saml.attributes.display_name", "displayName")
+	viper.SetDefault("auth.saml.attributes.groups", "groups")
+	viper.SetDefault("auth.oidc.enabled", false)
+	viper.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("auth.oidc.auto_provision", true)
+	viper.SetDefault("auth.oidc.claims.username", "preferred_username")
+	viper.SetDefault("auth.oidc.claims.email", "email")
+	viper.SetDefault("auth.oidc.claims.display_name", "name")
+	viper.SetDefault("auth.oidc.claims.groups", "groups")
+	viper.SetDefault("auth.two_factor.enabled", false)
+	viper.SetDefault("auth.two_factor.issuer", "WebDAV Gateway")
+	viper.SetDefault("auth.two_factor.enforce", "off")
+	viper.SetDefault("auth.two_factor.challenge_ttl", 5*time.Minute)
+	viper.SetDefault("auth.two_factor.max_attempts", 5)
+	viper.SetDefault("auth.two_factor.recovery_codes", 10)
+	viper.SetDefault("auth.api_tokens.enabled", false)
+	viper.SetDefault("auth.api_tokens.max_per_user", 20)
+	viper.SetDefault("auth.api_tokens.max_lifetime", 0)
+	viper.SetDefault("auth.scim.enabled", false)
+	viper.SetDefault("auth.scim.max_results", 200)
 	viper.SetDefault("storage.type", "minio")
+	viper.SetDefault("storage.layout", "bucket_per_user")
 	viper.SetDefault("storage.minio.endpoint", "localhost:9000")
 	viper.SetDefault("storage.minio.use_ssl", false)
 	viper.SetDefault("storage.minio.bucket_name", "webdav-files")
 	viper.SetDefault("storage.minio.bucket_prefix", "user-")
+	viper.SetDefault("storage.minio.part_size", 16<<20)
 	viper.SetDefault("storage.local.root_path", "./data")
+	viper.SetDefault("storage.azure.container_prefix", "user-")
+	viper.SetDefault("storage.listing_cache.enabled", false)
+	viper.SetDefault("storage.listing_cache.ttl", 5*time.Minute)
+	viper.SetDefault("storage.listing_cache.max_entries", 5000)
+	viper.SetDefault("storage.delete_workers", 4)
+	viper.SetDefault("storage.dedup.enabled", false)
+	viper.SetDefault("storage.dedup.min_size", int64(1<<20))
+	viper.SetDefault("storage.dedup.quota_policy", "logical")
+	viper.SetDefault("storage.dedup.sweep_interval", time.Hour)
+	viper.SetDefault("storage.dedup.grace", 24*time.Hour)
 	viper.SetDefault("database.type", "sqlite")
 	viper.SetDefault("database.sqlite.path", "./data/app.db")
 	viper.SetDefault("cache.type", "memory")
@@ -132,23 +1074,170 @@ func Load() (*Config, error) {
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.output", "stdout")
+	viper.SetDefault("logging.access.privacy", false)
+	viper.SetDefault("webdav.max_decompressed_size", int64(10<<30))
+	viper.SetDefault("webdav.max_compression_ratio", 100)
+	viper.SetDefault("webdav.orphan_sweep_interval", 24*time.Hour)
+	viper.SetDefault("webdav.propfind_max_children", 10000)
+	viper.SetDefault("webdav.allow_infinite_depth", false)
+	viper.SetDefault("webdav.case_insensitive", false)
+	viper.SetDefault("webdav.max_path_bytes", 1024)
+	viper.SetDefault("webdav.filename_policy.enabled", false)
+	viper.SetDefault("webdav.filename_policy.reserved_names", true)
+	viper.SetDefault("webdav.filename_policy.max_component_length", 255)
+	viper.SetDefault("webdav.filename_policy.max_path_length", 400)
+	viper.SetDefault("webdav.filename_policy.banned_characters", `\:*?"<>|`)
+	viper.SetDefault("webdav.property_policy.max_properties_per_resource", 200)
+	viper.SetDefault("webdav.property_policy.max_value_length", 10*1024)
+	viper.SetDefault("webdav.xml.max_body_size", int64(1<<20))
+	viper.SetDefault("webdav.xml.max_depth", 64)
+	viper.SetDefault("webdav.public.enabled", false)
+	viper.SetDefault("webdav.public.prefix", "/")
+	viper.SetDefault("webdav.public.cache_max_age", 24*time.Hour)
+	viper.SetDefault("webdav.public.listing_max_age", 5*time.Minute)
+	viper.SetDefault("webdav.lock_policy.max_timeout", 24*time.Hour)
+	viper.SetDefault("webdav.lock_policy.default_timeout", time.Hour)
+	viper.SetDefault("webdav.lock_policy.allow_shared", true)
+	viper.SetDefault("webdav.lock_policy.max_locks_per_user", 1000)
+	viper.SetDefault("webdav.lock_policy.idle_timeout", time.Duration(0))
+	viper.SetDefault("webdav.macos_compat.mode", "off")
+	viper.SetDefault("webdav.macos_compat.patterns", []string{"._*", ".DS_Store"})
+	viper.SetDefault("webdav.legacy_etags", true)
+	viper.SetDefault("webdav.conflict_copies", false)
+	viper.SetDefault("webdav.directory_index", false)
+	viper.SetDefault("webdav.idempotency.enabled", false)
+	viper.SetDefault("webdav.idempotency.ttl", 24*time.Hour)
+	viper.SetDefault("archive.temp_dir", "")
+	viper.SetDefault("archive.max_upload_size", int64(10<<30))
+	viper.SetDefault("archive.max_entries", 100000)
+	viper.SetDefault("archive.ingest_batch_size", 500)
+	viper.SetDefault("archive.job_retention", 24*time.Hour)
+	viper.SetDefault("properties.backend", "sqlite")
+	viper.SetDefault("download.min_segment_size", int64(8<<20))
+	viper.SetDefault("download.max_segments", 16)
+	viper.SetDefault("download.zip.max_entries", 100000)
+	viper.SetDefault("download.zip.max_total_size", int64(20<<30))
+	viper.SetDefault("download.zip.max_concurrent_per_user", 2)
+	viper.SetDefault("download.zip.compress", false)
+	viper.SetDefault("download.redirect.enabled", false)
+	viper.SetDefault("download.redirect.min_size", int64(100<<20))
+	viper.SetDefault("download.redirect.ttl", 5*time.Minute)
+
+	viper.SetDefault("share.upload.max_file_size", int64(1<<30))
+	viper.SetDefault("share.upload.max_files", 100)
+	viper.SetDefault("share.cleanup.interval", 10*time.Minute)
+	viper.SetDefault("share.cleanup.retention", 30*24*time.Hour)
+	viper.SetDefault("share.stats.retention", 90*24*time.Hour)
+	viper.SetDefault("share.short_links.enabled", false)
+	viper.SetDefault("share.short_links.length", 7)
+	viper.SetDefault("share.short_links.alphabet", "23456789abcdefghjkmnpqrstuvwxyz")
+	viper.SetDefault("share.password.min_length", 8)
+	viper.SetDefault("share.password.require_letter", true)
+	viper.SetDefault("share.password.require_digit", true)
+	viper.SetDefault("share.password.require_symbol", false)
+
+	viper.SetDefault("mirror.enabled", false)
+	viper.SetDefault("mirror.poll_interval", time.Minute)
+	viper.SetDefault("mirror.min_interval", 5*time.Minute)
+	viper.SetDefault("mirror.max_per_user", 10)
+	viper.SetDefault("mirror.request_timeout", 30*time.Minute)
+
+	viper.SetDefault("events.enabled", false)
+	viper.SetDefault("events.retention", 7*24*time.Hour)
+	viper.SetDefault("events.heartbeat", 30*time.Second)
+	viper.SetDefault("events.max_duration", 10*time.Minute)
+	viper.SetDefault("events.replay_limit", 1000)
+
+	viper.SetDefault("quota.reconcile.interval", 24*time.Hour)
+	viper.SetDefault("quota.reconcile.repair", true)
+	viper.SetDefault("quota.reconcile.tolerance", 0)
+	viper.SetDefault("quota.usage.enabled", true)
+	viper.SetDefault("quota.usage.interval", time.Minute)
+	viper.SetDefault("quota.usage.rescan", 24*time.Hour)
+	viper.SetDefault("quota.usage.batch_size", 100)
+	viper.SetDefault("quota.usage.largest_files", 20)
+	viper.SetDefault("quota.usage.trash_folders", []string{".Trash", ".Trashes", "$RECYCLE.BIN"})
+
+	viper.SetDefault("audit.enabled", false)
+	viper.SetDefault("audit.buffer_size", 1024)
+	viper.SetDefault("audit.retention", 0)
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.tenants.enabled", false)
+	viper.SetDefault("metrics.tenants.max_tenants", 100)
+	viper.SetDefault("metrics.tenants.storage_refresh", 5*time.Minute)
+	viper.SetDefault("health.timeout", 2*time.Second)
+
+	viper.SetDefault("properties.sqlite_path", "./data/properties.db")
+	viper.SetDefault("properties.sqlite.busy_timeout", 5*time.Second)
+	viper.SetDefault("properties.sqlite.maintenance_interval", 24*time.Hour)
+	viper.SetDefault("properties.sqlite.vacuum_threshold", 0.2)
+	viper.SetDefault("properties.cache.enabled", true)
+	viper.SetDefault("properties.cache.ttl", 30*time.Second)
+	viper.SetDefault("properties.cache.max_entries", 10000)
+	viper.SetDefault("bandwidth.enabled", false)
+	viper.SetDefault("crypto.approved_only", false)
+	viper.SetDefault("crypto.pbkdf2_iterations", 600000)
+	viper.SetDefault("search.max_results", 1000)
+	viper.SetDefault("search.max_scan", 100000)
+	viper.SetDefault("batch.max_operations", 1000)
+	viper.SetDefault("jobs.workers", 4)
+	viper.SetDefault("jobs.poll_interval", 2*time.Second)
+	viper.SetDefault("jobs.stale_after", 5*time.Minute)
+	viper.SetDefault("jobs.retention", 7*24*time.Hour)
+	viper.SetDefault("jobs.max_active_per_user", 5)
+
+	viper.SetDefault("cors.enabled", false)
+	viper.SetDefault("cors.allow_credentials", false)
+	viper.SetDefault("cors.max_age", 24*time.Hour)
+
+	viper.SetDefault("tenancy.enabled", false)
+	viper.SetDefault("tenancy.resolution", "subdomain")
+	viper.SetDefault("tenancy.path_prefix", "/t")
+	viper.SetDefault("tenancy.default_quota", int64(0))
+
+	viper.SetDefault("account.deletion_grace_period", 30*24*time.Hour)
+	viper.SetDefault("account.purge_interval", time.Hour)
+	viper.SetDefault("account.export_folder", "/Account exports")
+
+	viper.SetDefault("migration.enabled", false)
+	viper.SetDefault("migration.poll_interval", 30*time.Second)
+	viper.SetDefault("migration.request_timeout", 30*time.Minute)
+	viper.SetDefault("uploads.enabled", false)
+	viper.SetDefault("uploads.ttl", time.Hour)
+	viper.SetDefault("uploads.part_size", int64(64<<20))
+	viper.SetDefault("uploads.poll_interval", time.Minute)
+
+	viper.SetDefault("comments.enabled", false)
+	viper.SetDefault("comments.max_length", 10000)
+	viper.SetDefault("comments.count_property", true)
+
+	viper.SetDefault("tags.enabled", false)
+
+	viper.SetDefault("media.enabled", false)
+	viper.SetDefault("media.location", false)
+	viper.SetDefault("media.poll_interval", 10*time.Second)
 
 	// 优先从配置文件加载
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./config")
-	viper.AddConfigPath("/etc/webdav-gateway")
-	viper.AddConfigPath("$HOME/.webdav-gateway")
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./config")
+		viper.AddConfigPath("/etc/webdav-gateway")
+		viper.AddConfigPath("$HOME/.webdav-gateway")
+	}
 
 	// 从环境变量加载
 	viper.AutomaticEnv()
 
-	// 读取配置文件
-	if err := viper.ReadInConfig(); err == nil {
-		// 配置文件读取成功
-	} else if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-		// 配置文件未找到但有其他错误
+	// 读取配置文件，未找到时使用默认值
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
 	}
 
 	// 如果设置了环境变量，覆盖配置文件
@@ -162,6 +1251,30 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
+// ConfigFile 最近一次加载使用的配置文件路径，未找到配置文件时为空
+func ConfigFile() string {
+	return viper.ConfigFileUsed()
+}
+
+// UnknownKeys 检查配置文件中不对应任何配置项的键（多为拼写错误），每个配置节返回一条描述
+func UnknownKeys() []string {
+	var config Config
+	err := viper.UnmarshalExact(&config)
+	if err == nil {
+		return nil
+	}
+	var problems []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasPrefix(line, "* ") {
+			problems = append(problems, strings.TrimPrefix(line, "* "))
+		}
+	}
+	if len(problems) == 0 {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
 // setEnvOverrides 设置环境变量覆盖
 func setEnvOverrides() {
 	// 服务器配置
@@ -176,6 +1289,15 @@ func setEnvOverrides() {
 	if secret := os.Getenv("JWT_SECRET"); secret != "" {
 		viper.Set("auth.jwt_secret", secret)
 	}
+	if secretKey := os.Getenv("CRYPTO_SECRET_KEY"); secretKey != "" {
+		viper.Set("crypto.secret_key", secretKey)
+	}
+	if scimToken := os.Getenv("SCIM_TOKEN"); scimToken != "" {
+		viper.Set("auth.scim.token", scimToken)
+	}
+	if metricsToken := os.Getenv("METRICS_TOKEN"); metricsToken != "" {
+		viper.Set("metrics.token", metricsToken)
+	}
 
 	// MinIO配置
 	if endpoint := os.Getenv("MINIO_ENDPOINT"); endpoint != "" {
@@ -225,6 +1347,11 @@ func setEnvOverrides() {
 			viper.Set("cache.redis.db", db)
 		}
 	}
+
+	// 属性存储配置
+	if backend := os.Getenv("PROPERTIES_BACKEND"); backend != "" {
+		viper.Set("properties.backend", backend)
+	}
 }
 
 // GetDSN 获取数据库连接字符串
@@ -239,6 +1366,11 @@ func (c *Config) GetDSN() string {
 	}
 }
 
+// PostgresDSN 获取PostgreSQL连接字符串（与Database.Type无关）
+func (c *Config) PostgresDSN() string {
+	return buildPostgresDSN(c.Database.Postgres)
+}
+
 // buildPostgresDSN 构建PostgreSQL DSN
 func buildPostgresDSN(config PostgresConfig) string {
 	dsn := "host=" + config.Host
@@ -0,0 +1,426 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logLevels logging.level可用的级别（与logrus一致）
+var logLevels = []string{"panic", "fatal", "error", "warn", "warning", "info", "debug", "trace"}
+
+// Validate 检查配置项的取值，返回的错误包含所有问题，每个问题一行，以配置项名称开头。
+// 只检查配置本身，不连接数据库或存储
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		var names []string
+		for _, a := range allowed {
+			if a != "" {
+				names = append(names, a)
+			}
+		}
+		add(key, "unknown value %q, expected one of %s", value, strings.Join(names, ", "))
+	}
+	nonNegative := func(key string, d time.Duration) {
+		if d < 0 {
+			add(key, "must not be negative, got %s", d)
+		}
+	}
+
+	// 服务器
+	if c.Server.Address == "" {
+		add("server.address", "must not be empty")
+	}
+	oneOf("server.mode", c.Server.Mode, "", "debug", "release", "test")
+	nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	nonNegative("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	if c.Server.MaxConnections < 0 {
+		add("server.max_connections", "must not be negative")
+	}
+	if c.Server.HTTP2.H2C && c.Server.TLS.Enabled {
+		add("server.http2.h2c", "only applies without TLS, HTTP/2 over TLS is negotiated via ALPN")
+	}
+	nonNegative("server.shutdown.timeout", c.Server.Shutdown.Timeout)
+	if sd := c.Server.Shutdown; sd.MaxDrain > 0 && sd.MaxDrain < sd.Timeout {
+		add("server.shutdown.max_drain", "must not be less than server.shutdown.timeout (%s)", sd.Timeout)
+	}
+	if c.Server.Compression.MinSize < 0 {
+		add("server.compression.min_size", "must not be negative")
+	}
+	if level := c.Server.Compression.Level; level < 0 || level > 9 {
+		add("server.compression.level", "must be between 1 and 9, or 0 for the default level, got %d", level)
+	}
+	if tls := c.Server.TLS; tls.Enabled {
+		if tls.ACME.Enabled {
+			if len(tls.ACME.Domains) == 0 {
+				add("server.tls.acme.domains", "must not be empty when ACME is enabled")
+			}
+			for i, domain := range tls.ACME.Domains {
+				if domain == "" || strings.ContainsAny(domain, "*:/ ") {
+					add(fmt.Sprintf("server.tls.acme.domains[%d]", i), "%q is not a host name (wildcards are not supported by HTTP-01)", domain)
+				}
+			}
+			if tls.ACME.CacheDir == "" {
+				add("server.tls.acme.cache_dir", "must not be empty, certificates would be requested again on every start")
+			}
+			if tls.CertFile != "" || tls.KeyFile != "" {
+				add("server.tls", "cert_file/key_file and acme are mutually exclusive")
+			}
+		} else if tls.CertFile == "" || tls.KeyFile == "" {
+			add("server.tls", "cert_file and key_file are required when TLS is enabled")
+		}
+		if tls.RedirectAddress != "" && tls.RedirectAddress == c.Server.Address {
+			add("server.tls.redirect_address", "must differ from server.address")
+		}
+		nonNegative("server.tls.hsts.max_age", tls.HSTS.MaxAge)
+		if tls.HSTS.Preload && (!tls.HSTS.IncludeSubdomains || tls.HSTS.MaxAge < 365*24*time.Hour) {
+			add("server.tls.hsts.preload", "requires include_subdomains and a max_age of at least 8760h")
+		}
+	}
+	limits := c.Server.Limits
+	if limits.MaxUploadSize < 0 {
+		add("server.limits.max_upload_size", "must not be negative")
+	}
+	if limits.MaxBodySize < 0 {
+		add("server.limits.max_body_size", "must not be negative")
+	}
+	for i, user := range limits.Users {
+		if user.Username == "" {
+			add(fmt.Sprintf("server.limits.users[%d].username", i), "must not be empty")
+		}
+		if user.MaxUploadSize < 0 {
+			add(fmt.Sprintf("server.limits.users[%d].max_upload_size", i), "must not be negative")
+		}
+	}
+	nonNegative("server.limits.metadata_timeout", limits.MetadataTimeout)
+	nonNegative("server.limits.transfer_timeout", limits.TransferTimeout)
+	methods := make([]string, 0, len(limits.Timeouts))
+	for method := range limits.Timeouts {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if timeout := limits.Timeouts[method]; timeout <= 0 {
+			add("server.limits.timeouts."+method, "must be positive, got %s", timeout)
+		}
+	}
+
+	// 认证
+	if c.Auth.TokenExpiry <= 0 {
+		add("auth.token_expiry", "must be positive")
+	}
+	nonNegative("auth.clock_skew", c.Auth.ClockSkew)
+	if c.Auth.SCIM.Enabled && c.Auth.SCIM.Token == "" {
+		add("auth.scim.token", "is required when SCIM is enabled")
+	}
+	if c.Auth.SAML.Enabled && c.Auth.SAML.IDPMetadataURL == "" && c.Auth.SAML.IDPMetadataFile == "" {
+		add("auth.saml", "idp_metadata_url or idp_metadata_file is required when SAML is enabled")
+	}
+	if oidc := c.Auth.OIDC; oidc.Enabled {
+		if oidc.Issuer == "" || oidc.ClientID == "" {
+			add("auth.oidc", "issuer and client_id are required when OIDC is enabled")
+		}
+		if u, err := url.Parse(oidc.RootURL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("auth.oidc.root_url", "must be an absolute URL, got %q", oidc.RootURL)
+		}
+		if oidc.DefaultQuota < 0 {
+			add("auth.oidc.default_quota", "must not be negative")
+		}
+		for i, mapping := range oidc.GroupMapping {
+			if mapping.IDPGroup == "" || mapping.Group == "" {
+				add(fmt.Sprintf("auth.oidc.group_mapping[%d]", i), "idp_group and group are required")
+			}
+		}
+	}
+
+	if tf := c.Auth.TwoFactor; tf.Enabled {
+		oneOf("auth.two_factor.enforce", tf.Enforce, "", "off", "admins", "all")
+		if tf.ChallengeTTL <= 0 {
+			add("auth.two_factor.challenge_ttl", "must be positive")
+		}
+		if tf.MaxAttempts <= 0 {
+			add("auth.two_factor.max_attempts", "must be positive")
+		}
+		if tf.RecoveryCodes <= 0 {
+			add("auth.two_factor.recovery_codes", "must be positive")
+		}
+	}
+
+	if at := c.Auth.APITokens; at.Enabled {
+		if at.MaxPerUser <= 0 {
+			add("auth.api_tokens.max_per_user", "must be positive")
+		}
+		if at.MaxLifetime < 0 {
+			add("auth.api_tokens.max_lifetime", "must not be negative")
+		}
+	}
+
+	// 存储
+	oneOf("storage.type", c.Storage.Type, "", "minio", "s3", "local", "azure")
+	oneOf("storage.layout", c.Storage.Layout, "", "bucket_per_user", "shared_bucket")
+	if c.Storage.DeleteWorkers < 0 {
+		add("storage.delete_workers", "must not be negative")
+	}
+	switch c.Storage.Type {
+	case "local":
+		if c.Storage.Local.RootPath == "" {
+			add("storage.local.root_path", "is required for the local backend")
+		}
+	case "azure":
+		if c.Storage.Azure.AccountName == "" || c.Storage.Azure.AccountKey == "" {
+			add("storage.azure", "account_name and account_key are required for the azure backend")
+		}
+	default:
+		if c.Storage.MinIO.Endpoint == "" {
+			add("storage.minio.endpoint", "must not be empty")
+		}
+		if endpoint := c.Storage.MinIO.PublicEndpoint; endpoint != "" {
+			if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				add("storage.minio.public_endpoint", "must be an http(s) URL without a path, got %q", endpoint)
+			}
+		}
+	}
+	if dedup := c.Storage.Dedup; dedup.Enabled {
+		oneOf("storage.dedup.quota_policy", dedup.QuotaPolicy, "", "logical", "unique")
+		if dedup.MinSize < 0 {
+			add("storage.dedup.min_size", "must not be negative")
+		}
+		nonNegative("storage.dedup.sweep_interval", dedup.SweepInterval)
+		nonNegative("storage.dedup.grace", dedup.Grace)
+		if dedup.QuotaPolicy == "unique" && !c.Quota.Reconcile.Repair {
+			add("storage.dedup.quota_policy", "unique requires quota.reconcile.repair, usage is corrected by the reconciler")
+		}
+		if c.Uploads.Enabled {
+			add("storage.dedup.enabled", "cannot be combined with uploads.enabled, direct uploads bypass the gateway")
+		}
+	}
+	if uploads := c.Uploads; uploads.Enabled {
+		if c.Storage.Type == "local" || c.Storage.Type == "azure" {
+			add("uploads.enabled", "requires the minio or s3 storage backend")
+		}
+		if uploads.TTL <= 0 {
+			add("uploads.ttl", "must be positive")
+		}
+		if uploads.PartSize < 5<<20 {
+			add("uploads.part_size", "must be at least 5MiB (the S3 minimum part size), got %d", uploads.PartSize)
+		}
+		nonNegative("uploads.poll_interval", uploads.PollInterval)
+	}
+	if c.Media.Enabled {
+		nonNegative("media.poll_interval", c.Media.PollInterval)
+	}
+	if c.Comments.MaxLength < 0 {
+		add("comments.max_length", "must not be negative")
+	}
+	if redirect := c.Download.Redirect; redirect.Enabled {
+		if c.Storage.Type == "local" || c.Storage.Type == "azure" {
+			add("download.redirect.enabled", "requires the minio or s3 storage backend")
+		}
+		if redirect.TTL <= 0 {
+			add("download.redirect.ttl", "must be positive")
+		}
+		if redirect.MinSize < 0 {
+			add("download.redirect.min_size", "must not be negative")
+		}
+	}
+	oneOf("properties.backend", c.Properties.Backend, "", "sqlite", "postgres")
+	nonNegative("properties.cache.ttl", c.Properties.Cache.TTL)
+	nonNegative("properties.sqlite.busy_timeout", c.Properties.SQLite.BusyTimeout)
+	nonNegative("properties.sqlite.maintenance_interval", c.Properties.SQLite.MaintenanceInterval)
+	if t := c.Properties.SQLite.VacuumThreshold; t < 0 || t > 1 {
+		add("properties.sqlite.vacuum_threshold", "must be between 0 and 1, got %g", t)
+	}
+	if c.Properties.Cache.MaxEntries < 0 {
+		add("properties.cache.max_entries", "must not be negative")
+	}
+
+	// 配额
+	nonNegative("quota.reconcile.interval", c.Quota.Reconcile.Interval)
+	if usage := c.Quota.Usage; usage.Enabled {
+		if usage.Interval <= 0 {
+			add("quota.usage.interval", "must be positive")
+		}
+		nonNegative("quota.usage.rescan", usage.Rescan)
+		if usage.BatchSize <= 0 {
+			add("quota.usage.batch_size", "must be positive")
+		}
+		if usage.LargestFiles < 0 {
+			add("quota.usage.largest_files", "must not be negative")
+		}
+	}
+
+	// 批量操作
+	if c.Batch.MaxOperations < 0 {
+		add("batch.max_operations", "must not be negative")
+	}
+
+	nonNegative("archive.job_retention", c.Archive.JobRetention)
+
+	// 后台任务
+	jobs := c.Jobs
+	if jobs.Workers <= 0 {
+		add("jobs.workers", "must be positive")
+	}
+	if jobs.PollInterval <= 0 {
+		add("jobs.poll_interval", "must be positive")
+	} else if jobs.StaleAfter <= jobs.PollInterval {
+		add("jobs.stale_after", "must be longer than jobs.poll_interval (%s)", jobs.PollInterval)
+	}
+	nonNegative("jobs.retention", jobs.Retention)
+	if jobs.MaxActivePerUser < 0 {
+		add("jobs.max_active_per_user", "must not be negative")
+	}
+
+	// 账户注销与导出
+	nonNegative("account.deletion_grace_period", c.Account.DeletionGracePeriod)
+	nonNegative("account.purge_interval", c.Account.PurgeInterval)
+	if folder := c.Account.ExportFolder; folder == "/" || strings.Contains(folder, "..") {
+		add("account.export_folder", "must be a folder below the user's root, got %q", folder)
+	}
+
+	// 迁移
+	nonNegative("migration.poll_interval", c.Migration.PollInterval)
+	nonNegative("migration.request_timeout", c.Migration.RequestTimeout)
+
+	// 分享
+	nonNegative("share.stats.retention", c.Share.Stats.Retention)
+	if c.Share.Password.MinLength < 0 || c.Share.Password.MinLength > 72 {
+		add("share.password.min_length", "must be between 0 and 72, got %d", c.Share.Password.MinLength)
+	}
+	if links := c.Share.ShortLinks; links.Enabled {
+		if links.Length < 4 || links.Length > 32 {
+			add("share.short_links.length", "must be between 4 and 32, got %d", links.Length)
+		}
+		seen := map[rune]bool{}
+		for _, r := range links.Alphabet {
+			if seen[r] || !strings.ContainsRune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_", r) {
+				add("share.short_links.alphabet", "must consist of distinct letters, digits, - and _, got %q", links.Alphabet)
+				break
+			}
+			seen[r] = true
+		}
+		if len(links.Alphabet) < 16 {
+			add("share.short_links.alphabet", "must contain at least 16 characters")
+		}
+		if links.PublicURL != "" {
+			if u, err := url.Parse(links.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+				add("share.short_links.public_url", "%q is not an absolute URL", links.PublicURL)
+			}
+		}
+	}
+
+	// 多租户
+	if tenancy := c.Tenancy; tenancy.Enabled {
+		oneOf("tenancy.resolution", tenancy.Resolution, "subdomain", "path")
+		if tenancy.Resolution == "subdomain" && tenancy.BaseDomain == "" {
+			add("tenancy.base_domain", "is required for subdomain resolution")
+		}
+		if tenancy.Resolution == "path" && (!strings.HasPrefix(tenancy.PathPrefix, "/") || tenancy.PathPrefix == "/" || strings.HasSuffix(tenancy.PathPrefix, "/")) {
+			add("tenancy.path_prefix", "must start with / and not end with /, got %q", tenancy.PathPrefix)
+		}
+		if tenancy.DefaultQuota < 0 {
+			add("tenancy.default_quota", "must not be negative")
+		}
+	}
+
+	// 日志
+	if c.Logging.Level != "" {
+		oneOf("logging.level", strings.ToLower(c.Logging.Level), logLevels...)
+	}
+
+	// WebDAV
+	lockPolicy := c.WebDAV.LockPolicy
+	nonNegative("webdav.lock_policy.max_timeout", lockPolicy.MaxTimeout)
+	nonNegative("webdav.lock_policy.default_timeout", lockPolicy.DefaultTimeout)
+	nonNegative("webdav.lock_policy.idle_timeout", lockPolicy.IdleTimeout)
+	if lockPolicy.MaxTimeout > 0 && lockPolicy.DefaultTimeout > lockPolicy.MaxTimeout {
+		add("webdav.lock_policy.default_timeout", "%s exceeds max_timeout %s", lockPolicy.DefaultTimeout, lockPolicy.MaxTimeout)
+	}
+	if lockPolicy.MaxLocksPerUser < 0 {
+		add("webdav.lock_policy.max_locks_per_user", "must not be negative")
+	}
+	if c.WebDAV.MaxPathBytes < 0 {
+		add("webdav.max_path_bytes", "must not be negative")
+	}
+	if c.WebDAV.XML.MaxBodySize < 0 {
+		add("webdav.xml.max_body_size", "must not be negative")
+	}
+	if c.WebDAV.XML.MaxDepth < 0 {
+		add("webdav.xml.max_depth", "must not be negative")
+	}
+	propertyPolicy := c.WebDAV.PropertyPolicy
+	if propertyPolicy.MaxPropertiesPerResource < 0 {
+		add("webdav.property_policy.max_properties_per_resource", "must not be negative")
+	}
+	if propertyPolicy.MaxValueLength < 0 {
+		add("webdav.property_policy.max_value_length", "must not be negative")
+	}
+	for i, rule := range propertyPolicy.Namespaces {
+		key := fmt.Sprintf("webdav.property_policy.namespaces[%d]", i)
+		if rule.Namespace == "" {
+			add(key+".namespace", "must not be empty")
+		}
+		if rule.MaxValueLength < 0 {
+			add(key+".max_value_length", "must not be negative")
+		}
+		if rule.ValuePattern != "" {
+			if _, err := regexp.Compile(rule.ValuePattern); err != nil {
+				add(key+".value_pattern", "invalid pattern %q: %v", rule.ValuePattern, err)
+			}
+		}
+	}
+	oneOf("webdav.macos_compat.mode", c.WebDAV.MacOSCompat.Mode, "", "off", "reject", "hide")
+	for i, pattern := range c.WebDAV.MacOSCompat.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			add(fmt.Sprintf("webdav.macos_compat.patterns[%d]", i), "invalid pattern %q: %v", pattern, err)
+		}
+	}
+	nonNegative("webdav.idempotency.ttl", c.WebDAV.Idempotency.TTL)
+
+	// 带宽
+	if c.Bandwidth.UploadRate < 0 || c.Bandwidth.DownloadRate < 0 {
+		add("bandwidth", "upload_rate and download_rate must not be negative")
+	}
+
+	// 跨域
+	anyOrigin := len(c.CORS.AllowedOrigins) == 0
+	for i, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			add(fmt.Sprintf("cors.allowed_origins[%d]", i), "%q is not an origin like https://files.example.com", origin)
+			continue
+		}
+		// 通配符只能作为主机名的第一段，如https://*.example.com
+		if host := strings.TrimPrefix(u.Host, "*."); strings.Contains(host, "*") {
+			add(fmt.Sprintf("cors.allowed_origins[%d]", i), "%q: * is only allowed as the first label, like https://*.example.com", origin)
+		}
+	}
+	if c.CORS.Enabled && c.CORS.AllowCredentials && anyOrigin {
+		add("cors.allow_credentials", "requires explicit allowed_origins, * would expose credentials to any site")
+	}
+	nonNegative("cors.max_age", c.CORS.MaxAge)
+
+	nonNegative("health.timeout", c.Health.Timeout)
+
+	return errors.Join(errs...)
+}
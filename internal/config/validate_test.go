@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig 通过校验的最小配置
+func validConfig() *Config {
+	return &Config{
+		Server:  ServerConfig{Address: ":8080", Mode: "release"},
+		Auth:    AuthConfig{TokenExpiry: time.Hour},
+		Storage: StorageConfig{Type: "minio", MinIO: MinIOConfig{Endpoint: "localhost:9000"}},
+		Logging: LoggingConfig{Level: "info"},
+		WebDAV: WebDAVConfig{
+			LockPolicy:  LockPolicyConfig{MaxTimeout: 24 * time.Hour, DefaultTimeout: time.Hour},
+			MacOSCompat: MacOSCompatConfig{Mode: "hide", Patterns: []string{"._*", ".DS_Store"}},
+		},
+		CORS: CORSConfig{Enabled: true, AllowedOrigins: []string{"https://files.example.com"}},
+		Jobs: JobsConfig{Workers: 4, PollInterval: 2 * time.Second, StaleAfter: 5 * time.Minute},
+	}
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Server.Mode = "production"
+	cfg.Storage.Type = "local"
+	cfg.Logging.Level = "verbose"
+	cfg.WebDAV.LockPolicy.DefaultTimeout = 48 * time.Hour
+	cfg.WebDAV.MacOSCompat.Patterns = []string{"[._*"}
+	cfg.WebDAV.PropertyPolicy.Namespaces = []NamespacePolicyConfig{{Namespace: "urn:example", ValuePattern: "("}}
+	cfg.CORS.AllowedOrigins = []string{"files.example.com"}
+	cfg.Server.Limits.Timeouts = map[string]time.Duration{"put": 0}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, key := range []string{
+		"server.mode",
+		"storage.local.root_path",
+		"logging.level",
+		"webdav.lock_policy.default_timeout",
+		"webdav.macos_compat.patterns[0]",
+		"webdav.property_policy.namespaces[0].value_pattern",
+		"cors.allowed_origins[0]",
+		"server.limits.timeouts.put",
+	} {
+		if !strings.Contains(err.Error(), key+": ") {
+			t.Errorf("error does not mention %s:\n%v", key, err)
+		}
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != 8 {
+		t.Errorf("got %d problems, want 8:\n%v", lines, err)
+	}
+}
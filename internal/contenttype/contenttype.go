@@ -0,0 +1,168 @@
+// Package contenttype 按文件扩展名和内容开头的特征字节判断上传文件的类型
+package contenttype
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Default 无法判断类型时使用的类型
+const Default = "application/octet-stream"
+
+// SniffLen 内容检测读取的字节数，与http.DetectContentType一致
+const SniffLen = 512
+
+// extensionTypes 常用文件的类型。mime.TypeByExtension依赖系统的mime.types，容器镜像中通常没有，
+// 这里列出的扩展名在任何部署中结果一致
+var extensionTypes = map[string]string{
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".log":  "text/plain; charset=utf-8",
+	".ics":  "text/calendar; charset=utf-8",
+	".vcf":  "text/vcard; charset=utf-8",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".epub": "application/epub+zip",
+	".zip":  "application/zip",
+	".gz":   "application/gzip",
+	".tgz":  "application/gzip",
+	".tar":  "application/x-tar",
+	".7z":   "application/x-7z-compressed",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".bmp":  "image/bmp",
+	".ico":  "image/vnd.microsoft.icon",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+}
+
+// genericTypes 客户端声明的这些类型不说明文件的实际类型，按未声明处理
+var genericTypes = map[string]bool{
+	"":                                  true,
+	"application/octet-stream":          true,
+	"binary/octet-stream":               true,
+	"application/x-www-form-urlencoded": true, // curl --data-binary的默认值
+}
+
+// 用量统计中的文件类别
+const (
+	CategoryImages    = "images"
+	CategoryVideo     = "video"
+	CategoryAudio     = "audio"
+	CategoryDocuments = "documents"
+	CategoryArchives  = "archives"
+	CategoryOther     = "other"
+)
+
+// archiveTypes 归类为压缩包的类型
+var archiveTypes = map[string]bool{
+	"application/zip":             true,
+	"application/gzip":            true,
+	"application/x-tar":           true,
+	"application/x-7z-compressed": true,
+}
+
+// ByExtension 按扩展名判断类型，无法识别时返回空字符串
+func ByExtension(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := extensionTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// IsGeneric 判断客户端声明的类型是否需要重新检测
+func IsGeneric(declared string) bool {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return strings.TrimSpace(declared) == ""
+	}
+	return genericTypes[mediaType]
+}
+
+// Detect 根据文件名和内容开头的字节判断类型。扩展名能识别时以扩展名为准：
+// 内容检测对.docx、.epub只能识别出zip，对.svg只能识别出XML，而且不能让内容像HTML的.txt文件按HTML返回。
+// 没有扩展名或无法识别时按内容判断，内容为空时返回Default
+func Detect(name string, head []byte) string {
+	if byExt := ByExtension(name); byExt != "" {
+		return byExt
+	}
+	if len(head) == 0 {
+		return Default
+	}
+	return http.DetectContentType(head)
+}
+
+// Sniff 读取r开头最多SniffLen字节判断类型，返回的Reader仍从头输出全部内容。
+// 读取出错时返回该错误，已读取的内容不可恢复
+func Sniff(name string, r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return Detect(name, head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// Resolve 返回展示给客户端的类型：存储的类型缺失或为通用类型时（如检测上线前上传的文件）按扩展名补全
+func Resolve(name, stored string) string {
+	if !IsGeneric(stored) {
+		return stored
+	}
+	if t := ByExtension(name); t != "" {
+		return t
+	}
+	return Default
+}
+
+// Category 按扩展名把文件归入图片、视频、音频、文档、压缩包或其他，用于用量统计
+func Category(name string) string {
+	mediaType, _, _ := mime.ParseMediaType(ByExtension(name))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return CategoryImages
+	case strings.HasPrefix(mediaType, "video/"):
+		return CategoryVideo
+	case strings.HasPrefix(mediaType, "audio/"):
+		return CategoryAudio
+	case archiveTypes[mediaType]:
+		return CategoryArchives
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/pdf",
+		mediaType == "application/msword",
+		mediaType == "application/epub+zip",
+		strings.HasPrefix(mediaType, "application/vnd.ms-"),
+		strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument."),
+		strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument."):
+		return CategoryDocuments
+	}
+	return CategoryOther
+}
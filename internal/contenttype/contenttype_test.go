@@ -0,0 +1,105 @@
+package contenttype
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"report.docx", []byte("PK\x03\x04"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"notes.txt", []byte("<html><body>hi</body></html>"), "text/plain; charset=utf-8"},
+		{"Photo.PNG", pngHeader, "image/png"},
+		{"scan", pngHeader, "image/png"},
+		{"scan.unknownext", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"README", []byte("plain words\n"), "text/plain; charset=utf-8"},
+		{"empty", nil, Default},
+		{"blob", []byte{0x00, 0x01, 0x02, 0x03}, Default},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.name, tt.head); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsGeneric(t *testing.T) {
+	for _, declared := range []string{"", " ", "application/octet-stream", "Application/Octet-Stream", "binary/octet-stream", "application/x-www-form-urlencoded"} {
+		if !IsGeneric(declared) {
+			t.Errorf("IsGeneric(%q) = false", declared)
+		}
+	}
+	for _, declared := range []string{"image/png", "text/plain; charset=utf-8", "not a type"} {
+		if IsGeneric(declared) {
+			t.Errorf("IsGeneric(%q) = true", declared)
+		}
+	}
+}
+
+func TestSniffPreservesContent(t *testing.T) {
+	content := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0xAB}, 2*SniffLen)...)
+	for _, size := range []int{0, 10, SniffLen, len(content)} {
+		got, r, err := Sniff("upload", bytes.NewReader(content[:size]))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		data, _ := io.ReadAll(r)
+		if !bytes.Equal(data, content[:size]) {
+			t.Errorf("size %d: content changed after sniffing", size)
+		}
+		if size >= len(pngHeader) && got != "image/png" {
+			t.Errorf("size %d: type = %q, want image/png", size, got)
+		}
+	}
+
+	if _, _, err := Sniff("upload", io.MultiReader(strings.NewReader("abc"), errReader{})); err == nil {
+		t.Error("read error not returned")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	if got := Resolve("/a/sheet.xlsx", "application/octet-stream"); got != extensionTypes[".xlsx"] {
+		t.Errorf("legacy octet-stream object resolved to %q", got)
+	}
+	if got := Resolve("/a/photo.jpg", "image/webp"); got != "image/webp" {
+		t.Errorf("stored type overridden: %q", got)
+	}
+	if got := Resolve("/a/blob", ""); got != Default {
+		t.Errorf("unknown file resolved to %q", got)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestCategory(t *testing.T) {
+	tests := map[string]string{
+		"IMG_0001.HEIC":     CategoryImages,
+		"photo.jpg":         CategoryImages,
+		"clip.mov":          CategoryVideo,
+		"song.flac":         CategoryAudio,
+		"report.docx":       CategoryDocuments,
+		"slides.odp":        CategoryDocuments,
+		"paper.pdf":         CategoryDocuments,
+		"notes.md":          CategoryDocuments,
+		"backup.tar":        CategoryArchives,
+		"site.tgz":          CategoryArchives,
+		"book.epub":         CategoryDocuments,
+		"Makefile":          CategoryOther,
+		"disk.img.unknown1": CategoryOther,
+	}
+	for name, want := range tests {
+		if got := Category(name); got != want {
+			t.Errorf("Category(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
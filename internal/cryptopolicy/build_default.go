@@ -0,0 +1,6 @@
+//go:build !fips
+
+package cryptopolicy
+
+// fipsBuild 默认构建由crypto.approved_only决定是否限制算法
+const fipsBuild = false
@@ -0,0 +1,6 @@
+//go:build fips
+
+package cryptopolicy
+
+// fipsBuild 以fips标签构建时强制只使用经批准的算法，配置无法关闭
+const fipsBuild = true
@@ -0,0 +1,107 @@
+package cryptopolicy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// pbkdf2Prefix PBKDF2哈希格式：$pbkdf2-sha256$<迭代次数>$<盐>$<摘要>（无填充Base64）
+	pbkdf2Prefix  = "$pbkdf2-sha256$"
+	pbkdf2SaltLen = 16
+	pbkdf2KeyLen  = sha256.Size
+)
+
+var (
+	// ErrPasswordMismatch 密码不匹配
+	ErrPasswordMismatch = errors.New("password does not match")
+	// ErrUnknownHash 无法识别的密码哈希格式
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// HashPassword 生成密码哈希：受限模式使用PBKDF2-HMAC-SHA256，否则使用bcrypt
+func HashPassword(password string) (string, error) {
+	if !ApprovedOnly() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, pbkdf2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	iterations := int(pbkdf2Iterations.Load())
+	key := pbkdf2.Key([]byte(password), salt, iterations, pbkdf2KeyLen, sha256.New)
+
+	return fmt.Sprintf("%s%d$%s$%s", pbkdf2Prefix, iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// ComparePassword 校验密码，根据哈希前缀识别格式。受限模式下已有的bcrypt哈希
+// 仍可校验（SP 800-131A的legacy use），用户修改密码后即改为PBKDF2
+func ComparePassword(hash, password string) error {
+	if strings.HasPrefix(hash, pbkdf2Prefix) {
+		return comparePBKDF2(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrPasswordMismatch
+	default:
+		return ErrUnknownHash
+	}
+}
+
+// IsHash 判断字符串是否为HashPassword生成的密码哈希（bcrypt或PBKDF2），
+// 用于识别早期以明文保存、需要迁移的密码
+func IsHash(value string) bool {
+	if strings.HasPrefix(value, pbkdf2Prefix) {
+		return true
+	}
+	if _, err := bcrypt.Cost([]byte(value)); err == nil {
+		return true
+	}
+	return false
+}
+
+// comparePBKDF2 以常数时间比较PBKDF2摘要
+func comparePBKDF2(hash, password string) error {
+	parts := strings.Split(strings.TrimPrefix(hash, pbkdf2Prefix), "$")
+	if len(parts) != 3 {
+		return ErrUnknownHash
+	}
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations <= 0 {
+		return ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrUnknownHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(want) == 0 {
+		return ErrUnknownHash
+	}
+
+	got := pbkdf2.Key([]byte(password), salt, iterations, len(want), sha256.New)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package cryptopolicy 进程级的密码算法策略。开启crypto.approved_only或以fips标签构建时，
+// 令牌签名、密码哈希、校验值和TLS只使用经批准的算法（FIPS 140-3 / SP 800系列）
+package cryptopolicy
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// DefaultPBKDF2Iterations PBKDF2-HMAC-SHA256的默认迭代次数（OWASP 2023建议值）
+	DefaultPBKDF2Iterations = 600000
+	// minPBKDF2Iterations 允许配置的最小迭代次数
+	minPBKDF2Iterations = 100000
+	// MinJWTSecretLength 受限模式下HMAC签名密钥的最小字节数（不低于SHA-256输出长度）
+	MinJWTSecretLength = 32
+)
+
+var (
+	approvedOnly     atomic.Bool
+	pbkdf2Iterations atomic.Int64
+)
+
+func init() {
+	approvedOnly.Store(fipsBuild)
+	pbkdf2Iterations.Store(DefaultPBKDF2Iterations)
+}
+
+// Configure 应用配置中的算法策略，应在启动时、处理请求前调用一次
+func Configure(cfg config.CryptoConfig) error {
+	iterations := cfg.PBKDF2Iterations
+	if iterations == 0 {
+		iterations = DefaultPBKDF2Iterations
+	}
+	if iterations < minPBKDF2Iterations {
+		return fmt.Errorf("crypto.pbkdf2_iterations must be at least %d", minPBKDF2Iterations)
+	}
+
+	pbkdf2Iterations.Store(int64(iterations))
+	approvedOnly.Store(fipsBuild || cfg.ApprovedOnly)
+	return nil
+}
+
+// ApprovedOnly 是否只允许使用经批准的算法
+func ApprovedOnly() bool {
+	return approvedOnly.Load()
+}
+
+// FIPSBuild 是否以fips标签构建
+func FIPSBuild() bool {
+	return fipsBuild
+}
+
+// ValidateJWTSecret 受限模式下检查HMAC签名密钥长度
+func ValidateJWTSecret(secret string) error {
+	if ApprovedOnly() && len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("auth.jwt_secret must be at least %d bytes in approved-crypto mode", MinJWTSecretLength)
+	}
+	return nil
+}
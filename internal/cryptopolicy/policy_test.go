@@ -0,0 +1,91 @@
+package cryptopolicy
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// withApprovedOnly 在测试期间切换算法策略
+func withApprovedOnly(t *testing.T, enabled bool) {
+	t.Helper()
+	if err := Configure(config.CryptoConfig{ApprovedOnly: enabled, PBKDF2Iterations: minPBKDF2Iterations}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	t.Cleanup(func() {
+		approvedOnly.Store(fipsBuild)
+		pbkdf2Iterations.Store(DefaultPBKDF2Iterations)
+	})
+}
+
+func TestPasswordHashing(t *testing.T) {
+	withApprovedOnly(t, false)
+	legacy, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !fipsBuild && strings.HasPrefix(legacy, pbkdf2Prefix) {
+		t.Errorf("默认模式应使用bcrypt，得到 %q", legacy)
+	}
+
+	withApprovedOnly(t, true)
+	approved, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(approved, pbkdf2Prefix+"100000$") {
+		t.Errorf("受限模式应使用PBKDF2，得到 %q", approved)
+	}
+
+	for _, hash := range []string{legacy, approved} {
+		if !IsHash(hash) {
+			t.Errorf("IsHash(%q) = false", hash)
+		}
+		if err := ComparePassword(hash, "correct horse"); err != nil {
+			t.Errorf("ComparePassword(%q) error = %v", hash, err)
+		}
+		if err := ComparePassword(hash, "wrong"); err != ErrPasswordMismatch {
+			t.Errorf("ComparePassword(%q, wrong) error = %v, want ErrPasswordMismatch", hash, err)
+		}
+	}
+
+	if IsHash("correct horse") || IsHash("$2a$10$short") {
+		t.Error("IsHash() 不应把明文识别为哈希")
+	}
+
+	if err := ComparePassword(pbkdf2Prefix+"abc$$", "x"); err != ErrUnknownHash {
+		t.Errorf("ComparePassword(malformed) error = %v, want ErrUnknownHash", err)
+	}
+}
+
+func TestConfigureRejectsWeakIterations(t *testing.T) {
+	if err := Configure(config.CryptoConfig{PBKDF2Iterations: 1000}); err == nil {
+		t.Error("Configure() 应拒绝过低的迭代次数")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	withApprovedOnly(t, true)
+
+	cfg, err := TLSConfig(config.TLSConfig{})
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || len(cfg.CipherSuites) != len(approvedCipherSuites) {
+		t.Errorf("受限模式默认应为TLS 1.2 + 经批准的套件，得到 %x %v", cfg.MinVersion, cfg.CipherSuites)
+	}
+
+	if _, err := TLSConfig(config.TLSConfig{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"}}); err == nil {
+		t.Error("受限模式应拒绝ChaCha20套件")
+	}
+	if _, err := TLSConfig(config.TLSConfig{MinVersion: "1.0"}); err == nil {
+		t.Error("应拒绝TLS 1.0")
+	}
+
+	cfg, err = TLSConfig(config.TLSConfig{MinVersion: "1.3"})
+	if err != nil || cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("TLSConfig(1.3) = %v, %v", cfg, err)
+	}
+}
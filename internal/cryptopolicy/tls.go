@@ -0,0 +1,78 @@
+package cryptopolicy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// approvedCipherSuites 受限模式下TLS 1.2允许的套件：ECDHE密钥交换 + AES-GCM
+var approvedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// TLSConfig 根据server.tls配置生成TLS策略。TLS 1.3的套件由Go运行时决定，
+// 需要经认证的实现时应使用FIPS工具链构建（见make build-fips）
+func TLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	switch strings.TrimSpace(cfg.MinVersion) {
+	case "", "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported server.tls.min_version %q, expected 1.2 or 1.3", cfg.MinVersion)
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		suites, err := parseCipherSuites(cfg.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	} else if ApprovedOnly() {
+		tlsConfig.CipherSuites = approvedCipherSuites
+	}
+
+	if ApprovedOnly() {
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	}
+	return tlsConfig, nil
+}
+
+// parseCipherSuites 按名称解析套件，拒绝Go标记为不安全的套件，受限模式下只接受经批准的套件
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		if ApprovedOnly() && !isApprovedCipherSuite(id) {
+			return nil, fmt.Errorf("cipher suite %q is not allowed in approved-crypto mode", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+func isApprovedCipherSuite(id uint16) bool {
+	for _, approved := range approvedCipherSuites {
+		if id == approved {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Package davpath 统一资源路径的规范形式。Windows客户端发送NFC、macOS发送NFD，
+// Destination头和请求路径的百分号编码方式也各不相同，看起来相同的名称会被当作不同的资源。
+// 所有进入存储和属性库的路径都经过这里：解码、NFC规范化、消除..并限制长度
+package davpath
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultMaxLength 未配置时路径的最大字节数，与S3对象键的上限一致
+const DefaultMaxLength = 1024
+
+var (
+	// ErrInvalidPath 路径不是合法的UTF-8、包含NUL或无法解码（400）
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrPathTooLong 规范化后的路径超出长度上限（414）
+	ErrPathTooLong = errors.New("path too long")
+)
+
+// Clean 返回以/开头、不带结尾/的规范路径：名称转换为NFC，.和..按目录层级消除，不会超出根目录
+func Clean(p string) string {
+	return path.Clean("/" + norm.NFC.String(p))
+}
+
+// Normalize 校验并规范化已解码的路径，结尾的/（集合）保留。maxLength为规范化后的最大字节数，
+// 0表示使用DefaultMaxLength，负数表示不限制
+func Normalize(p string, maxLength int) (string, error) {
+	if !utf8.ValidString(p) || strings.ContainsRune(p, 0) {
+		return "", ErrInvalidPath
+	}
+	cleaned := Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if maxLength == 0 {
+		maxLength = DefaultMaxLength
+	}
+	if maxLength > 0 && len(cleaned) > maxLength {
+		return "", ErrPathTooLong
+	}
+	return cleaned, nil
+}
+
+// FromURL 把Destination等头中的绝对URL或绝对路径转换为用户文件树中的路径：
+// 百分号解码一次，去掉路由前缀（如/webdav），再按Normalize规范化。
+// 请求路径本身已由net/http解码一次，直接使用Normalize
+func FromURL(raw, prefix string, maxLength int) (string, error) {
+	raw = strings.TrimSpace(raw)
+	// 没有正确编码的路径（如名称中直接出现%）按原样使用
+	p := raw
+	if u, err := url.Parse(raw); err == nil {
+		p = u.Path
+	} else if !strings.HasPrefix(raw, "/") {
+		return "", ErrInvalidPath
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && (p == prefix || strings.HasPrefix(p, prefix+"/")) {
+		p = strings.TrimPrefix(p, prefix)
+	}
+	return Normalize(p, maxLength)
+}
@@ -0,0 +1,107 @@
+package davpath
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{"nfd to nfc", "/docs/cafe\u0301.txt", "/docs/caf\u00e9.txt", nil},
+		{"hangul jamo", "/\u1112\u1161\u11ab.txt", "/\ud55c.txt", nil},
+		{"already nfc", "/docs/caf\u00e9.txt", "/docs/caf\u00e9.txt", nil},
+		{"collection keeps slash", "/photos/2024/", "/photos/2024/", nil},
+		{"root", "", "/", nil},
+		{"root slash", "/", "/", nil},
+		{"dot segments", "/a/./b//c/../d.txt", "/a/b/d.txt", nil},
+		{"traversal stays in root", "/../../etc/passwd", "/etc/passwd", nil},
+		{"relative traversal", "../x", "/x", nil},
+		{"literal percent", "/100%.txt", "/100%.txt", nil},
+		{"emoji", "/\U0001F600 notes.md", "/\U0001F600 notes.md", nil},
+		{"nul", "/a\x00b", "", ErrInvalidPath},
+		{"invalid utf-8", "/a\xffb", "", ErrInvalidPath},
+		{"too long", "/" + strings.Repeat("a", DefaultMaxLength), "", ErrPathTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.in, 0)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// 长度按规范化后的字节数计算，负数表示不限制
+	_, err := Normalize("/"+strings.Repeat("a", DefaultMaxLength), -1)
+	assert.NoError(t, err)
+	_, err = Normalize("/abcdef", 4)
+	assert.ErrorIs(t, err, ErrPathTooLong)
+}
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"absolute url", "https://dav.example.com/webdav/My%20Files/a.txt", "/My Files/a.txt"},
+		{"path only", "/webdav/docs/", "/docs/"},
+		{"without prefix", "/docs/a.txt", "/docs/a.txt"},
+		{"prefix is a name prefix", "/webdav2/a.txt", "/webdav2/a.txt"},
+		{"prefix root", "/webdav", "/"},
+		{"nfd encoded", "/webdav/cafe%CC%81.txt", "/caf\u00e9.txt"},
+		{"mixed encoding", "/webdav/caf%C3%A9 %E6%96%87%E6%A1%A3.txt", "/caf\u00e9 文档.txt"},
+		{"decoded only once", "/webdav/a%2520b.txt", "/a%20b.txt"},
+		{"unencoded percent", "/webdav/100%.txt", "/100%.txt"},
+		{"traversal", "http://host/webdav/a/%2E%2E/%2E%2E/b.txt", "/b.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromURL(tt.in, "/webdav", 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := FromURL("http://host/webdav/a%00b", "/webdav", 0)
+	assert.ErrorIs(t, err, ErrInvalidPath)
+}
+
+// 客户端按任意一种规范化形式编码名称，经过Destination或请求路径都得到同一个规范路径
+func TestRoundTrip(t *testing.T) {
+	names := []string{
+		"café.txt",
+		"café.txt",
+		"100% done #1?.txt",
+		"a+b & c=d;e.txt",
+		"Ångström/가.md",
+		"\U0001F4C1 folder/",
+		"spaces  and\ttabs.txt",
+	}
+	for _, name := range names {
+		fromPath, err := Normalize("/"+name, 0)
+		require.NoError(t, err, name)
+
+		escaped := (&url.URL{Path: "/webdav/" + name}).EscapedPath()
+		fromURL, err := FromURL("https://dav.example.com"+escaped, "/webdav", 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, fromPath, fromURL, name)
+
+		again, err := Normalize(fromPath, 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, fromPath, again, "normalization must be idempotent for %q", name)
+	}
+	assert.Equal(t, Clean("/café.txt"), Clean("/café.txt"))
+}
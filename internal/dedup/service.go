@@ -0,0 +1,334 @@
+// Package dedup 按内容去重的引用计数：存储中相同内容只保存一份blob，dedup_blobs表记录每个blob
+// 被多少个文件引用。计数归零的blob在宽限期后由后台清理删除，宽限期内重新上传相同内容时直接复用
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// sweepBatchSize 每个清理事务删除的blob数
+const sweepBatchSize = 100
+
+// Stats 去重的存储统计
+type Stats struct {
+	// Blobs 仍被引用的blob数
+	Blobs int64 `json:"blobs"`
+	// References 引用blob的文件数
+	References int64 `json:"references"`
+	// StoredBytes blob实际占用的字节数
+	StoredBytes int64 `json:"stored_bytes"`
+	// LogicalBytes 引用blob的文件按各自大小合计的字节数
+	LogicalBytes int64 `json:"logical_bytes"`
+	// SavedBytes 去重节省的字节数
+	SavedBytes int64 `json:"saved_bytes"`
+	// PendingDeletion 引用计数已归零、等待宽限期结束后删除的blob数
+	PendingDeletion int64 `json:"pending_deletion"`
+}
+
+// Service 维护blob的引用计数并清理不再被引用的blob，实现storage.BlobRefs
+type Service struct {
+	db      *sql.DB
+	storage *storage.Service
+	config  config.DedupConfig
+	now     func() time.Time
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewService 创建去重服务
+func NewService(db *sql.DB, storageService *storage.Service, cfg config.DedupConfig) *Service {
+	return &Service{
+		db:      db,
+		storage: storageService,
+		config:  cfg,
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Initialize 创建引用计数表
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS dedup_blobs (
+			hash CHAR(64) PRIMARY KEY,
+			size BIGINT NOT NULL,
+			refs BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			released_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_dedup_blobs_released ON dedup_blobs(released_at) WHERE refs = 0`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize dedup tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// Acquire 为内容增加一个引用，等待删除的blob重新被引用后不再删除
+func (s *Service) Acquire(ctx context.Context, hash string, size int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO dedup_blobs (hash, size, refs) VALUES ($1, $2, 1)
+		ON CONFLICT (hash) DO UPDATE SET refs = dedup_blobs.refs + 1, released_at = NULL`,
+		hash, size)
+	return err
+}
+
+// Release 减少一个引用，计数归零时记录时间，宽限期结束后删除blob。计数不会小于0
+func (s *Service) Release(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE dedup_blobs SET refs = refs - 1,
+			released_at = CASE WHEN refs = 1 THEN $1 ELSE released_at END
+		WHERE hash = $2 AND refs > 0`,
+		s.now(), hash)
+	return err
+}
+
+// Stats 返回去重的存储统计
+func (s *Service) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE refs > 0),
+			COALESCE(SUM(refs), 0),
+			COALESCE(SUM(size) FILTER (WHERE refs > 0), 0),
+			COALESCE(SUM(size * refs), 0),
+			COUNT(*) FILTER (WHERE refs = 0)
+		FROM dedup_blobs`).Scan(&stats.Blobs, &stats.References, &stats.StoredBytes, &stats.LogicalBytes, &stats.PendingDeletion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dedup stats: %w", err)
+	}
+	stats.SavedBytes = stats.LogicalBytes - stats.StoredBytes
+	return &stats, nil
+}
+
+// Start 启动定期清理，SweepInterval不大于0时不启动
+func (s *Service) Start() {
+	if s.config.SweepInterval <= 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.SweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if n, err := s.Sweep(context.Background()); err != nil {
+					log.Printf("Warning: dedup sweep failed: %v", err)
+				} else if n > 0 {
+					log.Printf("Removed %d unreferenced dedup blobs", n)
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定期清理
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	s.wg.Wait()
+}
+
+// Sweep 删除引用计数归零超过宽限期的blob和遗留的临时上传，返回删除的blob数。
+// 每批blob在持有行锁的事务中删除，同时上传相同内容的请求等待事务结束后重新写入blob
+func (s *Service) Sweep(ctx context.Context) (int, error) {
+	before := s.now().Add(-s.config.Grace)
+	if _, err := s.storage.RemoveStaleBlobUploads(ctx, before); err != nil {
+		return 0, fmt.Errorf("remove stale uploads: %w", err)
+	}
+
+	removed := 0
+	for {
+		n, err := s.sweepBatch(ctx, before)
+		removed += n
+		if err != nil || n < sweepBatchSize {
+			return removed, err
+		}
+	}
+}
+
+func (s *Service) sweepBatch(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT hash FROM dedup_blobs
+		WHERE refs = 0 AND released_at < $1
+		ORDER BY released_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`,
+		before, sweepBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(hashes) == 0 {
+		return 0, err
+	}
+
+	if err := s.storage.RemoveBlobs(ctx, hashes); err != nil {
+		return 0, fmt.Errorf("remove blobs: %w", err)
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM dedup_blobs WHERE hash = $1`, hash); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(hashes), nil
+}
+
+// ScanResult 一次已有数据去重的结果
+type ScanResult struct {
+	Users int `json:"users"`
+	// Objects 检查的文件数
+	Objects int64 `json:"objects"`
+	// Converted 转换为指针的文件数和字节数
+	Converted      int64 `json:"converted"`
+	ConvertedBytes int64 `json:"converted_bytes"`
+	// Failed 转换失败的文件数，下次运行时重试
+	Failed int64 `json:"failed"`
+	// Repaired 引用计数少于实际引用、已修正的blob数
+	Repaired int64 `json:"repaired"`
+	// Overcounted 引用计数多于实际引用的blob数，这些blob不会被删除，只占用空间
+	Overcounted int64 `json:"overcounted"`
+}
+
+// Scan 遍历所有用户的文件，把去重启用前写入的文件转换为指针，并按实际的指针数核对引用计数。
+// 遍历期间的并发写入可能使核对结果偏大，所以只调高偏少的计数，偏多的计数只报告，不会误删blob。
+// 可以重复执行，progress报告已处理的用户数和用户总数
+func (s *Service) Scan(ctx context.Context, progress func(done, total int)) (*ScanResult, error) {
+	result := &ScanResult{}
+	userIDs, err := s.listUsers(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	type reference struct {
+		count int64
+		size  int64
+	}
+	references := make(map[string]*reference)
+	for i, userID := range userIDs {
+		err := s.storage.WalkObjects(ctx, userID, "", true, func(object minio.ObjectInfo) error {
+			if strings.HasSuffix(object.Key, "/") {
+				return nil
+			}
+			result.Objects++
+			hash := storage.BlobHash(object)
+			if hash == "" {
+				var err error
+				if hash, err = s.storage.DedupObject(ctx, userID, object); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					log.Printf("Warning: failed to deduplicate %s for user %s: %v", object.Key, userID, err)
+					result.Failed++
+					return nil
+				}
+				if hash == "" {
+					return nil
+				}
+				result.Converted++
+				result.ConvertedBytes += object.Size
+			}
+			ref := references[hash]
+			if ref == nil {
+				ref = &reference{size: object.Size}
+				references[hash] = ref
+			}
+			ref.count++
+			return nil
+		})
+		if err != nil && !storage.IsNotFound(err) {
+			return result, fmt.Errorf("scan user %s: %w", userID, err)
+		}
+		result.Users++
+		if progress != nil {
+			progress(i+1, len(userIDs))
+		}
+	}
+
+	for hash, ref := range references {
+		res, err := s.db.ExecContext(ctx, `
+			INSERT INTO dedup_blobs (hash, size, refs) VALUES ($1, $2, $3)
+			ON CONFLICT (hash) DO UPDATE SET refs = EXCLUDED.refs, released_at = NULL
+			WHERE dedup_blobs.refs < EXCLUDED.refs`,
+			hash, ref.size, ref.count)
+		if err != nil {
+			return result, fmt.Errorf("repair references: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Repaired++
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT hash, refs FROM dedup_blobs WHERE refs > 0`)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		var refs int64
+		if err := rows.Scan(&hash, &refs); err != nil {
+			return result, err
+		}
+		if ref := references[hash]; ref == nil || refs > ref.count {
+			result.Overcounted++
+		}
+	}
+	return result, rows.Err()
+}
+
+func (s *Service) listUsers(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
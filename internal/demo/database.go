@@ -0,0 +1,147 @@
+package demo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName 注册的SQLite驱动，补充服务SQL中用到的PostgreSQL函数
+const driverName = "sqlite3_demo"
+
+var registerOnce sync.Once
+
+// addColumnIfNotExists SQLite不支持ADD COLUMN IF NOT EXISTS，改为普通ADD COLUMN并忽略列已存在的错误
+var addColumnIfNotExists = regexp.MustCompile(`(?i)ADD\s+COLUMN\s+IF\s+NOT\s+EXISTS`)
+
+// alterConstraint SQLite不支持修改表约束，演示表创建时已包含最终的约束，直接跳过
+var alterConstraint = regexp.MustCompile(`(?i)^\s*ALTER\s+TABLE\s+\S+\s+(ADD|DROP)\s+CONSTRAINT\b`)
+
+// schema 演示模式使用的核心表，与deployments/docker/schema.sql中的定义对应
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT UNIQUE NOT NULL,
+		email TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		display_name TEXT,
+		storage_quota BIGINT DEFAULT 10737418240,
+		storage_used BIGINT DEFAULT 0,
+		status TEXT DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'deleted')),
+		tokens_valid_after TIMESTAMP,
+		deletion_requested_at TIMESTAMP,
+		purge_after TIMESTAMP,
+		password_reset_required BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS file_shares (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		file_path TEXT NOT NULL,
+		share_token TEXT UNIQUE NOT NULL,
+		share_name TEXT,
+		password_hash TEXT,
+		expires_at TIMESTAMP,
+		max_downloads INTEGER,
+		download_count INTEGER DEFAULT 0,
+		permissions TEXT DEFAULT 'read' CHECK (permissions IN ('read', 'write', 'drop')),
+		max_uploads INTEGER,
+		max_upload_size BIGINT,
+		max_upload_bytes BIGINT,
+		upload_count INTEGER NOT NULL DEFAULT 0,
+		upload_bytes BIGINT NOT NULL DEFAULT 0,
+		disabled_at TIMESTAMP,
+		disabled_reason TEXT,
+		first_accessed_at TIMESTAMP,
+		short_slug TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_file_shares_user_id ON file_shares(user_id)`,
+}
+
+// OpenDatabase 打开演示用的SQLite数据库并创建核心表
+func OpenDatabase(ctx context.Context, path string) (*sql.DB, error) {
+	registerOnce.Do(func() {
+		sql.Register(driverName, &compatDriver{})
+	})
+
+	db, err := sql.Open(driverName, "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create demo schema: %w", err)
+		}
+	}
+	return db, nil
+}
+
+// compatDriver 在SQLite上注册now()、gen_random_uuid()和left()，并改写少量PostgreSQL专有语法，
+// 使基于PostgreSQL编写的用户和分享SQL可以直接运行
+type compatDriver struct{}
+
+func (d *compatDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := (&sqlite3.SQLiteDriver{ConnectHook: registerFunctions}).Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &compatConn{SQLiteConn: conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc("now", func() string {
+		return time.Now().UTC().Format("2006-01-02 15:04:05.999999999-07:00")
+	}, false); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("gen_random_uuid", func() string {
+		return uuid.New().String()
+	}, false); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("left", func(s string, n int) string {
+		runes := []rune(s)
+		if n < 0 {
+			n += len(runes)
+		}
+		if n < 0 {
+			n = 0
+		}
+		if n > len(runes) {
+			n = len(runes)
+		}
+		return string(runes[:n])
+	}, true)
+}
+
+type compatConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *compatConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if alterConstraint.MatchString(query) {
+		return driver.RowsAffected(0), nil
+	}
+	translated := addColumnIfNotExists.ReplaceAllString(query, "ADD COLUMN")
+	res, err := c.SQLiteConn.ExecContext(ctx, translated, args)
+	if err != nil && translated != query && strings.Contains(err.Error(), "duplicate column name") {
+		return driver.RowsAffected(0), nil
+	}
+	return res, err
+}
+
+func (c *compatConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, addColumnIfNotExists.ReplaceAllString(query, "ADD COLUMN"))
+}
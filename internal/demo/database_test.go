@@ -0,0 +1,46 @@
+package demo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenDatabaseCompat(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenDatabase(ctx, filepath.Join(t.TempDir(), "gateway.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase() error = %v", err)
+	}
+	defer db.Close()
+
+	// 服务初始化时执行的PostgreSQL语句可以重复执行
+	for i := 0; i < 2; i++ {
+		for _, stmt := range []string{
+			`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS max_uploads INTEGER`,
+			`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS extra_note TEXT`,
+			`ALTER TABLE file_shares DROP CONSTRAINT IF EXISTS file_shares_permissions_check`,
+		} {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				t.Fatalf("ExecContext(%q) error = %v", stmt, err)
+			}
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO users (id, username, email, password_hash, created_at)
+		VALUES (gen_random_uuid(), $1, $2, 'x', NOW())`, "demo", "demo@demo.local"); err != nil {
+		t.Fatalf("insert user error = %v", err)
+	}
+
+	var id, prefix string
+	var created time.Time
+	err = db.QueryRowContext(ctx, `SELECT id, left(username, 2), created_at FROM users WHERE username = $1`, "demo").Scan(&id, &prefix, &created)
+	if err != nil {
+		t.Fatalf("select user error = %v", err)
+	}
+	if len(id) != 36 || prefix != "de" || time.Since(created) > time.Minute {
+		t.Errorf("got id=%q prefix=%q created=%v", id, prefix, created)
+	}
+}
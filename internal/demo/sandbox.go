@@ -0,0 +1,86 @@
+package demo
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// Sandbox 演示模式的运行环境：SQLite数据库和本地目录存储，不依赖PostgreSQL、Redis和MinIO
+type Sandbox struct {
+	// DataDir 数据目录
+	DataDir string
+	// DB 用户和分享数据库
+	DB *sql.DB
+
+	ephemeral bool
+}
+
+// Start 准备演示环境并改写配置。dataDir为空时使用临时目录，退出时删除
+func Start(ctx context.Context, cfg *config.Config, dataDir string) (*Sandbox, error) {
+	sb := &Sandbox{DataDir: dataDir}
+	if dataDir == "" {
+		dir, err := os.MkdirTemp("", "webdav-gateway-demo-")
+		if err != nil {
+			return nil, err
+		}
+		sb.DataDir, sb.ephemeral = dir, true
+	} else if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := OpenDatabase(ctx, filepath.Join(sb.DataDir, "gateway.db"))
+	if err != nil {
+		sb.Close()
+		return nil, err
+	}
+	sb.DB = db
+
+	applyConfig(cfg, sb.DataDir)
+	return sb, nil
+}
+
+// applyConfig 使用本地目录存储后端，并关闭依赖PostgreSQL专有语法或外部服务的功能
+func applyConfig(cfg *config.Config, dataDir string) {
+	cfg.Storage.Type = "local"
+	cfg.Storage.Local.RootPath = filepath.Join(dataDir, "objects")
+	cfg.Storage.ListingCache.Enabled = false
+	cfg.Properties.Backend = "sqlite"
+	cfg.Properties.SQLitePath = filepath.Join(dataDir, "properties.db")
+
+	cfg.Auth.JWTSecret = randomHex(32)
+	cfg.Auth.LoginAlerts.Enabled = false
+	cfg.Auth.SAML.Enabled = false
+	cfg.Auth.SCIM.Enabled = false
+	cfg.Auth.Admins = append(cfg.Auth.Admins, DemoAdmin)
+
+	cfg.Mirror.Enabled = false
+	cfg.Migration.Enabled = false
+	cfg.Audit.Enabled = false
+	cfg.WebDAV.Public.Enabled = false
+}
+
+// Close 关闭数据库，临时数据目录会被删除
+func (sb *Sandbox) Close() error {
+	if sb.DB != nil {
+		sb.DB.Close()
+	}
+	if sb.ephemeral {
+		return os.RemoveAll(sb.DataDir)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,131 @@
+package demo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/cryptopolicy"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// 演示账号，所有账号使用同一个密码
+const (
+	DemoAdmin    = "demo"
+	DemoPassword = "demo-password"
+	DemoUser     = "alice"
+)
+
+// 固定的分享令牌，文档中的示例可以直接使用
+const (
+	DemoReadShare = "demo-readme"
+	DemoDropShare = "demo-dropbox"
+)
+
+type seedFile struct {
+	path    string
+	content string
+}
+
+var demoFiles = map[string][]seedFile{
+	DemoAdmin: {
+		{"/README.md", "# WebDAV Gateway demo\n\nThis sandbox stores everything under its data directory.\nMount /webdav/ with any WebDAV client or use the REST API under /api/.\n"},
+		{"/Documents/getting-started.md", "# Getting started\n\n1. POST /api/auth/login with {\"username\":\"demo\",\"password\":\"demo-password\"}\n2. Send the returned token as `Authorization: Bearer <token>`\n3. PROPFIND /webdav/ with `Depth: 1` to list this folder\n"},
+		{"/Documents/report.csv", "quarter,revenue\nQ1,100\nQ2,140\nQ3,180\n"},
+		{"/Shared/drop/", ""},
+	},
+	DemoUser: {
+		{"/notes.txt", "Alice's notes. Log in as alice to see a second, isolated namespace.\n"},
+	},
+}
+
+// SeedResult 演示数据的登录信息
+type SeedResult struct {
+	Users  []string
+	Shares []string
+	// Seeded 为false表示数据目录中已有数据，未重新生成
+	Seeded bool
+}
+
+// Seed 创建演示用户、文件和分享，数据库中已有用户时不做任何事
+func (sb *Sandbox) Seed(ctx context.Context, storageService *storage.Service) (*SeedResult, error) {
+	result := &SeedResult{
+		Users:  []string{DemoAdmin, DemoUser},
+		Shares: []string{DemoReadShare, DemoDropShare},
+	}
+
+	var count int
+	if err := sb.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check demo users: %w", err)
+	}
+	if count > 0 {
+		return result, nil
+	}
+
+	hash, err := cryptopolicy.HashPassword(DemoPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make(map[string]uuid.UUID)
+	for _, username := range result.Users {
+		id := uuid.New()
+		userIDs[username] = id
+
+		var used int64
+		if err := storageService.EnsureBucket(ctx, id); err != nil {
+			return nil, err
+		}
+		for _, f := range demoFiles[username] {
+			if strings.HasSuffix(f.path, "/") {
+				if err := storageService.CreateFolder(ctx, id, f.path); err != nil {
+					return nil, fmt.Errorf("failed to seed %s: %w", f.path, err)
+				}
+				continue
+			}
+			if err := storageService.PutObject(ctx, id, f.path, strings.NewReader(f.content), int64(len(f.content)), contentType(f.path)); err != nil {
+				return nil, fmt.Errorf("failed to seed %s: %w", f.path, err)
+			}
+			used += int64(len(f.content))
+		}
+
+		if _, err := sb.DB.ExecContext(ctx, `
+			INSERT INTO users (id, username, email, password_hash, display_name, storage_used)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			id, username, username+"@demo.local", hash, strings.ToUpper(username[:1])+username[1:], used); err != nil {
+			return nil, fmt.Errorf("failed to seed user %s: %w", username, err)
+		}
+	}
+
+	owner := userIDs[DemoAdmin]
+	shares := []struct {
+		token, path, name, permissions string
+	}{
+		{DemoReadShare, "/README.md", "Demo readme", "read"},
+		{DemoDropShare, "/Shared/drop", "Demo drop box", "drop"},
+	}
+	for _, s := range shares {
+		if _, err := sb.DB.ExecContext(ctx, `
+			INSERT INTO file_shares (id, user_id, file_path, share_token, share_name, permissions)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			uuid.New(), owner, s.path, s.token, s.name, s.permissions); err != nil {
+			return nil, fmt.Errorf("failed to seed share %s: %w", s.token, err)
+		}
+	}
+
+	result.Seeded = true
+	return result, nil
+}
+
+func contentType(p string) string {
+	switch {
+	case strings.HasSuffix(p, ".md"):
+		return "text/markdown"
+	case strings.HasSuffix(p, ".csv"):
+		return "text/csv"
+	default:
+		return "text/plain"
+	}
+}
@@ -0,0 +1,92 @@
+// Package drain 优雅停机：跟踪进行中的上传和下载，停机开始后拒绝新的写请求并等待传输完成
+package drain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrDraining 网关正在停机，就绪检查以此报告不可用，负载均衡器随之停止转发新请求
+var ErrDraining = errors.New("server is draining")
+
+// Tracker 记录进行中的传输数量和停机状态，可并发使用
+type Tracker struct {
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	active int
+	// idle 有传输进行中时创建，传输全部结束时关闭
+	idle chan struct{}
+}
+
+// New 创建传输跟踪器
+func New() *Tracker {
+	return &Tracker{}
+}
+
+// Begin 登记一个开始的传输，返回的函数在传输结束时调用（只生效一次）
+func (t *Tracker) Begin() func() {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.active--
+			if t.active == 0 {
+				close(t.idle)
+			}
+			t.mu.Unlock()
+		})
+	}
+}
+
+// Active 返回进行中的传输数量
+func (t *Tracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// Start 开始停机，之后Draining返回true
+func (t *Tracker) Start() {
+	t.draining.Store(true)
+}
+
+// Draining 是否已开始停机
+func (t *Tracker) Draining() bool {
+	return t.draining.Load()
+}
+
+// Wait 等待进行中的传输全部结束，ctx结束时返回ctx的错误
+func (t *Tracker) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HealthCheck 实现health.CheckFunc，停机开始后返回ErrDraining
+func (t *Tracker) HealthCheck(ctx context.Context) error {
+	if t.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
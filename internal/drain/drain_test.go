@@ -0,0 +1,65 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrackerWait(t *testing.T) {
+	tracker := New()
+	if err := tracker.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait with no transfers = %v, want nil", err)
+	}
+
+	first := tracker.Begin()
+	second := tracker.Begin()
+	if got := tracker.Active(); got != 2 {
+		t.Fatalf("Active() = %d, want 2", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait with active transfers = %v, want deadline exceeded", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- tracker.Wait(context.Background()) }()
+	first()
+	first() // 重复调用不影响计数
+	if got := tracker.Active(); got != 1 {
+		t.Fatalf("Active() = %d, want 1", got)
+	}
+	second()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the last transfer finished")
+	}
+
+	// 传输全部结束后可以再次开始
+	third := tracker.Begin()
+	defer third()
+	if got := tracker.Active(); got != 1 {
+		t.Fatalf("Active() = %d, want 1", got)
+	}
+}
+
+func TestTrackerDraining(t *testing.T) {
+	tracker := New()
+	if tracker.Draining() || tracker.HealthCheck(context.Background()) != nil {
+		t.Fatal("new tracker reports draining")
+	}
+	tracker.Start()
+	if !tracker.Draining() {
+		t.Fatal("Draining() = false after Start")
+	}
+	if err := tracker.HealthCheck(context.Background()); !errors.Is(err, ErrDraining) {
+		t.Fatalf("HealthCheck = %v, want ErrDraining", err)
+	}
+}
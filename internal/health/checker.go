@@ -0,0 +1,142 @@
+// Package health 检查网关依赖的服务（数据库、Redis、对象存储、属性库）是否可用
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 检查结果状态
+const (
+	// StatusUp 依赖可用
+	StatusUp = "up"
+	// StatusDown 依赖不可用或超时
+	StatusDown = "down"
+	// StatusReady 所有必需的依赖可用
+	StatusReady = "ready"
+	// StatusDegraded 必需的依赖可用，但有可选依赖不可用
+	StatusDegraded = "degraded"
+	// StatusNotReady 有必需的依赖不可用
+	StatusNotReady = "not_ready"
+)
+
+// CheckFunc 探测一个依赖，ctx带有检查超时，返回nil表示可用
+type CheckFunc func(ctx context.Context) error
+
+// DependencyStatus 单个依赖的检查结果
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Optional  bool   `json:"optional,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report 就绪检查结果
+type Report struct {
+	Status       string                      `json:"status"`
+	Time         int64                       `json:"time"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Ready 必需的依赖是否都可用
+func (r Report) Ready() bool {
+	return r.Status != StatusNotReady
+}
+
+type dependency struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker 并发探测已注册的依赖，每个依赖单独计算超时
+type Checker struct {
+	timeout      time.Duration
+	optional     map[string]bool
+	dependencies []dependency
+}
+
+// NewChecker 创建就绪检查器
+func NewChecker(cfg config.HealthConfig) *Checker {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	optional := make(map[string]bool, len(cfg.Optional))
+	for _, name := range cfg.Optional {
+		optional[name] = true
+	}
+	return &Checker{timeout: timeout, optional: optional}
+}
+
+// Register 注册依赖检查，应在开始处理请求之前完成
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.dependencies = append(c.dependencies, dependency{name: name, check: check})
+}
+
+// Check 探测所有依赖。检查函数不响应ctx时也会在超时后记为down，不会阻塞就绪探针
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]DependencyStatus, len(c.dependencies))
+	var wg sync.WaitGroup
+	for i, dep := range c.dependencies {
+		wg.Add(1)
+		go func(i int, dep dependency) {
+			defer wg.Done()
+			results[i] = c.probe(ctx, dep)
+		}(i, dep)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:       StatusReady,
+		Time:         time.Now().Unix(),
+		Dependencies: make(map[string]DependencyStatus, len(c.dependencies)),
+	}
+	for i, dep := range c.dependencies {
+		result := results[i]
+		report.Dependencies[dep.name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Optional {
+			if report.Status == StatusReady {
+				report.Status = StatusDegraded
+			}
+		} else {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+// probe 在超时内执行一次依赖检查
+func (c *Checker) probe(ctx context.Context, dep dependency) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- dep.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := DependencyStatus{
+		Status:    StatusUp,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Optional:  c.optional[dep.name],
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestCheckerReportsEachDependency(t *testing.T) {
+	checker := NewChecker(config.HealthConfig{Timeout: time.Second})
+	checker.Register("database", func(ctx context.Context) error { return nil })
+	checker.Register("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Check(context.Background())
+	if report.Ready() || report.Status != StatusNotReady {
+		t.Fatalf("status = %s, want %s", report.Status, StatusNotReady)
+	}
+	if got := report.Dependencies["database"]; got.Status != StatusUp || got.Error != "" {
+		t.Errorf("database = %+v, want up", got)
+	}
+	if got := report.Dependencies["redis"]; got.Status != StatusDown || got.Error != "connection refused" {
+		t.Errorf("redis = %+v, want down with error", got)
+	}
+}
+
+func TestCheckerOptionalDependency(t *testing.T) {
+	checker := NewChecker(config.HealthConfig{Timeout: time.Second, Optional: []string{"redis"}})
+	checker.Register("database", func(ctx context.Context) error { return nil })
+	checker.Register("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Check(context.Background())
+	if !report.Ready() || report.Status != StatusDegraded {
+		t.Fatalf("status = %s, want %s", report.Status, StatusDegraded)
+	}
+	if !report.Dependencies["redis"].Optional {
+		t.Error("redis not marked optional")
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	checker := NewChecker(config.HealthConfig{Timeout: 50 * time.Millisecond})
+	block := make(chan struct{})
+	defer close(block)
+	// 不响应ctx的检查函数也不能拖住就绪探针
+	checker.Register("storage", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+	checker.Register("properties", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Check took %v, want about the 50ms timeout", elapsed)
+	}
+	if report.Status != StatusNotReady {
+		t.Errorf("status = %s, want %s", report.Status, StatusNotReady)
+	}
+	for _, name := range []string{"storage", "properties"} {
+		if got := report.Dependencies[name]; got.Status != StatusDown || got.Error != context.DeadlineExceeded.Error() {
+			t.Errorf("%s = %+v, want down with deadline exceeded", name, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package idempotency 请求幂等键：保存带Idempotency-Key请求的结果，客户端重试时重放保存的响应而不是再执行一次
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// HeaderKey 客户端携带幂等键的请求头
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed 重放的响应带上该请求头，便于客户端和排查问题时区分
+	HeaderReplayed = "Idempotent-Replayed"
+
+	// keyPrefix Redis键前缀，后接用户ID和幂等键的哈希
+	keyPrefix = "webdav:idempotency:"
+	// defaultTTL 未配置TTL时结果保存的时长
+	defaultTTL = 24 * time.Hour
+	// pendingTTL 执行中占位记录的有效期，进程在请求完成前退出时占位在这之后自动释放
+	pendingTTL = time.Hour
+	// maxKeyLength 幂等键的最大长度
+	maxKeyLength = 255
+	// MaxBodySize 只保存不超过该大小的响应体，PUT和MKCOL的响应通常为空或很短
+	MaxBodySize = 64 << 10
+)
+
+var (
+	// ErrInvalidKey 幂等键为空、过长或包含可见ASCII以外的字符
+	ErrInvalidKey = errors.New("invalid idempotency key")
+	// ErrInProgress 使用同一个键的请求仍在执行
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+	// ErrKeyReused 同一个键被用于不同的请求（方法、路径或请求体长度不同）
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// Response 保存的响应
+type Response struct {
+	// Fingerprint 原请求的指纹，重试时必须一致
+	Fingerprint string      `json:"fingerprint"`
+	Pending     bool        `json:"pending,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Store 基于Redis的幂等结果存储，键按用户隔离
+type Store struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewStore 创建幂等结果存储
+func NewStore(client *redis.Client, cfg config.IdempotencyConfig) *Store {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Store{client: client, ttl: ttl}
+}
+
+// ValidKey 检查幂等键：1到255个可见ASCII字符
+func ValidKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Fingerprint 计算请求指纹。请求体只按长度比较，避免为了指纹缓存整个上传
+func Fingerprint(method, path string, contentLength int64) string {
+	sum := sha256.Sum256([]byte(method + "\n" + path + "\n" + strconv.FormatInt(contentLength, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) redisKey(userID uuid.UUID, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return keyPrefix + userID.String() + ":" + hex.EncodeToString(sum[:])
+}
+
+// Begin 开始执行带幂等键的请求。已有保存的结果时返回该结果，调用方应直接重放；
+// 否则写入执行中占位并返回nil，调用方执行完成后必须调用Complete或Release
+func (s *Store) Begin(ctx context.Context, userID uuid.UUID, key, fingerprint string) (*Response, error) {
+	rkey := s.redisKey(userID, key)
+	pending, err := json.Marshal(Response{Fingerprint: fingerprint, Pending: true})
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.client.SetNX(ctx, rkey, pending, pendingTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if ok {
+		return nil, nil
+	}
+
+	data, err := s.client.Get(ctx, rkey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// 占位恰好过期或被释放，重新占位
+		return s.Begin(ctx, userID, key, fingerprint)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+
+	var stored Response
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if stored.Pending {
+		return nil, ErrInProgress
+	}
+	return &stored, nil
+}
+
+// Complete 保存请求的响应，在TTL内重试同一个键时重放
+func (s *Store) Complete(ctx context.Context, userID uuid.UUID, key string, resp Response) error {
+	resp.Pending = false
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, s.redisKey(userID, key), data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release 删除执行中占位，请求失败时调用，客户端可以用同一个键重试
+func (s *Store) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	if err := s.client.Del(ctx, s.redisKey(userID, key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
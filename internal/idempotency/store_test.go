@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"", false},
+		{"3f1c9a2e-upload-1", true},
+		{strings.Repeat("k", 255), true},
+		{strings.Repeat("k", 256), false},
+		{"has space", false},
+		{"tab\tkey", false},
+		{"ключ", false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("PUT", "/webdav/a.txt", 10)
+	if base != Fingerprint("PUT", "/webdav/a.txt", 10) {
+		t.Fatal("Fingerprint is not stable")
+	}
+	for name, other := range map[string]string{
+		"method": Fingerprint("MKCOL", "/webdav/a.txt", 10),
+		"path":   Fingerprint("PUT", "/webdav/b.txt", 10),
+		"length": Fingerprint("PUT", "/webdav/a.txt", 11),
+	} {
+		if other == base {
+			t.Errorf("Fingerprint ignores a different %s", name)
+		}
+	}
+}
@@ -0,0 +1,589 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrFinished    = errors.New("job has already finished")
+	ErrTooManyJobs = errors.New("too many unfinished jobs")
+)
+
+// 任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// maintenanceInterval 清理超时任务和过期记录的间隔
+const maintenanceInterval = time.Minute
+
+// Progress 任务进度，Total为0表示总量未知
+type Progress struct {
+	Done    int64  `json:"done"`
+	Total   int64  `json:"total"`
+	Message string `json:"message,omitempty"`
+}
+
+// Job 后台任务
+type Job struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Kind   string    `json:"kind"`
+	Status string    `json:"status"`
+	// Payload 提交时的参数，由对应的Runner解析
+	Payload  json.RawMessage `json:"-"`
+	Progress Progress        `json:"progress"`
+	// Result Runner返回的结果
+	Result          json.RawMessage `json:"result,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	CancelRequested bool            `json:"cancel_requested,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished 任务是否已结束
+func (j *Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed || j.Status == StatusCanceled
+}
+
+// Runner 执行一种任务。ctx在任务被取消或服务停止时取消；progress可随时调用，
+// 由Manager定期写入数据库。返回值序列化为JSON保存为任务结果，失败时也可以返回已完成部分的结果
+type Runner func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error)
+
+// Manager 后台任务管理：任务保存在数据库中，由每个副本的工作协程认领执行，
+// 运行中定期写入进度（兼作心跳）并检查是否被取消
+type Manager struct {
+	db     *sql.DB
+	config config.JobsConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	runners map[string]Runner
+	// running 本副本正在执行的任务，用于立即取消
+	running map[uuid.UUID]context.CancelFunc
+
+	wake      chan struct{}
+	initOnce  sync.Once
+	initError error
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewManager 创建任务管理器
+func NewManager(db *sql.DB, cfg config.JobsConfig) *Manager {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	return &Manager{
+		db:      db,
+		config:  cfg,
+		now:     time.Now,
+		runners: make(map[string]Runner),
+		running: make(map[uuid.UUID]context.CancelFunc),
+		wake:    make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Register 注册一种任务的执行函数，需在Start之前调用
+func (m *Manager) Register(kind string, runner Runner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runners[kind] = runner
+}
+
+// Initialize 创建任务表，多次调用只执行一次
+func (m *Manager) Initialize(ctx context.Context) error {
+	m.initOnce.Do(func() {
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS jobs (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				kind VARCHAR(50) NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				payload JSONB,
+				result JSONB,
+				error TEXT NOT NULL DEFAULT '',
+				progress_done BIGINT NOT NULL DEFAULT 0,
+				progress_total BIGINT NOT NULL DEFAULT 0,
+				progress_message TEXT NOT NULL DEFAULT '',
+				cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMP NOT NULL,
+				started_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, created_at)`,
+		}
+		for _, query := range queries {
+			if _, err := m.db.ExecContext(ctx, query); err != nil {
+				m.initError = fmt.Errorf("初始化任务表失败: %v", err)
+				return
+			}
+		}
+	})
+	return m.initError
+}
+
+// Submit 提交任务，payload序列化为JSON保存，任务由空闲的工作协程执行
+func (m *Manager) Submit(ctx context.Context, userID uuid.UUID, kind string, payload interface{}) (*Job, error) {
+	if err := m.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	_, ok := m.runners[kind]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+
+	if m.config.MaxActivePerUser > 0 {
+		var active int
+		if err := m.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM jobs WHERE user_id = $1 AND status IN ('pending', 'running')`,
+			userID).Scan(&active); err != nil {
+			return nil, fmt.Errorf("查询任务失败: %v", err)
+		}
+		if active >= m.config.MaxActivePerUser {
+			return nil, ErrTooManyJobs
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	job := &Job{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    StatusPending,
+		Payload:   data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := m.db.ExecContext(ctx, `
+		INSERT INTO jobs (id, user_id, kind, status, payload, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		job.ID, job.UserID, job.Kind, job.Status, string(data), now, now); err != nil {
+		return nil, fmt.Errorf("创建任务失败: %v", err)
+	}
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// jobColumns 查询任务时的列，与scanJob一致
+const jobColumns = `id, user_id, kind, status, payload, result, error, progress_done, progress_total,
+	progress_message, cancel_requested, created_at, started_at, updated_at, finished_at`
+
+// rowScanner 由*sql.Row和*sql.Rows实现
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanJob 读取一行任务
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var payload, result []byte
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.UserID, &job.Kind, &job.Status, &payload, &result, &job.Error,
+		&job.Progress.Done, &job.Progress.Total, &job.Progress.Message, &job.CancelRequested,
+		&job.CreatedAt, &startedAt, &job.UpdatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if len(payload) > 0 {
+		job.Payload = payload
+	}
+	if len(result) > 0 {
+		job.Result = result
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// Get 获取用户的任务
+func (m *Manager) Get(ctx context.Context, userID, jobID uuid.UUID) (*Job, error) {
+	if err := m.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	job, err := scanJob(m.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id = $1 AND user_id = $2`, jobID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %v", err)
+	}
+	return job, nil
+}
+
+// List 列出用户最近的任务，按创建时间倒序
+func (m *Manager) List(ctx context.Context, userID uuid.UUID, limit int) ([]*Job, error) {
+	if err := m.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取任务失败: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Cancel 取消任务：等待中的任务直接取消，运行中的任务标记后由执行的副本中止
+func (m *Manager) Cancel(ctx context.Context, userID, jobID uuid.UUID) (*Job, error) {
+	if err := m.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'canceled', finished_at = $1, updated_at = $1
+		WHERE id = $2 AND user_id = $3 AND status = 'pending'`,
+		now, jobID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("取消任务失败: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		res, err = m.db.ExecContext(ctx, `
+			UPDATE jobs SET cancel_requested = TRUE
+			WHERE id = $1 AND user_id = $2 AND status = 'running'`,
+			jobID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("取消任务失败: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			job, err := m.Get(ctx, userID, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job.Finished() {
+				return nil, ErrFinished
+			}
+		}
+		m.mu.Lock()
+		if cancel, ok := m.running[jobID]; ok {
+			cancel()
+		}
+		m.mu.Unlock()
+	}
+	return m.Get(ctx, userID, jobID)
+}
+
+// Start 启动工作协程和定期清理
+func (m *Manager) Start() {
+	for i := 0; i < m.config.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(maintenanceInterval)
+		defer ticker.Stop()
+
+		for {
+			m.maintain(context.Background())
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止认领新任务，中止本副本正在执行的任务并等待其退出
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+		m.mu.Lock()
+		for _, cancel := range m.running {
+			cancel()
+		}
+		m.mu.Unlock()
+	})
+	m.wg.Wait()
+}
+
+// work 工作协程：有任务时连续执行，空闲时等待提交通知或下一次轮询
+func (m *Manager) work() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		default:
+		}
+
+		job, err := m.claim(context.Background())
+		if err != nil {
+			log.Printf("Warning: failed to claim job: %v", err)
+		}
+		if job != nil {
+			m.run(job)
+			continue
+		}
+
+		select {
+		case <-m.wake:
+		case <-ticker.C:
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// claim 认领一个等待中的任务。先查询候选再按状态条件更新，多个副本同时认领时只有一个成功
+func (m *Manager) claim(ctx context.Context) (*Job, error) {
+	if err := m.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT id FROM jobs WHERE status = 'pending' ORDER BY created_at LIMIT $1`, m.config.Workers)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range candidates {
+		now := m.now().UTC()
+		res, err := m.db.ExecContext(ctx, `
+			UPDATE jobs SET status = 'running', started_at = $1, updated_at = $1
+			WHERE id = $2 AND status = 'pending'`, now, id)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return scanJob(m.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+		}
+	}
+	return nil, nil
+}
+
+// run 执行已认领的任务并保存结果
+func (m *Manager) run(job *Job) {
+	m.mu.Lock()
+	runner, ok := m.runners[job.Kind]
+	ctx, cancel := context.WithCancel(context.Background())
+	m.running[job.ID] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, job.ID)
+		m.mu.Unlock()
+		cancel()
+	}()
+
+	var progressMu sync.Mutex
+	progress := job.Progress
+	report := func(p Progress) {
+		progressMu.Lock()
+		progress = p
+		progressMu.Unlock()
+	}
+	snapshot := func() Progress {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		return progress
+	}
+
+	// 定期写入进度并检查取消，updated_at同时作为心跳
+	heartbeatDone := make(chan struct{})
+	canceled := false
+	var canceledMu sync.Mutex
+	go func() {
+		ticker := time.NewTicker(m.config.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				requested, err := m.heartbeat(job.ID, snapshot())
+				if err != nil {
+					log.Printf("Warning: failed to update job %s: %v", job.ID, err)
+					continue
+				}
+				if requested {
+					canceledMu.Lock()
+					canceled = true
+					canceledMu.Unlock()
+					cancel()
+				}
+			case <-heartbeatDone:
+				return
+			}
+		}
+	}()
+
+	var result interface{}
+	var err error
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	} else {
+		result, err = m.execute(ctx, runner, job, report)
+	}
+	close(heartbeatDone)
+
+	// 用户取消的任务可能由其他副本标记，以数据库为准
+	canceledMu.Lock()
+	wasCanceled := canceled
+	canceledMu.Unlock()
+	if err != nil && !wasCanceled {
+		var requested bool
+		if e := m.db.QueryRow(`SELECT cancel_requested FROM jobs WHERE id = $1`, job.ID).Scan(&requested); e == nil {
+			wasCanceled = requested
+		}
+	}
+
+	var data []byte
+	if result != nil {
+		var marshalErr error
+		if data, marshalErr = json.Marshal(result); marshalErr != nil && err == nil {
+			err = marshalErr
+		}
+	}
+
+	// 取消时已经执行完的任务仍记为完成
+	status, message := StatusCompleted, ""
+	switch {
+	case err == nil:
+	case wasCanceled:
+		status = StatusCanceled
+	default:
+		status, message = StatusFailed, err.Error()
+		select {
+		case <-m.stopCh:
+			message = "interrupted by server shutdown: " + message
+		default:
+		}
+	}
+	if err := m.finish(job.ID, status, data, message, snapshot()); err != nil {
+		log.Printf("Warning: failed to save result of job %s: %v", job.ID, err)
+	}
+}
+
+// execute 调用Runner，panic记为任务失败
+func (m *Manager) execute(ctx context.Context, runner Runner, job *Job, progress func(Progress)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return runner(ctx, job, progress)
+}
+
+// heartbeat 写入进度，返回任务是否已被请求取消
+func (m *Manager) heartbeat(jobID uuid.UUID, p Progress) (bool, error) {
+	if _, err := m.db.Exec(`
+		UPDATE jobs SET progress_done = $1, progress_total = $2, progress_message = $3, updated_at = $4
+		WHERE id = $5`,
+		p.Done, p.Total, p.Message, m.now().UTC(), jobID); err != nil {
+		return false, err
+	}
+	var requested bool
+	err := m.db.QueryRow(`SELECT cancel_requested FROM jobs WHERE id = $1`, jobID).Scan(&requested)
+	return requested, err
+}
+
+// finish 保存任务的最终状态
+func (m *Manager) finish(jobID uuid.UUID, status string, result []byte, message string, p Progress) error {
+	var resultValue interface{}
+	if result != nil {
+		resultValue = string(result)
+	}
+	now := m.now().UTC()
+	_, err := m.db.Exec(`
+		UPDATE jobs SET status = $1, result = $2, error = $3,
+			progress_done = $4, progress_total = $5, progress_message = $6,
+			updated_at = $7, finished_at = $7
+		WHERE id = $8`,
+		status, resultValue, message, p.Done, p.Total, p.Message, now, jobID)
+	return err
+}
+
+// maintain 把长时间没有心跳的运行中任务标记为失败（执行的副本已退出），并删除过期的已结束任务
+func (m *Manager) maintain(ctx context.Context) {
+	if err := m.Initialize(ctx); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	now := m.now().UTC()
+	if m.config.StaleAfter > 0 {
+		res, err := m.db.ExecContext(ctx, `
+			UPDATE jobs SET status = 'failed', error = 'interrupted: the server running the job stopped',
+				updated_at = $1, finished_at = $1
+			WHERE status = 'running' AND updated_at < $2`,
+			now, now.Add(-m.config.StaleAfter))
+		if err != nil {
+			log.Printf("Warning: failed to fail stale jobs: %v", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Marked %d stale jobs as failed", n)
+		}
+	}
+	if m.config.Retention > 0 {
+		if _, err := m.db.ExecContext(ctx, `
+			DELETE FROM jobs WHERE finished_at IS NOT NULL AND finished_at < $1`,
+			now.Add(-m.config.Retention)); err != nil {
+			log.Printf("Warning: failed to delete old jobs: %v", err)
+		}
+	}
+}
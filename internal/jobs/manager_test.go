@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func newTestManager(t *testing.T, cfg config.JobsConfig) (*Manager, uuid.UUID) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE users (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	user := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id) VALUES ($1)`, user.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 10 * time.Millisecond
+	}
+	m := NewManager(db, cfg)
+	if err := m.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return m, user
+}
+
+// waitFinished 轮询直到任务结束
+func waitFinished(t *testing.T, m *Manager, user, id uuid.UUID) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), user, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestManagerRunsJobsAndSavesResults(t *testing.T) {
+	m, user := newTestManager(t, config.JobsConfig{Workers: 2})
+	m.Register("sum", func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error) {
+		var numbers []int
+		if err := json.Unmarshal(job.Payload, &numbers); err != nil {
+			return nil, err
+		}
+		total := 0
+		for i, n := range numbers {
+			total += n
+			progress(Progress{Done: int64(i + 1), Total: int64(len(numbers))})
+		}
+		return map[string]int{"sum": total}, nil
+	})
+	m.Register("fail", func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	m.Start()
+	defer m.Stop()
+
+	ctx := context.Background()
+	sum, err := m.Submit(ctx, user, "sum", []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail, err := m.Submit(ctx, user, "fail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitFinished(t, m, user, sum.ID)
+	if job.Status != StatusCompleted || string(job.Result) != `{"sum":6}` {
+		t.Errorf("sum job: status = %s result = %s", job.Status, job.Result)
+	}
+	if job.Progress.Done != 3 || job.Progress.Total != 3 {
+		t.Errorf("progress = %+v, want 3/3", job.Progress)
+	}
+	if job := waitFinished(t, m, user, fail.ID); job.Status != StatusFailed || job.Error != "boom" {
+		t.Errorf("fail job: status = %s error = %q", job.Status, job.Error)
+	}
+
+	if _, err := m.Submit(ctx, user, "unknown", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("unknown kind: err = %v", err)
+	}
+	if _, err := m.Get(ctx, uuid.New(), sum.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("another user's job: err = %v, want ErrNotFound", err)
+	}
+	jobs, err := m.List(ctx, user, 10)
+	if err != nil || len(jobs) != 2 {
+		t.Errorf("List = %d jobs, %v", len(jobs), err)
+	}
+}
+
+func TestManagerCancelsJobs(t *testing.T) {
+	m, user := newTestManager(t, config.JobsConfig{Workers: 1})
+	started := make(chan struct{})
+	m.Register("wait", func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx := context.Background()
+
+	// 等待中的任务直接取消
+	pending, err := m.Submit(ctx, user, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := m.Cancel(ctx, user, pending.ID)
+	if err != nil || job.Status != StatusCanceled {
+		t.Fatalf("cancel pending: job = %+v, err = %v", job, err)
+	}
+	if _, err := m.Cancel(ctx, user, pending.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("cancel finished job: err = %v, want ErrFinished", err)
+	}
+
+	// 运行中的任务收到ctx取消
+	m.Start()
+	defer m.Stop()
+	running, err := m.Submit(ctx, user, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := m.Cancel(ctx, user, running.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitFinished(t, m, user, running.ID); job.Status != StatusCanceled {
+		t.Errorf("cancel running: status = %s error = %q", job.Status, job.Error)
+	}
+}
+
+func TestManagerLimitsActiveJobsPerUser(t *testing.T) {
+	m, user := newTestManager(t, config.JobsConfig{Workers: 1, MaxActivePerUser: 1})
+	m.Register("noop", func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error) {
+		return nil, nil
+	})
+	ctx := context.Background()
+	if _, err := m.Submit(ctx, user, "noop", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit(ctx, user, "noop", nil); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("second job: err = %v, want ErrTooManyJobs", err)
+	}
+}
+
+func TestManagerFailsStaleJobs(t *testing.T) {
+	m, user := newTestManager(t, config.JobsConfig{Workers: 1, StaleAfter: time.Minute, Retention: time.Hour})
+	m.Register("noop", func(ctx context.Context, job *Job, progress func(Progress)) (interface{}, error) {
+		return nil, nil
+	})
+	ctx := context.Background()
+	job, err := m.Submit(ctx, user, "noop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟认领任务后副本退出
+	if _, err := m.claim(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	m.maintain(ctx)
+	stale, err := m.Get(ctx, user, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale.Status != StatusFailed {
+		t.Errorf("status = %s, want failed", stale.Status)
+	}
+
+	// 超过保留时间后删除
+	m.now = func() time.Time { return time.Now().Add(3 * time.Hour) }
+	m.maintain(ctx)
+	if _, err := m.Get(ctx, user, job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired job: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,71 @@
+package loginalert
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// 触发提醒的原因
+const (
+	ReasonNewDevice  = "new_device"
+	ReasonNewCountry = "new_country"
+)
+
+// versionPattern 匹配User-Agent中的版本号，浏览器自动升级不应被视为新设备
+var versionPattern = regexp.MustCompile(`[0-9]+(?:[._][0-9]+)*`)
+
+// DeviceHash 计算设备指纹。客户端提供稳定的设备ID（X-Device-ID）时优先使用，
+// 否则使用去掉版本号后的User-Agent
+func DeviceHash(deviceID, userAgent string) string {
+	source := "id:" + strings.TrimSpace(deviceID)
+	if strings.TrimSpace(deviceID) == "" {
+		ua := strings.ToLower(strings.TrimSpace(userAgent))
+		source = "ua:" + versionPattern.ReplaceAllString(ua, "#")
+	}
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// knownLogins 用户已有的登录记录摘要
+type knownLogins struct {
+	devices      int
+	deviceKnown  bool
+	countries    int
+	countryKnown bool
+}
+
+// anomalies 判断本次登录的异常原因。首次登录只建立基线不提醒；
+// 从未识别过国家的用户（如刚启用GeoIP）同样只记录不提醒
+func anomalies(known knownLogins, country string) []string {
+	if known.devices == 0 {
+		return nil
+	}
+
+	var reasons []string
+	if !known.deviceKnown {
+		reasons = append(reasons, ReasonNewDevice)
+	}
+	if country != "" && known.countries > 0 && !known.countryKnown {
+		reasons = append(reasons, ReasonNewCountry)
+	}
+	return reasons
+}
+
+// newToken 生成提醒链接或密码重置使用的随机令牌
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 数据库只保存令牌摘要，泄露数据库不会泄露可用的链接
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package loginalert
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeviceHash(t *testing.T) {
+	chrome119 := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.105 Safari/537.36"
+	chrome120 := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Safari/537.36"
+	firefox := "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+	if DeviceHash("", chrome119) != DeviceHash("", chrome120) {
+		t.Error("浏览器升级不应产生新的设备指纹")
+	}
+	if DeviceHash("", chrome120) == DeviceHash("", firefox) {
+		t.Error("不同浏览器应产生不同的设备指纹")
+	}
+	if DeviceHash("device-1", chrome120) != DeviceHash("device-1", firefox) {
+		t.Error("提供设备ID时应忽略User-Agent")
+	}
+	if DeviceHash("device-1", chrome120) == DeviceHash("device-2", chrome120) {
+		t.Error("不同设备ID应产生不同的设备指纹")
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	tests := []struct {
+		name    string
+		known   knownLogins
+		country string
+		want    []string
+	}{
+		{name: "首次登录", known: knownLogins{}, country: "CN", want: nil},
+		{name: "已知设备和国家", known: knownLogins{devices: 2, deviceKnown: true, countries: 1, countryKnown: true}, country: "CN", want: nil},
+		{name: "新设备", known: knownLogins{devices: 1, countries: 1, countryKnown: true}, country: "CN", want: []string{ReasonNewDevice}},
+		{name: "新国家", known: knownLogins{devices: 1, deviceKnown: true, countries: 1}, country: "US", want: []string{ReasonNewCountry}},
+		{name: "新设备且新国家", known: knownLogins{devices: 1, countries: 2}, country: "US", want: []string{ReasonNewDevice, ReasonNewCountry}},
+		{name: "未识别国家", known: knownLogins{devices: 1, deviceKnown: true, countries: 1}, country: "", want: nil},
+		{name: "此前从未识别国家", known: knownLogins{devices: 3, deviceKnown: true}, country: "US", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := anomalies(tt.known, tt.country); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("anomalies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
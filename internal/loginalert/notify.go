@@ -0,0 +1,99 @@
+package loginalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GeoLocator 根据IP识别国家（ISO 3166-1 alpha-2），无法识别时返回空字符串。
+// 可接入MaxMind等GeoIP数据库
+type GeoLocator interface {
+	Country(ctx context.Context, ip net.IP) (string, error)
+}
+
+// NoopLocator 不做GeoIP识别，只按设备判断
+type NoopLocator struct{}
+
+// Country 始终返回空字符串
+func (NoopLocator) Country(context.Context, net.IP) (string, error) {
+	return "", nil
+}
+
+// Notifier 发送异常登录提醒
+type Notifier interface {
+	Notify(ctx context.Context, alert *Alert) error
+}
+
+// LogNotifier 只把提醒写入日志，用于未配置Webhook的部署
+type LogNotifier struct{}
+
+// Notify 记录提醒，不输出可用的拒绝链接
+func (LogNotifier) Notify(_ context.Context, alert *Alert) error {
+	log.Printf("Login alert for user %s: %s from %s (%s)",
+		alert.Username, strings.Join(alert.Reasons, ","), alert.IP, alert.Country)
+	return nil
+}
+
+// WebhookNotifier 以JSON POST推送提醒，由邮件/IM服务负责送达用户
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier 创建Webhook提醒
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify 推送提醒，非2xx响应视为失败
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *Alert) error {
+	body, err := json.Marshal(newWebhookPayload(alert))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookPayload Webhook推送内容，包含面向用户的链接
+type webhookPayload struct {
+	Event string `json:"event"`
+	*Alert
+	DetailsURL string `json:"details_url,omitempty"`
+	DenyURL    string `json:"deny_url,omitempty"`
+}
+
+// newWebhookPayload 组装推送内容
+func newWebhookPayload(alert *Alert) webhookPayload {
+	return webhookPayload{
+		Event:      "login.anomaly",
+		Alert:      alert,
+		DetailsURL: alert.detailsURL,
+		DenyURL:    alert.denyURL,
+	}
+}
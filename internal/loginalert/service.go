@@ -0,0 +1,467 @@
+package loginalert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+)
+
+const (
+	// defaultLinkTTL 未配置时提醒链接和密码重置令牌的有效期
+	defaultLinkTTL = 72 * time.Hour
+	// notifyTimeout 单次提醒推送的超时
+	notifyTimeout = 15 * time.Second
+)
+
+var (
+	// ErrAlertNotFound 提醒链接无效
+	ErrAlertNotFound = errors.New("login alert not found")
+	// ErrAlertExpired 提醒链接已过期
+	ErrAlertExpired = errors.New("login alert has expired")
+	// ErrAlertResolved 提醒已处理过
+	ErrAlertResolved = errors.New("login alert already handled")
+	// ErrResetTokenInvalid 密码重置令牌无效、已使用或已过期
+	ErrResetTokenInvalid = errors.New("invalid or expired password reset token")
+)
+
+// LoginEvent 一次成功的登录
+type LoginEvent struct {
+	UserID    uuid.UUID
+	Username  string
+	Email     string
+	IP        string
+	UserAgent string
+	// DeviceID 客户端提供的稳定设备标识，可为空
+	DeviceID string
+	// Country 已由反向代理识别的国家，为空时使用GeoLocator
+	Country string
+}
+
+// Alert 异常登录提醒
+type Alert struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email,omitempty"`
+	Reasons   []string  `json:"reasons"`
+	IP        string    `json:"ip"`
+	Country   string    `json:"country,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Denied    bool      `json:"denied"`
+
+	detailsURL string
+	denyURL    string
+}
+
+// DenyResult 确认"不是我本人"后返回的密码重置令牌
+type DenyResult struct {
+	ResetToken     string    `json:"reset_token"`
+	ResetExpiresAt time.Time `json:"reset_expires_at"`
+}
+
+// Service 记录登录指纹，在新设备或新国家登录时发送提醒，
+// 并在用户确认不是本人时撤销全部会话、要求重置密码
+type Service struct {
+	db        *sql.DB
+	cfg       config.LoginAlertConfig
+	locator   GeoLocator
+	notifier  Notifier
+	linkTTL   time.Duration
+	initOnce  sync.Once
+	initError error
+}
+
+// NewService 创建异常登录提醒服务，db为主数据库（PostgreSQL）
+func NewService(db *sql.DB, cfg config.LoginAlertConfig) *Service {
+	var notifier Notifier = LogNotifier{}
+	if cfg.WebhookURL != "" {
+		notifier = NewWebhookNotifier(cfg.WebhookURL)
+	}
+
+	linkTTL := cfg.LinkTTL
+	if linkTTL <= 0 {
+		linkTTL = defaultLinkTTL
+	}
+
+	return &Service{
+		db:       db,
+		cfg:      cfg,
+		locator:  NoopLocator{},
+		notifier: notifier,
+		linkTTL:  linkTTL,
+	}
+}
+
+// SetGeoLocator 替换GeoIP实现
+func (s *Service) SetGeoLocator(locator GeoLocator) {
+	s.locator = locator
+}
+
+// SetNotifier 替换提醒发送方式
+func (s *Service) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// CountryHeader 返回由反向代理注入国家代码的请求头，未配置时为空
+func (s *Service) CountryHeader() string {
+	return s.cfg.CountryHeader
+}
+
+// Initialize 创建所需的表和列，多次调用只执行一次。
+// 会话撤销使用的users.tokens_valid_after列由account.Service.Initialize创建
+func (s *Service) Initialize(ctx context.Context) error {
+	s.initOnce.Do(func() {
+		queries := []string{
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN DEFAULT FALSE`,
+			`CREATE TABLE IF NOT EXISTS login_devices (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				device_hash VARCHAR(64) NOT NULL,
+				user_agent TEXT,
+				last_ip VARCHAR(45),
+				first_seen TIMESTAMP NOT NULL,
+				last_seen TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, device_hash)
+			)`,
+			`CREATE TABLE IF NOT EXISTS login_countries (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				country VARCHAR(2) NOT NULL,
+				first_seen TIMESTAMP NOT NULL,
+				last_seen TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, country)
+			)`,
+			`CREATE TABLE IF NOT EXISTS login_alerts (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				token_hash VARCHAR(64) UNIQUE NOT NULL,
+				reasons VARCHAR(64) NOT NULL,
+				device_hash VARCHAR(64) NOT NULL,
+				ip VARCHAR(45),
+				country VARCHAR(2),
+				user_agent TEXT,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				denied_at TIMESTAMP,
+				reset_token_hash VARCHAR(64) UNIQUE,
+				reset_expires_at TIMESTAMP,
+				reset_used_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_login_alerts_user_id ON login_alerts(user_id)`,
+		}
+		for _, query := range queries {
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				s.initError = fmt.Errorf("初始化登录提醒表失败: %v", err)
+				return
+			}
+		}
+	})
+	return s.initError
+}
+
+// RecordLogin 记录登录指纹，出现异常时创建提醒并异步发送。返回nil表示无需提醒
+func (s *Service) RecordLogin(ctx context.Context, event LoginEvent) (*Alert, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(event.Country))
+	if country == "" {
+		if ip := net.ParseIP(event.IP); ip != nil {
+			located, err := s.locator.Country(ctx, ip)
+			if err != nil {
+				log.Printf("Warning: GeoIP lookup for %s failed: %v", event.IP, err)
+			}
+			country = strings.ToUpper(located)
+		}
+	}
+	if len(country) != 2 {
+		country = ""
+	}
+
+	deviceHash := DeviceHash(event.DeviceID, event.UserAgent)
+	now := time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	known, err := s.lookupKnown(ctx, tx, event.UserID, deviceHash, country)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_devices (user_id, device_hash, user_agent, last_ip, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (user_id, device_hash)
+		DO UPDATE SET user_agent = EXCLUDED.user_agent, last_ip = EXCLUDED.last_ip, last_seen = EXCLUDED.last_seen`,
+		event.UserID, deviceHash, event.UserAgent, event.IP, now)
+	if err != nil {
+		return nil, fmt.Errorf("记录登录设备失败: %v", err)
+	}
+
+	if country != "" {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO login_countries (user_id, country, first_seen, last_seen)
+			VALUES ($1, $2, $3, $3)
+			ON CONFLICT (user_id, country) DO UPDATE SET last_seen = EXCLUDED.last_seen`,
+			event.UserID, country, now)
+		if err != nil {
+			return nil, fmt.Errorf("记录登录国家失败: %v", err)
+		}
+	}
+
+	reasons := anomalies(known, country)
+	if len(reasons) == 0 {
+		return nil, tx.Commit()
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	alert := &Alert{
+		ID:        uuid.New(),
+		UserID:    event.UserID,
+		Username:  event.Username,
+		Email:     event.Email,
+		Reasons:   reasons,
+		IP:        event.IP,
+		Country:   country,
+		UserAgent: event.UserAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.linkTTL),
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_alerts (id, user_id, token_hash, reasons, device_hash, ip, country, user_agent, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		alert.ID, alert.UserID, hashToken(token), strings.Join(reasons, ","), deviceHash,
+		alert.IP, alert.Country, alert.UserAgent, alert.CreatedAt, alert.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("创建登录提醒失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
+	if base := strings.TrimRight(s.cfg.PublicURL, "/"); base != "" {
+		alert.detailsURL = base + "/api/auth/login-alerts/" + token
+		alert.denyURL = alert.detailsURL + "/deny"
+	}
+
+	// 推送不阻塞登录，也不随请求取消
+	go func() {
+		notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+		if err := s.notifier.Notify(notifyCtx, alert); err != nil {
+			log.Printf("Warning: failed to deliver login alert %s: %v", alert.ID, err)
+		}
+	}()
+
+	return alert, nil
+}
+
+// lookupKnown 查询用户已知的设备和国家
+func (s *Service) lookupKnown(ctx context.Context, tx *sql.Tx, userID uuid.UUID, deviceHash, country string) (knownLogins, error) {
+	var known knownLogins
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(device_hash = $2), FALSE)
+		FROM login_devices WHERE user_id = $1`,
+		userID, deviceHash).Scan(&known.devices, &known.deviceKnown)
+	if err != nil {
+		return known, fmt.Errorf("查询登录设备失败: %v", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(country = $2), FALSE)
+		FROM login_countries WHERE user_id = $1`,
+		userID, country).Scan(&known.countries, &known.countryKnown)
+	if err != nil {
+		return known, fmt.Errorf("查询登录国家失败: %v", err)
+	}
+	return known, nil
+}
+
+// GetAlert 根据链接令牌读取提醒
+func (s *Service) GetAlert(ctx context.Context, token string) (*Alert, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	alert := &Alert{}
+	var reasons string
+	var country, ip, userAgent, email sql.NullString
+	var deniedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.id, a.user_id, u.username, u.email, a.reasons, a.ip, a.country, a.user_agent,
+			a.created_at, a.expires_at, a.denied_at
+		FROM login_alerts a JOIN users u ON u.id = a.user_id
+		WHERE a.token_hash = $1`,
+		hashToken(token)).Scan(&alert.ID, &alert.UserID, &alert.Username, &email, &reasons,
+		&ip, &country, &userAgent, &alert.CreatedAt, &alert.ExpiresAt, &deniedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询登录提醒失败: %v", err)
+	}
+
+	alert.Email = email.String
+	alert.Reasons = strings.Split(reasons, ",")
+	alert.IP = ip.String
+	alert.Country = country.String
+	alert.UserAgent = userAgent.String
+	alert.Denied = deniedAt.Valid
+	return alert, nil
+}
+
+// Deny 用户确认登录不是本人：撤销该用户全部会话，要求重置密码，
+// 并忘记可疑设备使其再次登录时重新提醒。返回一次性的密码重置令牌
+func (s *Service) Deny(ctx context.Context, token string) (*DenyResult, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	var alertID, userID uuid.UUID
+	var deviceHash string
+	var expiresAt time.Time
+	var deniedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, device_hash, expires_at, denied_at
+		FROM login_alerts WHERE token_hash = $1 FOR UPDATE`,
+		hashToken(token)).Scan(&alertID, &userID, &deviceHash, &expiresAt, &deniedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询登录提醒失败: %v", err)
+	}
+	if deniedAt.Valid {
+		return nil, ErrAlertResolved
+	}
+
+	now := time.Now().UTC()
+	if now.After(expiresAt) {
+		return nil, ErrAlertExpired
+	}
+
+	resetToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	result := &DenyResult{ResetToken: resetToken, ResetExpiresAt: now.Add(s.linkTTL)}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET tokens_valid_after = $2, password_reset_required = TRUE WHERE id = $1`,
+			[]interface{}{userID, now}},
+		{`DELETE FROM login_devices WHERE user_id = $1 AND device_hash = $2`,
+			[]interface{}{userID, deviceHash}},
+		{`UPDATE login_alerts SET denied_at = $2, reset_token_hash = $3, reset_expires_at = $4 WHERE id = $1`,
+			[]interface{}{alertID, now, hashToken(resetToken), result.ResetExpiresAt}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return nil, fmt.Errorf("撤销会话失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return result, nil
+}
+
+// ResetPassword 使用Deny返回的令牌设置新密码，解除登录限制并再次撤销旧会话
+func (s *Service) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	hash, err := cryptopolicy.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	var alertID, userID uuid.UUID
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, reset_expires_at, reset_used_at
+		FROM login_alerts WHERE reset_token_hash = $1 FOR UPDATE`,
+		hashToken(resetToken)).Scan(&alertID, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("查询密码重置令牌失败: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if usedAt.Valid || now.After(expiresAt) {
+		return ErrResetTokenInvalid
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET password_hash = $2, password_reset_required = FALSE, tokens_valid_after = $3
+		WHERE id = $1`,
+		userID, hash, now)
+	if err != nil {
+		return fmt.Errorf("更新密码失败: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE login_alerts SET reset_used_at = $2 WHERE id = $1`, alertID, now); err != nil {
+		return fmt.Errorf("更新密码重置令牌失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// PasswordResetRequired 用户是否因异常登录被要求重置密码
+func (s *Service) PasswordResetRequired(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return false, err
+	}
+
+	var required sql.NullBool
+	err := s.db.QueryRowContext(ctx, `SELECT password_reset_required FROM users WHERE id = $1`, userID).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询密码重置状态失败: %v", err)
+	}
+	return required.Bool, nil
+}
@@ -0,0 +1,216 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// errInvalidTIFF TIFF/EXIF数据格式错误
+var errInvalidTIFF = errors.New("invalid tiff data")
+
+// 用到的TIFF/EXIF标签
+const (
+	tagImageWidth       = 0x0100
+	tagImageLength      = 0x0101
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOrig   = 0x9011
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+const (
+	// maxIFDEntries 单个IFD的字段数上限，超出时视为数据损坏
+	maxIFDEntries        = 1000
+	exifDateTimeLayout   = "2006:01:02 15:04:05"
+	exifOffsetTimeLayout = "2006:01:02 15:04:05-07:00"
+)
+
+// typeSizes TIFF字段类型对应的单个值字节数
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// ifdEntry IFD中的一个字段，data为字段值的原始字节
+type ifdEntry struct {
+	typ   uint16
+	count int
+	data  []byte
+}
+
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// parseTIFF 解析TIFF头和IFD0、Exif IFD、GPS IFD，把找到的字段写入m
+func parseTIFF(b []byte, m *Metadata) error {
+	if len(b) < 8 {
+		return errInvalidTIFF
+	}
+	t := &tiffReader{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errInvalidTIFF
+	}
+	if t.order.Uint16(b[2:4]) != 42 {
+		return errInvalidTIFF
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(b[4:8]))
+	if err != nil {
+		return err
+	}
+	m.CameraMake = t.ascii(ifd0[tagMake])
+	m.CameraModel = t.ascii(ifd0[tagModel])
+	m.Width = t.integer(ifd0[tagImageWidth])
+	m.Height = t.integer(ifd0[tagImageLength])
+	takenAt := t.ascii(ifd0[tagDateTime])
+	offset := ""
+
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if exif, err := t.readIFD(uint32(t.integer(e))); err == nil {
+			if original := t.ascii(exif[tagDateTimeOriginal]); original != "" {
+				takenAt = original
+				offset = t.ascii(exif[tagOffsetTimeOrig])
+			}
+			if w, h := t.integer(exif[tagPixelXDimension]), t.integer(exif[tagPixelYDimension]); w > 0 && h > 0 {
+				m.Width, m.Height = w, h
+			}
+		}
+	}
+	m.TakenAt = parseEXIFTime(takenAt, offset)
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.readIFD(uint32(t.integer(e))); err == nil {
+			m.Location = t.location(gps)
+		}
+	}
+	return nil
+}
+
+// readIFD 读取offset处的IFD，值超出数据范围的字段被忽略
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	if offset < 8 || int64(offset)+2 > int64(len(t.b)) {
+		return nil, errInvalidTIFF
+	}
+	n := int(t.order.Uint16(t.b[offset:]))
+	if n > maxIFDEntries || int(offset)+2+n*12 > len(t.b) {
+		return nil, errInvalidTIFF
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		raw := t.b[int(offset)+2+i*12:][:12]
+		typ := t.order.Uint16(raw[2:4])
+		count := t.order.Uint32(raw[4:8])
+		size, ok := typeSizes[typ]
+		if !ok || count == 0 || count > uint32(len(t.b)) {
+			continue
+		}
+		length := int64(size) * int64(count)
+		data := raw[8:12]
+		if length > 4 {
+			start := int64(t.order.Uint32(raw[8:12]))
+			if start+length > int64(len(t.b)) {
+				continue
+			}
+			data = t.b[start : start+length]
+		}
+		entries[t.order.Uint16(raw[0:2])] = ifdEntry{typ: typ, count: int(count), data: data[:length]}
+	}
+	return entries, nil
+}
+
+// ascii 读取ASCII字段，去掉结尾的NUL和空白
+func (t *tiffReader) ascii(e ifdEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.data), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// integer 读取SHORT或LONG字段的第一个值
+func (t *tiffReader) integer(e ifdEntry) int {
+	switch e.typ {
+	case 3:
+		return int(t.order.Uint16(e.data))
+	case 4:
+		return int(t.order.Uint32(e.data))
+	}
+	return 0
+}
+
+// rationals 读取RATIONAL字段
+func (t *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	values := make([]float64, e.count)
+	for i := range values {
+		num := t.order.Uint32(e.data[i*8:])
+		den := t.order.Uint32(e.data[i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		values[i] = float64(num) / float64(den)
+	}
+	return values
+}
+
+// location 从GPS IFD读取经纬度（度、分、秒），缺少任一项时返回nil
+func (t *tiffReader) location(gps map[uint16]ifdEntry) *Location {
+	lat := t.rationals(gps[tagGPSLatitude])
+	lon := t.rationals(gps[tagGPSLongitude])
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil
+	}
+	loc := &Location{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lon[0] + lon[1]/60 + lon[2]/3600,
+	}
+	if t.ascii(gps[tagGPSLatitudeRef]) == "S" {
+		loc.Latitude = -loc.Latitude
+	}
+	if t.ascii(gps[tagGPSLongitudeRef]) == "W" {
+		loc.Longitude = -loc.Longitude
+	}
+	if math.Abs(loc.Latitude) > 90 || math.Abs(loc.Longitude) > 180 {
+		return nil
+	}
+	return loc
+}
+
+// parseEXIFTime 解析EXIF日期时间，offset为OffsetTimeOriginal（如+08:00），为空时按UTC处理。
+// 相机未设置时间时写入的全零值返回零时间
+func parseEXIFTime(value, offset string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		if t, err := time.Parse(exifOffsetTimeLayout, value+offset); err == nil {
+			return t
+		}
+	}
+	t, err := time.Parse(exifDateTimeLayout, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
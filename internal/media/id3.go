@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// extractID3 读取ID3v2.3/2.4标签中的标题、艺术家、专辑和时长（TLEN帧）。
+// 没有TLEN帧时不计算时长，不扫描音频帧；没有ID3v2标签时返回空的元数据
+func extractID3(r io.ReaderAt, size int64) (*Metadata, error) {
+	head, err := readHead(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(head) < 10 || string(head[:3]) != "ID3" || (head[3] != 3 && head[3] != 4) {
+		return &Metadata{}, nil
+	}
+	version := head[3]
+	flags := head[5]
+	end := 10 + syncsafe(head[6:10])
+	if end > len(head) {
+		end = len(head) // 标签超过读取的部分时只解析读取到的帧
+	}
+
+	pos := 10
+	if flags&0x40 != 0 && pos+4 <= end { // 扩展头
+		extSize := int(binary.BigEndian.Uint32(head[pos:]))
+		if version == 4 {
+			extSize = syncsafe(head[pos : pos+4])
+		} else {
+			extSize += 4 // v2.3的大小不包括大小字段本身
+		}
+		pos += extSize
+	}
+
+	m := &Metadata{}
+	for pos+10 <= end {
+		id := string(head[pos : pos+4])
+		if id[0] == 0 {
+			break // 填充
+		}
+		frameSize := int(binary.BigEndian.Uint32(head[pos+4:]))
+		if version == 4 {
+			frameSize = syncsafe(head[pos+4 : pos+8])
+		}
+		pos += 10
+		if frameSize < 0 || pos+frameSize > end {
+			break
+		}
+		frame := head[pos : pos+frameSize]
+		pos += frameSize
+
+		switch id {
+		case "TIT2":
+			m.Title = id3Text(frame)
+		case "TPE1":
+			m.Artist = id3Text(frame)
+		case "TALB":
+			m.Album = id3Text(frame)
+		case "TLEN":
+			if ms, err := strconv.ParseInt(id3Text(frame), 10, 64); err == nil && ms > 0 {
+				m.Duration = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return m, nil
+}
+
+// syncsafe 解析每字节7位的同步安全整数
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// id3Text 解码文本帧，第一个字节为编码：0 ISO-8859-1，1 带BOM的UTF-16，2 UTF-16BE，3 UTF-8。
+// 多个值（v2.4以NUL分隔）只取第一个
+func id3Text(frame []byte) string {
+	if len(frame) < 1 {
+		return ""
+	}
+	data := frame[1:]
+	var text string
+	switch frame[0] {
+	case 0:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if frame[0] == 1 && len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[i*2:])
+		}
+		text = string(utf16.Decode(units))
+	case 3:
+		text = string(data)
+	default:
+		return ""
+	}
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
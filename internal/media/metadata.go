@@ -0,0 +1,214 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported 内容类型不支持提取元数据
+var ErrUnsupported = errors.New("unsupported media type")
+
+// headSize 图片和音频只读取文件开头这么多字节，EXIF和ID3标签都在文件开头
+const headSize = 512 << 10
+
+// Location 拍摄地点（WGS 84十进制度数，南纬、西经为负）
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Metadata 从文件内容中提取的媒体元数据，未能提取的字段为零值
+type Metadata struct {
+	Width  int
+	Height int
+	// TakenAt 拍摄时间：照片取EXIF的DateTimeOriginal，视频取mvhd的创建时间。
+	// EXIF没有记录时区时按UTC处理
+	TakenAt     time.Time
+	Location    *Location
+	Duration    time.Duration
+	CameraMake  string
+	CameraModel string
+	Title       string
+	Artist      string
+	Album       string
+}
+
+// 元数据作为只读属性时的属性名
+const (
+	PropertyWidth       = "width"
+	PropertyHeight      = "height"
+	PropertyTakenAt     = "taken-at"
+	PropertyLatitude    = "latitude"
+	PropertyLongitude   = "longitude"
+	PropertyDuration    = "duration"
+	PropertyCameraMake  = "camera-make"
+	PropertyCameraModel = "camera-model"
+	PropertyTitle       = "title"
+	PropertyArtist      = "artist"
+	PropertyAlbum       = "album"
+)
+
+// Properties 把元数据转换为属性值，未提取到的字段不输出；withLocation为false时不输出拍摄地点
+func (m *Metadata) Properties(withLocation bool) map[string]string {
+	props := make(map[string]string)
+	set := func(name, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			props[name] = value
+		}
+	}
+	if m.Width > 0 && m.Height > 0 {
+		set(PropertyWidth, strconv.Itoa(m.Width))
+		set(PropertyHeight, strconv.Itoa(m.Height))
+	}
+	if !m.TakenAt.IsZero() {
+		set(PropertyTakenAt, m.TakenAt.Format(time.RFC3339))
+	}
+	if withLocation && m.Location != nil {
+		set(PropertyLatitude, strconv.FormatFloat(m.Location.Latitude, 'f', 6, 64))
+		set(PropertyLongitude, strconv.FormatFloat(m.Location.Longitude, 'f', 6, 64))
+	}
+	if m.Duration > 0 {
+		set(PropertyDuration, strconv.FormatFloat(m.Duration.Seconds(), 'f', -1, 64))
+	}
+	set(PropertyCameraMake, m.CameraMake)
+	set(PropertyCameraModel, m.CameraModel)
+	set(PropertyTitle, m.Title)
+	set(PropertyArtist, m.Artist)
+	set(PropertyAlbum, m.Album)
+	return props
+}
+
+// Supported 判断内容类型是否支持提取元数据
+func Supported(contentType string) bool {
+	_, ok := extractors[mediaType(contentType)]
+	return ok
+}
+
+type extractor func(r io.ReaderAt, size int64) (*Metadata, error)
+
+var extractors = map[string]extractor{
+	"image/jpeg":      extractJPEG,
+	"image/png":       extractImageConfig,
+	"image/gif":       extractImageConfig,
+	"image/tiff":      extractTIFF,
+	"video/mp4":       extractMP4,
+	"video/quicktime": extractMP4,
+	"video/x-m4v":     extractMP4,
+	"audio/mp4":       extractMP4,
+	"audio/x-m4a":     extractMP4,
+	"audio/mpeg":      extractID3,
+}
+
+// Extract 按内容类型从文件内容中提取元数据，不支持的类型返回ErrUnsupported。
+// 视频按盒子结构跳读，只读取moov盒子，不会读取整个文件
+func Extract(r io.ReaderAt, size int64, contentType string) (*Metadata, error) {
+	extract, ok := extractors[mediaType(contentType)]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return extract(r, size)
+}
+
+// mediaType 去掉参数并转为小写
+func mediaType(contentType string) string {
+	if mt, _, ok := strings.Cut(contentType, ";"); ok {
+		contentType = mt
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// readHead 读取文件开头最多headSize字节
+func readHead(r io.ReaderAt, size int64) ([]byte, error) {
+	n := size
+	if n > headSize {
+		n = headSize
+	}
+	head := make([]byte, n)
+	read, err := r.ReadAt(head, 0)
+	if err != nil && !(errors.Is(err, io.EOF) && int64(read) == n) {
+		return nil, err
+	}
+	return head, nil
+}
+
+// extractImageConfig 只读取图片尺寸
+func extractImageConfig(r io.ReaderAt, size int64) (*Metadata, error) {
+	head, err := readHead(r, size)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// extractJPEG 读取尺寸和APP1段中的EXIF。尺寸不在文件开头（SOF段之前有很大的缩略图）时只返回EXIF
+func extractJPEG(r io.ReaderAt, size int64) (*Metadata, error) {
+	head, err := readHead(r, size)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	if exif := jpegEXIF(head); exif != nil {
+		if err := parseTIFF(exif, m); err != nil {
+			return nil, err
+		}
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		m.Width, m.Height = cfg.Width, cfg.Height
+	}
+	return m, nil
+}
+
+// jpegEXIF 在JPEG段中查找Exif APP1段，返回其中的TIFF数据
+func jpegEXIF(b []byte) []byte {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return nil
+		}
+		marker := b[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return nil // 图像数据开始，后面不再有元数据段
+		}
+		length := int(b[i+2])<<8 | int(b[i+3])
+		if length < 2 || i+2+length > len(b) {
+			return nil
+		}
+		segment := b[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// extractTIFF TIFF文件本身就是EXIF的容器
+func extractTIFF(r io.ReaderAt, size int64) (*Metadata, error) {
+	head, err := readHead(r, size)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	if err := parseTIFF(head, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
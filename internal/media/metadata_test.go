@@ -0,0 +1,233 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEntry 构造测试用TIFF的字段，ifd大于0时值为第ifd个IFD的偏移
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	ifd   int
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func shortEntry(order binary.ByteOrder, tag, v uint16) testEntry {
+	value := make([]byte, 4)
+	order.PutUint16(value, v)
+	return testEntry{tag: tag, typ: 3, count: 1, value: value}
+}
+
+func rationalEntry(order binary.ByteOrder, tag uint16, values ...[2]uint32) testEntry {
+	value := make([]byte, 8*len(values))
+	for i, v := range values {
+		order.PutUint32(value[i*8:], v[0])
+		order.PutUint32(value[i*8+4:], v[1])
+	}
+	return testEntry{tag: tag, typ: 5, count: uint32(len(values)), value: value}
+}
+
+func pointerEntry(tag uint16, ifd int) testEntry {
+	return testEntry{tag: tag, typ: 4, count: 1, ifd: ifd}
+}
+
+// buildTIFF 依次排列IFD，每个IFD后面是它放不进字段的值
+func buildTIFF(order binary.ByteOrder, ifds ...[]testEntry) []byte {
+	offsets := make([]uint32, len(ifds))
+	offset := uint32(8)
+	for i, entries := range ifds {
+		offsets[i] = offset
+		offset += uint32(2 + 12*len(entries) + 4)
+		for _, e := range entries {
+			if len(e.value) > 4 {
+				offset += uint32(len(e.value))
+			}
+		}
+	}
+
+	b := make([]byte, offset)
+	if order == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+	for i, entries := range ifds {
+		pos := offsets[i]
+		order.PutUint16(b[pos:], uint16(len(entries)))
+		data := pos + 2 + uint32(12*len(entries)) + 4
+		for j, e := range entries {
+			raw := b[pos+2+uint32(12*j):]
+			order.PutUint16(raw[0:], e.tag)
+			order.PutUint16(raw[2:], e.typ)
+			order.PutUint32(raw[4:], e.count)
+			switch {
+			case e.ifd > 0:
+				order.PutUint32(raw[8:], offsets[e.ifd])
+			case len(e.value) > 4:
+				copy(b[data:], e.value)
+				order.PutUint32(raw[8:], data)
+				data += uint32(len(e.value))
+			default:
+				copy(raw[8:12], e.value)
+			}
+		}
+	}
+	return b
+}
+
+func TestExtractJPEGWithEXIF(t *testing.T) {
+	order := binary.LittleEndian
+	tiff := buildTIFF(order,
+		[]testEntry{asciiEntry(tagMake, "Canon"), asciiEntry(tagModel, "EOS R5"), pointerEntry(tagExifIFD, 1), pointerEntry(tagGPSIFD, 2)},
+		[]testEntry{asciiEntry(tagDateTimeOriginal, "2023:07:14 18:30:05"), asciiEntry(tagOffsetTimeOrig, "+08:00")},
+		[]testEntry{
+			asciiEntry(tagGPSLatitudeRef, "N"),
+			rationalEntry(order, tagGPSLatitude, [2]uint32{31, 1}, [2]uint32{14, 1}, [2]uint32{2430, 100}),
+			asciiEntry(tagGPSLongitudeRef, "W"),
+			rationalEntry(order, tagGPSLongitude, [2]uint32{121, 1}, [2]uint32{28, 1}, [2]uint32{0, 1}),
+		},
+	)
+
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 3)), nil))
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	file := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}
+	file = append(append(file, app1...), encoded.Bytes()[2:]...)
+
+	m, err := Extract(bytes.NewReader(file), int64(len(file)), "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, 4, m.Width)
+	assert.Equal(t, 3, m.Height)
+	assert.Equal(t, "Canon", m.CameraMake)
+	assert.Equal(t, "EOS R5", m.CameraModel)
+	assert.True(t, m.TakenAt.Equal(time.Date(2023, 7, 14, 10, 30, 5, 0, time.UTC)), m.TakenAt)
+	require.NotNil(t, m.Location)
+	assert.InDelta(t, 31.240083, m.Location.Latitude, 1e-6)
+	assert.InDelta(t, -121.466667, m.Location.Longitude, 1e-6)
+
+	props := m.Properties(false)
+	assert.Equal(t, "2023-07-14T18:30:05+08:00", props[PropertyTakenAt])
+	assert.Equal(t, "4", props[PropertyWidth])
+	assert.NotContains(t, props, PropertyLatitude)
+	assert.Equal(t, "31.240083", m.Properties(true)[PropertyLatitude])
+}
+
+func TestExtractTIFFWithoutExifIFD(t *testing.T) {
+	order := binary.BigEndian
+	tiff := buildTIFF(order, []testEntry{
+		shortEntry(order, tagImageWidth, 640),
+		shortEntry(order, tagImageLength, 480),
+		asciiEntry(tagDateTime, "0000:00:00 00:00:00"),
+	})
+
+	m, err := Extract(bytes.NewReader(tiff), int64(len(tiff)), "image/tiff")
+	require.NoError(t, err)
+	assert.Equal(t, 640, m.Width)
+	assert.Equal(t, 480, m.Height)
+	assert.True(t, m.TakenAt.IsZero(), "unset camera clock must not become a date")
+	assert.Nil(t, m.Location)
+
+	_, err = Extract(bytes.NewReader([]byte("not a tiff")), 10, "image/tiff")
+	assert.Error(t, err)
+}
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(box, uint32(8+len(body)))
+	copy(box[4:], typ)
+	return append(box, body...)
+}
+
+func TestExtractMP4(t *testing.T) {
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(mp4Epoch)/time.Second))
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 90500)
+
+	videoTkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(videoTkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(videoTkhd[80:], 1080<<16)
+	audioTkhd := make([]byte, 84)
+
+	file := bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		mp4Box("mdat", make([]byte, 1024)),
+		mp4Box("moov",
+			mp4Box("mvhd", mvhd),
+			mp4Box("trak", mp4Box("tkhd", audioTkhd)),
+			mp4Box("trak", mp4Box("tkhd", videoTkhd)),
+		),
+	}, nil)
+
+	m, err := Extract(bytes.NewReader(file), int64(len(file)), "video/mp4")
+	require.NoError(t, err)
+	assert.True(t, m.TakenAt.Equal(created), m.TakenAt)
+	assert.Equal(t, 90500*time.Millisecond, m.Duration)
+	assert.Equal(t, 1920, m.Width)
+	assert.Equal(t, 1080, m.Height)
+	assert.Equal(t, "90.5", m.Properties(false)[PropertyDuration])
+
+	_, err = Extract(bytes.NewReader(file[:40]), 40, "video/mp4")
+	assert.Error(t, err, "file without moov")
+}
+
+func id3Frame(id string, text []byte) []byte {
+	frame := make([]byte, 10, 10+len(text))
+	copy(frame, id)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(text)))
+	return append(frame, text...)
+}
+
+func TestExtractID3(t *testing.T) {
+	artist := []byte{1, 0xFF, 0xFE} // UTF-16LE带BOM
+	for _, r := range "Artïst" {
+		artist = append(artist, byte(r), byte(r>>8))
+	}
+	frames := bytes.Join([][]byte{
+		id3Frame("TIT2", []byte("\x00Song")),
+		id3Frame("TPE1", artist),
+		id3Frame("TALB", []byte("\x03Album\x00")),
+		id3Frame("TLEN", []byte("\x00185000")),
+	}, nil)
+	frames = append(frames, make([]byte, 16)...) // 填充
+	size := len(frames)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	file := append(append(header, frames...), make([]byte, 256)...)
+
+	m, err := Extract(bytes.NewReader(file), int64(len(file)), "audio/mpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "Song", m.Title)
+	assert.Equal(t, "Artïst", m.Artist)
+	assert.Equal(t, "Album", m.Album)
+	assert.Equal(t, 185*time.Second, m.Duration)
+
+	m, err = Extract(bytes.NewReader(make([]byte, 64)), 64, "audio/mpeg")
+	require.NoError(t, err)
+	assert.Empty(t, m.Properties(true), "mp3 without id3 tag")
+}
+
+func TestSupported(t *testing.T) {
+	assert.True(t, Supported("image/jpeg"))
+	assert.True(t, Supported("Video/MP4; codecs=avc1"))
+	assert.False(t, Supported("application/pdf"))
+
+	_, err := Extract(bytes.NewReader(nil), 0, "text/plain")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
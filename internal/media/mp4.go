@@ -0,0 +1,152 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// errInvalidMP4 MP4/QuickTime盒子结构错误
+var errInvalidMP4 = errors.New("invalid mp4 data")
+
+// maxMoovSize moov盒子的大小上限，超出时不提取（正常视频的moov远小于该值）
+const maxMoovSize = 32 << 20
+
+// mp4Epoch MP4时间字段的起点
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// extractMP4 从moov盒子中读取时长、创建时间（mvhd）和第一个视频轨道的尺寸（tkhd）
+func extractMP4(r io.ReaderAt, size int64) (*Metadata, error) {
+	moov, err := findMoov(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{}
+	err = walkBoxes(moov, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			parseMVHD(payload, m)
+		case "trak":
+			return walkBoxes(payload, func(typ string, payload []byte) error {
+				if typ == "tkhd" && m.Width == 0 {
+					m.Width, m.Height = parseTKHD(payload)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// findMoov 按盒子头跳读顶层盒子，读取moov盒子的内容
+func findMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	var header [16]byte
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+		switch boxSize {
+		case 0: // 延伸到文件末尾
+			boxSize = size - offset
+		case 1: // 64位大小
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if boxSize < headerLen || offset+boxSize > size {
+			return nil, errInvalidMP4
+		}
+
+		if typ == "moov" {
+			if boxSize-headerLen > maxMoovSize {
+				return nil, errInvalidMP4
+			}
+			moov := make([]byte, boxSize-headerLen)
+			if _, err := r.ReadAt(moov, offset+headerLen); err != nil && !(errors.Is(err, io.EOF) && offset+boxSize == size) {
+				return nil, err
+			}
+			return moov, nil
+		}
+		offset += boxSize
+	}
+	return nil, errInvalidMP4
+}
+
+// walkBoxes 遍历内存中的一层盒子
+func walkBoxes(b []byte, fn func(typ string, payload []byte) error) error {
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b[:4]))
+		typ := string(b[4:8])
+		headerLen := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return errInvalidMP4
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			headerLen = 16
+		}
+		if size < headerLen || size > uint64(len(b)) {
+			return errInvalidMP4
+		}
+		if err := fn(typ, b[headerLen:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// parseMVHD 读取电影头中的创建时间和时长，版本1使用64位字段
+func parseMVHD(b []byte, m *Metadata) {
+	var created, timescale, duration uint64
+	switch {
+	case len(b) >= 20 && b[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(b[4:8]))
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	case len(b) >= 32 && b[0] == 1:
+		created = binary.BigEndian.Uint64(b[4:12])
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	default:
+		return
+	}
+	// 很多设备不写创建时间（为0），不能当作1904年
+	if created > 0 {
+		m.TakenAt = mp4Epoch.Add(time.Duration(created) * time.Second)
+	}
+	if timescale > 0 && duration > 0 && duration != 1<<32-1 && duration != 1<<64-1 {
+		m.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+}
+
+// parseTKHD 读取轨道头中的显示尺寸（16.16定点数），音频轨道为0
+func parseTKHD(b []byte) (int, int) {
+	offset := 76
+	if len(b) > 0 && b[0] == 1 {
+		offset = 88
+	}
+	if len(b) < offset+8 {
+		return 0, 0
+	}
+	width := int(binary.BigEndian.Uint32(b[offset:]) >> 16)
+	height := int(binary.BigEndian.Uint32(b[offset+4:]) >> 16)
+	if width == 0 || height == 0 {
+		return 0, 0
+	}
+	return width, height
+}
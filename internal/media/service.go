@@ -0,0 +1,197 @@
+// Package media 媒体元数据：图片、视频和音频写入后在后台提取尺寸、拍摄时间、拍摄地点、时长等，
+// 结果保存在media_metadata表中供搜索按拍摄时间等条件过滤，并作为只读属性在PROPFIND中返回
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// 提取状态
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusDone       = "done"
+	StatusFailed     = "failed"
+)
+
+// PropertyStore 保存提取结果对应的只读属性
+type PropertyStore interface {
+	SetMediaProperties(ctx context.Context, userID, resourcePath string, values map[string]string) error
+}
+
+// Service 排队并提取媒体元数据。记录按稳定文件ID保存，文件移动、改名后搜索仍然命中；
+// 内容变化（ETag不同）时重新提取
+type Service struct {
+	db         *sql.DB
+	storage    *storage.Service
+	properties PropertyStore
+	config     config.MediaConfig
+
+	cancel   context.CancelFunc
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewService 创建媒体元数据服务
+func NewService(db *sql.DB, storageService *storage.Service, properties PropertyStore, cfg config.MediaConfig) *Service {
+	return &Service{
+		db:         db,
+		storage:    storageService,
+		properties: properties,
+		config:     cfg,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Initialize 创建媒体元数据表
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS media_metadata (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			file_id TEXT NOT NULL,
+			path TEXT NOT NULL,
+			etag TEXT NOT NULL DEFAULT '',
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			width INTEGER,
+			height INTEGER,
+			taken_at TIMESTAMP WITH TIME ZONE,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			duration_seconds DOUBLE PRECISION,
+			camera_make TEXT NOT NULL DEFAULT '',
+			camera_model TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			artist TEXT NOT NULL DEFAULT '',
+			album TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, file_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_metadata_queue ON media_metadata(updated_at) WHERE status IN ('pending', 'processing')`,
+		`CREATE INDEX IF NOT EXISTS idx_media_metadata_taken_at ON media_metadata(user_id, taken_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize media tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// Enqueue 文件写入后排队提取元数据。不支持的类型、目录、没有稳定ID的文件直接忽略；
+// 已提取过且内容未变（如移动、改名）时只更新路径
+func (s *Service) Enqueue(ctx context.Context, userID uuid.UUID, filePath string) error {
+	if filePath == "" || strings.HasSuffix(filePath, "/") {
+		return nil
+	}
+	info, err := s.storage.StatObject(ctx, userID, filePath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat %s: %w", filePath, err)
+	}
+	contentType := contenttype.Resolve(filePath, info.ContentType)
+	fileID := storage.FileID(*info)
+	if fileID == "" || !Supported(contentType) {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO media_metadata (user_id, file_id, path, etag, content_type)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, file_id) DO UPDATE SET
+			path = EXCLUDED.path,
+			status = CASE WHEN media_metadata.etag = EXCLUDED.etag THEN media_metadata.status ELSE 'pending' END,
+			attempts = CASE WHEN media_metadata.etag = EXCLUDED.etag THEN media_metadata.attempts ELSE 0 END,
+			etag = EXCLUDED.etag,
+			content_type = EXCLUDED.content_type,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, fileID, filePath, info.ETag, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to queue media metadata for %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// MatchFileIDs 返回元数据满足条件的文件ID，供搜索过滤遍历到的对象
+func (s *Service) MatchFileIDs(ctx context.Context, userID uuid.UUID, filter webdav.MediaFilter) (map[string]bool, error) {
+	conditions := []string{"user_id = $1", "status = 'done'"}
+	args := []interface{}{userID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if !filter.TakenAfter.IsZero() {
+		add("taken_at >= $%d", filter.TakenAfter)
+	}
+	if !filter.TakenBefore.IsZero() {
+		add("taken_at < $%d", filter.TakenBefore)
+	}
+	if filter.MinWidth > 0 {
+		add("width >= $%d", filter.MinWidth)
+	}
+	if filter.MinHeight > 0 {
+		add("height >= $%d", filter.MinHeight)
+	}
+	if filter.HasLocation {
+		conditions = append(conditions, "latitude IS NOT NULL")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT file_id FROM media_metadata WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media metadata: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// objectReader 按需读取对象的字节区间，etag保证提取期间读到的是同一版本
+type objectReader struct {
+	ctx     context.Context
+	storage *storage.Service
+	userID  uuid.UUID
+	path    string
+	etag    string
+}
+
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	obj, err := r.storage.GetObjectRange(r.ctx, r.userID, r.path, off, off+int64(len(p))-1, r.etag)
+	if err != nil {
+		return 0, err
+	}
+	defer obj.Close()
+	n, err := io.ReadFull(obj, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,230 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+const (
+	// batchSize 每次轮询领取的文件数
+	batchSize = 20
+	// maxAttempts 提取失败（如读取存储出错）后的重试次数
+	maxAttempts = 3
+	// staleAfter 领取后超过该时长仍未完成的记录视为副本已退出，重新领取
+	staleAfter = 10 * time.Minute
+)
+
+// job 领取的待提取文件
+type job struct {
+	userID uuid.UUID
+	fileID string
+	path   string
+	etag   string
+}
+
+// Start 启动后台提取。PollInterval不大于0时不启动，本副本只排队不提取
+func (s *Service) Start() {
+	if s.config.PollInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// 一批处理完后立即领取下一批，队列为空时等待下一次轮询
+			for s.processBatch(ctx) == batchSize {
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台提取，正在提取的文件在下次启动后重新领取
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// processBatch 领取并提取一批文件，返回领取的数量
+func (s *Service) processBatch(ctx context.Context) int {
+	jobs, err := s.claim(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to claim media metadata jobs: %v", err)
+		}
+		return 0
+	}
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return 0
+		}
+		s.process(ctx, j)
+	}
+	return len(jobs)
+}
+
+// claim 以条件更新领取待提取的记录，多副本部署时每个文件只由一个副本提取。
+// 重试次数用完仍未完成的记录标记为failed
+func (s *Service) claim(ctx context.Context) ([]job, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE media_metadata SET status = $1, error = 'extraction did not finish', updated_at = CURRENT_TIMESTAMP
+		WHERE status = $2 AND attempts >= $3 AND updated_at < $4`,
+		StatusFailed, StatusProcessing, maxAttempts, time.Now().Add(-staleAfter)); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE media_metadata SET status = $1, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE (user_id, file_id) IN (
+			SELECT user_id, file_id FROM media_metadata
+			WHERE (status = $2 OR (status = $1 AND updated_at < $3)) AND attempts < $4
+			ORDER BY updated_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED)
+		RETURNING user_id, file_id, path, etag`,
+		StatusProcessing, StatusPending, time.Now().Add(-staleAfter), maxAttempts, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []job
+	for rows.Next() {
+		var j job
+		if err := rows.Scan(&j.userID, &j.fileID, &j.path, &j.etag); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// process 提取单个文件。文件已删除或路径上已是另一个文件时丢弃记录；
+// 读取存储出错时放回队列重试，内容无法解析时标记为failed
+func (s *Service) process(ctx context.Context, j job) {
+	info, err := s.storage.StatObject(ctx, j.userID, j.path)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			s.drop(ctx, j)
+			return
+		}
+		s.retry(ctx, j, err)
+		return
+	}
+	if storage.FileID(*info) != j.fileID {
+		s.drop(ctx, j)
+		return
+	}
+
+	reader := &objectReader{ctx: ctx, storage: s.storage, userID: j.userID, path: j.path, etag: info.ETag}
+	m, err := Extract(reader, info.Size, contenttype.Resolve(j.path, info.ContentType))
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		if storage.IsPreconditionFailed(err) {
+			// 提取期间文件被覆盖，重新领取时读取新的内容
+			s.retry(ctx, j, err)
+			return
+		}
+		s.fail(ctx, j, err)
+		return
+	}
+	if !s.config.Location {
+		m.Location = nil
+	}
+
+	if err := s.save(ctx, j, info.ETag, m); err != nil {
+		s.retry(ctx, j, err)
+		return
+	}
+	if s.properties != nil {
+		if err := s.properties.SetMediaProperties(ctx, j.userID.String(), j.path, m.Properties(s.config.Location)); err != nil {
+			log.Printf("Warning: failed to write media properties for %s: %v", j.path, err)
+		}
+	}
+}
+
+// save 保存提取结果和提取时的ETag；记录在提取期间被重新排队时不覆盖
+func (s *Service) save(ctx context.Context, j job, etag string, m *Metadata) error {
+	var takenAt sql.NullTime
+	if !m.TakenAt.IsZero() {
+		takenAt = sql.NullTime{Time: m.TakenAt, Valid: true}
+	}
+	var width, height sql.NullInt64
+	if m.Width > 0 && m.Height > 0 {
+		width = sql.NullInt64{Int64: int64(m.Width), Valid: true}
+		height = sql.NullInt64{Int64: int64(m.Height), Valid: true}
+	}
+	var latitude, longitude, duration sql.NullFloat64
+	if m.Location != nil {
+		latitude = sql.NullFloat64{Float64: m.Location.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: m.Location.Longitude, Valid: true}
+	}
+	if m.Duration > 0 {
+		duration = sql.NullFloat64{Float64: m.Duration.Seconds(), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE media_metadata SET status = $1, error = '', width = $2, height = $3, taken_at = $4,
+			latitude = $5, longitude = $6, duration_seconds = $7, camera_make = $8, camera_model = $9,
+			title = $10, artist = $11, album = $12, etag = $13, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $14 AND file_id = $15 AND etag = $16 AND status = $17`,
+		StatusDone, width, height, takenAt, latitude, longitude, duration, m.CameraMake, m.CameraModel,
+		m.Title, m.Artist, m.Album, etag, j.userID, j.fileID, j.etag, StatusProcessing)
+	return err
+}
+
+// retry 放回队列，重试次数用完时标记为failed
+func (s *Service) retry(ctx context.Context, j job, cause error) {
+	if ctx.Err() != nil {
+		return
+	}
+	log.Printf("Warning: failed to extract media metadata from %s: %v", j.path, cause)
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE media_metadata SET status = CASE WHEN attempts >= $1 THEN $2 ELSE $3 END, error = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $5 AND file_id = $6 AND status = $7`,
+		maxAttempts, StatusFailed, StatusPending, cause.Error(), j.userID, j.fileID, StatusProcessing); err != nil {
+		log.Printf("Warning: failed to requeue media metadata for %s: %v", j.path, err)
+	}
+}
+
+// fail 内容无法解析，不再重试
+func (s *Service) fail(ctx context.Context, j job, cause error) {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE media_metadata SET status = $1, error = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $3 AND file_id = $4 AND status = $5`,
+		StatusFailed, cause.Error(), j.userID, j.fileID, StatusProcessing); err != nil {
+		log.Printf("Warning: failed to update media metadata for %s: %v", j.path, err)
+	}
+}
+
+// drop 文件已不存在，删除记录
+func (s *Service) drop(ctx context.Context, j job) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM media_metadata WHERE user_id = $1 AND file_id = $2 AND etag = $3`,
+		j.userID, j.fileID, j.etag); err != nil {
+		log.Printf("Warning: failed to delete media metadata for %s: %v", j.path, err)
+	}
+}
@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 特殊的tenant标签取值
+const (
+	// TenantOther 超出标签上限或不在Include列表中的租户
+	TenantOther = "_other"
+	// TenantAnonymous 未认证的请求，如分享链接和公开命名空间
+	TenantAnonymous = "_anonymous"
+	// TenantNone 不属于任何租户的账号，未启用多租户时所有账号都是如此
+	TenantNone = "_none"
+)
+
+// trackedMethods 单独统计的请求方法，其余归为OTHER，保证method标签取值有限
+var trackedMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPut: true, http.MethodPost: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+	"PROPFIND": true, "PROPPATCH": true, "MKCOL": true, "COPY": true, "MOVE": true,
+	"LOCK": true, "UNLOCK": true, "REPORT": true, "SEARCH": true,
+}
+
+type requestKey struct {
+	method string
+	class  string
+}
+
+type tenantCounters struct {
+	requests map[requestKey]uint64
+	ingress  uint64
+	egress   uint64
+}
+
+type storageUsage struct {
+	used  int64
+	quota int64
+	users int
+}
+
+// TenantMetrics 按租户累计请求数和流量，并定期从数据库读取存储用量。
+// tenant标签取租户的slug，最多MaxTenants个取值，其余租户合并到_other
+type TenantMetrics struct {
+	db          *sql.DB
+	config      config.TenantMetricsConfig
+	multiTenant bool
+
+	mu       sync.Mutex
+	include  map[string]bool
+	labels   map[string]bool
+	folded   map[string]bool
+	counters map[string]*tenantCounters
+
+	storageMu      sync.Mutex
+	storage        map[string]storageUsage
+	storageFetched time.Time
+}
+
+// NewTenantMetrics 创建租户用量指标，db为nil时不导出存储用量
+func NewTenantMetrics(db *sql.DB, cfg config.TenantMetricsConfig) *TenantMetrics {
+	m := &TenantMetrics{
+		db:       db,
+		config:   cfg,
+		labels:   make(map[string]bool),
+		folded:   make(map[string]bool),
+		counters: make(map[string]*tenantCounters),
+	}
+	if len(cfg.Include) > 0 {
+		m.include = make(map[string]bool, len(cfg.Include))
+		for _, tenant := range cfg.Include {
+			m.include[tenant] = true
+		}
+	}
+	return m
+}
+
+// SetMultiTenant 设置是否启用了多租户。未启用时没有tenants表，存储用量全部计入_none
+func (m *TenantMetrics) SetMultiTenant(enabled bool) {
+	m.storageMu.Lock()
+	m.multiTenant = enabled
+	m.storageMu.Unlock()
+}
+
+// label 返回租户使用的标签取值，调用方需持有mu
+func (m *TenantMetrics) label(tenant string) string {
+	switch tenant {
+	case "":
+		return TenantAnonymous
+	case TenantNone:
+		return TenantNone
+	}
+	if m.labels[tenant] {
+		return tenant
+	}
+	if (m.include != nil && !m.include[tenant]) || (m.config.MaxTenants > 0 && len(m.labels) >= m.config.MaxTenants) {
+		m.folded[tenant] = true
+		return TenantOther
+	}
+	m.labels[tenant] = true
+	return tenant
+}
+
+// Observe 记录一个请求，tenant为租户slug，已认证但不属于租户的请求传TenantNone，未认证的传空字符串；
+// ingress/egress为请求体和响应体的字节数
+func (m *TenantMetrics) Observe(tenant, method string, status int, ingress, egress int64) {
+	if !trackedMethods[method] {
+		method = "OTHER"
+	}
+	key := requestKey{method: method, class: fmt.Sprintf("%dxx", status/100)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	label := m.label(tenant)
+	c := m.counters[label]
+	if c == nil {
+		c = &tenantCounters{requests: make(map[requestKey]uint64)}
+		m.counters[label] = c
+	}
+	c.requests[key]++
+	if ingress > 0 {
+		c.ingress += uint64(ingress)
+	}
+	if egress > 0 {
+		c.egress += uint64(egress)
+	}
+}
+
+// refreshStorage 距上次读取超过StorageRefresh时重新按租户汇总活跃账号的存储用量
+func (m *TenantMetrics) refreshStorage(ctx context.Context) map[string]storageUsage {
+	m.storageMu.Lock()
+	defer m.storageMu.Unlock()
+
+	if m.db == nil || (m.storage != nil && time.Since(m.storageFetched) < m.config.StorageRefresh) {
+		return m.storage
+	}
+
+	// 按用量降序读取，未指定Include时标签优先分配给用量大的租户
+	query := `
+		SELECT '', COALESCE(SUM(storage_used), 0), COALESCE(SUM(storage_quota), 0), COUNT(*)
+		FROM users WHERE status = 'active'`
+	if m.multiTenant {
+		query = `
+		SELECT COALESCE(t.slug, ''), COALESCE(SUM(u.storage_used), 0), COALESCE(SUM(u.storage_quota), 0), COUNT(*)
+		FROM users u LEFT JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.status = 'active'
+		GROUP BY t.slug
+		ORDER BY 2 DESC`
+	}
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Warning: failed to read tenant storage usage: %v", err)
+		return m.storage
+	}
+	defer rows.Close()
+
+	usage := make(map[string]storageUsage)
+	m.mu.Lock()
+	for rows.Next() {
+		var tenant string
+		var used, quota int64
+		var users int
+		if err := rows.Scan(&tenant, &used, &quota, &users); err != nil {
+			break
+		}
+		if users == 0 {
+			continue
+		}
+		if tenant == "" {
+			tenant = TenantNone
+		}
+		label := m.label(tenant)
+		u := usage[label]
+		u.used += used
+		u.quota += quota
+		u.users += users
+		usage[label] = u
+	}
+	m.mu.Unlock()
+	if err := rows.Err(); err != nil {
+		log.Printf("Warning: failed to read tenant storage usage: %v", err)
+		return m.storage
+	}
+
+	m.storage = usage
+	m.storageFetched = time.Now()
+	return usage
+}
+
+// WriteTo 以Prometheus文本格式输出指标
+func (m *TenantMetrics) WriteTo(ctx context.Context, w io.Writer) error {
+	storage := m.refreshStorage(ctx)
+
+	m.mu.Lock()
+	tenants := make([]string, 0, len(m.counters))
+	for tenant := range m.counters {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	var b strings.Builder
+	writeHeader(&b, "webdav_tenant_requests_total", "counter", "Requests handled per tenant, method and status class.")
+	for _, tenant := range tenants {
+		c := m.counters[tenant]
+		keys := make([]requestKey, 0, len(c.requests))
+		for k := range c.requests {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].method != keys[j].method {
+				return keys[i].method < keys[j].method
+			}
+			return keys[i].class < keys[j].class
+		})
+		for _, k := range keys {
+			fmt.Fprintf(&b, "webdav_tenant_requests_total{tenant=%s,method=%q,code=%q} %d\n", quote(tenant), k.method, k.class, c.requests[k])
+		}
+	}
+	writeHeader(&b, "webdav_tenant_ingress_bytes_total", "counter", "Request body bytes received per tenant.")
+	for _, tenant := range tenants {
+		fmt.Fprintf(&b, "webdav_tenant_ingress_bytes_total{tenant=%s} %d\n", quote(tenant), m.counters[tenant].ingress)
+	}
+	writeHeader(&b, "webdav_tenant_egress_bytes_total", "counter", "Response body bytes sent per tenant.")
+	for _, tenant := range tenants {
+		fmt.Fprintf(&b, "webdav_tenant_egress_bytes_total{tenant=%s} %d\n", quote(tenant), m.counters[tenant].egress)
+	}
+	writeHeader(&b, "webdav_tenant_folded", "gauge", "Tenants aggregated into the _other label because of the cardinality cap or include list.")
+	fmt.Fprintf(&b, "webdav_tenant_folded %d\n", len(m.folded))
+	m.mu.Unlock()
+
+	if storage != nil {
+		names := make([]string, 0, len(storage))
+		for tenant := range storage {
+			names = append(names, tenant)
+		}
+		sort.Strings(names)
+		writeHeader(&b, "webdav_tenant_storage_used_bytes", "gauge", "Storage used per tenant.")
+		for _, tenant := range names {
+			fmt.Fprintf(&b, "webdav_tenant_storage_used_bytes{tenant=%s} %d\n", quote(tenant), storage[tenant].used)
+		}
+		writeHeader(&b, "webdav_tenant_storage_quota_bytes", "gauge", "Storage quota per tenant.")
+		for _, tenant := range names {
+			fmt.Fprintf(&b, "webdav_tenant_storage_quota_bytes{tenant=%s} %d\n", quote(tenant), storage[tenant].quota)
+		}
+		writeHeader(&b, "webdav_tenant_users", "gauge", "Active accounts per tenant.")
+		for _, tenant := range names {
+			fmt.Fprintf(&b, "webdav_tenant_users{tenant=%s} %d\n", quote(tenant), storage[tenant].users)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quote 按Prometheus文本格式转义标签值
+func quote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+)
+
+func TestTenantLabelCap(t *testing.T) {
+	m := NewTenantMetrics(nil, config.TenantMetricsConfig{MaxTenants: 2})
+	m.Observe("alice", "GET", 200, 0, 100)
+	m.Observe("bob", "PUT", 201, 50, 0)
+	m.Observe("carol", "GET", 200, 0, 10)
+	m.Observe("dave", "GET", 404, 0, 5)
+	m.Observe("alice", "GET", 200, 0, 1)
+
+	var buf bytes.Buffer
+	if err := m.WriteTo(context.Background(), &buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`webdav_tenant_requests_total{tenant="alice",method="GET",code="2xx"} 2`,
+		`webdav_tenant_requests_total{tenant="bob",method="PUT",code="2xx"} 1`,
+		`webdav_tenant_requests_total{tenant="_other",method="GET",code="4xx"} 1`,
+		`webdav_tenant_egress_bytes_total{tenant="alice"} 101`,
+		`webdav_tenant_egress_bytes_total{tenant="_other"} 15`,
+		`webdav_tenant_ingress_bytes_total{tenant="bob"} 50`,
+		"webdav_tenant_folded 2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "carol") || strings.Contains(out, "dave") {
+		t.Errorf("tenants beyond the cap got their own label:\n%s", out)
+	}
+}
+
+func TestTenantIncludeList(t *testing.T) {
+	m := NewTenantMetrics(nil, config.TenantMetricsConfig{Include: []string{"acme"}, MaxTenants: 10})
+	m.Observe("acme", "PROPFIND", 207, 0, 0)
+	m.Observe("other-co", "BREW", 418, 0, 0)
+	m.Observe("", "GET", 200, 0, 0)
+
+	var buf bytes.Buffer
+	m.WriteTo(context.Background(), &buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		`tenant="acme",method="PROPFIND",code="2xx"} 1`,
+		`tenant="_other",method="OTHER",code="4xx"} 1`,
+		`tenant="_anonymous",method="GET",code="2xx"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, want := quote("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("quote() = %s, want %s", got, want)
+	}
+}
+
+// newTestUsersDB 演示模式的SQLite用户表，按多租户模式添加tenants表和users.tenant_id列
+func newTestUsersDB(t *testing.T) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range []string{
+		`CREATE TABLE tenants (id TEXT PRIMARY KEY, slug TEXT UNIQUE NOT NULL)`,
+		`ALTER TABLE users ADD COLUMN tenant_id TEXT REFERENCES tenants(id)`,
+		`INSERT INTO tenants (id, slug) VALUES ('t1', 'acme'), ('t2', 'globex')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users := []struct {
+		name, tenant, status string
+		used, quota          int64
+	}{
+		{"alice", "t1", "active", 100, 1000},
+		{"bob", "t1", "active", 50, 1000},
+		{"carol", "t2", "active", 10, 500},
+		{"dave", "", "active", 7, 100},
+		{"erin", "t2", "suspended", 9999, 9999},
+	}
+	for _, u := range users {
+		var tenant interface{}
+		if u.tenant != "" {
+			tenant = u.tenant
+		}
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO users (id, username, email, password_hash, storage_used, storage_quota, status, tenant_id)
+			VALUES ($1, $2, $3, 'x', $4, $5, $6, $7)`,
+			uuid.New(), u.name, u.name+"@example.com", u.used, u.quota, u.status, tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// TestTenantStorage 存储用量按租户slug汇总，不出现用户名
+func TestTenantStorage(t *testing.T) {
+	db := newTestUsersDB(t)
+
+	tests := []struct {
+		name        string
+		multiTenant bool
+		want        []string
+	}{
+		{"multi-tenant", true, []string{
+			`webdav_tenant_storage_used_bytes{tenant="acme"} 150`,
+			`webdav_tenant_storage_quota_bytes{tenant="acme"} 2000`,
+			`webdav_tenant_users{tenant="acme"} 2`,
+			`webdav_tenant_storage_used_bytes{tenant="globex"} 10`,
+			`webdav_tenant_users{tenant="globex"} 1`,
+			`webdav_tenant_storage_used_bytes{tenant="_none"} 7`,
+		}},
+		{"single tenant", false, []string{
+			`webdav_tenant_storage_used_bytes{tenant="_none"} 167`,
+			`webdav_tenant_users{tenant="_none"} 4`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewTenantMetrics(db, config.TenantMetricsConfig{MaxTenants: 10})
+			m.SetMultiTenant(tt.multiTenant)
+			var buf bytes.Buffer
+			if err := m.WriteTo(context.Background(), &buf); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want+"\n") {
+					t.Errorf("output missing %q:\n%s", want, out)
+				}
+			}
+			for _, name := range []string{"alice", "bob", "carol", "dave", "erin"} {
+				if strings.Contains(out, name) {
+					t.Errorf("username %s exported as a label:\n%s", name, out)
+				}
+			}
+		})
+	}
+}
+
+// TestTenantNoneNotCapped _none和_anonymous不占用标签上限，也不会被Include合并
+func TestTenantNoneNotCapped(t *testing.T) {
+	m := NewTenantMetrics(nil, config.TenantMetricsConfig{Include: []string{"acme"}, MaxTenants: 1})
+	m.Observe(TenantNone, "GET", 200, 0, 0)
+	m.Observe("acme", "GET", 200, 0, 0)
+
+	var buf bytes.Buffer
+	m.WriteTo(context.Background(), &buf)
+	out := buf.String()
+	for _, want := range []string{`tenant="_none",method="GET"`, `tenant="acme",method="GET"`, "webdav_tenant_folded 0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
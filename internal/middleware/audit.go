@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/audit"
+)
+
+// webdavAuditActions 需要审计的WebDAV方法
+var webdavAuditActions = map[string]string{
+	http.MethodPut:    audit.ActionPut,
+	http.MethodPatch:  audit.ActionPatch,
+	http.MethodDelete: audit.ActionDelete,
+	"MOVE":            audit.ActionMove,
+	"COPY":            audit.ActionCopy,
+	"MKCOL":           audit.ActionMkcol,
+	"LOCK":            audit.ActionLock,
+	"UNLOCK":          audit.ActionUnlock,
+}
+
+// AuditMiddleware 在请求处理完后记录一条审计事件，action为空时按WebDAV方法确定动作，
+// 不需要审计的方法直接放行。处理器可以通过audit.ActorKey、PathKey、DetailsKey补充信息
+func AuditMiddleware(logger *audit.Logger, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if logger == nil {
+			c.Next()
+			return
+		}
+		act := action
+		if act == "" {
+			act = webdavAuditActions[c.Request.Method]
+			if act == "" {
+				c.Next()
+				return
+			}
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		event := audit.Event{
+			Actor:       c.GetString("username"),
+			Action:      act,
+			Path:        c.GetString(audit.PathKey),
+			Destination: c.GetHeader("Destination"),
+			ClientIP:    c.ClientIP(),
+			UserAgent:   c.Request.UserAgent(),
+			Result:      audit.ResultOf(status),
+			Status:      status,
+		}
+		if event.Actor == "" {
+			event.Actor = c.GetString(audit.ActorKey)
+		}
+		if event.Path == "" {
+			event.Path = c.Param("path")
+		}
+		if id, err := uuid.Parse(c.GetString("userID")); err == nil {
+			event.UserID = &id
+		}
+		if details, ok := c.Get(audit.DetailsKey); ok {
+			event.Details, _ = details.(map[string]string)
+		}
+		// Record which API token acted so a leaked token's activity can be traced
+		if tokenID := c.GetString(APITokenIDKey); tokenID != "" {
+			details := make(map[string]string, len(event.Details)+1)
+			for k, v := range event.Details {
+				details[k] = v
+			}
+			details["api_token"] = tokenID
+			event.Details = details
+		}
+		logger.Record(event)
+	}
+}
+
+// AdminMiddleware 只允许配置的管理员访问，需在AuthMiddleware之后使用
+func AdminMiddleware(admins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		allowed[name] = true
+	}
+	return func(c *gin.Context) {
+		if !allowed[c.GetString("username")] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/audit"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+)
+
+// newTestAuditLogger 使用SQLite的审计日志，表结构与audit.Logger.Initialize对应
+func newTestAuditLogger(t *testing.T) *audit.Logger {
+	t.Helper()
+	db, err := demo.OpenDatabase(context.Background(), filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT,
+		actor TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		path TEXT NOT NULL DEFAULT '',
+		destination TEXT NOT NULL DEFAULT '',
+		client_ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		details BLOB
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	logger := audit.NewLogger(db, config.AuditConfig{})
+	logger.Start()
+	return logger
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := newTestAuditLogger(t)
+	userID := uuid.New()
+
+	router := gin.New()
+	dav := router.Group("/webdav", func(c *gin.Context) {
+		c.Set("username", "alice")
+		c.Set("userID", userID.String())
+		if token := c.GetHeader("X-Test-Token"); token != "" {
+			c.Set(APITokenIDKey, token)
+		}
+	}, AuditMiddleware(logger, ""))
+	dav.Handle(http.MethodPut, "/*path", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	dav.Handle(http.MethodGet, "/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+	dav.Handle("MOVE", "/*path", func(c *gin.Context) {
+		c.Set(audit.DetailsKey, map[string]string{"overwrite": "T"})
+		c.Status(http.StatusForbidden)
+	})
+	router.POST("/api/auth/login", AuditMiddleware(logger, audit.ActionLogin), func(c *gin.Context) {
+		c.Set(audit.ActorKey, "bob")
+		c.Set(audit.PathKey, "/login")
+		c.Status(http.StatusUnauthorized)
+	})
+
+	send := func(method, target string, header map[string]string) {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("User-Agent", "davfs2")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send(http.MethodPut, "/webdav/docs/a.txt", map[string]string{"X-Test-Token": "tok-1"})
+	// 读操作不审计
+	send(http.MethodGet, "/webdav/docs/a.txt", nil)
+	send("MOVE", "/webdav/docs/a.txt", map[string]string{"Destination": "/webdav/docs/b.txt"})
+	send(http.MethodPost, "/api/auth/login", nil)
+	logger.Stop()
+
+	events, err := logger.Search(context.Background(), audit.Query{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(events), events)
+	}
+	login, move, put := events[0], events[1], events[2]
+
+	if put.Action != audit.ActionPut || put.Actor != "alice" || put.Path != "/docs/a.txt" ||
+		put.Result != audit.ResultSuccess || put.Status != http.StatusCreated || put.UserAgent != "davfs2" {
+		t.Errorf("PUT event = %+v", put)
+	}
+	if put.UserID == nil || *put.UserID != userID {
+		t.Errorf("PUT UserID = %v, want %s", put.UserID, userID)
+	}
+	if put.Details["api_token"] != "tok-1" {
+		t.Errorf("PUT Details = %v, want the API token ID", put.Details)
+	}
+
+	if move.Action != audit.ActionMove || move.Destination != "/webdav/docs/b.txt" ||
+		move.Result != audit.ResultFailure || move.Status != http.StatusForbidden {
+		t.Errorf("MOVE event = %+v", move)
+	}
+	if move.Details["overwrite"] != "T" || move.Details["api_token"] != "" {
+		t.Errorf("MOVE Details = %v", move.Details)
+	}
+
+	// 未认证请求使用处理器提供的操作者和路径
+	if login.Action != audit.ActionLogin || login.Actor != "bob" || login.Path != "/login" ||
+		login.UserID != nil || login.Result != audit.ResultFailure {
+		t.Errorf("login event = %+v", login)
+	}
+}
+
+func TestAuditMiddlewareNilLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/file", AuditMiddleware(nil, ""), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/file", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin", func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set("username", user)
+		}
+	}, AdminMiddleware([]string{"alice"}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for user, want := range map[string]int{
+		"alice": http.StatusOK,
+		"Alice": http.StatusForbidden,
+		"bob":   http.StatusForbidden,
+		"":      http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("X-Test-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("user %q: status = %d, want %d", user, w.Code, want)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,54 +24,79 @@ func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		// Support both Bearer token and Basic auth
-		var token string
-		
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			token = strings.TrimPrefix(authHeader, "Bearer ")
-		} else if strings.HasPrefix(authHeader, "Basic ") {
-			// For WebDAV clients, we'll use the username as token
-			// This is a simplified approach - in production you might want to handle Basic auth properly
-			c.Header("WWW-Authenticate", `Basic realm="WebDAV"`)
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		} else {
+		// Bearer carries a session JWT or an API token; Basic only carries an API token as the password
+		var claims *auth.JWTClaims
+		var err error
+		switch {
+		case strings.HasPrefix(authHeader, "Bearer "):
+			token := strings.TrimPrefix(authHeader, "Bearer ")
+			if strings.HasPrefix(token, auth.APITokenPrefix) {
+				claims, err = authService.ValidateAPIToken(c.Request.Context(), token, c.ClientIP())
+			} else {
+				claims, err = authService.ValidateToken(token)
+			}
+		case strings.HasPrefix(authHeader, "Basic "):
+			// WebDAV clients and CI tools that only speak Basic auth send the API token as the password
+			username, password, ok := c.Request.BasicAuth()
+			if !ok || !strings.HasPrefix(password, auth.APITokenPrefix) {
+				c.Header("WWW-Authenticate", `Basic realm="WebDAV"`)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			claims, err = authService.ValidateAPIToken(c.Request.Context(), password, c.ClientIP())
+			if err == nil && username != "" && username != claims.Username {
+				err = auth.ErrTokenInvalid
+			}
+		default:
 			c.Header("WWW-Authenticate", `Basic realm="WebDAV"`)
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
-
-		// Validate token
-		claims, err := authService.ValidateToken(token)
 		if err != nil {
-			c.Header("WWW-Authenticate", `Basic realm="WebDAV"`)
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortInvalidToken(c, err, authService.ClockSkew())
 			return
 		}
 
 		// Set user info in context
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		if len(claims.Scopes) > 0 {
+			c.Set(TokenScopesKey, claims.Scopes)
+			c.Set(APITokenIDKey, claims.Id)
+		}
 
 		c.Next()
 	}
 }
 
-func CORSMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PROPFIND, PROPPATCH, MKCOL, COPY, MOVE")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Depth, Destination, Overwrite")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type, Last-Modified, ETag")
-		c.Header("Access-Control-Max-Age", "86400")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
+// abortInvalidToken 返回带错误码的401，客户端时钟偏差过大时明确提示校准时间
+func abortInvalidToken(c *gin.Context, err error, tolerance time.Duration) {
+	now := time.Now()
+	c.Header("WWW-Authenticate", `Basic realm="WebDAV"`)
+
+	code, message := "invalid_token", "invalid token"
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		code, message = "token_expired", "token has expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		code, message = "token_not_yet_valid", "token is not valid yet"
+	case errors.Is(err, auth.ErrTokenRevoked):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session has been revoked", "code": "token_revoked"})
+		return
+	}
 
-		c.Next()
+	body := gin.H{"error": message, "code": code}
+	if code != "invalid_token" {
+		if skew, ok := ClientClockSkew(c, now); ok && skew.Abs() > tolerance {
+			body["code"] = "clock_skew"
+			body["error"] = fmt.Sprintf("client clock is off by %s, please correct the device time", skew.Round(time.Second))
+			body["skew_seconds"] = int64(skew.Seconds())
+		}
+		body["server_time"] = now.UTC().Format(time.RFC3339)
+		c.Header("X-Server-Time", now.UTC().Format(time.RFC3339))
 	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, body)
 }
 
 func StorageQuotaMiddleware(authService *auth.Service) gin.HandlerFunc {
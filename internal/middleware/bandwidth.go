@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/bandwidth"
+)
+
+// BandwidthMiddleware 按带宽调度策略限制请求体和响应体的传输速率，需在AuthMiddleware之后使用
+func BandwidthMiddleware(limiter *bandwidth.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+		ctx := c.Request.Context()
+
+		if c.Request.Body != nil {
+			c.Request.Body = limiter.Reader(ctx, username, c.Request.Body)
+		}
+		c.Writer = &throttledResponseWriter{
+			ResponseWriter: c.Writer,
+			body:           limiter.Writer(ctx, username, c.Writer),
+		}
+
+		c.Next()
+	}
+}
+
+// throttledResponseWriter 将响应体写入转发给限速Writer
+type throttledResponseWriter struct {
+	gin.ResponseWriter
+	body io.Writer
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *throttledResponseWriter) WriteString(s string) (int, error) {
+	return w.body.Write([]byte(s))
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/davpath"
+)
+
+// ChangeJournalMiddleware 在修改文件树的WebDAV请求成功后写入变更日志，journal为nil时直接放行
+func ChangeJournalMiddleware(journal *changes.Journal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if journal == nil {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete, "MKCOL", "MKCALENDAR", "MOVE", "COPY":
+		default:
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil || status < 200 || status >= 300 {
+			return
+		}
+
+		change := changes.Change{
+			UserID: userID,
+			Path:   davpath.Clean(c.Param("path")),
+		}
+		switch c.Request.Method {
+		case http.MethodPut:
+			change.Type = changes.TypeCreated
+			if status == http.StatusNoContent {
+				change.Type = changes.TypeUpdated
+			}
+			if copyPath := c.GetString(changes.ConflictCopyKey); copyPath != "" {
+				change.Type = changes.TypeConflict
+				change.Destination = copyPath
+			}
+		case http.MethodPatch:
+			change.Type = changes.TypeUpdated
+		case http.MethodDelete:
+			change.Type = changes.TypeDeleted
+		case "MKCOL", "MKCALENDAR":
+			change.Type = changes.TypeCreated
+		case "MOVE":
+			change.Type = changes.TypeMoved
+			change.Destination = destinationPath(c)
+		case "COPY":
+			// 复制只改变目标，记为目标上的创建或覆盖
+			change.Type = changes.TypeCreated
+			if status == http.StatusNoContent {
+				change.Type = changes.TypeUpdated
+			}
+			change.Path = destinationPath(c)
+		}
+
+		// 请求已经完成，客户端断开不应使记录失败
+		if err := journal.Record(context.WithoutCancel(c.Request.Context()), change); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// destinationPath 将Destination请求头（绝对URL或路径）转换为用户文件树中的规范路径，去掉路由前缀。
+// 只在请求成功后调用，此时处理函数已经校验过Destination
+func destinationPath(c *gin.Context) string {
+	dst, _ := davpath.FromURL(c.GetHeader("Destination"), strings.TrimSuffix(c.FullPath(), "/*path"), -1)
+	return davpath.Clean(dst)
+}
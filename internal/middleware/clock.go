@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderClientTime 客户端上报本地时间的请求头，支持RFC 3339或Unix秒
+const HeaderClientTime = "X-Client-Time"
+
+// ClientClockSkew 根据X-Client-Time（缺省时用Date头）计算客户端时钟相对服务器的偏差，
+// 正值表示客户端时钟偏快。客户端未上报时间时返回false
+func ClientClockSkew(c *gin.Context, now time.Time) (time.Duration, bool) {
+	if value := c.GetHeader(HeaderClientTime); value != "" {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.Sub(now), true
+		}
+		if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(sec, 0).Sub(now), true
+		}
+		return 0, false
+	}
+
+	if value := c.GetHeader("Date"); value != "" {
+		if t, err := http.ParseTime(value); err == nil {
+			return t.Sub(now), true
+		}
+	}
+	return 0, false
+}
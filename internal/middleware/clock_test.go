@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/auth"
+)
+
+func TestClientClockSkew(t *testing.T) {
+	now := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"no headers", nil, 0, false},
+		{"RFC 3339 ahead", map[string]string{HeaderClientTime: "2024-01-05T10:05:00Z"}, 5 * time.Minute, true},
+		{"RFC 3339 with offset", map[string]string{HeaderClientTime: "2024-01-05T17:59:30+08:00"}, -30 * time.Second, true},
+		{"unix seconds behind", map[string]string{HeaderClientTime: strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)}, -time.Hour, true},
+		{"Date header", map[string]string{"Date": "Fri, 05 Jan 2024 10:00:10 GMT"}, 10 * time.Second, true},
+		// X-Client-Time优先于Date，无法解析时不再回退到Date
+		{"client time wins", map[string]string{HeaderClientTime: "2024-01-05T10:01:00Z", "Date": "Fri, 05 Jan 2024 11:00:00 GMT"}, time.Minute, true},
+		{"invalid client time", map[string]string{HeaderClientTime: "yesterday", "Date": "Fri, 05 Jan 2024 11:00:00 GMT"}, 0, false},
+		{"invalid Date", map[string]string{"Date": "soon"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				c.Request.Header.Set(k, v)
+			}
+			got, ok := ClientClockSkew(c, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ClientClockSkew = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestAbortInvalidTokenClockSkew 令牌时间校验失败且客户端时钟偏差超过容差时返回clock_skew
+func TestAbortInvalidTokenClockSkew(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const tolerance = 2 * time.Minute
+
+	tests := []struct {
+		name       string
+		err        error
+		clientSkew time.Duration
+		wantCode   string
+	}{
+		{"expired, clock in sync", auth.ErrTokenExpired, 0, "token_expired"},
+		{"expired, skew within tolerance", auth.ErrTokenExpired, time.Minute, "token_expired"},
+		{"expired, clock ahead", auth.ErrTokenExpired, 10 * time.Minute, "clock_skew"},
+		{"not yet valid, clock behind", auth.ErrTokenNotYetValid, -10 * time.Minute, "clock_skew"},
+		{"invalid signature ignores clock", auth.ErrTokenInvalid, 10 * time.Minute, "invalid_token"},
+		{"revoked ignores clock", auth.ErrTokenRevoked, 10 * time.Minute, "token_revoked"},
+		{"unknown error", errors.New("boom"), 10 * time.Minute, "invalid_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set(HeaderClientTime, time.Now().Add(tt.clientSkew).UTC().Format(time.RFC3339))
+
+			abortInvalidToken(c, tt.err, tolerance)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", w.Code)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != tt.wantCode {
+				t.Errorf("code = %v, want %s (body %v)", body["code"], tt.wantCode, body)
+			}
+			if tt.wantCode == "clock_skew" && body["skew_seconds"] == nil {
+				t.Error("clock_skew response missing skew_seconds")
+			}
+			if timed := tt.wantCode == "token_expired" || tt.wantCode == "clock_skew"; timed != (w.Header().Get("X-Server-Time") != "") {
+				t.Errorf("X-Server-Time = %q", w.Header().Get("X-Server-Time"))
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// NegotiateEncoding 按Accept-Encoding选择响应的压缩方式，支持gzip和deflate，q值相同时优先gzip；
+// 客户端不接受压缩时返回空字符串
+func NegotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := strings.TrimSpace(part), 1.0
+		if i := strings.IndexByte(coding, ';'); i >= 0 {
+			param := strings.TrimSpace(coding[i+1:])
+			coding = strings.TrimSpace(coding[:i])
+			if v, ok := strings.CutPrefix(param, "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					continue
+				}
+				q = parsed
+			}
+		}
+		coding = strings.ToLower(coding)
+		if coding == "*" {
+			coding = "gzip"
+		}
+		if q <= 0 || (coding != "gzip" && coding != "deflate") {
+			continue
+		}
+		if q > bestQ || (q == bestQ && coding == "gzip") {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// CompressionMiddleware 压缩PROPFIND多状态响应、API的JSON等文本响应。
+// 响应体达到min_size后才开始压缩，较小的响应原样发送；已编码的响应和文件下载不压缩
+func CompressionMiddleware(cfg config.CompressionConfig) gin.HandlerFunc {
+	types := make(map[string]bool, len(cfg.Types))
+	for _, t := range cfg.Types {
+		types[strings.ToLower(t)] = true
+	}
+	level := cfg.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := NegotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			level:          level,
+			minSize:        cfg.MinSize,
+			types:          types,
+		}
+		c.Writer = writer
+		// 处理函数panic时缓存的内容作废，由RecoveryMiddleware直接写出错误响应
+		defer func() { c.Writer = writer.ResponseWriter }()
+		c.Next()
+		writer.finish()
+	}
+}
+
+// compressWriter 先缓存响应体，达到minSize时根据响应头决定压缩还是原样发送
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+	types    map[string]bool
+
+	buf     bytes.Buffer
+	decided bool
+	// encoder 决定压缩后的压缩器，原样发送时为nil
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf.Write(p)
+	if w.buf.Len() >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 决定是否压缩之前不发送响应头，压缩时还要修改Content-Encoding等头
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush 流式响应：按已缓存的内容决定，压缩时把已压缩的数据发送出去
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(w.buf.Len() >= w.minSize)
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide 确定压缩方式并写出已缓存的内容
+func (w *compressWriter) decide(largeEnough bool) error {
+	w.decided = true
+	if largeEnough && w.compressible() {
+		header := w.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		// 压缩后是同一资源的另一种表示，强ETag不再逐字节对应
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "gzip" {
+			w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		} else {
+			w.encoder, _ = zlib.NewWriterLevel(w.ResponseWriter, w.level)
+		}
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(data)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(data)
+	return err
+}
+
+// compressible 按状态码和响应头判断是否压缩
+func (w *compressWriter) compressible() bool {
+	switch status := w.Status(); {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusPartialContent,
+		status == http.StatusNotModified:
+		return false
+	}
+	header := w.Header()
+	// 文件下载：已编码、支持范围请求或作为附件下载的响应按原样发送，图片、压缩包等本身已压缩
+	for _, name := range []string{"Content-Encoding", "Content-Range", "Accept-Ranges", "Content-Disposition"} {
+		if header.Get(name) != "" {
+			return false
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return w.types[mediaType] || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+// finish 请求处理完成后发送剩余内容：不足minSize的响应原样发送，压缩时写出压缩尾部
+func (w *compressWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false)
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+	}
+}
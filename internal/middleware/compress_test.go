@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"deflate, gzip":           "gzip",
+		"deflate":                 "deflate",
+		"gzip;q=0.5, deflate":     "deflate",
+		"gzip;q=0":                "",
+		"br, identity":            "",
+		"*":                       "gzip",
+		"GZIP;q=1.0, deflate;q=1": "gzip",
+	}
+	for header, want := range tests {
+		if got := NegotiateEncoding(header); got != want {
+			t.Errorf("NegotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.CompressionConfig{Enabled: true, MinSize: 1024, Types: []string{"application/xml"}}
+	multistatus := `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">` +
+		strings.Repeat("<D:response><D:href>/file.txt</D:href></D:response>", 100) + `</D:multistatus>`
+
+	router := gin.New()
+	router.Use(CompressionMiddleware(cfg))
+	router.Handle("PROPFIND", "/big", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(multistatus))
+	})
+	router.Handle("PROPFIND", "/small", func(c *gin.Context) {
+		c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte("<D:multistatus/>"))
+	})
+	router.GET("/download", func(c *gin.Context) {
+		c.Header("Accept-Ranges", "bytes")
+		c.Data(http.StatusOK, "application/xml", []byte(multistatus))
+	})
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("PROPFIND", "/big")
+	if w.Code != http.StatusMultiStatus || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large multistatus: status %d, Content-Encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if got := w.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("ETag = %q, want a weak ETag", got)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil || string(body) != multistatus {
+		t.Errorf("decompressed body does not match (%v)", err)
+	}
+
+	w = request("PROPFIND", "/small")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "<D:multistatus/>" {
+		t.Errorf("small response was compressed")
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+	}
+
+	w = request(http.MethodGet, "/download")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != multistatus {
+		t.Errorf("file download was compressed")
+	}
+}
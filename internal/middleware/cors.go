@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// CORS 跨域访问设置，SetConfig可以在运行时替换，对之后的请求生效
+type CORS struct {
+	mu  sync.RWMutex
+	cfg config.CORSConfig
+}
+
+// NewCORS 创建跨域访问设置
+func NewCORS(cfg config.CORSConfig) *CORS {
+	return &CORS{cfg: cfg}
+}
+
+// SetConfig 替换跨域访问设置
+func (c *CORS) SetConfig(cfg config.CORSConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+}
+
+// Config 返回当前的跨域访问设置
+func (c *CORS) Config() config.CORSConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg
+}
+
+// 未配置allowed_headers/exposed_headers时使用的列表，覆盖网关支持的WebDAV、分块上传和同步请求头
+var (
+	defaultCORSAllowedHeaders = []string{
+		"Content-Type", "Content-Encoding", "Authorization", "Range", "If-Range", "If-Match", "If-None-Match",
+		"If-Modified-Since", "If-Unmodified-Since",
+		"Depth", "Destination", "Overwrite", "Lock-Token", "If", "Timeout",
+		"X-Client-Time", "X-Device-ID", "X-Create-Parents", "Last-Event-ID", "Idempotency-Key",
+		"X-Update-Range", "Content-Range", "X-Share-Password",
+	}
+	defaultCORSExposedHeaders = []string{
+		"Content-Length", "Content-Type", "Content-Disposition", "Last-Modified", "ETag", "Accept-Ranges", "Content-Range",
+		"Date", "Location", "DAV", "Allow", "Lock-Token", "X-Server-Time", "X-Clock-Skew", "Idempotent-Replayed",
+	}
+)
+
+// corsAllowedMethods 预检响应中允许的方法，包括全部WebDAV、CalDAV扩展方法
+const corsAllowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, PROPFIND, PROPPATCH, MKCOL, MKCALENDAR, " +
+	"COPY, MOVE, LOCK, UNLOCK, SEARCH, REPORT, ACL"
+
+// matchOrigin 判断来源是否匹配允许列表中的一项。https://*.example.com匹配任意层级的子域名，
+// 不匹配example.com本身；协议和端口必须一致
+func matchOrigin(pattern, origin string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+	origin = strings.ToLower(origin)
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@")
+}
+
+// allowOrigin 返回Access-Control-Allow-Origin的值，来源不在允许列表中时返回空字符串。
+// 允许携带凭据时不能返回*，改为回显请求的来源
+func allowOrigin(cfg config.CORSConfig, origin string) string {
+	if len(cfg.AllowedOrigins) == 0 {
+		if cfg.AllowCredentials {
+			return ""
+		}
+		return "*"
+	}
+	for _, a := range cfg.AllowedOrigins {
+		if a == "*" {
+			if cfg.AllowCredentials {
+				continue
+			}
+			return "*"
+		}
+		if origin != "" && matchOrigin(a, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CORSMiddleware 按当前的跨域设置添加响应头，关闭时直接放行。
+// 只有带Access-Control-Request-Method的OPTIONS才作为预检直接返回204，
+// 普通的WebDAV OPTIONS请求仍交给处理函数，以返回DAV和Allow头
+func CORSMiddleware(cors *CORS) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := cors.Config()
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		origin := allowOrigin(cfg, c.GetHeader("Origin"))
+		if origin != "*" {
+			// 响应随来源变化，包括不允许的来源（没有跨域头），避免缓存把它返回给允许的来源
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			allowedHeaders := cfg.AllowedHeaders
+			if len(allowedHeaders) == 0 {
+				allowedHeaders = defaultCORSAllowedHeaders
+			}
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		exposedHeaders := cfg.ExposedHeaders
+		if len(exposedHeaders) == 0 {
+			exposedHeaders = defaultCORSExposedHeaders
+		}
+		c.Header("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		c.Next()
+	}
+}
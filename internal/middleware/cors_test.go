@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestCORSMiddlewareReloadsOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cors := NewCORS(config.CORSConfig{})
+	router := gin.New()
+	router.Use(CORSMiddleware(cors))
+	router.GET("/api/time", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/time", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if got := request("https://files.example.com").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disabled: Access-Control-Allow-Origin = %q, want none", got)
+	}
+
+	cors.SetConfig(config.CORSConfig{Enabled: true})
+	if got := request("https://files.example.com").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("no allow list: Access-Control-Allow-Origin = %q, want *", got)
+	}
+
+	cors.SetConfig(config.CORSConfig{Enabled: true, AllowedOrigins: []string{"https://files.example.com/"}})
+	w := request("https://files.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://files.example.com" {
+		t.Errorf("allowed origin: Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("allowed origin: Vary = %q, want Origin", got)
+	}
+	w = request("https://evil.example.net")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("other origin: Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("other origin: status = %d, request should still be served", w.Code)
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://files.example.com", "https://files.example.com", true},
+		{"https://files.example.com/", "https://FILES.example.com", true},
+		{"https://files.example.com", "http://files.example.com", false},
+		{"https://*.example.com", "https://files.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://files.example.com:8443", false},
+		{"https://*.example.com:8443", "https://files.example.com:8443", true},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cors := NewCORS(config.CORSConfig{
+		Enabled:          true,
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	router := gin.New()
+	router.Use(CORSMiddleware(cors))
+	router.Handle(http.MethodOptions, "/webdav/*path", func(c *gin.Context) {
+		c.Header("DAV", "1, 2")
+		c.Status(http.StatusOK)
+	})
+	router.Handle("PROPFIND", "/webdav/*path", func(c *gin.Context) { c.Status(http.StatusMultiStatus) })
+
+	req := httptest.NewRequest(http.MethodOptions, "/webdav/docs/", nil)
+	req.Header.Set("Origin", "https://files.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PROPFIND")
+	req.Header.Set("Access-Control-Request-Headers", "depth, authorization")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	h := w.Header()
+	if got := h.Get("Access-Control-Allow-Origin"); got != "https://files.example.com" {
+		t.Errorf("preflight Access-Control-Allow-Origin = %q", got)
+	}
+	if got := h.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("preflight Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if got := h.Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("preflight Access-Control-Max-Age = %q, want 600", got)
+	}
+	for _, want := range []string{"PROPFIND", "LOCK", "UNLOCK"} {
+		if !strings.Contains(h.Get("Access-Control-Allow-Methods"), want) {
+			t.Errorf("preflight Access-Control-Allow-Methods = %q, missing %s", h.Get("Access-Control-Allow-Methods"), want)
+		}
+	}
+	for _, want := range []string{"Depth", "Destination", "Overwrite", "Lock-Token", "If"} {
+		if !strings.Contains(h.Get("Access-Control-Allow-Headers"), want) {
+			t.Errorf("preflight Access-Control-Allow-Headers = %q, missing %s", h.Get("Access-Control-Allow-Headers"), want)
+		}
+	}
+
+	// 不带Access-Control-Request-Method的OPTIONS是普通的WebDAV请求
+	req = httptest.NewRequest(http.MethodOptions, "/webdav/docs/", nil)
+	req.Header.Set("Origin", "https://files.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("DAV") == "" {
+		t.Errorf("WebDAV OPTIONS status = %d, DAV = %q, want handler response", w.Code, w.Header().Get("DAV"))
+	}
+
+	req = httptest.NewRequest("PROPFIND", "/webdav/docs/", nil)
+	req.Header.Set("Origin", "https://files.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	for _, want := range []string{"ETag", "Lock-Token"} {
+		if !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), want) {
+			t.Errorf("Access-Control-Expose-Headers = %q, missing %s", w.Header().Get("Access-Control-Expose-Headers"), want)
+		}
+	}
+
+	// 允许携带凭据时不使用*
+	cors.SetConfig(config.CORSConfig{Enabled: true, AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	req = httptest.NewRequest("PROPFIND", "/webdav/docs/", nil)
+	req.Header.Set("Origin", "https://files.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("credentials with *: Access-Control-Allow-Origin = %q, want none", got)
+	}
+
+	cors.SetConfig(config.CORSConfig{Enabled: true, AllowedHeaders: []string{"Authorization", "Depth"}, ExposedHeaders: []string{"ETag"}})
+	req = httptest.NewRequest(http.MethodOptions, "/webdav/docs/", nil)
+	req.Header.Set("Origin", "https://other.example.net")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, Depth" {
+		t.Errorf("configured Access-Control-Allow-Headers = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("max_age 0: Access-Control-Max-Age = %q, want none", got)
+	}
+}
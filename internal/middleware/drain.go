@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/drain"
+)
+
+// drainRetryAfter 停机期间503响应的Retry-After（秒），客户端重试时由其他副本处理
+const drainRetryAfter = "30"
+
+// DrainMiddleware 停机开始后拒绝新的写请求（readMethods之外的方法）并返回503，
+// 读请求照常处理，响应带Connection: close让客户端换用其他副本。tracker为nil时不做任何处理
+func DrainMiddleware(tracker *drain.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tracker == nil || !tracker.Draining() {
+			c.Next()
+			return
+		}
+		c.Header("Connection", "close")
+		if !readMethods[c.Request.Method] {
+			c.Header("Retry-After", drainRetryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "server is shutting down, please retry",
+				"code":  "draining",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// TransferMiddleware 把GET、PUT、PATCH、POST请求登记为进行中的传输，停机时等待它们完成（最长到server.shutdown.max_drain）。
+// 只注册在上传、下载路由上；tracker为nil时不做任何处理
+func TransferMiddleware(tracker *drain.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost:
+		default:
+			c.Next()
+			return
+		}
+		if tracker == nil {
+			c.Next()
+			return
+		}
+		done := tracker.Begin()
+		defer done()
+		c.Next()
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// HSTSValue 按配置生成Strict-Transport-Security的值，max_age为0时返回空字符串
+func HSTSValue(cfg config.HSTSConfig) string {
+	if cfg.MaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(int64(cfg.MaxAge.Seconds()), 10)
+	if cfg.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if cfg.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// HSTSMiddleware 为通过TLS到达的请求添加Strict-Transport-Security响应头。
+// 浏览器会忽略明文HTTP响应中的该头，因此只在HTTPS连接上发送；未配置max_age时直接放行
+func HSTSMiddleware(cfg config.HSTSConfig) gin.HandlerFunc {
+	value := HSTSValue(cfg)
+	return func(c *gin.Context) {
+		if value != "" && c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
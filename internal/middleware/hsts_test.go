@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestHSTSValue(t *testing.T) {
+	tests := []struct {
+		cfg  config.HSTSConfig
+		want string
+	}{
+		{config.HSTSConfig{}, ""},
+		{config.HSTSConfig{MaxAge: 180 * 24 * time.Hour}, "max-age=15552000"},
+		{config.HSTSConfig{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload"},
+	}
+	for _, tt := range tests {
+		if got := HSTSValue(tt.cfg); got != tt.want {
+			t.Errorf("HSTSValue(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestHSTSMiddlewareOnlyOverTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(HSTSMiddleware(config.HSTSConfig{MaxAge: time.Hour}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP: Strict-Transport-Security = %q, want none", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=3600" {
+		t.Errorf("HTTPS: Strict-Transport-Security = %q, want max-age=3600", got)
+	}
+}
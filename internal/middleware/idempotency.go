@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/idempotency"
+)
+
+// idempotentMethods 支持Idempotency-Key的方法
+var idempotentMethods = map[string]bool{
+	http.MethodPut:   true,
+	http.MethodPatch: true,
+	"MKCOL":          true,
+}
+
+// replaySkipHeaders 不随保存的响应重放的响应头
+var replaySkipHeaders = map[string]bool{
+	"Date":       true,
+	"Connection": true,
+	"Set-Cookie": true,
+}
+
+// IdempotencyMiddleware 处理PUT、PATCH、MKCOL请求的Idempotency-Key：同一用户用同一个键重试已成功的请求时
+// 重放保存的响应，不再执行处理函数（也不重复计入配额、审计和变更日志），因此需要注册在这些中间件之前。
+// 只保存2xx响应，失败的请求释放键，客户端可以重试。Redis不可用时按普通请求处理。store为nil时不做任何处理
+func IdempotencyMiddleware(store *idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotency.HeaderKey)
+		if store == nil || key == "" || !idempotentMethods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		if !idempotency.ValidKey(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": idempotency.ErrInvalidKey.Error()})
+			return
+		}
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.Request.URL.Path, c.Request.ContentLength)
+		stored, err := store.Begin(ctx, userID, key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "idempotency_in_progress"})
+			return
+		case errors.Is(err, idempotency.ErrKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "idempotency_key_reused"})
+			return
+		case err != nil:
+			log.Printf("Warning: %v", err)
+			c.Next()
+			return
+		case stored != nil:
+			replayResponse(c, stored)
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		// 请求已经执行，客户端断开不应使保存失败
+		saveCtx := context.WithoutCancel(ctx)
+		defer func() {
+			if completed {
+				return
+			}
+			if err := store.Release(saveCtx, userID, key); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status < 200 || status >= 300 || writer.overflow {
+			return
+		}
+		header := make(http.Header, len(writer.Header()))
+		for name, values := range writer.Header() {
+			if !replaySkipHeaders[name] {
+				header[name] = values
+			}
+		}
+		err = store.Complete(saveCtx, userID, key, idempotency.Response{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      header,
+			Body:        writer.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replayResponse 写出保存的响应
+func replayResponse(c *gin.Context, stored *idempotency.Response) {
+	for name, values := range stored.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Header(idempotency.HeaderReplayed, "true")
+	c.Status(stored.Status)
+	if len(stored.Body) > 0 {
+		_, _ = c.Writer.Write(stored.Body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+	c.Abort()
+}
+
+// idempotencyWriter 在写出响应的同时保留响应体，超过idempotency.MaxBodySize时不再保留
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *idempotencyWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *idempotencyWriter) capture(p []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(p) > idempotency.MaxBodySize {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(p)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 超时分类使用的方法，未列出的方法（如自定义扩展方法）只受timeouts和服务器统一超时限制
+var (
+	metadataMethods = []string{"PROPFIND", "PROPPATCH", "OPTIONS", "HEAD", "MKCOL", "MKCALENDAR", "LOCK", "UNLOCK", "REPORT", "SEARCH", "ACL"}
+	transferMethods = []string{"GET", "PUT", "PATCH", "POST", "COPY", "MOVE", "DELETE"}
+)
+
+// MethodTimeouts 把元数据和传输两类超时展开为按方法的超时，再用timeouts中单独设置的方法覆盖，
+// 结果供RequestTimeoutMiddleware使用
+func MethodTimeouts(cfg config.RequestLimitsConfig) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, class := range []struct {
+		methods []string
+		timeout time.Duration
+	}{
+		{metadataMethods, cfg.MetadataTimeout},
+		{transferMethods, cfg.TransferTimeout},
+	} {
+		if class.timeout <= 0 {
+			continue
+		}
+		for _, method := range class.methods {
+			timeouts[method] = class.timeout
+		}
+	}
+	for method, timeout := range cfg.Timeouts {
+		timeouts[strings.ToUpper(method)] = timeout
+	}
+	return timeouts
+}
+
+// RequestTimeoutMiddleware 按请求方法设置连接的读写截止时间，覆盖服务器统一的ReadTimeout和WriteTimeout。
+// 需要在包装ResponseWriter的中间件之前注册
+func RequestTimeoutMiddleware(timeouts map[string]time.Duration) gin.HandlerFunc {
+	byMethod := make(map[string]time.Duration, len(timeouts))
+	for method, timeout := range timeouts {
+		if timeout > 0 {
+			byMethod[strings.ToUpper(method)] = timeout
+		}
+	}
+
+	return func(c *gin.Context) {
+		if timeout, ok := byMethod[c.Request.Method]; ok {
+			deadline := time.Now().Add(timeout)
+			rc := http.NewResponseController(c.Writer)
+			// 连接不支持设置截止时间时（如测试中的ResponseRecorder）沿用服务器的超时
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline)
+		}
+		c.Next()
+	}
+}
+
+// RequestBodyLimitMiddleware 限制WebDAV请求体大小，需在AuthMiddleware之后使用以按用户选择上限。
+// Content-Length超出上限时直接返回413，PUT、PATCH使用上传大小上限，缺少Content-Length且配置要求时返回411；
+// 分块传输的请求体在读取超出上限时出错，由处理函数返回413
+func RequestBodyLimitMiddleware(cfg config.RequestLimitsConfig) gin.HandlerFunc {
+	userLimits := make(map[string]int64, len(cfg.Users))
+	for _, user := range cfg.Users {
+		userLimits[user.Username] = user.MaxUploadSize
+	}
+
+	return func(c *gin.Context) {
+		limit := cfg.MaxBodySize
+		if c.Request.Method == http.MethodPut || c.Request.Method == http.MethodPatch {
+			limit = cfg.MaxUploadSize
+			if userLimit, ok := userLimits[c.GetString("username")]; ok {
+				limit = userLimit
+			}
+			if cfg.RequireContentLength && c.Request.ContentLength < 0 {
+				c.AbortWithStatusJSON(http.StatusLengthRequired, gin.H{
+					"error": "Content-Length is required",
+				})
+				return
+			}
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "request body too large",
+				"limit": limit,
+			})
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func runLimited(cfg config.RequestLimitsConfig, username string, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	gin.SetMode(gin.TestMode)
+	reached := false
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("username", username)
+	}, RequestBodyLimitMiddleware(cfg))
+	router.Handle(req.Method, "/webdav/*path", func(c *gin.Context) {
+		reached = true
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w, reached
+}
+
+func TestRequestBodyLimitMiddleware(t *testing.T) {
+	cfg := config.RequestLimitsConfig{
+		MaxUploadSize: 10,
+		MaxBodySize:   5,
+		Users:         []config.UserUploadLimit{{Username: "bulk", MaxUploadSize: 100}, {Username: "free", MaxUploadSize: 0}},
+	}
+	tests := []struct {
+		name     string
+		method   string
+		username string
+		body     string
+		chunked  bool
+		want     int
+		reached  bool
+	}{
+		{"upload within limit", http.MethodPut, "alice", "0123456789", false, http.StatusCreated, true},
+		{"upload over limit rejected early", http.MethodPut, "alice", "0123456789a", false, http.StatusRequestEntityTooLarge, false},
+		{"per-user limit", http.MethodPut, "bulk", strings.Repeat("x", 100), false, http.StatusCreated, true},
+		{"per-user unlimited", http.MethodPut, "free", strings.Repeat("x", 1000), false, http.StatusCreated, true},
+		{"chunked upload over limit", http.MethodPut, "alice", strings.Repeat("x", 20), true, http.StatusRequestEntityTooLarge, true},
+		{"xml body over limit", "PROPPATCH", "bulk", "<propertyupdate/>", false, http.StatusRequestEntityTooLarge, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/webdav/file.bin", strings.NewReader(tt.body))
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		w, reached := runLimited(cfg, tt.username, req)
+		if w.Code != tt.want || reached != tt.reached {
+			t.Errorf("%s: status %d, handler reached %v; want %d, %v", tt.name, w.Code, reached, tt.want, tt.reached)
+		}
+	}
+}
+
+func TestRequestBodyLimitRequiresContentLength(t *testing.T) {
+	cfg := config.RequestLimitsConfig{RequireContentLength: true}
+
+	req := httptest.NewRequest(http.MethodPut, "/webdav/file.bin", strings.NewReader("data"))
+	req.ContentLength = -1
+	if w, reached := runLimited(cfg, "alice", req); w.Code != http.StatusLengthRequired || reached {
+		t.Errorf("chunked PUT: status %d, handler reached %v; want 411", w.Code, reached)
+	}
+
+	req = httptest.NewRequest("LOCK", "/webdav/file.bin", strings.NewReader(""))
+	req.ContentLength = -1
+	if w, _ := runLimited(cfg, "alice", req); w.Code != http.StatusCreated {
+		t.Errorf("LOCK without Content-Length: status %d, want it passed through", w.Code)
+	}
+}
+
+func TestRequestTimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestTimeoutMiddleware(map[string]time.Duration{"put": time.Minute, "get": 0}))
+	router.PUT("/webdav/*path", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	// ResponseRecorder不支持截止时间，请求照常处理
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/webdav/a", strings.NewReader("x")))
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+}
+
+func TestMethodTimeouts(t *testing.T) {
+	timeouts := MethodTimeouts(config.RequestLimitsConfig{
+		MetadataTimeout: 30 * time.Second,
+		Timeouts:        map[string]time.Duration{"propfind": 2 * time.Minute, "put": time.Hour},
+	})
+	want := map[string]time.Duration{
+		"PROPFIND": 2 * time.Minute, // 单独设置的方法覆盖分类
+		"LOCK":     30 * time.Second,
+		"OPTIONS":  30 * time.Second,
+		"PUT":      time.Hour,
+	}
+	for method, timeout := range want {
+		if timeouts[method] != timeout {
+			t.Errorf("%s timeout = %s, want %s", method, timeouts[method], timeout)
+		}
+	}
+	// transfer_timeout为0时GET沿用服务器的超时
+	if _, ok := timeouts["GET"]; ok {
+		t.Errorf("GET timeout = %s, want none", timeouts["GET"])
+	}
+}
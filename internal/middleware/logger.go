@@ -1,36 +1,195 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 请求日志字段名，logging.access.fields中使用
+const (
+	FieldStatus      = "status"
+	FieldMethod      = "method"
+	FieldPath        = "path"
+	FieldLatency     = "latency"
+	FieldIP          = "ip"
+	FieldUserID      = "user_id"
+	FieldBytesIn     = "bytes_in"
+	FieldBytesOut    = "bytes_out"
+	FieldDestination = "destination"
+	FieldOverwrite   = "overwrite"
+	FieldDepth       = "depth"
+	FieldLockToken   = "lock_token"
+	FieldMultistatus = "multistatus"
 )
 
-func LoggerMiddleware(logger *logrus.Logger) gin.HandlerFunc {
+// lockTokenPattern 从If和Lock-Token头中提取锁令牌
+var lockTokenPattern = regexp.MustCompile(`<(opaquelocktoken:[^>]+|urn:uuid:[^>]+)>`)
+
+// multistatusStatusPattern 207响应体中每个D:status的状态码
+var multistatusStatusPattern = regexp.MustCompile(`HTTP/1\.[01] (\d{3})`)
+
+// LoggerMiddleware 在请求处理完后记录一条结构化请求日志。除通用字段外，WebDAV请求还记录
+// MOVE/COPY的Destination和Overwrite、Depth、锁令牌、实际传输的字节数以及207响应中各状态码的数量。
+// 隐私模式下路径和Destination只记录哈希
+func LoggerMiddleware(logger *logrus.Logger, cfg config.AccessLogConfig) gin.HandlerFunc {
+	var include map[string]bool
+	if len(cfg.Fields) > 0 {
+		include = make(map[string]bool, len(cfg.Fields))
+		for _, f := range cfg.Fields {
+			include[strings.TrimSpace(f)] = true
+		}
+	}
+
 	return func(c *gin.Context) {
 		startTime := time.Now()
 
+		var body *countingReader
+		if c.Request.Body != nil {
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		}
+		writer := &accessLogWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
 		c.Next()
 
-		endTime := time.Now()
-		latency := endTime.Sub(startTime)
+		fields := logrus.Fields{
+			FieldStatus:   c.Writer.Status(),
+			FieldMethod:   c.Request.Method,
+			FieldPath:     redactPath(c.Request.URL.Path, cfg.Privacy),
+			FieldLatency:  time.Since(startTime),
+			FieldIP:       c.ClientIP(),
+			FieldUserID:   c.GetString("userID"),
+			FieldBytesOut: c.Writer.Size(),
+		}
+		if body != nil {
+			fields[FieldBytesIn] = body.n
+		} else {
+			fields[FieldBytesIn] = int64(0)
+		}
+
+		switch c.Request.Method {
+		case "MOVE", "COPY":
+			fields[FieldDestination] = redactPath(c.GetHeader("Destination"), cfg.Privacy)
+			if overwrite := c.GetHeader("Overwrite"); overwrite != "" {
+				fields[FieldOverwrite] = overwrite
+			}
+		}
+		if depth := c.GetHeader("Depth"); depth != "" {
+			fields[FieldDepth] = depth
+		}
+		if tokens := lockTokens(c); len(tokens) > 0 {
+			fields[FieldLockToken] = strings.Join(tokens, ",")
+		}
+		if summary := writer.multistatusSummary(); summary != "" {
+			fields[FieldMultistatus] = summary
+		}
 
-		statusCode := c.Writer.Status()
-		method := c.Request.Method
-		path := c.Request.URL.Path
-		clientIP := c.ClientIP()
-		userID := c.GetString("userID")
+		if include != nil {
+			for name := range fields {
+				if !include[name] {
+					delete(fields, name)
+				}
+			}
+		}
+		logger.WithFields(fields).Info("request processed")
+	}
+}
+
+// redactPath 隐私模式下将路径替换为哈希，同一路径的哈希相同，便于关联日志
+func redactPath(p string, privacy bool) string {
+	if !privacy || p == "" {
+		return p
+	}
+	sum := sha256.Sum256([]byte(p))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// lockTokens 收集请求If头、Lock-Token头及LOCK响应Lock-Token头中的锁令牌
+func lockTokens(c *gin.Context) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, header := range []string{
+		c.GetHeader("If"),
+		c.GetHeader("Lock-Token"),
+		c.Writer.Header().Get("Lock-Token"),
+	} {
+		for _, m := range lockTokenPattern.FindAllStringSubmatch(header, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				tokens = append(tokens, m[1])
+			}
+		}
+	}
+	return tokens
+}
+
+// accessLogWriter 在207响应写出时统计D:status中各状态码的数量，
+// 只保留上一次写入末尾的几个字节，用于匹配跨越两次写入的状态行
+type accessLogWriter struct {
+	gin.ResponseWriter
+	counts map[string]int
+	tail   []byte
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	w.scan(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *accessLogWriter) WriteString(s string) (int, error) {
+	w.scan([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *accessLogWriter) scan(p []byte) {
+	if w.ResponseWriter.Status() != 207 {
+		return
+	}
+	if w.counts == nil {
+		w.counts = make(map[string]int)
+	}
+
+	buf := append(w.tail, p...)
+	for _, m := range multistatusStatusPattern.FindAllSubmatch(buf, -1) {
+		w.counts[string(m[1])]++
+	}
+
+	// 完整的状态行长度为12字节，保留11字节不会重复统计已匹配的状态行
+	keep := len("HTTP/1.1 200") - 1
+	if len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	w.tail = bytes.Clone(buf)
+}
+
+// multistatusSummary 返回形如"200=12 404=3"的状态码统计，非207响应返回空串
+func (w *accessLogWriter) multistatusSummary() string {
+	if len(w.counts) == 0 {
+		return ""
+	}
+	codes := make([]string, 0, len(w.counts))
+	for code := range w.counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
 
-		logger.WithFields(logrus.Fields{
-			"status":   statusCode,
-			"method":   method,
-			"path":     path,
-			"latency":  latency,
-			"ip":       clientIP,
-			"user_id":  userID,
-		}).Info("request processed")
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%s=%d", code, w.counts[code])
 	}
+	return strings.Join(parts, " ")
 }
 
 func RecoveryMiddleware(logger *logrus.Logger) gin.HandlerFunc {
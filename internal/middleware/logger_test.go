@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func runLogged(t *testing.T, cfg config.AccessLogConfig, req *http.Request, handler gin.HandlerFunc) map[string]interface{} {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	router := gin.New()
+	router.Use(LoggerMiddleware(logger, cfg))
+	router.Handle(req.Method, "/webdav/*path", handler)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("log output is not JSON: %v (%q)", err, out.String())
+	}
+	return entry
+}
+
+func TestLoggerMiddlewareMultistatusSummary(t *testing.T) {
+	req := httptest.NewRequest("PROPFIND", "/webdav/docs/", nil)
+	req.Header.Set("Depth", "1")
+
+	entry := runLogged(t, config.AccessLogConfig{}, req, func(c *gin.Context) {
+		c.Status(http.StatusMultiStatus)
+		// 状态行被拆分到两次写入中
+		c.Writer.WriteString(`<D:multistatus><D:response><D:status>HTTP/1.1 200 OK</D:status></D:response><D:response><D:status>HTTP/1.`)
+		c.Writer.WriteString(`1 404 Not Found</D:status></D:response><D:response><D:status>HTTP/1.1 200 OK</D:status></D:response></D:multistatus>`)
+	})
+
+	if entry[FieldMultistatus] != "200=2 404=1" {
+		t.Errorf("multistatus = %v, want 200=2 404=1", entry[FieldMultistatus])
+	}
+	if entry[FieldDepth] != "1" {
+		t.Errorf("depth = %v, want 1", entry[FieldDepth])
+	}
+}
+
+func TestLoggerMiddlewareMoveFields(t *testing.T) {
+	req := httptest.NewRequest("MOVE", "/webdav/a.txt", strings.NewReader("body"))
+	req.Header.Set("Destination", "/webdav/b.txt")
+	req.Header.Set("Overwrite", "F")
+	req.Header.Set("If", "(<opaquelocktoken:abc>)")
+
+	entry := runLogged(t, config.AccessLogConfig{}, req, func(c *gin.Context) {
+		c.Request.Body.Read(make([]byte, 16))
+		c.Status(http.StatusCreated)
+	})
+
+	if entry[FieldDestination] != "/webdav/b.txt" || entry[FieldOverwrite] != "F" {
+		t.Errorf("destination/overwrite = %v/%v", entry[FieldDestination], entry[FieldOverwrite])
+	}
+	if entry[FieldLockToken] != "opaquelocktoken:abc" {
+		t.Errorf("lock_token = %v", entry[FieldLockToken])
+	}
+	if entry[FieldBytesIn] != float64(4) {
+		t.Errorf("bytes_in = %v, want 4", entry[FieldBytesIn])
+	}
+	if _, ok := entry[FieldMultistatus]; ok {
+		t.Error("multistatus logged for non-207 response")
+	}
+}
+
+func TestLoggerMiddlewarePrivacyAndFields(t *testing.T) {
+	req := httptest.NewRequest("COPY", "/webdav/secret.txt", nil)
+	req.Header.Set("Destination", "/webdav/copy.txt")
+
+	cfg := config.AccessLogConfig{Privacy: true, Fields: []string{FieldPath, FieldDestination, FieldStatus}}
+	entry := runLogged(t, cfg, req, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	path, _ := entry[FieldPath].(string)
+	if !strings.HasPrefix(path, "sha256:") || strings.Contains(path, "secret") {
+		t.Errorf("path not redacted: %q", path)
+	}
+	if entry[FieldDestination] == "/webdav/copy.txt" {
+		t.Error("destination not redacted")
+	}
+	if _, ok := entry[FieldIP]; ok {
+		t.Error("ip logged although not in fields")
+	}
+	if entry[FieldStatus] != float64(http.StatusNoContent) {
+		t.Errorf("status = %v", entry[FieldStatus])
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/davpath"
+)
+
+// MediaQueue 排队提取写入文件的媒体元数据
+type MediaQueue interface {
+	Enqueue(ctx context.Context, userID uuid.UUID, filePath string) error
+}
+
+// MediaMetadataMiddleware 在写入文件的WebDAV请求成功后排队提取媒体元数据，queue为nil时直接放行。
+// 移动、改名也会排队：内容未变时只更新记录的路径，不重新提取
+func MediaMetadataMiddleware(queue MediaQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if queue == nil {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPut, http.MethodPatch, "MOVE", "COPY":
+		default:
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil || status < 200 || status >= 300 {
+			return
+		}
+
+		filePath := davpath.Clean(c.Param("path"))
+		switch c.Request.Method {
+		case http.MethodPut:
+			// 冲突时请求的内容写入冲突副本，原文件没有变化
+			if copyPath := c.GetString(changes.ConflictCopyKey); copyPath != "" {
+				filePath = copyPath
+			}
+		case "MOVE", "COPY":
+			filePath = destinationPath(c)
+		}
+
+		if err := queue.Enqueue(context.WithoutCancel(c.Request.Context()), userID, filePath); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
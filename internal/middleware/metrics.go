@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/metrics"
+)
+
+// TenantMetricsMiddleware 按租户记录请求数和流量。作为全局中间件使用，在请求处理完后读取
+// TenantMiddleware设置的租户slug；已认证但不属于租户的请求记为_none，未认证的记为_anonymous
+func TenantMetricsMiddleware(m *metrics.TenantMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body *countingReader
+		if c.Request.Body != nil {
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		var ingress int64
+		if body != nil {
+			ingress = body.n
+		}
+		tenant := c.GetString(TenantSlugKey)
+		if tenant == "" && c.GetString("username") != "" {
+			tenant = metrics.TenantNone
+		}
+		m.Observe(tenant, c.Request.Method, c.Writer.Status(), ingress, int64(c.Writer.Size()))
+	}
+}
+
+// countingReader 统计实际读取的请求体字节数，分块上传没有Content-Length
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
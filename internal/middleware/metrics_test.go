@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/metrics"
+)
+
+// TestTenantMetricsMiddleware 请求按租户slug计数，用户名不会成为标签
+func TestTenantMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.NewTenantMetrics(nil, config.TenantMetricsConfig{MaxTenants: 10})
+	router := gin.New()
+	router.Use(TenantMetricsMiddleware(m))
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set("username", user)
+		}
+		if slug := c.GetHeader("X-Test-Tenant"); slug != "" {
+			c.Set(TenantSlugKey, slug)
+		}
+	})
+	router.PUT("/file", func(c *gin.Context) { c.String(http.StatusCreated, "ok") })
+
+	send := func(user, slug string) {
+		req := httptest.NewRequest(http.MethodPut, "/file", strings.NewReader("abc"))
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Tenant", slug)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("alice", "acme")
+	send("bob", "")
+	send("", "")
+
+	var buf bytes.Buffer
+	if err := m.WriteTo(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`webdav_tenant_requests_total{tenant="acme",method="PUT",code="2xx"} 1`,
+		`webdav_tenant_requests_total{tenant="_none",method="PUT",code="2xx"} 1`,
+		`webdav_tenant_requests_total{tenant="_anonymous",method="PUT",code="2xx"} 1`,
+		`webdav_tenant_egress_bytes_total{tenant="acme"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "alice") || strings.Contains(out, "bob") {
+		t.Errorf("username exported as a label:\n%s", out)
+	}
+}
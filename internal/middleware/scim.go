@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/scim"
+)
+
+// SCIMAuthMiddleware 校验身份提供方调用SCIM接口时携带的Bearer令牌
+func SCIMAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="SCIM"`)
+			c.Header("Content-Type", scim.ContentType)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, scim.ErrorResponse{
+				Schemas: []string{scim.SchemaError},
+				Status:  "401",
+				Detail:  "invalid or missing bearer token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/apitoken"
+)
+
+// 使用个人访问令牌认证时AuthMiddleware在gin.Context中设置的键，会话令牌不设置
+const (
+	// TokenScopesKey 令牌的权限范围，类型为[]string
+	TokenScopesKey = "tokenScopes"
+	// APITokenIDKey 令牌ID
+	APITokenIDKey = "apiTokenID"
+)
+
+// readMethods 只需要read权限的请求方法，其余方法需要write权限
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+	"SEARCH":           true,
+}
+
+// RequireScope 使用个人访问令牌时要求令牌具有scope权限，不足时返回403；
+// 会话令牌不受限制。必须注册在AuthMiddleware之后
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkScope(c, scope)
+	}
+}
+
+// MethodScope 按请求方法要求权限：GET、HEAD、OPTIONS、PROPFIND、REPORT、SEARCH需要read，其他方法需要write
+func MethodScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := apitoken.ScopeWrite
+		if readMethods[c.Request.Method] {
+			scope = apitoken.ScopeRead
+		}
+		checkScope(c, scope)
+	}
+}
+
+// SessionOnly 拒绝个人访问令牌，用于令牌管理、两步验证等只能由用户本人登录后操作的接口
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(TokenScopesKey); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "api tokens cannot be used for this endpoint",
+				"code":  "session_required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func checkScope(c *gin.Context, scope string) {
+	value, ok := c.Get(TokenScopesKey)
+	if !ok {
+		c.Next()
+		return
+	}
+	granted, _ := value.([]string)
+	if !apitoken.Allows(granted, scope) {
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":          fmt.Sprintf("api token lacks the %s scope", scope),
+			"code":           "insufficient_scope",
+			"required_scope": scope,
+		})
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func runScoped(scopes []string, handler gin.HandlerFunc, method string) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if scopes != nil {
+			c.Set(TokenScopesKey, scopes)
+		}
+	}, handler)
+	router.Handle(method, "/webdav/*path", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, "/webdav/a.txt", nil))
+	return w.Code
+}
+
+func TestMethodScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		want   int
+	}{
+		{"session token", nil, http.MethodPut, http.StatusNoContent},
+		{"read get", []string{"read"}, http.MethodGet, http.StatusNoContent},
+		{"read propfind", []string{"read"}, "PROPFIND", http.StatusNoContent},
+		{"read put", []string{"read"}, http.MethodPut, http.StatusForbidden},
+		{"read delete", []string{"read"}, http.MethodDelete, http.StatusForbidden},
+		{"write put", []string{"write"}, http.MethodPut, http.StatusNoContent},
+		{"write get", []string{"write"}, http.MethodGet, http.StatusNoContent},
+		{"share only", []string{"share"}, http.MethodGet, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := runScoped(tt.scopes, MethodScope(), tt.method); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequireScopeAndSessionOnly(t *testing.T) {
+	if got := runScoped([]string{"write"}, RequireScope("share"), http.MethodPost); got != http.StatusForbidden {
+		t.Errorf("write token on share route: status %d, want 403", got)
+	}
+	if got := runScoped([]string{"admin"}, RequireScope("share"), http.MethodPost); got != http.StatusNoContent {
+		t.Errorf("admin token on share route: status %d, want 204", got)
+	}
+	if got := runScoped([]string{"admin"}, SessionOnly(), http.MethodPost); got != http.StatusForbidden {
+		t.Errorf("api token on session-only route: status %d, want 403", got)
+	}
+	if got := runScoped(nil, SessionOnly(), http.MethodPost); got != http.StatusNoContent {
+		t.Errorf("session token on session-only route: status %d, want 204", got)
+	}
+}
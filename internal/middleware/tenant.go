@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/tenant"
+)
+
+// 多租户模式下TenantMiddleware在gin.Context中设置的键
+const (
+	TenantIDKey   = "tenantID"
+	TenantSlugKey = "tenant"
+	TenantRoleKey = "tenantRole"
+)
+
+// TenantMiddleware 核对已认证用户所属的租户与请求所属的租户（子域名或路径前缀）一致，
+// 不一致时返回403，不属于任何租户的用户只能通过基础域名（或不带租户前缀的路径）访问。
+// 已知长度的PUT在读取请求体之前检查租户配额池，分块上传由WebDAV处理函数边读取边检查。
+// 必须注册在AuthMiddleware之后；tenants为nil（未启用多租户）时不做任何处理
+func TenantMiddleware(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenants == nil {
+			c.Next()
+			return
+		}
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		membership, err := tenants.Membership(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve tenant"})
+			return
+		}
+
+		slug := tenants.Resolver().Slug(c.Request)
+		if membership == nil {
+			if slug != "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user does not belong to this tenant"})
+				return
+			}
+			c.Next()
+			return
+		}
+		if membership.Slug != slug {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user does not belong to this tenant"})
+			return
+		}
+		if membership.Status == tenant.StatusSuspended {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "tenant is suspended"})
+			return
+		}
+
+		c.Set(TenantIDKey, membership.TenantID.String())
+		c.Set(TenantSlugKey, membership.Slug)
+		c.Set(TenantRoleKey, membership.Role)
+
+		if c.Request.Method == http.MethodPut && c.Request.ContentLength > 0 {
+			if remaining := tenants.RemainingForUser(c.Request.Context(), userID); remaining >= 0 && c.Request.ContentLength > remaining {
+				c.JSON(http.StatusInsufficientStorage, gin.H{
+					"error": "tenant storage quota exceeded",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// TenantAdminMiddleware 只允许租户管理员访问，必须注册在TenantMiddleware之后
+func TenantAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(TenantRoleKey) != tenant.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "tenant admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// TenantShareMiddleware 分享链接只能通过所有者所属租户的地址访问，其他租户的地址上返回404，
+// 与不存在的分享无法区分。tenants为nil时不做任何处理
+func TenantShareMiddleware(tenants *tenant.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenants == nil {
+			c.Next()
+			return
+		}
+		owner, err := tenants.ShareTenant(c.Request.Context(), c.Param("token"))
+		if errors.Is(err, tenant.ErrNotFound) {
+			c.Next() // 由分享处理函数返回404
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve tenant"})
+			return
+		}
+		if owner != tenants.Resolver().Slug(c.Request) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "share not found"})
+			return
+		}
+		c.Next()
+	}
+}
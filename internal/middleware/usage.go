@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/quota"
+)
+
+// UsageMiddleware 在修改文件树的WebDAV请求成功后把涉及的目录标记为待统计，aggregator为nil时直接放行
+func UsageMiddleware(aggregator *quota.UsageAggregator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if aggregator == nil {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete, "MKCOL", "MKCALENDAR", "MOVE", "COPY":
+		default:
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil || status < 200 || status >= 300 {
+			return
+		}
+
+		paths := []string{path.Clean("/" + c.Param("path"))}
+		if c.Request.Method == "MOVE" || c.Request.Method == "COPY" {
+			paths = append(paths, destinationPath(c))
+		}
+		// 请求已经完成，客户端断开不应使标记失败
+		if err := aggregator.MarkChanged(context.WithoutCancel(c.Request.Context()), userID, paths...); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
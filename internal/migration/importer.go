@@ -0,0 +1,313 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// heartbeatInterval 迁移过程中保存进度、检查是否被取消的间隔
+const heartbeatInterval = 10 * time.Second
+
+// folderVersion 目录在migration_objects中的版本标记
+const folderVersion = "collection"
+
+// importedObject 之前的运行记录的导入结果
+type importedObject struct {
+	version string
+	size    int64
+	failed  bool
+}
+
+// importer 一次迁移运行的状态
+type importer struct {
+	s        *Service
+	m        *models.Migration
+	remote   *remote
+	progress *models.MigrationProgress
+
+	imported  map[string]importedObject
+	local     map[string]int64
+	remaining int64
+	lastBeat  time.Time
+}
+
+// migrate 逐层遍历源服务器并导入到目标目录。已导入且版本、大小未变的文件直接跳过，
+// 因此中断或失败后重新执行会从上次的位置继续。单个文件失败不中断迁移，源根目录无法列出时迁移失败
+func (s *Service) migrate(ctx context.Context, m *models.Migration, progress *models.MigrationProgress) error {
+	src := m.Source
+	password, err := s.box.Open(src.Password)
+	if err != nil {
+		return err
+	}
+	src.Password = password
+	r, err := newRemote(src, s.client)
+	if err != nil {
+		return err
+	}
+	imported, err := s.loadImported(ctx, m)
+	if err != nil {
+		return err
+	}
+	local, err := s.localSizes(ctx, m)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.EnsureBucket(ctx, m.UserID); err != nil {
+		return err
+	}
+
+	imp := &importer{s: s, m: m, remote: r, progress: progress, imported: imported, local: local, remaining: -1, lastBeat: time.Now()}
+	if user, err := s.quota.GetUserByID(ctx, m.UserID); err == nil && user.StorageQuota > 0 {
+		imp.remaining = user.StorageQuota - user.StorageUsed
+	}
+
+	queue := []RemoteEntry{r.Root()}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if err := imp.checkpoint(ctx, dir.Path); err != nil {
+			return err
+		}
+
+		listCtx, cancel := s.requestContext(ctx)
+		entries, err := r.List(listCtx, dir)
+		cancel()
+		if err != nil {
+			if dir.Path == "" {
+				return fmt.Errorf("list source: %w", err)
+			}
+			imp.fail(ctx, dir.Path, err)
+			continue
+		}
+
+		imp.importFolder(ctx, entries[0])
+		for _, entry := range entries[1:] {
+			if entry.Collection {
+				queue = append(queue, entry)
+				continue
+			}
+			if err := imp.checkpoint(ctx, entry.Path); err != nil {
+				return err
+			}
+			imp.importFile(ctx, entry)
+		}
+	}
+
+	if progress.Failed > 0 {
+		return fmt.Errorf("%d files failed", progress.Failed)
+	}
+	return nil
+}
+
+// checkpoint 定期保存进度，迁移被取消或服务停止时返回错误
+func (imp *importer) checkpoint(ctx context.Context, current string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	imp.progress.Current = current
+	if time.Since(imp.lastBeat) < heartbeatInterval {
+		return nil
+	}
+	imp.lastBeat = time.Now()
+	return imp.s.heartbeat(ctx, imp.m.ID, imp.progress)
+}
+
+// importFolder 创建目标目录并写入目录的属性，之前的运行已创建的目录不重复创建
+func (imp *importer) importFolder(ctx context.Context, entry RemoteEntry) {
+	target := path.Join(imp.m.TargetPath, entry.Path)
+	if prev, ok := imp.imported[entry.Path]; !ok || prev.failed {
+		if target != "/" {
+			if err := imp.s.storage.CreateFolder(ctx, imp.m.UserID, target); err != nil {
+				imp.fail(ctx, entry.Path, err)
+				return
+			}
+			imp.recordChange(ctx, changes.TypeCreated, target)
+		}
+		imp.progress.Folders++
+	}
+	if err := imp.setProperties(ctx, target, entry); err != nil {
+		imp.fail(ctx, entry.Path, err)
+		return
+	}
+	imp.record(ctx, entry.Path, folderVersion, 0, "")
+}
+
+// importFile 下载一个文件写入目标目录
+func (imp *importer) importFile(ctx context.Context, entry RemoteEntry) {
+	localSize, exists := imp.local[entry.Path]
+	if prev, ok := imp.imported[entry.Path]; ok && !prev.failed && exists &&
+		prev.version == entry.Version() && prev.size == entry.Size && localSize == entry.Size {
+		imp.progress.Skipped++
+		return
+	}
+
+	delta := entry.Size - localSize
+	if imp.remaining >= 0 && delta > imp.remaining {
+		imp.fail(ctx, entry.Path, fmt.Errorf("storage quota exceeded"))
+		return
+	}
+	target := path.Join(imp.m.TargetPath, entry.Path)
+	if err := imp.download(ctx, target, entry); err != nil {
+		imp.fail(ctx, entry.Path, err)
+		return
+	}
+	if delta != 0 {
+		if err := imp.s.quota.UpdateStorageUsed(ctx, imp.m.UserID, delta); err != nil {
+			log.Printf("Warning: failed to update storage usage of user %s: %v", imp.m.UserID, err)
+		}
+		if imp.remaining >= 0 {
+			imp.remaining -= delta
+		}
+	}
+	imp.local[entry.Path] = entry.Size
+	changeType := changes.TypeCreated
+	if exists {
+		changeType = changes.TypeUpdated
+	}
+	imp.recordChange(ctx, changeType, target)
+
+	if err := imp.setProperties(ctx, target, entry); err != nil {
+		imp.fail(ctx, entry.Path, err)
+		return
+	}
+	imp.record(ctx, entry.Path, entry.Version(), entry.Size, "")
+	imp.progress.Files++
+	imp.progress.Bytes += entry.Size
+}
+
+func (imp *importer) download(ctx context.Context, target string, entry RemoteEntry) error {
+	reqCtx, cancel := imp.s.requestContext(ctx)
+	defer cancel()
+
+	body, err := imp.remote.Open(reqCtx, entry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	contentType := entry.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return imp.s.storage.PutObject(reqCtx, imp.m.UserID, target, body, entry.Size, contentType)
+}
+
+// recordChange 写入一条变更，未启用变更通知时不记录，失败只记录日志
+func (imp *importer) recordChange(ctx context.Context, changeType, target string) {
+	if imp.s.journal == nil {
+		return
+	}
+	change := changes.Change{UserID: imp.m.UserID, Type: changeType, Path: target}
+	if err := imp.s.journal.Record(ctx, change); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// setProperties 保存源资源的死属性，源时间戳作为修改时间和创建时间的活属性保存
+func (imp *importer) setProperties(ctx context.Context, target string, entry RemoteEntry) error {
+	userID := imp.m.UserID.String()
+	var props []*webdav.DatabaseProperty
+	add := func(namespace, name, value string, live bool) {
+		props = append(props, &webdav.DatabaseProperty{
+			UserID:     userID,
+			ResourceID: target,
+			Path:       target,
+			Namespace:  namespace,
+			Name:       name,
+			Value:      value,
+			IsLive:     live,
+		})
+	}
+	if !entry.LastModified.IsZero() {
+		add(webdav.NamespaceMetadata, webdav.LastModifiedPropertyName, entry.LastModified.UTC().Format(time.RFC3339), true)
+	}
+	if !entry.CreatedAt.IsZero() {
+		add(webdav.NamespaceMetadata, webdav.CreationDatePropertyName, entry.CreatedAt.UTC().Format(time.RFC3339), true)
+	}
+	for _, prop := range entry.Properties {
+		add(prop.Namespace, prop.Name, prop.Value, false)
+	}
+	if err := imp.s.properties.SetPropertiesBatch(ctx, props); err != nil {
+		return fmt.Errorf("set properties: %w", err)
+	}
+	imp.progress.Properties += len(entry.Properties)
+	return nil
+}
+
+// fail 记录一个失败的路径，重新执行迁移时会重试
+func (imp *importer) fail(ctx context.Context, p string, err error) {
+	imp.progress.Failed++
+	imp.record(ctx, p, "", 0, err.Error())
+}
+
+// record 保存导入结果，写入失败只影响下次运行时能否跳过该文件
+func (imp *importer) record(ctx context.Context, p, version string, size int64, message string) {
+	_, err := imp.s.db.ExecContext(ctx, `
+		INSERT INTO migration_objects (migration_id, path, version, size, error, imported_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (migration_id, path) DO UPDATE SET version = EXCLUDED.version, size = EXCLUDED.size,
+			error = EXCLUDED.error, imported_at = NOW()`,
+		imp.m.ID, p, version, size, message)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Warning: failed to record migration %s object %s: %v", imp.m.ID, p, err)
+	}
+	imp.imported[p] = importedObject{version: version, size: size, failed: message != ""}
+}
+
+func (s *Service) loadImported(ctx context.Context, m *models.Migration) (map[string]importedObject, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, version, size, error FROM migration_objects WHERE migration_id = $1`, m.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migration state: %w", err)
+	}
+	defer rows.Close()
+
+	imported := make(map[string]importedObject)
+	for rows.Next() {
+		var p, message string
+		var obj importedObject
+		if err := rows.Scan(&p, &obj.version, &obj.size, &message); err != nil {
+			return nil, err
+		}
+		obj.failed = message != ""
+		imported[p] = obj
+	}
+	return imported, rows.Err()
+}
+
+// localSizes 列出目标目录下已有的文件，key为相对路径
+func (s *Service) localSizes(ctx context.Context, m *models.Migration) (map[string]int64, error) {
+	prefix := strings.TrimPrefix(m.TargetPath, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	local := make(map[string]int64)
+	err := s.storage.WalkObjects(ctx, m.UserID, m.TargetPath, true, func(obj minio.ObjectInfo) error {
+		if !strings.HasSuffix(obj.Key, "/") {
+			local[strings.TrimPrefix(obj.Key, prefix)] = obj.Size
+		}
+		return nil
+	})
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list target folder: %w", err)
+	}
+	return local, nil
+}
+
+// requestContext 为单个源服务器请求设置超时
+func (s *Service) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, s.config.RequestTimeout)
+	}
+	return context.WithCancel(ctx)
+}
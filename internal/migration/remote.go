@@ -0,0 +1,261 @@
+package migration
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// allpropBody 请求全部属性，大多数服务器会在allprop中返回死属性
+const allpropBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`
+
+// maxPropertyValue 单个死属性值的最大字节数，超出的属性不导入
+const maxPropertyValue = 64 * 1024
+
+// serverNamespaces 源服务器自己维护的属性命名空间，这些属性在本服务中没有意义，不作为死属性导入
+var serverNamespaces = map[string]bool{
+	"DAV:":                                      true,
+	"http://apache.org/dav/props/":              true,
+	"http://owncloud.org/ns":                    true,
+	"http://nextcloud.org/ns":                   true,
+	"http://open-collaboration-services.org/ns": true,
+	"urn:schemas-microsoft-com:":                true,
+}
+
+// RemoteProperty 源资源上的一个死属性，Value为属性元素的内部XML
+type RemoteProperty struct {
+	Namespace string
+	Name      string
+	Value     string
+}
+
+// RemoteEntry 源集合中的一个成员，Path为相对于源根目录的规范路径（不以/开头，根目录为空）
+type RemoteEntry struct {
+	Path         string
+	Collection   bool
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	CreatedAt    time.Time
+	Properties   []RemoteProperty
+
+	// href 源服务器返回的原始路径。名称可能是NFD等非规范形式，后续请求必须使用原样的路径
+	href *url.URL
+}
+
+// Version 用于判断文件在两次运行之间是否变化的标识，源服务器没有ETag时使用大小和修改时间
+func (e RemoteEntry) Version() string {
+	if e.ETag != "" {
+		return strings.Trim(e.ETag, `"`)
+	}
+	return fmt.Sprintf("%d-%d", e.Size, e.LastModified.Unix())
+}
+
+// remote 通过逐层Depth: 1的PROPFIND读取源WebDAV服务器，Nextcloud和Apache默认禁用Depth: infinity
+type remote struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func newRemote(src models.MigrationSource, client *http.Client) (*remote, error) {
+	base, err := url.Parse(src.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &remote{base: base, username: src.Username, password: src.Password, client: client}, nil
+}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		Props []davProp `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	XMLName  xml.Name
+	InnerXML string `xml:",innerxml"`
+}
+
+// Root 源根目录
+func (r *remote) Root() RemoteEntry {
+	return RemoteEntry{Collection: true, href: &url.URL{Path: r.base.Path, RawPath: r.base.RawPath}}
+}
+
+// List 列出一个源集合，返回的第一个条目是集合自身
+func (r *remote) List(ctx context.Context, dir RemoteEntry) ([]RemoteEntry, error) {
+	target := r.base.ResolveReference(dir.href)
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", target.String(), strings.NewReader(allpropBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	r.authorize(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %w", target.Path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: unexpected status %s", target.Path, resp.Status)
+	}
+	return parseMultistatus(resp.Body, r.base.Path, dir.Path)
+}
+
+// parseMultistatus 解析PROPFIND响应，返回位于basePath之下的条目，集合自身排在最前
+func parseMultistatus(body io.Reader, basePath, dir string) ([]RemoteEntry, error) {
+	var ms davMultistatus
+	if err := xml.NewDecoder(body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid multistatus: %w", err)
+	}
+
+	var self *RemoteEntry
+	var entries []RemoteEntry
+	for _, resp := range ms.Responses {
+		u, err := url.Parse(resp.Href)
+		if err != nil {
+			continue
+		}
+		// 只保留路径部分，不会跟随指向其他主机的href
+		href := &url.URL{Path: u.Path, RawPath: u.RawPath}
+		if href.Path+"/" == basePath {
+			href.Path, href.RawPath = basePath, ""
+		}
+		if !strings.HasPrefix(href.Path, basePath) {
+			continue
+		}
+		rel, ok := cleanRelative(strings.TrimPrefix(href.Path, basePath))
+		if !ok {
+			continue
+		}
+
+		entry := RemoteEntry{Path: rel, href: href}
+		found := false
+		for _, ps := range resp.Propstat {
+			if !strings.Contains(ps.Status, " 200") {
+				continue
+			}
+			found = true
+			for _, prop := range ps.Prop.Props {
+				entry.apply(prop)
+			}
+		}
+		if !found {
+			continue
+		}
+		if rel == dir {
+			entry.Collection = true
+			self = &entry
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if self == nil {
+		self = &RemoteEntry{Path: dir, Collection: true}
+	}
+	return append([]RemoteEntry{*self}, entries...), nil
+}
+
+// apply 把一个属性写入条目：DAV:中的标准属性转换为对应字段，其他命名空间的作为死属性保留
+func (e *RemoteEntry) apply(prop davProp) {
+	value := strings.TrimSpace(prop.InnerXML)
+	if prop.XMLName.Space == "DAV:" {
+		switch prop.XMLName.Local {
+		case "resourcetype":
+			e.Collection = strings.Contains(value, "collection")
+		case "getcontentlength":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				e.Size = size
+			}
+		case "getetag":
+			e.ETag = strings.TrimPrefix(value, "W/")
+		case "getcontenttype":
+			e.ContentType = value
+		case "getlastmodified":
+			e.LastModified, _ = parseTime(value)
+		case "creationdate":
+			e.CreatedAt, _ = parseTime(value)
+		}
+		return
+	}
+	if serverNamespaces[prop.XMLName.Space] || prop.XMLName.Space == "" || len(value) > maxPropertyValue {
+		return
+	}
+	e.Properties = append(e.Properties, RemoteProperty{Namespace: prop.XMLName.Space, Name: prop.XMLName.Local, Value: value})
+}
+
+// Open 下载一个文件
+func (r *remote) Open(ctx context.Context, entry RemoteEntry) (io.ReadCloser, error) {
+	target := r.base.ResolveReference(entry.href)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.authorize(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", target.Path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected status %s", target.Path, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (r *remote) authorize(req *http.Request) {
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+}
+
+// cleanRelative 规范化源服务器返回的相对路径（名称转换为NFC，不会越出源根目录），根目录返回空字符串
+func cleanRelative(p string) (string, bool) {
+	if !utf8.ValidString(p) || strings.ContainsRune(p, 0) {
+		return "", false
+	}
+	return strings.TrimPrefix(davpath.Clean(p), "/"), true
+}
+
+// parseTime 解析HTTP日期，creationdate和部分服务器的getlastmodified使用RFC 3339
+func parseTime(v string) (time.Time, bool) {
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
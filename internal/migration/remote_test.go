@@ -0,0 +1,187 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/netguard"
+)
+
+const testMultistatus = `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns" xmlns:x="urn:example:custom">
+  <d:response>
+    <d:href>/remote.php/dav/files/alice</d:href>
+    <d:propstat>
+      <d:prop>
+        <d:resourcetype><d:collection/></d:resourcetype>
+        <x:color>blue</x:color>
+      </d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>/remote.php/dav/files/alice/Cafe%CC%81/</d:href>
+    <d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>https://cloud.example/remote.php/dav/files/alice/notes.txt</d:href>
+    <d:propstat>
+      <d:prop>
+        <d:resourcetype/>
+        <d:getcontentlength>42</d:getcontentlength>
+        <d:getetag>"e1"</d:getetag>
+        <d:getcontenttype>text/plain</d:getcontenttype>
+        <d:getlastmodified>Mon, 01 Jan 2024 10:00:00 GMT</d:getlastmodified>
+        <d:creationdate>2023-06-01T08:00:00Z</d:creationdate>
+        <oc:fileid>123</oc:fileid>
+        <x:tags><x:tag>work</x:tag></x:tags>
+      </d:prop>
+      <d:status>HTTP/1.1 200 OK</d:status>
+    </d:propstat>
+    <d:propstat><d:prop><x:missing/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>
+  </d:response>
+  <d:response>
+    <d:href>/remote.php/dav/files/bob/secret.txt</d:href>
+    <d:propstat><d:prop><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+  </d:response>
+</d:multistatus>`
+
+func TestParseMultistatus(t *testing.T) {
+	entries, err := parseMultistatus(strings.NewReader(testMultistatus), "/remote.php/dav/files/alice/", "")
+	if err != nil {
+		t.Fatalf("parseMultistatus() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+
+	root := entries[0]
+	if root.Path != "" || !root.Collection || len(root.Properties) != 1 || root.Properties[0].Value != "blue" {
+		t.Errorf("root = %+v", root)
+	}
+
+	folder := entries[1]
+	if folder.Path != "Café" || !folder.Collection {
+		t.Errorf("entries[1] = %+v, want NFC collection Café", folder)
+	}
+	// 后续请求使用源服务器返回的NFD名称
+	if folder.href.EscapedPath() != "/remote.php/dav/files/alice/Cafe%CC%81/" {
+		t.Errorf("folder href = %s", folder.href.EscapedPath())
+	}
+
+	file := entries[2]
+	if file.Path != "notes.txt" || file.Collection || file.Size != 42 || file.ContentType != "text/plain" ||
+		file.LastModified.Year() != 2024 || file.CreatedAt.Year() != 2023 || file.Version() != "e1" {
+		t.Errorf("entries[2] = %+v", file)
+	}
+	// 源服务器的活属性（oc:fileid）和不存在的属性不导入
+	if len(file.Properties) != 1 {
+		t.Fatalf("file properties = %+v, want only x:tags", file.Properties)
+	}
+	if p := file.Properties[0]; p.Namespace != "urn:example:custom" || p.Name != "tags" || !strings.Contains(p.Value, ">work<") {
+		t.Errorf("file property = %+v", p)
+	}
+}
+
+func TestRemoteWalk(t *testing.T) {
+	tree := map[string]string{
+		"/dav/": `<d:response><d:href>/dav/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/a%20b.txt</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>5</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/sub/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`,
+		"/dav/sub/": `<d:response><d:href>/dav/sub/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/dav/sub/c.txt</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>3</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "u" || pass != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "PROPFIND":
+			body, ok := tree[r.URL.Path]
+			if !ok || r.Header.Get("Depth") != "1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">` + body + `</d:multistatus>`))
+		case http.MethodGet:
+			w.Write([]byte("file:" + r.URL.Path))
+		}
+	}))
+	defer srv.Close()
+
+	r, err := newRemote(models.MigrationSource{URL: srv.URL + "/dav", Username: "u", Password: "p"}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var files []string
+	queue := []RemoteEntry{r.Root()}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		entries, err := r.List(ctx, dir)
+		if err != nil {
+			t.Fatalf("List(%q) error = %v", dir.Path, err)
+		}
+		for _, entry := range entries[1:] {
+			if entry.Collection {
+				queue = append(queue, entry)
+			} else {
+				files = append(files, entry.Path)
+			}
+		}
+	}
+	if strings.Join(files, ",") != "a b.txt,sub/c.txt" {
+		t.Fatalf("walked files = %v", files)
+	}
+
+	// 文件通过源服务器返回的href下载
+	entries, _ := r.List(ctx, r.Root())
+	body, err := r.Open(ctx, entries[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	buf := new(strings.Builder)
+	if _, err := io.Copy(buf, body); err != nil || buf.String() != "file:/dav/a b.txt" {
+		t.Errorf("Open() = %q, %v", buf.String(), err)
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		url     string
+		wantErr bool
+	}{
+		{"allowed host", []string{"cloud.example.com"}, "https://cloud.example.com/remote.php/dav/files/alice/", false},
+		{"host outside allow list", []string{"cloud.example.com"}, "https://other.example.com/dav/", true},
+		// 允许列表中的内网服务器可以迁移
+		{"allowed internal address", []string{"10.0.0.5"}, "http://10.0.0.5/dav/", false},
+		{"non-http URL", nil, "file:///etc/passwd", true},
+		{"loopback", nil, "http://127.0.0.1:8080/dav/", true},
+		{"metadata address", nil, "http://169.254.169.254/latest/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{guard: netguard.New(tt.allowed)}
+			err := s.validateSource(context.Background(), models.MigrationSource{URL: tt.url})
+			if tt.wantErr && !errors.Is(err, ErrInvalidSource) {
+				t.Errorf("validateSource(%s) = %v, want ErrInvalidSource", tt.url, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateSource(%s) = %v", tt.url, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/netguard"
+	"github.com/webdav-gateway/internal/secretbox"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav"
+)
+
+// 错误定义
+var (
+	ErrNotFound      = Error("migration not found")
+	ErrUserNotFound  = Error("target user not found")
+	ErrInvalidSource = Error("invalid migration source")
+	ErrNotActive     = Error("migration is not pending or running")
+	ErrNotResumable  = Error("only failed or canceled migrations can be resumed")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// claimTimeout 运行中的迁移超过该时间没有心跳时，视为所在副本已退出，允许其他副本接手
+const claimTimeout = 10 * time.Minute
+
+// maxFailures 查看迁移时返回的失败路径数上限
+const maxFailures = 100
+
+// Quota 迁移写入计入目标用户配额
+type Quota interface {
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error
+}
+
+// PropertyStore 保存导入的死属性和时间戳
+type PropertyStore interface {
+	SetPropertiesBatch(ctx context.Context, properties []*webdav.DatabaseProperty) error
+}
+
+// Journal 记录迁移写入和删除的文件，未启用变更通知时为nil
+type Journal interface {
+	Record(ctx context.Context, change changes.Change) error
+}
+
+// Service 管理由管理员创建的迁移任务并在后台执行。迁移通过数据库领取，
+// 多副本部署时同一迁移同时只会由一个副本执行；中断后从已导入的文件之后继续
+type Service struct {
+	db         *sql.DB
+	storage    *storage.Service
+	quota      Quota
+	properties PropertyStore
+	journal    Journal
+	config     config.MigrationConfig
+	guard      *netguard.Guard
+	client     *http.Client
+	box        *secretbox.Box
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewService 创建迁移服务。访问源服务器的请求不能到达内网地址（migration.allowed_hosts中的主机除外），
+// 源服务器密码用box加密保存
+func NewService(db *sql.DB, storageService *storage.Service, quota Quota, properties PropertyStore, box *secretbox.Box, cfg config.MigrationConfig) *Service {
+	guard := netguard.New(cfg.AllowedHosts)
+	return &Service{
+		db:         db,
+		storage:    storageService,
+		quota:      quota,
+		properties: properties,
+		config:     cfg,
+		guard:      guard,
+		client:     guard.Client(cfg.RequestTimeout),
+		box:        box,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// SetJournal 设置变更日志，迁移写入的文件和目录与WebDAV写入一样推送给订阅的客户端
+func (s *Service) SetJournal(journal Journal) {
+	s.journal = journal
+}
+
+// Initialize 创建迁移表，并加密升级前以明文保存的源服务器密码
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS migrations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_by UUID NOT NULL,
+			source_url TEXT NOT NULL,
+			source_username VARCHAR(255) NOT NULL DEFAULT '',
+			source_password TEXT NOT NULL DEFAULT '',
+			target_path TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			progress JSONB,
+			last_error TEXT NOT NULL DEFAULT '',
+			running_since TIMESTAMP,
+			started_at TIMESTAMP,
+			finished_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS migration_objects (
+			migration_id UUID NOT NULL REFERENCES migrations(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			version TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (migration_id, path)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_migrations_status ON migrations(status) WHERE status IN ('pending', 'running')`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize migration tables: %w", err)
+		}
+	}
+	if _, err := s.box.SealColumn(ctx, s.db, "migrations", "source_password"); err != nil {
+		return fmt.Errorf("failed to encrypt migration passwords: %w", err)
+	}
+	return nil
+}
+
+const migrationColumns = `id, user_id, created_by, source_url, source_username, source_password, target_path,
+	status, progress, last_error, started_at, finished_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMigration 读取一行迁移记录，包含加密的源服务器密码，执行迁移时解密
+func scanMigration(row rowScanner) (*models.Migration, error) {
+	m := &models.Migration{}
+	var progress []byte
+	if err := row.Scan(&m.ID, &m.UserID, &m.CreatedBy, &m.Source.URL, &m.Source.Username, &m.Source.Password, &m.TargetPath,
+		&m.Status, &progress, &m.LastError, &m.StartedAt, &m.FinishedAt, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if len(progress) > 0 {
+		json.Unmarshal(progress, &m.Progress)
+	}
+	return m, nil
+}
+
+// redact 去掉返回给客户端的源服务器密码
+func redact(m *models.Migration) *models.Migration {
+	m.Source.Password = ""
+	return m
+}
+
+// List 列出全部迁移，最新的在前
+func (s *Service) List(ctx context.Context) ([]*models.Migration, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+migrationColumns+` FROM migrations ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	defer rows.Close()
+
+	migrations := []*models.Migration{}
+	for rows.Next() {
+		m, err := scanMigration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		migrations = append(migrations, redact(m))
+	}
+	return migrations, rows.Err()
+}
+
+// Get 获取一个迁移及其失败的路径
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*models.Migration, error) {
+	m, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT path, error FROM migration_objects
+		WHERE migration_id = $1 AND error <> ''
+		ORDER BY path
+		LIMIT $2`, id, maxFailures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration failures: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f models.MigrationFailure
+		if err := rows.Scan(&f.Path, &f.Error); err != nil {
+			return nil, err
+		}
+		m.Failures = append(m.Failures, f)
+	}
+	return redact(m), rows.Err()
+}
+
+func (s *Service) load(ctx context.Context, id uuid.UUID) (*models.Migration, error) {
+	m, err := scanMigration(s.db.QueryRowContext(ctx, `SELECT `+migrationColumns+` FROM migrations WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration: %w", err)
+	}
+	return m, nil
+}
+
+// Create 创建迁移，由后台在下一次轮询时开始执行
+func (s *Service) Create(ctx context.Context, createdBy uuid.UUID, req *models.CreateMigrationRequest) (*models.Migration, error) {
+	if err := s.validateSource(ctx, req.Source); err != nil {
+		return nil, err
+	}
+	if _, err := s.quota.GetUserByID(ctx, req.UserID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	target := path.Clean("/" + req.TargetPath)
+
+	src := req.Source
+	password, err := s.box.Seal(src.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt source password: %w", err)
+	}
+	var id uuid.UUID
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO migrations (user_id, created_by, source_url, source_username, source_password, target_path, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		req.UserID, createdBy, src.URL, src.Username, password, target, models.MigrationStatusPending).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// Cancel 取消等待中或运行中的迁移，运行中的迁移在下一次心跳时停止，已导入的文件保留
+func (s *Service) Cancel(ctx context.Context, id uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE migrations SET status = $1, running_since = NULL, finished_at = NOW()
+		WHERE id = $2 AND status IN ($3, $4)`,
+		models.MigrationStatusCanceled, id, models.MigrationStatusPending, models.MigrationStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to cancel migration: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.notChanged(ctx, id, ErrNotActive)
+	}
+	return nil
+}
+
+// Resume 重新排队失败或已取消的迁移，已导入且未变化的文件会被跳过，之前失败的文件会重试
+func (s *Service) Resume(ctx context.Context, id uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE migrations SET status = $1, last_error = '', finished_at = NULL
+		WHERE id = $2 AND status IN ($3, $4)`,
+		models.MigrationStatusPending, id, models.MigrationStatusFailed, models.MigrationStatusCanceled)
+	if err != nil {
+		return fmt.Errorf("failed to resume migration: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.notChanged(ctx, id, ErrNotResumable)
+	}
+	return nil
+}
+
+// notChanged 区分迁移不存在和状态不允许的情况
+func (s *Service) notChanged(ctx context.Context, id uuid.UUID, stateErr error) error {
+	if _, err := s.load(ctx, id); err != nil {
+		return err
+	}
+	return stateErr
+}
+
+// validateSource 校验源服务器地址，拒绝不在允许列表中或位于内网的源服务器
+func (s *Service) validateSource(ctx context.Context, src models.MigrationSource) error {
+	if err := s.guard.CheckURL(ctx, src.URL); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// errCanceled 迁移在运行中被管理员取消
+var errCanceled = errors.New("migration canceled")
+
+// Start 启动后台轮询，PollInterval不大于0时不启动
+func (s *Service) Start() {
+	if s.config.PollInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.runQueued(ctx)
+			select {
+			case <-ticker.C:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止轮询并中断正在进行的迁移，中断的迁移重新排队，下次启动后继续
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// runQueued 依次执行等待中的迁移，以及心跳超时的运行中迁移
+func (s *Service) runQueued(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM migrations
+		WHERE status = $1 OR (status = $2 AND (running_since IS NULL OR running_since < NOW() - $3 * INTERVAL '1 second'))
+		ORDER BY created_at
+		LIMIT 20`, models.MigrationStatusPending, models.MigrationStatusRunning, claimTimeout.Seconds())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to query queued migrations: %v", err)
+		}
+		return
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		m, err := s.claim(ctx, id)
+		if err != nil {
+			log.Printf("Warning: failed to claim migration %s: %v", id, err)
+			continue
+		}
+		if m == nil {
+			// 已被其他副本领取或已取消
+			continue
+		}
+		s.run(ctx, m)
+	}
+}
+
+// claim 原子地将迁移标记为运行中，未领取到时返回nil
+func (s *Service) claim(ctx context.Context, id uuid.UUID) (*models.Migration, error) {
+	m, err := scanMigration(s.db.QueryRowContext(ctx, `
+		UPDATE migrations SET status = $1, running_since = NOW(), started_at = COALESCE(started_at, NOW())
+		WHERE id = $2 AND (status = $3 OR (status = $1 AND (running_since IS NULL OR running_since < NOW() - $4 * INTERVAL '1 second')))
+		RETURNING `+migrationColumns, models.MigrationStatusRunning, id, models.MigrationStatusPending, claimTimeout.Seconds()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// run 执行一个已领取的迁移并记录结果。取消的迁移保持canceled状态，服务停止中断的迁移重新排队
+func (s *Service) run(ctx context.Context, m *models.Migration) {
+	started := time.Now()
+	var progress models.MigrationProgress
+	runErr := s.migrate(ctx, m, &progress)
+	progress.Current = ""
+	progressJSON, _ := json.Marshal(progress)
+
+	status, message := models.MigrationStatusCompleted, ""
+	switch {
+	case errors.Is(runErr, errCanceled):
+		log.Printf("Migration %s canceled after %s", m.ID, time.Since(started).Round(time.Second))
+		s.db.ExecContext(context.Background(), `UPDATE migrations SET progress = $1 WHERE id = $2`, progressJSON, m.ID)
+		return
+	case ctx.Err() != nil:
+		_, err := s.db.ExecContext(context.Background(), `
+			UPDATE migrations SET status = $1, running_since = NULL, progress = $2
+			WHERE id = $3 AND status = $4`, models.MigrationStatusPending, progressJSON, m.ID, models.MigrationStatusRunning)
+		if err != nil {
+			log.Printf("Warning: failed to requeue migration %s: %v", m.ID, err)
+		}
+		return
+	case runErr != nil:
+		status, message = models.MigrationStatusFailed, runErr.Error()
+		log.Printf("Warning: migration %s from %s failed: %v", m.ID, m.Source.URL, runErr)
+	default:
+		log.Printf("Migration %s from %s completed in %s: %d files, %d folders, %d skipped",
+			m.ID, m.Source.URL, time.Since(started).Round(time.Second), progress.Files, progress.Folders, progress.Skipped)
+	}
+
+	_, err := s.db.ExecContext(context.Background(), `
+		UPDATE migrations SET status = $1, last_error = $2, progress = $3, running_since = NULL, finished_at = NOW()
+		WHERE id = $4 AND status = $5`, status, message, progressJSON, m.ID, models.MigrationStatusRunning)
+	if err != nil {
+		log.Printf("Warning: failed to record result of migration %s: %v", m.ID, err)
+	}
+}
+
+// heartbeat 刷新运行中的标记并保存进度，迁移已被取消时返回errCanceled
+func (s *Service) heartbeat(ctx context.Context, id uuid.UUID, progress *models.MigrationProgress) error {
+	progressJSON, _ := json.Marshal(progress)
+	res, err := s.db.ExecContext(ctx, `UPDATE migrations SET running_since = NOW(), progress = $1 WHERE id = $2 AND status = $3`,
+		progressJSON, id, models.MigrationStatusRunning)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to refresh migration %s heartbeat: %v", id, err)
+		}
+		return nil
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errCanceled
+	}
+	return nil
+}
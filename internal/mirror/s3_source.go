@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// s3Source 列出并读取S3兼容存储中某个前缀下的对象
+type s3Source struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newS3Source 连接S3兼容存储，httpClient不为空时使用它的Transport，与WebDAV上游受同样的出站限制
+func newS3Source(src models.MirrorSource, httpClient *http.Client) (*s3Source, error) {
+	if src.Bucket == "" {
+		return nil, fmt.Errorf("%w: bucket is required for s3 sources", ErrInvalidSource)
+	}
+	u, err := url.Parse(src.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid s3 endpoint", ErrInvalidSource)
+	}
+
+	opts := &minio.Options{Secure: u.Scheme == "https"}
+	if httpClient != nil {
+		opts.Transport = httpClient.Transport
+	}
+	if src.Username != "" || src.Password != "" {
+		opts.Creds = credentials.NewStaticV4(src.Username, src.Password, "")
+	} else {
+		opts.Creds = credentials.NewStatic("", "", "", credentials.SignatureAnonymous)
+	}
+	client, err := minio.New(u.Host, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+
+	prefix := strings.Trim(src.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Source{client: client, bucket: src.Bucket, prefix: prefix}, nil
+}
+
+// List 递归列出前缀下的对象，跳过目录标记
+func (s *s3Source) List(ctx context.Context) ([]RemoteObject, error) {
+	var objects []RemoteObject
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("list %s/%s: %w", s.bucket, s.prefix, obj.Err)
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		rel, ok := cleanRelative(strings.TrimPrefix(obj.Key, s.prefix))
+		if !ok {
+			continue
+		}
+		objects = append(objects, RemoteObject{
+			Path:         rel,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+			ContentType:  obj.ContentType,
+		})
+		if len(objects) > maxListedObjects {
+			return nil, fmt.Errorf("source lists more than %d files", maxListedObjects)
+		}
+	}
+	return objects, nil
+}
+
+// Open 读取对象，ETag变化时GetObject会在读取中途报错，下次同步重试
+func (s *s3Source) Open(ctx context.Context, obj RemoteObject) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if obj.ETag != "" {
+		if err := opts.SetMatchETag(obj.ETag); err != nil {
+			return nil, err
+		}
+	}
+	return s.client.GetObject(ctx, s.bucket, s.prefix+obj.Path, opts)
+}
@@ -0,0 +1,373 @@
+package mirror
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/netguard"
+	"github.com/webdav-gateway/internal/secretbox"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// 错误定义
+var (
+	ErrNotFound       = Error("mirror not found")
+	ErrInvalidSource  = Error("invalid mirror source")
+	ErrInvalidTarget  = Error("target_path must be a folder below /")
+	ErrTargetOverlap  = Error("target_path overlaps another mirror")
+	ErrTooManyMirrors = Error("mirror limit reached")
+	ErrIntervalTooLow = Error("interval_seconds is below the configured minimum")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// claimTimeout 同步中的镜像超过该时间没有心跳时，视为所在副本已退出，允许其他副本接手
+const claimTimeout = 10 * time.Minute
+
+// Quota 镜像写入计入用户配额
+type Quota interface {
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error
+}
+
+// Journal 记录镜像同步写入和删除的文件，未启用变更通知时为nil
+type Journal interface {
+	Record(ctx context.Context, change changes.Change) error
+}
+
+// Service 管理镜像任务并在后台按计划同步。到期的镜像通过数据库领取，
+// 多副本部署时同一镜像同时只会被一个副本同步
+type Service struct {
+	db      *sql.DB
+	storage *storage.Service
+	quota   Quota
+	journal Journal
+	config  config.MirrorConfig
+	guard   *netguard.Guard
+	client  *http.Client
+	box     *secretbox.Box
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewService 创建镜像服务。访问上游的请求不能到达内网地址（mirror.allowed_hosts中的主机除外），
+// 上游密码用box加密保存
+func NewService(db *sql.DB, storageService *storage.Service, quota Quota, box *secretbox.Box, cfg config.MirrorConfig) *Service {
+	guard := netguard.New(cfg.AllowedHosts)
+	return &Service{
+		db:      db,
+		storage: storageService,
+		quota:   quota,
+		config:  cfg,
+		guard:   guard,
+		client:  guard.Client(cfg.RequestTimeout),
+		box:     box,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetJournal 设置变更日志，同步写入、删除的文件与WebDAV写入一样推送给订阅的客户端
+func (s *Service) SetJournal(journal Journal) {
+	s.journal = journal
+}
+
+// Initialize 创建镜像表，并加密升级前以明文保存的上游密码
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS mirrors (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			source_type VARCHAR(20) NOT NULL CHECK (source_type IN ('webdav', 's3')),
+			source_url TEXT NOT NULL,
+			source_bucket VARCHAR(255) NOT NULL DEFAULT '',
+			source_prefix TEXT NOT NULL DEFAULT '',
+			source_username VARCHAR(255) NOT NULL DEFAULT '',
+			source_password TEXT NOT NULL DEFAULT '',
+			target_path TEXT NOT NULL,
+			interval_seconds INTEGER NOT NULL,
+			delete_extraneous BOOLEAN NOT NULL DEFAULT FALSE,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			next_sync_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			running_since TIMESTAMP,
+			last_sync_at TIMESTAMP,
+			last_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			last_error TEXT NOT NULL DEFAULT '',
+			last_stats JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS mirror_objects (
+			mirror_id UUID NOT NULL REFERENCES mirrors(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			version TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (mirror_id, path)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mirrors_user_id ON mirrors(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mirrors_next_sync_at ON mirrors(next_sync_at) WHERE enabled`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize mirror tables: %w", err)
+		}
+	}
+	if _, err := s.box.SealColumn(ctx, s.db, "mirrors", "source_password"); err != nil {
+		return fmt.Errorf("failed to encrypt mirror passwords: %w", err)
+	}
+	return nil
+}
+
+const mirrorColumns = `id, user_id, name, source_type, source_url, source_bucket, source_prefix, source_username, source_password,
+	target_path, interval_seconds, delete_extraneous, enabled, last_sync_at, last_status, last_error, last_stats, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMirror 读取一行镜像记录，包含加密的上游密码，同步时用open解密
+func scanMirror(row rowScanner) (*models.Mirror, error) {
+	m := &models.Mirror{}
+	var stats []byte
+	if err := row.Scan(&m.ID, &m.UserID, &m.Name, &m.Source.Type, &m.Source.URL, &m.Source.Bucket, &m.Source.Prefix,
+		&m.Source.Username, &m.Source.Password, &m.TargetPath, &m.IntervalSeconds, &m.DeleteExtraneous, &m.Enabled,
+		&m.LastSyncAt, &m.LastStatus, &m.LastError, &stats, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if len(stats) > 0 {
+		m.LastStats = &models.MirrorStats{}
+		if err := json.Unmarshal(stats, m.LastStats); err != nil {
+			m.LastStats = nil
+		}
+	}
+	return m, nil
+}
+
+// redact 去掉返回给客户端的上游密码
+func redact(m *models.Mirror) *models.Mirror {
+	m.Source.Password = ""
+	return m
+}
+
+// List 列出用户的镜像
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]*models.Mirror, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+mirrorColumns+` FROM mirrors WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mirrors: %w", err)
+	}
+	defer rows.Close()
+
+	mirrors := []*models.Mirror{}
+	for rows.Next() {
+		m, err := scanMirror(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mirror: %w", err)
+		}
+		mirrors = append(mirrors, redact(m))
+	}
+	return mirrors, rows.Err()
+}
+
+// Get 获取用户的一个镜像
+func (s *Service) Get(ctx context.Context, userID, id uuid.UUID) (*models.Mirror, error) {
+	m, err := s.load(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return redact(m), nil
+}
+
+func (s *Service) load(ctx context.Context, userID, id uuid.UUID) (*models.Mirror, error) {
+	m, err := scanMirror(s.db.QueryRowContext(ctx, `SELECT `+mirrorColumns+` FROM mirrors WHERE id = $1 AND user_id = $2`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirror: %w", err)
+	}
+	return m, nil
+}
+
+// Create 创建镜像，首次同步在下一次轮询时进行
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, req *models.CreateMirrorRequest) (*models.Mirror, error) {
+	if err := s.validateSource(ctx, req.Source); err != nil {
+		return nil, err
+	}
+	if err := s.validateInterval(req.IntervalSeconds); err != nil {
+		return nil, err
+	}
+	target, err := cleanTarget(req.TargetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.MaxPerUser > 0 && len(existing) >= s.config.MaxPerUser {
+		return nil, ErrTooManyMirrors
+	}
+	for _, m := range existing {
+		if overlaps(m.TargetPath, target) {
+			return nil, fmt.Errorf("%w: %s", ErrTargetOverlap, m.Name)
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	src := req.Source
+	password, err := s.box.Seal(src.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt source password: %w", err)
+	}
+	var id uuid.UUID
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO mirrors (user_id, name, source_type, source_url, source_bucket, source_prefix, source_username, source_password,
+			target_path, interval_seconds, delete_extraneous, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id`,
+		userID, req.Name, src.Type, src.URL, src.Bucket, src.Prefix, src.Username, password,
+		target, req.IntervalSeconds, req.DeleteExtraneous, enabled).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mirror: %w", err)
+	}
+	return s.Get(ctx, userID, id)
+}
+
+// Update 修改镜像。目标目录创建后不可修改，否则已同步文件的记录会失效
+func (s *Service) Update(ctx context.Context, userID, id uuid.UUID, req *models.UpdateMirrorRequest) (*models.Mirror, error) {
+	m, err := s.load(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		m.Name = *req.Name
+	}
+	if req.Source != nil {
+		src := *req.Source
+		if src.Password == "" {
+			// 未提交新密码时沿用原来的密文
+			src.Password = m.Source.Password
+		} else if src.Password, err = s.box.Seal(src.Password); err != nil {
+			return nil, fmt.Errorf("failed to encrypt source password: %w", err)
+		}
+		if err := s.validateSource(ctx, src); err != nil {
+			return nil, err
+		}
+		m.Source = src
+	}
+	if req.IntervalSeconds != nil {
+		if err := s.validateInterval(*req.IntervalSeconds); err != nil {
+			return nil, err
+		}
+		m.IntervalSeconds = *req.IntervalSeconds
+	}
+	if req.DeleteExtraneous != nil {
+		m.DeleteExtraneous = *req.DeleteExtraneous
+	}
+	enabling := req.Enabled != nil && *req.Enabled && !m.Enabled
+	if req.Enabled != nil {
+		m.Enabled = *req.Enabled
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE mirrors SET name = $1, source_type = $2, source_url = $3, source_bucket = $4, source_prefix = $5,
+			source_username = $6, source_password = $7, interval_seconds = $8, delete_extraneous = $9, enabled = $10,
+			next_sync_at = CASE WHEN $11 THEN NOW() ELSE next_sync_at END
+		WHERE id = $12 AND user_id = $13`,
+		m.Name, m.Source.Type, m.Source.URL, m.Source.Bucket, m.Source.Prefix, m.Source.Username, m.Source.Password,
+		m.IntervalSeconds, m.DeleteExtraneous, m.Enabled, enabling, id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update mirror: %w", err)
+	}
+	return s.Get(ctx, userID, id)
+}
+
+// Delete 删除镜像任务，已同步的文件保留在目标目录中
+func (s *Service) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM mirrors WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete mirror: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Trigger 安排镜像在下一次轮询时立即同步
+func (s *Service) Trigger(ctx context.Context, userID, id uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE mirrors SET next_sync_at = NOW() WHERE id = $1 AND user_id = $2 AND enabled`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to schedule mirror: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// validateSource 校验上游地址和类型，拒绝不在允许列表中或位于内网的上游
+func (s *Service) validateSource(ctx context.Context, src models.MirrorSource) error {
+	if err := s.guard.CheckURL(ctx, src.URL); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	_, err := NewSource(src, s.client)
+	return err
+}
+
+// open 解密镜像的上游密码，返回可用于访问上游的配置
+func (s *Service) open(m *models.Mirror) (models.MirrorSource, error) {
+	src := m.Source
+	password, err := s.box.Open(src.Password)
+	if err != nil {
+		return src, err
+	}
+	src.Password = password
+	return src, nil
+}
+
+func (s *Service) validateInterval(seconds int) error {
+	if time.Duration(seconds)*time.Second < s.config.MinInterval {
+		return fmt.Errorf("%w (%s)", ErrIntervalTooLow, s.config.MinInterval)
+	}
+	return nil
+}
+
+// cleanTarget 规范化目标目录，不允许同步到根目录
+func cleanTarget(target string) (string, error) {
+	cleaned := path.Clean("/" + target)
+	if cleaned == "/" {
+		return "", ErrInvalidTarget
+	}
+	return cleaned, nil
+}
+
+// overlaps 判断两个目录是否相同或互相包含
+func overlaps(a, b string) bool {
+	a, b = strings.TrimSuffix(a, "/")+"/", strings.TrimSuffix(b, "/")+"/"
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
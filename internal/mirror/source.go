@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// RemoteObject 上游的一个文件，Path为相对于镜像根目录的路径（不以/开头）
+type RemoteObject struct {
+	Path         string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+}
+
+// Version 用于判断文件是否变化的标识。上游没有ETag时使用大小和修改时间
+func (o RemoteObject) Version() string {
+	if o.ETag != "" {
+		return strings.Trim(o.ETag, `"`)
+	}
+	return fmt.Sprintf("%d-%d", o.Size, o.LastModified.Unix())
+}
+
+// Source 镜像上游
+type Source interface {
+	// List 递归列出上游的全部文件
+	List(ctx context.Context) ([]RemoteObject, error)
+	// Open 读取一个文件的内容
+	Open(ctx context.Context, obj RemoteObject) (io.ReadCloser, error)
+}
+
+// NewSource 按上游类型创建Source
+func NewSource(src models.MirrorSource, client *http.Client) (Source, error) {
+	switch src.Type {
+	case models.MirrorSourceWebDAV:
+		return newWebDAVSource(src, client)
+	case models.MirrorSourceS3:
+		return newS3Source(src, client)
+	}
+	return nil, fmt.Errorf("%w: unknown source type %q", ErrInvalidSource, src.Type)
+}
+
+// cleanRelative 规范化上游返回的相对路径，拒绝试图越出镜像目录的路径
+func cleanRelative(p string) (string, bool) {
+	if p == "" || strings.Contains(p, "\x00") {
+		return "", false
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if cleaned == "" || cleaned == "." {
+		return "", false
+	}
+	return cleaned, true
+}
@@ -0,0 +1,240 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// heartbeatInterval 同步过程中刷新领取标记的间隔
+const heartbeatInterval = time.Minute
+
+// syncedObject 上次同步时记录的上游文件版本
+type syncedObject struct {
+	version string
+	size    int64
+}
+
+// syncMirror 将上游文件拉取到目标目录。按上游ETag（或大小和修改时间）与上次同步的记录比较，
+// 本地文件缺失或大小不一致时也重新下载。delete_extraneous只删除由镜像创建、上游已不存在的文件，
+// 上游列表为空时不做删除，避免上游配置错误清空本地副本
+func (s *Service) syncMirror(ctx context.Context, m *models.Mirror) (*models.MirrorStats, error) {
+	stats := &models.MirrorStats{}
+
+	source, err := s.open(m)
+	if err != nil {
+		return stats, err
+	}
+	src, err := NewSource(source, s.client)
+	if err != nil {
+		return stats, err
+	}
+	listCtx, cancel := s.requestContext(ctx)
+	remote, err := src.List(listCtx)
+	cancel()
+	if err != nil {
+		return stats, fmt.Errorf("list source: %w", err)
+	}
+	stats.Listed = len(remote)
+	sort.Slice(remote, func(i, j int) bool { return remote[i].Path < remote[j].Path })
+
+	synced, err := s.loadSynced(ctx, m)
+	if err != nil {
+		return stats, err
+	}
+	local, err := s.localSizes(ctx, m)
+	if err != nil {
+		return stats, err
+	}
+
+	if err := s.storage.EnsureBucket(ctx, m.UserID); err != nil {
+		return stats, err
+	}
+
+	remaining := int64(-1)
+	if user, err := s.quota.GetUserByID(ctx, m.UserID); err == nil && user.StorageQuota > 0 {
+		remaining = user.StorageQuota - user.StorageUsed
+	}
+
+	var firstErr error
+	fail := func(p string, err error) {
+		stats.Failed++
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	lastBeat := time.Now()
+	seen := make(map[string]bool, len(remote))
+
+	for _, obj := range remote {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		if time.Since(lastBeat) > heartbeatInterval {
+			s.heartbeat(ctx, m.ID)
+			lastBeat = time.Now()
+		}
+		seen[obj.Path] = true
+
+		localSize, exists := local[obj.Path]
+		if prev, ok := synced[obj.Path]; ok && exists && prev.version == obj.Version() && prev.size == obj.Size && localSize == obj.Size {
+			stats.Unchanged++
+			continue
+		}
+
+		delta := obj.Size - localSize
+		if remaining >= 0 && delta > remaining {
+			fail(obj.Path, fmt.Errorf("storage quota exceeded"))
+			continue
+		}
+		if err := s.download(ctx, src, m, obj); err != nil {
+			fail(obj.Path, err)
+			continue
+		}
+		if err := s.recordSynced(ctx, m, obj); err != nil {
+			fail(obj.Path, err)
+		}
+		changeType := changes.TypeCreated
+		if exists {
+			changeType = changes.TypeUpdated
+		}
+		s.recordChange(ctx, m.UserID, changeType, path.Join(m.TargetPath, obj.Path))
+		if delta != 0 {
+			if err := s.quota.UpdateStorageUsed(ctx, m.UserID, delta); err != nil {
+				log.Printf("Warning: failed to update storage usage of user %s: %v", m.UserID, err)
+			}
+			if remaining >= 0 {
+				remaining -= delta
+			}
+		}
+		stats.Downloaded++
+		stats.Bytes += obj.Size
+	}
+
+	if m.DeleteExtraneous && len(remote) > 0 {
+		for p := range synced {
+			if seen[p] || ctx.Err() != nil {
+				continue
+			}
+			if err := s.removeExtraneous(ctx, m, p, local); err != nil {
+				fail(p, err)
+				continue
+			}
+			stats.Deleted++
+		}
+	}
+
+	if firstErr != nil {
+		return stats, fmt.Errorf("%d files failed, first error: %w", stats.Failed, firstErr)
+	}
+	return stats, nil
+}
+
+// download 将一个上游文件写入目标目录，覆盖时保留原文件ID
+func (s *Service) download(ctx context.Context, src Source, m *models.Mirror, obj RemoteObject) error {
+	reqCtx, cancel := s.requestContext(ctx)
+	defer cancel()
+
+	body, err := src.Open(reqCtx, obj)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return s.storage.PutObject(reqCtx, m.UserID, path.Join(m.TargetPath, obj.Path), body, obj.Size, contentType)
+}
+
+// removeExtraneous 删除上游已不存在的文件及其同步记录
+func (s *Service) removeExtraneous(ctx context.Context, m *models.Mirror, p string, local map[string]int64) error {
+	if err := s.storage.DeleteObject(ctx, m.UserID, path.Join(m.TargetPath, p)); err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+	size, ok := local[p]
+	if ok && size > 0 {
+		if err := s.quota.UpdateStorageUsed(ctx, m.UserID, -size); err != nil {
+			log.Printf("Warning: failed to update storage usage of user %s: %v", m.UserID, err)
+		}
+	}
+	if ok {
+		s.recordChange(ctx, m.UserID, changes.TypeDeleted, path.Join(m.TargetPath, p))
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM mirror_objects WHERE mirror_id = $1 AND path = $2`, m.ID, p)
+	return err
+}
+
+// recordChange 写入一条变更，未启用变更通知时不记录，失败只记录日志
+func (s *Service) recordChange(ctx context.Context, userID uuid.UUID, changeType, p string) {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.Record(ctx, changes.Change{UserID: userID, Type: changeType, Path: p}); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+func (s *Service) loadSynced(ctx context.Context, m *models.Mirror) (map[string]syncedObject, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, version, size FROM mirror_objects WHERE mirror_id = $1`, m.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mirror state: %w", err)
+	}
+	defer rows.Close()
+
+	synced := make(map[string]syncedObject)
+	for rows.Next() {
+		var p string
+		var obj syncedObject
+		if err := rows.Scan(&p, &obj.version, &obj.size); err != nil {
+			return nil, err
+		}
+		synced[p] = obj
+	}
+	return synced, rows.Err()
+}
+
+func (s *Service) recordSynced(ctx context.Context, m *models.Mirror, obj RemoteObject) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO mirror_objects (mirror_id, path, version, size, synced_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (mirror_id, path) DO UPDATE SET version = EXCLUDED.version, size = EXCLUDED.size, synced_at = NOW()`,
+		m.ID, obj.Path, obj.Version(), obj.Size)
+	return err
+}
+
+// localSizes 列出目标目录下已有的文件，key为相对路径
+func (s *Service) localSizes(ctx context.Context, m *models.Mirror) (map[string]int64, error) {
+	prefix := strings.TrimPrefix(m.TargetPath, "/") + "/"
+	local := make(map[string]int64)
+	err := s.storage.WalkObjects(ctx, m.UserID, m.TargetPath, true, func(obj minio.ObjectInfo) error {
+		if !strings.HasSuffix(obj.Key, "/") {
+			local[strings.TrimPrefix(obj.Key, prefix)] = obj.Size
+		}
+		return nil
+	})
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list target folder: %w", err)
+	}
+	return local, nil
+}
+
+// requestContext 为单个上游请求设置超时
+func (s *Service) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, s.config.RequestTimeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,220 @@
+package mirror
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// maxListedObjects 单个镜像最多列出的文件数，防止异常上游无限返回
+const maxListedObjects = 1000000
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getetag/><D:getlastmodified/><D:getcontenttype/></D:prop></D:propfind>`
+
+// webdavSource 通过逐层Depth: 1的PROPFIND遍历上游集合，很多服务器禁用了Depth: infinity
+type webdavSource struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func newWebDAVSource(src models.MirrorSource, client *http.Client) (*webdavSource, error) {
+	base, err := url.Parse(src.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webdavSource{base: base, username: src.Username, password: src.Password, client: client}, nil
+}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		ETag          string `xml:"DAV: getetag"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+		ContentType   string `xml:"DAV: getcontenttype"`
+	} `xml:"DAV: prop"`
+}
+
+// List 广度优先遍历上游集合
+func (s *webdavSource) List(ctx context.Context) ([]RemoteObject, error) {
+	var objects []RemoteObject
+	queue := []string{""}
+	visited := map[string]bool{"": true}
+
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		entries, err := s.propfind(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.collection {
+				if !visited[entry.Path] {
+					visited[entry.Path] = true
+					queue = append(queue, entry.Path+"/")
+				}
+				continue
+			}
+			objects = append(objects, entry.RemoteObject)
+			if len(objects) > maxListedObjects {
+				return nil, fmt.Errorf("source lists more than %d files", maxListedObjects)
+			}
+		}
+	}
+	return objects, nil
+}
+
+type davEntry struct {
+	RemoteObject
+	collection bool
+}
+
+// propfind 列出一个集合的直接成员，dir为相对路径（空或以/结尾）
+func (s *webdavSource) propfind(ctx context.Context, dir string) ([]davEntry, error) {
+	target := s.resolve(dir)
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", target.String(), strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %w", target.Path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: unexpected status %s", target.Path, resp.Status)
+	}
+	return parseMultistatus(resp.Body, s.base.Path, dir)
+}
+
+// parseMultistatus 解析PROPFIND响应，跳过集合自身，返回相对于basePath的成员
+func parseMultistatus(r io.Reader, basePath, dir string) ([]davEntry, error) {
+	var ms davMultistatus
+	if err := xml.NewDecoder(r).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid multistatus: %w", err)
+	}
+
+	var entries []davEntry
+	for _, resp := range ms.Responses {
+		hrefPath := resp.Href
+		if u, err := url.Parse(resp.Href); err == nil {
+			hrefPath = u.Path
+		}
+		if !strings.HasPrefix(hrefPath, basePath) {
+			continue
+		}
+		rel := strings.TrimSuffix(strings.TrimPrefix(hrefPath, basePath), "/")
+		if rel == strings.TrimSuffix(dir, "/") {
+			continue
+		}
+		rel, ok := cleanRelative(rel)
+		if !ok {
+			continue
+		}
+
+		for _, ps := range resp.Propstat {
+			if !strings.Contains(ps.Status, " 200") {
+				continue
+			}
+			entry := davEntry{RemoteObject: RemoteObject{
+				Path:        rel,
+				ETag:        strings.TrimPrefix(ps.Prop.ETag, "W/"),
+				ContentType: ps.Prop.ContentType,
+			}}
+			entry.collection = ps.Prop.ResourceType.Collection != nil
+			if size, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64); err == nil {
+				entry.Size = size
+			}
+			if t, ok := parseTime(strings.TrimSpace(ps.Prop.LastModified)); ok {
+				entry.LastModified = t
+			}
+			entries = append(entries, entry)
+			break
+		}
+	}
+	return entries, nil
+}
+
+// Open 下载一个文件
+func (s *webdavSource) Open(ctx context.Context, obj RemoteObject) (io.ReadCloser, error) {
+	target := s.resolve(obj.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", target.Path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected status %s", target.Path, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// resolve 拼接相对路径，逐段转义
+func (s *webdavSource) resolve(rel string) *url.URL {
+	u := *s.base
+	segments := strings.Split(rel, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	u.Path = s.base.Path + rel
+	u.RawPath = s.base.EscapedPath() + strings.Join(segments, "/")
+	return &u
+}
+
+func (s *webdavSource) authorize(req *http.Request) {
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+}
+
+// parseTime 兼容部分服务器返回的RFC 3339时间
+func parseTime(v string) (time.Time, bool) {
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,179 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/netguard"
+)
+
+const testMultistatus = `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:">
+  <D:response>
+    <D:href>/dav/releases/</D:href>
+    <D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>
+  </D:response>
+  <D:response>
+    <D:href>http://upstream.example/dav/releases/v1%20final/</D:href>
+    <D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>
+  </D:response>
+  <D:response>
+    <D:href>/dav/releases/app.tar.gz</D:href>
+    <D:propstat>
+      <D:prop>
+        <D:resourcetype/>
+        <D:getcontentlength>1024</D:getcontentlength>
+        <D:getetag>W/"abc"</D:getetag>
+        <D:getlastmodified>Mon, 01 Jan 2024 00:00:00 GMT</D:getlastmodified>
+      </D:prop>
+      <D:status>HTTP/1.1 200 OK</D:status>
+    </D:propstat>
+  </D:response>
+  <D:response>
+    <D:href>/elsewhere/secret.txt</D:href>
+    <D:propstat><D:prop><D:resourcetype/></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>
+  </D:response>
+</D:multistatus>`
+
+func TestParseMultistatus(t *testing.T) {
+	entries, err := parseMultistatus(strings.NewReader(testMultistatus), "/dav/releases/", "")
+	if err != nil {
+		t.Fatalf("parseMultistatus() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].Path != "v1 final" || !entries[0].collection {
+		t.Errorf("entries[0] = %+v, want collection \"v1 final\"", entries[0])
+	}
+	file := entries[1]
+	if file.Path != "app.tar.gz" || file.collection || file.Size != 1024 || file.ETag != `"abc"` || file.LastModified.Year() != 2024 {
+		t.Errorf("entries[1] = %+v", file)
+	}
+	if file.Version() != "abc" {
+		t.Errorf("Version() = %q, want abc", file.Version())
+	}
+}
+
+func TestWebDAVSourceList(t *testing.T) {
+	tree := map[string][]string{
+		"/dav/":     {"a.txt", "sub/"},
+		"/dav/sub/": {"b.txt"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "u" || pass != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != "PROPFIND" || r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		members, ok := tree[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<D:multistatus xmlns:D="DAV:"><D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, r.URL.Path)
+		for _, m := range members {
+			resourceType := ""
+			if strings.HasSuffix(m, "/") {
+				resourceType = "<D:collection/>"
+			}
+			fmt.Fprintf(w, `<D:response><D:href>%s%s</D:href><D:propstat><D:prop><D:resourcetype>%s</D:resourcetype><D:getcontentlength>3</D:getcontentlength></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, r.URL.Path, m, resourceType)
+		}
+		fmt.Fprint(w, `</D:multistatus>`)
+	}))
+	defer srv.Close()
+
+	src, err := NewSource(models.MirrorSource{Type: models.MirrorSourceWebDAV, URL: srv.URL + "/dav", Username: "u", Password: "p"}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	objects, err := src.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var paths []string
+	for _, obj := range objects {
+		paths = append(paths, obj.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"a.txt", "sub/b.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("List() paths = %q, want %q", paths, want)
+	}
+}
+
+func TestCleanRelative(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"a/b.txt", "a/b.txt", true},
+		{"/a//b.txt", "a/b.txt", true},
+		{"../etc/passwd", "", false},
+		{"a/../../b", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cleanRelative(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanRelative(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		url     string
+		wantErr bool
+	}{
+		{"allowed host", []string{"mirror.example.com"}, "https://mirror.example.com/dav", false},
+		{"host outside allow list", []string{"mirror.example.com"}, "http://169.254.169.254/latest", true},
+		{"non-http URL", nil, "file:///etc/passwd", true},
+		// 未配置允许列表时拒绝内网地址
+		{"metadata address", nil, "http://169.254.169.254/latest", true},
+		{"loopback", nil, "http://127.0.0.1:9000/dav", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{guard: netguard.New(tt.allowed)}
+			err := s.validateSource(context.Background(), models.MirrorSource{Type: models.MirrorSourceWebDAV, URL: tt.url})
+			if tt.wantErr && !errors.Is(err, ErrInvalidSource) {
+				t.Errorf("validateSource(%s) = %v, want ErrInvalidSource", tt.url, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateSource(%s) = %v", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/mirror", "/mirror", true},
+		{"/mirror", "/mirror/sub", true},
+		{"/mirror/sub", "/mirror", true},
+		{"/mirror", "/mirror2", false},
+	}
+	for _, tt := range tests {
+		if got := overlaps(tt.a, tt.b); got != tt.want {
+			t.Errorf("overlaps(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
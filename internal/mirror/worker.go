@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// Start 启动后台轮询，PollInterval不大于0时不启动
+func (s *Service) Start() {
+	if s.config.PollInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.runDue(ctx)
+			select {
+			case <-ticker.C:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止轮询并中断正在进行的同步，中断的镜像会在下次启动后重新同步
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// runDue 依次同步所有到期的镜像
+func (s *Service) runDue(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM mirrors
+		WHERE enabled AND next_sync_at <= NOW()
+			AND (running_since IS NULL OR running_since < NOW() - $1 * INTERVAL '1 second')
+		ORDER BY next_sync_at
+		LIMIT 20`, claimTimeout.Seconds())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to query due mirrors: %v", err)
+		}
+		return
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		m, err := s.claim(ctx, id)
+		if err != nil {
+			log.Printf("Warning: failed to claim mirror %s: %v", id, err)
+			continue
+		}
+		if m == nil {
+			// 已被其他副本领取
+			continue
+		}
+		s.run(ctx, m)
+	}
+}
+
+// claim 原子地将镜像标记为同步中，未领取到时返回nil
+func (s *Service) claim(ctx context.Context, id uuid.UUID) (*models.Mirror, error) {
+	m, err := scanMirror(s.db.QueryRowContext(ctx, `
+		UPDATE mirrors SET running_since = NOW(), last_status = $1
+		WHERE id = $2 AND enabled AND next_sync_at <= NOW()
+			AND (running_since IS NULL OR running_since < NOW() - $3 * INTERVAL '1 second')
+		RETURNING `+mirrorColumns, models.MirrorStatusRunning, id, claimTimeout.Seconds()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// run 同步一个已领取的镜像并记录结果
+func (s *Service) run(ctx context.Context, m *models.Mirror) {
+	started := time.Now()
+	stats, syncErr := s.syncMirror(ctx, m)
+
+	status, message := models.MirrorStatusOK, ""
+	if syncErr != nil {
+		status, message = models.MirrorStatusFailed, syncErr.Error()
+		log.Printf("Warning: mirror %s (%s) sync failed: %v", m.ID, m.Name, syncErr)
+	} else {
+		log.Printf("Mirror %s (%s) synced in %s: %d downloaded, %d deleted, %d unchanged",
+			m.ID, m.Name, time.Since(started).Round(time.Second), stats.Downloaded, stats.Deleted, stats.Unchanged)
+	}
+	statsJSON, _ := json.Marshal(stats)
+
+	// 停止时中断的同步不推迟下一次同步
+	next := "NOW() + interval_seconds * INTERVAL '1 second'"
+	if ctx.Err() != nil {
+		next = "NOW()"
+	}
+	_, err := s.db.ExecContext(context.Background(), `
+		UPDATE mirrors SET running_since = NULL, last_sync_at = NOW(), last_status = $1, last_error = $2, last_stats = $3,
+			next_sync_at = `+next+`
+		WHERE id = $4`, status, message, statsJSON, m.ID)
+	if err != nil {
+		log.Printf("Warning: failed to record result of mirror %s: %v", m.ID, err)
+	}
+}
+
+// heartbeat 刷新同步中的标记，避免长时间同步被其他副本视为中断
+func (s *Service) heartbeat(ctx context.Context, id uuid.UUID) {
+	if _, err := s.db.ExecContext(ctx, `UPDATE mirrors SET running_since = NOW() WHERE id = $1`, id); err != nil && ctx.Err() == nil {
+		log.Printf("Warning: failed to refresh mirror %s heartbeat: %v", id, err)
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Comment 文件上的一条评论。回复通过ParentID组成讨论串；有回复的评论被删除后保留为占位，Deleted为true、Body为空
+type Comment struct {
+	ID         uuid.UUID  `json:"id"`
+	ParentID   *uuid.UUID `json:"parent_id,omitempty"`
+	AuthorID   uuid.UUID  `json:"author_id"`
+	AuthorName string     `json:"author"`
+	Body       string     `json:"body"`
+	Deleted    bool       `json:"deleted,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Replies    []*Comment `json:"replies,omitempty"`
+}
+
+type CreateCommentRequest struct {
+	Body     string     `json:"body" binding:"required"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
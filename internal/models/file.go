@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+type FileInfo struct {
+	FileID       string    `json:"file_id"`
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	IsDir        bool      `json:"is_dir"`
+}
+
+// SegmentInfo 多连接分段下载所需的文件元数据
+type SegmentInfo struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	AcceptRanges string    `json:"accept_ranges"`
+	SegmentSize  int64     `json:"segment_size"`
+	Segments     []Segment `json:"segments"`
+}
+
+// Segment 分段下载中的一个字节区间（闭区间）
+type Segment struct {
+	Index int   `json:"index"`
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// FileChecksum 上传时记录的文件校验值（十六进制）
+type FileChecksum struct {
+	Path   string `json:"path"`
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ZipDownloadRequest 打包下载请求，paths与folder二选一
+type ZipDownloadRequest struct {
+	Paths  []string `json:"paths"`
+	Folder string   `json:"folder"`
+	// Name 下载文件名（不含.zip），为空时使用目录名或download
+	Name string `json:"name"`
+	// Estimate 为true时只返回文件数和大小估算，不下载
+	Estimate bool `json:"estimate"`
+	// Async 为true时在后台打包并保存到Target，返回任务，用于超出HTTP超时的大目录
+	Async bool `json:"async"`
+	// Target 后台打包的保存位置，为空时保存到根目录下的<name>.zip
+	Target string `json:"target"`
+}
+
+// ShareZipDownloadRequest 通过分享链接打包下载，paths相对于分享的目录，为空时下载整个分享
+type ShareZipDownloadRequest struct {
+	Password string   `json:"password"`
+	Paths    []string `json:"paths"`
+	Estimate bool     `json:"estimate"`
+}
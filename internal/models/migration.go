@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 迁移状态
+const (
+	MigrationStatusPending   = "pending"
+	MigrationStatusRunning   = "running"
+	MigrationStatusCompleted = "completed"
+	MigrationStatusFailed    = "failed"
+	MigrationStatusCanceled  = "canceled"
+)
+
+// Migration 从其他WebDAV服务器（Nextcloud、ownCloud、Apache mod_dav等）一次性导入到用户空间的迁移任务
+type Migration struct {
+	ID         uuid.UUID          `json:"id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	CreatedBy  uuid.UUID          `json:"created_by"`
+	Source     MigrationSource    `json:"source"`
+	TargetPath string             `json:"target_path"`
+	Status     string             `json:"status"`
+	Progress   MigrationProgress  `json:"progress"`
+	LastError  string             `json:"last_error,omitempty"`
+	Failures   []MigrationFailure `json:"failures,omitempty"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// MigrationSource 源服务器上要迁移的集合，如https://cloud.example.com/remote.php/dav/files/alice/
+type MigrationSource struct {
+	URL      string `json:"url" binding:"required,url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// MigrationProgress 迁移进度。每次运行重新计数，之前的运行已导入且未变化的文件计入Skipped
+type MigrationProgress struct {
+	Folders    int   `json:"folders"`
+	Files      int   `json:"files"`
+	Skipped    int   `json:"skipped"`
+	Failed     int   `json:"failed"`
+	Bytes      int64 `json:"bytes"`
+	Properties int   `json:"properties"`
+	// Current 正在处理的源路径
+	Current string `json:"current,omitempty"`
+}
+
+// MigrationFailure 一个未能导入的文件或目录
+type MigrationFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type CreateMigrationRequest struct {
+	UserID     uuid.UUID       `json:"user_id" binding:"required"`
+	Source     MigrationSource `json:"source" binding:"required"`
+	TargetPath string          `json:"target_path"`
+}
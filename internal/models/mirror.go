@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 镜像上游类型
+const (
+	MirrorSourceWebDAV = "webdav"
+	MirrorSourceS3     = "s3"
+)
+
+// 镜像同步状态
+const (
+	MirrorStatusPending = "pending"
+	MirrorStatusRunning = "running"
+	MirrorStatusOK      = "ok"
+	MirrorStatusFailed  = "failed"
+)
+
+// Mirror 将上游WebDAV或S3内容定期拉取到用户目录的镜像任务
+type Mirror struct {
+	ID               uuid.UUID    `json:"id"`
+	UserID           uuid.UUID    `json:"user_id"`
+	Name             string       `json:"name"`
+	Source           MirrorSource `json:"source"`
+	TargetPath       string       `json:"target_path"`
+	IntervalSeconds  int          `json:"interval_seconds"`
+	DeleteExtraneous bool         `json:"delete_extraneous"`
+	Enabled          bool         `json:"enabled"`
+	LastSyncAt       *time.Time   `json:"last_sync_at,omitempty"`
+	LastStatus       string       `json:"last_status"`
+	LastError        string       `json:"last_error,omitempty"`
+	LastStats        *MirrorStats `json:"last_stats,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
+
+// MirrorSource 上游位置。WebDAV使用URL指向的集合；S3使用URL作为endpoint，
+// Username/Password为Access Key/Secret Key
+type MirrorSource struct {
+	Type     string `json:"type" binding:"required,oneof=webdav s3"`
+	URL      string `json:"url" binding:"required,url"`
+	Bucket   string `json:"bucket,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// MirrorStats 一次同步的结果
+type MirrorStats struct {
+	Listed     int   `json:"listed"`
+	Downloaded int   `json:"downloaded"`
+	Deleted    int   `json:"deleted"`
+	Unchanged  int   `json:"unchanged"`
+	Failed     int   `json:"failed"`
+	Bytes      int64 `json:"bytes"`
+}
+
+type CreateMirrorRequest struct {
+	Name             string       `json:"name" binding:"required,max=255"`
+	Source           MirrorSource `json:"source" binding:"required"`
+	TargetPath       string       `json:"target_path" binding:"required"`
+	IntervalSeconds  int          `json:"interval_seconds" binding:"required,min=1"`
+	DeleteExtraneous bool         `json:"delete_extraneous"`
+	Enabled          *bool        `json:"enabled"`
+}
+
+// UpdateMirrorRequest 为空的字段保持不变；Source整体替换，未提供密码时沿用原密码
+type UpdateMirrorRequest struct {
+	Name             *string       `json:"name" binding:"omitempty,max=255"`
+	Source           *MirrorSource `json:"source"`
+	IntervalSeconds  *int          `json:"interval_seconds" binding:"omitempty,min=1"`
+	DeleteExtraneous *bool         `json:"delete_extraneous"`
+	Enabled          *bool         `json:"enabled"`
+}
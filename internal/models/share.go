@@ -18,6 +18,9 @@ type FileShare struct {
 	DownloadCount int        `json:"download_count"`
 	Permissions   string     `json:"permissions"`
 	CreatedAt     time.Time  `json:"created_at"`
+	// DisabledAt 被过期清理任务停用的时间，停用后令牌不再可用
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
 }
 
 type CreateShareRequest struct {
@@ -27,14 +30,57 @@ type CreateShareRequest struct {
 	ExpiresIn    int    `json:"expires_in"` // hours
 	MaxDownloads *int   `json:"max_downloads"`
 	Permissions  string `json:"permissions"`
+	// UploadLimits permissions为write或drop时的上传限制，为空时使用share.upload配置
+	UploadLimits *ShareUploadLimits `json:"upload_limits,omitempty"`
+}
+
+// ShareUploadLimits 分享的匿名上传限制
+type ShareUploadLimits struct {
+	MaxFiles     *int   `json:"max_files,omitempty"`
+	MaxFileSize  *int64 `json:"max_file_size,omitempty"`
+	MaxTotalSize *int64 `json:"max_total_size,omitempty"`
+}
+
+// ShareUploadStatus 分享的上传限制及已接收的文件
+type ShareUploadStatus struct {
+	ShareUploadLimits
+	UploadCount int   `json:"upload_count"`
+	UploadBytes int64 `json:"upload_bytes"`
+}
+
+// ShareUploadedFile 一次匿名上传的结果
+type ShareUploadedFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
 }
 
 type CreateShareResponse struct {
 	ShareURL   string     `json:"share_url"`
 	ShareToken string     `json:"share_token"`
 	ExpiresAt  *time.Time `json:"expires_at"`
+	// ShortURL 启用share.short_links时的/s/短链接（绝对地址）
+	ShortURL string `json:"short_url,omitempty"`
 }
 
 type AccessShareRequest struct {
 	Password string `json:"password"`
 }
+
+// ShareEntry 文件夹分享中的一个条目，路径相对分享根目录
+type ShareEntry struct {
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	IsFolder     bool      `json:"is_folder"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ShareListing 文件夹分享中一个目录的内容
+type ShareListing struct {
+	Path    string       `json:"path"`
+	Entries []ShareEntry `json:"entries"`
+	// Truncated 条目数超出单次列表上限时只返回前面的部分
+	Truncated bool `json:"truncated,omitempty"`
+}
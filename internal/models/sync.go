@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	SyncVerdictUnchanged       = "unchanged"
+	SyncVerdictChangedOnServer = "changed-on-server"
+	SyncVerdictDeleted         = "deleted"
+	SyncVerdictConflict        = "conflict"
+	SyncVerdictNew             = "new"
+)
+
+type SyncEntry struct {
+	Path            string `json:"path" binding:"required"`
+	ETag            string `json:"etag"`             // last server etag known to the client
+	Hash            string `json:"hash"`             // hex MD5 of the local content
+	LocallyModified bool   `json:"locally_modified"` // client changed the file since last sync
+}
+
+type SyncCheckRequest struct {
+	Entries []SyncEntry `json:"entries" binding:"required,max=1000,dive"`
+}
+
+type SyncVerdict struct {
+	Path         string     `json:"path"`
+	Verdict      string     `json:"verdict"`
+	ETag         string     `json:"etag,omitempty"`
+	FileID       string     `json:"file_id,omitempty"`
+	Size         int64      `json:"size,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+type SyncCheckResponse struct {
+	Verdicts []SyncVerdict `json:"verdicts"`
+}
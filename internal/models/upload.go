@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 直接上传状态
+const (
+	DirectUploadStatusPending   = "pending"
+	DirectUploadStatusCompleted = "completed"
+	DirectUploadStatusCanceled  = "canceled"
+	DirectUploadStatusExpired   = "expired"
+	// DirectUploadStatusRejected 分段上传合并出的对象大小与声明不符，对象已被删除
+	DirectUploadStatusRejected = "rejected"
+)
+
+// DirectUpload 客户端通过预签名URL直接写入存储的上传。完成回调或后台轮询确认对象已写入后计入用量和变更日志
+type DirectUpload struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"-"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Status      string    `json:"status"`
+	// Parts 分段上传的分段数，单次PUT为0
+	Parts    int   `json:"parts,omitempty"`
+	PartSize int64 `json:"part_size,omitempty"`
+	// UploadID 存储中分段上传的ID，不返回给客户端
+	UploadID string `json:"-"`
+	// PreviousSize 创建时同名文件的大小，完成时只按差值计入用量
+	PreviousSize int64      `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+type PresignUploadRequest struct {
+	Path        string `json:"path" binding:"required"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+	ContentType string `json:"content_type"`
+}
+
+// PresignedUpload 预签名上传的结果。单次上传使用Request，分段上传按顺序使用Parts，
+// 每个分段PartSize字节（最后一个分段为余下的字节）；全部写入后调用完成接口
+type PresignedUpload struct {
+	Upload  *DirectUpload         `json:"upload"`
+	Request *PresignedRequest     `json:"request,omitempty"`
+	Parts   []PresignedUploadPart `json:"parts,omitempty"`
+}
+
+// PresignedRequest 预签名的请求，Headers中的请求头必须原样发送
+type PresignedRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers,omitempty"`
+}
+
+type PresignedUploadPart struct {
+	PartNumber int `json:"part_number"`
+	PresignedRequest
+}
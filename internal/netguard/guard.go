@@ -0,0 +1,123 @@
+// Package netguard 限制网关代替用户发起的出站请求（镜像上游、迁移源服务器），
+// 防止借助这些请求访问内网地址（SSRF）
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 错误定义
+var (
+	ErrInvalidURL     = Error("url must be an absolute http(s) URL")
+	ErrHostNotAllowed = Error("host is not allowed")
+	// ErrPrivateAddress 主机解析到内网、回环或链路本地地址
+	ErrPrivateAddress = Error("host resolves to a private address")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// sharedAddressSpace 运营商级NAT地址（RFC 6598），部分云平台的元数据服务位于其中
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Forbidden 判断地址是否不允许作为出站请求的目标：回环、私有、链路本地（包括169.254.169.254等云元数据地址）、
+// 未指定地址、组播和运营商级NAT地址
+func Forbidden(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// Guard 出站请求检查。配置了允许列表时只能访问列表中的主机，这些主机由管理员指定，可以位于内网；
+// 未配置时可以访问任意主机，但不能是内网地址。检查在建立连接时对实际连接的地址再做一次，
+// DNS重新绑定或重定向到内网地址的请求同样会被拒绝
+type Guard struct {
+	allowed map[string]bool
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// New 创建出站请求检查，allowedHosts为允许的主机名，为空时不限制主机但拒绝内网地址
+func New(allowedHosts []string) *Guard {
+	allowed := make(map[string]bool, len(allowedHosts))
+	for _, h := range allowedHosts {
+		allowed[strings.ToLower(h)] = true
+	}
+	return &Guard{allowed: allowed, lookup: net.DefaultResolver.LookupIPAddr}
+}
+
+// trusted 主机是否在允许列表中
+func (g *Guard) trusted(host string) bool {
+	return g.allowed[strings.ToLower(host)]
+}
+
+// CheckURL 校验用户提供的地址：必须是http(s)绝对地址，主机在允许列表中；
+// 未配置允许列表时解析主机名，任何一个地址是内网地址都会被拒绝
+func (g *Guard) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidURL
+	}
+	host := u.Hostname()
+	if len(g.allowed) > 0 {
+		if !g.trusted(host) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, strings.ToLower(host))
+		}
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if Forbidden(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+		return nil
+	}
+	addrs, err := g.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s", ErrInvalidURL, host)
+	}
+	for _, addr := range addrs {
+		if Forbidden(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+	}
+	return nil
+}
+
+// DialContext 建立连接，不在允许列表中的主机在连接前检查解析后的地址
+func (g *Guard) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if host, _, err := net.SplitHostPort(addr); err != nil || !g.trusted(host) {
+		dialer.Control = checkDialAddress
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// checkDialAddress 在套接字连接前检查实际连接的IP地址
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || Forbidden(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// Client 返回经过检查的HTTP客户端。不使用环境变量中的代理，否则连接检查只能看到代理地址
+func (g *Guard) Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = g.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,107 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestForbidden(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+		"127.0.0.1":       true,
+		"::1":             true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"100.100.100.200": true,
+		"224.0.0.1":       true,
+		"::ffff:10.0.0.1": true,
+	} {
+		if got := Forbidden(net.ParseIP(addr)); got != want {
+			t.Errorf("Forbidden(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// newTestGuard 使用固定解析结果的检查
+func newTestGuard(allowed []string, records map[string][]string) *Guard {
+	g := New(allowed)
+	g.lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := records[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		var addrs []net.IPAddr
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+	return g
+}
+
+func TestCheckURL(t *testing.T) {
+	records := map[string][]string{
+		"dav.example.com":      {"93.184.216.34"},
+		"internal.example.com": {"10.0.0.5"},
+		"mixed.example.com":    {"93.184.216.34", "127.0.0.1"},
+	}
+	tests := []struct {
+		name    string
+		allowed []string
+		url     string
+		wantErr error
+	}{
+		{"public host", nil, "https://dav.example.com/remote.php/dav/", nil},
+		{"public ip", nil, "http://93.184.216.34:8080/", nil},
+		{"not http", nil, "ftp://dav.example.com/", ErrInvalidURL},
+		{"relative", nil, "/dav/", ErrInvalidURL},
+		{"unresolvable", nil, "https://missing.example.com/", ErrInvalidURL},
+		{"loopback", nil, "http://127.0.0.1:9000/", ErrPrivateAddress},
+		{"ipv6 loopback", nil, "http://[::1]/", ErrPrivateAddress},
+		{"metadata", nil, "http://169.254.169.254/latest/meta-data/", ErrPrivateAddress},
+		{"resolves to private", nil, "https://internal.example.com/", ErrPrivateAddress},
+		{"any address private", nil, "https://mixed.example.com/", ErrPrivateAddress},
+		{"allowed host", []string{"DAV.example.com"}, "https://dav.example.com/", nil},
+		{"other host", []string{"dav.example.com"}, "https://evil.example.com/", ErrHostNotAllowed},
+		// 允许列表中的主机由管理员指定，可以位于内网
+		{"allowed internal host", []string{"internal.example.com"}, "https://internal.example.com/", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGuard(tt.allowed, records)
+			if err := g.CheckURL(context.Background(), tt.url); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckURL(%s) = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestClientDialCheck 连接时检查实际地址：通过校验后再解析到内网地址（DNS重新绑定）的请求被拒绝
+func TestClientDialCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	_, err := New(nil).Client(5 * time.Second).Get(srv.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get loopback = %v, want ErrPrivateAddress", err)
+	}
+
+	resp, err := New([]string{u.Hostname()}).Client(5 * time.Second).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get allowed host: %v", err)
+	}
+	resp.Body.Close()
+}
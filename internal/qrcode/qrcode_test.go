@@ -0,0 +1,119 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// ISO/IEC 18004附录I的示例：版本1-M编码"01234567"
+	data := []byte{0x10, 0x20, 0x0c, 0x56, 0x61, 0x80, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11}
+	want := []byte{0xa5, 0x24, 0xd4, 0xc1, 0xed, 0x36, 0xc7, 0x87, 0x2c, 0x55}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = % x, want % x", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	// 纠错等级M、掩码0的格式信息在异或掩码后为101010000010010
+	if got := formatBits(0); got != 0x5412 {
+		t.Errorf("formatBits(0) = %#x, want 0x5412", got)
+	}
+	if got := formatBits(5); got != 0x40ce {
+		t.Errorf("formatBits(5) = %#x, want 0x40ce", got)
+	}
+	if got := versionBits(7); got != 0x07c94 {
+		t.Errorf("versionBits(7) = %#x, want 0x07c94", got)
+	}
+	if got := versionBits(10); got != 0x0a4d3 {
+		t.Errorf("versionBits(10) = %#x, want 0x0a4d3", got)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// 纠错等级M字节模式各版本的容量
+	capacity := []int{0, 14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+	for v := 1; v <= maxVersion; v++ {
+		code, err := Encode(bytes.Repeat([]byte("a"), capacity[v]))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) error = %v", capacity[v], err)
+		}
+		if want := 17 + 4*v; code.Size() != want {
+			t.Errorf("Encode(%d bytes) size = %d, want %d", capacity[v], code.Size(), want)
+		}
+	}
+	if _, err := Encode(bytes.Repeat([]byte("a"), 214)); err != ErrTooLong {
+		t.Errorf("Encode(214 bytes) error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	code, err := Encode([]byte("https://dav.example.com/s/" + strings.Repeat("x", 40)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := code.Size()
+	// 三个定位图形的中心3x3为深色，分隔符为浅色
+	for _, corner := range [][2]int{{3, 3}, {n - 4, 3}, {3, n - 4}} {
+		for d := -1; d <= 1; d++ {
+			if !code.Dark(corner[0]+d, corner[1]) || !code.Dark(corner[0], corner[1]+d) {
+				t.Errorf("finder at %v not dark in center", corner)
+			}
+		}
+	}
+	if code.Dark(7, 0) || code.Dark(n-8, 0) || code.Dark(0, n-8) {
+		t.Error("finder separator should be light")
+	}
+	// 定时图形深浅交替
+	for i := 8; i < n-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+	if !code.Dark(8, n-8) {
+		t.Error("dark module missing")
+	}
+	// 两份格式信息一致
+	for i := 0; i < 8; i++ {
+		var first bool
+		switch {
+		case i <= 5:
+			first = code.Dark(8, i)
+		case i == 6:
+			first = code.Dark(8, 7)
+		default:
+			first = code.Dark(8, 8)
+		}
+		if first != code.Dark(n-1-i, 8) {
+			t.Errorf("format bit %d differs between copies", i)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("https://dav.example.com/s/abc1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (code.Size() + 2*quietZone) * 4; img.Bounds().Dx() != want || img.Bounds().Dy() != want {
+		t.Errorf("image size = %v, want %dx%d", img.Bounds(), want, want)
+	}
+	r, _, _, _ := img.At(0, 0).RGBA()
+	if r != 0xffff {
+		t.Error("quiet zone should be white")
+	}
+	r, _, _, _ = img.At(quietZone*4, quietZone*4).RGBA()
+	if r != 0 {
+		t.Error("finder corner should be black")
+	}
+}
@@ -0,0 +1,335 @@
+// Package quota 检查并修正用户存储用量计数与实际存储之间的偏差
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// ErrRunning 已有一次检查正在运行
+var ErrRunning = errors.New("quota reconciliation is already running")
+
+// ObjectWalker 遍历用户的对象，由storage.Service实现
+type ObjectWalker interface {
+	WalkObjects(ctx context.Context, userID uuid.UUID, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error
+}
+
+// Discrepancy 一个用户的用量偏差
+type Discrepancy struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	// Recorded 数据库中记录的用量
+	Recorded int64 `json:"recorded"`
+	// Actual 按存储中的对象计算的用量
+	Actual int64 `json:"actual"`
+	// Drift Recorded-Actual，正数表示多计
+	Drift    int64 `json:"drift"`
+	Repaired bool  `json:"repaired"`
+	// Skipped 检查期间用量发生了变化（有并发上传或删除），留待下次检查
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Report 一次检查的结果
+type Report struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Users         int           `json:"users"`
+	Repaired      int           `json:"repaired"`
+	Failed        int           `json:"failed"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reconciler 定期按存储中的对象重新计算每个用户的用量，与users.storage_used比较并修正偏差
+type Reconciler struct {
+	db      *sql.DB
+	storage ObjectWalker
+	config  config.QuotaReconcileConfig
+	// exempt 判断对象是否不计入用量（如隐藏的Finder元数据文件）
+	exempt func(key string) bool
+	// contentKey 返回对象内容的标识，标识相同的对象只计一次（按内容去重的unique配额策略）
+	contentKey func(object minio.ObjectInfo) string
+
+	running  sync.Mutex
+	mu       sync.Mutex
+	last     *Report
+	runs     uint64
+	repaired uint64
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReconciler 创建配额一致性检查器
+func NewReconciler(db *sql.DB, storage ObjectWalker, cfg config.QuotaReconcileConfig) *Reconciler {
+	return &Reconciler{
+		db:      db,
+		storage: storage,
+		config:  cfg,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetExempt 设置不计入用量的对象，需在Start之前调用
+func (r *Reconciler) SetExempt(exempt func(key string) bool) {
+	r.exempt = exempt
+}
+
+// SetContentKey 设置对象内容的标识，同一用户标识相同的对象只计入一次用量，需在Start之前调用。
+// 返回空字符串的对象照常计入
+func (r *Reconciler) SetContentKey(contentKey func(object minio.ObjectInfo) string) {
+	r.contentKey = contentKey
+}
+
+// Start 启动定期检查，interval不大于0时不启动
+func (r *Reconciler) Start() {
+	if r.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// 上一次（或手动触发的）检查尚未结束时跳过本次
+				if report, err := r.Run(context.Background()); !errors.Is(err, ErrRunning) {
+					r.logReport(report, err)
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定期检查
+func (r *Reconciler) Stop() {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+}
+
+// Trigger 在后台立即运行一次检查，已有检查正在运行时返回ErrRunning
+func (r *Reconciler) Trigger() error {
+	if !r.running.TryLock() {
+		return ErrRunning
+	}
+	go func() {
+		defer r.running.Unlock()
+		r.logReport(r.reconcile(context.Background()))
+	}()
+	return nil
+}
+
+// Running 判断是否有检查正在运行
+func (r *Reconciler) Running() bool {
+	if r.running.TryLock() {
+		r.running.Unlock()
+		return false
+	}
+	return true
+}
+
+// LastReport 返回最近一次完成的检查结果，尚未运行过时返回nil
+func (r *Reconciler) LastReport() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (r *Reconciler) logReport(report *Report, err error) {
+	if err != nil {
+		log.Printf("Warning: quota reconciliation failed: %v", err)
+		return
+	}
+	if len(report.Discrepancies) > 0 || report.Failed > 0 {
+		log.Printf("Quota reconciliation checked %d users: %d discrepancies, %d repaired, %d failed",
+			report.Users, len(report.Discrepancies), report.Repaired, report.Failed)
+	}
+}
+
+// Run 立即执行一次检查并返回结果，已有检查正在运行时返回ErrRunning
+func (r *Reconciler) Run(ctx context.Context) (*Report, error) {
+	if !r.running.TryLock() {
+		return nil, ErrRunning
+	}
+	defer r.running.Unlock()
+	return r.reconcile(ctx)
+}
+
+type userUsage struct {
+	id       uuid.UUID
+	username string
+	recorded int64
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) (*Report, error) {
+	report := &Report{StartedAt: time.Now(), Discrepancies: []Discrepancy{}}
+
+	users, err := r.listUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		report.Users++
+		d, err := r.checkUser(ctx, user)
+		if err != nil {
+			log.Printf("Warning: quota reconciliation of user %s failed: %v", user.id, err)
+			report.Failed++
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		if d.Repaired {
+			report.Repaired++
+		}
+		report.Discrepancies = append(report.Discrepancies, *d)
+	}
+	report.FinishedAt = time.Now()
+
+	r.mu.Lock()
+	r.last = report
+	r.runs++
+	r.repaired += uint64(report.Repaired)
+	r.mu.Unlock()
+	return report, nil
+}
+
+func (r *Reconciler) listUsers(ctx context.Context) ([]userUsage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, username
+		FROM users WHERE status <> 'deleted'
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []userUsage
+	for rows.Next() {
+		var user userUsage
+		if err := rows.Scan(&user.id, &user.username); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// checkUser 计算一个用户的实际用量，没有超出容差的偏差时返回nil
+func (r *Reconciler) checkUser(ctx context.Context, user userUsage) (*Discrepancy, error) {
+	// 遍历前读取计数，修复时要求计数仍是该值，遍历期间有上传或删除时跳过
+	if err := r.db.QueryRowContext(ctx, `SELECT COALESCE(storage_used, 0) FROM users WHERE id = $1`,
+		user.id).Scan(&user.recorded); err != nil {
+		return nil, err
+	}
+
+	var actual int64
+	counted := make(map[string]bool)
+	err := r.storage.WalkObjects(ctx, user.id, "", true, func(object minio.ObjectInfo) error {
+		if strings.HasSuffix(object.Key, "/") || (r.exempt != nil && r.exempt(object.Key)) {
+			return nil
+		}
+		if r.contentKey != nil {
+			if key := r.contentKey(object); key != "" {
+				if counted[key] {
+					return nil
+				}
+				counted[key] = true
+			}
+		}
+		actual += object.Size
+		return nil
+	})
+	if err != nil {
+		// 存储桶尚未创建（用户从未上传过）时用量为0
+		if !storage.IsNotFound(err) {
+			return nil, err
+		}
+		actual = 0
+	}
+
+	drift := user.recorded - actual
+	if drift <= r.config.Tolerance && -drift <= r.config.Tolerance {
+		return nil, nil
+	}
+
+	d := &Discrepancy{
+		UserID:   user.id,
+		Username: user.username,
+		Recorded: user.recorded,
+		Actual:   actual,
+		Drift:    drift,
+	}
+	if !r.config.Repair {
+		return d, nil
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users SET storage_used = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND COALESCE(storage_used, 0) = $3`,
+		actual, user.id, user.recorded)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		d.Skipped = true
+	} else {
+		d.Repaired = true
+	}
+	return d, nil
+}
+
+// WriteMetrics 以Prometheus文本格式输出最近一次检查的结果
+func (r *Reconciler) WriteMetrics(w io.Writer) error {
+	r.mu.Lock()
+	last, runs, repaired := r.last, r.runs, r.repaired
+	r.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP webdav_quota_reconcile_runs_total Completed quota reconciliation runs.\n")
+	b.WriteString("# TYPE webdav_quota_reconcile_runs_total counter\n")
+	fmt.Fprintf(&b, "webdav_quota_reconcile_runs_total %d\n", runs)
+	b.WriteString("# HELP webdav_quota_reconcile_repaired_total Users whose storage usage counter was repaired.\n")
+	b.WriteString("# TYPE webdav_quota_reconcile_repaired_total counter\n")
+	fmt.Fprintf(&b, "webdav_quota_reconcile_repaired_total %d\n", repaired)
+
+	if last != nil {
+		var over, under int64
+		for _, d := range last.Discrepancies {
+			if d.Drift > 0 {
+				over += d.Drift
+			} else {
+				under -= d.Drift
+			}
+		}
+		b.WriteString("# HELP webdav_quota_reconcile_last_run_timestamp_seconds Finish time of the last quota reconciliation.\n")
+		b.WriteString("# TYPE webdav_quota_reconcile_last_run_timestamp_seconds gauge\n")
+		fmt.Fprintf(&b, "webdav_quota_reconcile_last_run_timestamp_seconds %d\n", last.FinishedAt.Unix())
+		b.WriteString("# HELP webdav_quota_discrepancy_users Users whose recorded usage differed from storage in the last run.\n")
+		b.WriteString("# TYPE webdav_quota_discrepancy_users gauge\n")
+		fmt.Fprintf(&b, "webdav_quota_discrepancy_users %d\n", len(last.Discrepancies))
+		b.WriteString("# HELP webdav_quota_drift_bytes Total drift found in the last run, by direction.\n")
+		b.WriteString("# TYPE webdav_quota_drift_bytes gauge\n")
+		fmt.Fprintf(&b, "webdav_quota_drift_bytes{direction=\"over\"} %d\n", over)
+		fmt.Fprintf(&b, "webdav_quota_drift_bytes{direction=\"under\"} %d\n", under)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
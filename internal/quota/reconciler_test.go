@@ -0,0 +1,219 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// fakeWalker 按用户返回固定的对象列表，onWalk在遍历时调用以模拟并发写入。
+// 非递归遍历只返回目录下直接的对象，不返回子目录前缀
+type fakeWalker struct {
+	objects map[uuid.UUID][]minio.ObjectInfo
+	onWalk  func(userID uuid.UUID)
+}
+
+func (w *fakeWalker) WalkObjects(ctx context.Context, userID uuid.UUID, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	if w.onWalk != nil {
+		w.onWalk(userID)
+	}
+	objects, ok := w.objects[userID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	for _, object := range objects {
+		rest, ok := strings.CutPrefix(object.Key, prefix)
+		if !ok || rest == "" || (!recursive && strings.Contains(rest, "/")) {
+			continue
+		}
+		if err := fn(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		storage_used BIGINT DEFAULT 0,
+		status TEXT DEFAULT 'active',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func addUser(t *testing.T, db *sql.DB, name string, used int64) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, username, storage_used) VALUES ($1, $2, $3)`, id.String(), name, used); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func storageUsed(t *testing.T, db *sql.DB, id uuid.UUID) int64 {
+	t.Helper()
+	var used int64
+	if err := db.QueryRow(`SELECT storage_used FROM users WHERE id = $1`, id.String()).Scan(&used); err != nil {
+		t.Fatal(err)
+	}
+	return used
+}
+
+func TestReconcilerRepairsDrift(t *testing.T) {
+	db := openTestDB(t)
+	exact := addUser(t, db, "exact", 150)
+	over := addUser(t, db, "over", 500)
+	under := addUser(t, db, "under", 10)
+	empty := addUser(t, db, "empty", 42)
+
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{
+		exact: {{Key: "docs/", Size: 0}, {Key: "docs/a.txt", Size: 100}, {Key: "b.txt", Size: 50}},
+		over:  {{Key: "a.txt", Size: 200}},
+		under: {{Key: "a.txt", Size: 30}},
+	}}
+	r := NewReconciler(db, walker, config.QuotaReconcileConfig{Repair: true})
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 4 || report.Repaired != 3 || len(report.Discrepancies) != 3 {
+		t.Fatalf("report = %+v, want 4 users with 3 repaired discrepancies", report)
+	}
+	for id, want := range map[uuid.UUID]int64{exact: 150, over: 200, under: 30, empty: 0} {
+		if got := storageUsed(t, db, id); got != want {
+			t.Errorf("storage_used of %s = %d, want %d", id, got, want)
+		}
+	}
+	for _, d := range report.Discrepancies {
+		if d.UserID == over && d.Drift != 300 {
+			t.Errorf("over-counted user drift = %d, want 300", d.Drift)
+		}
+	}
+
+	if report, _ := r.Run(context.Background()); len(report.Discrepancies) != 0 {
+		t.Errorf("second run found %d discrepancies, want none", len(report.Discrepancies))
+	}
+}
+
+func TestReconcilerReportOnlyAndTolerance(t *testing.T) {
+	db := openTestDB(t)
+	small := addUser(t, db, "small", 105)
+	large := addUser(t, db, "large", 1000)
+
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{
+		small: {{Key: "a.txt", Size: 100}},
+		large: {{Key: "a.txt", Size: 100}},
+	}}
+	r := NewReconciler(db, walker, config.QuotaReconcileConfig{Repair: false, Tolerance: 10})
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].UserID != large || report.Discrepancies[0].Repaired {
+		t.Fatalf("discrepancies = %+v, want only the unrepaired large drift", report.Discrepancies)
+	}
+	if got := storageUsed(t, db, large); got != 1000 {
+		t.Errorf("report-only run changed storage_used to %d", got)
+	}
+}
+
+func TestReconcilerSkipsConcurrentChanges(t *testing.T) {
+	db := openTestDB(t)
+	busy := addUser(t, db, "busy", 0)
+
+	// 遍历期间完成了一次上传，计数已变化，不能用遍历结果覆盖
+	walker := &fakeWalker{
+		objects: map[uuid.UUID][]minio.ObjectInfo{busy: {{Key: "a.txt", Size: 100}}},
+		onWalk: func(userID uuid.UUID) {
+			db.Exec(`UPDATE users SET storage_used = storage_used + 100 WHERE id = $1`, userID.String())
+		},
+	}
+	r := NewReconciler(db, walker, config.QuotaReconcileConfig{Repair: true})
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 1 || !report.Discrepancies[0].Skipped || report.Repaired != 0 {
+		t.Fatalf("discrepancies = %+v, want one skipped", report.Discrepancies)
+	}
+	if got := storageUsed(t, db, busy); got != 100 {
+		t.Errorf("storage_used = %d, want the concurrent update kept", got)
+	}
+}
+
+func TestReconcilerSkipsExemptObjects(t *testing.T) {
+	db := openTestDB(t)
+	user := addUser(t, db, "finder", 100)
+
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{
+		user: {{Key: "a.txt", Size: 100}, {Key: "._a.txt", Size: 4096}, {Key: "docs/.DS_Store", Size: 6148}},
+	}}
+	r := NewReconciler(db, walker, config.QuotaReconcileConfig{Repair: true})
+	r.SetExempt(func(key string) bool {
+		return key == "._a.txt" || key == "docs/.DS_Store"
+	})
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("discrepancies = %+v, want exempt objects ignored", report.Discrepancies)
+	}
+}
+
+func TestReconcilerCountsSharedContentOnce(t *testing.T) {
+	db := openTestDB(t)
+	user := addUser(t, db, "photos", 300)
+
+	hash := func(h string) map[string]string { return map[string]string{storage.MetaContentSHA256: h} }
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{
+		user: {
+			{Key: "a.jpg", Size: 100, UserMetadata: hash("aa")},
+			{Key: "backup/a.jpg", Size: 100, UserMetadata: hash("aa")},
+			{Key: "b.jpg", Size: 100, UserMetadata: hash("bb")},
+			{Key: "notes.txt", Size: 10},
+		},
+	}}
+	r := NewReconciler(db, walker, config.QuotaReconcileConfig{Repair: true})
+	r.SetContentKey(storage.BlobHash)
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Actual != 210 {
+		t.Fatalf("discrepancies = %+v, want the copy of a.jpg counted once", report.Discrepancies)
+	}
+	if got := storageUsed(t, db, user); got != 210 {
+		t.Errorf("storage_used = %d, want 210", got)
+	}
+}
@@ -0,0 +1,565 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// ErrUsagePending 用户的用量尚未完成首次统计
+var ErrUsagePending = errors.New("storage usage is being computed")
+
+// rootFolder 根目录下的文件在统计表中的目录名
+const rootFolder = ""
+
+// UsageFile 大文件
+type UsageFile struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// UsageTotals 字节数和文件数
+type UsageTotals struct {
+	Size  int64 `json:"size"`
+	Files int64 `json:"files"`
+}
+
+// FolderUsage 一个顶层目录的用量
+type FolderUsage struct {
+	Name string `json:"name"`
+	UsageTotals
+}
+
+// Usage 一个用户的用量明细
+type Usage struct {
+	// Used/Quota 用户表中记录的用量计数和配额
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+	// Total 统计得到的用量，包含回收站
+	Total int64 `json:"total"`
+	Files int64 `json:"files"`
+	// Folders 顶层目录，按大小降序，不含回收站
+	Folders []FolderUsage `json:"folders"`
+	// RootFiles 直接位于根目录下的文件
+	RootFiles    UsageTotals      `json:"root_files"`
+	Trash        UsageTotals      `json:"trash"`
+	Categories   map[string]int64 `json:"categories"`
+	LargestFiles []UsageFile      `json:"largest_files"`
+	// ComputedAt 最早一次统计的时间，明细反映的是该时间之后的状态
+	ComputedAt time.Time `json:"computed_at"`
+	// Pending 有改动尚未重新统计
+	Pending bool `json:"pending"`
+}
+
+// folderStats 一个顶层目录的统计结果，categories和largest以JSON保存
+type folderStats struct {
+	size       int64
+	files      int64
+	categories map[string]int64
+	largest    []UsageFile
+}
+
+// add 计入一个文件，只保留最大的limit个文件
+func (f *folderStats) add(file UsageFile, limit int) {
+	f.size += file.Size
+	f.files++
+	if f.categories == nil {
+		f.categories = make(map[string]int64)
+	}
+	f.categories[contenttype.Category(file.Path)] += file.Size
+	f.largest = appendLargest(f.largest, limit, file)
+}
+
+// appendLargest 按大小降序插入，超出limit时丢弃最小的
+func appendLargest(largest []UsageFile, limit int, files ...UsageFile) []UsageFile {
+	for _, file := range files {
+		if limit <= 0 || (len(largest) >= limit && file.Size <= largest[len(largest)-1].Size) {
+			continue
+		}
+		i := sort.Search(len(largest), func(i int) bool { return largest[i].Size < file.Size })
+		largest = append(largest, UsageFile{})
+		copy(largest[i+1:], largest[i:])
+		largest[i] = file
+		if len(largest) > limit {
+			largest = largest[:limit]
+		}
+	}
+	return largest
+}
+
+// topFolder 返回路径所在的顶层目录，根目录下的条目返回其自身名称
+func topFolder(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if i := strings.Index(p, "/"); i >= 0 {
+		return p[:i]
+	}
+	return p
+}
+
+// UsageAggregator 按顶层目录增量统计用户用量：WebDAV修改只把涉及的顶层目录标记为待统计，
+// 后台任务定期重新遍历这些目录，查询时直接汇总统计表，不遍历存储
+type UsageAggregator struct {
+	db      *sql.DB
+	storage ObjectWalker
+	config  config.UsageConfig
+	// exempt 判断对象是否不计入用量，与Reconciler一致
+	exempt func(key string) bool
+	trash  map[string]bool
+	now    func() time.Time
+
+	initOnce  sync.Once
+	initError error
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewUsageAggregator 创建用量明细统计
+func NewUsageAggregator(db *sql.DB, storage ObjectWalker, cfg config.UsageConfig) *UsageAggregator {
+	trash := make(map[string]bool, len(cfg.TrashFolders))
+	for _, name := range cfg.TrashFolders {
+		trash[strings.ToLower(strings.Trim(name, "/"))] = true
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &UsageAggregator{
+		db:      db,
+		storage: storage,
+		config:  cfg,
+		trash:   trash,
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetExempt 设置不计入用量的对象，需在Start之前调用
+func (a *UsageAggregator) SetExempt(exempt func(key string) bool) {
+	a.exempt = exempt
+}
+
+// Initialize 创建统计表，多次调用只执行一次
+func (a *UsageAggregator) Initialize(ctx context.Context) error {
+	a.initOnce.Do(func() {
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS usage_users (
+				user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				requested_at TIMESTAMP NOT NULL,
+				scanned_at TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS usage_folders (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				folder TEXT NOT NULL,
+				size BIGINT NOT NULL DEFAULT 0,
+				files BIGINT NOT NULL DEFAULT 0,
+				categories JSONB,
+				largest JSONB,
+				dirty BOOLEAN NOT NULL DEFAULT TRUE,
+				generation BIGINT NOT NULL DEFAULT 0,
+				computed_at TIMESTAMP,
+				PRIMARY KEY (user_id, folder)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_usage_folders_dirty ON usage_folders(user_id) WHERE dirty`,
+		}
+		for _, query := range queries {
+			if _, err := a.db.ExecContext(ctx, query); err != nil {
+				a.initError = fmt.Errorf("初始化用量统计表失败: %v", err)
+				return
+			}
+		}
+	})
+	return a.initError
+}
+
+// Start 启动后台统计
+func (a *UsageAggregator) Start() {
+	if a.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Refresh(context.Background()); err != nil {
+					log.Printf("Warning: storage usage aggregation failed: %v", err)
+				}
+			case <-a.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台统计
+func (a *UsageAggregator) Stop() {
+	a.stopOnce.Do(func() { close(a.stopCh) })
+}
+
+// MarkChanged 把路径所在的顶层目录标记为待统计，尚未统计过的用户忽略。
+// 根目录下的条目可能是文件也可能是目录，两者都标记
+func (a *UsageAggregator) MarkChanged(ctx context.Context, userID uuid.UUID, paths ...string) error {
+	if err := a.Initialize(ctx); err != nil {
+		return err
+	}
+
+	folders := make(map[string]bool)
+	for _, p := range paths {
+		folder := topFolder(p)
+		folders[folder] = true
+		if strings.Trim(path.Clean("/"+p), "/") == folder {
+			folders[rootFolder] = true
+		}
+	}
+	for folder := range folders {
+		_, err := a.db.ExecContext(ctx, `
+			INSERT INTO usage_folders (user_id, folder, dirty, generation)
+			SELECT $1, $2, TRUE, 1 WHERE EXISTS (SELECT 1 FROM usage_users WHERE user_id = $1)
+			ON CONFLICT (user_id, folder) DO UPDATE SET dirty = TRUE, generation = usage_folders.generation + 1`,
+			userID, folder)
+		if err != nil {
+			return fmt.Errorf("标记用量待统计失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Get 汇总用户的用量明细。首次查询时登记用户并返回ErrUsagePending，由后台任务完成首次遍历
+func (a *UsageAggregator) Get(ctx context.Context, userID uuid.UUID) (*Usage, error) {
+	if err := a.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	var scannedAt sql.NullTime
+	err := a.db.QueryRowContext(ctx, `SELECT scanned_at FROM usage_users WHERE user_id = $1`, userID).Scan(&scannedAt)
+	if err == sql.ErrNoRows {
+		_, err = a.db.ExecContext(ctx, `
+			INSERT INTO usage_users (user_id, requested_at) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO NOTHING`,
+			userID, a.now().UTC())
+		if err != nil {
+			return nil, fmt.Errorf("登记用量统计失败: %v", err)
+		}
+		return nil, ErrUsagePending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询用量统计失败: %v", err)
+	}
+	if !scannedAt.Valid {
+		return nil, ErrUsagePending
+	}
+
+	usage := &Usage{
+		Folders:      []FolderUsage{},
+		Categories:   make(map[string]int64),
+		LargestFiles: []UsageFile{},
+		ComputedAt:   scannedAt.Time,
+	}
+	if err := a.db.QueryRowContext(ctx, `
+		SELECT COALESCE(storage_used, 0), COALESCE(storage_quota, 0) FROM users WHERE id = $1`,
+		userID).Scan(&usage.Used, &usage.Quota); err != nil {
+		return nil, fmt.Errorf("查询用户用量失败: %v", err)
+	}
+
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT folder, size, files, categories, largest, dirty, computed_at
+		FROM usage_folders WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量统计失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var folder string
+		var totals UsageTotals
+		var categoriesJSON, largestJSON []byte
+		var dirty bool
+		var computedAt sql.NullTime
+		if err := rows.Scan(&folder, &totals.Size, &totals.Files, &categoriesJSON, &largestJSON, &dirty, &computedAt); err != nil {
+			return nil, fmt.Errorf("读取用量统计失败: %v", err)
+		}
+		usage.Pending = usage.Pending || dirty
+		if computedAt.Valid && computedAt.Time.Before(usage.ComputedAt) {
+			usage.ComputedAt = computedAt.Time
+		}
+
+		var categories map[string]int64
+		var largest []UsageFile
+		if len(categoriesJSON) > 0 {
+			if err := json.Unmarshal(categoriesJSON, &categories); err != nil {
+				return nil, fmt.Errorf("解析用量统计失败: %v", err)
+			}
+		}
+		if len(largestJSON) > 0 {
+			if err := json.Unmarshal(largestJSON, &largest); err != nil {
+				return nil, fmt.Errorf("解析用量统计失败: %v", err)
+			}
+		}
+
+		usage.Total += totals.Size
+		usage.Files += totals.Files
+		for category, size := range categories {
+			usage.Categories[category] += size
+		}
+		usage.LargestFiles = appendLargest(usage.LargestFiles, a.config.LargestFiles, largest...)
+
+		switch {
+		case folder == rootFolder:
+			usage.RootFiles = totals
+		case a.trash[strings.ToLower(folder)]:
+			usage.Trash.Size += totals.Size
+			usage.Trash.Files += totals.Files
+		case totals.Files > 0:
+			usage.Folders = append(usage.Folders, FolderUsage{Name: folder, UsageTotals: totals})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取用量统计失败: %v", err)
+	}
+
+	sort.Slice(usage.Folders, func(i, j int) bool {
+		if usage.Folders[i].Size != usage.Folders[j].Size {
+			return usage.Folders[i].Size > usage.Folders[j].Size
+		}
+		return usage.Folders[i].Name < usage.Folders[j].Name
+	})
+	return usage, nil
+}
+
+// Refresh 执行一轮统计：完整遍历首次查询或到期重扫的用户，再重新统计有改动的目录
+func (a *UsageAggregator) Refresh(ctx context.Context) error {
+	if err := a.Initialize(ctx); err != nil {
+		return err
+	}
+
+	users, err := a.usersToScan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, userID := range users {
+		if err := a.scanUser(ctx, userID); err != nil {
+			log.Printf("Warning: storage usage scan of user %s failed: %v", userID, err)
+		}
+	}
+
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT user_id, folder, generation FROM usage_folders
+		WHERE dirty ORDER BY user_id, folder LIMIT $1`, a.config.BatchSize)
+	if err != nil {
+		return fmt.Errorf("查询待统计目录失败: %v", err)
+	}
+	type dirtyFolder struct {
+		userID     uuid.UUID
+		folder     string
+		generation int64
+	}
+	var dirty []dirtyFolder
+	for rows.Next() {
+		var d dirtyFolder
+		if err := rows.Scan(&d.userID, &d.folder, &d.generation); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取待统计目录失败: %v", err)
+		}
+		dirty = append(dirty, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取待统计目录失败: %v", err)
+	}
+
+	for _, d := range dirty {
+		stats, err := a.walkFolder(ctx, d.userID, d.folder)
+		if err != nil {
+			log.Printf("Warning: storage usage of %s in user %s failed: %v", d.folder, d.userID, err)
+			continue
+		}
+		if err := a.saveFolder(ctx, a.db, d.userID, d.folder, stats, d.generation); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return nil
+}
+
+// usersToScan 返回需要完整遍历的用户：首次查询的用户优先，其次是超过rescan间隔的用户
+func (a *UsageAggregator) usersToScan(ctx context.Context) ([]uuid.UUID, error) {
+	// 不定期重扫时截止时间取零值，只选出从未遍历过的用户
+	var rescanBefore time.Time
+	if a.config.Rescan > 0 {
+		rescanBefore = a.now().UTC().Add(-a.config.Rescan)
+	}
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT user_id FROM usage_users WHERE scanned_at IS NULL OR scanned_at < $1
+		ORDER BY scanned_at NULLS FIRST, requested_at LIMIT $2`,
+		rescanBefore, a.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("查询待遍历用户失败: %v", err)
+	}
+	defer rows.Close()
+
+	var users []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("读取待遍历用户失败: %v", err)
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+// counted 判断对象是否计入用量
+func (a *UsageAggregator) counted(object minio.ObjectInfo) bool {
+	return !strings.HasSuffix(object.Key, "/") && (a.exempt == nil || !a.exempt(object.Key))
+}
+
+// fileOf 把对象转换为统计中的文件
+func fileOf(object minio.ObjectInfo) UsageFile {
+	return UsageFile{Path: "/" + object.Key, Size: object.Size, LastModified: object.LastModified}
+}
+
+// walkFolder 遍历一个顶层目录，rootFolder只统计根目录下的文件
+func (a *UsageAggregator) walkFolder(ctx context.Context, userID uuid.UUID, folder string) (*folderStats, error) {
+	stats := &folderStats{}
+	err := a.storage.WalkObjects(ctx, userID, folder, folder != rootFolder, func(object minio.ObjectInfo) error {
+		if a.counted(object) {
+			stats.add(fileOf(object), a.config.LargestFiles)
+		}
+		return nil
+	})
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// scanUser 完整遍历用户的全部对象，重建所有目录的统计
+func (a *UsageAggregator) scanUser(ctx context.Context, userID uuid.UUID) error {
+	// 遍历前记录各目录的版本，遍历期间被标记的目录保持待统计
+	generations := make(map[string]int64)
+	rows, err := a.db.QueryContext(ctx, `SELECT folder, generation FROM usage_folders WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("查询用量统计失败: %v", err)
+	}
+	for rows.Next() {
+		var folder string
+		var generation int64
+		if err := rows.Scan(&folder, &generation); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取用量统计失败: %v", err)
+		}
+		generations[folder] = generation
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取用量统计失败: %v", err)
+	}
+
+	folders := make(map[string]*folderStats)
+	err = a.storage.WalkObjects(ctx, userID, "", true, func(object minio.ObjectInfo) error {
+		if !a.counted(object) {
+			return nil
+		}
+		folder := rootFolder
+		if i := strings.Index(object.Key, "/"); i >= 0 {
+			folder = object.Key[:i]
+		}
+		if folders[folder] == nil {
+			folders[folder] = &folderStats{}
+		}
+		folders[folder].add(fileOf(object), a.config.LargestFiles)
+		return nil
+	})
+	if err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	for folder, stats := range folders {
+		generation, known := generations[folder]
+		if !known {
+			// 遍历开始时没有记录：遍历期间新标记的行版本从1开始，不会被误清除标记
+			generation = 0
+		}
+		if err := a.saveFolder(ctx, tx, userID, folder, stats, generation); err != nil {
+			return err
+		}
+	}
+	// 存储中已不存在的目录
+	for folder, generation := range generations {
+		if folders[folder] != nil {
+			continue
+		}
+		if err := a.saveFolder(ctx, tx, userID, folder, &folderStats{}, generation); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE usage_users SET scanned_at = $1 WHERE user_id = $2`,
+		a.now().UTC(), userID); err != nil {
+		return fmt.Errorf("更新用量统计时间失败: %v", err)
+	}
+	return tx.Commit()
+}
+
+// execer 由*sql.DB和*sql.Tx实现
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveFolder 保存目录的统计。统计期间目录再次被标记（版本变化）时保存结果但保持待统计；
+// 目录已没有文件时删除该行
+func (a *UsageAggregator) saveFolder(ctx context.Context, db execer, userID uuid.UUID, folder string, stats *folderStats, generation int64) error {
+	if stats.files == 0 {
+		if _, err := db.ExecContext(ctx, `
+			DELETE FROM usage_folders WHERE user_id = $1 AND folder = $2 AND generation = $3`,
+			userID, folder, generation); err != nil {
+			return fmt.Errorf("删除用量统计失败: %v", err)
+		}
+		return nil
+	}
+
+	categories, err := json.Marshal(stats.categories)
+	if err != nil {
+		return err
+	}
+	largest, err := json.Marshal(stats.largest)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO usage_folders (user_id, folder, size, files, categories, largest, dirty, generation, computed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, FALSE, $7, $8)
+		ON CONFLICT (user_id, folder) DO UPDATE SET
+			size = EXCLUDED.size, files = EXCLUDED.files,
+			categories = EXCLUDED.categories, largest = EXCLUDED.largest,
+			dirty = usage_folders.generation <> EXCLUDED.generation,
+			computed_at = EXCLUDED.computed_at`,
+		userID, folder, stats.size, stats.files, string(categories), string(largest), generation, a.now().UTC())
+	if err != nil {
+		return fmt.Errorf("保存用量统计失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func newTestAggregator(t *testing.T, walker *fakeWalker) (*UsageAggregator, *sql.DB) {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := db.Exec(`ALTER TABLE users ADD COLUMN storage_quota BIGINT DEFAULT 1000000`); err != nil {
+		t.Fatal(err)
+	}
+	a := NewUsageAggregator(db, walker, config.UsageConfig{
+		Enabled:      true,
+		Interval:     time.Minute,
+		LargestFiles: 2,
+		TrashFolders: []string{".Trash"},
+	})
+	if err := a.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return a, db
+}
+
+func TestUsageAggregatorBreakdown(t *testing.T) {
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{}}
+	a, db := newTestAggregator(t, walker)
+	user := addUser(t, db, "alice", 0)
+	walker.objects[user] = []minio.ObjectInfo{
+		{Key: "Photos/", Size: 0},
+		{Key: "Photos/2023/beach.jpg", Size: 300},
+		{Key: "Photos/clip.mov", Size: 900},
+		{Key: "Documents/report.pdf", Size: 200},
+		{Key: ".Trash/old.zip", Size: 500},
+		{Key: "notes.txt", Size: 10},
+		{Key: "._notes.txt", Size: 4096},
+	}
+	a.SetExempt(func(key string) bool { return key == "._notes.txt" })
+	ctx := context.Background()
+
+	// 首次查询只登记，由后台任务完成遍历
+	if _, err := a.Get(ctx, user); !errors.Is(err, ErrUsagePending) {
+		t.Fatalf("first Get: err = %v, want ErrUsagePending", err)
+	}
+	if err := a.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := a.Get(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 1910 || usage.Files != 5 || usage.Pending {
+		t.Errorf("total = %d files = %d pending = %v, want 1910, 5, false", usage.Total, usage.Files, usage.Pending)
+	}
+	if len(usage.Folders) != 2 || usage.Folders[0].Name != "Photos" || usage.Folders[0].Size != 1200 ||
+		usage.Folders[1].Name != "Documents" || usage.Folders[1].Size != 200 {
+		t.Errorf("folders = %+v", usage.Folders)
+	}
+	if usage.RootFiles != (UsageTotals{Size: 10, Files: 1}) || usage.Trash != (UsageTotals{Size: 500, Files: 1}) {
+		t.Errorf("root files = %+v trash = %+v", usage.RootFiles, usage.Trash)
+	}
+	wantCategories := map[string]int64{"images": 300, "video": 900, "documents": 210, "archives": 500}
+	for category, size := range wantCategories {
+		if usage.Categories[category] != size {
+			t.Errorf("categories[%s] = %d, want %d", category, usage.Categories[category], size)
+		}
+	}
+	if len(usage.LargestFiles) != 2 || usage.LargestFiles[0].Path != "/Photos/clip.mov" || usage.LargestFiles[1].Path != "/.Trash/old.zip" {
+		t.Errorf("largest files = %+v", usage.LargestFiles)
+	}
+}
+
+func TestUsageAggregatorRefreshesChangedFolders(t *testing.T) {
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{}}
+	a, db := newTestAggregator(t, walker)
+	user := addUser(t, db, "bob", 0)
+	walker.objects[user] = []minio.ObjectInfo{
+		{Key: "Music/a.mp3", Size: 100},
+		{Key: "Video/b.mp4", Size: 1000},
+	}
+	ctx := context.Background()
+	a.Get(ctx, user)
+	if err := a.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有标记过的目录会被重新遍历
+	walks := 0
+	walker.onWalk = func(uuid.UUID) { walks++ }
+	walker.objects[user] = []minio.ObjectInfo{
+		{Key: "Music/a.mp3", Size: 100},
+		{Key: "Music/c.mp3", Size: 50},
+		{Key: "Video/b.mp4", Size: 1000},
+		{Key: "Video/d.mp4", Size: 1000},
+	}
+	if err := a.MarkChanged(ctx, user, "/Music/c.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if usage, _ := a.Get(ctx, user); !usage.Pending {
+		t.Error("usage not pending after a change")
+	}
+	if err := a.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if walks != 1 {
+		t.Errorf("refresh walked storage %d times, want only the changed folder", walks)
+	}
+	usage, err := a.Get(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Pending || usage.Categories["audio"] != 150 || usage.Total != 1150 {
+		t.Errorf("usage = %+v, want the Music folder refreshed and Video unchanged", usage)
+	}
+
+	// 删除整个顶层目录后该目录不再出现
+	walker.objects[user] = []minio.ObjectInfo{{Key: "Video/b.mp4", Size: 1000}, {Key: "Video/d.mp4", Size: 1000}}
+	a.MarkChanged(ctx, user, "/Music")
+	a.Refresh(ctx)
+	usage, _ = a.Get(ctx, user)
+	if len(usage.Folders) != 1 || usage.Folders[0].Name != "Video" || usage.Total != 1000 {
+		t.Errorf("folders after delete = %+v total = %d", usage.Folders, usage.Total)
+	}
+}
+
+func TestUsageAggregatorKeepsChangesDuringWalk(t *testing.T) {
+	walker := &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{}}
+	a, db := newTestAggregator(t, walker)
+	user := addUser(t, db, "carol", 0)
+	walker.objects[user] = []minio.ObjectInfo{{Key: "Docs/a.txt", Size: 10}}
+	ctx := context.Background()
+	a.Get(ctx, user)
+	a.Refresh(ctx)
+
+	// 遍历期间又有写入，结果保存但目录保持待统计
+	a.MarkChanged(ctx, user, "/Docs/b.txt")
+	walker.onWalk = func(uuid.UUID) {
+		walker.onWalk = nil
+		a.MarkChanged(ctx, user, "/Docs/c.txt")
+	}
+	if err := a.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if usage, _ := a.Get(ctx, user); !usage.Pending {
+		t.Error("change made during the walk was lost")
+	}
+	a.Refresh(ctx)
+	if usage, _ := a.Get(ctx, user); usage.Pending {
+		t.Error("folder still pending after a quiet refresh")
+	}
+}
+
+func TestUsageAggregatorIgnoresUnknownUsers(t *testing.T) {
+	a, db := newTestAggregator(t, &fakeWalker{objects: map[uuid.UUID][]minio.ObjectInfo{}})
+	user := addUser(t, db, "dave", 0)
+	if err := a.MarkChanged(context.Background(), user, "/Docs/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	db.QueryRow(`SELECT COUNT(*) FROM usage_folders`).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("changes of a user who never asked for usage created %d rows", rows)
+	}
+}
@@ -0,0 +1,71 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter 支持的filter形式：单个属性的eq比较，如 userName eq "alice"。
+// 身份提供方在创建前按userName/externalId查询、按displayName查询组时使用这种形式
+type Filter struct {
+	// Attribute 规范化后的属性名（小写），如username、externalid、emails.value
+	Attribute string
+	Value     string
+}
+
+// ParseFilter 解析filter参数，空字符串返回nil
+func ParseFilter(filter string, allowed ...string) (*Filter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, nil
+	}
+
+	attr, rest, ok := cutSpace(filter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, filter)
+	}
+	op, value, ok := cutSpace(rest)
+	if !ok || !strings.EqualFold(op, "eq") {
+		return nil, fmt.Errorf("%w: only \"eq\" is supported", ErrInvalidFilter)
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, value)
+		}
+		value = unquoted
+	} else if value != "true" && value != "false" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, value)
+	}
+
+	attr = normalizeAttribute(attr)
+	for _, name := range allowed {
+		if attr == strings.ToLower(name) {
+			return &Filter{Attribute: attr, Value: value}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported attribute %q", ErrInvalidFilter, attr)
+}
+
+// normalizeAttribute 去掉schema URN前缀并转为小写
+func normalizeAttribute(attr string) string {
+	attr = strings.TrimSpace(attr)
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(attr) > len(schema) && strings.EqualFold(attr[:len(schema)], schema) {
+			attr = strings.TrimPrefix(attr[len(schema):], ":")
+		}
+	}
+	return strings.ToLower(attr)
+}
+
+func cutSpace(s string) (string, string, bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], strings.TrimSpace(s[i:]), true
+}
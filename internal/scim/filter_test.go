@@ -0,0 +1,45 @@
+package scim
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		attr   string
+		value  string
+	}{
+		{`userName eq "alice@example.com"`, "username", "alice@example.com"},
+		{`externalId EQ "00u1"`, "externalid", "00u1"},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bob"`, "username", "bob"},
+		{`displayName eq "Engineering \"Core\""`, "displayname", `Engineering "Core"`},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.filter, "userName", "externalId", "displayName")
+		if err != nil {
+			t.Fatalf("ParseFilter(%q) error = %v", tt.filter, err)
+		}
+		if f.Attribute != tt.attr || f.Value != tt.value {
+			t.Errorf("ParseFilter(%q) = %+v", tt.filter, f)
+		}
+	}
+
+	if f, err := ParseFilter("  "); f != nil || err != nil {
+		t.Errorf("空filter应返回nil, got %+v %v", f, err)
+	}
+
+	invalid := []string{
+		`userName sw "al"`,
+		`userName eq alice`,
+		`title eq "CEO"`,
+		`userName`,
+		`userName eq "a" and active eq true`,
+	}
+	for _, filter := range invalid {
+		if _, err := ParseFilter(filter, "userName"); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q) error = %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ApplyUserPatch 将PATCH操作应用到用户上。支持的path：active、userName、displayName、
+// externalId、password、name.*、emails及emails[type eq "work"].value；省略path时value为属性对象。
+// 网关不保存的属性会被忽略
+func ApplyUserPatch(user *User, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return fmt.Errorf("%w: unsupported op %q", ErrInvalidValue, op.Op)
+		}
+
+		if op.Path == "" {
+			if kind == "remove" {
+				return fmt.Errorf("%w: remove requires a path", ErrInvalidPath)
+			}
+			var attrs map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidValue, err)
+			}
+			for attr, value := range attrs {
+				if err := setUserAttribute(user, attr, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		value := op.Value
+		if kind == "remove" {
+			value = nil
+		}
+		if err := setUserAttribute(user, op.Path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUserAttribute 设置单个属性，value为nil时清除
+func setUserAttribute(user *User, path string, value json.RawMessage) error {
+	attr := normalizeAttribute(path)
+	switch attr {
+	case "active":
+		if value == nil {
+			return fmt.Errorf("%w: active cannot be removed", ErrInvalidValue)
+		}
+		active, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case "username":
+		if value == nil {
+			return fmt.Errorf("%w: userName cannot be removed", ErrInvalidValue)
+		}
+		return decodeString(value, &user.UserName)
+	case "displayname":
+		return decodeString(value, &user.DisplayName)
+	case "externalid":
+		return decodeString(value, &user.ExternalID)
+	case "password":
+		return decodeString(value, &user.Password)
+	case "name":
+		user.Name = nil
+		if value != nil {
+			return decodeJSON(value, &user.Name)
+		}
+	case "name.formatted", "name.givenname", "name.familyname":
+		if user.Name == nil {
+			user.Name = &Name{}
+		}
+		switch attr {
+		case "name.formatted":
+			return decodeString(value, &user.Name.Formatted)
+		case "name.givenname":
+			return decodeString(value, &user.Name.GivenName)
+		default:
+			return decodeString(value, &user.Name.FamilyName)
+		}
+	case "emails":
+		user.Emails = nil
+		if value != nil {
+			return decodeJSON(value, &user.Emails)
+		}
+	default:
+		// emails[type eq "work"].value：只保留一个邮箱，直接替换主邮箱
+		if strings.HasPrefix(attr, "emails[") && strings.HasSuffix(attr, "].value") {
+			var email string
+			if err := decodeString(value, &email); err != nil {
+				return err
+			}
+			if email == "" {
+				user.Emails = nil
+			} else {
+				user.Emails = []Email{{Value: email, Type: "work", Primary: true}}
+			}
+			return nil
+		}
+		// 不保存的属性（如title、phoneNumbers、企业扩展）直接忽略，避免IdP同步失败
+	}
+	return nil
+}
+
+// ApplyGroupPatch 将PATCH操作应用到组上。支持displayName、externalId、members，
+// 以及remove members[value eq "id"]
+func ApplyGroupPatch(group *Group, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		attr := normalizeAttribute(op.Path)
+
+		switch {
+		case attr == "" && kind != "remove":
+			var attrs struct {
+				DisplayName *string     `json:"displayName"`
+				ExternalID  *string     `json:"externalId"`
+				Members     []Reference `json:"members"`
+			}
+			if err := decodeJSON(op.Value, &attrs); err != nil {
+				return err
+			}
+			if attrs.DisplayName != nil {
+				group.DisplayName = *attrs.DisplayName
+			}
+			if attrs.ExternalID != nil {
+				group.ExternalID = *attrs.ExternalID
+			}
+			if attrs.Members != nil {
+				if kind == "replace" {
+					group.Members = nil
+				}
+				group.Members = addMembers(group.Members, attrs.Members)
+			}
+		case attr == "displayname" && kind != "remove":
+			if err := decodeString(op.Value, &group.DisplayName); err != nil {
+				return err
+			}
+		case attr == "externalid":
+			if kind == "remove" {
+				group.ExternalID = ""
+			} else if err := decodeString(op.Value, &group.ExternalID); err != nil {
+				return err
+			}
+		case attr == "members":
+			var members []Reference
+			if len(op.Value) > 0 {
+				if err := decodeJSON(op.Value, &members); err != nil {
+					return err
+				}
+			}
+			switch kind {
+			case "add":
+				group.Members = addMembers(group.Members, members)
+			case "replace":
+				group.Members = addMembers(nil, members)
+			case "remove":
+				if len(members) == 0 {
+					group.Members = nil
+				} else {
+					group.Members = removeMembers(group.Members, members)
+				}
+			default:
+				return fmt.Errorf("%w: unsupported op %q", ErrInvalidValue, op.Op)
+			}
+		case strings.HasPrefix(attr, "members[") && kind == "remove":
+			inner := strings.TrimSuffix(op.Path[strings.Index(op.Path, "[")+1:], "]")
+			filter, err := ParseFilter(inner, "value")
+			if err != nil || filter == nil {
+				return fmt.Errorf("%w: %s", ErrInvalidPath, op.Path)
+			}
+			group.Members = removeMembers(group.Members, []Reference{{Value: filter.Value}})
+		default:
+			return fmt.Errorf("%w: %s %s", ErrInvalidPath, op.Op, op.Path)
+		}
+	}
+	return nil
+}
+
+func addMembers(members, add []Reference) []Reference {
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		seen[m.Value] = true
+	}
+	for _, m := range add {
+		if m.Value == "" || seen[m.Value] {
+			continue
+		}
+		seen[m.Value] = true
+		members = append(members, Reference{Value: m.Value})
+	}
+	return members
+}
+
+func removeMembers(members, remove []Reference) []Reference {
+	drop := make(map[string]bool, len(remove))
+	for _, m := range remove {
+		drop[m.Value] = true
+	}
+	kept := members[:0]
+	for _, m := range members {
+		if !drop[m.Value] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// parseBool 接受JSON布尔值，以及部分IdP发送的"True"/"False"字符串
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("%w: expected boolean, got %s", ErrInvalidValue, value)
+}
+
+// decodeString 解码字符串属性，value为nil时清空
+func decodeString(value json.RawMessage, dst *string) error {
+	if value == nil {
+		*dst = ""
+		return nil
+	}
+	return decodeJSON(value, dst)
+}
+
+func decodeJSON(value json.RawMessage, dst interface{}) error {
+	if err := json.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func ops(t *testing.T, body string) []PatchOperation {
+	t.Helper()
+	var req PatchRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	return req.Operations
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	user := &User{UserName: "alice", Emails: []Email{{Value: "alice@example.com", Primary: true}}}
+
+	// Azure AD发送字符串形式的布尔值
+	err := ApplyUserPatch(user, ops(t, `{"Operations":[
+		{"op":"Replace","path":"active","value":"False"},
+		{"op":"replace","path":"emails[type eq \"work\"].value","value":"alice@corp.example.com"},
+		{"op":"add","path":"name.givenName","value":"Alice"},
+		{"op":"replace","path":"title","value":"Engineer"}
+	]}`))
+	if err != nil {
+		t.Fatalf("ApplyUserPatch() error = %v", err)
+	}
+	if user.IsActive() {
+		t.Error("active应为false")
+	}
+	if user.PrimaryEmail() != "alice@corp.example.com" {
+		t.Errorf("PrimaryEmail() = %q", user.PrimaryEmail())
+	}
+	if user.Name == nil || user.Name.GivenName != "Alice" {
+		t.Errorf("Name = %+v", user.Name)
+	}
+
+	// 省略path时value为属性对象
+	err = ApplyUserPatch(user, ops(t, `{"Operations":[{"op":"replace","value":{"active":true,"displayName":"Alice A."}}]}`))
+	if err != nil {
+		t.Fatalf("ApplyUserPatch() error = %v", err)
+	}
+	if !user.IsActive() || user.DisplayName != "Alice A." {
+		t.Errorf("user = %+v", user)
+	}
+
+	if err := ApplyUserPatch(user, ops(t, `{"Operations":[{"op":"remove","path":"userName"}]}`)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("移除userName error = %v, want ErrInvalidValue", err)
+	}
+	if err := ApplyUserPatch(user, ops(t, `{"Operations":[{"op":"move","path":"active","value":true}]}`)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("未知op error = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	group := &Group{DisplayName: "eng", Members: []Reference{{Value: "u1"}, {Value: "u2"}}}
+
+	err := ApplyGroupPatch(group, ops(t, `{"Operations":[
+		{"op":"Add","path":"members","value":[{"value":"u3"},{"value":"u1"}]},
+		{"op":"Remove","path":"members[value eq \"u2\"]"},
+		{"op":"Replace","path":"displayName","value":"engineering"}
+	]}`))
+	if err != nil {
+		t.Fatalf("ApplyGroupPatch() error = %v", err)
+	}
+	if group.DisplayName != "engineering" {
+		t.Errorf("DisplayName = %q", group.DisplayName)
+	}
+	if len(group.Members) != 2 || group.Members[0].Value != "u1" || group.Members[1].Value != "u3" {
+		t.Errorf("Members = %+v", group.Members)
+	}
+
+	err = ApplyGroupPatch(group, ops(t, `{"Operations":[{"op":"replace","value":{"members":[{"value":"u9"}]}}]}`))
+	if err != nil {
+		t.Fatalf("ApplyGroupPatch() error = %v", err)
+	}
+	if len(group.Members) != 1 || group.Members[0].Value != "u9" {
+		t.Errorf("Members = %+v", group.Members)
+	}
+
+	if err := ApplyGroupPatch(group, ops(t, `{"Operations":[{"op":"remove","path":"members"}]}`)); err != nil || len(group.Members) != 0 {
+		t.Errorf("移除全部成员: err = %v, members = %+v", err, group.Members)
+	}
+	if err := ApplyGroupPatch(group, ops(t, `{"Operations":[{"op":"replace","path":"owner","value":"x"}]}`)); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("未知path error = %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestQuotaForGroups(t *testing.T) {
+	cfg := config.SCIMConfig{
+		DefaultQuota: 10,
+		GroupQuotas: []config.SCIMGroupQuota{
+			{Group: "Engineering", Quota: 100},
+			{Group: "Design", Quota: 50},
+			{Group: "Interns", Quota: 5},
+		},
+	}
+
+	tests := []struct {
+		groups []string
+		want   int64
+	}{
+		{nil, 10},
+		{[]string{"sales"}, 10},
+		{[]string{"engineering"}, 100},
+		{[]string{"Design", "Engineering"}, 100},
+		{[]string{"Interns"}, 5},
+	}
+	for _, tt := range tests {
+		if got := QuotaForGroups(cfg, tt.groups); got != tt.want {
+			t.Errorf("QuotaForGroups(%v) = %d, want %d", tt.groups, got, tt.want)
+		}
+	}
+}
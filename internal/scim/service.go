@@ -0,0 +1,763 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+	"github.com/webdav-gateway/internal/sso"
+)
+
+// GroupSource user_groups表中SCIM组成员关系的来源标识
+const GroupSource = "scim"
+
+// unusablePasswordHash 未设置密码的SCIM用户只能通过单点登录访问
+const unusablePasswordHash = "!scim"
+
+// maxUsernameLength 与users.username列长度一致
+const maxUsernameLength = 50
+
+// Service 将SCIM用户和组映射到本地用户、user_groups表，并按组设置存储配额
+type Service struct {
+	db     *sql.DB
+	config config.SCIMConfig
+	// admins auth.admins中的用户名（小写），与注册一样不能由IdP创建或改名占用
+	admins map[string]bool
+}
+
+// NewService 创建SCIM服务，admins为auth.admins
+func NewService(db *sql.DB, cfg config.SCIMConfig, admins []string) *Service {
+	reserved := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		reserved[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	return &Service{db: db, config: cfg, admins: reserved}
+}
+
+// Initialize 创建SCIM所需的表。组成员关系与单点登录共用user_groups表，scim_users表也由单点登录创建
+// （按externalId关联已有用户）。停用用户时写入的users.tokens_valid_after列由account.Service.Initialize创建
+func (s *Service) Initialize(ctx context.Context) error {
+	if err := sso.NewProvisioner(s.db, nil).Initialize(ctx); err != nil {
+		return err
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS scim_groups (
+			id UUID PRIMARY KEY,
+			display_name VARCHAR(255) UNIQUE NOT NULL,
+			external_id VARCHAR(255),
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_groups_group ON user_groups(group_name, source)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize scim tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// MaxResults 返回单页最多的资源数
+func (s *Service) MaxResults() int {
+	if s.config.MaxResults <= 0 {
+		return 200
+	}
+	return s.config.MaxResults
+}
+
+const userColumns = `u.id, u.username, u.email, COALESCE(u.display_name, ''), u.status, u.created_at, u.updated_at,
+	COALESCE(su.external_id, '')`
+
+// ListUsers 分页列出未删除的用户，startIndex从1开始
+func (s *Service) ListUsers(ctx context.Context, filter *Filter, startIndex, count int) ([]*User, int, error) {
+	where := `u.status <> 'deleted'`
+	var args []interface{}
+	if filter != nil {
+		switch filter.Attribute {
+		case "id":
+			if _, err := uuid.Parse(filter.Value); err != nil {
+				return nil, 0, nil
+			}
+			where += ` AND u.id = $1`
+		case "username":
+			where += ` AND LOWER(u.username) = LOWER($1)`
+		case "externalid":
+			where += ` AND su.external_id = $1`
+		case "emails.value", "emails":
+			where += ` AND LOWER(u.email) = LOWER($1)`
+		default:
+			return nil, 0, fmt.Errorf("%w: %s", ErrInvalidFilter, filter.Attribute)
+		}
+		args = append(args, filter.Value)
+	}
+
+	var total int
+	from := ` FROM users u LEFT JOIN scim_users su ON su.user_id = u.id WHERE ` + where
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, count, startIndex-1)
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s%s ORDER BY u.created_at, u.id LIMIT $%d OFFSET $%d`, userColumns, from, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	for _, user := range users {
+		if user.Groups, err = s.userGroups(ctx, s.db, user.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+	return users, total, nil
+}
+
+// GetUser 返回用户，已删除的用户视为不存在
+func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
+	return s.getUser(ctx, s.db, id)
+}
+
+// CreateUser 创建本地用户，userName或邮箱已被占用时返回ErrUniqueness
+func (s *Service) CreateUser(ctx context.Context, in *User) (*User, error) {
+	if err := validateUser(in); err != nil {
+		return nil, err
+	}
+	if err := s.checkReserved(in.UserName); err != nil {
+		return nil, err
+	}
+	passwordHash, err := s.passwordHash(in.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status := "active"
+	if !in.IsActive() {
+		status = "suspended"
+	}
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, email, password_hash, display_name, status)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		in.UserName, in.PrimaryEmail(), passwordHash, in.DisplayNameOrDefault(), status).Scan(&userID)
+	if err != nil {
+		return nil, uniquenessError(err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO scim_users (user_id, external_id, created_at) VALUES ($1, NULLIF($2, ''), $3)`,
+		userID, in.ExternalID, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.applyQuota(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, tx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// ReplaceUser 用in替换用户的属性，active=false时停用用户并撤销其会话
+func (s *Service) ReplaceUser(ctx context.Context, id string, in *User) (*User, error) {
+	if err := validateUser(in); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status, username string
+	err = tx.QueryRowContext(ctx,
+		`SELECT status, username FROM users WHERE id = $1 AND status <> 'deleted' FOR UPDATE`, userID).Scan(&status, &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 运维创建的管理员账户可以保留原名，其他用户不能改名为管理员用户名
+	if !strings.EqualFold(username, in.UserName) {
+		if err := s.checkReserved(in.UserName); err != nil {
+			return nil, err
+		}
+	}
+
+	newStatus := "active"
+	if !in.IsActive() {
+		newStatus = "suspended"
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET username = $1, email = $2, display_name = $3, status = $4, updated_at = $5
+		WHERE id = $6`,
+		in.UserName, in.PrimaryEmail(), in.DisplayNameOrDefault(), newStatus, time.Now(), userID)
+	if err != nil {
+		return nil, uniquenessError(err)
+	}
+	if in.Password != "" {
+		passwordHash, err := s.passwordHash(in.Password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, userID); err != nil {
+			return nil, err
+		}
+	}
+	if status == "active" && newStatus != "active" {
+		if err := revokeSessions(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO scim_users (user_id, external_id, created_at) VALUES ($1, NULLIF($2, ''), $3)
+		ON CONFLICT (user_id) DO UPDATE SET external_id = EXCLUDED.external_id`,
+		userID, in.ExternalID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// PatchUser 应用PATCH操作后替换用户
+func (s *Service) PatchUser(ctx context.Context, id string, ops []PatchOperation) (*User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyUserPatch(user, ops); err != nil {
+		return nil, err
+	}
+	return s.ReplaceUser(ctx, id, user)
+}
+
+// DeleteUser 取消用户的配置：标记为已删除、撤销会话并移除SCIM组成员关系。
+// 用户的文件保留在存储中，由管理员另行清理
+func (s *Service) DeleteUser(ctx context.Context, id string) error {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET status = 'deleted', updated_at = $1 WHERE id = $2 AND status <> 'deleted'`,
+		time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if err := revokeSessions(ctx, tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM user_groups WHERE user_id = $1 AND source = $2`, userID, GroupSource); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListGroups 分页列出组，withMembers为false时不加载成员（对应excludedAttributes=members）
+func (s *Service) ListGroups(ctx context.Context, filter *Filter, startIndex, count int, withMembers bool) ([]*Group, int, error) {
+	where := `TRUE`
+	var args []interface{}
+	if filter != nil {
+		switch filter.Attribute {
+		case "id":
+			if _, err := uuid.Parse(filter.Value); err != nil {
+				return nil, 0, nil
+			}
+			where = `id = $1`
+		case "displayname":
+			where = `LOWER(display_name) = LOWER($1)`
+		case "externalid":
+			where = `external_id = $1`
+		default:
+			return nil, 0, fmt.Errorf("%w: %s", ErrInvalidFilter, filter.Attribute)
+		}
+		args = append(args, filter.Value)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM scim_groups WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, count, startIndex-1)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, display_name, COALESCE(external_id, ''), created_at, updated_at
+		FROM scim_groups WHERE %s ORDER BY created_at, id LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var groups []*Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if withMembers {
+		for _, group := range groups {
+			if group.Members, err = s.groupMembers(ctx, s.db, group.DisplayName); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return groups, total, nil
+}
+
+// GetGroup 返回组及其成员
+func (s *Service) GetGroup(ctx context.Context, id string, withMembers bool) (*Group, error) {
+	return s.getGroup(ctx, s.db, id, withMembers)
+}
+
+// CreateGroup 创建组并设置成员，组名已存在时返回ErrUniqueness
+func (s *Service) CreateGroup(ctx context.Context, in *Group) (*Group, error) {
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	if in.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO scim_groups (id, display_name, external_id, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $4)`,
+		id, in.DisplayName, in.ExternalID, now)
+	if err != nil {
+		return nil, uniquenessError(err)
+	}
+	if err := s.setMembers(ctx, tx, in.DisplayName, in.DisplayName, in.Members); err != nil {
+		return nil, err
+	}
+
+	group, err := s.getGroup(ctx, tx, id.String(), true)
+	if err != nil {
+		return nil, err
+	}
+	return group, tx.Commit()
+}
+
+// ReplaceGroup 替换组名和成员，改名时同步更新user_groups
+func (s *Service) ReplaceGroup(ctx context.Context, id string, in *Group) (*Group, error) {
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	if in.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRowContext(ctx, `SELECT display_name FROM scim_groups WHERE id = $1 FOR UPDATE`, groupID).Scan(&oldName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE scim_groups SET display_name = $1, external_id = NULLIF($2, ''), updated_at = $3 WHERE id = $4`,
+		in.DisplayName, in.ExternalID, time.Now(), groupID)
+	if err != nil {
+		return nil, uniquenessError(err)
+	}
+	if err := s.setMembers(ctx, tx, oldName, in.DisplayName, in.Members); err != nil {
+		return nil, err
+	}
+
+	group, err := s.getGroup(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return group, tx.Commit()
+}
+
+// PatchGroup 应用PATCH操作后替换组
+func (s *Service) PatchGroup(ctx context.Context, id string, ops []PatchOperation) (*Group, error) {
+	group, err := s.GetGroup(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyGroupPatch(group, ops); err != nil {
+		return nil, err
+	}
+	return s.ReplaceGroup(ctx, id, group)
+}
+
+// DeleteGroup 删除组及其成员关系，并重新计算原成员的配额
+func (s *Service) DeleteGroup(ctx context.Context, id string) error {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRowContext(ctx, `DELETE FROM scim_groups WHERE id = $1 RETURNING display_name`, groupID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.setMembers(ctx, tx, name, name, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setMembers 将组oldName的成员替换为members（组名改为newName），并重新计算受影响用户的配额。
+// 不存在或已删除的用户返回ErrInvalidValue
+func (s *Service) setMembers(ctx context.Context, tx *sql.Tx, oldName, newName string, members []Reference) error {
+	affected := make(map[uuid.UUID]bool)
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM user_groups WHERE group_name = $1 AND source = $2 RETURNING user_id`, oldName, GroupSource)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		affected[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		userID, err := uuid.Parse(member.Value)
+		if err != nil {
+			return fmt.Errorf("%w: unknown member %q", ErrInvalidValue, member.Value)
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO user_groups (user_id, group_name, source)
+			SELECT id, $2, $3 FROM users WHERE id = $1 AND status <> 'deleted'
+			ON CONFLICT DO NOTHING`,
+			userID, newName, GroupSource)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			// 重复的成员会被ON CONFLICT忽略，只有用户不存在时才报错
+			var exists bool
+			if err := tx.QueryRowContext(ctx,
+				`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND status <> 'deleted')`, userID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%w: unknown member %q", ErrInvalidValue, member.Value)
+			}
+		}
+		affected[userID] = true
+	}
+
+	for userID := range affected {
+		if err := s.applyQuota(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyQuota 按用户所属的组设置存储配额：取匹配的组配额中的最大值，都不匹配时使用default_quota；
+// 两者均未配置时保持原配额不变
+func (s *Service) applyQuota(ctx context.Context, tx *sql.Tx, userID uuid.UUID) error {
+	if s.config.DefaultQuota <= 0 && len(s.config.GroupQuotas) == 0 {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT group_name FROM user_groups WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, group)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	quota := QuotaForGroups(s.config, groups)
+	if quota <= 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET storage_quota = $1 WHERE id = $2`, quota, userID)
+	return err
+}
+
+// QuotaForGroups 返回属于groups的用户应有的配额，0表示不修改
+func QuotaForGroups(cfg config.SCIMConfig, groups []string) int64 {
+	var quota int64
+	matched := false
+	for _, rule := range cfg.GroupQuotas {
+		for _, group := range groups {
+			if strings.EqualFold(strings.TrimSpace(rule.Group), strings.TrimSpace(group)) {
+				if !matched || rule.Quota > quota {
+					quota = rule.Quota
+				}
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return cfg.DefaultQuota
+	}
+	return quota
+}
+
+func (s *Service) passwordHash(password string) (string, error) {
+	if password == "" {
+		return unusablePasswordHash, nil
+	}
+	return cryptopolicy.HashPassword(password)
+}
+
+// queryer 可在事务内外执行的查询
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *Service) getUser(ctx context.Context, q queryer, id string) (*User, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	user, err := scanUser(q.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users u LEFT JOIN scim_users su ON su.user_id = u.id
+		WHERE u.id = $1 AND u.status <> 'deleted'`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Groups, err = s.userGroups(ctx, q, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// userGroups 返回用户所属的SCIM组
+func (s *Service) userGroups(ctx context.Context, q queryer, userID string) ([]Reference, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT g.id, g.display_name FROM scim_groups g
+		JOIN user_groups ug ON ug.group_name = g.display_name AND ug.source = $2
+		WHERE ug.user_id = $1 ORDER BY g.display_name`, userID, GroupSource)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Reference
+	for rows.Next() {
+		var ref Reference
+		if err := rows.Scan(&ref.Value, &ref.Display); err != nil {
+			return nil, err
+		}
+		groups = append(groups, ref)
+	}
+	return groups, rows.Err()
+}
+
+func (s *Service) getGroup(ctx context.Context, q queryer, id string, withMembers bool) (*Group, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	group, err := scanGroup(q.QueryRowContext(ctx, `
+		SELECT id, display_name, COALESCE(external_id, ''), created_at, updated_at
+		FROM scim_groups WHERE id = $1`, groupID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if withMembers {
+		if group.Members, err = s.groupMembers(ctx, q, group.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+func (s *Service) groupMembers(ctx context.Context, q queryer, name string) ([]Reference, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT u.id, u.username FROM user_groups ug JOIN users u ON u.id = ug.user_id
+		WHERE ug.group_name = $1 AND ug.source = $2 ORDER BY u.username`, name, GroupSource)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Reference
+	for rows.Next() {
+		var ref Reference
+		if err := rows.Scan(&ref.Value, &ref.Display); err != nil {
+			return nil, err
+		}
+		members = append(members, ref)
+	}
+	return members, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	var user User
+	var email, status string
+	meta := Meta{ResourceType: "User"}
+	if err := row.Scan(&user.ID, &user.UserName, &email, &user.DisplayName, &status,
+		&meta.Created, &meta.LastModified, &user.ExternalID); err != nil {
+		return nil, err
+	}
+	user.Schemas = []string{SchemaUser}
+	active := status == "active"
+	user.Active = &active
+	if email != "" {
+		user.Emails = []Email{{Value: email, Type: "work", Primary: true}}
+	}
+	user.Meta = &meta
+	return &user, nil
+}
+
+func scanGroup(row scanner) (*Group, error) {
+	var group Group
+	meta := Meta{ResourceType: "Group"}
+	if err := row.Scan(&group.ID, &group.DisplayName, &group.ExternalID, &meta.Created, &meta.LastModified); err != nil {
+		return nil, err
+	}
+	group.Schemas = []string{SchemaGroup}
+	group.Meta = &meta
+	return &group, nil
+}
+
+// validateUser 校验并规范化创建/替换请求中的用户属性
+func validateUser(user *User) error {
+	user.UserName = strings.TrimSpace(user.UserName)
+	if user.UserName == "" {
+		return fmt.Errorf("%w: userName is required", ErrInvalidValue)
+	}
+	if len(user.UserName) > maxUsernameLength || strings.ContainsAny(user.UserName, "/\\ \t\r\n") {
+		return fmt.Errorf("%w: unusable userName %q", ErrInvalidValue, user.UserName)
+	}
+	email := strings.ToLower(user.PrimaryEmail())
+	if email == "" || !strings.Contains(email, "@") {
+		return fmt.Errorf("%w: a valid email is required", ErrInvalidValue)
+	}
+	user.Emails = []Email{{Value: email, Type: "work", Primary: true}}
+	return nil
+}
+
+// checkReserved AdminMiddleware按用户名授予管理员权限，auth.admins中的用户名（不区分大小写）按已被占用处理，
+// 与注册一样不透露管理员名单
+func (s *Service) checkReserved(username string) error {
+	if s.admins[strings.ToLower(username)] {
+		return fmt.Errorf("%w: userName", ErrUniqueness)
+	}
+	return nil
+}
+
+// uniquenessError 将唯一约束冲突转换为ErrUniqueness
+func uniquenessError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrUniqueness, pqErr.Constraint)
+	}
+	return err
+}
+
+// revokeSessions 使用户已签发的令牌失效（需开启auth.login_alerts才会校验）
+func revokeSessions(ctx context.Context, tx *sql.Tx, userID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `UPDATE users SET tokens_valid_after = $1 WHERE id = $2`, time.Now(), userID)
+	return err
+}
@@ -0,0 +1,20 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// TestCreateUserReservedUsername auth.admins中的用户名（不区分大小写）在写入数据库前按已被占用拒绝
+func TestCreateUserReservedUsername(t *testing.T) {
+	s := NewService(nil, config.SCIMConfig{}, []string{" Root "})
+	for _, name := range []string{"root", "ROOT"} {
+		user := &User{UserName: name, Emails: []Email{{Value: "root@example.com", Primary: true}}}
+		if _, err := s.CreateUser(context.Background(), user); !errors.Is(err, ErrUniqueness) {
+			t.Errorf("CreateUser(%s) = %v, want ErrUniqueness", name, err)
+		}
+	}
+}
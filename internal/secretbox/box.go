@@ -0,0 +1,133 @@
+// Package secretbox 加密保存在数据库中、之后需要原样取回的凭据（镜像上游、迁移源服务器的密码），
+// 使用AES-256-GCM，属于经批准的算法
+package secretbox
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// sealedPrefix 加密值的前缀，没有该前缀的值是加密之前保存的明文
+const sealedPrefix = "enc:v1:"
+
+// hkdfInfo 由配置的密钥派生加密密钥时使用的用途标识，与其他用途的派生密钥相互独立
+const hkdfInfo = "webdav-gateway stored credentials"
+
+// ErrDecrypt 密文被篡改或加密密钥已更换
+var ErrDecrypt = errors.New("failed to decrypt stored credential")
+
+// Box 加密和解密保存的凭据
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New 由密钥派生AES-256密钥，key为空时返回错误
+func New(key string) (*Box, error) {
+	if key == "" {
+		return nil, errors.New("secret key is empty")
+	}
+	derived := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(key), nil, []byte(hkdfInfo)), derived); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal 加密凭据，空字符串保持为空
+func (b *Box) Seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密Seal的结果。没有加密前缀的值是升级前保存的明文，原样返回
+func (b *Box) Open(value string) (string, error) {
+	if !Sealed(value) {
+		return value, nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return string(plaintext), nil
+}
+
+// Sealed 判断值是否已加密
+func Sealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// SealColumn 把table.column中加密之前保存的明文凭据改为密文，返回处理的行数。table和column由调用方固定，
+// 表必须有id主键。更新以原值为条件，多副本同时启动时不会重复加密
+func (b *Box) SealColumn(ctx context.Context, db *sql.DB, table, column string) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, `+column+` FROM `+table+` WHERE `+column+` <> ''`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s.%s: %w", table, column, err)
+	}
+	type plaintextRow struct {
+		id    string
+		value string
+	}
+	var pending []plaintextRow
+	for rows.Next() {
+		var r plaintextRow
+		if err := rows.Scan(&r.id, &r.value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !Sealed(r.value) {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sealed := 0
+	for _, r := range pending {
+		value, err := b.Seal(r.value)
+		if err != nil {
+			return sealed, err
+		}
+		result, err := db.ExecContext(ctx, `UPDATE `+table+` SET `+column+` = $1 WHERE id = $2 AND `+column+` = $3`,
+			value, r.id, r.value)
+		if err != nil {
+			return sealed, fmt.Errorf("failed to encrypt %s.%s: %w", table, column, err)
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			sealed++
+		}
+	}
+	return sealed, nil
+}
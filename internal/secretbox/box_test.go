@@ -0,0 +1,105 @@
+package secretbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/demo"
+)
+
+func TestBoxSealOpen(t *testing.T) {
+	box, err := New("test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"app-password", "密码 with spaces", strings.Repeat("x", 1000)} {
+		sealed, err := box.Seal(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Sealed(sealed) || strings.Contains(sealed, plaintext) {
+			t.Errorf("Seal(%q) = %q, not encrypted", plaintext, sealed)
+		}
+		if again, _ := box.Seal(plaintext); again == sealed {
+			t.Error("Seal should use a fresh nonce every time")
+		}
+		if got, err := box.Open(sealed); err != nil || got != plaintext {
+			t.Errorf("Open = %q, %v; want %q", got, err, plaintext)
+		}
+	}
+
+	if sealed, err := box.Seal(""); err != nil || sealed != "" {
+		t.Errorf("Seal(\"\") = %q, %v; want empty", sealed, err)
+	}
+	// 升级前保存的明文原样返回
+	if got, err := box.Open("legacy-password"); err != nil || got != "legacy-password" {
+		t.Errorf("Open legacy = %q, %v", got, err)
+	}
+}
+
+func TestBoxOpenRejects(t *testing.T) {
+	box, _ := New("test-key")
+	other, _ := New("other-key")
+	sealed, _ := box.Seal("app-password")
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+	for name, value := range map[string]string{
+		"other key":  func() string { s, _ := other.Seal("app-password"); return s }(),
+		"tampered":   string(tampered),
+		"truncated":  sealedPrefix + "AAAA",
+		"not base64": sealedPrefix + "!!!",
+	} {
+		if _, err := box.Open(value); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: Open = %v, want ErrDecrypt", name, err)
+		}
+	}
+
+	if _, err := New(""); err == nil {
+		t.Error("New with an empty key should fail")
+	}
+}
+
+func TestSealColumn(t *testing.T) {
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE mirrors (id TEXT PRIMARY KEY, source_password TEXT NOT NULL DEFAULT '')`); err != nil {
+		t.Fatal(err)
+	}
+	box, _ := New("test-key")
+	already, _ := box.Seal("sealed-before")
+	for id, password := range map[string]string{"a": "legacy", "b": "", "c": already} {
+		if _, err := db.Exec(`INSERT INTO mirrors (id, source_password) VALUES ($1, $2)`, id, password); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := box.SealColumn(ctx, db, "mirrors", "source_password")
+	if err != nil || n != 1 {
+		t.Fatalf("SealColumn = %d, %v; want 1", n, err)
+	}
+	// 再次执行不会重复加密
+	if n, err := box.SealColumn(ctx, db, "mirrors", "source_password"); err != nil || n != 0 {
+		t.Errorf("second SealColumn = %d, %v; want 0", n, err)
+	}
+
+	for id, want := range map[string]string{"a": "legacy", "b": "", "c": "sealed-before"} {
+		var stored string
+		if err := db.QueryRow(`SELECT source_password FROM mirrors WHERE id = $1`, id).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if want != "" && !Sealed(stored) {
+			t.Errorf("row %s stored in plaintext: %q", id, stored)
+		}
+		if got, err := box.Open(stored); err != nil || got != want {
+			t.Errorf("row %s = %q, %v; want %q", id, got, err, want)
+		}
+	}
+}
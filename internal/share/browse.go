@@ -0,0 +1,44 @@
+package share
+
+import (
+	"path"
+	"strings"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// ErrOutsideShare 访问路径超出分享的根目录
+var ErrOutsideShare = Error("path is outside the share")
+
+// Root 分享的根路径（分享者空间中的规范路径）
+func Root(fileShare *models.FileShare) string {
+	return path.Clean("/" + fileShare.FilePath)
+}
+
+// ResolvePath 把访问者提交的相对路径映射为分享者空间中的路径，结果总在分享根目录之内。
+// 空路径和/表示分享根目录；包含..分段的路径返回ErrOutsideShare，而不是静默截断到根目录
+func ResolvePath(fileShare *models.FileShare, rel string) (string, error) {
+	if strings.ContainsRune(rel, 0) || strings.Contains(rel, `\`) {
+		return "", ErrOutsideShare
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if segment == ".." {
+			return "", ErrOutsideShare
+		}
+	}
+	return path.Join(Root(fileShare), path.Clean("/"+rel)), nil
+}
+
+// RelativePath 把分享者空间中的路径转换为相对分享根目录的路径（以/开头），
+// 返回给访问者的列表只使用相对路径，不暴露分享者的目录结构
+func RelativePath(fileShare *models.FileShare, objectPath string) string {
+	root := Root(fileShare)
+	objectPath = path.Clean("/" + objectPath)
+	if root == "/" {
+		return objectPath
+	}
+	if objectPath == root {
+		return "/"
+	}
+	return strings.TrimPrefix(objectPath, root)
+}
@@ -0,0 +1,57 @@
+package share
+
+import (
+	"testing"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+func TestResolvePath(t *testing.T) {
+	fileShare := &models.FileShare{FilePath: "/photos/2024"}
+	tests := []struct {
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{"", "/photos/2024", false},
+		{"/", "/photos/2024", false},
+		{"trip", "/photos/2024/trip", false},
+		{"/trip/a.jpg", "/photos/2024/trip/a.jpg", false},
+		{"trip//./a.jpg", "/photos/2024/trip/a.jpg", false},
+		{"..", "", true},
+		{"../2023/a.jpg", "", true},
+		{"trip/../../2023", "", true},
+		{`..\2023`, "", true},
+		{"a\x00b", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolvePath(fileShare, tt.rel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolvePath(%q) error = %v, wantErr %v", tt.rel, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	fileShare := &models.FileShare{FilePath: "photos/2024/"}
+	tests := map[string]string{
+		"/photos/2024":           "/",
+		"/photos/2024/":          "/",
+		"/photos/2024/trip/":     "/trip",
+		"/photos/2024/trip/a.jp": "/trip/a.jp",
+	}
+	for objectPath, want := range tests {
+		if got := RelativePath(fileShare, objectPath); got != want {
+			t.Errorf("RelativePath(%q) = %q, want %q", objectPath, got, want)
+		}
+	}
+
+	root := &models.FileShare{FilePath: "/"}
+	if got := RelativePath(root, "/docs/a.txt"); got != "/docs/a.txt" {
+		t.Errorf("RelativePath with root share = %q, want /docs/a.txt", got)
+	}
+}
@@ -0,0 +1,198 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// 分享权限
+const (
+	// PermissionRead 只能查看和下载
+	PermissionRead = "read"
+	// PermissionWrite 可以下载，也可以向分享目录上传
+	PermissionWrite = "write"
+	// PermissionDrop 文件投递：只能向分享目录上传，不能列出或下载
+	PermissionDrop = "drop"
+)
+
+// 上传错误
+var (
+	ErrUploadNotAllowed   = Error("share does not accept uploads")
+	ErrUploadLimitReached = Error("share upload limit reached")
+	ErrUploadTooLarge     = Error("file exceeds share upload size limit")
+)
+
+// ValidPermission 判断权限取值是否有效，空值视为read
+func ValidPermission(permission string) bool {
+	switch permission {
+	case "", PermissionRead, PermissionWrite, PermissionDrop:
+		return true
+	}
+	return false
+}
+
+// AcceptsUploads 判断分享是否允许匿名上传
+func AcceptsUploads(fileShare *models.FileShare) bool {
+	return fileShare.Permissions == PermissionWrite || fileShare.Permissions == PermissionDrop
+}
+
+// AllowsDownload 判断分享是否允许下载，文件投递分享对访问者不可见
+func AllowsDownload(fileShare *models.FileShare) bool {
+	return fileShare.Permissions != PermissionDrop
+}
+
+// DropBox 记录分享的匿名上传数量和字节数，执行每个分享的上传限制。
+// 计数保存在file_shares表中，多副本部署下同样有效
+type DropBox struct {
+	db     *sql.DB
+	config config.ShareUploadConfig
+}
+
+// NewDropBox 创建分享上传计数服务
+func NewDropBox(db *sql.DB, cfg config.ShareUploadConfig) *DropBox {
+	return &DropBox{db: db, config: cfg}
+}
+
+// Initialize 为file_shares表添加上传限制和计数列，并允许drop权限
+func (d *DropBox) Initialize(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS max_uploads INTEGER`,
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS max_upload_size BIGINT`,
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS max_upload_bytes BIGINT`,
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS upload_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS upload_bytes BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE file_shares DROP CONSTRAINT IF EXISTS file_shares_permissions_check`,
+		`ALTER TABLE file_shares ADD CONSTRAINT file_shares_permissions_check CHECK (permissions IN ('read', 'write', 'drop'))`,
+	}
+	for _, stmt := range statements {
+		if _, err := d.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize share upload columns: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetLimits 保存分享的上传限制，未设置的项使用配置的默认值
+func (d *DropBox) SetLimits(ctx context.Context, shareToken string, limits *models.ShareUploadLimits) error {
+	var maxFiles sql.NullInt64
+	var maxFileSize, maxTotalSize sql.NullInt64
+	if limits != nil {
+		if limits.MaxFiles != nil {
+			maxFiles = sql.NullInt64{Int64: int64(*limits.MaxFiles), Valid: true}
+		}
+		if limits.MaxFileSize != nil {
+			maxFileSize = sql.NullInt64{Int64: *limits.MaxFileSize, Valid: true}
+		}
+		if limits.MaxTotalSize != nil {
+			maxTotalSize = sql.NullInt64{Int64: *limits.MaxTotalSize, Valid: true}
+		}
+	}
+	if !maxFiles.Valid && d.config.MaxFiles > 0 {
+		maxFiles = sql.NullInt64{Int64: int64(d.config.MaxFiles), Valid: true}
+	}
+
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE file_shares SET max_uploads = $1, max_upload_size = $2, max_upload_bytes = $3
+		WHERE share_token = $4`,
+		maxFiles, maxFileSize, maxTotalSize, shareToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// Status 返回分享的上传限制和已接收的文件数、字节数
+func (d *DropBox) Status(ctx context.Context, shareID uuid.UUID) (*models.ShareUploadStatus, error) {
+	var maxFiles, maxFileSize, maxTotalSize sql.NullInt64
+	status := &models.ShareUploadStatus{}
+	err := d.db.QueryRowContext(ctx, `
+		SELECT max_uploads, max_upload_size, max_upload_bytes, upload_count, upload_bytes
+		FROM file_shares WHERE id = $1`, shareID).Scan(
+		&maxFiles, &maxFileSize, &maxTotalSize, &status.UploadCount, &status.UploadBytes)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if maxFiles.Valid {
+		n := int(maxFiles.Int64)
+		status.MaxFiles = &n
+	}
+	fileSize := d.config.MaxFileSize
+	if maxFileSize.Valid && (fileSize <= 0 || maxFileSize.Int64 < fileSize) {
+		fileSize = maxFileSize.Int64
+	}
+	if fileSize > 0 {
+		status.MaxFileSize = &fileSize
+	}
+	if maxTotalSize.Valid {
+		status.MaxTotalSize = &maxTotalSize.Int64
+	}
+	return status, nil
+}
+
+// Reserve 在开始接收文件前占用一个上传名额，返回本次最多可写入的字节数（-1表示不限制）。
+// 上传失败时需调用Release，成功后调用Commit
+func (d *DropBox) Reserve(ctx context.Context, shareID uuid.UUID) (int64, error) {
+	status, err := d.Status(ctx, shareID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE file_shares SET upload_count = upload_count + 1
+		WHERE id = $1 AND (max_uploads IS NULL OR upload_count < max_uploads)
+			AND (max_upload_bytes IS NULL OR upload_bytes < max_upload_bytes)`,
+		shareID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, ErrUploadLimitReached
+	}
+
+	limit := int64(-1)
+	if status.MaxFileSize != nil {
+		limit = *status.MaxFileSize
+	}
+	if status.MaxTotalSize != nil {
+		if remaining := *status.MaxTotalSize - status.UploadBytes; limit < 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+	return limit, nil
+}
+
+// Commit 记录已写入的字节数；并发上传使总量超限时返回ErrUploadLimitReached，调用方应删除该文件并Release
+func (d *DropBox) Commit(ctx context.Context, shareID uuid.UUID, size int64) error {
+	// 参数按出现顺序编号：SQLite按首次出现的顺序绑定$N参数
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE file_shares SET upload_bytes = upload_bytes + $1
+		WHERE id = $2 AND (max_upload_bytes IS NULL OR upload_bytes + $1 <= max_upload_bytes)`,
+		size, shareID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUploadLimitReached
+	}
+	return nil
+}
+
+// Release 归还Reserve占用的名额（不使用GREATEST，演示模式的SQLite没有该函数）
+func (d *DropBox) Release(ctx context.Context, shareID uuid.UUID) error {
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE file_shares SET upload_count = CASE WHEN upload_count > 0 THEN upload_count - 1 ELSE 0 END WHERE id = $1`, shareID)
+	return err
+}
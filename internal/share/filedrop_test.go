@@ -0,0 +1,178 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// newTestShareDB 打开演示模式的SQLite数据库（与生产SQL兼容的最小环境），插入一个用户和一个投递分享
+func newTestShareDB(t *testing.T) (*sql.DB, uuid.UUID, string) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	userID, shareID := uuid.New(), uuid.New()
+	token := "drop-" + shareID.String()[:8]
+	if _, err := db.ExecContext(ctx, `INSERT INTO users (id, username, email, password_hash) VALUES ($1, 'alice', 'alice@example.com', 'x')`, userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO file_shares (id, user_id, file_path, share_token, permissions) VALUES ($1, $2, '/inbox', $3, 'drop')`,
+		shareID, userID, token); err != nil {
+		t.Fatal(err)
+	}
+	return db, shareID, token
+}
+
+func newTestDropBox(t *testing.T, cfg config.ShareUploadConfig) (*DropBox, uuid.UUID, string) {
+	t.Helper()
+	db, shareID, token := newTestShareDB(t)
+	d := NewDropBox(db, cfg)
+	if err := d.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return d, shareID, token
+}
+
+func intPtr(n int) *int       { return &n }
+func int64Ptr(n int64) *int64 { return &n }
+
+func TestDropBoxLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ShareUploadConfig
+		limits *models.ShareUploadLimits
+		want   models.ShareUploadLimits
+	}{
+		{"unlimited", config.ShareUploadConfig{}, nil, models.ShareUploadLimits{}},
+		{"config defaults", config.ShareUploadConfig{MaxFiles: 10, MaxFileSize: 1000}, nil,
+			models.ShareUploadLimits{MaxFiles: intPtr(10), MaxFileSize: int64Ptr(1000)}},
+		{"share limits", config.ShareUploadConfig{}, &models.ShareUploadLimits{MaxFiles: intPtr(3), MaxFileSize: int64Ptr(50), MaxTotalSize: int64Ptr(100)},
+			models.ShareUploadLimits{MaxFiles: intPtr(3), MaxFileSize: int64Ptr(50), MaxTotalSize: int64Ptr(100)}},
+		// 分享设置的文件大小不能超过全局上限
+		{"file size capped by config", config.ShareUploadConfig{MaxFileSize: 1000}, &models.ShareUploadLimits{MaxFileSize: int64Ptr(5000)},
+			models.ShareUploadLimits{MaxFileSize: int64Ptr(1000)}},
+		{"smaller share file size", config.ShareUploadConfig{MaxFileSize: 1000}, &models.ShareUploadLimits{MaxFileSize: int64Ptr(10)},
+			models.ShareUploadLimits{MaxFileSize: int64Ptr(10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, shareID, token := newTestDropBox(t, tt.cfg)
+			ctx := context.Background()
+			if err := d.SetLimits(ctx, token, tt.limits); err != nil {
+				t.Fatal(err)
+			}
+			status, err := d.Status(ctx, shareID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalLimit(status.MaxFiles, tt.want.MaxFiles) || !equalLimit(status.MaxFileSize, tt.want.MaxFileSize) ||
+				!equalLimit(status.MaxTotalSize, tt.want.MaxTotalSize) {
+				t.Errorf("limits = %s, want %s", formatLimits(status.ShareUploadLimits), formatLimits(tt.want))
+			}
+		})
+	}
+
+	d, _, _ := newTestDropBox(t, config.ShareUploadConfig{})
+	if err := d.SetLimits(context.Background(), "missing", nil); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("SetLimits unknown token = %v, want ErrShareNotFound", err)
+	}
+	if _, err := d.Status(context.Background(), uuid.New()); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Status unknown share = %v, want ErrShareNotFound", err)
+	}
+}
+
+func equalLimit[T comparable](got, want *T) bool {
+	return (got == nil) == (want == nil) && (got == nil || *got == *want)
+}
+
+func formatLimits(l models.ShareUploadLimits) string {
+	return fmt.Sprintf("files=%s size=%s total=%s", formatLimit(l.MaxFiles), formatLimit(l.MaxFileSize), formatLimit(l.MaxTotalSize))
+}
+
+func formatLimit[T any](p *T) string {
+	if p == nil {
+		return "-"
+	}
+	return fmt.Sprint(*p)
+}
+
+// TestDropBoxReserveCommitRelease 名额和字节数的占用、提交与归还
+func TestDropBoxReserveCommitRelease(t *testing.T) {
+	d, shareID, token := newTestDropBox(t, config.ShareUploadConfig{MaxFileSize: 80})
+	ctx := context.Background()
+	if err := d.SetLimits(ctx, token, &models.ShareUploadLimits{MaxFiles: intPtr(2), MaxTotalSize: int64Ptr(100)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一个文件：单文件上限80
+	limit, err := d.Reserve(ctx, shareID)
+	if err != nil || limit != 80 {
+		t.Fatalf("Reserve = %d, %v; want 80", limit, err)
+	}
+	if err := d.Commit(ctx, shareID, 70); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二个文件：总量只剩30
+	limit, err = d.Reserve(ctx, shareID)
+	if err != nil || limit != 30 {
+		t.Fatalf("Reserve = %d, %v; want 30", limit, err)
+	}
+	// 并发上传使总量超限时提交失败，调用方归还名额
+	if err := d.Commit(ctx, shareID, 31); !errors.Is(err, ErrUploadLimitReached) {
+		t.Fatalf("Commit over total = %v, want ErrUploadLimitReached", err)
+	}
+	if err := d.Release(ctx, shareID); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	status, err := d.Status(ctx, shareID)
+	if err != nil || status.UploadCount != 1 || status.UploadBytes != 70 {
+		t.Fatalf("status = %+v, %v; want 1 file, 70 bytes", status, err)
+	}
+
+	if _, err := d.Reserve(ctx, shareID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Commit(ctx, shareID, 30); err != nil {
+		t.Fatal(err)
+	}
+	// 文件数已满
+	if _, err := d.Reserve(ctx, shareID); !errors.Is(err, ErrUploadLimitReached) {
+		t.Errorf("Reserve over max files = %v, want ErrUploadLimitReached", err)
+	}
+}
+
+// TestDropBoxRelease 归还名额不会使计数小于0
+func TestDropBoxRelease(t *testing.T) {
+	d, shareID, _ := newTestDropBox(t, config.ShareUploadConfig{})
+	ctx := context.Background()
+
+	limit, err := d.Reserve(ctx, shareID)
+	if err != nil || limit != -1 {
+		t.Fatalf("Reserve = %d, %v; want unlimited", limit, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := d.Release(ctx, shareID); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+	}
+	status, err := d.Status(ctx, shareID)
+	if err != nil || status.UploadCount != 0 {
+		t.Errorf("upload count = %+v, %v; want 0", status, err)
+	}
+}
@@ -0,0 +1,48 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// shareColumns 查询分享时的列，顺序与scanShare一致。包含停用时间和原因，
+// 通过令牌访问时据此拒绝已被清理任务停用的分享
+const shareColumns = `id, user_id, file_path, share_token, COALESCE(share_name, ''), COALESCE(password_hash, ''),
+	expires_at, max_downloads, COALESCE(download_count, 0), COALESCE(permissions, 'read'),
+	created_at, disabled_at, COALESCE(disabled_reason, '')`
+
+// rowScanner *sql.Row和*sql.Rows的共同部分
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanShare 读取按shareColumns查询的一行
+func scanShare(row rowScanner) (*models.FileShare, error) {
+	fs := &models.FileShare{}
+	var maxDownloads sql.NullInt64
+	if err := row.Scan(&fs.ID, &fs.UserID, &fs.FilePath, &fs.ShareToken, &fs.ShareName, &fs.PasswordHash,
+		&fs.ExpiresAt, &maxDownloads, &fs.DownloadCount, &fs.Permissions,
+		&fs.CreatedAt, &fs.DisabledAt, &fs.DisabledReason); err != nil {
+		return nil, err
+	}
+	if maxDownloads.Valid {
+		n := int(maxDownloads.Int64)
+		fs.MaxDownloads = &n
+	}
+	return fs, nil
+}
+
+// shareByToken 按令牌查询分享，不检查是否过期或停用；不存在时返回ErrShareNotFound
+func shareByToken(ctx context.Context, db *sql.DB, token string) (*models.FileShare, error) {
+	fs, err := scanShare(db.QueryRowContext(ctx, `SELECT `+shareColumns+` FROM file_shares WHERE share_token = $1`, token))
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return fs, nil
+}
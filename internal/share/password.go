@@ -0,0 +1,143 @@
+package share
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+)
+
+// maxPasswordBytes bcrypt只使用密码的前72字节，更长的密码会被拒绝
+const maxPasswordBytes = 72
+
+var (
+	// ErrInvalidPassword 分享密码错误
+	ErrInvalidPassword = Error("invalid password")
+	// ErrWeakPassword 分享密码不满足share.password的复杂度要求
+	ErrWeakPassword = Error("share password does not meet the password policy")
+)
+
+// CheckPassword 按复杂度要求检查新的分享密码，返回的错误包装ErrWeakPassword并说明未满足的要求。
+// 空密码表示分享不设密码，不做检查
+func CheckPassword(policy config.SharePasswordConfig, password string) error {
+	if password == "" {
+		return nil
+	}
+	var problems []string
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("at most %d bytes", maxPasswordBytes))
+	}
+	if policy.MinLength > 0 && utf8.RuneCountInString(password) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", policy.MinLength))
+	}
+
+	var letter, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if policy.RequireLetter && !letter {
+		problems = append(problems, "a letter")
+	}
+	if policy.RequireDigit && !digit {
+		problems = append(problems, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		problems = append(problems, "a symbol")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: requires %s", ErrWeakPassword, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// HashPassword 生成分享密码的哈希，与用户密码使用相同的算法（见cryptopolicy）
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	return cryptopolicy.HashPassword(password)
+}
+
+// VerifyPassword 校验访问者提交的分享密码，分享未设密码时总是通过。
+// 尚未迁移的明文密码以常数时间比较，启动时的MigratePasswords会把它们改为哈希
+func VerifyPassword(passwordHash, password string) error {
+	if passwordHash == "" {
+		return nil
+	}
+	if !cryptopolicy.IsHash(passwordHash) {
+		if subtle.ConstantTimeCompare([]byte(passwordHash), []byte(password)) != 1 {
+			return ErrInvalidPassword
+		}
+		return nil
+	}
+	err := cryptopolicy.ComparePassword(passwordHash, password)
+	if errors.Is(err, cryptopolicy.ErrPasswordMismatch) {
+		return ErrInvalidPassword
+	}
+	return err
+}
+
+// MigratePasswords 把file_shares.password_hash中以明文保存的早期分享密码改为哈希，返回迁移的分享数。
+// 更新以原值为条件，多副本同时启动时不会重复哈希；无法哈希的密码记录警告后跳过
+func MigratePasswords(ctx context.Context, db *sql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, password_hash FROM file_shares WHERE password_hash IS NOT NULL AND password_hash <> ''`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list share passwords: %w", err)
+	}
+	type legacyPassword struct {
+		id       uuid.UUID
+		password string
+	}
+	var legacy []legacyPassword
+	for rows.Next() {
+		var p legacyPassword
+		if err := rows.Scan(&p.id, &p.password); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan share password: %w", err)
+		}
+		if !cryptopolicy.IsHash(p.password) {
+			legacy = append(legacy, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, p := range legacy {
+		hash, err := cryptopolicy.HashPassword(p.password)
+		if err != nil {
+			// 超过72字节的旧密码bcrypt无法哈希，保持明文直到分享者修改密码
+			log.Printf("Warning: failed to hash password of share %s: %v", p.id, err)
+			continue
+		}
+		result, err := db.ExecContext(ctx, `UPDATE file_shares SET password_hash = $1 WHERE id = $2 AND password_hash = $3`,
+			hash, p.id, p.password)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate password of share %s: %w", p.id, err)
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,74 @@
+package share
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestCheckPassword(t *testing.T) {
+	policy := config.SharePasswordConfig{MinLength: 8, RequireLetter: true, RequireDigit: true}
+	tests := []struct {
+		password string
+		problem  string
+	}{
+		{"", ""},
+		{"summer2024", ""},
+		{"密码安全测试2024", ""},
+		{"abc1", "at least 8 characters"},
+		{"12345678", "a letter"},
+		{"password", "a digit"},
+		{strings.Repeat("a1", 37), "at most 72 bytes"},
+	}
+	for _, tt := range tests {
+		err := CheckPassword(policy, tt.password)
+		if tt.problem == "" {
+			if err != nil {
+				t.Errorf("CheckPassword(%q) = %v, want nil", tt.password, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrWeakPassword) || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("CheckPassword(%q) = %v, want ErrWeakPassword mentioning %q", tt.password, err, tt.problem)
+		}
+	}
+
+	symbols := config.SharePasswordConfig{RequireSymbol: true}
+	if err := CheckPassword(symbols, "abc123"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("CheckPassword without symbol = %v, want ErrWeakPassword", err)
+	}
+	if err := CheckPassword(symbols, "abc-123"); err != nil {
+		t.Errorf("CheckPassword with symbol = %v, want nil", err)
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("summer2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "summer2024" {
+		t.Fatal("HashPassword returned the plaintext")
+	}
+
+	tests := []struct {
+		stored, password string
+		want             error
+	}{
+		{"", "", nil},
+		{"", "anything", nil},
+		{hash, "summer2024", nil},
+		{hash, "winter2024", ErrInvalidPassword},
+		{hash, "", ErrInvalidPassword},
+		// 尚未迁移的明文密码
+		{"legacy-pass", "legacy-pass", nil},
+		{"legacy-pass", "legacy", ErrInvalidPassword},
+	}
+	for _, tt := range tests {
+		if err := VerifyPassword(tt.stored, tt.password); err != tt.want {
+			t.Errorf("VerifyPassword(%q, %q) = %v, want %v", tt.stored, tt.password, err, tt.want)
+		}
+	}
+}
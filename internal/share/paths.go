@@ -0,0 +1,37 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Execer *sql.DB或*sql.Tx，使分享路径可以与其他表在同一事务中更新
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// RewritePaths 目录改名后将指向该目录及其下文件的分享改为新路径，返回更新的分享数。
+// 分享路径可能带或不带开头的/，两种写法都会更新并保持原有写法
+func RewritePaths(ctx context.Context, exec Execer, userID uuid.UUID, srcPath, dstPath string) (int64, error) {
+	src, dst := path.Clean("/"+srcPath), path.Clean("/"+dstPath)
+	forms := [][2]string{{src, dst}, {strings.TrimPrefix(src, "/"), strings.TrimPrefix(dst, "/")}}
+
+	var total int64
+	for _, form := range forms {
+		res, err := exec.ExecContext(ctx, `
+			UPDATE file_shares SET file_path = $1 || substr(file_path, length($2) + 1)
+			WHERE user_id = $3 AND (file_path = $2 OR substr(file_path, 1, length($2) + 1) = $2 || '/')`,
+			form[1], form[0], userID)
+		if err != nil {
+			return total, fmt.Errorf("failed to rewrite share paths: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
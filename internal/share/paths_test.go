@@ -0,0 +1,74 @@
+package share
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRewritePaths(t *testing.T) {
+	db, _, _ := newTestShareDB(t)
+	ctx := context.Background()
+	var alice uuid.UUID
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'alice'`).Scan(&alice); err != nil {
+		t.Fatal(err)
+	}
+	bob := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, username, email, password_hash) VALUES ($1, 'bob', 'bob@example.com', 'x')`, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	shares := map[string]struct {
+		owner uuid.UUID
+		path  string
+		want  string
+	}{
+		"folder":        {alice, "/docs", "/archive/2024"},
+		"file":          {alice, "/docs/a.txt", "/archive/2024/a.txt"},
+		"nested":        {alice, "/docs/sub/b.txt", "/archive/2024/sub/b.txt"},
+		"no slash":      {alice, "docs/c.txt", "archive/2024/c.txt"},
+		"similar name":  {alice, "/docs2/d.txt", "/docs2/d.txt"},
+		"parent":        {alice, "/", "/"},
+		"other user":    {bob, "/docs/a.txt", "/docs/a.txt"},
+		"unicode below": {alice, "/docs/报告.pdf", "/archive/2024/报告.pdf"},
+	}
+	for token, s := range shares {
+		if _, err := db.Exec(`INSERT INTO file_shares (id, user_id, file_path, share_token) VALUES ($1, $2, $3, $4)`,
+			uuid.New(), s.owner, s.path, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := RewritePaths(ctx, db, alice, "/docs/", "archive/2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("RewritePaths updated %d shares, want 5", n)
+	}
+	for token, s := range shares {
+		var got string
+		if err := db.QueryRow(`SELECT file_path FROM file_shares WHERE share_token = $1`, token).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != s.want {
+			t.Errorf("%s: file_path = %q, want %q", token, got, s.want)
+		}
+	}
+
+	// 在事务中执行，回滚后路径不变
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RewritePaths(ctx, tx, alice, "/archive", "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	var got string
+	db.QueryRow(`SELECT file_path FROM file_shares WHERE share_token = 'file'`).Scan(&got)
+	if got != "/archive/2024/a.txt" {
+		t.Errorf("after rollback file_path = %q", got)
+	}
+}
@@ -0,0 +1,231 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// 分享停用原因
+const (
+	// ReasonExpired 超过有效期
+	ReasonExpired = "expired"
+	// ReasonDownloadLimit 下载次数已用尽
+	ReasonDownloadLimit = "download_limit"
+	// ReasonAccountDeleted 分享者已注销账户，恢复账户时重新启用
+	ReasonAccountDeleted = "account_deleted"
+)
+
+// 分享列表的状态筛选
+const (
+	StatusAll     = "all"
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
+// ErrInvalidStatus 不支持的状态筛选
+var ErrInvalidStatus = Error("status must be all, active or expired")
+
+// 清理动作
+const (
+	ActionDisabled = "share.disabled"
+	ActionDeleted  = "share.deleted"
+)
+
+// unavailableCondition 已过期或下载次数已用尽的分享
+const unavailableCondition = `((expires_at IS NOT NULL AND expires_at <= NOW())
+	OR (max_downloads IS NOT NULL AND max_downloads > 0 AND COALESCE(download_count, 0) >= max_downloads))`
+
+// ReapEvent 清理任务对一个分享执行的操作，用于审计
+type ReapEvent struct {
+	Action     string
+	ShareID    uuid.UUID
+	UserID     uuid.UUID
+	ShareToken string
+	FilePath   string
+	Reason     string
+	Time       time.Time
+}
+
+// Auditor 接收清理事件
+type Auditor func(ctx context.Context, event ReapEvent)
+
+// Reaper 定期停用已过期或下载次数用尽的分享，并在保留期过后删除它们。
+// 停用使用单条UPDATE ... RETURNING，多副本同时运行时每个分享只会产生一次事件
+type Reaper struct {
+	db       *sql.DB
+	config   config.ShareCleanupConfig
+	auditor  Auditor
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReaper 创建过期分享清理器，默认将事件写入日志
+func NewReaper(db *sql.DB, cfg config.ShareCleanupConfig) *Reaper {
+	return &Reaper{
+		db:      db,
+		config:  cfg,
+		auditor: logReapEvent,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetAuditor 设置清理事件的接收者
+func (r *Reaper) SetAuditor(auditor Auditor) {
+	if auditor != nil {
+		r.auditor = auditor
+	}
+}
+
+// Initialize 为file_shares表添加停用列
+func (r *Reaper) Initialize(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP`,
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS disabled_reason VARCHAR(20)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_shares_disabled_at ON file_shares(disabled_at) WHERE disabled_at IS NOT NULL`,
+	}
+	for _, stmt := range statements {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize share cleanup columns: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start 启动后台清理任务，interval不大于0时不启动
+func (r *Reaper) Start() {
+	if r.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				disabled, deleted, err := r.Reap(context.Background())
+				if err != nil {
+					log.Printf("Warning: share cleanup failed: %v", err)
+				} else if disabled > 0 || deleted > 0 {
+					log.Printf("Share cleanup disabled %d and deleted %d shares", disabled, deleted)
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理任务
+func (r *Reaper) Stop() {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+}
+
+// Reap 执行一次清理：停用不再可用的分享，删除停用超过保留期的分享
+func (r *Reaper) Reap(ctx context.Context) (disabled, deleted int, err error) {
+	disabled, err = r.run(ctx, ActionDisabled, `
+		UPDATE file_shares
+		SET disabled_at = NOW(),
+			disabled_reason = CASE WHEN expires_at IS NOT NULL AND expires_at <= NOW() THEN $1 ELSE $2 END
+		WHERE disabled_at IS NULL AND `+unavailableCondition+`
+		RETURNING id, user_id, share_token, file_path, disabled_reason`,
+		ReasonExpired, ReasonDownloadLimit)
+	if err != nil {
+		return disabled, 0, fmt.Errorf("failed to disable shares: %w", err)
+	}
+
+	// 因注销账户停用的分享在恢复账户时重新启用，随账户一起删除
+	deleted, err = r.run(ctx, ActionDeleted, `
+		DELETE FROM file_shares
+		WHERE disabled_at IS NOT NULL AND disabled_at <= $1
+			AND COALESCE(disabled_reason, '') <> $2
+		RETURNING id, user_id, share_token, file_path, disabled_reason`,
+		time.Now().UTC().Add(-r.config.Retention), ReasonAccountDeleted)
+	if err != nil {
+		return disabled, deleted, fmt.Errorf("failed to delete shares: %w", err)
+	}
+	return disabled, deleted, nil
+}
+
+// run 执行返回被处理分享的语句，并为每行发出审计事件
+func (r *Reaper) run(ctx context.Context, action, query string, args ...interface{}) (int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var events []ReapEvent
+	now := time.Now()
+	for rows.Next() {
+		event := ReapEvent{Action: action, Time: now}
+		var reason sql.NullString
+		if err := rows.Scan(&event.ShareID, &event.UserID, &event.ShareToken, &event.FilePath, &reason); err != nil {
+			return len(events), err
+		}
+		event.Reason = reason.String
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return len(events), err
+	}
+
+	for _, event := range events {
+		r.auditor(ctx, event)
+	}
+	return len(events), nil
+}
+
+// ListShares 按状态列出用户的分享。expired包括已停用、已过期和下载次数用尽但尚未被清理的分享
+func (r *Reaper) ListShares(ctx context.Context, userID uuid.UUID, status string) ([]*models.FileShare, error) {
+	var condition string
+	switch status {
+	case StatusAll:
+		condition = "TRUE"
+	case StatusActive:
+		condition = "disabled_at IS NULL AND NOT " + unavailableCondition
+	case StatusExpired:
+		condition = "(disabled_at IS NOT NULL OR " + unavailableCondition + ")"
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+shareColumns+`
+		FROM file_shares
+		WHERE user_id = $1 AND `+condition+`
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*models.FileShare{}
+	for rows.Next() {
+		fs, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, fs)
+	}
+	return shares, rows.Err()
+}
+
+// Disabled 判断分享是否已被清理任务停用
+func Disabled(fileShare *models.FileShare) bool {
+	return fileShare.DisabledAt != nil
+}
+
+func logReapEvent(_ context.Context, event ReapEvent) {
+	log.Printf("Audit: %s share=%s user=%s path=%s reason=%s", event.Action, event.ShareID, event.UserID, event.FilePath, event.Reason)
+}
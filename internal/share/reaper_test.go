@@ -0,0 +1,190 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// testShare 插入file_shares的一行，零值的列保持NULL
+type testShare struct {
+	token          string
+	expiresAt      time.Time
+	maxDownloads   int
+	downloads      int
+	disabledAt     time.Time
+	disabledReason string
+}
+
+func insertTestShare(t *testing.T, db *sql.DB, userID uuid.UUID, s testShare) uuid.UUID {
+	t.Helper()
+	nullTime := func(v time.Time) interface{} {
+		if v.IsZero() {
+			return nil
+		}
+		return v.UTC()
+	}
+	var maxDownloads, reason interface{}
+	if s.maxDownloads > 0 {
+		maxDownloads = s.maxDownloads
+	}
+	if s.disabledReason != "" {
+		reason = s.disabledReason
+	}
+	id := uuid.New()
+	if _, err := db.ExecContext(context.Background(), `
+		INSERT INTO file_shares (id, user_id, file_path, share_token, expires_at, max_downloads, download_count, disabled_at, disabled_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		id, userID, "/"+s.token, s.token, nullTime(s.expiresAt), maxDownloads, s.downloads, nullTime(s.disabledAt), reason); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newTestReaper 在newTestShareDB的数据库上创建清理器，停用的分享保留一天
+func newTestReaper(t *testing.T) (*Reaper, *sql.DB, uuid.UUID, *[]ReapEvent) {
+	t.Helper()
+	db, _, _ := newTestShareDB(t)
+	var userID uuid.UUID
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'alice'`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReaper(db, config.ShareCleanupConfig{Retention: 24 * time.Hour})
+	if err := r.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	events := &[]ReapEvent{}
+	r.SetAuditor(func(_ context.Context, event ReapEvent) { *events = append(*events, event) })
+	return r, db, userID, events
+}
+
+func TestReaperReap(t *testing.T) {
+	r, db, userID, events := newTestReaper(t)
+	ctx := context.Background()
+	now := time.Now()
+	insertTestShare(t, db, userID, testShare{token: "active", expiresAt: now.Add(time.Hour), maxDownloads: 5, downloads: 4})
+	insertTestShare(t, db, userID, testShare{token: "expired", expiresAt: now.Add(-time.Hour)})
+	insertTestShare(t, db, userID, testShare{token: "exhausted", maxDownloads: 2, downloads: 2})
+	insertTestShare(t, db, userID, testShare{token: "recent", disabledAt: now.Add(-time.Hour), disabledReason: ReasonExpired})
+	insertTestShare(t, db, userID, testShare{token: "old", disabledAt: now.Add(-48 * time.Hour), disabledReason: ReasonDownloadLimit})
+	// 因注销账户停用的分享等待恢复账户，不按保留期删除
+	insertTestShare(t, db, userID, testShare{token: "deleted-account", disabledAt: now.Add(-48 * time.Hour), disabledReason: ReasonAccountDeleted})
+
+	disabled, deleted, err := r.Reap(ctx)
+	if err != nil {
+		t.Fatalf("Reap: %v", err)
+	}
+	if disabled != 2 || deleted != 1 {
+		t.Errorf("Reap = %d disabled, %d deleted; want 2, 1", disabled, deleted)
+	}
+
+	var got []string
+	for _, event := range *events {
+		got = append(got, event.Action+":"+event.ShareToken+":"+event.Reason)
+	}
+	sort.Strings(got)
+	want := []string{
+		ActionDeleted + ":old:" + ReasonDownloadLimit,
+		ActionDisabled + ":exhausted:" + ReasonDownloadLimit,
+		ActionDisabled + ":expired:" + ReasonExpired,
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	// 再次执行不会重复停用
+	*events = nil
+	if disabled, deleted, err := r.Reap(ctx); err != nil || disabled != 0 || deleted != 0 {
+		t.Errorf("second Reap = %d, %d, %v; want nothing to do", disabled, deleted, err)
+	}
+
+	if _, err := shareByToken(ctx, db, "old"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("deleted share lookup = %v, want ErrShareNotFound", err)
+	}
+	for token, wantDisabled := range map[string]bool{"active": false, "expired": true, "exhausted": true, "deleted-account": true} {
+		fs, err := shareByToken(ctx, db, token)
+		if err != nil {
+			t.Fatalf("shareByToken(%s): %v", token, err)
+		}
+		if Disabled(fs) != wantDisabled {
+			t.Errorf("share %s disabled = %v, want %v", token, Disabled(fs), wantDisabled)
+		}
+	}
+}
+
+// TestShareByTokenDisabled 按令牌查询时带出停用时间和原因，供访问接口拒绝已停用的分享
+func TestShareByTokenDisabled(t *testing.T) {
+	_, db, userID, _ := newTestReaper(t)
+	disabledAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	id := insertTestShare(t, db, userID, testShare{token: "gone", maxDownloads: 3, downloads: 3, disabledAt: disabledAt, disabledReason: ReasonDownloadLimit})
+
+	fs, err := shareByToken(context.Background(), db, "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.ID != id || fs.UserID != userID || fs.FilePath != "/gone" || fs.Permissions != "read" {
+		t.Errorf("share = %+v", fs)
+	}
+	if fs.MaxDownloads == nil || *fs.MaxDownloads != 3 || fs.DownloadCount != 3 {
+		t.Errorf("downloads = %v/%d, want 3/3", fs.MaxDownloads, fs.DownloadCount)
+	}
+	if fs.DisabledAt == nil || !fs.DisabledAt.Equal(disabledAt) || fs.DisabledReason != ReasonDownloadLimit {
+		t.Errorf("disabled = %v %q, want %v %q", fs.DisabledAt, fs.DisabledReason, disabledAt, ReasonDownloadLimit)
+	}
+
+	if _, err := shareByToken(context.Background(), db, "missing"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("missing token = %v, want ErrShareNotFound", err)
+	}
+}
+
+func TestReaperListShares(t *testing.T) {
+	r, db, userID, _ := newTestReaper(t)
+	now := time.Now()
+	insertTestShare(t, db, userID, testShare{token: "active"})
+	// 已过期但尚未被清理任务停用的分享也算作expired
+	insertTestShare(t, db, userID, testShare{token: "expired", expiresAt: now.Add(-time.Hour)})
+	insertTestShare(t, db, userID, testShare{token: "disabled", disabledAt: now, disabledReason: ReasonExpired})
+
+	tests := []struct {
+		status  string
+		want    []string
+		wantErr error
+	}{
+		{StatusAll, []string{"active", "disabled", "drop-", "expired"}, nil},
+		{StatusActive, []string{"active", "drop-"}, nil},
+		{StatusExpired, []string{"disabled", "expired"}, nil},
+		{"deleted", nil, ErrInvalidStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			shares, err := r.ListShares(context.Background(), userID, tt.status)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ListShares error = %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, fs := range shares {
+				token := fs.ShareToken
+				if strings.HasPrefix(token, "drop-") {
+					token = "drop-"
+				}
+				got = append(got, token)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListShares(%s) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+
+	if shares, err := r.ListShares(context.Background(), uuid.New(), StatusAll); err != nil || len(shares) != 0 {
+		t.Errorf("other user's shares = %v, %v; want none", shares, err)
+	}
+}
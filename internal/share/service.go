@@ -1,195 +1,163 @@
 package share
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
 	"github.com/webdav-gateway/internal/models"
 )
 
-// Service 共享服务
+// tokenBytes 分享令牌的随机字节数，十六进制编码后与share_token列长度（64）一致
+const tokenBytes = 32
+
+// Service 文件分享服务，分享保存在file_shares表中
 type Service struct {
-	shareRepo models.ShareRepository
+	db     *sql.DB
+	config *config.Config
 }
 
-// NewService 创建共享服务
-func NewService(shareRepo models.ShareRepository) *Service {
+// NewService 创建分享服务
+func NewService(db *sql.DB, cfg *config.Config) *Service {
 	return &Service{
-		shareRepo: shareRepo,
-	}
-}
-
-// CreateShareRequest 创建共享请求
-type CreateShareRequest struct {
-	Name         string     `json:"name"`
-	Path         string     `json:"path"`
-	Password     string     `json:"password,omitempty"`
-	ExpiresAt    *int64     `json:"expires_at,omitempty"`
-	MaxDownloads int        `json:"max_downloads,omitempty"`
-	CreatedBy    string     `json:"created_by"`
-}
-
-// CreateShare 创建共享
-func (s *Service) CreateShare(req CreateShareRequest) (*models.Share, error) {
-	// 验证请求
-	if req.Name == "" {
-		return nil, ErrInvalidRequest
-	}
-	if req.Path == "" {
-		return nil, ErrInvalidRequest
-	}
-	if req.CreatedBy == "" {
-		return nil, ErrInvalidRequest
-	}
-
-	// 检查名称是否已存在
-	if _, err := s.shareRepo.GetByName(req.Name); err == nil {
-		return nil, ErrShareNameExists
-	}
-
-	// 创建共享
-	share := &models.Share{
-		ID:           uuid.New().String(),
-		Name:         req.Name,
-		Path:         req.Path,
-		Password:     req.Password,
-		MaxDownloads: req.MaxDownloads,
-		CreatedBy:    req.CreatedBy,
-		CreatedAt:    time.Now(),
-	}
-
-	if req.ExpiresAt != nil {
-		expiresAt := time.Unix(*req.ExpiresAt, 0)
-		share.ExpiresAt = &expiresAt
-	}
-
-	if err := s.shareRepo.Create(share); err != nil {
-		return nil, err
+		db:     db,
+		config: cfg,
 	}
-
-	return share, nil
 }
 
-// GetUserShares 获取用户的共享列表
-func (s *Service) GetUserShares(userID string, page, limit int) ([]models.Share, int, error) {
-	shares, err := s.shareRepo.GetByUserID(userID)
+// CreateShare 为用户的文件或目录创建分享。密码只保存哈希，不通过接口返回
+func (s *Service) CreateShare(ctx context.Context, userID uuid.UUID, req *models.CreateShareRequest) (*models.CreateShareResponse, error) {
+	token, err := newShareToken()
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-
-	total, err := s.shareRepo.CountByUser(userID)
+	passwordHash, err := HashPassword(req.Password)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// 分页处理（简化实现）
-	start := (page - 1) * limit
-	end := start + limit
-	if start >= len(shares) {
-		return []models.Share{}, total, nil
+	var expiresAt *time.Time
+	if req.ExpiresIn > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresIn) * time.Hour)
+		expiresAt = &t
 	}
-	if end > len(shares) {
-		end = len(shares)
+	permissions := req.Permissions
+	if permissions == "" {
+		permissions = PermissionRead
 	}
 
-	return shares[start:end], total, nil
-}
-
-// GetShare 获取共享
-func (s *Service) GetShare(id string) (*models.Share, error) {
-	share, err := s.shareRepo.GetByID(id)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO file_shares (id, user_id, file_path, share_token, share_name, password_hash, expires_at, max_downloads, permissions, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10)`,
+		uuid.New(), userID, req.FilePath, token, req.ShareName, passwordHash, expiresAt, req.MaxDownloads, permissions, time.Now().UTC())
 	if err != nil {
-		return nil, ErrShareNotFound
+		return nil, fmt.Errorf("failed to create share: %w", err)
 	}
 
-	// 检查是否过期
-	if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
-		return nil, ErrShareExpired
-	}
-
-	// 检查是否激活
-	if !share.IsActive {
-		return nil, ErrShareInactive
-	}
+	return &models.CreateShareResponse{
+		ShareURL:   strings.TrimRight(s.config.Share.ShortLinks.PublicURL, "/") + "/share/" + token,
+		ShareToken: token,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
 
-	// 检查下载次数限制
-	if share.MaxDownloads > 0 && share.DownloadCount >= share.MaxDownloads {
-		return nil, ErrShareDownloadLimitExceeded
+// newShareToken 生成随机的分享令牌
+func newShareToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
 	}
-
-	return share, nil
+	return hex.EncodeToString(b), nil
 }
 
-// UpdateShareRequest 更新共享请求
-type UpdateShareRequest struct {
-	Name         string `json:"name,omitempty"`
-	Password     string `json:"password,omitempty"`
-	ExpiresAt    *int64 `json:"expires_at,omitempty"`
-	MaxDownloads int    `json:"max_downloads,omitempty"`
+// GetShare 按令牌查询分享，不校验密码、有效期和下载次数
+func (s *Service) GetShare(ctx context.Context, token string) (*models.FileShare, error) {
+	return shareByToken(ctx, s.db, token)
 }
 
-// UpdateShare 更新共享
-func (s *Service) UpdateShare(id, userID string, req UpdateShareRequest) (*models.Share, error) {
-	share, err := s.shareRepo.GetByID(id)
+// ListUserShares 列出用户的全部分享，最近创建的在前
+func (s *Service) ListUserShares(ctx context.Context, userID uuid.UUID) ([]*models.FileShare, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+shareColumns+`
+		FROM file_shares
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
 	if err != nil {
-		return nil, ErrShareNotFound
+		return nil, fmt.Errorf("failed to list shares: %w", err)
 	}
+	defer rows.Close()
 
-	// 检查权限
-	if share.CreatedBy != userID {
-		return nil, ErrUnauthorized
+	shares := []*models.FileShare{}
+	for rows.Next() {
+		fs, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, fs)
 	}
+	return shares, rows.Err()
+}
 
-	// 更新字段
-	if req.Name != "" {
-		share.Name = req.Name
-	}
-	if req.Password != "" {
-		share.Password = req.Password
-	}
-	if req.ExpiresAt != nil {
-		expiresAt := time.Unix(*req.ExpiresAt, 0)
-		share.ExpiresAt = &expiresAt
+// DeleteShare 删除用户的分享，分享不存在或不属于该用户时返回ErrShareNotFound
+func (s *Service) DeleteShare(ctx context.Context, shareID, userID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM file_shares WHERE id = $1 AND user_id = $2`, shareID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete share: %w", err)
 	}
-	if req.MaxDownloads >= 0 {
-		share.MaxDownloads = req.MaxDownloads
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrShareNotFound
 	}
+	return nil
+}
 
-	if err := s.shareRepo.Update(share); err != nil {
-		return nil, err
+// IncrementDownloadCount 分享的下载次数加一
+func (s *Service) IncrementDownloadCount(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE file_shares SET download_count = COALESCE(download_count, 0) + 1 WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to update download count: %w", err)
 	}
-
-	return share, nil
+	return nil
 }
 
-// DeleteShare 删除共享
-func (s *Service) DeleteShare(id, userID string) error {
-	share, err := s.shareRepo.GetByID(id)
+// ValidateShareAccess 校验访问者能否使用分享：分享存在、未过期、下载次数未用尽且密码正确（见VerifyPassword）。
+// 已被清理任务停用的分享同样返回，由调用方按停用原因拒绝
+func (s *Service) ValidateShareAccess(ctx context.Context, token, password string) (*models.FileShare, error) {
+	fileShare, err := shareByToken(ctx, s.db, token)
 	if err != nil {
-		return ErrShareNotFound
+		return nil, err
 	}
-
-	// 检查权限
-	if share.CreatedBy != userID {
-		return ErrUnauthorized
+	if fileShare.ExpiresAt != nil && !time.Now().Before(*fileShare.ExpiresAt) {
+		return nil, ErrShareExpired
 	}
-
-	return s.shareRepo.Delete(id)
+	if fileShare.MaxDownloads != nil && *fileShare.MaxDownloads > 0 && fileShare.DownloadCount >= *fileShare.MaxDownloads {
+		return nil, ErrMaxDownloads
+	}
+	if err := VerifyPassword(fileShare.PasswordHash, password); err != nil {
+		return nil, err
+	}
+	return fileShare, nil
 }
 
 // 错误定义
 var (
-	ErrInvalidRequest              = Error("invalid request")
-	ErrShareNameExists            = Error("share name already exists")
-	ErrShareNotFound              = Error("share not found")
-	ErrShareExpired               = Error("share has expired")
-	ErrShareInactive              = Error("share is inactive")
-	ErrShareDownloadLimitExceeded = Error("share download limit exceeded")
-	ErrUnauthorized               = Error("unauthorized")
+	// ErrShareNotFound 分享不存在
+	ErrShareNotFound = Error("share not found")
+	// ErrShareExpired 分享已过期
+	ErrShareExpired = Error("share has expired")
+	// ErrMaxDownloads 分享的下载次数已用尽
+	ErrMaxDownloads = Error("maximum downloads reached")
 )
 
+// Error 分享服务的错误
 type Error string
 
 func (e Error) Error() string {
 	return string(e)
-}
\ No newline at end of file
+}
@@ -0,0 +1,203 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/cryptopolicy"
+	"github.com/webdav-gateway/internal/models"
+)
+
+func newTestService(t *testing.T) (*Service, uuid.UUID) {
+	t.Helper()
+	db, _, _ := newTestShareDB(t)
+	var userID uuid.UUID
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'alice'`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Share: config.ShareConfig{ShortLinks: config.ShareShortLinkConfig{PublicURL: "https://dav.example.com/"}}}
+	return NewService(db, cfg), userID
+}
+
+func TestServiceCreateShare(t *testing.T) {
+	s, userID := newTestService(t)
+	ctx := context.Background()
+	maxDownloads := 3
+
+	resp, err := s.CreateShare(ctx, userID, &models.CreateShareRequest{
+		FilePath: "/docs/report.pdf", ShareName: "Report", Password: "summer2024", ExpiresIn: 24, MaxDownloads: &maxDownloads,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ShareToken) != 2*tokenBytes || resp.ShareURL != "https://dav.example.com/share/"+resp.ShareToken {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.ExpiresAt == nil || time.Until(*resp.ExpiresAt) < 23*time.Hour {
+		t.Errorf("expires at %v, want in 24 hours", resp.ExpiresAt)
+	}
+
+	fileShare, err := s.GetShare(ctx, resp.ShareToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileShare.UserID != userID || fileShare.FilePath != "/docs/report.pdf" || fileShare.ShareName != "Report" ||
+		fileShare.Permissions != PermissionRead || fileShare.MaxDownloads == nil || *fileShare.MaxDownloads != 3 {
+		t.Errorf("share = %+v", fileShare)
+	}
+	// 密码只保存哈希，也不会出现在JSON中
+	if !cryptopolicy.IsHash(fileShare.PasswordHash) || fileShare.PasswordHash == "summer2024" {
+		t.Errorf("password stored as %q, want a hash", fileShare.PasswordHash)
+	}
+	body, _ := json.Marshal(fileShare)
+	if strings.Contains(string(body), fileShare.PasswordHash) || strings.Contains(string(body), "summer2024") {
+		t.Errorf("share JSON exposes the password: %s", body)
+	}
+
+	// 不设密码、有效期和下载次数
+	open, err := s.CreateShare(ctx, userID, &models.CreateShareRequest{FilePath: "/inbox", Permissions: PermissionDrop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.ExpiresAt != nil || open.ShareToken == resp.ShareToken {
+		t.Errorf("response = %+v", open)
+	}
+	if fileShare, err := s.GetShare(ctx, open.ShareToken); err != nil || fileShare.PasswordHash != "" ||
+		fileShare.MaxDownloads != nil || fileShare.Permissions != PermissionDrop {
+		t.Errorf("share = %+v, %v", fileShare, err)
+	}
+
+	if _, err := s.GetShare(ctx, "missing"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("GetShare(missing) = %v, want ErrShareNotFound", err)
+	}
+}
+
+func TestServiceValidateShareAccess(t *testing.T) {
+	s, userID := newTestService(t)
+	ctx := context.Background()
+	create := func(password string, maxDownloads *int) string {
+		t.Helper()
+		resp, err := s.CreateShare(ctx, userID, &models.CreateShareRequest{FilePath: "/a.txt", Password: password, MaxDownloads: maxDownloads})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.ShareToken
+	}
+
+	hashed := create("summer2024", nil)
+	open := create("", nil)
+	// 迁移前以明文保存的密码
+	legacy := create("", nil)
+	if _, err := s.db.Exec(`UPDATE file_shares SET password_hash = 'plain-secret' WHERE share_token = $1`, legacy); err != nil {
+		t.Fatal(err)
+	}
+	expired := create("", nil)
+	if _, err := s.db.Exec(`UPDATE file_shares SET expires_at = $1 WHERE share_token = $2`, time.Now().UTC().Add(-time.Minute), expired); err != nil {
+		t.Fatal(err)
+	}
+	one := 1
+	limited := create("", &one)
+	unlimited := create("", new(int))
+	stored, err := s.GetShare(ctx, hashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		want     error
+	}{
+		{"hashed password", hashed, "summer2024", nil},
+		{"wrong password", hashed, "winter2024", ErrInvalidPassword},
+		{"missing password", hashed, "", ErrInvalidPassword},
+		{"hash submitted as password", hashed, stored.PasswordHash, ErrInvalidPassword},
+		{"no password", open, "", nil},
+		{"no password ignores input", open, "anything", nil},
+		{"legacy plaintext", legacy, "plain-secret", nil},
+		{"legacy plaintext wrong", legacy, "plain", ErrInvalidPassword},
+		{"expired", expired, "", ErrShareExpired},
+		{"downloads left", limited, "", nil},
+		{"zero means unlimited", unlimited, "", nil},
+		{"not found", "missing", "", ErrShareNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileShare, err := s.ValidateShareAccess(ctx, tt.token, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateShareAccess = %v, want %v", err, tt.want)
+			}
+			if err == nil && fileShare.ShareToken != tt.token {
+				t.Errorf("share token = %q, want %q", fileShare.ShareToken, tt.token)
+			}
+		})
+	}
+
+	// 下载次数用尽后拒绝访问
+	fileShare, _ := s.GetShare(ctx, limited)
+	if err := s.IncrementDownloadCount(ctx, fileShare.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateShareAccess(ctx, limited, ""); !errors.Is(err, ErrMaxDownloads) {
+		t.Errorf("after the last download = %v, want ErrMaxDownloads", err)
+	}
+	if fileShare, _ := s.GetShare(ctx, limited); fileShare.DownloadCount != 1 {
+		t.Errorf("download count = %d, want 1", fileShare.DownloadCount)
+	}
+
+	// MigratePasswords改为哈希后原密码仍然有效
+	if _, err := MigratePasswords(ctx, s.db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateShareAccess(ctx, legacy, "plain-secret"); err != nil {
+		t.Errorf("legacy password after migration: %v", err)
+	}
+}
+
+func TestServiceListAndDelete(t *testing.T) {
+	s, userID := newTestService(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for _, p := range []string{"/a.txt", "/b.txt"} {
+		resp, err := s.CreateShare(ctx, userID, &models.CreateShareRequest{FilePath: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, resp.ShareToken)
+	}
+
+	shares, err := s.ListUserShares(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newTestShareDB已为alice创建了一个投递分享
+	if len(shares) != 3 {
+		t.Fatalf("listed %d shares, want 3", len(shares))
+	}
+	if others, err := s.ListUserShares(ctx, uuid.New()); err != nil || others == nil || len(others) != 0 {
+		t.Errorf("shares of another user = %v, %v; want an empty list", others, err)
+	}
+
+	fileShare, _ := s.GetShare(ctx, tokens[0])
+	if err := s.DeleteShare(ctx, fileShare.ID, uuid.New()); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("delete another user's share = %v, want ErrShareNotFound", err)
+	}
+	if err := s.DeleteShare(ctx, fileShare.ID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetShare(ctx, tokens[0]); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("deleted share still found: %v", err)
+	}
+	if err := s.DeleteShare(ctx, fileShare.ID, userID); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("second delete = %v, want ErrShareNotFound", err)
+	}
+}
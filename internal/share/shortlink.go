@@ -0,0 +1,173 @@
+package share
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// maxSlugAttempts 短码冲突时最多重新生成的次数
+const maxSlugAttempts = 8
+
+// ErrSlugExhausted 多次生成的短码都已被占用，通常说明短码长度相对分享数量太短
+var ErrSlugExhausted = Error("no free short link slug, increase share.short_links.length")
+
+// ShortLinks 为分享分配/s/:slug短链接。短码用crypto/rand从配置的字符集中生成，
+// 写入时以短码未被占用为条件，冲突（包括并发写入触发的唯一约束错误）时重新生成
+type ShortLinks struct {
+	db     *sql.DB
+	config config.ShareShortLinkConfig
+}
+
+// NewShortLinks 创建短链接生成器
+func NewShortLinks(db *sql.DB, cfg config.ShareShortLinkConfig) *ShortLinks {
+	return &ShortLinks{db: db, config: cfg}
+}
+
+// Enabled 是否启用短链接
+func (s *ShortLinks) Enabled() bool {
+	return s != nil && s.config.Enabled
+}
+
+// PublicURL 配置的对外地址，为空时由调用方按请求生成
+func (s *ShortLinks) PublicURL() string {
+	if s == nil {
+		return ""
+	}
+	return s.config.PublicURL
+}
+
+// Initialize 为file_shares表添加短码列
+func (s *ShortLinks) Initialize(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS short_slug VARCHAR(32)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_file_shares_short_slug ON file_shares(short_slug)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize share short links: %w", err)
+		}
+	}
+	return nil
+}
+
+// Assign 返回分享的短码，尚未分配时生成一个。分享不存在或不属于该用户时返回ErrShareNotFound
+func (s *ShortLinks) Assign(ctx context.Context, userID, shareID uuid.UUID) (string, error) {
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		var current sql.NullString
+		err := s.db.QueryRowContext(ctx, `SELECT short_slug FROM file_shares WHERE id = $1 AND user_id = $2`,
+			shareID, userID).Scan(&current)
+		if err == sql.ErrNoRows {
+			return "", ErrShareNotFound
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to load share: %w", err)
+		}
+		if current.Valid && current.String != "" {
+			return current.String, nil
+		}
+
+		slug, err := s.generate()
+		if err != nil {
+			return "", err
+		}
+		// 短码已被占用时不更新，唯一索引兜底并发分配到同一短码的情况
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE file_shares SET short_slug = $1
+			WHERE id = $2 AND short_slug IS NULL
+			AND NOT EXISTS (SELECT 1 FROM file_shares WHERE short_slug = $1)`, slug, shareID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to assign short link: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			return slug, nil
+		}
+		// 短码冲突，或其他请求已为该分享分配了短码，重新查询后再决定
+	}
+	return "", ErrSlugExhausted
+}
+
+// Path 返回分享的对外路径：启用短链接时为/s/<短码>（尚未分配时生成），否则为/share/<令牌>。
+// 分享不存在或不属于该用户时返回ErrShareNotFound
+func (s *ShortLinks) Path(ctx context.Context, userID, shareID uuid.UUID) (string, error) {
+	if s.Enabled() {
+		slug, err := s.Assign(ctx, userID, shareID)
+		if err != nil {
+			return "", err
+		}
+		return "/s/" + slug, nil
+	}
+
+	var token string
+	err := s.db.QueryRowContext(ctx, `SELECT share_token FROM file_shares WHERE id = $1 AND user_id = $2`,
+		shareID, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", ErrShareNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load share: %w", err)
+	}
+	return "/share/" + token, nil
+}
+
+// Resolve 返回短码对应的分享令牌，不存在时返回ErrShareNotFound
+func (s *ShortLinks) Resolve(ctx context.Context, slug string) (string, error) {
+	if !s.validSlug(slug) {
+		return "", ErrShareNotFound
+	}
+	var token string
+	err := s.db.QueryRowContext(ctx, `SELECT share_token FROM file_shares WHERE short_slug = $1`, slug).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", ErrShareNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve short link: %w", err)
+	}
+	return token, nil
+}
+
+// generate 生成一个随机短码
+func (s *ShortLinks) generate() (string, error) {
+	alphabet := []rune(s.config.Alphabet)
+	base := big.NewInt(int64(len(alphabet)))
+	slug := make([]rune, s.config.Length)
+	for i := range slug {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate short link: %w", err)
+		}
+		slug[i] = alphabet[n.Int64()]
+	}
+	return string(slug), nil
+}
+
+// validSlug 检查短码只包含字符集中的字符，避免无效请求查询数据库
+func (s *ShortLinks) validSlug(slug string) bool {
+	if slug == "" || len(slug) > 32 {
+		return false
+	}
+	for _, r := range slug {
+		if !strings.ContainsRune(s.config.Alphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUniqueViolation 判断是否为唯一约束冲突
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
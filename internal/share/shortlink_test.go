@@ -0,0 +1,45 @@
+package share
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestShortLinkGenerate(t *testing.T) {
+	links := NewShortLinks(nil, config.ShareShortLinkConfig{Enabled: true, Length: 7, Alphabet: "23456789abcdefghjkmnpqrstuvwxyz"})
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		slug, err := links.generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(slug) != 7 {
+			t.Fatalf("generate() = %q, want 7 characters", slug)
+		}
+		if !links.validSlug(slug) {
+			t.Fatalf("generate() = %q, not valid for its own alphabet", slug)
+		}
+		seen[slug] = true
+	}
+	if len(seen) < 95 {
+		t.Errorf("generate() produced only %d distinct slugs out of 100", len(seen))
+	}
+}
+
+func TestShortLinkValidSlug(t *testing.T) {
+	links := NewShortLinks(nil, config.ShareShortLinkConfig{Length: 7, Alphabet: "23456789abcdefghjkmnpqrstuvwxyz"})
+	for slug, want := range map[string]bool{
+		"k7mq2xa":               true,
+		"":                      false,
+		"K7MQ2XA":               false,
+		"k7mq2x0":               false,
+		"../etc":                false,
+		strings.Repeat("a", 33): false,
+	} {
+		if got := links.validSlug(slug); got != want {
+			t.Errorf("validSlug(%q) = %v, want %v", slug, got, want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// 分享访问记录的动作
+const (
+	// AccessOpen 验证密码打开分享
+	AccessOpen = "access"
+	// AccessList 浏览目录分享中的目录
+	AccessList = "list"
+	// AccessDownload 下载单个文件
+	AccessDownload = "download"
+	// AccessZip 打包下载
+	AccessZip = "zip"
+	// AccessUpload 匿名上传
+	AccessUpload = "upload"
+)
+
+const (
+	// defaultRecentAccesses 统计接口默认返回的最近访问记录数
+	defaultRecentAccesses = 50
+	// maxRecentAccesses 统计接口最多返回的最近访问记录数
+	maxRecentAccesses = 500
+)
+
+// AccessEvent 一次分享访问
+type AccessEvent struct {
+	ShareID uuid.UUID `json:"-"`
+	Time    time.Time `json:"time"`
+	IP      string    `json:"ip"`
+	Action  string    `json:"action"`
+	// Path 访问的路径，相对分享根目录
+	Path      string `json:"path"`
+	Bytes     int64  `json:"bytes"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Stats 分享的访问统计，只包含保留期内的访问记录
+type Stats struct {
+	ShareID uuid.UUID `json:"share_id"`
+	// DownloadCount 分享累计的下载次数（不受保留期影响）
+	DownloadCount int            `json:"download_count"`
+	Accesses      int            `json:"accesses"`
+	ByAction      map[string]int `json:"by_action"`
+	Bytes         int64          `json:"bytes"`
+	UniqueIPs     int            `json:"unique_ips"`
+	// FirstAccessAt 分享第一次被访问的时间，从未被访问时为空
+	FirstAccessAt *time.Time    `json:"first_access_at,omitempty"`
+	Recent        []AccessEvent `json:"recent"`
+}
+
+// AccessRecorder 记录分享访问并在分享首次被访问时通知分享者。
+// 首次访问用file_shares.first_accessed_at上的条件UPDATE判定，多副本部署下每个分享只通知一次
+type AccessRecorder struct {
+	db     *sql.DB
+	config config.ShareStatsConfig
+	client *http.Client
+}
+
+// NewAccessRecorder 创建分享访问统计
+func NewAccessRecorder(db *sql.DB, cfg config.ShareStatsConfig) *AccessRecorder {
+	return &AccessRecorder{
+		db:     db,
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Initialize 创建访问记录表并为file_shares表添加首次访问时间列
+func (r *AccessRecorder) Initialize(ctx context.Context) error {
+	statements := []string{
+		`ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS first_accessed_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS share_access_events (
+			id UUID PRIMARY KEY,
+			share_id UUID NOT NULL REFERENCES file_shares(id) ON DELETE CASCADE,
+			accessed_at TIMESTAMP NOT NULL,
+			ip VARCHAR(45),
+			action VARCHAR(16) NOT NULL,
+			path TEXT,
+			bytes BIGINT NOT NULL DEFAULT 0,
+			user_agent TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_access_events_share ON share_access_events(share_id, accessed_at DESC)`,
+	}
+	for _, stmt := range statements {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize share access stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// Record 写入一条访问记录，同时删除该分享超出保留期的记录。
+// 分享第一次被访问且配置了notify_webhook_url时异步通知分享者
+func (r *AccessRecorder) Record(ctx context.Context, fileShare *models.FileShare, event AccessEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.ShareID = fileShare.ID
+
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO share_access_events (id, share_id, accessed_at, ip, action, path, bytes, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		uuid.New(), event.ShareID, event.Time, event.IP, event.Action, event.Path, event.Bytes, event.UserAgent); err != nil {
+		return fmt.Errorf("failed to record share access: %w", err)
+	}
+
+	if r.config.Retention > 0 {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM share_access_events WHERE share_id = $1 AND accessed_at < $2`,
+			event.ShareID, event.Time.Add(-r.config.Retention)); err != nil {
+			log.Printf("Warning: failed to prune share access events: %v", err)
+		}
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE file_shares SET first_accessed_at = $1 WHERE id = $2 AND first_accessed_at IS NULL`,
+		event.Time, event.ShareID)
+	if err != nil {
+		return fmt.Errorf("failed to record first share access: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 1 && r.config.NotifyWebhookURL != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := r.notifyFirstAccess(ctx, fileShare, event); err != nil {
+				log.Printf("Warning: failed to send first access notification for share %s: %v", fileShare.ID, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// firstAccessPayload 首次访问通知的推送内容，由邮件/IM服务根据owner转发给分享者
+type firstAccessPayload struct {
+	Event     string      `json:"event"`
+	ShareID   uuid.UUID   `json:"share_id"`
+	ShareName string      `json:"share_name"`
+	FilePath  string      `json:"file_path"`
+	Owner     shareOwner  `json:"owner"`
+	Access    AccessEvent `json:"access"`
+}
+
+// shareOwner 分享者信息
+type shareOwner struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+}
+
+// notifyFirstAccess 以JSON POST推送首次访问通知，非2xx响应视为失败
+func (r *AccessRecorder) notifyFirstAccess(ctx context.Context, fileShare *models.FileShare, event AccessEvent) error {
+	owner := shareOwner{ID: fileShare.UserID}
+	if err := r.db.QueryRowContext(ctx, `SELECT username, email FROM users WHERE id = $1`, fileShare.UserID).
+		Scan(&owner.Username, &owner.Email); err != nil {
+		return fmt.Errorf("failed to load share owner: %w", err)
+	}
+
+	body, err := json.Marshal(firstAccessPayload{
+		Event:     "share.first_access",
+		ShareID:   fileShare.ID,
+		ShareName: fileShare.ShareName,
+		FilePath:  fileShare.FilePath,
+		Owner:     owner,
+		Access:    event,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.NotifyWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Stats 返回用户分享的访问统计和最近limit条访问记录（limit<=0时为50，最多500）。
+// 分享不存在或不属于该用户时返回ErrShareNotFound
+func (r *AccessRecorder) Stats(ctx context.Context, userID, shareID uuid.UUID, limit int) (*Stats, error) {
+	if limit <= 0 {
+		limit = defaultRecentAccesses
+	}
+	limit = min(limit, maxRecentAccesses)
+
+	stats := &Stats{ShareID: shareID, ByAction: map[string]int{}, Recent: []AccessEvent{}}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(download_count, 0), first_accessed_at FROM file_shares WHERE id = $1 AND user_id = $2`,
+		shareID, userID).Scan(&stats.DownloadCount, &stats.FirstAccessAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT action, COUNT(*), COALESCE(SUM(bytes), 0) FROM share_access_events
+		WHERE share_id = $1 GROUP BY action`, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count share accesses: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var action string
+		var count int
+		var total int64
+		if err := rows.Scan(&action, &count, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan share access count: %w", err)
+		}
+		stats.ByAction[action] = count
+		stats.Accesses += count
+		stats.Bytes += total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT ip) FROM share_access_events WHERE share_id = $1`,
+		shareID).Scan(&stats.UniqueIPs); err != nil {
+		return nil, fmt.Errorf("failed to count share visitors: %w", err)
+	}
+
+	recent, err := r.db.QueryContext(ctx, `
+		SELECT accessed_at, COALESCE(ip, ''), action, COALESCE(path, ''), bytes, COALESCE(user_agent, '')
+		FROM share_access_events WHERE share_id = $1
+		ORDER BY accessed_at DESC LIMIT $2`, shareID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share accesses: %w", err)
+	}
+	defer recent.Close()
+	for recent.Next() {
+		event := AccessEvent{ShareID: shareID}
+		if err := recent.Scan(&event.Time, &event.IP, &event.Action, &event.Path, &event.Bytes, &event.UserAgent); err != nil {
+			return nil, fmt.Errorf("failed to scan share access: %w", err)
+		}
+		stats.Recent = append(stats.Recent, event)
+	}
+	return stats, recent.Err()
+}
@@ -0,0 +1,172 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+)
+
+func newTestRecorder(t *testing.T, cfg config.ShareStatsConfig) (*AccessRecorder, *models.FileShare) {
+	t.Helper()
+	db, shareID, token := newTestShareDB(t)
+	r := NewAccessRecorder(db, cfg)
+	if err := r.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	fileShare := &models.FileShare{ID: shareID, ShareToken: token, ShareName: "Inbox", FilePath: "/inbox"}
+	if err := db.QueryRow(`SELECT user_id FROM file_shares WHERE id = $1`, shareID).Scan(&fileShare.UserID); err != nil {
+		t.Fatal(err)
+	}
+	return r, fileShare
+}
+
+func TestAccessRecorderStats(t *testing.T) {
+	r, fileShare := newTestRecorder(t, config.ShareStatsConfig{})
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	stats, err := r.Stats(ctx, fileShare.UserID, fileShare.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accesses != 0 || stats.FirstAccessAt != nil || len(stats.Recent) != 0 {
+		t.Errorf("stats before any access = %+v", stats)
+	}
+
+	events := []AccessEvent{
+		{Time: base, IP: "203.0.113.1", Action: AccessOpen},
+		{Time: base.Add(time.Minute), IP: "203.0.113.1", Action: AccessList, Path: "/docs"},
+		{Time: base.Add(2 * time.Minute), IP: "203.0.113.1", Action: AccessDownload, Path: "/docs/a.pdf", Bytes: 1000},
+		{Time: base.Add(3 * time.Minute), IP: "198.51.100.7", Action: AccessDownload, Path: "/docs/b.pdf", Bytes: 500, UserAgent: "curl/8.0"},
+		{Time: base.Add(4 * time.Minute), IP: "198.51.100.7", Action: AccessZip, Path: "/", Bytes: 2000},
+	}
+	for _, event := range events {
+		if err := r.Record(ctx, fileShare, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.db.Exec(`UPDATE file_shares SET download_count = 3 WHERE id = $1`, fileShare.ID)
+
+	stats, err = r.Stats(ctx, fileShare.UserID, fileShare.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accesses != 5 || stats.Bytes != 3500 || stats.UniqueIPs != 2 || stats.DownloadCount != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.ByAction[AccessDownload] != 2 || stats.ByAction[AccessOpen] != 1 || stats.ByAction[AccessZip] != 1 {
+		t.Errorf("by action = %v", stats.ByAction)
+	}
+	// 首次访问时间只在第一次访问时记录
+	if stats.FirstAccessAt == nil || !stats.FirstAccessAt.Equal(base) {
+		t.Errorf("first access = %v, want %v", stats.FirstAccessAt, base)
+	}
+	// 最近的记录在前，limit限制条数
+	if len(stats.Recent) != 2 || stats.Recent[0].Action != AccessZip || stats.Recent[1].UserAgent != "curl/8.0" ||
+		stats.Recent[1].Path != "/docs/b.pdf" || !stats.Recent[1].Time.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("recent = %+v", stats.Recent)
+	}
+
+	// 其他用户的分享和不存在的分享
+	if _, err := r.Stats(ctx, uuid.New(), fileShare.ID, 0); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("stats of another user's share: err = %v, want ErrShareNotFound", err)
+	}
+	if _, err := r.Stats(ctx, fileShare.UserID, uuid.New(), 0); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("stats of a missing share: err = %v, want ErrShareNotFound", err)
+	}
+}
+
+// TestAccessRecorderRetention 写入记录时删除该分享超出保留期的记录，首次访问时间不受影响
+func TestAccessRecorderRetention(t *testing.T) {
+	r, fileShare := newTestRecorder(t, config.ShareStatsConfig{Retention: 24 * time.Hour})
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, event := range []AccessEvent{
+		{Time: now.Add(-72 * time.Hour), IP: "203.0.113.1", Action: AccessOpen},
+		{Time: now.Add(-48 * time.Hour), IP: "203.0.113.2", Action: AccessDownload, Bytes: 10},
+		{IP: "203.0.113.3", Action: AccessDownload, Bytes: 20},
+	} {
+		if err := r.Record(ctx, fileShare, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := r.Stats(ctx, fileShare.UserID, fileShare.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accesses != 1 || stats.Bytes != 20 || stats.Recent[0].IP != "203.0.113.3" || stats.Recent[0].Time.IsZero() {
+		t.Errorf("stats after pruning = %+v", stats)
+	}
+	if stats.FirstAccessAt == nil || !stats.FirstAccessAt.Equal(now.Add(-72*time.Hour)) {
+		t.Errorf("first access = %v, want the pruned first access", stats.FirstAccessAt)
+	}
+}
+
+// TestAccessRecorderNotify 分享第一次被访问时推送一次通知
+func TestAccessRecorderNotify(t *testing.T) {
+	received := make(chan firstAccessPayload, 4)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var payload firstAccessPayload
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook request %s %s", req.Method, req.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Errorf("decode webhook payload: %v", err)
+		}
+		w.WriteHeader(status)
+		received <- payload
+	}))
+	defer server.Close()
+
+	r, fileShare := newTestRecorder(t, config.ShareStatsConfig{NotifyWebhookURL: server.URL})
+	ctx := context.Background()
+	first := AccessEvent{IP: "203.0.113.1", Action: AccessDownload, Path: "/a.pdf", Bytes: 42}
+	if err := r.Record(ctx, fileShare, first); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.Event != "share.first_access" || payload.ShareID != fileShare.ID || payload.ShareName != "Inbox" ||
+			payload.FilePath != "/inbox" {
+			t.Errorf("payload = %+v", payload)
+		}
+		if payload.Owner.ID != fileShare.UserID || payload.Owner.Username != "alice" || payload.Owner.Email != "alice@example.com" {
+			t.Errorf("owner = %+v", payload.Owner)
+		}
+		if payload.Access.IP != "203.0.113.1" || payload.Access.Action != AccessDownload || payload.Access.Bytes != 42 {
+			t.Errorf("access = %+v", payload.Access)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first access notification not sent")
+	}
+
+	// 之后的访问不再通知
+	if err := r.Record(ctx, fileShare, AccessEvent{IP: "203.0.113.2", Action: AccessOpen}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("notified again: %+v", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 非2xx响应视为失败
+	status = http.StatusBadGateway
+	if err := r.notifyFirstAccess(ctx, fileShare, first); err == nil {
+		t.Error("notifyFirstAccess succeeded on a 502 response")
+	}
+	<-received
+}
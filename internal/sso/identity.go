@@ -0,0 +1,333 @@
+package sso
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/models"
+)
+
+// maxUsernameLength 与users.username列长度一致
+const maxUsernameLength = 50
+
+// unusablePasswordHash 外部身份创建的用户没有本地密码，该值不是任何算法的有效哈希，密码登录总是失败
+const unusablePasswordHash = "!sso"
+
+var (
+	// ErrMissingAttribute 断言中缺少必需的用户属性
+	ErrMissingAttribute = errors.New("identity provider did not supply a required attribute")
+	// ErrGroupNotAllowed 用户不属于允许登录的组
+	ErrGroupNotAllowed = errors.New("user is not a member of an allowed group")
+	// ErrNotProvisioned 用户不存在且未开启自动创建
+	ErrNotProvisioned = errors.New("user has not been provisioned")
+	// ErrAccountConflict 用户名或邮箱已被未关联的本地用户占用
+	ErrAccountConflict = errors.New("username or email is already used by a local account")
+	// ErrAccountDisabled 关联的用户已停用
+	ErrAccountDisabled = errors.New("account is not active")
+)
+
+// Identity 外部身份提供方认证后的用户信息，SAML与其他单点登录后端共用
+type Identity struct {
+	// Provider 身份提供方标识（如IdP实体ID），与Subject一起唯一确定外部用户
+	Provider    string
+	Subject     string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+	// EmailVerified 邮箱已由IdP验证（OIDC的email_verified声明），只有已验证的邮箱可用于关联已有本地用户
+	EmailVerified bool
+}
+
+// InAnyGroup 判断是否属于allowed中任一组（不区分大小写），allowed为空时总是true
+func (id *Identity) InAnyGroup(allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, group := range id.Groups {
+		for _, want := range allowed {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalize 校验并规范化用户名和邮箱
+func (id *Identity) normalize() error {
+	id.Username = strings.TrimSpace(id.Username)
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+	id.DisplayName = strings.TrimSpace(id.DisplayName)
+
+	if id.Provider == "" || id.Subject == "" {
+		return fmt.Errorf("%w: subject", ErrMissingAttribute)
+	}
+	if id.Username == "" {
+		return fmt.Errorf("%w: username", ErrMissingAttribute)
+	}
+	if len(id.Username) > maxUsernameLength || strings.ContainsAny(id.Username, "/\\ \t\r\n") {
+		return fmt.Errorf("%w: unusable username %q", ErrMissingAttribute, id.Username)
+	}
+	if id.Email == "" || !strings.Contains(id.Email, "@") {
+		return fmt.Errorf("%w: email", ErrMissingAttribute)
+	}
+	return nil
+}
+
+// ProvisionOptions 外部身份到本地用户的映射策略
+type ProvisionOptions struct {
+	// AutoProvision 首次登录时自动创建用户
+	AutoProvision bool
+	// LinkExisting 允许关联能确认为同一人的已有本地用户：SCIM同步的externalId与外部身份的Subject相同，
+	// 或IdP已验证的邮箱与本地用户的邮箱相同。只有用户名相同时不关联
+	LinkExisting bool
+	// DefaultQuota 自动创建的用户的存储配额，0表示使用数据库默认值
+	DefaultQuota int64
+}
+
+// MapGroups 按映射把外部组名转换为内部组名（外部组名不区分大小写），mapping为空时原样返回；
+// 不在映射中的组被丢弃
+func MapGroups(groups []string, mapping []config.GroupMapping) []string {
+	if len(mapping) == 0 {
+		return groups
+	}
+	var mapped []string
+	for _, group := range groups {
+		for _, m := range mapping {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(m.IDPGroup)) {
+				mapped = append(mapped, m.Group)
+			}
+		}
+	}
+	return mapped
+}
+
+// Provisioner 将外部身份映射到本地用户，并同步组成员关系
+type Provisioner struct {
+	db *sql.DB
+	// admins auth.admins中的用户名（小写），管理员账户由运维创建，不能通过外部身份自动创建
+	admins map[string]bool
+}
+
+// NewProvisioner 创建用户映射服务，admins为auth.admins
+func NewProvisioner(db *sql.DB, admins []string) *Provisioner {
+	reserved := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		reserved[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	return &Provisioner{db: db, admins: reserved}
+}
+
+// Initialize 创建外部身份、用户组表及SCIM用户表（关联已有用户时按externalId查找）
+func (p *Provisioner) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			provider VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP NOT NULL,
+			last_login_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (provider, subject)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)`,
+		`CREATE TABLE IF NOT EXISTS user_groups (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			group_name VARCHAR(255) NOT NULL,
+			source VARCHAR(255) NOT NULL,
+			PRIMARY KEY (user_id, group_name, source)
+		)`,
+		`CREATE TABLE IF NOT EXISTS scim_users (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			external_id VARCHAR(255),
+			created_at TIMESTAMP NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := p.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize identity tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// Resolve 返回外部身份对应的本地用户，必要时按opts关联或创建用户，并用身份中的组替换该来源的组成员关系
+func (p *Provisioner) Resolve(ctx context.Context, id Identity, opts ProvisionOptions) (*models.User, error) {
+	if err := id.normalize(); err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`,
+		id.Provider, id.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE user_identities SET last_login_at = $1 WHERE provider = $2 AND subject = $3`,
+			now, id.Provider, id.Subject)
+		if err != nil {
+			return nil, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if userID, err = p.linkOrCreate(ctx, tx, id, opts); err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO user_identities (provider, subject, user_id, created_at, last_login_at) VALUES ($1, $2, $3, $4, $4)`,
+			id.Provider, id.Subject, userID, now)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := syncGroups(ctx, tx, userID, id.Provider, id.Groups); err != nil {
+		return nil, err
+	}
+
+	user, err := loadUser(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != "active" {
+		return nil, ErrAccountDisabled
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Groups 返回用户的全部组（去重）
+func (p *Provisioner) Groups(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT DISTINCT group_name FROM user_groups WHERE user_id = $1 ORDER BY group_name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// linkOrCreate 为尚未关联的外部身份找到或创建本地用户
+func (p *Provisioner) linkOrCreate(ctx context.Context, tx *sql.Tx, id Identity, opts ProvisionOptions) (uuid.UUID, error) {
+	// SCIM同步的用户按externalId关联，IdP中的用户改名、改邮箱都不影响
+	var existing uuid.UUID
+	err := tx.QueryRowContext(ctx,
+		`SELECT user_id FROM scim_users WHERE external_id = $1`, id.Subject).Scan(&existing)
+	switch {
+	case err == nil:
+		if !opts.LinkExisting {
+			return uuid.Nil, ErrAccountConflict
+		}
+		return existing, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return uuid.Nil, err
+	}
+
+	var email string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, LOWER(email) FROM users WHERE username = $1 OR LOWER(email) = $2 ORDER BY (LOWER(email) = $2) DESC LIMIT 1`,
+		id.Username, id.Email).Scan(&existing, &email)
+	switch {
+	case err == nil:
+		// 用户名可能由IdP中的任何账户声明，只凭用户名关联会让同名账户接管本地用户；
+		// 邮箱未经IdP验证或与本地用户不同时视为冲突
+		if !opts.LinkExisting || !id.EmailVerified || email != id.Email {
+			return uuid.Nil, ErrAccountConflict
+		}
+		return existing, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return uuid.Nil, err
+	}
+
+	if !opts.AutoProvision {
+		return uuid.Nil, ErrNotProvisioned
+	}
+	// AdminMiddleware按用户名授予管理员权限，自动创建auth.admins中的用户名会让IdP中的同名账户成为管理员；
+	// 与注册一样按已被占用处理
+	if p.admins[strings.ToLower(id.Username)] {
+		return uuid.Nil, ErrAccountConflict
+	}
+
+	displayName := id.DisplayName
+	if displayName == "" {
+		displayName = id.Username
+	}
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, email, password_hash, display_name) VALUES ($1, $2, $3, $4) RETURNING id`,
+		id.Username, id.Email, unusablePasswordHash, displayName).Scan(&userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create user %s: %w", id.Username, err)
+	}
+	if opts.DefaultQuota > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE users SET storage_quota = $1 WHERE id = $2`, opts.DefaultQuota, userID); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return userID, nil
+}
+
+// syncGroups 用groups替换该来源下的组成员关系
+func syncGroups(ctx context.Context, tx *sql.Tx, userID uuid.UUID, source string, groups []string) error {
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM user_groups WHERE user_id = $1 AND source = $2`, userID, source); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" || seen[group] {
+			continue
+		}
+		seen[group] = true
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_groups (user_id, group_name, source) VALUES ($1, $2, $3)`,
+			userID, group, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadUser(ctx context.Context, tx *sql.Tx, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, username, email, COALESCE(display_name, ''), storage_quota, storage_used, status, created_at, updated_at
+		FROM users WHERE id = $1`, userID).Scan(
+		&user.ID, &user.Username, &user.Email, &user.DisplayName, &user.StorageQuota, &user.StorageUsed,
+		&user.Status, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
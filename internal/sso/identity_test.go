@@ -0,0 +1,216 @@
+package sso
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestIdentityInAnyGroup(t *testing.T) {
+	id := Identity{Groups: []string{"Engineering", " webdav-users "}}
+
+	if !id.InAnyGroup(nil) {
+		t.Error("未配置允许的组时应允许登录")
+	}
+	if !id.InAnyGroup([]string{"finance", "WebDAV-Users"}) {
+		t.Error("组名比较应忽略大小写和空白")
+	}
+	if id.InAnyGroup([]string{"finance"}) {
+		t.Error("不属于允许的组时应拒绝")
+	}
+}
+
+func TestIdentityNormalize(t *testing.T) {
+	id := Identity{Provider: "https://idp.example.com", Subject: "abc", Username: " alice ", Email: "Alice@Example.COM"}
+	if err := id.normalize(); err != nil {
+		t.Fatalf("normalize() error = %v", err)
+	}
+	if id.Username != "alice" || id.Email != "alice@example.com" {
+		t.Errorf("normalize() = %q %q", id.Username, id.Email)
+	}
+
+	invalid := []Identity{
+		{Provider: "idp", Username: "alice", Email: "a@example.com"},
+		{Provider: "idp", Subject: "abc", Email: "a@example.com"},
+		{Provider: "idp", Subject: "abc", Username: "a/b", Email: "a@example.com"},
+		{Provider: "idp", Subject: "abc", Username: "alice"},
+	}
+	for _, id := range invalid {
+		if err := id.normalize(); !errors.Is(err, ErrMissingAttribute) {
+			t.Errorf("normalize(%+v) error = %v, want ErrMissingAttribute", id, err)
+		}
+	}
+}
+
+// newTestProvisioner 在SQLite上创建users表（与schema.sql对应的列）和身份表
+func newTestProvisioner(t *testing.T) (*Provisioner, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "users.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE users (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6)))),
+		username TEXT UNIQUE NOT NULL,
+		email TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		display_name TEXT,
+		storage_quota BIGINT DEFAULT 10737418240,
+		storage_used BIGINT DEFAULT 0,
+		status TEXT DEFAULT 'active',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProvisioner(db, []string{"Root"})
+	if err := p.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return p, db
+}
+
+// addLocalUser 插入一个本地用户
+func addLocalUser(t *testing.T, db *sql.DB, username, email, status string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, username, email, password_hash, status) VALUES ($1, $2, $3, 'hash', $4)`,
+		id.String(), username, email, status); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestProvisionerResolve(t *testing.T) {
+	alice := Identity{Provider: "https://idp.example.com", Subject: "sub-1", Username: "alice", Email: "Alice@Example.com", Groups: []string{"eng", "eng", " ops "}}
+
+	tests := []struct {
+		name       string
+		local      [][3]string // 已有的本地用户：用户名、邮箱、状态
+		externalID string      // 第一个本地用户的SCIM externalId
+		username   string      // 覆盖外部身份的用户名
+		verified   bool
+		noEmail    bool
+		opts       ProvisionOptions
+		wantErr    error
+		wantUser   string
+		created    bool
+	}{
+		{name: "auto provision", opts: ProvisionOptions{AutoProvision: true, DefaultQuota: 1 << 20}, wantUser: "alice", created: true},
+		{name: "not provisioned", wantErr: ErrNotProvisioned},
+		{name: "username taken without linking", local: [][3]string{{"alice", "alice@example.com", "active"}}, verified: true, opts: ProvisionOptions{AutoProvision: true}, wantErr: ErrAccountConflict},
+		// 只有用户名相同不能证明是同一人
+		{name: "username only", local: [][3]string{{"alice", "alice@old.example.com", "active"}}, verified: true, opts: ProvisionOptions{AutoProvision: true, LinkExisting: true}, wantErr: ErrAccountConflict},
+		{name: "unverified email", local: [][3]string{{"alice", "alice@example.com", "active"}}, opts: ProvisionOptions{LinkExisting: true}, wantErr: ErrAccountConflict},
+		{name: "link by verified email", local: [][3]string{{"alice", "alice@example.com", "active"}}, verified: true, opts: ProvisionOptions{LinkExisting: true}, wantUser: "alice"},
+		{name: "verified email of other username", local: [][3]string{{"alice2", "alice@example.com", "active"}}, verified: true, opts: ProvisionOptions{LinkExisting: true}, wantUser: "alice2"},
+		{name: "verified email with username taken", local: [][3]string{{"alice", "other@example.com", "active"}, {"alice2", "alice@example.com", "active"}}, verified: true, opts: ProvisionOptions{LinkExisting: true}, wantUser: "alice2"},
+		{name: "link by scim external id", local: [][3]string{{"asmith", "a.smith@example.com", "active"}}, externalID: "sub-1", opts: ProvisionOptions{LinkExisting: true}, wantUser: "asmith"},
+		{name: "scim external id without linking", local: [][3]string{{"asmith", "a.smith@example.com", "active"}}, externalID: "sub-1", opts: ProvisionOptions{AutoProvision: true}, wantErr: ErrAccountConflict},
+		{name: "other scim external id", local: [][3]string{{"alice", "alice@example.com", "active"}}, externalID: "sub-2", opts: ProvisionOptions{AutoProvision: true, LinkExisting: true}, wantErr: ErrAccountConflict},
+		{name: "linked user disabled", local: [][3]string{{"alice", "alice@example.com", "suspended"}}, verified: true, opts: ProvisionOptions{LinkExisting: true}, wantErr: ErrAccountDisabled},
+		// auth.admins中的用户名（不区分大小写）不能自动创建，运维创建的管理员仍可按已验证邮箱关联
+		{name: "admin username", username: "root", opts: ProvisionOptions{AutoProvision: true}, wantErr: ErrAccountConflict},
+		{name: "link admin by verified email", local: [][3]string{{"root", "alice@example.com", "active"}}, username: "ROOT", verified: true, opts: ProvisionOptions{AutoProvision: true, LinkExisting: true}, wantUser: "root"},
+		{name: "missing email", noEmail: true, opts: ProvisionOptions{AutoProvision: true}, wantErr: ErrMissingAttribute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, db := newTestProvisioner(t)
+			ctx := context.Background()
+			for i, u := range tt.local {
+				userID := addLocalUser(t, db, u[0], u[1], u[2])
+				if i == 0 && tt.externalID != "" {
+					if _, err := db.Exec(`INSERT INTO scim_users (user_id, external_id, created_at) VALUES ($1, $2, CURRENT_TIMESTAMP)`,
+						userID.String(), tt.externalID); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			id := alice
+			id.EmailVerified = tt.verified
+			if tt.username != "" {
+				id.Username = tt.username
+			}
+			if tt.noEmail {
+				id.Email = ""
+			}
+
+			user, err := p.Resolve(ctx, id, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve error = %v, want %v", err, tt.wantErr)
+			}
+			var identities int
+			db.QueryRow(`SELECT COUNT(*) FROM user_identities`).Scan(&identities)
+			if err != nil {
+				if identities != 0 {
+					t.Error("failed resolve must not record the identity")
+				}
+				return
+			}
+
+			if user.Username != tt.wantUser || identities != 1 {
+				t.Errorf("user = %+v, identities = %d, want user %s", user, identities, tt.wantUser)
+			}
+			var passwordHash string
+			db.QueryRow(`SELECT password_hash FROM users WHERE id = $1`, user.ID.String()).Scan(&passwordHash)
+			if created := passwordHash == unusablePasswordHash; created != tt.created {
+				t.Errorf("password hash = %q, created %v", passwordHash, tt.created)
+			}
+			if tt.created && user.Email != "alice@example.com" {
+				t.Errorf("created user email = %q", user.Email)
+			}
+			if tt.opts.DefaultQuota > 0 && user.StorageQuota != tt.opts.DefaultQuota {
+				t.Errorf("quota = %d, want %d", user.StorageQuota, tt.opts.DefaultQuota)
+			}
+			groups, err := p.Groups(ctx, user.ID)
+			if err != nil || !reflect.DeepEqual(groups, []string{"eng", "ops"}) {
+				t.Errorf("groups = %v, %v", groups, err)
+			}
+		})
+	}
+}
+
+// TestProvisionerResolveLinked 已关联的身份直接返回同一用户，组成员关系按来源替换，不影响其他来源
+func TestProvisionerResolveLinked(t *testing.T) {
+	p, db := newTestProvisioner(t)
+	ctx := context.Background()
+	opts := ProvisionOptions{AutoProvision: true}
+	id := Identity{Provider: "https://idp.example.com", Subject: "sub-1", Username: "alice", Email: "alice@example.com", Groups: []string{"eng"}}
+
+	first, err := p.Resolve(ctx, id, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO user_groups (user_id, group_name, source) VALUES ($1, 'admins', 'scim')`, first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// IdP上改名后仍按provider+subject找到同一用户
+	id.Username, id.Email, id.Groups = "alice.renamed", "renamed@example.com", []string{"sales"}
+	second, err := p.Resolve(ctx, id, ProvisionOptions{})
+	if err != nil {
+		t.Fatalf("Resolve linked identity: %v", err)
+	}
+	if second.ID != first.ID || second.Username != "alice" {
+		t.Errorf("resolved %+v, want user %s", second, first.ID)
+	}
+	groups, _ := p.Groups(ctx, first.ID)
+	if !reflect.DeepEqual(groups, []string{"admins", "sales"}) {
+		t.Errorf("groups = %v", groups)
+	}
+
+	// 同一subject来自另一个IdP时是不同的外部用户
+	id.Provider = "https://other-idp.example.com"
+	if _, err := p.Resolve(ctx, id, ProvisionOptions{}); !errors.Is(err, ErrNotProvisioned) {
+		t.Errorf("other provider error = %v, want ErrNotProvisioned", err)
+	}
+}
@@ -0,0 +1,323 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// fakeIdP 最小的OpenID Provider：发现文档、JWKS、令牌端点和UserInfo端点
+type fakeIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	claims   jwt.MapClaims
+	userinfo map[string]interface{}
+	// codes 授权码到签发时记录的nonce和PKCE challenge
+	codes map[string]url.Values
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize?tenant=acme",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID, secret, _ := r.BasicAuth()
+		issued, ok := idp.codes[r.PostForm.Get("code")]
+		if !ok || clientID != "gateway" || secret != "s3cret" ||
+			pkceChallenge(r.PostForm.Get("code_verifier")) != issued.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{"nonce": issued.Get("nonce")}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "access_token": "at", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(idp.userinfo)
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.claims = jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"aud":                "gateway",
+		"sub":                "248289761001",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "alice",
+		"email":              "Alice@Example.com",
+		"email_verified":     true,
+		"name":               "Alice",
+		"groups":             []string{"Engineering", "Everyone"},
+	}
+	return idp
+}
+
+// pkceChallenge 按S256计算verifier对应的challenge
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize 模拟用户在IdP登录：记录授权请求的参数并返回授权码
+func (idp *fakeIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := "code-" + u.Query().Get("state")
+	idp.codes[code] = u.Query()
+	return code
+}
+
+func newTestOIDCProvider(t *testing.T, idp *fakeIdP, modify func(*config.OIDCConfig)) *OIDCProvider {
+	t.Helper()
+	cfg := config.OIDCConfig{
+		Enabled:       true,
+		Issuer:        idp.server.URL,
+		ClientID:      "gateway",
+		ClientSecret:  "s3cret",
+		RootURL:       "https://dav.example.com/",
+		Scopes:        []string{"openid", "profile", "email"},
+		AutoProvision: true,
+		Claims:        config.OIDCClaimMapping{Username: "preferred_username", Email: "email", DisplayName: "name", Groups: "groups"},
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	provider, err := NewOIDCProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return provider
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := newTestOIDCProvider(t, idp, func(cfg *config.OIDCConfig) {
+		cfg.GroupMapping = []config.GroupMapping{{IDPGroup: "engineering", Group: "staff"}}
+	})
+
+	authURL, login, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := mustQuery(t, authURL)
+	if query.Get("tenant") != "acme" || query.Get("redirect_uri") != "https://dav.example.com/api/auth/oidc/callback" ||
+		query.Get("scope") != "openid profile email" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("unexpected authorization request %s", authURL)
+	}
+
+	code := idp.authorize(t, authURL)
+	id, err := provider.Exchange(context.Background(), code, login.State, login)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := &Identity{
+		Provider:      idp.server.URL,
+		Subject:       "248289761001",
+		Username:      "alice",
+		Email:         "Alice@Example.com",
+		DisplayName:   "Alice",
+		Groups:        []string{"staff"},
+		EmailVerified: true,
+	}
+	if !reflect.DeepEqual(id, want) {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+}
+
+// TestOIDCEmailVerified 只有email_verified为true的邮箱可用于关联已有用户，为false时不采用邮箱
+func TestOIDCEmailVerified(t *testing.T) {
+	provider := newTestOIDCProvider(t, newFakeIdP(t), nil)
+	for _, tt := range []struct {
+		name      string
+		verified  interface{}
+		wantEmail string
+		want      bool
+	}{
+		{"verified", true, "alice@example.com", true},
+		{"unverified", false, "", false},
+		{"claim missing", nil, "alice@example.com", false},
+		{"not a boolean", "true", "alice@example.com", false},
+	} {
+		claims := jwt.MapClaims{"sub": "248289761001", "preferred_username": "alice", "email": "alice@example.com"}
+		if tt.verified != nil {
+			claims["email_verified"] = tt.verified
+		}
+		id := provider.identity(claims)
+		if id.Email != tt.wantEmail || id.EmailVerified != tt.want {
+			t.Errorf("%s: email %q, verified %v; want %q, %v", tt.name, id.Email, id.EmailVerified, tt.wantEmail, tt.want)
+		}
+	}
+}
+
+func TestOIDCRejectsInvalidResponses(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := newTestOIDCProvider(t, idp, nil)
+
+	// 回调的state与cookie中的不一致（登录CSRF）
+	_, login, _ := provider.AuthCodeURL()
+	if _, err := provider.Exchange(context.Background(), "code", "forged", login); !errors.Is(err, ErrOIDCState) {
+		t.Errorf("state mismatch: err = %v, want ErrOIDCState", err)
+	}
+
+	// 授权码属于另一次登录：PKCE verifier和nonce都对不上
+	authURL, _, _ := provider.AuthCodeURL()
+	code := idp.authorize(t, authURL)
+	_, other, _ := provider.AuthCodeURL()
+	if _, err := provider.Exchange(context.Background(), code, other.State, other); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("foreign code: err = %v, want ErrInvalidIDToken", err)
+	}
+
+	for name, mutate := range map[string]func(jwt.MapClaims){
+		"audience": func(c jwt.MapClaims) { c["aud"] = "another-client" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":      func(c jwt.MapClaims) { c["aud"] = []string{"gateway", "another-client"} },
+	} {
+		saved := idp.claims
+		idp.claims = jwt.MapClaims{}
+		for k, v := range saved {
+			idp.claims[k] = v
+		}
+		mutate(idp.claims)
+
+		authURL, login, _ := provider.AuthCodeURL()
+		code := idp.authorize(t, authURL)
+		if _, err := provider.Exchange(context.Background(), code, login.State, login); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidIDToken", name, err)
+		}
+		idp.claims = saved
+	}
+}
+
+func TestOIDCUserinfoAndAllowedGroups(t *testing.T) {
+	idp := newFakeIdP(t)
+	delete(idp.claims, "email")
+	delete(idp.claims, "groups")
+	idp.userinfo = map[string]interface{}{"sub": "248289761001", "email": "alice@example.com", "groups": []string{"Everyone"}}
+	provider := newTestOIDCProvider(t, idp, func(cfg *config.OIDCConfig) {
+		cfg.AllowedGroups = []string{"webdav-users"}
+	})
+
+	authURL, login, _ := provider.AuthCodeURL()
+	code := idp.authorize(t, authURL)
+	if _, err := provider.Exchange(context.Background(), code, login.State, login); !errors.Is(err, ErrGroupNotAllowed) {
+		t.Fatalf("err = %v, want ErrGroupNotAllowed", err)
+	}
+
+	idp.userinfo["groups"] = []string{"WebDAV-Users"}
+	authURL, login, _ = provider.AuthCodeURL()
+	code = idp.authorize(t, authURL)
+	id, err := provider.Exchange(context.Background(), code, login.State, login)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if id.Email != "alice@example.com" || !reflect.DeepEqual(id.Groups, []string{"WebDAV-Users"}) {
+		t.Errorf("identity = %+v, want email and groups from userinfo", id)
+	}
+
+	// UserInfo的sub与ID令牌不一致时拒绝
+	idp.userinfo["sub"] = "someone-else"
+	authURL, login, _ = provider.AuthCodeURL()
+	code = idp.authorize(t, authURL)
+	if _, err := provider.Exchange(context.Background(), code, login.State, login); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("userinfo subject mismatch: err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestNewOIDCProviderRejectsIssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	}))
+	defer server.Close()
+
+	_, err := NewOIDCProvider(context.Background(), config.OIDCConfig{
+		Issuer:   server.URL,
+		ClientID: "gateway",
+		RootURL:  "https://dav.example.com",
+	})
+	if err == nil {
+		t.Fatal("NewOIDCProvider accepted a discovery document for another issuer")
+	}
+}
+
+func TestMapGroups(t *testing.T) {
+	groups := []string{"Engineering", "Everyone", " Finance "}
+	if got := MapGroups(groups, nil); !reflect.DeepEqual(got, groups) {
+		t.Errorf("未配置映射时应原样返回，got %v", got)
+	}
+	mapping := []config.GroupMapping{
+		{IDPGroup: "engineering", Group: "staff"},
+		{IDPGroup: "finance", Group: "staff"},
+		{IDPGroup: "finance", Group: "billing"},
+	}
+	if got, want := MapGroups(groups, mapping), []string{"staff", "staff", "billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MapGroups() = %v, want %v", got, want)
+	}
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
@@ -0,0 +1,223 @@
+package sso
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// SAMLMetadataPath SP元数据地址，需与路由一致
+	SAMLMetadataPath = "/api/auth/saml/metadata"
+	// SAMLACSPath 断言消费服务（ACS）地址，需与路由一致
+	SAMLACSPath = "/api/auth/saml/acs"
+
+	// metadataFetchTimeout 启动时获取IdP元数据的超时
+	metadataFetchTimeout = 30 * time.Second
+)
+
+// ErrInvalidAssertion SAML响应无效（签名、受众、有效期或InResponseTo校验失败）
+var ErrInvalidAssertion = errors.New("invalid SAML response")
+
+// SAMLProvider SP发起的SAML 2.0登录：HTTP-Redirect绑定发送AuthnRequest，HTTP-POST绑定接收响应
+type SAMLProvider struct {
+	sp         *saml.ServiceProvider
+	attributes config.SAMLAttributeMapping
+	options    ProvisionOptions
+	allowed    []string
+}
+
+// NewSAMLProvider 加载SP证书和IdP元数据
+func NewSAMLProvider(ctx context.Context, cfg config.SAMLConfig) (*SAMLProvider, error) {
+	rootURL, err := url.Parse(strings.TrimSuffix(cfg.RootURL, "/"))
+	if err != nil || rootURL.Scheme == "" || rootURL.Host == "" {
+		return nil, fmt.Errorf("auth.saml.root_url must be an absolute URL, got %q", cfg.RootURL)
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SAML SP certificate: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML SP key must be an RSA private key")
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SAML SP certificate: %w", err)
+	}
+
+	idpMetadata, err := loadIDPMetadata(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataURL := rootURL.JoinPath(SAMLMetadataPath)
+	acsURL := rootURL.JoinPath(SAMLACSPath)
+	entityID := cfg.EntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+
+	return &SAMLProvider{
+		sp: &saml.ServiceProvider{
+			EntityID:          entityID,
+			Key:               key,
+			Certificate:       cert,
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			IDPMetadata:       idpMetadata,
+			AuthnNameIDFormat: saml.PersistentNameIDFormat,
+			SignatureMethod:   "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+		},
+		attributes: cfg.Attributes,
+		options:    ProvisionOptions{AutoProvision: cfg.AutoProvision, LinkExisting: cfg.LinkExisting},
+		allowed:    cfg.AllowedGroups,
+	}, nil
+}
+
+// loadIDPMetadata 从URL或本地文件读取IdP元数据
+func loadIDPMetadata(ctx context.Context, cfg config.SAMLConfig) (*saml.EntityDescriptor, error) {
+	switch {
+	case cfg.IDPMetadataFile != "":
+		data, err := os.ReadFile(cfg.IDPMetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IdP metadata: %w", err)
+		}
+		return samlsp.ParseMetadata(data)
+	case cfg.IDPMetadataURL != "":
+		metadataURL, err := url.Parse(cfg.IDPMetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth.saml.idp_metadata_url: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, metadataFetchTimeout)
+		defer cancel()
+		return samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataURL)
+	default:
+		return nil, errors.New("auth.saml requires idp_metadata_url or idp_metadata_file")
+	}
+}
+
+// Options 返回用户映射策略
+func (p *SAMLProvider) Options() ProvisionOptions {
+	return p.options
+}
+
+// Metadata 返回SP元数据XML，提供给IdP管理员注册
+func (p *SAMLProvider) Metadata() ([]byte, error) {
+	data, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// AuthnRequestURL 生成跳转到IdP的登录地址，返回的请求ID需在ACS回调时提供
+func (p *SAMLProvider) AuthnRequestURL() (string, string, error) {
+	idpURL := p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if idpURL == "" {
+		return "", "", errors.New("IdP metadata has no HTTP-Redirect SSO endpoint")
+	}
+	req, err := p.sp.MakeAuthenticationRequest(idpURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirect, err := req.Redirect("", p.sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirect.String(), req.ID, nil
+}
+
+// ParseResponse 校验ACS收到的SAML响应并提取身份。requestIDs为本浏览器发起的请求ID，
+// 不接受IdP发起的登录
+func (p *SAMLProvider) ParseResponse(r *http.Request, requestIDs []string) (*Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+	assertion, err := p.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+
+	id := p.identity(assertion)
+	if !id.InAnyGroup(p.allowed) {
+		return nil, ErrGroupNotAllowed
+	}
+	return id, nil
+}
+
+// identity 按属性映射从断言中提取用户信息
+func (p *SAMLProvider) identity(assertion *saml.Assertion) *Identity {
+	// 签名校验已确认断言由该IdP签发
+	id := &Identity{Provider: p.sp.IDPMetadata.EntityID}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		id.Subject = assertion.Subject.NameID.Value
+	}
+
+	values := assertionAttributes(assertion)
+	first := func(name string) string {
+		if vals := values[strings.ToLower(name)]; name != "" && len(vals) > 0 {
+			return vals[0]
+		}
+		return ""
+	}
+
+	id.Username = id.Subject
+	if p.attributes.Username != "" {
+		id.Username = first(p.attributes.Username)
+	}
+	id.Email = first(p.attributes.Email)
+	if id.Email == "" && strings.Contains(id.Subject, "@") {
+		id.Email = id.Subject
+	}
+	id.DisplayName = first(p.attributes.DisplayName)
+	if p.attributes.Groups != "" {
+		id.Groups = values[strings.ToLower(p.attributes.Groups)]
+	}
+	return id
+}
+
+// assertionAttributes 按属性Name和FriendlyName（小写）索引全部属性值
+func assertionAttributes(assertion *saml.Assertion) map[string][]string {
+	values := make(map[string][]string)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			var vals []string
+			for _, v := range attr.Values {
+				if v.Value != "" {
+					vals = append(vals, v.Value)
+				}
+			}
+			names := []string{attr.Name}
+			if !strings.EqualFold(attr.FriendlyName, attr.Name) {
+				names = append(names, attr.FriendlyName)
+			}
+			for _, name := range names {
+				if name != "" {
+					key := strings.ToLower(name)
+					values[key] = append(values[key], vals...)
+				}
+			}
+		}
+	}
+	return values
+}
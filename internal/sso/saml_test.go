@@ -0,0 +1,292 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// newTestCertificate 生成自签名的RSA证书
+func newTestCertificate(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// fakeSAMLIdP 用crewjam/saml的IdentityProvider签发断言，SP元数据由测试注册
+type fakeSAMLIdP struct {
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor
+}
+
+func (f *fakeSAMLIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if f.sp == nil || f.sp.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return f.sp, nil
+}
+
+func newFakeSAMLIdP(t *testing.T) *fakeSAMLIdP {
+	t.Helper()
+	key, cert := newTestCertificate(t, "idp.example.com")
+	f := &fakeSAMLIdP{}
+	f.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: f,
+	}
+	return f
+}
+
+// newTestSAMLProvider 按配置文件的方式加载SP证书和IdP元数据
+func newTestSAMLProvider(t *testing.T, f *fakeSAMLIdP, modify func(*config.SAMLConfig)) *SAMLProvider {
+	t.Helper()
+	dir := t.TempDir()
+	key, cert := newTestCertificate(t, "dav.example.com")
+	writePEM := func(name, blockType string, der []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	metadata, err := xml.Marshal(f.idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataFile := filepath.Join(dir, "idp.xml")
+	if err := os.WriteFile(metadataFile, metadata, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.SAMLConfig{
+		RootURL:         "https://dav.example.com/",
+		CertFile:        writePEM("sp.crt", "CERTIFICATE", cert.Raw),
+		KeyFile:         writePEM("sp.key", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		IDPMetadataFile: metadataFile,
+		AutoProvision:   true,
+		Attributes:      config.SAMLAttributeMapping{Username: "uid", Email: "eduPersonPrincipalName", DisplayName: "cn", Groups: "eduPersonAffiliation"},
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	provider, err := NewSAMLProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewSAMLProvider: %v", err)
+	}
+	f.sp = provider.sp.Metadata()
+	return provider
+}
+
+// login 走一遍SP发起的登录：生成AuthnRequest，由IdP签发断言（可由mutate修改），返回ACS收到的POST请求和请求ID
+func (f *fakeSAMLIdP) login(t *testing.T, provider *SAMLProvider, session *saml.Session, mutate func(*saml.IdpAuthnRequest)) (*http.Request, string) {
+	t.Helper()
+	redirect, requestID, err := provider.AuthnRequestURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := saml.NewIdpAuthnRequest(f.idp, httptest.NewRequest(http.MethodGet, redirect, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("IdP rejected AuthnRequest: %v", err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	if mutate != nil {
+		mutate(req)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := url.Values{"SAMLResponse": {form.SAMLResponse}}
+	acs := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(body.Encode()))
+	acs.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return acs, requestID
+}
+
+func testSAMLSession() *saml.Session {
+	return &saml.Session{
+		ID:             "session-1",
+		CreateTime:     time.Now(),
+		ExpireTime:     time.Now().Add(time.Hour),
+		Index:          "1",
+		NameID:         "a1b2c3",
+		NameIDFormat:   string(saml.PersistentNameIDFormat),
+		UserName:       "alice",
+		UserEmail:      "alice@example.com",
+		UserCommonName: "Alice Liddell",
+		Groups:         []string{"Engineering", "Everyone"},
+	}
+}
+
+func TestSAMLParseResponse(t *testing.T) {
+	f := newFakeSAMLIdP(t)
+	provider := newTestSAMLProvider(t, f, nil)
+
+	r, requestID := f.login(t, provider, testSAMLSession(), nil)
+	id, err := provider.ParseResponse(r, []string{requestID})
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	want := &Identity{
+		Provider:    f.idp.Metadata().EntityID,
+		Subject:     "a1b2c3",
+		Username:    "alice",
+		Email:       "alice@example.com",
+		DisplayName: "Alice Liddell",
+		Groups:      []string{"Engineering", "Everyone"},
+	}
+	if !reflect.DeepEqual(id, want) {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+}
+
+// TestSAMLParseResponseDefaults 未配置用户名属性时使用NameID，NameID是邮箱时兼作邮箱
+func TestSAMLParseResponseDefaults(t *testing.T) {
+	f := newFakeSAMLIdP(t)
+	provider := newTestSAMLProvider(t, f, func(cfg *config.SAMLConfig) {
+		cfg.Attributes = config.SAMLAttributeMapping{}
+	})
+	session := testSAMLSession()
+	session.NameID = "bob@example.com"
+
+	r, requestID := f.login(t, provider, session, nil)
+	id, err := provider.ParseResponse(r, []string{requestID})
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if id.Username != "bob@example.com" || id.Email != "bob@example.com" || id.Groups != nil {
+		t.Errorf("identity = %+v", id)
+	}
+}
+
+func TestSAMLParseResponseRejects(t *testing.T) {
+	otherKey, otherCert := newTestCertificate(t, "evil.example.com")
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		mutate     func(*saml.IdpAuthnRequest)
+		requestIDs func(requestID string) []string
+		wantErr    error
+	}{
+		{
+			name:       "unsolicited response",
+			requestIDs: func(string) []string { return nil },
+			wantErr:    ErrInvalidAssertion,
+		},
+		{
+			name:       "other browser's request",
+			requestIDs: func(string) []string { return []string{"id-someone-else"} },
+			wantErr:    ErrInvalidAssertion,
+		},
+		{
+			name: "wrong audience",
+			mutate: func(req *saml.IdpAuthnRequest) {
+				req.Assertion.Conditions.AudienceRestrictions[0].Audience.Value = "https://other.example.com/metadata"
+			},
+			wantErr: ErrInvalidAssertion,
+		},
+		{
+			name: "expired assertion",
+			mutate: func(req *saml.IdpAuthnRequest) {
+				req.Assertion.Conditions.NotOnOrAfter = time.Now().Add(-time.Hour)
+			},
+			wantErr: ErrInvalidAssertion,
+		},
+		{
+			name: "signed by unknown key",
+			mutate: func(req *saml.IdpAuthnRequest) {
+				idp := *req.IDP
+				idp.Key, idp.Certificate = otherKey, otherCert
+				req.IDP = &idp
+			},
+			wantErr: ErrInvalidAssertion,
+		},
+		{
+			name:    "group not allowed",
+			allowed: []string{"finance"},
+			wantErr: ErrGroupNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSAMLIdP(t)
+			provider := newTestSAMLProvider(t, f, func(cfg *config.SAMLConfig) {
+				cfg.AllowedGroups = tt.allowed
+			})
+			r, requestID := f.login(t, provider, testSAMLSession(), tt.mutate)
+			ids := []string{requestID}
+			if tt.requestIDs != nil {
+				ids = tt.requestIDs(requestID)
+			}
+			if _, err := provider.ParseResponse(r, ids); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseResponse error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	f := newFakeSAMLIdP(t)
+	provider := newTestSAMLProvider(t, f, nil)
+
+	data, err := provider.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("invalid metadata: %v", err)
+	}
+	if metadata.EntityID != "https://dav.example.com"+SAMLMetadataPath {
+		t.Errorf("entity ID = %q", metadata.EntityID)
+	}
+	acs := metadata.SPSSODescriptors[0].AssertionConsumerServices
+	if len(acs) == 0 || acs[0].Location != "https://dav.example.com"+SAMLACSPath {
+		t.Errorf("ACS = %+v", acs)
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+var (
+	// ErrNotFound 对象或存储桶不存在（非S3后端使用，S3后端返回minio.ErrorResponse）
+	ErrNotFound = errors.New("object not found")
+	// ErrPreconditionFailed 对象ETag与请求中的不一致
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// StorageBackend 对象存储后端。bucket对应一个用户的存储空间，key为不以/开头的对象键，
+// 以/结尾的键是目录标记。对象信息统一使用minio.ObjectInfo，UserMetadata的键不带x-amz-meta-前缀
+type StorageBackend interface {
+	// EnsureBucket 存储桶不存在时创建
+	EnsureBucket(ctx context.Context, bucket string) error
+	// PutObject 写入对象，size为-1表示长度未知
+	PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error
+	// GetObject 读取对象，错误（包括ETag不一致）可以延迟到第一次Read或Stat时返回
+	GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error)
+	StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error)
+	// ListObjects 遍历以prefix开头的对象（含元数据），S3在每页中先返回对象再返回公共前缀，顺序不作保证。
+	// 非递归时下一级目录以Key结尾为/、不含其他信息的条目返回一次。fn返回错误时停止遍历并原样返回该错误
+	ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error
+	// CopyObject 在同一存储桶内复制对象，默认保留源对象的元数据
+	CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error
+	// RemoveObjects 删除对象，不存在的键不视为错误
+	RemoveObjects(ctx context.Context, bucket string, keys []string) error
+}
+
+// RemoveObjectsError 批量删除中部分对象删除失败，Keys为失败的对象键，其余对象已删除。
+// 不能逐个报告结果的后端返回普通错误，调用方应视为整批都未删除
+type RemoveObjectsError struct {
+	Keys []string
+	Err  error
+}
+
+func (e *RemoveObjectsError) Error() string {
+	return fmt.Sprintf("failed to remove %d objects: %v", len(e.Keys), e.Err)
+}
+
+func (e *RemoveObjectsError) Unwrap() error {
+	return e.Err
+}
+
+// Object 读取中的对象
+type Object interface {
+	io.ReadCloser
+	Stat() (minio.ObjectInfo, error)
+}
+
+// failedObject 读取失败的对象，错误在Read或Stat时返回，与MinIO客户端的延迟报错保持一致
+type failedObject struct {
+	err error
+}
+
+func (o *failedObject) Read([]byte) (int, error)        { return 0, o.err }
+func (o *failedObject) Stat() (minio.ObjectInfo, error) { return minio.ObjectInfo{}, o.err }
+func (o *failedObject) Close() error                    { return nil }
+
+// PutOptions 写入选项
+type PutOptions struct {
+	ContentType  string
+	UserMetadata map[string]string
+}
+
+// GetOptions 读取选项
+type GetOptions struct {
+	// Start、End 字节区间[Start, End]（闭区间），Start<0表示读取整个对象
+	Start, End int64
+	// MatchETag 非空时要求对象仍是该版本，否则返回ErrPreconditionFailed
+	MatchETag string
+}
+
+// CopyOptions 复制选项
+type CopyOptions struct {
+	// MatchETag 非空时要求源对象仍是该版本
+	MatchETag string
+	// ReplaceMetadata 为true时用ContentType和UserMetadata替换源对象的元数据
+	ReplaceMetadata bool
+	ContentType     string
+	UserMetadata    map[string]string
+	// SourceSize 源对象大小，后端据此选择单次复制或分段复制；超过单次复制上限的对象必须提供
+	SourceSize int64
+}
+
+// NewBackend 按storage.type创建存储后端：minio、s3、local或azure
+func NewBackend(cfg config.StorageConfig) (StorageBackend, error) {
+	switch cfg.Type {
+	case "", "minio", "s3":
+		return NewMinIOBackend(cfg.MinIO)
+	case "local":
+		return NewLocalBackend(cfg.Local.RootPath)
+	case "azure":
+		return NewAzureBackend(cfg.Azure)
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
+}
+
+// bucketPrefix 存储桶（Azure为容器）名称前缀，本地目录后端不使用前缀
+func bucketPrefix(cfg config.StorageConfig) string {
+	switch cfg.Type {
+	case "local":
+		return ""
+	case "azure":
+		return cfg.Azure.ContainerPrefix
+	default:
+		return cfg.MinIO.BucketPrefix
+	}
+}
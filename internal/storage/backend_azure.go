@@ -0,0 +1,544 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// azureAPIVersion Blob服务REST API版本
+	azureAPIVersion = "2021-08-06"
+	// azureSinglePutLimit 不超过该大小且长度已知的对象用一次Put Blob写入，否则分块上传
+	azureSinglePutLimit = 256 << 20
+	// azureBlockSize 分块上传的块大小
+	azureBlockSize = 8 << 20
+	// azureDeleteWorkers 批量删除时的并发数
+	azureDeleteWorkers = 8
+)
+
+// azureBackend Azure Blob存储，通过REST API和共享密钥签名访问，不依赖SDK。
+// 存储桶对应容器；元数据名称只能是标识符，File-Id在Azure中保存为file_id
+type azureBackend struct {
+	account  string
+	key      []byte
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// azureError Blob服务返回的错误
+type azureError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *azureError) Error() string {
+	return fmt.Sprintf("azure blob: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is 使IsNotFound、IsPreconditionFailed可以识别Azure错误
+func (e *azureError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// NewAzureBackend 创建Azure Blob后端，endpoint为空时使用https://<account>.blob.core.windows.net
+func NewAzureBackend(cfg config.AzureConfig) (StorageBackend, error) {
+	if cfg.AccountName == "" || cfg.AccountKey == "" {
+		return nil, errors.New("storage.azure.account_name and account_key are required")
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage.azure.account_key: %w", err)
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + cfg.AccountName + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage.azure.endpoint: %w", err)
+	}
+
+	return &azureBackend{
+		account:  cfg.AccountName,
+		key:      key,
+		endpoint: u,
+		client:   &http.Client{},
+	}, nil
+}
+
+func (b *azureBackend) url(container, blob string, query url.Values) *url.URL {
+	u := *b.endpoint
+	u.Path += "/" + container
+	if blob != "" {
+		u.Path += "/" + blob
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (b *azureBackend) do(ctx context.Context, method string, u *url.URL, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	b.sign(req)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		azErr := &azureError{StatusCode: resp.StatusCode, Code: resp.Header.Get("x-ms-error-code")}
+		var body struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); xml.Unmarshal(data, &body) == nil {
+			if body.Code != "" {
+				azErr.Code = body.Code
+			}
+			azErr.Message = body.Message
+		}
+		return nil, azErr
+	}
+	return resp, nil
+}
+
+// sign 按共享密钥方案签名（Blob服务2009-09-19及以后版本的格式）
+func (b *azureBackend) sign(req *http.Request) {
+	h := req.Header
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		length,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		"", // Date，使用x-ms-date
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	}, "\n") + "\n" + azureCanonicalHeaders(h) + azureCanonicalResource(b.account, req.URL)
+
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(stringToSign))
+	h.Set("Authorization", "SharedKey "+b.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// azureCanonicalHeaders 按名称排序的x-ms-头，每个一行
+func azureCanonicalHeaders(h http.Header) string {
+	var names []string
+	for name := range h {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		var values []string
+		for _, v := range h.Values(name) {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+		sb.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return sb.String()
+}
+
+// azureCanonicalResource /<account><编码后的路径>，随后是按名称排序的查询参数
+func azureCanonicalResource(account string, u *url.URL) string {
+	var sb strings.Builder
+	sb.WriteString("/" + account + u.EscapedPath())
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		sb.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+	return sb.String()
+}
+
+// azureMetaHeader 元数据名称必须是标识符：File-Id写为x-ms-meta-file_id
+func azureMetaHeader(name string) string {
+	return "x-ms-meta-" + strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+}
+
+// azureMetaName 将Azure元数据名称还原为网关使用的形式，如file_id还原为File-Id
+func azureMetaName(name string) string {
+	return http.CanonicalHeaderKey(strings.ReplaceAll(name, "_", "-"))
+}
+
+func azureETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+func (b *azureBackend) EnsureBucket(ctx context.Context, bucket string) error {
+	resp, err := b.do(ctx, http.MethodPut, b.url(bucket, "", url.Values{"restype": {"container"}}), nil, nil, 0)
+	if err != nil {
+		var azErr *azureError
+		if errors.As(err, &azErr) && azErr.Code == "ContainerAlreadyExists" {
+			return nil
+		}
+		return fmt.Errorf("create bucket: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *azureBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error {
+	if size >= 0 && size <= azureSinglePutLimit {
+		header := b.blobHeader(opts.ContentType, opts.UserMetadata)
+		header.Set("x-ms-blob-type", "BlockBlob")
+		resp, err := b.do(ctx, http.MethodPut, b.url(bucket, key, nil), header, io.LimitReader(reader, size), size)
+		if err != nil {
+			return fmt.Errorf("put object: %w", err)
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return b.putBlocks(ctx, bucket, key, reader, opts)
+}
+
+// putBlocks 长度未知或超大的对象逐块上传，最后提交块列表
+func (b *azureBackend) putBlocks(ctx context.Context, bucket, key string, reader io.Reader, opts PutOptions) error {
+	var ids []string
+	buf := make([]byte, azureBlockSize)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(ids))))
+			query := url.Values{"comp": {"block"}, "blockid": {id}}
+			resp, putErr := b.do(ctx, http.MethodPut, b.url(bucket, key, query), nil, bytes.NewReader(buf[:n]), int64(n))
+			if putErr != nil {
+				return fmt.Errorf("put block: %w", putErr)
+			}
+			resp.Body.Close()
+			ids = append(ids, id)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("put object: %w", err)
+		}
+	}
+
+	var list bytes.Buffer
+	list.WriteString(xml.Header + "<BlockList>")
+	for _, id := range ids {
+		list.WriteString("<Latest>" + id + "</Latest>")
+	}
+	list.WriteString("</BlockList>")
+
+	header := b.blobHeader(opts.ContentType, opts.UserMetadata)
+	resp, err := b.do(ctx, http.MethodPut, b.url(bucket, key, url.Values{"comp": {"blocklist"}}), header, &list, int64(list.Len()))
+	if err != nil {
+		return fmt.Errorf("put block list: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *azureBackend) blobHeader(contentType string, metadata map[string]string) http.Header {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("x-ms-blob-content-type", contentType)
+	}
+	for name, value := range metadata {
+		header.Set(azureMetaHeader(name), value)
+	}
+	return header
+}
+
+// azureObjectInfo 从Get Blob/Get Blob Properties响应头读取对象信息
+func azureObjectInfo(key string, header http.Header) minio.ObjectInfo {
+	info := minio.ObjectInfo{
+		Key:          key,
+		ETag:         azureETag(header.Get("ETag")),
+		ContentType:  header.Get("Content-Type"),
+		UserMetadata: make(map[string]string),
+	}
+	info.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	// 区间读取时Content-Length是区间长度，对象大小取自Content-Range
+	if cr := header.Get("Content-Range"); cr != "" {
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if total, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				info.Size = total
+			}
+		}
+	}
+	info.LastModified, _ = http.ParseTime(header.Get("Last-Modified"))
+	for name, values := range header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-meta-") && len(values) > 0 {
+			info.UserMetadata[azureMetaName(lower[len("x-ms-meta-"):])] = values[0]
+		}
+	}
+	return info
+}
+
+func (b *azureBackend) GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error) {
+	header := http.Header{}
+	if opts.Start >= 0 {
+		if opts.End >= 0 {
+			header.Set("x-ms-range", fmt.Sprintf("bytes=%d-%d", opts.Start, opts.End))
+		} else {
+			header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", opts.Start))
+		}
+	}
+	if opts.MatchETag != "" {
+		header.Set("If-Match", `"`+azureETag(opts.MatchETag)+`"`)
+	}
+	resp, err := b.do(ctx, http.MethodGet, b.url(bucket, key, nil), header, nil, 0)
+	if err != nil {
+		return &failedObject{err: fmt.Errorf("get object: %w", err)}, nil
+	}
+	return &azureObject{body: resp.Body, info: azureObjectInfo(key, resp.Header)}, nil
+}
+
+func (b *azureBackend) StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.url(bucket, key, nil), nil, nil, 0)
+	if err != nil {
+		return minio.ObjectInfo{}, fmt.Errorf("stat object: %w", err)
+	}
+	resp.Body.Close()
+	return azureObjectInfo(key, resp.Header), nil
+}
+
+// azureListResult List Blobs响应
+type azureListResult struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string `xml:"Name"`
+			Properties struct {
+				LastModified  string `xml:"Last-Modified"`
+				ETag          string `xml:"Etag"`
+				ContentLength int64  `xml:"Content-Length"`
+				ContentType   string `xml:"Content-Type"`
+			} `xml:"Properties"`
+			Metadata struct {
+				Items []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"Metadata"`
+		} `xml:"Blob"`
+		BlobPrefix []struct {
+			Name string `xml:"Name"`
+		} `xml:"BlobPrefix"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// objects 将一页结果中的对象和公共前缀按名称合并
+func (r *azureListResult) objects() []minio.ObjectInfo {
+	objects := make([]minio.ObjectInfo, 0, len(r.Blobs.Blob)+len(r.Blobs.BlobPrefix))
+	for _, blob := range r.Blobs.Blob {
+		info := minio.ObjectInfo{
+			Key:          blob.Name,
+			ETag:         azureETag(blob.Properties.ETag),
+			Size:         blob.Properties.ContentLength,
+			ContentType:  blob.Properties.ContentType,
+			UserMetadata: make(map[string]string, len(blob.Metadata.Items)),
+		}
+		info.LastModified, _ = http.ParseTime(blob.Properties.LastModified)
+		for _, item := range blob.Metadata.Items {
+			info.UserMetadata[azureMetaName(item.XMLName.Local)] = item.Value
+		}
+		objects = append(objects, info)
+	}
+	for _, prefix := range r.Blobs.BlobPrefix {
+		objects = append(objects, minio.ObjectInfo{Key: prefix.Name})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects
+}
+
+func (b *azureBackend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	marker := ""
+	for {
+		query := url.Values{
+			"restype": {"container"},
+			"comp":    {"list"},
+			"include": {"metadata"},
+		}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if !recursive {
+			query.Set("delimiter", "/")
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		resp, err := b.do(ctx, http.MethodGet, b.url(bucket, "", query), nil, nil, 0)
+		if err != nil {
+			return fmt.Errorf("list objects: %w", err)
+		}
+		var result azureListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("list objects: %w", err)
+		}
+
+		for _, object := range result.objects() {
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+		if result.NextMarker == "" {
+			return nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (b *azureBackend) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error {
+	return b.CopyBetween(ctx, bucket, srcKey, bucket, dstKey, opts)
+}
+
+// CopyBetween 服务端复制，源和目标可以位于同一账户的不同容器，不限对象大小。
+// Azure总是保留源对象的Content-Type，ReplaceMetadata只替换元数据
+func (b *azureBackend) CopyBetween(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts CopyOptions) error {
+	header := http.Header{}
+	header.Set("x-ms-copy-source", b.url(srcBucket, srcKey, nil).String())
+	if opts.MatchETag != "" {
+		header.Set("x-ms-source-if-match", `"`+azureETag(opts.MatchETag)+`"`)
+	}
+	if opts.ReplaceMetadata {
+		for name, value := range opts.UserMetadata {
+			header.Set(azureMetaHeader(name), value)
+		}
+	}
+
+	resp, err := b.do(ctx, http.MethodPut, b.url(dstBucket, dstKey, nil), header, nil, 0)
+	if err != nil {
+		return fmt.Errorf("copy object: %w", err)
+	}
+	resp.Body.Close()
+
+	// 同一账户内的复制通常同步完成，否则等待复制结束
+	status := resp.Header.Get("x-ms-copy-status")
+	for status == "pending" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+		resp, err := b.do(ctx, http.MethodHead, b.url(dstBucket, dstKey, nil), nil, nil, 0)
+		if err != nil {
+			return fmt.Errorf("copy object: %w", err)
+		}
+		resp.Body.Close()
+		status = resp.Header.Get("x-ms-copy-status")
+	}
+	if status != "" && status != "success" {
+		return fmt.Errorf("copy object: copy status %s", status)
+	}
+	return nil
+}
+
+func (b *azureBackend) RemoveObjects(ctx context.Context, bucket string, keys []string) error {
+	keyCh := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < azureDeleteWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyCh {
+				resp, err := b.do(ctx, http.MethodDelete, b.url(bucket, key, nil), nil, nil, 0)
+				if err == nil {
+					resp.Body.Close()
+					continue
+				}
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("delete %s: %w", key, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		keyCh <- key
+	}
+	close(keyCh)
+	wg.Wait()
+	return firstErr
+}
+
+// azureObject Get Blob的响应体
+type azureObject struct {
+	body io.ReadCloser
+	info minio.ObjectInfo
+}
+
+func (o *azureObject) Read(p []byte) (int, error) {
+	return o.body.Read(p)
+}
+
+func (o *azureObject) Stat() (minio.ObjectInfo, error) {
+	return o.info, nil
+}
+
+func (o *azureObject) Close() error {
+	return o.body.Close()
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAzureCanonicalization(t *testing.T) {
+	h := http.Header{}
+	h.Set("x-ms-version", "2021-08-06")
+	h.Set("x-ms-date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	h.Set("X-Ms-Meta-File_id", "  abc   def ")
+	h.Set("Content-Type", "text/plain")
+
+	want := "x-ms-date:Mon, 02 Jan 2006 15:04:05 GMT\nx-ms-meta-file_id:abc def\nx-ms-version:2021-08-06\n"
+	if got := azureCanonicalHeaders(h); got != want {
+		t.Errorf("headers = %q, want %q", got, want)
+	}
+
+	u, _ := url.Parse("https://acct.blob.core.windows.net/user-1/My%20Docs/a.txt?restype=container&comp=list&include=metadata")
+	want = "/acct/user-1/My%20Docs/a.txt\ncomp:list\ninclude:metadata\nrestype:container"
+	if got := azureCanonicalResource("acct", u); got != want {
+		t.Errorf("resource = %q, want %q", got, want)
+	}
+}
+
+func TestAzureMetadataNames(t *testing.T) {
+	if got := azureMetaHeader(MetaFileID); got != "x-ms-meta-file_id" {
+		t.Errorf("azureMetaHeader = %q", got)
+	}
+	if got := azureMetaName("file_id"); got != MetaFileID {
+		t.Errorf("azureMetaName = %q, want %q", got, MetaFileID)
+	}
+}
+
+func TestAzureListResultOrder(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults ContainerName="user-1">
+  <Blobs>
+    <Blob>
+      <Name>docs.txt</Name>
+      <Properties>
+        <Last-Modified>Mon, 02 Jan 2006 15:04:05 GMT</Last-Modified>
+        <Etag>"0x8D1"</Etag>
+        <Content-Length>7</Content-Length>
+        <Content-Type>text/plain</Content-Type>
+      </Properties>
+      <Metadata><file_id>id-1</file_id></Metadata>
+    </Blob>
+    <Blob><Name>other.txt</Name><Properties><Content-Length>5</Content-Length></Properties></Blob>
+    <BlobPrefix><Name>docs/</Name></BlobPrefix>
+  </Blobs>
+  <NextMarker />
+</EnumerationResults>`
+
+	var result azureListResult
+	if err := xml.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	objects := result.objects()
+
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	if want := []string{"docs.txt", "docs/", "other.txt"}; !equalKeys(keys, want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+	if objects[0].ETag != "0x8D1" || objects[0].Size != 7 || FileID(objects[0]) != "id-1" {
+		t.Errorf("first object = %+v", objects[0])
+	}
+	if result.NextMarker != "" {
+		t.Errorf("NextMarker = %q", result.NextMarker)
+	}
+}
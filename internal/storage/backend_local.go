@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// localStateDir 根目录下保存元数据和临时文件的目录，存储桶名称不会以.开头
+const localStateDir = ".gateway"
+
+// localMeta 对象的元数据，按键的哈希保存在.gateway/meta/<bucket>/下
+type localMeta struct {
+	ContentType  string            `json:"content_type"`
+	ETag         string            `json:"etag"`
+	Size         int64             `json:"size"`
+	ModTime      time.Time         `json:"mod_time"`
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+}
+
+// localBackend 本地目录存储：<root>/<bucket>/<key>就是普通文件，可以直接浏览和备份。
+// 每个目录都视为目录标记；在网关之外放入或修改的文件同样可见，ETag按大小和修改时间生成
+type localBackend struct {
+	root string
+}
+
+// NewLocalBackend 创建本地目录后端
+func NewLocalBackend(root string) (StorageBackend, error) {
+	if root == "" {
+		return nil, errors.New("storage.local.root_path is required")
+	}
+	if err := os.MkdirAll(filepath.Join(root, localStateDir, "tmp"), 0o755); err != nil {
+		return nil, fmt.Errorf("create storage root: %w", err)
+	}
+	return &localBackend{root: root}, nil
+}
+
+func (b *localBackend) bucketDir(bucket string) (string, error) {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	return filepath.Join(b.root, bucket), nil
+}
+
+// objectPath 对象键对应的文件或目录，拒绝包含.、..或空段的键
+func (b *localBackend) objectPath(bucket, key string) (string, error) {
+	dir, err := b.bucketDir(bucket)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(key, "/")
+	if name == "" {
+		return dir, nil
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, "\x00\\") {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+func (b *localBackend) metaPath(bucket, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(b.root, localStateDir, "meta", bucket, hex.EncodeToString(sum[:])+".json")
+}
+
+func (b *localBackend) readMeta(bucket, key string) *localMeta {
+	data, err := os.ReadFile(b.metaPath(bucket, key))
+	if err != nil {
+		return nil
+	}
+	var meta localMeta
+	if json.Unmarshal(data, &meta) != nil {
+		return nil
+	}
+	return &meta
+}
+
+func (b *localBackend) writeMeta(bucket, key string, meta *localMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	p := b.metaPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return b.writeAtomic(p, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeAtomic 先写入临时文件再改名，读者不会看到写了一半的文件
+func (b *localBackend) writeAtomic(dst string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Join(b.root, localStateDir, "tmp"), "put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// info 组合文件信息和元数据；文件在网关之外被修改过时元数据中的ETag失效，按大小和修改时间重新生成
+func (b *localBackend) info(bucket, key string, fi os.FileInfo) minio.ObjectInfo {
+	info := minio.ObjectInfo{
+		Key:          key,
+		LastModified: fi.ModTime().UTC(),
+	}
+	meta := b.readMeta(bucket, key)
+	if meta != nil {
+		info.UserMetadata = meta.UserMetadata
+	}
+
+	if fi.IsDir() {
+		info.ContentType = "application/x-directory"
+		info.ETag = fmt.Sprintf("%x", md5.Sum(nil))
+		return info
+	}
+
+	info.Size = fi.Size()
+	if meta != nil && meta.Size == fi.Size() && meta.ModTime.Equal(fi.ModTime()) {
+		info.ETag, info.ContentType = meta.ETag, meta.ContentType
+	} else {
+		info.ETag = fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size())
+		// 复制时记录的内容ETag对应的是修改前的内容
+		if meta != nil && meta.UserMetadata[MetaContentETag] != "" {
+			info.UserMetadata = make(map[string]string, len(meta.UserMetadata))
+			for k, v := range meta.UserMetadata {
+				if k != MetaContentETag {
+					info.UserMetadata[k] = v
+				}
+			}
+		}
+	}
+	if info.ContentType == "" {
+		info.ContentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	return info
+}
+
+func (b *localBackend) EnsureBucket(ctx context.Context, bucket string) error {
+	dir, err := b.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create bucket: %w", err)
+	}
+	return nil
+}
+
+func (b *localBackend) checkBucket(bucket string) error {
+	dir, err := b.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("bucket %s: %w", bucket, ErrNotFound)
+	}
+	return nil
+}
+
+func (b *localBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+	p, err := b.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			return err
+		}
+		return b.writeMeta(bucket, key, &localMeta{ContentType: opts.ContentType, UserMetadata: opts.UserMetadata})
+	}
+
+	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+		return fmt.Errorf("put object: %s is a folder", key)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	hash := md5.New()
+	err = b.writeAtomic(p, func(w io.Writer) error {
+		n, err := io.Copy(io.MultiWriter(w, hash), reader)
+		if err != nil {
+			return err
+		}
+		if size >= 0 && n != size {
+			return fmt.Errorf("put object: read %d of %d bytes: %w", n, size, io.ErrUnexpectedEOF)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	return b.writeMeta(bucket, key, &localMeta{
+		ContentType:  opts.ContentType,
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+		Size:         fi.Size(),
+		ModTime:      fi.ModTime(),
+		UserMetadata: opts.UserMetadata,
+	})
+}
+
+func (b *localBackend) stat(bucket, key string) (string, os.FileInfo, error) {
+	p, err := b.objectPath(bucket, key)
+	if err != nil {
+		return "", nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil || fi.IsDir() != strings.HasSuffix(key, "/") || (key == "" || key == "/") {
+		return "", nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return p, fi, nil
+}
+
+func (b *localBackend) StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error) {
+	_, fi, err := b.stat(bucket, key)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return b.info(bucket, key, fi), nil
+}
+
+func (b *localBackend) GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error) {
+	p, fi, err := b.stat(bucket, key)
+	if err != nil {
+		return &failedObject{err: err}, nil
+	}
+	info := b.info(bucket, key, fi)
+	if opts.MatchETag != "" && strings.Trim(opts.MatchETag, `"`) != info.ETag {
+		return &failedObject{err: fmt.Errorf("%s: %w", key, ErrPreconditionFailed)}, nil
+	}
+	if fi.IsDir() {
+		return &localObject{reader: strings.NewReader(""), info: info}, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return &failedObject{err: err}, nil
+	}
+	obj := &localObject{file: f, reader: f, info: info}
+	if opts.Start >= 0 {
+		end := opts.End
+		if end < 0 || end >= info.Size {
+			end = info.Size - 1
+		}
+		obj.reader = io.NewSectionReader(f, opts.Start, end-opts.Start+1)
+	}
+	return obj, nil
+}
+
+func (b *localBackend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	if err := b.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	// prefix可以在名称中间结束，如"docs/rep"匹配"docs/report.csv"
+	dirKey, namePrefix := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dirKey, namePrefix = prefix[:i+1], prefix[i+1:]
+	}
+	dir, err := b.objectPath(bucket, dirKey)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+	if dirKey != "" && namePrefix == "" {
+		if err := fn(b.info(bucket, dirKey, fi)); err != nil {
+			return err
+		}
+	}
+	return b.walk(ctx, bucket, dirKey, dir, namePrefix, recursive, fn)
+}
+
+// walk 按S3键的字典序遍历目录：子目录按"名称/"参与排序，保证"a.txt"排在"a/"之前
+func (b *localBackend) walk(ctx context.Context, bucket, dirKey, dir, namePrefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("list objects: %w", err)
+	}
+
+	type entry struct {
+		key string
+		fi  os.FileInfo
+	}
+	children := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), namePrefix) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue // 遍历期间被删除
+		}
+		key := dirKey + e.Name()
+		if fi.IsDir() {
+			key += "/"
+		}
+		children = append(children, entry{key: key, fi: fi})
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].key < children[j].key })
+
+	for _, child := range children {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if child.fi.IsDir() && !recursive {
+			if err := fn(minio.ObjectInfo{Key: child.key}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(b.info(bucket, child.key, child.fi)); err != nil {
+			return err
+		}
+		if child.fi.IsDir() {
+			childDir := filepath.Join(dir, filepath.Base(strings.TrimSuffix(child.key, "/")))
+			if err := b.walk(ctx, bucket, child.key, childDir, "", true, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *localBackend) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error {
+	srcPath, fi, err := b.stat(bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	info := b.info(bucket, srcKey, fi)
+	if opts.MatchETag != "" && strings.Trim(opts.MatchETag, `"`) != info.ETag {
+		return fmt.Errorf("%s: %w", srcKey, ErrPreconditionFailed)
+	}
+
+	contentType, userMetadata := info.ContentType, info.UserMetadata
+	if opts.ReplaceMetadata {
+		contentType, userMetadata = opts.ContentType, opts.UserMetadata
+	}
+	if fi.IsDir() {
+		return b.PutObject(ctx, bucket, dstKey, strings.NewReader(""), 0, PutOptions{ContentType: contentType, UserMetadata: userMetadata})
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return b.PutObject(ctx, bucket, dstKey, src, fi.Size(), PutOptions{ContentType: contentType, UserMetadata: userMetadata})
+}
+
+// copyMethod 本地目录后端的复制由网关读取源文件后写入
+func (b *localBackend) copyMethod(size int64) string {
+	return CopyStreamed
+}
+
+// RenamePrefix 改名文件系统目录，目录下的文件一次完成移动，随后逐个移动按键保存的元数据。
+// 目标已存在时返回错误，目标的上级目录不存在时先创建
+func (b *localBackend) RenamePrefix(ctx context.Context, bucket, srcPrefix, dstPrefix string) error {
+	src, err := b.objectPath(bucket, srcPrefix)
+	if err != nil {
+		return err
+	}
+	dst, err := b.objectPath(bucket, dstPrefix)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		return fmt.Errorf("rename %s: %w", srcPrefix, ErrNotFound)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("rename %s: %s already exists", srcPrefix, dstPrefix)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("rename %s: %w", srcPrefix, err)
+	}
+
+	// 元数据文件以键的哈希命名，需要按新键逐个改名；缺少元数据的对象（网关之外放入的文件）跳过
+	return filepath.WalkDir(dst, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		suffix := ""
+		if rel != "." {
+			suffix = filepath.ToSlash(rel)
+			if d.IsDir() {
+				suffix += "/"
+			}
+		}
+		err = os.Rename(b.metaPath(bucket, srcPrefix+suffix), b.metaPath(bucket, dstPrefix+suffix))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (b *localBackend) RemoveObjects(ctx context.Context, bucket string, keys []string) error {
+	for _, key := range keys {
+		p, err := b.objectPath(bucket, key)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(p)
+		switch {
+		case err != nil || key == "" || fi.IsDir() != strings.HasSuffix(key, "/"):
+			// 不存在的键不视为错误
+		case fi.IsDir():
+			// 目录中还有对象时保留目录，与S3中删除标记后仍存在的隐式目录一致
+			if err := os.Remove(p); err != nil && !dirHasEntries(p) {
+				return fmt.Errorf("delete %s: %w", key, err)
+			}
+		default:
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("delete %s: %w", key, err)
+			}
+		}
+		if err := os.Remove(b.metaPath(bucket, key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func dirHasEntries(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(1)
+	return len(names) > 0
+}
+
+// localObject 本地文件对象，读取区间时reader为SectionReader
+type localObject struct {
+	file   *os.File
+	reader io.Reader
+	info   minio.ObjectInfo
+}
+
+func (o *localObject) Read(p []byte) (int, error) {
+	return o.reader.Read(p)
+}
+
+func (o *localObject) Stat() (minio.ObjectInfo, error) {
+	return o.info, nil
+}
+
+func (o *localObject) Close() error {
+	if o.file != nil {
+		return o.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// defaultPartSize 未配置storage.minio.part_size时长度未知的上传使用的分片大小
+const defaultPartSize = 16 << 20
+
+// maxCopyObjectSize S3单次CopyObject请求的对象大小上限
+const maxCopyObjectSize = 5 << 30
+
+// minioBackend MinIO及其他S3兼容存储
+type minioBackend struct {
+	client   *minio.Client
+	partSize uint64
+	// presigner 按客户端访问的地址签名，未配置public_endpoint时与client相同
+	presigner *minio.Client
+}
+
+// NewMinIOBackend 创建MinIO/S3后端，AWS S3使用endpoint s3.amazonaws.com并设置region
+func NewMinIOBackend(cfg config.MinIOConfig) (StorageBackend, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create minio client: %w", err)
+	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		if presigner, err = newPresignClient(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &minioBackend{client: client, partSize: partSize, presigner: presigner}, nil
+}
+
+// newPresignClient 创建按public_endpoint签名的客户端，只用于生成URL。
+// 预签名不需要访问存储，但未设置region时minio-go会查询存储桶所在区域，因此默认使用us-east-1
+func newPresignClient(cfg config.MinIOConfig) (*minio.Client, error) {
+	u, err := url.Parse(cfg.PublicEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse public endpoint: %w", err)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: u.Scheme == "https",
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create presign client: %w", err)
+	}
+	return client, nil
+}
+
+// PresignGet 生成预签名GET URL，通过response-content-*参数让存储返回指定的响应头
+func (b *minioBackend) PresignGet(ctx context.Context, bucket, key string, expiry time.Duration, opts PresignGetOptions) (string, error) {
+	params := make(url.Values)
+	if opts.ContentType != "" {
+		params.Set("response-content-type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		params.Set("response-content-disposition", opts.ContentDisposition)
+	}
+	u, err := b.presigner.PresignedGetObject(ctx, bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (b *minioBackend) EnsureBucket(ctx context.Context, bucket string) error {
+	exists, err := b.client.BucketExists(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("check bucket exists: %w", err)
+	}
+	if !exists {
+		if err := b.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *minioBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error {
+	putOpts := minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+	}
+	if size < 0 {
+		// 长度未知时minio-go默认按5TiB/10000计算分片大小并整片缓冲，
+		// 固定分片大小使每个上传的内存占用有上限
+		putOpts.PartSize = b.partSize
+	}
+	// 分片上传失败时minio-go使用同一个上下文中止上传，请求已取消时中止请求也会失败，
+	// 未完成的分片会一直占用存储空间。因此流式上传使用不随请求取消的上下文，
+	// 取消时读取请求体立即失败，minio-go随即中止分片上传；正在发送的分片最多再传完一个
+	uploadCtx := ctx
+	if r, ok := withContext(ctx, reader).(*contextReader); ok {
+		reader, uploadCtx = r, context.WithoutCancel(ctx)
+	}
+	_, err := b.client.PutObject(uploadCtx, bucket, key, reader, size, putOpts)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("upload aborted: %w", ctx.Err())
+	}
+	return err
+}
+
+func (b *minioBackend) GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error) {
+	getOpts := minio.GetObjectOptions{}
+	if opts.Start >= 0 {
+		if err := getOpts.SetRange(opts.Start, opts.End); err != nil {
+			return nil, fmt.Errorf("set range: %w", err)
+		}
+	}
+	if opts.MatchETag != "" {
+		if err := getOpts.SetMatchETag(opts.MatchETag); err != nil {
+			return nil, fmt.Errorf("set etag: %w", err)
+		}
+	}
+	return b.client.GetObject(ctx, bucket, key, getOpts)
+}
+
+func (b *minioBackend) StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error) {
+	return b.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+}
+
+func (b *minioBackend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 提前结束时停止后台分页
+
+	opts := minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    recursive,
+		WithMetadata: true,
+	}
+	for object := range b.client.ListObjects(ctx, bucket, opts) {
+		if object.Err != nil {
+			return fmt.Errorf("list objects: %w", object.Err)
+		}
+		if err := fn(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *minioBackend) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error {
+	return b.CopyBetween(ctx, bucket, srcKey, bucket, dstKey, opts)
+}
+
+// CopyBetween 服务端复制，源和目标可以位于不同存储桶。超过5GiB的对象通过UploadPartCopy分段复制，
+// 数据同样不经过网关
+func (b *minioBackend) CopyBetween(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts CopyOptions) error {
+	src := minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey, MatchETag: opts.MatchETag}
+	multipart := opts.SourceSize > maxCopyObjectSize
+	if multipart && !opts.ReplaceMetadata {
+		// 分段复制不会沿用源对象的Content-Type和元数据，改为显式写入
+		info, err := b.client.StatObject(ctx, srcBucket, srcKey, minio.StatObjectOptions{})
+		if err != nil {
+			return err
+		}
+		opts.ReplaceMetadata, opts.ContentType = true, info.ContentType
+		opts.UserMetadata = make(map[string]string, len(info.UserMetadata))
+		for k, v := range info.UserMetadata {
+			opts.UserMetadata[strings.TrimPrefix(k, "X-Amz-Meta-")] = v
+		}
+	}
+
+	dst := minio.CopyDestOptions{Bucket: dstBucket, Object: dstKey}
+	if opts.ReplaceMetadata {
+		dst.ReplaceMetadata = true
+		dst.UserMetadata = make(map[string]string, len(opts.UserMetadata)+1)
+		for k, v := range opts.UserMetadata {
+			dst.UserMetadata[k] = v
+		}
+		if opts.ContentType != "" {
+			dst.UserMetadata["Content-Type"] = opts.ContentType
+		}
+	}
+
+	var err error
+	if multipart {
+		_, err = b.client.ComposeObject(ctx, dst, src)
+	} else {
+		_, err = b.client.CopyObject(ctx, dst, src)
+	}
+	return err
+}
+
+func (b *minioBackend) copyMethod(size int64) string {
+	if size > maxCopyObjectSize {
+		return CopyMultipart
+	}
+	return CopyServerSide
+}
+
+// PresignPut 预签名PUT，Content-Length、Content-Type和用户元数据作为签名的请求头，客户端必须原样发送
+func (b *minioBackend) PresignPut(ctx context.Context, bucket, key string, size int64, expiry time.Duration, opts PutOptions) (PresignedRequest, error) {
+	header := make(http.Header)
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	for k, v := range opts.UserMetadata {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	u, err := b.presigner.PresignHeader(ctx, http.MethodPut, bucket, key, expiry, nil, header)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	return PresignedRequest{Method: http.MethodPut, URL: u.String(), Header: header}, nil
+}
+
+func (b *minioBackend) NewMultipartUpload(ctx context.Context, bucket, key string, opts PutOptions) (string, error) {
+	core := minio.Core{Client: b.client}
+	return core.NewMultipartUpload(ctx, bucket, key, minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+	})
+}
+
+func (b *minioBackend) PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int, expiry time.Duration) (PresignedRequest, error) {
+	params := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}
+	u, err := b.presigner.PresignHeader(ctx, http.MethodPut, bucket, key, expiry, params, nil)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	return PresignedRequest{Method: http.MethodPut, URL: u.String()}, nil
+}
+
+// CompleteMultipartUpload 按存储中已上传的分段合并对象，客户端不需要提交各分段的ETag
+func (b *minioBackend) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts int) error {
+	core := minio.Core{Client: b.client}
+	var completed []minio.CompletePart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return err
+		}
+		for _, part := range result.ObjectParts {
+			completed = append(completed, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	if len(completed) < parts {
+		return ErrUploadIncomplete
+	}
+	_, err := core.CompleteMultipartUpload(ctx, bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	return err
+}
+
+func (b *minioBackend) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	return minio.Core{Client: b.client}.AbortMultipartUpload(ctx, bucket, key, uploadID)
+}
+
+func (b *minioBackend) RemoveObjects(ctx context.Context, bucket string, keys []string) error {
+	objectsCh := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		objectsCh <- minio.ObjectInfo{Key: key}
+	}
+	close(objectsCh)
+
+	// 读完全部结果，记录每个失败的对象，调用方据此计算实际删除的对象
+	var failed *RemoveObjectsError
+	for err := range b.client.RemoveObjects(ctx, bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if err.Err == nil {
+			continue
+		}
+		if failed == nil {
+			failed = &RemoveObjectsError{Err: err.Err}
+		}
+		failed.Keys = append(failed.Keys, err.ObjectName)
+	}
+	if failed != nil {
+		return failed
+	}
+	return nil
+}
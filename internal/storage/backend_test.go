@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 每个后端都运行同一组用例。本地目录后端总是运行，MinIO/S3和Azure后端在设置了
+// 对应的环境变量时运行（例如连接CI中的MinIO或Azurite容器）
+func TestLocalBackend(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageBackend(t, backend, "user-local")
+}
+
+func TestMinIOBackend(t *testing.T) {
+	endpoint := os.Getenv("WEBDAV_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("WEBDAV_TEST_S3_ENDPOINT not set")
+	}
+	backend, err := NewMinIOBackend(config.MinIOConfig{
+		Endpoint:  endpoint,
+		AccessKey: os.Getenv("WEBDAV_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("WEBDAV_TEST_S3_SECRET_KEY"),
+		UseSSL:    os.Getenv("WEBDAV_TEST_S3_USE_SSL") == "true",
+		Region:    os.Getenv("WEBDAV_TEST_S3_REGION"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageBackend(t, backend, fmt.Sprintf("webdav-test-%d", time.Now().UnixNano()))
+}
+
+func TestAzureBackend(t *testing.T) {
+	account := os.Getenv("WEBDAV_TEST_AZURE_ACCOUNT")
+	if account == "" {
+		t.Skip("WEBDAV_TEST_AZURE_ACCOUNT not set")
+	}
+	backend, err := NewAzureBackend(config.AzureConfig{
+		AccountName: account,
+		AccountKey:  os.Getenv("WEBDAV_TEST_AZURE_KEY"),
+		Endpoint:    os.Getenv("WEBDAV_TEST_AZURE_ENDPOINT"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageBackend(t, backend, fmt.Sprintf("webdav-test-%d", time.Now().UnixNano()))
+}
+
+func testStorageBackend(t *testing.T, b StorageBackend, bucket string) {
+	ctx := context.Background()
+
+	if err := b.EnsureBucket(ctx, bucket); err != nil {
+		t.Fatalf("EnsureBucket: %v", err)
+	}
+	if err := b.EnsureBucket(ctx, bucket); err != nil {
+		t.Fatalf("EnsureBucket on existing bucket: %v", err)
+	}
+
+	put := func(key, content string, size int64, fileID string) {
+		t.Helper()
+		contentType := "text/plain"
+		if strings.HasSuffix(key, "/") {
+			contentType = "application/x-directory"
+		}
+		err := b.PutObject(ctx, bucket, key, strings.NewReader(content), size, PutOptions{
+			ContentType:  contentType,
+			UserMetadata: map[string]string{MetaFileID: fileID},
+		})
+		if err != nil {
+			t.Fatalf("PutObject %s: %v", key, err)
+		}
+	}
+	put("docs/", "", 0, "id-docs")
+	put("docs/a.txt", "hello", 5, "id-a")
+	put("docs/sub/b.txt", "nested", -1, "id-b")
+	put("docs.txt", "sibling", 7, "id-sibling")
+	put("other.txt", "other", 5, "id-other")
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := b.StatObject(ctx, bucket, "docs/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != 5 || info.ContentType != "text/plain" || info.ETag == "" {
+			t.Errorf("info = size %d, type %q, etag %q", info.Size, info.ContentType, info.ETag)
+		}
+		if FileID(info) != "id-a" {
+			t.Errorf("FileID = %q, want id-a", FileID(info))
+		}
+		if _, err := b.StatObject(ctx, bucket, "docs/missing.txt"); !IsNotFound(err) {
+			t.Errorf("stat missing object: got %v, want not found", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		keys := func(prefix string, recursive bool) []string {
+			t.Helper()
+			var keys []string
+			err := b.ListObjects(ctx, bucket, prefix, recursive, func(obj minio.ObjectInfo) error {
+				keys = append(keys, obj.Key)
+				if obj.Key == "docs/a.txt" && FileID(obj) != "id-a" {
+					t.Errorf("listed FileID = %q, want id-a", FileID(obj))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ListObjects(%q, %v): %v", prefix, recursive, err)
+			}
+			sort.Strings(keys)
+			return keys
+		}
+
+		if got, want := keys("", false), []string{"docs.txt", "docs/", "other.txt"}; !equalKeys(got, want) {
+			t.Errorf("root listing = %v, want %v", got, want)
+		}
+		if got, want := keys("docs/", false), []string{"docs/", "docs/a.txt", "docs/sub/"}; !equalKeys(got, want) {
+			t.Errorf("docs/ listing = %v, want %v", got, want)
+		}
+		// 本地目录后端把每个目录都当作目录标记，递归列表只比较文件
+		var files []string
+		for _, key := range keys("docs/", true) {
+			if !strings.HasSuffix(key, "/") {
+				files = append(files, key)
+			}
+		}
+		if want := []string{"docs/a.txt", "docs/sub/b.txt"}; !equalKeys(files, want) {
+			t.Errorf("recursive docs/ files = %v, want %v", files, want)
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err := b.ListObjects(ctx, bucket, "", true, func(minio.ObjectInfo) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("callback error: got %v after %d calls, want stop after 1", err, calls)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		info, err := b.StatObject(ctx, bucket, "docs/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj, err := b.GetObject(ctx, bucket, "docs/a.txt", GetOptions{Start: 1, End: 3, MatchETag: info.ETag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(obj)
+		obj.Close()
+		if err != nil || string(data) != "ell" {
+			t.Errorf("range read = %q, %v; want ell", data, err)
+		}
+
+		obj, err = b.GetObject(ctx, bucket, "docs/a.txt", GetOptions{Start: -1, MatchETag: "stale"})
+		if err == nil {
+			_, err = obj.Stat()
+			obj.Close()
+		}
+		if !IsPreconditionFailed(err) {
+			t.Errorf("stale etag: got %v, want precondition failed", err)
+		}
+
+		obj, err = b.GetObject(ctx, bucket, "missing.txt", GetOptions{Start: -1})
+		if err == nil {
+			_, err = obj.Stat()
+			obj.Close()
+		}
+		if !IsNotFound(err) {
+			t.Errorf("missing object: got %v, want not found", err)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		if err := b.CopyObject(ctx, bucket, "docs/a.txt", "copy/kept.txt", CopyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		info, err := b.StatObject(ctx, bucket, "copy/kept.txt")
+		if err != nil || FileID(info) != "id-a" || info.Size != 5 {
+			t.Errorf("copy with metadata: %+v, %v", info, err)
+		}
+
+		err = b.CopyObject(ctx, bucket, "docs/a.txt", "copy/new.txt", CopyOptions{
+			ReplaceMetadata: true,
+			ContentType:     "text/plain",
+			UserMetadata:    map[string]string{MetaFileID: "id-new"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, err := b.StatObject(ctx, bucket, "copy/new.txt"); err != nil || FileID(info) != "id-new" {
+			t.Errorf("copy with replaced metadata: FileID %q, %v", FileID(info), err)
+		}
+
+		err = b.CopyObject(ctx, bucket, "docs/a.txt", "copy/stale.txt", CopyOptions{MatchETag: "stale"})
+		if !IsPreconditionFailed(err) {
+			t.Errorf("copy with stale etag: got %v, want precondition failed", err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := b.RemoveObjects(ctx, bucket, []string{"docs/a.txt", "docs/never-existed.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.StatObject(ctx, bucket, "docs/a.txt"); !IsNotFound(err) {
+			t.Errorf("removed object: got %v, want not found", err)
+		}
+		if _, err := b.StatObject(ctx, bucket, "docs/sub/b.txt"); err != nil {
+			t.Errorf("sibling removed: %v", err)
+		}
+	})
+}
+
+func equalKeys(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
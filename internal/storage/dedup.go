@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// 按内容去重：不小于storage.dedup.min_size的文件按SHA-256只保存一份（blob），用户路径上是不含数据的
+// 指针对象，元数据记录内容的哈希和大小。读取、列出时指针对象报告内容的大小，ETag为内容的哈希
+const (
+	// MetaContentSHA256 指针对象用户元数据中内容的SHA-256（十六进制）
+	MetaContentSHA256 = "Content-Sha256"
+	// MetaContentSize 指针对象用户元数据中内容的字节数
+	MetaContentSize = "Content-Size"
+	// blobUploadPrefix 上传中的内容先写入该前缀下的临时对象，算出哈希后再复制为blob
+	blobUploadPrefix = "tmp/"
+)
+
+// BlobRefs 维护blob的引用计数：每个指针对象持有一个引用，计数归零的blob在宽限期后删除
+type BlobRefs interface {
+	// Acquire 为内容增加一个引用，内容第一次出现时登记大小
+	Acquire(ctx context.Context, hash string, size int64) error
+	// Release 减少一个引用
+	Release(ctx context.Context, hash string) error
+}
+
+// BlobHash 返回指针对象引用的内容哈希，普通对象和目录标记返回空字符串
+func BlobHash(info minio.ObjectInfo) string {
+	if strings.HasSuffix(info.Key, "/") {
+		return ""
+	}
+	return metadataValue(info, MetaContentSHA256)
+}
+
+// blobStore blob在底层后端中的位置，blob的键为{prefix}{哈希前两位}/{哈希}
+type blobStore struct {
+	backend StorageBackend
+	bucket  string
+	prefix  string
+}
+
+func (b blobStore) key(hash string) string {
+	return b.prefix + hash[:2] + "/" + hash
+}
+
+// dedupBackend 在按布局包装的后端之上实现按内容去重。小于minSize的文件、目录标记和
+// 去重启用前写入的对象仍是普通对象，原样读写
+type dedupBackend struct {
+	backend StorageBackend
+	blobs   blobStore
+	refs    BlobRefs
+	minSize int64
+}
+
+// logical 把指针对象的信息改为内容的大小和ETag，普通对象原样返回
+func logical(info minio.ObjectInfo) minio.ObjectInfo {
+	hash := BlobHash(info)
+	if hash == "" {
+		return info
+	}
+	info.Size, _ = strconv.ParseInt(metadataValue(info, MetaContentSize), 10, 64)
+	info.ETag = hash
+	return info
+}
+
+// pointerHash 返回键上现有指针对象引用的内容，不存在或不是指针时返回空字符串
+func (d *dedupBackend) pointerHash(ctx context.Context, bucket, key string) string {
+	info, err := d.backend.StatObject(ctx, bucket, key)
+	if err != nil {
+		return ""
+	}
+	return BlobHash(info)
+}
+
+// release 释放一个引用。失败只会使blob晚些（或不再）被删除，不影响数据，记录日志后继续
+func (d *dedupBackend) release(ctx context.Context, hash string) {
+	if hash == "" {
+		return
+	}
+	if err := d.refs.Release(context.WithoutCancel(ctx), hash); err != nil {
+		log.Printf("Warning: failed to release blob %s: %v", hash, err)
+	}
+}
+
+func (d *dedupBackend) EnsureBucket(ctx context.Context, bucket string) error {
+	return d.backend.EnsureBucket(ctx, bucket)
+}
+
+func (d *dedupBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error {
+	if strings.HasSuffix(key, "/") {
+		return d.backend.PutObject(ctx, bucket, key, reader, size, opts)
+	}
+
+	old := d.pointerHash(ctx, bucket, key)
+	if size >= 0 && size < d.minSize {
+		if err := d.backend.PutObject(ctx, bucket, key, reader, size, opts); err != nil {
+			return err
+		}
+		d.release(ctx, old)
+		return nil
+	}
+
+	hash, n, err := d.storeBlob(ctx, reader, size)
+	if err != nil {
+		return err
+	}
+	if err := d.putPointer(ctx, bucket, key, hash, n, opts); err != nil {
+		d.release(ctx, hash)
+		return err
+	}
+	d.release(ctx, old)
+	return nil
+}
+
+// storeBlob 把内容写入临时对象并计算哈希，为内容增加一个引用。blob尚不存在时由临时对象复制得到；
+// 并发上传相同内容时引用可能先于blob登记，两边都会复制，内容相同，重复写入无害
+func (d *dedupBackend) storeBlob(ctx context.Context, reader io.Reader, size int64) (string, int64, error) {
+	tmp := d.blobs.prefix + blobUploadPrefix + uuid.New().String()
+	hash := sha256.New()
+	counter := &countingReader{reader: io.TeeReader(reader, hash)}
+	if err := d.blobs.backend.PutObject(ctx, d.blobs.bucket, tmp, counter, size, PutOptions{}); err != nil {
+		return "", 0, err
+	}
+	defer d.blobs.backend.RemoveObjects(context.WithoutCancel(ctx), d.blobs.bucket, []string{tmp})
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if err := d.refs.Acquire(ctx, sum, counter.n); err != nil {
+		return "", 0, fmt.Errorf("acquire blob: %w", err)
+	}
+	if _, err := d.blobs.backend.StatObject(ctx, d.blobs.bucket, d.blobs.key(sum)); err != nil {
+		if IsNotFound(err) {
+			err = d.blobs.backend.CopyObject(ctx, d.blobs.bucket, tmp, d.blobs.key(sum), CopyOptions{SourceSize: counter.n})
+		}
+		if err != nil {
+			d.release(ctx, sum)
+			return "", 0, fmt.Errorf("store blob: %w", err)
+		}
+	}
+	return sum, counter.n, nil
+}
+
+// putPointer 在用户路径上写入引用blob的指针对象
+func (d *dedupBackend) putPointer(ctx context.Context, bucket, key, hash string, size int64, opts PutOptions) error {
+	metadata := make(map[string]string, len(opts.UserMetadata)+2)
+	for k, v := range opts.UserMetadata {
+		metadata[k] = v
+	}
+	metadata[MetaContentSHA256] = hash
+	metadata[MetaContentSize] = strconv.FormatInt(size, 10)
+	return d.backend.PutObject(ctx, bucket, key, strings.NewReader(""), 0, PutOptions{ContentType: opts.ContentType, UserMetadata: metadata})
+}
+
+// GetObject 读取指针对象时从blob中读取内容。先读取对象信息判断是否为指针，
+// 普通对象按读取到的版本（或调用方指定的版本）读取，避免读到期间被替换成的指针
+func (d *dedupBackend) GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error) {
+	info, err := d.backend.StatObject(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	hash := BlobHash(info)
+	if hash == "" {
+		if opts.MatchETag == "" {
+			opts.MatchETag = info.ETag
+		}
+		return d.backend.GetObject(ctx, bucket, key, opts)
+	}
+
+	info = logical(info)
+	if opts.MatchETag != "" && strings.Trim(opts.MatchETag, `"`) != info.ETag {
+		return nil, fmt.Errorf("%s: %w", key, ErrPreconditionFailed)
+	}
+	obj, err := d.blobs.backend.GetObject(ctx, d.blobs.bucket, d.blobs.key(hash), GetOptions{Start: opts.Start, End: opts.End})
+	if err != nil {
+		return nil, err
+	}
+	return &pointerObject{Object: obj, info: info}, nil
+}
+
+func (d *dedupBackend) StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error) {
+	info, err := d.backend.StatObject(ctx, bucket, key)
+	if err != nil {
+		return info, err
+	}
+	return logical(info), nil
+}
+
+func (d *dedupBackend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	return d.backend.ListObjects(ctx, bucket, prefix, recursive, func(object minio.ObjectInfo) error {
+		if object.Size == 0 && len(object.UserMetadata) == 0 && !strings.HasSuffix(object.Key, "/") {
+			// 列表中不返回用户元数据的服务（AWS S3）上，空对象可能是指针，读取元数据确认
+			if info, err := d.backend.StatObject(ctx, bucket, object.Key); err == nil {
+				object.UserMetadata = info.UserMetadata
+			}
+		}
+		return fn(logical(object))
+	})
+}
+
+// CopyObject 复制指针对象时只复制指针并增加一个引用，内容不重新写入
+func (d *dedupBackend) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error {
+	if strings.HasSuffix(srcKey, "/") {
+		return d.backend.CopyObject(ctx, bucket, srcKey, dstKey, opts)
+	}
+	src, err := d.backend.StatObject(ctx, bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	old := d.pointerHash(ctx, bucket, dstKey)
+
+	hash := BlobHash(src)
+	if hash == "" {
+		if err := d.backend.CopyObject(ctx, bucket, srcKey, dstKey, opts); err != nil {
+			return err
+		}
+		d.release(ctx, old)
+		return nil
+	}
+
+	content := logical(src)
+	if opts.MatchETag != "" && strings.Trim(opts.MatchETag, `"`) != content.ETag {
+		return fmt.Errorf("%s: %w", srcKey, ErrPreconditionFailed)
+	}
+	if opts.ReplaceMetadata {
+		metadata := make(map[string]string, len(opts.UserMetadata)+2)
+		for k, v := range opts.UserMetadata {
+			metadata[k] = v
+		}
+		metadata[MetaContentSHA256] = hash
+		metadata[MetaContentSize] = strconv.FormatInt(content.Size, 10)
+		opts.UserMetadata = metadata
+	}
+	opts.MatchETag, opts.SourceSize = src.ETag, src.Size
+
+	if err := d.refs.Acquire(ctx, hash, content.Size); err != nil {
+		return fmt.Errorf("acquire blob: %w", err)
+	}
+	if err := d.backend.CopyObject(ctx, bucket, srcKey, dstKey, opts); err != nil {
+		d.release(ctx, hash)
+		return err
+	}
+	d.release(ctx, old)
+	return nil
+}
+
+// PresignGet 普通对象由底层后端生成预签名URL。指针对象的内容在多个文件共享的blob中，
+// 不对外签发blob的地址，返回ErrPresignUnsupported由网关转发
+func (d *dedupBackend) PresignGet(ctx context.Context, bucket, key string, expiry time.Duration, opts PresignGetOptions) (string, error) {
+	info, err := d.backend.StatObject(ctx, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if BlobHash(info) != "" {
+		return "", ErrPresignUnsupported
+	}
+	backend, bucket, key := resolve(d.backend, bucket, key)
+	presigner, ok := backend.(Presigner)
+	if !ok {
+		return "", ErrPresignUnsupported
+	}
+	return presigner.PresignGet(ctx, bucket, key, expiry, opts)
+}
+
+// copyMethod 去重的文件只复制指针
+func (d *dedupBackend) copyMethod(size int64) string {
+	if size >= d.minSize {
+		return CopyServerSide
+	}
+	return copyMethod(d.backend, size)
+}
+
+// RemoveObjects 删除对象后释放被删除的指针持有的引用，删除失败的对象不释放
+func (d *dedupBackend) RemoveObjects(ctx context.Context, bucket string, keys []string) error {
+	hashes := make(map[string]string)
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		info, err := d.backend.StatObject(ctx, bucket, key)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if hash := BlobHash(info); hash != "" {
+			hashes[key] = hash
+		}
+	}
+
+	err := d.backend.RemoveObjects(ctx, bucket, keys)
+	removed := keys
+	if err != nil {
+		var failed *RemoveObjectsError
+		if !errors.As(err, &failed) {
+			return err
+		}
+		removed = removedKeys(keys, failed.Keys)
+	}
+	for _, key := range removed {
+		d.release(ctx, hashes[key])
+	}
+	return err
+}
+
+// pointerObject 从blob中读取的内容，Stat返回指针对象的信息
+type pointerObject struct {
+	Object
+	info minio.ObjectInfo
+}
+
+func (o *pointerObject) Stat() (minio.ObjectInfo, error) {
+	if _, err := o.Object.Stat(); err != nil {
+		return minio.ObjectInfo{}, fmt.Errorf("blob %s: %w", o.info.ETag, err)
+	}
+	return o.info, nil
+}
+
+// countingReader 统计读取的字节数，长度未知的上传据此得到内容大小
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// EnableDedup 启用按内容去重，需在处理请求之前调用。blob保存在storage.dedup.bucket中，未设置时
+// 每用户存储桶布局使用{prefix}dedup存储桶，共享存储桶布局使用共享存储桶中的dedup/前缀
+func (s *Service) EnableDedup(ctx context.Context, refs BlobRefs) error {
+	cfg := s.config.Storage.Dedup
+	blobs := blobStore{backend: s.raw, bucket: cfg.Bucket}
+	if blobs.bucket == "" {
+		if s.layout.Name == LayoutSharedBucket {
+			blobs.bucket, blobs.prefix = s.layout.SharedBucket, "dedup/"
+		} else {
+			blobs.bucket = s.layout.BucketPrefix + "dedup"
+		}
+	}
+	if err := blobs.backend.EnsureBucket(ctx, blobs.bucket); err != nil {
+		return fmt.Errorf("create dedup bucket: %w", err)
+	}
+
+	s.dedup = &dedupBackend{backend: s.backend, blobs: blobs, refs: refs, minSize: cfg.MinSize}
+	s.backend = s.dedup
+	return nil
+}
+
+// DedupObject 把去重启用前写入的普通对象转换为指针，文件ID、其他元数据和对外报告的ETag不变。
+// 返回指针引用的内容哈希。目录、已经去重的对象和小于storage.dedup.min_size的对象不转换，
+// 读取期间对象被修改时放弃，都返回空字符串
+func (s *Service) DedupObject(ctx context.Context, userID uuid.UUID, info minio.ObjectInfo) (string, error) {
+	d := s.dedup
+	if d == nil || strings.HasSuffix(info.Key, "/") || BlobHash(info) != "" || info.Size < d.minSize {
+		return "", nil
+	}
+	bucketName := s.getBucketName(userID)
+
+	obj, err := d.backend.GetObject(ctx, bucketName, info.Key, GetOptions{Start: -1, MatchETag: info.ETag})
+	if err != nil {
+		return "", err
+	}
+	hash, size, err := d.storeBlob(ctx, obj, info.Size)
+	obj.Close()
+	if err != nil {
+		if IsPreconditionFailed(err) || IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	metadata := make(map[string]string, len(info.UserMetadata)+1)
+	for key, value := range info.UserMetadata {
+		metadata[strings.TrimPrefix(key, "X-Amz-Meta-")] = value
+	}
+	metadata[MetaContentETag] = ContentETag(info)
+
+	// 写入指针前确认对象仍是读取的版本，不覆盖期间写入的新内容
+	current, err := d.backend.StatObject(ctx, bucketName, info.Key)
+	if err != nil || current.ETag != info.ETag {
+		d.release(ctx, hash)
+		if err != nil && !IsNotFound(err) {
+			return "", err
+		}
+		return "", nil
+	}
+	if err := d.putPointer(ctx, bucketName, info.Key, hash, size, PutOptions{ContentType: info.ContentType, UserMetadata: metadata}); err != nil {
+		d.release(ctx, hash)
+		return "", err
+	}
+	s.invalidateListing(ctx, userID, info.Key)
+	return hash, nil
+}
+
+// RemoveBlobs 删除引用计数已归零的blob
+func (s *Service) RemoveBlobs(ctx context.Context, hashes []string) error {
+	if s.dedup == nil || len(hashes) == 0 {
+		return nil
+	}
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = s.dedup.blobs.key(hash)
+	}
+	return s.dedup.blobs.backend.RemoveObjects(ctx, s.dedup.blobs.bucket, keys)
+}
+
+// RemoveStaleBlobUploads 删除before之前开始、因进程退出等原因没有清理的临时上传，返回删除的数量
+func (s *Service) RemoveStaleBlobUploads(ctx context.Context, before time.Time) (int, error) {
+	if s.dedup == nil {
+		return 0, nil
+	}
+	blobs := s.dedup.blobs
+	var stale []string
+	err := blobs.backend.ListObjects(ctx, blobs.bucket, blobs.prefix+blobUploadPrefix, true, func(object minio.ObjectInfo) error {
+		if !strings.HasSuffix(object.Key, "/") && object.LastModified.Before(before) {
+			stale = append(stale, object.Key)
+		}
+		return nil
+	})
+	if IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil || len(stale) == 0 {
+		return 0, err
+	}
+	for start := 0; start < len(stale); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(stale))
+		if err := blobs.backend.RemoveObjects(ctx, blobs.bucket, stale[start:end]); err != nil {
+			return start, err
+		}
+	}
+	return len(stale), nil
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// memoryRefs 内存中的引用计数
+type memoryRefs struct {
+	mu   sync.Mutex
+	refs map[string]int64
+}
+
+func (r *memoryRefs) Acquire(ctx context.Context, hash string, size int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs == nil {
+		r.refs = make(map[string]int64)
+	}
+	r.refs[hash]++
+	return nil
+}
+
+func (r *memoryRefs) Release(ctx context.Context, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs[hash] > 0 {
+		r.refs[hash]--
+	}
+	return nil
+}
+
+func (r *memoryRefs) count(hash string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refs[hash]
+}
+
+// newDedupService 创建启用去重的存储服务，minSize为去重的最小文件大小
+func newDedupService(t *testing.T, minSize int64) (*Service, *memoryRefs) {
+	t.Helper()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{Type: "local", Dedup: config.DedupConfig{Enabled: true, MinSize: minSize}}}
+	s, err := NewServiceWithBackend(cfg, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := &memoryRefs{}
+	if err := s.EnableDedup(context.Background(), refs); err != nil {
+		t.Fatal(err)
+	}
+	return s, refs
+}
+
+func TestDedupBackend(t *testing.T) {
+	s, _ := newDedupService(t, 0)
+	testStorageBackend(t, s.backend, uuid.New().String())
+}
+
+func readObject(t *testing.T, s *Service, userID uuid.UUID, objectPath string) string {
+	t.Helper()
+	obj, err := s.GetObject(context.Background(), userID, objectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatalf("read %s: %v", objectPath, err)
+	}
+	return string(data)
+}
+
+// blobCount 返回blob存储中除临时上传外的对象数
+func blobCount(t *testing.T, s *Service) int {
+	t.Helper()
+	blobs := s.dedup.blobs
+	count := 0
+	err := blobs.backend.ListObjects(context.Background(), blobs.bucket, blobs.prefix, true, func(object minio.ObjectInfo) error {
+		if !strings.HasSuffix(object.Key, "/") {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestDedupSharesContentAcrossUsers(t *testing.T) {
+	ctx := context.Background()
+	s, refs := newDedupService(t, 8)
+	alice, bob := uuid.New(), uuid.New()
+	for _, userID := range []uuid.UUID{alice, bob} {
+		if err := s.EnsureBucket(ctx, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content := "the same large file"
+	if err := s.PutObject(ctx, alice, "/video.mp4", strings.NewReader(content), int64(len(content)), "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, bob, "/copy.mp4", strings.NewReader(content), -1, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, bob, "/small.txt", strings.NewReader("tiny"), 4, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if n := blobCount(t, s); n != 1 {
+		t.Fatalf("blobs = %d, want the content stored once", n)
+	}
+
+	info, err := s.StatObject(ctx, alice, "/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := BlobHash(*info)
+	if hash == "" || info.Size != int64(len(content)) || info.ETag != hash || FileID(*info) == "" {
+		t.Fatalf("pointer info = size %d, etag %q, hash %q, FileID %q", info.Size, info.ETag, hash, FileID(*info))
+	}
+	if refs.count(hash) != 2 {
+		t.Fatalf("refs = %d, want 2", refs.count(hash))
+	}
+	if small, _ := s.StatObject(ctx, bob, "/small.txt"); BlobHash(*small) != "" {
+		t.Error("file below min_size was deduplicated")
+	}
+
+	if got := readObject(t, s, bob, "/copy.mp4"); got != content {
+		t.Errorf("read = %q, want %q", got, content)
+	}
+	obj, err := s.GetObjectRange(ctx, alice, "/video.mp4", 4, 7, info.ETag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(obj)
+	stat, _ := obj.Stat()
+	obj.Close()
+	if string(data) != "same" || stat.Size != int64(len(content)) {
+		t.Errorf("range read = %q (size %d), want same", data, stat.Size)
+	}
+
+	listed, err := s.ListObjects(ctx, bob, "/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range listed {
+		if object.Key == "copy.mp4" && (object.Size != int64(len(content)) || object.ETag != hash) {
+			t.Errorf("listed pointer = size %d, etag %q", object.Size, object.ETag)
+		}
+	}
+
+	// 复制只增加引用，覆盖和删除释放引用
+	if err := s.CopyObject(ctx, alice, "/video.mp4", "/backup.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if refs.count(hash) != 3 || readObject(t, s, alice, "/backup.mp4") != content {
+		t.Fatalf("after copy refs = %d", refs.count(hash))
+	}
+	if err := s.MoveObject(ctx, alice, "/backup.mp4", "/moved.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if refs.count(hash) != 3 {
+		t.Fatalf("after move refs = %d, want unchanged", refs.count(hash))
+	}
+	if err := s.PutObject(ctx, alice, "/moved.mp4", strings.NewReader("overwritten content"), 19, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteObject(ctx, bob, "/copy.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if refs.count(hash) != 1 {
+		t.Errorf("after overwrite and delete refs = %d, want 1", refs.count(hash))
+	}
+	if got := readObject(t, s, alice, "/video.mp4"); got != content {
+		t.Errorf("remaining reference reads %q", got)
+	}
+}
+
+func TestDedupObjectConvertsExistingFiles(t *testing.T) {
+	ctx := context.Background()
+	s, refs := newDedupService(t, 8)
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 去重启用前写入的文件直接写入按布局包装的后端
+	content := "written before dedup"
+	plain := s.dedup.backend
+	err := plain.PutObject(ctx, s.getBucketName(userID), "old.bin", strings.NewReader(content), int64(len(content)), PutOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: map[string]string{MetaFileID: "id-old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.StatObject(ctx, userID, "/old.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readObject(t, s, userID, "/old.bin") != content {
+		t.Fatal("plain object not readable through the dedup backend")
+	}
+
+	hash, err := s.DedupObject(ctx, userID, *before)
+	if err != nil || hash == "" {
+		t.Fatalf("DedupObject = %q, %v", hash, err)
+	}
+	after, err := s.StatObject(ctx, userID, "/old.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BlobHash(*after) != hash || FileID(*after) != "id-old" || ContentETag(*after) != ContentETag(*before) {
+		t.Errorf("converted = hash %q, FileID %q, content etag %q (was %q)", BlobHash(*after), FileID(*after), ContentETag(*after), ContentETag(*before))
+	}
+	if refs.count(hash) != 1 || readObject(t, s, userID, "/old.bin") != content {
+		t.Errorf("converted object refs = %d", refs.count(hash))
+	}
+
+	// 已转换的对象不再转换，过期的对象信息不覆盖新内容
+	if again, err := s.DedupObject(ctx, userID, *after); err != nil || again != "" {
+		t.Errorf("second DedupObject = %q, %v", again, err)
+	}
+	if stale, err := s.DedupObject(ctx, userID, *before); err != nil || stale != "" {
+		t.Errorf("DedupObject with stale info = %q, %v", stale, err)
+	}
+	if refs.count(hash) != 1 {
+		t.Errorf("refs = %d after skipped conversions, want 1", refs.count(hash))
+	}
+}
+
+// presignBackend 为本地后端补上预签名下载，URL直接由存储桶和键组成
+type presignBackend struct {
+	StorageBackend
+}
+
+func (b presignBackend) PresignGet(ctx context.Context, bucket, key string, expiry time.Duration, opts PresignGetOptions) (string, error) {
+	return "https://storage.example.com/" + bucket + "/" + key, nil
+}
+
+func TestDedupPresignGet(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{Type: "local", Dedup: config.DedupConfig{Enabled: true, MinSize: 10}}}
+	s, err := NewServiceWithBackend(cfg, presignBackend{local})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableDedup(ctx, &memoryRefs{}); err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, userID, "/small.txt", strings.NewReader("small"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, userID, "/large.txt", strings.NewReader("deduplicated content"), 20, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 普通对象照常签名，指针对象退回由网关转发
+	location, err := s.PresignGet(ctx, userID, "/small.txt", time.Minute, PresignGetOptions{})
+	if err != nil {
+		t.Fatalf("presign plain object: %v", err)
+	}
+	if !strings.HasSuffix(location, "/small.txt") {
+		t.Errorf("presigned URL %s does not point at the object", location)
+	}
+	if _, err := s.PresignGet(ctx, userID, "/large.txt", time.Minute, PresignGetOptions{}); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("presign pointer object: err = %v, want ErrPresignUnsupported", err)
+	}
+	if _, err := s.PresignGet(ctx, userID, "/missing.txt", time.Minute, PresignGetOptions{}); !IsNotFound(err) {
+		t.Errorf("presign missing object: err = %v, want not found", err)
+	}
+}
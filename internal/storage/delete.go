@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// deleteBatchSize DeleteFolder每批删除的对象数（S3批量删除上限）
+	deleteBatchSize = 1000
+	// defaultDeleteWorkers 未配置storage.delete_workers时并发的批量删除请求数
+	defaultDeleteWorkers = 4
+)
+
+// DeleteStats 递归删除实际删除的文件数和字节数，不含目录标记
+type DeleteStats struct {
+	Objects int64 `json:"objects"`
+	// Bytes 计入用量的字节数，exempt排除的对象不计入
+	Bytes int64 `json:"bytes"`
+}
+
+// deleteProgressKey 在请求上下文中传递删除进度回调
+type deleteProgressKey struct{}
+
+// WithDeleteProgress 返回带删除进度回调的上下文，DeleteFolder每删除一批对象调用一次fn（不会并发调用），
+// 后台任务借此报告经由WebDAV请求执行的大目录删除的进度
+func WithDeleteProgress(ctx context.Context, fn func(DeleteStats)) context.Context {
+	return context.WithValue(ctx, deleteProgressKey{}, fn)
+}
+
+// deleteBatch 一批待删除的对象及其大小
+type deleteBatch struct {
+	keys  []string
+	sizes map[string]int64
+}
+
+// DeleteFolder 删除目录及其下所有对象。列出的对象按deleteBatchSize分批，由storage.delete_workers个
+// 协程并发调用批量删除接口；目录标记在所有对象删除后按从深到浅的顺序删除，本地目录后端只能删除已经清空的目录。
+// 返回实际删除的文件数和字节数，出错时也返回已删除的部分，调用方据此调整用量。
+// exempt非nil时对其返回true的对象不计入Bytes（与用量计算规则一致）
+func (s *Service) DeleteFolder(ctx context.Context, userID uuid.UUID, folderPath string, exempt func(key string) bool) (DeleteStats, error) {
+	prefix := s.normalizePath(folderPath)
+
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return s.deletePrefix(ctx, userID, prefix, exempt)
+}
+
+// DeleteAll 删除用户存储空间中的全部对象，用于注销账户。DeleteFolder不会删除根目录，清空整个空间只能通过该方法
+func (s *Service) DeleteAll(ctx context.Context, userID uuid.UUID) (DeleteStats, error) {
+	return s.deletePrefix(ctx, userID, "", nil)
+}
+
+// deletePrefix 分批删除以prefix开头的所有对象，目录标记最后删除
+func (s *Service) deletePrefix(ctx context.Context, userID uuid.UUID, prefix string, exempt func(key string) bool) (DeleteStats, error) {
+	bucketName := s.getBucketName(userID)
+
+	defer func() {
+		// 子目录的列表也一并失效，即使只删除了部分对象
+		if s.listingCache != nil {
+			s.listingCache.invalidateAll(context.WithoutCancel(ctx), userID)
+		}
+	}()
+
+	workers := defaultDeleteWorkers
+	if s.config != nil && s.config.Storage.DeleteWorkers > 0 {
+		workers = s.config.Storage.DeleteWorkers
+	}
+	progress, _ := ctx.Value(deleteProgressKey{}).(func(DeleteStats))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		stats    DeleteStats
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	// fail 记录第一个错误并停止列出和删除其余对象
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	batches := make(chan deleteBatch, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				err := s.backend.RemoveObjects(ctx, bucketName, batch.keys)
+				deleted := batch.keys
+				if err != nil {
+					deleted = nil
+					var failed *RemoveObjectsError
+					if errors.As(err, &failed) {
+						deleted = removedKeys(batch.keys, failed.Keys)
+					}
+					fail(err)
+				}
+
+				s.unindexNames(ctx, userID, deleted...)
+				mu.Lock()
+				for _, key := range deleted {
+					stats.Objects++
+					if exempt == nil || !exempt(key) {
+						stats.Bytes += batch.sizes[key]
+					}
+				}
+				if progress != nil && len(deleted) > 0 {
+					progress(stats)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var markers []string
+	batch := deleteBatch{sizes: make(map[string]int64)}
+	listErr := s.backend.ListObjects(ctx, bucketName, prefix, true, func(object minio.ObjectInfo) error {
+		if strings.HasSuffix(object.Key, "/") {
+			markers = append(markers, object.Key)
+			return nil
+		}
+		batch.keys = append(batch.keys, object.Key)
+		batch.sizes[object.Key] = object.Size
+		if len(batch.keys) < deleteBatchSize {
+			return nil
+		}
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		batch = deleteBatch{sizes: make(map[string]int64)}
+		return nil
+	})
+	if listErr == nil && len(batch.keys) > 0 {
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			listErr = ctx.Err()
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	// 删除失败导致的取消以删除错误为准
+	if firstErr == nil && listErr != nil {
+		firstErr = listErr
+	}
+	if firstErr != nil {
+		return stats, fmt.Errorf("delete folder: %w", firstErr)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(markers)))
+	if err := s.backend.RemoveObjects(ctx, bucketName, markers); err != nil {
+		return stats, fmt.Errorf("delete folder: %w", err)
+	}
+	// 目录已清空，隐式目录没有标记对象，按前缀删除其名称
+	s.unindexPrefix(ctx, userID, prefix)
+
+	return stats, nil
+}
+
+// removedKeys 从一批对象键中去掉删除失败的键
+func removedKeys(keys, failed []string) []string {
+	skip := make(map[string]bool, len(failed))
+	for _, key := range failed {
+		skip[key] = true
+	}
+	removed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !skip[key] {
+			removed = append(removed, key)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestDeleteFolder(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{Type: "local", DeleteWorkers: 3}}
+	s, err := NewServiceWithBackend(cfg, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过一批的文件分布在几个子目录中，另有一个不计入用量的文件
+	const files = deleteBatchSize*2 + 500
+	for _, dir := range []string{"/big", "/big/a", "/big/b", "/keep"} {
+		if err := s.CreateFolder(ctx, userID, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < files; i++ {
+		p := fmt.Sprintf("/big/%s/%04d.txt", []string{"a", "b"}[i%2], i)
+		if err := s.PutObject(ctx, userID, p, strings.NewReader("xy"), 2, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PutObject(ctx, userID, "/big/._meta", strings.NewReader("hidden"), 6, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, userID, "/keep/c.txt", strings.NewReader("c"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []DeleteStats
+	ctx = WithDeleteProgress(ctx, func(stats DeleteStats) { reports = append(reports, stats) })
+	exempt := func(key string) bool { return strings.HasPrefix(path.Base(key), "._") }
+	stats, err := s.DeleteFolder(ctx, userID, "/big", exempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DeleteStats{Objects: files + 1, Bytes: files * 2}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if len(reports) < 3 || reports[len(reports)-1] != stats {
+		t.Errorf("progress reports = %v, want one per batch ending with %+v", reports, stats)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Objects <= reports[i-1].Objects {
+			t.Errorf("progress went backwards: %v", reports)
+		}
+	}
+
+	if _, err := s.StatResource(ctx, userID, "/big/"); err == nil {
+		t.Error("/big still exists after DeleteFolder")
+	}
+	if _, err := s.StatObject(ctx, userID, "/keep/c.txt"); err != nil {
+		t.Errorf("sibling folder was affected: %v", err)
+	}
+
+	// 清空整个空间
+	stats, err = s.DeleteAll(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DeleteStats{Objects: 1, Bytes: 1}); stats != want {
+		t.Errorf("DeleteAll stats = %+v, want %+v", stats, want)
+	}
+	if objects, err := s.ListObjects(ctx, userID, "", true); err != nil || len(objects) != 0 {
+		t.Errorf("objects left after DeleteAll: %v, %v", objects, err)
+	}
+}
+
+func TestRemovedKeys(t *testing.T) {
+	got := removedKeys([]string{"a", "b", "c"}, []string{"b"})
+	if strings.Join(got, ",") != "a,c" {
+		t.Errorf("removedKeys = %v, want [a c]", got)
+	}
+}
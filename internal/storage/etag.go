@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MetaContentETag 对象用户元数据中保存的内容ETag。后端为复制得到的对象生成的ETag可能与源对象不同
+// （分段上传的对象、Azure），复制时把源对象的内容ETag写入该键，同一内容的ETag在COPY、MOVE后保持不变
+const MetaContentETag = "Content-Etag"
+
+// ContentETag 返回对象内容的ETag（不带引号）：优先使用复制时记录的内容ETag，否则使用后端的ETag。
+// GET、HEAD、PROPFIND等所有对外报告ETag的地方都应使用它，按后端ETag做条件读写时仍使用info.ETag
+func ContentETag(info minio.ObjectInfo) string {
+	if etag := metadataValue(info, MetaContentETag); etag != "" {
+		return etag
+	}
+	return strings.Trim(info.ETag, `"`)
+}
+
+// metadataValue 按不区分大小写的名称读取用户元数据，兼容带x-amz-meta-前缀的键
+func metadataValue(info minio.ObjectInfo, name string) string {
+	name = strings.ToLower(name)
+	for key, value := range info.UserMetadata {
+		if strings.TrimPrefix(strings.ToLower(key), "x-amz-meta-") == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// copyOptions 复制对象src的选项。源对象尚未记录内容ETag或需要分配新文件ID（fileID非空）时，
+// 重新读取源对象的元数据并替换副本的元数据，写入源对象的内容ETag；否则原样复制元数据
+func (s *Service) copyOptions(ctx context.Context, bucketName string, src minio.ObjectInfo, fileID string) (CopyOptions, error) {
+	if fileID == "" && metadataValue(src, MetaContentETag) != "" {
+		return CopyOptions{MatchETag: src.ETag, SourceSize: src.Size}, nil
+	}
+
+	info, err := s.backend.StatObject(ctx, bucketName, src.Key)
+	if err != nil {
+		return CopyOptions{}, err
+	}
+	metadata := make(map[string]string, len(info.UserMetadata)+1)
+	if fileID != "" {
+		metadata[MetaFileID] = fileID
+	} else {
+		for key, value := range info.UserMetadata {
+			metadata[strings.TrimPrefix(key, "X-Amz-Meta-")] = value
+		}
+	}
+	metadata[MetaContentETag] = ContentETag(info)
+	return CopyOptions{
+		MatchETag:       info.ETag,
+		ReplaceMetadata: true,
+		ContentType:     info.ContentType,
+		UserMetadata:    metadata,
+		SourceSize:      info.Size,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestContentETag(t *testing.T) {
+	tests := []struct {
+		name string
+		info minio.ObjectInfo
+		want string
+	}{
+		{"backend etag", minio.ObjectInfo{ETag: `"abc"`}, "abc"},
+		{"recorded on copy", minio.ObjectInfo{ETag: "def", UserMetadata: minio.StringMap{MetaContentETag: "abc"}}, "abc"},
+		{"s3 metadata prefix", minio.ObjectInfo{ETag: "def", UserMetadata: minio.StringMap{"X-Amz-Meta-Content-Etag": "abc"}}, "abc"},
+	}
+	for _, tt := range tests {
+		if got := ContentETag(tt.info); got != tt.want {
+			t.Errorf("%s: ContentETag = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentETagSurvivesCopyAndMove(t *testing.T) {
+	root := t.TempDir()
+	backend, err := NewLocalBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutObject(ctx, userID, "/docs/a.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	etagOf := func(p string) string {
+		t.Helper()
+		info, err := s.StatObject(ctx, userID, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ContentETag(*info)
+	}
+	original := etagOf("/docs/a.txt")
+
+	if err := s.CopyObject(ctx, userID, "/docs/a.txt", "/docs/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MoveObject(ctx, userID, "/docs/a.txt", "/moved/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CopyTree(ctx, userID, "/moved", "/tree"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/docs/b.txt", "/moved/a.txt", "/tree/a.txt"} {
+		if got := etagOf(p); got != original {
+			t.Errorf("ETag of %s = %q, want %q", p, got, original)
+		}
+	}
+
+	// 在网关之外修改文件后，复制时记录的ETag不再适用
+	time.Sleep(10 * time.Millisecond)
+	file := filepath.Join(root, s.getBucketName(userID), "docs", "b.txt")
+	if err := os.WriteFile(file, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := etagOf("/docs/b.txt"); got == original {
+		t.Errorf("ETag of an externally modified file is still %q", got)
+	}
+}
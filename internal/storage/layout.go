@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// storage.layout的取值
+const (
+	// LayoutBucketPerUser 每个用户一个存储桶（默认）
+	LayoutBucketPerUser = "bucket_per_user"
+	// LayoutSharedBucket 所有用户共用一个存储桶，用户数据位于users/{userID}/前缀下，
+	// 避免AWS S3等服务的存储桶数量限制
+	LayoutSharedBucket = "shared_bucket"
+)
+
+// sharedUserPrefix 共享存储桶中用户数据的前缀
+const sharedUserPrefix = "users/"
+
+// sharedTenantPrefix 共享存储桶中租户数据的前缀，租户成员的数据位于tenants/{tenant}/users/{userID}/下
+const sharedTenantPrefix = "tenants/"
+
+// TenantResolver 返回用户所属租户的标识，不属于任何租户时返回空字符串。
+// 用户的租户决定其数据在后端中的位置，创建后不能改变
+type TenantResolver interface {
+	TenantOf(userID uuid.UUID) string
+}
+
+// Layout 用户存储空间在后端中的位置
+type Layout struct {
+	Name string
+	// BucketPrefix 每用户存储桶的名称前缀
+	BucketPrefix string
+	// SharedBucket 共享存储桶名称
+	SharedBucket string
+}
+
+// NewLayout 按名称创建布局，name为空时使用storage.layout
+func NewLayout(cfg config.StorageConfig, name string) (Layout, error) {
+	if name == "" {
+		name = cfg.Layout
+	}
+	switch name {
+	case "", LayoutBucketPerUser:
+		return Layout{Name: LayoutBucketPerUser, BucketPrefix: bucketPrefix(cfg)}, nil
+	case LayoutSharedBucket:
+		bucket := cfg.SharedBucket
+		if bucket == "" {
+			bucket = cfg.MinIO.BucketName
+		}
+		if bucket == "" {
+			return Layout{}, fmt.Errorf("storage.shared_bucket is required for the %s layout", LayoutSharedBucket)
+		}
+		return Layout{Name: LayoutSharedBucket, SharedBucket: bucket}, nil
+	default:
+		return Layout{}, fmt.Errorf("unknown storage layout %q", name)
+	}
+}
+
+// Bucket 用户在Backend返回的后端中的存储桶名称
+func (l Layout) Bucket(userID uuid.UUID) string {
+	if l.Name == LayoutSharedBucket {
+		return userID.String()
+	}
+	return l.BucketPrefix + userID.String()
+}
+
+// TenantBucket 租户成员在Backend返回的后端中的存储桶名称，tenant为空时与Bucket相同。
+// 每用户存储桶布局下为{prefix}{tenant}-{userID}，共享存储桶布局下映射为tenants/{tenant}/users/{userID}/前缀
+func (l Layout) TenantBucket(tenant string, userID uuid.UUID) string {
+	if tenant == "" {
+		return l.Bucket(userID)
+	}
+	if l.Name == LayoutSharedBucket {
+		return tenant + "/" + userID.String()
+	}
+	return l.BucketPrefix + tenant + "-" + userID.String()
+}
+
+// Backend 按布局包装后端，共享存储桶布局下每个用户的存储桶映射为共享存储桶中的前缀
+func (l Layout) Backend(backend StorageBackend) StorageBackend {
+	if l.Name == LayoutSharedBucket {
+		return &sharedBucketBackend{backend: backend, bucket: l.SharedBucket}
+	}
+	return backend
+}
+
+// sharedBucketBackend 将存储桶bucket中的键key映射为共享存储桶中的users/{bucket}/{key}，
+// 租户成员的存储桶（{tenant}/{userID}）映射为tenants/{tenant}/users/{userID}/{key}
+type sharedBucketBackend struct {
+	backend StorageBackend
+	bucket  string
+}
+
+func (b *sharedBucketBackend) key(bucket, key string) string {
+	if tenant, user, ok := strings.Cut(bucket, "/"); ok {
+		return sharedTenantPrefix + tenant + "/" + sharedUserPrefix + user + "/" + key
+	}
+	return sharedUserPrefix + bucket + "/" + key
+}
+
+func (b *sharedBucketBackend) EnsureBucket(ctx context.Context, bucket string) error {
+	return b.backend.EnsureBucket(ctx, b.bucket)
+}
+
+func (b *sharedBucketBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) error {
+	return b.backend.PutObject(ctx, b.bucket, b.key(bucket, key), reader, size, opts)
+}
+
+func (b *sharedBucketBackend) GetObject(ctx context.Context, bucket, key string, opts GetOptions) (Object, error) {
+	obj, err := b.backend.GetObject(ctx, b.bucket, b.key(bucket, key), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sharedBucketObject{Object: obj, key: key}, nil
+}
+
+func (b *sharedBucketBackend) StatObject(ctx context.Context, bucket, key string) (minio.ObjectInfo, error) {
+	info, err := b.backend.StatObject(ctx, b.bucket, b.key(bucket, key))
+	info.Key = key
+	return info, err
+}
+
+func (b *sharedBucketBackend) ListObjects(ctx context.Context, bucket, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	userPrefix := b.key(bucket, "")
+	return b.backend.ListObjects(ctx, b.bucket, userPrefix+prefix, recursive, func(object minio.ObjectInfo) error {
+		object.Key = strings.TrimPrefix(object.Key, userPrefix)
+		if object.Key == "" {
+			return nil // users/{userID}/本身不是用户可见的对象
+		}
+		return fn(object)
+	})
+}
+
+func (b *sharedBucketBackend) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, opts CopyOptions) error {
+	return b.backend.CopyObject(ctx, b.bucket, b.key(bucket, srcKey), b.key(bucket, dstKey), opts)
+}
+
+func (b *sharedBucketBackend) copyMethod(size int64) string {
+	return copyMethod(b.backend, size)
+}
+
+func (b *sharedBucketBackend) locate(bucket, key string) (StorageBackend, string, string) {
+	return b.backend, b.bucket, b.key(bucket, key)
+}
+
+func (b *sharedBucketBackend) RemoveObjects(ctx context.Context, bucket string, keys []string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = b.key(bucket, key)
+	}
+	err := b.backend.RemoveObjects(ctx, b.bucket, prefixed)
+	var failed *RemoveObjectsError
+	if errors.As(err, &failed) {
+		userPrefix := b.key(bucket, "")
+		keys := make([]string, len(failed.Keys))
+		for i, key := range failed.Keys {
+			keys[i] = strings.TrimPrefix(key, userPrefix)
+		}
+		return &RemoveObjectsError{Keys: keys, Err: failed.Err}
+	}
+	return err
+}
+
+// sharedBucketObject 返回不含用户前缀的对象键
+type sharedBucketObject struct {
+	Object
+	key string
+}
+
+func (o *sharedBucketObject) Stat() (minio.ObjectInfo, error) {
+	info, err := o.Object.Stat()
+	info.Key = o.key
+	return info, err
+}
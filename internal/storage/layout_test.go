@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestSharedBucketLayout(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := NewLayout(config.StorageConfig{Layout: LayoutSharedBucket, SharedBucket: "webdav-files"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageBackend(t, layout.Backend(backend), layout.Bucket(uuid.New()))
+}
+
+func TestMigrateUser(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.StorageConfig{Type: "local", SharedBucket: "webdav-files"}
+	perUser, _ := NewLayout(cfg, LayoutBucketPerUser)
+	shared, _ := NewLayout(cfg, LayoutSharedBucket)
+
+	userID := uuid.New()
+	src, srcBucket := perUser.Backend(backend), perUser.Bucket(userID)
+	if err := src.EnsureBucket(ctx, srcBucket); err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{"docs/": "", "docs/a.txt": "hello", "b.txt": "bye"} {
+		err := src.PutObject(ctx, srcBucket, key, strings.NewReader(content), int64(len(content)), PutOptions{
+			ContentType:  "text/plain",
+			UserMetadata: map[string]string{MetaFileID: "id-" + key},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := MigrateUser(ctx, backend, perUser, shared, userID, MigrateOptions{DryRun: true})
+	if err != nil || result.Copied != 3 || result.Bytes != 8 {
+		t.Fatalf("dry run = %+v, %v; want 3 objects, 8 bytes", result, err)
+	}
+	if _, err := backend.StatObject(ctx, "webdav-files", "users/"+userID.String()+"/b.txt"); !IsNotFound(err) {
+		t.Fatalf("dry run wrote objects: %v", err)
+	}
+
+	result, err = MigrateUser(ctx, backend, perUser, shared, userID, MigrateOptions{})
+	if err != nil || result.Copied != 3 || result.Streamed != 3 {
+		t.Fatalf("migrate = %+v, %v; want 3 objects streamed", result, err)
+	}
+
+	dst, dstBucket := shared.Backend(backend), shared.Bucket(userID)
+	obj, err := dst.GetObject(ctx, dstBucket, "docs/a.txt", GetOptions{Start: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(obj)
+	info, _ := obj.Stat()
+	obj.Close()
+	if string(data) != "hello" || FileID(info) != "id-docs/a.txt" || info.Key != "docs/a.txt" {
+		t.Errorf("migrated object = %q, FileID %q, key %q", data, FileID(info), info.Key)
+	}
+
+	result, err = MigrateUser(ctx, backend, perUser, shared, userID, MigrateOptions{DeleteSource: true})
+	if err != nil || result.Copied != 0 || result.Skipped != 3 || result.Deleted != 3 {
+		t.Fatalf("rerun = %+v, %v; want everything skipped and deleted", result, err)
+	}
+	if _, err := src.StatObject(ctx, srcBucket, "docs/a.txt"); !IsNotFound(err) {
+		t.Errorf("source object still present: %v", err)
+	}
+
+	// 从未创建过存储桶的用户没有需要迁移的数据
+	if result, err := MigrateUser(ctx, backend, perUser, shared, uuid.New(), MigrateOptions{}); err != nil || result.Copied != 0 {
+		t.Errorf("user without bucket = %+v, %v", result, err)
+	}
+}
+
+// bucketCopier 测试用的支持跨存储桶复制的后端
+type bucketCopier struct {
+	StorageBackend
+	copies int
+}
+
+func (b *bucketCopier) CopyBetween(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts CopyOptions) error {
+	b.copies++
+	obj, err := b.GetObject(ctx, srcBucket, srcKey, GetOptions{Start: -1})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	return b.PutObject(ctx, dstBucket, dstKey, obj, info.Size, PutOptions{ContentType: info.ContentType})
+}
+
+func TestMigrateUserServerSideCopy(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &bucketCopier{StorageBackend: local}
+	cfg := config.StorageConfig{Type: "local", SharedBucket: "webdav-files"}
+	perUser, _ := NewLayout(cfg, LayoutBucketPerUser)
+	shared, _ := NewLayout(cfg, LayoutSharedBucket)
+
+	userID := uuid.New()
+	src, srcBucket := perUser.Backend(backend), perUser.Bucket(userID)
+	if err := src.EnsureBucket(ctx, srcBucket); err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{"a.txt": "hello", "b.txt": "bye"} {
+		if err := src.PutObject(ctx, srcBucket, key, strings.NewReader(content), int64(len(content)), PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := MigrateUser(ctx, backend, perUser, shared, userID, MigrateOptions{})
+	if err != nil || result.Copied != 2 || result.Streamed != 0 || backend.copies != 2 {
+		t.Fatalf("migrate = %+v, %v, %d server-side copies; want 2 objects copied on the backend", result, err, backend.copies)
+	}
+	// 共享存储桶布局中的对象位于用户前缀下
+	if _, err := local.StatObject(ctx, "webdav-files", "users/"+userID.String()+"/a.txt"); err != nil {
+		t.Errorf("copied object missing: %v", err)
+	}
+}
+
+// tenantMap 测试用的租户解析
+type tenantMap map[uuid.UUID]string
+
+func (m tenantMap) TenantOf(userID uuid.UUID) string {
+	return m[userID]
+}
+
+func TestTenantLayout(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{Type: "local", Layout: LayoutSharedBucket, SharedBucket: "webdav-files"}}
+	s, err := NewServiceWithBackend(cfg, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, loner := uuid.New(), uuid.New()
+	s.SetTenantResolver(tenantMap{member: "acme"})
+
+	for _, userID := range []uuid.UUID{member, loner} {
+		if err := s.EnsureBucket(ctx, userID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.PutObject(ctx, userID, "/a.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, want := range map[string]bool{
+		"tenants/acme/users/" + member.String() + "/a.txt": true,
+		"users/" + loner.String() + "/a.txt":               true,
+		"users/" + member.String() + "/a.txt":              false,
+	} {
+		if _, err := backend.StatObject(ctx, "webdav-files", key); (err == nil) != want {
+			t.Errorf("object %s exists = %v, want %v", key, err == nil, want)
+		}
+	}
+
+	perUser, _ := NewLayout(config.StorageConfig{MinIO: config.MinIOConfig{BucketPrefix: "webdav-"}}, LayoutBucketPerUser)
+	if got, want := perUser.TenantBucket("acme", member), "webdav-acme-"+member.String(); got != want {
+		t.Errorf("TenantBucket = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// listingCacheKeyPrefix 每个用户的目录列表缓存保存在一个Hash中，字段为目录前缀
+	listingCacheKeyPrefix = "webdav:listing:"
+	// defaultListingCacheTTL 未配置TTL时的缓存时长
+	defaultListingCacheTTL = 5 * time.Minute
+)
+
+// cachedObject 缓存中保存的对象信息，只保留PROPFIND需要的字段
+type cachedObject struct {
+	Key          string    `json:"k"`
+	Size         int64     `json:"s,omitempty"`
+	LastModified time.Time `json:"m,omitempty"`
+	ContentType  string    `json:"t,omitempty"`
+	ETag         string    `json:"e,omitempty"`
+	FileID       string    `json:"id,omitempty"`
+	// ContentETag 复制时记录的内容ETag，见MetaContentETag
+	ContentETag string `json:"ce,omitempty"`
+}
+
+// cachedListing 单个目录的列表及缓存时间
+type cachedListing struct {
+	CachedAt time.Time      `json:"cached_at"`
+	Objects  []cachedObject `json:"objects"`
+}
+
+// ListingCache 基于Redis的非递归目录列表缓存，减少未变化目录的ListObjects请求。
+// 写操作经由Service时会失效受影响的目录；绕过网关直接修改存储桶的变更在TTL后可见
+type ListingCache struct {
+	client     *redis.Client
+	ttl        time.Duration
+	maxEntries int
+}
+
+// NewListingCache 创建目录列表缓存
+func NewListingCache(client *redis.Client, cfg config.ListingCacheConfig) *ListingCache {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultListingCacheTTL
+	}
+	return &ListingCache{
+		client:     client,
+		ttl:        ttl,
+		maxEntries: cfg.MaxEntries,
+	}
+}
+
+// SetListingCache 启用目录列表缓存，传入nil时关闭
+func (s *Service) SetListingCache(cache *ListingCache) {
+	s.listingCache = cache
+}
+
+func (c *ListingCache) userKey(userID uuid.UUID) string {
+	return listingCacheKeyPrefix + userID.String()
+}
+
+// get 读取目录列表，未命中、已过期或Redis不可用时返回false
+func (c *ListingCache) get(ctx context.Context, userID uuid.UUID, dirPrefix string) ([]minio.ObjectInfo, bool) {
+	data, err := c.client.HGet(ctx, c.userKey(userID), dirPrefix).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Warning: listing cache lookup failed: %v", err)
+		}
+		return nil, false
+	}
+
+	var listing cachedListing
+	if err := json.Unmarshal(data, &listing); err != nil || time.Since(listing.CachedAt) > c.ttl {
+		return nil, false
+	}
+
+	objects := make([]minio.ObjectInfo, 0, len(listing.Objects))
+	for _, obj := range listing.Objects {
+		info := minio.ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ContentType:  obj.ContentType,
+			ETag:         obj.ETag,
+		}
+		if obj.FileID != "" || obj.ContentETag != "" {
+			info.UserMetadata = minio.StringMap{}
+			if obj.FileID != "" {
+				info.UserMetadata[MetaFileID] = obj.FileID
+			}
+			if obj.ContentETag != "" {
+				info.UserMetadata[MetaContentETag] = obj.ContentETag
+			}
+		}
+		objects = append(objects, info)
+	}
+	return objects, true
+}
+
+// fits 判断n个条目的目录是否可以缓存，超过maxEntries的大目录不缓存
+func (c *ListingCache) fits(n int) bool {
+	return c.maxEntries <= 0 || n <= c.maxEntries
+}
+
+// put 保存完整的目录列表
+func (c *ListingCache) put(ctx context.Context, userID uuid.UUID, dirPrefix string, objects []minio.ObjectInfo) {
+	listing := cachedListing{CachedAt: time.Now(), Objects: make([]cachedObject, 0, len(objects))}
+	for _, obj := range objects {
+		listing.Objects = append(listing.Objects, cachedObject{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ContentType:  obj.ContentType,
+			ETag:         obj.ETag,
+			FileID:       FileID(obj),
+			ContentETag:  metadataValue(obj, MetaContentETag),
+		})
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		return
+	}
+
+	key := c.userKey(userID)
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, key, dirPrefix, data)
+	pipe.Expire(ctx, key, c.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Warning: listing cache store failed: %v", err)
+	}
+}
+
+// invalidate 失效对象所在目录及所有上级目录的列表（新建对象可能产生新的隐式子目录）。
+// 写操作已完成，即使客户端断开也必须失效，因此不继承请求的取消
+func (c *ListingCache) invalidate(ctx context.Context, userID uuid.UUID, objectKey string) {
+	ctx = context.WithoutCancel(ctx)
+	if err := c.client.HDel(ctx, c.userKey(userID), parentPrefixes(objectKey)...).Err(); err != nil {
+		log.Printf("Warning: listing cache invalidation for %s failed: %v", objectKey, err)
+	}
+}
+
+// invalidateAll 失效用户的全部目录列表，用于删除整个目录树
+func (c *ListingCache) invalidateAll(ctx context.Context, userID uuid.UUID) {
+	ctx = context.WithoutCancel(ctx)
+	if err := c.client.Del(ctx, c.userKey(userID)).Err(); err != nil {
+		log.Printf("Warning: listing cache invalidation failed: %v", err)
+	}
+}
+
+// invalidateListing 写操作后失效缓存（未启用缓存时不做任何事）
+func (s *Service) invalidateListing(ctx context.Context, userID uuid.UUID, objectKey string) {
+	if s.listingCache != nil {
+		s.listingCache.invalidate(ctx, userID, objectKey)
+	}
+}
+
+// parentPrefixes 返回对象所有上级目录的列表前缀（由近及远，根目录为空字符串）
+func parentPrefixes(objectKey string) []string {
+	var prefixes []string
+	for dir := path.Dir(objectKey); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		prefixes = append(prefixes, dir+"/")
+	}
+	return append(prefixes, "")
+}
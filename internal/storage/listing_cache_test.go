@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParentPrefixes(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected []string
+	}{
+		{key: "a.txt", expected: []string{""}},
+		{key: "docs/a.txt", expected: []string{"docs/", ""}},
+		{key: "docs/2024/q1/report.pdf", expected: []string{"docs/2024/q1/", "docs/2024/", "docs/", ""}},
+	}
+
+	for _, tt := range tests {
+		if got := parentPrefixes(tt.key); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parentPrefixes(%q) = %q, want %q", tt.key, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// MigrateOptions 布局迁移选项
+type MigrateOptions struct {
+	// DryRun 只统计需要复制的对象
+	DryRun bool
+	// DeleteSource 全部复制成功后删除源布局中的对象
+	DeleteSource bool
+	// Tenant 用户加入的租户，数据复制到目标布局中该租户的前缀下；为空时按不属于租户的用户处理
+	Tenant string
+}
+
+// MigrateResult 单个用户的迁移结果
+type MigrateResult struct {
+	Copied  int
+	Skipped int
+	Bytes   int64
+	Deleted int
+	// Streamed 经网关读取后重新写入的对象数，其余对象在存储服务端复制
+	Streamed int
+}
+
+// MigrateUser 将一个用户的全部对象从布局from复制到布局to（指定opts.Tenant时为该租户的前缀下），保留Content-Type和文件ID。
+// S3和Azure后端在服务端复制，不经过网关。目标中已存在且大小相同的对象会被跳过，中断后可以重复执行
+func MigrateUser(ctx context.Context, backend StorageBackend, from, to Layout, userID uuid.UUID, opts MigrateOptions) (MigrateResult, error) {
+	var result MigrateResult
+	src, srcBucket := from.Backend(backend), from.Bucket(userID)
+	dst, dstBucket := to.Backend(backend), to.TenantBucket(opts.Tenant, userID)
+
+	if !opts.DryRun {
+		if err := dst.EnsureBucket(ctx, dstBucket); err != nil {
+			return result, err
+		}
+	}
+
+	var keys []string
+	err := src.ListObjects(ctx, srcBucket, "", true, func(object minio.ObjectInfo) error {
+		keys = append(keys, object.Key)
+		if existing, err := dst.StatObject(ctx, dstBucket, object.Key); err == nil && existing.Size == object.Size {
+			result.Skipped++
+			return nil
+		} else if err != nil && !IsNotFound(err) {
+			return fmt.Errorf("stat %s: %w", object.Key, err)
+		}
+
+		result.Copied++
+		result.Bytes += object.Size
+		if opts.DryRun {
+			return nil
+		}
+		method, err := copyAcross(ctx, src, srcBucket, dst, dstBucket, object)
+		if method == CopyStreamed {
+			result.Streamed++
+		}
+		return err
+	})
+	if err != nil {
+		// 每用户存储桶尚不存在（用户从未登录）时没有数据需要迁移
+		if IsNotFound(err) && len(keys) == 0 {
+			return result, nil
+		}
+		return result, err
+	}
+
+	if opts.DeleteSource && !opts.DryRun && len(keys) > 0 {
+		// 目录标记最后按从深到浅的顺序删除
+		sort.SliceStable(keys, func(i, j int) bool {
+			iMarker, jMarker := strings.HasSuffix(keys[i], "/"), strings.HasSuffix(keys[j], "/")
+			if iMarker != jMarker {
+				return !iMarker
+			}
+			return iMarker && keys[i] > keys[j]
+		})
+		for start := 0; start < len(keys); start += deleteBatchSize {
+			end := min(start+deleteBatchSize, len(keys))
+			if err := src.RemoveObjects(ctx, srcBucket, keys[start:end]); err != nil {
+				return result, fmt.Errorf("delete source objects: %w", err)
+			}
+			result.Deleted += end - start
+		}
+	}
+	return result, nil
+}
+
+// copyAcross 在两个存储桶之间复制对象。两端位于同一个支持跨存储桶复制的后端时在服务端复制，
+// 否则读取后重新写入，返回实际使用的复制方式
+func copyAcross(ctx context.Context, src StorageBackend, srcBucket string, dst StorageBackend, dstBucket string, object minio.ObjectInfo) (string, error) {
+	key := object.Key
+	srcBackend, srcBucketName, srcKey := resolve(src, srcBucket, key)
+	dstBackend, dstBucketName, dstKey := resolve(dst, dstBucket, key)
+	if copier, ok := srcBackend.(BucketCopier); ok && srcBackend == dstBackend {
+		opts := CopyOptions{MatchETag: object.ETag, SourceSize: object.Size}
+		if err := copier.CopyBetween(ctx, srcBucketName, srcKey, dstBucketName, dstKey, opts); err != nil {
+			return "", fmt.Errorf("copy %s: %w", key, err)
+		}
+		return copyMethod(srcBackend, object.Size), nil
+	}
+
+	obj, err := src.GetObject(ctx, srcBucket, key, GetOptions{Start: -1})
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", key, err)
+	}
+	metadata := make(map[string]string, 1)
+	if id := FileID(info); id != "" {
+		metadata[MetaFileID] = id
+	}
+	if err := dst.PutObject(ctx, dstBucket, key, obj, info.Size, PutOptions{ContentType: info.ContentType, UserMetadata: metadata}); err != nil {
+		return "", fmt.Errorf("write %s: %w", key, err)
+	}
+	return CopyStreamed, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// failingReader 读出limit字节后返回err，模拟上传过程中被配额、解压限制或校验中止的请求体
+type failingReader struct {
+	read  int
+	limit int
+	err   error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read >= r.limit {
+		return 0, r.err
+	}
+	if len(p) > r.limit-r.read {
+		p = p[:r.limit-r.read]
+	}
+	for i := range p {
+		p[i] = 'x'
+	}
+	r.read += len(p)
+	return len(p), nil
+}
+
+// fakeS3 只实现PutObject和分片上传所需接口的S3服务，记录中止的分片上传数
+func fakeS3(t *testing.T) (*httptest.Server, *int32) {
+	var aborted int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>b</Bucket><Key>k</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodDelete && query.Has("uploadId"):
+			atomic.AddInt32(&aborted, 1)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &aborted
+}
+
+// TestMinIOBackendReaderErrors 请求体的读取错误经minio-go返回后仍能用errors.Is识别，
+// WebDAV层据此把配额、解压和校验错误映射为507、413、400
+func TestMinIOBackendReaderErrors(t *testing.T) {
+	server, aborted := fakeS3(t)
+	u, _ := url.Parse(server.URL)
+	backend, err := NewMinIOBackend(config.MinIOConfig{Endpoint: u.Host, Region: "us-east-1", PartSize: 5 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errLimit := errors.New("limit exceeded")
+
+	tests := []struct {
+		name    string
+		limit   int
+		size    int64
+		aborted int32 // 长度未知时以分片上传写入，失败后应中止上传
+	}{
+		{"known size", 1 << 10, 4 << 10, 0},
+		{"unknown size first part", 1 << 10, -1, 1},
+		{"unknown size later part", 6 << 20, -1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &failingReader{limit: tt.limit, err: fmt.Errorf("upload: %w", errLimit)}
+			err := backend.PutObject(context.Background(), "bucket", "key", reader, tt.size, PutOptions{})
+			if !errors.Is(err, errLimit) {
+				t.Fatalf("PutObject error = %v, want wrapping the reader error", err)
+			}
+			if n := atomic.SwapInt32(aborted, 0); n != tt.aborted {
+				t.Errorf("aborted uploads = %d, want %d", n, tt.aborted)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// NameIndex 不区分大小写模式下的名称索引（见casefold.Index）。写操作经由Service时同步登记或删除对象键，
+// 索引失败只记录日志，不影响写操作本身
+type NameIndex interface {
+	// Add 登记对象键及其上级目录
+	Add(ctx context.Context, userID uuid.UUID, keys []string) error
+	// Remove 删除对象键
+	Remove(ctx context.Context, userID uuid.UUID, keys []string) error
+	// RemovePrefix 删除目录及其下所有键，prefix为空时删除全部键
+	RemovePrefix(ctx context.Context, userID uuid.UUID, prefix string) error
+}
+
+// SetNameIndex 启用名称索引，传入nil时关闭
+func (s *Service) SetNameIndex(index NameIndex) {
+	s.nameIndex = index
+}
+
+// indexNames 写入对象后登记名称。写操作已完成，不继承请求的取消
+func (s *Service) indexNames(ctx context.Context, userID uuid.UUID, keys ...string) {
+	if s.nameIndex == nil || len(keys) == 0 {
+		return
+	}
+	if err := s.nameIndex.Add(context.WithoutCancel(ctx), userID, keys); err != nil {
+		log.Printf("Warning: name index update for %s failed: %v", keys[0], err)
+	}
+}
+
+// unindexNames 删除对象后从索引中删除名称
+func (s *Service) unindexNames(ctx context.Context, userID uuid.UUID, keys ...string) {
+	if s.nameIndex == nil || len(keys) == 0 {
+		return
+	}
+	if err := s.nameIndex.Remove(context.WithoutCancel(ctx), userID, keys); err != nil {
+		log.Printf("Warning: name index removal for %s failed: %v", keys[0], err)
+	}
+}
+
+// unindexPrefix 删除整个目录后从索引中删除目录及其下所有名称
+func (s *Service) unindexPrefix(ctx context.Context, userID uuid.UUID, prefix string) {
+	if s.nameIndex == nil {
+		return
+	}
+	if err := s.nameIndex.RemovePrefix(context.WithoutCancel(ctx), userID, strings.TrimSuffix(prefix, "/")); err != nil {
+		log.Printf("Warning: name index removal for %s failed: %v", prefix, err)
+	}
+}
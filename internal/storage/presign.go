@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrPresignUnsupported 存储后端不能生成预签名URL（本地目录、Azure），只能由网关转发数据
+var ErrPresignUnsupported = errors.New("storage backend does not support presigned urls")
+
+// PresignGetOptions 预签名下载URL的响应头覆盖，使存储直接返回与网关一致的Content-Type和Content-Disposition
+type PresignGetOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Presigner 能够生成预签名URL的后端，客户端凭URL在有效期内直接访问存储，数据不经过网关
+type Presigner interface {
+	PresignGet(ctx context.Context, bucket, key string, expiry time.Duration, opts PresignGetOptions) (string, error)
+}
+
+// PresignGet 生成对象的预签名下载URL，有效期为expiry。后端不支持时返回ErrPresignUnsupported
+func (s *Service) PresignGet(ctx context.Context, userID uuid.UUID, objectPath string, expiry time.Duration, opts PresignGetOptions) (string, error) {
+	backend, bucket, key := resolve(s.backend, s.getBucketName(userID), s.normalizePath(objectPath))
+	presigner, ok := backend.(Presigner)
+	if !ok {
+		return "", ErrPresignUnsupported
+	}
+	u, err := presigner.PresignGet(ctx, bucket, key, expiry, opts)
+	if err != nil {
+		return "", fmt.Errorf("presign get: %w", err)
+	}
+	return u, nil
+}
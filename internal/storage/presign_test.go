@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestPresignGetUsesPublicEndpoint(t *testing.T) {
+	cfg := config.MinIOConfig{
+		Endpoint:       "minio:9000",
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		Region:         "us-east-1",
+		PublicEndpoint: "https://files.example.com",
+	}
+	backend, err := NewMinIOBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{MinIO: cfg}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := s.PresignGet(context.Background(), uuid.New(), "/docs/big.iso", 5*time.Minute, PresignGetOptions{
+		ContentType: "application/x-iso9660-image",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || u.Host != "files.example.com" {
+		t.Errorf("presigned URL %s does not use the public endpoint", location)
+	}
+	query := u.Query()
+	if query.Get("X-Amz-Expires") != "300" || query.Get("response-content-type") != "application/x-iso9660-image" {
+		t.Errorf("presigned URL query = %v", query)
+	}
+}
+
+func TestPresignGetUnsupported(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PresignGet(context.Background(), uuid.New(), "/a.txt", time.Minute, PresignGetOptions{}); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("PresignGet on the local backend = %v, want ErrPresignUnsupported", err)
+	}
+}
+
+func TestPresignPutSignsHeaders(t *testing.T) {
+	backend, err := NewMinIOBackend(config.MinIOConfig{
+		Endpoint:       "minio:9000",
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		Region:         "us-east-1",
+		PublicEndpoint: "https://files.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	presigner, ok := backend.(UploadPresigner)
+	if !ok {
+		t.Fatal("minio backend does not implement UploadPresigner")
+	}
+
+	req, err := presigner.PresignPut(context.Background(), "bucket", "docs/a.txt", 1024, time.Hour, PutOptions{
+		ContentType:  "text/plain",
+		UserMetadata: map[string]string{MetaFileID: "file-id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "PUT" || u.Host != "files.example.com" {
+		t.Errorf("presigned request %s %s does not use the public endpoint", req.Method, req.URL)
+	}
+	if req.Header.Get("Content-Length") != "1024" || req.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("presigned headers = %v", req.Header)
+	}
+	signed := u.Query().Get("X-Amz-SignedHeaders")
+	for _, name := range []string{"content-length", "content-type", "x-amz-meta-" + strings.ToLower(MetaFileID)} {
+		if !strings.Contains(signed, name) {
+			t.Errorf("X-Amz-SignedHeaders %q does not include %s", signed, name)
+		}
+	}
+
+	part, err := presigner.PresignUploadPart(context.Background(), "bucket", "docs/a.txt", "upload-1", 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err = url.Parse(part.URL); err != nil {
+		t.Fatal(err)
+	}
+	if q := u.Query(); q.Get("partNumber") != "3" || q.Get("uploadId") != "upload-1" {
+		t.Errorf("presigned part URL query = %v", q)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUploadIncomplete 分段上传还有分段没有上传
+var ErrUploadIncomplete = errors.New("multipart upload is missing parts")
+
+// PresignedRequest 预签名的请求，客户端必须原样带上Header中的请求头，否则签名校验失败
+type PresignedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// UploadPresigner 能够生成预签名上传URL的后端，客户端直接把内容写入存储
+type UploadPresigner interface {
+	// PresignPut 预签名单次PUT，大小、类型和用户元数据作为签名的请求头，写入的内容必须正好size字节
+	PresignPut(ctx context.Context, bucket, key string, size int64, expiry time.Duration, opts PutOptions) (PresignedRequest, error)
+	// NewMultipartUpload 创建分段上传，返回uploadID
+	NewMultipartUpload(ctx context.Context, bucket, key string, opts PutOptions) (string, error)
+	// PresignUploadPart 预签名分段上传中的一个分段，partNumber从1开始
+	PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int, expiry time.Duration) (PresignedRequest, error)
+	// CompleteMultipartUpload 按已上传的分段合并对象，少于parts个分段时返回ErrUploadIncomplete
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts int) error
+	// AbortMultipartUpload 放弃分段上传并删除已上传的分段
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+}
+
+// uploadPresigner 返回对象所在的底层后端，不支持预签名上传时返回ErrPresignUnsupported
+func (s *Service) uploadPresigner(userID uuid.UUID, objectPath string) (UploadPresigner, string, string, error) {
+	backend, bucket, key := resolve(s.backend, s.getBucketName(userID), s.normalizePath(objectPath))
+	presigner, ok := backend.(UploadPresigner)
+	if !ok {
+		return nil, "", "", ErrPresignUnsupported
+	}
+	return presigner, bucket, key, nil
+}
+
+// uploadOptions 覆盖写入时沿用原有文件ID，新建时分配新ID，与PutObject一致
+func (s *Service) uploadOptions(ctx context.Context, userID uuid.UUID, objectPath, contentType string) PutOptions {
+	fileID := ""
+	if info, err := s.backend.StatObject(ctx, s.getBucketName(userID), s.normalizePath(objectPath)); err == nil {
+		fileID = FileID(info)
+	}
+	if fileID == "" {
+		fileID = uuid.New().String()
+	}
+	return PutOptions{ContentType: contentType, UserMetadata: map[string]string{MetaFileID: fileID}}
+}
+
+// PresignPut 生成直接写入存储的预签名PUT请求，内容必须正好size字节
+func (s *Service) PresignPut(ctx context.Context, userID uuid.UUID, objectPath, contentType string, size int64, expiry time.Duration) (PresignedRequest, error) {
+	presigner, bucket, key, err := s.uploadPresigner(userID, objectPath)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	req, err := presigner.PresignPut(ctx, bucket, key, size, expiry, s.uploadOptions(ctx, userID, objectPath, contentType))
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("presign put: %w", err)
+	}
+	return req, nil
+}
+
+// NewMultipartUpload 为直接上传创建分段上传
+func (s *Service) NewMultipartUpload(ctx context.Context, userID uuid.UUID, objectPath, contentType string) (string, error) {
+	presigner, bucket, key, err := s.uploadPresigner(userID, objectPath)
+	if err != nil {
+		return "", err
+	}
+	uploadID, err := presigner.NewMultipartUpload(ctx, bucket, key, s.uploadOptions(ctx, userID, objectPath, contentType))
+	if err != nil {
+		return "", fmt.Errorf("new multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+// PresignUploadPart 生成分段上传中一个分段的预签名PUT请求
+func (s *Service) PresignUploadPart(ctx context.Context, userID uuid.UUID, objectPath, uploadID string, partNumber int, expiry time.Duration) (PresignedRequest, error) {
+	presigner, bucket, key, err := s.uploadPresigner(userID, objectPath)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	req, err := presigner.PresignUploadPart(ctx, bucket, key, uploadID, partNumber, expiry)
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("presign upload part: %w", err)
+	}
+	return req, nil
+}
+
+// CompleteMultipartUpload 合并直接上传的分段，完成后失效目录列表缓存
+func (s *Service) CompleteMultipartUpload(ctx context.Context, userID uuid.UUID, objectPath, uploadID string, parts int) error {
+	presigner, bucket, key, err := s.uploadPresigner(userID, objectPath)
+	if err != nil {
+		return err
+	}
+	if err := presigner.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts); err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	s.invalidateListing(ctx, userID, s.normalizePath(objectPath))
+	s.indexNames(ctx, userID, s.normalizePath(objectPath))
+	return nil
+}
+
+// AbortMultipartUpload 放弃直接上传的分段上传
+func (s *Service) AbortMultipartUpload(ctx context.Context, userID uuid.UUID, objectPath, uploadID string) error {
+	presigner, bucket, key, err := s.uploadPresigner(userID, objectPath)
+	if err != nil {
+		return err
+	}
+	if err := presigner.AbortMultipartUpload(ctx, bucket, key, uploadID); err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// InvalidateListing 直接上传的单次PUT完成后失效目录列表缓存并登记名称，对象由客户端写入，网关无法在写入时处理
+func (s *Service) InvalidateListing(ctx context.Context, userID uuid.UUID, objectPath string) {
+	s.invalidateListing(ctx, userID, s.normalizePath(objectPath))
+	s.indexNames(ctx, userID, s.normalizePath(objectPath))
+}
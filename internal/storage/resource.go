@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// ResourceKind 资源类型：文件或集合（目录）
+type ResourceKind int
+
+const (
+	ResourceFile ResourceKind = iota + 1
+	ResourceCollection
+)
+
+// Resource 路径对应的WebDAV资源
+type Resource struct {
+	// Path 规范路径，以/开头；集合以/结尾，根目录为/
+	Path string
+	Kind ResourceKind
+	// Info 文件对象或目录标记的信息；根目录和没有目录标记的隐式目录为nil
+	Info *minio.ObjectInfo
+}
+
+// IsCollection 判断资源是否为集合
+func (r *Resource) IsCollection() bool {
+	return r.Kind == ResourceCollection
+}
+
+// StatResource 按固定顺序判定路径对应的资源，同一路径总是得到相同的结果：
+//  1. 根目录总是集合
+//  2. 路径不以/结尾时，同名的文件对象优先
+//  3. 有目录标记（key/）的集合
+//  4. 没有标记但其下至少有一个对象的隐式集合
+//
+// 以/结尾的路径只匹配集合，不会命中同名文件。都不满足时返回ErrNotFound
+func (s *Service) StatResource(ctx context.Context, userID uuid.UUID, resourcePath string) (*Resource, error) {
+	key := s.normalizePath(resourcePath)
+	if key == "" {
+		return &Resource{Path: "/", Kind: ResourceCollection}, nil
+	}
+	bucketName := s.getBucketName(userID)
+
+	if !strings.HasSuffix(resourcePath, "/") {
+		info, err := s.backend.StatObject(ctx, bucketName, key)
+		if err == nil {
+			return &Resource{Path: "/" + key, Kind: ResourceFile, Info: &info}, nil
+		}
+		if !IsNotFound(err) {
+			return nil, fmt.Errorf("stat resource: %w", err)
+		}
+	}
+
+	collection := &Resource{Path: "/" + key + "/", Kind: ResourceCollection}
+	info, err := s.backend.StatObject(ctx, bucketName, key+"/")
+	if err == nil {
+		collection.Info = &info
+		return collection, nil
+	}
+	if !IsNotFound(err) {
+		return nil, fmt.Errorf("stat resource: %w", err)
+	}
+
+	found := false
+	err = s.WalkObjects(ctx, userID, key, false, func(minio.ObjectInfo) error {
+		found = true
+		return ErrStopWalk
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stat resource: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("stat resource: %w", ErrNotFound)
+	}
+	return collection, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestStatResource(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateFolder(ctx, userID, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	// implicit/没有通过CreateFolder创建，只有其下的对象
+	for _, p := range []string{"/docs/a.txt", "/implicit/b.txt"} {
+		if err := s.PutObject(ctx, userID, p, strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		wantPath string
+		wantKind ResourceKind
+	}{
+		{"", "/", ResourceCollection},
+		{"/", "/", ResourceCollection},
+		{"/docs", "/docs/", ResourceCollection},
+		{"/docs/", "/docs/", ResourceCollection},
+		{"/implicit", "/implicit/", ResourceCollection},
+		{"/implicit/", "/implicit/", ResourceCollection},
+		{"/docs/a.txt", "/docs/a.txt", ResourceFile},
+	}
+	for _, tt := range tests {
+		r, err := s.StatResource(ctx, userID, tt.path)
+		if err != nil {
+			t.Errorf("StatResource(%q): %v", tt.path, err)
+			continue
+		}
+		if r.Path != tt.wantPath || r.Kind != tt.wantKind || (r.Kind == ResourceFile && r.Info == nil) {
+			t.Errorf("StatResource(%q) = %+v, want path %q kind %d", tt.path, r, tt.wantPath, tt.wantKind)
+		}
+	}
+
+	// 以/结尾的路径只匹配集合；不存在的路径和名称前缀相同的路径都返回ErrNotFound
+	for _, p := range []string{"/docs/a.txt/", "/missing", "/missing/", "/doc", "/docs/a"} {
+		if _, err := s.StatResource(ctx, userID, p); !IsNotFound(err) {
+			t.Errorf("StatResource(%q) error = %v, want not found", p, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "github.com/webdav-gateway/internal/models"
+
+// segmentAlignment 分段大小按1MiB对齐
+const segmentAlignment = 1 << 20
+
+// PlanSegments 为多连接下载规划分段：分段数不超过connections，
+// 每段不小于minSegment并按1MiB对齐，最后一段可能较小
+func PlanSegments(size, minSegment int64, connections int) (int64, []models.Segment) {
+	if size <= 0 {
+		return 0, nil
+	}
+	if connections < 1 {
+		connections = 1
+	}
+	if minSegment < segmentAlignment {
+		minSegment = segmentAlignment
+	}
+
+	segmentSize := (size + int64(connections) - 1) / int64(connections)
+	if segmentSize < minSegment {
+		segmentSize = minSegment
+	}
+	segmentSize = (segmentSize + segmentAlignment - 1) / segmentAlignment * segmentAlignment
+
+	var segments []models.Segment
+	for start := int64(0); start < size; start += segmentSize {
+		end := start + segmentSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		segments = append(segments, models.Segment{Index: len(segments), Start: start, End: end})
+	}
+	return segmentSize, segments
+}
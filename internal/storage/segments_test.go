@@ -0,0 +1,47 @@
+package storage
+
+import "testing"
+
+func TestPlanSegments(t *testing.T) {
+	const mib = int64(1 << 20)
+
+	tests := []struct {
+		name        string
+		size        int64
+		minSegment  int64
+		connections int
+		segmentSize int64
+		count       int
+	}{
+		{name: "空文件", size: 0, minSegment: 8 * mib, connections: 4, segmentSize: 0, count: 0},
+		{name: "小文件只有一段", size: 100, minSegment: 8 * mib, connections: 4, segmentSize: 8 * mib, count: 1},
+		{name: "按连接数均分", size: 64 * mib, minSegment: 8 * mib, connections: 4, segmentSize: 16 * mib, count: 4},
+		{name: "受最小分段限制", size: 20 * mib, minSegment: 8 * mib, connections: 16, segmentSize: 8 * mib, count: 3},
+		{name: "按1MiB对齐", size: 10*mib + 1, minSegment: mib, connections: 2, segmentSize: 6 * mib, count: 2},
+		{name: "连接数非法时视为1", size: 3 * mib, minSegment: mib, connections: 0, segmentSize: 3 * mib, count: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segmentSize, segments := PlanSegments(tt.size, tt.minSegment, tt.connections)
+			if segmentSize != tt.segmentSize {
+				t.Errorf("segment size = %d, want %d", segmentSize, tt.segmentSize)
+			}
+			if len(segments) != tt.count {
+				t.Fatalf("segments = %d, want %d", len(segments), tt.count)
+			}
+
+			// 分段必须连续覆盖整个文件
+			var next int64
+			for i, seg := range segments {
+				if seg.Index != i || seg.Start != next || seg.End < seg.Start {
+					t.Fatalf("segment %d invalid: %+v", i, seg)
+				}
+				next = seg.End + 1
+			}
+			if next != tt.size {
+				t.Errorf("segments cover %d bytes, want %d", next, tt.size)
+			}
+		})
+	}
+}
@@ -2,93 +2,140 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"path"
+	"net/http"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 
 	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/davpath"
 )
 
+// MetaFileID 对象用户元数据中保存稳定文件ID的键
+const MetaFileID = "File-Id"
+
+// ErrStopWalk 由WalkObjects回调返回，提前结束遍历（不视为错误）
+var ErrStopWalk = errors.New("stop walk")
+
 type Service struct {
-	client       *minio.Client
+	backend      StorageBackend
 	config       *config.Config
-	bucketPrefix string
+	layout       Layout
+	listingCache *ListingCache
+	nameIndex    NameIndex
+	tenants      TenantResolver
+	copies       copyCounters
+	// raw 未按布局包装的后端，保存去重的blob
+	raw   StorageBackend
+	dedup *dedupBackend
 }
 
+// NewService 按storage.type创建存储后端和存储服务
 func NewService(cfg *config.Config) (*Service, error) {
-	client, err := minio.New(cfg.MinIO.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.MinIO.AccessKey, cfg.MinIO.SecretKey, ""),
-		Secure: cfg.MinIO.UseSSL,
-	})
+	backend, err := NewBackend(cfg.Storage)
 	if err != nil {
-		return nil, fmt.Errorf("create minio client: %w", err)
+		return nil, err
 	}
+	return NewServiceWithBackend(cfg, backend)
+}
 
+// NewServiceWithBackend 使用指定的存储后端创建存储服务，按storage.layout组织用户数据
+func NewServiceWithBackend(cfg *config.Config, backend StorageBackend) (*Service, error) {
+	layout, err := NewLayout(cfg.Storage, "")
+	if err != nil {
+		return nil, err
+	}
 	return &Service{
-		client:       client,
-		config:       cfg,
-		bucketPrefix: cfg.MinIO.BucketPrefix,
+		backend: layout.Backend(backend),
+		raw:     backend,
+		config:  cfg,
+		layout:  layout,
 	}, nil
 }
 
+// SetTenantResolver 启用多租户布局，租户成员的数据位于租户前缀下；传入nil时关闭
+func (s *Service) SetTenantResolver(tenants TenantResolver) {
+	s.tenants = tenants
+}
+
 func (s *Service) getBucketName(userID uuid.UUID) string {
-	return fmt.Sprintf("%s%s", s.bucketPrefix, userID.String())
+	if s.tenants != nil {
+		return s.layout.TenantBucket(s.tenants.TenantOf(userID), userID)
+	}
+	return s.layout.Bucket(userID)
 }
 
 func (s *Service) EnsureBucket(ctx context.Context, userID uuid.UUID) error {
-	bucketName := s.getBucketName(userID)
+	return s.backend.EnsureBucket(ctx, s.getBucketName(userID))
+}
 
-	exists, err := s.client.BucketExists(ctx, bucketName)
+func (s *Service) PutObject(ctx context.Context, userID uuid.UUID, objectPath string, reader io.Reader, size int64, contentType string) error {
+	// 覆盖写入时沿用原有文件ID
+	previous, err := s.backend.StatObject(ctx, s.getBucketName(userID), s.normalizePath(objectPath))
 	if err != nil {
-		return fmt.Errorf("check bucket exists: %w", err)
+		return s.ReplaceObject(ctx, userID, objectPath, reader, size, contentType, nil)
 	}
-
-	if !exists {
-		err = s.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
-		if err != nil {
-			return fmt.Errorf("create bucket: %w", err)
-		}
-	}
-
-	return nil
+	return s.ReplaceObject(ctx, userID, objectPath, reader, size, contentType, &previous)
 }
 
-func (s *Service) PutObject(ctx context.Context, userID uuid.UUID, objectPath string, reader io.Reader, size int64, contentType string) error {
+// ReplaceObject 与PutObject相同，previous为调用方已经查询到的原对象（新建时为nil），
+// 覆盖写入时沿用其文件ID，省去一次StatObject
+func (s *Service) ReplaceObject(ctx context.Context, userID uuid.UUID, objectPath string, reader io.Reader, size int64, contentType string, previous *minio.ObjectInfo) error {
 	bucketName := s.getBucketName(userID)
 	objectKey := s.normalizePath(objectPath)
 
-	_, err := s.client.PutObject(ctx, bucketName, objectKey, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
+	// 新建或原对象没有文件ID时分配新ID
+	fileID := ""
+	if previous != nil {
+		fileID = FileID(*previous)
+	}
+	if fileID == "" {
+		fileID = uuid.New().String()
+	}
+
+	// 客户端断开后不再继续读取请求体，后端据此中止上传
+	err := s.backend.PutObject(ctx, bucketName, objectKey, withContext(ctx, reader), size, PutOptions{
+		ContentType:  contentType,
+		UserMetadata: map[string]string{MetaFileID: fileID},
 	})
 	if err != nil {
 		return fmt.Errorf("put object: %w", err)
 	}
+	s.invalidateListing(ctx, userID, objectKey)
+	s.indexNames(ctx, userID, objectKey)
 
 	return nil
 }
 
-func (s *Service) GetObject(ctx context.Context, userID uuid.UUID, objectPath string) (*minio.Object, error) {
+func (s *Service) GetObject(ctx context.Context, userID uuid.UUID, objectPath string) (Object, error) {
+	return s.GetObjectRange(ctx, userID, objectPath, -1, -1, "")
+}
+
+// GetObjectRange 读取对象的字节区间[start, end]（闭区间），start<0表示读取整个对象
+// etag非空时要求对象仍是该版本，分段下载期间文件被覆盖会得到IsPreconditionFailed错误
+func (s *Service) GetObjectRange(ctx context.Context, userID uuid.UUID, objectPath string, start, end int64, etag string) (Object, error) {
 	bucketName := s.getBucketName(userID)
 	objectKey := s.normalizePath(objectPath)
 
-	obj, err := s.client.GetObject(ctx, bucketName, objectKey, minio.GetObjectOptions{})
+	obj, err := s.backend.GetObject(ctx, bucketName, objectKey, GetOptions{Start: start, End: end, MatchETag: etag})
 	if err != nil {
 		return nil, fmt.Errorf("get object: %w", err)
 	}
-
-	return obj, nil
+	if ctx.Done() == nil {
+		return obj, nil
+	}
+	return &contextObject{Object: obj, ctx: ctx}, nil
 }
 
 func (s *Service) StatObject(ctx context.Context, userID uuid.UUID, objectPath string) (*minio.ObjectInfo, error) {
 	bucketName := s.getBucketName(userID)
 	objectKey := s.normalizePath(objectPath)
 
-	info, err := s.client.StatObject(ctx, bucketName, objectKey, minio.StatObjectOptions{})
+	info, err := s.backend.StatObject(ctx, bucketName, objectKey)
 	if err != nil {
 		return nil, fmt.Errorf("stat object: %w", err)
 	}
@@ -100,10 +147,12 @@ func (s *Service) DeleteObject(ctx context.Context, userID uuid.UUID, objectPath
 	bucketName := s.getBucketName(userID)
 	objectKey := s.normalizePath(objectPath)
 
-	err := s.client.RemoveObject(ctx, bucketName, objectKey, minio.RemoveObjectOptions{})
+	err := s.backend.RemoveObjects(ctx, bucketName, []string{objectKey})
 	if err != nil {
 		return fmt.Errorf("delete object: %w", err)
 	}
+	s.invalidateListing(ctx, userID, objectKey)
+	s.unindexNames(ctx, userID, objectKey)
 
 	return nil
 }
@@ -112,47 +161,102 @@ func (s *Service) ListObjects(ctx context.Context, userID uuid.UUID, prefix stri
 	bucketName := s.getBucketName(userID)
 	normalizedPrefix := s.normalizePath(prefix)
 
-	opts := minio.ListObjectsOptions{
-		Prefix:    normalizedPrefix,
-		Recursive: recursive,
-	}
-
 	var objects []minio.ObjectInfo
-	for object := range s.client.ListObjects(ctx, bucketName, opts) {
-		if object.Err != nil {
-			return nil, fmt.Errorf("list objects: %w", object.Err)
-		}
+	err := s.backend.ListObjects(ctx, bucketName, normalizedPrefix, recursive, func(object minio.ObjectInfo) error {
 		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return objects, nil
 }
 
+// WalkObjects 逐个遍历目录下的对象而不在内存中累积，适合超大目录
+// prefix按目录处理，不包含目录自身的标记对象；非递归时子目录以结尾为/的公共前缀返回
+// fn返回ErrStopWalk时停止遍历并返回nil，返回其他错误时停止遍历并返回该错误
+func (s *Service) WalkObjects(ctx context.Context, userID uuid.UUID, prefix string, recursive bool, fn func(minio.ObjectInfo) error) error {
+	dirPrefix := s.normalizePath(prefix)
+	if dirPrefix != "" {
+		dirPrefix += "/"
+	}
+
+	// 非递归列表可走缓存，只有完整遍历的结果才写回缓存
+	caching := s.listingCache != nil && !recursive
+	if caching {
+		if objects, ok := s.listingCache.get(ctx, userID, dirPrefix); ok {
+			for _, object := range objects {
+				if err := fn(object); err != nil {
+					if errors.Is(err, ErrStopWalk) {
+						return nil
+					}
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	var collected []minio.ObjectInfo
+	err := s.backend.ListObjects(ctx, s.getBucketName(userID), dirPrefix, recursive, func(object minio.ObjectInfo) error {
+		if object.Key == dirPrefix {
+			return nil
+		}
+		if caching {
+			collected = append(collected, object)
+			if !s.listingCache.fits(len(collected)) {
+				caching, collected = false, nil
+			}
+		}
+		return fn(object)
+	})
+	if err != nil {
+		if errors.Is(err, ErrStopWalk) {
+			return nil
+		}
+		return err
+	}
+
+	if caching {
+		s.listingCache.put(ctx, userID, dirPrefix, collected)
+	}
+	return nil
+}
+
+// CopyObject 复制对象，副本获得新的文件ID
 func (s *Service) CopyObject(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) error {
+	return s.copyObject(ctx, userID, srcPath, dstPath, false)
+}
+
+func (s *Service) copyObject(ctx context.Context, userID uuid.UUID, srcPath, dstPath string, preserveID bool) error {
 	bucketName := s.getBucketName(userID)
 	srcKey := s.normalizePath(srcPath)
 	dstKey := s.normalizePath(dstPath)
 
-	src := minio.CopySrcOptions{
-		Bucket: bucketName,
-		Object: srcKey,
+	fileID := ""
+	if !preserveID {
+		fileID = uuid.New().String()
 	}
-
-	dst := minio.CopyDestOptions{
-		Bucket: bucketName,
-		Object: dstKey,
+	opts, err := s.copyOptions(ctx, bucketName, minio.ObjectInfo{Key: srcKey}, fileID)
+	if err != nil {
+		return fmt.Errorf("copy object: %w", err)
 	}
 
-	_, err := s.client.CopyObject(ctx, dst, src)
+	err = s.backend.CopyObject(ctx, bucketName, srcKey, dstKey, opts)
 	if err != nil {
 		return fmt.Errorf("copy object: %w", err)
 	}
+	s.recordCopy(dstKey, opts.SourceSize)
+	s.invalidateListing(ctx, userID, dstKey)
+	s.indexNames(ctx, userID, dstKey)
 
 	return nil
 }
 
+// MoveObject 移动对象，文件ID随对象一起保留
 func (s *Service) MoveObject(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) error {
-	if err := s.CopyObject(ctx, userID, srcPath, dstPath); err != nil {
+	if err := s.copyObject(ctx, userID, srcPath, dstPath, true); err != nil {
 		return err
 	}
 
@@ -171,59 +275,101 @@ func (s *Service) CreateFolder(ctx context.Context, userID uuid.UUID, folderPath
 		folderKey += "/"
 	}
 
-	_, err := s.client.PutObject(ctx, bucketName, folderKey, strings.NewReader(""), 0, minio.PutObjectOptions{
-		ContentType: "application/x-directory",
+	err := s.backend.PutObject(ctx, bucketName, folderKey, strings.NewReader(""), 0, PutOptions{
+		ContentType:  "application/x-directory",
+		UserMetadata: map[string]string{MetaFileID: uuid.New().String()},
 	})
 	if err != nil {
 		return fmt.Errorf("create folder: %w", err)
 	}
+	s.invalidateListing(ctx, userID, strings.TrimSuffix(folderKey, "/"))
+	s.indexNames(ctx, userID, folderKey)
 
 	return nil
 }
 
-func (s *Service) DeleteFolder(ctx context.Context, userID uuid.UUID, folderPath string) error {
-	bucketName := s.getBucketName(userID)
-	prefix := s.normalizePath(folderPath)
-	
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
+// normalizePath 将用户路径转换为对象键：名称转换为NFC，..不会越出用户根目录，根目录为空字符串
+func (s *Service) normalizePath(p string) string {
+	return strings.TrimPrefix(davpath.Clean(p), "/")
+}
+
+func (s *Service) GetObjectSize(ctx context.Context, userID uuid.UUID, objectPath string) (int64, error) {
+	info, err := s.StatObject(ctx, userID, objectPath)
+	if err != nil {
+		return 0, err
 	}
+	return info.Size, nil
+}
 
-	objectsCh := make(chan minio.ObjectInfo)
+// FileID 从对象元数据中读取稳定文件ID，未分配时返回空字符串
+func FileID(info minio.ObjectInfo) string {
+	return metadataValue(info, MetaFileID)
+}
 
-	go func() {
-		defer close(objectsCh)
-		opts := minio.ListObjectsOptions{
-			Prefix:    prefix,
-			Recursive: true,
-		}
-		for object := range s.client.ListObjects(ctx, bucketName, opts) {
-			if object.Err == nil {
-				objectsCh <- object
-			}
-		}
-	}()
+// StatFolder 获取目录标记对象信息
+func (s *Service) StatFolder(ctx context.Context, userID uuid.UUID, folderPath string) (*minio.ObjectInfo, error) {
+	folderKey := s.normalizePath(folderPath)
+	if folderKey == "." || folderKey == "" {
+		return nil, fmt.Errorf("stat folder: root has no marker")
+	}
 
-	errCh := s.client.RemoveObjects(ctx, bucketName, objectsCh, minio.RemoveObjectsOptions{})
-	for err := range errCh {
-		if err.Err != nil {
-			return fmt.Errorf("delete folder: %w", err.Err)
-		}
+	info, err := s.backend.StatObject(ctx, s.getBucketName(userID), folderKey+"/")
+	if err != nil {
+		return nil, fmt.Errorf("stat folder: %w", err)
 	}
 
-	return nil
+	return &info, nil
 }
 
-func (s *Service) normalizePath(p string) string {
-	p = path.Clean(p)
-	p = strings.TrimPrefix(p, "/")
-	return p
+// FolderExists 判断目录是否存在：有目录标记或至少有一个子对象
+func (s *Service) FolderExists(ctx context.Context, userID uuid.UUID, folderPath string) (bool, error) {
+	if _, err := s.StatFolder(ctx, userID, folderPath); err == nil {
+		return true, nil
+	}
+	found := false
+	err := s.WalkObjects(ctx, userID, folderPath, false, func(minio.ObjectInfo) error {
+		found = true
+		return ErrStopWalk
+	})
+	if err != nil && !IsNotFound(err) {
+		return false, err
+	}
+	return found, nil
 }
 
-func (s *Service) GetObjectSize(ctx context.Context, userID uuid.UUID, objectPath string) (int64, error) {
-	info, err := s.StatObject(ctx, userID, objectPath)
-	if err != nil {
-		return 0, err
+// healthProbeKey 健康检查读取的对象键，不需要真实存在
+const healthProbeKey = ".health-probe"
+
+// HealthCheck 检查存储后端是否可访问：读取一个不存在的对象，返回"不存在"说明后端能正常应答，
+// 网络错误、认证失败等其他错误视为不可用
+func (s *Service) HealthCheck(ctx context.Context) error {
+	_, err := s.backend.StatObject(ctx, s.getBucketName(uuid.Nil), healthProbeKey)
+	if err == nil || IsNotFound(err) {
+		return nil
 	}
-	return info.Size, nil
-}
\ No newline at end of file
+	return err
+}
+
+// IsNotFound 判断错误是否表示对象不存在
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// IsPreconditionFailed 判断错误是否因对象ETag与预期不符（对象已被修改）
+func IsPreconditionFailed(err error) bool {
+	if errors.Is(err, ErrPreconditionFailed) {
+		return true
+	}
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.Code == "PreconditionFailed" || resp.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
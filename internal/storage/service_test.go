@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestServiceNormalizesKeys(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// macOS发送NFD，Windows发送NFC，两种写法指向同一个对象
+	nfd, nfc := "/docs/cafe\u0301.txt", "/docs/caf\u00e9.txt"
+	if err := s.PutObject(ctx, userID, nfd, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.StatObject(ctx, userID, nfc)
+	if err != nil {
+		t.Fatalf("stat NFC name after NFD upload: %v", err)
+	}
+	if info.Key != "docs/caf\u00e9.txt" {
+		t.Errorf("key = %q, want the NFC form", info.Key)
+	}
+
+	// ..不能越出用户根目录
+	if err := s.PutObject(ctx, userID, "../../escape.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StatObject(ctx, userID, "/escape.txt"); err != nil {
+		t.Errorf("traversal was not kept inside the user root: %v", err)
+	}
+
+	for p, want := range map[string]string{"": "", "/": "", "a/b/": "a/b", "/a/./b/../c": "a/c"} {
+		if got := s.normalizePath(p); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestServiceFileID(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	fileID := func(p string) string {
+		t.Helper()
+		info, err := s.StatObject(ctx, userID, p)
+		if err != nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		return FileID(*info)
+	}
+
+	if err := s.PutObject(ctx, userID, "/a.txt", strings.NewReader("one"), 3, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	id := fileID("/a.txt")
+	if id == "" {
+		t.Fatal("new object has no file id")
+	}
+
+	// 覆盖写入沿用原ID，无论是否由调用方传入原对象
+	if err := s.PutObject(ctx, userID, "/a.txt", strings.NewReader("two"), 3, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileID("/a.txt"); got != id {
+		t.Errorf("id after PutObject overwrite = %q, want %q", got, id)
+	}
+	previous, err := s.StatObject(ctx, userID, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReplaceObject(ctx, userID, "/a.txt", strings.NewReader("three"), 5, "text/plain", previous); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileID("/a.txt"); got != id {
+		t.Errorf("id after ReplaceObject overwrite = %q, want %q", got, id)
+	}
+
+	// 移动保留ID，复制得到新ID
+	if err := s.MoveObject(ctx, userID, "/a.txt", "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileID("/b.txt"); got != id {
+		t.Errorf("id after move = %q, want %q", got, id)
+	}
+	if err := s.CopyObject(ctx, userID, "/b.txt", "/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileID("/c.txt"); got == "" || got == id {
+		t.Errorf("id after copy = %q, want a new id", got)
+	}
+	if got := fileID("/b.txt"); got != id {
+		t.Errorf("copy source id = %q, want %q", got, id)
+	}
+
+	// 新建的对象得到各自不同的ID
+	if err := s.ReplaceObject(ctx, userID, "/d.txt", strings.NewReader("x"), 1, "text/plain", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileID("/d.txt"); got == "" || got == id {
+		t.Errorf("id of new object = %q, want a new id", got)
+	}
+}
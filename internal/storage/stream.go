@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// copyBufferSize CopyContext每次读写的字节数，两次读取之间检查一次取消
+const copyBufferSize = 32 << 10
+
+// CopyContext 与io.Copy相同，但每次读取前检查ctx，请求被取消（客户端断开）时立即停止并返回ctx.Err()，
+// 不再继续从存储后端读取剩余内容
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			w, werr := dst.Write(buf[:n])
+			written += int64(w)
+			if werr != nil {
+				return written, werr
+			}
+			if w != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			if err := ctx.Err(); err != nil {
+				// 取消导致的读取错误（连接被关闭等）统一报告为取消
+				return written, err
+			}
+			return written, rerr
+		}
+	}
+}
+
+// contextReader 每次读取前检查ctx，取消后返回ctx.Err()
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// withContext 包装reader，请求被取消后读取立即失败，写入方据此中止上传。
+// 不会被取消的上下文（如后台任务）和可重读的reader（内存数据、临时文件）不包装，
+// 后者保留minio-go按io.Seeker/io.ReaderAt重试和并行上传的能力
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	switch r.(type) {
+	case *contextReader, io.Seeker:
+		return r
+	}
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contextObject 读取前检查ctx的对象，调用方未使用CopyContext时同样在取消后停止读取
+type contextObject struct {
+	Object
+	ctx context.Context
+}
+
+func (o *contextObject) Read(p []byte) (int, error) {
+	if err := o.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return o.Object.Read(p)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// endlessReader 无限产生数据并记录读取次数，模拟存储后端上的大文件
+type endlessReader struct {
+	reads int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	r.reads++
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+// disconnectingWriter 写入limit字节后取消请求，模拟下载中途断开的客户端
+type disconnectingWriter struct {
+	written int
+	limit   int
+	cancel  context.CancelFunc
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	w.written += len(p)
+	if w.written >= w.limit {
+		w.cancel()
+	}
+	return len(p), nil
+}
+
+// disconnectingBody 读出limit字节后取消请求并继续返回数据，模拟上传中途断开的客户端
+type disconnectingBody struct {
+	read   int
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (b *disconnectingBody) Read(p []byte) (int, error) {
+	if b.read >= b.limit {
+		b.cancel()
+	}
+	for i := range p {
+		p[i] = 'x'
+	}
+	b.read += len(p)
+	return len(p), nil
+}
+
+func TestCopyContext(t *testing.T) {
+	var out strings.Builder
+	n, err := CopyContext(context.Background(), &out, strings.NewReader("hello"))
+	if err != nil || n != 5 || out.String() != "hello" {
+		t.Fatalf("CopyContext = %d, %v, %q", n, err, out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &endlessReader{}
+	dst := &disconnectingWriter{limit: 3 * copyBufferSize, cancel: cancel}
+	n, err = CopyContext(ctx, dst, src)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if src.reads != 3 || n != 3*copyBufferSize {
+		t.Errorf("read %d chunks (%d bytes) after the client disconnected, want to stop after 3", src.reads, n)
+	}
+}
+
+func TestServiceStopsOnCancel(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传中途断开：写入失败，不留下不完整的对象
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &disconnectingBody{limit: 1 << 20, cancel: cancel}
+	err = s.PutObject(ctx, userID, "/big.bin", body, -1, "application/octet-stream")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("PutObject err = %v, want context.Canceled", err)
+	}
+	if body.read > 2<<20 {
+		t.Errorf("read %d bytes after the client disconnected", body.read)
+	}
+	if _, err := s.StatObject(context.Background(), userID, "/big.bin"); !IsNotFound(err) {
+		t.Errorf("cancelled upload left an object behind: %v", err)
+	}
+
+	// 下载中途断开：对象的后续读取直接失败
+	if err := s.PutObject(context.Background(), userID, "/small.txt", strings.NewReader("hello world"), 11, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	obj, err := s.GetObject(ctx, userID, "/small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(obj, buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := obj.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read after cancel = %v, want context.Canceled", err)
+	}
+	if _, err := obj.Stat(); err != nil {
+		t.Errorf("Stat after cancel: %v", err)
+	}
+}
+
+// TestMinIOAbortsCancelledUpload 客户端断开的分片上传被中止，不留下未完成的分片
+func TestMinIOAbortsCancelledUpload(t *testing.T) {
+	endpoint := os.Getenv("WEBDAV_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("WEBDAV_TEST_S3_ENDPOINT not set")
+	}
+	cfg := config.MinIOConfig{
+		Endpoint:  endpoint,
+		AccessKey: os.Getenv("WEBDAV_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("WEBDAV_TEST_S3_SECRET_KEY"),
+		UseSSL:    os.Getenv("WEBDAV_TEST_S3_USE_SSL") == "true",
+		Region:    os.Getenv("WEBDAV_TEST_S3_REGION"),
+		PartSize:  5 << 20,
+	}
+	b, err := NewMinIOBackend(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := fmt.Sprintf("webdav-test-%d", time.Now().UnixNano())
+	ctx := context.Background()
+	if err := b.EnsureBucket(ctx, bucket); err != nil {
+		t.Fatal(err)
+	}
+	client := b.(*minioBackend).client
+	defer client.RemoveBucket(ctx, bucket)
+
+	// 第一个分片上传后断开
+	uploadCtx, cancel := context.WithCancel(ctx)
+	body := &disconnectingBody{limit: int(cfg.PartSize) + 1, cancel: cancel}
+	err = b.PutObject(uploadCtx, bucket, "big.bin", body, -1, PutOptions{ContentType: "application/octet-stream"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("PutObject err = %v, want context.Canceled", err)
+	}
+	if _, err := b.StatObject(ctx, bucket, "big.bin"); !IsNotFound(err) {
+		t.Errorf("cancelled upload left an object behind: %v", err)
+	}
+	var incomplete []minio.ObjectMultipartInfo
+	for upload := range client.ListIncompleteUploads(ctx, bucket, "big.bin", false) {
+		if upload.Err != nil {
+			t.Fatal(upload.Err)
+		}
+		incomplete = append(incomplete, upload)
+	}
+	if len(incomplete) != 0 {
+		t.Errorf("cancelled upload was not aborted: %d incomplete uploads", len(incomplete))
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// ErrRenameUnsupported 存储后端不能整体改名目录，调用方改为CopyTree后删除源目录
+var ErrRenameUnsupported = errors.New("storage backend cannot rename a prefix")
+
+// PrefixRenamer 可以整体改名目录的后端。本地目录后端直接改名文件系统目录；S3没有前缀改名操作
+type PrefixRenamer interface {
+	// RenamePrefix 把srcPrefix下的全部对象（含目录标记）移到dstPrefix下，两者均以/结尾，
+	// 对象的元数据随对象一起保留。dstPrefix已存在时返回错误
+	RenamePrefix(ctx context.Context, bucket, srcPrefix, dstPrefix string) error
+}
+
+// RenameTree 后端支持时整体改名目录，文件ID和元数据保持不变；不支持时返回ErrRenameUnsupported，
+// 存储中的对象不会有任何变化
+func (s *Service) RenameTree(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) error {
+	bucketName := s.getBucketName(userID)
+	srcPrefix := s.normalizePath(srcPath) + "/"
+	dstPrefix := s.normalizePath(dstPath) + "/"
+
+	backend, srcBucket, srcKey := resolve(s.backend, bucketName, srcPrefix)
+	renamer, ok := backend.(PrefixRenamer)
+	if !ok {
+		return ErrRenameUnsupported
+	}
+	_, dstBucket, dstKey := resolve(s.backend, bucketName, dstPrefix)
+	if dstBucket != srcBucket {
+		return ErrRenameUnsupported
+	}
+	if err := renamer.RenamePrefix(ctx, srcBucket, srcKey, dstKey); err != nil {
+		return fmt.Errorf("rename folder: %w", err)
+	}
+
+	if s.listingCache != nil {
+		s.listingCache.invalidateAll(context.WithoutCancel(ctx), userID)
+	}
+	if s.nameIndex != nil {
+		s.unindexPrefix(ctx, userID, srcPrefix)
+		keys := []string{dstPrefix}
+		err := s.backend.ListObjects(ctx, bucketName, dstPrefix, true, func(object minio.ObjectInfo) error {
+			keys = append(keys, object.Key)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: name index update for %s failed: %v", dstPrefix, err)
+		}
+		s.indexNames(ctx, userID, keys...)
+	}
+	return nil
+}
+
+// CopyTree 将目录（含目录标记）下的所有对象复制到新目录，保留文件ID和元数据。
+// S3没有前缀改名操作，目录改名只能逐个复制后再删除源目录。
+// 返回已写入的目标键；出错时同样返回已写入的键，供调用方回滚
+func (s *Service) CopyTree(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) ([]string, error) {
+	bucketName := s.getBucketName(userID)
+	srcPrefix := s.normalizePath(srcPath) + "/"
+	dstPrefix := s.normalizePath(dstPath) + "/"
+
+	var copied []string
+	defer func() {
+		if len(copied) > 0 && s.listingCache != nil {
+			s.listingCache.invalidateAll(ctx, userID)
+		}
+		s.indexNames(ctx, userID, copied...)
+	}()
+
+	err := s.backend.ListObjects(ctx, bucketName, srcPrefix, true, func(object minio.ObjectInfo) error {
+		dstKey := dstPrefix + strings.TrimPrefix(object.Key, srcPrefix)
+		opts := CopyOptions{MatchETag: object.ETag}
+		if !strings.HasSuffix(object.Key, "/") {
+			// 文件的内容ETag随对象一起保留，目录标记没有对外报告的ETag
+			var err error
+			if opts, err = s.copyOptions(ctx, bucketName, object, ""); err != nil {
+				return fmt.Errorf("copy %s: %w", object.Key, err)
+			}
+		}
+		err := s.backend.CopyObject(ctx, bucketName, object.Key, dstKey, opts)
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", object.Key, err)
+		}
+		if !strings.HasSuffix(object.Key, "/") {
+			s.recordCopy(dstKey, opts.SourceSize)
+		}
+		copied = append(copied, dstKey)
+		return nil
+	})
+	if err != nil {
+		return copied, err
+	}
+
+	// 没有目录标记的隐式目录复制后补一个标记，保证目标目录在源目录删除后仍然存在
+	if len(copied) == 0 || copied[0] != dstPrefix {
+		if err := s.CreateFolder(ctx, userID, dstPath); err != nil {
+			return copied, err
+		}
+		copied = append(copied, dstPrefix)
+	}
+	return copied, nil
+}
+
+// DeleteKeys 删除指定的对象键，用于回滚未完成的CopyTree
+func (s *Service) DeleteKeys(ctx context.Context, userID uuid.UUID, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	defer func() {
+		if s.listingCache != nil {
+			s.listingCache.invalidateAll(ctx, userID)
+		}
+	}()
+	if err := s.backend.RemoveObjects(ctx, s.getBucketName(userID), keys); err != nil {
+		return fmt.Errorf("delete objects: %w", err)
+	}
+	s.unindexNames(ctx, userID, keys...)
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// plainBackend 隐藏后端的可选接口，模拟不支持目录改名的S3后端
+type plainBackend struct {
+	StorageBackend
+}
+
+func newTreeTestService(t *testing.T, wrap bool) (*Service, uuid.UUID) {
+	t.Helper()
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap {
+		backend = plainBackend{backend}
+	}
+	s, err := NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	return s, userID
+}
+
+func TestRenameTree(t *testing.T) {
+	s, userID := newTreeTestService(t, false)
+	ctx := context.Background()
+	if err := s.CreateFolder(ctx, userID, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{}
+	for _, p := range []string{"/docs/a.txt", "/docs/sub/b.txt"} {
+		if err := s.PutObject(ctx, userID, p, strings.NewReader("hello"), 5, "text/markdown"); err != nil {
+			t.Fatal(err)
+		}
+		info, err := s.StatObject(ctx, userID, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[strings.TrimPrefix(p, "/docs")] = FileID(*info)
+	}
+	folder, err := s.StatFolder(ctx, userID, "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RenameTree(ctx, userID, "/docs", "/archive/2024"); err != nil {
+		t.Fatal(err)
+	}
+
+	for rel, id := range ids {
+		info, err := s.StatObject(ctx, userID, "/archive/2024"+rel)
+		if err != nil {
+			t.Fatalf("renamed %s: %v", rel, err)
+		}
+		if FileID(*info) != id || info.ContentType != "text/markdown" {
+			t.Errorf("%s: file ID %q, content type %q; want %q, text/markdown", rel, FileID(*info), info.ContentType, id)
+		}
+		if _, err := s.StatObject(ctx, userID, "/docs"+rel); !IsNotFound(err) {
+			t.Errorf("source %s still exists: %v", rel, err)
+		}
+	}
+	if renamed, err := s.StatFolder(ctx, userID, "/archive/2024"); err != nil || FileID(*renamed) != FileID(*folder) {
+		t.Errorf("folder marker not renamed with its file ID: %v", err)
+	}
+
+	// 目标已存在时不改名
+	if err := s.CreateFolder(ctx, userID, "/other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenameTree(ctx, userID, "/other", "/archive"); err == nil || errors.Is(err, ErrRenameUnsupported) {
+		t.Errorf("rename onto an existing folder = %v, want an error", err)
+	}
+	if err := s.RenameTree(ctx, userID, "/missing", "/elsewhere"); !IsNotFound(err) {
+		t.Errorf("rename of a missing folder = %v, want not found", err)
+	}
+}
+
+func TestRenameTreeUnsupported(t *testing.T) {
+	s, userID := newTreeTestService(t, true)
+	ctx := context.Background()
+	if err := s.PutObject(ctx, userID, "/docs/a.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenameTree(ctx, userID, "/docs", "/archive"); !errors.Is(err, ErrRenameUnsupported) {
+		t.Fatalf("RenameTree = %v, want ErrRenameUnsupported", err)
+	}
+	if _, err := s.StatObject(ctx, userID, "/docs/a.txt"); err != nil {
+		t.Errorf("source changed by an unsupported rename: %v", err)
+	}
+}
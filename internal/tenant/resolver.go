@@ -0,0 +1,113 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// tenancy.resolution的取值
+const (
+	// ResolutionSubdomain 按Host头中的子域名（{slug}.base_domain）识别租户
+	ResolutionSubdomain = "subdomain"
+	// ResolutionPath 按路径前缀（path_prefix/{slug}/...）识别租户
+	ResolutionPath = "path"
+)
+
+// slugPattern 租户标识：小写字母、数字和连字符，1到16个字符，不以连字符开头或结尾。
+// 标识会成为存储桶名称和DNS标签的一部分，长度与存储桶名称的63字节上限匹配
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,14}[a-z0-9])?$`)
+
+// ValidSlug 判断租户标识是否合法
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+type contextKey int
+
+const (
+	slugKey contextKey = iota
+	mountKey
+)
+
+// Resolver 从请求中识别租户标识
+type Resolver struct {
+	mode       string
+	baseDomain string
+	pathPrefix string
+}
+
+// NewResolver 按tenancy配置创建租户识别
+func NewResolver(cfg config.TenancyConfig) Resolver {
+	return Resolver{
+		mode:       cfg.Resolution,
+		baseDomain: strings.ToLower(strings.Trim(cfg.BaseDomain, ".")),
+		pathPrefix: strings.TrimSuffix(cfg.PathPrefix, "/"),
+	}
+}
+
+// Slug 返回请求所属的租户标识，请求不属于任何租户（如直接访问基础域名）时返回空字符串。
+// context中已有租户标识（路径模式或WithSlug）时优先使用
+func (r Resolver) Slug(req *http.Request) string {
+	if slug, ok := req.Context().Value(slugKey).(string); ok || r.mode == ResolutionPath {
+		return slug
+	}
+	return r.fromHost(req.Host)
+}
+
+// WithSlug 为网关内部发起的请求（批量操作、后台任务）指定租户标识，这些请求没有客户端的Host头和路径前缀
+func WithSlug(ctx context.Context, slug string) context.Context {
+	return context.WithValue(ctx, slugKey, slug)
+}
+
+// fromHost 取出{slug}.base_domain中的slug，只接受一级子域名
+func (r Resolver) fromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	slug, ok := strings.CutSuffix(host, "."+r.baseDomain)
+	if !ok || !ValidSlug(slug) {
+		return ""
+	}
+	return slug
+}
+
+// Handler 路径模式下在路由之前去掉path_prefix/{slug}，之后的路由和处理函数看到的路径与单租户部署相同。
+// 租户标识和去掉的前缀保存在请求的context中，分别由Slug和MountPrefix读取。子域名模式下直接调用next
+func (r Resolver) Handler(next http.Handler) http.Handler {
+	if r.mode != ResolutionPath {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rest, ok := strings.CutPrefix(req.URL.Path, r.pathPrefix+"/")
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+		slug, tail, _ := strings.Cut(rest, "/")
+		if !ValidSlug(slug) {
+			http.NotFound(w, req)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), slugKey, slug)
+		ctx = context.WithValue(ctx, mountKey, r.pathPrefix+"/"+slug)
+		req = req.WithContext(ctx)
+		u := *req.URL
+		u.Path = "/" + tail
+		u.RawPath = ""
+		req.URL = &u
+		next.ServeHTTP(w, req)
+	})
+}
+
+// MountPrefix 路径模式下被Handler去掉的前缀（如/t/acme），用于生成客户端可见的URL和解析Destination等请求头
+func MountPrefix(ctx context.Context) string {
+	prefix, _ := ctx.Value(mountKey).(string)
+	return prefix
+}
@@ -0,0 +1,79 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestValidSlug(t *testing.T) {
+	for slug, want := range map[string]bool{
+		"acme":              true,
+		"a":                 true,
+		"acme-corp":         true,
+		"0123456789abcdef":  true,
+		"0123456789abcdefg": false,
+		"":                  false,
+		"-acme":             false,
+		"acme-":             false,
+		"Acme":              false,
+		"acme.corp":         false,
+		"acme/corp":         false,
+	} {
+		if got := ValidSlug(slug); got != want {
+			t.Errorf("ValidSlug(%q) = %v, want %v", slug, got, want)
+		}
+	}
+}
+
+func TestResolverSubdomain(t *testing.T) {
+	r := NewResolver(config.TenancyConfig{Resolution: ResolutionSubdomain, BaseDomain: "files.example.com"})
+	for host, want := range map[string]string{
+		"acme.files.example.com":      "acme",
+		"ACME.files.example.com:8443": "acme",
+		"acme.files.example.com.":     "acme",
+		"files.example.com":           "",
+		"a.b.files.example.com":       "",
+		"acme.example.com":            "",
+		"evilfiles.example.com":       "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/webdav/", nil)
+		req.Host = host
+		if got := r.Slug(req); got != want {
+			t.Errorf("Slug(host %q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestResolverPath(t *testing.T) {
+	r := NewResolver(config.TenancyConfig{Resolution: ResolutionPath, PathPrefix: "/t"})
+
+	var gotPath, gotSlug, gotMount string
+	handler := r.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath, gotSlug, gotMount = req.URL.Path, r.Slug(req), MountPrefix(req.Context())
+	}))
+
+	tests := []struct {
+		path, wantPath, wantSlug, wantMount string
+	}{
+		{"/t/acme/webdav/docs/a.txt", "/webdav/docs/a.txt", "acme", "/t/acme"},
+		{"/t/acme", "/", "acme", "/t/acme"},
+		{"/webdav/docs", "/webdav/docs", "", ""},
+		{"/tx/acme/webdav", "/tx/acme/webdav", "", ""},
+	}
+	for _, tt := range tests {
+		gotPath, gotSlug, gotMount = "", "", ""
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if gotPath != tt.wantPath || gotSlug != tt.wantSlug || gotMount != tt.wantMount {
+			t.Errorf("%s: path %q slug %q mount %q, want %q %q %q", tt.path, gotPath, gotSlug, gotMount, tt.wantPath, tt.wantSlug, tt.wantMount)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/Not_Valid/webdav", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("invalid slug: status %d, want 404", w.Code)
+	}
+}
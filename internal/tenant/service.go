@@ -0,0 +1,407 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 租户成员的角色
+const (
+	RoleMember = "member"
+	// RoleAdmin 租户管理员，可以查看租户用量和成员并调整成员角色
+	RoleAdmin = "admin"
+)
+
+// 租户状态
+const (
+	StatusActive = "active"
+	// StatusSuspended 暂停的租户，成员的请求一律返回403
+	StatusSuspended = "suspended"
+)
+
+// lookupTimeout 存储调用中查询用户所属租户的超时
+const lookupTimeout = 5 * time.Second
+
+var (
+	// ErrNotFound 租户不存在
+	ErrNotFound = errors.New("tenant not found")
+	// ErrInvalidSlug 租户标识不合法
+	ErrInvalidSlug = errors.New("tenant slug must be 1-16 lowercase letters, digits or hyphens")
+	// ErrSlugTaken 租户标识已被使用
+	ErrSlugTaken = errors.New("tenant slug is already taken")
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+	// ErrAlreadyAssigned 用户已属于其他租户；用户的数据位于租户前缀下，不能直接转到其他租户
+	ErrAlreadyAssigned = errors.New("user already belongs to another tenant")
+	// ErrNotMember 用户不是该租户的成员
+	ErrNotMember = errors.New("user is not a member of this tenant")
+	// ErrInvalidRole 未知的成员角色
+	ErrInvalidRole = errors.New("role must be member or admin")
+	// ErrInvalidStatus 未知的租户状态
+	ErrInvalidStatus = errors.New("status must be active or suspended")
+	// ErrInvalidQuota 配额池为负数
+	ErrInvalidQuota = errors.New("quota must not be negative")
+)
+
+// Tenant 租户
+type Tenant struct {
+	ID   uuid.UUID `json:"id"`
+	Slug string    `json:"slug"`
+	Name string    `json:"name"`
+	// Quota 租户配额池（字节），所有成员的用量之和不能超过该值，0表示不限制
+	Quota int64 `json:"quota"`
+	// Used 所有成员的用量之和
+	Used      int64     `json:"used"`
+	Members   int       `json:"members"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Member 租户成员
+type Member struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	StorageUsed int64     `json:"storage_used"`
+}
+
+// Membership 用户所属的租户
+type Membership struct {
+	TenantID uuid.UUID
+	Slug     string
+	Role     string
+	Status   string
+}
+
+// UpdateRequest 修改租户，为nil的字段保持不变
+type UpdateRequest struct {
+	Name   *string `json:"name"`
+	Quota  *int64  `json:"quota"`
+	Status *string `json:"status"`
+}
+
+// Service 租户、成员关系和租户配额池，数据保存在主数据库（PostgreSQL）的tenants表和users表中
+type Service struct {
+	db        *sql.DB
+	cfg       config.TenancyConfig
+	resolver  Resolver
+	initOnce  sync.Once
+	initError error
+
+	// slugs 用户ID到租户标识的缓存，用户加入租户后不会再改变
+	mu    sync.RWMutex
+	slugs map[uuid.UUID]string
+}
+
+// NewService 创建租户服务
+func NewService(db *sql.DB, cfg config.TenancyConfig) *Service {
+	return &Service{
+		db:       db,
+		cfg:      cfg,
+		resolver: NewResolver(cfg),
+		slugs:    make(map[uuid.UUID]string),
+	}
+}
+
+// Initialize 创建租户表，并为用户表增加租户和角色列
+func (s *Service) Initialize(ctx context.Context) error {
+	s.initOnce.Do(func() {
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS tenants (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				slug VARCHAR(16) UNIQUE NOT NULL,
+				name VARCHAR(100) NOT NULL,
+				quota_bytes BIGINT NOT NULL DEFAULT 0,
+				status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended')),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id) ON DELETE RESTRICT`,
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_role VARCHAR(20) NOT NULL DEFAULT 'member'`,
+			`CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id)`,
+		}
+		for _, query := range queries {
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				s.initError = fmt.Errorf("初始化租户表失败: %v", err)
+				return
+			}
+		}
+	})
+	return s.initError
+}
+
+// Resolver 返回请求的租户识别
+func (s *Service) Resolver() Resolver {
+	return s.resolver
+}
+
+// tenantColumns 租户列及用量、成员数的聚合
+const tenantColumns = `t.id, t.slug, t.name, t.quota_bytes, t.status, t.created_at,
+	COALESCE((SELECT SUM(u.storage_used) FROM users u WHERE u.tenant_id = t.id), 0),
+	(SELECT COUNT(*) FROM users u WHERE u.tenant_id = t.id)`
+
+func scanTenant(row interface{ Scan(...interface{}) error }) (*Tenant, error) {
+	var t Tenant
+	if err := row.Scan(&t.ID, &t.Slug, &t.Name, &t.Quota, &t.Status, &t.CreatedAt, &t.Used, &t.Members); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Create 创建租户，quota小于0时使用tenancy.default_quota
+func (s *Service) Create(ctx context.Context, slug, name string, quota int64) (*Tenant, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !ValidSlug(slug) {
+		return nil, ErrInvalidSlug
+	}
+	if name == "" {
+		name = slug
+	}
+	if quota < 0 {
+		quota = s.cfg.DefaultQuota
+	}
+
+	var id uuid.UUID
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO tenants (slug, name, quota_bytes) VALUES ($1, $2, $3)
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING id`, slug, name, quota).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create tenant: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// Get 按ID返回租户
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Tenant, error) {
+	t, err := scanTenant(s.db.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants t WHERE t.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// GetBySlug 按标识返回租户
+func (s *Service) GetBySlug(ctx context.Context, slug string) (*Tenant, error) {
+	t, err := scanTenant(s.db.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants t WHERE t.slug = $1`, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// List 返回所有租户，按标识排序
+func (s *Service) List(ctx context.Context) ([]Tenant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants t ORDER BY t.slug`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []Tenant{}
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, *t)
+	}
+	return tenants, rows.Err()
+}
+
+// Update 修改租户的名称、配额池或状态
+func (s *Service) Update(ctx context.Context, id uuid.UUID, req UpdateRequest) (*Tenant, error) {
+	if req.Quota != nil && *req.Quota < 0 {
+		return nil, ErrInvalidQuota
+	}
+	if req.Status != nil && *req.Status != StatusActive && *req.Status != StatusSuspended {
+		return nil, ErrInvalidStatus
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE tenants SET
+			name = COALESCE($2, name),
+			quota_bytes = COALESCE($3, quota_bytes),
+			status = COALESCE($4, status)
+		WHERE id = $1`, id, req.Name, req.Quota, req.Status)
+	if err != nil {
+		return nil, fmt.Errorf("update tenant: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// AddMember 将用户加入租户。已属于同一租户时只修改角色；已属于其他租户时返回ErrAlreadyAssigned。
+// 用户加入前写入的数据不会自动移动，需要先用migrate-storage -tenant迁移
+func (s *Service) AddMember(ctx context.Context, tenantID, userID uuid.UUID, role string) error {
+	if role != RoleMember && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	if _, err := s.Get(ctx, tenantID); err != nil {
+		return err
+	}
+
+	var current uuid.NullUUID
+	err := s.db.QueryRowContext(ctx, `SELECT tenant_id FROM users WHERE id = $1`, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current.Valid && current.UUID != tenantID {
+		return ErrAlreadyAssigned
+	}
+
+	// 条件更新避免并发请求把同一用户加入两个租户
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE users SET tenant_id = $2, tenant_role = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (tenant_id IS NULL OR tenant_id = $2)`, userID, tenantID, role)
+	if err != nil {
+		return fmt.Errorf("add tenant member: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAlreadyAssigned
+	}
+	s.forget(userID)
+	return nil
+}
+
+// SetRole 修改租户成员的角色
+func (s *Service) SetRole(ctx context.Context, tenantID, userID uuid.UUID, role string) error {
+	if role != RoleMember && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE users SET tenant_role = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND tenant_id = $2`, userID, tenantID, role)
+	if err != nil {
+		return fmt.Errorf("set tenant role: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// Members 返回租户的成员，按用户名排序
+func (s *Service) Members(ctx context.Context, tenantID uuid.UUID) ([]Member, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, tenant_role, COALESCE(storage_used, 0)
+		FROM users WHERE tenant_id = $1 ORDER BY username`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role, &m.StorageUsed); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// Membership 返回用户所属的租户，不属于任何租户时返回nil
+func (s *Service) Membership(ctx context.Context, userID uuid.UUID) (*Membership, error) {
+	var m Membership
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.slug, u.tenant_role, t.status
+		FROM users u JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.id = $1`, userID).Scan(&m.TenantID, &m.Slug, &m.Role, &m.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// TenantOf 实现storage.TenantResolver，返回用户所属租户的标识。
+// 查询失败时不缓存并返回空字符串，请求落在用户自己的非租户存储空间中，不会访问其他用户的数据
+func (s *Service) TenantOf(userID uuid.UUID) string {
+	s.mu.RLock()
+	slug, ok := s.slugs[userID]
+	s.mu.RUnlock()
+	if ok {
+		return slug
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(t.slug, '')
+		FROM users u LEFT JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.id = $1`, userID).Scan(&slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ""
+	}
+	if err != nil {
+		log.Printf("Warning: failed to look up tenant of user %s: %v", userID, err)
+		return ""
+	}
+
+	s.mu.Lock()
+	s.slugs[userID] = slug
+	s.mu.Unlock()
+	return slug
+}
+
+// forget 用户加入租户后清除缓存的租户标识
+func (s *Service) forget(userID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.slugs, userID)
+	s.mu.Unlock()
+}
+
+// RemainingForUser 返回用户所属租户配额池的剩余字节数；用户不属于租户、租户不限制配额或查询失败时返回-1
+func (s *Service) RemainingForUser(ctx context.Context, userID uuid.UUID) int64 {
+	var quota, used int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.quota_bytes, COALESCE((SELECT SUM(m.storage_used) FROM users m WHERE m.tenant_id = t.id), 0)
+		FROM users u JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.id = $1`, userID).Scan(&quota, &used)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Warning: failed to read tenant quota of user %s: %v", userID, err)
+		}
+		return -1
+	}
+	if quota <= 0 {
+		return -1
+	}
+	return max(quota-used, 0)
+}
+
+// ShareTenant 返回分享链接所有者所属租户的标识，所有者不属于租户时返回空字符串
+func (s *Service) ShareTenant(ctx context.Context, token string) (string, error) {
+	var slug string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(t.slug, '')
+		FROM file_shares fs
+		JOIN users u ON u.id = fs.user_id
+		LEFT JOIN tenants t ON t.id = u.tenant_id
+		WHERE fs.share_token = $1`, token).Scan(&slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return slug, err
+}
@@ -0,0 +1,616 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// 强制启用范围
+const (
+	EnforceOff    = "off"
+	EnforceAdmins = "admins"
+	EnforceAll    = "all"
+)
+
+// recoveryCodeSize 恢复码的随机字节数，编码为10位Base32（50位熵）
+const recoveryCodeSize = 7
+
+var (
+	// ErrInvalidCode 验证码或恢复码错误
+	ErrInvalidCode = errors.New("invalid two-factor code")
+	// ErrChallengeInvalid 登录挑战不存在、已过期或错误次数过多
+	ErrChallengeInvalid = errors.New("invalid or expired two-factor challenge")
+	// ErrNotEnabled 用户尚未启用两步验证
+	ErrNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrAlreadyEnabled 用户已启用两步验证
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrNoPendingSetup 确认前没有调用Setup
+	ErrNoPendingSetup = errors.New("no pending two-factor setup")
+	// ErrRequired 策略要求该用户启用两步验证，不能关闭
+	ErrRequired = errors.New("two-factor authentication is required for this account")
+)
+
+// Requirement 密码验证通过后登录还需要的步骤
+type Requirement int
+
+const (
+	// RequirementNone 直接签发令牌
+	RequirementNone Requirement = iota
+	// RequirementVerify 需要输入验证码或恢复码
+	RequirementVerify
+	// RequirementEnroll 策略要求启用但用户尚未绑定，需先完成绑定
+	RequirementEnroll
+)
+
+// Status 用户的两步验证状态
+type Status struct {
+	Enabled bool `json:"enabled"`
+	// Required 策略或管理员要求启用
+	Required               bool       `json:"required"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// Enrollment 待确认的绑定信息
+type Enrollment struct {
+	Secret string `json:"secret"`
+	// URI otpauth://地址，由客户端编码为二维码
+	URI string `json:"uri"`
+}
+
+// Challenge 密码验证通过后签发的待验证登录
+type Challenge struct {
+	Token     string    `json:"mfa_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Enroll 需要先绑定验证器
+	Enroll bool `json:"enrollment_required"`
+}
+
+// VerifyResult 完成挑战的结果
+type VerifyResult struct {
+	UserID uuid.UUID
+	// RecoveryCodes 本次登录同时完成绑定时生成的恢复码
+	RecoveryCodes []string
+	// UsedRecoveryCode 使用恢复码而不是验证码登录
+	UsedRecoveryCode bool
+}
+
+// Service TOTP绑定、登录挑战和恢复码
+type Service struct {
+	db        *sql.DB
+	cfg       config.TwoFactorConfig
+	admins    map[string]bool
+	now       func() time.Time
+	initOnce  sync.Once
+	initError error
+}
+
+// NewService 创建两步验证服务，db为主数据库（PostgreSQL），admins为auth.admins
+func NewService(db *sql.DB, cfg config.TwoFactorConfig, admins []string) *Service {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "WebDAV Gateway"
+	}
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RecoveryCodes <= 0 {
+		cfg.RecoveryCodes = 10
+	}
+
+	allowed := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		allowed[name] = true
+	}
+	return &Service{db: db, cfg: cfg, admins: allowed, now: time.Now}
+}
+
+// Initialize 创建所需的表，多次调用只执行一次
+func (s *Service) Initialize(ctx context.Context) error {
+	s.initOnce.Do(func() {
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				secret VARCHAR(64),
+				pending_secret VARCHAR(64),
+				enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				required BOOLEAN NOT NULL DEFAULT FALSE,
+				last_step BIGINT NOT NULL DEFAULT 0,
+				enabled_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				code_hash VARCHAR(64) NOT NULL,
+				used_at TIMESTAMP,
+				PRIMARY KEY (user_id, code_hash)
+			)`,
+			`CREATE TABLE IF NOT EXISTS two_factor_challenges (
+				token_hash VARCHAR(64) PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				attempts INT NOT NULL DEFAULT 0,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_expires_at ON two_factor_challenges(expires_at)`,
+		}
+		for _, query := range queries {
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				s.initError = fmt.Errorf("初始化两步验证表失败: %v", err)
+				return
+			}
+		}
+	})
+	return s.initError
+}
+
+// requiredByPolicy 按auth.two_factor.enforce判断是否强制
+func (s *Service) requiredByPolicy(username string) bool {
+	switch s.cfg.Enforce {
+	case EnforceAll:
+		return true
+	case EnforceAdmins:
+		return s.admins[username]
+	}
+	return false
+}
+
+// GetStatus 返回用户的两步验证状态
+func (s *Service) GetStatus(ctx context.Context, userID uuid.UUID, username string) (*Status, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	status := &Status{Required: s.requiredByPolicy(username)}
+	var required bool
+	var enabledAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT enabled, required, enabled_at FROM user_two_factor WHERE user_id = $1`,
+		userID).Scan(&status.Enabled, &required, &enabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("查询两步验证状态失败: %v", err)
+	}
+	status.Required = status.Required || required
+	if enabledAt.Valid {
+		status.EnabledAt = &enabledAt.Time
+	}
+
+	if status.Enabled {
+		err = s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+			userID).Scan(&status.RecoveryCodesRemaining)
+		if err != nil {
+			return nil, fmt.Errorf("查询恢复码失败: %v", err)
+		}
+	}
+	return status, nil
+}
+
+// LoginRequirement 密码验证通过后判断是否需要两步验证
+func (s *Service) LoginRequirement(ctx context.Context, userID uuid.UUID, username string) (Requirement, error) {
+	status, err := s.GetStatus(ctx, userID, username)
+	if err != nil {
+		return RequirementNone, err
+	}
+	switch {
+	case status.Enabled:
+		return RequirementVerify, nil
+	case status.Required:
+		return RequirementEnroll, nil
+	}
+	return RequirementNone, nil
+}
+
+// BeginChallenge 为通过密码验证的用户创建登录挑战
+func (s *Service) BeginChallenge(ctx context.Context, userID uuid.UUID, requirement Requirement) (*Challenge, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	challenge := &Challenge{
+		Token:     token,
+		ExpiresAt: now.Add(s.cfg.ChallengeTTL),
+		Enroll:    requirement == RequirementEnroll,
+	}
+
+	// 顺带清理过期的挑战
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM two_factor_challenges WHERE expires_at < $1`, now); err != nil {
+		return nil, fmt.Errorf("清理登录挑战失败: %v", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO two_factor_challenges (token_hash, user_id, attempts, created_at, expires_at)
+		VALUES ($1, $2, 0, $3, $4)`,
+		hashToken(token), userID, now, challenge.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("创建登录挑战失败: %v", err)
+	}
+	return challenge, nil
+}
+
+// challengeUser 返回挑战对应的用户，挑战无效时返回ErrChallengeInvalid
+func (s *Service) challengeUser(ctx context.Context, token string) (uuid.UUID, string, error) {
+	var userID uuid.UUID
+	var username string
+	var attempts int
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		SELECT c.user_id, u.username, c.attempts, c.expires_at
+		FROM two_factor_challenges c JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1`,
+		hashToken(token)).Scan(&userID, &username, &attempts, &expiresAt)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, "", ErrChallengeInvalid
+	}
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("查询登录挑战失败: %v", err)
+	}
+	if attempts >= s.cfg.MaxAttempts || s.now().After(expiresAt) {
+		return uuid.Nil, "", ErrChallengeInvalid
+	}
+	return userID, username, nil
+}
+
+// SetupForChallenge 策略强制绑定时，凭登录挑战生成密钥（用户此时还没有令牌）
+func (s *Service) SetupForChallenge(ctx context.Context, token string) (*Enrollment, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	userID, username, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.Setup(ctx, userID, username)
+}
+
+// VerifyChallenge 校验登录挑战的验证码或恢复码。挑战处于绑定阶段时，验证码同时用于确认绑定。
+// 成功后挑战作废；输错达到max_attempts次后挑战也作废，需重新输入密码
+func (s *Service) VerifyChallenge(ctx context.Context, token, code string) (*VerifyResult, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	userID, _, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{UserID: userID}
+	var enabled bool
+	err = s.db.QueryRowContext(ctx, `SELECT enabled FROM user_two_factor WHERE user_id = $1`, userID).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("查询两步验证状态失败: %v", err)
+	}
+
+	if enabled {
+		result.UsedRecoveryCode, err = s.verify(ctx, userID, code)
+	} else {
+		result.RecoveryCodes, err = s.Confirm(ctx, userID, code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidCode) || errors.Is(err, ErrNoPendingSetup) {
+			if _, updateErr := s.db.ExecContext(ctx, `
+				UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE token_hash = $1`,
+				hashToken(token)); updateErr != nil {
+				return nil, fmt.Errorf("记录验证失败次数失败: %v", updateErr)
+			}
+		}
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM two_factor_challenges WHERE token_hash = $1`, hashToken(token)); err != nil {
+		return nil, fmt.Errorf("删除登录挑战失败: %v", err)
+	}
+	return result, nil
+}
+
+// Setup 生成新密钥，确认前不生效，已启用的用户需先关闭
+func (s *Service) Setup(ctx context.Context, userID uuid.UUID, username string) (*Enrollment, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_two_factor (user_id, pending_secret, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET pending_secret = EXCLUDED.pending_secret, updated_at = EXCLUDED.updated_at
+		WHERE user_two_factor.enabled = FALSE`,
+		userID, secret, s.now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("保存两步验证密钥失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrAlreadyEnabled
+	}
+
+	return &Enrollment{
+		Secret: secret,
+		URI:    ProvisioningURI(s.cfg.Issuer, username, secret),
+	}, nil
+}
+
+// Confirm 用验证器App显示的验证码确认绑定，启用两步验证并返回恢复码
+func (s *Service) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	var pending sql.NullString
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT pending_secret, enabled FROM user_two_factor WHERE user_id = $1`,
+		userID).Scan(&pending, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoPendingSetup
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询两步验证密钥失败: %v", err)
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if !pending.Valid || pending.String == "" {
+		return nil, ErrNoPendingSetup
+	}
+
+	now := s.now()
+	step, ok := ValidateCode(pending.String, normalizeCode(code), now, 0)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_two_factor
+		SET secret = pending_secret, pending_secret = NULL, enabled = TRUE, last_step = $2, enabled_at = $3, updated_at = $3
+		WHERE user_id = $1 AND enabled = FALSE AND pending_secret = $4`,
+		userID, step, now.UTC(), pending.String)
+	if err != nil {
+		return nil, fmt.Errorf("启用两步验证失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// 并发的Setup替换了密钥，或另一个请求已完成确认
+		return nil, ErrNoPendingSetup
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 用当前验证码换取一组新的恢复码，旧恢复码全部作废
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := s.verifyTOTP(ctx, userID, normalizeCode(code)); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := s.replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return codes, nil
+}
+
+// Disable 用户用验证码或恢复码关闭两步验证，策略或管理员要求启用时返回ErrRequired
+func (s *Service) Disable(ctx context.Context, userID uuid.UUID, username, code string) error {
+	status, err := s.GetStatus(ctx, userID, username)
+	if err != nil {
+		return err
+	}
+	if !status.Enabled {
+		return ErrNotEnabled
+	}
+	if status.Required {
+		return ErrRequired
+	}
+	if _, err := s.verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.Reset(ctx, userID)
+}
+
+// Reset 清除用户的密钥和恢复码（管理员处理丢失设备），保留管理员设置的强制标记
+func (s *Service) Reset(ctx context.Context, userID uuid.UUID) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_two_factor
+		SET secret = NULL, pending_secret = NULL, enabled = FALSE, last_step = 0, enabled_at = NULL, updated_at = $2
+		WHERE user_id = $1`,
+		userID, s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("重置两步验证失败: %v", err)
+	}
+	for _, query := range []string{
+		`DELETE FROM user_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM two_factor_challenges WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return fmt.Errorf("重置两步验证失败: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// SetRequired 管理员为单个用户设置是否强制两步验证
+func (s *Service) SetRequired(ctx context.Context, userID uuid.UUID, required bool) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_two_factor (user_id, required, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET required = EXCLUDED.required, updated_at = EXCLUDED.updated_at`,
+		userID, required, s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("设置两步验证策略失败: %v", err)
+	}
+	return nil
+}
+
+// verify 校验验证码或恢复码，返回是否使用了恢复码
+func (s *Service) verify(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	code = normalizeCode(code)
+	if len(code) == Digits && strings.Trim(code, "0123456789") == "" {
+		_, err := s.verifyTOTP(ctx, userID, code)
+		return false, err
+	}
+	return true, s.useRecoveryCode(ctx, userID, code)
+}
+
+// verifyTOTP 校验验证码并记录时间步，同一验证码只能使用一次
+func (s *Service) verifyTOTP(ctx context.Context, userID uuid.UUID, code string) (int64, error) {
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT secret, enabled, last_step FROM user_two_factor WHERE user_id = $1`,
+		userID).Scan(&secret, &enabled, &lastStep)
+	if err == sql.ErrNoRows || (err == nil && (!enabled || !secret.Valid)) {
+		return 0, ErrNotEnabled
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询两步验证密钥失败: %v", err)
+	}
+
+	step, ok := ValidateCode(secret.String, code, s.now(), lastStep)
+	if !ok {
+		return 0, ErrInvalidCode
+	}
+	// 条件更新保证并发请求中同一时间步只有一个成功
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_two_factor SET last_step = $2 WHERE user_id = $1 AND last_step < $2`,
+		userID, step)
+	if err != nil {
+		return 0, fmt.Errorf("记录验证码使用失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, ErrInvalidCode
+	}
+	return step, nil
+}
+
+// useRecoveryCode 消耗一个未使用的恢复码
+func (s *Service) useRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	if code == "" {
+		return ErrInvalidCode
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, hashToken(code), s.now().UTC())
+	if err != nil {
+		return fmt.Errorf("使用恢复码失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes 生成新的恢复码并替换旧的，数据库只保存摘要
+func (s *Service) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("删除旧恢复码失败: %v", err)
+	}
+
+	codes := make([]string, 0, s.cfg.RecoveryCodes)
+	for len(codes) < s.cfg.RecoveryCodes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`,
+			userID, hashToken(normalizeCode(code)))
+		if err != nil {
+			return nil, fmt.Errorf("保存恢复码失败: %v", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode 生成形如ABCDE-FGHIJ的恢复码
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := secretEncoding.EncodeToString(buf)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	return strings.ToUpper(code)
+}
+
+// newToken 生成登录挑战令牌
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 数据库只保存挑战令牌和恢复码的摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
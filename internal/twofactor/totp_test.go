@@ -0,0 +1,85 @@
+package twofactor
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238附录B中SHA1测试向量使用的密钥
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// 附录B给出8位验证码，6位验证码为其后6位
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := Code(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code(%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	previous, _ := Code(secret, now.Add(-Period))
+	current, _ := Code(secret, now)
+	stale, _ := Code(secret, now.Add(-2*Period))
+
+	step, ok := ValidateCode(secret, previous, now, 0)
+	if !ok || step != timeStep(now)-1 {
+		t.Errorf("previous step: ok=%v step=%d", ok, step)
+	}
+	if _, ok := ValidateCode(secret, stale, now, 0); ok {
+		t.Error("code from two steps ago was accepted")
+	}
+	// 已使用过的时间步不能再次使用
+	if _, ok := ValidateCode(secret, previous, now, timeStep(now)-1); ok {
+		t.Error("replayed code was accepted")
+	}
+	if _, ok := ValidateCode(secret, current, now, timeStep(now)-1); !ok {
+		t.Error("code of a later step was rejected after an earlier one was used")
+	}
+	if _, ok := ValidateCode(secret, "12345", now, 0); ok {
+		t.Error("short code was accepted")
+	}
+	// 验证器App显示的密钥可能是小写并带空格
+	spaced := strings.ToLower(secret[:4] + " " + secret[4:])
+	if _, ok := ValidateCode(spaced, current, now, 0); !ok {
+		t.Error("secret with spaces and lower case was rejected")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("WebDAV Gateway", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	if u.Path != "/WebDAV Gateway:alice@example.com" {
+		t.Errorf("label = %q", u.Path)
+	}
+	query := u.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "WebDAV Gateway" ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", query)
+	}
+}
@@ -16,6 +16,10 @@ type PropertyError struct {
 	Description string    `json:"description,omitempty"`
 	Property    string    `json:"property,omitempty"`
 	PropertyObj Property  `json:"property_obj,omitempty"`
+	// Namespace Property所在的命名空间
+	Namespace   string    `json:"namespace,omitempty"`
+	// Condition 响应D:error中的前置条件元素名（如cannot-modify-protected-property），为空时不输出
+	Condition   string    `json:"condition,omitempty"`
 }
 
 func (e *PropertyError) Error() string {
@@ -87,8 +91,8 @@ type PropertyUpdateResult struct {
 
 // Propstat 属性状态
 type Propstat struct {
-	Prop ResponseProp `json:"prop"`
-	Status string     `json:"status"`
+	Prop ResponseProp `json:"prop" xml:"D:prop"`
+	Status string     `json:"status" xml:"D:status"`
 }
 
 // PropContentResponse 属性内容响应
@@ -122,20 +126,175 @@ type WebDAVPropstat struct {
 type ResponseProp struct {
 	DisplayName       string        `xml:"D:displayname,omitempty"`
 	GetContentLength  int64         `xml:"D:getcontentlength,omitempty"`
-	GetContentType    string        `xml:"D:getlastmodified,omitempty"`
+	GetContentType    string        `xml:"D:getcontenttype,omitempty"`
 	GetLastModified   string        `xml:"D:getlastmodified,omitempty"`
 	CreationDate      string        `xml:"D:creationdate,omitempty"`
 	ResourceType      *ResourceType `xml:"D:resourcetype,omitempty"`
 	GetETag           string        `xml:"D:getetag,omitempty"`
-	SupportedLock     []interface{} `xml:"D:supportedlock>DAV:lockentry,omitempty"`
-	LockDiscovery     []ActiveLock  `xml:"D:lockdiscovery,omitempty"`
+	SupportedLock     *SupportedLock `xml:"D:supportedlock,omitempty"`
+	LockDiscovery     *LockDiscovery `xml:"D:lockdiscovery,omitempty"`
+	// 稳定文件ID（oc:fileid）
+	FileID            string        `xml:"oc:fileid,omitempty"`
+	// 目录只读标记（gw:read-only）
+	ReadOnly          string        `xml:"gw:read-only,omitempty"`
+	// 上传时计算的内容校验值（十六进制）
+	GetContentMD5     string        `xml:"gw:getcontentmd5,omitempty"`
+	ChecksumSHA256    string        `xml:"gw:checksum-sha256,omitempty"`
+	// 收藏标记（oc:favorite），只在收藏的资源上返回1
+	Favorite          string        `xml:"oc:favorite,omitempty"`
+	// 文件的评论数（gw:comment-count）
+	CommentCount      string        `xml:"gw:comment-count,omitempty"`
+	// CalDAV日历集合支持的组件及REPORT返回的日历数据
+	SupportedCalendarComponentSet *CalendarComponentSet `xml:"C:supported-calendar-component-set,omitempty"`
+	CalendarData      string        `xml:"C:calendar-data,omitempty"`
+	// CardDAV通讯录集合支持的vCard版本、单个联系人大小上限及REPORT返回的联系人数据
+	SupportedAddressData *AddressDataTypes `xml:"CARD:supported-address-data,omitempty"`
+	MaxResourceSize   int64         `xml:"CARD:max-resource-size,omitempty"`
+	AddressData       string        `xml:"CARD:address-data,omitempty"`
+	// 客户端发现日历和通讯录所需的主体及主目录（只在根目录返回）
+	CurrentUserPrincipal *Href      `xml:"D:current-user-principal,omitempty"`
+	CalendarHomeSet   *Href         `xml:"C:calendar-home-set,omitempty"`
+	AddressbookHomeSet *Href        `xml:"CARD:addressbook-home-set,omitempty"`
+	// RFC 3744访问控制属性，只在PROPFIND显式请求时返回
+	Owner             *Href         `xml:"D:owner,omitempty"`
+	ACL               *ACL          `xml:"D:acl,omitempty"`
+	CurrentUserPrivilegeSet *PrivilegeSet `xml:"D:current-user-privilege-set,omitempty"`
+	SupportedPrivilegeSet *SupportedPrivilegeSet `xml:"D:supported-privilege-set,omitempty"`
+	ACLRestrictions   *ACLRestrictions `xml:"D:acl-restrictions,omitempty"`
+	// RFC 4331配额属性（只在集合上返回），0是有效值，用指针区分未设置
+	QuotaAvailableBytes *int64      `xml:"D:quota-available-bytes,omitempty"`
+	QuotaUsedBytes    *int64        `xml:"D:quota-used-bytes,omitempty"`
+	// 自定义（dead）属性，逐个序列化为带命名空间的XML元素
+	DeadProperties    []DeadProperty    `xml:",any"`
 	// 自定义属性支持
 	CustomProperties  map[string]string `xml:"-"`
 }
 
+// DeadProperty 通过PROPPATCH写入的自定义属性，在multistatus中按原命名空间输出
+type DeadProperty struct {
+	Namespace string
+	Name      string
+	Value     string
+}
+
+// deadPropertyPrefixes 常见命名空间的习惯前缀，其他命名空间使用ns0
+var deadPropertyPrefixes = map[string]string{
+	"DAV:":                            "D",
+	NamespaceOwnCloud:                 "oc",
+	NamespaceCalDAV:                   "C",
+	NamespaceCardDAV:                  "CARD",
+	"http://nextcloud.org/ns":         "nc",
+	"http://webdav-gateway.org/media": "media",
+}
+
+// MarshalXML 输出 <prefix:name xmlns:prefix="namespace">value</prefix:name>
+// 命名空间声明放在元素自身上，每个属性都可以独立解析
+func (p DeadProperty) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if p.Namespace == "" {
+		return e.EncodeElement(p.Value, xml.StartElement{Name: xml.Name{Local: p.Name}})
+	}
+
+	prefix, ok := deadPropertyPrefixes[p.Namespace]
+	if !ok {
+		prefix = "ns0"
+	}
+	start := xml.StartElement{
+		Name: xml.Name{Local: prefix + ":" + p.Name},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:" + prefix}, Value: p.Namespace}},
+	}
+	return e.EncodeElement(p.Value, start)
+}
+
+// Key 返回属性的"namespace:name"键，与CustomProperties的键格式一致
+func (p DeadProperty) Key() string {
+	return p.Namespace + ":" + p.Name
+}
+
 // ResourceType 资源类型
 type ResourceType struct {
 	Collection *struct{} `xml:"D:collection,omitempty"`
+	Calendar   *struct{} `xml:"C:calendar,omitempty"`
+	Addressbook *struct{} `xml:"CARD:addressbook,omitempty"`
+}
+
+// Href 只包含一个D:href的属性值
+type Href struct {
+	Href string `xml:"D:href"`
+}
+
+// ACL DAV:acl（RFC 3744 5.5），按求值顺序列出ACE
+type ACL struct {
+	ACEs []ACE `xml:"D:ace"`
+}
+
+// ACE 一条访问控制项，Grant和Deny只设置其中一个
+type ACE struct {
+	Principal ACEPrincipal  `xml:"D:principal"`
+	Grant     *PrivilegeSet `xml:"D:grant,omitempty"`
+	Deny      *PrivilegeSet `xml:"D:deny,omitempty"`
+	Protected *struct{}     `xml:"D:protected,omitempty"`
+	Inherited *Href         `xml:"D:inherited,omitempty"`
+}
+
+// ACEPrincipal ACE适用的主体，只设置其中一个字段
+type ACEPrincipal struct {
+	Href            string    `xml:"D:href,omitempty"`
+	All             *struct{} `xml:"D:all,omitempty"`
+	Authenticated   *struct{} `xml:"D:authenticated,omitempty"`
+	Unauthenticated *struct{} `xml:"D:unauthenticated,omitempty"`
+	Self            *struct{} `xml:"D:self,omitempty"`
+	Owner           *struct{} `xml:"D:property>D:owner,omitempty"`
+}
+
+// PrivilegeSet D:grant、D:deny和D:current-user-privilege-set中的权限列表
+type PrivilegeSet struct {
+	Privileges []Privilege `xml:"D:privilege"`
+}
+
+// Privilege 单个权限，Name.XMLName为带D:前缀的元素名（如D:read）
+type Privilege struct {
+	Name struct {
+		XMLName xml.Name
+	}
+}
+
+// SupportedPrivilegeSet DAV:supported-privilege-set，聚合权限包含其子权限
+type SupportedPrivilegeSet struct {
+	Privileges []SupportedPrivilege `xml:"D:supported-privilege"`
+}
+
+// SupportedPrivilege 支持的一个权限及其聚合的子权限
+type SupportedPrivilege struct {
+	Privilege   Privilege            `xml:"D:privilege"`
+	Abstract    *struct{}            `xml:"D:abstract,omitempty"`
+	Description string               `xml:"D:description"`
+	Children    []SupportedPrivilege `xml:"D:supported-privilege,omitempty"`
+}
+
+// ACLRestrictions DAV:acl-restrictions，列出ACL方法的限制
+type ACLRestrictions struct {
+	NoInvert *struct{} `xml:"D:no-invert,omitempty"`
+}
+
+// AddressDataTypes CARDDAV:supported-address-data
+type AddressDataTypes struct {
+	Types []AddressDataType `xml:"CARD:address-data-type"`
+}
+
+// AddressDataType 通讯录支持的一种vCard格式
+type AddressDataType struct {
+	ContentType string `xml:"content-type,attr"`
+	Version     string `xml:"version,attr"`
+}
+
+// CalendarComponentSet CALDAV:supported-calendar-component-set
+type CalendarComponentSet struct {
+	Comps []CalendarComp `xml:"C:comp"`
+}
+
+// CalendarComp 日历集合支持的一种组件
+type CalendarComp struct {
+	Name string `xml:"name,attr"`
 }
 
 // LockScopeInfo 锁作用域信息（XML格式）
@@ -144,11 +303,54 @@ type LockScopeInfo struct {
 	Shared    *struct{} `xml:"D:shared,omitempty"`
 }
 
+// UnmarshalXML 按DAV:命名空间识别请求中的作用域。字段标签中的D:前缀只用于输出，
+// 解析时不能直接匹配客户端声明的命名空间
+func (s *LockScopeInfo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return unmarshalDAVFlags(d, func(name string) {
+		switch name {
+		case "exclusive":
+			s.Exclusive = &struct{}{}
+		case "shared":
+			s.Shared = &struct{}{}
+		}
+	})
+}
+
 // LockTypeInfo 锁类型信息（XML格式）
 type LockTypeInfo struct {
 	Write *struct{} `xml:"D:write,omitempty"`
 }
 
+// UnmarshalXML 按DAV:命名空间识别请求中的锁类型
+func (t *LockTypeInfo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return unmarshalDAVFlags(d, func(name string) {
+		if name == "write" {
+			t.Write = &struct{}{}
+		}
+	})
+}
+
+// unmarshalDAVFlags 读取元素的直接子元素，对DAV:命名空间中的每个子元素调用set，其余内容忽略
+func unmarshalDAVFlags(d *xml.Decoder, set func(name string)) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == "DAV:" {
+				set(t.Name.Local)
+			}
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
 // ActiveLock 活跃锁
 type ActiveLock struct {
 	XMLName   xml.Name      `xml:"D:activelock"`
@@ -157,7 +359,24 @@ type ActiveLock struct {
 	Depth     string        `xml:"D:depth"`
 	Owner     string        `xml:"D:owner,omitempty"`
 	Timeout   string        `xml:"D:timeout"`
-	LockToken string        `xml:"D:locktoken,omitempty"`
+	LockToken *Href         `xml:"D:locktoken,omitempty"`
+	LockRoot  *Href         `xml:"D:lockroot,omitempty"`
+}
+
+// LockEntry DAV:supportedlock中的一种锁定方式
+type LockEntry struct {
+	LockScope LockScopeInfo `xml:"D:lockscope"`
+	LockType  LockTypeInfo  `xml:"D:locktype"`
+}
+
+// SupportedLock DAV:supportedlock（RFC 4918 15.10）
+type SupportedLock struct {
+	LockEntries []LockEntry `xml:"D:lockentry"`
+}
+
+// LockDiscovery DAV:lockdiscovery（RFC 4918 15.8），没有锁时为空元素
+type LockDiscovery struct {
+	ActiveLocks []ActiveLock `xml:"D:activelock"`
 }
 
 // LockInfoRequest LOCK请求体结构
@@ -273,6 +492,15 @@ const (
 	
 	// NamespaceUser 用户命名空间
 	NamespaceUser = "USER"
+
+	// NamespaceOwnCloud ownCloud/Nextcloud客户端使用的命名空间
+	NamespaceOwnCloud = "http://owncloud.org/ns"
+
+	// NamespaceCalDAV CalDAV命名空间（RFC 4791）
+	NamespaceCalDAV = "urn:ietf:params:xml:ns:caldav"
+
+	// NamespaceCardDAV CardDAV命名空间（RFC 6352）
+	NamespaceCardDAV = "urn:ietf:params:xml:ns:carddav"
 )
 
 // ========================================
@@ -292,4 +520,11 @@ var KnownLiveProperties = map[string]bool{
 	"source":              true,
 	"supportedlock":       true,
 	"displayname":         true,
+	"owner":               true,
+	"acl":                 true,
+	"current-user-privilege-set": true,
+	"supported-privilege-set":    true,
+	"acl-restrictions":    true,
+	"quota-available-bytes": true,
+	"quota-used-bytes":    true,
 }
\ No newline at end of file
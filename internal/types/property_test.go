@@ -0,0 +1,100 @@
+package types
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDeadPropertyMarshalXML(t *testing.T) {
+	tests := []struct {
+		name string
+		prop DeadProperty
+		want string
+	}{
+		{
+			name: "custom namespace",
+			prop: DeadProperty{Namespace: "http://example.com/ns", Name: "author", Value: "Alice"},
+			want: `<ns0:author xmlns:ns0="http://example.com/ns">Alice</ns0:author>`,
+		},
+		{
+			name: "known prefix",
+			prop: DeadProperty{Namespace: NamespaceOwnCloud, Name: "tags", Value: "work"},
+			want: `<oc:tags xmlns:oc="http://owncloud.org/ns">work</oc:tags>`,
+		},
+		{
+			name: "DAV namespace",
+			prop: DeadProperty{Namespace: "DAV:", Name: "displayname", Value: "Report"},
+			want: `<D:displayname xmlns:D="DAV:">Report</D:displayname>`,
+		},
+		{
+			name: "no namespace",
+			prop: DeadProperty{Name: "color", Value: "red"},
+			want: `<color>red</color>`,
+		},
+		{
+			name: "escaped value",
+			prop: DeadProperty{Namespace: "http://example.com/ns", Name: "note", Value: `a < b & "c"`},
+			want: `<ns0:note xmlns:ns0="http://example.com/ns">a &lt; b &amp; &#34;c&#34;</ns0:note>`,
+		},
+		{
+			name: "empty value",
+			prop: DeadProperty{Namespace: "http://example.com/ns", Name: "flag"},
+			want: `<ns0:flag xmlns:ns0="http://example.com/ns"></ns0:flag>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := xml.Marshal(tt.prop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeadPropertiesRoundTrip 多个属性放在同一个prop中输出，各自的命名空间声明可以被独立解析
+func TestDeadPropertiesRoundTrip(t *testing.T) {
+	props := []DeadProperty{
+		{Namespace: "http://example.com/a", Name: "x", Value: "1"},
+		{Namespace: "http://example.com/b", Name: "x", Value: "2"},
+		{Namespace: NamespaceOwnCloud, Name: "tags", Value: "a & b"},
+	}
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"D:prop"`
+		NS      string   `xml:"xmlns:D,attr"`
+		ResponseProp
+	}{NS: "DAV:", ResponseProp: ResponseProp{DisplayName: "file.txt", DeadProperties: props}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Props []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+
+	got := make(map[string]string)
+	for _, p := range decoded.Props {
+		got[p.XMLName.Space+" "+p.XMLName.Local] = p.Value
+	}
+	for _, p := range props {
+		if value, ok := got[p.Namespace+" "+p.Name]; !ok || value != p.Value {
+			t.Errorf("property {%s}%s = %q (present %v) in %s", p.Namespace, p.Name, value, ok, data)
+		}
+	}
+	if got["DAV: displayname"] != "file.txt" {
+		t.Errorf("live property lost: %s", data)
+	}
+	if strings.Count(string(data), `xmlns:ns0=`) != 2 {
+		t.Errorf("each custom property should declare its own namespace: %s", data)
+	}
+}
@@ -0,0 +1,477 @@
+// Package uploads 预签名直接上传：客户端凭网关签发的URL把文件直接写入存储，
+// 完成后由网关计入用量并写入变更日志
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/changes"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/webdav/validators"
+)
+
+// 错误定义
+var (
+	ErrNotFound       = Error("upload not found")
+	ErrInvalidPath    = Error("invalid upload path")
+	ErrIsFolder       = Error("upload path is a folder")
+	ErrParentNotFound = Error("parent folder does not exist")
+	ErrQuotaExceeded  = Error("storage quota exceeded")
+	ErrTooLarge       = Error("file needs more than 10000 parts, increase uploads.part_size")
+	ErrNotPending     = Error("upload is not pending")
+	ErrNotUploaded    = Error("upload content has not been written to storage")
+	ErrSizeMismatch   = Error("uploaded size does not match the declared size")
+	ErrRejected       = Error("upload was rejected and deleted")
+	ErrUnsupported    = Error("storage backend does not support direct uploads")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// maxParts S3分段上传的分段数上限
+const maxParts = 10000
+
+// clockSkew 判断对象是否由本次上传写入时容许的网关与存储之间的时钟偏差
+const clockSkew = time.Minute
+
+// Quota 直接上传计入用户配额
+type Quota interface {
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error
+}
+
+// WriteGuard 与PUT相同的只读目录、锁、访问控制和剩余配额（包括租户配额池）检查，由webdav.Handler.WriteGuard提供
+type WriteGuard interface {
+	CheckWrite(ctx context.Context, userID uuid.UUID, resourcePath string) error
+	RemainingQuota(ctx context.Context, userID uuid.UUID, previousSize int64) int64
+}
+
+// Journal 记录完成的上传，未启用变更通知时为nil
+type Journal interface {
+	Record(ctx context.Context, change changes.Change) error
+}
+
+// Service 签发直接上传并跟踪其完成情况。上传记录保存在数据库中，完成回调和后台轮询都通过
+// 条件更新领取，多副本部署时每个上传只会计入一次
+type Service struct {
+	db      *sql.DB
+	storage *storage.Service
+	quota   Quota
+	guard   WriteGuard
+	journal Journal
+	config  config.UploadsConfig
+
+	// maxPathBytes和filenamePolicy与WebDAV创建文件时的路径规则一致
+	maxPathBytes   int
+	filenamePolicy *validators.FilenamePolicy
+
+	cancel   context.CancelFunc
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewService 创建直接上传服务，journal为nil时不写变更日志
+func NewService(db *sql.DB, storageService *storage.Service, quota Quota, journal Journal, cfg config.UploadsConfig) *Service {
+	return &Service{
+		db:      db,
+		storage: storageService,
+		quota:   quota,
+		journal: journal,
+		config:  cfg,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetPathRules 设置路径长度上限和文件名规则，与WebDAV的PUT保持一致
+func (s *Service) SetPathRules(maxPathBytes int, policy *validators.FilenamePolicy) {
+	s.maxPathBytes = maxPathBytes
+	s.filenamePolicy = policy
+}
+
+// SetWriteGuard 设置签发和完成上传时的写入检查，未设置时只检查用户配额
+func (s *Service) SetWriteGuard(guard WriteGuard) {
+	s.guard = guard
+}
+
+// Initialize 创建上传记录表
+func (s *Service) Initialize(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS direct_uploads (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			parts INTEGER NOT NULL DEFAULT 0,
+			part_size BIGINT NOT NULL DEFAULT 0,
+			upload_id TEXT NOT NULL DEFAULT '',
+			overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+			previous_size BIGINT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_direct_uploads_pending ON direct_uploads(user_id) WHERE status = 'pending'`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to initialize upload tables: %w", err)
+		}
+	}
+	return nil
+}
+
+const uploadColumns = `id, user_id, path, size, content_type, status, parts, part_size, upload_id,
+	overwrite, previous_size, expires_at, created_at, completed_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// upload 上传记录及网关内部使用的字段
+type upload struct {
+	models.DirectUpload
+	overwrite bool
+}
+
+func scanUpload(row rowScanner) (*upload, error) {
+	u := &upload{}
+	if err := row.Scan(&u.ID, &u.UserID, &u.Path, &u.Size, &u.ContentType, &u.Status, &u.Parts, &u.PartSize, &u.UploadID,
+		&u.overwrite, &u.PreviousSize, &u.ExpiresAt, &u.CreatedAt, &u.CompletedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Presign 校验路径、写入权限和配额后签发上传URL：不超过part_size的文件为单次PUT，更大的文件为分段上传
+func (s *Service) Presign(ctx context.Context, userID uuid.UUID, req *models.PresignUploadRequest) (*models.PresignedUpload, error) {
+	uploadPath, err := davpath.Normalize(req.Path, s.maxPathBytes)
+	if err != nil || uploadPath == "/" || strings.HasSuffix(uploadPath, "/") {
+		return nil, ErrInvalidPath
+	}
+	if s.filenamePolicy != nil {
+		if err := s.filenamePolicy.Validate(uploadPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var overwrite bool
+	var previousSize int64
+	resource, err := s.storage.StatResource(ctx, userID, uploadPath)
+	switch {
+	case err == nil && resource.IsCollection():
+		return nil, ErrIsFolder
+	case err == nil:
+		overwrite, previousSize = true, resource.Info.Size
+	case !storage.IsNotFound(err):
+		return nil, err
+	}
+	if parent := path.Dir(uploadPath); parent != "/" {
+		if resource, err := s.storage.StatResource(ctx, userID, parent+"/"); err != nil || !resource.IsCollection() {
+			if err != nil && !storage.IsNotFound(err) {
+				return nil, err
+			}
+			return nil, ErrParentNotFound
+		}
+	}
+	if s.guard != nil {
+		if err := s.guard.CheckWrite(ctx, userID, uploadPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkQuota(ctx, userID, req.Size, previousSize); err != nil {
+		return nil, err
+	}
+
+	u := &upload{overwrite: overwrite}
+	u.UserID, u.Path, u.Size, u.PreviousSize = userID, uploadPath, req.Size, previousSize
+	u.ContentType = contenttype.Resolve(uploadPath, req.ContentType)
+	u.ExpiresAt = time.Now().Add(s.config.TTL)
+	if req.Size > s.config.PartSize {
+		u.PartSize = s.config.PartSize
+		u.Parts = int((req.Size + u.PartSize - 1) / u.PartSize)
+		if u.Parts > maxParts {
+			return nil, ErrTooLarge
+		}
+	}
+
+	result := &models.PresignedUpload{Upload: &u.DirectUpload}
+	if u.Parts == 0 {
+		signed, err := s.storage.PresignPut(ctx, userID, uploadPath, u.ContentType, u.Size, s.config.TTL)
+		if err != nil {
+			return nil, presignError(err)
+		}
+		result.Request = presignedRequest(signed)
+	} else {
+		if u.UploadID, err = s.storage.NewMultipartUpload(ctx, userID, uploadPath, u.ContentType); err != nil {
+			return nil, presignError(err)
+		}
+		for part := 1; part <= u.Parts; part++ {
+			signed, err := s.storage.PresignUploadPart(ctx, userID, uploadPath, u.UploadID, part, s.config.TTL)
+			if err != nil {
+				s.abort(u)
+				return nil, presignError(err)
+			}
+			result.Parts = append(result.Parts, models.PresignedUploadPart{PartNumber: part, PresignedRequest: *presignedRequest(signed)})
+		}
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO direct_uploads (user_id, path, size, content_type, status, parts, part_size, upload_id, overwrite, previous_size, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at`,
+		userID, u.Path, u.Size, u.ContentType, models.DirectUploadStatusPending, u.Parts, u.PartSize, u.UploadID,
+		u.overwrite, u.PreviousSize, u.ExpiresAt).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		s.abort(u)
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	u.Status = models.DirectUploadStatusPending
+	return result, nil
+}
+
+// checkQuota 检查剩余配额能否容纳覆盖previousSize字节的size字节文件，尚未完成的直接上传预留的空间同样计入
+func (s *Service) checkQuota(ctx context.Context, userID uuid.UUID, size, previousSize int64) error {
+	if size <= previousSize {
+		return nil
+	}
+	remaining, err := s.remainingQuota(ctx, userID, previousSize)
+	if err != nil || remaining < 0 {
+		return err
+	}
+	var reserved int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN size > previous_size THEN size - previous_size ELSE 0 END), 0) FROM direct_uploads
+		WHERE user_id = $1 AND status = $2 AND expires_at > NOW()`,
+		userID, models.DirectUploadStatusPending).Scan(&reserved)
+	if err != nil {
+		return fmt.Errorf("failed to sum pending uploads: %w", err)
+	}
+	if reserved+size > remaining {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// remainingQuota 返回覆盖previousSize字节后还能写入的字节数，-1表示不限制。
+// 设置了WriteGuard时与PUT一致，租户成员同时受租户配额池限制
+func (s *Service) remainingQuota(ctx context.Context, userID uuid.UUID, previousSize int64) (int64, error) {
+	if s.guard != nil {
+		return s.guard.RemainingQuota(ctx, userID, previousSize), nil
+	}
+	user, err := s.quota.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return user.StorageQuota - user.StorageUsed + previousSize, nil
+}
+
+// Get 返回用户的一个上传
+func (s *Service) Get(ctx context.Context, userID, id uuid.UUID) (*models.DirectUpload, error) {
+	u, err := s.load(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &u.DirectUpload, nil
+}
+
+func (s *Service) load(ctx context.Context, userID, id uuid.UUID) (*upload, error) {
+	u, err := scanUpload(s.db.QueryRowContext(ctx,
+		`SELECT `+uploadColumns+` FROM direct_uploads WHERE id = $1 AND user_id = $2`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return u, nil
+}
+
+// Complete 客户端写入全部内容后调用：合并分段上传，确认对象已写入后计入用量和变更日志。
+// 已完成的上传再次调用直接返回
+func (s *Service) Complete(ctx context.Context, userID, id uuid.UUID) (*models.DirectUpload, error) {
+	u, err := s.load(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Status {
+	case models.DirectUploadStatusCompleted:
+		return &u.DirectUpload, nil
+	case models.DirectUploadStatusPending:
+	default:
+		return nil, ErrNotPending
+	}
+	if err := s.finish(ctx, u); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID, id)
+}
+
+// Cancel 放弃等待中的上传，分段上传已写入的分段被删除。单次PUT的URL无法撤销，
+// 在过期前写入的内容不会计入用量，由配额一致性检查修正
+func (s *Service) Cancel(ctx context.Context, userID, id uuid.UUID) error {
+	u, err := s.load(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !s.markFinished(ctx, u, models.DirectUploadStatusCanceled, u.Size) {
+		return ErrNotPending
+	}
+	s.abort(u)
+	return nil
+}
+
+// finish 确认内容已写入并计入。分段上传先按已上传的分段合并，缺少分段时返回ErrNotUploaded
+func (s *Service) finish(ctx context.Context, u *upload) error {
+	if u.Parts > 0 {
+		err := s.storage.CompleteMultipartUpload(ctx, u.UserID, u.Path, u.UploadID, u.Parts)
+		if errors.Is(err, storage.ErrUploadIncomplete) {
+			return ErrNotUploaded
+		}
+		// 其他副本已经合并时分段上传不存在，按对象是否已写入判断
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+	}
+
+	info, err := s.storage.StatObject(ctx, u.UserID, u.Path)
+	if storage.IsNotFound(err) {
+		return ErrNotUploaded
+	}
+	if err != nil {
+		return err
+	}
+	// 对象早于上传签发时间，仍是原来的文件
+	if info.LastModified.Before(u.CreatedAt.Add(-clockSkew)) {
+		return ErrNotUploaded
+	}
+	// 单次PUT的大小已签名，大小不符说明不是本次写入的内容；分段的大小没有签名，
+	// 合并出的对象大小不符时绕过了签发时的配额检查，拒绝并删除
+	if info.Size != u.Size {
+		if u.Parts == 0 {
+			return ErrNotUploaded
+		}
+		return s.reject(ctx, u, info.Size, ErrSizeMismatch)
+	}
+	// 签发之后目录可能被设为只读、资源可能被其他用户锁定、配额可能已被其他写入占用，
+	// 内容已经写入存储，按PUT的规则重新检查，不通过时拒绝并删除
+	if err := s.recheck(ctx, u, info.Size); err != nil {
+		return s.reject(ctx, u, info.Size, err)
+	}
+	if !s.markFinished(ctx, u, models.DirectUploadStatusCompleted, info.Size) {
+		return nil
+	}
+	if u.Parts == 0 {
+		s.storage.InvalidateListing(ctx, u.UserID, u.Path)
+	}
+
+	// 状态已经更新，调用方断开不应使计入失败
+	ctx = context.WithoutCancel(ctx)
+	if err := s.quota.UpdateStorageUsed(ctx, u.UserID, info.Size-u.PreviousSize); err != nil {
+		log.Printf("Warning: failed to account direct upload %s: %v", u.ID, err)
+	}
+	if s.journal != nil {
+		change := changes.Change{UserID: u.UserID, Type: changes.TypeCreated, Path: u.Path}
+		if u.overwrite {
+			change.Type = changes.TypeUpdated
+		}
+		if err := s.journal.Record(ctx, change); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return nil
+}
+
+// recheck 完成时按PUT的规则重新检查写入权限和配额，未设置WriteGuard时不检查
+func (s *Service) recheck(ctx context.Context, u *upload, size int64) error {
+	if s.guard == nil {
+		return nil
+	}
+	if err := s.guard.CheckWrite(ctx, u.UserID, u.Path); err != nil {
+		return err
+	}
+	if remaining := s.guard.RemainingQuota(ctx, u.UserID, u.PreviousSize); remaining >= 0 && size > u.PreviousSize && size > remaining {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// reject 把不能计入的上传（大小不符、完成时不再允许写入）标记为rejected并删除写入的对象，
+// 返回包含cause的ErrRejected。覆盖写入时原文件已被替换，按删除原文件扣除用量
+func (s *Service) reject(ctx context.Context, u *upload, size int64, cause error) error {
+	err := fmt.Errorf("%w: %w", ErrRejected, cause)
+	if !s.markFinished(ctx, u, models.DirectUploadStatusRejected, size) {
+		return err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if err := s.storage.DeleteObject(ctx, u.UserID, u.Path); err != nil && !storage.IsNotFound(err) {
+		log.Printf("Warning: failed to delete rejected upload %s: %v", u.ID, err)
+	}
+	if !u.overwrite {
+		return err
+	}
+	if err := s.quota.UpdateStorageUsed(ctx, u.UserID, -u.PreviousSize); err != nil {
+		log.Printf("Warning: failed to account rejected upload %s: %v", u.ID, err)
+	}
+	if s.journal != nil {
+		if err := s.journal.Record(ctx, changes.Change{UserID: u.UserID, Type: changes.TypeDeleted, Path: u.Path}); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return err
+}
+
+// markFinished 把等待中的上传改为status，已被其他请求或副本处理时返回false
+func (s *Service) markFinished(ctx context.Context, u *upload, status string, size int64) bool {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE direct_uploads SET status = $1, size = $2, completed_at = NOW()
+		WHERE id = $3 AND status = $4`,
+		status, size, u.ID, models.DirectUploadStatusPending)
+	if err != nil {
+		log.Printf("Warning: failed to update upload %s: %v", u.ID, err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// abort 放弃存储中的分段上传
+func (s *Service) abort(u *upload) {
+	if u.UploadID == "" {
+		return
+	}
+	if err := s.storage.AbortMultipartUpload(context.Background(), u.UserID, u.Path, u.UploadID); err != nil && !storage.IsNotFound(err) {
+		log.Printf("Warning: failed to abort multipart upload for %s: %v", u.ID, err)
+	}
+}
+
+func presignError(err error) error {
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		return ErrUnsupported
+	}
+	return err
+}
+
+func presignedRequest(req storage.PresignedRequest) *models.PresignedRequest {
+	return &models.PresignedRequest{Method: req.Method, URL: req.URL, Headers: req.Header}
+}
@@ -0,0 +1,305 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/models"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// fakePresigner 在本地目录上模拟分段直接上传：合并时写入written字节，代替客户端按分段写入的内容
+type fakePresigner struct {
+	storage.StorageBackend
+	written int64
+}
+
+func (f *fakePresigner) PresignPut(ctx context.Context, bucket, key string, size int64, expiry time.Duration, opts storage.PutOptions) (storage.PresignedRequest, error) {
+	return storage.PresignedRequest{}, storage.ErrPresignUnsupported
+}
+
+func (f *fakePresigner) NewMultipartUpload(ctx context.Context, bucket, key string, opts storage.PutOptions) (string, error) {
+	return "", storage.ErrPresignUnsupported
+}
+
+func (f *fakePresigner) PresignUploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int, expiry time.Duration) (storage.PresignedRequest, error) {
+	return storage.PresignedRequest{}, storage.ErrPresignUnsupported
+}
+
+func (f *fakePresigner) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts int) error {
+	return f.PutObject(ctx, bucket, key, bytes.NewReader(make([]byte, f.written)), f.written, storage.PutOptions{})
+}
+
+func (f *fakePresigner) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	return nil
+}
+
+// fakeQuota 累计计入的用量
+type fakeQuota struct {
+	used int64
+}
+
+func (q *fakeQuota) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	return &models.User{ID: userID, StorageUsed: q.used}, nil
+}
+
+func (q *fakeQuota) UpdateStorageUsed(ctx context.Context, userID uuid.UUID, delta int64) error {
+	q.used += delta
+	return nil
+}
+
+// fakeGuard 拒绝denied中的路径，剩余配额为limit减去已计入的用量
+type fakeGuard struct {
+	quota  *fakeQuota
+	limit  int64
+	denied map[string]error
+}
+
+func (g *fakeGuard) CheckWrite(ctx context.Context, userID uuid.UUID, resourcePath string) error {
+	return g.denied[resourcePath]
+}
+
+func (g *fakeGuard) RemainingQuota(ctx context.Context, userID uuid.UUID, previousSize int64) int64 {
+	return g.limit - g.quota.used + previousSize
+}
+
+func newTestService(t *testing.T) (*Service, *fakePresigner, *fakeQuota, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	userID := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, username, email, password_hash) VALUES ($1, 'alice', 'alice@example.com', 'x')`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &fakePresigner{StorageBackend: local}
+	store, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnsureBucket(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// SQLite的列默认值不能直接调用函数，不经Initialize建表
+	if _, err := db.Exec(`CREATE TABLE direct_uploads (
+		id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		path TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		content_type TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		parts INTEGER NOT NULL DEFAULT 0,
+		part_size BIGINT NOT NULL DEFAULT 0,
+		upload_id TEXT NOT NULL DEFAULT '',
+		overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+		previous_size BIGINT NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP
+	)`); err != nil {
+		t.Fatal(err)
+	}
+
+	quota := &fakeQuota{}
+	s := NewService(db, store, quota, nil, config.UploadsConfig{TTL: time.Hour, PartSize: 10})
+	return s, backend, quota, userID
+}
+
+// TestCompleteMultipartSize 分段上传合并出的对象大小与声明不符时拒绝并删除对象
+func TestCompleteMultipartSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		written    int64
+		previous   int64
+		want       error
+		wantStatus string
+		wantUsed   int64
+	}{
+		{"declared size", 25, 0, nil, models.DirectUploadStatusCompleted, 25},
+		{"larger", 1000, 0, ErrSizeMismatch, models.DirectUploadStatusRejected, 0},
+		{"smaller", 12, 0, ErrSizeMismatch, models.DirectUploadStatusRejected, 0},
+		{"overwrite", 25, 5, nil, models.DirectUploadStatusCompleted, 25},
+		// 覆盖写入时原文件已被替换，按删除原文件扣除用量
+		{"overwrite larger", 1000, 5, ErrSizeMismatch, models.DirectUploadStatusRejected, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backend, quota, userID := newTestService(t)
+			ctx := context.Background()
+			if tt.previous > 0 {
+				if err := s.storage.PutObject(ctx, userID, "/video.mp4", bytes.NewReader(make([]byte, tt.previous)), tt.previous, "video/mp4"); err != nil {
+					t.Fatal(err)
+				}
+				quota.used = tt.previous
+			}
+
+			// 与Presign签发的25字节、3个分段的上传相同
+			var id uuid.UUID
+			if err := s.db.QueryRow(`
+				INSERT INTO direct_uploads (user_id, path, size, status, parts, part_size, upload_id, overwrite, previous_size, expires_at)
+				VALUES ($1, '/video.mp4', 25, $2, 3, 10, 'upload-1', $3, $4, $5)
+				RETURNING id`,
+				userID, models.DirectUploadStatusPending, tt.previous > 0, tt.previous, time.Now().Add(time.Hour)).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+
+			backend.written = tt.written
+			upload, err := s.Complete(ctx, userID, id)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Complete = %v, want %v", err, tt.want)
+			}
+			if err == nil && upload.Size != tt.written {
+				t.Errorf("size = %d, want %d", upload.Size, tt.written)
+			}
+			upload, err = s.Get(ctx, userID, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upload.Status != tt.wantStatus || upload.CompletedAt == nil {
+				t.Errorf("upload = %+v, want status %s", upload, tt.wantStatus)
+			}
+			if quota.used != tt.wantUsed {
+				t.Errorf("storage used = %d, want %d", quota.used, tt.wantUsed)
+			}
+
+			_, err = s.storage.StatObject(ctx, userID, "/video.mp4")
+			if tt.want != nil && !storage.IsNotFound(err) {
+				t.Errorf("rejected object still stored: %v", err)
+			}
+			if tt.want == nil && err != nil {
+				t.Errorf("completed object: %v", err)
+			}
+
+			// 已被拒绝的上传不能再次完成
+			if tt.want != nil {
+				if _, err := s.Complete(ctx, userID, id); !errors.Is(err, ErrNotPending) {
+					t.Errorf("second Complete = %v, want ErrNotPending", err)
+				}
+			}
+		})
+	}
+}
+
+// addPending 插入一个与Presign签发的25字节、3个分段的上传相同的记录
+func addPending(t *testing.T, s *Service, userID uuid.UUID, uploadPath string) uuid.UUID {
+	t.Helper()
+	var id uuid.UUID
+	if err := s.db.QueryRow(`
+		INSERT INTO direct_uploads (user_id, path, size, status, parts, part_size, upload_id, expires_at)
+		VALUES ($1, $2, 25, $3, 3, 10, 'upload-1', $4)
+		RETURNING id`,
+		userID, uploadPath, models.DirectUploadStatusPending, time.Now().Add(time.Hour)).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// TestPresignChecks 签发前与PUT一样检查写入权限和剩余配额，未完成的上传预留的空间同样计入
+func TestPresignChecks(t *testing.T) {
+	locked := errors.New("locked")
+	tests := []struct {
+		name    string
+		path    string
+		size    int64
+		deny    bool
+		pending bool
+		want    error
+	}{
+		// 检查全部通过后才会签发，测试后端不支持签发
+		{"allowed", "/new.bin", 25, false, false, ErrUnsupported},
+		{"denied", "/new.bin", 25, true, false, locked},
+		{"quota", "/new.bin", 96, false, false, ErrQuotaExceeded},
+		{"reserved by pending upload", "/new.bin", 80, false, true, ErrQuotaExceeded},
+		// 覆盖5字节的文件只需要额外95字节
+		{"overwrite", "/old.bin", 100, false, false, ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, quota, userID := newTestService(t)
+			ctx := context.Background()
+			if err := s.storage.PutObject(ctx, userID, "/old.bin", bytes.NewReader(make([]byte, 5)), 5, ""); err != nil {
+				t.Fatal(err)
+			}
+			quota.used = 5
+			guard := &fakeGuard{quota: quota, limit: 100, denied: map[string]error{}}
+			if tt.deny {
+				guard.denied[tt.path] = locked
+			}
+			s.SetWriteGuard(guard)
+			if tt.pending {
+				addPending(t, s, userID, "/other.bin")
+			}
+
+			_, err := s.Presign(ctx, userID, &models.PresignUploadRequest{Path: tt.path, Size: tt.size})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Presign = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompleteRecheck 完成时不再允许写入的上传被拒绝并删除，不计入用量
+func TestCompleteRecheck(t *testing.T) {
+	locked := errors.New("locked")
+	tests := []struct {
+		name  string
+		limit int64
+		deny  bool
+		want  error
+	}{
+		{"allowed", 100, false, nil},
+		{"locked since presign", 100, true, locked},
+		{"quota used since presign", 20, false, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backend, quota, userID := newTestService(t)
+			ctx := context.Background()
+			guard := &fakeGuard{quota: quota, limit: tt.limit, denied: map[string]error{}}
+			if tt.deny {
+				guard.denied["/video.mp4"] = locked
+			}
+			s.SetWriteGuard(guard)
+			id := addPending(t, s, userID, "/video.mp4")
+
+			backend.written = 25
+			_, err := s.Complete(ctx, userID, id)
+			if tt.want == nil {
+				if err != nil || quota.used != 25 {
+					t.Errorf("Complete = %v, storage used %d", err, quota.used)
+				}
+				return
+			}
+			if !errors.Is(err, ErrRejected) || !errors.Is(err, tt.want) {
+				t.Fatalf("Complete = %v, want ErrRejected wrapping %v", err, tt.want)
+			}
+			upload, err := s.Get(ctx, userID, id)
+			if err != nil || upload.Status != models.DirectUploadStatusRejected {
+				t.Errorf("upload = %+v, %v", upload, err)
+			}
+			if _, err := s.storage.StatObject(ctx, userID, "/video.mp4"); !storage.IsNotFound(err) {
+				t.Errorf("rejected object still stored: %v", err)
+			}
+			if quota.used != 0 {
+				t.Errorf("storage used = %d, want 0", quota.used)
+			}
+		})
+	}
+}
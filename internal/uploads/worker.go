@@ -0,0 +1,89 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// Start 启动后台轮询：客户端没有调用完成接口的上传在内容写入后由轮询计入，过期的上传被放弃。
+// PollInterval不大于0时不启动，只能通过完成接口计入
+func (s *Service) Start() {
+	if s.config.PollInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.reconcile(ctx)
+			select {
+			case <-ticker.C:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止轮询
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// reconcile 检查等待中的上传：内容已写入的计入用量，过期仍未写入的标记为expired
+func (s *Service) reconcile(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+uploadColumns+` FROM direct_uploads
+		WHERE status = $1 AND (parts = 0 OR expires_at < NOW())
+		ORDER BY created_at
+		LIMIT 100`, models.DirectUploadStatusPending)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to query pending uploads: %v", err)
+		}
+		return
+	}
+	var pending []*upload
+	for rows.Next() {
+		if u, err := scanUpload(rows); err == nil {
+			pending = append(pending, u)
+		}
+	}
+	rows.Close()
+
+	for _, u := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		// 分段上传在过期前可能仍在进行，查询只返回过期的分段上传，按已上传的分段尝试合并
+		expired := time.Now().After(u.ExpiresAt)
+		err := s.finish(ctx, u)
+		switch {
+		case err == nil, errors.Is(err, ErrRejected):
+		case errors.Is(err, ErrNotUploaded):
+			if expired && s.markFinished(ctx, u, models.DirectUploadStatusExpired, u.Size) {
+				s.abort(u)
+			}
+		default:
+			if ctx.Err() == nil {
+				log.Printf("Warning: failed to reconcile upload %s: %v", u.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,656 @@
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// ACLPropertyName 资源ACL的属性名，位于NamespaceMetadata命名空间，值为ACE列表的JSON
+const ACLPropertyName = "acl"
+
+// maxACEs 单个资源最多可以设置的ACE数量（DAV:limited-number-of-aces）
+const maxACEs = 64
+
+// principalHref 当前用户的主体URL，与current-user-principal一致
+const principalHref = "/"
+
+// 权限（RFC 3744 3）
+const (
+	PrivilegeAll                         = "all"
+	PrivilegeRead                        = "read"
+	PrivilegeWrite                       = "write"
+	PrivilegeWriteProperties             = "write-properties"
+	PrivilegeWriteContent                = "write-content"
+	PrivilegeBind                        = "bind"
+	PrivilegeUnbind                      = "unbind"
+	PrivilegeUnlock                      = "unlock"
+	PrivilegeReadACL                     = "read-acl"
+	PrivilegeReadCurrentUserPrivilegeSet = "read-current-user-privilege-set"
+	PrivilegeWriteACL                    = "write-acl"
+)
+
+// 主体（RFC 3744 5.5.1），href主体只能是当前用户的主体URL
+const (
+	PrincipalAll             = "all"
+	PrincipalAuthenticated   = "authenticated"
+	PrincipalUnauthenticated = "unauthenticated"
+	PrincipalSelf            = "self"
+	PrincipalOwner           = "owner"
+	PrincipalHref            = "href"
+)
+
+// privilegeTree 聚合权限及其直接包含的子权限
+var privilegeTree = map[string][]string{
+	PrivilegeAll:   {PrivilegeRead, PrivilegeWrite, PrivilegeUnlock, PrivilegeReadACL, PrivilegeReadCurrentUserPrivilegeSet, PrivilegeWriteACL},
+	PrivilegeWrite: {PrivilegeWriteProperties, PrivilegeWriteContent, PrivilegeBind, PrivilegeUnbind},
+}
+
+// privilegeDescriptions supported-privilege-set中的权限说明
+var privilegeDescriptions = map[string]string{
+	PrivilegeAll:                         "Any operation",
+	PrivilegeRead:                        "Read any object",
+	PrivilegeWrite:                       "Write any object",
+	PrivilegeWriteProperties:             "Write properties",
+	PrivilegeWriteContent:                "Write resource content",
+	PrivilegeBind:                        "Add new members to a collection",
+	PrivilegeUnbind:                      "Remove members from a collection",
+	PrivilegeUnlock:                      "Unlock resource",
+	PrivilegeReadACL:                     "Read ACL",
+	PrivilegeReadCurrentUserPrivilegeSet: "Read current user privilege set property",
+	PrivilegeWriteACL:                    "Write ACL",
+}
+
+var (
+	// ErrUnsupportedPrivilege ACE中包含未知权限（DAV:not-supported-privilege）
+	ErrUnsupportedPrivilege = errors.New("unsupported privilege")
+	// ErrUnrecognizedPrincipal ACE的主体无法识别（DAV:recognized-principal）
+	ErrUnrecognizedPrincipal = errors.New("unrecognized principal")
+)
+
+// ACE 保存在资源上的一条访问控制项
+type ACE struct {
+	Principal string   `json:"principal"`
+	Href      string   `json:"href,omitempty"`
+	Grant     []string `json:"grant,omitempty"`
+	Deny      []string `json:"deny,omitempty"`
+}
+
+// protectedHeadACE 所有者始终可以读取和修改ACL，避免通过ACL把自己锁在外面
+var protectedHeadACE = ACE{Principal: PrincipalOwner, Grant: []string{PrivilegeReadACL, PrivilegeReadCurrentUserPrivilegeSet, PrivilegeWriteACL}}
+
+// protectedTailACE 没有其他ACE匹配时所有者拥有全部权限
+var protectedTailACE = ACE{Principal: PrincipalOwner, Grant: []string{PrivilegeAll}}
+
+// aclSubject 发起请求的主体。WebDAV路由下总是空间的所有者，公开命名空间为匿名用户
+type aclSubject struct {
+	authenticated bool
+	owner         bool
+}
+
+// ownerSubject 已认证的空间所有者
+var ownerSubject = aclSubject{authenticated: true, owner: true}
+
+// aclEntry 求值时的ACE，source为设置该ACE的资源路径
+type aclEntry struct {
+	ACE
+	source    string
+	protected bool
+}
+
+// aclSet 用户所有资源的ACL（按路径索引），一次查询后在内存中对多个资源求值
+type aclSet map[string][]ACE
+
+// matches 判断ACE是否适用于主体，self只在主体资源（根目录）上匹配
+func (e ACE) matches(subject aclSubject, resourcePath string) bool {
+	switch e.Principal {
+	case PrincipalAll:
+		return true
+	case PrincipalAuthenticated:
+		return subject.authenticated
+	case PrincipalUnauthenticated:
+		return !subject.authenticated
+	case PrincipalOwner, PrincipalHref:
+		return subject.owner
+	case PrincipalSelf:
+		return subject.owner && resourcePath == principalHref
+	}
+	return false
+}
+
+// coversPrivilege 判断权限列表中是否有权限等于或聚合了privilege
+func coversPrivilege(privileges []string, privilege string) bool {
+	for _, p := range privileges {
+		if p == privilege || coversPrivilege(privilegeTree[p], privilege) {
+			return true
+		}
+	}
+	return false
+}
+
+// leafPrivileges 返回权限展开后的全部非聚合权限
+func leafPrivileges(privilege string) []string {
+	children, ok := privilegeTree[privilege]
+	if !ok {
+		return []string{privilege}
+	}
+	var leaves []string
+	for _, child := range children {
+		leaves = append(leaves, leafPrivileges(child)...)
+	}
+	return leaves
+}
+
+// entries 返回资源的ACE求值顺序：受保护的头部、资源自身的ACE、上级目录继承的ACE（由近到远）、受保护的尾部
+func (a aclSet) entries(resourcePath string) []aclEntry {
+	resourcePath = normalizeCollectionPath(resourcePath)
+	list := []aclEntry{{ACE: protectedHeadACE, source: resourcePath, protected: true}}
+	for current := resourcePath; ; current = path.Dir(current) {
+		for _, ace := range a[current] {
+			list = append(list, aclEntry{ACE: ace, source: current})
+		}
+		if current == "/" {
+			break
+		}
+	}
+	return append(list, aclEntry{ACE: protectedTailACE, source: resourcePath, protected: true})
+}
+
+// decide 按顺序求值，第一条适用于主体且涉及该权限的ACE决定结果。
+// 聚合权限要求每个子权限都被授予；matched为false表示没有ACE涉及该权限
+func (a aclSet) decide(subject aclSubject, resourcePath, privilege string) (granted, matched bool) {
+	resourcePath = normalizeCollectionPath(resourcePath)
+	entries := a.entries(resourcePath)
+	granted, matched = true, true
+	for _, leaf := range leafPrivileges(privilege) {
+		leafMatched := false
+		for _, entry := range entries {
+			if !entry.matches(subject, resourcePath) {
+				continue
+			}
+			if coversPrivilege(entry.Deny, leaf) {
+				return false, true
+			}
+			if coversPrivilege(entry.Grant, leaf) {
+				leafMatched = true
+				break
+			}
+		}
+		if !leafMatched {
+			granted, matched = false, false
+		}
+	}
+	return granted, matched
+}
+
+// allowed 判断主体是否拥有资源上的权限
+func (a aclSet) allowed(subject aclSubject, resourcePath, privilege string) bool {
+	granted, _ := a.decide(subject, resourcePath, privilege)
+	return granted
+}
+
+// denied 判断权限是否被某条ACE明确拒绝
+func (a aclSet) denied(subject aclSubject, resourcePath, privilege string) bool {
+	granted, matched := a.decide(subject, resourcePath, privilege)
+	return matched && !granted
+}
+
+// privileges 按supported-privilege-set的顺序返回主体拥有的全部权限（current-user-privilege-set）
+func (a aclSet) privileges(subject aclSubject, resourcePath string) []string {
+	var granted []string
+	var walk func(privilege string)
+	walk = func(privilege string) {
+		if a.allowed(subject, resourcePath, privilege) {
+			granted = append(granted, privilege)
+		}
+		for _, child := range privilegeTree[privilege] {
+			walk(child)
+		}
+	}
+	walk(PrivilegeAll)
+	return granted
+}
+
+// LoadACLs 读取用户设置过的全部ACL
+func (s *PropertyService) LoadACLs(ctx context.Context, userID string) (aclSet, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	builder := NewSelectBuilder("properties", "path", "value").
+		Where("user_id = ? AND namespace = ? AND name = ?", userID, NamespaceMetadata, ACLPropertyName)
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询ACL失败: %v", err)
+	}
+	defer rows.Close()
+
+	acls := make(aclSet)
+	for rows.Next() {
+		var resourcePath, value string
+		if err := rows.Scan(&resourcePath, &value); err != nil {
+			return nil, err
+		}
+		var aces []ACE
+		if err := json.Unmarshal([]byte(value), &aces); err != nil {
+			log.Printf("Warning: ignoring malformed ACL on %s: %v", resourcePath, err)
+			continue
+		}
+		acls[normalizeCollectionPath(resourcePath)] = aces
+	}
+	return acls, rows.Err()
+}
+
+// SetACL 替换资源自身的ACE，列表为空时删除ACL恢复为继承
+func (s *PropertyService) SetACL(ctx context.Context, userID, resourcePath string, aces []ACE) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	resourcePath = normalizeCollectionPath(resourcePath)
+	if len(aces) == 0 {
+		existing, err := s.GetProperty(ctx, userID, resourcePath, NamespaceMetadata, ACLPropertyName)
+		if err != nil || existing == nil {
+			return err
+		}
+		return s.DeleteProperty(ctx, userID, resourcePath, NamespaceMetadata, ACLPropertyName)
+	}
+
+	value, err := json.Marshal(aces)
+	if err != nil {
+		return err
+	}
+	return s.setProperty(ctx, &DatabaseProperty{
+		UserID:    userID,
+		Path:      resourcePath,
+		Namespace: NamespaceMetadata,
+		Name:      ACLPropertyName,
+		Value:     string(value),
+		IsLive:    true,
+	})
+}
+
+// isACLProperty 判断是否为RFC 3744的访问控制属性或ACL存储，只能通过ACL方法修改
+func isACLProperty(namespace, name string) bool {
+	if namespace == NamespaceMetadata {
+		return name == ACLPropertyName
+	}
+	if namespace != "DAV:" {
+		return false
+	}
+	switch name {
+	case "owner", "acl", "current-user-privilege-set", "supported-privilege-set", "acl-restrictions":
+		return true
+	}
+	return false
+}
+
+// requestACLs 读取当前用户的ACL，同一请求中只查询一次
+func (h *Handler) requestACLs(c *gin.Context) (aclSet, error) {
+	return h.aclsFor(c, c.GetString("userID"))
+}
+
+// aclsFor 读取指定用户空间的ACL并缓存在请求上下文中
+func (h *Handler) aclsFor(c *gin.Context, userID string) (aclSet, error) {
+	if cached, ok := c.Get("webdav.acls"); ok {
+		return cached.(aclSet), nil
+	}
+	acls, err := h.propertyService.LoadACLs(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("webdav.acls", acls)
+	return acls, nil
+}
+
+// CheckPrivilege 检查当前用户是否拥有资源上的权限，没有则发送403 need-privileges错误
+func (h *Handler) CheckPrivilege(c *gin.Context, resourcePath, privilege string) bool {
+	acls, err := h.requestACLs(c)
+	if err != nil {
+		log.Printf("Warning: failed to load ACLs: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return true
+	}
+	if acls.allowed(ownerSubject, resourcePath, privilege) {
+		return false
+	}
+
+	h.sendNeedPrivilegesError(c, normalizeCollectionPath(resourcePath), privilege)
+	return true
+}
+
+// CheckParentPrivilege 检查上级目录的权限（bind/unbind）
+func (h *Handler) CheckParentPrivilege(c *gin.Context, resourcePath, privilege string) bool {
+	return h.CheckPrivilege(c, path.Dir(normalizeCollectionPath(resourcePath)), privilege)
+}
+
+// CheckWritePrivilege 写入已有资源需要write-content，创建新资源需要上级目录的bind。
+// 用户没有设置任何ACL时所有者拥有全部权限，不需要查询资源是否存在
+func (h *Handler) CheckWritePrivilege(c *gin.Context, resourcePath string) bool {
+	if acls, err := h.requestACLs(c); err == nil && len(acls) == 0 {
+		return false
+	}
+	uid, _ := uuid.Parse(c.GetString("userID"))
+	if h.resourceExists(c.Request.Context(), uid, normalizeCollectionPath(resourcePath)) {
+		return h.CheckPrivilege(c, resourcePath, PrivilegeWriteContent)
+	}
+	return h.CheckParentPrivilege(c, resourcePath, PrivilegeBind)
+}
+
+// canRead 判断当前用户能否读取资源，用于过滤PROPFIND、REPORT和SEARCH的结果
+func (h *Handler) canRead(c *gin.Context, resourcePath string) bool {
+	acls, err := h.requestACLs(c)
+	if err != nil {
+		return false
+	}
+	return acls.allowed(ownerSubject, resourcePath, PrivilegeRead)
+}
+
+// needPrivilegesError 403 DAV:need-privileges错误响应（RFC 3744 7.1.1）
+type needPrivilegesError struct {
+	XMLName   xml.Name                 `xml:"D:error"`
+	XMLNS     string                   `xml:"xmlns:D,attr"`
+	Resources []needPrivilegesResource `xml:"D:need-privileges>D:resource"`
+}
+
+// needPrivilegesResource 缺少权限的资源
+type needPrivilegesResource struct {
+	Href      string                `xml:"D:href"`
+	Privilege webdavtypes.Privilege `xml:"D:privilege"`
+}
+
+// sendNeedPrivilegesError 发送缺少权限的403错误响应
+func (h *Handler) sendNeedPrivilegesError(c *gin.Context, href, privilege string) {
+	resp := needPrivilegesError{
+		XMLNS:     "DAV:",
+		Resources: []needPrivilegesResource{{Href: href, Privilege: davPrivilege(privilege)}},
+	}
+
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.Status(http.StatusForbidden)
+	c.Writer.Write([]byte(xml.Header))
+	xml.NewEncoder(c.Writer).Encode(resp)
+}
+
+// davPrivilege 生成D:privilege元素
+func davPrivilege(name string) webdavtypes.Privilege {
+	var p webdavtypes.Privilege
+	p.Name.XMLName = xml.Name{Local: "D:" + name}
+	return p
+}
+
+// davPrivilegeSet 生成权限列表，列表为空时返回nil
+func davPrivilegeSet(names []string) *webdavtypes.PrivilegeSet {
+	if len(names) == 0 {
+		return nil
+	}
+	set := &webdavtypes.PrivilegeSet{}
+	for _, name := range names {
+		set.Privileges = append(set.Privileges, davPrivilege(name))
+	}
+	return set
+}
+
+// davACL 生成资源的DAV:acl属性值
+func (a aclSet) davACL(resourcePath string) *webdavtypes.ACL {
+	resourcePath = normalizeCollectionPath(resourcePath)
+	acl := &webdavtypes.ACL{}
+	for _, entry := range a.entries(resourcePath) {
+		ace := webdavtypes.ACE{
+			Grant: davPrivilegeSet(entry.Grant),
+			Deny:  davPrivilegeSet(entry.Deny),
+		}
+		switch entry.Principal {
+		case PrincipalAll:
+			ace.Principal.All = &struct{}{}
+		case PrincipalAuthenticated:
+			ace.Principal.Authenticated = &struct{}{}
+		case PrincipalUnauthenticated:
+			ace.Principal.Unauthenticated = &struct{}{}
+		case PrincipalSelf:
+			ace.Principal.Self = &struct{}{}
+		case PrincipalOwner:
+			ace.Principal.Owner = &struct{}{}
+		case PrincipalHref:
+			ace.Principal.Href = entry.Href
+		}
+		if entry.protected {
+			ace.Protected = &struct{}{}
+		} else if entry.source != resourcePath {
+			ace.Inherited = &webdavtypes.Href{Href: entry.source}
+		}
+		acl.ACEs = append(acl.ACEs, ace)
+	}
+	return acl
+}
+
+// supportedPrivilegeSet 生成DAV:supported-privilege-set属性值
+func supportedPrivilegeSet() *webdavtypes.SupportedPrivilegeSet {
+	var build func(name string) webdavtypes.SupportedPrivilege
+	build = func(name string) webdavtypes.SupportedPrivilege {
+		sp := webdavtypes.SupportedPrivilege{
+			Privilege:   davPrivilege(name),
+			Description: privilegeDescriptions[name],
+		}
+		for _, child := range privilegeTree[name] {
+			sp.Children = append(sp.Children, build(child))
+		}
+		return sp
+	}
+	return &webdavtypes.SupportedPrivilegeSet{Privileges: []webdavtypes.SupportedPrivilege{build(PrivilegeAll)}}
+}
+
+// addACLProperties 按请求为PROPFIND响应添加访问控制属性，没有read-acl时DAV:acl以403返回
+func (h *Handler) addACLProperties(c *gin.Context, resp *Response, props *reportProp) {
+	if props == nil || len(resp.Propstat) == 0 {
+		return
+	}
+	acls, err := h.requestACLs(c)
+	if err != nil {
+		return
+	}
+	resourcePath := resp.Href
+	prop := &resp.Propstat[0].Prop
+	var forbidden webdavtypes.ResponseProp
+
+	if props.wants("DAV:", "owner") {
+		prop.Owner = &webdavtypes.Href{Href: principalHref}
+	}
+	if props.wants("DAV:", "acl") {
+		if acls.allowed(ownerSubject, resourcePath, PrivilegeReadACL) {
+			prop.ACL = acls.davACL(resourcePath)
+		} else {
+			forbidden.ACL = &webdavtypes.ACL{}
+		}
+	}
+	if props.wants("DAV:", "current-user-privilege-set") {
+		if acls.allowed(ownerSubject, resourcePath, PrivilegeReadCurrentUserPrivilegeSet) {
+			prop.CurrentUserPrivilegeSet = davPrivilegeSet(acls.privileges(ownerSubject, resourcePath))
+			if prop.CurrentUserPrivilegeSet == nil {
+				prop.CurrentUserPrivilegeSet = &webdavtypes.PrivilegeSet{}
+			}
+		} else {
+			forbidden.CurrentUserPrivilegeSet = &webdavtypes.PrivilegeSet{}
+		}
+	}
+	if props.wants("DAV:", "supported-privilege-set") {
+		prop.SupportedPrivilegeSet = supportedPrivilegeSet()
+	}
+	if props.wants("DAV:", "acl-restrictions") {
+		prop.ACLRestrictions = &webdavtypes.ACLRestrictions{NoInvert: &struct{}{}}
+	}
+
+	if forbidden.ACL != nil || forbidden.CurrentUserPrivilegeSet != nil {
+		resp.Propstat = append(resp.Propstat, webdavtypes.Propstat{Prop: forbidden, Status: "HTTP/1.1 403 Forbidden"})
+	}
+}
+
+// aclRequest ACL方法的请求体（RFC 3744 8.1）
+type aclRequest struct {
+	XMLName xml.Name `xml:"DAV: acl"`
+	ACEs    []struct {
+		Principal *struct {
+			Nodes []daslNode `xml:",any"`
+		} `xml:"DAV: principal"`
+		Invert *struct{} `xml:"DAV: invert"`
+		Grant  *struct {
+			Privileges []daslNode `xml:"DAV: privilege"`
+		} `xml:"DAV: grant"`
+		Deny *struct {
+			Privileges []daslNode `xml:"DAV: privilege"`
+		} `xml:"DAV: deny"`
+		Protected *struct{} `xml:"DAV: protected"`
+		Inherited *struct{} `xml:"DAV: inherited"`
+	} `xml:"DAV: ace"`
+}
+
+// aclCondition ACL请求不满足前置条件时的错误，Condition为D:error中的元素名
+type aclCondition struct {
+	Condition string
+	err       error
+}
+
+func (e *aclCondition) Error() string { return e.err.Error() }
+
+func (e *aclCondition) Unwrap() error { return e.err }
+
+// parseACLPrivileges 解析grant/deny中的权限名
+func parseACLPrivileges(nodes []daslNode) ([]string, error) {
+	var privileges []string
+	for _, node := range nodes {
+		if len(node.Children) != 1 || node.Children[0].XMLName.Space != "DAV:" {
+			return nil, &aclCondition{"D:not-supported-privilege", ErrUnsupportedPrivilege}
+		}
+		name := node.Children[0].XMLName.Local
+		if _, ok := privilegeDescriptions[name]; !ok {
+			return nil, &aclCondition{"D:not-supported-privilege", fmt.Errorf("%w: %s", ErrUnsupportedPrivilege, name)}
+		}
+		privileges = append(privileges, name)
+	}
+	return privileges, nil
+}
+
+// toACEs 校验请求中的ACE并转换为保存格式，hrefPrefix用于把D:href主体还原为主体URL
+func (r *aclRequest) toACEs(hrefPrefix string) ([]ACE, error) {
+	if len(r.ACEs) > maxACEs {
+		return nil, &aclCondition{"D:limited-number-of-aces", fmt.Errorf("more than %d ACEs", maxACEs)}
+	}
+
+	aces := make([]ACE, 0, len(r.ACEs))
+	for _, requested := range r.ACEs {
+		switch {
+		case requested.Protected != nil:
+			return nil, &aclCondition{"D:no-protected-ace-conflict", errors.New("protected ACEs cannot be set")}
+		case requested.Inherited != nil:
+			return nil, &aclCondition{"D:no-inherited-ace-conflict", errors.New("inherited ACEs cannot be set")}
+		case requested.Invert != nil:
+			return nil, &aclCondition{"D:no-invert", errors.New("inverted principals are not supported")}
+		case requested.Principal == nil || len(requested.Principal.Nodes) != 1:
+			return nil, &aclCondition{"D:recognized-principal", ErrUnrecognizedPrincipal}
+		case (requested.Grant == nil) == (requested.Deny == nil):
+			return nil, &aclCondition{"D:no-ace-conflict", errors.New("an ACE must either grant or deny")}
+		}
+
+		var ace ACE
+		principal := requested.Principal.Nodes[0]
+		if principal.XMLName.Space != "DAV:" {
+			return nil, &aclCondition{"D:recognized-principal", ErrUnrecognizedPrincipal}
+		}
+		switch principal.XMLName.Local {
+		case PrincipalAll, PrincipalAuthenticated, PrincipalUnauthenticated, PrincipalSelf:
+			ace.Principal = principal.XMLName.Local
+		case "property":
+			if len(principal.Children) != 1 || principal.Children[0].XMLName != (xml.Name{Space: "DAV:", Local: "owner"}) {
+				return nil, &aclCondition{"D:recognized-principal", ErrUnrecognizedPrincipal}
+			}
+			ace.Principal = PrincipalOwner
+		case "href":
+			p, err := scopeHrefPath(strings.TrimSpace(principal.Content), hrefPrefix)
+			if err != nil || normalizeCollectionPath(p) != principalHref {
+				return nil, &aclCondition{"D:recognized-principal", fmt.Errorf("%w: %s", ErrUnrecognizedPrincipal, principal.Content)}
+			}
+			ace.Principal, ace.Href = PrincipalHref, principalHref
+		default:
+			return nil, &aclCondition{"D:recognized-principal", ErrUnrecognizedPrincipal}
+		}
+
+		var err error
+		if requested.Grant != nil {
+			ace.Grant, err = parseACLPrivileges(requested.Grant.Privileges)
+		} else {
+			ace.Deny, err = parseACLPrivileges(requested.Deny.Privileges)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(ace.Grant) == 0 && len(ace.Deny) == 0 {
+			return nil, &aclCondition{"D:no-ace-conflict", errors.New("an ACE must list at least one privilege")}
+		}
+		aces = append(aces, ace)
+	}
+	return aces, nil
+}
+
+// HandleACL 处理ACL方法：用请求中的ACE替换资源自身的ACL，继承的和受保护的ACE不受影响
+func (h *Handler) HandleACL(c *gin.Context) {
+	userID := c.GetString("userID")
+	uid, _ := uuid.Parse(userID)
+
+	requestPath := c.Param("path")
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	resourcePath := normalizeCollectionPath(requestPath)
+
+	if resourcePath != "/" && !h.resourceExists(c.Request.Context(), uid, resourcePath) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if h.CheckPrivilege(c, resourcePath, PrivilegeWriteACL) {
+		return // CheckPrivilege已经发送了403错误
+	}
+	if h.CheckReadOnly(c, resourcePath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+	var req aclRequest
+	if err := davxml.Unmarshal(body, &req); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	hrefPrefix := routePrefix(c)
+	aces, err := req.toACEs(hrefPrefix)
+	if err != nil {
+		var condition *aclCondition
+		if errors.As(err, &condition) {
+			h.sendDAVError(c, http.StatusForbidden, condition.Condition)
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.propertyService.SetACL(c.Request.Context(), userID, resourcePath, aces); err != nil {
+		log.Printf("ACL %s failed: %v", resourcePath, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
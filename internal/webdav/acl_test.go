@@ -0,0 +1,144 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestACLEvaluation(t *testing.T) {
+	acls := aclSet{
+		"/projects": {
+			{Principal: PrincipalAll, Deny: []string{PrivilegeWriteContent}},
+		},
+		"/projects/drafts": {
+			{Principal: PrincipalOwner, Grant: []string{PrivilegeWrite}},
+		},
+		"/public": {
+			{Principal: PrincipalUnauthenticated, Deny: []string{PrivilegeRead}},
+		},
+	}
+	anonymous := aclSubject{}
+
+	tests := []struct {
+		name      string
+		subject   aclSubject
+		path      string
+		privilege string
+		want      bool
+	}{
+		{"no ACL grants the owner everything", ownerSubject, "/other/file.txt", PrivilegeAll, true},
+		{"inherited deny", ownerSubject, "/projects/report.txt", PrivilegeWriteContent, false},
+		{"deny of a leaf denies the aggregate", ownerSubject, "/projects/report.txt", PrivilegeWrite, false},
+		{"other leaves still granted", ownerSubject, "/projects/report.txt", PrivilegeBind, true},
+		{"nearer grant wins over inherited deny", ownerSubject, "/projects/drafts/a.txt", PrivilegeWriteContent, true},
+		{"owner keeps write-acl", ownerSubject, "/projects", PrivilegeWriteACL, true},
+		{"anonymous has no default grant", anonymous, "/other/file.txt", PrivilegeRead, false},
+		{"unauthenticated deny does not apply to the owner", ownerSubject, "/public/a.txt", PrivilegeRead, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acls.allowed(tt.subject, tt.path, tt.privilege); got != tt.want {
+				t.Errorf("allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !acls.denied(anonymous, "/public/a.txt", PrivilegeRead) {
+		t.Error("anonymous read below /public should be denied explicitly")
+	}
+	if acls.denied(anonymous, "/other/file.txt", PrivilegeRead) {
+		t.Error("anonymous read without ACEs should not count as an explicit deny")
+	}
+}
+
+func TestACLPrivileges(t *testing.T) {
+	acls := aclSet{"/docs": {{Principal: PrincipalAuthenticated, Deny: []string{PrivilegeUnbind, PrivilegeWriteProperties}}}}
+
+	got := acls.privileges(ownerSubject, "/docs/a.txt")
+	want := []string{PrivilegeRead, PrivilegeWriteContent, PrivilegeBind, PrivilegeUnlock, PrivilegeReadACL, PrivilegeReadCurrentUserPrivilegeSet, PrivilegeWriteACL}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("privileges = %v, want %v", got, want)
+	}
+}
+
+func TestACLEntriesMarshal(t *testing.T) {
+	acls := aclSet{
+		"/":     {{Principal: PrincipalAll, Grant: []string{PrivilegeRead}}},
+		"/docs": {{Principal: PrincipalHref, Href: principalHref, Deny: []string{PrivilegeWrite}}},
+	}
+
+	data, err := xml.Marshal(acls.davACL("/docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		`<D:ace><D:principal><D:href>/</D:href></D:principal><D:deny><D:privilege><D:write></D:write></D:privilege></D:deny></D:ace>`,
+		`<D:ace><D:principal><D:all></D:all></D:principal><D:grant><D:privilege><D:read></D:read></D:privilege></D:grant><D:inherited><D:href>/</D:href></D:inherited></D:ace>`,
+		`<D:principal><D:property><D:owner></D:owner></D:property></D:principal><D:grant><D:privilege><D:all></D:all></D:privilege></D:grant><D:protected></D:protected>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("acl missing %s\n%s", want, out)
+		}
+	}
+}
+
+func TestACLRequest(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:acl xmlns:D="DAV:">
+  <D:ace>
+    <D:principal><D:href>/webdav/</D:href></D:principal>
+    <D:deny><D:privilege><D:write-content/></D:privilege><D:privilege><D:unbind/></D:privilege></D:deny>
+  </D:ace>
+  <D:ace>
+    <D:principal><D:property><D:owner/></D:property></D:principal>
+    <D:grant><D:privilege><D:all/></D:privilege></D:grant>
+  </D:ace>
+</D:acl>`
+
+	var req aclRequest
+	if err := xml.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	aces, err := req.toACEs("/webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ACE{
+		{Principal: PrincipalHref, Href: principalHref, Deny: []string{PrivilegeWriteContent, PrivilegeUnbind}},
+		{Principal: PrincipalOwner, Grant: []string{PrivilegeAll}},
+	}
+	if !reflect.DeepEqual(aces, want) {
+		t.Errorf("aces = %+v, want %+v", aces, want)
+	}
+}
+
+func TestACLRequestRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		ace       string
+		condition string
+	}{
+		{"unknown privilege", `<D:principal><D:all/></D:principal><D:grant><D:privilege><D:delete/></D:privilege></D:grant>`, "D:not-supported-privilege"},
+		{"other user", `<D:principal><D:href>/principals/bob</D:href></D:principal><D:grant><D:privilege><D:read/></D:privilege></D:grant>`, "D:recognized-principal"},
+		{"invert", `<D:invert><D:principal><D:all/></D:principal></D:invert><D:grant><D:privilege><D:read/></D:privilege></D:grant>`, "D:no-invert"},
+		{"protected", `<D:principal><D:all/></D:principal><D:grant><D:privilege><D:read/></D:privilege></D:grant><D:protected/>`, "D:no-protected-ace-conflict"},
+		{"grant and deny", `<D:principal><D:all/></D:principal><D:grant><D:privilege><D:read/></D:privilege></D:grant><D:deny><D:privilege><D:write/></D:privilege></D:deny>`, "D:no-ace-conflict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req aclRequest
+			if err := xml.Unmarshal([]byte(`<D:acl xmlns:D="DAV:"><D:ace>`+tt.ace+`</D:ace></D:acl>`), &req); err != nil {
+				t.Fatal(err)
+			}
+			_, err := req.toACEs("/webdav")
+			var condition *aclCondition
+			if !errors.As(err, &condition) || condition.Condition != tt.condition {
+				t.Errorf("err = %v, want condition %s", err, tt.condition)
+			}
+		})
+	}
+}
@@ -0,0 +1,812 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// NamespaceCalDAV CalDAV命名空间（RFC 4791）
+const NamespaceCalDAV = webdavtypes.NamespaceCalDAV
+
+const (
+	// CalendarPropertyName 日历集合标记的活属性名，值为集合支持的组件（逗号分隔），位于NamespaceMetadata命名空间
+	CalendarPropertyName = "calendar"
+	// CalendarUIDPropertyName 日历对象索引：UID
+	CalendarUIDPropertyName = "calendar-uid"
+	// CalendarComponentPropertyName 日历对象索引：组件类型
+	CalendarComponentPropertyName = "calendar-component"
+	// CalendarStartPropertyName 日历对象索引：起始时间（RFC 3339，UTC），为空表示不限
+	CalendarStartPropertyName = "calendar-start"
+	// CalendarEndPropertyName 日历对象索引：结束时间（RFC 3339，UTC），为空表示不限
+	CalendarEndPropertyName = "calendar-end"
+
+	// maxCalendarObjectSize 单个日历对象的最大字节数（CALDAV:max-resource-size）
+	maxCalendarObjectSize = 1 << 20
+)
+
+// defaultCalendarComponents MKCALENDAR未指定supported-calendar-component-set时支持的组件
+var defaultCalendarComponents = []string{ComponentVEvent, ComponentVTodo}
+
+var (
+	// ErrInvalidCalendarFilter calendar-query的过滤条件格式错误（CALDAV:valid-filter）
+	ErrInvalidCalendarFilter = errors.New("invalid calendar filter")
+	// ErrUnsupportedCalendarFilter 过滤条件使用了不支持的prop-filter或子组件过滤（CALDAV:supported-filter）
+	ErrUnsupportedCalendarFilter = errors.New("unsupported calendar filter")
+)
+
+// isCalendarProperty 日历标记和对象索引由服务端维护，不能通过PROPPATCH修改
+func isCalendarProperty(namespace, name string) bool {
+	if namespace != NamespaceMetadata {
+		return false
+	}
+	switch name {
+	case CalendarPropertyName, CalendarUIDPropertyName, CalendarComponentPropertyName,
+		CalendarStartPropertyName, CalendarEndPropertyName:
+		return true
+	}
+	return false
+}
+
+// MarkCalendar 将目录标记为支持components的日历集合
+func (s *PropertyService) MarkCalendar(ctx context.Context, userID, collectionPath string, components []string) error {
+	return s.setMetadataProperties(ctx, userID, normalizeCollectionPath(collectionPath), map[string]string{
+		CalendarPropertyName: strings.Join(components, ","),
+	})
+}
+
+// CalendarComponents 返回日历集合支持的组件，目录不是日历集合时返回nil
+func (s *PropertyService) CalendarComponents(ctx context.Context, userID, collectionPath string) ([]string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	prop, err := s.GetProperty(ctx, userID, normalizeCollectionPath(collectionPath), NamespaceMetadata, CalendarPropertyName)
+	if err != nil || prop == nil {
+		return nil, err
+	}
+	return strings.Split(prop.Value, ","), nil
+}
+
+// SetCalendarIndex 记录日历对象的索引信息
+func (s *PropertyService) SetCalendarIndex(ctx context.Context, userID, objectPath string, obj *CalendarObject) error {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return s.setMetadataProperties(ctx, userID, objectPath, map[string]string{
+		CalendarUIDPropertyName:       obj.UID,
+		CalendarComponentPropertyName: obj.Component,
+		CalendarStartPropertyName:     formatTime(obj.Start),
+		CalendarEndPropertyName:       formatTime(obj.End),
+	})
+}
+
+// CalendarIndex 读取日历对象的索引信息，尚未建立索引时返回nil
+func (s *PropertyService) CalendarIndex(ctx context.Context, userID, objectPath string) (*CalendarObject, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	props, err := s.ListResourceProperties(ctx, userID, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	var obj CalendarObject
+	for _, prop := range props {
+		if prop.Namespace != NamespaceMetadata {
+			continue
+		}
+		switch prop.Name {
+		case CalendarUIDPropertyName:
+			obj.UID = prop.Value
+		case CalendarComponentPropertyName:
+			obj.Component = prop.Value
+		case CalendarStartPropertyName:
+			obj.Start, err = time.Parse(time.RFC3339, prop.Value)
+		case CalendarEndPropertyName:
+			obj.End, err = time.Parse(time.RFC3339, prop.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("日历索引格式错误: %v", err)
+		}
+	}
+	if obj.UID == "" {
+		return nil, nil
+	}
+	return &obj, nil
+}
+
+// CalendarUIDOwner 返回日历集合中使用该UID的对象路径，不存在时返回空字符串
+func (s *PropertyService) CalendarUIDOwner(ctx context.Context, userID, collectionPath, uid string) (string, error) {
+	return s.collectionUIDOwner(ctx, userID, collectionPath, CalendarUIDPropertyName, uid)
+}
+
+// collectionUIDOwner 返回集合的直接成员中索引属性name等于uid的对象路径，不存在时返回空字符串
+func (s *PropertyService) collectionUIDOwner(ctx context.Context, userID, collectionPath, name, uid string) (string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return "", err
+	}
+
+	prefix := normalizeCollectionPath(collectionPath)
+	if prefix != "/" {
+		prefix += "/"
+	}
+	builder := NewSelectBuilder("properties", "path").
+		Where("user_id = ? AND namespace = ? AND name = ? AND value = ? AND path LIKE ? ESCAPE '\\'", userID, NamespaceMetadata, name, uid, escapeLikePattern(prefix)+"%")
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return "", fmt.Errorf("查询UID失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var objectPath string
+		if err := rows.Scan(&objectPath); err != nil {
+			return "", err
+		}
+		// 只有集合的直接成员是日历或通讯录对象
+		if path.Dir(objectPath) == normalizeCollectionPath(collectionPath) {
+			return objectPath, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// isCalendarCollection 判断目录是否为日历集合
+func (h *Handler) isCalendarCollection(userID, collectionPath string) bool {
+	components, err := h.propertyService.CalendarComponents(context.Background(), userID, collectionPath)
+	return err == nil && components != nil
+}
+
+// hasCollectionAncestor 判断路径的某个上级目录是否满足isKind，日历和通讯录集合都不能嵌套
+func (h *Handler) hasCollectionAncestor(userID, resourcePath string, isKind func(userID, collectionPath string) bool) bool {
+	for current := path.Dir(normalizeCollectionPath(resourcePath)); ; current = path.Dir(current) {
+		if isKind(userID, current) {
+			return true
+		}
+		if current == "/" {
+			return false
+		}
+	}
+}
+
+// mkcalendarRequest MKCALENDAR请求体（RFC 4791 5.3.1），只处理日历描述和支持的组件
+type mkcalendarRequest struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav mkcalendar"`
+	Set     struct {
+		Prop struct {
+			Description  string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+			ComponentSet *struct {
+				Comps []struct {
+					Name string `xml:"name,attr"`
+				} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+			} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+}
+
+// HandleMkcalendar 处理MKCALENDAR（RFC 4791 5.3.1）：创建目录并标记为日历集合
+func (h *Handler) HandleMkcalendar(c *gin.Context) {
+	userID := c.GetString("userID")
+	uid, _ := uuid.Parse(userID)
+
+	requestPath := c.Param("path")
+
+	// 检查文件名规则
+	if h.CheckFilename(c, requestPath) {
+		return // CheckFilename已经发送了400或403错误
+	}
+
+	// 检查访问控制权限：创建需要上级目录的bind
+	if h.CheckParentPrivilege(c, requestPath, PrivilegeBind) {
+		return // CheckParentPrivilege已经发送了403错误
+	}
+
+	// 检查只读目录
+	if h.CheckReadOnly(c, requestPath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
+	// 检查父目录锁定
+	if locked, _ := h.CheckParentLocks(c, requestPath); locked {
+		return // CheckParentLocks已经发送了423错误
+	}
+
+	components := defaultCalendarComponents
+	var description string
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+	if body != nil {
+		var req mkcalendarRequest
+		if err := davxml.Unmarshal(body, &req); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		description = req.Set.Prop.Description
+		if set := req.Set.Prop.ComponentSet; set != nil && len(set.Comps) > 0 {
+			components = nil
+			for _, comp := range set.Comps {
+				name := strings.ToUpper(comp.Name)
+				if !calendarComponents[name] {
+					h.sendDAVError(c, http.StatusForbidden, "C:supported-calendar-component")
+					return
+				}
+				components = append(components, name)
+			}
+		}
+	}
+
+	ctx := c.Request.Context()
+	collectionPath := path.Clean("/" + requestPath)
+
+	if h.resourceExists(ctx, uid, collectionPath) {
+		h.sendDAVError(c, http.StatusForbidden, "D:resource-must-be-null")
+		return
+	}
+	if h.hasCollectionAncestor(userID, collectionPath, h.isCalendarCollection) {
+		h.sendDAVError(c, http.StatusForbidden, "C:calendar-collection-location-ok")
+		return
+	}
+
+	// 父集合不存在时返回409，除非请求X-Create-Parents: T
+	parents, ok := h.missingParents(ctx, uid, collectionPath)
+	if !ok || (len(parents) > 0 && !createParentsRequested(c)) {
+		c.Status(http.StatusConflict)
+		return
+	}
+	for _, parent := range parents {
+		if err := h.storage.CreateFolder(ctx, uid, parent); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.storage.CreateFolder(ctx, uid, collectionPath); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if err := h.markCalendar(ctx, userID, collectionPath, components, description); err != nil {
+		log.Printf("MKCALENDAR %s failed to mark collection: %v", collectionPath, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+// markCalendar 将新建的目录标记为日历集合，并保存可选的日历描述
+func (h *Handler) markCalendar(ctx context.Context, userID, collectionPath string, components []string, description string) error {
+	if err := h.propertyService.MarkCalendar(ctx, userID, collectionPath, components); err != nil {
+		return err
+	}
+	if description == "" {
+		return nil
+	}
+	return h.propertyService.setProperty(ctx, &DatabaseProperty{
+		UserID:    userID,
+		Path:      collectionPath,
+		Namespace: NamespaceCalDAV,
+		Name:      "calendar-description",
+		Value:     description,
+	})
+}
+
+// putCalendarObject 写入日历集合中的对象：校验iCalendar内容、UID唯一性和支持的组件后再存储，并建立索引
+func (h *Handler) putCalendarObject(c *gin.Context, uid uuid.UUID, requestPath string) {
+	userID := uid.String()
+	ctx := c.Request.Context()
+	objectPath := path.Clean("/" + requestPath)
+	collectionPath := path.Dir(objectPath)
+
+	contentType := c.GetHeader("Content-Type")
+	if !hasMediaType(contentType, "text/calendar") {
+		h.sendDAVError(c, http.StatusForbidden, "C:supported-calendar-data")
+		return
+	}
+	data, ok := h.readDAVObjectBody(c, maxCalendarObjectSize, "C:max-resource-size")
+	if !ok {
+		return
+	}
+
+	obj, err := ParseCalendarObject(data)
+	switch {
+	case errors.Is(err, ErrInvalidCalendarObject):
+		h.sendDAVError(c, http.StatusForbidden, "C:valid-calendar-object-resource")
+		return
+	case err != nil:
+		h.sendDAVError(c, http.StatusForbidden, "C:valid-calendar-data")
+		return
+	}
+
+	components, err := h.propertyService.CalendarComponents(ctx, userID, collectionPath)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	supported := false
+	for _, comp := range components {
+		supported = supported || comp == obj.Component
+	}
+	if !supported {
+		h.sendDAVError(c, http.StatusForbidden, "C:supported-calendar-component")
+		return
+	}
+
+	// 同一日历中UID必须唯一（覆盖写入同一对象除外）
+	owner, err := h.propertyService.CalendarUIDOwner(ctx, userID, collectionPath, obj.UID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if owner != "" && owner != objectPath {
+		h.sendDAVError(c, http.StatusForbidden, "C:no-uid-conflict")
+		return
+	}
+
+	overwrite, ok := h.storeDAVObject(c, uid, objectPath, data, contentType)
+	if !ok {
+		return
+	}
+	if err := h.propertyService.SetCalendarIndex(ctx, userID, objectPath, obj); err != nil {
+		// 查询时会重新解析并补建索引
+		log.Printf("Warning: failed to index calendar object %s: %v", objectPath, err)
+	}
+
+	if overwrite {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// hasMediaType 判断Content-Type（忽略参数）是否为mediaTypes之一
+func hasMediaType(contentType string, mediaTypes ...string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	for _, t := range mediaTypes {
+		if strings.EqualFold(strings.TrimSpace(mediaType), t) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDAVObjectBody 读取日历或通讯录对象的请求体，超过maxSize时发送403及sizeCondition
+func (h *Handler) readDAVObjectBody(c *gin.Context, maxSize int64, sizeCondition string) ([]byte, bool) {
+	if c.Request.ContentLength > maxSize {
+		h.sendDAVError(c, http.StatusForbidden, sizeCondition)
+		return nil, false
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSize+1))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return nil, false
+	}
+	if int64(len(data)) > maxSize {
+		h.sendDAVError(c, http.StatusForbidden, sizeCondition)
+		return nil, false
+	}
+	return data, true
+}
+
+// storeDAVObject 存储校验过的日历或通讯录对象并更新用量和校验值，返回是否覆盖了已有对象。
+// ok为false时已发送错误响应；成功时由调用方建立索引并发送状态码
+func (h *Handler) storeDAVObject(c *gin.Context, uid uuid.UUID, objectPath string, data []byte, contentType string) (overwrite bool, ok bool) {
+	ctx := c.Request.Context()
+
+	var previousSize int64
+	info, err := h.storage.StatObject(ctx, uid, objectPath)
+	overwrite = err == nil
+	if overwrite {
+		previousSize = info.Size
+	}
+	if quota := h.remainingQuota(ctx, uid, previousSize); quota >= 0 && int64(len(data)) > quota {
+		sendQuotaExceeded(c)
+		return overwrite, false
+	}
+
+	checksum, err := newChecksumReader(c, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return overwrite, false
+	}
+	if err := h.storage.ReplaceObject(ctx, uid, objectPath, checksum, int64(len(data)), contentType, info); err != nil {
+		sendUploadError(c, err)
+		return overwrite, false
+	}
+	h.auth.UpdateStorageUsed(ctx, uid, checksum.n-previousSize)
+
+	md5Hex, sha256Hex := checksum.sums()
+	if err := h.propertyService.SetChecksums(ctx, uid.String(), objectPath, md5Hex, sha256Hex); err != nil {
+		log.Printf("Warning: failed to record checksum for %s: %v", objectPath, err)
+	}
+	return overwrite, true
+}
+
+// calendarIndex 读取日历对象的索引，没有索引（如索引写入失败）时解析对象内容并补建
+func (h *Handler) calendarIndex(ctx context.Context, uid uuid.UUID, objectPath string) (*CalendarObject, error) {
+	userID := uid.String()
+	obj, err := h.propertyService.CalendarIndex(ctx, userID, objectPath)
+	if err != nil || obj != nil {
+		return obj, err
+	}
+
+	data, err := h.readDAVObject(ctx, uid, objectPath, maxCalendarObjectSize)
+	if err != nil {
+		return nil, err
+	}
+	if obj, err = ParseCalendarObject(data); err != nil {
+		return nil, err
+	}
+	if err := h.propertyService.SetCalendarIndex(ctx, userID, objectPath, obj); err != nil {
+		log.Printf("Warning: failed to index calendar object %s: %v", objectPath, err)
+	}
+	return obj, nil
+}
+
+// readDAVObject 读取日历或通讯录对象的内容，最多maxSize字节
+func (h *Handler) readDAVObject(ctx context.Context, uid uuid.UUID, objectPath string, maxSize int64) ([]byte, error) {
+	object, err := h.storage.GetObject(ctx, uid, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(io.LimitReader(object, maxSize))
+}
+
+// reportHandler 处理一种REPORT，body为完整的请求体
+type reportHandler func(h *Handler, c *gin.Context, uid uuid.UUID, body []byte)
+
+// reportHandlers 按请求体根元素分派REPORT
+var reportHandlers = map[xml.Name]reportHandler{
+	{Space: NamespaceCalDAV, Local: "calendar-query"}:             (*Handler).reportCalendarQuery,
+	{Space: NamespaceCalDAV, Local: "calendar-multiget"}:          (*Handler).reportCalendarMultiget,
+	{Space: NamespaceCardDAV, Local: "addressbook-query"}:         (*Handler).reportAddressbookQuery,
+	{Space: NamespaceCardDAV, Local: "addressbook-multiget"}:      (*Handler).reportAddressbookMultiget,
+	{Space: webdavtypes.NamespaceOwnCloud, Local: "filter-files"}: (*Handler).reportFilterFiles,
+}
+
+// HandleReport 处理REPORT（RFC 3253 3.6），按请求体的根元素分派，不支持的报告返回403 DAV:supported-report
+func (h *Handler) HandleReport(c *gin.Context) {
+	uid, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	// 检查访问控制权限，查询结果中没有读取权限的对象不返回
+	if h.CheckPrivilege(c, c.Param("path"), PrivilegeRead) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+
+	name, err := reportName(body)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	handler, ok := reportHandlers[name]
+	if !ok {
+		h.sendDAVError(c, http.StatusForbidden, "D:supported-report")
+		return
+	}
+	handler(h, c, uid, body)
+}
+
+// reportName 返回REPORT请求体根元素的名称
+func reportName(body []byte) (xml.Name, error) {
+	decoder := davxml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// reportProp REPORT请求中的DAV:prop，列出需要返回的属性
+type reportProp struct {
+	Names []daslNode `xml:",any"`
+}
+
+// wants 判断是否请求了某个属性；未指定DAV:prop时只返回getetag
+func (p *reportProp) wants(space, local string) bool {
+	if p == nil {
+		return space == "DAV:" && local == "getetag"
+	}
+	for _, name := range p.Names {
+		if name.XMLName.Space == space && name.XMLName.Local == local {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarTimeRange CALDAV:time-range，start/end为UTC时间（如20060104T000000Z），省略的一侧不限
+type calendarTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+
+	start, end time.Time
+}
+
+// calendarCompFilter CALDAV:comp-filter。顶层必须是VCALENDAR，其下按组件类型和时间范围过滤
+type calendarCompFilter struct {
+	Name         string               `xml:"name,attr"`
+	IsNotDefined *struct{}            `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *calendarTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters  []calendarCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters  []daslNode           `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+// calendarQueryRequest CALDAV:calendar-query请求（RFC 4791 7.8）
+type calendarQueryRequest struct {
+	XMLName xml.Name    `xml:"urn:ietf:params:xml:ns:caldav calendar-query"`
+	Prop    *reportProp `xml:"DAV: prop"`
+	Filter  struct {
+		CompFilter *calendarCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// calendarMultigetRequest CALDAV:calendar-multiget请求（RFC 4791 7.9）
+type calendarMultigetRequest struct {
+	XMLName xml.Name    `xml:"urn:ietf:params:xml:ns:caldav calendar-multiget"`
+	Prop    *reportProp `xml:"DAV: prop"`
+	Hrefs   []string    `xml:"DAV: href"`
+}
+
+// validate 检查过滤条件并解析时间范围。只支持VCALENDAR下一层组件的is-not-defined和time-range，
+// prop-filter和子组件（如VALARM）过滤返回ErrUnsupportedCalendarFilter
+func (f *calendarCompFilter) validate() error {
+	if !strings.EqualFold(f.Name, "VCALENDAR") {
+		return fmt.Errorf("%w: top-level comp-filter must be VCALENDAR", ErrInvalidCalendarFilter)
+	}
+	if f.IsNotDefined != nil || f.TimeRange != nil {
+		return fmt.Errorf("%w: VCALENDAR cannot be filtered by existence or time range", ErrInvalidCalendarFilter)
+	}
+	if len(f.PropFilters) > 0 {
+		return fmt.Errorf("%w: prop-filter", ErrUnsupportedCalendarFilter)
+	}
+
+	for i := range f.CompFilters {
+		comp := &f.CompFilters[i]
+		comp.Name = strings.ToUpper(comp.Name)
+		if !calendarComponents[comp.Name] {
+			return fmt.Errorf("%w: component %q", ErrUnsupportedCalendarFilter, comp.Name)
+		}
+		if len(comp.CompFilters) > 0 || len(comp.PropFilters) > 0 {
+			return fmt.Errorf("%w: nested filters in %s", ErrUnsupportedCalendarFilter, comp.Name)
+		}
+		if comp.IsNotDefined != nil && comp.TimeRange != nil {
+			return fmt.Errorf("%w: is-not-defined with time-range", ErrInvalidCalendarFilter)
+		}
+		if tr := comp.TimeRange; tr != nil {
+			if tr.Start == "" && tr.End == "" {
+				return fmt.Errorf("%w: empty time-range", ErrInvalidCalendarFilter)
+			}
+			for _, bound := range []struct {
+				value string
+				t     *time.Time
+			}{{tr.Start, &tr.start}, {tr.End, &tr.end}} {
+				if bound.value == "" {
+					continue
+				}
+				t, err := time.Parse("20060102T150405Z", bound.value)
+				if err != nil {
+					return fmt.Errorf("%w: time-range must use UTC date-time values", ErrInvalidCalendarFilter)
+				}
+				*bound.t = t
+			}
+			if !tr.start.IsZero() && !tr.end.IsZero() && !tr.end.After(tr.start) {
+				return fmt.Errorf("%w: time-range end must be after start", ErrInvalidCalendarFilter)
+			}
+		}
+	}
+	return nil
+}
+
+// matches 判断日历对象是否满足过滤条件，同一层的多个comp-filter需全部满足
+func (f *calendarCompFilter) matches(obj *CalendarObject) bool {
+	for _, comp := range f.CompFilters {
+		if comp.IsNotDefined != nil {
+			if obj.Component == comp.Name {
+				return false
+			}
+			continue
+		}
+		if obj.Component != comp.Name {
+			return false
+		}
+		if tr := comp.TimeRange; tr != nil && !obj.Overlaps(tr.start, tr.end) {
+			return false
+		}
+	}
+	return true
+}
+
+// reportCalendarQuery 处理calendar-query：在日历集合的对象（或单个日历对象）中按索引过滤
+func (h *Handler) reportCalendarQuery(c *gin.Context, uid uuid.UUID, body []byte) {
+	var req calendarQueryRequest
+	if err := davxml.Unmarshal(body, &req); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	filter := req.Filter.CompFilter
+	if filter == nil {
+		h.sendDAVError(c, http.StatusForbidden, "C:valid-filter")
+		return
+	}
+	if err := filter.validate(); err != nil {
+		if errors.Is(err, ErrUnsupportedCalendarFilter) {
+			h.sendDAVError(c, http.StatusForbidden, "C:supported-filter")
+		} else {
+			h.sendDAVError(c, http.StatusForbidden, "C:valid-filter")
+		}
+		return
+	}
+
+	userID := uid.String()
+	ctx := c.Request.Context()
+	requestPath := path.Clean("/" + c.Param("path"))
+
+	// 请求目标是日历集合时查询其成员（Depth: 0时只有集合本身，没有结果），是日历对象时只检查该对象
+	var members []minio.ObjectInfo
+	var objectPaths []string
+	if info, err := h.storage.StatObject(ctx, uid, requestPath); err == nil {
+		if !h.isCalendarCollection(userID, path.Dir(requestPath)) {
+			h.sendDAVError(c, http.StatusForbidden, "D:supported-report")
+			return
+		}
+		members, objectPaths = append(members, *info), append(objectPaths, requestPath)
+	} else if !h.isCalendarCollection(userID, requestPath) {
+		h.sendDAVError(c, http.StatusForbidden, "D:supported-report")
+		return
+	} else if c.GetHeader("Depth") != "0" {
+		err := h.storage.WalkObjects(ctx, uid, requestPath, false, func(obj minio.ObjectInfo) error {
+			if !strings.HasSuffix(obj.Key, "/") {
+				members, objectPaths = append(members, obj), append(objectPaths, "/"+obj.Key)
+			}
+			return nil
+		})
+		if err != nil && !storage.IsNotFound(err) {
+			log.Printf("REPORT calendar-query listing %s failed: %v", requestPath, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	for i, info := range members {
+		if !h.canRead(c, objectPaths[i]) {
+			continue
+		}
+		obj, err := h.calendarIndex(ctx, uid, objectPaths[i])
+		if err != nil {
+			log.Printf("Warning: skipping calendar object %s: %v", objectPaths[i], err)
+			continue
+		}
+		if !filter.matches(obj) {
+			continue
+		}
+		if err := stream.Write(h.calendarObjectResponse(ctx, uid, objectPaths[i], objectPaths[i], info, req.Prop)); err != nil {
+			log.Printf("REPORT calendar-query response for %s failed: %v", requestPath, err)
+			return
+		}
+	}
+}
+
+// reportCalendarMultiget 处理calendar-multiget：按href逐个返回日历对象，不存在的返回404
+func (h *Handler) reportCalendarMultiget(c *gin.Context, uid uuid.UUID, body []byte) {
+	var req calendarMultigetRequest
+	if err := davxml.Unmarshal(body, &req); err != nil || len(req.Hrefs) == 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	h.multiget(c, uid, req.Hrefs, h.isCalendarCollection, func(href, objectPath string, info minio.ObjectInfo) Response {
+		return h.calendarObjectResponse(c.Request.Context(), uid, href, objectPath, info, req.Prop)
+	})
+}
+
+// multiget 按href逐个返回集合成员：不存在的返回404，不在isCollection集合中的返回403，其余由respond生成
+func (h *Handler) multiget(c *gin.Context, uid uuid.UUID, hrefs []string, isCollection func(userID, collectionPath string) bool, respond func(href, objectPath string, info minio.ObjectInfo) Response) {
+	hrefPrefix := routePrefix(c)
+
+	objectPaths := make([]string, len(hrefs))
+	for i, href := range hrefs {
+		hrefs[i] = strings.TrimSpace(href)
+		p, err := scopeHrefPath(hrefs[i], hrefPrefix)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		objectPaths[i] = path.Clean(p)
+	}
+
+	userID := uid.String()
+	ctx := c.Request.Context()
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	for i, href := range hrefs {
+		var resp Response
+		info, err := h.storage.StatObject(ctx, uid, objectPaths[i])
+		switch {
+		case err != nil:
+			resp = Response{Href: href, Status: "HTTP/1.1 404 Not Found"}
+		case !isCollection(userID, path.Dir(objectPaths[i])) || !h.canRead(c, objectPaths[i]):
+			resp = Response{Href: href, Status: "HTTP/1.1 403 Forbidden"}
+		default:
+			resp = respond(href, objectPaths[i], *info)
+		}
+		if err := stream.Write(resp); err != nil {
+			log.Printf("REPORT multiget response failed: %v", err)
+			return
+		}
+	}
+}
+
+// calendarObjectResponse 生成日历对象的D:response，只包含请求的getetag、getcontenttype和calendar-data
+func (h *Handler) calendarObjectResponse(ctx context.Context, uid uuid.UUID, href, objectPath string, info minio.ObjectInfo, props *reportProp) Response {
+	var prop webdavtypes.ResponseProp
+	if props.wants("DAV:", "getetag") {
+		prop.GetETag = resourceETag(info)
+	}
+	if props.wants("DAV:", "getcontenttype") {
+		prop.GetContentType = info.ContentType
+	}
+	if props.wants(NamespaceCalDAV, "calendar-data") {
+		data, err := h.readDAVObject(ctx, uid, objectPath, maxCalendarObjectSize)
+		if err != nil {
+			log.Printf("Warning: failed to read calendar object %s: %v", objectPath, err)
+			return Response{Href: href, Status: "HTTP/1.1 500 Internal Server Error"}
+		}
+		prop.CalendarData = string(data)
+	}
+
+	return Response{
+		Href: href,
+		Propstat: []webdavtypes.Propstat{{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		}},
+	}
+}
@@ -0,0 +1,491 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// NamespaceCardDAV CardDAV命名空间（RFC 6352）
+const NamespaceCardDAV = webdavtypes.NamespaceCardDAV
+
+const (
+	// AddressbookPropertyName 通讯录集合标记的活属性名，值为支持的vCard版本（逗号分隔），位于NamespaceMetadata命名空间
+	AddressbookPropertyName = "addressbook"
+	// AddressbookUIDPropertyName 通讯录对象索引：UID，用于检查同一通讯录中UID唯一
+	AddressbookUIDPropertyName = "addressbook-uid"
+
+	// maxAddressObjectSize 单个通讯录对象的最大字节数（CARDDAV:max-resource-size）
+	maxAddressObjectSize = 1 << 20
+)
+
+var (
+	// ErrInvalidAddressFilter addressbook-query的过滤条件格式错误（CARDDAV:valid-filter）
+	ErrInvalidAddressFilter = errors.New("invalid address filter")
+	// ErrUnsupportedCollation text-match使用了不支持的排序规则（CARDDAV:supported-collation）
+	ErrUnsupportedCollation = errors.New("unsupported collation")
+)
+
+// isAddressbookProperty 通讯录标记和对象索引由服务端维护，不能通过PROPPATCH修改
+func isAddressbookProperty(namespace, name string) bool {
+	return namespace == NamespaceMetadata && (name == AddressbookPropertyName || name == AddressbookUIDPropertyName)
+}
+
+// MarkAddressbook 将目录标记为通讯录集合
+func (s *PropertyService) MarkAddressbook(ctx context.Context, userID, collectionPath string) error {
+	return s.setMetadataProperties(ctx, userID, normalizeCollectionPath(collectionPath), map[string]string{
+		AddressbookPropertyName: strings.Join(supportedVCardVersions, ","),
+	})
+}
+
+// IsAddressbook 判断目录是否为通讯录集合
+func (s *PropertyService) IsAddressbook(ctx context.Context, userID, collectionPath string) (bool, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return false, err
+	}
+
+	prop, err := s.GetProperty(ctx, userID, normalizeCollectionPath(collectionPath), NamespaceMetadata, AddressbookPropertyName)
+	return prop != nil, err
+}
+
+// SetAddressIndex 记录通讯录对象的UID
+func (s *PropertyService) SetAddressIndex(ctx context.Context, userID, objectPath string, obj *AddressObject) error {
+	return s.setMetadataProperties(ctx, userID, objectPath, map[string]string{
+		AddressbookUIDPropertyName: obj.UID,
+	})
+}
+
+// AddressbookUIDOwner 返回通讯录中使用该UID的对象路径，不存在时返回空字符串
+func (s *PropertyService) AddressbookUIDOwner(ctx context.Context, userID, collectionPath, uid string) (string, error) {
+	return s.collectionUIDOwner(ctx, userID, collectionPath, AddressbookUIDPropertyName, uid)
+}
+
+// isAddressbookCollection 判断目录是否为通讯录集合
+func (h *Handler) isAddressbookCollection(userID, collectionPath string) bool {
+	ok, err := h.propertyService.IsAddressbook(context.Background(), userID, collectionPath)
+	return err == nil && ok
+}
+
+// markAddressbook 将新建的目录标记为通讯录集合，并保存可选的通讯录描述
+func (h *Handler) markAddressbook(ctx context.Context, userID, collectionPath, description string) error {
+	if err := h.propertyService.MarkAddressbook(ctx, userID, collectionPath); err != nil {
+		return err
+	}
+	if description == "" {
+		return nil
+	}
+	return h.propertyService.setProperty(ctx, &DatabaseProperty{
+		UserID:    userID,
+		Path:      collectionPath,
+		Namespace: NamespaceCardDAV,
+		Name:      "addressbook-description",
+		Value:     description,
+	})
+}
+
+// supportedAddressData 通讯录集合的CARDDAV:supported-address-data
+func supportedAddressData() *webdavtypes.AddressDataTypes {
+	types := &webdavtypes.AddressDataTypes{}
+	for _, version := range supportedVCardVersions {
+		types.Types = append(types.Types, webdavtypes.AddressDataType{ContentType: "text/vcard", Version: version})
+	}
+	return types
+}
+
+// putAddressObject 写入通讯录中的对象：校验vCard内容和UID唯一性后再存储
+func (h *Handler) putAddressObject(c *gin.Context, uid uuid.UUID, requestPath string) {
+	userID := uid.String()
+	ctx := c.Request.Context()
+	objectPath := path.Clean("/" + requestPath)
+	collectionPath := path.Dir(objectPath)
+
+	contentType := c.GetHeader("Content-Type")
+	if !hasMediaType(contentType, "text/vcard", "text/x-vcard") {
+		h.sendDAVError(c, http.StatusForbidden, "CARD:supported-address-data")
+		return
+	}
+	data, ok := h.readDAVObjectBody(c, maxAddressObjectSize, "CARD:max-resource-size")
+	if !ok {
+		return
+	}
+
+	obj, err := ParseAddressObject(data)
+	switch {
+	case errors.Is(err, ErrUnsupportedAddressData):
+		h.sendDAVError(c, http.StatusForbidden, "CARD:supported-address-data")
+		return
+	case err != nil:
+		h.sendDAVError(c, http.StatusForbidden, "CARD:valid-address-data")
+		return
+	}
+
+	// 同一通讯录中UID必须唯一（覆盖写入同一对象除外）
+	owner, err := h.propertyService.AddressbookUIDOwner(ctx, userID, collectionPath, obj.UID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if owner != "" && owner != objectPath {
+		h.sendDAVError(c, http.StatusForbidden, "CARD:no-uid-conflict")
+		return
+	}
+
+	overwrite, ok := h.storeDAVObject(c, uid, objectPath, data, contentType)
+	if !ok {
+		return
+	}
+	if err := h.propertyService.SetAddressIndex(ctx, userID, objectPath, obj); err != nil {
+		log.Printf("Warning: failed to index address object %s: %v", objectPath, err)
+	}
+
+	if overwrite {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// addressTextMatch CARDDAV:text-match
+type addressTextMatch struct {
+	Collation       string `xml:"collation,attr"`
+	NegateCondition string `xml:"negate-condition,attr"`
+	MatchType       string `xml:"match-type,attr"`
+	Value           string `xml:",chardata"`
+}
+
+// addressParamFilter CARDDAV:param-filter，按属性参数（如TYPE）过滤
+type addressParamFilter struct {
+	Name         string            `xml:"name,attr"`
+	IsNotDefined *struct{}         `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatch    *addressTextMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+}
+
+// addressPropFilter CARDDAV:prop-filter，test决定text-match和param-filter是任一满足还是全部满足
+type addressPropFilter struct {
+	Name         string               `xml:"name,attr"`
+	Test         string               `xml:"test,attr"`
+	IsNotDefined *struct{}            `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []addressTextMatch   `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+	ParamFilters []addressParamFilter `xml:"urn:ietf:params:xml:ns:carddav param-filter"`
+}
+
+// addressFilter CARDDAV:filter，没有prop-filter时匹配全部对象
+type addressFilter struct {
+	Test        string              `xml:"test,attr"`
+	PropFilters []addressPropFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+// addressbookQueryRequest CARDDAV:addressbook-query请求（RFC 6352 8.6）
+type addressbookQueryRequest struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:carddav addressbook-query"`
+	Prop    *reportProp   `xml:"DAV: prop"`
+	Filter  addressFilter `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+}
+
+// addressbookMultigetRequest CARDDAV:addressbook-multiget请求（RFC 6352 8.7）
+type addressbookMultigetRequest struct {
+	XMLName xml.Name    `xml:"urn:ietf:params:xml:ns:carddav addressbook-multiget"`
+	Prop    *reportProp `xml:"DAV: prop"`
+	Hrefs   []string    `xml:"DAV: href"`
+}
+
+// validTest 检查filter和prop-filter的test属性（缺省为anyof）
+func validTest(test string) bool {
+	return test == "" || test == "anyof" || test == "allof"
+}
+
+// validate 检查text-match的排序规则、匹配方式和取反标记
+func (m *addressTextMatch) validate() error {
+	switch m.Collation {
+	case "", "i;unicode-casemap", "i;ascii-casemap", "i;octet":
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedCollation, m.Collation)
+	}
+	switch m.MatchType {
+	case "", "equals", "contains", "starts-with", "ends-with":
+	default:
+		return fmt.Errorf("%w: match-type %q", ErrInvalidAddressFilter, m.MatchType)
+	}
+	if m.NegateCondition != "" && m.NegateCondition != "yes" && m.NegateCondition != "no" {
+		return fmt.Errorf("%w: negate-condition %q", ErrInvalidAddressFilter, m.NegateCondition)
+	}
+	return nil
+}
+
+// validate 检查过滤条件，属性名和参数名统一转为大写
+func (f *addressFilter) validate() error {
+	if !validTest(f.Test) {
+		return fmt.Errorf("%w: test %q", ErrInvalidAddressFilter, f.Test)
+	}
+	for i := range f.PropFilters {
+		prop := &f.PropFilters[i]
+		prop.Name = strings.ToUpper(strings.TrimSpace(prop.Name))
+		if prop.Name == "" || !validTest(prop.Test) {
+			return fmt.Errorf("%w: prop-filter", ErrInvalidAddressFilter)
+		}
+		if prop.IsNotDefined != nil && (len(prop.TextMatches) > 0 || len(prop.ParamFilters) > 0) {
+			return fmt.Errorf("%w: is-not-defined with other conditions", ErrInvalidAddressFilter)
+		}
+		for j := range prop.TextMatches {
+			if err := prop.TextMatches[j].validate(); err != nil {
+				return err
+			}
+		}
+		for j := range prop.ParamFilters {
+			param := &prop.ParamFilters[j]
+			param.Name = strings.ToUpper(strings.TrimSpace(param.Name))
+			if param.Name == "" || (param.IsNotDefined != nil && param.TextMatch != nil) {
+				return fmt.Errorf("%w: param-filter", ErrInvalidAddressFilter)
+			}
+			if param.TextMatch != nil {
+				if err := param.TextMatch.validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matches 按排序规则和匹配方式比较文本（RFC 6352 10.5.4），缺省为i;unicode-casemap和contains
+func (m *addressTextMatch) matches(value string) bool {
+	needle := m.Value
+	switch m.Collation {
+	case "i;octet":
+	case "i;ascii-casemap":
+		lower := func(r rune) rune {
+			if r >= 'A' && r <= 'Z' {
+				return r + 'a' - 'A'
+			}
+			return r
+		}
+		value, needle = strings.Map(lower, value), strings.Map(lower, needle)
+	default:
+		value, needle = strings.ToLower(value), strings.ToLower(needle)
+	}
+
+	var matched bool
+	switch m.MatchType {
+	case "equals":
+		matched = value == needle
+	case "starts-with":
+		matched = strings.HasPrefix(value, needle)
+	case "ends-with":
+		matched = strings.HasSuffix(value, needle)
+	default:
+		matched = strings.Contains(value, needle)
+	}
+	return matched != (m.NegateCondition == "yes")
+}
+
+// matches 判断属性实例的参数是否满足条件
+func (p *addressParamFilter) matches(line icalLine) bool {
+	value, ok := line.Params[p.Name]
+	if p.IsNotDefined != nil {
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	return p.TextMatch == nil || p.TextMatch.matches(value)
+}
+
+// matches 判断vCard是否满足prop-filter：任一属性实例满足某个条件即认为该条件成立
+func (p *addressPropFilter) matches(obj *AddressObject) bool {
+	lines := obj.properties(p.Name)
+	if p.IsNotDefined != nil {
+		return len(lines) == 0
+	}
+	if len(lines) == 0 {
+		return false
+	}
+
+	var results []bool
+	for i := range p.TextMatches {
+		matched := false
+		for _, line := range lines {
+			matched = matched || p.TextMatches[i].matches(unescapeVCardText(line.Value))
+		}
+		results = append(results, matched)
+	}
+	for i := range p.ParamFilters {
+		matched := false
+		for _, line := range lines {
+			matched = matched || p.ParamFilters[i].matches(line)
+		}
+		results = append(results, matched)
+	}
+	return combineTests(p.Test, results)
+}
+
+// matches 判断vCard是否满足过滤条件
+func (f *addressFilter) matches(obj *AddressObject) bool {
+	results := make([]bool, len(f.PropFilters))
+	for i := range f.PropFilters {
+		results[i] = f.PropFilters[i].matches(obj)
+	}
+	return combineTests(f.Test, results)
+}
+
+// combineTests 按test（anyof/allof）合并各条件的结果，没有条件时成立
+func combineTests(test string, results []bool) bool {
+	if len(results) == 0 {
+		return true
+	}
+	allof := test == "allof"
+	for _, r := range results {
+		if r != allof {
+			return r
+		}
+	}
+	return allof
+}
+
+// reportAddressbookQuery 处理addressbook-query：读取通讯录中的每张vCard并按条件过滤
+func (h *Handler) reportAddressbookQuery(c *gin.Context, uid uuid.UUID, body []byte) {
+	var req addressbookQueryRequest
+	if err := davxml.Unmarshal(body, &req); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if err := req.Filter.validate(); err != nil {
+		if errors.Is(err, ErrUnsupportedCollation) {
+			h.sendDAVError(c, http.StatusForbidden, "CARD:supported-collation")
+		} else {
+			h.sendDAVError(c, http.StatusForbidden, "CARD:valid-filter")
+		}
+		return
+	}
+	limit := 0
+	if req.Limit != nil {
+		if req.Limit.NResults <= 0 {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		limit = req.Limit.NResults
+	}
+
+	userID := uid.String()
+	ctx := c.Request.Context()
+	requestPath := path.Clean("/" + c.Param("path"))
+
+	// 请求目标是通讯录时查询其成员（Depth: 0时没有结果），是通讯录对象时只检查该对象
+	var members []minio.ObjectInfo
+	var objectPaths []string
+	if info, err := h.storage.StatObject(ctx, uid, requestPath); err == nil {
+		if !h.isAddressbookCollection(userID, path.Dir(requestPath)) {
+			h.sendDAVError(c, http.StatusForbidden, "D:supported-report")
+			return
+		}
+		members, objectPaths = append(members, *info), append(objectPaths, requestPath)
+	} else if !h.isAddressbookCollection(userID, requestPath) {
+		h.sendDAVError(c, http.StatusForbidden, "D:supported-report")
+		return
+	} else if c.GetHeader("Depth") != "0" {
+		err := h.storage.WalkObjects(ctx, uid, requestPath, false, func(obj minio.ObjectInfo) error {
+			if !strings.HasSuffix(obj.Key, "/") {
+				members, objectPaths = append(members, obj), append(objectPaths, "/"+obj.Key)
+			}
+			return nil
+		})
+		if err != nil && !storage.IsNotFound(err) {
+			log.Printf("REPORT addressbook-query listing %s failed: %v", requestPath, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	matched := 0
+	for i, info := range members {
+		if !h.canRead(c, objectPaths[i]) {
+			continue
+		}
+		data, err := h.readDAVObject(ctx, uid, objectPaths[i], maxAddressObjectSize)
+		if err != nil {
+			log.Printf("Warning: skipping address object %s: %v", objectPaths[i], err)
+			continue
+		}
+		obj, err := ParseAddressObject(data)
+		if err != nil {
+			log.Printf("Warning: skipping address object %s: %v", objectPaths[i], err)
+			continue
+		}
+		if !req.Filter.matches(obj) {
+			continue
+		}
+		if limit > 0 && matched >= limit {
+			stream.WriteTruncated(requestPath, limit)
+			return
+		}
+		matched++
+		if err := stream.Write(h.addressObjectResponse(ctx, uid, objectPaths[i], objectPaths[i], info, req.Prop, data)); err != nil {
+			log.Printf("REPORT addressbook-query response for %s failed: %v", requestPath, err)
+			return
+		}
+	}
+}
+
+// reportAddressbookMultiget 处理addressbook-multiget：按href逐个返回通讯录对象，不存在的返回404
+func (h *Handler) reportAddressbookMultiget(c *gin.Context, uid uuid.UUID, body []byte) {
+	var req addressbookMultigetRequest
+	if err := davxml.Unmarshal(body, &req); err != nil || len(req.Hrefs) == 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	h.multiget(c, uid, req.Hrefs, h.isAddressbookCollection, func(href, objectPath string, info minio.ObjectInfo) Response {
+		return h.addressObjectResponse(c.Request.Context(), uid, href, objectPath, info, req.Prop, nil)
+	})
+}
+
+// addressObjectResponse 生成通讯录对象的D:response，只包含请求的getetag、getcontenttype和address-data。
+// data为已读取的vCard内容，为nil时按需读取
+func (h *Handler) addressObjectResponse(ctx context.Context, uid uuid.UUID, href, objectPath string, info minio.ObjectInfo, props *reportProp, data []byte) Response {
+	var prop webdavtypes.ResponseProp
+	if props.wants("DAV:", "getetag") {
+		prop.GetETag = resourceETag(info)
+	}
+	if props.wants("DAV:", "getcontenttype") {
+		prop.GetContentType = info.ContentType
+	}
+	if props.wants(NamespaceCardDAV, "address-data") {
+		if data == nil {
+			var err error
+			if data, err = h.readDAVObject(ctx, uid, objectPath, maxAddressObjectSize); err != nil {
+				log.Printf("Warning: failed to read address object %s: %v", objectPath, err)
+				return Response{Href: href, Status: "HTTP/1.1 500 Internal Server Error"}
+			}
+		}
+		prop.AddressData = string(data)
+	}
+
+	return Response{
+		Href: href,
+		Propstat: []webdavtypes.Propstat{{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		}},
+	}
+}
@@ -0,0 +1,196 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/casefold"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// errCaseCollision 同一目录下存在多个仅大小写不同、且都不与请求完全一致的名称
+var errCaseCollision = errors.New("case-insensitive name collision")
+
+// foldName 返回名称的规范化键，仅大小写不同的名称得到相同的键
+func foldName(name string) string {
+	return casefold.Fold(name)
+}
+
+// pickCase 从目录中与name规范化键相同的名称里选出实际使用的名称。
+// 完全一致的名称优先；只有一个候选时使用它的显示名；没有候选时保留name；
+// 多个候选且没有完全一致的名称时无法确定指向哪个资源，返回errCaseCollision
+func pickCase(name string, candidates []string) (string, error) {
+	switch len(candidates) {
+	case 0:
+		return name, nil
+	case 1:
+		return candidates[0], nil
+	}
+	for _, candidate := range candidates {
+		if candidate == name {
+			return name, nil
+		}
+	}
+	return "", errCaseCollision
+}
+
+// SetNameIndex 设置不区分大小写模式使用的名称索引，未设置时逐级列出目录匹配
+func (h *Handler) SetNameIndex(index *casefold.Index) {
+	h.nameIndex = index
+}
+
+// resolveCase 在不区分大小写模式下将请求路径映射为已存在资源的实际路径。
+// 对象键保留创建时的显示名，按规范化键逐级匹配；
+// 某一级不存在时其后的各级保持请求中的写法，新建资源使用该写法作为显示名
+func (h *Handler) resolveCase(ctx context.Context, uid uuid.UUID, requestPath string) (string, error) {
+	cleaned := path.Clean("/" + requestPath)
+	if cleaned == "/" {
+		return cleaned, nil
+	}
+	// 大多数请求的写法与实际一致，文件存在时无需查找
+	if _, err := h.storage.StatObject(ctx, uid, cleaned); err == nil {
+		return cleaned, nil
+	}
+
+	segments := strings.Split(strings.TrimPrefix(cleaned, "/"), "/")
+	if h.nameIndex != nil {
+		keys, err := h.nameIndex.Lookup(ctx, uid, cleaned)
+		if err != nil {
+			return "", err
+		}
+		return resolveIndexed(segments, keys)
+	}
+	return h.resolveByListing(ctx, uid, segments)
+}
+
+// resolveIndexed 按名称索引的查找结果逐级确定实际路径。keys为规范化键与请求路径某一级相同的对象键，
+// 每一级只考虑位于上一级已确定目录中的键
+func resolveIndexed(segments []string, keys []string) (string, error) {
+	children := make(map[string][]string, len(segments))
+	for _, key := range keys {
+		parent := path.Dir("/" + key)
+		children[parent] = append(children[parent], path.Base(key))
+	}
+
+	resolved := "/"
+	for i, segment := range segments {
+		folded := foldName(segment)
+		var candidates []string
+		for _, name := range children[resolved] {
+			if foldName(name) == folded {
+				candidates = append(candidates, name)
+			}
+		}
+		name, err := pickCase(segment, candidates)
+		if err != nil {
+			return "", err
+		}
+		resolved = path.Join(resolved, name)
+		if len(candidates) == 0 {
+			// 目录中没有对应的资源，剩余部分按请求的写法
+			return path.Join(append([]string{resolved}, segments[i+1:]...)...), nil
+		}
+	}
+	return resolved, nil
+}
+
+// resolveByListing 没有名称索引时逐级列出父目录按规范化键匹配
+func (h *Handler) resolveByListing(ctx context.Context, uid uuid.UUID, segments []string) (string, error) {
+	resolved := "/"
+	for i, segment := range segments {
+		key := foldName(segment)
+		var candidates []string
+		exact := false
+		err := h.storage.WalkObjects(ctx, uid, resolved, false, func(obj minio.ObjectInfo) error {
+			name := path.Base(strings.TrimSuffix(obj.Key, "/"))
+			if foldName(name) != key {
+				return nil
+			}
+			if name == segment {
+				exact = true
+				return storage.ErrStopWalk
+			}
+			candidates = append(candidates, name)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		name := segment
+		if !exact {
+			if name, err = pickCase(segment, candidates); err != nil {
+				return "", err
+			}
+		}
+		resolved = path.Join(resolved, name)
+		if !exact && len(candidates) == 0 {
+			// 父目录中没有对应的资源，剩余部分按请求的写法
+			return path.Join(append([]string{resolved}, segments[i+1:]...)...), nil
+		}
+	}
+	return resolved, nil
+}
+
+// ResolveCase 不区分大小写模式的中间件，将路由参数path替换为已存在资源的实际路径，
+// 使Foo.txt和foo.txt指向同一个文件而不是创建重复的文件。未开启时不做处理
+func (h *Handler) ResolveCase(c *gin.Context) {
+	if !h.config.CaseInsensitive {
+		c.Next()
+		return
+	}
+	uid, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.Next()
+		return
+	}
+
+	requestPath := c.Param("path")
+	resolved, err := h.resolveCase(c.Request.Context(), uid, requestPath)
+	if err != nil {
+		c.AbortWithStatus(caseErrorStatus(err))
+		return
+	}
+	if strings.HasSuffix(requestPath, "/") && resolved != "/" {
+		resolved += "/"
+	}
+	for i := range c.Params {
+		if c.Params[i].Key == "path" {
+			c.Params[i].Value = resolved
+		}
+	}
+	c.Next()
+}
+
+// resolveDestinationCase 解析MOVE/COPY的目标路径。目标与源是同一资源、仅大小写不同时
+// 视为改名（只对MOVE有意义），保留请求的写法；其他情况下指向已存在的同名资源，
+// 由Overwrite决定是否覆盖，而不是在旁边创建仅大小写不同的副本
+func (h *Handler) resolveDestinationCase(c *gin.Context, uid uuid.UUID, srcPath, dstPath string) (string, bool) {
+	if !h.config.CaseInsensitive {
+		return dstPath, true
+	}
+	resolved, err := h.resolveCase(c.Request.Context(), uid, dstPath)
+	if err != nil {
+		c.Status(caseErrorStatus(err))
+		return "", false
+	}
+	if resolved == path.Clean("/"+srcPath) {
+		return path.Join(path.Dir(resolved), path.Base(path.Clean("/"+dstPath))), true
+	}
+	return resolved, true
+}
+
+// caseErrorStatus 名称冲突返回409，其他错误（存储不可用等）返回500
+func caseErrorStatus(err error) int {
+	if errors.Is(err, errCaseCollision) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
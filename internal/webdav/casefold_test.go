@@ -0,0 +1,127 @@
+package webdav
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/casefold"
+	"github.com/webdav-gateway/internal/demo"
+)
+
+func TestPickCase(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+		collision  bool
+	}{
+		{"foo.txt", nil, "foo.txt", false},
+		{"foo.txt", []string{"Foo.txt"}, "Foo.txt", false},
+		{"foo.txt", []string{"Foo.txt", "foo.txt"}, "foo.txt", false},
+		{"FOO.txt", []string{"Foo.txt", "foo.txt"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := pickCase(tt.name, tt.candidates)
+		if (err == errCaseCollision) != tt.collision || got != tt.want {
+			t.Errorf("pickCase(%q, %q) = %q, %v; want %q, collision %v", tt.name, tt.candidates, got, err, tt.want, tt.collision)
+		}
+	}
+}
+
+func TestFoldName(t *testing.T) {
+	if foldName("Report.DOCX") != foldName("report.docx") {
+		t.Error("names differing only in case must share a key")
+	}
+	if foldName("Straße") == foldName("Strasse") {
+		t.Error("distinct names must not share a key")
+	}
+}
+
+func TestResolveIndexed(t *testing.T) {
+	keys := []string{"Docs", "docs", "Docs/Report.txt", "docs/notes.txt", "Music"}
+	tests := []struct {
+		path      string
+		want      string
+		collision bool
+	}{
+		{"/Docs/report.TXT", "/Docs/Report.txt", false},
+		{"/docs/notes.txt", "/docs/notes.txt", false},
+		// Docs下没有notes.txt，只按上一级确定的目录查找
+		{"/Docs/NOTES.txt", "/Docs/NOTES.txt", false},
+		{"/DOCS/a.txt", "", true},
+		{"/music/new/song.mp3", "/Music/new/song.mp3", false},
+		{"/Other/File.txt", "/Other/File.txt", false},
+	}
+	for _, tt := range tests {
+		segments := strings.Split(strings.TrimPrefix(tt.path, "/"), "/")
+		got, err := resolveIndexed(segments, keys)
+		if (err == errCaseCollision) != tt.collision || got != tt.want {
+			t.Errorf("resolveIndexed(%s) = %q, %v; want %q, collision %v", tt.path, got, err, tt.want, tt.collision)
+		}
+	}
+}
+
+// TestResolveCase 按名称索引和逐级列目录两种方式解析的结果一致
+func TestResolveCase(t *testing.T) {
+	ctx := context.Background()
+	store, uid := newTestStorage(t)
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	index := casefold.NewIndex(db, store)
+	if err := index.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 建立索引之前已存在的对象
+	for _, p := range []string{"/Docs/Report.txt", "/Docs/2024/Plan.md", "/Dup.txt", "/dup.txt"} {
+		if err := store.PutObject(ctx, uid, p, strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.SetNameIndex(index)
+
+	tests := []struct {
+		path      string
+		want      string
+		collision bool
+	}{
+		{"/", "/", false},
+		{"/Docs/Report.txt", "/Docs/Report.txt", false},
+		{"/docs/report.TXT", "/Docs/Report.txt", false},
+		{"/DOCS/2024/plan.md", "/Docs/2024/Plan.md", false},
+		{"/docs/2024", "/Docs/2024", false},
+		{"/docs/New Folder/a.txt", "/Docs/New Folder/a.txt", false},
+		{"/new.txt", "/new.txt", false},
+		{"/dup.txt", "/dup.txt", false},
+		{"/DUP.txt", "", true},
+	}
+	listing := &Handler{storage: store}
+	indexed := &Handler{storage: store, nameIndex: index}
+	for _, h := range []*Handler{listing, indexed} {
+		for _, tt := range tests {
+			got, err := h.resolveCase(ctx, uid, tt.path)
+			if (err == errCaseCollision) != tt.collision || got != tt.want {
+				t.Errorf("resolveCase(%s) indexed=%v = %q, %v; want %q, collision %v",
+					tt.path, h.nameIndex != nil, got, err, tt.want, tt.collision)
+			}
+		}
+	}
+
+	// 之后的写操作同步进入索引
+	if err := store.MoveObject(ctx, uid, "/Docs/Report.txt", "/Docs/Final.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"/docs/final.txt":  "/Docs/Final.txt",
+		"/docs/report.txt": "/Docs/report.txt",
+	} {
+		if got, err := indexed.resolveCase(ctx, uid, p); err != nil || got != want {
+			t.Errorf("after move resolveCase(%s) = %q, %v; want %q", p, got, err, want)
+		}
+	}
+}
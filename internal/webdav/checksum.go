@@ -0,0 +1,242 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/cryptopolicy"
+)
+
+const (
+	// ContentMD5PropertyName 上传内容MD5（十六进制）的活属性名，位于NamespaceMetadata命名空间
+	ContentMD5PropertyName = "getcontentmd5"
+	// ChecksumSHA256PropertyName 上传内容SHA-256（十六进制）的活属性名，仅在客户端提供校验值时记录
+	ChecksumSHA256PropertyName = "checksum-sha256"
+	// HeaderChecksumSHA256 客户端提供SHA-256校验值的扩展请求头（十六进制或Base64）
+	HeaderChecksumSHA256 = "X-Checksum-SHA256"
+)
+
+var (
+	// ErrChecksumMismatch 上传内容与客户端提供的校验值不一致
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// errInvalidChecksum 校验值请求头格式错误
+	errInvalidChecksum = errors.New("invalid checksum header")
+)
+
+// isChecksumProperty 校验值属性由服务端维护，不能通过PROPPATCH修改
+func isChecksumProperty(namespace, name string) bool {
+	return namespace == NamespaceMetadata && (name == ContentMD5PropertyName || name == ChecksumSHA256PropertyName)
+}
+
+// checksumReader 在上传流经时计算摘要，读完全部内容时与期望值比较，
+// 不一致时返回ErrChecksumMismatch使存储写入中止，原有对象不受影响
+type checksumReader struct {
+	r           io.Reader
+	md5         hash.Hash
+	sha256      hash.Hash
+	expectMD5   []byte
+	expectSHA   []byte
+	size        int64
+	n           int64
+	verifyError error
+	verified    bool
+}
+
+// newChecksumReader 根据Content-MD5和X-Checksum-SHA256请求头创建校验读取器，
+// size为已知的内容长度（未知时为-1）。请求头格式错误时返回errInvalidChecksum，空内容校验失败时返回ErrChecksumMismatch。
+// 受限算法模式下不计算MD5、忽略Content-MD5，始终记录SHA-256
+func newChecksumReader(c *gin.Context, r io.Reader, size int64) (*checksumReader, error) {
+	cr := newHashingReader(r, size)
+
+	if value := strings.TrimSpace(c.GetHeader("Content-MD5")); value != "" && cr.md5 != nil {
+		// RFC 1864：Base64编码的128位摘要
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != md5.Size {
+			return nil, errInvalidChecksum
+		}
+		cr.expectMD5 = sum
+	}
+
+	if value := strings.TrimSpace(c.GetHeader(HeaderChecksumSHA256)); value != "" {
+		sum, err := decodeDigest(value, sha256.Size)
+		if err != nil {
+			return nil, errInvalidChecksum
+		}
+		cr.expectSHA = sum
+		cr.sha256 = sha256.New()
+	}
+
+	// 空内容可能不会触发读取，直接校验
+	if size == 0 {
+		if err := cr.verify(); err != nil {
+			return nil, err
+		}
+	}
+	return cr, nil
+}
+
+// newHashingReader 创建只计算摘要、不做校验的读取器，用于服务端拼接出的内容（如PATCH部分更新后的文件）
+func newHashingReader(r io.Reader, size int64) *checksumReader {
+	cr := &checksumReader{r: r, size: size}
+	if cryptopolicy.ApprovedOnly() {
+		cr.sha256 = sha256.New()
+	} else {
+		cr.md5 = md5.New()
+	}
+	return cr
+}
+
+// decodeDigest 解析十六进制或Base64编码的摘要
+func decodeDigest(value string, size int) ([]byte, error) {
+	if len(value) == hex.EncodedLen(size) {
+		if sum, err := hex.DecodeString(value); err == nil {
+			return sum, nil
+		}
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != size {
+		return nil, errInvalidChecksum
+	}
+	return sum, nil
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.n += int64(n)
+		if cr.md5 != nil {
+			cr.md5.Write(p[:n])
+		}
+		if cr.sha256 != nil {
+			cr.sha256.Write(p[:n])
+		}
+	}
+
+	// 已知长度时存储端可能不会再读到EOF，读满即校验
+	if err == io.EOF || (cr.size >= 0 && cr.n == cr.size) {
+		if verifyErr := cr.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+// verify 比较摘要，只执行一次
+func (cr *checksumReader) verify() error {
+	if cr.verified {
+		return cr.verifyError
+	}
+	cr.verified = true
+
+	if cr.expectMD5 != nil && !bytes.Equal(cr.md5.Sum(nil), cr.expectMD5) {
+		cr.verifyError = fmt.Errorf("%w: Content-MD5", ErrChecksumMismatch)
+	} else if cr.expectSHA != nil && !bytes.Equal(cr.sha256.Sum(nil), cr.expectSHA) {
+		cr.verifyError = fmt.Errorf("%w: %s", ErrChecksumMismatch, HeaderChecksumSHA256)
+	}
+	return cr.verifyError
+}
+
+// sums 返回十六进制的MD5和SHA-256（未计算的摘要为空）
+func (cr *checksumReader) sums() (string, string) {
+	var md5Hex, sha256Hex string
+	if cr.md5 != nil {
+		md5Hex = hex.EncodeToString(cr.md5.Sum(nil))
+	}
+	if cr.sha256 != nil {
+		sha256Hex = hex.EncodeToString(cr.sha256.Sum(nil))
+	}
+	return md5Hex, sha256Hex
+}
+
+// SetChecksums 记录上传内容的校验值；未提供SHA-256时清除旧值，避免覆盖写入后残留过期的校验值
+func (s *PropertyService) SetChecksums(ctx context.Context, userID, path, md5Hex, sha256Hex string) error {
+	return s.setMetadataProperties(ctx, userID, path, map[string]string{
+		ContentMD5PropertyName:     md5Hex,
+		ChecksumSHA256PropertyName: sha256Hex,
+	})
+}
+
+// setMetadataProperties 在一个事务中写入NamespaceMetadata下由服务端维护的活属性，值为空的属性被删除
+func (s *PropertyService) setMetadataProperties(ctx context.Context, userID, path string, values map[string]string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	for name, value := range values {
+		if value == "" {
+			if err := s.deletePropertyTx(tx, userID, path, NamespaceMetadata, name); err != nil {
+				return fmt.Errorf("删除属性%s失败: %v", name, err)
+			}
+			continue
+		}
+
+		property := &DatabaseProperty{
+			UserID:    userID,
+			Path:      path,
+			Namespace: NamespaceMetadata,
+			Name:      name,
+			Value:     value,
+			IsLive:    true,
+		}
+		existing, err := s.getPropertyTx(tx, userID, path, NamespaceMetadata, name)
+		if err != nil {
+			return fmt.Errorf("检查属性存在性失败: %v", err)
+		}
+		if existing != nil {
+			err = s.updatePropertyTx(tx, property)
+		} else {
+			err = s.createPropertyTx(tx, property)
+		}
+		if err != nil {
+			return fmt.Errorf("写入属性%s失败: %v", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, path, false)
+	return nil
+}
+
+// GetChecksums 读取资源的校验值，未记录时返回空字符串
+func (s *PropertyService) GetChecksums(ctx context.Context, userID, path string) (string, string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return "", "", err
+	}
+
+	var sums [2]string
+	for i, name := range []string{ContentMD5PropertyName, ChecksumSHA256PropertyName} {
+		prop, err := s.GetProperty(ctx, userID, path, NamespaceMetadata, name)
+		if err != nil {
+			return "", "", err
+		}
+		if prop != nil {
+			sums[i] = prop.Value
+		}
+	}
+	return sums[0], sums[1], nil
+}
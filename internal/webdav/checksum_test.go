@@ -0,0 +1,76 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChecksumReader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content := "hello checksum"
+	md5Sum := md5.Sum([]byte(content))
+	shaSum := sha256.Sum256([]byte(content))
+	goodMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	goodSHA := hex.EncodeToString(shaSum[:])
+	badMD5 := base64.StdEncoding.EncodeToString(make([]byte, md5.Size))
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		size      int64
+		createErr error
+		readErr   error
+	}{
+		{name: "未提供校验值", size: int64(len(content))},
+		{name: "MD5匹配", headers: map[string]string{"Content-MD5": goodMD5}, size: int64(len(content))},
+		{name: "SHA256匹配（十六进制）", headers: map[string]string{HeaderChecksumSHA256: goodSHA}, size: -1},
+		{name: "MD5不匹配", headers: map[string]string{"Content-MD5": badMD5}, size: int64(len(content)), readErr: ErrChecksumMismatch},
+		{name: "长度未知时在EOF校验", headers: map[string]string{"Content-MD5": badMD5}, size: -1, readErr: ErrChecksumMismatch},
+		{name: "MD5格式错误", headers: map[string]string{"Content-MD5": "not-base64"}, createErr: errInvalidChecksum},
+		{name: "SHA256长度错误", headers: map[string]string{HeaderChecksumSHA256: "abcd"}, createErr: errInvalidChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPut, "/webdav/a.txt", nil)
+			for k, v := range tt.headers {
+				c.Request.Header.Set(k, v)
+			}
+
+			cr, err := newChecksumReader(c, strings.NewReader(content), tt.size)
+			if !errors.Is(err, tt.createErr) {
+				t.Fatalf("newChecksumReader() error = %v, want %v", err, tt.createErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// 已知长度时只读取size字节，模拟存储端不再读到EOF
+			var r io.Reader = cr
+			if tt.size >= 0 {
+				r = io.LimitReader(cr, tt.size)
+			}
+			_, err = io.ReadAll(r)
+			if !errors.Is(err, tt.readErr) {
+				t.Fatalf("read error = %v, want %v", err, tt.readErr)
+			}
+			if err == nil {
+				if md5Hex, _ := cr.sums(); md5Hex != hex.EncodeToString(md5Sum[:]) {
+					t.Errorf("md5 = %s, want %x", md5Hex, md5Sum)
+				}
+			}
+		})
+	}
+}
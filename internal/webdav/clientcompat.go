@@ -0,0 +1,94 @@
+package webdav
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// NamespaceMicrosoft Windows WebDAV客户端（Mini-Redirector）写入文件属性使用的命名空间
+const NamespaceMicrosoft = "urn:schemas-microsoft-com:"
+
+const (
+	// Win32CreationTimeProperty 文件创建时间（HTTP日期格式）
+	Win32CreationTimeProperty = "Win32CreationTime"
+	// Win32LastAccessTimeProperty 文件最后访问时间（HTTP日期格式）
+	Win32LastAccessTimeProperty = "Win32LastAccessTime"
+	// Win32LastModifiedTimeProperty 文件最后修改时间（HTTP日期格式）
+	Win32LastModifiedTimeProperty = "Win32LastModifiedTime"
+	// Win32FileAttributesProperty 文件属性位（8位十六进制，如00000020表示归档）
+	Win32FileAttributesProperty = "Win32FileAttributes"
+)
+
+// ErrInvalidWin32Property Win32文件属性的值格式错误
+var ErrInvalidWin32Property = errors.New("invalid win32 property value")
+
+// ClientKind 按User-Agent识别的WebDAV客户端类型
+type ClientKind int
+
+const (
+	// ClientGeneric 普通WebDAV客户端
+	ClientGeneric ClientKind = iota
+	// ClientOffice Microsoft Office（包括协议发现和上载中心）
+	ClientOffice
+	// ClientMiniRedir Windows资源管理器使用的WebClient服务（Mini-Redirector）
+	ClientMiniRedir
+)
+
+// davMethods WebDAV命名空间支持的方法，用于Allow和Public响应头
+const davMethods = "OPTIONS, GET, HEAD, POST, PUT, PATCH, DELETE, PROPFIND, PROPPATCH, MKCOL, MKCALENDAR, COPY, MOVE, LOCK, UNLOCK, SEARCH, REPORT, ACL"
+
+// officeUserAgents Office各组件使用的User-Agent前缀（小写）
+var officeUserAgents = []string{
+	"microsoft office",
+	"msoffice",
+	"microsoft data access internet publishing provider",
+}
+
+// DetectClient 根据User-Agent识别Office和Windows WebClient客户端
+func DetectClient(userAgent string) ClientKind {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if strings.HasPrefix(ua, "microsoft-webdav-miniredir") {
+		return ClientMiniRedir
+	}
+	for _, prefix := range officeUserAgents {
+		if strings.HasPrefix(ua, prefix) {
+			return ClientOffice
+		}
+	}
+	return ClientGeneric
+}
+
+// isWin32Property 判断是否为Windows客户端通过PROPPATCH写入的Win32文件属性
+func isWin32Property(namespace, name string) bool {
+	if namespace != NamespaceMicrosoft {
+		return false
+	}
+	switch name {
+	case Win32CreationTimeProperty, Win32LastAccessTimeProperty, Win32LastModifiedTimeProperty, Win32FileAttributesProperty:
+		return true
+	}
+	return false
+}
+
+// validateWin32Property 检查Win32文件属性的值格式，时间使用HTTP日期，属性位为8位十六进制。
+// 其他属性不做限制
+func validateWin32Property(name, value string) error {
+	value = strings.TrimSpace(value)
+	switch name {
+	case Win32CreationTimeProperty, Win32LastAccessTimeProperty, Win32LastModifiedTimeProperty:
+		if _, err := http.ParseTime(value); err != nil {
+			return ErrInvalidWin32Property
+		}
+	case Win32FileAttributesProperty:
+		if len(value) != 8 {
+			return ErrInvalidWin32Property
+		}
+		for _, r := range value {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return ErrInvalidWin32Property
+			}
+		}
+	}
+	return nil
+}
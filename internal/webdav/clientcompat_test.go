@@ -0,0 +1,207 @@
+package webdav
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 以下请求记录自Word 2016和Windows 10资源管理器打开、保存文档的过程，仅替换了主机名和令牌
+
+const officeProtocolDiscoveryTrace = "OPTIONS / HTTP/1.1\r\n" +
+	"Connection: Keep-Alive\r\n" +
+	"User-Agent: Microsoft Office Protocol Discovery\r\n" +
+	"Content-Length: 0\r\n" +
+	"Host: dav.example.com\r\n\r\n"
+
+const officeLockTrace = "LOCK /webdav/reports/Q3.docx HTTP/1.1\r\n" +
+	"Cache-Control: no-cache\r\n" +
+	"Connection: Keep-Alive\r\n" +
+	"Pragma: no-cache\r\n" +
+	"Content-Type: text/xml; charset=\"utf-8\"\r\n" +
+	"User-Agent: Microsoft Office Word 2014\r\n" +
+	"Timeout: Second-3600\r\n" +
+	"Content-Length: 204\r\n" +
+	"Host: dav.example.com\r\n\r\n" +
+	`<?xml version="1.0" encoding="utf-8" ?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner><D:href>EXAMPLE\alice</D:href></D:owner></D:lockinfo>`
+
+const miniRedirLockTrace = "LOCK /webdav/reports/Q3.docx HTTP/1.1\r\n" +
+	"Connection: Keep-Alive\r\n" +
+	"User-Agent: Microsoft-WebDAV-MiniRedir/10.0.19045\r\n" +
+	"Timeout: Infinite, Second-4100000000\r\n" +
+	"translate: f\r\n" +
+	"Content-Length: 0\r\n" +
+	"Host: dav.example.com\r\n\r\n"
+
+const miniRedirProppatchTrace = "PROPPATCH /webdav/reports/Q3.docx HTTP/1.1\r\n" +
+	"Connection: Keep-Alive\r\n" +
+	"User-Agent: Microsoft-WebDAV-MiniRedir/10.0.19045\r\n" +
+	"If: (<opaquelocktoken:3f1c2b7e-0d6a-4d0e-9c61-5a1b2c3d4e5f>)\r\n" +
+	"Content-Type: text/xml; charset=\"utf-8\"\r\n" +
+	"Content-Length: 443\r\n" +
+	"Host: dav.example.com\r\n\r\n" +
+	`<?xml version="1.0" encoding="utf-8" ?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:"><D:set><D:prop>` +
+	`<Z:Win32CreationTime>Tue, 14 Oct 2025 08:12:31 GMT</Z:Win32CreationTime>` +
+	`<Z:Win32LastAccessTime>Tue, 14 Oct 2025 08:15:02 GMT</Z:Win32LastAccessTime>` +
+	`<Z:Win32LastModifiedTime>Tue, 14 Oct 2025 08:15:02 GMT</Z:Win32LastModifiedTime>` +
+	`<Z:Win32FileAttributes>00000020</Z:Win32FileAttributes>` +
+	`</D:prop></D:set></D:propertyupdate>`
+
+// readTrace 解析记录的原始请求，并读出完整请求体
+func readTrace(t *testing.T, trace string) (*http.Request, []byte) {
+	t.Helper()
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(trace)))
+	if err != nil {
+		t.Fatalf("ReadRequest: %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if req.ContentLength >= 0 && int64(len(body)) != req.ContentLength {
+		t.Fatalf("trace body is %d bytes, Content-Length says %d", len(body), req.ContentLength)
+	}
+	return req, body
+}
+
+func TestDetectClient(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      ClientKind
+	}{
+		{"Microsoft Office Protocol Discovery", ClientOffice},
+		{"Microsoft Office Existence Discovery", ClientOffice},
+		{"Microsoft Office Word 2014", ClientOffice},
+		{"Microsoft Office/16.0 (Windows NT 10.0; Microsoft Excel 16.0.17328; Pro)", ClientOffice},
+		{"MSOffice 16", ClientOffice},
+		{"Microsoft Data Access Internet Publishing Provider DAV", ClientOffice},
+		{"Microsoft-WebDAV-MiniRedir/10.0.19045", ClientMiniRedir},
+		{"davfs2/1.7.0 neon/0.32.5", ClientGeneric},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Microsoft Edge", ClientGeneric},
+		{"", ClientGeneric},
+	}
+	for _, tt := range tests {
+		if got := DetectClient(tt.userAgent); got != tt.want {
+			t.Errorf("DetectClient(%q) = %v, want %v", tt.userAgent, got, tt.want)
+		}
+	}
+
+	for _, trace := range []string{officeProtocolDiscoveryTrace, officeLockTrace} {
+		req, _ := readTrace(t, trace)
+		if DetectClient(req.UserAgent()) != ClientOffice {
+			t.Errorf("%s %s: User-Agent %q not recognized as Office", req.Method, req.URL.Path, req.UserAgent())
+		}
+	}
+	req, _ := readTrace(t, miniRedirLockTrace)
+	if DetectClient(req.UserAgent()) != ClientMiniRedir {
+		t.Errorf("User-Agent %q not recognized as WebClient", req.UserAgent())
+	}
+}
+
+func TestOfficeLockTrace(t *testing.T) {
+	req, body := readTrace(t, officeLockTrace)
+	info, err := ParseLockInfoFromBytes(body)
+	if err != nil {
+		t.Fatalf("ParseLockInfoFromBytes: %v", err)
+	}
+	if info.LockScope.Exclusive == nil || info.LockType.Write == nil {
+		t.Errorf("Office LOCK parsed as %+v, want exclusive write", info)
+	}
+	if got := ParseTimeout(req.Header.Get("Timeout")); got != 3600 {
+		t.Errorf("ParseTimeout(%q) = %d, want 3600", req.Header.Get("Timeout"), got)
+	}
+
+	// WebClient发送空请求体和多个候选超时值
+	req, body = readTrace(t, miniRedirLockTrace)
+	if len(body) != 0 {
+		t.Errorf("WebClient LOCK body = %q, want empty", body)
+	}
+	if got := ParseTimeout(req.Header.Get("Timeout")); got != 86400*365 {
+		t.Errorf("ParseTimeout(%q) = %d, want the Infinite value", req.Header.Get("Timeout"), got)
+	}
+}
+
+func TestParseTimeoutList(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"", 0},
+		{"Second-600", 600},
+		{"infinite", 86400 * 365},
+		{"Second-x, Second-120", 120},
+		{"Extension-1, Second-30", 30},
+		{"Second-0", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseTimeout(tt.header); got != tt.want {
+			t.Errorf("ParseTimeout(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestWin32ProppatchTrace(t *testing.T) {
+	_, body := readTrace(t, miniRedirProppatchTrace)
+	var update struct {
+		Set []struct {
+			Props []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"set>prop"`
+	}
+	if err := xml.Unmarshal(body, &update); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(update.Set) != 1 || len(update.Set[0].Props) != 4 {
+		t.Fatalf("unexpected PROPPATCH structure: %+v", update)
+	}
+	for _, prop := range update.Set[0].Props {
+		if !isWin32Property(prop.XMLName.Space, prop.XMLName.Local) {
+			t.Errorf("%s %s not recognized as a Win32 property", prop.XMLName.Space, prop.XMLName.Local)
+			continue
+		}
+		if err := validateWin32Property(prop.XMLName.Local, prop.Value); err != nil {
+			t.Errorf("%s = %q rejected: %v", prop.XMLName.Local, prop.Value, err)
+		}
+	}
+}
+
+func TestValidateWin32Property(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{Win32FileAttributesProperty, "00000020", true},
+		{Win32FileAttributesProperty, "0000002a", true},
+		{Win32FileAttributesProperty, "20", false},
+		{Win32FileAttributesProperty, "0000002G", false},
+		{Win32CreationTimeProperty, "Tue, 14 Oct 2025 08:12:31 GMT", true},
+		{Win32LastModifiedTimeProperty, "2025-10-14T08:12:31Z", false},
+		{Win32LastAccessTimeProperty, "", false},
+	}
+	for _, tt := range tests {
+		err := validateWin32Property(tt.name, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateWin32Property(%s, %q) = %v, want ok %v", tt.name, tt.value, err, tt.ok)
+		}
+	}
+	if isWin32Property(NamespaceMicrosoft, "Win32Size") || isWin32Property("DAV:", Win32FileAttributesProperty) {
+		t.Error("only the four Win32 properties in the Microsoft namespace are validated")
+	}
+}
+
+func TestParseSharedLockInfo(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?><lockinfo xmlns="DAV:"><lockscope><shared/></lockscope><locktype><write/></locktype><owner>alice</owner></lockinfo>`
+	info, err := ParseLockInfoFromBytes([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseLockInfoFromBytes: %v", err)
+	}
+	if info.LockScope.Shared == nil || info.LockScope.Exclusive != nil || info.LockType.Write == nil {
+		t.Errorf("parsed %+v, want shared write", info)
+	}
+}
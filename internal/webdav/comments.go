@@ -0,0 +1,18 @@
+package webdav
+
+import (
+	"context"
+	"strconv"
+)
+
+// CommentCountPropertyName 文件评论数的活属性名，位于NamespaceMetadata命名空间，由评论服务维护
+const CommentCountPropertyName = "comment-count"
+
+// SetCommentCount 记录文件的评论数，count为0时删除属性
+func (s *PropertyService) SetCommentCount(ctx context.Context, userID, path string, count int) error {
+	value := ""
+	if count > 0 {
+		value = strconv.Itoa(count)
+	}
+	return s.setMetadataProperties(ctx, userID, path, map[string]string{CommentCountPropertyName: value})
+}
@@ -0,0 +1,79 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/changes"
+)
+
+// maxConflictCopies 同一天同一用户对同一文件的冲突副本编号上限
+const maxConflictCopies = 100
+
+// conflictCopyName 冲突副本的文件名：“名称 (conflicted copy 日期 用户).扩展名”，n大于1时在用户名后加编号。
+// 以点开头且没有其他点的名称（.bashrc）整体作为名称
+func conflictCopyName(name, username string, day time.Time, n int) string {
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	label := "conflicted copy " + day.Format("2006-01-02")
+	if username = strings.NewReplacer("/", "_", `\`, "_").Replace(username); username != "" {
+		label += " " + username
+	}
+	if n > 1 {
+		label += fmt.Sprintf(" %d", n)
+	}
+	return strings.TrimSuffix(name, ext) + " (" + label + ")" + ext
+}
+
+// conflictCopyPath 在同一目录下选择一个尚不存在的冲突副本路径
+func (h *Handler) conflictCopyPath(ctx context.Context, uid uuid.UUID, filePath, username string) (string, error) {
+	dir, name := path.Split(path.Clean("/" + filePath))
+	day := time.Now()
+	for n := 1; n <= maxConflictCopies; n++ {
+		candidate := dir + conflictCopyName(name, username, day, n)
+		if !h.resourceExists(ctx, uid, candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("too many conflict copies of %s", filePath)
+}
+
+// resolvePutConflict 检查PUT的If-Match：条件满足时写入请求路径；文件已被其他客户端修改（ETag不同）时，
+// 开启webdav.conflict_copies后改为写入冲突副本，否则返回412。current为当前文件，不存在时为nil。
+// 返回实际写入的路径，已发送错误响应时ok为false
+func (h *Handler) resolvePutConflict(c *gin.Context, uid uuid.UUID, requestPath string, current *minio.ObjectInfo) (string, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || (current != nil && (ifMatch == "*" || h.matchesETag(ifMatch, *current))) {
+		return requestPath, true
+	}
+	// 文件已被删除时没有可保留的版本，按RFC 7232返回412，由客户端决定是否重新创建
+	if current == nil || !h.config.ConflictCopies {
+		c.Status(http.StatusPreconditionFailed)
+		return "", false
+	}
+
+	copyPath, err := h.conflictCopyPath(c.Request.Context(), uid, requestPath, c.GetString("username"))
+	if err != nil {
+		c.Status(http.StatusConflict)
+		return "", false
+	}
+	// 副本是上级目录中的新资源，需要bind权限
+	if h.CheckParentPrivilege(c, copyPath, PrivilegeBind) {
+		return "", false
+	}
+	// 变更日志按请求路径记录，副本的路径由ChangeJournalMiddleware从这里读取
+	c.Set(changes.ConflictCopyKey, copyPath)
+	c.Header("Location", (&url.URL{Path: routePrefix(c) + copyPath}).String())
+	return copyPath, true
+}
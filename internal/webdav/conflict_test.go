@@ -0,0 +1,28 @@
+package webdav
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConflictCopyName(t *testing.T) {
+	day := time.Date(2024, 3, 5, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, user string
+		n          int
+		want       string
+	}{
+		{"report.docx", "alice", 1, "report (conflicted copy 2024-03-05 alice).docx"},
+		{"report.docx", "alice", 2, "report (conflicted copy 2024-03-05 alice 2).docx"},
+		{"archive.tar.gz", "bob", 1, "archive.tar (conflicted copy 2024-03-05 bob).gz"},
+		{"Makefile", "alice", 1, "Makefile (conflicted copy 2024-03-05 alice)"},
+		{".bashrc", "alice", 1, ".bashrc (conflicted copy 2024-03-05 alice)"},
+		{"notes.txt", "ad/min", 1, "notes (conflicted copy 2024-03-05 ad_min).txt"},
+		{"notes.txt", "", 1, "notes (conflicted copy 2024-03-05).txt"},
+	}
+	for _, tt := range tests {
+		if got := conflictCopyName(tt.name, tt.user, day, tt.n); got != tt.want {
+			t.Errorf("conflictCopyName(%q, %q, %d) = %q, want %q", tt.name, tt.user, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package webdav
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxDecompressedSize 未配置时单个压缩上传解压后的最大字节数
+	DefaultMaxDecompressedSize int64 = 10 << 30
+	// DefaultMaxCompressionRatio 未配置时允许的最大压缩比
+	DefaultMaxCompressionRatio = 100
+	// compressionRatioGrace 解压量低于该值时不检查压缩比，避免小文件误判
+	compressionRatioGrace int64 = 1 << 20
+)
+
+var (
+	// ErrDecompressedTooLarge 解压后内容超出大小限制
+	ErrDecompressedTooLarge = errors.New("decompressed content exceeds size limit")
+	// ErrCompressionRatio 压缩比异常（疑似解压炸弹）
+	ErrCompressionRatio = errors.New("compression ratio exceeds limit")
+	// ErrQuotaExceeded 上传内容超出用户剩余配额
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// countingReader 统计已读取字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// guardedReader 对解压后的数据流执行大小、配额和压缩比限制
+type guardedReader struct {
+	r          io.Reader
+	compressed *countingReader
+	n          int64
+	maxSize    int64
+	quota      int64
+	maxRatio   int64
+}
+
+func (g *guardedReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.n += int64(n)
+
+	if g.n > g.maxSize {
+		return n, ErrDecompressedTooLarge
+	}
+	if g.quota >= 0 && g.n > g.quota {
+		return n, ErrQuotaExceeded
+	}
+	if g.n > compressionRatioGrace && g.n > g.compressed.n*g.maxRatio {
+		return n, ErrCompressionRatio
+	}
+	return n, err
+}
+
+// quotaReader 长度未知（分块传输编码）的上传在读取过程中检查剩余配额
+type quotaReader struct {
+	r     io.Reader
+	n     int64
+	quota int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.n > q.quota {
+		return n, ErrQuotaExceeded
+	}
+	return n, err
+}
+
+// remainingQuota 返回用户剩余配额，覆盖写入时原文件大小previousSize会被释放；无法获取用户时返回-1（不限制）
+func (h *Handler) remainingQuota(ctx context.Context, uid uuid.UUID, previousSize int64) int64 {
+	user, err := h.auth.GetUserByID(ctx, uid)
+	if err != nil {
+		return -1
+	}
+	pool := int64(-1)
+	if h.tenantQuota != nil {
+		pool = h.tenantQuota.RemainingForUser(ctx, uid)
+	}
+	return remainingBytes(user.StorageQuota, user.StorageUsed, pool, previousSize)
+}
+
+// remainingBytes 用户配额quota、已用used时还能写入的字节数，原文件大小previousSize计为可用；
+// 租户成员同时受租户配额池pool限制（-1表示不限制），取两者中较小的一个
+func remainingBytes(quota, used, pool, previousSize int64) int64 {
+	remaining := quota - used + previousSize
+	if pool >= 0 && pool+previousSize < remaining {
+		remaining = pool + previousSize
+	}
+	return remaining
+}
+
+// TenantQuota 租户配额池，返回用户所属租户剩余的字节数，-1表示不限制
+type TenantQuota interface {
+	RemainingForUser(ctx context.Context, userID uuid.UUID) int64
+}
+
+// SetTenantQuota 启用租户配额池，上传同时检查用户配额和租户配额池；传入nil时关闭
+func (h *Handler) SetTenantQuota(quota TenantQuota) {
+	h.tenantQuota = quota
+}
+
+// decodeUploadBody 根据Content-Encoding返回解码后的请求体，ok为false时已发送错误响应
+// 返回的guardedReader在上传完成后记录实际（解压后）的字节数
+func (h *Handler) decodeUploadBody(c *gin.Context, uid uuid.UUID, previousSize int64) (io.Reader, *guardedReader, bool) {
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return c.Request.Body, nil, true
+	case "gzip", "x-gzip":
+	default:
+		c.Status(http.StatusUnsupportedMediaType)
+		return nil, nil, false
+	}
+
+	compressed := &countingReader{r: c.Request.Body}
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	// 剩余配额：解压后的大小才计入用户用量
+	quota := h.remainingQuota(c.Request.Context(), uid, previousSize)
+
+	maxSize := h.config.MaxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	maxRatio := int64(h.config.MaxCompressionRatio)
+	if maxRatio <= 0 {
+		maxRatio = DefaultMaxCompressionRatio
+	}
+
+	guard := &guardedReader{
+		r:          gz,
+		compressed: compressed,
+		maxSize:    maxSize,
+		quota:      quota,
+		maxRatio:   maxRatio,
+	}
+	return guard, guard, true
+}
+
+// sendUploadError 发送上传失败的响应，超出配额时带quota-not-exceeded条件
+func sendUploadError(c *gin.Context, err error) {
+	if errors.Is(err, ErrQuotaExceeded) {
+		sendQuotaExceeded(c)
+		return
+	}
+	c.Status(uploadErrorStatus(err))
+}
+
+// uploadErrorStatus 将上传（解压、校验）的错误映射为HTTP状态码
+func uploadErrorStatus(err error) int {
+	// 请求体超出server.limits的上限（分块传输时在读取过程中才能发现）
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrDecompressedTooLarge), errors.Is(err, ErrCompressionRatio), errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, gzip.ErrChecksum), errors.Is(err, gzip.ErrHeader), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, ErrChecksumMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
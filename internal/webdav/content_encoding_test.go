@@ -0,0 +1,181 @@
+package webdav
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"testing/iotest"
+)
+
+// gzipGuard 返回读取data的gzip压缩内容的guardedReader
+func gzipGuard(t *testing.T, data []byte, maxSize, quota, maxRatio int64) *guardedReader {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+
+	compressed := &countingReader{r: &buf}
+	r, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &guardedReader{r: r, compressed: compressed, maxSize: maxSize, quota: quota, maxRatio: maxRatio}
+}
+
+func TestGuardedReader(t *testing.T) {
+	random := make([]byte, 64<<10)
+	for i := range random {
+		random[i] = byte(i*7919 + i/251)
+	}
+	zeros := make([]byte, 4<<20)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		maxSize  int64
+		quota    int64
+		maxRatio int64
+		wantErr  error
+	}{
+		{"within limits", random, 1 << 20, -1, 100, nil},
+		{"exactly max size", random, int64(len(random)), -1, 100, nil},
+		{"exceeds max size", random, int64(len(random)) - 1, -1, 100, ErrDecompressedTooLarge},
+		{"exactly quota", random, 1 << 20, int64(len(random)), 100, nil},
+		{"exceeds quota", random, 1 << 20, 1000, 100, ErrQuotaExceeded},
+		{"no quota left", random, 1 << 20, 0, 100, ErrQuotaExceeded},
+		// 全零内容压缩比极高，超过1MiB后检查压缩比
+		{"compression bomb", zeros, 1 << 30, -1, 100, ErrCompressionRatio},
+		{"high ratio allowed", zeros, 1 << 30, -1, 10000, nil},
+		{"high ratio below grace", zeros[:compressionRatioGrace], 1 << 30, -1, 100, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := gzipGuard(t, tt.data, tt.maxSize, tt.quota, tt.maxRatio)
+			data, err := io.ReadAll(guard)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (!bytes.Equal(data, tt.data) || guard.n != int64(len(tt.data))) {
+				t.Errorf("read %d bytes (counted %d), want %d", len(data), guard.n, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestUploadErrorStatus(t *testing.T) {
+	// 存储后端返回的错误经过storage包和minio-go/net/http包装
+	wrapped := func(err error) error {
+		opErr := &net.OpError{Op: "readfrom", Net: "tcp", Err: err}
+		return fmt.Errorf("put object: %w", &url.Error{Op: "Put", URL: "http://minio:9000/user/a.txt", Err: opErr})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"decompressed too large", ErrDecompressedTooLarge, http.StatusRequestEntityTooLarge},
+		{"compression ratio", ErrCompressionRatio, http.StatusRequestEntityTooLarge},
+		{"body too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge},
+		{"quota", ErrQuotaExceeded, http.StatusInsufficientStorage},
+		{"gzip checksum", gzip.ErrChecksum, http.StatusBadRequest},
+		{"gzip header", gzip.ErrHeader, http.StatusBadRequest},
+		{"truncated body", io.ErrUnexpectedEOF, http.StatusBadRequest},
+		{"checksum mismatch", fmt.Errorf("%w: Content-MD5", ErrChecksumMismatch), http.StatusBadRequest},
+		{"wrapped quota", wrapped(ErrQuotaExceeded), http.StatusInsufficientStorage},
+		{"wrapped compression ratio", wrapped(ErrCompressionRatio), http.StatusRequestEntityTooLarge},
+		{"wrapped checksum mismatch", wrapped(fmt.Errorf("%w: %s", ErrChecksumMismatch, HeaderChecksumSHA256)), http.StatusBadRequest},
+		{"wrapped max bytes", wrapped(&http.MaxBytesError{Limit: 10}), http.StatusRequestEntityTooLarge},
+		{"storage failure", errors.New("put object: connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uploadErrorStatus(tt.err); got != tt.want {
+				t.Errorf("uploadErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10<<10)
+
+	tests := []struct {
+		name    string
+		quota   int64
+		wantErr error
+	}{
+		{"within quota", int64(len(data)) + 1, nil},
+		{"exactly quota", int64(len(data)), nil},
+		{"exceeds quota", int64(len(data)) - 1, ErrQuotaExceeded},
+		{"no quota left", 0, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 分块传输编码的请求体每次Read只返回一部分
+			q := &quotaReader{r: iotest.HalfReader(bytes.NewReader(data)), quota: tt.quota}
+			got, err := io.ReadAll(q)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(got, data) {
+				t.Errorf("read %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+// TestQuotaReaderPut 长度未知的上传超出配额时存储端中止写入，不留下对象
+func TestQuotaReaderPut(t *testing.T) {
+	store, userID := newTestStorage(t)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("x"), 64<<10)
+
+	body := &quotaReader{r: bytes.NewReader(data), quota: 1000}
+	err := store.PutObject(ctx, userID, "/big.bin", body, -1, "application/octet-stream")
+	if !errors.Is(err, ErrQuotaExceeded) || uploadErrorStatus(err) != http.StatusInsufficientStorage {
+		t.Fatalf("PutObject = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := store.StatObject(ctx, userID, "/big.bin"); err == nil {
+		t.Error("object stored although the quota was exceeded")
+	}
+
+	body = &quotaReader{r: bytes.NewReader(data), quota: int64(len(data))}
+	if err := store.PutObject(ctx, userID, "/fits.bin", body, -1, "application/octet-stream"); err != nil {
+		t.Fatalf("PutObject within quota: %v", err)
+	}
+	if info, err := store.StatObject(ctx, userID, "/fits.bin"); err != nil || info.Size != int64(len(data)) {
+		t.Errorf("stored object = %v, %v; want %d bytes", info, err, len(data))
+	}
+}
+
+func TestRemainingBytes(t *testing.T) {
+	tests := []struct {
+		name                        string
+		quota, used, pool, previous int64
+		want                        int64
+	}{
+		{"user quota", 1000, 400, -1, 0, 600},
+		{"overwrite frees previous size", 1000, 400, -1, 100, 700},
+		{"over quota", 1000, 1200, -1, 0, -200},
+		{"tenant pool smaller", 1000, 400, 300, 0, 300},
+		{"tenant pool smaller on overwrite", 1000, 400, 300, 100, 400},
+		{"tenant pool larger", 1000, 400, 5000, 100, 700},
+		{"tenant pool exhausted", 1000, 400, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remainingBytes(tt.quota, tt.used, tt.pool, tt.previous); got != tt.want {
+				t.Errorf("remainingBytes(%d, %d, %d, %d) = %d, want %d", tt.quota, tt.used, tt.pool, tt.previous, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/davpath"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// maxSearchRequestSize SEARCH请求体的最大字节数
+const maxSearchRequestSize = 1 << 20
+
+// ErrUnsupportedSearch 查询使用了不支持的语法或运算符（如or、not）
+var ErrUnsupportedSearch = errors.New("unsupported search query")
+
+// daslNode 通用XML节点，basicsearch的where条件可以任意嵌套
+type daslNode struct {
+	XMLName  xml.Name
+	Content  string     `xml:",chardata"`
+	Children []daslNode `xml:",any"`
+}
+
+// child 返回第一个DAV:命名空间下名为local的子节点
+func (n *daslNode) child(local string) *daslNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Space == "DAV:" && n.Children[i].XMLName.Local == local {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// ParseSearchRequest 将RFC 5323 basicsearch请求转换为SearchQuery。
+// hrefPrefix为WebDAV路由前缀（如/webdav），scope中的href会去掉该前缀；未指定scope时Scope为空。
+// 只支持and组合的条件，使用or、not等运算符时返回ErrUnsupportedSearch
+func ParseSearchRequest(body io.Reader, hrefPrefix string) (SearchQuery, error) {
+	q := SearchQuery{Recursive: true}
+
+	var root daslNode
+	if err := davxml.NewDecoder(io.LimitReader(body, maxSearchRequestSize)).Decode(&root); err != nil {
+		return q, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+	if root.XMLName.Space != "DAV:" || root.XMLName.Local != "searchrequest" {
+		return q, fmt.Errorf("%w: expected DAV:searchrequest", ErrInvalidSearch)
+	}
+	search := root.child("basicsearch")
+	if search == nil {
+		return q, fmt.Errorf("%w: only DAV:basicsearch is supported", ErrUnsupportedSearch)
+	}
+
+	if scope := search.child("from"); scope != nil {
+		if scope = scope.child("scope"); scope == nil {
+			return q, fmt.Errorf("%w: DAV:from without DAV:scope", ErrInvalidSearch)
+		}
+		if href := scope.child("href"); href != nil {
+			scopePath, err := scopeHrefPath(strings.TrimSpace(href.Content), hrefPrefix)
+			if err != nil {
+				return q, err
+			}
+			q.Scope = scopePath
+		}
+		if depth := scope.child("depth"); depth != nil {
+			switch strings.TrimSpace(depth.Content) {
+			case "infinity":
+			case "1":
+				q.Recursive = false
+			default:
+				return q, fmt.Errorf("%w: scope depth must be 1 or infinity", ErrUnsupportedSearch)
+			}
+		}
+	}
+
+	if where := search.child("where"); where != nil {
+		for _, cond := range where.Children {
+			if err := q.applyCondition(cond); err != nil {
+				return q, err
+			}
+		}
+	}
+
+	if limit := search.child("limit"); limit != nil {
+		if nresults := limit.child("nresults"); nresults != nil {
+			n, err := strconv.Atoi(strings.TrimSpace(nresults.Content))
+			if err != nil || n <= 0 {
+				return q, fmt.Errorf("%w: invalid nresults", ErrInvalidSearch)
+			}
+			q.Limit = n
+		}
+	}
+	return q, nil
+}
+
+// scopeHrefPath 将scope中的href（绝对URL或路径）转换为相对WebDAV根的规范路径。
+// href只用于查找已有的资源，不限制长度
+func scopeHrefPath(href, hrefPrefix string) (string, error) {
+	p, err := davpath.FromURL(href, hrefPrefix, -1)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid scope href", ErrInvalidSearch)
+	}
+	return p, nil
+}
+
+// applyCondition 将where中的一个条件合并到查询
+func (q *SearchQuery) applyCondition(n daslNode) error {
+	if n.XMLName.Space != "DAV:" {
+		return fmt.Errorf("%w: unknown operator %s", ErrUnsupportedSearch, n.XMLName.Local)
+	}
+
+	switch op := n.XMLName.Local; op {
+	case "and":
+		for _, cond := range n.Children {
+			if err := q.applyCondition(cond); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "contains":
+		if q.Text != "" {
+			return fmt.Errorf("%w: only one DAV:contains is supported", ErrUnsupportedSearch)
+		}
+		q.Text = strings.TrimSpace(n.Content)
+		return nil
+	case "eq", "like", "gt", "gte", "lt", "lte":
+		prop := n.child("prop")
+		literal := n.child("literal")
+		if literal == nil {
+			literal = n.child("typed-literal")
+		}
+		if prop == nil || len(prop.Children) != 1 || literal == nil {
+			return fmt.Errorf("%w: DAV:%s requires one property and a literal", ErrInvalidSearch, op)
+		}
+		return q.applyComparison(op, prop.Children[0].XMLName, literal.Content)
+	default:
+		return fmt.Errorf("%w: operator DAV:%s", ErrUnsupportedSearch, op)
+	}
+}
+
+// applyComparison 按属性将比较条件映射到查询字段
+func (q *SearchQuery) applyComparison(op string, prop xml.Name, literal string) error {
+	unsupported := fmt.Errorf("%w: DAV:%s on %s%s", ErrUnsupportedSearch, op, prop.Space, prop.Local)
+
+	if prop.Space != "DAV:" {
+		filter := PropertyFilter{Namespace: prop.Space, Name: prop.Local, Value: literal}
+		if op == "like" {
+			value, contains, ok := likeToContains(literal)
+			if !ok {
+				return unsupported
+			}
+			filter.Value, filter.Contains = value, contains
+		} else if op != "eq" {
+			return unsupported
+		}
+		q.Properties = append(q.Properties, filter)
+		return nil
+	}
+
+	switch prop.Local {
+	case "displayname":
+		switch op {
+		case "eq":
+			q.NameGlob = escapeGlob(literal)
+		case "like":
+			q.NameGlob = likeToGlob(literal)
+		default:
+			return unsupported
+		}
+	case "getcontenttype":
+		switch op {
+		case "eq":
+			q.ContentType = literal
+		case "like":
+			prefix, ok := strings.CutSuffix(literal, "%")
+			if !ok || !strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, "%_") {
+				return unsupported
+			}
+			q.ContentType = prefix + "*"
+		default:
+			return unsupported
+		}
+	case "getcontentlength":
+		size, err := strconv.ParseInt(strings.TrimSpace(literal), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid getcontentlength %q", ErrInvalidSearch, literal)
+		}
+		switch op {
+		case "eq":
+			q.raiseMinSize(size)
+			q.lowerMaxSize(size)
+		case "gt":
+			q.raiseMinSize(size + 1)
+		case "gte":
+			q.raiseMinSize(size)
+		case "lt":
+			q.lowerMaxSize(size - 1)
+		case "lte":
+			q.lowerMaxSize(size)
+		default:
+			return unsupported
+		}
+	case "getlastmodified":
+		t, err := parseSearchTime(literal)
+		if err != nil {
+			return fmt.Errorf("%w: invalid getlastmodified %q", ErrInvalidSearch, literal)
+		}
+		switch op {
+		case "gt":
+			q.ModifiedAfter = t
+		case "gte":
+			q.ModifiedAfter = t.Add(-time.Nanosecond)
+		case "lt":
+			q.ModifiedBefore = t
+		case "lte":
+			q.ModifiedBefore = t.Add(time.Nanosecond)
+		default:
+			return unsupported
+		}
+	default:
+		return unsupported
+	}
+	return nil
+}
+
+func (q *SearchQuery) raiseMinSize(size int64) {
+	if q.MinSize == nil || size > *q.MinSize {
+		q.MinSize = &size
+	}
+}
+
+func (q *SearchQuery) lowerMaxSize(size int64) {
+	if q.MaxSize == nil || size < *q.MaxSize {
+		q.MaxSize = &size
+	}
+}
+
+// parseSearchTime 解析RFC 1123（HTTP日期）或RFC 3339时间
+func parseSearchTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// likeToGlob 将SQL LIKE模式（%、_、\转义）转换为path.Match的glob
+func likeToGlob(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(escapeGlob(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteByte('*')
+		case r == '_':
+			b.WriteByte('?')
+		default:
+			b.WriteString(escapeGlob(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// escapeGlob 转义glob的特殊字符，使其按字面匹配
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
+
+// likeToContains 将属性值的LIKE模式转换为精确或包含匹配，只支持x与%x%两种形式
+func likeToContains(pattern string) (string, bool, bool) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(pattern, "%"), "%")
+	if strings.ContainsAny(inner, `%_\`) {
+		return "", false, false
+	}
+	switch {
+	case inner == pattern:
+		return inner, false, true
+	case len(pattern) >= 2 && strings.HasPrefix(pattern, "%") && strings.HasSuffix(pattern, "%"):
+		return inner, true, true
+	default:
+		return "", false, false
+	}
+}
+
+// HandleSearch 处理WebDAV SEARCH（RFC 5323 DASL basicsearch），
+// 与GET /api/search使用同一搜索实现
+func (h *Handler) HandleSearch(c *gin.Context) {
+	if h.searcher == nil {
+		c.Status(http.StatusNotImplemented)
+		return
+	}
+
+	uid, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	requestPath := c.Param("path")
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	hrefPrefix := routePrefix(c)
+
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+	q, err := ParseSearchRequest(bytes.NewReader(body), hrefPrefix)
+	if err != nil {
+		h.sendSearchError(c, err)
+		return
+	}
+	if q.Scope == "" {
+		q.Scope = requestPath
+	}
+
+	// 检查访问控制权限，没有读取权限的结果不返回
+	if h.CheckPrivilege(c, q.Scope, PrivilegeRead) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
+	results, err := h.searcher.Search(c.Request.Context(), uid, q)
+	if err != nil {
+		h.sendSearchError(c, err)
+		return
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	userID := uid.String()
+	for _, result := range results.Results {
+		if !h.canRead(c, result.Path) {
+			continue
+		}
+		var resp Response
+		if result.IsDir {
+			resp = h.createFolderResponse(result.Path, result.LastModified, userID, result.FileID)
+		} else {
+			resp = h.createFileResponse(result.Path, result.Size, result.LastModified, result.ContentType, result.ETag, userID, result.FileID)
+		}
+		if err := stream.Write(resp); err != nil {
+			log.Printf("SEARCH response for %s failed: %v", q.Scope, err)
+			return
+		}
+	}
+	if results.Truncated {
+		stream.WriteTruncated(q.Scope, len(results.Results))
+	}
+}
+
+// sendSearchError 将搜索错误映射为状态码：格式错误400，不支持的查询422
+func (h *Handler) sendSearchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnsupportedSearch):
+		c.String(http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, ErrInvalidSearch):
+		c.String(http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("SEARCH failed: %v", err)
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+package webdav
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchRequest(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:searchrequest xmlns:D="DAV:" xmlns:gw="urn:example:meta">
+  <D:basicsearch>
+    <D:select><D:prop><D:displayname/></D:prop></D:select>
+    <D:from><D:scope><D:href>https://dav.example.com/webdav/docs/</D:href><D:depth>1</D:depth></D:scope></D:from>
+    <D:where>
+      <D:and>
+        <D:like><D:prop><D:displayname/></D:prop><D:literal>report_%.pdf</D:literal></D:like>
+        <D:gte><D:prop><D:getcontentlength/></D:prop><D:literal>1024</D:literal></D:gte>
+        <D:lt><D:prop><D:getcontentlength/></D:prop><D:literal>4096</D:literal></D:lt>
+        <D:like><D:prop><D:getcontenttype/></D:prop><D:literal>application/%</D:literal></D:like>
+        <D:gt><D:prop><D:getlastmodified/></D:prop><D:literal>Mon, 02 Jan 2006 15:04:05 GMT</D:literal></D:gt>
+        <D:like><D:prop><gw:project/></D:prop><D:literal>%apollo%</D:literal></D:like>
+        <D:contains>budget</D:contains>
+      </D:and>
+    </D:where>
+    <D:limit><D:nresults>20</D:nresults></D:limit>
+  </D:basicsearch>
+</D:searchrequest>`
+
+	q, err := ParseSearchRequest(strings.NewReader(body), "/webdav")
+	if err != nil {
+		t.Fatalf("ParseSearchRequest() error = %v", err)
+	}
+
+	if q.Scope != "/docs/" || q.Recursive {
+		t.Errorf("scope = %q recursive = %v, want /docs/ false", q.Scope, q.Recursive)
+	}
+	if q.NameGlob != "report?*.pdf" {
+		t.Errorf("NameGlob = %q", q.NameGlob)
+	}
+	if q.MinSize == nil || *q.MinSize != 1024 || q.MaxSize == nil || *q.MaxSize != 4095 {
+		t.Errorf("size range = %v..%v", q.MinSize, q.MaxSize)
+	}
+	if q.ContentType != "application/*" {
+		t.Errorf("ContentType = %q", q.ContentType)
+	}
+	if q.ModifiedAfter.IsZero() || q.ModifiedAfter.Year() != 2006 {
+		t.Errorf("ModifiedAfter = %v", q.ModifiedAfter)
+	}
+	want := PropertyFilter{Namespace: "urn:example:meta", Name: "project", Value: "apollo", Contains: true}
+	if len(q.Properties) != 1 || q.Properties[0] != want {
+		t.Errorf("Properties = %+v", q.Properties)
+	}
+	if q.Text != "budget" || q.Limit != 20 {
+		t.Errorf("Text = %q Limit = %d", q.Text, q.Limit)
+	}
+}
+
+func TestParseSearchRequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"malformed", `<D:searchrequest xmlns:D="DAV:">`, ErrInvalidSearch},
+		{"not searchrequest", `<D:propfind xmlns:D="DAV:"/>`, ErrInvalidSearch},
+		{"other grammar", `<D:searchrequest xmlns:D="DAV:"><x:sql xmlns:x="urn:x"/></D:searchrequest>`, ErrUnsupportedSearch},
+		{"or", `<D:searchrequest xmlns:D="DAV:"><D:basicsearch><D:where><D:or/></D:where></D:basicsearch></D:searchrequest>`, ErrUnsupportedSearch},
+		{"bad size", `<D:searchrequest xmlns:D="DAV:"><D:basicsearch><D:where><D:gt><D:prop><D:getcontentlength/></D:prop><D:literal>big</D:literal></D:gt></D:where></D:basicsearch></D:searchrequest>`, ErrInvalidSearch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSearchRequest(strings.NewReader(tt.body), "/webdav")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseSearchRequest() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		pattern, contentType string
+		want                 bool
+	}{
+		{"application/pdf", "application/pdf", true},
+		{"application/pdf", "Application/PDF; charset=binary", true},
+		{"image/*", "image/png", true},
+		{"image/", "image/jpeg", true},
+		{"image/*", "text/plain", false},
+		{"text/plain", "text/plain-extra", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchContentType(tt.pattern, tt.contentType); got != tt.want {
+			t.Errorf("matchContentType(%q, %q) = %v, want %v", tt.pattern, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DAV:前置条件和后置条件元素（RFC 4918 16、RFC 4331 6），带D:前缀，
+// 与CalDAV的C:、CardDAV的CARD:条件一样通过sendDAVError发送
+const (
+	ConditionLockTokenSubmitted         = "D:lock-token-submitted"
+	ConditionNoConflictingLock          = "D:no-conflicting-lock"
+	ConditionLockTokenMatchesRequestURI = "D:lock-token-matches-request-uri"
+	ConditionPropfindFiniteDepth        = "D:propfind-finite-depth"
+	ConditionQuotaNotExceeded           = "D:quota-not-exceeded"
+)
+
+// DAVError 带前置条件或后置条件的错误响应（RFC 4918 8.7、16），所有方法的条件错误都通过writeDAVError发送
+type DAVError struct {
+	Status int
+	// Condition 条件元素名，带D:、C:或CARD:前缀；为空时只输出说明
+	Condition string
+	// Hrefs 条件元素中的D:href，如被锁定的资源或冲突锁的锁根
+	Hrefs []string
+	// Href 没有标准条件的错误（只读目录、文件名规则）中出错的资源，输出在条件元素之外
+	Href string
+	// Message 给用户看的说明，输出为D:message
+	Message string
+	// LockToken和Owner 423响应中阻止请求的锁，同时通过Lock-Token头返回
+	LockToken string
+	Owner     string
+}
+
+func (e *DAVError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Condition)
+}
+
+// davErrorCondition 条件元素，只有锁相关的条件包含D:href
+type davErrorCondition struct {
+	XMLName xml.Name
+	Hrefs   []string `xml:"D:href,omitempty"`
+}
+
+// davErrorBody D:error响应体，声明D、C、CARD三个前缀以便条件元素直接使用带前缀的名称
+type davErrorBody struct {
+	XMLName   xml.Name `xml:"D:error"`
+	XMLNSD    string   `xml:"xmlns:D,attr"`
+	XMLNSC    string   `xml:"xmlns:C,attr"`
+	XMLNSCard string   `xml:"xmlns:CARD,attr"`
+	Condition *davErrorCondition
+	Href      string `xml:"D:href,omitempty"`
+	LockToken string `xml:"D:locktoken,omitempty"`
+	Owner     string `xml:"D:owner,omitempty"`
+	Message   string `xml:"D:message,omitempty"`
+}
+
+// newDAVErrorBody 构造错误响应体
+func newDAVErrorBody(e *DAVError) davErrorBody {
+	body := davErrorBody{
+		XMLNSD:    "DAV:",
+		XMLNSC:    NamespaceCalDAV,
+		XMLNSCard: NamespaceCardDAV,
+		Href:      e.Href,
+		LockToken: e.LockToken,
+		Owner:     e.Owner,
+		Message:   e.Message,
+	}
+	if e.Condition != "" {
+		body.Condition = &davErrorCondition{XMLName: xml.Name{Local: e.Condition}, Hrefs: e.Hrefs}
+	}
+	return body
+}
+
+// writeDAVError 发送D:error错误响应。423响应附带Retry-After，并通过Lock-Token头返回阻止请求的锁
+func writeDAVError(c *gin.Context, e *DAVError) {
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	if e.Status == http.StatusLocked {
+		c.Header("Retry-After", "60")
+		if e.LockToken != "" {
+			c.Header("Lock-Token", fmt.Sprintf("<%s>", e.LockToken))
+		}
+	}
+	c.Status(e.Status)
+	c.Writer.Write([]byte(xml.Header))
+	xml.NewEncoder(c.Writer).Encode(newDAVErrorBody(e))
+}
+
+// sendDAVError 发送前置条件失败的错误响应
+func (h *Handler) sendDAVError(c *gin.Context, statusCode int, condition string) {
+	writeDAVError(c, &DAVError{Status: statusCode, Condition: condition})
+}
+
+// lockedError 被其他用户的锁阻止时的423错误（lock-token-submitted），href为锁根
+func lockedError(lock *Lock, message string) *DAVError {
+	e := &DAVError{Status: http.StatusLocked, Condition: ConditionLockTokenSubmitted, Message: message}
+	if lock == nil {
+		return e
+	}
+	e.LockToken, e.Owner = lock.Token, lock.Owner
+	if root := lockRootHref(lock); root != "" {
+		e.Hrefs = []string{root}
+	}
+	return e
+}
+
+// lockRootHref 锁的锁根，旧的持久化数据没有锁根时使用锁定路径
+func lockRootHref(lock *Lock) string {
+	if lock.LockRoot != "" {
+		return lock.LockRoot
+	}
+	return lock.Path
+}
+
+// sendQuotaExceeded 上传超出用户剩余配额时发送507 quota-not-exceeded（RFC 4331 6）
+func sendQuotaExceeded(c *gin.Context) {
+	writeDAVError(c, &DAVError{
+		Status:    http.StatusInsufficientStorage,
+		Condition: ConditionQuotaNotExceeded,
+		Message:   ErrQuotaExceeded.Error(),
+	})
+}
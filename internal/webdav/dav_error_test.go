@@ -0,0 +1,77 @@
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDAVError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		err     *DAVError
+		status  int
+		body    []string
+		headers map[string]string
+	}{
+		{
+			name:   "locked",
+			err:    lockedError(&Lock{Token: "opaquelocktoken:1", Owner: "alice", Path: "/docs/a.txt", LockRoot: "/docs/"}, "Resource is locked"),
+			status: http.StatusLocked,
+			body: []string{
+				`<D:lock-token-submitted><D:href>/docs/</D:href></D:lock-token-submitted>`,
+				`<D:locktoken>opaquelocktoken:1</D:locktoken>`,
+				`<D:message>Resource is locked</D:message>`,
+			},
+			headers: map[string]string{"Lock-Token": "<opaquelocktoken:1>", "Retry-After": "60"},
+		},
+		{
+			name:   "finite depth",
+			err:    &DAVError{Status: http.StatusForbidden, Condition: ConditionPropfindFiniteDepth},
+			status: http.StatusForbidden,
+			body:   []string{`<D:error xmlns:D="DAV:"`, `<D:propfind-finite-depth></D:propfind-finite-depth></D:error>`},
+		},
+		{
+			name:   "caldav condition",
+			err:    &DAVError{Status: http.StatusForbidden, Condition: "C:no-uid-conflict"},
+			status: http.StatusForbidden,
+			body:   []string{`<C:no-uid-conflict></C:no-uid-conflict>`},
+		},
+		{
+			name:   "without condition",
+			err:    &DAVError{Status: http.StatusBadRequest, Href: "/a:b", Message: "invalid name"},
+			status: http.StatusBadRequest,
+			body:   []string{`<D:href>/a:b</D:href><D:message>invalid name</D:message></D:error>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			writeDAVError(c, tt.err)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+			for _, want := range tt.body {
+				assert.Contains(t, w.Body.String(), want)
+			}
+			for key, value := range tt.headers {
+				assert.Equal(t, value, w.Header().Get(key))
+			}
+		})
+	}
+}
+
+func TestSendQuotaExceeded(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	sendUploadError(c, ErrQuotaExceeded)
+
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+	assert.Contains(t, w.Body.String(), `<D:quota-not-exceeded></D:quota-not-exceeded>`)
+}
@@ -0,0 +1,176 @@
+package webdav
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// indexEntry 目录列表中的一个子资源
+type indexEntry struct {
+	Name         string    `json:"name"`
+	Href         string    `json:"href"`
+	IsCollection bool      `json:"is_collection"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+}
+
+// directoryIndex 集合GET返回的目录列表
+type directoryIndex struct {
+	Path string `json:"path"`
+	// Parent 上级目录的链接，根目录为空
+	Parent  string       `json:"parent,omitempty"`
+	Entries []indexEntry `json:"entries"`
+	// Truncated 子资源数超出webdav.propfind_max_children时只列出前面的部分
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// directoryIndexTemplate 目录列表页面，不引用任何外部资源
+var directoryIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"size": formatIndexSize,
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.25em 1em 0.25em 0; text-align: left; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Last modified</th></tr>
+{{- if .Parent}}
+<tr><td><a href="{{.Parent}}">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{.Href}}">{{.Name}}{{if .IsCollection}}/{{end}}</a></td><td class="size">{{if not .IsCollection}}{{size .Size}}{{end}}</td><td>{{time .LastModified}}</td></tr>
+{{- end}}
+</table>
+{{- if .Truncated}}
+<p>Only the first {{len .Entries}} entries are shown.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// formatIndexSize 以1024为进制显示文件大小
+func formatIndexSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	value := float64(size)
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + suffixes[i]
+}
+
+// indexHref 资源在当前路由下的链接，路径分段按URL编码，集合以/结尾
+func indexHref(c *gin.Context, resourcePath string, collection bool) string {
+	href := (&url.URL{Path: routePrefix(c) + resourcePath}).EscapedPath()
+	if collection && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return href
+}
+
+// serveDirectoryIndex 列出集合的子资源：浏览器得到HTML页面，Accept: application/json时返回JSON。
+// 与PROPFIND Depth: 1一样跳过没有读取权限的资源和隐藏的Finder元数据文件，数量受webdav.propfind_max_children限制
+func (h *Handler) serveDirectoryIndex(c *gin.Context, uid uuid.UUID, collectionPath string) {
+	// 只有明确要求JSON时返回JSON，其他Accept一律返回HTML
+	format := c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON)
+	if format != gin.MIMEJSON {
+		format = gin.MIMEHTML
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Header("Cache-Control", "no-cache")
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", format+"; charset=utf-8")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	index := directoryIndex{Path: collectionPath, Entries: []indexEntry{}}
+	if collectionPath != "/" {
+		index.Parent = indexHref(c, path.Dir(strings.TrimSuffix(collectionPath, "/")), true)
+	}
+
+	limit := h.config.PropfindMaxChildren
+	err := h.storage.WalkObjects(c.Request.Context(), uid, collectionPath, false, func(obj minio.ObjectInfo) error {
+		if limit > 0 && len(index.Entries) >= limit {
+			index.Truncated = true
+			return storage.ErrStopWalk
+		}
+		objPath := "/" + obj.Key
+		if !h.canRead(c, objPath) || h.hidesMacOSMetadata(objPath) {
+			return nil
+		}
+
+		entry := indexEntry{
+			Name:         path.Base(objPath),
+			Href:         indexHref(c, objPath, false),
+			LastModified: obj.LastModified,
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			entry.IsCollection = true
+		} else {
+			entry.Size = obj.Size
+			entry.ContentType = contenttype.Resolve(objPath, obj.ContentType)
+			entry.ETag = storage.ContentETag(obj)
+		}
+		index.Entries = append(index.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Directory index of %s failed: %v", collectionPath, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// 目录在前，同类按名称排序（不区分大小写）
+	sort.SliceStable(index.Entries, func(i, j int) bool {
+		a, b := index.Entries[i], index.Entries[j]
+		if a.IsCollection != b.IsCollection {
+			return a.IsCollection
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	if format == gin.MIMEJSON {
+		c.JSON(http.StatusOK, index)
+		return
+	}
+	// 文件名来自用户，模板已转义；再禁止脚本以防万一
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := directoryIndexTemplate.Execute(c.Writer, index); err != nil {
+		log.Printf("Directory index of %s failed: %v", collectionPath, err)
+	}
+}
@@ -0,0 +1,51 @@
+package webdav
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatIndexSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 40, "3.0 TiB"},
+		{2048 << 50, "2048.0 PiB"},
+	}
+	for _, tt := range tests {
+		if got := formatIndexSize(tt.size); got != tt.want {
+			t.Errorf("formatIndexSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestDirectoryIndexTemplateEscapesNames(t *testing.T) {
+	index := directoryIndex{
+		Path:   "/docs/",
+		Parent: "/webdav/",
+		Entries: []indexEntry{
+			{Name: "<script>alert(1)</script>.txt", Href: "/webdav/docs/%3Cscript%3E.txt", Size: 10, LastModified: time.Unix(0, 0)},
+			{Name: "sub", Href: "/webdav/docs/sub/", IsCollection: true, LastModified: time.Unix(0, 0)},
+		},
+	}
+	var out strings.Builder
+	if err := directoryIndexTemplate.Execute(&out, index); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	html := out.String()
+	if strings.Contains(html, "<script>") {
+		t.Errorf("file name was not escaped:\n%s", html)
+	}
+	for _, want := range []string{`href="/webdav/"`, `href="/webdav/docs/sub/">sub/</a>`, "10 B", "1970-01-01 00:00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("index page missing %q:\n%s", want, html)
+		}
+	}
+}
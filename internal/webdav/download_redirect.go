@@ -0,0 +1,42 @@
+package webdav
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// SetDownloadRedirect 启用大文件下载重定向，GET不小于min_size的文件时返回307和预签名URL
+func (h *Handler) SetDownloadRedirect(cfg config.DownloadRedirectConfig) {
+	h.downloadRedirect = cfg
+}
+
+// redirectDownload 将大文件的GET重定向到存储的预签名URL，已发送307时返回true。
+// 后端不支持或生成URL失败时返回false，由网关照常转发内容
+func (h *Handler) redirectDownload(c *gin.Context, uid uuid.UUID, resourcePath string, info *minio.ObjectInfo) bool {
+	cfg := h.downloadRedirect
+	if !cfg.Enabled || info.Size < cfg.MinSize {
+		return false
+	}
+	location, err := h.storage.PresignGet(c.Request.Context(), uid, resourcePath, cfg.TTL, storage.PresignGetOptions{
+		ContentType: contenttype.Resolve(resourcePath, info.ContentType),
+	})
+	if err != nil {
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			log.Printf("Warning: download redirect for %s: %v", resourcePath, err)
+		}
+		return false
+	}
+	// URL带有签名且很快过期，不能被缓存
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusTemporaryRedirect, location)
+	return true
+}
@@ -0,0 +1,29 @@
+package webdav
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// resourceETag 对外报告的ETag（带引号），由对象内容决定，COPY、MOVE后保持不变
+func resourceETag(info minio.ObjectInfo) string {
+	return `"` + storage.ContentETag(info) + `"`
+}
+
+// legacyETag 旧版本按修改时间和大小生成的ETag，MOVE后会变化，大小相同的文件也可能重复
+func legacyETag(info minio.ObjectInfo) string {
+	return fmt.Sprintf(`"%d-%d"`, info.LastModified.Unix(), info.Size)
+}
+
+// matchesETag 判断条件请求中的ETag是否指向资源当前的内容，开启webdav.legacy_etags时也接受旧版ETag
+func (h *Handler) matchesETag(candidate string, info minio.ObjectInfo) bool {
+	candidate = strings.TrimSpace(candidate)
+	if candidate == resourceETag(info) {
+		return true
+	}
+	return h.config.LegacyETags && candidate == legacyETag(info)
+}
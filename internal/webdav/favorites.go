@@ -0,0 +1,322 @@
+package webdav
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// FavoritePropertyName ownCloud/Nextcloud客户端标记收藏的属性名（oc:favorite），值为1或0。
+// 收藏保存在favorites表中，不作为死属性保存；PROPFIND只在收藏的资源上返回该属性
+const FavoritePropertyName = "favorite"
+
+// ErrInvalidFavorite oc:favorite的值不是0或1
+var ErrInvalidFavorite = errors.New("invalid favorite value")
+
+// isFavoriteProperty 判断属性是否为收藏标记
+func isFavoriteProperty(namespace, name string) bool {
+	return namespace == webdavtypes.NamespaceOwnCloud && name == FavoritePropertyName
+}
+
+// parseFavorite 解析oc:favorite的值，空值视为取消收藏
+func parseFavorite(value string) (bool, error) {
+	switch strings.TrimSpace(value) {
+	case "1", "true":
+		return true, nil
+	case "0", "false", "":
+		return false, nil
+	}
+	return false, ErrInvalidFavorite
+}
+
+// favoriteProperty 收藏的资源在属性列表中的活属性，随资源属性一起缓存
+func favoriteProperty(userID, resourcePath string) *DatabaseProperty {
+	return &DatabaseProperty{
+		UserID:    userID,
+		Path:      resourcePath,
+		Namespace: webdavtypes.NamespaceOwnCloud,
+		Name:      FavoritePropertyName,
+		Value:     "1",
+		IsLive:    true,
+	}
+}
+
+// createFavoritesTable 创建收藏表，并把之前作为死属性保存的oc:favorite迁移到表中
+func (s *PropertyService) createFavoritesTable(ctx context.Context) error {
+	createdAt := "INTEGER"
+	if s.dialect == DialectPostgres {
+		createdAt = "BIGINT"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS favorites (
+			user_id TEXT NOT NULL,
+			path TEXT NOT NULL,
+			created_at ` + createdAt + ` NOT NULL,
+			PRIMARY KEY (user_id, path)
+		)`,
+	}
+	if s.dialect == DialectPostgres {
+		// 目录下收藏的前缀查询按字节序做范围扫描
+		statements = append(statements, `CREATE INDEX IF NOT EXISTS idx_favorites_user_path_prefix ON favorites(user_id, path COLLATE "C")`)
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return s.migrateFavoriteProperties(ctx)
+}
+
+// migrateFavoriteProperties 把属性表中的oc:favorite死属性转入收藏表，值不为1的直接删除
+func (s *PropertyService) migrateFavoriteProperties(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	builder := NewSelectBuilder("properties", "user_id", "path", "value").
+		Where("namespace = ? AND name = ?", webdavtypes.NamespaceOwnCloud, FavoritePropertyName)
+	rows, err := tx.QueryContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...)
+	if err != nil {
+		return err
+	}
+	type favorite struct{ userID, path string }
+	var favorites []favorite
+	for rows.Next() {
+		var f favorite
+		var value sql.NullString
+		if err := rows.Scan(&f.userID, &f.path, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		if fav, _ := parseFavorite(value.String); fav {
+			favorites = append(favorites, f)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range favorites {
+		if err := s.setFavoriteTx(ctx, tx, f.userID, f.path, true); err != nil {
+			return err
+		}
+	}
+	deleteBuilder := NewDeleteBuilder("properties").
+		Where("namespace = ? AND name = ?", webdavtypes.NamespaceOwnCloud, FavoritePropertyName)
+	if _, err := tx.ExecContext(ctx, s.dialect.Rebind(deleteBuilder.Build()), deleteBuilder.Args()...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setFavoriteTx 事务中收藏或取消收藏资源，路径统一保存为不带结尾/的形式
+func (s *PropertyService) setFavoriteTx(ctx context.Context, tx *sql.Tx, userID, resourcePath string, favorite bool) error {
+	resourcePath = trimPropertyPath(resourcePath)
+	var err error
+	if favorite {
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind(
+			`INSERT INTO favorites (user_id, path, created_at) VALUES (?, ?, ?) ON CONFLICT (user_id, path) DO NOTHING`),
+			userID, resourcePath, time.Now().Unix())
+	} else {
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind(`DELETE FROM favorites WHERE user_id = ? AND path = ?`),
+			userID, resourcePath)
+	}
+	if err != nil {
+		return fmt.Errorf("更新收藏失败: %v", err)
+	}
+	return nil
+}
+
+// isFavorite 查询资源是否被收藏
+func (s *PropertyService) isFavorite(ctx context.Context, userID, resourcePath string) (bool, error) {
+	var exists int
+	err := NewSelectBuilder("favorites", "1").
+		Where("user_id = ? AND path = ?", userID, trimPropertyPath(resourcePath)).
+		QueryRowWith(ctx, s.stmts).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询收藏失败: %v", err)
+	}
+	return true, nil
+}
+
+// favoritesByPathPrefix 列出路径以prefix开头的收藏，prefix按字面匹配
+func (s *PropertyService) favoritesByPathPrefix(ctx context.Context, userID, prefix string) ([]string, error) {
+	column := "path"
+	if s.dialect == DialectPostgres {
+		column = `path COLLATE "C"`
+	}
+	builder := NewSelectBuilder("favorites", "path").
+		Where("user_id = ?", userID).
+		OrderBy("path")
+	if prefix != "" {
+		builder.And(column+" >= ?", prefix)
+	}
+	if upper, ok := prefixUpperBound(prefix); ok {
+		builder.And(column+" < ?", upper)
+	}
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询收藏失败: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("查询收藏失败: %v", err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// ListFavorites 列出用户收藏的资源路径（不带结尾/），scope不为空时只列出该目录下的收藏
+func (s *PropertyService) ListFavorites(ctx context.Context, userID, scope string) ([]string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	root := trimPropertyPath(normalizeCollectionPath(scope))
+	paths, err := s.favoritesByPathPrefix(ctx, userID, root)
+	if err != nil {
+		return nil, err
+	}
+	favorites := make([]string, 0, len(paths))
+	for _, p := range paths {
+		// 名称以目录名开头的兄弟资源不在范围内；根目录不作为收藏返回
+		if p == "" || (root != "" && p != root && !strings.HasPrefix(p, root+"/")) {
+			continue
+		}
+		favorites = append(favorites, p)
+	}
+	return favorites, nil
+}
+
+// moveFavoritesTx 事务中把源路径（recursive时包括子树）的收藏移到目标路径，目标路径上原有的收藏被替换
+func (s *PropertyService) moveFavoritesTx(ctx context.Context, tx *sql.Tx, userID, srcPath, dstPath string, recursive bool) error {
+	if err := s.deleteFavoritesTx(ctx, tx, userID, dstPath, recursive); err != nil {
+		return err
+	}
+
+	condition, args := treePropertyCondition(userID, srcPath, recursive)
+	builder := NewSelectBuilder("favorites", "path").Where(condition, args...)
+	rows, err := tx.QueryContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...)
+	if err != nil {
+		return fmt.Errorf("移动收藏失败: %v", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return fmt.Errorf("移动收藏失败: %v", err)
+		}
+		paths = append(paths, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("移动收藏失败: %v", err)
+	}
+
+	srcRoot, dstRoot := trimPropertyPath(srcPath), trimPropertyPath(dstPath)
+	for _, p := range paths {
+		_, err := tx.ExecContext(ctx, s.dialect.Rebind(`UPDATE favorites SET path = ? WHERE user_id = ? AND path = ?`),
+			dstRoot+strings.TrimPrefix(p, srcRoot), userID, p)
+		if err != nil {
+			return fmt.Errorf("移动收藏失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteFavoritesTx 事务中删除路径（recursive时包括子树）的收藏
+func (s *PropertyService) deleteFavoritesTx(ctx context.Context, tx *sql.Tx, userID, resourcePath string, recursive bool) error {
+	condition, args := treePropertyCondition(userID, resourcePath, recursive)
+	builder := NewDeleteBuilder("favorites").Where(condition, args...)
+	if _, err := tx.ExecContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...); err != nil {
+		return fmt.Errorf("删除收藏失败: %v", err)
+	}
+	return nil
+}
+
+// filterFilesRequest oc:filter-files REPORT请求，桌面和移动客户端用它列出收藏
+type filterFilesRequest struct {
+	XMLName xml.Name `xml:"http://owncloud.org/ns filter-files"`
+	Rules   struct {
+		Favorite *string `xml:"http://owncloud.org/ns favorite"`
+	} `xml:"http://owncloud.org/ns filter-rules"`
+}
+
+// reportFilterFiles 处理oc:filter-files REPORT，列出请求路径下收藏的文件和目录。
+// 只支持oc:favorite规则，其他规则（如系统标签）返回400
+func (h *Handler) reportFilterFiles(c *gin.Context, uid uuid.UUID, body []byte) {
+	var req filterFilesRequest
+	if err := davxml.Unmarshal(body, &req); err != nil || req.Rules.Favorite == nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	favorite, err := parseFavorite(*req.Rules.Favorite)
+	if err != nil || !favorite {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := uid.String()
+	paths, err := h.propertyService.ListFavorites(ctx, userID, c.Param("path"))
+	if err != nil {
+		log.Printf("Warning: failed to list favorites: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	for _, p := range paths {
+		resource, err := h.storage.StatResource(ctx, uid, p)
+		if err != nil || !h.canRead(c, p) {
+			continue // 收藏残留但资源已不存在，或没有读取权限
+		}
+		var resp Response
+		if resource.IsCollection() {
+			modTime := time.Now()
+			if resource.Info != nil {
+				modTime = resource.Info.LastModified
+			}
+			resp = h.createFolderResponse(resource.Path, modTime, userID, h.folderFileID(ctx, uid, resource.Path))
+		} else {
+			info := resource.Info
+			resp = h.createFileResponse(resource.Path, info.Size, info.LastModified, info.ContentType, storage.ContentETag(*info), userID, storage.FileID(*info))
+		}
+		if err := stream.Write(resp); err != nil {
+			log.Printf("REPORT filter-files response failed: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package webdav
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+func isFavoriteResource(t *testing.T, service *PropertyService, userID, resourcePath string) bool {
+	t.Helper()
+	props, err := service.ListResourceProperties(context.Background(), userID, resourcePath)
+	require.NoError(t, err)
+	for _, prop := range props {
+		if isFavoriteProperty(prop.Namespace, prop.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFavorites_PatchMoveDelete(t *testing.T) {
+	service, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	require.NoError(t, err)
+	defer service.Close()
+	ctx := context.Background()
+	require.NoError(t, service.Initialize(ctx))
+
+	favorite := &Property{Namespace: webdavtypes.NamespaceOwnCloud, Name: FavoritePropertyName, Value: "1"}
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/docs/", []*Property{favorite}, nil))
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/docs/a.txt", []*Property{favorite}, nil))
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/docsx.txt", []*Property{favorite}, nil))
+
+	// 收藏不作为死属性保存，也不计入资源的属性
+	props, err := service.listProperties(ctx, "user1", "/docs/a.txt")
+	require.NoError(t, err)
+	assert.Empty(t, props)
+	assert.True(t, isFavoriteResource(t, service, "user1", "/docs"))
+
+	favorites, err := service.ListFavorites(ctx, "user1", "/docs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/docs", "/docs/a.txt"}, favorites)
+
+	require.NoError(t, service.MoveProperties(ctx, "user1", "/docs/", "/archive/", true))
+	favorites, err = service.ListFavorites(ctx, "user1", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/archive", "/archive/a.txt", "/docsx.txt"}, favorites)
+
+	// 取消收藏：值为0或移除属性
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/archive/a.txt",
+		[]*Property{{Namespace: webdavtypes.NamespaceOwnCloud, Name: FavoritePropertyName, Value: "0"}}, nil))
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/docsx.txt", nil,
+		[]*Property{{Namespace: webdavtypes.NamespaceOwnCloud, Name: FavoritePropertyName}}))
+	assert.False(t, isFavoriteResource(t, service, "user1", "/archive/a.txt"))
+
+	require.NoError(t, service.DeletePropertiesRecursive(ctx, "user1", "/archive/"))
+	favorites, err = service.ListFavorites(ctx, "user1", "")
+	require.NoError(t, err)
+	assert.Empty(t, favorites)
+}
+
+func TestFavorites_MigratesDeadProperties(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "properties.db")
+	service, err := NewPropertyService(dbPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, service.createPropertiesTable(ctx))
+	require.NoError(t, service.createIndexes(ctx))
+	service.initialised = true
+	require.NoError(t, service.BatchSetProperties(ctx, "user1", "/a.txt", []*Property{
+		{UserID: "user1", Path: "/a.txt", Namespace: webdavtypes.NamespaceOwnCloud, Name: FavoritePropertyName, Value: "1"},
+		{UserID: "user1", Path: "/a.txt", Namespace: "urn:x", Name: "color", Value: "red"},
+	}))
+	require.NoError(t, service.BatchSetProperties(ctx, "user1", "/b.txt", []*Property{
+		{UserID: "user1", Path: "/b.txt", Namespace: webdavtypes.NamespaceOwnCloud, Name: FavoritePropertyName, Value: "0"},
+	}))
+	require.NoError(t, service.Close())
+
+	service, err = NewPropertyService(dbPath)
+	require.NoError(t, err)
+	defer service.Close()
+	require.NoError(t, service.Initialize(ctx))
+
+	favorites, err := service.ListFavorites(ctx, "user1", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a.txt"}, favorites)
+	props, err := service.listProperties(ctx, "user1", "/a.txt")
+	require.NoError(t, err)
+	require.Len(t, props, 1)
+	assert.Equal(t, "color", props[0].Name)
+}
+
+func TestParseFavorite(t *testing.T) {
+	for value, want := range map[string]bool{"1": true, "true": true, " 1 ": true, "0": false, "": false} {
+		got, err := parseFavorite(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	_, err := parseFavorite("yes")
+	assert.ErrorIs(t, err, ErrInvalidFavorite)
+}
@@ -0,0 +1,37 @@
+package webdav
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/webdav/validators"
+)
+
+// CheckFilename 检查将要创建的资源路径是否符合文件名规则，不符合时发送400并返回true；
+// macOS兼容模式为reject时，Finder元数据文件发送403
+func (h *Handler) CheckFilename(c *gin.Context, resourcePath string) bool {
+	if h.rejectsMacOSMetadata(resourcePath) {
+		sendFilenameError(c, http.StatusForbidden, resourcePath, "macOS metadata files are not accepted")
+		return true
+	}
+
+	err := h.filenamePolicy.Validate(resourcePath)
+	if err == nil {
+		return false
+	}
+
+	var nameErr *validators.FilenameError
+	if !errors.As(err, &nameErr) {
+		c.Status(http.StatusInternalServerError)
+		return true
+	}
+	sendFilenameError(c, http.StatusBadRequest, resourcePath, nameErr.Message)
+	return true
+}
+
+// sendFilenameError 发送带原因说明的文件名错误响应
+func sendFilenameError(c *gin.Context, status int, resourcePath, message string) {
+	writeDAVError(c, &DAVError{Status: status, Href: resourcePath, Message: message})
+}
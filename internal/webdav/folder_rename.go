@@ -0,0 +1,129 @@
+package webdav
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/share"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// FolderRenamer 协调目录改名：对象、属性、分享和锁要么全部指向新路径，要么全部保持原样。
+//
+// 存储后端支持整体改名目录（本地目录后端）时先改名目录，再更新属性和分享，元数据更新失败时把目录改回原名。
+// 其他后端的步骤：1. 复制对象到新目录，失败时删除已复制的对象；
+// 2. 更新属性和分享路径，与分享同库时在同一事务中完成，否则分别提交并在失败时把属性移回；
+// 元数据更新失败时删除已复制的对象；3. 释放源目录上的锁；4. 删除源目录。
+// 第4步失败时元数据已指向完整的新目录，残留的源对象只记录日志，不回滚
+type FolderRenamer struct {
+	storage    *storage.Service
+	properties *PropertyService
+	locks      *LockManager
+	// db 分享所在的主数据库，为nil时不更新分享路径
+	db *sql.DB
+}
+
+// NewFolderRenamer 创建目录改名协调器
+func NewFolderRenamer(storage *storage.Service, properties *PropertyService, locks *LockManager, db *sql.DB) *FolderRenamer {
+	return &FolderRenamer{
+		storage:    storage,
+		properties: properties,
+		locks:      locks,
+		db:         db,
+	}
+}
+
+// IsFolder 判断路径是否为集合（有目录标记或其下存在对象），同名文件不算
+func (r *FolderRenamer) IsFolder(ctx context.Context, userID uuid.UUID, folderPath string) bool {
+	_, err := r.storage.StatResource(ctx, userID, strings.TrimSuffix(folderPath, "/")+"/")
+	return err == nil
+}
+
+// Rename 将目录srcPath改名为dstPath，dstPath必须不存在
+func (r *FolderRenamer) Rename(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) error {
+	srcPath, dstPath = path.Clean("/"+srcPath), path.Clean("/"+dstPath)
+
+	err := r.storage.RenameTree(ctx, userID, srcPath, dstPath)
+	if err == nil {
+		if err := r.moveMetadata(ctx, userID, srcPath, dstPath); err != nil {
+			if undoErr := r.storage.RenameTree(context.WithoutCancel(ctx), userID, dstPath, srcPath); undoErr != nil {
+				log.Printf("Warning: failed to rename folder %s back to %s after failed rename: %v", dstPath, srcPath, undoErr)
+			}
+			return err
+		}
+		r.locks.RemoveLocksUnder(srcPath)
+		return nil
+	}
+	if !errors.Is(err, storage.ErrRenameUnsupported) {
+		return err
+	}
+
+	copied, err := r.storage.CopyTree(ctx, userID, srcPath, dstPath)
+	if err != nil {
+		r.rollbackObjects(userID, copied)
+		return err
+	}
+
+	if err := r.moveMetadata(ctx, userID, srcPath, dstPath); err != nil {
+		r.rollbackObjects(userID, copied)
+		return err
+	}
+
+	r.locks.RemoveLocksUnder(srcPath)
+
+	// 元数据已经提交，源目录的删除不再受请求取消的影响
+	// 源目录的对象已经复制到新位置，用量不变
+	if _, err := r.storage.DeleteFolder(context.WithoutCancel(ctx), userID, srcPath, nil); err != nil {
+		log.Printf("Warning: folder %s renamed to %s but old objects were not fully removed: %v", srcPath, dstPath, err)
+	}
+	return nil
+}
+
+// moveMetadata 更新属性和分享中的路径
+func (r *FolderRenamer) moveMetadata(ctx context.Context, userID uuid.UUID, srcPath, dstPath string) error {
+	uid := userID.String()
+	if r.db == nil {
+		return r.properties.MoveProperties(ctx, uid, srcPath, dstPath, true)
+	}
+
+	if r.properties.UsesDB(r.db) {
+		return r.properties.MovePropertiesWith(ctx, uid, srcPath, dstPath, true, func(tx *sql.Tx) error {
+			_, err := share.RewritePaths(ctx, tx, userID, srcPath, dstPath)
+			return err
+		})
+	}
+
+	// 属性存储在独立的数据库中，无法共用事务：分享更新失败时把属性移回
+	if err := r.properties.MoveProperties(ctx, uid, srcPath, dstPath, true); err != nil {
+		return err
+	}
+	if _, err := share.RewritePaths(ctx, r.db, userID, srcPath, dstPath); err != nil {
+		if undoErr := r.properties.MoveProperties(context.WithoutCancel(ctx), uid, dstPath, srcPath, true); undoErr != nil {
+			log.Printf("Warning: failed to restore properties of %s after failed rename: %v", srcPath, undoErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// rollbackObjects 删除改名过程中已复制到新目录的对象
+func (r *FolderRenamer) rollbackObjects(userID uuid.UUID, copied []string) {
+	if len(copied) == 0 {
+		return
+	}
+	if err := r.storage.DeleteKeys(context.Background(), userID, copied); err != nil {
+		log.Printf("Warning: failed to clean up %d objects after failed folder rename: %v", len(copied), err)
+	}
+}
+
+// isDescendant 判断p是否位于目录root之下（不含root本身）
+func isDescendant(root, p string) bool {
+	root = strings.TrimSuffix(path.Clean("/"+root), "/")
+	return strings.HasPrefix(path.Clean("/"+p), root+"/")
+}
@@ -0,0 +1,159 @@
+package webdav
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/demo"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+func TestIsDescendant(t *testing.T) {
+	tests := []struct {
+		root, p string
+		want    bool
+	}{
+		{"/a", "/a/b", true},
+		{"/a/", "/a/b/c", true},
+		{"/a", "/a", false},
+		{"/a", "/ab", false},
+		{"/a", "/b/a", false},
+		{"/", "/a", true},
+	}
+	for _, tt := range tests {
+		if got := isDescendant(tt.root, tt.p); got != tt.want {
+			t.Errorf("isDescendant(%q, %q) = %v, want %v", tt.root, tt.p, got, tt.want)
+		}
+	}
+}
+
+// copyOnlyBackend 隐藏本地目录后端的目录改名，模拟只能逐个复制的S3后端
+type copyOnlyBackend struct {
+	storage.StorageBackend
+}
+
+// newTestRenamer 本地存储、SQLite属性库和demo分享库上的目录改名协调器，/docs下有一个文件、
+// 一个死属性、一个分享和一个锁
+func newTestRenamer(t *testing.T, copyOnly bool) (*FolderRenamer, uuid.UUID, *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copyOnly {
+		backend = copyOnlyBackend{backend}
+	}
+	store, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := uuid.New()
+	if err := store.EnsureBucket(ctx, uid); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutObject(ctx, uid, "/docs/a.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	properties, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { properties.Close() })
+	if err := properties.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	prop := &Property{Namespace: "urn:test", Name: "color", Value: "red"}
+	if err := properties.PatchProperties(ctx, uid.String(), "/docs/a.txt", []*Property{prop}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := demo.OpenDatabase(ctx, filepath.Join(t.TempDir(), "demo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`INSERT INTO users (id, username, email, password_hash) VALUES ($1, 'alice', 'alice@example.com', 'x')`, uid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO file_shares (id, user_id, file_path, share_token) VALUES ($1, $2, '/docs/a.txt', 'tok')`, uuid.New(), uid); err != nil {
+		t.Fatal(err)
+	}
+
+	locks := newTestLockManager()
+	createTestLock(t, locks, "/docs/a.txt", LockTypeExclusive, uid.String(), 0)
+	return NewFolderRenamer(store, properties, locks, db), uid, db
+}
+
+// checkRenamed 文件、属性和分享全部位于at目录下
+func checkRenamed(t *testing.T, r *FolderRenamer, uid uuid.UUID, db *sql.DB, at, gone string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := r.storage.StatObject(ctx, uid, at+"/a.txt"); err != nil {
+		t.Errorf("object not under %s: %v", at, err)
+	}
+	if _, err := r.storage.StatObject(ctx, uid, gone+"/a.txt"); !storage.IsNotFound(err) {
+		t.Errorf("object still under %s: %v", gone, err)
+	}
+	props, err := r.properties.listProperties(ctx, uid.String(), at+"/a.txt")
+	if err != nil || len(props) != 1 {
+		t.Errorf("properties under %s = %v, %v", at, props, err)
+	}
+	var sharePath string
+	if err := db.QueryRow(`SELECT file_path FROM file_shares WHERE share_token = 'tok'`).Scan(&sharePath); err != nil {
+		t.Fatal(err)
+	}
+	if sharePath != at+"/a.txt" {
+		t.Errorf("share path = %q, want %s/a.txt", sharePath, at)
+	}
+}
+
+func TestFolderRenamerRename(t *testing.T) {
+	for name, copyOnly := range map[string]bool{"prefix rename": false, "copy": true} {
+		t.Run(name, func(t *testing.T) {
+			r, uid, db := newTestRenamer(t, copyOnly)
+			if err := r.Rename(context.Background(), uid, "/docs", "/archive/2024"); err != nil {
+				t.Fatal(err)
+			}
+			checkRenamed(t, r, uid, db, "/archive/2024", "/docs")
+			if locks := r.locks.GetLocksForPath("/docs/a.txt"); len(locks) != 0 {
+				t.Errorf("locks under the old folder were not released: %d", len(locks))
+			}
+		})
+	}
+}
+
+// TestFolderRenamerRollback 分享路径更新失败时对象和属性都回到原目录
+func TestFolderRenamerRollback(t *testing.T) {
+	for name, copyOnly := range map[string]bool{"prefix rename": false, "copy": true} {
+		t.Run(name, func(t *testing.T) {
+			r, uid, db := newTestRenamer(t, copyOnly)
+			if _, err := db.Exec(`DROP TABLE file_shares`); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Rename(context.Background(), uid, "/docs", "/archive"); err == nil {
+				t.Fatal("Rename succeeded although share paths could not be updated")
+			}
+			ctx := context.Background()
+			if _, err := r.storage.StatObject(ctx, uid, "/docs/a.txt"); err != nil {
+				t.Errorf("object not restored: %v", err)
+			}
+			if _, err := r.storage.StatObject(ctx, uid, "/archive/a.txt"); !storage.IsNotFound(err) {
+				t.Errorf("object left under the new folder: %v", err)
+			}
+			if props, err := r.properties.listProperties(ctx, uid.String(), "/docs/a.txt"); err != nil || len(props) != 1 {
+				t.Errorf("properties not restored: %v, %v", props, err)
+			}
+			if locks := r.locks.GetLocksForPath("/docs/a.txt"); len(locks) != 1 {
+				t.Errorf("lock released by a failed rename")
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package webdav
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"encoding/xml"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"path"
 	"strconv"
@@ -13,10 +15,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
 
 	"github.com/webdav-gateway/internal/auth"
+	"github.com/webdav-gateway/internal/casefold"
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
 	"github.com/webdav-gateway/internal/storage"
 	webdavtypes "github.com/webdav-gateway/internal/types"
+	"github.com/webdav-gateway/internal/webdav/validators"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
 )
 
 type Handler struct {
@@ -26,17 +34,65 @@ type Handler struct {
 	propertyService *PropertyService
 	xmlParser       *ProppatchXMLParser
 	responseBuilder *ProppatchResponseBuilder
+	config          config.WebDAVConfig
+	searcher        *Searcher
+	filenamePolicy  *validators.FilenamePolicy
+	propertyPolicy  *validators.PropertyPolicy
+	xmlLimits       davxml.Limits
+	folders         *FolderRenamer
+	tenantQuota     TenantQuota
+	// nameIndex 不区分大小写模式的名称索引
+	nameIndex *casefold.Index
+	// downloadRedirect 大文件GET重定向到预签名URL
+	downloadRedirect config.DownloadRedirectConfig
 }
 
 func NewHandler(storage *storage.Service, auth *auth.Service, propertyService *PropertyService) *Handler {
-	return &Handler{
+	lockManager := NewLockManager()
+	propertyPolicy, _ := newPropertyPolicy(config.PropertyPolicyConfig{})
+	h := &Handler{
 		storage:         storage,
 		auth:            auth,
-		lockManager:     NewLockManager(),
+		lockManager:     lockManager,
 		propertyService: propertyService,
 		xmlParser:       NewProppatchXMLParser(),
 		responseBuilder: NewProppatchResponseBuilder(),
+		propertyPolicy:  propertyPolicy,
+		xmlLimits:       davxml.DefaultLimits,
+		folders:         NewFolderRenamer(storage, propertyService, lockManager, nil),
 	}
+	lockManager.SetExpireHook(h.cleanupNullResource)
+	return h
+}
+
+// LockManager 返回WebDAV锁管理器，供锁管理API使用
+func (h *Handler) LockManager() *LockManager {
+	return h.lockManager
+}
+
+// SetShareDB 设置分享所在的数据库，目录改名时一并更新分享路径
+func (h *Handler) SetShareDB(db *sql.DB) {
+	h.folders.db = db
+}
+
+// SetConfig 设置WebDAV处理配置
+func (h *Handler) SetConfig(cfg config.WebDAVConfig) {
+	h.config = cfg
+	if err := validateMacOSCompat(cfg.MacOSCompat); err != nil {
+		log.Printf("Warning: macOS compatibility mode disabled: %v", err)
+		h.config.MacOSCompat.Mode = MacOSCompatOff
+	}
+	h.filenamePolicy = validators.NewFilenamePolicy(cfg.FilenamePolicy)
+	propertyPolicy, err := newPropertyPolicy(cfg.PropertyPolicy)
+	if err != nil {
+		log.Printf("Warning: property policy namespace rules disabled: %v", err)
+		fallback := cfg.PropertyPolicy
+		fallback.Namespaces = nil
+		propertyPolicy, _ = newPropertyPolicy(fallback)
+	}
+	h.propertyPolicy = propertyPolicy
+	h.xmlLimits = newXMLLimits(cfg.XML)
+	h.lockManager.SetPolicy(cfg.LockPolicy)
 }
 
 type PropfindRequest struct {
@@ -59,6 +115,10 @@ type Prop struct {
 type Multistatus struct {
 	XMLName   xml.Name   `xml:"D:multistatus"`
 	Xmlns     string     `xml:"xmlns:D,attr"`
+	XmlnsOC   string     `xml:"xmlns:oc,attr,omitempty"`
+	XmlnsGW   string     `xml:"xmlns:gw,attr,omitempty"`
+	XmlnsC    string     `xml:"xmlns:C,attr,omitempty"`
+	XmlnsCard string     `xml:"xmlns:CARD,attr,omitempty"`
 	Responses []Response `xml:"D:response"`
 }
 
@@ -66,6 +126,8 @@ type Multistatus struct {
 type Response struct {
 	Href     string                   `xml:"D:href"`
 	Propstat []webdavtypes.Propstat   `xml:"D:propstat"`
+	// Status 资源整体的状态（如calendar-multiget中不存在的href），此时没有propstat
+	Status   string                   `xml:"D:status,omitempty"`
 }
 
 // handler.go中的简化类型别名，兼容现有代码
@@ -74,25 +136,51 @@ type ResponseProp = webdavtypes.ResponseProp
 type ResourceType = webdavtypes.ResourceType
 
 // 创建响应时的辅助函数
-func createSupportedLock() []interface{} {
-	return []interface{}{
-		map[string]interface{}{
-			"lockscope": map[string]interface{}{
-				"exclusive": struct{}{},
-			},
-			"locktype": map[string]interface{}{
-				"write": struct{}{},
-			},
-		},
-		map[string]interface{}{
-			"lockscope": map[string]interface{}{
-				"shared": struct{}{},
-			},
-			"locktype": map[string]interface{}{
-				"write": struct{}{},
-			},
-		},
+// createSupportedLock 返回支持的锁类型：排他写锁，策略允许时还有共享写锁
+func (h *Handler) createSupportedLock() *webdavtypes.SupportedLock {
+	supported := &webdavtypes.SupportedLock{
+		LockEntries: []webdavtypes.LockEntry{{
+			LockScope: webdavtypes.LockScopeInfo{Exclusive: &struct{}{}},
+			LockType:  webdavtypes.LockTypeInfo{Write: &struct{}{}},
+		}},
+	}
+	if h.lockManager == nil || h.lockManager.Policy().AllowShared {
+		supported.LockEntries = append(supported.LockEntries, webdavtypes.LockEntry{
+			LockScope: webdavtypes.LockScopeInfo{Shared: &struct{}{}},
+			LockType:  webdavtypes.LockTypeInfo{Write: &struct{}{}},
+		})
+	}
+	return supported
+}
+
+// lockDiscovery 返回资源上的活动锁（含上级目录的深度锁），超时为剩余秒数
+func (h *Handler) lockDiscovery(href string) *webdavtypes.LockDiscovery {
+	discovery := &webdavtypes.LockDiscovery{}
+	if h.lockManager == nil {
+		return discovery
+	}
+	now := time.Now()
+	for _, lock := range h.lockManager.ActiveLocksFor(href) {
+		remaining := int64(lock.ExpiresAt.Sub(now).Seconds())
+		if remaining < 1 {
+			remaining = 1
+		}
+		active := webdavtypes.ActiveLock{
+			LockType:  webdavtypes.LockTypeInfo{Write: &struct{}{}},
+			Depth:     FormatDepth(lock.Depth),
+			Owner:     lock.OwnerInfo,
+			Timeout:   fmt.Sprintf("Second-%d", remaining),
+			LockToken: &webdavtypes.Href{Href: lock.Token},
+			LockRoot:  &webdavtypes.Href{Href: lock.LockRoot},
+		}
+		if lock.Type == LockTypeExclusive {
+			active.LockScope.Exclusive = &struct{}{}
+		} else {
+			active.LockScope.Shared = &struct{}{}
+		}
+		discovery.ActiveLocks = append(discovery.ActiveLocks, active)
 	}
+	return discovery
 }
 
 func (h *Handler) HandlePropfind(c *gin.Context) {
@@ -104,57 +192,108 @@ func (h *Handler) HandlePropfind(c *gin.Context) {
 		requestPath = "/"
 	}
 
-	depth := c.GetHeader("Depth")
-	if depth == "" {
-		depth = "infinity"
+	depth, ok := h.propfindDepth(c)
+	if !ok {
+		return
+	}
+
+	// 检查访问控制权限，没有读取权限的子资源不列出
+	if h.CheckPrivilege(c, requestPath, PrivilegeRead) {
+		return // CheckPrivilege已经发送了403错误
+	}
+	requestedProps, ok := h.propfindRequestedProps(c)
+	if !ok {
+		return
 	}
 
-	var responses []Response
 	userIDString := uid.String()
+	ctx := c.Request.Context()
+
+	// 不存在的路径返回404；以/结尾的路径只匹配集合
+	resource, ok := h.statResource(c, uid, requestPath)
+	if !ok {
+		return
+	}
+	if resource.IsCollection() && resource.Path != requestPath {
+		// 缺少结尾/的集合直接按集合应答，href和Content-Location使用规范路径
+		c.Header("Content-Location", routePrefix(c)+resource.Path)
+	}
+	requestPath = resource.Path
 
+	// 逐个写出D:response，避免大目录在内存中构建完整的multistatus
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	// 按请求补充访问控制和配额属性后写出
+	write := func(resp Response) error {
+		h.addACLProperties(c, &resp, requestedProps)
+		h.addQuotaProperties(c, &resp, requestedProps)
+		return stream.Write(resp)
+	}
+
+	if !resource.IsCollection() {
+		// 文件没有成员，Depth: 1和infinity同样只返回文件本身
+		info := resource.Info
+		write(h.createFileResponse(requestPath, info.Size, info.LastModified, info.ContentType, storage.ContentETag(*info), userIDString, storage.FileID(*info)))
+		return
+	}
+
+	// 有目录标记时使用标记的修改时间，根目录和隐式目录没有记录
+	modTime := time.Now()
+	if resource.Info != nil {
+		modTime = resource.Info.LastModified
+	}
 	if depth == "0" {
-		// Only the resource itself
-		info, err := h.storage.StatObject(c.Request.Context(), uid, requestPath)
-		if err != nil {
-			// It might be a folder or root
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
-		} else {
-			responses = append(responses, h.createFileResponse(requestPath, info.Size, info.LastModified, info.ContentType, userIDString))
-		}
-	} else {
-		// List directory contents
-		objects, err := h.storage.ListObjects(c.Request.Context(), uid, requestPath, depth == "infinity")
-		if err != nil {
-			// Return root folder
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
-		} else {
-			// Add parent folder
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
-			
-			// Add files and folders
-			for _, obj := range objects {
-				objPath := "/" + obj.Key
-				if strings.HasSuffix(obj.Key, "/") {
-					responses = append(responses, h.createFolderResponse(objPath, obj.LastModified, userIDString))
-				} else {
-					responses = append(responses, h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, userIDString))
-				}
-			}
-		}
+		write(h.createFolderResponse(requestPath, modTime, userIDString, h.folderFileID(ctx, uid, requestPath)))
+		return
 	}
 
-	multistatus := Multistatus{
-		Xmlns:     "DAV:",
-		Responses: responses,
+	// 一次查询载入目录及其子资源的属性，逐个生成响应时直接读取缓存（更深的目录由walkTree预取）
+	h.prefetchProperties(ctx, userIDString, requestPath)
+
+	// Add parent folder
+	if err := write(h.createFolderResponse(requestPath, modTime, userIDString, h.folderFileID(ctx, uid, requestPath))); err != nil {
+		return
 	}
 
-	c.Header("Content-Type", "application/xml; charset=utf-8")
-	c.Status(http.StatusMultiStatus)
-	
-	c.Writer.Write([]byte(xml.Header))
-	encoder := xml.NewEncoder(c.Writer)
-	encoder.Indent("", "  ")
-	encoder.Encode(multistatus)
+	// Add files and folders (truncated at PropfindMaxChildren)
+	limit := h.config.PropfindMaxChildren
+	children := 0
+	truncated := false
+	writeChild := func(obj minio.ObjectInfo) error {
+		if limit > 0 && children >= limit {
+			truncated = true
+			return storage.ErrStopWalk
+		}
+		objPath := "/" + obj.Key
+		if !h.canRead(c, objPath) || h.hidesMacOSMetadata(objPath) {
+			return nil
+		}
+		children++
+
+		if strings.HasSuffix(obj.Key, "/") {
+			return write(h.createFolderResponse(objPath, obj.LastModified, userIDString, storage.FileID(obj)))
+		}
+		return write(h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, storage.ContentETag(obj), userIDString, storage.FileID(obj)))
+	}
+	if depth == "infinity" {
+		err = h.walkTree(ctx, uid, requestPath, writeChild)
+	} else {
+		err = h.storage.WalkObjects(ctx, uid, requestPath, false, writeChild)
+	}
+	if err != nil {
+		// 还没有发送内容时返回500，否则只能记录错误并结束已写出的部分
+		log.Printf("PROPFIND listing %s failed after %d members: %v", requestPath, children, err)
+		stream.Abort()
+		return
+	}
+	if truncated {
+		stream.WriteTruncated(requestPath, limit)
+	}
 }
 
 func (h *Handler) HandleGet(c *gin.Context) {
@@ -163,6 +302,11 @@ func (h *Handler) HandleGet(c *gin.Context) {
 	
 	requestPath := c.Param("path")
 
+	// 检查访问控制权限
+	if h.CheckPrivilege(c, requestPath, PrivilegeRead) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
 	// 检查共享锁定（允许读取）
 	if _, lock := h.CheckSharedLock(c, requestPath); lock != nil {
 		// 允许SHARED锁定的读取操作
@@ -172,26 +316,91 @@ func (h *Handler) HandleGet(c *gin.Context) {
 		}
 	}
 
-	obj, err := h.storage.GetObject(c.Request.Context(), uid, requestPath)
-	if err != nil {
+	// 先获取元数据（HEAD请求，开销小），再按ETag读取，保证分段下载读到同一版本
+	resource, ok := h.statResource(c, uid, requestPath)
+	if !ok {
+		return
+	}
+	if redirectCollection(c, resource, requestPath) {
+		return
+	}
+	if resource.IsCollection() {
+		// 集合没有可下载的内容，开启webdav.directory_index时返回目录列表
+		if h.config.DirectoryIndex {
+			h.serveDirectoryIndex(c, uid, resource.Path)
+			return
+		}
 		c.Status(http.StatusNotFound)
 		return
 	}
-	defer obj.Close()
+	info := resource.Info
+	etag := resourceETag(*info)
+	modified := h.modTime(userID, resource.Path, info.LastModified)
+
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && ifMatch != "*" && !h.matchesETag(ifMatch, *info) {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+	if h.notModified(c.Request, *info, modified) {
+		c.Header("ETag", etag)
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// 条件请求已在上面处理，范围请求由存储按Range头直接响应
+	if h.redirectDownload(c, uid, resource.Path, info) {
+		return
+	}
+
+	rng, err := parseByteRange(c.GetHeader("Range"), info.Size)
+	if ifRange := c.GetHeader("If-Range"); ifRange != "" && !h.matchesETag(ifRange, *info) {
+		// 文件已变化，返回完整的新内容
+		rng, err = nil, nil
+	}
+	if err == errRangeNotSatisfiable {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
 
-	stat, err := obj.Stat()
+	start, end := int64(-1), int64(-1)
+	if rng != nil {
+		start, end = rng.start, rng.end
+	}
+	obj, err := h.storage.GetObjectRange(c.Request.Context(), uid, requestPath, start, end, info.ETag)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
+	defer obj.Close()
 
-	c.Header("Content-Type", stat.ContentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", stat.Size))
-	c.Header("Last-Modified", stat.LastModified.Format(http.TimeFormat))
-	c.Header("ETag", fmt.Sprintf(`"%s"`, stat.ETag))
+	// Stat触发实际请求；对象在元数据读取后被覆盖时返回412，客户端应重新开始下载
+	if _, err := obj.Stat(); err != nil {
+		if storage.IsPreconditionFailed(err) {
+			c.Status(http.StatusPreconditionFailed)
+		} else if storage.IsNotFound(err) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
 
-	c.Status(http.StatusOK)
-	io.Copy(c.Writer, obj)
+	c.Header("Content-Type", contenttype.Resolve(requestPath, info.ContentType))
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	c.Header("ETag", etag)
+	c.Header("Accept-Ranges", "bytes")
+
+	if rng != nil {
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.end, info.Size))
+		c.Header("Content-Length", fmt.Sprintf("%d", rng.length()))
+		c.Status(http.StatusPartialContent)
+	} else {
+		c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
+		c.Status(http.StatusOK)
+	}
+	// 客户端断开时停止从存储后端读取剩余内容
+	storage.CopyContext(c.Request.Context(), c.Writer, obj)
 }
 
 func (h *Handler) HandleHead(c *gin.Context) {
@@ -200,6 +409,11 @@ func (h *Handler) HandleHead(c *gin.Context) {
 	
 	requestPath := c.Param("path")
 
+	// 检查访问控制权限
+	if h.CheckPrivilege(c, requestPath, PrivilegeRead) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
 	// 检查共享锁定（允许读取）
 	if _, lock := h.CheckSharedLock(c, requestPath); lock != nil {
 		// 允许SHARED锁定的读取操作
@@ -209,16 +423,33 @@ func (h *Handler) HandleHead(c *gin.Context) {
 		}
 	}
 
-	info, err := h.storage.StatObject(c.Request.Context(), uid, requestPath)
-	if err != nil {
+	resource, ok := h.statResource(c, uid, requestPath)
+	if !ok {
+		return
+	}
+	if redirectCollection(c, resource, requestPath) {
+		return
+	}
+	if resource.IsCollection() {
+		if h.config.DirectoryIndex {
+			h.serveDirectoryIndex(c, uid, resource.Path)
+			return
+		}
 		c.Status(http.StatusNotFound)
 		return
 	}
+	info := resource.Info
+	modified := h.modTime(userID, resource.Path, info.LastModified)
 
-	c.Header("Content-Type", info.ContentType)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	c.Header("ETag", resourceETag(*info))
+	if h.notModified(c.Request, *info, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Type", contenttype.Resolve(requestPath, info.ContentType))
 	c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
-	c.Header("Last-Modified", info.LastModified.Format(http.TimeFormat))
-	c.Header("ETag", fmt.Sprintf(`"%s"`, info.ETag))
+	c.Header("Accept-Ranges", "bytes")
 	c.Status(http.StatusOK)
 }
 
@@ -228,9 +459,37 @@ func (h *Handler) HandlePut(c *gin.Context) {
 	
 	requestPath := c.Param("path")
 
-	// 检查EXCLUSIVE锁定
-	if locked, _ := h.CheckExclusiveLock(c, requestPath); locked {
-		return // CheckExclusiveLock已经发送了423错误
+	// 检查文件名规则
+	if h.CheckFilename(c, requestPath) {
+		return // CheckFilename已经发送了400或403错误
+	}
+
+	// 检查访问控制权限：覆盖需要write-content，新建需要上级目录的bind
+	if h.CheckWritePrivilege(c, requestPath) {
+		return // CheckWritePrivilege已经发送了403错误
+	}
+
+	// 检查只读目录
+	if h.CheckReadOnly(c, requestPath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
+	// 集合不能通过PUT写入内容（RFC 4918 9.7.2），以/结尾的路径总是指向集合
+	if strings.HasSuffix(requestPath, "/") {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+	if resource, err := h.storage.StatResource(c.Request.Context(), uid, requestPath); err == nil && resource.IsCollection() {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	} else if err != nil && !storage.IsNotFound(err) {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// 检查锁定（共享锁同样只允许持有者写入）
+	if locked, _ := h.CheckAnyLock(c, requestPath); locked {
+		return // CheckAnyLock已经发送了423错误
 	}
 
 	// 检查父目录锁定
@@ -238,20 +497,102 @@ func (h *Handler) HandlePut(c *gin.Context) {
 		return // CheckParentLocks已经发送了423错误
 	}
 
+	// 日历集合、通讯录中的对象需要通过iCalendar/vCard校验并建立索引
+	if parent := path.Dir(path.Clean("/" + requestPath)); h.isCalendarCollection(userID, parent) {
+		h.putCalendarObject(c, uid, requestPath)
+		return
+	} else if h.isAddressbookCollection(userID, parent) {
+		h.putAddressObject(c, uid, requestPath)
+		return
+	}
+
 	contentType := c.GetHeader("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+
+	// 覆盖写入时只按新旧大小之差更新用量
+	var previousSize int64
+	info, err := h.storage.StatObject(c.Request.Context(), uid, requestPath)
+	overwrite := err == nil
+	if !overwrite {
+		info = nil
 	}
 
-	err := h.storage.PutObject(c.Request.Context(), uid, requestPath, c.Request.Body, c.Request.ContentLength, contentType)
+	// If-Match与当前版本不一致时返回412或写入冲突副本
+	target, ok := h.resolvePutConflict(c, uid, requestPath, info)
+	if !ok {
+		return // resolvePutConflict已经发送了错误响应
+	}
+	if target != requestPath {
+		requestPath, overwrite, info = target, false, nil
+	}
+	if overwrite {
+		previousSize = info.Size
+	}
+
+	// 处理Content-Encoding: gzip等预压缩的请求体
+	body, decoded, ok := h.decodeUploadBody(c, uid, previousSize)
+	if !ok {
+		return // decodeUploadBody已经发送了错误响应
+	}
+
+	// 客户端未声明具体类型时按扩展名和（解压后）内容开头的字节判断，作为对象元数据保存
+	if contenttype.IsGeneric(contentType) {
+		contentType, body, err = contenttype.Sniff(requestPath, body)
+		if err != nil {
+			sendUploadError(c, err)
+			return
+		}
+	}
+	size := c.Request.ContentLength
+	// 隐藏的Finder元数据文件不计入用量
+	quotaExempt := h.hidesMacOSMetadata(requestPath)
+	if decoded != nil {
+		size = -1 // 解压后的大小未知
+	} else if size < 0 && !quotaExempt {
+		// 分块传输编码（curl -T -等）没有Content-Length，无法预先检查配额，改为边读取边检查
+		if quota := h.remainingQuota(c.Request.Context(), uid, previousSize); quota >= 0 {
+			body = &quotaReader{r: body, quota: quota}
+		}
+	}
+
+	// 边上传边计算摘要，与Content-MD5/X-Checksum-SHA256不一致时中止写入
+	checksum, err := newChecksumReader(c, body, size)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	// Update user storage
-	h.auth.UpdateStorageUsed(c.Request.Context(), uid, c.Request.ContentLength)
+	// 长度未知时存储端按固定分片大小以分片上传方式写入，内存占用有上限；
+	// 覆盖写入时沿用上面查询到的原对象的文件ID
+	err = h.storage.ReplaceObject(c.Request.Context(), uid, requestPath, checksum, size, contentType, info)
+	if err != nil {
+		sendUploadError(c, err)
+		return
+	}
 
+	// 按实际写入的字节数（解压后）核算用量，不依赖Content-Length
+	if !quotaExempt {
+		h.auth.UpdateStorageUsed(c.Request.Context(), uid, checksum.n-previousSize)
+	}
+
+	md5Hex, sha256Hex := checksum.sums()
+	if err := h.propertyService.SetChecksums(c.Request.Context(), userID, requestPath, md5Hex, sha256Hex); err != nil {
+		log.Printf("Warning: failed to record checksum for %s: %v", requestPath, err)
+	}
+	// 新建文件记录创建时间，覆盖写入保留原有的创建时间
+	var created time.Time
+	if !overwrite {
+		created = time.Now()
+	}
+	if err := h.propertyService.SetUploadTimes(c.Request.Context(), userID, requestPath, created, uploadMtime(c)); err != nil {
+		log.Printf("Warning: failed to record timestamps for %s: %v", requestPath, err)
+	}
+	h.lockManager.ClearNullResource(requestPath)
+
+	// 覆盖已有文件返回204（RFC 4918 9.7.1）
+	if overwrite {
+		c.Status(http.StatusNoContent)
+		return
+	}
 	c.Status(http.StatusCreated)
 }
 
@@ -261,6 +602,16 @@ func (h *Handler) HandleDelete(c *gin.Context) {
 	
 	requestPath := c.Param("path")
 
+	// 检查访问控制权限：删除需要上级目录的unbind
+	if h.CheckParentPrivilege(c, requestPath, PrivilegeUnbind) {
+		return // CheckParentPrivilege已经发送了403错误
+	}
+
+	// 检查只读目录（包括被删除目录下的只读子目录）
+	if h.CheckReadOnlyTree(c, requestPath) {
+		return // CheckReadOnlyTree已经发送了403错误
+	}
+
 	// 检查任何类型的锁定
 	if locked, _ := h.CheckAnyLock(c, requestPath); locked {
 		return // CheckAnyLock已经发送了423错误
@@ -272,18 +623,38 @@ func (h *Handler) HandleDelete(c *gin.Context) {
 	}
 
 	// Get size before deletion
-	info, err := h.storage.StatObject(c.Request.Context(), uid, requestPath)
-	if err == nil {
-		// It's a file
+	resource, ok := h.statResource(c, uid, requestPath)
+	if !ok {
+		return
+	}
+	if !resource.IsCollection() {
+		info := resource.Info
 		if err := h.storage.DeleteObject(c.Request.Context(), uid, requestPath); err != nil {
 			c.Status(http.StatusInternalServerError)
 			return
 		}
 		// Update storage
-		h.auth.UpdateStorageUsed(c.Request.Context(), uid, -info.Size)
+		if !h.hidesMacOSMetadata(requestPath) {
+			h.auth.UpdateStorageUsed(c.Request.Context(), uid, -info.Size)
+		}
+
+		// 清理属性，避免同路径新建的文件继承旧的元数据
+		if err := h.propertyService.DeletePropertiesForPath(c.Request.Context(), userID, requestPath); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
 	} else {
-		// Try as folder
-		if err := h.storage.DeleteFolder(c.Request.Context(), uid, requestPath); err != nil {
+		// 按实际删除的字节数调整用量，删除中途失败时已删除的部分也要扣除
+		stats, err := h.storage.DeleteFolder(c.Request.Context(), uid, requestPath, h.QuotaExempt)
+		h.auth.UpdateStorageUsed(context.WithoutCancel(c.Request.Context()), uid, -stats.Bytes)
+		if err != nil {
+			log.Printf("DELETE %s failed after removing %d objects: %v", requestPath, stats.Objects, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		// 清理目录及其子树的属性
+		if err := h.propertyService.DeletePropertiesRecursive(c.Request.Context(), userID, requestPath); err != nil {
 			c.Status(http.StatusInternalServerError)
 			return
 		}
@@ -298,16 +669,94 @@ func (h *Handler) HandleMkcol(c *gin.Context) {
 	
 	requestPath := c.Param("path")
 
+	// 检查文件名规则
+	if h.CheckFilename(c, requestPath) {
+		return // CheckFilename已经发送了400或403错误
+	}
+
+	// 检查访问控制权限：创建需要上级目录的bind
+	if h.CheckParentPrivilege(c, requestPath, PrivilegeBind) {
+		return // CheckParentPrivilege已经发送了403错误
+	}
+
+	// 检查只读目录
+	if h.CheckReadOnly(c, requestPath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
 	// 检查父目录锁定
 	if locked, _ := h.CheckParentLocks(c, requestPath); locked {
 		return // CheckParentLocks已经发送了423错误
 	}
 
-	err := h.storage.CreateFolder(c.Request.Context(), uid, requestPath)
-	if err != nil {
+	// 只支持扩展MKCOL（RFC 5689）的请求体，用于创建日历或通讯录集合，其他请求体返回415（RFC 4918 9.3）
+	var extended *extendedMkcolRequest
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+	if body != nil {
+		var err error
+		if extended, err = parseExtendedMkcol(body); err != nil {
+			c.Status(http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	kind, ok := extended.collectionKind()
+	if !ok {
+		h.sendDAVError(c, http.StatusForbidden, "D:valid-resourcetype")
+		return
+	}
+
+	ctx := c.Request.Context()
+	collectionPath := path.Clean("/" + requestPath)
+
+	// 资源已存在
+	if h.resourceExists(ctx, uid, collectionPath) {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 日历、通讯录集合不能嵌套在同类集合中
+	switch {
+	case kind == collectionKindCalendar && h.hasCollectionAncestor(userID, collectionPath, h.isCalendarCollection):
+		h.sendDAVError(c, http.StatusForbidden, "C:calendar-collection-location-ok")
+		return
+	case kind == collectionKindAddressbook && h.hasCollectionAncestor(userID, collectionPath, h.isAddressbookCollection):
+		h.sendDAVError(c, http.StatusForbidden, "CARD:addressbook-collection-location-ok")
+		return
+	}
+
+	// 父集合不存在时返回409，除非请求X-Create-Parents: T
+	parents, ok := h.missingParents(ctx, uid, collectionPath)
+	if !ok || (len(parents) > 0 && !createParentsRequested(c)) {
 		c.Status(http.StatusConflict)
 		return
 	}
+	for _, parent := range parents {
+		if err := h.storage.CreateFolder(ctx, uid, parent); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.storage.CreateFolder(ctx, uid, collectionPath); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	var err error
+	switch kind {
+	case collectionKindCalendar:
+		err = h.markCalendar(ctx, userID, collectionPath, defaultCalendarComponents, extended.Set.Prop.CalendarDescription)
+	case collectionKindAddressbook:
+		err = h.markAddressbook(ctx, userID, collectionPath, extended.Set.Prop.AddressbookDescription)
+	}
+	if err != nil {
+		log.Printf("MKCOL %s failed to mark %s collection: %v", collectionPath, kind, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
 
 	c.Status(http.StatusCreated)
 }
@@ -317,18 +766,28 @@ func (h *Handler) HandleMove(c *gin.Context) {
 	uid, _ := uuid.Parse(userID)
 	
 	srcPath := c.Param("path")
-	dstPath := c.GetHeader("Destination")
-	
-	if dstPath == "" {
-		c.Status(http.StatusBadRequest)
+	dstPath, ok := h.destinationPath(c)
+	if !ok {
+		return // destinationPath已经发送了400错误
+	}
+	dstPath, ok = h.resolveDestinationCase(c, uid, srcPath, dstPath)
+	if !ok {
 		return
 	}
 
-	// Extract path from destination URL
-	dstPath = strings.TrimPrefix(dstPath, "http://")
-	dstPath = strings.TrimPrefix(dstPath, "https://")
-	if idx := strings.Index(dstPath, "/"); idx >= 0 {
-		dstPath = dstPath[idx:]
+	// 检查目标的文件名规则
+	if h.CheckFilename(c, dstPath) {
+		return // CheckFilename已经发送了400或403错误
+	}
+
+	// 检查访问控制权限：源上级目录的unbind和目标上级目录的bind
+	if h.CheckParentPrivilege(c, srcPath, PrivilegeUnbind) || h.CheckParentPrivilege(c, dstPath, PrivilegeBind) {
+		return // CheckParentPrivilege已经发送了403错误
+	}
+
+	// 检查源和目标是否位于只读目录
+	if h.CheckReadOnlyTree(c, srcPath) || h.CheckReadOnly(c, dstPath) {
+		return // 已经发送了403错误
 	}
 
 	// 检查源资源锁定
@@ -337,8 +796,14 @@ func (h *Handler) HandleMove(c *gin.Context) {
 	}
 
 	// 检查目标资源锁定
-	if locked, _ := h.CheckExclusiveLock(c, dstPath); locked {
-		return // CheckExclusiveLock已经发送了423错误
+	if locked, _ := h.CheckAnyLock(c, dstPath); locked {
+		return // CheckAnyLock已经发送了423错误
+	}
+
+	// 目录改名由FolderRenamer协调对象、属性、分享和锁
+	if _, err := h.storage.StatObject(c.Request.Context(), uid, srcPath); err != nil && h.folders.IsFolder(c.Request.Context(), uid, srcPath) {
+		h.moveFolder(c, uid, srcPath, dstPath)
+		return
 	}
 
 	overwrite := c.GetHeader("Overwrite")
@@ -357,6 +822,91 @@ func (h *Handler) HandleMove(c *gin.Context) {
 		return
 	}
 
+	// 隐藏的Finder元数据文件改名为普通文件（或反之）时按文件大小调整用量
+	if srcExempt, dstExempt := h.hidesMacOSMetadata(srcPath), h.hidesMacOSMetadata(dstPath); srcExempt != dstExempt {
+		if info, err := h.storage.StatObject(c.Request.Context(), uid, dstPath); err == nil {
+			delta := info.Size
+			if dstExempt {
+				delta = -delta
+			}
+			h.auth.UpdateStorageUsed(c.Request.Context(), uid, delta)
+		}
+	}
+
+	// 死属性随资源（及其子树）一起移动
+	if err := h.propertyService.MoveProperties(c.Request.Context(), userID, srcPath, dstPath, true); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+// moveFolder 移动（改名）目录。目标已存在时按Overwrite删除或返回412，
+// 源目录下有其他用户的锁时返回423
+func (h *Handler) moveFolder(c *gin.Context, uid uuid.UUID, srcPath, dstPath string) {
+	ctx := c.Request.Context()
+	userID := uid.String()
+
+	if path.Clean("/"+srcPath) == path.Clean("/"+dstPath) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if isDescendant(srcPath, dstPath) {
+		c.Status(http.StatusConflict)
+		return
+	}
+	if conflict, lock, _ := h.lockManager.CheckLockConflict(path.Clean("/"+srcPath), LockTypeExclusive, userID, -1); conflict {
+		h.SendLockedError(c, lock, "A resource inside the collection is locked")
+		return
+	}
+
+	// 目标已存在时先删除（Overwrite: T）
+	overwritten := false
+	if info, err := h.storage.StatObject(ctx, uid, dstPath); err == nil {
+		if c.GetHeader("Overwrite") == "F" {
+			c.Status(http.StatusPreconditionFailed)
+			return
+		}
+		if err := h.storage.DeleteObject(ctx, uid, dstPath); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		h.auth.UpdateStorageUsed(ctx, uid, -info.Size)
+		overwritten = true
+	} else if h.folders.IsFolder(ctx, uid, dstPath) {
+		if c.GetHeader("Overwrite") == "F" {
+			c.Status(http.StatusPreconditionFailed)
+			return
+		}
+		if h.CheckReadOnlyTree(c, dstPath) {
+			return // CheckReadOnlyTree已经发送了403错误
+		}
+		stats, err := h.storage.DeleteFolder(ctx, uid, dstPath, h.QuotaExempt)
+		h.auth.UpdateStorageUsed(context.WithoutCancel(ctx), uid, -stats.Bytes)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		overwritten = true
+	}
+	if overwritten {
+		if err := h.propertyService.DeletePropertiesRecursive(ctx, userID, dstPath); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.folders.Rename(ctx, uid, srcPath, dstPath); err != nil {
+		log.Printf("MOVE %s -> %s failed: %v", srcPath, dstPath, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if overwritten {
+		c.Status(http.StatusNoContent)
+		return
+	}
 	c.Status(http.StatusCreated)
 }
 
@@ -365,17 +915,28 @@ func (h *Handler) HandleCopy(c *gin.Context) {
 	uid, _ := uuid.Parse(userID)
 	
 	srcPath := c.Param("path")
-	dstPath := c.GetHeader("Destination")
-	
-	if dstPath == "" {
-		c.Status(http.StatusBadRequest)
+	dstPath, ok := h.destinationPath(c)
+	if !ok {
+		return // destinationPath已经发送了400错误
+	}
+	dstPath, ok = h.resolveDestinationCase(c, uid, srcPath, dstPath)
+	if !ok {
 		return
 	}
 
-	dstPath = strings.TrimPrefix(dstPath, "http://")
-	dstPath = strings.TrimPrefix(dstPath, "https://")
-	if idx := strings.Index(dstPath, "/"); idx >= 0 {
-		dstPath = dstPath[idx:]
+	// 检查目标的文件名规则
+	if h.CheckFilename(c, dstPath) {
+		return // CheckFilename已经发送了400或403错误
+	}
+
+	// 检查访问控制权限：读取源资源，目标上级目录的bind
+	if h.CheckPrivilege(c, srcPath, PrivilegeRead) || h.CheckParentPrivilege(c, dstPath, PrivilegeBind) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
+	// 检查目标是否位于只读目录
+	if h.CheckReadOnly(c, dstPath) {
+		return // CheckReadOnly已经发送了403错误
 	}
 
 	// 检查源资源锁定（允许SHARED锁定的读取）
@@ -386,8 +947,8 @@ func (h *Handler) HandleCopy(c *gin.Context) {
 	}
 
 	// 检查目标资源锁定
-	if locked, _ := h.CheckExclusiveLock(c, dstPath); locked {
-		return // CheckExclusiveLock已经发送了423错误
+	if locked, _ := h.CheckAnyLock(c, dstPath); locked {
+		return // CheckAnyLock已经发送了423错误
 	}
 
 	err := h.storage.CopyObject(c.Request.Context(), uid, srcPath, dstPath)
@@ -396,19 +957,36 @@ func (h *Handler) HandleCopy(c *gin.Context) {
 		return
 	}
 
+	// 死属性随资源一起复制，Depth: 0时只复制资源自身的属性
+	recursive := c.GetHeader("Depth") != "0"
+	if err := h.propertyService.CopyProperties(c.Request.Context(), userID, srcPath, dstPath, recursive); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
 	c.Status(http.StatusCreated)
 }
 
 func (h *Handler) HandleOptions(c *gin.Context) {
-	c.Header("DAV", "1, 2")
+	c.Header("DAV", "1, 2, access-control, calendar-access, addressbook, extended-mkcol, sabredav-partialupdate")
 	c.Header("MS-Author-Via", "DAV")
-	c.Header("Allow", "OPTIONS, GET, HEAD, POST, PUT, DELETE, PROPFIND, PROPPATCH, MKCOL, COPY, MOVE, LOCK, UNLOCK")
+	c.Header("Accept-Patch", PartialUpdateContentType)
+	c.Header("Allow", davMethods)
+	if h.searcher != nil {
+		c.Header("DASL", "<DAV:basicsearch>")
+	}
+	// Office和Windows WebClient按IIS的习惯从Public头读取支持的方法，并据此决定是否启用分段读取
+	if DetectClient(c.GetHeader("User-Agent")) != ClientGeneric {
+		c.Header("Public", davMethods)
+		c.Header("Accept-Ranges", "bytes")
+	}
 	c.Status(http.StatusOK)
 }
 
-func (h *Handler) createFileResponse(href string, size int64, modTime time.Time, contentType string, userID string) Response {
-	// 获取自定义属性
-	customProperties, _ := h.GetCustomPropertiesForUser(userID, href)
+func (h *Handler) createFileResponse(href string, size int64, modTime time.Time, contentType, etag string, userID string, fileID string) Response {
+	// 获取自定义属性及上传时记录的校验值、时间戳
+	deadProperties, liveProperties := h.loadResourceProperties(userID, href)
+	modified, created := resourceTimes(liveProperties, modTime)
 	
 	return Response{
 		Href: href,
@@ -416,76 +994,101 @@ func (h *Handler) createFileResponse(href string, size int64, modTime time.Time,
 			Prop: webdavtypes.ResponseProp{
 				DisplayName:       path.Base(href),
 				GetContentLength:  size,
-				GetContentType:    contentType,
-				GetLastModified:   modTime.Format(http.TimeFormat),
-				CreationDate:      modTime.Format(time.RFC3339),
+				GetContentType:    contenttype.Resolve(href, contentType),
+				GetLastModified:   modified.UTC().Format(http.TimeFormat),
+				CreationDate:      created.UTC().Format(time.RFC3339),
 				ResourceType:      &webdavtypes.ResourceType{},
-				GetETag:           fmt.Sprintf(`"%d-%d"`, modTime.Unix(), size),
-				SupportedLock:     createSupportedLock(),
-				LockDiscovery:     nil, // 临时设为nil避免类型错误
-				CustomProperties:  customProperties,
+				GetETag:           `"` + etag + `"`,
+				SupportedLock:     h.createSupportedLock(),
+				LockDiscovery:     h.lockDiscovery(href),
+				FileID:            fileID,
+				GetContentMD5:     liveProperties[ContentMD5PropertyName],
+				ChecksumSHA256:    liveProperties[ChecksumSHA256PropertyName],
+				CommentCount:      liveProperties[CommentCountPropertyName],
+				Favorite:          liveProperties[FavoritePropertyName],
+				DeadProperties:    deadProperties,
 			},
 			Status: "HTTP/1.1 200 OK",
 		}},
 	}
 }
 
-func (h *Handler) createFolderResponse(href string, modTime time.Time, userID string) Response {
+func (h *Handler) createFolderResponse(href string, modTime time.Time, userID string, fileID string) Response {
 	if !strings.HasSuffix(href, "/") {
 		href += "/"
 	}
 	
-	// 获取自定义属性
-	customProperties, _ := h.GetCustomPropertiesForUser(userID, href)
+	// 获取自定义属性、时间戳及日历、通讯录集合标记
+	deadProperties, liveProperties := h.loadResourceProperties(userID, href)
+	modified, created := resourceTimes(liveProperties, modTime)
+	resourceType := &webdavtypes.ResourceType{
+		Collection: &struct{}{},
+	}
+	var calendarComponentSet *webdavtypes.CalendarComponentSet
+	if components, ok := liveProperties[CalendarPropertyName]; ok {
+		resourceType.Calendar = &struct{}{}
+		calendarComponentSet = &webdavtypes.CalendarComponentSet{}
+		for _, name := range strings.Split(components, ",") {
+			calendarComponentSet.Comps = append(calendarComponentSet.Comps, webdavtypes.CalendarComp{Name: name})
+		}
+	}
+	var addressData *webdavtypes.AddressDataTypes
+	var maxResourceSize int64
+	if _, ok := liveProperties[AddressbookPropertyName]; ok {
+		resourceType.Addressbook = &struct{}{}
+		addressData = supportedAddressData()
+		maxResourceSize = maxAddressObjectSize
+	}
+
+	// 用户根目录同时是主体（principal）和日历、通讯录的主目录，供客户端自动发现
+	var principal *webdavtypes.Href
+	if href == "/" {
+		principal = &webdavtypes.Href{Href: "/"}
+	}
+	
+	// 只读标记是活属性，随其他属性一起读取
+	readOnly := ""
+	if _, ok := liveProperties[ReadOnlyPropertyName]; ok {
+		readOnly = "T"
+	}
 	
 	return Response{
 		Href: href,
 		Propstat: []webdavtypes.Propstat{{
 			Prop: webdavtypes.ResponseProp{
 				DisplayName:       path.Base(strings.TrimSuffix(href, "/")),
-				GetLastModified:   modTime.Format(http.TimeFormat),
-				CreationDate:      modTime.Format(time.RFC3339),
-				ResourceType: &webdavtypes.ResourceType{
-					Collection: &struct{}{},
-				},
-				SupportedLock:     createSupportedLock(),
-				LockDiscovery:     nil, // 临时设为nil避免类型错误
-				CustomProperties:  customProperties,
+				GetLastModified:   modified.UTC().Format(http.TimeFormat),
+				CreationDate:      created.UTC().Format(time.RFC3339),
+				ResourceType:      resourceType,
+				SupportedLock:     h.createSupportedLock(),
+				LockDiscovery:     h.lockDiscovery(href),
+				FileID:            fileID,
+				ReadOnly:          readOnly,
+				Favorite:          liveProperties[FavoritePropertyName],
+				SupportedCalendarComponentSet: calendarComponentSet,
+				SupportedAddressData: addressData,
+				MaxResourceSize:   maxResourceSize,
+				CurrentUserPrincipal: principal,
+				CalendarHomeSet:   principal,
+				AddressbookHomeSet: principal,
+				DeadProperties:    deadProperties,
 			},
 			Status: "HTTP/1.1 200 OK",
 		}},
 	}
 }
-// LockedError 423 Locked错误响应
-type LockedError struct {
-	XMLName    xml.Name `xml:"D:error"`
-	XMLNS      string   `xml:"xmlns:D,attr"`
-	LockToken  string   `xml:"D:locktoken"`
-	Owner      string   `xml:"D:owner"`
-	Message    string   `xml:"D:message"`
-}
-
-// SendLockedError 发送423 Locked错误响应
-func (h *Handler) SendLockedError(c *gin.Context, lockToken, owner, message string) {
-	errorResponse := LockedError{
-		XMLNS:     "DAV:",
-		LockToken: lockToken,
-		Owner:     owner,
-		Message:   message,
-	}
-
-	c.Header("Content-Type", "application/xml; charset=utf-8")
-	c.Header("Retry-After", "60")
-	c.Status(http.StatusLocked)
-
-	// 添加锁定令牌引用
-	if lockToken != "" {
-		c.Header("Lock-Token", fmt.Sprintf("<%s>", lockToken))
+// folderFileID 获取目录的稳定文件ID（根目录或无目录标记时为空）
+func (h *Handler) folderFileID(ctx context.Context, uid uuid.UUID, folderPath string) string {
+	info, err := h.storage.StatFolder(ctx, uid, folderPath)
+	if err != nil {
+		return ""
 	}
+	return storage.FileID(*info)
+}
 
-	encoder := xml.NewEncoder(c.Writer)
-	encoder.Indent("", "  ")
-	encoder.Encode(errorResponse)
+// SendLockedError 发送423 Locked错误响应，带lock-token-submitted条件和阻止请求的锁根
+func (h *Handler) SendLockedError(c *gin.Context, lock *Lock, message string) {
+	writeDAVError(c, lockedError(lock, message))
 }
 
 // CheckExclusiveLock 检查EXCLUSIVE锁定
@@ -502,7 +1105,7 @@ func (h *Handler) CheckExclusiveLock(c *gin.Context, path string) (bool, *Lock)
 				Type:  LockTypeExclusive,
 			}
 		}
-		h.SendLockedError(c, lock.Token, lock.Owner, err.Error())
+		h.SendLockedError(c, lock, err.Error())
 		return true, lock
 	}
 	
@@ -525,7 +1128,7 @@ func (h *Handler) CheckSharedLock(c *gin.Context, path string) (bool, *Lock) {
 		}
 		// 如果是EXCLUSIVE锁定且不是持有者，返回423
 		if lock.Type == LockTypeExclusive && lock.Owner != userID {
-			h.SendLockedError(c, lock.Token, lock.Owner, err.Error())
+			h.SendLockedError(c, lock, err.Error())
 			return true, lock
 		}
 	}
@@ -547,39 +1150,27 @@ func (h *Handler) CheckParentLocks(c *gin.Context, path string) (bool, *Lock) {
 				Type:  LockTypeExclusive,
 			}
 		}
-		h.SendLockedError(c, lock.Token, lock.Owner, err.Error())
+		h.SendLockedError(c, lock, err.Error())
 		return true, lock
 	}
 	
 	return locked, lock
 }
 
-// CheckAnyLock 检查任何类型的锁定
+// CheckAnyLock 检查写操作的锁定：其他用户持有共享或排他锁时都返回423
 func (h *Handler) CheckAnyLock(c *gin.Context, path string) (bool, *Lock) {
 	userID := c.GetString("userID")
-	
-	locks := h.lockManager.GetLocksForPath(path)
-	for _, lock := range locks {
-		// 检查锁定是否过期
-		if time.Now().Sub(lock.CreatedAt).Seconds() > float64(lock.Timeout) {
-			h.lockManager.RemoveLock(lock.Token)
-			continue
-		}
-		
-		// 如果有EXCLUSIVE锁定且不是持有者，返回423
-		if lock.Type == LockTypeExclusive && lock.Owner != userID {
-			h.SendLockedError(c, lock.Token, lock.Owner, "Resource is locked exclusively")
-			return true, lock
-		}
-		
-		// 如果有SHARED锁定，返回但不阻止操作
-		if lock.Type == LockTypeShared {
-			return true, lock
-		}
+
+	locked, lock, err := h.lockManager.CheckLock(path, userID)
+	if locked {
+		h.SendLockedError(c, lock, err.Error())
+		return true, lock
 	}
-	
+
 	return false, nil
-}// HandleLock 处理LOCK请求
+}
+
+// HandleLock 处理LOCK请求
 func (h *Handler) HandleLock(c *gin.Context) {
 	userID := c.GetString("userID")
 	if userID == "" {
@@ -592,6 +1183,11 @@ func (h *Handler) HandleLock(c *gin.Context) {
 		requestPath = "/"
 	}
 
+	// 检查访问控制权限：锁定已有资源需要write-content，锁定未映射的URL需要上级目录的bind
+	if h.CheckWritePrivilege(c, requestPath) {
+		return // CheckWritePrivilege已经发送了403错误
+	}
+
 	// 获取完整的请求URL（用于lockroot）
 	requestURL := h.buildRequestURL(c, requestPath)
 
@@ -607,13 +1203,13 @@ func (h *Handler) HandleLock(c *gin.Context) {
 	var lockInfo *webdavtypes.LockInfoRequest
 	var err error
 
-	if c.Request.Body != nil && c.Request.ContentLength > 0 {
-		body, readErr := io.ReadAll(c.Request.Body)
-		if readErr != nil {
-			c.Status(http.StatusBadRequest)
-			return
-		}
+	// Office发送的LOCK可能使用分块传输或只包含空白，按实际内容判断是否为空请求体
+	body, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
 
+	if body != nil {
 		lockInfo, err = ParseLockInfoFromBytes(body)
 		if err != nil {
 			c.Status(http.StatusBadRequest)
@@ -650,14 +1246,10 @@ func (h *Handler) HandleLock(c *gin.Context) {
 	depthHeader := c.GetHeader("Depth")
 	depth := ParseDepth(depthHeader)
 
-	// 提取所有者信息
-	owner := userID
+	// 提取客户端提交的所有者信息；锁的持有者始终是当前用户
+	ownerInfo := ""
 	if lockInfo.Owner != nil {
-		if lockInfo.Owner.Href != "" {
-			owner = lockInfo.Owner.Href
-		} else {
-			owner = userID // 使用默认值
-		}
+		ownerInfo = lockInfo.Owner.Href
 	}
 
 	// 检查锁定冲突
@@ -667,11 +1259,84 @@ func (h *Handler) HandleLock(c *gin.Context) {
 		return
 	}
 
-	// 创建锁定
-	lock := h.lockManager.CreateLock(requestPath, lockType, owner, timeout, depth)
+	// 检查锁策略（共享锁开关、每用户锁数上限），避免先创建空资源再失败
+	if err := h.lockManager.CheckPolicy(userID, lockType); err != nil {
+		c.String(http.StatusForbidden, err.Error())
+		return
+	}
 
-	// 生成响应
-	h.sendLockResponse(c, lock, requestURL)
+	// 锁定未映射的URL时创建空资源（RFC 4918 7.3），客户端可以在PUT之前先占用名称
+	ctx := c.Request.Context()
+	uid, _ := uuid.Parse(userID)
+	created := false
+	if _, err := h.storage.StatObject(ctx, uid, requestPath); err != nil && !h.folders.IsFolder(ctx, uid, requestPath) {
+		// 空资源只能是普通文件，集合需要通过MKCOL创建；日历、通讯录中的对象必须是合法的iCalendar/vCard
+		parent := path.Dir(path.Clean("/" + requestPath))
+		if strings.HasSuffix(requestPath, "/") || h.isCalendarCollection(userID, parent) || h.isAddressbookCollection(userID, parent) {
+			c.Status(http.StatusConflict)
+			return
+		}
+		if h.CheckFilename(c, requestPath) {
+			return // CheckFilename已经发送了400或403错误
+		}
+		if h.CheckReadOnly(c, requestPath) {
+			return // CheckReadOnly已经发送了403错误
+		}
+		if err := h.storage.PutObject(ctx, uid, requestPath, bytes.NewReader(nil), 0, "application/octet-stream"); err != nil {
+			sendUploadError(c, err)
+			return
+		}
+		created = true
+	}
+
+	// 创建锁定；并发请求可能在检查之后用完了配额，此时撤销刚创建的空资源
+	lock, err := h.lockManager.CreateLock(requestPath, lockType, userID, timeout, depth)
+	if err != nil {
+		if created {
+			h.storage.DeleteObject(ctx, uid, requestPath)
+		}
+		c.String(http.StatusForbidden, err.Error())
+		return
+	}
+	if ownerInfo != "" {
+		h.lockManager.SetOwnerInfo(lock.Token, ownerInfo)
+	}
+
+	// 生成响应：新建了资源时返回201
+	if created {
+		h.lockManager.MarkNullResource(lock.Token)
+		h.sendLockResponse(c, lock, requestURL, http.StatusCreated)
+		return
+	}
+	h.sendLockResponse(c, lock, requestURL, http.StatusOK)
+}
+
+// cleanupNullResource 锁过期时删除LOCK创建后一直未被写入的空资源
+func (h *Handler) cleanupNullResource(lock *Lock) {
+	if !lock.NullResource {
+		return
+	}
+	uid, err := uuid.Parse(lock.Owner)
+	if err != nil {
+		return
+	}
+	// 其他锁仍然覆盖该资源时保留
+	if len(h.lockManager.ActiveLocksFor(lock.Path)) > 0 {
+		return
+	}
+
+	ctx := context.Background()
+	info, err := h.storage.StatObject(ctx, uid, lock.Path)
+	if err != nil || info.Size > 0 {
+		return
+	}
+	if err := h.storage.DeleteObject(ctx, uid, lock.Path); err != nil {
+		log.Printf("Warning: failed to remove unused locked resource %s: %v", lock.Path, err)
+		return
+	}
+	if err := h.propertyService.DeletePropertiesForPath(ctx, lock.Owner, lock.Path); err != nil {
+		log.Printf("Warning: failed to delete properties of %s: %v", lock.Path, err)
+	}
 }
 
 // handleLockRefresh 处理锁定刷新请求
@@ -735,7 +1400,7 @@ func (h *Handler) handleLockRefresh(c *gin.Context, requestPath string, ifHeader
 	}
 
 	// 返回刷新后的锁定信息
-	h.sendLockResponse(c, refreshedLock, requestURL)
+	h.sendLockResponse(c, refreshedLock, requestURL, http.StatusOK)
 }
 
 // HandleUnlock 处理UNLOCK请求
@@ -751,6 +1416,11 @@ func (h *Handler) HandleUnlock(c *gin.Context) {
 		requestPath = "/"
 	}
 
+	// 检查访问控制权限
+	if h.CheckPrivilege(c, requestPath, PrivilegeUnlock) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
 	// 获取Lock-Token头
 	lockToken := c.GetHeader("Lock-Token")
 	if lockToken == "" {
@@ -776,8 +1446,7 @@ func (h *Handler) HandleUnlock(c *gin.Context) {
 	if lock.Path != requestPath {
 		// 锁令牌范围不匹配Request-URI
 		// 返回409错误并包含lock-token-matches-request-uri前置条件
-		errorCondition := CreateLockTokenMismatchError()
-		h.sendXMLError(c, http.StatusConflict, errorCondition)
+		h.sendDAVError(c, http.StatusConflict, ConditionLockTokenMatchesRequestURI)
 		return
 	}
 
@@ -800,7 +1469,7 @@ func (h *Handler) HandleUnlock(c *gin.Context) {
 }
 
 // sendLockResponse 发送LOCK响应
-func (h *Handler) sendLockResponse(c *gin.Context, lock *Lock, requestURL string) {
+func (h *Handler) sendLockResponse(c *gin.Context, lock *Lock, requestURL string, status int) {
 	// 创建活动锁定信息
 	activeLock := CreateActiveLockResponse(lock, requestURL)
 
@@ -813,7 +1482,7 @@ func (h *Handler) sendLockResponse(c *gin.Context, lock *Lock, requestURL string
 	// 设置响应头
 	c.Header("Content-Type", "application/xml; charset=utf-8")
 	c.Header("Lock-Token", fmt.Sprintf("<%s>", lock.Token))
-	c.Status(http.StatusOK)
+	c.Status(status)
 
 	// 发送XML响应
 	c.Writer.Write([]byte(xml.Header))
@@ -822,37 +1491,16 @@ func (h *Handler) sendLockResponse(c *gin.Context, lock *Lock, requestURL string
 	encoder.Encode(response)
 }
 
-// sendConflictError 发送锁定冲突错误
+// sendConflictError 发送锁定冲突错误：423 no-conflicting-lock，href为冲突锁的锁根
 func (h *Handler) sendConflictError(c *gin.Context, lock *Lock, err error) {
-	var errorCondition webdavtypes.LockErrorCondition
-
+	e := &DAVError{Status: http.StatusLocked, Condition: ConditionNoConflictingLock}
+	if err != nil {
+		e.Message = err.Error()
+	}
 	if lock != nil {
-		// 创建no-conflicting-lock错误
-		errorCondition = CreateNoConflictingLockError([]string{lock.Path})
-	} else {
-		// 创建通用冲突错误
-		errorCondition = CreateNoConflictingLockError([]string{})
+		e.Hrefs = []string{lockRootHref(lock)}
 	}
-
-	_ = errorCondition // 使用变量避免编译器警告
-
-	h.sendXMLError(c, http.StatusLocked, errorCondition)
-}
-
-// sendXMLError 发送XML格式的错误响应
-func (h *Handler) sendXMLError(c *gin.Context, statusCode int, errorCondition webdavtypes.LockErrorCondition) {
-	errorResponse := ErrorResponse{
-		Namespace: "DAV:",
-		Condition: errorCondition,
-	}
-
-	c.Header("Content-Type", "application/xml; charset=utf-8")
-	c.Status(statusCode)
-
-	c.Writer.Write([]byte(xml.Header))
-	encoder := xml.NewEncoder(c.Writer)
-	encoder.Indent("", "  ")
-	encoder.Encode(errorResponse)
+	writeDAVError(c, e)
 }
 
 // buildRequestURL 构建完整的请求URL
@@ -882,23 +1530,19 @@ func (h *Handler) CheckAndEnforceLocks(c *gin.Context, path string) bool {
 
 	// 检查路径锁定
 	if locked, existingLock, err := h.lockManager.CheckLock(path, userID); err != nil {
-		c.Status(http.StatusLocked)
-		h.SendLockedError(c, existingLock.Token, existingLock.Owner, err.Error())
+		h.SendLockedError(c, existingLock, err.Error())
 		return true
 	} else if locked {
-		c.Status(http.StatusLocked)
-		h.SendLockedError(c, existingLock.Token, existingLock.Owner, "Resource is locked")
+		h.SendLockedError(c, existingLock, "Resource is locked")
 		return true
 	}
 
 	// 检查父目录锁定
 	if locked, existingLock, err := h.lockManager.CheckParentLocks(path, userID); err != nil {
-		c.Status(http.StatusLocked)
-		h.SendLockedError(c, existingLock.Token, existingLock.Owner, err.Error())
+		h.SendLockedError(c, existingLock, err.Error())
 		return true
 	} else if locked {
-		c.Status(http.StatusLocked)
-		h.SendLockedError(c, existingLock.Token, existingLock.Owner, "Parent resource is locked")
+		h.SendLockedError(c, existingLock, "Parent resource is locked")
 		return true
 	}
 
@@ -923,11 +1567,28 @@ func (h *Handler) HandleProppatch(c *gin.Context) {
 		requestPath = "/"
 	}
 
+	// 检查访问控制权限
+	if h.CheckPrivilege(c, requestPath, PrivilegeWriteProperties) {
+		return // CheckPrivilege已经发送了403错误
+	}
+
+	// 检查只读目录
+	if h.CheckReadOnly(c, requestPath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
+	// 目录（包括根目录和没有目录标记的隐式目录）与文件一样可以设置属性，不存在的资源返回404
+	resource, ok := h.statResource(c, uid, requestPath)
+	if !ok {
+		return
+	}
+	requestPath = resource.Path
+
 	// 检查资源锁定状态
 	// 使用优化的锁定检查
 	if locked, lock, err := h.OptimizedProppatchLockCheck(c, requestPath, userID); err != nil {
 		// 处理锁定错误
-		h.SendProppatchLockedError(c, requestPath, lock.Token, lock.Owner, err.Error())
+		h.SendLockedError(c, lock, err.Error())
 		return
 	} else if locked {
 		// 资源被锁定
@@ -936,8 +1597,7 @@ func (h *Handler) HandleProppatch(c *gin.Context) {
 
 	// 验证锁定所有权（如果有If头）
 	if err := h.ValidateProppatchLockOwnership(c, requestPath, userID); err != nil {
-		c.Status(http.StatusPreconditionFailed)
-		h.sendProppatchErrorResponse(c, requestPath, []webdavtypes.PropertyError{{
+		h.sendProppatchErrorResponse(c, http.StatusPreconditionFailed, requestPath, []webdavtypes.PropertyError{{
 			Code:        412,
 			Message:     "锁定验证失败: " + err.Error(),
 		}})
@@ -951,39 +1611,43 @@ func (h *Handler) HandleProppatch(c *gin.Context) {
 	}
 
 	// 读取和解析XML请求体
-	xmlBody, propError := h.xmlParser.ReadXMLBody(c.Request.Body)
-	if propError != nil {
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.Status(propError.Code)
-		h.sendProppatchErrorResponse(c, requestPath, []webdavtypes.PropertyError{*propError})
+	xmlBody, ok := h.readXMLBody(c)
+	if !ok {
+		return
+	}
+	if xmlBody == nil {
+		h.sendProppatchErrorResponse(c, http.StatusBadRequest, requestPath, []webdavtypes.PropertyError{{
+			Code:    400,
+			Message: "请求体不能为空",
+		}})
 		return
 	}
 
 	// 解析PROPPATCH请求
 	propRequest, propError := h.xmlParser.ParseProppatchRequest(xmlBody)
 	if propError != nil {
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.Status(propError.Code)
-		h.sendProppatchErrorResponse(c, requestPath, []webdavtypes.PropertyError{*propError})
+		h.sendProppatchErrorResponse(c, propError.Code, requestPath, []webdavtypes.PropertyError{*propError})
 		return
 	}
 
-	// 处理属性操作
-	result, propErrors := h.processProppatchOperations(c, uid, requestPath, propRequest)
+	// 处理属性操作，目录的属性统一以不带结尾/的路径保存
+	propertyPath := requestPath
+	if resource.IsCollection() {
+		propertyPath = normalizeCollectionPath(requestPath)
+	}
+	result, propErrors := h.processProppatchOperations(c, uid, propertyPath, propRequest)
+	result.ResourcePath = requestPath
 	
 	// 生成响应
 	if len(propErrors) > 0 {
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.Status(http.StatusMultiStatus)
-		h.sendProppatchErrorResponse(c, requestPath, propErrors)
+		h.sendProppatchErrorResponse(c, http.StatusMultiStatus, requestPath, propErrors)
 	} else {
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.Status(http.StatusMultiStatus)
 		h.sendProppatchSuccessResponse(c, result)
 	}
 }
 
-// processProppatchOperations 处理PROPPATCH操作
+// processProppatchOperations 处理PROPPATCH操作。PROPPATCH是原子的（RFC 4918 9.2）：先检查全部操作，
+// 任一属性失败时不修改任何属性，其余属性返回424；全部通过后在一个事务中写入
 func (h *Handler) processProppatchOperations(ctx context.Context, uid uuid.UUID, requestPath string, propRequest *PropertyUpdateRequest) (*PropertyUpdateResult, []webdavtypes.PropertyError) {
 	result := &PropertyUpdateResult{
 		ResourcePath: requestPath,
@@ -992,83 +1656,89 @@ func (h *Handler) processProppatchOperations(ctx context.Context, uid uuid.UUID,
 	}
 	
 	var propErrors []webdavtypes.PropertyError
-	var propertiesToSet []*Property
+	var propertiesToSet, propertiesToRemove []*Property
 	userID := uid.String()
 	
 	// 预检查所有操作的锁定兼容性
 	preCheckErrors := h.performPreOperationLockCheck(requestPath, propRequest.SetOperations, propRequest.RemoveOperations, userID)
 	if len(preCheckErrors) > 0 {
+		result.ErrorCount = len(preCheckErrors)
 		return result, preCheckErrors
 	}
 	
-	// 处理set操作
+	// 检查set操作
 	for _, setOp := range propRequest.SetOperations {
-		prop, propError := h.processSetOperation(setOp.PropContent[0], ctx, uid.String(), requestPath)
-		if propError != nil {
-			propErrors = append(propErrors, *propError)
-		} else if prop != nil {
-			propertiesToSet = append(propertiesToSet, prop)
-			
-			// 添加到操作记录
-			operation := webdavtypes.PropertyOperation{
-				Property:  *prop,
-				Operation: "set",
-				Success:   true,
-				Timestamp: time.Now(),
+		for _, content := range setOp.PropContent {
+			prop, propError := h.processSetOperation(content, ctx, userID, requestPath)
+			if propError != nil {
+				propErrors = append(propErrors, *propError)
+			} else if prop != nil {
+				propertiesToSet = append(propertiesToSet, prop)
 			}
-			result.Operations = append(result.Operations, operation)
 		}
 	}
 	
-	// 处理remove操作
+	// 检查remove操作
 	for _, removeOp := range propRequest.RemoveOperations {
-		propError := h.processRemoveOperation(removeOp.PropContent[0], ctx, uid.String(), requestPath)
-		if propError != nil {
-			propErrors = append(propErrors, *propError)
-		} else {
-			// 添加到操作记录
-			operation := webdavtypes.PropertyOperation{
-				Operation: "remove",
-				Property:  webdavtypes.Property{
-					Name: removeOp.PropContent[0].XMLName.Local,
-				},
-				Success:   true,
-				Timestamp: time.Now(),
+		for _, content := range removeOp.PropContent {
+			prop, propError := h.processRemoveOperation(content, userID, requestPath)
+			if propError != nil {
+				propErrors = append(propErrors, *propError)
+			} else {
+				propertiesToRemove = append(propertiesToRemove, prop)
 			}
-			result.Operations = append(result.Operations, operation)
 		}
 	}
-	
-	// 如果有要设置的属性，批量创建/更新
+
+	// 新增属性后不能超出每个资源的属性数上限
 	if len(propertiesToSet) > 0 && len(propErrors) == 0 {
-		if err := h.propertyService.BatchSetProperties(ctx, uid.String(), requestPath, propertiesToSet); err != nil {
-			propErrors = append(propErrors, webdavtypes.PropertyError{
-				Code:    500,
-				Message: "批量设置属性失败",
-			})
-		} else {
-			result.SuccessCount = len(propertiesToSet)
-			// 为成功操作的属性创建propstat响应
-			for _, prop := range propertiesToSet {
-				propContent := webdavtypes.PropContentResponse{
-					DisplayName: prop.Name,
-					CustomProps: map[string]string{
-						fmt.Sprintf("%s:%s", prop.Namespace, prop.Name): prop.Value,
-					},
-				}
-				result.Propstats = append(result.Propstats, webdavtypes.Propstat{
-					Prop:   webdavtypes.ResponseProp{
-						DisplayName: propContent.DisplayName,
-						CustomProperties: propContent.CustomProps,
-					},
-					Status: "HTTP/1.1 200 OK",
+		propErrors = h.checkPropertyCount(ctx, userID, requestPath, propertiesToSet, propertiesToRemove)
+	}
+
+	if len(propErrors) > 0 {
+		propErrors = failedDependencyErrors(propErrors, propertiesToSet, propertiesToRemove)
+		result.ErrorCount = len(propErrors)
+		return result, propErrors
+	}
+
+	// 设置文件时间的属性同时更新PROPFIND、GET使用的修改时间和创建时间
+	storedSets, storedRemoves := applyTimestampProperties(userID, requestPath, propertiesToSet, propertiesToRemove)
+	if err := h.propertyService.PatchProperties(ctx, userID, requestPath, storedSets, storedRemoves); err != nil {
+		log.Printf("Warning: PROPPATCH %s failed: %v", requestPath, err)
+		// 事务已回滚，所有属性都未修改
+		for _, group := range [][]*Property{propertiesToSet, propertiesToRemove} {
+			for _, prop := range group {
+				propErrors = append(propErrors, webdavtypes.PropertyError{
+					Code:      http.StatusInternalServerError,
+					Message:   "保存属性失败",
+					Property:  prop.Name,
+					Namespace: prop.Namespace,
 				})
 			}
 		}
-	}
-	
-	result.ErrorCount = len(propErrors)
-	return result, propErrors
+		result.ErrorCount = len(propErrors)
+		return result, propErrors
+	}
+
+	now := time.Now()
+	for _, prop := range propertiesToSet {
+		result.Operations = append(result.Operations, webdavtypes.PropertyOperation{
+			Property:  *prop,
+			Operation: "set",
+			Success:   true,
+			Timestamp: now,
+		})
+	}
+	for _, prop := range propertiesToRemove {
+		result.Operations = append(result.Operations, webdavtypes.PropertyOperation{
+			Property:  *prop,
+			Operation: "remove",
+			Success:   true,
+			Timestamp: now,
+		})
+	}
+	result.SuccessCount = len(result.Operations)
+	return result, nil
 }
 
 // performPreOperationLockCheck 执行操作前的锁定检查
@@ -1121,113 +1791,50 @@ func (h *Handler) processSetOperation(prop webdavtypes.PropContent, ctx context.
 	// 解析属性
 	property, propError := h.xmlParser.ParsePropertyFromContent(userID, path, prop)
 	if propError != nil {
+		propError.Property = prop.XMLName.Local
+		propError.Namespace = h.xmlParser.resolveNamespace(prop)
 		return nil, propError
 	}
 	
-	// 检查权限（这里可以实现更复杂的权限检查）
-	if !h.canModifyProperty(userID, property) {
-		return nil, &webdavtypes.PropertyError{
-			Code:    403,
-			Message: "没有权限修改此属性",
-		}
+	if propError := h.checkPropertySet(property.Namespace, property.Name, property.Value); propError != nil {
+		return nil, propError
 	}
-	
+
 	return property, nil
 }
 
-// processRemoveOperation 处理单个remove操作
-func (h *Handler) processRemoveOperation(prop webdavtypes.PropContent, ctx context.Context, userID, path string) *webdavtypes.PropertyError {
+// processRemoveOperation 检查单个remove操作，删除在所有操作检查通过后统一执行
+func (h *Handler) processRemoveOperation(prop webdavtypes.PropContent, userID, path string) (*webdavtypes.Property, *webdavtypes.PropertyError) {
 	namespace := h.xmlParser.resolveNamespace(prop)
 	propertyName := prop.XMLName.Local
 	
-	// 检查权限
-	if !h.canRemoveProperty(userID, namespace, propertyName) {
-		return &webdavtypes.PropertyError{
-			Code:    403,
-			Message: "没有权限移除此属性",
-		}
-	}
-	
-	// 检查属性是否存在
-	existingProp, err := h.propertyService.GetProperty(ctx, userID, path, namespace, propertyName)
-	if err != nil {
-		return &webdavtypes.PropertyError{
-			Code:    500,
-			Message: "检查属性存在性失败",
-		}
-	}
-	
-	if existingProp == nil {
-		return &webdavtypes.PropertyError{
-			Code:    404,
-			Message: "属性不存在",
-		}
-	}
-	
-	// 检查是否为活属性（活属性通常不能被删除）
-	if existingProp.IsLive {
-		return &webdavtypes.PropertyError{
-			Code:    403,
-			Message: "活属性不能被删除",
-		}
+	// 受保护的属性和保留命名空间
+	if err := h.propertyPolicy.CheckRemove(namespace, propertyName); err != nil {
+		return nil, propertyPolicyError(namespace, propertyName, err)
 	}
 	
-	// 删除属性
-	if err := h.propertyService.DeleteProperty(ctx, userID, path, namespace, propertyName); err != nil {
-		return &webdavtypes.PropertyError{
-			Code:    500,
-			Message: "删除属性失败",
-		}
-	}
-	
-	return nil
+	return &webdavtypes.Property{
+		UserID:    userID,
+		Path:      path,
+		Namespace: namespace,
+		Name:      propertyName,
+	}, nil
 }
 
-// canModifyProperty 检查是否可以修改属性
-func (h *Handler) canModifyProperty(userID string, property *webdavtypes.Property) bool {
-	// 基本权限检查：用户可以修改自己的属性
-	// 这里可以实现更复杂的权限逻辑
-	return true
-}
-
-// canRemoveProperty 检查是否可以删除属性
-func (h *Handler) canRemoveProperty(userID, namespace, propertyName string) bool {
-	// 基本权限检查：用户可以删除自己的属性
-	// 特殊命名空间的属性可能有特殊规则
-	if namespace == NamespaceDAV {
-		// DAV命名空间的活属性通常不能被删除
-		if propertyName == "displayname" || propertyName == "resourcetype" {
-			return false
-		}
-	}
-	return true
-}
-
-// sendProppatchSuccessResponse 发送成功的PROPPATCH响应
+// sendProppatchSuccessResponse 发送成功的PROPPATCH响应，列出所有已设置和删除的属性
 func (h *Handler) sendProppatchSuccessResponse(c *gin.Context, result *PropertyUpdateResult) {
-	responseXML, propError := h.xmlParser.GenerateProppatchResponse(result)
-	if propError != nil {
-		c.Status(http.StatusInternalServerError)
-		return
+	succeeded := make([]webdavtypes.DeadProperty, 0, len(result.Operations))
+	for _, op := range result.Operations {
+		if op.Success {
+			succeeded = append(succeeded, webdavtypes.DeadProperty{Namespace: op.Property.Namespace, Name: op.Property.Name})
+		}
 	}
-	
-	c.Writer.Write(responseXML)
+	writeProppatchResponse(c, http.StatusMultiStatus, result.ResourcePath, succeeded, nil)
 }
 
-// sendProppatchErrorResponse 发送错误的PROPPATCH响应
-func (h *Handler) sendProppatchErrorResponse(c *gin.Context, path string, errors []webdavtypes.PropertyError) {
-	responseXML, propError := h.xmlParser.GenerateErrorResponse(http.StatusMultiStatus, errors)
-	if propError != nil {
-		c.Status(http.StatusInternalServerError)
-		return
-	}
-	
-	// 在响应中设置正确的路径
-	responseStr := string(responseXML)
-	// 简单的字符串替换，实际应该用XML处理
-	responseStr = strings.Replace(responseStr, `href=""`, `href="`+path+`"`, 1)
-	
-	c.Writer.Write([]byte(responseStr))
+// sendProppatchErrorResponse 发送错误的PROPPATCH响应，每个出错的属性带状态码、前置条件和说明
+func (h *Handler) sendProppatchErrorResponse(c *gin.Context, status int, path string, errors []webdavtypes.PropertyError) {
+	writeProppatchResponse(c, status, path, nil, errors)
 }
 
 // ========================================
@@ -1288,6 +1895,57 @@ func (h *Handler) GetCustomPropertiesForUser(userID, path string) (map[string]st
 	return customProps, nil
 }
 
+// GetDeadPropertiesForUser 获取资源的自定义（dead）属性，用于PROPFIND响应
+// 目录的属性可能以带或不带结尾/的路径保存，两种形式都会返回；活属性由各自字段输出，这里跳过
+func (h *Handler) GetDeadPropertiesForUser(userID, resourcePath string) []webdavtypes.DeadProperty {
+	deadProps, _ := h.loadResourceProperties(userID, resourcePath)
+	return deadProps
+}
+
+// prefetchProperties 列举目录前一次载入目录自身及其直接子资源的属性，失败时回退为逐个查询
+func (h *Handler) prefetchProperties(ctx context.Context, userID, dirPath string) {
+	if err := h.propertyService.PrefetchChildProperties(ctx, userID, dirPath); err != nil {
+		log.Printf("Warning: failed to prefetch properties for %s: %v", dirPath, err)
+	}
+}
+
+// loadResourceProperties 一次查询同时取得自定义属性和网关维护的活属性（按属性名索引）
+func (h *Handler) loadResourceProperties(userID, resourcePath string) ([]webdavtypes.DeadProperty, map[string]string) {
+	ctx := context.Background()
+	if err := h.propertyService.Initialize(ctx); err != nil {
+		return nil, nil
+	}
+
+	properties, err := h.propertyService.ListResourceProperties(ctx, userID, resourcePath)
+	if err != nil {
+		log.Printf("Warning: failed to load properties for %s: %v", resourcePath, err)
+		return nil, nil
+	}
+
+	var deadProps []webdavtypes.DeadProperty
+	liveProps := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, prop := range properties {
+		if prop.IsLive && (prop.Namespace == NamespaceMetadata || isFavoriteProperty(prop.Namespace, prop.Name)) {
+			liveProps[prop.Name] = prop.Value
+		}
+		if prop.IsLive || (prop.Namespace == "DAV:" && webdavtypes.KnownLiveProperties[prop.Name]) {
+			continue
+		}
+		deadProp := webdavtypes.DeadProperty{
+			Namespace: prop.Namespace,
+			Name:      prop.Name,
+			Value:     prop.Value,
+		}
+		if seen[deadProp.Key()] {
+			continue
+		}
+		seen[deadProp.Key()] = true
+		deadProps = append(deadProps, deadProp)
+	}
+	return deadProps, liveProps
+}
+
 // ========================================
 // PROPPATCH 锁定检查增强
 // ========================================
@@ -1378,28 +2036,6 @@ func (h *Handler) ValidateProppatchLockOwnership(c *gin.Context, requestPath str
 	return nil
 }
 
-// SendProppatchLockedError 发送PROPPATCH特定的锁定错误
-func (h *Handler) SendProppatchLockedError(c *gin.Context, path string, lockToken, owner, message string) {
-	// 创建PROPPATCH特定的锁定错误响应
-	_ = CreateNoConflictingLockError([]string{path}) // 标记为已使用
-	
-	c.Header("Content-Type", "application/xml; charset=utf-8")
-	c.Header("Lock-Token", fmt.Sprintf("<%s>", lockToken))
-	c.Status(http.StatusLocked)
-	
-	// 生成详细的锁定错误信息
-	errorXML := fmt.Sprintf(`<?xml version="1.1" encoding="utf-8"?>
-<D:error xmlns:D="DAV:">
-<D:no-conflicting-lock>
-<D:locktoken>%s</D:locktoken>
-<D:owner>%s</D:owner>
-<D:message>%s</D:message>
-</D:no-conflicting-lock>
-</D:error>`, lockToken, owner, message)
-	
-	c.Writer.Write([]byte(errorXML))
-}
-
 // OptimizedProppatchLockCheck 优化的PROPPATCH锁定检查
 func (h *Handler) OptimizedProppatchLockCheck(c *gin.Context, requestPath string, userID string) (bool, *Lock, error) {
 	// 缓存锁定检查结果以提高性能
@@ -1487,9 +2123,9 @@ func (h *Handler) HandleProppatchEnhancedPROPFIND(c *gin.Context) {
 		requestPath = "/"
 	}
 
-	depth := c.GetHeader("Depth")
-	if depth == "" {
-		depth = "infinity"
+	depth, ok := h.propfindDepth(c)
+	if !ok {
+		return
 	}
 
 	var responses []Response
@@ -1500,27 +2136,27 @@ func (h *Handler) HandleProppatchEnhancedPROPFIND(c *gin.Context) {
 		info, err := h.storage.StatObject(c.Request.Context(), uid, requestPath)
 		if err != nil {
 			// It might be a folder or root
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
+			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString, h.folderFileID(c.Request.Context(), uid, requestPath)))
 		} else {
-			responses = append(responses, h.createFileResponse(requestPath, info.Size, info.LastModified, info.ContentType, userIDString))
+			responses = append(responses, h.createFileResponse(requestPath, info.Size, info.LastModified, info.ContentType, storage.ContentETag(*info), userIDString, storage.FileID(*info)))
 		}
 	} else {
 		// List directory contents
 		objects, err := h.storage.ListObjects(c.Request.Context(), uid, requestPath, depth == "infinity")
 		if err != nil {
 			// Return root folder
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
+			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString, h.folderFileID(c.Request.Context(), uid, requestPath)))
 		} else {
 			// Add parent folder
-			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString))
+			responses = append(responses, h.createFolderResponse(requestPath, time.Now(), userIDString, h.folderFileID(c.Request.Context(), uid, requestPath)))
 			
 			// Add files and folders
 			for _, obj := range objects {
 				objPath := "/" + obj.Key
 				if strings.HasSuffix(obj.Key, "/") {
-					responses = append(responses, h.createFolderResponse(objPath, obj.LastModified, userIDString))
+					responses = append(responses, h.createFolderResponse(objPath, obj.LastModified, userIDString, storage.FileID(obj)))
 				} else {
-					responses = append(responses, h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, userIDString))
+					responses = append(responses, h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, storage.ContentETag(obj), userIDString, storage.FileID(obj)))
 				}
 			}
 		}
@@ -1528,6 +2164,10 @@ func (h *Handler) HandleProppatchEnhancedPROPFIND(c *gin.Context) {
 
 	multistatus := Multistatus{
 		Xmlns:     "DAV:",
+		XmlnsOC:   webdavtypes.NamespaceOwnCloud,
+		XmlnsGW:   NamespaceMetadata,
+		XmlnsC:    webdavtypes.NamespaceCalDAV,
+		XmlnsCard: webdavtypes.NamespaceCardDAV,
 		Responses: responses,
 	}
 
@@ -1563,5 +2203,6 @@ func (h *Handler) UpdatePROPFINDResponseWithCustomProperties(c *gin.Context, res
 		if err == nil {
 			responses[i].Propstat[0].Prop.CustomProperties = customProps
 		}
+		responses[i].Propstat[0].Prop.DeadProperties = h.GetDeadPropertiesForUser(userID, responses[i].Href)
 	}
 }
\ No newline at end of file
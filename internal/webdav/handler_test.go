@@ -868,7 +868,7 @@ func TestHandleProppatch_WithLock(t *testing.T) {
 	path := "/test.txt"
 	
 	// 创建一个锁定
-	lock := handler.lockManager.CreateLock(path, LockTypeExclusive, userID, 3600, "0")
+	lock, _ := handler.lockManager.CreateLock(path, LockTypeExclusive, userID, 3600, "0")
 	assert.NotNil(t, lock)
 	
 	// 尝试执行PROPPATCH（应该失败，因为资源被锁定）
@@ -893,7 +893,7 @@ func TestHandleProppatch_SharedLockCompatible(t *testing.T) {
 	path := "/test.txt"
 	
 	// 创建共享锁定
-	lock := handler.lockManager.CreateLock(path, LockTypeShared, userID, 3600, "0")
+	lock, _ := handler.lockManager.CreateLock(path, LockTypeShared, userID, 3600, "0")
 	assert.NotNil(t, lock)
 	
 	// 尝试执行PROPPATCH（应该成功，因为是锁的持有者）
@@ -1243,7 +1243,7 @@ func TestHandleUnlock(t *testing.T) {
 	path := "/test.txt"
 	
 	// 首先创建一个锁定
-	lock := handler.lockManager.CreateLock(path, LockTypeExclusive, userID, 3600, "0")
+	lock, _ := handler.lockManager.CreateLock(path, LockTypeExclusive, userID, 3600, "0")
 	assert.NotNil(t, lock)
 	
 	c, w := createTestContext("UNLOCK", "/files/test.txt", nil, userID)
@@ -0,0 +1,421 @@
+package webdav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iCalendar组件名（RFC 5545 3.6）
+const (
+	ComponentVEvent   = "VEVENT"
+	ComponentVTodo    = "VTODO"
+	ComponentVJournal = "VJOURNAL"
+)
+
+// calendarComponents 日历对象可以包含的组件，VTIMEZONE只作为时区定义出现
+var calendarComponents = map[string]bool{
+	ComponentVEvent:   true,
+	ComponentVTodo:    true,
+	ComponentVJournal: true,
+}
+
+var (
+	// ErrInvalidCalendarData 内容不是合法的iCalendar数据（CALDAV:valid-calendar-data）
+	ErrInvalidCalendarData = errors.New("invalid calendar data")
+	// ErrInvalidCalendarObject 内容不满足日历对象资源的限制：只能包含同一UID的同类组件（CALDAV:valid-calendar-object-resource）
+	ErrInvalidCalendarObject = errors.New("invalid calendar object resource")
+)
+
+// CalendarObject 日历对象的索引信息，calendar-query按这些字段过滤，无需读取对象内容。
+// Start为零值表示没有起始时间，End为零值表示没有结束（如重复事件），两者都为零时与任意时间范围相交
+type CalendarObject struct {
+	UID       string
+	Component string
+	Start     time.Time
+	End       time.Time
+	Recurring bool
+}
+
+// Overlaps 判断对象是否与[start, end)相交（RFC 4791 9.9），零值表示该侧不限。
+// 起止相同的瞬时对象只在起始时间落入范围内时相交
+func (o *CalendarObject) Overlaps(start, end time.Time) bool {
+	if !end.IsZero() && !o.Start.IsZero() && !o.Start.Before(end) {
+		return false
+	}
+	if start.IsZero() || o.End.IsZero() {
+		return true
+	}
+	if o.End.Equal(o.Start) {
+		return !o.Start.Before(start)
+	}
+	return o.End.After(start)
+}
+
+// icalLine 展开折行后的一条内容行：NAME;PARAM=VALUE:VALUE
+type icalLine struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icalComponent 解析出的组件，只保留自身的属性，子组件（如VALARM）单独保存
+type icalComponent struct {
+	Name       string
+	Properties []icalLine
+	Children   []*icalComponent
+}
+
+// property 返回第一个名为name的属性
+func (c *icalComponent) property(name string) *icalLine {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// ParseCalendarObject 校验并解析一个日历对象资源（RFC 4791 4.1）：
+// 必须是单个VCALENDAR，包含一个或多个同类型、同UID的VEVENT/VTODO/VJOURNAL（重复事件的例外实例共用UID）
+func ParseCalendarObject(data []byte) (*CalendarObject, error) {
+	calendar, err := parseICalendar(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCalendarData, err)
+	}
+	if calendar.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: expected VCALENDAR", ErrInvalidCalendarData)
+	}
+	if version := calendar.property("VERSION"); version == nil || version.Value != "2.0" {
+		return nil, fmt.Errorf("%w: VERSION must be 2.0", ErrInvalidCalendarData)
+	}
+	if calendar.property("METHOD") != nil {
+		return nil, fmt.Errorf("%w: METHOD is not allowed in stored calendar objects", ErrInvalidCalendarObject)
+	}
+
+	var obj *CalendarObject
+	for _, comp := range calendar.Children {
+		if comp.Name == "VTIMEZONE" {
+			continue
+		}
+		if !calendarComponents[comp.Name] {
+			return nil, fmt.Errorf("%w: unsupported component %s", ErrInvalidCalendarObject, comp.Name)
+		}
+		uid := comp.property("UID")
+		if uid == nil || uid.Value == "" {
+			return nil, fmt.Errorf("%w: %s without UID", ErrInvalidCalendarData, comp.Name)
+		}
+
+		start, end, err := componentTimeRange(comp)
+		if err != nil {
+			return nil, err
+		}
+		recurring := comp.property("RRULE") != nil || comp.property("RDATE") != nil
+
+		if obj == nil {
+			obj = &CalendarObject{UID: uid.Value, Component: comp.Name, Start: start, End: end, Recurring: recurring}
+			continue
+		}
+		if comp.Name != obj.Component || uid.Value != obj.UID {
+			return nil, fmt.Errorf("%w: components must share type and UID", ErrInvalidCalendarObject)
+		}
+		// 例外实例可能移出主事件的时间范围，索引取所有实例的并集
+		obj.Recurring = obj.Recurring || recurring
+		if start.IsZero() || (!obj.Start.IsZero() && start.Before(obj.Start)) {
+			obj.Start = start
+		}
+		if end.IsZero() || (!obj.End.IsZero() && end.After(obj.End)) {
+			obj.End = end
+		}
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("%w: no calendar component", ErrInvalidCalendarObject)
+	}
+	if obj.Recurring {
+		// 不展开重复规则，重复事件视为没有结束
+		obj.End = time.Time{}
+	}
+	return obj, nil
+}
+
+// componentTimeRange 按RFC 4791 9.9计算组件的有效时间范围
+func componentTimeRange(comp *icalComponent) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var dateOnly bool
+	var err error
+
+	if dtstart := comp.property("DTSTART"); dtstart != nil {
+		if start, dateOnly, err = parseICalTime(dtstart); err != nil {
+			return start, end, err
+		}
+	}
+
+	switch comp.Name {
+	case ComponentVEvent:
+		if start.IsZero() {
+			return start, end, fmt.Errorf("%w: VEVENT without DTSTART", ErrInvalidCalendarData)
+		}
+		if dtend := comp.property("DTEND"); dtend != nil {
+			end, _, err = parseICalTime(dtend)
+		} else if duration := comp.property("DURATION"); duration != nil {
+			var d time.Duration
+			d, err = parseICalDuration(duration.Value)
+			end = start.Add(d)
+		} else if dateOnly {
+			end = start.AddDate(0, 0, 1)
+		} else {
+			end = start
+		}
+	case ComponentVTodo:
+		if due := comp.property("DUE"); due != nil {
+			end, _, err = parseICalTime(due)
+			if err == nil && start.IsZero() {
+				start = end
+			}
+		} else if duration := comp.property("DURATION"); duration != nil && !start.IsZero() {
+			var d time.Duration
+			d, err = parseICalDuration(duration.Value)
+			end = start.Add(d)
+		} else if !start.IsZero() {
+			end = start
+		}
+	case ComponentVJournal:
+		if dateOnly {
+			end = start.AddDate(0, 0, 1)
+		} else {
+			end = start
+		}
+	}
+	if err != nil {
+		return start, end, err
+	}
+	if !end.IsZero() && end.Before(start) {
+		return start, end, fmt.Errorf("%w: %s ends before it starts", ErrInvalidCalendarData, comp.Name)
+	}
+	return start, end, nil
+}
+
+// parseICalendar 解析iCalendar文本为组件树，校验BEGIN/END配对。vCard使用相同的内容行语法，也由此解析
+func parseICalendar(data []byte) (*icalComponent, error) {
+	lines, err := unfoldICalLines(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var root *icalComponent
+	var stack []*icalComponent
+	for _, line := range lines {
+		switch line.Name {
+		case "BEGIN":
+			name := strings.ToUpper(line.Value)
+			if name == "" {
+				return nil, errors.New("BEGIN without component name")
+			}
+			comp := &icalComponent{Name: name}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("more than one top-level component")
+				}
+				root = comp
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, comp)
+			}
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(line.Value) {
+				return nil, fmt.Errorf("unexpected END:%s", line.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("property %s outside of a component", line.Name)
+			}
+			comp := stack[len(stack)-1]
+			comp.Properties = append(comp.Properties, line)
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no content lines")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfoldICalLines 展开折行（以空格或制表符开头的行接续上一行，RFC 5545 3.1）并拆分内容行
+func unfoldICalLines(data []byte) ([]icalLine, error) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var unfolded []string
+	for _, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		if len(raw) > 0 && (raw[0] == ' ' || raw[0] == '\t') {
+			if len(unfolded) == 0 {
+				return nil, errors.New("continuation line without content line")
+			}
+			unfolded[len(unfolded)-1] += raw[1:]
+			continue
+		}
+		unfolded = append(unfolded, raw)
+	}
+
+	lines := make([]icalLine, 0, len(unfolded))
+	for _, raw := range unfolded {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		line, err := parseICalLine(raw)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// parseICalLine 拆分一条内容行，参数值可以用双引号包含:;,
+func parseICalLine(raw string) (icalLine, error) {
+	// 找到第一个不在引号中的冒号
+	colon := -1
+	quoted := false
+	for i, r := range raw {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icalLine{}, fmt.Errorf("malformed content line %q", raw)
+	}
+
+	line := icalLine{Value: raw[colon+1:]}
+	parts := splitICalParams(raw[:colon])
+	line.Name = strings.ToUpper(parts[0])
+	if line.Name == "" {
+		return icalLine{}, fmt.Errorf("malformed content line %q", raw)
+	}
+	for _, param := range parts[1:] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return icalLine{}, fmt.Errorf("malformed parameter in %s", line.Name)
+		}
+		if line.Params == nil {
+			line.Params = make(map[string]string)
+		}
+		// 重复的参数（如vCard中多个TYPE）合并为逗号分隔的值
+		name, value = strings.ToUpper(name), strings.Trim(value, `"`)
+		if previous, ok := line.Params[name]; ok {
+			value = previous + "," + value
+		}
+		line.Params[name] = value
+	}
+	return line, nil
+}
+
+// splitICalParams 按不在引号中的分号拆分属性名和参数
+func splitICalParams(s string) []string {
+	var parts []string
+	quoted := false
+	begin := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			parts = append(parts, s[begin:i])
+			begin = i + 1
+		}
+	}
+	return append(parts, s[begin:])
+}
+
+// parseICalTime 解析DATE或DATE-TIME值：UTC（Z结尾）、带TZID或浮动时间。
+// TZID无法在本地时区数据库中找到时（如Windows时区名）按UTC处理，时间范围过滤可能偏差时区差
+func parseICalTime(line *icalLine) (time.Time, bool, error) {
+	value := strings.TrimSpace(line.Value)
+	if line.Params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return t, true, fmt.Errorf("%w: invalid %s date %q", ErrInvalidCalendarData, line.Name, value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return t, false, fmt.Errorf("%w: invalid %s time %q", ErrInvalidCalendarData, line.Name, value)
+		}
+		return t, false, nil
+	}
+
+	loc := time.UTC
+	if tzid := line.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return t, false, fmt.Errorf("%w: invalid %s time %q", ErrInvalidCalendarData, line.Name, value)
+	}
+	return t.UTC(), false, nil
+}
+
+// parseICalDuration 解析RFC 5545 3.3.6的DURATION值，如P1D、PT1H30M、-P1W
+func parseICalDuration(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("%w: invalid duration %q", ErrInvalidCalendarData, value)
+
+	s := strings.TrimSpace(value)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, invalid
+	}
+	s = s[1:]
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	var total time.Duration
+	inTime := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime || len(s) == 1 {
+				return 0, invalid
+			}
+			inTime = true
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			s = s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, invalid
+		}
+		unit, ok := units[s[i]]
+		if !ok {
+			return 0, invalid
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, invalid
+		}
+		total += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * total, nil
+}
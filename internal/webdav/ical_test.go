@@ -0,0 +1,207 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func icalData(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func TestParseCalendarObject(t *testing.T) {
+	data := icalData(
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:event-1@example.com",
+		"DTSTART;TZID=Europe/Berlin:20240105T100000",
+		"DURATION:PT1H30M",
+		"SUMMARY:Planning with a long",
+		"  folded summary",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	)
+
+	obj, err := ParseCalendarObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.UID != "event-1@example.com" || obj.Component != ComponentVEvent {
+		t.Fatalf("object = %+v", obj)
+	}
+	wantStart := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)
+	if !obj.Start.Equal(wantStart) || !obj.End.Equal(wantStart.Add(90*time.Minute)) {
+		t.Errorf("range = %v - %v, want %v + 90m", obj.Start, obj.End, wantStart)
+	}
+}
+
+func TestParseCalendarObjectTimeRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		component []string
+		start     string
+		end       string
+	}{
+		{"all-day event", []string{"BEGIN:VEVENT", "UID:a", "DTSTART;VALUE=DATE:20240105", "END:VEVENT"}, "2024-01-05T00:00:00Z", "2024-01-06T00:00:00Z"},
+		{"explicit end", []string{"BEGIN:VEVENT", "UID:a", "DTSTART:20240105T100000Z", "DTEND:20240105T110000Z", "END:VEVENT"}, "2024-01-05T10:00:00Z", "2024-01-05T11:00:00Z"},
+		{"recurring event", []string{"BEGIN:VEVENT", "UID:a", "DTSTART:20240105T100000Z", "RRULE:FREQ=WEEKLY", "END:VEVENT"}, "2024-01-05T10:00:00Z", ""},
+		{"todo with due only", []string{"BEGIN:VTODO", "UID:a", "DUE:20240105T100000Z", "END:VTODO"}, "2024-01-05T10:00:00Z", "2024-01-05T10:00:00Z"},
+		{"todo without dates", []string{"BEGIN:VTODO", "UID:a", "END:VTODO"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, tt.component...)
+			obj, err := ParseCalendarObject(icalData(append(lines, "END:VCALENDAR")...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := func(ts time.Time) string {
+				if ts.IsZero() {
+					return ""
+				}
+				return ts.Format(time.RFC3339)
+			}
+			if format(obj.Start) != tt.start || format(obj.End) != tt.end {
+				t.Errorf("range = %q - %q, want %q - %q", format(obj.Start), format(obj.End), tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestParseCalendarObjectRejects(t *testing.T) {
+	event := func(uid string) []string {
+		return []string{"BEGIN:VEVENT", "UID:" + uid, "DTSTART:20240105T100000Z", "END:VEVENT"}
+	}
+	calendar := func(body ...[]string) []byte {
+		lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0"}
+		for _, b := range body {
+			lines = append(lines, b...)
+		}
+		return icalData(append(lines, "END:VCALENDAR")...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not icalendar", []byte("hello world"), ErrInvalidCalendarData},
+		{"unbalanced", icalData("BEGIN:VCALENDAR", "VERSION:2.0", "BEGIN:VEVENT", "UID:a", "END:VCALENDAR"), ErrInvalidCalendarData},
+		{"missing version", icalData(append(append([]string{"BEGIN:VCALENDAR"}, event("a")...), "END:VCALENDAR")...), ErrInvalidCalendarData},
+		{"missing uid", calendar([]string{"BEGIN:VEVENT", "DTSTART:20240105T100000Z", "END:VEVENT"}), ErrInvalidCalendarData},
+		{"event without start", calendar([]string{"BEGIN:VEVENT", "UID:a", "END:VEVENT"}), ErrInvalidCalendarData},
+		{"bad duration", calendar([]string{"BEGIN:VEVENT", "UID:a", "DTSTART:20240105T100000Z", "DURATION:1H", "END:VEVENT"}), ErrInvalidCalendarData},
+		{"no components", calendar(), ErrInvalidCalendarObject},
+		{"two uids", calendar(event("a"), event("b")), ErrInvalidCalendarObject},
+		{"mixed components", calendar(event("a"), []string{"BEGIN:VTODO", "UID:a", "END:VTODO"}), ErrInvalidCalendarObject},
+		{"scheduling method", calendar([]string{"METHOD:REQUEST"}, event("a")), ErrInvalidCalendarObject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCalendarObject(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarObjectOverlaps(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 1, 5, hour, 0, 0, 0, time.UTC) }
+	var open time.Time
+
+	tests := []struct {
+		name       string
+		obj        CalendarObject
+		start, end time.Time
+		want       bool
+	}{
+		{"inside", CalendarObject{Start: at(10), End: at(11)}, at(9), at(12), true},
+		{"ends at range start", CalendarObject{Start: at(8), End: at(9)}, at(9), at(12), false},
+		{"starts at range end", CalendarObject{Start: at(12), End: at(13)}, at(9), at(12), false},
+		{"instant at range start", CalendarObject{Start: at(9), End: at(9)}, at(9), at(12), true},
+		{"recurring started earlier", CalendarObject{Start: at(1), End: open}, at(9), at(12), true},
+		{"recurring starts later", CalendarObject{Start: at(13), End: open}, at(9), at(12), false},
+		{"undated", CalendarObject{}, at(9), at(12), true},
+		{"open range", CalendarObject{Start: at(10), End: at(11)}, at(10), open, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.obj.Overlaps(tt.start, tt.end); got != tt.want {
+				t.Errorf("Overlaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarQueryFilter(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="20240105T000000Z" end="20240106T000000Z"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+	var req calendarQueryRequest
+	if err := xml.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if !req.Prop.wants(NamespaceCalDAV, "calendar-data") || req.Prop.wants("DAV:", "getcontenttype") {
+		t.Errorf("requested properties = %+v", req.Prop.Names)
+	}
+	filter := req.Filter.CompFilter
+	if err := filter.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	if !filter.matches(&CalendarObject{Component: ComponentVEvent, Start: day.Add(10 * time.Hour), End: day.Add(11 * time.Hour)}) {
+		t.Error("event within the day should match")
+	}
+	if filter.matches(&CalendarObject{Component: ComponentVEvent, Start: day.AddDate(0, 0, 1), End: day.AddDate(0, 0, 2)}) {
+		t.Error("event on the next day should not match")
+	}
+	if filter.matches(&CalendarObject{Component: ComponentVTodo}) {
+		t.Error("todo should not match a VEVENT filter")
+	}
+}
+
+func TestCalendarQueryFilterRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   error
+	}{
+		{"not vcalendar", `<C:comp-filter name="VEVENT"/>`, ErrInvalidCalendarFilter},
+		{"local time range", `<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:time-range start="20240105T000000"/></C:comp-filter></C:comp-filter>`, ErrInvalidCalendarFilter},
+		{"prop filter", `<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:prop-filter name="SUMMARY"/></C:comp-filter></C:comp-filter>`, ErrUnsupportedCalendarFilter},
+		{"alarm filter", `<C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"><C:comp-filter name="VALARM"/></C:comp-filter></C:comp-filter>`, ErrUnsupportedCalendarFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `<C:calendar-query xmlns:C="urn:ietf:params:xml:ns:caldav"><C:filter>` + tt.filter + `</C:filter></C:calendar-query>`
+			var req calendarQueryRequest
+			if err := xml.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			if err := req.Filter.CompFilter.validate(); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"log"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -35,21 +38,18 @@ type Lock struct {
 	Token       string    `json:"token"`
 	Type        LockType  `json:"type"`
 	Scope       LockScope `json:"scope"`
-	Owner       string    `json:"owner"`
+	Owner       string    `json:"owner"` // 持有锁的用户ID
+	OwnerInfo   string    `json:"owner_info,omitempty"` // LOCK请求中客户端提交的DAV:owner
 	Timeout     int64     `json:"timeout"` // 秒
 	CreatedAt   time.Time `json:"created_at"`
 	ExpiresAt   time.Time `json:"expires_at"`
 	Path        string    `json:"path"`
 	Depth       int       `json:"depth"`     // 0 或 infinity (用-1表示)
+	LastUsed    time.Time `json:"last_used"` // 最近一次刷新或被持有者写入的时间
 	LockRoot    string    `json:"lock_root"` // 锁根路径
 	RefreshHint time.Duration `json:"refresh_hint,omitempty"`
-}
-
-// LockEntry 锁定信息用于响应
-type LockEntry struct {
-	XMLName   xml.Name      `xml:"D:lockentry"`
-	LockScope LockScopeInfo `xml:"D:lockscope"`
-	LockType  LockTypeInfo  `xml:"D:locktype"`
+	// NullResource 锁定未映射URL时创建了空资源（RFC 4918 7.3），锁过期前资源未被写入则删除
+	NullResource bool `json:"null_resource,omitempty"`
 }
 
 type LockScopeInfo struct {
@@ -80,18 +80,35 @@ type LockRoot struct {
 	Href string `xml:"D:href"`
 }
 
+var (
+	// ErrTooManyLocks 用户持有的锁达到策略上限
+	ErrTooManyLocks = errors.New("too many locks held by user")
+	// ErrSharedLockDisabled 策略不允许共享锁
+	ErrSharedLockDisabled = errors.New("shared locks are disabled")
+)
+
+// defaultLockPolicy 未调用SetPolicy时使用的策略
+var defaultLockPolicy = config.LockPolicyConfig{
+	MaxTimeout:     24 * time.Hour,
+	DefaultTimeout: time.Hour,
+	AllowShared:    true,
+}
+
 // LockManager 锁定管理器
 type LockManager struct {
 	locks       map[string]*Lock   // token -> Lock
 	locksByPath map[string][]*Lock // path -> []*Lock
 	mu          sync.RWMutex
-	maxTimeout  int64 // 最大超时时间（秒）
+	policy      config.LockPolicyConfig
 	
 	// 持久化和备份功能
 	persistence *LockPersistence
 	backup      *LockBackup
 	config      *config.LockPersistenceConfig
 	lastSync    time.Time
+
+	// expireHook 后台清理移除过期锁后调用
+	expireHook func(lock *Lock)
 }
 
 // NewLockManager 创建新的锁定管理器
@@ -104,7 +121,7 @@ func NewLockManagerWithConfig(lockConfig *config.LockPersistenceConfig) *LockMan
 	lm := &LockManager{
 		locks:       make(map[string]*Lock),
 		locksByPath: make(map[string][]*Lock),
-		maxTimeout:  86400, // 默认最大超时24小时
+		policy:      defaultLockPolicy,
 		config:      lockConfig,
 	}
 
@@ -157,15 +174,71 @@ func (lm *LockManager) generateSecureToken() string {
 	return fmt.Sprintf("opaquelocktoken:%s", hex.EncodeToString(b))
 }
 
-// CreateLock 创建锁定
-func (lm *LockManager) CreateLock(path string, lockType LockType, owner string, timeout int64, depth int) *Lock {
+// SetPolicy 设置锁策略，对之后创建和刷新的锁生效
+func (lm *LockManager) SetPolicy(policy config.LockPolicyConfig) {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
+	lm.policy = policy
+}
 
-	// 应用超时上限
-	if timeout > lm.maxTimeout || timeout <= 0 {
-		timeout = lm.maxTimeout
+// Policy 返回当前的锁策略
+func (lm *LockManager) Policy() config.LockPolicyConfig {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.policy
+}
+
+// effectiveTimeoutUnsafe 按策略确定锁的有效期（秒）：未指定时使用默认值，超过上限时截断
+func (lm *LockManager) effectiveTimeoutUnsafe(timeout int64) int64 {
+	if timeout <= 0 {
+		timeout = int64(lm.policy.DefaultTimeout / time.Second)
+	}
+	if max := int64(lm.policy.MaxTimeout / time.Second); max > 0 && timeout > max {
+		timeout = max
 	}
+	if timeout <= 0 {
+		timeout = 3600
+	}
+	return timeout
+}
+
+// CheckPolicy 检查策略是否允许owner再创建一把lockType类型的锁
+func (lm *LockManager) CheckPolicy(owner string, lockType LockType) error {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.checkPolicyUnsafe(owner, lockType)
+}
+
+// checkPolicyUnsafe 检查共享锁开关和每用户锁数上限（不加锁）
+func (lm *LockManager) checkPolicyUnsafe(owner string, lockType LockType) error {
+	if lockType == LockTypeShared && !lm.policy.AllowShared {
+		return ErrSharedLockDisabled
+	}
+	if lm.policy.MaxLocksPerUser <= 0 {
+		return nil
+	}
+	now := time.Now()
+	held := 0
+	for _, lock := range lm.locks {
+		if lock.Owner == owner && now.Before(lock.ExpiresAt) {
+			held++
+		}
+	}
+	if held >= lm.policy.MaxLocksPerUser {
+		return ErrTooManyLocks
+	}
+	return nil
+}
+
+// CreateLock 创建锁定，策略不允许时返回ErrSharedLockDisabled或ErrTooManyLocks
+func (lm *LockManager) CreateLock(path string, lockType LockType, owner string, timeout int64, depth int) (*Lock, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if err := lm.checkPolicyUnsafe(owner, lockType); err != nil {
+		return nil, err
+	}
+	timeout = lm.effectiveTimeoutUnsafe(timeout)
 
 	token := lm.generateLockToken()
 	now := time.Now()
@@ -178,14 +251,15 @@ func (lm *LockManager) CreateLock(path string, lockType LockType, owner string,
 		Timeout:     timeout,
 		CreatedAt:   now,
 		ExpiresAt:   now.Add(time.Duration(timeout) * time.Second),
-		Path:        path,
+		Path:        lockKey(path),
 		Depth:       depth,
+		LastUsed:    now,
 		LockRoot:    path,
 		RefreshHint: time.Duration(timeout/2) * time.Second, // 建议在一半时间后刷新
 	}
 
 	lm.locks[token] = lock
-	lm.locksByPath[path] = append(lm.locksByPath[path], lock)
+	lm.locksByPath[lock.Path] = append(lm.locksByPath[lock.Path], lock)
 
 	// 持久化锁定
 	if lm.persistence != nil {
@@ -194,7 +268,7 @@ func (lm *LockManager) CreateLock(path string, lockType LockType, owner string,
 		}
 	}
 
-	return lock
+	return lock, nil
 }
 
 // RefreshLock 刷新锁定
@@ -213,13 +287,12 @@ func (lm *LockManager) RefreshLock(token string, timeout int64) (*Lock, error) {
 		return nil, fmt.Errorf("lock has expired")
 	}
 
-	// 应用超时上限
-	if timeout > lm.maxTimeout || timeout <= 0 {
-		timeout = lm.maxTimeout
-	}
+	// 按策略确定有效期
+	timeout = lm.effectiveTimeoutUnsafe(timeout)
 
 	// 更新超时
 	now := time.Now()
+	lock.LastUsed = now
 	lock.Timeout = timeout
 	lock.ExpiresAt = now.Add(time.Duration(timeout) * time.Second)
 	lock.RefreshHint = time.Duration(timeout/2) * time.Second
@@ -258,7 +331,7 @@ func (lm *LockManager) GetLocksForPath(path string) []*Lock {
 	defer lm.mu.RUnlock()
 
 	var validLocks []*Lock
-	locks := lm.locksByPath[path]
+	locks := lm.locksByPath[lockKey(path)]
 
 	for _, lock := range locks {
 		// 只返回未过期的锁
@@ -275,7 +348,7 @@ func (lm *LockManager) GetLockForPathAndUser(path, userID string) *Lock {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	locks := lm.locksByPath[path]
+	locks := lm.locksByPath[lockKey(path)]
 
 	for _, lock := range locks {
 		// 只返回未过期的锁
@@ -304,6 +377,35 @@ func (lm *LockManager) RemoveLock(token string) bool {
 	return result
 }
 
+// RemoveLocksUnder 移除路径本身及其下所有资源上的锁，返回移除的数量。
+// 资源被移动后锁不随资源迁移（RFC 4918 9.9.4），源路径上的锁需要一并释放
+func (lm *LockManager) RemoveLocksUnder(path string) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	root := lockKey(path)
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	var tokens []string
+	for lockPath, locks := range lm.locksByPath {
+		if lockPath != root && !strings.HasPrefix(lockPath, prefix) {
+			continue
+		}
+		for _, lock := range locks {
+			tokens = append(tokens, lock.Token)
+		}
+	}
+
+	for _, token := range tokens {
+		lm.removeLockUnsafe(token)
+		if lm.persistence != nil {
+			if err := lm.persistence.DeleteLock(token); err != nil {
+				log.Printf("Warning: failed to delete lock from persistence: %v", err)
+			}
+		}
+	}
+	return len(tokens)
+}
+
 // removeLockUnsafe 不加锁的移除锁定（内部使用）
 func (lm *LockManager) removeLockUnsafe(token string) bool {
 	lock, exists := lm.locks[token]
@@ -329,15 +431,68 @@ func (lm *LockManager) removeLockUnsafe(token string) bool {
 	return true
 }
 
-// CheckLock 检查路径的锁定状态
+// lockKey 锁的索引路径：集合带或不带结尾斜杠视为同一资源
+func lockKey(resourcePath string) string {
+	return path.Clean("/" + resourcePath)
+}
+
+// locksConflict 两把锁的作用域是否互斥（RFC 4918 6.1）：
+// 共享锁之间可以共存，排他锁与任何锁（无论共享还是排他）都冲突
+func locksConflict(held, requested LockType) bool {
+	return held == LockTypeExclusive || requested == LockTypeExclusive
+}
+
+// ancestorKeys 返回key的全部上级路径（由近及远，含根目录）
+func ancestorKeys(key string) []string {
+	var ancestors []string
+	for current := key; current != "/"; {
+		current = path.Dir(current)
+		ancestors = append(ancestors, current)
+	}
+	return ancestors
+}
+
+// coveringLocksUnsafe 返回作用于key的未过期锁：资源自身的锁以及上级目录的深度锁（不加锁）
+func (lm *LockManager) coveringLocksUnsafe(key string) []*Lock {
+	now := time.Now()
+	var covering []*Lock
+	for _, lock := range lm.locksByPath[key] {
+		if now.Before(lock.ExpiresAt) {
+			covering = append(covering, lock)
+		}
+	}
+	for _, ancestor := range ancestorKeys(key) {
+		for _, lock := range lm.locksByPath[ancestor] {
+			if lock.Depth != 0 && now.Before(lock.ExpiresAt) {
+				covering = append(covering, lock)
+			}
+		}
+	}
+	return covering
+}
+
+// CheckLock 检查写操作是否被锁定：共享锁和排他锁都只允许持有者修改资源（RFC 4918 7），
+// 用户不持有资源上的任何锁时返回其中一把。持有者通过检查时记为锁的一次使用
 func (lm *LockManager) CheckLock(path string, userID string) (bool, *Lock, error) {
-	locks := lm.GetLocksForPath(path)
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 
-	for _, lock := range locks {
-		// 如果是排他锁且不是持有者
-		if lock.Type == LockTypeExclusive && lock.Owner != userID {
-			return true, lock, fmt.Errorf("resource is locked exclusively by %s", lock.Owner)
+	now := time.Now()
+	var foreign *Lock
+	for _, lock := range lm.locksByPath[lockKey(path)] {
+		if now.After(lock.ExpiresAt) {
+			continue
+		}
+		if lock.Owner == userID {
+			lock.LastUsed = now
+			return false, nil, nil
 		}
+		if foreign == nil {
+			foreign = lock
+		}
+	}
+	if foreign != nil {
+		return true, foreign, fmt.Errorf("resource is locked (%s) by %s", foreign.Scope, foreign.Owner)
 	}
 
 	return false, nil, nil
@@ -358,38 +513,31 @@ func (lm *LockManager) CheckExclusiveLock(path string, userID string) (bool, *Lo
 	return false, nil, nil
 }
 
-// CheckLockConflict 检查锁定冲突（用于创建新锁时）
+// CheckLockConflict 检查锁定冲突（用于创建新锁时）。按RFC 4918 6.1比较作用域：
+// 资源自身的锁和上级目录的深度锁都参与比较；新锁为深度锁时还要比较子资源上的锁。
+// 同一用户持有的锁不视为冲突
 func (lm *LockManager) CheckLockConflict(path string, newLockType LockType, userID string, depth int) (bool, *Lock, error) {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	// 检查精确路径匹配
-	if locks, ok := lm.locksByPath[path]; ok {
-		for _, lock := range locks {
-			// 跳过过期的锁
-			if time.Now().After(lock.ExpiresAt) {
-				continue
-			}
+	key := lockKey(path)
+	now := time.Now()
 
-			// 排他锁与任何锁冲突
-			if lock.Type == LockTypeExclusive || newLockType == LockTypeExclusive {
-				if lock.Owner != userID {
-					return true, lock, fmt.Errorf("conflicting lock exists")
-				}
-			}
+	// 检查精确路径匹配
+	for _, lock := range lm.locksByPath[key] {
+		if now.Before(lock.ExpiresAt) && lock.Owner != userID && locksConflict(lock.Type, newLockType) {
+			return true, lock, fmt.Errorf("conflicting %s lock exists", lock.Scope)
 		}
 	}
 
-	// 如果是深度锁，检查父路径
-	if depth != 0 {
-		if conflict, lock := lm.checkParentConflictsUnsafe(path, newLockType, userID); conflict {
-			return true, lock, fmt.Errorf("parent path is locked")
-		}
+	// 上级目录的深度锁覆盖本资源，无论新锁的深度如何都要检查
+	if conflict, lock := lm.checkParentConflictsUnsafe(key, newLockType, userID); conflict {
+		return true, lock, fmt.Errorf("parent path is locked")
 	}
 
 	// 检查子路径（如果新锁是深度锁）
 	if depth != 0 {
-		if conflict, lock := lm.checkChildrenConflictsUnsafe(path, newLockType, userID); conflict {
+		if conflict, lock := lm.checkChildrenConflictsUnsafe(key, newLockType, userID); conflict {
 			return true, lock, fmt.Errorf("child path is locked")
 		}
 	}
@@ -398,28 +546,16 @@ func (lm *LockManager) CheckLockConflict(path string, newLockType LockType, user
 }
 
 // checkParentConflictsUnsafe 检查父路径冲突（不加锁）
-func (lm *LockManager) checkParentConflictsUnsafe(path string, newLockType LockType, userID string) (bool, *Lock) {
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-
-	for i := len(parts) - 1; i > 0; i-- {
-		parentPath := "/" + strings.Join(parts[:i], "/")
-
-		if locks, ok := lm.locksByPath[parentPath]; ok {
-			for _, lock := range locks {
-				// 跳过过期的锁
-				if time.Now().After(lock.ExpiresAt) {
-					continue
-				}
-
-				// 只有深度锁会影响子路径
-				if lock.Depth != 0 {
-					// 排他锁与任何锁冲突
-					if lock.Type == LockTypeExclusive || newLockType == LockTypeExclusive {
-						if lock.Owner != userID {
-							return true, lock
-						}
-					}
-				}
+func (lm *LockManager) checkParentConflictsUnsafe(key string, newLockType LockType, userID string) (bool, *Lock) {
+	now := time.Now()
+	for _, parentPath := range ancestorKeys(key) {
+		for _, lock := range lm.locksByPath[parentPath] {
+			// 跳过过期的锁；只有深度锁会影响子路径
+			if now.After(lock.ExpiresAt) || lock.Depth == 0 {
+				continue
+			}
+			if lock.Owner != userID && locksConflict(lock.Type, newLockType) {
+				return true, lock
 			}
 		}
 	}
@@ -428,26 +564,23 @@ func (lm *LockManager) checkParentConflictsUnsafe(path string, newLockType LockT
 }
 
 // checkChildrenConflictsUnsafe 检查子路径冲突（不加锁）
-func (lm *LockManager) checkChildrenConflictsUnsafe(path string, newLockType LockType, userID string) (bool, *Lock) {
-	prefix := strings.TrimSuffix(path, "/") + "/"
+func (lm *LockManager) checkChildrenConflictsUnsafe(key string, newLockType LockType, userID string) (bool, *Lock) {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	now := time.Now()
 
 	for childPath, locks := range lm.locksByPath {
 		// 检查是否为子路径
-		if !strings.HasPrefix(childPath, prefix) && childPath != path {
+		if childPath == key || !strings.HasPrefix(childPath, prefix) {
 			continue
 		}
 
 		for _, lock := range locks {
 			// 跳过过期的锁
-			if time.Now().After(lock.ExpiresAt) {
+			if now.After(lock.ExpiresAt) {
 				continue
 			}
-
-			// 排他锁与任何锁冲突
-			if lock.Type == LockTypeExclusive || newLockType == LockTypeExclusive {
-				if lock.Owner != userID {
-					return true, lock
-				}
+			if lock.Owner != userID && locksConflict(lock.Type, newLockType) {
+				return true, lock
 			}
 		}
 	}
@@ -455,29 +588,20 @@ func (lm *LockManager) checkChildrenConflictsUnsafe(path string, newLockType Loc
 	return false, nil
 }
 
-// CheckParentLocks 检查父目录锁定
+// CheckParentLocks 检查父目录锁定：上级目录上其他用户的深度锁（共享或排他）禁止在其下增删资源
 func (lm *LockManager) CheckParentLocks(path string, userID string) (bool, *Lock, error) {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-
-	for i := len(parts) - 1; i > 0; i-- {
-		parentPath := "/" + strings.Join(parts[:i], "/")
-
-		if locks, ok := lm.locksByPath[parentPath]; ok {
-			for _, lock := range locks {
-				// 跳过过期的锁
-				if time.Now().After(lock.ExpiresAt) {
-					continue
-				}
-
-				// 只有深度锁会影响子路径
-				if lock.Depth != 0 {
-					if lock.Type == LockTypeExclusive && lock.Owner != userID {
-						return true, lock, fmt.Errorf("parent path is locked by %s", lock.Owner)
-					}
-				}
+	now := time.Now()
+	for _, parentPath := range ancestorKeys(lockKey(path)) {
+		for _, lock := range lm.locksByPath[parentPath] {
+			// 跳过过期的锁；只有深度锁会影响子路径
+			if now.After(lock.ExpiresAt) || lock.Depth == 0 {
+				continue
+			}
+			if lock.Owner != userID {
+				return true, lock, fmt.Errorf("parent path is locked by %s", lock.Owner)
 			}
 		}
 	}
@@ -485,6 +609,14 @@ func (lm *LockManager) CheckParentLocks(path string, userID string) (bool, *Lock
 	return false, nil, nil
 }
 
+// ActiveLocksFor 返回作用于路径的未过期锁：路径自身的锁以及上级目录的深度锁（RFC 4918 15.8）
+func (lm *LockManager) ActiveLocksFor(resourcePath string) []*Lock {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return lm.coveringLocksUnsafe(lockKey(resourcePath))
+}
+
 // GetLockDiscovery 获取锁定发现信息
 func (lm *LockManager) GetLockDiscovery(path string) []ActiveLock {
 	locks := lm.GetLocksForPath(path)
@@ -496,8 +628,8 @@ func (lm *LockManager) GetLockDiscovery(path string) []ActiveLock {
 			LockType: LockTypeInfo{
 				Write: &struct{}{},
 			},
-			Depth:   fmt.Sprintf("%d", lock.Depth),
-			Owner:   lock.Owner,
+			Depth:   FormatDepth(lock.Depth),
+			Owner:   lock.OwnerInfo,
 			Timeout: fmt.Sprintf("Second-%d", lock.Timeout),
 			LockToken: LockToken{
 				Href: lock.Token,
@@ -523,19 +655,26 @@ func (lm *LockManager) GetLockDiscovery(path string) []ActiveLock {
 // CleanExpiredLocks 清理过期的锁定
 func (lm *LockManager) CleanExpiredLocks() int {
 	lm.mu.Lock()
-	defer lm.mu.Unlock()
 
 	now := time.Now()
-	expiredTokens := []string{}
+	var expired []*Lock
 
-	for token, lock := range lm.locks {
-		if now.After(lock.ExpiresAt) {
-			expiredTokens = append(expiredTokens, token)
+	idle := lm.policy.IdleTimeout
+	for _, lock := range lm.locks {
+		// 超过空闲时间未刷新也未使用的锁提前释放
+		if now.After(lock.ExpiresAt) || (idle > 0 && now.Sub(lock.LastUsed) > idle) {
+			expired = append(expired, lock)
 		}
 	}
 
-	for _, token := range expiredTokens {
-		lm.removeLockUnsafe(token)
+	for _, lock := range expired {
+		lm.removeLockUnsafe(lock.Token)
+		// 因空闲释放的锁尚未到期，不会被持久化存储的过期清理删除
+		if lm.persistence != nil && now.Before(lock.ExpiresAt) {
+			if err := lm.persistence.DeleteLock(lock.Token); err != nil {
+				log.Printf("Warning: failed to delete lock from persistence: %v", err)
+			}
+		}
 	}
 
 	// 清理持久化存储中的过期锁定
@@ -547,7 +686,82 @@ func (lm *LockManager) CleanExpiredLocks() int {
 		}
 	}
 
-	return len(expiredTokens)
+	hook := lm.expireHook
+	lm.mu.Unlock()
+
+	// 回调在释放锁之后执行，回调中可以再次访问LockManager
+	if hook != nil {
+		for _, lock := range expired {
+			hook(lock)
+		}
+	}
+
+	return len(expired)
+}
+
+// SetExpireHook 设置过期锁被清理后的回调
+func (lm *LockManager) SetExpireHook(hook func(lock *Lock)) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.expireHook = hook
+}
+
+// MarkNullResource 记录锁是在未映射的URL上创建的，并同时创建了空资源
+func (lm *LockManager) MarkNullResource(token string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lock, ok := lm.locks[token]; ok {
+		lock.NullResource = true
+	}
+}
+
+// SetOwnerInfo 记录客户端在LOCK请求中提交的DAV:owner，锁发现时原样返回
+func (lm *LockManager) SetOwnerInfo(token, ownerInfo string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lock, ok := lm.locks[token]; ok {
+		lock.OwnerInfo = ownerInfo
+	}
+}
+
+// ClearNullResource 资源被写入后不再是空资源，锁过期时不再删除
+func (lm *LockManager) ClearNullResource(path string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, lock := range lm.locksByPath[lockKey(path)] {
+		lock.NullResource = false
+	}
+}
+
+// FindLocks 列出未过期的锁，可按持有者和路径（路径本身及其下的资源）过滤，按创建时间排序
+func (lm *LockManager) FindLocks(owner, pathPrefix string) []*Lock {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	var root, prefix string
+	if pathPrefix != "" {
+		root = lockKey(pathPrefix)
+		prefix = strings.TrimSuffix(root, "/") + "/"
+	}
+
+	now := time.Now()
+	locks := []*Lock{}
+	for _, lock := range lm.locks {
+		if now.After(lock.ExpiresAt) || (owner != "" && lock.Owner != owner) {
+			continue
+		}
+		if root != "" && lock.Path != root && !strings.HasPrefix(lock.Path, prefix) {
+			continue
+		}
+		locks = append(locks, lock)
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].CreatedAt.Before(locks[j].CreatedAt)
+	})
+	return locks
 }
 
 // startCleanupTask 启动后台清理任务
@@ -606,6 +820,10 @@ func (lm *LockManager) restoreFromPersistence() error {
 	}
 
 	for _, lock := range locks {
+		// 旧版本按请求路径保存，恢复时统一为规范路径
+		lock.Path = lockKey(lock.Path)
+		// 使用时间不持久化，从恢复时开始计算空闲
+		lock.LastUsed = time.Now()
 		lm.locks[lock.Token] = lock
 		lm.locksByPath[lock.Path] = append(lm.locksByPath[lock.Path], lock)
 	}
@@ -0,0 +1,274 @@
+package webdav
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestActiveLocksFor(t *testing.T) {
+	lm := newTestLockManager()
+	deep := createTestLock(t, lm, "/projects/", LockTypeExclusive, "alice", -1)
+	shallow := createTestLock(t, lm, "/docs", LockTypeShared, "alice", 0)
+	file := createTestLock(t, lm, "/projects/plan.txt", LockTypeShared, "bob", 0)
+
+	tests := []struct {
+		path string
+		want []*Lock
+	}{
+		{"/projects", []*Lock{deep}},
+		{"/projects/plan.txt", []*Lock{file, deep}},
+		{"/projects/sub/a.txt", []*Lock{deep}},
+		{"/docs/", []*Lock{shallow}},
+		{"/docs/a.txt", nil},
+		{"/other", nil},
+	}
+	for _, tt := range tests {
+		got := lm.ActiveLocksFor(tt.path)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d locks, want %d", tt.path, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: lock %d = %s, want %s", tt.path, i, got[i].Token, tt.want[i].Token)
+			}
+		}
+	}
+}
+
+func newTestLockManager() *LockManager {
+	return &LockManager{
+		locks:       make(map[string]*Lock),
+		locksByPath: make(map[string][]*Lock),
+		policy:      defaultLockPolicy,
+	}
+}
+
+func createTestLock(t *testing.T, lm *LockManager, path string, lockType LockType, owner string, depth int) *Lock {
+	t.Helper()
+	lock, err := lm.CreateLock(path, lockType, owner, 600, depth)
+	if err != nil {
+		t.Fatalf("CreateLock(%s): %v", path, err)
+	}
+	return lock
+}
+
+func TestLockConflictMatrix(t *testing.T) {
+	scopes := []LockType{LockTypeShared, LockTypeExclusive}
+	placements := []struct {
+		name      string
+		heldPath  string
+		heldDepth int
+		newPath   string
+		newDepth  int
+		applies   bool // 已有锁是否覆盖新锁的范围
+	}{
+		{"same resource", "/docs/a.txt", 0, "/docs/a.txt", 0, true},
+		{"same collection with trailing slash", "/docs/", 0, "/docs", 0, true},
+		{"depth infinity parent", "/docs", -1, "/docs/a.txt", 0, true},
+		{"depth infinity grandparent", "/", -1, "/docs/sub/a.txt", 0, true},
+		{"depth 0 parent", "/docs", 0, "/docs/a.txt", 0, false},
+		{"descendant of new depth infinity lock", "/docs/sub/a.txt", 0, "/docs", -1, true},
+		{"descendant of new depth 0 lock", "/docs/a.txt", 0, "/docs", 0, false},
+		{"sibling", "/docs/a.txt", -1, "/docs/b.txt", -1, false},
+		{"name prefix is not a descendant", "/docs", -1, "/docs2/a.txt", 0, false},
+	}
+
+	for _, pl := range placements {
+		for _, held := range scopes {
+			for _, requested := range scopes {
+				name := pl.name + "/" + string(held) + "-" + string(requested)
+				t.Run(name, func(t *testing.T) {
+					lm := newTestLockManager()
+					createTestLock(t, lm, pl.heldPath, held, "alice", pl.heldDepth)
+
+					want := pl.applies && (held == LockTypeExclusive || requested == LockTypeExclusive)
+					conflict, lock, _ := lm.CheckLockConflict(pl.newPath, requested, "bob", pl.newDepth)
+					if conflict != want {
+						t.Fatalf("conflict = %v, want %v", conflict, want)
+					}
+					if conflict && lock.Owner != "alice" {
+						t.Errorf("conflicting lock owner = %s", lock.Owner)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSharedLocksCoexist(t *testing.T) {
+	lm := newTestLockManager()
+	for _, owner := range []string{"alice", "bob", "carol"} {
+		if conflict, _, err := lm.CheckLockConflict("/shared.txt", LockTypeShared, owner, 0); conflict {
+			t.Fatalf("shared lock for %s: %v", owner, err)
+		}
+		createTestLock(t, lm, "/shared.txt", LockTypeShared, owner, 0)
+	}
+	if got := len(lm.GetLocksForPath("/shared.txt")); got != 3 {
+		t.Fatalf("locks = %d, want 3", got)
+	}
+	if conflict, _, _ := lm.CheckLockConflict("/shared.txt", LockTypeExclusive, "dave", 0); !conflict {
+		t.Error("exclusive lock must not be granted while shared locks exist")
+	}
+
+	// 共享锁同样只允许持有者写入
+	if locked, _, _ := lm.CheckLock("/shared.txt", "alice"); locked {
+		t.Error("lock holder should be allowed to write")
+	}
+	if locked, _, _ := lm.CheckLock("/shared.txt", "dave"); !locked {
+		t.Error("write by a non-holder should be locked")
+	}
+	if locked, _, _ := lm.CheckExclusiveLock("/shared.txt", "dave"); locked {
+		t.Error("shared locks are not exclusive locks")
+	}
+}
+
+func TestLockConflictIgnoresOwnAndExpiredLocks(t *testing.T) {
+	lm := newTestLockManager()
+	createTestLock(t, lm, "/docs", LockTypeExclusive, "alice", -1)
+	if conflict, _, _ := lm.CheckLockConflict("/docs/a.txt", LockTypeExclusive, "alice", 0); conflict {
+		t.Error("locks held by the same user should not conflict")
+	}
+
+	expired := createTestLock(t, lm, "/old.txt", LockTypeExclusive, "alice", 0)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if conflict, _, _ := lm.CheckLockConflict("/old.txt", LockTypeShared, "bob", 0); conflict {
+		t.Error("expired locks should not conflict")
+	}
+}
+
+func TestParentLocksBlockNonHolders(t *testing.T) {
+	lm := newTestLockManager()
+	createTestLock(t, lm, "/team/", LockTypeShared, "alice", -1)
+	createTestLock(t, lm, "/flat", LockTypeExclusive, "alice", 0)
+
+	tests := []struct {
+		path   string
+		userID string
+		want   bool
+	}{
+		{"/team/new.txt", "bob", true},
+		{"/team/sub/new.txt", "bob", true},
+		{"/team/new.txt", "alice", false},
+		{"/flat/new.txt", "bob", false},
+	}
+	for _, tt := range tests {
+		if locked, _, _ := lm.CheckParentLocks(tt.path, tt.userID); locked != tt.want {
+			t.Errorf("CheckParentLocks(%s, %s) = %v, want %v", tt.path, tt.userID, locked, tt.want)
+		}
+	}
+}
+
+func TestExpireHookSeesNullResources(t *testing.T) {
+	lm := newTestLockManager()
+	reserved := createTestLock(t, lm, "/draft.docx", LockTypeExclusive, "alice", 0)
+	lm.MarkNullResource(reserved.Token)
+	written := createTestLock(t, lm, "/report.docx", LockTypeExclusive, "alice", 0)
+	lm.MarkNullResource(written.Token)
+	lm.ClearNullResource("/report.docx")
+	reserved.ExpiresAt = time.Now().Add(-time.Second)
+	written.ExpiresAt = time.Now().Add(-time.Second)
+
+	var expired []string
+	lm.SetExpireHook(func(lock *Lock) {
+		if lock.NullResource {
+			expired = append(expired, lock.Path)
+		}
+	})
+	if n := lm.CleanExpiredLocks(); n != 2 {
+		t.Fatalf("cleaned %d locks, want 2", n)
+	}
+	if len(expired) != 1 || expired[0] != "/draft.docx" {
+		t.Errorf("unused null resources = %v, want [/draft.docx]", expired)
+	}
+	if len(lm.locks) != 0 || len(lm.locksByPath) != 0 {
+		t.Errorf("expired locks still indexed")
+	}
+}
+
+func TestFindLocks(t *testing.T) {
+	lm := newTestLockManager()
+	first := createTestLock(t, lm, "/docs/a.txt", LockTypeExclusive, "alice", 0)
+	second := createTestLock(t, lm, "/docs/sub/", LockTypeShared, "bob", -1)
+	third := createTestLock(t, lm, "/docs2/b.txt", LockTypeShared, "alice", 0)
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+	third.CreatedAt = first.CreatedAt.Add(2 * time.Second)
+	expired := createTestLock(t, lm, "/docs/old.txt", LockTypeExclusive, "alice", 0)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+
+	tests := []struct {
+		owner, path string
+		want        []*Lock
+	}{
+		{"", "", []*Lock{first, second, third}},
+		{"alice", "", []*Lock{first, third}},
+		{"", "/docs", []*Lock{first, second}},
+		{"", "/docs/sub", []*Lock{second}},
+		{"bob", "/docs2", []*Lock{}},
+	}
+	for _, tt := range tests {
+		got := lm.FindLocks(tt.owner, tt.path)
+		if len(got) != len(tt.want) {
+			t.Errorf("FindLocks(%q, %q) = %d locks, want %d", tt.owner, tt.path, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("FindLocks(%q, %q)[%d] = %s, want %s", tt.owner, tt.path, i, got[i].Path, tt.want[i].Path)
+			}
+		}
+	}
+}
+
+func TestLockPolicy(t *testing.T) {
+	lm := newTestLockManager()
+	lm.SetPolicy(config.LockPolicyConfig{
+		MaxTimeout:      10 * time.Minute,
+		DefaultTimeout:  2 * time.Minute,
+		MaxLocksPerUser: 2,
+		IdleTimeout:     time.Minute,
+	})
+
+	if _, err := lm.CreateLock("/shared.txt", LockTypeShared, "alice", 60, 0); !errors.Is(err, ErrSharedLockDisabled) {
+		t.Errorf("shared lock err = %v, want ErrSharedLockDisabled", err)
+	}
+
+	unspecified, err := lm.CreateLock("/a.txt", LockTypeExclusive, "alice", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unspecified.Timeout != 120 {
+		t.Errorf("default timeout = %d, want 120", unspecified.Timeout)
+	}
+	infinite, err := lm.CreateLock("/b.txt", LockTypeExclusive, "alice", 86400*365, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infinite.Timeout != 600 {
+		t.Errorf("capped timeout = %d, want 600", infinite.Timeout)
+	}
+
+	if _, err := lm.CreateLock("/c.txt", LockTypeExclusive, "alice", 60, 0); !errors.Is(err, ErrTooManyLocks) {
+		t.Errorf("third lock err = %v, want ErrTooManyLocks", err)
+	}
+	if err := lm.CheckPolicy("bob", LockTypeExclusive); err != nil {
+		t.Errorf("limit should be per user: %v", err)
+	}
+
+	// 空闲超时：未被刷新或使用的锁在清理时释放，持有者写入会刷新使用时间
+	unspecified.LastUsed = time.Now().Add(-2 * time.Minute)
+	infinite.LastUsed = time.Now().Add(-2 * time.Minute)
+	lm.CheckLock("/b.txt", "alice")
+	if n := lm.CleanExpiredLocks(); n != 1 {
+		t.Fatalf("cleaned %d idle locks, want 1", n)
+	}
+	if _, ok := lm.GetLock(infinite.Token); !ok {
+		t.Error("recently used lock should be kept")
+	}
+	if _, err := lm.CreateLock("/c.txt", LockTypeExclusive, "alice", 60, 0); err != nil {
+		t.Errorf("lock after idle release: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package webdav
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// macOS兼容模式（config.MacOSCompatConfig.Mode）
+const (
+	// MacOSCompatOff Finder元数据文件按普通文件处理
+	MacOSCompatOff = "off"
+	// MacOSCompatReject 拒绝创建Finder元数据文件
+	MacOSCompatReject = "reject"
+	// MacOSCompatHide 照常保存Finder元数据文件，但不计入用量、不在PROPFIND列表中出现
+	MacOSCompatHide = "hide"
+)
+
+// validateMacOSCompat 检查兼容模式和文件名模式是否有效
+func validateMacOSCompat(cfg config.MacOSCompatConfig) error {
+	switch cfg.Mode {
+	case "", MacOSCompatOff, MacOSCompatReject, MacOSCompatHide:
+	default:
+		return fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	for _, pattern := range cfg.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesMacOSMetadata 判断资源的文件名是否匹配Finder元数据文件的模式
+func matchesMacOSMetadata(patterns []string, resourcePath string) bool {
+	name := path.Base(path.Clean("/" + resourcePath))
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectsMacOSMetadata reject模式下Finder元数据文件不允许创建
+func (h *Handler) rejectsMacOSMetadata(resourcePath string) bool {
+	compat := h.config.MacOSCompat
+	return compat.Mode == MacOSCompatReject && matchesMacOSMetadata(compat.Patterns, resourcePath)
+}
+
+// hidesMacOSMetadata hide模式下Finder元数据文件不计入用量，也不在集合的PROPFIND列表中出现，
+// 直接访问（GET、Depth: 0的PROPFIND）不受影响，Finder仍能读回自己写入的扩展属性
+func (h *Handler) hidesMacOSMetadata(resourcePath string) bool {
+	compat := h.config.MacOSCompat
+	return compat.Mode == MacOSCompatHide && matchesMacOSMetadata(compat.Patterns, resourcePath)
+}
+
+// QuotaExempt 判断对象是否不计入用量，供配额一致性检查按相同规则计算实际用量
+func (h *Handler) QuotaExempt(key string) bool {
+	return h.hidesMacOSMetadata(key)
+}
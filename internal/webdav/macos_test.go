@@ -0,0 +1,62 @@
+package webdav
+
+import (
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestMatchesMacOSMetadata(t *testing.T) {
+	patterns := []string{"._*", ".DS_Store"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/._report.docx", true},
+		{"/docs/._report.docx", true},
+		{"/docs/.DS_Store", true},
+		{"/docs/._resources/", true},
+		{"/docs/report.docx", false},
+		{"/docs/.ds_store", false},
+		{"/._docs/report.docx", false},
+		{"/docs/a._b", false},
+	}
+	for _, tt := range tests {
+		if got := matchesMacOSMetadata(patterns, tt.path); got != tt.want {
+			t.Errorf("matchesMacOSMetadata(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if matchesMacOSMetadata(nil, "/._report.docx") {
+		t.Error("no patterns must match nothing")
+	}
+}
+
+func TestMacOSCompatModes(t *testing.T) {
+	h := &Handler{}
+	for _, tt := range []struct {
+		mode           string
+		reject, hidden bool
+	}{
+		{MacOSCompatOff, false, false},
+		{MacOSCompatReject, true, false},
+		{MacOSCompatHide, false, true},
+	} {
+		h.config.MacOSCompat = config.MacOSCompatConfig{Mode: tt.mode, Patterns: []string{"._*", ".DS_Store"}}
+		if got := h.rejectsMacOSMetadata("/docs/._a.txt"); got != tt.reject {
+			t.Errorf("mode %s: reject = %v, want %v", tt.mode, got, tt.reject)
+		}
+		if got := h.QuotaExempt("docs/._a.txt"); got != tt.hidden {
+			t.Errorf("mode %s: quota exempt = %v, want %v", tt.mode, got, tt.hidden)
+		}
+		if h.rejectsMacOSMetadata("/docs/a.txt") || h.QuotaExempt("docs/a.txt") {
+			t.Errorf("mode %s: regular files must not be affected", tt.mode)
+		}
+	}
+
+	if err := validateMacOSCompat(config.MacOSCompatConfig{Mode: "drop"}); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	if err := validateMacOSCompat(config.MacOSCompatConfig{Mode: MacOSCompatHide, Patterns: []string{"[._*"}}); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+}
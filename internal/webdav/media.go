@@ -0,0 +1,55 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+)
+
+// NamespaceMedia 从图片、视频和音频中提取的元数据属性（media:width、media:taken-at等）。
+// 属性由媒体元数据服务写入，作为死属性随资源移动、复制，PROPPATCH不能修改
+const NamespaceMedia = "http://webdav-gateway.org/media"
+
+// SetMediaProperties 替换资源上的全部媒体元数据属性，values为空时只删除原有的属性
+func (s *PropertyService) SetMediaProperties(ctx context.Context, userID, resourcePath string, values map[string]string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, p := range propertyPathForms(resourcePath) {
+		builder := NewDeleteBuilder("properties").
+			Where("user_id = ? AND path = ? AND namespace = ?", userID, p, NamespaceMedia)
+		if _, err := tx.ExecContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...); err != nil {
+			return fmt.Errorf("删除媒体属性失败: %v", err)
+		}
+	}
+	for name, value := range values {
+		property := &DatabaseProperty{
+			UserID:    userID,
+			Path:      trimPropertyPath(resourcePath),
+			Namespace: NamespaceMedia,
+			Name:      name,
+			Value:     value,
+		}
+		if err := s.createPropertyTx(tx, property); err != nil {
+			return fmt.Errorf("写入属性%s失败: %v", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, resourcePath, false)
+	return nil
+}
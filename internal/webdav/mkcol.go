@@ -0,0 +1,117 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// HeaderCreateParents MKCOL扩展请求头，值为T时依次创建缺失的中间集合（类似mkdir -p），
+// 未携带时按RFC 4918在父集合不存在时返回409
+const HeaderCreateParents = "X-Create-Parents"
+
+// hasRequestBody 判断请求是否携带请求体，分块传输编码时长度为-1
+func hasRequestBody(r *http.Request) bool {
+	return r.ContentLength != 0
+}
+
+// 扩展MKCOL（RFC 5689）可以创建的集合类型
+const (
+	collectionKindCalendar    = "calendar"
+	collectionKindAddressbook = "addressbook"
+)
+
+// extendedMkcolRequest 扩展MKCOL请求体，只处理资源类型和日历、通讯录描述
+type extendedMkcolRequest struct {
+	XMLName xml.Name `xml:"DAV: mkcol"`
+	Set     struct {
+		Prop struct {
+			ResourceType *struct {
+				Types []daslNode `xml:",any"`
+			} `xml:"DAV: resourcetype"`
+			CalendarDescription    string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+			AddressbookDescription string `xml:"urn:ietf:params:xml:ns:carddav addressbook-description"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+}
+
+// parseExtendedMkcol 解析扩展MKCOL请求体（readXMLBody的结果），不是DAV:mkcol的请求体返回错误（415）
+func parseExtendedMkcol(body []byte) (*extendedMkcolRequest, error) {
+	var req extendedMkcolRequest
+	if err := davxml.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// collectionKind 返回请求创建的集合类型，空字符串为普通集合；
+// resourcetype中有不支持的类型或同时要求日历和通讯录时ok为false（DAV:valid-resourcetype）
+func (r *extendedMkcolRequest) collectionKind() (kind string, ok bool) {
+	if r == nil || r.Set.Prop.ResourceType == nil {
+		return "", true
+	}
+	for _, t := range r.Set.Prop.ResourceType.Types {
+		var k string
+		switch t.XMLName {
+		case xml.Name{Space: "DAV:", Local: "collection"}:
+			continue
+		case xml.Name{Space: NamespaceCalDAV, Local: "calendar"}:
+			k = collectionKindCalendar
+		case xml.Name{Space: NamespaceCardDAV, Local: "addressbook"}:
+			k = collectionKindAddressbook
+		default:
+			return "", false
+		}
+		if kind != "" && kind != k {
+			return "", false
+		}
+		kind = k
+	}
+	return kind, true
+}
+
+// createParentsRequested 判断MKCOL是否要求创建中间集合
+func createParentsRequested(c *gin.Context) bool {
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(HeaderCreateParents))) {
+	case "t", "true", "1":
+		return true
+	}
+	return false
+}
+
+// collectionExists 判断集合是否存在：根目录、有目录标记或至少有一个子对象
+func (h *Handler) collectionExists(ctx context.Context, uid uuid.UUID, collectionPath string) bool {
+	_, err := h.storage.StatResource(ctx, uid, strings.TrimSuffix(collectionPath, "/")+"/")
+	return err == nil
+}
+
+// resourceExists 判断路径上是否已有文件或集合
+func (h *Handler) resourceExists(ctx context.Context, uid uuid.UUID, resourcePath string) bool {
+	_, err := h.storage.StatResource(ctx, uid, resourcePath)
+	return err == nil
+}
+
+// missingParents 返回collectionPath缺失的祖先集合（从浅到深）。
+// 某个祖先是文件时ok为false，此时无法在其下创建集合
+func (h *Handler) missingParents(ctx context.Context, uid uuid.UUID, collectionPath string) (missing []string, ok bool) {
+	for parent := path.Dir(collectionPath); parent != "/"; parent = path.Dir(parent) {
+		if h.collectionExists(ctx, uid, parent) {
+			break // 已存在的集合的祖先也一定存在
+		}
+		if _, err := h.storage.StatObject(ctx, uid, parent); err == nil {
+			return nil, false
+		}
+		missing = append(missing, parent)
+	}
+	for i, j := 0, len(missing)-1; i < j; i, j = i+1, j-1 {
+		missing[i], missing[j] = missing[j], missing[i]
+	}
+	return missing, true
+}
@@ -0,0 +1,173 @@
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newMkcolHandler 本地存储和SQLite属性库上的Handler，已有/docs目录和/file.txt文件
+func newMkcolHandler(t *testing.T) (*Handler, uuid.UUID) {
+	t.Helper()
+	store, uid := newTestStorage(t)
+	properties, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.CreateFolder(ctx, uid, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutObject(ctx, uid, "/file.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(store, nil, properties), uid
+}
+
+func mkcol(h *Handler, uid uuid.UUID, p, body string, headers map[string]string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest("MKCOL", p, nil)
+	} else {
+		r = httptest.NewRequest("MKCOL", p, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/xml")
+	}
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	c.Request = r
+	c.Set("userID", uid.String())
+	c.Params = gin.Params{{Key: "path", Value: p}}
+	h.HandleMkcol(c)
+	// c.Status只设置状态码，没有响应体时写入响应头
+	c.Writer.WriteHeaderNow()
+	return rec
+}
+
+func TestHandleMkcolStatus(t *testing.T) {
+	const calendarBody = `<?xml version="1.0"?>
+<D:mkcol xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:set><D:prop><D:resourcetype><D:collection/><C:calendar/></D:resourcetype></D:prop></D:set>
+</D:mkcol>`
+	const unknownTypeBody = `<?xml version="1.0"?>
+<D:mkcol xmlns:D="DAV:"><D:set><D:prop><D:resourcetype><D:collection/><X:mailbox xmlns:X="urn:example"/></D:resourcetype></D:prop></D:set></D:mkcol>`
+	createParents := map[string]string{HeaderCreateParents: "T"}
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		headers   map[string]string
+		want      int
+		condition string
+	}{
+		{"new collection", "/new", "", nil, http.StatusCreated, ""},
+		{"inside existing collection", "/docs/sub", "", nil, http.StatusCreated, ""},
+		{"existing collection", "/docs", "", nil, http.StatusMethodNotAllowed, ""},
+		{"existing collection with slash", "/docs/", "", nil, http.StatusMethodNotAllowed, ""},
+		{"existing file", "/file.txt", "", nil, http.StatusMethodNotAllowed, ""},
+		{"missing parent", "/a/b/c", "", nil, http.StatusConflict, ""},
+		{"create parents not requested", "/a/b/c", "", map[string]string{HeaderCreateParents: "F"}, http.StatusConflict, ""},
+		{"parent is a file", "/file.txt/sub", "", nil, http.StatusConflict, ""},
+		{"parent is a file with create parents", "/file.txt/a/b", "", createParents, http.StatusConflict, ""},
+		{"unsupported body", "/plain", `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:"/>`, nil, http.StatusUnsupportedMediaType, ""},
+		{"malformed body", "/plain", `not xml`, nil, http.StatusUnsupportedMediaType, ""},
+		{"unsupported resource type", "/mailbox", unknownTypeBody, nil, http.StatusForbidden, "valid-resourcetype"},
+		{"calendar", "/calendar", calendarBody, nil, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, uid := newMkcolHandler(t)
+			rec := mkcol(h, uid, tt.path, tt.body, tt.headers)
+			if rec.Code != tt.want {
+				t.Fatalf("MKCOL %s = %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.condition != "" && !strings.Contains(rec.Body.String(), tt.condition) {
+				t.Errorf("body missing %s: %q", tt.condition, rec.Body.String())
+			}
+			if tt.want == http.StatusCreated && !h.collectionExists(context.Background(), uid, tt.path) {
+				t.Errorf("collection %s not created", tt.path)
+			}
+			// 失败时不创建任何中间集合
+			if tt.want == http.StatusConflict && h.resourceExists(context.Background(), uid, "/a") {
+				t.Error("intermediate collection created for a failed MKCOL")
+			}
+		})
+	}
+}
+
+// TestHandleMkcolCreateParents X-Create-Parents: T时依次创建缺失的中间集合
+func TestHandleMkcolCreateParents(t *testing.T) {
+	h, uid := newMkcolHandler(t)
+	ctx := context.Background()
+	if rec := mkcol(h, uid, "/docs/a/b/c", "", map[string]string{HeaderCreateParents: "true"}); rec.Code != http.StatusCreated {
+		t.Fatalf("MKCOL = %d, want 201", rec.Code)
+	}
+	for _, p := range []string{"/docs/a", "/docs/a/b", "/docs/a/b/c"} {
+		if _, err := h.storage.StatFolder(ctx, uid, p); err != nil {
+			t.Errorf("collection %s not created: %v", p, err)
+		}
+	}
+	if missing, ok := h.missingParents(ctx, uid, "/x/y/z"); !ok || strings.Join(missing, ",") != "/x,/x/y" {
+		t.Errorf("missingParents = %q, %v; want /x,/x/y", missing, ok)
+	}
+}
+
+// TestHandleMkcolNestedCalendar 日历集合中不能再创建日历集合
+func TestHandleMkcolNestedCalendar(t *testing.T) {
+	h, uid := newMkcolHandler(t)
+	body := `<?xml version="1.0"?>
+<D:mkcol xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:set><D:prop><D:resourcetype><D:collection/><C:calendar/></D:resourcetype></D:prop></D:set>
+</D:mkcol>`
+	if rec := mkcol(h, uid, "/work", body, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("MKCOL calendar = %d, want 201", rec.Code)
+	}
+	if !h.isCalendarCollection(uid.String(), "/work") {
+		t.Fatal("/work not marked as a calendar")
+	}
+	rec := mkcol(h, uid, "/work/nested", body, nil)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "calendar-collection-location-ok") {
+		t.Errorf("nested calendar = %d %q, want 403 calendar-collection-location-ok", rec.Code, rec.Body.String())
+	}
+	// 普通集合可以放在日历集合中
+	if rec := mkcol(h, uid, "/work/plain", "", nil); rec.Code != http.StatusCreated {
+		t.Errorf("plain collection in a calendar = %d, want 201", rec.Code)
+	}
+}
+
+func TestCollectionKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   string
+		wantOK bool
+	}{
+		{"no resourcetype", `<D:mkcol xmlns:D="DAV:"><D:set><D:prop/></D:set></D:mkcol>`, "", true},
+		{"collection only", `<D:mkcol xmlns:D="DAV:"><D:set><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:set></D:mkcol>`, "", true},
+		{"addressbook", `<D:mkcol xmlns:D="DAV:" xmlns:A="urn:ietf:params:xml:ns:carddav"><D:set><D:prop><D:resourcetype><D:collection/><A:addressbook/></D:resourcetype></D:prop></D:set></D:mkcol>`, collectionKindAddressbook, true},
+		{"calendar and addressbook", `<D:mkcol xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="urn:ietf:params:xml:ns:carddav"><D:set><D:prop><D:resourcetype><C:calendar/><A:addressbook/></D:resourcetype></D:prop></D:set></D:mkcol>`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseExtendedMkcol([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind, ok := req.collectionKind(); kind != tt.want || ok != tt.wantOK {
+				t.Errorf("collectionKind = %q, %v; want %q, %v", kind, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if kind, ok := (*extendedMkcolRequest)(nil).collectionKind(); kind != "" || !ok {
+		t.Errorf("collectionKind without body = %q, %v", kind, ok)
+	}
+}
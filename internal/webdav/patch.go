@@ -0,0 +1,266 @@
+package webdav
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/storage"
+)
+
+const (
+	// PartialUpdateContentType SabreDAV部分更新约定的请求体类型
+	PartialUpdateContentType = "application/x-sabredav-partialupdate"
+	// HeaderUpdateRange SabreDAV部分更新指定写入位置的请求头：append、bytes=a-b、bytes=a-、bytes=-n
+	HeaderUpdateRange = "X-Update-Range"
+)
+
+// errInvalidUpdateRange X-Update-Range或Content-Range格式错误
+var errInvalidUpdateRange = errors.New("invalid update range")
+
+// parseUpdateRange 解析X-Update-Range，返回写入的起始偏移。size为文件当前大小，length为请求体长度。
+// bytes=a-b要求区间长度与请求体长度一致；bytes=-n从文件末尾倒数n个字节开始写入。
+// 起始位置超出文件末尾时返回errRangeNotSatisfiable（不允许在文件中间留下空洞）
+func parseUpdateRange(header string, size, length int64) (int64, error) {
+	header = strings.TrimSpace(header)
+	if strings.EqualFold(header, "append") {
+		return size, nil
+	}
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, errInvalidUpdateRange
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, errInvalidUpdateRange
+	}
+	first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	var start int64
+	switch {
+	case first == "":
+		// 从末尾倒数
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, errInvalidUpdateRange
+		}
+		if n > size {
+			return 0, errRangeNotSatisfiable
+		}
+		start = size - n
+	default:
+		var err error
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return 0, errInvalidUpdateRange
+		}
+		if last != "" {
+			end, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return 0, errInvalidUpdateRange
+			}
+			if end-start+1 != length {
+				return 0, errRangeNotSatisfiable
+			}
+		}
+	}
+
+	if start > size {
+		return 0, errRangeNotSatisfiable
+	}
+	return start, nil
+}
+
+// parsePatchContentRange 解析Content-Range: bytes a-b/total（total可以是*），
+// 用于不支持X-Update-Range的客户端，区间长度必须与请求体长度一致
+func parsePatchContentRange(header string, size, length int64) (int64, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, errInvalidUpdateRange
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes "))
+	slash := strings.Index(spec, "/")
+	if slash < 0 {
+		return 0, errInvalidUpdateRange
+	}
+	rangeSpec, total := spec[:slash], spec[slash+1:]
+	dash := strings.Index(rangeSpec, "-")
+	if dash < 0 {
+		return 0, errInvalidUpdateRange
+	}
+	start, err := strconv.ParseInt(rangeSpec[:dash], 10, 64)
+	if err != nil || start < 0 {
+		return 0, errInvalidUpdateRange
+	}
+	end, err := strconv.ParseInt(rangeSpec[dash+1:], 10, 64)
+	if err != nil || end < start {
+		return 0, errInvalidUpdateRange
+	}
+	if total != "*" {
+		n, err := strconv.ParseInt(total, 10, 64)
+		if err != nil || n <= end {
+			return 0, errInvalidUpdateRange
+		}
+	}
+	if end-start+1 != length || start > size {
+		return 0, errRangeNotSatisfiable
+	}
+	return start, nil
+}
+
+// HandlePatch 部分更新已有文件（SabreDAV PartialUpdate）。
+// 新内容由原文件[0,start)、请求体、原文件[start+len,size)拼接后整体写回，读取原文件时要求ETag不变，
+// 期间文件被其他请求覆盖时返回412。各存储后端的写入都是原子的（本地目录先写临时文件再改名，
+// S3在上传完成时才替换对象），写入失败时原文件保持不变，不需要额外的暂存区
+func (h *Handler) HandlePatch(c *gin.Context) {
+	userID := c.GetString("userID")
+	uid, _ := uuid.Parse(userID)
+	requestPath := c.Param("path")
+	ctx := c.Request.Context()
+
+	if strings.HasSuffix(requestPath, "/") {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	updateRange := c.GetHeader(HeaderUpdateRange)
+	contentRange := c.GetHeader("Content-Range")
+	if updateRange != "" {
+		if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType != PartialUpdateContentType {
+			c.Status(http.StatusUnsupportedMediaType)
+			return
+		}
+	} else if contentRange == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Update-Range or Content-Range header is required"})
+		return
+	}
+
+	length := c.Request.ContentLength
+	if length < 0 {
+		c.Status(http.StatusLengthRequired)
+		return
+	}
+
+	// 部分更新只能修改已有文件的内容
+	if h.CheckPrivilege(c, requestPath, PrivilegeWriteContent) {
+		return // CheckPrivilege已经发送了403错误
+	}
+	if h.CheckReadOnly(c, requestPath) {
+		return // CheckReadOnly已经发送了403错误
+	}
+
+	resource, err := h.storage.StatResource(ctx, uid, requestPath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if resource.IsCollection() {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 日历对象和联系人必须整体通过校验并重建索引，只能用PUT写入
+	if parent := path.Dir(path.Clean("/" + requestPath)); h.isCalendarCollection(userID, parent) || h.isAddressbookCollection(userID, parent) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	if locked, _ := h.CheckAnyLock(c, requestPath); locked {
+		return // CheckAnyLock已经发送了423错误
+	}
+
+	info, err := h.storage.StatObject(ctx, uid, requestPath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	size := info.Size
+
+	var start int64
+	if updateRange != "" {
+		start, err = parseUpdateRange(updateRange, size, length)
+	} else {
+		start, err = parsePatchContentRange(contentRange, size, length)
+	}
+	if errors.Is(err, errRangeNotSatisfiable) {
+		c.Header("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	} else if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	newSize := max(size, start+length)
+	quotaExempt := h.hidesMacOSMetadata(requestPath)
+	if !quotaExempt && newSize > size {
+		if quota := h.remainingQuota(ctx, uid, size); quota >= 0 && newSize > quota {
+			sendQuotaExceeded(c)
+			return
+		}
+	}
+
+	// 拼接原文件未修改的部分和请求体
+	parts := make([]io.Reader, 0, 3)
+	if start > 0 {
+		head, err := h.storage.GetObjectRange(ctx, uid, requestPath, 0, start-1, info.ETag)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		defer head.Close()
+		parts = append(parts, head)
+	}
+	parts = append(parts, io.LimitReader(c.Request.Body, length))
+	if start+length < size {
+		tail, err := h.storage.GetObjectRange(ctx, uid, requestPath, start+length, size-1, info.ETag)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		defer tail.Close()
+		parts = append(parts, tail)
+	}
+
+	checksum := newHashingReader(io.MultiReader(parts...), newSize)
+	if err := h.storage.ReplaceObject(ctx, uid, requestPath, checksum, newSize, info.ContentType, info); err != nil {
+		if storage.IsPreconditionFailed(err) {
+			c.Status(http.StatusPreconditionFailed)
+			return
+		}
+		sendUploadError(c, err)
+		return
+	}
+
+	if !quotaExempt && newSize != size {
+		h.auth.UpdateStorageUsed(ctx, uid, newSize-size)
+	}
+
+	md5Hex, sha256Hex := checksum.sums()
+	if err := h.propertyService.SetChecksums(ctx, userID, requestPath, md5Hex, sha256Hex); err != nil {
+		log.Printf("Warning: failed to record checksum for %s: %v", requestPath, err)
+	}
+	// 内容已变化，之前设置的修改时间不再适用
+	if err := h.propertyService.SetUploadTimes(ctx, userID, requestPath, time.Time{}, uploadMtime(c)); err != nil {
+		log.Printf("Warning: failed to record timestamps for %s: %v", requestPath, err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
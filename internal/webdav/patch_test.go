@@ -0,0 +1,70 @@
+package webdav
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseUpdateRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    int64
+		length  int64
+		want    int64
+		wantErr error
+	}{
+		{"append", 100, 10, 100, nil},
+		{"APPEND", 0, 10, 0, nil},
+		{"bytes=10-19", 100, 10, 10, nil},
+		{"bytes=95-104", 100, 10, 95, nil}, // 超出末尾的部分扩展文件
+		{"bytes=100-109", 100, 10, 100, nil},
+		{"bytes=10-", 100, 5, 10, nil},
+		{"bytes=-20", 100, 5, 80, nil},
+		{"bytes=-0", 100, 5, 100, nil},
+		{"bytes=10-18", 100, 10, 0, errRangeNotSatisfiable},
+		{"bytes=101-", 100, 5, 0, errRangeNotSatisfiable},
+		{"bytes=-101", 100, 5, 0, errRangeNotSatisfiable},
+		{"bytes=20-10", 100, 5, 0, errInvalidUpdateRange},
+		{"bytes=abc-", 100, 5, 0, errInvalidUpdateRange},
+		{"bytes=10", 100, 5, 0, errInvalidUpdateRange},
+		{"10-19", 100, 10, 0, errInvalidUpdateRange},
+	}
+	for _, tt := range tests {
+		got, err := parseUpdateRange(tt.header, tt.size, tt.length)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("parseUpdateRange(%q, %d, %d) error = %v, want %v", tt.header, tt.size, tt.length, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseUpdateRange(%q, %d, %d) = %d, want %d", tt.header, tt.size, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestParsePatchContentRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    int64
+		length  int64
+		want    int64
+		wantErr error
+	}{
+		{"bytes 0-9/*", 100, 10, 0, nil},
+		{"bytes 100-109/110", 100, 10, 100, nil},
+		{"bytes 0-9/*", 100, 5, 0, errRangeNotSatisfiable},
+		{"bytes 101-110/*", 100, 10, 0, errRangeNotSatisfiable},
+		{"bytes 0-9/5", 100, 10, 0, errInvalidUpdateRange},
+		{"bytes 0-9", 100, 10, 0, errInvalidUpdateRange},
+		{"bytes=0-9/*", 100, 10, 0, errInvalidUpdateRange},
+	}
+	for _, tt := range tests {
+		got, err := parsePatchContentRange(tt.header, tt.size, tt.length)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("parsePatchContentRange(%q, %d, %d) error = %v, want %v", tt.header, tt.size, tt.length, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parsePatchContentRange(%q, %d, %d) = %d, want %d", tt.header, tt.size, tt.length, got, tt.want)
+		}
+	}
+}
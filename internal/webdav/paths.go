@@ -0,0 +1,87 @@
+package webdav
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/davpath"
+	"github.com/webdav-gateway/internal/storage"
+	"github.com/webdav-gateway/internal/tenant"
+)
+
+// NormalizePath 将路由参数path替换为规范路径（NFC、消除.和..、长度上限），
+// 注册在路由组的最前面，之后的中间件、处理函数和存储调用看到的都是同一种写法。
+// 路径不是合法的UTF-8或包含NUL时返回400，超出max_path_bytes时返回414
+func (h *Handler) NormalizePath(c *gin.Context) {
+	normalized, err := davpath.Normalize(c.Param("path"), h.config.MaxPathBytes)
+	if err != nil {
+		c.AbortWithStatus(pathErrorStatus(err))
+		return
+	}
+	for i := range c.Params {
+		if c.Params[i].Key == "path" {
+			c.Params[i].Value = normalized
+		}
+	}
+	c.Next()
+}
+
+// pathErrorStatus 请求路径超长返回414，其他错误返回400
+func pathErrorStatus(err error) int {
+	if errors.Is(err, davpath.ErrPathTooLong) {
+		return http.StatusRequestURITooLong
+	}
+	return http.StatusBadRequest
+}
+
+// destinationPath 解析MOVE/COPY的Destination头（绝对URL或绝对路径），返回用户文件树中的规范路径。
+// 路由前缀（/webdav）被去掉；缺少或无法解析时发送400，ok为false
+func (h *Handler) destinationPath(c *gin.Context) (string, bool) {
+	raw := c.GetHeader("Destination")
+	if raw == "" {
+		c.Status(http.StatusBadRequest)
+		return "", false
+	}
+	dst, err := davpath.FromURL(raw, routePrefix(c), h.config.MaxPathBytes)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return "", false
+	}
+	return dst, true
+}
+
+// routePrefix 客户端看到的路由组前缀（如/webdav，多租户路径模式下为/t/{slug}/webdav），
+// 用于把请求体和请求头中的href转换为用户文件树中的路径
+func routePrefix(c *gin.Context) string {
+	return tenant.MountPrefix(c.Request.Context()) + strings.TrimSuffix(c.FullPath(), "/*path")
+}
+
+// statResource 查询请求路径对应的资源；不存在时发送404，存储错误时发送500，ok为false
+func (h *Handler) statResource(c *gin.Context, uid uuid.UUID, requestPath string) (*storage.Resource, bool) {
+	resource, err := h.storage.StatResource(c.Request.Context(), uid, requestPath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.Status(http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return resource, true
+}
+
+// redirectCollection 集合的请求路径缺少结尾的/时发送301到规范URL（保留查询参数），
+// 客户端之后按集合解析相对链接。已重定向时返回true
+func redirectCollection(c *gin.Context, resource *storage.Resource, requestPath string) bool {
+	if !resource.IsCollection() || strings.HasSuffix(requestPath, "/") {
+		return false
+	}
+	location := &url.URL{Path: routePrefix(c) + resource.Path, RawQuery: c.Request.URL.RawQuery}
+	c.Redirect(http.StatusMovedPermanently, location.String())
+	return true
+}
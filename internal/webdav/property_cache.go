@@ -0,0 +1,203 @@
+package webdav
+
+import (
+	"container/list"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+const (
+	// defaultPropertyCacheEntries 未配置条目上限时的缓存大小
+	defaultPropertyCacheEntries = 10000
+	// defaultPropertyCacheTTL 未配置TTL时的缓存时长
+	defaultPropertyCacheTTL = 30 * time.Second
+)
+
+// propertyCacheKey 缓存键，path为去掉结尾/的资源路径（根目录为空字符串）。
+// children为true时表示该目录所有直接子资源的属性都已在缓存中（没有条目即没有属性）
+type propertyCacheKey struct {
+	userID   string
+	path     string
+	children bool
+}
+
+// propertyCacheEntry 缓存条目
+type propertyCacheEntry struct {
+	key      propertyCacheKey
+	props    []*DatabaseProperty
+	cachedAt time.Time
+}
+
+// PropertyCache 进程内的资源属性LRU缓存，按（用户，路径）保存ListResourceProperties的结果。
+// 经由PropertyService的写操作会立即失效受影响的路径；多副本共享PostgreSQL时，
+// 其他副本的修改在TTL后可见
+type PropertyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[propertyCacheKey]*list.Element
+	lru        *list.List
+	// gen 每次失效递增，查询前后不一致时不写入缓存，避免并发写入后缓存旧值
+	gen uint64
+}
+
+// NewPropertyCache 创建属性缓存
+func NewPropertyCache(cfg config.PropertyCacheConfig) *PropertyCache {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultPropertyCacheTTL
+	}
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultPropertyCacheEntries
+	}
+	return &PropertyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[propertyCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// propertyCacheParent 返回缓存路径的上级目录，根目录没有上级
+func propertyCacheParent(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	return trimPropertyPath(path.Dir(key)), true
+}
+
+// generation 返回当前的失效代数，查询数据库前读取，写入缓存时传回
+func (c *PropertyCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// lookup 读取未过期的条目并移到LRU头部，调用方持有锁
+func (c *PropertyCache) lookup(key propertyCacheKey) (*propertyCacheEntry, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*propertyCacheEntry)
+	if time.Since(entry.cachedAt) > c.ttl {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// get 读取资源的属性。资源没有条目但上级目录的子资源已整体加载时，返回空结果
+func (c *PropertyCache) get(userID, resourcePath string) ([]*DatabaseProperty, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := trimPropertyPath(resourcePath)
+	if entry, ok := c.lookup(propertyCacheKey{userID: userID, path: key}); ok {
+		return entry.props, true
+	}
+	if parent, ok := propertyCacheParent(key); ok {
+		if _, ok := c.lookup(propertyCacheKey{userID: userID, path: parent, children: true}); ok {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// store 写入条目并淘汰超出上限的最久未使用条目，调用方持有锁
+func (c *PropertyCache) store(key propertyCacheKey, props []*DatabaseProperty, now time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*propertyCacheEntry)
+		entry.props, entry.cachedAt = props, now
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&propertyCacheEntry{key: key, props: props, cachedAt: now})
+	for c.lru.Len() > c.maxEntries {
+		evicted := c.lru.Back().Value.(*propertyCacheEntry).key
+		c.remove(evicted)
+		// 子资源条目被淘汰后，上级目录不能再视为整体加载
+		if parent, ok := propertyCacheParent(evicted.path); ok && !evicted.children {
+			c.remove(propertyCacheKey{userID: evicted.userID, path: parent, children: true})
+		}
+	}
+}
+
+// put 保存单个资源的属性，gen与当前代数不一致（查询期间发生过写入）时放弃
+func (c *PropertyCache) put(userID, resourcePath string, props []*DatabaseProperty, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	c.store(propertyCacheKey{userID: userID, path: trimPropertyPath(resourcePath)}, props, time.Now())
+}
+
+// putChildren 保存目录自身及全部直接子资源的属性（按缓存路径分组），并标记子资源已整体加载
+func (c *PropertyCache) putChildren(userID, dirPath string, groups map[string][]*DatabaseProperty, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 放不下的大目录不缓存，避免淘汰刚写入的条目
+	if gen != c.gen || len(groups)+2 > c.maxEntries {
+		return
+	}
+	now := time.Now()
+	dir := trimPropertyPath(dirPath)
+	c.store(propertyCacheKey{userID: userID, path: dir}, groups[dir], now)
+	for key, props := range groups {
+		if parent, ok := propertyCacheParent(key); ok && parent == dir {
+			c.store(propertyCacheKey{userID: userID, path: key}, props, now)
+		}
+	}
+	c.store(propertyCacheKey{userID: userID, path: dir, children: true}, nil, now)
+}
+
+// invalidate 失效资源（recursive时包括整个子树）的缓存，以及上级目录的子资源加载标记
+func (c *PropertyCache) invalidate(userID, resourcePath string, recursive bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	key := trimPropertyPath(resourcePath)
+	c.remove(propertyCacheKey{userID: userID, path: key})
+	c.remove(propertyCacheKey{userID: userID, path: key, children: true})
+	if parent, ok := propertyCacheParent(key); ok {
+		c.remove(propertyCacheKey{userID: userID, path: parent, children: true})
+	}
+	if !recursive {
+		return
+	}
+	prefix := key + "/"
+	for k := range c.entries {
+		if k.userID == userID && strings.HasPrefix(k.path, prefix) {
+			c.remove(k)
+		}
+	}
+}
+
+// purge 清空全部缓存，用于导入等无法确定影响范围的写入
+func (c *PropertyCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = make(map[propertyCacheKey]*list.Element)
+	c.lru.Init()
+}
+
+// remove 删除条目，调用方持有锁
+func (c *PropertyCache) remove(key propertyCacheKey) {
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
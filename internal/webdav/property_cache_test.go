@@ -0,0 +1,169 @@
+package webdav
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func newCachedPropertyService(t *testing.T) *PropertyService {
+	t.Helper()
+	service, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { service.Close() })
+	require.NoError(t, service.Initialize(context.Background()))
+	service.SetCache(NewPropertyCache(config.PropertyCacheConfig{TTL: time.Minute, MaxEntries: 100}))
+	return service
+}
+
+// setPropertyDirect 绕过服务直接写数据库，用于判断结果是否来自缓存
+func setPropertyDirect(t *testing.T, s *PropertyService, userID, resourcePath, value string) {
+	t.Helper()
+	_, err := s.db.Exec(`UPDATE properties SET value = $1 WHERE user_id = $2 AND path = $3`, value, userID, resourcePath)
+	require.NoError(t, err)
+}
+
+func createCacheTestProperty(t *testing.T, s *PropertyService, userID, resourcePath, value string) {
+	t.Helper()
+	require.NoError(t, s.CreateProperty(context.Background(), &DatabaseProperty{
+		UserID: userID, Path: resourcePath, Namespace: "CUSTOM:", Name: "label", Value: value,
+	}))
+}
+
+func resourceLabel(t *testing.T, s *PropertyService, userID, resourcePath string) string {
+	t.Helper()
+	props, err := s.ListResourceProperties(context.Background(), userID, resourcePath)
+	require.NoError(t, err)
+	if len(props) == 0 {
+		return ""
+	}
+	return props[0].Value
+}
+
+func TestPropertyCache_ServesAndInvalidates(t *testing.T) {
+	s := newCachedPropertyService(t)
+	ctx := context.Background()
+	createCacheTestProperty(t, s, "user1", "/docs/a.txt", "v1")
+
+	assert.Equal(t, "v1", resourceLabel(t, s, "user1", "/docs/a.txt"))
+	setPropertyDirect(t, s, "user1", "/docs/a.txt", "direct")
+	assert.Equal(t, "v1", resourceLabel(t, s, "user1", "/docs/a.txt"), "second read should come from the cache")
+
+	// 经由服务的写入立即可见
+	require.NoError(t, s.BatchSetProperties(ctx, "user1", "/docs/a.txt", []*Property{
+		{UserID: "user1", Path: "/docs/a.txt", Namespace: "CUSTOM:", Name: "label", Value: "v2"},
+	}))
+	assert.Equal(t, "v2", resourceLabel(t, s, "user1", "/docs/a.txt"))
+
+	require.NoError(t, s.MoveProperties(ctx, "user1", "/docs", "/moved", true))
+	assert.Equal(t, "", resourceLabel(t, s, "user1", "/docs/a.txt"))
+	assert.Equal(t, "v2", resourceLabel(t, s, "user1", "/moved/a.txt"))
+
+	require.NoError(t, s.DeletePropertiesRecursive(ctx, "user1", "/moved"))
+	assert.Equal(t, "", resourceLabel(t, s, "user1", "/moved/a.txt"))
+}
+
+func TestPropertyCache_PrefetchChildren(t *testing.T) {
+	s := newCachedPropertyService(t)
+	ctx := context.Background()
+	createCacheTestProperty(t, s, "user1", "/dir/", "folder")
+	createCacheTestProperty(t, s, "user1", "/dir/a.txt", "a")
+	createCacheTestProperty(t, s, "user1", "/dir/sub/", "sub")
+	createCacheTestProperty(t, s, "user1", "/dir/sub/deep.txt", "deep")
+	createCacheTestProperty(t, s, "user1", "/dir2/b.txt", "sibling")
+
+	require.NoError(t, s.PrefetchChildProperties(ctx, "user1", "/dir/"))
+	for _, p := range []string{"/dir/", "/dir/a.txt", "/dir/sub/", "/dir/sub/deep.txt", "/dir2/b.txt"} {
+		setPropertyDirect(t, s, "user1", p, "direct")
+	}
+
+	// 目录自身和直接子资源来自缓存
+	assert.Equal(t, "folder", resourceLabel(t, s, "user1", "/dir"))
+	assert.Equal(t, "a", resourceLabel(t, s, "user1", "/dir/a.txt"))
+	assert.Equal(t, "sub", resourceLabel(t, s, "user1", "/dir/sub"))
+	// 没有属性的子资源不再查询数据库
+	_, err := s.db.Exec(`INSERT INTO properties (user_id, resource_id, path, name, namespace, value, created_at, updated_at)
+		VALUES ($1, '', $2, 'label', 'CUSTOM:', 'direct', 0, 0)`, "user1", "/dir/empty.txt")
+	require.NoError(t, err)
+	props, err := s.ListResourceProperties(ctx, "user1", "/dir/empty.txt")
+	require.NoError(t, err)
+	assert.Empty(t, props)
+	// 更深的子资源和名称相似的兄弟目录不在预取范围内
+	assert.Equal(t, "direct", resourceLabel(t, s, "user1", "/dir/sub/deep.txt"))
+	assert.Equal(t, "direct", resourceLabel(t, s, "user1", "/dir2/b.txt"))
+
+	// 新增子资源属性后，目录的整体加载标记失效
+	createCacheTestProperty(t, s, "user1", "/dir/new.txt", "new")
+	assert.Equal(t, "new", resourceLabel(t, s, "user1", "/dir/new.txt"))
+}
+
+func TestPropertyCache_StaleFillIsDropped(t *testing.T) {
+	cache := NewPropertyCache(config.PropertyCacheConfig{MaxEntries: 2})
+	gen := cache.generation()
+	cache.invalidate("user1", "/a.txt", false)
+	cache.put("user1", "/a.txt", []*DatabaseProperty{{Value: "stale"}}, gen)
+	_, ok := cache.get("user1", "/a.txt")
+	assert.False(t, ok, "a fill that raced with a write must not be cached")
+
+	// 超出上限时淘汰最久未使用的条目
+	gen = cache.generation()
+	cache.put("user1", "/a.txt", nil, gen)
+	cache.put("user1", "/b.txt", nil, gen)
+	cache.get("user1", "/a.txt")
+	cache.put("user1", "/c.txt", nil, gen)
+	_, ok = cache.get("user1", "/b.txt")
+	assert.False(t, ok)
+	_, ok = cache.get("user1", "/a.txt")
+	assert.True(t, ok)
+
+	// 淘汰子资源后，目录不再视为整体加载
+	cache = NewPropertyCache(config.PropertyCacheConfig{MaxEntries: 4})
+	gen = cache.generation()
+	cache.putChildren("user1", "/dir", map[string][]*DatabaseProperty{"/dir/a.txt": {{Value: "a"}}}, gen)
+	_, ok = cache.get("user1", "/dir/b.txt")
+	assert.True(t, ok)
+	cache.put("user1", "/x.txt", nil, gen)
+	cache.put("user1", "/y.txt", nil, gen)
+	cache.put("user1", "/z.txt", nil, gen)
+	_, ok = cache.get("user1", "/dir/b.txt")
+	assert.False(t, ok)
+}
+
+func TestListPropertiesByPathPrefix(t *testing.T) {
+	s := newCachedPropertyService(t)
+	createCacheTestProperty(t, s, "user1", "/photos/", "folder")
+	createCacheTestProperty(t, s, "user1", "/photos/a.jpg", "a")
+	createCacheTestProperty(t, s, "user1", "/photos/2024/b.jpg", "b")
+	createCacheTestProperty(t, s, "user1", "/photos0/c.jpg", "outside")
+	createCacheTestProperty(t, s, "user1", "/photos_x/d.jpg", "outside")
+	createCacheTestProperty(t, s, "user2", "/photos/a.jpg", "other user")
+
+	groups, err := s.ListPropertiesByPathPrefix(context.Background(), "user1", "/photos/")
+	require.NoError(t, err)
+	assert.Len(t, groups, 3)
+	require.Len(t, groups["/photos/2024/b.jpg"], 1)
+	assert.Equal(t, "b", groups["/photos/2024/b.jpg"][0].Value)
+
+	all, err := s.ListPropertiesByPathPrefix(context.Background(), "user1", "")
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	upper, ok := prefixUpperBound("/photos/")
+	assert.True(t, ok)
+	assert.Equal(t, "/photos0", upper)
+
+	upper, ok = prefixUpperBound("/文档")
+	assert.True(t, ok)
+	assert.Equal(t, "/文"+string(rune('档'+1)), upper)
+
+	_, ok = prefixUpperBound("")
+	assert.False(t, ok)
+}
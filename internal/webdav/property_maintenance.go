@@ -0,0 +1,248 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// ErrMaintenanceRunning 已有维护任务正在运行
+var ErrMaintenanceRunning = errors.New("property database maintenance is already running")
+
+// ErrMaintenanceUnsupported 属性存储不是本地SQLite，由数据库自身负责维护（PostgreSQL的autovacuum）
+var ErrMaintenanceUnsupported = errors.New("maintenance is only supported for the sqlite property backend")
+
+// MaintenanceReport 一次维护的结果
+type MaintenanceReport struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	// Vacuumed 是否执行了VACUUM，碎片低于阈值时只执行ANALYZE
+	Vacuumed bool `json:"vacuumed"`
+	// ReclaimedBytes VACUUM回收的空间
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+	Error          string `json:"error,omitempty"`
+}
+
+// GetStats 返回属性数据库的统计信息：属性数（total_properties、live_properties）、backend、
+// 数据库占用的空间size_bytes（PostgreSQL为属性表及其索引），以及仅SQLite有的可由VACUUM回收的空间free_bytes、
+// 空闲页比例fragmentation、尚未合并回数据库的WAL大小wal_bytes和journal_mode。
+// 本进程维护过数据库时包含最近一次的结果last_maintenance
+func (s *PropertyService) GetStats(ctx context.Context) (map[string]interface{}, error) {
+	var total, live int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_live THEN 1 ELSE 0 END), 0) FROM properties`).Scan(&total, &live); err != nil {
+		return nil, fmt.Errorf("统计属性数失败: %v", err)
+	}
+	stats := map[string]interface{}{
+		"backend":          s.dialect,
+		"total_properties": total,
+		"live_properties":  live,
+	}
+
+	if s.dialect == DialectPostgres {
+		var size int64
+		if err := s.db.QueryRowContext(ctx, `SELECT pg_total_relation_size('properties')`).Scan(&size); err != nil {
+			return nil, fmt.Errorf("读取属性表大小失败: %v", err)
+		}
+		stats["size_bytes"] = size
+	} else {
+		space, err := s.sqliteSpace(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats["size_bytes"] = space.size
+		stats["free_bytes"] = space.free
+		stats["fragmentation"] = space.fragmentation()
+		stats["journal_mode"] = space.journalMode
+		var walBytes int64
+		if info, err := os.Stat(s.dbPath + "-wal"); err == nil {
+			walBytes = info.Size()
+		}
+		stats["wal_bytes"] = walBytes
+	}
+
+	s.maintenanceMu.Lock()
+	if s.lastMaintenance != nil {
+		stats["last_maintenance"] = s.lastMaintenance
+	}
+	s.maintenanceMu.Unlock()
+	return stats, nil
+}
+
+// sqliteSpace SQLite数据库的页使用情况
+type sqliteSpace struct {
+	size, free  int64
+	journalMode string
+}
+
+// fragmentation 空闲页占数据库的比例
+func (sp sqliteSpace) fragmentation() float64 {
+	if sp.size == 0 {
+		return 0
+	}
+	return float64(sp.free) / float64(sp.size)
+}
+
+func (s *PropertyService) sqliteSpace(ctx context.Context) (sqliteSpace, error) {
+	var space sqliteSpace
+	var pageSize, pageCount, freePages int64
+	for _, pragma := range []struct {
+		name string
+		dest interface{}
+	}{
+		{"page_size", &pageSize},
+		{"page_count", &pageCount},
+		{"freelist_count", &freePages},
+		{"journal_mode", &space.journalMode},
+	} {
+		if err := s.db.QueryRowContext(ctx, "PRAGMA "+pragma.name).Scan(pragma.dest); err != nil {
+			return space, fmt.Errorf("读取%s失败: %v", pragma.name, err)
+		}
+	}
+	space.size = pageSize * pageCount
+	space.free = pageSize * freePages
+	return space, nil
+}
+
+// Maintain 维护本地SQLite属性数据库：更新查询规划器的统计信息（ANALYZE），空闲页比例达到vacuumThreshold时
+// 执行VACUUM重建数据库并回收空间，最后把WAL合并回数据库。维护期间写操作排队等待，读取不受影响
+func (s *PropertyService) Maintain(ctx context.Context, vacuumThreshold float64) (*MaintenanceReport, error) {
+	if s.dialect != DialectSQLite {
+		return nil, ErrMaintenanceUnsupported
+	}
+	if !s.maintaining.TryLock() {
+		return nil, ErrMaintenanceRunning
+	}
+	defer s.maintaining.Unlock()
+
+	report := &MaintenanceReport{StartedAt: time.Now()}
+	err := s.maintain(ctx, vacuumThreshold, report)
+	report.Duration = time.Since(report.StartedAt)
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	s.maintenanceMu.Lock()
+	s.lastMaintenance = report
+	s.maintenanceMu.Unlock()
+	return report, err
+}
+
+func (s *PropertyService) maintain(ctx context.Context, vacuumThreshold float64, report *MaintenanceReport) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := s.db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("ANALYZE失败: %v", err)
+	}
+
+	before, err := s.sqliteSpace(ctx)
+	if err != nil {
+		return err
+	}
+	if before.free > 0 && before.fragmentation() >= vacuumThreshold {
+		if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+			return fmt.Errorf("VACUUM失败: %v", err)
+		}
+		report.Vacuumed = true
+		if after, err := s.sqliteSpace(ctx); err == nil {
+			report.ReclaimedBytes = before.size - after.size
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("合并WAL失败: %v", err)
+	}
+	return nil
+}
+
+// PropertyMaintainer 定期维护本地SQLite属性数据库
+type PropertyMaintainer struct {
+	properties *PropertyService
+	config     config.PropertySQLiteConfig
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewPropertyMaintainer 创建属性数据库维护任务
+func NewPropertyMaintainer(properties *PropertyService, cfg config.PropertySQLiteConfig) *PropertyMaintainer {
+	return &PropertyMaintainer{
+		properties: properties,
+		config:     cfg,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start 启动定期维护，未配置间隔或属性存储不是SQLite时不启动
+func (m *PropertyMaintainer) Start() {
+	if m.config.MaintenanceInterval <= 0 || m.properties.Dialect() != DialectSQLite {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.config.MaintenanceInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// 手动触发的维护尚未结束时跳过本次
+				if report, err := m.properties.Maintain(context.Background(), m.config.VacuumThreshold); !errors.Is(err, ErrMaintenanceRunning) {
+					logMaintenance(report, err)
+				}
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定期维护
+func (m *PropertyMaintainer) Stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
+// Trigger 在后台立即执行一次维护（总是VACUUM），结果通过GetStats查询
+func (m *PropertyMaintainer) Trigger() error {
+	if m.properties.Dialect() != DialectSQLite {
+		return ErrMaintenanceUnsupported
+	}
+	if m.properties.MaintenanceRunning() {
+		return ErrMaintenanceRunning
+	}
+	go func() {
+		report, err := m.properties.Maintain(context.Background(), 0)
+		if !errors.Is(err, ErrMaintenanceRunning) {
+			logMaintenance(report, err)
+		}
+	}()
+	return nil
+}
+
+// MaintenanceRunning 判断是否有维护任务正在运行
+func (s *PropertyService) MaintenanceRunning() bool {
+	if s.maintaining.TryLock() {
+		s.maintaining.Unlock()
+		return false
+	}
+	return true
+}
+
+func logMaintenance(report *MaintenanceReport, err error) {
+	if err != nil {
+		log.Printf("Warning: property database maintenance failed: %v", err)
+		return
+	}
+	if report.Vacuumed {
+		log.Printf("Property database vacuumed in %s, reclaimed %d bytes", report.Duration.Round(time.Millisecond), report.ReclaimedBytes)
+	}
+}
@@ -0,0 +1,140 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/webdav-gateway/internal/config"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	"github.com/webdav-gateway/internal/webdav/validators"
+)
+
+// newPropertyPolicy 创建PROPPATCH属性规则，网关内部命名空间（只读标记、校验值、日历和通讯录索引、ACL）
+// 和媒体元数据命名空间总是保留
+func newPropertyPolicy(cfg config.PropertyPolicyConfig) (*validators.PropertyPolicy, error) {
+	policy, err := validators.NewPropertyPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	policy.Reserve(NamespaceMetadata)
+	policy.Reserve(NamespaceMedia)
+	return policy, nil
+}
+
+// propertyPolicyError 把属性规则的检查结果转换为PROPPATCH中单个属性的错误
+func propertyPolicyError(namespace, name string, err error) *webdavtypes.PropertyError {
+	propError := &webdavtypes.PropertyError{
+		Code:      http.StatusForbidden,
+		Message:   err.Error(),
+		Property:  name,
+		Namespace: namespace,
+	}
+	var policyErr *validators.PropertyPolicyError
+	if errors.As(err, &policyErr) {
+		propError.Code = policyErr.Status
+		propError.Condition = policyErr.Condition
+	}
+	return propError
+}
+
+// checkPropertySet 检查属性能否写入为value：受保护的属性、保留命名空间、命名空间写入规则和特殊属性的值格式
+func (h *Handler) checkPropertySet(namespace, name, value string) *webdavtypes.PropertyError {
+	// 受保护的属性、保留命名空间和命名空间写入规则
+	if err := h.propertyPolicy.CheckSet(namespace, name, value); err != nil {
+		return propertyPolicyError(namespace, name, err)
+	}
+
+	// Windows客户端写入的文件时间和属性位按死属性保存，写入前检查格式
+	if isWin32Property(namespace, name) {
+		if err := validateWin32Property(name, value); err != nil {
+			return &webdavtypes.PropertyError{
+				Code:      409,
+				Message:   "Win32属性值格式错误",
+				Property:  name,
+				Namespace: namespace,
+			}
+		}
+	}
+
+	// 收藏标记只接受0或1
+	if isFavoriteProperty(namespace, name) {
+		if _, err := parseFavorite(value); err != nil {
+			return &webdavtypes.PropertyError{
+				Code:      409,
+				Message:   "收藏标记格式错误",
+				Property:  name,
+				Namespace: namespace,
+			}
+		}
+	}
+
+	// Nextcloud兼容客户端通过DAV:lastmodified设置修改时间，接受Unix时间戳、HTTP日期或RFC 3339
+	if _, ok := timestampTarget(namespace, name); ok {
+		if _, err := parseClientTime(value); err != nil {
+			return &webdavtypes.PropertyError{
+				Code:      409,
+				Message:   "时间格式错误",
+				Property:  name,
+				Namespace: namespace,
+			}
+		}
+	}
+	return nil
+}
+
+// CheckPropertySets 按PROPPATCH的规则检查WebDAV之外写入一个资源的属性（如tar导入的PAX扩展头），
+// 包括属性数上限。任一属性被拒绝时返回错误；全部通过时返回实际保存的属性，设置文件时间的属性转换为对应的活属性
+func (h *Handler) CheckPropertySets(ctx context.Context, userID, resourcePath string, sets []*Property) ([]*Property, error) {
+	for _, prop := range sets {
+		if propError := h.checkPropertySet(prop.Namespace, prop.Name, prop.Value); propError != nil {
+			return nil, fmt.Errorf("{%s}%s: %s", prop.Namespace, prop.Name, propError.Message)
+		}
+	}
+	if propErrors := h.checkPropertyCount(ctx, userID, resourcePath, sets, nil); len(propErrors) > 0 {
+		return nil, errors.New(propErrors[0].Message)
+	}
+	stored, _ := applyTimestampProperties(userID, resourcePath, sets, nil)
+	return stored, nil
+}
+
+// checkPropertyCount 检查PROPPATCH完成后资源的自定义属性数，超出上限时每个新增的属性返回507
+func (h *Handler) checkPropertyCount(ctx context.Context, userID, resourcePath string, sets, removes []*Property) []webdavtypes.PropertyError {
+	existing, err := h.propertyService.ListResourceProperties(ctx, userID, resourcePath)
+	if err != nil {
+		return []webdavtypes.PropertyError{{Code: http.StatusInternalServerError, Message: "读取属性失败"}}
+	}
+
+	// 服务端维护的活属性和媒体元数据属性不计入上限
+	keys := make(map[string]bool, len(existing)+len(sets))
+	for _, prop := range existing {
+		if !prop.IsLive && prop.Namespace != NamespaceMedia {
+			keys[prop.Namespace+":"+prop.Name] = true
+		}
+	}
+	var added []*Property
+	for _, prop := range sets {
+		if !storesAsDeadProperty(prop.Namespace, prop.Name) || isFavoriteProperty(prop.Namespace, prop.Name) {
+			continue
+		}
+		key := prop.Namespace + ":" + prop.Name
+		if !keys[key] {
+			keys[key] = true
+			added = append(added, prop)
+		}
+	}
+	for _, prop := range removes {
+		delete(keys, prop.Namespace+":"+prop.Name)
+	}
+
+	err = h.propertyPolicy.CheckCount(len(keys))
+	if err == nil || len(added) == 0 {
+		return nil
+	}
+	propErrors := make([]webdavtypes.PropertyError, 0, len(added))
+	for _, prop := range added {
+		propErrors = append(propErrors, *propertyPolicyError(prop.Namespace, prop.Name, err))
+	}
+	return propErrors
+}
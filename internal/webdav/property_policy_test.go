@@ -0,0 +1,52 @@
+package webdav
+
+import (
+	"context"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+func TestCheckPropertySets(t *testing.T) {
+	service := newTestPropertyService(t)
+	h := NewHandler(nil, nil, service)
+	h.SetConfig(config.WebDAVConfig{PropertyPolicy: config.PropertyPolicyConfig{MaxPropertiesPerResource: 2}})
+	ctx := context.Background()
+
+	prop := func(namespace, name, value string) *Property {
+		return &Property{UserID: "user1", Path: "/a.txt", Namespace: namespace, Name: name, Value: value}
+	}
+	tests := []struct {
+		name    string
+		sets    []*Property
+		wantErr bool
+		stored  []string
+	}{
+		{"custom property", []*Property{prop("http://example.com/ns", "author", "Alice")}, false, []string{"http://example.com/ns:author"}},
+		{"protected DAV property", []*Property{prop("DAV:", "getetag", "forged")}, true, nil},
+		{"reserved gateway namespace", []*Property{prop(NamespaceMetadata, ReadOnlyPropertyName, "x")}, true, nil},
+		{"reserved media namespace", []*Property{prop(NamespaceMedia, "width", "1")}, true, nil},
+		{"one rejected rejects all", []*Property{prop("http://example.com/ns", "author", "Alice"), prop("DAV:", "resourcetype", "")}, true, nil},
+		{"invalid favorite", []*Property{prop(webdavtypes.NamespaceOwnCloud, FavoritePropertyName, "yes")}, true, nil},
+		{"too many properties", []*Property{prop("urn:x", "a", "1"), prop("urn:x", "b", "2"), prop("urn:x", "c", "3")}, true, nil},
+		// 修改时间属性转换为网关维护的活属性
+		{"lastmodified", []*Property{prop(NamespaceDAV, "lastmodified", "1700000000")}, false, []string{NamespaceMetadata + ":" + LastModifiedPropertyName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := h.CheckPropertySets(ctx, "user1", "/a.txt", tt.sets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckPropertySets error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(stored) != len(tt.stored) {
+				t.Fatalf("stored %d properties, want %v", len(stored), tt.stored)
+			}
+			for i, key := range tt.stored {
+				if got := stored[i].Namespace + ":" + stored[i].Name; got != key {
+					t.Errorf("stored[%d] = %s, want %s", i, got, key)
+				}
+			}
+		})
+	}
+}
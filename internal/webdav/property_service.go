@@ -3,10 +3,14 @@ package webdav
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
+	"github.com/webdav-gateway/internal/config"
 	"github.com/webdav-gateway/internal/types"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -74,20 +78,46 @@ func DatabasePropertyToPropertySlice(dbProps []*DatabaseProperty) []*Property {
 type PropertyService struct {
 	db      *sql.DB
 	dbPath  string
+	dialect Dialect
+	stmts   *StmtCache
+	ownsDB  bool // 是否由服务自身打开连接（共享连接池不在Close时关闭）
+	cache   *PropertyCache
 	mu      sync.RWMutex
 	initialised bool
+	// writer 本地SQLite的写操作队列（容量为1），PostgreSQL为nil
+	writer chan struct{}
+
+	maintaining     sync.Mutex
+	maintenanceMu   sync.Mutex
+	lastMaintenance *MaintenanceReport
 }
 
-// NewPropertyService 创建属性存储服务
+// ErrPropertyExists 创建属性时同名属性已存在（INSERT ... ON CONFLICT DO NOTHING未插入任何行）
+var ErrPropertyExists = errors.New("property already exists")
+
+// propertyColumns 属性表列顺序，与scanProperty/scanProperties一致
+var propertyColumns = []string{"id", "user_id", "resource_id", "path", "name", "namespace", "value", "is_live", "created_at", "updated_at"}
+
+// NewPropertyService 创建属性存储服务（本地SQLite），使用默认的连接设置
 func NewPropertyService(dbPath string) (*PropertyService, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	return NewSQLitePropertyService(dbPath, config.PropertySQLiteConfig{BusyTimeout: 5 * time.Second})
+}
+
+// NewSQLitePropertyService 创建本地SQLite属性存储服务。数据库使用WAL模式，读取不被写入阻塞；
+// 写事务立即获取写锁（_txlock=immediate），被其他进程锁定时等待cfg.BusyTimeout
+func NewSQLitePropertyService(dbPath string, cfg config.PropertySQLiteConfig) (*PropertyService, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath, cfg))
 	if err != nil {
 		return nil, fmt.Errorf("连接数据库失败: %v", err)
 	}
 
 	service := &PropertyService{
-		db:     db,
-		dbPath: dbPath,
+		db:      db,
+		dbPath:  dbPath,
+		dialect: DialectSQLite,
+		stmts:   NewStmtCache(db, DialectSQLite),
+		ownsDB:  true,
+		writer:  make(chan struct{}, 1),
 	}
 
 	// 设置连接池参数
@@ -98,6 +128,57 @@ func NewPropertyService(dbPath string) (*PropertyService, error) {
 	return service, nil
 }
 
+// sqliteDSN 在数据库路径后追加WAL、busy_timeout和写事务加锁方式的连接参数
+func sqliteDSN(dbPath string, cfg config.PropertySQLiteConfig) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		dbPath, separator, cfg.BusyTimeout.Milliseconds())
+}
+
+// acquireWriter 等待轮到本次写操作。SQLite同一时间只有一个写事务，进程内的写操作排队执行，
+// 避免并发事务争抢写锁返回SQLITE_BUSY；PostgreSQL不排队。ctx取消时放弃等待
+func (s *PropertyService) acquireWriter(ctx context.Context) (func(), error) {
+	if s.writer == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.writer <- struct{}{}:
+		return func() { <-s.writer }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// NewPropertyServiceWithDB 使用已有连接池创建属性存储服务（如主PostgreSQL数据库），
+// 多副本部署时所有实例共享同一份属性数据
+func NewPropertyServiceWithDB(db *sql.DB, dialect Dialect) *PropertyService {
+	return &PropertyService{
+		db:      db,
+		dialect: dialect,
+		stmts:   NewStmtCache(db, dialect),
+	}
+}
+
+// SetCache 启用资源属性缓存，传入nil时关闭
+func (s *PropertyService) SetCache(cache *PropertyCache) {
+	s.cache = cache
+}
+
+// invalidateCache 写操作后失效缓存（未启用缓存时不做任何事）
+func (s *PropertyService) invalidateCache(userID, resourcePath string, recursive bool) {
+	if s.cache != nil {
+		s.cache.invalidate(userID, resourcePath, recursive)
+	}
+}
+
+// Dialect 返回属性存储使用的SQL方言
+func (s *PropertyService) Dialect() Dialect {
+	return s.dialect
+}
+
 // Initialize 初始化数据库表
 func (s *PropertyService) Initialize(ctx context.Context) error {
 	s.mu.Lock()
@@ -117,6 +198,11 @@ func (s *PropertyService) Initialize(ctx context.Context) error {
 		return fmt.Errorf("创建索引失败: %v", err)
 	}
 
+	// 创建收藏表
+	if err := s.createFavoritesTable(ctx); err != nil {
+		return fmt.Errorf("创建收藏表失败: %v", err)
+	}
+
 	s.initialised = true
 	return nil
 }
@@ -139,6 +225,24 @@ func (s *PropertyService) createPropertiesTable(ctx context.Context) error {
 		);
 	`
 	
+	if s.dialect == DialectPostgres {
+		query = `
+		CREATE TABLE IF NOT EXISTS properties (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			resource_id TEXT NOT NULL,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			namespace TEXT NOT NULL,
+			value TEXT,
+			is_live BOOLEAN DEFAULT FALSE,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			UNIQUE(user_id, path, namespace, name)
+		);
+	`
+	}
+	
 	_, err := s.db.ExecContext(ctx, query)
 	return err
 }
@@ -158,6 +262,14 @@ func (s *PropertyService) createIndexes(ctx context.Context) error {
 		{"idx_properties_is_live", "CREATE INDEX IF NOT EXISTS idx_properties_is_live ON properties(is_live)"},
 	}
 
+	if s.dialect == DialectPostgres {
+		// 前缀查询按字节序做范围扫描，默认排序规则的索引无法使用
+		indexes = append(indexes, struct {
+			name string
+			sql  string
+		}{"idx_properties_user_path_prefix", `CREATE INDEX IF NOT EXISTS idx_properties_user_path_prefix ON properties(user_id, path COLLATE "C")`})
+	}
+
 	for _, index := range indexes {
 		if _, err := s.db.ExecContext(ctx, index.sql); err != nil {
 			return fmt.Errorf("创建索引 %s 失败: %v", index.name, err)
@@ -173,10 +285,10 @@ func (s *PropertyService) createIndexes(ctx context.Context) error {
 
 // GetProperty 获取单个属性
 func (s *PropertyService) GetProperty(ctx context.Context, userID, path, namespace, name string) (*DatabaseProperty, error) {
-	builder := NewSelectBuilder("properties").
+	builder := NewSelectBuilder("properties", propertyColumns...).
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", userID, path, namespace, name)
 
-	row := builder.ExecuteQueryRow(ctx, s.db)
+	row := builder.QueryRowWith(ctx, s.stmts)
 	
 	property, err := s.scanProperty(row)
 	if err == sql.ErrNoRows {
@@ -200,7 +312,7 @@ func (s *PropertyService) listProperties(ctx context.Context, userID, path strin
 		Where("user_id = ? AND path = ?", userID, path).
 		OrderBy("namespace", "name")
 
-	rows, err := builder.ExecuteQuery(ctx, s.db)
+	rows, err := builder.QueryWith(ctx, s.stmts)
 	if err != nil {
 		return nil, fmt.Errorf("查询属性列表失败: %v", err)
 	}
@@ -209,8 +321,199 @@ func (s *PropertyService) listProperties(ctx context.Context, userID, path strin
 	return s.scanProperties(rows)
 }
 
+// ListResourceProperties 列出资源自身的属性，目录路径带或不带结尾/都会匹配。
+// 启用缓存时结果可能来自缓存，调用方不能修改返回的属性
+func (s *PropertyService) ListResourceProperties(ctx context.Context, userID, resourcePath string) ([]*DatabaseProperty, error) {
+	if s.cache == nil {
+		return s.listResourceProperties(ctx, userID, resourcePath)
+	}
+	if props, ok := s.cache.get(userID, resourcePath); ok {
+		return props, nil
+	}
+
+	gen := s.cache.generation()
+	props, err := s.listResourceProperties(ctx, userID, resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(userID, resourcePath, props, gen)
+	return props, nil
+}
+
+// listResourceProperties 内部方法，直接查询数据库
+func (s *PropertyService) listResourceProperties(ctx context.Context, userID, resourcePath string) ([]*DatabaseProperty, error) {
+	condition, args := treePropertyCondition(userID, resourcePath, false)
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		Where(condition, args...).
+		OrderBy("namespace", "name")
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询属性列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	props, err := s.scanProperties(rows)
+	if err != nil {
+		return nil, err
+	}
+	// 收藏保存在单独的表中，作为活属性与其他属性一起返回和缓存
+	favorite, err := s.isFavorite(ctx, userID, resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	if favorite {
+		props = append(props, favoriteProperty(userID, trimPropertyPath(resourcePath)))
+	}
+	return props, nil
+}
+
+// ListPropertiesByPathPrefix 一次查询列出路径以prefix开头的所有属性，按保存的路径分组。
+// prefix按字面匹配，不做目录边界判断；查询为(user_id, path)上的范围扫描，可以使用索引
+func (s *PropertyService) ListPropertiesByPathPrefix(ctx context.Context, userID, prefix string) (map[string][]*DatabaseProperty, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	// PostgreSQL按字节序比较才与前缀匹配一致，对应idx_properties_user_path_prefix索引
+	column := "path"
+	if s.dialect == DialectPostgres {
+		column = `path COLLATE "C"`
+	}
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		Where("user_id = ?", userID).
+		OrderBy("path", "namespace", "name")
+	if prefix != "" {
+		builder.And(column+" >= ?", prefix)
+	}
+	if upper, ok := prefixUpperBound(prefix); ok {
+		builder.And(column+" < ?", upper)
+	}
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询属性列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	props, err := s.scanProperties(rows)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]*DatabaseProperty)
+	for _, prop := range props {
+		groups[prop.Path] = append(groups[prop.Path], prop)
+	}
+	return groups, nil
+}
+
+// prefixUpperBound 返回以prefix开头的字符串（按字节序）的上界：把最后一个字符加一。
+// UTF-8的字节序与码点顺序一致，结果仍是合法的UTF-8；prefix为空时没有上界
+func prefixUpperBound(prefix string) (string, bool) {
+	runes := []rune(prefix)
+	for i := len(runes) - 1; i >= 0; i-- {
+		next := runes[i] + 1
+		if next >= 0xD800 && next <= 0xDFFF {
+			next = 0xE000 // 跳过代理项
+		}
+		if next <= unicode.MaxRune {
+			return string(append(runes[:i], next)), true
+		}
+	}
+	return "", false
+}
+
+// PrefetchChildProperties 用一次查询把目录自身及其直接子资源的属性载入缓存，
+// 之后为Depth: 1 PROPFIND逐个读取子资源属性时不再访问数据库。未启用缓存时不做任何事
+func (s *PropertyService) PrefetchChildProperties(ctx context.Context, userID, dirPath string) error {
+	if s.cache == nil {
+		return nil
+	}
+
+	gen := s.cache.generation()
+	dir := trimPropertyPath(dirPath)
+	byPath, err := s.ListPropertiesByPathPrefix(ctx, userID, dir)
+	if err != nil {
+		return err
+	}
+
+	// 目录的属性可能以带或不带结尾/的路径保存，按缓存路径合并
+	groups := make(map[string][]*DatabaseProperty)
+	for storedPath, props := range byPath {
+		key := trimPropertyPath(storedPath)
+		if key != dir && !strings.HasPrefix(key, dir+"/") {
+			continue // 名称以目录名开头的兄弟资源
+		}
+		groups[key] = append(groups[key], props...)
+	}
+	favorites, err := s.favoritesByPathPrefix(ctx, userID, dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range favorites {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			groups[p] = append(groups[p], favoriteProperty(userID, p))
+		}
+	}
+	s.cache.putChildren(userID, dir, groups, gen)
+	return nil
+}
+
+// SearchProperties 按条件搜索用户的属性。支持的过滤条件：namespace、name（精确）、
+// name_pattern（名称包含）、value（精确）、value_pattern（值包含，不区分大小写）、
+// path_prefix（路径及其子树）、is_live（bool）、limit（int）
+func (s *PropertyService) SearchProperties(ctx context.Context, userID string, filters map[string]interface{}) ([]*Property, error) {
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		Where("user_id = ?", userID).
+		OrderBy("path", "namespace", "name")
+
+	if namespace, ok := filters["namespace"].(string); ok && namespace != "" {
+		builder.And("namespace = ?", namespace)
+	}
+	if name, ok := filters["name"].(string); ok && name != "" {
+		builder.And("name = ?", name)
+	}
+	if pattern, ok := filters["name_pattern"].(string); ok && pattern != "" {
+		builder.And(`name LIKE ? ESCAPE '\'`, "%"+escapeLikePattern(pattern)+"%")
+	}
+	if value, ok := filters["value"].(string); ok {
+		builder.And("value = ?", value)
+	}
+	if pattern, ok := filters["value_pattern"].(string); ok && pattern != "" {
+		builder.And(`LOWER(value) LIKE ? ESCAPE '\'`, "%"+escapeLikePattern(strings.ToLower(pattern))+"%")
+	}
+	if prefix, ok := filters["path_prefix"].(string); ok && prefix != "" && prefix != "/" {
+		root := trimPropertyPath(prefix)
+		builder.And(`(path = ? OR path LIKE ? ESCAPE '\')`, root, escapeLikePattern(root+"/")+"%")
+	}
+	if isLive, ok := filters["is_live"].(bool); ok {
+		builder.And("is_live = ?", isLive)
+	}
+	if limit, ok := filters["limit"].(int); ok && limit > 0 {
+		builder.Limit(limit)
+	}
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("搜索属性失败: %v", err)
+	}
+	defer rows.Close()
+
+	dbProps, err := s.scanProperties(rows)
+	if err != nil {
+		return nil, err
+	}
+	return DatabasePropertyToPropertySlice(dbProps), nil
+}
+
 // CreateProperty 创建新属性
 func (s *PropertyService) CreateProperty(ctx context.Context, property *DatabaseProperty) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	now := time.Now()
 	property.CreatedAt = now.Unix()
 	property.UpdatedAt = now.Unix()
@@ -220,35 +523,92 @@ func (s *PropertyService) CreateProperty(ctx context.Context, property *Database
 		Values(property.UserID, property.ResourceID, property.Path, property.Name, property.Namespace, property.Value, property.IsLive, now.Unix(), now.Unix()).
 		OnConflict("user_id", "path", "namespace", "name")
 
-	result, err := builder.Execute(ctx, s.db)
-	if err != nil {
-		return fmt.Errorf("创建属性失败: %v", err)
+	id, err := s.insertProperty(ctx, nil, builder)
+	if errors.Is(err, ErrPropertyExists) {
+		return err
 	}
-
-	id, err := result.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("获取新属性ID失败: %v", err)
+		return fmt.Errorf("创建属性失败: %v", err)
 	}
+	s.invalidateCache(property.UserID, property.Path, false)
 
 	property.ID = int(id)
 	return nil
 }
 
+// setProperty 创建属性，同名属性已存在时更新其值
+func (s *PropertyService) setProperty(ctx context.Context, property *DatabaseProperty) error {
+	err := s.CreateProperty(ctx, property)
+	if errors.Is(err, ErrPropertyExists) {
+		return s.UpdateProperty(ctx, property)
+	}
+	return err
+}
+
+// insertProperty 执行INSERT并返回新属性ID，tx为nil时使用预编译语句
+// PostgreSQL不支持LastInsertId，改用RETURNING id；唯一约束冲突未插入时返回ErrPropertyExists
+func (s *PropertyService) insertProperty(ctx context.Context, tx *sql.Tx, builder *InsertBuilder) (int64, error) {
+	if s.dialect == DialectPostgres {
+		builder.Returning("id")
+
+		var row *sql.Row
+		if tx != nil {
+			row = tx.QueryRowContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...)
+		} else {
+			row = builder.QueryRowWith(ctx, s.stmts)
+		}
+
+		var id int64
+		if err := row.Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return 0, ErrPropertyExists
+			}
+			return 0, err
+		}
+		return id, nil
+	}
+
+	var result sql.Result
+	var err error
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, builder.Build(), builder.Args()...)
+	} else {
+		result, err = builder.ExecWith(ctx, s.stmts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// 冲突时SQLite的LastInsertId仍是上一次插入的ID，按影响行数判断
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrPropertyExists
+	}
+	return result.LastInsertId()
+}
+
 // UpdateProperty 更新属性
 func (s *PropertyService) UpdateProperty(ctx context.Context, property *DatabaseProperty) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	now := time.Now()
 	property.UpdatedAt = now.Unix()
 
 	builder := NewUpdateBuilder("properties").
-		Set("value = ?", property.Value).
-		Set("is_live = ?", property.IsLive).
-		Set("updated_at = ?", now.Unix()).
+		Set("value", property.Value).
+		Set("is_live", property.IsLive).
+		Set("updated_at", now.Unix()).
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", property.UserID, property.Path, property.Namespace, property.Name)
 
-	result, err := builder.Execute(ctx, s.db)
+	result, err := builder.ExecWith(ctx, s.stmts)
 	if err != nil {
 		return fmt.Errorf("更新属性失败: %v", err)
 	}
+	s.invalidateCache(property.UserID, property.Path, false)
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -264,13 +624,20 @@ func (s *PropertyService) UpdateProperty(ctx context.Context, property *Database
 
 // DeleteProperty 删除属性
 func (s *PropertyService) DeleteProperty(ctx context.Context, userID, path, namespace, name string) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	builder := NewDeleteBuilder("properties").
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", userID, path, namespace, name)
 
-	result, err := builder.Execute(ctx, s.db)
+	result, err := builder.ExecWith(ctx, s.stmts)
 	if err != nil {
 		return fmt.Errorf("删除属性失败: %v", err)
 	}
+	s.invalidateCache(userID, path, false)
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -299,6 +666,12 @@ func (s *PropertyService) BatchSetProperties(ctx context.Context, userID, path s
 
 // batchSetProperties 内部方法
 func (s *PropertyService) batchSetProperties(ctx context.Context, userID, path string, properties []*DatabaseProperty) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("开始事务失败: %v", err)
@@ -325,11 +698,80 @@ func (s *PropertyService) batchSetProperties(ctx context.Context, userID, path s
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, property := range properties {
+		s.invalidateCache(property.UserID, property.Path, false)
+	}
+	return nil
+}
+
+// SetPropertiesBatch 在单个事务中为多个资源设置属性（已存在则更新），用于批量导入
+func (s *PropertyService) SetPropertiesBatch(ctx context.Context, properties []*DatabaseProperty) error {
+	if len(properties) == 0 {
+		return nil
+	}
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, property := range properties {
+		// oc:favorite与PROPPATCH一样写入收藏表
+		if isFavoriteProperty(property.Namespace, property.Name) {
+			favorite, err := parseFavorite(property.Value)
+			if err != nil {
+				return fmt.Errorf("写入属性失败: %v", err)
+			}
+			if err := s.setFavoriteTx(ctx, tx, property.UserID, property.Path, favorite); err != nil {
+				return err
+			}
+			continue
+		}
+		existing, err := s.getPropertyTx(tx, property.UserID, property.Path, property.Namespace, property.Name)
+		if err != nil {
+			return fmt.Errorf("检查属性存在性失败: %v", err)
+		}
+
+		if existing != nil {
+			err = s.updatePropertyTx(tx, property)
+		} else {
+			err = s.createPropertyTx(tx, property)
+		}
+		if err != nil {
+			return fmt.Errorf("写入属性失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, property := range properties {
+		s.invalidateCache(property.UserID, property.Path, false)
+	}
+	return nil
 }
 
 // BatchRemoveProperties 批量删除属性
 func (s *PropertyService) BatchRemoveProperties(ctx context.Context, userID, path string, namespaces []string, names []string) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("开始事务失败: %v", err)
@@ -344,7 +786,393 @@ func (s *PropertyService) BatchRemoveProperties(ctx context.Context, userID, pat
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, path, false)
+	return nil
+}
+
+// PatchProperties 在一个事务中设置和删除资源的属性（PROPPATCH），任一操作失败时全部回滚。
+// 先设置后删除，删除不存在的属性不是错误（RFC 4918 14.23）
+func (s *PropertyService) PatchProperties(ctx context.Context, userID, path string, set, remove []*Property) error {
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, prop := range set {
+		// oc:favorite写入收藏表，值已通过processSetOperation检查
+		if isFavoriteProperty(prop.Namespace, prop.Name) {
+			favorite, _ := parseFavorite(prop.Value)
+			if err := s.setFavoriteTx(ctx, tx, userID, path, favorite); err != nil {
+				return err
+			}
+			continue
+		}
+		property := PropertyToDatabaseProperty(*prop)
+		property.UserID, property.Path = userID, path
+		// 之前以另一种形式（带或不带结尾/）保存的同名属性被替换，避免同一目录出现两个值
+		for _, form := range propertyPathForms(path) {
+			if form == path {
+				continue
+			}
+			if err := s.deletePropertyTx(tx, userID, form, property.Namespace, property.Name); err != nil {
+				return fmt.Errorf("写入属性%s失败: %v", property.Name, err)
+			}
+		}
+		existing, err := s.getPropertyTx(tx, userID, path, property.Namespace, property.Name)
+		if err != nil {
+			return fmt.Errorf("检查属性存在性失败: %v", err)
+		}
+		if existing != nil {
+			err = s.updatePropertyTx(tx, property)
+		} else {
+			err = s.createPropertyTx(tx, property)
+		}
+		if err != nil {
+			return fmt.Errorf("写入属性%s失败: %v", property.Name, err)
+		}
+	}
+	for _, prop := range remove {
+		if isFavoriteProperty(prop.Namespace, prop.Name) {
+			if err := s.setFavoriteTx(ctx, tx, userID, path, false); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, form := range propertyPathForms(path) {
+			if err := s.deletePropertyTx(tx, userID, form, prop.Namespace, prop.Name); err != nil {
+				return fmt.Errorf("删除属性%s失败: %v", prop.Name, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, path, false)
+	return nil
+}
+
+// ========================================
+// 资源移动/复制时的属性迁移
+// ========================================
+
+// MoveProperties 将源路径的属性迁移到目标路径，recursive为true时包括整个子树
+// 目标路径上原有的属性会被覆盖（与资源的Overwrite语义一致）
+func (s *PropertyService) MoveProperties(ctx context.Context, userID, srcPath, dstPath string, recursive bool) error {
+	return s.MovePropertiesWith(ctx, userID, srcPath, dstPath, recursive, nil)
+}
+
+// MovePropertiesWith 与MoveProperties相同，fn不为nil时在同一事务中执行，
+// 用于属性与其他表位于同一数据库时一并更新，任一步失败整体回滚
+func (s *PropertyService) MovePropertiesWith(ctx context.Context, userID, srcPath, dstPath string, recursive bool, fn func(*sql.Tx) error) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	srcProps, err := s.listTreePropertiesTx(tx, userID, srcPath, recursive)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteTreePropertiesTx(tx, userID, dstPath, recursive); err != nil {
+		return err
+	}
+
+	srcRoot, dstRoot := trimPropertyPath(srcPath), trimPropertyPath(dstPath)
+	now := time.Now().Unix()
+	for _, prop := range srcProps {
+		builder := NewUpdateBuilder("properties").
+			Set("path", dstRoot+strings.TrimPrefix(prop.Path, srcRoot)).
+			Set("updated_at", now).
+			Where("id = ?", prop.ID)
+
+		if _, err := tx.Exec(s.dialect.Rebind(builder.Build()), builder.Args()...); err != nil {
+			return fmt.Errorf("移动属性失败: %v", err)
+		}
+	}
+	if err := s.moveFavoritesTx(ctx, tx, userID, srcPath, dstPath, recursive); err != nil {
+		return err
+	}
+
+	if fn != nil {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, srcPath, recursive)
+	s.invalidateCache(userID, dstPath, recursive)
+	return nil
+}
+
+// UsesDB 判断属性是否存储在db所在的数据库中
+func (s *PropertyService) UsesDB(db *sql.DB) bool {
+	return db != nil && s.db == db
+}
+
+// CopyProperties 将源路径的属性复制到目标路径，recursive为true时包括整个子树
+// 只读目录标记不会被复制
+func (s *PropertyService) CopyProperties(ctx context.Context, userID, srcPath, dstPath string, recursive bool) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	srcProps, err := s.listTreePropertiesTx(tx, userID, srcPath, recursive)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteTreePropertiesTx(tx, userID, dstPath, recursive); err != nil {
+		return err
+	}
+
+	srcRoot, dstRoot := trimPropertyPath(srcPath), trimPropertyPath(dstPath)
+	for _, prop := range srcProps {
+		// 副本是新资源，创建时间取复制的时间（未记录时使用存储中的修改时间）；评论按文件ID关联，不属于副本
+		if prop.Namespace == NamespaceMetadata && (prop.Name == ReadOnlyPropertyName || prop.Name == CreationDatePropertyName ||
+			prop.Name == CommentCountPropertyName) {
+			continue
+		}
+
+		copied := *prop
+		copied.Path = dstRoot + strings.TrimPrefix(prop.Path, srcRoot)
+		if err := s.createPropertyTx(tx, &copied); err != nil {
+			return fmt.Errorf("复制属性失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateCache(userID, dstPath, recursive)
+	return nil
+}
+
+// DeletePropertiesForPath 删除资源自身的所有属性（资源被删除时调用）
+func (s *PropertyService) DeletePropertiesForPath(ctx context.Context, userID, path string) error {
+	return s.deleteTreeProperties(ctx, userID, path, false)
+}
+
+// DeletePropertiesRecursive 删除目录及其整个子树的所有属性
+func (s *PropertyService) DeletePropertiesRecursive(ctx context.Context, userID, path string) error {
+	return s.deleteTreeProperties(ctx, userID, path, true)
+}
+
+// deleteTreeProperties 内部方法
+func (s *PropertyService) deleteTreeProperties(ctx context.Context, userID, path string, recursive bool) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	condition, args := treePropertyCondition(userID, path, recursive)
+	builder := NewDeleteBuilder("properties").Where(condition, args...)
+
+	if _, err := builder.ExecWith(ctx, s.stmts); err != nil {
+		return fmt.Errorf("删除属性失败: %v", err)
+	}
+	favorites := NewDeleteBuilder("favorites").Where(condition, args...)
+	if _, err := favorites.ExecWith(ctx, s.stmts); err != nil {
+		return fmt.Errorf("删除收藏失败: %v", err)
+	}
+	s.invalidateCache(userID, path, recursive)
+	return nil
+}
+
+// PropertyOwner 拥有属性的资源（用户+路径）
+type PropertyOwner struct {
+	UserID string
+	Path   string
+}
+
+// ListPropertyOwners 列出所有拥有属性的资源，用于孤儿属性清理
+func (s *PropertyService) ListPropertyOwners(ctx context.Context) ([]PropertyOwner, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	builder := NewSelectBuilder("properties", "user_id", "path").
+		GroupBy("user_id", "path").
+		OrderBy("user_id", "path")
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询属性资源失败: %v", err)
+	}
+	defer rows.Close()
+
+	var owners []PropertyOwner
+	for rows.Next() {
+		var owner PropertyOwner
+		if err := rows.Scan(&owner.UserID, &owner.Path); err != nil {
+			return nil, fmt.Errorf("扫描属性资源失败: %v", err)
+		}
+		owners = append(owners, owner)
+	}
+	return owners, rows.Err()
+}
+
+// ========================================
+// 存储后端迁移
+// ========================================
+
+// ExportProperties 按ID顺序导出全部属性记录（用于迁移到其他存储后端）
+func (s *PropertyService) ExportProperties(ctx context.Context) ([]*DatabaseProperty, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		OrderBy("id")
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("导出属性失败: %v", err)
+	}
+	defer rows.Close()
+
+	return s.scanProperties(rows)
+}
+
+// ImportProperties 原样导入属性记录（保留创建/更新时间），已存在的属性保持不变
+// 返回实际写入的记录数，导入可重复执行
+func (s *PropertyService) ImportProperties(ctx context.Context, properties []*DatabaseProperty) (int, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return 0, err
+	}
+
+	release, err := s.acquireWriter(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for _, property := range properties {
+		builder := NewInsertBuilder("properties").
+			Columns("user_id", "resource_id", "path", "name", "namespace", "value", "is_live", "created_at", "updated_at").
+			Values(property.UserID, property.ResourceID, property.Path, property.Name, property.Namespace, property.Value, property.IsLive, property.CreatedAt, property.UpdatedAt).
+			OnConflict("user_id", "path", "namespace", "name")
+
+		result, err := tx.ExecContext(ctx, s.dialect.Rebind(builder.Build()), builder.Args()...)
+		if err != nil {
+			return 0, fmt.Errorf("导入属性 %s%s 失败: %v", property.Path, property.Name, err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			imported += int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %v", err)
+	}
+	if s.cache != nil {
+		s.cache.purge()
+	}
+	return imported, nil
+}
+
+// trimPropertyPath 去掉路径结尾的/，用于子树前缀替换
+func trimPropertyPath(p string) string {
+	if p == "/" {
+		return ""
+	}
+	return strings.TrimSuffix(p, "/")
+}
+
+// propertyPathForms 返回资源属性可能使用的两种路径形式（不带和带结尾/），根目录为""和"/"
+func propertyPathForms(p string) []string {
+	root := trimPropertyPath(p)
+	return []string{root, root + "/"}
+}
+
+// treePropertyCondition 构建匹配路径本身（含/结尾形式）及可选子树的条件
+func treePropertyCondition(userID, resourcePath string, recursive bool) (string, []interface{}) {
+	root := trimPropertyPath(resourcePath)
+	condition := "user_id = ? AND (path = ? OR path = ?"
+	args := []interface{}{userID, root, root + "/"}
+	if recursive {
+		condition += " OR path LIKE ? ESCAPE '\\'"
+		args = append(args, escapeLikePattern(root+"/")+"%")
+	}
+	return condition + ")", args
+}
+
+// escapeLikePattern 转义LIKE模式中的通配符
+func escapeLikePattern(p string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(p)
+}
+
+// listTreePropertiesTx 事务中列出路径（及可选子树）的所有属性
+func (s *PropertyService) listTreePropertiesTx(tx *sql.Tx, userID, resourcePath string, recursive bool) ([]*DatabaseProperty, error) {
+	condition, args := treePropertyCondition(userID, resourcePath, recursive)
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		Where(condition, args...)
+
+	rows, err := tx.Query(s.dialect.Rebind(builder.Build()), builder.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("查询属性列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	return s.scanProperties(rows)
+}
+
+// deleteTreePropertiesTx 事务中删除路径（及可选子树）的所有属性
+func (s *PropertyService) deleteTreePropertiesTx(tx *sql.Tx, userID, resourcePath string, recursive bool) error {
+	condition, args := treePropertyCondition(userID, resourcePath, recursive)
+	builder := NewDeleteBuilder("properties").Where(condition, args...)
+
+	if _, err := tx.Exec(s.dialect.Rebind(builder.Build()), builder.Args()...); err != nil {
+		return fmt.Errorf("删除属性失败: %v", err)
+	}
+	return nil
 }
 
 // ========================================
@@ -353,10 +1181,10 @@ func (s *PropertyService) BatchRemoveProperties(ctx context.Context, userID, pat
 
 // getPropertyTx 事务中获取属性
 func (s *PropertyService) getPropertyTx(tx *sql.Tx, userID, path, namespace, name string) (*DatabaseProperty, error) {
-	builder := NewSelectBuilder("properties").
+	builder := NewSelectBuilder("properties", propertyColumns...).
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", userID, path, namespace, name)
 
-	row := tx.QueryRow(builder.Build(), builder.Args()...)
+	row := tx.QueryRow(s.dialect.Rebind(builder.Build()), builder.Args()...)
 	
 	property, err := s.scanProperty(row)
 	if err == sql.ErrNoRows {
@@ -376,12 +1204,7 @@ func (s *PropertyService) createPropertyTx(tx *sql.Tx, property *DatabasePropert
 		Values(property.UserID, property.ResourceID, property.Path, property.Name, property.Namespace, property.Value, property.IsLive, now.Unix(), now.Unix()).
 		OnConflict("user_id", "path", "namespace", "name")
 
-	result, err := tx.Exec(builder.Build(), builder.Args()...)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
+	id, err := s.insertProperty(context.Background(), tx, builder)
 	if err != nil {
 		return err
 	}
@@ -396,12 +1219,12 @@ func (s *PropertyService) updatePropertyTx(tx *sql.Tx, property *DatabasePropert
 	property.UpdatedAt = now.Unix()
 
 	builder := NewUpdateBuilder("properties").
-		Set("value = ?", property.Value).
-		Set("is_live = ?", property.IsLive).
-		Set("updated_at = ?", now.Unix()).
+		Set("value", property.Value).
+		Set("is_live", property.IsLive).
+		Set("updated_at", now.Unix()).
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", property.UserID, property.Path, property.Namespace, property.Name)
 
-	_, err := tx.Exec(builder.Build(), builder.Args()...)
+	_, err := tx.Exec(s.dialect.Rebind(builder.Build()), builder.Args()...)
 	return err
 }
 
@@ -410,7 +1233,7 @@ func (s *PropertyService) deletePropertyTx(tx *sql.Tx, userID, path, namespace,
 	builder := NewDeleteBuilder("properties").
 		Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", userID, path, namespace, name)
 
-	_, err := tx.Exec(builder.Build(), builder.Args()...)
+	_, err := tx.Exec(s.dialect.Rebind(builder.Build()), builder.Args()...)
 	return err
 }
 
@@ -483,7 +1306,13 @@ func (s *PropertyService) scanProperties(rows *sql.Rows) ([]*DatabaseProperty, e
 func (s *PropertyService) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
+
+	if err := s.stmts.Close(); err != nil {
+		return err
+	}
+	if !s.ownsDB {
+		return nil
+	}
 	return s.db.Close()
 }
 
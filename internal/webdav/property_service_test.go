@@ -775,6 +775,153 @@ func TestPropertyService_BatchRemoveProperties(t *testing.T) {
 	})
 }
 
+// ========================================
+// Move/Copy Properties Tests
+// ========================================
+
+func TestPropertyService_MoveProperties(t *testing.T) {
+	service, cleanup := createTestPropertyService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("移动单个文件的属性", func(t *testing.T) {
+		err := service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/move/a.txt", "CUSTOM:", "author", "Alice", false)))
+		require.NoError(t, err)
+
+		err = service.MoveProperties(ctx, "user1", "/move/a.txt", "/move/b.txt", false)
+		assert.NoError(t, err)
+
+		old, _ := service.GetProperty(ctx, "user1", "/move/a.txt", "CUSTOM:", "author")
+		assert.Nil(t, old)
+
+		moved, _ := service.GetProperty(ctx, "user1", "/move/b.txt", "CUSTOM:", "author")
+		require.NotNil(t, moved)
+		assert.Equal(t, "Alice", moved.Value)
+	})
+
+	t.Run("递归移动子树属性", func(t *testing.T) {
+		properties := []*Property{
+			createTestProperty("user1", "/tree/", "CUSTOM:", "label", "folder", false),
+			createTestProperty("user1", "/tree/sub/file.txt", "CUSTOM:", "label", "nested", false),
+			createTestProperty("user1", "/tree_other/file.txt", "CUSTOM:", "label", "sibling", false),
+		}
+		for _, prop := range properties {
+			err := service.CreateProperty(ctx, PropertyToDatabaseProperty(*prop))
+			require.NoError(t, err)
+		}
+
+		err := service.MoveProperties(ctx, "user1", "/tree", "/moved", true)
+		assert.NoError(t, err)
+
+		folder, _ := service.GetProperty(ctx, "user1", "/moved/", "CUSTOM:", "label")
+		assert.NotNil(t, folder)
+
+		nested, _ := service.GetProperty(ctx, "user1", "/moved/sub/file.txt", "CUSTOM:", "label")
+		require.NotNil(t, nested)
+		assert.Equal(t, "nested", nested.Value)
+
+		// 名称相似的兄弟目录不受影响
+		sibling, _ := service.GetProperty(ctx, "user1", "/tree_other/file.txt", "CUSTOM:", "label")
+		assert.NotNil(t, sibling)
+	})
+
+	t.Run("覆盖目标路径已有的属性", func(t *testing.T) {
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/over/src.txt", "CUSTOM:", "author", "new", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/over/dst.txt", "CUSTOM:", "author", "old", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/over/dst.txt", "CUSTOM:", "stale", "x", false))))
+
+		err := service.MoveProperties(ctx, "user1", "/over/src.txt", "/over/dst.txt", false)
+		assert.NoError(t, err)
+
+		author, _ := service.GetProperty(ctx, "user1", "/over/dst.txt", "CUSTOM:", "author")
+		require.NotNil(t, author)
+		assert.Equal(t, "new", author.Value)
+
+		stale, _ := service.GetProperty(ctx, "user1", "/over/dst.txt", "CUSTOM:", "stale")
+		assert.Nil(t, stale)
+	})
+}
+
+func TestPropertyService_CopyProperties(t *testing.T) {
+	service, cleanup := createTestPropertyService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("递归复制子树属性", func(t *testing.T) {
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/copy/", "CUSTOM:", "label", "folder", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/copy/doc.txt", "CUSTOM:", "label", "doc", false))))
+
+		err := service.CopyProperties(ctx, "user1", "/copy", "/copy2", true)
+		assert.NoError(t, err)
+
+		// 源属性保留
+		src, _ := service.GetProperty(ctx, "user1", "/copy/doc.txt", "CUSTOM:", "label")
+		assert.NotNil(t, src)
+
+		dst, _ := service.GetProperty(ctx, "user1", "/copy2/doc.txt", "CUSTOM:", "label")
+		require.NotNil(t, dst)
+		assert.Equal(t, "doc", dst.Value)
+	})
+
+	t.Run("非递归复制不包含子资源", func(t *testing.T) {
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/shallow/", "CUSTOM:", "label", "folder", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/shallow/doc.txt", "CUSTOM:", "label", "doc", false))))
+
+		err := service.CopyProperties(ctx, "user1", "/shallow", "/shallow2", false)
+		assert.NoError(t, err)
+
+		folder, _ := service.GetProperty(ctx, "user1", "/shallow2/", "CUSTOM:", "label")
+		assert.NotNil(t, folder)
+
+		child, _ := service.GetProperty(ctx, "user1", "/shallow2/doc.txt", "CUSTOM:", "label")
+		assert.Nil(t, child)
+	})
+}
+
+func TestPropertyService_DeletePropertiesForPath(t *testing.T) {
+	service, cleanup := createTestPropertyService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("删除文件属性", func(t *testing.T) {
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/del/file.txt", "CUSTOM:", "author", "Alice", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/del/file.txt.bak", "CUSTOM:", "author", "Bob", false))))
+
+		err := service.DeletePropertiesForPath(ctx, "user1", "/del/file.txt")
+		assert.NoError(t, err)
+
+		properties, err := service.ListProperties(ctx, "user1", "/del/file.txt")
+		assert.NoError(t, err)
+		assert.Empty(t, properties)
+
+		// 前缀相同的其他文件不受影响
+		other, _ := service.GetProperty(ctx, "user1", "/del/file.txt.bak", "CUSTOM:", "author")
+		assert.NotNil(t, other)
+	})
+
+	t.Run("递归删除目录属性", func(t *testing.T) {
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/rm/", "CUSTOM:", "label", "folder", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user1", "/rm/a/b.txt", "CUSTOM:", "label", "nested", false))))
+		require.NoError(t, service.CreateProperty(ctx, PropertyToDatabaseProperty(*createTestProperty("user2", "/rm/a/b.txt", "CUSTOM:", "label", "other user", false))))
+
+		err := service.DeletePropertiesRecursive(ctx, "user1", "/rm")
+		assert.NoError(t, err)
+
+		folder, _ := service.GetProperty(ctx, "user1", "/rm/", "CUSTOM:", "label")
+		assert.Nil(t, folder)
+
+		nested, _ := service.GetProperty(ctx, "user1", "/rm/a/b.txt", "CUSTOM:", "label")
+		assert.Nil(t, nested)
+
+		// 其他用户的属性不受影响
+		otherUser, _ := service.GetProperty(ctx, "user2", "/rm/a/b.txt", "CUSTOM:", "label")
+		assert.NotNil(t, otherUser)
+	})
+}
+
 // ========================================
 // Advanced Query Tests
 // ========================================
@@ -1519,6 +1666,53 @@ func TestPropertyService_GetStats(t *testing.T) {
 	})
 }
 
+func TestPropertyService_Maintain(t *testing.T) {
+	service, cleanup := createTestPropertyService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	createBulkTestData(t, service, ctx, "user1", "/maintain", 500)
+	require.NoError(t, service.DeletePropertiesRecursive(ctx, "user1", "/maintain"))
+
+	stats, err := service.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", stats["journal_mode"])
+	assert.Greater(t, stats["free_bytes"].(int64), int64(0))
+
+	report, err := service.Maintain(ctx, 0.1)
+	require.NoError(t, err)
+	assert.True(t, report.Vacuumed)
+	assert.Greater(t, report.ReclaimedBytes, int64(0))
+
+	stats, err = service.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats["free_bytes"])
+	assert.Equal(t, report, stats["last_maintenance"])
+}
+
+func TestPropertyService_ConcurrentPatch(t *testing.T) {
+	service, cleanup := createTestPropertyService(t)
+	defer cleanup()
+
+	// 并发写入在进程内排队，不应返回SQLITE_BUSY
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prop := createTestProperty("user1", "/busy.txt", NamespaceCustom, "p"+randString(6), "v", false)
+			errs <- service.PatchProperties(ctx, "user1", "/busy.txt", []*Property{prop}, nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
 // ========================================
 // Integration with SQLBuilder Tests
 // ========================================
@@ -1566,7 +1760,7 @@ func TestPropertyService_SQLBuilderIntegration(t *testing.T) {
 		
 		// 使用UpdateBuilder更新
 		updateBuilder := NewUpdateBuilder("properties").
-			Set("value = ?", "Updated via SQLBuilder").
+			Set("value", "Updated via SQLBuilder").
 			Where("user_id = ? AND path = ? AND namespace = ? AND name = ?", 
 				"user1", "/path/update.txt", "DAV:", "displayname")
 		
@@ -0,0 +1,106 @@
+package webdav
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// OrphanSweeper 定期清理存储中已不存在的资源上遗留的属性
+type OrphanSweeper struct {
+	properties *PropertyService
+	storage    *storage.Service
+	interval   time.Duration
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewOrphanSweeper 创建孤儿属性清理器
+func NewOrphanSweeper(properties *PropertyService, storage *storage.Service, interval time.Duration) *OrphanSweeper {
+	return &OrphanSweeper{
+		properties: properties,
+		storage:    storage,
+		interval:   interval,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start 启动后台清理任务，interval不大于0时不启动
+func (s *OrphanSweeper) Start() {
+	if s.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				removed, err := s.Sweep(context.Background())
+				if err != nil {
+					log.Printf("Warning: orphan property sweep failed: %v", err)
+				} else if removed > 0 {
+					log.Printf("Removed properties of %d orphaned resources", removed)
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理任务
+func (s *OrphanSweeper) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+// Sweep 执行一次清理，返回被清理属性的资源数量
+func (s *OrphanSweeper) Sweep(ctx context.Context) (int, error) {
+	owners, err := s.properties.ListPropertyOwners(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, owner := range owners {
+		uid, err := uuid.Parse(owner.UserID)
+		if err != nil || owner.Path == "/" || owner.Path == "" {
+			continue
+		}
+
+		exists, err := s.resourceExists(ctx, uid, owner.Path)
+		if err != nil {
+			// 存储不可用时不做任何删除
+			return removed, err
+		}
+		if exists {
+			continue
+		}
+
+		if err := s.properties.DeletePropertiesForPath(ctx, owner.UserID, owner.Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// resourceExists 检查资源（文件或目录）在存储中是否存在
+func (s *OrphanSweeper) resourceExists(ctx context.Context, uid uuid.UUID, resourcePath string) (bool, error) {
+	_, err := s.storage.StatResource(ctx, uid, resourcePath)
+	if err == nil {
+		return true, nil
+	}
+	if storage.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
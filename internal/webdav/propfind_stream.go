@@ -0,0 +1,207 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// multistatusFlushEvery 每写出多少个D:response刷新一次底层连接
+const multistatusFlushEvery = 100
+
+// truncatedResponse 子资源数超出上限时追加的D:response（参照RFC 5323的507截断约定）
+type truncatedResponse struct {
+	XMLName xml.Name `xml:"D:response"`
+	Href    string   `xml:"D:href"`
+	Status  string   `xml:"D:status"`
+	Error   struct {
+		NumberOfMatchesWithinLimits struct{} `xml:"D:number-of-matches-within-limits"`
+	} `xml:"D:error"`
+	ResponseDescription string `xml:"D:responsedescription"`
+}
+
+// propfindRequest PROPFIND请求体，只用于判断是否显式请求了allprop不包含的属性（访问控制、配额）
+type propfindRequest struct {
+	XMLName xml.Name    `xml:"DAV: propfind"`
+	Prop    *reportProp `xml:"DAV: prop"`
+}
+
+// propfindRequestedProps 解析PROPFIND请求体中显式请求的属性，没有请求体或不是prop请求时返回nil。
+// 请求体超出XML限制时已发送错误响应，返回false
+func (h *Handler) propfindRequestedProps(c *gin.Context) (*reportProp, bool) {
+	body, ok := h.readXMLBody(c)
+	if !ok || body == nil {
+		return nil, ok
+	}
+	var req propfindRequest
+	if err := davxml.Unmarshal(body, &req); err != nil {
+		return nil, true
+	}
+	return req.Prop, true
+}
+
+// propfindDepth 解析PROPFIND的Depth头（缺省为infinity）。
+// 未开启allow_infinite_depth时拒绝infinity请求，返回false表示已写出错误响应
+func (h *Handler) propfindDepth(c *gin.Context) (string, bool) {
+	depth := strings.ToLower(strings.TrimSpace(c.GetHeader("Depth")))
+	switch depth {
+	case "":
+		depth = "infinity"
+	case "0", "1", "infinity":
+	default:
+		c.Status(http.StatusBadRequest)
+		return "", false
+	}
+
+	if depth == "infinity" && !h.config.AllowInfiniteDepth {
+		h.sendDAVError(c, http.StatusForbidden, ConditionPropfindFiniteDepth)
+		return "", false
+	}
+	return depth, true
+}
+
+// walkTree 逐个目录分页列举整棵子树：每个目录只做一次非递归列举，
+// 内存中只保留待访问的目录前缀。没有目录标记的隐式目录也会作为集合返回。
+// 根目录以外的每个目录在列举前预取子资源的属性（根目录由调用方预取）
+func (h *Handler) walkTree(ctx context.Context, uid uuid.UUID, root string, fn func(minio.ObjectInfo) error) error {
+	pending := []string{root}
+	stopped := false
+
+	for len(pending) > 0 && !stopped {
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if dir != root {
+			h.prefetchProperties(ctx, uid.String(), "/"+dir)
+		}
+
+		err := h.storage.WalkObjects(ctx, uid, dir, false, func(obj minio.ObjectInfo) error {
+			if err := fn(obj); err != nil {
+				stopped = errors.Is(err, storage.ErrStopWalk)
+				return err
+			}
+			if strings.HasSuffix(obj.Key, "/") {
+				pending = append(pending, obj.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multistatusWriter 流式写出multistatus：每个D:response生成后立即编码，
+// 每multistatusFlushEvery个响应写到连接一次，大目录的PROPFIND不需要在内存中构建完整响应。
+// 207状态和响应头在第一次写到连接时才发送，在此之前出错仍可以改为返回500
+type multistatusWriter struct {
+	w         http.ResponseWriter
+	buf       bytes.Buffer
+	enc       *xml.Encoder
+	written   int
+	committed bool
+	aborted   bool
+}
+
+// newMultistatusWriter 在缓冲区中写出XML声明和D:multistatus起始标签，此时还没有发送任何内容
+func newMultistatusWriter(w http.ResponseWriter) (*multistatusWriter, error) {
+	m := &multistatusWriter{w: w}
+	m.buf.WriteString(xml.Header)
+
+	m.enc = xml.NewEncoder(&m.buf)
+	m.enc.Indent("", "  ")
+	start := xml.StartElement{
+		Name: xml.Name{Local: "D:multistatus"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns:D"}, Value: "DAV:"},
+			{Name: xml.Name{Local: "xmlns:oc"}, Value: webdavtypes.NamespaceOwnCloud},
+			{Name: xml.Name{Local: "xmlns:gw"}, Value: NamespaceMetadata},
+			{Name: xml.Name{Local: "xmlns:C"}, Value: webdavtypes.NamespaceCalDAV},
+			{Name: xml.Name{Local: "xmlns:CARD"}, Value: webdavtypes.NamespaceCardDAV},
+		},
+	}
+	if err := m.enc.EncodeToken(start); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Write 编码单个D:response，并定期刷新到客户端
+func (m *multistatusWriter) Write(resp Response) error {
+	if err := m.enc.EncodeElement(resp, xml.StartElement{Name: xml.Name{Local: "D:response"}}); err != nil {
+		return err
+	}
+
+	m.written++
+	if m.written%multistatusFlushEvery == 0 {
+		return m.flush()
+	}
+	return nil
+}
+
+// WriteTruncated 追加507响应，告知客户端结果在limit个子资源处被截断
+func (m *multistatusWriter) WriteTruncated(href string, limit int) error {
+	resp := truncatedResponse{
+		Href:                href,
+		Status:              "HTTP/1.1 507 Insufficient Storage",
+		ResponseDescription: fmt.Sprintf("Only the first %d members are listed", limit),
+	}
+	return m.enc.Encode(resp)
+}
+
+// Abort 列举中途出错时调用：还没有向客户端发送任何内容时丢弃缓冲的响应并返回500，
+// 返回false表示207已经发出，只能结束已写出的部分
+func (m *multistatusWriter) Abort() bool {
+	if m.committed {
+		return false
+	}
+	m.aborted = true
+	m.buf.Reset()
+	m.w.Header().Del("Cache-Control") // 不缓存错误响应
+	m.w.WriteHeader(http.StatusInternalServerError)
+	return true
+}
+
+// Close 写出D:multistatus结束标签并刷新，Abort之后不再写出任何内容
+func (m *multistatusWriter) Close() error {
+	if m.aborted {
+		return nil
+	}
+	if err := m.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "D:multistatus"}}); err != nil {
+		return err
+	}
+	return m.flush()
+}
+
+// flush 把缓冲的响应写到HTTP连接并刷新，第一次写出时先发送207状态
+func (m *multistatusWriter) flush() error {
+	if err := m.enc.Flush(); err != nil {
+		return err
+	}
+	if !m.committed {
+		m.committed = true
+		m.w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		m.w.WriteHeader(http.StatusMultiStatus)
+	}
+	_, err := m.w.Write(m.buf.Bytes())
+	m.buf.Reset()
+	if err != nil {
+		return err
+	}
+	if f, ok := m.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+// decodeMultistatus 解析multistatus响应体，返回各D:response的href和状态
+func decodeMultistatus(t *testing.T, body string) []struct{ Href, Status string } {
+	t.Helper()
+	var ms struct {
+		XMLName   xml.Name `xml:"DAV: multistatus"`
+		Responses []struct {
+			Href   string `xml:"DAV: href"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("invalid multistatus %q: %v", body, err)
+	}
+	out := make([]struct{ Href, Status string }, len(ms.Responses))
+	for i, r := range ms.Responses {
+		out[i].Href, out[i].Status = r.Href, r.Status
+	}
+	return out
+}
+
+func TestMultistatusWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses int
+		truncated bool
+	}{
+		{"empty", 0, false},
+		{"single", 1, false},
+		{"flushes periodically", multistatusFlushEvery*2 + 1, false},
+		{"truncated", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			stream, err := newMultistatusWriter(rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.responses; i++ {
+				if err := stream.Write(Response{Href: fmt.Sprintf("/dir/%d", i), Status: "HTTP/1.1 200 OK"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.truncated {
+				stream.WriteTruncated("/dir/", tt.responses)
+			}
+			if err := stream.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != http.StatusMultiStatus {
+				t.Errorf("status = %d, want 207", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if !strings.HasPrefix(rec.Body.String(), xml.Header) {
+				t.Errorf("missing XML declaration: %q", rec.Body.String())
+			}
+			got := decodeMultistatus(t, rec.Body.String())
+			want := tt.responses
+			if tt.truncated {
+				want++
+			}
+			if len(got) != want {
+				t.Fatalf("decoded %d responses, want %d", len(got), want)
+			}
+			if tt.truncated && (got[want-1].Href != "/dir/" || !strings.Contains(got[want-1].Status, "507")) {
+				t.Errorf("truncation marker = %+v", got[want-1])
+			}
+		})
+	}
+}
+
+// TestMultistatusWriterAbort 还没有发送内容时出错改为500，已经发送207后只能结束响应
+func TestMultistatusWriterAbort(t *testing.T) {
+	t.Run("before commit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "public, max-age=60")
+		stream, err := newMultistatusWriter(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Write(Response{Href: "/dir/", Status: "HTTP/1.1 200 OK"})
+		if !stream.Abort() {
+			t.Fatal("Abort before any flush should succeed")
+		}
+		stream.Close()
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("aborted response has body %q", rec.Body.String())
+		}
+		if rec.Header().Get("Cache-Control") != "" {
+			t.Error("error response must not be cacheable")
+		}
+	})
+
+	t.Run("after commit", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		stream, err := newMultistatusWriter(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < multistatusFlushEvery; i++ {
+			stream.Write(Response{Href: fmt.Sprintf("/dir/%d", i), Status: "HTTP/1.1 200 OK"})
+		}
+		if stream.Abort() {
+			t.Fatal("Abort after flush should report the status as already sent")
+		}
+		stream.Close()
+
+		if rec.Code != http.StatusMultiStatus {
+			t.Errorf("status = %d, want 207", rec.Code)
+		}
+		if got := decodeMultistatus(t, rec.Body.String()); len(got) != multistatusFlushEvery {
+			t.Errorf("decoded %d responses, want %d", len(got), multistatusFlushEvery)
+		}
+	})
+}
+
+func TestPropfindDepth(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		infinite   bool
+		want       string
+		wantOK     bool
+		wantStatus int
+	}{
+		{"zero", "0", false, "0", true, 0},
+		{"one", "1", false, "1", true, 0},
+		{"case and whitespace", " Infinity ", true, "infinity", true, 0},
+		{"infinity allowed", "infinity", true, "infinity", true, 0},
+		// 缺省按RFC 4918视为infinity
+		{"missing header allowed", "", true, "infinity", true, 0},
+		{"infinity rejected", "infinity", false, "", false, http.StatusForbidden},
+		{"missing header rejected", "", false, "", false, http.StatusForbidden},
+		{"invalid", "2", true, "", false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, nil, nil)
+			h.SetConfig(config.WebDAVConfig{AllowInfiniteDepth: tt.infinite})
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest("PROPFIND", "/dir/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Depth", tt.header)
+			}
+
+			depth, ok := h.propfindDepth(c)
+			if depth != tt.want || ok != tt.wantOK {
+				t.Fatalf("propfindDepth = %q, %v; want %q, %v", depth, ok, tt.want, tt.wantOK)
+			}
+			if status := c.Writer.Status(); !ok && status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), ConditionPropfindFiniteDepth) {
+				t.Errorf("403 body missing precondition: %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+// newTestStorage 创建本地目录上的存储服务和一个已建好存储桶的用户
+func newTestStorage(t *testing.T) (*storage.Service, uuid.UUID) {
+	t.Helper()
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewServiceWithBackend(&config.Config{Storage: config.StorageConfig{Type: "local"}}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	if err := s.EnsureBucket(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	return s, userID
+}
+
+func TestWalkTree(t *testing.T) {
+	store, uid := newTestStorage(t)
+	ctx := context.Background()
+	if err := store.CreateFolder(ctx, uid, "/docs/sub"); err != nil {
+		t.Fatal(err)
+	}
+	// deep没有目录标记，只能从子对象推断
+	for _, p := range []string{"/docs/a.txt", "/docs/sub/b.txt", "/docs/sub/deep/c.txt", "/other.txt"} {
+		if err := store.PutObject(ctx, uid, p, strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHandler(store, nil, newTestPropertyService(t))
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		stopAt  string
+		failAt  string
+		want    []string
+		wantErr error
+	}{
+		{name: "whole subtree", want: []string{"docs/a.txt", "docs/sub/", "docs/sub/b.txt", "docs/sub/deep/", "docs/sub/deep/c.txt"}},
+		{name: "stop walk", stopAt: "docs/sub/b.txt", want: []string{"docs/a.txt", "docs/sub/"}},
+		{name: "listing error", failAt: "docs/sub/deep/", want: []string{"docs/a.txt", "docs/sub/", "docs/sub/b.txt"}, wantErr: boom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := h.walkTree(ctx, uid, "/docs", func(obj minio.ObjectInfo) error {
+				switch obj.Key {
+				case tt.stopAt:
+					return storage.ErrStopWalk
+				case tt.failAt:
+					return boom
+				}
+				got = append(got, obj.Key)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("walkTree error = %v, want %v", err, tt.wantErr)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("walked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+// proppatchMultistatus PROPPATCH的multistatus响应（RFC 4918 9.2.1），只包含请求的资源，
+// 每个propstat列出同一结果的属性
+type proppatchMultistatus struct {
+	XMLName  xml.Name            `xml:"D:multistatus"`
+	XMLNS    string              `xml:"xmlns:D,attr"`
+	Href     string              `xml:"D:response>D:href"`
+	Propstat []proppatchPropstat `xml:"D:response>D:propstat"`
+}
+
+// proppatchPropstat 一组结果相同的属性，属性只输出名称
+type proppatchPropstat struct {
+	Prop struct {
+		Properties []webdavtypes.DeadProperty `xml:",any"`
+	} `xml:"D:prop"`
+	Status              string              `xml:"D:status"`
+	Error               *proppatchCondition `xml:"D:error,omitempty"`
+	ResponseDescription string              `xml:"D:responsedescription,omitempty"`
+}
+
+// proppatchCondition propstat中的D:error，Condition为DAV:前置条件元素
+type proppatchCondition struct {
+	Condition struct {
+		XMLName xml.Name
+	}
+}
+
+// newProppatchMultistatus 按结果分组：成功的属性为一个200 propstat，错误按状态码、前置条件和说明分组，保持请求中的顺序
+func newProppatchMultistatus(href string, succeeded []webdavtypes.DeadProperty, propErrors []webdavtypes.PropertyError) proppatchMultistatus {
+	ms := proppatchMultistatus{XMLNS: "DAV:", Href: href}
+	if len(succeeded) > 0 {
+		var propstat proppatchPropstat
+		propstat.Prop.Properties = succeeded
+		propstat.Status = getHTTPStatus(http.StatusOK)
+		ms.Propstat = append(ms.Propstat, propstat)
+	}
+
+	type groupKey struct {
+		code      int
+		condition string
+		message   string
+	}
+	groups := make(map[groupKey]int)
+	for _, propError := range propErrors {
+		key := groupKey{propError.Code, propError.Condition, propError.Message}
+		i, ok := groups[key]
+		if !ok {
+			propstat := proppatchPropstat{
+				Status:              getHTTPStatus(propError.Code),
+				ResponseDescription: propError.Message,
+			}
+			if propError.Condition != "" {
+				propstat.Error = &proppatchCondition{}
+				propstat.Error.Condition.XMLName = xml.Name{Local: "D:" + propError.Condition}
+			}
+			ms.Propstat = append(ms.Propstat, propstat)
+			i = len(ms.Propstat) - 1
+			groups[key] = i
+		}
+		if propError.Property != "" {
+			ms.Propstat[i].Prop.Properties = append(ms.Propstat[i].Prop.Properties, webdavtypes.DeadProperty{
+				Namespace: propError.Namespace,
+				Name:      propError.Property,
+			})
+		}
+	}
+	return ms
+}
+
+// failedDependencyErrors PROPPATCH有属性失败时其余属性都未修改（RFC 4918 9.2.1），为这些属性补充424
+func failedDependencyErrors(propErrors []webdavtypes.PropertyError, groups ...[]*Property) []webdavtypes.PropertyError {
+	failed := make(map[string]bool, len(propErrors))
+	for _, propError := range propErrors {
+		failed[propError.Namespace+":"+propError.Property] = true
+	}
+	for _, group := range groups {
+		for _, prop := range group {
+			key := prop.Namespace + ":" + prop.Name
+			if failed[key] {
+				continue
+			}
+			failed[key] = true
+			propErrors = append(propErrors, webdavtypes.PropertyError{
+				Code:      http.StatusFailedDependency,
+				Message:   "not applied because another property in the request failed",
+				Property:  prop.Name,
+				Namespace: prop.Namespace,
+			})
+		}
+	}
+	return propErrors
+}
+
+// writeProppatchResponse 发送PROPPATCH响应，请求整体失败（如锁验证失败）时status不是207
+func writeProppatchResponse(c *gin.Context, status int, href string, succeeded []webdavtypes.DeadProperty, propErrors []webdavtypes.PropertyError) {
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.Status(status)
+	c.Writer.Write([]byte(xml.Header))
+	xml.NewEncoder(c.Writer).Encode(newProppatchMultistatus(href, succeeded, propErrors))
+}
@@ -0,0 +1,95 @@
+package webdav
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+func TestPatchProperties_SetsAndRemovesTogether(t *testing.T) {
+	service, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	require.NoError(t, err)
+	defer service.Close()
+	ctx := context.Background()
+	require.NoError(t, service.Initialize(ctx))
+	require.NoError(t, service.BatchSetProperties(ctx, "user1", "/a.txt", []*Property{
+		{UserID: "user1", Path: "/a.txt", Namespace: "urn:x", Name: "old", Value: "1"},
+		{UserID: "user1", Path: "/a.txt", Namespace: "urn:x", Name: "keep", Value: "1"},
+	}))
+
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/a.txt",
+		[]*Property{{Namespace: "urn:x", Name: "keep", Value: "2"}, {Namespace: "urn:x", Name: "new", Value: "3"}},
+		[]*Property{{Namespace: "urn:x", Name: "old"}, {Namespace: "urn:x", Name: "missing"}},
+	))
+
+	props, err := service.ListResourceProperties(ctx, "user1", "/a.txt")
+	require.NoError(t, err)
+	values := make(map[string]string)
+	for _, prop := range props {
+		values[prop.Name] = prop.Value
+	}
+	assert.Equal(t, map[string]string{"keep": "2", "new": "3"}, values)
+}
+
+func TestFailedDependencyErrors(t *testing.T) {
+	propErrors := failedDependencyErrors(
+		[]webdavtypes.PropertyError{{Code: 403, Namespace: "DAV:", Property: "getetag"}},
+		[]*Property{{Namespace: "urn:x", Name: "color"}},
+		[]*Property{{Namespace: "urn:x", Name: "size"}, {Namespace: "DAV:", Name: "getetag"}},
+	)
+	require.Len(t, propErrors, 3)
+	assert.Equal(t, 403, propErrors[0].Code)
+	assert.Equal(t, 424, propErrors[1].Code)
+	assert.Equal(t, "color", propErrors[1].Property)
+	assert.Equal(t, 424, propErrors[2].Code)
+	assert.Equal(t, "size", propErrors[2].Property)
+
+	ms := newProppatchMultistatus("/a.txt", nil, propErrors)
+	require.Len(t, ms.Propstat, 2)
+	assert.Equal(t, "HTTP/1.1 403 Forbidden", ms.Propstat[0].Status)
+	assert.Equal(t, "HTTP/1.1 424 Failed Dependency", ms.Propstat[1].Status)
+	assert.Len(t, ms.Propstat[1].Prop.Properties, 2)
+}
+
+func TestPatchProperties_CollectionPathForms(t *testing.T) {
+	service, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	require.NoError(t, err)
+	defer service.Close()
+	ctx := context.Background()
+	require.NoError(t, service.Initialize(ctx))
+
+	// 旧版本可能以带结尾/的路径保存目录的属性
+	require.NoError(t, service.BatchSetProperties(ctx, "user1", "/docs/", []*Property{
+		{UserID: "user1", Path: "/docs/", Namespace: "urn:x", Name: "color", Value: "red"},
+		{UserID: "user1", Path: "/docs/", Namespace: "urn:x", Name: "size", Value: "1"},
+	}))
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/docs",
+		[]*Property{{Namespace: "urn:x", Name: "color", Value: "blue"}},
+		[]*Property{{Namespace: "urn:x", Name: "size"}},
+	))
+	require.NoError(t, service.PatchProperties(ctx, "user1", "/",
+		[]*Property{{Namespace: "urn:x", Name: "color", Value: "green"}}, nil))
+
+	values := func(resourcePath string) map[string]string {
+		props, err := service.ListResourceProperties(ctx, "user1", resourcePath)
+		require.NoError(t, err)
+		values := make(map[string]string)
+		for _, prop := range props {
+			values[prop.Name] = prop.Value
+		}
+		return values
+	}
+	assert.Equal(t, map[string]string{"color": "blue"}, values("/docs/"))
+	assert.Equal(t, map[string]string{"color": "green"}, values("/"))
+
+	// 目录改名后属性随目录移动
+	require.NoError(t, service.MoveProperties(ctx, "user1", "/docs/", "/archive/docs/", true))
+	assert.Empty(t, values("/docs"))
+	assert.Equal(t, map[string]string{"color": "blue"}, values("/archive/docs"))
+	assert.Equal(t, map[string]string{"color": "green"}, values("/"))
+}
@@ -0,0 +1,254 @@
+package webdav
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+// PublicBasePath 公开命名空间的路由前缀
+const PublicBasePath = "/public-dav"
+
+// publicAllow 公开命名空间支持的方法
+const publicAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+// PublicHandler 以只读WebDAV匿名发布指定用户的一个目录，用于分发发布包、数据集等公开文件。
+// 请求路径映射到 Prefix 下，写方法一律返回405
+type PublicHandler struct {
+	h      *Handler
+	userID uuid.UUID
+	prefix string
+	config config.PublicNamespaceConfig
+}
+
+// NewPublicHandler 创建公开命名空间处理器，userID为提供内容的用户
+func NewPublicHandler(h *Handler, userID uuid.UUID, cfg config.PublicNamespaceConfig) *PublicHandler {
+	prefix := path.Clean("/" + cfg.Prefix)
+	return &PublicHandler{h: h, userID: userID, prefix: prefix, config: cfg}
+}
+
+// Handle 按方法分发请求
+func (p *PublicHandler) Handle(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodOptions:
+		c.Header("DAV", "1")
+		c.Header("Allow", publicAllow)
+		c.Status(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		p.handleGet(c)
+	case "PROPFIND":
+		p.handlePropfind(c)
+	default:
+		c.Header("Allow", publicAllow)
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
+
+// storagePath 将请求路径映射为用户空间内的路径，path.Clean去掉了..，不会越出Prefix
+func (p *PublicHandler) storagePath(c *gin.Context) string {
+	return path.Join(p.prefix, path.Clean("/"+c.Param("path")))
+}
+
+// publicHref 将用户空间内的路径转换为公开命名空间下的href
+func (p *PublicHandler) publicHref(objectPath string) string {
+	rel := strings.TrimPrefix(objectPath, p.prefix)
+	if p.prefix == "/" {
+		rel = objectPath
+	}
+	return PublicBasePath + "/" + strings.TrimPrefix(rel, "/")
+}
+
+// publicResponse 把响应地址改写为公开链接，并隐藏锁令牌（匿名访问不能加锁）
+func (p *PublicHandler) publicResponse(resp Response, href string) Response {
+	resp.Href = href
+	for i := range resp.Propstat {
+		resp.Propstat[i].Prop.LockDiscovery = &webdavtypes.LockDiscovery{}
+	}
+	return resp
+}
+
+// handleGet 处理条件请求后交给Handler输出内容，支持Range
+func (p *PublicHandler) handleGet(c *gin.Context) {
+	objectPath := p.storagePath(c)
+	if p.hidden(c, objectPath) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	info, err := p.h.storage.StatObject(c.Request.Context(), p.userID, objectPath)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	etag := resourceETag(*info)
+	modified := p.h.modTime(p.userID.String(), objectPath, info.LastModified)
+	c.Header("Cache-Control", cacheControl(p.config.CacheMaxAge))
+	if p.h.notModified(c.Request, *info, modified) {
+		c.Header("ETag", etag)
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	p.impersonate(c, objectPath)
+	if c.Request.Method == http.MethodHead {
+		p.h.HandleHead(c)
+		return
+	}
+	p.h.HandleGet(c)
+}
+
+// handlePropfind 列出公开目录，href使用公开命名空间的路径，不存在的路径返回404
+func (p *PublicHandler) handlePropfind(c *gin.Context) {
+	ctx := c.Request.Context()
+	objectPath := p.storagePath(c)
+	userIDString := p.userID.String()
+
+	depth, ok := p.h.propfindDepth(c)
+	if !ok {
+		return
+	}
+
+	file, err := p.h.storage.StatObject(ctx, p.userID, objectPath)
+	if err != nil && !storage.IsNotFound(err) {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if (file == nil && objectPath != p.prefix && !p.folderExists(c, objectPath)) || p.hidden(c, objectPath) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", cacheControl(p.config.ListingMaxAge))
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	if file != nil {
+		resp := p.h.createFileResponse(objectPath, file.Size, file.LastModified, file.ContentType, storage.ContentETag(*file), userIDString, storage.FileID(*file))
+		stream.Write(p.publicResponse(resp, p.publicHref(objectPath)))
+		return
+	}
+
+	if depth != "0" {
+		p.h.prefetchProperties(ctx, userIDString, objectPath)
+	}
+	root := p.h.createFolderResponse(objectPath, time.Now(), userIDString, p.h.folderFileID(ctx, p.userID, objectPath))
+	root = p.publicResponse(root, strings.TrimSuffix(p.publicHref(objectPath), "/")+"/")
+	if err := stream.Write(root); err != nil || depth == "0" {
+		return
+	}
+
+	limit := p.h.config.PropfindMaxChildren
+	children := 0
+	truncated := false
+	writeChild := func(obj minio.ObjectInfo) error {
+		if limit > 0 && children >= limit {
+			truncated = true
+			return storage.ErrStopWalk
+		}
+		objPath := "/" + obj.Key
+		if p.hidden(c, objPath) {
+			return nil
+		}
+		children++
+
+		if strings.HasSuffix(obj.Key, "/") {
+			resp := p.h.createFolderResponse(objPath, obj.LastModified, userIDString, storage.FileID(obj))
+			return stream.Write(p.publicResponse(resp, p.publicHref(objPath)))
+		}
+		resp := p.h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, storage.ContentETag(obj), userIDString, storage.FileID(obj))
+		return stream.Write(p.publicResponse(resp, p.publicHref(objPath)))
+	}
+	if depth == "infinity" {
+		err = p.h.walkTree(ctx, p.userID, objectPath, writeChild)
+	} else {
+		err = p.h.storage.WalkObjects(ctx, p.userID, objectPath, false, writeChild)
+	}
+	if err != nil {
+		log.Printf("Public PROPFIND listing %s failed after %d members: %v", objectPath, children, err)
+		stream.Abort()
+		return
+	}
+	if truncated {
+		stream.WriteTruncated(root.Href, limit)
+	}
+}
+
+// hidden 判断资源是否被ACL明确拒绝匿名读取（deny DAV:read给DAV:all或DAV:unauthenticated），
+// 被拒绝的资源在公开命名空间中视为不存在。读取ACL失败时同样隐藏
+func (p *PublicHandler) hidden(c *gin.Context, objectPath string) bool {
+	acls, err := p.h.aclsFor(c, p.userID.String())
+	if err != nil {
+		log.Printf("Warning: failed to load ACLs for public namespace: %v", err)
+		return true
+	}
+	return acls.denied(aclSubject{}, objectPath, PrivilegeRead)
+}
+
+// folderExists 判断目录是否存在：有目录标记或至少有一个子对象
+func (p *PublicHandler) folderExists(c *gin.Context, folderPath string) bool {
+	exists, _ := p.h.storage.FolderExists(c.Request.Context(), p.userID, folderPath)
+	return exists
+}
+
+// impersonate 让Handler以内容提供者的身份处理映射后的路径
+func (p *PublicHandler) impersonate(c *gin.Context, objectPath string) {
+	c.Set("userID", p.userID.String())
+	for i := range c.Params {
+		if c.Params[i].Key == "path" {
+			c.Params[i].Value = objectPath
+			return
+		}
+	}
+	c.Params = append(c.Params, gin.Param{Key: "path", Value: objectPath})
+}
+
+// notModified 判断客户端缓存的info是否仍然有效，开启legacy_etags时同时接受旧版ETag。
+// modified为资源的修改时间（客户端设置过时以其为准）
+func (h *Handler) notModified(r *http.Request, info minio.ObjectInfo, modified time.Time) bool {
+	if notModified(r, resourceETag(info), modified) {
+		return true
+	}
+	return h.config.LegacyETags && notModified(r, legacyETag(info), modified)
+}
+
+// notModified 按If-None-Match（优先）或If-Modified-Since判断客户端缓存是否仍然有效
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modified.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "public, no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge.Seconds()))
+}
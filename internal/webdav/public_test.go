@@ -0,0 +1,55 @@
+package webdav
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestPublicHref(t *testing.T) {
+	tests := []struct {
+		prefix, objectPath, want string
+	}{
+		{"/releases", "/releases", "/public-dav/"},
+		{"/releases/", "/releases/v1.2/app.tar.gz", "/public-dav/v1.2/app.tar.gz"},
+		{"releases", "/releases/v1.2/", "/public-dav/v1.2/"},
+		{"", "/datasets/a.csv", "/public-dav/datasets/a.csv"},
+		{"/", "/", "/public-dav/"},
+	}
+	for _, tt := range tests {
+		p := NewPublicHandler(nil, uuid.Nil, config.PublicNamespaceConfig{Prefix: tt.prefix})
+		if got := p.publicHref(tt.objectPath); got != tt.want {
+			t.Errorf("publicHref(%q, %q) = %q, want %q", tt.prefix, tt.objectPath, got, tt.want)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	etag := `"abc"`
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"无条件", nil, false},
+		{"ETag匹配", map[string]string{"If-None-Match": `"xyz", W/"abc"`}, true},
+		{"ETag不匹配时忽略If-Modified-Since", map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, false},
+		{"未修改", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"已修改", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, false},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(http.MethodGet, "/public-dav/a", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := notModified(r, etag, modified); got != tt.want {
+			t.Errorf("%s: notModified() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
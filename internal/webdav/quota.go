@@ -0,0 +1,65 @@
+package webdav
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/webdav-gateway/internal/models"
+)
+
+// isQuotaProperty 判断是否为RFC 4331的配额属性，由用户的配额和用量计算，不能通过PROPPATCH修改
+func isQuotaProperty(namespace, name string) bool {
+	return namespace == "DAV:" && (name == "quota-available-bytes" || name == "quota-used-bytes")
+}
+
+// requestUser 读取当前用户的配额和用量，同一请求中只查询一次
+func (h *Handler) requestUser(c *gin.Context) (*models.User, error) {
+	if cached, ok := c.Get("webdav.user"); ok {
+		return cached.(*models.User), nil
+	}
+	uid, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.auth.GetUserByID(c.Request.Context(), uid)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("webdav.user", user)
+	return user, nil
+}
+
+// addQuotaProperties 按请求为集合的PROPFIND响应添加quota-available-bytes和quota-used-bytes。
+// 配额按用户空间计算，所有集合返回相同的值；用量超过配额时可用空间为0
+func (h *Handler) addQuotaProperties(c *gin.Context, resp *Response, props *reportProp) {
+	if props == nil || len(resp.Propstat) == 0 {
+		return
+	}
+	prop := &resp.Propstat[0].Prop
+	if prop.ResourceType == nil || prop.ResourceType.Collection == nil {
+		return
+	}
+	wantsAvailable, wantsUsed := props.wants("DAV:", "quota-available-bytes"), props.wants("DAV:", "quota-used-bytes")
+	if !wantsAvailable && !wantsUsed {
+		return
+	}
+
+	user, err := h.requestUser(c)
+	if err != nil {
+		log.Printf("Warning: failed to load quota for PROPFIND: %v", err)
+		return
+	}
+	if wantsAvailable {
+		available := user.StorageQuota - user.StorageUsed
+		if available < 0 {
+			available = 0
+		}
+		prop.QuotaAvailableBytes = &available
+	}
+	if wantsUsed {
+		used := user.StorageUsed
+		prop.QuotaUsedBytes = &used
+	}
+}
@@ -0,0 +1,140 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/models"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+// quotaProps 请求指定DAV:属性的prop
+func quotaProps(names ...string) *reportProp {
+	props := &reportProp{}
+	for _, name := range names {
+		props.Names = append(props.Names, daslNode{XMLName: xml.Name{Space: "DAV:", Local: name}})
+	}
+	return props
+}
+
+func quotaResponse(collection bool) Response {
+	var prop webdavtypes.ResponseProp
+	if collection {
+		prop.ResourceType = &ResourceType{Collection: &struct{}{}}
+	}
+	return Response{Href: "/docs/", Propstat: []webdavtypes.Propstat{{Prop: prop, Status: "HTTP/1.1 200 OK"}}}
+}
+
+func TestAddQuotaProperties(t *testing.T) {
+	const gib = int64(1 << 30)
+	both := quotaProps("quota-available-bytes", "quota-used-bytes")
+
+	tests := []struct {
+		name          string
+		quota, used   int64
+		collection    bool
+		props         *reportProp
+		wantAvailable *int64
+		wantUsed      *int64
+	}{
+		{"both", 10 * gib, 3 * gib, true, both, ptr(7 * gib), ptr(3 * gib)},
+		{"available only", 10 * gib, 3 * gib, true, quotaProps("quota-available-bytes"), ptr(7 * gib), nil},
+		{"used only", 10 * gib, 3 * gib, true, quotaProps("quota-used-bytes", "getetag"), nil, ptr(3 * gib)},
+		{"empty space", 10 * gib, 0, true, both, ptr(10 * gib), ptr(0)},
+		{"quota used up", 10 * gib, 10 * gib, true, both, ptr(0), ptr(10 * gib)},
+		// 降低配额后用量可能超过配额，可用空间不为负
+		{"over quota", 10 * gib, 12 * gib, true, both, ptr(0), ptr(12 * gib)},
+		{"file", 10 * gib, 3 * gib, false, both, nil, nil},
+		{"not requested", 10 * gib, 3 * gib, true, quotaProps("getetag", "displayname"), nil, nil},
+		{"allprop", 10 * gib, 3 * gib, true, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("PROPFIND", "/docs/", nil)
+			c.Set("webdav.user", &models.User{StorageQuota: tt.quota, StorageUsed: tt.used})
+
+			resp := quotaResponse(tt.collection)
+			(&Handler{}).addQuotaProperties(c, &resp, tt.props)
+
+			prop := resp.Propstat[0].Prop
+			if !equalPtr(prop.QuotaAvailableBytes, tt.wantAvailable) {
+				t.Errorf("quota-available-bytes = %v, want %v", deref(prop.QuotaAvailableBytes), deref(tt.wantAvailable))
+			}
+			if !equalPtr(prop.QuotaUsedBytes, tt.wantUsed) {
+				t.Errorf("quota-used-bytes = %v, want %v", deref(prop.QuotaUsedBytes), deref(tt.wantUsed))
+			}
+		})
+	}
+}
+
+// TestAddQuotaPropertiesXML 0是有效的配额值，同样写入响应
+func TestAddQuotaPropertiesXML(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PROPFIND", "/docs/", nil)
+	c.Set("webdav.user", &models.User{StorageQuota: 1024, StorageUsed: 2048})
+
+	resp := quotaResponse(true)
+	(&Handler{}).addQuotaProperties(c, &resp, quotaProps("quota-available-bytes", "quota-used-bytes"))
+	out, err := xml.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<D:quota-available-bytes>0</D:quota-available-bytes>",
+		"<D:quota-used-bytes>2048</D:quota-used-bytes>",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("response missing %s: %s", want, out)
+		}
+	}
+}
+
+// TestAddQuotaPropertiesNoUser 无法读取用户时不返回配额属性
+func TestAddQuotaPropertiesNoUser(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PROPFIND", "/docs/", nil)
+	c.Set("userID", "not-a-uuid")
+
+	resp := quotaResponse(true)
+	(&Handler{}).addQuotaProperties(c, &resp, quotaProps("quota-available-bytes", "quota-used-bytes"))
+	if prop := resp.Propstat[0].Prop; prop.QuotaAvailableBytes != nil || prop.QuotaUsedBytes != nil {
+		t.Errorf("quota properties set without a user: %v, %v", deref(prop.QuotaAvailableBytes), deref(prop.QuotaUsedBytes))
+	}
+}
+
+func TestIsQuotaProperty(t *testing.T) {
+	for _, tt := range []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"DAV:", "quota-available-bytes", true},
+		{"DAV:", "quota-used-bytes", true},
+		{"DAV:", "getetag", false},
+		{"http://example.com/ns", "quota-used-bytes", false},
+	} {
+		if got := isQuotaProperty(tt.namespace, tt.name); got != tt.want {
+			t.Errorf("isQuotaProperty(%q, %q) = %v, want %v", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
+
+func ptr(v int64) *int64 { return &v }
+
+func deref(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func equalPtr(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,75 @@
+package webdav
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errRangeNotSatisfiable Range请求超出文件大小
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange 解析后的单个字节区间（闭区间）
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// length 区间字节数
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// parseByteRange 解析单区间的Range头：bytes=a-b、bytes=a-、bytes=-n
+// 返回nil表示应返回完整内容（无Range头、格式无法识别或多区间请求）
+func parseByteRange(header string, size int64) (*byteRange, error) {
+	if header == "" || !strings.HasPrefix(header, "bytes=") {
+		return nil, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		// 多区间（multipart/byteranges）不支持，按RFC 7233可忽略Range返回完整内容
+		return nil, nil
+	}
+
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return nil, nil
+	}
+	first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	if first == "" {
+		// 后缀区间：最后n个字节
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return &byteRange{start: size - n, end: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return &byteRange{start: start, end: end}, nil
+}
@@ -0,0 +1,52 @@
+package webdav
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    *byteRange
+		wantErr error
+	}{
+		{"no header", "", 100, nil, nil},
+		{"other unit", "items=0-5", 100, nil, nil},
+		{"closed range", "bytes=0-9", 100, &byteRange{0, 9}, nil},
+		{"open ended", "bytes=90-", 100, &byteRange{90, 99}, nil},
+		{"last byte", "bytes=99-99", 100, &byteRange{99, 99}, nil},
+		{"end clamped to size", "bytes=50-1000", 100, &byteRange{50, 99}, nil},
+		{"suffix", "bytes=-10", 100, &byteRange{90, 99}, nil},
+		{"suffix larger than file", "bytes=-500", 100, &byteRange{0, 99}, nil},
+		{"whitespace", "bytes= 10 - 19 ", 100, &byteRange{10, 19}, nil},
+		// 多区间和无法识别的格式按RFC 7233忽略，返回完整内容
+		{"multiple ranges", "bytes=0-1,5-6", 100, nil, nil},
+		{"missing dash", "bytes=10", 100, nil, nil},
+		{"end before start", "bytes=20-10", 100, nil, nil},
+		{"not a number", "bytes=a-b", 100, nil, nil},
+		{"negative suffix", "bytes=--5", 100, nil, nil},
+		{"start beyond size", "bytes=100-", 100, nil, errRangeNotSatisfiable},
+		{"zero suffix", "bytes=-0", 100, nil, errRangeNotSatisfiable},
+		{"empty file suffix", "bytes=-5", 0, nil, errRangeNotSatisfiable},
+		{"empty file", "bytes=0-", 0, nil, errRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseByteRange(tt.header, tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseByteRange(%q, %d) error = %v, want %v", tt.header, tt.size, err, tt.wantErr)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("parseByteRange(%q, %d) = %+v, want %+v", tt.header, tt.size, got, tt.want)
+			}
+			if got != nil && got.length() != tt.want.end-tt.want.start+1 {
+				t.Errorf("length = %d", got.length())
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package webdav
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnlyPropertyName 目录只读（冻结）标记的属性名，位于NamespaceMetadata命名空间
+const ReadOnlyPropertyName = "read-only"
+
+// ErrCollectionNotFrozen 目录未被设为只读
+var ErrCollectionNotFrozen = errors.New("collection is not read-only")
+
+// FrozenCollection 只读目录信息
+type FrozenCollection struct {
+	Path     string    `json:"path"`
+	FrozenAt time.Time `json:"frozen_at"`
+}
+
+// normalizeCollectionPath 统一目录路径格式（以/开头，不带结尾/）
+func normalizeCollectionPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// FreezeCollection 将目录标记为只读，已经只读的目录保持原有的冻结时间
+func (s *PropertyService) FreezeCollection(ctx context.Context, userID, collectionPath string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	collectionPath = normalizeCollectionPath(collectionPath)
+	existing, err := s.GetProperty(ctx, userID, collectionPath, NamespaceMetadata, ReadOnlyPropertyName)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	// 标记为活属性，防止通过PROPPATCH移除
+	err = s.CreateProperty(ctx, &DatabaseProperty{
+		UserID:    userID,
+		Path:      collectionPath,
+		Namespace: NamespaceMetadata,
+		Name:      ReadOnlyPropertyName,
+		Value:     time.Now().UTC().Format(time.RFC3339),
+		IsLive:    true,
+	})
+	if errors.Is(err, ErrPropertyExists) {
+		return nil // 并发冻结，保留先写入的冻结时间
+	}
+	return err
+}
+
+// UnfreezeCollection 解除目录的只读标记
+func (s *PropertyService) UnfreezeCollection(ctx context.Context, userID, collectionPath string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+
+	collectionPath = normalizeCollectionPath(collectionPath)
+	existing, err := s.GetProperty(ctx, userID, collectionPath, NamespaceMetadata, ReadOnlyPropertyName)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrCollectionNotFrozen
+	}
+
+	return s.DeleteProperty(ctx, userID, collectionPath, NamespaceMetadata, ReadOnlyPropertyName)
+}
+
+// FrozenAncestor 返回覆盖该路径的最近的只读目录（包括路径自身），未冻结时返回空字符串。
+// 路径自身和所有上级目录在一次查询中检查
+func (s *PropertyService) FrozenAncestor(ctx context.Context, userID, resourcePath string) (string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return "", err
+	}
+
+	current := normalizeCollectionPath(resourcePath)
+	args := []interface{}{userID, NamespaceMetadata, ReadOnlyPropertyName, current}
+	for current != "/" {
+		current = path.Dir(current)
+		args = append(args, current)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)-3), ", ")
+
+	builder := NewSelectBuilder("properties", "path").
+		Where("user_id = ? AND namespace = ? AND name = ? AND path IN ("+placeholders+")", args...).
+		OrderBy("LENGTH(path) DESC").
+		Limit(1)
+
+	var frozenPath string
+	err := builder.QueryRowWith(ctx, s.stmts).Scan(&frozenPath)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return frozenPath, err
+}
+
+// FrozenDescendant 返回路径下任意一个只读子目录，不存在时返回空字符串
+func (s *PropertyService) FrozenDescendant(ctx context.Context, userID, collectionPath string) (string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return "", err
+	}
+
+	prefix := normalizeCollectionPath(collectionPath)
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	builder := NewSelectBuilder("properties", "path").
+		Where("user_id = ? AND namespace = ? AND name = ? AND path LIKE ? ESCAPE '\\'", userID, NamespaceMetadata, ReadOnlyPropertyName, escapeLikePattern(prefix)+"%").
+		Limit(1)
+
+	var frozenPath string
+	err := builder.QueryRowWith(ctx, s.stmts).Scan(&frozenPath)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return frozenPath, err
+}
+
+// ListFrozenCollections 列出用户的所有只读目录
+func (s *PropertyService) ListFrozenCollections(ctx context.Context, userID string) ([]FrozenCollection, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	builder := NewSelectBuilder("properties", propertyColumns...).
+		Where("user_id = ? AND namespace = ? AND name = ?", userID, NamespaceMetadata, ReadOnlyPropertyName).
+		OrderBy("path")
+
+	rows, err := builder.QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询只读目录失败: %v", err)
+	}
+	defer rows.Close()
+
+	props, err := s.scanProperties(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]FrozenCollection, 0, len(props))
+	for _, prop := range props {
+		collections = append(collections, FrozenCollection{
+			Path:     prop.Path,
+			FrozenAt: time.Unix(prop.CreatedAt, 0).UTC(),
+		})
+	}
+	return collections, nil
+}
+
+// CheckReadOnly 检查路径是否位于只读目录下，是则发送403错误
+func (h *Handler) CheckReadOnly(c *gin.Context, resourcePath string) bool {
+	frozenPath, err := h.propertyService.FrozenAncestor(c.Request.Context(), c.GetString("userID"), resourcePath)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return true
+	}
+	if frozenPath == "" {
+		return false
+	}
+
+	h.sendReadOnlyError(c, frozenPath)
+	return true
+}
+
+// CheckReadOnlyTree 检查路径本身、上级及下级是否存在只读目录（用于DELETE/MOVE整个子树）
+func (h *Handler) CheckReadOnlyTree(c *gin.Context, resourcePath string) bool {
+	if h.CheckReadOnly(c, resourcePath) {
+		return true
+	}
+
+	frozenPath, err := h.propertyService.FrozenDescendant(c.Request.Context(), c.GetString("userID"), resourcePath)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return true
+	}
+	if frozenPath == "" {
+		return false
+	}
+
+	h.sendReadOnlyError(c, frozenPath)
+	return true
+}
+
+// sendReadOnlyError 发送403只读目录错误响应
+func (h *Handler) sendReadOnlyError(c *gin.Context, frozenPath string) {
+	writeDAVError(c, &DAVError{
+		Status:  http.StatusForbidden,
+		Href:    frozenPath,
+		Message: fmt.Sprintf("Collection %s is read-only; unfreeze it before making changes", frozenPath),
+	})
+}
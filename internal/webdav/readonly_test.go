@@ -0,0 +1,118 @@
+package webdav
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// newTestPropertyService 创建临时SQLite数据库上的属性服务
+func newTestPropertyService(t *testing.T) *PropertyService {
+	t.Helper()
+	service, err := NewPropertyService(filepath.Join(t.TempDir(), "properties.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	if err := service.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestFreezeCollection(t *testing.T) {
+	service := newTestPropertyService(t)
+	ctx := context.Background()
+
+	if err := service.FreezeCollection(ctx, "user1", "/projects/report/"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := service.ListFrozenCollections(ctx, "user1")
+	if err != nil || len(first) != 1 || first[0].Path != "/projects/report" {
+		t.Fatalf("ListFrozenCollections = %v, %v", first, err)
+	}
+
+	// 重复冻结成功，冻结时间不变
+	if err := service.FreezeCollection(ctx, "user1", "/projects/report"); err != nil {
+		t.Fatalf("re-freeze: %v", err)
+	}
+	again, err := service.ListFrozenCollections(ctx, "user1")
+	if err != nil || len(again) != 1 || !again[0].FrozenAt.Equal(first[0].FrozenAt) {
+		t.Fatalf("after re-freeze = %v, %v", again, err)
+	}
+
+	if err := service.UnfreezeCollection(ctx, "user1", "/projects/report"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.UnfreezeCollection(ctx, "user1", "/projects/report"); err != ErrCollectionNotFrozen {
+		t.Errorf("second unfreeze = %v, want ErrCollectionNotFrozen", err)
+	}
+}
+
+func TestFrozenAncestor(t *testing.T) {
+	service := newTestPropertyService(t)
+	ctx := context.Background()
+
+	for _, p := range []string{"/a", "/a/b/c"} {
+		if err := service.FreezeCollection(ctx, "user1", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/a", "/a"},
+		{"/a/file.txt", "/a"},
+		{"/a/b", "/a"},
+		{"/a/b/c/d/e.txt", "/a/b/c"},
+		{"/ab/file.txt", ""},
+		{"/", ""},
+		{"/other/x", ""},
+	}
+	for _, tt := range tests {
+		got, err := service.FrozenAncestor(ctx, "user1", tt.path)
+		if err != nil {
+			t.Fatalf("FrozenAncestor(%q): %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("FrozenAncestor(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if got, _ := service.FrozenAncestor(ctx, "user2", "/a/file.txt"); got != "" {
+		t.Errorf("other user's frozen folder applied: %q", got)
+	}
+}
+
+func TestFrozenDescendant(t *testing.T) {
+	service := newTestPropertyService(t)
+	ctx := context.Background()
+
+	if err := service.FreezeCollection(ctx, "user1", "/data_2024/archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/data_2024/archive"},
+		{"/data_2024", "/data_2024/archive"},
+		// LIKE通配符按字面匹配：_不匹配任意字符，%不匹配任意字符串
+		{"/dataX2024", ""},
+		{"/data%", ""},
+		{"/data_2024/archive", ""},
+		{"/data_2024/other", ""},
+	}
+	for _, tt := range tests {
+		got, err := service.FrozenDescendant(ctx, "user1", tt.path)
+		if err != nil {
+			t.Fatalf("FrozenDescendant(%q): %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("FrozenDescendant(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
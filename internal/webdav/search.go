@@ -0,0 +1,362 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/config"
+	"github.com/webdav-gateway/internal/contenttype"
+	"github.com/webdav-gateway/internal/storage"
+)
+
+const (
+	// DefaultSearchLimit 未指定数量时返回的结果数
+	DefaultSearchLimit = 100
+	// defaultSearchMaxResults 未配置时单次搜索最多返回的结果数
+	defaultSearchMaxResults = 1000
+	// defaultSearchMaxScan 未配置时单次搜索最多检查的对象数
+	defaultSearchMaxScan = 100000
+)
+
+// ErrInvalidSearch 搜索条件无效
+var ErrInvalidSearch = errors.New("invalid search query")
+
+// PropertyFilter 按自定义属性值过滤
+type PropertyFilter struct {
+	// Namespace 为空时匹配任意命名空间
+	Namespace string
+	Name      string
+	Value     string
+	// Contains 为true时按包含（不区分大小写）匹配，否则精确匹配
+	Contains bool
+}
+
+// MediaFilter 按提取的媒体元数据过滤，只命中已提取元数据的文件
+type MediaFilter struct {
+	// TakenAfter、TakenBefore 拍摄时间范围[TakenAfter, TakenBefore)
+	TakenAfter  time.Time
+	TakenBefore time.Time
+	MinWidth    int
+	MinHeight   int
+	// HasLocation 为true时只命中记录了拍摄地点的照片
+	HasLocation bool
+}
+
+// IsZero 判断是否没有任何媒体条件
+func (f MediaFilter) IsZero() bool {
+	return f == MediaFilter{}
+}
+
+// MediaIndex 按媒体元数据查找文件，返回满足条件的稳定文件ID
+type MediaIndex interface {
+	MatchFileIDs(ctx context.Context, userID uuid.UUID, filter MediaFilter) (map[string]bool, error)
+}
+
+// SearchQuery 文件搜索条件，REST接口和WebDAV SEARCH共用，各条件之间为AND关系
+type SearchQuery struct {
+	// Scope 搜索范围目录，默认为根目录
+	Scope string
+	// Recursive 是否搜索子目录
+	Recursive bool
+	// NameGlob 文件名glob（如*.pdf），不区分大小写
+	NameGlob string
+	// Text 文件名或任一自定义属性值包含的文本，不区分大小写
+	Text string
+	// ContentType 精确匹配，以/结尾或/*结尾时按前缀匹配（如image/）
+	ContentType    string
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Properties     []PropertyFilter
+	Media          MediaFilter
+	Limit          int
+}
+
+// SearchResult 单个搜索结果
+type SearchResult struct {
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+	FileID       string    `json:"file_id,omitempty"`
+}
+
+// SearchResults 搜索结果；达到数量上限或扫描上限时Truncated为true
+type SearchResults struct {
+	Results   []SearchResult `json:"results"`
+	Truncated bool           `json:"truncated"`
+	Scanned   int            `json:"scanned"`
+}
+
+// Searcher 遍历对象列表并结合属性库执行搜索。内容不建立全文索引，
+// 文本只匹配文件名和自定义属性值
+type Searcher struct {
+	storage    *storage.Service
+	properties *PropertyService
+	media      MediaIndex
+	maxResults int
+	maxScan    int
+}
+
+// NewSearcher 创建搜索服务
+func NewSearcher(storage *storage.Service, properties *PropertyService, cfg config.SearchConfig) *Searcher {
+	maxResults := cfg.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchMaxResults
+	}
+	maxScan := cfg.MaxScan
+	if maxScan <= 0 {
+		maxScan = defaultSearchMaxScan
+	}
+	return &Searcher{
+		storage:    storage,
+		properties: properties,
+		maxResults: maxResults,
+		maxScan:    maxScan,
+	}
+}
+
+// SetMediaIndex 启用按媒体元数据搜索
+func (s *Searcher) SetMediaIndex(index MediaIndex) {
+	s.media = index
+}
+
+// SetSearcher 启用WebDAV SEARCH方法
+func (h *Handler) SetSearcher(searcher *Searcher) {
+	h.searcher = searcher
+}
+
+// Search 执行搜索，结果按对象键顺序返回
+func (s *Searcher) Search(ctx context.Context, uid uuid.UUID, q SearchQuery) (*SearchResults, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	scope := q.Scope
+	if scope == "" {
+		scope = "/"
+	}
+
+	userID := uid.String()
+	propPaths, err := s.propertyPaths(ctx, userID, scope, q.Properties)
+	if err != nil {
+		return nil, err
+	}
+	results := &SearchResults{Results: []SearchResult{}}
+	if propPaths != nil && len(propPaths) == 0 {
+		return results, nil
+	}
+
+	var mediaIDs map[string]bool
+	if !q.Media.IsZero() {
+		if s.media == nil {
+			return nil, fmt.Errorf("%w: media metadata is not enabled", ErrInvalidSearch)
+		}
+		if mediaIDs, err = s.media.MatchFileIDs(ctx, uid, q.Media); err != nil {
+			return nil, err
+		}
+		if len(mediaIDs) == 0 {
+			return results, nil
+		}
+	}
+
+	var textPaths map[string]bool
+	if q.Text != "" {
+		props, err := s.properties.SearchProperties(ctx, userID, map[string]interface{}{
+			"value_pattern": q.Text,
+			"path_prefix":   scope,
+			"is_live":       false,
+		})
+		if err != nil {
+			return nil, err
+		}
+		textPaths = make(map[string]bool, len(props))
+		for _, prop := range props {
+			textPaths[trimPropertyPath(prop.Path)] = true
+		}
+	}
+
+	err = s.storage.WalkObjects(ctx, uid, scope, q.Recursive, func(obj minio.ObjectInfo) error {
+		if results.Scanned >= s.maxScan {
+			results.Truncated = true
+			return storage.ErrStopWalk
+		}
+		results.Scanned++
+
+		objPath := "/" + strings.TrimSuffix(obj.Key, "/")
+		if propPaths != nil && !propPaths[objPath] {
+			return nil
+		}
+		if mediaIDs != nil && !mediaIDs[storage.FileID(obj)] {
+			return nil
+		}
+		if !q.matches(obj, objPath, textPaths) {
+			return nil
+		}
+
+		if len(results.Results) >= limit {
+			results.Truncated = true
+			return storage.ErrStopWalk
+		}
+		results.Results = append(results.Results, newSearchResult(obj, objPath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// propertyPaths 返回满足全部属性条件的资源路径（去掉结尾/），没有属性条件时返回nil
+func (s *Searcher) propertyPaths(ctx context.Context, userID, scope string, filters []PropertyFilter) (map[string]bool, error) {
+	var paths map[string]bool
+	for _, filter := range filters {
+		conditions := map[string]interface{}{
+			"name":        filter.Name,
+			"namespace":   filter.Namespace,
+			"path_prefix": scope,
+			"is_live":     false,
+		}
+		if filter.Contains {
+			conditions["value_pattern"] = filter.Value
+		} else {
+			conditions["value"] = filter.Value
+		}
+
+		props, err := s.properties.SearchProperties(ctx, userID, conditions)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := make(map[string]bool, len(props))
+		for _, prop := range props {
+			p := trimPropertyPath(prop.Path)
+			if paths == nil || paths[p] {
+				matched[p] = true
+			}
+		}
+		paths = matched
+		if len(paths) == 0 {
+			break
+		}
+	}
+	return paths, nil
+}
+
+// validate 检查条件格式
+func (q SearchQuery) validate() error {
+	if q.NameGlob != "" {
+		if _, err := path.Match(strings.ToLower(q.NameGlob), ""); err != nil {
+			return fmt.Errorf("%w: bad name pattern %q", ErrInvalidSearch, q.NameGlob)
+		}
+	}
+	if q.MinSize != nil && q.MaxSize != nil && *q.MinSize > *q.MaxSize {
+		return fmt.Errorf("%w: min_size is greater than max_size", ErrInvalidSearch)
+	}
+	if media := q.Media; !media.TakenAfter.IsZero() && !media.TakenBefore.IsZero() && !media.TakenAfter.Before(media.TakenBefore) {
+		return fmt.Errorf("%w: taken_after must be before taken_before", ErrInvalidSearch)
+	}
+	if q.Media.MinWidth < 0 || q.Media.MinHeight < 0 {
+		return fmt.Errorf("%w: min_width and min_height must not be negative", ErrInvalidSearch)
+	}
+	for _, filter := range q.Properties {
+		if filter.Name == "" {
+			return fmt.Errorf("%w: property filter without name", ErrInvalidSearch)
+		}
+	}
+	return nil
+}
+
+// matches 判断对象是否满足除属性条件外的全部条件。
+// 指定了大小或类型条件时不返回目录
+func (q SearchQuery) matches(obj minio.ObjectInfo, objPath string, textPaths map[string]bool) bool {
+	isDir := strings.HasSuffix(obj.Key, "/")
+	name := strings.ToLower(path.Base(objPath))
+
+	if q.NameGlob != "" {
+		if ok, _ := path.Match(strings.ToLower(q.NameGlob), name); !ok {
+			return false
+		}
+	}
+	if q.Text != "" && !strings.Contains(name, strings.ToLower(q.Text)) && !textPaths[objPath] {
+		return false
+	}
+
+	if isDir && (q.ContentType != "" || q.MinSize != nil || q.MaxSize != nil) {
+		return false
+	}
+	if q.ContentType != "" && !matchContentType(q.ContentType, contenttype.Resolve(objPath, obj.ContentType)) {
+		return false
+	}
+	if q.MinSize != nil && obj.Size < *q.MinSize {
+		return false
+	}
+	if q.MaxSize != nil && obj.Size > *q.MaxSize {
+		return false
+	}
+
+	// 隐式目录（公共前缀）没有修改时间，指定时间条件时不会命中
+	if !q.ModifiedAfter.IsZero() && !obj.LastModified.After(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !obj.LastModified.Before(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// matchContentType 忽略参数和大小写比较MIME类型，pattern以/或/*结尾时按前缀匹配
+func matchContentType(pattern, contentType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if mediaType, _, ok := strings.Cut(contentType, ";"); ok {
+		contentType = mediaType
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(contentType, prefix)
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(contentType, pattern)
+	}
+	return contentType == pattern
+}
+
+// newSearchResult 将对象信息转换为搜索结果
+func newSearchResult(obj minio.ObjectInfo, objPath string) SearchResult {
+	result := SearchResult{
+		Path:         objPath,
+		Name:         path.Base(objPath),
+		IsDir:        strings.HasSuffix(obj.Key, "/"),
+		Size:         obj.Size,
+		ContentType:  contenttype.Resolve(objPath, obj.ContentType),
+		LastModified: obj.LastModified,
+		ETag:         storage.ContentETag(obj),
+		FileID:       storage.FileID(obj),
+	}
+	if result.IsDir {
+		result.Path += "/"
+		result.Size = 0
+		result.ContentType = ""
+	}
+	return result
+}
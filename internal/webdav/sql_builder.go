@@ -4,9 +4,120 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// Dialect SQL方言
+type Dialect string
+
+const (
+	// DialectSQLite SQLite方言，使用?占位符
+	DialectSQLite Dialect = "sqlite"
+	// DialectPostgres PostgreSQL方言，使用$1、$2...占位符
+	DialectPostgres Dialect = "postgres"
+)
+
+// Rebind 将?占位符转换为方言对应的格式，字符串字面量中的?保持不变
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+	return rebound.String()
+}
+
+// StmtCache 预编译语句缓存，按方言转换占位符后复用*sql.Stmt
+type StmtCache struct {
+	db      *sql.DB
+	dialect Dialect
+	mu      sync.Mutex
+	stmts   map[string]*sql.Stmt
+}
+
+// NewStmtCache 创建预编译语句缓存
+func NewStmtCache(db *sql.DB, dialect Dialect) *StmtCache {
+	return &StmtCache{
+		db:      db,
+		dialect: dialect,
+		stmts:   make(map[string]*sql.Stmt),
+	}
+}
+
+// Prepare 获取（必要时预编译）语句
+func (c *StmtCache) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, c.dialect.Rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Query 使用预编译语句执行查询
+func (c *StmtCache) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.Prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// QueryRow 使用预编译语句执行单行查询，预编译失败时错误由返回的Row报告
+func (c *StmtCache) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, err := c.Prepare(ctx, query)
+	if err != nil {
+		return c.db.QueryRowContext(ctx, c.dialect.Rebind(query), args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// Exec 使用预编译语句执行写操作
+func (c *StmtCache) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.Prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// Close 关闭所有缓存的语句
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.stmts, query)
+	}
+	return firstErr
+}
+
 // SQLBuilder SQL查询构建器
 type SQLBuilder struct {
 	table      string
@@ -160,6 +271,16 @@ func (b *SQLBuilder) ExecuteQuery(ctx context.Context, db *sql.DB) (*sql.Rows, e
 	return db.QueryContext(ctx, b.Build(), b.args...)
 }
 
+// QueryWith 通过预编译语句缓存执行查询
+func (b *SQLBuilder) QueryWith(ctx context.Context, c *StmtCache) (*sql.Rows, error) {
+	return c.Query(ctx, b.Build(), b.args...)
+}
+
+// QueryRowWith 通过预编译语句缓存执行单行查询
+func (b *SQLBuilder) QueryRowWith(ctx context.Context, c *StmtCache) *sql.Row {
+	return c.QueryRow(ctx, b.Build(), b.args...)
+}
+
 // ExecuteQueryRow 执行单行查询
 func (b *SQLBuilder) ExecuteQueryRow(ctx context.Context, db *sql.DB) *sql.Row {
 	return db.QueryRowContext(ctx, b.Build(), b.args...)
@@ -177,6 +298,7 @@ type InsertBuilder struct {
 	values     [][]interface{}
 	args       []interface{}
 	onConflict []string
+	returning  []string
 }
 
 // NewInsertBuilder 创建INSERT构建器
@@ -225,23 +347,42 @@ func (i *InsertBuilder) Build() string {
 			valuePlaceholders[j] = "?"
 		}
 		
-		for idx, values := range i.values {
+		// 参数已在Values中加入args，这里只生成占位符，重复Build不会重复追加参数
+		for idx := range i.values {
 			if idx > 0 {
 				query.WriteString(", ")
 			}
 			query.WriteString("(" + strings.Join(valuePlaceholders, ", ") + ")")
-			// 将值添加到args中
-			i.args = append(i.args, values...)
 		}
 	}
 	
 	if len(i.onConflict) > 0 {
 		query.WriteString(" ON CONFLICT (" + strings.Join(i.onConflict, ", ") + ") DO NOTHING")
 	}
+
+	if len(i.returning) > 0 {
+		query.WriteString(" RETURNING " + strings.Join(i.returning, ", "))
+	}
 	
 	return query.String()
 }
 
+// Returning 添加RETURNING子句（PostgreSQL获取自增ID）
+func (i *InsertBuilder) Returning(cols ...string) *InsertBuilder {
+	i.returning = append(i.returning, cols...)
+	return i
+}
+
+// ExecWith 通过预编译语句缓存执行INSERT
+func (i *InsertBuilder) ExecWith(ctx context.Context, c *StmtCache) (sql.Result, error) {
+	return c.Exec(ctx, i.Build(), i.args...)
+}
+
+// QueryRowWith 通过预编译语句缓存执行带RETURNING的INSERT
+func (i *InsertBuilder) QueryRowWith(ctx context.Context, c *StmtCache) *sql.Row {
+	return c.QueryRow(ctx, i.Build(), i.args...)
+}
+
 // Args 返回参数列表
 func (i *InsertBuilder) Args() []interface{} {
 	return i.args
@@ -256,6 +397,7 @@ func (i *InsertBuilder) Execute(ctx context.Context, db *sql.DB) (sql.Result, er
 type UpdateBuilder struct {
 	table      string
 	sets       map[string]interface{}
+	setCols    []string
 	conditions []string
 	args       []interface{}
 	orderBy    []string
@@ -273,8 +415,11 @@ func NewUpdateBuilder(table string) *UpdateBuilder {
 	}
 }
 
-// Set 设置更新列
+// Set 设置更新列，col为列名，不含"= ?"
 func (u *UpdateBuilder) Set(col string, val interface{}) *UpdateBuilder {
+	if _, exists := u.sets[col]; !exists {
+		u.setCols = append(u.setCols, col)
+	}
 	u.sets[col] = val
 	u.args = append(u.args, val)
 	return u
@@ -307,8 +452,9 @@ func (u *UpdateBuilder) Build() string {
 	
 	// SET子句
 	if len(u.sets) > 0 {
-		sets := make([]string, 0, len(u.sets))
-		for col := range u.sets {
+		// 按Set调用顺序输出，与args顺序保持一致
+		sets := make([]string, 0, len(u.setCols))
+		for _, col := range u.setCols {
 			sets = append(sets, col+"=?")
 		}
 		query.WriteString(" SET " + strings.Join(sets, ", "))
@@ -342,6 +488,11 @@ func (u *UpdateBuilder) Execute(ctx context.Context, db *sql.DB) (sql.Result, er
 	return db.ExecContext(ctx, u.Build(), u.args...)
 }
 
+// ExecWith 通过预编译语句缓存执行UPDATE
+func (u *UpdateBuilder) ExecWith(ctx context.Context, c *StmtCache) (sql.Result, error) {
+	return c.Exec(ctx, u.Build(), u.args...)
+}
+
 // NewDeleteBuilder 创建新的DELETE查询构建器
 type DeleteBuilder struct {
 	table      string
@@ -409,6 +560,11 @@ func (d *DeleteBuilder) Execute(ctx context.Context, db *sql.DB) (sql.Result, er
 	return db.ExecContext(ctx, d.Build(), d.args...)
 }
 
+// ExecWith 通过预编译语句缓存执行DELETE
+func (d *DeleteBuilder) ExecWith(ctx context.Context, c *StmtCache) (sql.Result, error) {
+	return c.Exec(ctx, d.Build(), d.args...)
+}
+
 // Args 返回参数列表
 func (d *DeleteBuilder) Args() []interface{} {
 	return d.args
@@ -0,0 +1,49 @@
+package webdav
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestUpdateBuilderSetOrder SET子句按Set调用顺序输出，与参数一一对应
+func TestUpdateBuilderSetOrder(t *testing.T) {
+	builder := NewUpdateBuilder("properties").
+		Set("path", "/b").
+		Set("value", "v").
+		Set("is_live", false).
+		Set("updated_at", int64(42)).
+		Where("id = ?", 7)
+
+	expectedSQL := "UPDATE properties SET path=?, value=?, is_live=?, updated_at=? WHERE id = ?"
+	expectedArgs := []interface{}{"/b", "v", false, int64(42), 7}
+
+	// map遍历顺序随机，多次构建结果必须一致
+	for i := 0; i < 20; i++ {
+		if got := builder.Build(); got != expectedSQL {
+			t.Fatalf("Expected %s, got %s", expectedSQL, got)
+		}
+	}
+	if !reflect.DeepEqual(builder.Args(), expectedArgs) {
+		t.Errorf("Expected args %v, got %v", expectedArgs, builder.Args())
+	}
+}
+
+// TestInsertBuilderArgs 参数只在Values中加入一次，Build不追加参数
+func TestInsertBuilderArgs(t *testing.T) {
+	builder := NewInsertBuilder("properties").
+		Columns("user_id", "path").
+		Values("u1", "/a").
+		Values("u1", "/b").
+		OnConflict("user_id", "path")
+
+	expectedSQL := "INSERT INTO properties (user_id, path) VALUES (?, ?), (?, ?) ON CONFLICT (user_id, path) DO NOTHING"
+	expectedArgs := []interface{}{"u1", "/a", "u1", "/b"}
+
+	builder.Build()
+	if got := builder.Build(); got != expectedSQL {
+		t.Errorf("Expected %s, got %s", expectedSQL, got)
+	}
+	if !reflect.DeepEqual(builder.Args(), expectedArgs) {
+		t.Errorf("Expected args %v after Build, got %v", expectedArgs, builder.Args())
+	}
+}
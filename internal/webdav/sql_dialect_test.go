@@ -0,0 +1,98 @@
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestDialectRebind PostgreSQL使用$n占位符，字符串字面量中的?保持不变
+func TestDialectRebind(t *testing.T) {
+	builder := NewSelectBuilder("properties", "path").
+		Where("user_id = ? AND path LIKE ? ESCAPE '\\' AND name <> '?'", "u1", "/a/%")
+
+	sql := DialectPostgres.Rebind(builder.Build())
+	expectedSQL := "SELECT path FROM properties WHERE user_id = $1 AND path LIKE $2 ESCAPE '\\' AND name <> '?'"
+	if sql != expectedSQL {
+		t.Errorf("Expected %s, got %s", expectedSQL, sql)
+	}
+
+	if got := DialectSQLite.Rebind(builder.Build()); got != builder.Build() {
+		t.Errorf("SQLite rebind should be a no-op, got %s", got)
+	}
+}
+
+// TestInsertBuilderReturning RETURNING子句位于ON CONFLICT之后
+func TestInsertBuilderReturning(t *testing.T) {
+	builder := NewInsertBuilder("properties").
+		Columns("user_id", "path").
+		Values("u1", "/a").
+		OnConflict("user_id", "path").
+		Returning("id")
+
+	sql := DialectPostgres.Rebind(builder.Build())
+	expectedSQL := "INSERT INTO properties (user_id, path) VALUES ($1, $2) ON CONFLICT (user_id, path) DO NOTHING RETURNING id"
+	if sql != expectedSQL {
+		t.Errorf("Expected %s, got %s", expectedSQL, sql)
+	}
+	if len(builder.Args()) != 2 {
+		t.Errorf("Expected 2 args after Build, got %d", len(builder.Args()))
+	}
+}
+
+// TestCreatePropertyConflict 同名属性已存在时ON CONFLICT DO NOTHING不插入，返回ErrPropertyExists而不是ID 0
+func TestCreatePropertyConflict(t *testing.T) {
+	service := newTestPropertyService(t)
+	ctx := context.Background()
+
+	first := &DatabaseProperty{UserID: "user1", Path: "/a.txt", Namespace: "urn:test", Name: "author", Value: "alice"}
+	if err := service.CreateProperty(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Fatal("created property has no ID")
+	}
+
+	second := &DatabaseProperty{UserID: "user1", Path: "/a.txt", Namespace: "urn:test", Name: "author", Value: "bob"}
+	if err := service.CreateProperty(ctx, second); !errors.Is(err, ErrPropertyExists) {
+		t.Fatalf("duplicate CreateProperty = %v, want ErrPropertyExists", err)
+	}
+	if got, _ := service.GetProperty(ctx, "user1", "/a.txt", "urn:test", "author"); got == nil || got.Value != "alice" {
+		t.Errorf("existing property overwritten: %+v", got)
+	}
+
+	// setProperty在冲突时更新原有属性
+	if err := service.setProperty(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := service.GetProperty(ctx, "user1", "/a.txt", "urn:test", "author"); got == nil || got.Value != "bob" {
+		t.Errorf("setProperty did not replace the value: %+v", got)
+	}
+}
+
+// TestSetACLReplaces 再次设置ACL替换原有的ACE，重复添加标签不报错
+func TestSetACLReplaces(t *testing.T) {
+	service := newTestPropertyService(t)
+	ctx := context.Background()
+
+	for _, principal := range []string{"alice", "bob"} {
+		if err := service.SetACL(ctx, "user1", "/shared", []ACE{{Principal: principal, Grant: []string{"read"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prop, err := service.GetProperty(ctx, "user1", "/shared", NamespaceMetadata, ACLPropertyName)
+	if err != nil || prop == nil {
+		t.Fatalf("ACL property = %v, %v", prop, err)
+	}
+	var aces []ACE
+	if err := json.Unmarshal([]byte(prop.Value), &aces); err != nil || len(aces) != 1 || aces[0].Principal != "bob" {
+		t.Errorf("ACL after replace = %s", prop.Value)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := service.TagResource(ctx, "user1", "/a.txt", "work"); err != nil {
+			t.Fatalf("TagResource #%d: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/webdav-gateway/internal/storage"
+	webdavtypes "github.com/webdav-gateway/internal/types"
+)
+
+// NamespaceTags 标签属性的命名空间：每个标签是该命名空间下以标签名为属性名的死属性，
+// PROPPATCH设置<t:urgent/>即添加标签urgent，移除该属性即去掉标签
+const NamespaceTags = "http://webdav-gateway.org/tags"
+
+// TagsBasePath 按标签浏览的虚拟集合，/.tags/<标签>/下只读列出带该标签的文件和目录
+const TagsBasePath = "/.tags"
+
+// tagsAllow 虚拟标签集合支持的方法
+const tagsAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+// maxTagLength 标签名的最大字符数
+const maxTagLength = 64
+
+// ValidTagName 判断标签名能否作为XML元素名：以字母或_开头，由字母、数字、-、_、.组成
+func ValidTagName(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return false
+	}
+	for i, r := range tag {
+		switch {
+		case unicode.IsLetter(r), r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// TagCount 一个标签及带该标签的资源数
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagResource 给资源添加标签
+func (s *PropertyService) TagResource(ctx context.Context, userID, resourcePath, tag string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+	err := s.CreateProperty(ctx, &DatabaseProperty{
+		UserID:    userID,
+		Path:      trimPropertyPath(resourcePath),
+		Namespace: NamespaceTags,
+		Name:      tag,
+	})
+	if errors.Is(err, ErrPropertyExists) {
+		return nil // 已有该标签
+	}
+	return err
+}
+
+// UntagResource 去掉资源的标签，属性可能以带或不带结尾/的路径保存
+func (s *PropertyService) UntagResource(ctx context.Context, userID, resourcePath, tag string) error {
+	if err := s.Initialize(ctx); err != nil {
+		return err
+	}
+	for _, p := range propertyPathForms(resourcePath) {
+		if err := s.DeleteProperty(ctx, userID, p, NamespaceTags, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags 列出用户使用的所有标签，按名称排序
+func (s *PropertyService) ListTags(ctx context.Context, userID string) ([]TagCount, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := NewSelectBuilder("properties", "name", "path").
+		Where("user_id = ? AND namespace = ?", userID, NamespaceTags).
+		QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询标签失败: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]bool)
+	for rows.Next() {
+		var name, p string
+		if err := rows.Scan(&name, &p); err != nil {
+			return nil, fmt.Errorf("查询标签失败: %v", err)
+		}
+		if counts[name] == nil {
+			counts[name] = make(map[string]bool)
+		}
+		if p = normalizeCollectionPath(p); p != "/" {
+			counts[name][p] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询标签失败: %v", err)
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for name, paths := range counts {
+		if len(paths) == 0 {
+			continue
+		}
+		tags = append(tags, TagCount{Name: name, Count: len(paths)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// ListTaggedPaths 列出带标签的资源路径（不带结尾/），按路径排序
+func (s *PropertyService) ListTaggedPaths(ctx context.Context, userID, tag string) ([]string, error) {
+	if err := s.Initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := NewSelectBuilder("properties", "path").
+		Where("user_id = ? AND namespace = ? AND name = ?", userID, NamespaceTags, tag).
+		OrderBy("path").
+		QueryWith(ctx, s.stmts)
+	if err != nil {
+		return nil, fmt.Errorf("查询标签失败: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("查询标签失败: %v", err)
+		}
+		// 根目录不能作为标签集合的成员
+		if p = normalizeCollectionPath(p); p != "/" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询标签失败: %v", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// tagMemberNames 为虚拟标签集合中的资源分配成员名：使用资源的文件名，
+// 不同目录下的同名资源按路径顺序在扩展名前加编号（report (2).pdf）。paths需已排序
+func tagMemberNames(paths []string) ([]string, map[string]string) {
+	names := make([]string, 0, len(paths))
+	members := make(map[string]string, len(paths))
+	for _, p := range paths {
+		base := path.Base(p)
+		name := base
+		for n := 2; members[name] != ""; n++ {
+			ext := path.Ext(base)
+			if ext == base {
+				ext = ""
+			}
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		members[name] = p
+		names = append(names, name)
+	}
+	return names, members
+}
+
+// splitTagPath 把/.tags下的路径拆分为标签、成员名和成员内的相对路径，不在/.tags下时ok为false
+func splitTagPath(requestPath string) (tag, member, rest string, ok bool) {
+	cleaned := path.Clean("/" + requestPath)
+	if cleaned != TagsBasePath && !strings.HasPrefix(cleaned, TagsBasePath+"/") {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(cleaned, TagsBasePath), "/"), "/", 3)
+	switch len(parts) {
+	case 3:
+		rest = parts[2]
+		fallthrough
+	case 2:
+		member = parts[1]
+		fallthrough
+	default:
+		tag = parts[0]
+	}
+	return tag, member, rest, true
+}
+
+// TagCollections 处理/.tags下的虚拟集合，其他路径交给后续处理函数。
+// 虚拟集合只读，写方法返回405；用户空间中真实的/.tags目录被虚拟集合遮蔽
+func (h *Handler) TagCollections(c *gin.Context) {
+	tag, member, rest, ok := splitTagPath(c.Param("path"))
+	if !ok {
+		c.Next()
+		return
+	}
+	c.Abort()
+
+	switch c.Request.Method {
+	case http.MethodOptions:
+		c.Header("DAV", "1")
+		c.Header("Allow", tagsAllow)
+		c.Status(http.StatusOK)
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+		h.serveTagCollection(c, tag, member, rest)
+	default:
+		c.Header("Allow", tagsAllow)
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveTagCollection 按请求的层级列出标签、标签下的成员，或把成员内的路径映射到实际资源
+func (h *Handler) serveTagCollection(c *gin.Context, tag, member, rest string) {
+	ctx := c.Request.Context()
+	userID := c.GetString("userID")
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	if tag == "" {
+		tags, err := h.propertyService.ListTags(ctx, userID)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		children := make([]string, 0, len(tags))
+		for _, t := range tags {
+			children = append(children, t.Name)
+		}
+		h.serveVirtualCollection(c, uid, TagsBasePath+"/", children, nil)
+		return
+	}
+
+	paths, err := h.propertyService.ListTaggedPaths(ctx, userID, tag)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	names, members := tagMemberNames(paths)
+	tagHref := TagsBasePath + "/" + tag + "/"
+	if member == "" {
+		if len(paths) == 0 {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		h.serveVirtualCollection(c, uid, tagHref, names, members)
+		return
+	}
+
+	target, ok := members[member]
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	h.serveTagMember(c, uid, path.Join(target, rest), tagHref+member+strings.TrimSuffix("/"+rest, "/"))
+}
+
+// serveVirtualCollection 虚拟集合没有内容，GET返回404；PROPFIND列出集合本身和（Depth不为0时）直接成员。
+// members为nil时成员是子集合（标签列表），否则按成员名映射到实际资源
+func (h *Handler) serveVirtualCollection(c *gin.Context, uid uuid.UUID, href string, children []string, members map[string]string) {
+	if c.Request.Method != "PROPFIND" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	depth, ok := h.propfindDepth(c)
+	if !ok {
+		return
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	if err := stream.Write(virtualCollectionResponse(href)); err != nil || depth == "0" {
+		return
+	}
+	if members == nil {
+		for _, name := range children {
+			if err := stream.Write(virtualCollectionResponse(href + name + "/")); err != nil {
+				return
+			}
+		}
+		return
+	}
+	for _, name := range children {
+		resp, ok := h.tagMemberResponse(c.Request.Context(), uid, members[name], href+name)
+		if !ok {
+			continue // 属性残留但资源已不存在
+		}
+		if err := stream.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// virtualCollectionResponse 虚拟集合的属性
+func virtualCollectionResponse(href string) Response {
+	return Response{
+		Href: href,
+		Propstat: []webdavtypes.Propstat{{
+			Prop: webdavtypes.ResponseProp{
+				DisplayName:  path.Base(strings.TrimSuffix(href, "/")),
+				ResourceType: &webdavtypes.ResourceType{Collection: &struct{}{}},
+			},
+			Status: "HTTP/1.1 200 OK",
+		}},
+	}
+}
+
+// tagMemberResponse 实际资源的属性，href改写为虚拟集合中的地址；资源不存在时ok为false
+func (h *Handler) tagMemberResponse(ctx context.Context, uid uuid.UUID, objectPath, href string) (Response, bool) {
+	resource, err := h.storage.StatResource(ctx, uid, objectPath)
+	if err != nil {
+		return Response{}, false
+	}
+	userID := uid.String()
+	var resp Response
+	if resource.IsCollection() {
+		modTime := time.Now()
+		if resource.Info != nil {
+			modTime = resource.Info.LastModified
+		}
+		resp = h.createFolderResponse(resource.Path, modTime, userID, h.folderFileID(ctx, uid, resource.Path))
+		href = strings.TrimSuffix(href, "/") + "/"
+	} else {
+		info := resource.Info
+		resp = h.createFileResponse(resource.Path, info.Size, info.LastModified, info.ContentType, storage.ContentETag(*info), userID, storage.FileID(*info))
+	}
+	resp.Href = href
+	return resp, true
+}
+
+// serveTagMember 虚拟集合中的成员：GET、HEAD由Handler按实际路径处理，PROPFIND列出实际资源（及目录的直接成员），
+// href使用虚拟集合中的地址
+func (h *Handler) serveTagMember(c *gin.Context, uid uuid.UUID, objectPath, href string) {
+	if c.Request.Method != "PROPFIND" {
+		for i := range c.Params {
+			if c.Params[i].Key == "path" {
+				c.Params[i].Value = objectPath
+			}
+		}
+		if c.Request.Method == http.MethodHead {
+			h.HandleHead(c)
+		} else {
+			h.HandleGet(c)
+		}
+		return
+	}
+
+	depth, ok := h.propfindDepth(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	resp, ok := h.tagMemberResponse(ctx, uid, objectPath, href)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	stream, err := newMultistatusWriter(c.Writer)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+	if err := stream.Write(resp); err != nil || depth == "0" || !strings.HasSuffix(resp.Href, "/") {
+		return
+	}
+
+	// 虚拟集合中的目录只列出直接成员，Depth: infinity按1处理
+	userID := uid.String()
+	h.prefetchProperties(ctx, userID, objectPath)
+	limit := h.config.PropfindMaxChildren
+	children := 0
+	truncated := false
+	err = h.storage.WalkObjects(ctx, uid, objectPath, false, func(obj minio.ObjectInfo) error {
+		if limit > 0 && children >= limit {
+			truncated = true
+			return storage.ErrStopWalk
+		}
+		objPath := "/" + obj.Key
+		if h.hidesMacOSMetadata(objPath) {
+			return nil
+		}
+		children++
+		childHref := resp.Href + path.Base(strings.TrimSuffix(obj.Key, "/"))
+		if strings.HasSuffix(obj.Key, "/") {
+			child := h.createFolderResponse(objPath, obj.LastModified, userID, storage.FileID(obj))
+			child.Href = childHref + "/"
+			return stream.Write(child)
+		}
+		child := h.createFileResponse(objPath, obj.Size, obj.LastModified, obj.ContentType, storage.ContentETag(obj), userID, storage.FileID(obj))
+		child.Href = childHref
+		return stream.Write(child)
+	})
+	if err != nil {
+		log.Printf("Tag PROPFIND listing %s failed after %d members: %v", objectPath, children, err)
+		stream.Abort()
+		return
+	}
+	if truncated {
+		stream.WriteTruncated(resp.Href, limit)
+	}
+}
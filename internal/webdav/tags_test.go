@@ -0,0 +1,67 @@
+package webdav
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidTagName(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"urgent", true},
+		{"_draft", true},
+		{"q3-review.v2", true},
+		{"重要", true},
+		{"", false},
+		{"2024", false},
+		{"-draft", false},
+		{"with space", false},
+		{"a/b", false},
+		{"ns:tag", false},
+	}
+	for _, tt := range tests {
+		if got := ValidTagName(tt.tag); got != tt.want {
+			t.Errorf("ValidTagName(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestTagMemberNames(t *testing.T) {
+	paths := []string{"/a/report.pdf", "/b/report.pdf", "/c/Makefile", "/d/Makefile", "/docs"}
+	names, members := tagMemberNames(paths)
+
+	want := []string{"report.pdf", "report (2).pdf", "Makefile", "Makefile (2)", "docs"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %q, want %q", names, want)
+	}
+	for i, name := range want {
+		if members[name] != paths[i] {
+			t.Errorf("members[%q] = %q, want %q", name, members[name], paths[i])
+		}
+	}
+}
+
+func TestSplitTagPath(t *testing.T) {
+	tests := []struct {
+		path              string
+		tag, member, rest string
+		ok                bool
+	}{
+		{"/.tags", "", "", "", true},
+		{"/.tags/", "", "", "", true},
+		{"/.tags/urgent/", "urgent", "", "", true},
+		{"/.tags/urgent/report.pdf", "urgent", "report.pdf", "", true},
+		{"/.tags/urgent/docs/sub/a.txt", "urgent", "docs", "sub/a.txt", true},
+		{"/.tagsfoo", "", "", "", false},
+		{"/docs/.tags/urgent", "", "", "", false},
+	}
+	for _, tt := range tests {
+		tag, member, rest, ok := splitTagPath(tt.path)
+		if tag != tt.tag || member != tt.member || rest != tt.rest || ok != tt.ok {
+			t.Errorf("splitTagPath(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				tt.path, tag, member, rest, ok, tt.tag, tt.member, tt.rest, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CreationDatePropertyName 资源创建时间的活属性名，位于NamespaceMetadata命名空间，值为RFC 3339时间（UTC）。
+	// 新建文件时记录，覆盖写入时保留；没有记录的资源使用存储中的修改时间
+	CreationDatePropertyName = "creationdate"
+	// LastModifiedPropertyName 客户端设置的修改时间的活属性名，格式同上。
+	// 写入内容时清除（除非请求带X-OC-Mtime），PROPFIND、GET的Last-Modified和If-Modified-Since使用该时间
+	LastModifiedPropertyName = "lastmodified"
+)
+
+// ErrInvalidTimestamp 客户端设置的时间格式错误
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// parseClientTime 解析客户端设置的时间：Unix时间戳（Nextcloud、rclone的DAV:lastmodified和X-OC-Mtime）、
+// HTTP日期（Win32时间属性）或RFC 3339
+func parseClientTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return time.Time{}, ErrInvalidTimestamp
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, ErrInvalidTimestamp
+}
+
+// formatTimestamp 保存时间戳活属性时使用的格式
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// timestampTarget 返回PROPPATCH中设置文件时间的属性对应的活属性名。
+// DAV:lastmodified是Nextcloud兼容客户端使用的写法，Win32时间属性由Windows客户端写入
+func timestampTarget(namespace, name string) (string, bool) {
+	switch {
+	case namespace == NamespaceDAV && name == "lastmodified":
+		return LastModifiedPropertyName, true
+	case namespace == NamespaceMicrosoft && name == Win32LastModifiedTimeProperty:
+		return LastModifiedPropertyName, true
+	case namespace == NamespaceMicrosoft && name == Win32CreationTimeProperty:
+		return CreationDatePropertyName, true
+	}
+	return "", false
+}
+
+// storesAsDeadProperty DAV:lastmodified只作为修改时间保存，不另存死属性，避免PROPFIND返回过期的值
+func storesAsDeadProperty(namespace, name string) bool {
+	return !(namespace == NamespaceDAV && name == "lastmodified")
+}
+
+// applyTimestampProperties 把PROPPATCH中设置或删除文件时间的属性转换为对应活属性的写入和删除，
+// 返回实际保存的属性（值已通过processSetOperation检查）
+func applyTimestampProperties(userID, resourcePath string, sets, removes []*Property) ([]*Property, []*Property) {
+	storedSets := make([]*Property, 0, len(sets))
+	storedRemoves := make([]*Property, 0, len(removes))
+	for _, prop := range sets {
+		if storesAsDeadProperty(prop.Namespace, prop.Name) {
+			storedSets = append(storedSets, prop)
+		}
+		target, ok := timestampTarget(prop.Namespace, prop.Name)
+		if !ok {
+			continue
+		}
+		t, err := parseClientTime(prop.Value)
+		if err != nil {
+			continue
+		}
+		storedSets = append(storedSets, &Property{
+			UserID:    userID,
+			Path:      resourcePath,
+			Namespace: NamespaceMetadata,
+			Name:      target,
+			Value:     formatTimestamp(t),
+			IsLive:    true,
+		})
+	}
+	for _, prop := range removes {
+		if storesAsDeadProperty(prop.Namespace, prop.Name) {
+			storedRemoves = append(storedRemoves, prop)
+		}
+		// 删除修改时间属性后恢复为存储中的修改时间；创建时间由网关记录，不随Win32属性删除
+		if target, ok := timestampTarget(prop.Namespace, prop.Name); ok && target == LastModifiedPropertyName {
+			storedRemoves = append(storedRemoves, &Property{
+				UserID:    userID,
+				Path:      resourcePath,
+				Namespace: NamespaceMetadata,
+				Name:      target,
+			})
+		}
+	}
+	return storedSets, storedRemoves
+}
+
+// resourceTimes 按活属性返回资源的修改时间和创建时间，没有记录时使用存储中的修改时间
+func resourceTimes(liveProperties map[string]string, modTime time.Time) (time.Time, time.Time) {
+	modified, created := modTime, modTime
+	if t, err := time.Parse(time.RFC3339, liveProperties[LastModifiedPropertyName]); err == nil {
+		modified = t
+	}
+	if t, err := time.Parse(time.RFC3339, liveProperties[CreationDatePropertyName]); err == nil {
+		created = t
+	}
+	return modified, created
+}
+
+// modTime 返回GET、HEAD使用的修改时间，客户端设置过修改时间时以其为准
+func (h *Handler) modTime(userID, resourcePath string, stored time.Time) time.Time {
+	_, liveProperties := h.loadResourceProperties(userID, resourcePath)
+	modified, _ := resourceTimes(liveProperties, stored)
+	return modified
+}
+
+// SetUploadTimes 写入内容后更新资源的时间戳。created不为零时记录为创建时间（新建文件），
+// 为零时保留原有的创建时间；modified为客户端通过X-OC-Mtime提供的修改时间，为零时清除之前设置的修改时间
+func (s *PropertyService) SetUploadTimes(ctx context.Context, userID, path string, created, modified time.Time) error {
+	values := map[string]string{LastModifiedPropertyName: ""}
+	if !modified.IsZero() {
+		values[LastModifiedPropertyName] = formatTimestamp(modified)
+	}
+	if !created.IsZero() {
+		values[CreationDatePropertyName] = formatTimestamp(created)
+	}
+	return s.setMetadataProperties(ctx, userID, path, values)
+}
+
+// uploadMtime 读取Nextcloud、ownCloud客户端和rclone上传时通过X-OC-Mtime提供的修改时间（Unix时间戳），
+// 接受时按Nextcloud的约定回复X-OC-MTime: accepted
+func uploadMtime(c *gin.Context) time.Time {
+	value := c.GetHeader("X-OC-Mtime")
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := parseClientTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	c.Header("X-OC-MTime", "accepted")
+	return t
+}
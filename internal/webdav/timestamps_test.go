@@ -0,0 +1,81 @@
+package webdav
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClientTime(t *testing.T) {
+	want := time.Date(2025, 10, 14, 8, 15, 2, 0, time.UTC)
+	for _, value := range []string{"1760429702", "Tue, 14 Oct 2025 08:15:02 GMT", "2025-10-14T10:15:02+02:00", " 1760429702 "} {
+		got, err := parseClientTime(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseClientTime(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "0", "-5", "yesterday"} {
+		if _, err := parseClientTime(value); err == nil {
+			t.Errorf("parseClientTime(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestApplyTimestampProperties(t *testing.T) {
+	sets := []*Property{
+		{Namespace: NamespaceDAV, Name: "lastmodified", Value: "1760429702"},
+		{Namespace: NamespaceMicrosoft, Name: Win32CreationTimeProperty, Value: "Mon, 01 Sep 2025 12:00:00 GMT"},
+		{Namespace: NamespaceCustom, Name: "color", Value: "blue"},
+	}
+	removes := []*Property{
+		{Namespace: NamespaceMicrosoft, Name: Win32LastModifiedTimeProperty},
+		{Namespace: NamespaceMicrosoft, Name: Win32CreationTimeProperty},
+	}
+	storedSets, storedRemoves := applyTimestampProperties("u1", "/a.txt", sets, removes)
+
+	got := make(map[string]string)
+	for _, prop := range storedSets {
+		got[prop.Namespace+" "+prop.Name] = prop.Value
+		if prop.Namespace == NamespaceMetadata && !prop.IsLive {
+			t.Errorf("%s saved as a dead property", prop.Name)
+		}
+	}
+	want := map[string]string{
+		NamespaceMetadata + " " + LastModifiedPropertyName:   "2025-10-14T08:15:02Z",
+		NamespaceMetadata + " " + CreationDatePropertyName:   "2025-09-01T12:00:00Z",
+		NamespaceMicrosoft + " " + Win32CreationTimeProperty: "Mon, 01 Sep 2025 12:00:00 GMT",
+		NamespaceCustom + " color":                           "blue",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("stored sets = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("stored %s = %q, want %q", key, got[key], value)
+		}
+	}
+
+	// 删除Win32修改时间同时清除修改时间，创建时间保留
+	var removed []string
+	for _, prop := range storedRemoves {
+		removed = append(removed, prop.Namespace+" "+prop.Name)
+	}
+	if len(removed) != 3 || removed[1] != NamespaceMetadata+" "+LastModifiedPropertyName {
+		t.Errorf("stored removes = %v", removed)
+	}
+}
+
+func TestResourceTimes(t *testing.T) {
+	stored := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified, created := resourceTimes(nil, stored)
+	if !modified.Equal(stored) || !created.Equal(stored) {
+		t.Errorf("without live properties = %v, %v; want the stored time", modified, created)
+	}
+
+	modified, created = resourceTimes(map[string]string{
+		LastModifiedPropertyName: "2024-01-01T10:00:00Z",
+		CreationDatePropertyName: "2023-06-01T08:00:00Z",
+	}, stored)
+	if modified.Year() != 2024 || created.Year() != 2023 {
+		t.Errorf("with live properties = %v, %v", modified, created)
+	}
+}
@@ -0,0 +1,93 @@
+package validators
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// windowsReservedNames Windows保留的设备名，带扩展名（如CON.txt）同样不可用
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// FilenameError 路径不符合文件名规则
+type FilenameError struct {
+	// Name 不符合规则的路径部分，路径过长时为完整路径
+	Name    string
+	Message string
+}
+
+func (e *FilenameError) Error() string {
+	return e.Message
+}
+
+// FilenamePolicy 文件名规则，保证经网关创建的文件能同步到Windows客户端
+type FilenamePolicy struct {
+	config config.FilenamePolicyConfig
+}
+
+// NewFilenamePolicy 创建文件名规则，未开启时Validate总是返回nil
+func NewFilenamePolicy(cfg config.FilenamePolicyConfig) *FilenamePolicy {
+	return &FilenamePolicy{config: cfg}
+}
+
+// Validate 检查路径的每一级名称和总长度，长度按字符计算
+func (p *FilenamePolicy) Validate(resourcePath string) error {
+	if p == nil || !p.config.Enabled {
+		return nil
+	}
+
+	trimmed := strings.Trim(resourcePath, "/")
+	if trimmed == "" {
+		return nil
+	}
+	if p.config.MaxPathLength > 0 && utf8.RuneCountInString(trimmed) > p.config.MaxPathLength {
+		return &FilenameError{
+			Name:    resourcePath,
+			Message: fmt.Sprintf("path exceeds the maximum length of %d characters", p.config.MaxPathLength),
+		}
+	}
+	for _, name := range strings.Split(trimmed, "/") {
+		if err := p.validateName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *FilenamePolicy) validateName(name string) error {
+	if p.config.MaxComponentLength > 0 && utf8.RuneCountInString(name) > p.config.MaxComponentLength {
+		return &FilenameError{
+			Name:    name,
+			Message: fmt.Sprintf("name %q exceeds the maximum length of %d characters", name, p.config.MaxComponentLength),
+		}
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return &FilenameError{Name: name, Message: fmt.Sprintf("name %q contains a control character", name)}
+		}
+		if strings.ContainsRune(p.config.BannedCharacters, r) {
+			return &FilenameError{Name: name, Message: fmt.Sprintf("name %q contains the character %q, which is not allowed", name, r)}
+		}
+	}
+	if p.config.ReservedNames {
+		base := name
+		if i := strings.IndexByte(base, '.'); i >= 0 {
+			base = base[:i]
+		}
+		if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return &FilenameError{Name: name, Message: fmt.Sprintf("name %q is reserved on Windows", name)}
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return &FilenameError{Name: name, Message: fmt.Sprintf("name %q must not end with a dot or space", name)}
+		}
+	}
+	return nil
+}
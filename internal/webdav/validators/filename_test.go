@@ -0,0 +1,56 @@
+package validators
+
+import (
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestFilenamePolicy_Validate(t *testing.T) {
+	policy := NewFilenamePolicy(config.FilenamePolicyConfig{
+		Enabled:            true,
+		ReservedNames:      true,
+		MaxComponentLength: 10,
+		MaxPathLength:      20,
+		BannedCharacters:   `\:*?"<>|`,
+	})
+
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"/docs/report.txt", true},
+		{"/docs/", true},
+		{"/文档/报告.txt", true},
+		{"/docs/CON", false},
+		{"/docs/con.txt", false},
+		{"/nul/a.txt", false},
+		{"/docs/CONSOLE", true},
+		{"/docs/COM10", true},
+		{"/docs/a:b.txt", false},
+		{"/docs/a?.txt", false},
+		{"/docs/tab\there", false},
+		{"/docs/trailing.", false},
+		{"/docs/trailing ", false},
+		{"/docs/verylongname.txt", false},
+		{"/aaaaaaaaa/bbbbbbbbb/c", false},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.path)
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", tt.path, err, tt.valid)
+		}
+		if err != nil {
+			if _, ok := err.(*FilenameError); !ok {
+				t.Errorf("Validate(%q) returned %T, want *FilenameError", tt.path, err)
+			}
+		}
+	}
+}
+
+func TestFilenamePolicy_Disabled(t *testing.T) {
+	policy := NewFilenamePolicy(config.FilenamePolicyConfig{ReservedNames: true})
+	if err := policy.Validate("/CON"); err != nil {
+		t.Errorf("disabled policy rejected path: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package validators
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+// ConditionCannotModifyProtectedProperty 写入或删除受保护属性时D:error中的前置条件（RFC 4918 16）
+const ConditionCannotModifyProtectedProperty = "cannot-modify-protected-property"
+
+// protectedDAVProperties 由服务端计算或只能通过专门方法修改的DAV:属性。
+// displayname和getcontentlanguage按RFC 4918允许客户端写入
+var protectedDAVProperties = map[string]bool{
+	"creationdate":     true,
+	"getcontentlength": true,
+	"getcontenttype":   true,
+	"getetag":          true,
+	"getlastmodified":  true,
+	"lockdiscovery":    true,
+	"resourcetype":     true,
+	"source":           true,
+	"supportedlock":    true,
+	// 访问控制属性只能通过ACL方法修改（RFC 3744 5）
+	"owner":                      true,
+	"acl":                        true,
+	"current-user-privilege-set": true,
+	"supported-privilege-set":    true,
+	"acl-restrictions":           true,
+	// 配额属性由用量计算（RFC 4331）
+	"quota-available-bytes": true,
+	"quota-used-bytes":      true,
+}
+
+// PropertyPolicyError 属性操作不符合属性规则
+type PropertyPolicyError struct {
+	// Status 403：受保护或保留的属性；409：值不符合命名空间规则；507：超出属性数上限
+	Status int
+	// Condition D:error中的前置条件元素名，为空时不输出
+	Condition string
+	Message   string
+}
+
+func (e *PropertyPolicyError) Error() string {
+	return e.Message
+}
+
+// namespaceRule 编译后的命名空间写入规则
+type namespaceRule struct {
+	readOnly       bool
+	allowedNames   map[string]bool
+	maxValueLength int
+	pattern        *regexp.Regexp
+}
+
+// PropertyPolicy PROPPATCH属性规则：受保护的DAV:属性、保留命名空间、按命名空间的写入规则和每个资源的属性数上限
+type PropertyPolicy struct {
+	reserved       map[string]bool
+	rules          map[string]*namespaceRule
+	maxProperties  int
+	maxValueLength int
+}
+
+// NewPropertyPolicy 创建属性规则，值的正则表达式无法编译时返回错误
+func NewPropertyPolicy(cfg config.PropertyPolicyConfig) (*PropertyPolicy, error) {
+	p := &PropertyPolicy{
+		reserved:       make(map[string]bool),
+		rules:          make(map[string]*namespaceRule),
+		maxProperties:  cfg.MaxPropertiesPerResource,
+		maxValueLength: cfg.MaxValueLength,
+	}
+	for _, namespace := range cfg.ReservedNamespaces {
+		p.reserved[namespace] = true
+	}
+	for _, rc := range cfg.Namespaces {
+		rule := &namespaceRule{readOnly: rc.ReadOnly, maxValueLength: rc.MaxValueLength}
+		if len(rc.AllowedNames) > 0 {
+			rule.allowedNames = make(map[string]bool, len(rc.AllowedNames))
+			for _, name := range rc.AllowedNames {
+				rule.allowedNames[name] = true
+			}
+		}
+		if rc.ValuePattern != "" {
+			pattern, err := regexp.Compile(`^(?:` + rc.ValuePattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("namespace %q: invalid value pattern: %w", rc.Namespace, err)
+			}
+			rule.pattern = pattern
+		}
+		p.rules[rc.Namespace] = rule
+	}
+	return p, nil
+}
+
+// Reserve 保留命名空间，用于网关内部维护的属性
+func (p *PropertyPolicy) Reserve(namespace string) {
+	p.reserved[namespace] = true
+}
+
+// protected 判断属性是否受保护，返回403错误
+func (p *PropertyPolicy) protected(namespace, name string) *PropertyPolicyError {
+	if namespace == "DAV:" && protectedDAVProperties[name] {
+		return &PropertyPolicyError{
+			Status:    http.StatusForbidden,
+			Condition: ConditionCannotModifyProtectedProperty,
+			Message:   fmt.Sprintf("DAV:%s is maintained by the server", name),
+		}
+	}
+	if p.reserved[namespace] {
+		return &PropertyPolicyError{
+			Status:    http.StatusForbidden,
+			Condition: ConditionCannotModifyProtectedProperty,
+			Message:   fmt.Sprintf("namespace %s is reserved", namespace),
+		}
+	}
+	if rule := p.rules[namespace]; rule != nil && rule.readOnly {
+		return &PropertyPolicyError{
+			Status:    http.StatusForbidden,
+			Condition: ConditionCannotModifyProtectedProperty,
+			Message:   fmt.Sprintf("namespace %s is read-only", namespace),
+		}
+	}
+	return nil
+}
+
+// CheckSet 检查属性是否可以写入为value
+func (p *PropertyPolicy) CheckSet(namespace, name, value string) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.protected(namespace, name); err != nil {
+		return err
+	}
+
+	maxValueLength := p.maxValueLength
+	rule := p.rules[namespace]
+	if rule != nil {
+		if rule.allowedNames != nil && !rule.allowedNames[name] {
+			return &PropertyPolicyError{
+				Status:    http.StatusForbidden,
+				Condition: ConditionCannotModifyProtectedProperty,
+				Message:   fmt.Sprintf("property %s is not allowed in namespace %s", name, namespace),
+			}
+		}
+		if rule.maxValueLength > 0 {
+			maxValueLength = rule.maxValueLength
+		}
+	}
+	if maxValueLength > 0 && len(value) > maxValueLength {
+		return &PropertyPolicyError{
+			Status:  http.StatusConflict,
+			Message: fmt.Sprintf("value exceeds the maximum length of %d bytes", maxValueLength),
+		}
+	}
+	if rule != nil && rule.pattern != nil && !rule.pattern.MatchString(value) {
+		return &PropertyPolicyError{
+			Status:  http.StatusConflict,
+			Message: fmt.Sprintf("value does not match the format required for namespace %s", namespace),
+		}
+	}
+	return nil
+}
+
+// CheckRemove 检查属性是否可以删除
+func (p *PropertyPolicy) CheckRemove(namespace, name string) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.protected(namespace, name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckCount 检查操作完成后资源的自定义属性数是否超出上限
+func (p *PropertyPolicy) CheckCount(count int) error {
+	if p == nil || p.maxProperties <= 0 || count <= p.maxProperties {
+		return nil
+	}
+	return &PropertyPolicyError{
+		Status:  http.StatusInsufficientStorage,
+		Message: fmt.Sprintf("a resource may have at most %d properties", p.maxProperties),
+	}
+}
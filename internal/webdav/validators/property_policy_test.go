@@ -0,0 +1,93 @@
+package validators
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/webdav-gateway/internal/config"
+)
+
+func TestPropertyPolicy_CheckSet(t *testing.T) {
+	policy, err := NewPropertyPolicy(config.PropertyPolicyConfig{
+		ReservedNamespaces: []string{"urn:reserved"},
+		MaxValueLength:     16,
+		Namespaces: []config.NamespacePolicyConfig{
+			{Namespace: "urn:readonly", ReadOnly: true},
+			{Namespace: "urn:tags", AllowedNames: []string{"color"}, ValuePattern: "red|green"},
+			{Namespace: "urn:notes", MaxValueLength: 32},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPropertyPolicy() = %v", err)
+	}
+	policy.Reserve("urn:internal")
+
+	tests := []struct {
+		namespace, name, value string
+		status                 int
+	}{
+		{"DAV:", "displayname", "Report", 0},
+		{"DAV:", "getetag", `"abc"`, http.StatusForbidden},
+		{"DAV:", "quota-used-bytes", "0", http.StatusForbidden},
+		{"urn:reserved", "anything", "x", http.StatusForbidden},
+		{"urn:internal", "anything", "x", http.StatusForbidden},
+		{"urn:readonly", "anything", "x", http.StatusForbidden},
+		{"urn:tags", "color", "red", 0},
+		{"urn:tags", "size", "red", http.StatusForbidden},
+		{"urn:tags", "color", "blue", http.StatusConflict},
+		{"urn:tags", "color", "reddish", http.StatusConflict},
+		{"urn:custom", "label", strings.Repeat("a", 16), 0},
+		{"urn:custom", "label", strings.Repeat("a", 17), http.StatusConflict},
+		{"urn:notes", "body", strings.Repeat("a", 32), 0},
+	}
+	for _, tt := range tests {
+		err := policy.CheckSet(tt.namespace, tt.name, tt.value)
+		if tt.status == 0 {
+			if err != nil {
+				t.Errorf("CheckSet(%s%s) = %v, want nil", tt.namespace, tt.name, err)
+			}
+			continue
+		}
+		policyErr, ok := err.(*PropertyPolicyError)
+		if !ok {
+			t.Errorf("CheckSet(%s%s) = %v, want *PropertyPolicyError", tt.namespace, tt.name, err)
+			continue
+		}
+		if policyErr.Status != tt.status {
+			t.Errorf("CheckSet(%s%s) status = %d, want %d", tt.namespace, tt.name, policyErr.Status, tt.status)
+		}
+		if tt.status == http.StatusForbidden && policyErr.Condition != ConditionCannotModifyProtectedProperty {
+			t.Errorf("CheckSet(%s%s) condition = %q", tt.namespace, tt.name, policyErr.Condition)
+		}
+	}
+}
+
+func TestPropertyPolicy_CheckRemoveAndCount(t *testing.T) {
+	policy, err := NewPropertyPolicy(config.PropertyPolicyConfig{MaxPropertiesPerResource: 2})
+	if err != nil {
+		t.Fatalf("NewPropertyPolicy() = %v", err)
+	}
+	if err := policy.CheckRemove("DAV:", "resourcetype"); err == nil {
+		t.Error("removing DAV:resourcetype was allowed")
+	}
+	if err := policy.CheckRemove("urn:custom", "label"); err != nil {
+		t.Errorf("CheckRemove() = %v, want nil", err)
+	}
+	if err := policy.CheckCount(2); err != nil {
+		t.Errorf("CheckCount(2) = %v, want nil", err)
+	}
+	if err, ok := policy.CheckCount(3).(*PropertyPolicyError); !ok || err.Status != http.StatusInsufficientStorage {
+		t.Errorf("CheckCount(3) = %v, want 507", err)
+	}
+
+	if _, err := NewPropertyPolicy(config.PropertyPolicyConfig{
+		Namespaces: []config.NamespacePolicyConfig{{Namespace: "urn:x", ValuePattern: "("}},
+	}); err == nil {
+		t.Error("invalid value pattern was accepted")
+	}
+	var nilPolicy *PropertyPolicy
+	if err := nilPolicy.CheckSet("DAV:", "getetag", ""); err != nil {
+		t.Errorf("nil policy rejected property: %v", err)
+	}
+}
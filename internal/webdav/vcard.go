@@ -0,0 +1,102 @@
+package webdav
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// supportedVCardVersions 通讯录接受的vCard版本
+var supportedVCardVersions = []string{"3.0", "4.0"}
+
+var (
+	// ErrInvalidAddressData 内容不是合法的vCard（CARDDAV:valid-address-data）
+	ErrInvalidAddressData = errors.New("invalid address data")
+	// ErrUnsupportedAddressData vCard版本不受支持（CARDDAV:supported-address-data）
+	ErrUnsupportedAddressData = errors.New("unsupported address data")
+)
+
+// AddressObject 解析后的通讯录对象（一张vCard），addressbook-query直接按其中的属性过滤
+type AddressObject struct {
+	UID     string
+	Version string
+	card    *icalComponent
+}
+
+// ParseAddressObject 校验并解析一个通讯录对象资源（RFC 6352 5.1）：
+// 必须是单个VCARD，VERSION为3.0或4.0，包含FN和UID。属性名上的分组前缀（如item1.EMAIL）被去掉
+func ParseAddressObject(data []byte) (*AddressObject, error) {
+	card, err := parseICalendar(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddressData, err)
+	}
+	if card.Name != "VCARD" {
+		return nil, fmt.Errorf("%w: expected VCARD", ErrInvalidAddressData)
+	}
+	if len(card.Children) > 0 {
+		return nil, fmt.Errorf("%w: nested components", ErrInvalidAddressData)
+	}
+	for i := range card.Properties {
+		if dot := strings.LastIndex(card.Properties[i].Name, "."); dot >= 0 {
+			card.Properties[i].Name = card.Properties[i].Name[dot+1:]
+		}
+	}
+
+	version := card.property("VERSION")
+	if version == nil {
+		return nil, fmt.Errorf("%w: missing VERSION", ErrInvalidAddressData)
+	}
+	supported := false
+	for _, v := range supportedVCardVersions {
+		supported = supported || strings.TrimSpace(version.Value) == v
+	}
+	if !supported {
+		return nil, fmt.Errorf("%w: vCard version %s", ErrUnsupportedAddressData, version.Value)
+	}
+	if fn := card.property("FN"); fn == nil {
+		return nil, fmt.Errorf("%w: missing FN", ErrInvalidAddressData)
+	}
+	uid := card.property("UID")
+	if uid == nil || strings.TrimSpace(uid.Value) == "" {
+		return nil, fmt.Errorf("%w: missing UID", ErrInvalidAddressData)
+	}
+
+	return &AddressObject{
+		UID:     strings.TrimSpace(uid.Value),
+		Version: strings.TrimSpace(version.Value),
+		card:    card,
+	}, nil
+}
+
+// properties 返回名为name（大写）的全部属性实例，如多个EMAIL
+func (a *AddressObject) properties(name string) []icalLine {
+	var lines []icalLine
+	for _, line := range a.card.Properties {
+		if line.Name == name {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// unescapeVCardText 还原文本值中的转义（\, \; \\ \n），用于文本匹配
+func unescapeVCardText(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+)
+
+func TestParseAddressObject(t *testing.T) {
+	data := icalData(
+		"BEGIN:VCARD",
+		"VERSION:4.0",
+		"UID:urn:uuid:contact-1",
+		"FN:Jane Doe",
+		"item1.EMAIL;TYPE=work:jane@example.com",
+		"item1.X-ABLabel:Office",
+		"TEL;TYPE=cell:+1 555 0100",
+		"END:VCARD",
+	)
+
+	obj, err := ParseAddressObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.UID != "urn:uuid:contact-1" || obj.Version != "4.0" {
+		t.Fatalf("object = %+v", obj)
+	}
+	emails := obj.properties("EMAIL")
+	if len(emails) != 1 || emails[0].Value != "jane@example.com" {
+		t.Errorf("EMAIL = %+v, want the grouped property without its prefix", emails)
+	}
+}
+
+func TestParseAddressObjectRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not vcard", []byte("hello world"), ErrInvalidAddressData},
+		{"calendar", icalData("BEGIN:VCALENDAR", "VERSION:2.0", "END:VCALENDAR"), ErrInvalidAddressData},
+		{"missing fn", icalData("BEGIN:VCARD", "VERSION:3.0", "UID:a", "END:VCARD"), ErrInvalidAddressData},
+		{"missing uid", icalData("BEGIN:VCARD", "VERSION:3.0", "FN:A", "END:VCARD"), ErrInvalidAddressData},
+		{"nested", icalData("BEGIN:VCARD", "VERSION:3.0", "UID:a", "FN:A", "BEGIN:VCARD", "END:VCARD", "END:VCARD"), ErrInvalidAddressData},
+		{"version 2.1", icalData("BEGIN:VCARD", "VERSION:2.1", "UID:a", "FN:A", "END:VCARD"), ErrUnsupportedAddressData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseAddressObject(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressbookQueryFilter(t *testing.T) {
+	contact, err := ParseAddressObject(icalData(
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"UID:a",
+		"FN:Jane Doe",
+		"EMAIL;TYPE=work:jane@example.com",
+		"NOTE:Met at the conference\\, Berlin",
+		"END:VCARD",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		want   bool
+	}{
+		{"no filter", ``, true},
+		{"contains is case-insensitive", `<C:prop-filter name="fn"><C:text-match>JANE</C:text-match></C:prop-filter>`, true},
+		{"octet is case-sensitive", `<C:prop-filter name="FN"><C:text-match collation="i;octet">JANE</C:text-match></C:prop-filter>`, false},
+		{"equals", `<C:prop-filter name="EMAIL"><C:text-match match-type="equals">jane@example.com</C:text-match></C:prop-filter>`, true},
+		{"starts-with", `<C:prop-filter name="FN"><C:text-match match-type="starts-with">Doe</C:text-match></C:prop-filter>`, false},
+		{"ends-with", `<C:prop-filter name="FN"><C:text-match match-type="ends-with">Doe</C:text-match></C:prop-filter>`, true},
+		{"negated", `<C:prop-filter name="FN"><C:text-match negate-condition="yes">John</C:text-match></C:prop-filter>`, true},
+		{"escaped text", `<C:prop-filter name="NOTE"><C:text-match>conference, Berlin</C:text-match></C:prop-filter>`, true},
+		{"param filter", `<C:prop-filter name="EMAIL"><C:param-filter name="type"><C:text-match match-type="equals">WORK</C:text-match></C:param-filter></C:prop-filter>`, true},
+		{"is-not-defined", `<C:prop-filter name="TEL"><C:is-not-defined/></C:prop-filter>`, true},
+		{"missing property", `<C:prop-filter name="TEL"><C:text-match>555</C:text-match></C:prop-filter>`, false},
+		{"anyof", `<C:prop-filter name="TEL"/><C:prop-filter name="FN"/>`, true},
+		{"allof", `<C:prop-filter name="TEL"/><C:prop-filter name="FN"/>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := "anyof"
+			if tt.name == "allof" {
+				test = "allof"
+			}
+			body := `<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><C:filter test="` + test + `">` + tt.filter + `</C:filter></C:addressbook-query>`
+			var req addressbookQueryRequest
+			if err := xml.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			if err := req.Filter.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Filter.matches(contact); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressbookQueryFilterRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   error
+	}{
+		{"unknown collation", `<C:prop-filter name="FN"><C:text-match collation="i;basic">a</C:text-match></C:prop-filter>`, ErrUnsupportedCollation},
+		{"unknown match type", `<C:prop-filter name="FN"><C:text-match match-type="regex">a</C:text-match></C:prop-filter>`, ErrInvalidAddressFilter},
+		{"missing name", `<C:prop-filter/>`, ErrInvalidAddressFilter},
+		{"is-not-defined with text-match", `<C:prop-filter name="FN"><C:is-not-defined/><C:text-match>a</C:text-match></C:prop-filter>`, ErrInvalidAddressFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `<C:addressbook-query xmlns:C="urn:ietf:params:xml:ns:carddav"><C:filter>` + tt.filter + `</C:filter></C:addressbook-query>`
+			var req addressbookQueryRequest
+			if err := xml.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			if err := req.Filter.validate(); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWriteGuardCheckWrite(t *testing.T) {
+	other := uuid.New().String()
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, h *Handler, uid uuid.UUID)
+		path  string
+		want  error
+	}{
+		{"new file", nil, "/docs/new.txt", nil},
+		{"overwrite", nil, "/file.txt", nil},
+		{"folder", nil, "/docs/sub", nil},
+		{"read-only folder", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			if err := h.propertyService.FreezeCollection(context.Background(), uid.String(), "/docs"); err != nil {
+				t.Fatal(err)
+			}
+		}, "/docs/sub/new.txt", ErrReadOnlyFolder},
+		{"locked by another user", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			if _, err := h.lockManager.CreateLock("/file.txt", LockTypeShared, other, 60, 0); err != nil {
+				t.Fatal(err)
+			}
+		}, "/file.txt", ErrResourceLocked},
+		{"own lock", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			if _, err := h.lockManager.CreateLock("/file.txt", LockTypeExclusive, uid.String(), 60, 0); err != nil {
+				t.Fatal(err)
+			}
+		}, "/file.txt", nil},
+		{"parent locked by another user", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			if _, err := h.lockManager.CreateLock("/docs", LockTypeExclusive, other, 60, -1); err != nil {
+				t.Fatal(err)
+			}
+		}, "/docs/new.txt", ErrResourceLocked},
+		{"write-content denied", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			aces := []ACE{{Principal: PrincipalOwner, Deny: []string{PrivilegeWriteContent}}}
+			if err := h.propertyService.SetACL(context.Background(), uid.String(), "/file.txt", aces); err != nil {
+				t.Fatal(err)
+			}
+		}, "/file.txt", ErrWriteForbidden},
+		{"bind denied", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			aces := []ACE{{Principal: PrincipalOwner, Deny: []string{PrivilegeBind}}}
+			if err := h.propertyService.SetACL(context.Background(), uid.String(), "/docs", aces); err != nil {
+				t.Fatal(err)
+			}
+		}, "/docs/new.txt", ErrWriteForbidden},
+		// 覆盖已有文件只需要write-content，不需要上级目录的bind
+		{"bind denied overwrite", func(t *testing.T, h *Handler, uid uuid.UUID) {
+			aces := []ACE{{Principal: PrincipalOwner, Deny: []string{PrivilegeBind}}}
+			if err := h.propertyService.SetACL(context.Background(), uid.String(), "/", aces); err != nil {
+				t.Fatal(err)
+			}
+		}, "/file.txt", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, uid := newMkcolHandler(t)
+			if tt.setup != nil {
+				tt.setup(t, h, uid)
+			}
+			err := h.WriteGuard().CheckWrite(context.Background(), uid, tt.path)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CheckWrite(%s) = %v, want %v", tt.path, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var (
+	// ErrBodyTooLarge 请求体超出大小上限（413）
+	ErrBodyTooLarge = errors.New("xml body exceeds the size limit")
+	// ErrTooDeep 元素嵌套超出深度上限
+	ErrTooDeep = errors.New("xml nesting exceeds the depth limit")
+	// ErrDTD 请求体包含DOCTYPE或其他DTD声明，拒绝以避免外部实体和实体展开
+	ErrDTD = errors.New("xml DTD declarations are not allowed")
+	// ErrCharset 不支持的字符集（415）
+	ErrCharset = errors.New("unsupported xml charset")
+	// ErrMalformed 请求体不是格式正确的XML
+	ErrMalformed = errors.New("malformed xml")
+)
+
+// Limits DAV请求体的XML限制，所有读取请求体的方法都通过ReadBody读取
+type Limits struct {
+	// MaxBodySize 请求体的最大字节数（转码前），0表示使用默认值
+	MaxBodySize int64
+	// MaxDepth 元素的最大嵌套深度，0表示使用默认值
+	MaxDepth int
+}
+
+// DefaultLimits 未配置时使用的限制
+var DefaultLimits = Limits{MaxBodySize: 1 << 20, MaxDepth: 64}
+
+// encodingDeclaration XML声明中的encoding
+var encodingDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// ReadBody 读取请求体，转换为UTF-8并检查DTD和嵌套深度。charset为Content-Type的字符集参数，
+// 为空时依次按BOM和XML声明判断编码。没有请求体时返回空结果
+func (l Limits) ReadBody(r io.Reader, charset string) ([]byte, error) {
+	maxBodySize := l.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultLimits.MaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	if body, err = toUTF8(body, charset); err != nil {
+		return nil, err
+	}
+	if err := l.check(body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Decode 读取、检查并解析请求体
+func (l Limits) Decode(r io.Reader, charset string, v interface{}) error {
+	body, err := l.ReadBody(r, charset)
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		return fmt.Errorf("%w: empty body", ErrMalformed)
+	}
+	return Unmarshal(body, v)
+}
+
+// toUTF8 按Content-Type字符集、BOM或XML声明把请求体转换为UTF-8
+func toUTF8(body []byte, charset string) ([]byte, error) {
+	if charset == "" {
+		if bytes.HasPrefix(body, []byte{0xFE, 0xFF}) || bytes.HasPrefix(body, []byte{0xFF, 0xFE}) || bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}) {
+			decoded, _, err := transform.Bytes(unicode.BOMOverride(encoding.Nop.NewDecoder()), body)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCharset, err)
+			}
+			return decoded, nil
+		}
+		if m := encodingDeclaration.FindSubmatch(body); m != nil {
+			charset = string(m[1])
+		}
+	}
+	if charset == "" {
+		return body, nil
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCharset, charset)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return body, nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCharset, err)
+	}
+	return decoded, nil
+}
+
+// check 逐个token检查：拒绝DTD声明（DOCTYPE、ENTITY），限制嵌套深度，并确认格式正确
+func (l Limits) check(body []byte) error {
+	maxDepth := l.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultLimits.MaxDepth
+	}
+	decoder := NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		switch token.(type) {
+		case xml.Directive:
+			return ErrDTD
+		case xml.StartElement:
+			depth++
+			if depth > maxDepth {
+				return ErrTooDeep
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// NewDecoder 创建解析ReadBody结果的解码器。内容已经转换为UTF-8，XML声明中的编码不再转换
+func NewDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
+
+// Unmarshal 解析ReadBody返回的请求体
+func Unmarshal(data []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
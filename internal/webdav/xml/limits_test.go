@@ -0,0 +1,62 @@
+package xml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimits_ReadBody(t *testing.T) {
+	limits := Limits{MaxBodySize: 256, MaxDepth: 4}
+
+	tests := []struct {
+		name    string
+		body    string
+		charset string
+		want    error
+	}{
+		{"plain", `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`, "", nil},
+		{"doctype", `<?xml version="1.0"?><!DOCTYPE x [<!ENTITY e SYSTEM "file:///etc/passwd">]><x>&e;</x>`, "", ErrDTD},
+		{"undeclared entity", `<x>&e;</x>`, "", ErrMalformed},
+		{"too deep", `<a><b><c><d><e/></d></c></b></a>`, "", ErrTooDeep},
+		{"too large", "<a>" + strings.Repeat("x", 300) + "</a>", "", ErrBodyTooLarge},
+		{"unknown charset", `<a/>`, "x-unknown", ErrCharset},
+		{"mismatched tags", `<a></b>`, "", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := limits.ReadBody(strings.NewReader(tt.body), tt.charset)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReadBody() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimits_Charsets(t *testing.T) {
+	var v struct {
+		Value string `xml:"value"`
+	}
+
+	latin1 := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><r><value>caf\xe9</value></r>"
+	if err := DefaultLimits.Decode(strings.NewReader(latin1), "", &v); err != nil || v.Value != "café" {
+		t.Errorf("declared latin-1: value %q, error %v", v.Value, err)
+	}
+
+	if err := DefaultLimits.Decode(strings.NewReader("<r><value>caf\xe9</value></r>"), "iso-8859-1", &v); err != nil || v.Value != "café" {
+		t.Errorf("Content-Type latin-1: value %q, error %v", v.Value, err)
+	}
+
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range "<r><value>文档</value></r>" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	if err := DefaultLimits.Decode(strings.NewReader(string(utf16)), "", &v); err != nil || v.Value != "文档" {
+		t.Errorf("UTF-16 with BOM: value %q, error %v", v.Value, err)
+	}
+
+	body, err := DefaultLimits.ReadBody(strings.NewReader(" \r\n"), "")
+	if err != nil || body != nil {
+		t.Errorf("blank body = %q, %v; want nil, nil", body, err)
+	}
+}
@@ -11,8 +11,8 @@ import (
 
 // ReadXMLBody 从HTTP请求体中读取XML数据，返回XML解码器
 func ReadXMLBody(r io.Reader) (*xml.Decoder, error) {
-	// 读取所有数据
-	body, err := io.ReadAll(r)
+	// 读取数据，检查大小、DTD和嵌套深度
+	body, err := DefaultLimits.ReadBody(r, "")
 	if err != nil {
 		return nil, fmt.Errorf("读取请求体失败: %v", err)
 	}
@@ -28,7 +28,7 @@ func ReadXMLBody(r io.Reader) (*xml.Decoder, error) {
 	}
 
 	// 创建XML解码器
-	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder := NewDecoder(bytes.NewReader(body))
 	
 	// 尝试解析XML结构以验证语法
 	var temp interface{}
@@ -37,7 +37,7 @@ func ReadXMLBody(r io.Reader) (*xml.Decoder, error) {
 	}
 
 	// 重新创建解码器供实际使用
-	decoder = xml.NewDecoder(bytes.NewReader(body))
+	decoder = NewDecoder(bytes.NewReader(body))
 	return decoder, nil
 }
 
@@ -54,10 +54,10 @@ func (s *Serializer) EncodeProppatchRequest(request *types.PropertyUpdateRequest
 	return buf.Bytes(), nil
 }
 
-// DecodeProppatchRequest 解码PROPPATCH请求
+// DecodeProppatchRequest 解码PROPPATCH请求，data为Limits.ReadBody的结果
 func (s *Serializer) DecodeProppatchRequest(data []byte) (*types.PropertyUpdateRequest, error) {
 	var request types.PropertyUpdateRequest
-	if err := xml.Unmarshal(data, &request); err != nil {
+	if err := Unmarshal(data, &request); err != nil {
 		return nil, fmt.Errorf("解码PROPPATCH请求失败: %v", err)
 	}
 	
@@ -367,7 +367,7 @@ func (p *XMLParser) SetResolver(resolver *NamespaceResolver) *XMLParser {
 
 // ReadBody 读取并验证请求体
 func (p *XMLParser) ReadBody(r io.Reader) ([]byte, error) {
-	body, err := io.ReadAll(r)
+	body, err := DefaultLimits.ReadBody(r, "")
 	if err != nil {
 		return nil, fmt.Errorf("读取请求体失败: %v", err)
 	}
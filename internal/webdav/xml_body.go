@@ -0,0 +1,47 @@
+package webdav
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/webdav-gateway/internal/config"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
+)
+
+// newXMLLimits 把配置转换为XML请求体限制
+func newXMLLimits(cfg config.XMLLimitsConfig) davxml.Limits {
+	return davxml.Limits{MaxBodySize: cfg.MaxBodySize, MaxDepth: cfg.MaxDepth}
+}
+
+// xmlBodyStatus XML请求体错误对应的状态码
+func xmlBodyStatus(err error) int {
+	switch {
+	case errors.Is(err, davxml.ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, davxml.ErrCharset):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// readXMLBody 读取DAV请求体并转换为UTF-8，超出大小或深度限制、包含DTD、字符集不支持或格式错误时
+// 发送错误状态并返回false。没有请求体时返回nil。结果用davxml.Unmarshal或davxml.NewDecoder解析
+func (h *Handler) readXMLBody(c *gin.Context) ([]byte, bool) {
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return nil, true
+	}
+	var charset string
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil {
+		charset = params["charset"]
+	}
+	body, err := h.xmlLimits.ReadBody(c.Request.Body, charset)
+	if err != nil {
+		c.Status(xmlBodyStatus(err))
+		return nil, false
+	}
+	return body, true
+}
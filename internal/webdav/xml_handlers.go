@@ -4,8 +4,10 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"strings"
 
 	webdavtypes "github.com/webdav-gateway/internal/types"
+	davxml "github.com/webdav-gateway/internal/webdav/xml"
 )
 
 // WebDAV XML 请求结构
@@ -29,16 +31,6 @@ type PropResponse struct {
 	LockDiscovery []ActiveLock `xml:"D:lockdiscovery>D:activelock"`
 }
 
-// ErrorResponse WebDAV错误响应
-type ErrorResponse struct {
-	XMLName   xml.Name `xml:"D:error"`
-	Namespace string   `xml:"xmlns:D,attr"`
-	Condition ErrorConditionDetail
-}
-
-// ErrorConditionDetail 错误条件（使用统一类型）
-type ErrorConditionDetail = webdavtypes.LockErrorCondition
-
 // NoConflictingLock 冲突锁错误（使用统一类型）
 type NoConflictingLock = webdavtypes.NoConflictingLock
 
@@ -54,7 +46,7 @@ type LockTokenMismatch = webdavtypes.LockTokenMismatch
 func ParseLockInfo(body io.Reader) (*LockInfoRequest, error) {
 	var lockInfo LockInfoRequest
 
-	decoder := xml.NewDecoder(body)
+	decoder := davxml.NewDecoder(body)
 	if err := decoder.Decode(&lockInfo); err != nil {
 		return nil, fmt.Errorf("failed to parse lock info: %w", err)
 	}
@@ -66,7 +58,7 @@ func ParseLockInfo(body io.Reader) (*LockInfoRequest, error) {
 func ParseLockInfoFromBytes(data []byte) (*LockInfoRequest, error) {
 	var lockInfo LockInfoRequest
 
-	if err := xml.Unmarshal(data, &lockInfo); err != nil {
+	if err := davxml.Unmarshal(data, &lockInfo); err != nil {
 		return nil, fmt.Errorf("failed to parse lock info: %w", err)
 	}
 
@@ -90,46 +82,6 @@ func MarshalPropResponse(activeLocks []ActiveLock) ([]byte, error) {
 	return append([]byte(xml.Header), output...), nil
 }
 
-// MarshalErrorResponse 序列化错误响应
-func MarshalErrorResponse(condition ErrorConditionDetail) ([]byte, error) {
-	response := ErrorResponse{
-		Namespace: "DAV:",
-		Condition: condition,
-	}
-
-	output, err := xml.MarshalIndent(response, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal error response: %w", err)
-	}
-
-	return append([]byte(xml.Header), output...), nil
-}
-
-// CreateNoConflictingLockError 创建冲突锁错误
-func CreateNoConflictingLockError(conflictingPaths []string) webdavtypes.LockErrorCondition {
-	return webdavtypes.LockErrorCondition{
-		NoConflictingLock: &webdavtypes.NoConflictingLock{
-			Href: conflictingPaths,
-		},
-	}
-}
-
-// CreateLockTokenSubmittedError 创建未提交令牌错误
-func CreateLockTokenSubmittedError(lockedPaths []string) webdavtypes.LockErrorCondition {
-	return webdavtypes.LockErrorCondition{
-		LockTokenSubmitted: &webdavtypes.LockTokenSubmitted{
-			Href: lockedPaths,
-		},
-	}
-}
-
-// CreateLockTokenMismatchError 创建令牌不匹配错误
-func CreateLockTokenMismatchError() webdavtypes.LockErrorCondition {
-	return webdavtypes.LockErrorCondition{
-		LockTokenMismatch: &webdavtypes.LockTokenMismatch{},
-	}
-}
-
 // If 头解析
 
 // IfHeader If头部结构
@@ -246,29 +198,25 @@ func ValidateIfHeader(ifHeader string, validTokens []string) (bool, string) {
 
 // Timeout 头解析
 
-// ParseTimeout 解析Timeout头部
+// ParseTimeout 解析Timeout头部，返回秒数；未指定或无法解析时返回0，由LockManager按策略使用默认有效期
 func ParseTimeout(timeoutHeader string) int64 {
-	if timeoutHeader == "" {
-		return 3600 // 默认1小时
-	}
-
-	// 支持格式：Second-3600, Infinite
-	if timeoutHeader == "Infinite" || timeoutHeader == "infinite" {
-		return 86400 * 365 // 1年
-	}
+	// 客户端可以按优先顺序给出多个值（RFC 4918 10.7），如Windows WebClient发送的"Infinite, Second-4100000000"，取第一个可识别的值
+	for _, value := range strings.Split(timeoutHeader, ",") {
+		value = strings.TrimSpace(value)
 
-	// 解析 Second-XXX 格式
-	var seconds int64
-	_, err := fmt.Sscanf(timeoutHeader, "Second-%d", &seconds)
-	if err != nil {
-		return 3600 // 默认1小时
-	}
+		// 支持格式：Second-3600, Infinite
+		if strings.EqualFold(value, "Infinite") {
+			return 86400 * 365 // 1年，由策略的最长有效期截断
+		}
 
-	if seconds <= 0 {
-		return 3600
+		// 解析 Second-XXX 格式
+		var seconds int64
+		if _, err := fmt.Sscanf(value, "Second-%d", &seconds); err == nil && seconds > 0 {
+			return seconds
+		}
 	}
 
-	return seconds
+	return 0
 }
 
 // Depth 头解析
@@ -308,7 +256,7 @@ func CreateActiveLockResponse(lock *Lock, requestURL string) ActiveLock {
 			Write: &struct{}{},
 		},
 		Depth:   FormatDepth(lock.Depth),
-		Owner:   lock.Owner,
+		Owner:   lock.OwnerInfo,
 		Timeout: fmt.Sprintf("Second-%d", lock.Timeout),
 		LockToken: LockToken{
 			Href: lock.Token,
@@ -120,10 +120,10 @@ func (p *ProppatchXMLParser) ParsePropertyFromContent(userID, resourcePath strin
 
 // ReadXMLBody 从HTTP请求体中读取XML数据
 func (p *ProppatchXMLParser) ReadXMLBody(r io.Reader) ([]byte, *PropertyError) {
-	body, err := io.ReadAll(r)
+	body, err := xml.DefaultLimits.ReadBody(r, "")
 	if err != nil {
 		return nil, &PropertyError{
-			Code:        400,
+			Code:        xmlBodyStatus(err),
 			Message:     "读取请求体失败",
 			Description: err.Error(),
 		}
@@ -421,6 +421,9 @@ func ExtractCustomPropertiesFromResponse(response Response) map[string]string {
 		for key, value := range propstat.Prop.CustomProperties {
 			customProps[key] = value
 		}
+		for _, prop := range propstat.Prop.DeadProperties {
+			customProps[prop.Key()] = prop.Value
+		}
 	}
 	
 	return customProps